@@ -1,10 +1,13 @@
 package bin
 
 import (
+	"context"
 	"encoding/json"
 	"os"
+	"os/signal"
 	"runtime/pprof"
 	"sync"
+	"syscall"
 	"time"
 
 	"fmt"
@@ -83,6 +86,22 @@ func stopCPUProfile() {
 	}
 }
 
+// interruptContext returns a context that is canceled on the first SIGINT or
+// SIGTERM. The signals are then no longer caught, so that a second one kills
+// the process.
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		log.Warnf("received %s, stopping the scan and flushing the output", sig)
+		cancel()
+	}()
+	return ctx
+}
+
 // ZGrab2Main should be called by func main() in a binary. The caller is
 // responsible for importing any modules in use. This allows clients to easily
 // include custom sets of scan modules by creating new main packages with custom
@@ -91,9 +110,11 @@ func ZGrab2Main() {
 	startCPUProfile()
 	defer stopCPUProfile()
 	defer dumpHeapProfile()
-	_, moduleType, flag, err := zgrab2.ParseCommandLine(os.Args[1:])
+	if err := zgrab2.LoadPlugins(); err != nil {
+		log.Fatal(err)
+	}
+	posArgs, moduleType, flag, err := zgrab2.ParseCommandLine(os.Args[1:])
 
-	// Blanked arg is positional arguments
 	if err != nil {
 		// Outputting help is returned as an error. Exit successfuly on help output.
 		flagsErr, ok := err.(*flags.Error)
@@ -105,6 +126,34 @@ func ZGrab2Main() {
 		log.Fatalf("could not parse flags: %s", err)
 	}
 
+	if s, ok := flag.(*zgrab2.SchemaCommand); ok {
+		if err := s.Print(os.Stdout, posArgs); err != nil {
+			log.Fatalf("could not print schema: %s", err)
+		}
+		return
+	}
+
+	if v, ok := flag.(*zgrab2.VerifyCommand); ok {
+		if err := v.Run(os.Stdout, posArgs[0]); err != nil {
+			log.Fatalf("verification failed: %s", err)
+		}
+		return
+	}
+
+	if d, ok := flag.(*zgrab2.DiffCommand); ok {
+		if err := d.Run(os.Stdout, posArgs[0], posArgs[1]); err != nil {
+			log.Fatalf("could not compare scans: %s", err)
+		}
+		return
+	}
+
+	if st, ok := flag.(*zgrab2.SelfTestCommand); ok {
+		if err := st.Run(os.Stdout, selfTests, posArgs); err != nil {
+			log.Fatalf("self-test failed: %s", err)
+		}
+		return
+	}
+
 	if m, ok := flag.(*zgrab2.MultipleCommand); ok {
 		iniParser := zgrab2.NewIniParser()
 		var modTypes []string
@@ -126,6 +175,7 @@ func ZGrab2Main() {
 			s := mod.NewScanner()
 			s.Init(f)
 			zgrab2.RegisterScan(s.GetName(), s)
+			zgrab2.RegisterScanCondition(s.GetName(), f)
 		}
 	} else {
 		mod := zgrab2.GetModule(moduleType)
@@ -138,18 +188,35 @@ func ZGrab2Main() {
 	monitor.Callback = func(_ string) {
 		dumpHeapProfile()
 	}
+	var dashboard *zgrab2.Dashboard
+	if zgrab2.DashboardEnabled() {
+		dashboard = zgrab2.StartDashboard(monitor)
+	}
+	progress := zgrab2.StartProgressReporter(monitor)
 	start := time.Now()
 	log.Infof("started grab at %s", start.Format(time.RFC3339))
-	zgrab2.Process(monitor)
+	ctx := interruptContext()
+	zgrab2.ProcessContext(ctx, monitor)
 	end := time.Now()
 	log.Infof("finished grab at %s", end.Format(time.RFC3339))
 	monitor.Stop()
 	wg.Wait()
+	if dashboard != nil {
+		dashboard.Stop()
+	}
+	progress.Stop()
 	s := Summary{
 		StatusesPerModule: monitor.GetStatuses(),
 		StartTime:         start.Format(time.RFC3339),
 		EndTime:           end.Format(time.RFC3339),
 		Duration:          end.Sub(start).String(),
+		Interrupted:       ctx.Err() != nil,
+	}
+	if throttling := monitor.Throttling(); throttling.Delayed > 0 {
+		s.Throttling = &throttling
+	}
+	if skipped := monitor.Skipped(); skipped != (zgrab2.SkipStats{}) {
+		s.Skipped = &skipped
 	}
 	enc := json.NewEncoder(zgrab2.GetMetaFile())
 	if err := enc.Encode(&s); err != nil {
@@ -9,6 +9,8 @@ import (
 	"github.com/zmap/zgrab2/modules/fox"
 	"github.com/zmap/zgrab2/modules/ftp"
 	"github.com/zmap/zgrab2/modules/http"
+	"github.com/zmap/zgrab2/modules/http3"
+	"github.com/zmap/zgrab2/modules/identify"
 	"github.com/zmap/zgrab2/modules/imap"
 	"github.com/zmap/zgrab2/modules/ipp"
 	"github.com/zmap/zgrab2/modules/modbus"
@@ -36,6 +38,8 @@ func init() {
 		"fox":      &fox.Module{},
 		"ftp":      &ftp.Module{},
 		"http":     &http.Module{},
+		"http3":    &http3.Module{},
+		"identify": &identify.Module{},
 		"imap":     &imap.Module{},
 		"ipp":      &ipp.Module{},
 		"modbus":   &modbus.Module{},
@@ -0,0 +1,215 @@
+package bin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	nethttp "net/http"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/testserver"
+	"github.com/zmap/zgrab2/modules/banner"
+	"github.com/zmap/zgrab2/modules/http"
+	"github.com/zmap/zgrab2/modules/rsync"
+)
+
+// httpExchange answers a single HTTP request.
+var httpExchange = []testserver.Step{
+	testserver.Exchange(`^GET / HTTP/1\.1\r\n(?s:.*?)\r\n\r\n`, "HTTP/1.1 200 OK\r\nServer: zgrab2-selftest\r\nContent-Type: text/plain\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello"),
+}
+
+// ntpResponse answers an NTP client request with a server response from a
+// stratum 2 server.
+func ntpResponse(request []byte) []byte {
+	if len(request) < 48 || request[0]&0x07 != 3 {
+		return nil
+	}
+	response := make([]byte, 48)
+	response[0] = 0x1c // leap indicator 0, version 3, mode 4 (server)
+	response[1] = 2
+	copy(response[12:16], []byte{192, 0, 2, 1})
+	copy(response[24:32], request[40:48])
+	return response
+}
+
+// httpRoutes returns a handler answering the HTTP requests of a connection
+// with the JSON document of their path in routes, or a 404.
+func httpRoutes(routes map[string]string) func(conn net.Conn) error {
+	return func(conn net.Conn) error {
+		reader := bufio.NewReader(conn)
+		for {
+			req, err := nethttp.ReadRequest(reader)
+			if err != nil {
+				// The client closed the connection.
+				return nil
+			}
+			io.Copy(io.Discard, req.Body)
+			status := "200 OK"
+			body, ok := routes[req.URL.Path]
+			if !ok {
+				status, body = "404 Not Found", "{}"
+			}
+			fmt.Fprintf(conn, "HTTP/1.1 %s\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", status, len(body), body)
+		}
+	}
+}
+
+// zookeeperCommand answers the four-letter-word command sent on conn.
+func zookeeperCommand(conn net.Conn) error {
+	cmd := make([]byte, 4)
+	if _, err := io.ReadFull(conn, cmd); err != nil {
+		return err
+	}
+	switch string(cmd) {
+	case "ruok":
+		conn.Write([]byte("imok"))
+	case "srvr":
+		conn.Write([]byte("Zookeeper version: 3.8.1-74db005175a4ec545697012f9069cb9dcc8cdda7, built on 2023-01-25 16:31 UTC\nMode: standalone\nNode count: 5\n"))
+	default:
+		conn.Write([]byte(string(cmd) + " is not executed because it is not in the whitelist.\n"))
+	}
+	return nil
+}
+
+// selfTests are the scans run by the selftest command, each against a fake
+// server of the module's protocol.
+var selfTests = concatSelfTests(
+	serviceSelfTests,
+	databaseSelfTests,
+	icsSelfTests,
+	networkSelfTests,
+	remoteSelfTests,
+	applicationSelfTests,
+)
+
+// concatSelfTests returns the concatenation of lists of self-tests.
+func concatSelfTests(lists ...[]zgrab2.SelfTest) []zgrab2.SelfTest {
+	var ret []zgrab2.SelfTest
+	for _, list := range lists {
+		ret = append(ret, list...)
+	}
+	return ret
+}
+
+// serviceSelfTests are the self-tests of the banner, mail, web and other
+// service modules.
+var serviceSelfTests = []zgrab2.SelfTest{
+	{
+		Module: "banner",
+		Server: testserver.Config{Banner: []byte("SSH-2.0-OpenSSH_8.9p1\r\n")},
+		Configure: func(flags interface{}) {
+			f := flags.(*banner.Flags)
+			f.Probe, f.Pattern = `\n`, `^SSH-2\.0-`
+		},
+		Expect: "OpenSSH_8.9p1",
+	},
+	{
+		Module: "ftp",
+		Server: testserver.Config{Banner: []byte("220 (vsFTPd 3.0.5)\r\n")},
+		Expect: "vsFTPd 3.0.5",
+	},
+	{
+		Module: "smtp",
+		Server: testserver.Config{Banner: []byte("220 mail.example.com ESMTP Postfix\r\n")},
+		Expect: "ESMTP Postfix",
+	},
+	{
+		Module: "pop3",
+		Server: testserver.Config{Banner: []byte("+OK Dovecot ready.\r\n")},
+		Expect: "Dovecot ready",
+	},
+	{
+		Module: "imap",
+		Server: testserver.Config{Banner: []byte("* OK [CAPABILITY IMAP4rev1 STARTTLS] Dovecot ready.\r\n")},
+		Expect: "Dovecot ready",
+	},
+	{
+		Module: "telnet",
+		Server: testserver.Config{Banner: []byte("\xff\xfd\x18Ubuntu 22.04 LTS\r\nlogin: "), KeepOpen: true},
+		Expect: "login:",
+	},
+	{
+		Module: "redis",
+		Server: testserver.Config{Script: []testserver.Step{
+			testserver.Exchange(`PING\r\n`, "+PONG\r\n"),
+			testserver.Exchange(`INFO\r\n`, "$46\r\n# Server\r\nredis_version:7.0.11\r\nredis_mode:x\r\n\r\n"),
+			testserver.Exchange(`NONEXISTENT\r\n`, "-ERR unknown command 'NONEXISTENT'\r\n"),
+			testserver.Exchange(`QUIT\r\n`, "+OK\r\n"),
+		}},
+		Expect: "7.0.11",
+	},
+	{
+		Module: "http",
+		Server: testserver.Config{Script: httpExchange},
+		Expect: "zgrab2-selftest",
+	},
+	{
+		Name:   "http (https)",
+		Module: "http",
+		Server: testserver.Config{TLS: true, Script: httpExchange},
+		Configure: func(flags interface{}) {
+			flags.(*http.Flags).UseHTTPS = true
+		},
+		Expect: "zgrab2-selftest",
+	},
+	{
+		Module: "tls",
+		Server: testserver.Config{TLS: true},
+		Expect: "zgrab2 test server",
+	},
+	{
+		Module: "ntp",
+		UDP:    ntpResponse,
+		Expect: `"stratum":2`,
+	},
+	{
+		Module: "vnc",
+		Server: testserver.Config{
+			Banner: []byte("RFB 003.008\n"),
+			Script: []testserver.Step{testserver.Exchange(`^RFB 003\.008\n`, "\x02\x01\x02")},
+		},
+		Expect: `"no_auth":true`,
+	},
+	{
+		Module: "rsync",
+		Server: testserver.Config{
+			Banner: []byte("@RSYNCD: 31.0 sha512 sha256 md5\n"),
+			Script: []testserver.Step{testserver.Exchange(`#list\n`, "Welcome to the mirror\n\npub            \tPublic files\n@RSYNCD: EXIT\n")},
+		},
+		Configure: func(flags interface{}) {
+			flags.(*rsync.Flags).MaxModules = 0
+		},
+		Expect: "Public files",
+	},
+	{
+		Module: "memcached",
+		Server: testserver.Config{Script: []testserver.Step{
+			testserver.Exchange(`^version\r\n`, "VERSION 1.6.21\r\n"),
+			testserver.Exchange(`^stats\r\n`, "STAT pid 42\r\nSTAT uptime 3600\r\nSTAT curr_connections 2\r\nEND\r\n"),
+		}},
+		Expect: "1.6.21",
+	},
+	{
+		Module: "zookeeper",
+		Server: testserver.Config{Handler: zookeeperCommand},
+		Expect: "3.8.1",
+	},
+	{
+		Module: "docker",
+		Server: testserver.Config{Handler: httpRoutes(map[string]string{
+			"/version": `{"Version":"24.0.5","ApiVersion":"1.43","MinAPIVersion":"1.12","Os":"linux","Arch":"amd64"}`,
+			"/info":    `{"Containers":3,"Images":7,"OperatingSystem":"Ubuntu 22.04.3 LTS"}`,
+		})},
+		Expect: "24.0.5",
+	},
+	{
+		Module: "elasticsearch",
+		Server: testserver.Config{Handler: httpRoutes(map[string]string{
+			"/":                `{"name":"node-1","cluster_name":"search","version":{"number":"8.9.0"},"tagline":"You Know, for Search"}`,
+			"/_cluster/health": `{"cluster_name":"search","status":"green","number_of_nodes":1}`,
+			"/_cat/indices":    `[{"health":"green","index":"logs","docs.count":"42"}]`,
+		})},
+		Expect: "8.9.0",
+	},
+}
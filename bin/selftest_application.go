@@ -0,0 +1,217 @@
+package bin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/testserver"
+	"github.com/zmap/zgrab2/modules/probe"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// amqpStart is the Connection.Start frame of a RabbitMQ server.
+func amqpStart() []byte {
+	longString := func(s string) []byte {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(len(s)))
+		return append(b, s...)
+	}
+	var properties []byte
+	for _, p := range [][2]string{{"product", "RabbitMQ"}, {"version", "3.12.2"}, {"platform", "Erlang/OTP 25.3"}} {
+		properties = append(append(append(properties, byte(len(p[0]))), p[0]...), 'S')
+		properties = append(properties, longString(p[1])...)
+	}
+	// Class Connection, method Start, version 0-9.
+	payload := []byte{0, 10, 0, 10, 0, 9}
+	payload = append(payload, longString(string(properties))...)
+	payload = append(payload, longString("PLAIN AMQPLAIN")...)
+	payload = append(payload, longString("en_US")...)
+	frame := make([]byte, 7)
+	frame[0] = 1 // method frame
+	binary.BigEndian.PutUint32(frame[3:], uint32(len(payload)))
+	return append(append(frame, payload...), 0xce)
+}
+
+// gitRefs is the reference advertisement of a git daemon.
+func gitRefs() string {
+	var refs bytes.Buffer
+	for _, line := range []string{
+		"6f2e3c1d4b5a69788796a5b4c3d2e1f00a1b2c3d HEAD\x00multi_ack thin-pack side-band ofs-delta symref=HEAD:refs/heads/main agent=git/2.39.2\n",
+		"6f2e3c1d4b5a69788796a5b4c3d2e1f00a1b2c3d refs/heads/main\n",
+	} {
+		fmt.Fprintf(&refs, "%04x%s", 4+len(line), line)
+	}
+	refs.WriteString("0000")
+	return refs.String()
+}
+
+// grpcUnimplemented runs an HTTP/2 server answering each gRPC call with the
+// UNIMPLEMENTED status, as a server without the reflection service does.
+func grpcUnimplemented(conn net.Conn) error {
+	if _, err := io.ReadFull(conn, make([]byte, len(http2.ClientPreface))); err != nil {
+		return err
+	}
+	framer := http2.NewFramer(conn, conn)
+	if err := framer.WriteSettings(http2.Setting{ID: http2.SettingMaxConcurrentStreams, Val: 100}); err != nil {
+		return err
+	}
+	var headers bytes.Buffer
+	encoder := hpack.NewEncoder(&headers)
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			// The client closed the connection.
+			return nil
+		}
+		switch f := frame.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				framer.WriteSettingsAck()
+			}
+		case *http2.DataFrame:
+			if !f.StreamEnded() {
+				continue
+			}
+			headers.Reset()
+			for _, field := range [][2]string{{":status", "200"}, {"content-type", "application/grpc"}, {"grpc-status", "12"}, {"grpc-message", "unknown service"}} {
+				encoder.WriteField(hpack.HeaderField{Name: field[0], Value: field[1]})
+			}
+			err := framer.WriteHeaders(http2.HeadersFrameParam{StreamID: f.StreamID, BlockFragment: headers.Bytes(), EndStream: true, EndHeaders: true})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// ippAttributes answers the Get-Printer-Attributes request of the client with
+// the versions supported by an IPP Everywhere printer.
+func ippAttributes() string {
+	var body []byte
+	attribute := func(tag byte, name, value string) {
+		body = append(body, tag, byte(len(name)>>8), byte(len(name)))
+		body = append(body, name...)
+		body = append(body, byte(len(value)>>8), byte(len(value)))
+		body = append(body, value...)
+	}
+	// Version 2.1, status successful-ok, request ID 1.
+	body = append(body, 2, 1, 0, 0, 0, 0, 0, 1)
+	body = append(body, 0x01)
+	attribute(0x47, "attributes-charset", "utf-8")
+	attribute(0x48, "attributes-natural-language", "en")
+	body = append(body, 0x04)
+	attribute(0x44, "ipp-versions-supported", "1.1")
+	attribute(0x44, "", "2.0")
+	attribute(0x44, "", "2.1")
+	attribute(0x45, "printer-uri-supported", "ipp://127.0.0.1/ipp/print")
+	body = append(body, 0x03)
+	return fmt.Sprintf("HTTP/1.1 200 OK\r\nServer: IPP/2.1 Selftest\r\nContent-Type: application/ipp\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// http3VersionNegotiation answers the Initial packets of the client with a
+// Version Negotiation packet, as a server not supporting QUIC version 1
+// does.
+func http3VersionNegotiation(request []byte) []byte {
+	if len(request) < 7 || request[0]&0x80 == 0 || binary.BigEndian.Uint32(request[1:]) == 0 || len(request) < 7+int(request[5]) {
+		return nil
+	}
+	dcid := request[6 : 6+int(request[5])]
+	rest := request[6+len(dcid):]
+	if len(rest) < 1+int(rest[0]) {
+		return nil
+	}
+	scid := rest[1 : 1+int(rest[0])]
+	response := []byte{0xc0, 0, 0, 0, 0}
+	response = append(append(response, byte(len(scid))), scid...)
+	response = append(append(response, byte(len(dcid))), dcid...)
+	// draft-29 and version 2.
+	return append(response, 0xff, 0x00, 0x00, 0x1d, 0x6b, 0x33, 0x43, 0xcf)
+}
+
+// probeSignatures are the probes loaded by the self-test of the probe module.
+const probeSignatures = "Probe TCP NULL q||\n" +
+	"totalwaitms 1000\n" +
+	"match ssh m|^SSH-([\\d.]+)-OpenSSH_([\\w._-]+)\\r?\\n| p/OpenSSH/ v/$2/ i/protocol $1/\n"
+
+// applicationSelfTests are the self-tests of the messaging, source control,
+// RPC, cluster, printing and service identification modules.
+var applicationSelfTests = []zgrab2.SelfTest{
+	{
+		Module: "amqp",
+		Server: testserver.Config{Script: []testserver.Step{testserver.Exchange(`^AMQP\x00\x00\x09\x01`, string(amqpStart()))}},
+		Expect: `"version":"3.12.2"`,
+	},
+	{
+		Module: "mqtt",
+		Server: testserver.Config{Script: []testserver.Step{testserver.Exchange(`^\x10(?s:.)+zgrab2`, "\x20\x02\x00\x00")}},
+		Expect: `"accepted":true`,
+	},
+	{
+		Module: "git",
+		Server: testserver.Config{Script: []testserver.Step{testserver.Exchange(`git-upload-pack /\x00host=127\.0\.0\.1\x00`, gitRefs())}},
+		Expect: `"agent":"git/2.39.2"`,
+	},
+	{
+		Module: "grpc",
+		Server: testserver.Config{Handler: grpcUnimplemented},
+		Expect: `"grpc_status":"UNIMPLEMENTED"`,
+	},
+	{
+		Module: "etcd",
+		Server: testserver.Config{Handler: httpRoutes(map[string]string{
+			"/version":                `{"etcdserver":"3.5.9","etcdcluster":"3.5.0"}`,
+			"/v3/maintenance/status":  `{"header":{"cluster_id":"14841639068965178418","member_id":"10276657743932975437","raft_term":"2"},"version":"3.5.9","dbSize":"20480","leader":"10276657743932975437","raftTerm":"2"}`,
+			"/v3/cluster/member/list": `{"header":{},"members":[{"ID":"10276657743932975437","name":"selftest","peerURLs":["http://127.0.0.1:2380"],"clientURLs":["http://127.0.0.1:2379"]}]}`,
+		})},
+		Expect: `"server_version":"3.5.9"`,
+	},
+	{
+		Module: "k8s",
+		Server: testserver.Config{TLS: true, Handler: httpRoutes(map[string]string{
+			"/version": `{"major":"1","minor":"28","gitVersion":"v1.28.2","platform":"linux/amd64"}`,
+			"/healthz": `ok`,
+		})},
+		Expect: "v1.28.2",
+	},
+	{
+		Module: "ipp",
+		Server: testserver.Config{Script: []testserver.Step{testserver.Exchange(`^POST /ipp HTTP/1\.1\r\n(?s:.*?)\r\n\r\n(?s:.*)attributes-natural-language`, ippAttributes())}},
+		Expect: `"version_string":"IPP/2.1"`,
+	},
+	{
+		Module: "http3",
+		UDP:    http3VersionNegotiation,
+		Status: zgrab2.SCAN_PROTOCOL_ERROR,
+		Expect: `"supported_versions":["draft-29","2"]`,
+	},
+	{
+		Module: "jarm",
+		Server: testserver.Config{TLS: true},
+		// The server hello of a TLS 1.2 ClientHello.
+		Expect: `|0303||`,
+	},
+	{
+		Module: "identify",
+		Server: testserver.Config{Banner: []byte("SSH-2.0-OpenSSH_9.6\r\n"), KeepOpen: true},
+		Expect: `"service":"ssh"`,
+	},
+	{
+		Module: "probe",
+		Server: testserver.Config{Banner: []byte("SSH-2.0-OpenSSH_9.6\r\n"), KeepOpen: true},
+		Configure: func(flags interface{}) {
+			// The nmap-service-probes file may not be installed.
+			path := filepath.Join(os.TempDir(), "zgrab2-selftest-probes")
+			ioutil.WriteFile(path, []byte(probeSignatures), 0644)
+			flags.(*probe.Flags).ProbesFile = path
+		},
+		Expect: `"product":"OpenSSH"`,
+	},
+}
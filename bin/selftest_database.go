@@ -0,0 +1,273 @@
+package bin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/ber"
+	"github.com/zmap/zgrab2/lib/testserver"
+	"github.com/zmap/zgrab2/modules/mongodb"
+	"github.com/zmap/zgrab2/modules/mssql"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// mysqlHandshake is the initial handshake packet of a MySQL 8 server, without
+// TLS support.
+func mysqlHandshake() []byte {
+	var body bytes.Buffer
+	body.WriteString("\x0a8.0.34-selftest\x00\x01\x00\x00\x00")
+	body.WriteString("01234567")
+	flags := uint32(1 | 1<<9 | 1<<13 | 1<<15 | 1<<19 | 1<<21)
+	body.Write([]byte{0, byte(flags), byte(flags >> 8), 33, 2, 0, byte(flags >> 16), byte(flags >> 24), 21})
+	body.Write(make([]byte, 10))
+	body.WriteString("89abcdefghij\x00mysql_native_password\x00")
+	header := make([]byte, 4)
+	binary.LittleEndian.PutUint32(header, uint32(body.Len()))
+	return append(header, body.Bytes()...)
+}
+
+// postgresMessage encodes a server message.
+func postgresMessage(msgType byte, body string) []byte {
+	header := make([]byte, 5)
+	header[0] = msgType
+	binary.BigEndian.PutUint32(header[1:], uint32(len(body)+4))
+	return append(header, body...)
+}
+
+// postgresStartup refuses SSL, then answers the startup message of each
+// connection with an error: that of an unsupported protocol version, or else
+// that of a missing user name.
+func postgresStartup(conn net.Conn) error {
+	for {
+		var length [4]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil
+		}
+		body := make([]byte, binary.BigEndian.Uint32(length[:])-4)
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return err
+		}
+		if len(body) == 4 && binary.BigEndian.Uint32(body) == 80877103 {
+			// SSLRequest
+			conn.Write([]byte("N"))
+			continue
+		}
+		msg := "SFATAL\x00C28000\x00Mno PostgreSQL user name specified in startup packet\x00Fpostmaster.c\x00L2258\x00\x00"
+		if len(body) < 4 || binary.BigEndian.Uint32(body) != 3<<16 {
+			msg = "SFATAL\x00C0A000\x00Munsupported frontend protocol: server supports 3.0 to 3.0\x00Fpostmaster.c\x00L2136\x00\x00"
+		}
+		_, err := conn.Write(postgresMessage('E', msg))
+		return err
+	}
+}
+
+// mssqlPrelogin answers the PRELOGIN message with the version of SQL Server
+// 2019, without encryption.
+func mssqlPrelogin(conn net.Conn) error {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, binary.BigEndian.Uint16(header[2:4])-8)); err != nil {
+		return err
+	}
+	options := mssql.PreloginOptions{
+		mssql.PreloginVersion:    {15, 0, 0x07, 0xd0, 0, 0},
+		mssql.PreloginEncryption: {mssql.EncryptModeNotSupported},
+	}
+	body, err := options.Encode()
+	if err != nil {
+		return err
+	}
+	packet := &mssql.TDSPacket{
+		TDSHeader: mssql.TDSHeader{Type: mssql.TDSPacketTypeTabularResult, Status: mssql.TDSStatusEOM},
+		Body:      body,
+	}
+	encoded, err := packet.Encode()
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(encoded)
+	return err
+}
+
+// mongodbReply writes doc in an OP_REPLY, or in an OP_MSG.
+func mongodbReply(w io.Writer, opCode int, doc interface{}) error {
+	payload, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	if opCode == mongodb.OP_REPLY {
+		body = append(make([]byte, 20), payload...)
+		binary.LittleEndian.PutUint32(body[16:], 1)
+	} else {
+		body = append(make([]byte, 5), payload...)
+	}
+	header := make([]byte, mongodb.MSGHEADER_LEN)
+	binary.LittleEndian.PutUint32(header[0:], uint32(mongodb.MSGHEADER_LEN+len(body)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(opCode))
+	_, err = w.Write(append(header, body...))
+	return err
+}
+
+// mongodbBuildInfo answers the isMaster query, and then the buildInfo
+// command.
+func mongodbBuildInfo(conn net.Conn) error {
+	replies := []struct {
+		opCode int
+		doc    bson.M
+	}{
+		{mongodb.OP_REPLY, bson.M{"ismaster": true, "maxWireVersion": 7, "ok": 1}},
+		{mongodb.OP_MSG, bson.M{"version": "4.0.28", "gitVersion": "af1a9dc12adcfa83cc19571cb3faba26eeddac92", "ok": 1}},
+	}
+	for _, reply := range replies {
+		header := make([]byte, mongodb.MSGHEADER_LEN)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, make([]byte, binary.LittleEndian.Uint32(header)-mongodb.MSGHEADER_LEN)); err != nil {
+			return err
+		}
+		if err := mongodbReply(conn, reply.opCode, reply.doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// oracleRefuse refuses the Connect packet of the client with the error of an
+// unknown service, as the listener of Oracle 11.2.0.4 does.
+func oracleRefuse(conn net.Conn) error {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, binary.BigEndian.Uint16(header)-8)); err != nil {
+		return err
+	}
+	data := "(DESCRIPTION=(TMP=)(VSNNUM=186647552)(ERR=12514)(ERROR_STACK=(ERROR=(CODE=12514)(EMFI=4))))"
+	packet := make([]byte, 12, 12+len(data))
+	binary.BigEndian.PutUint16(packet[0:], uint16(cap(packet)))
+	packet[4] = 4 // Refuse
+	packet[8], packet[9] = 0x22, 0x00
+	binary.BigEndian.PutUint16(packet[10:], uint16(len(data)))
+	_, err := conn.Write(append(packet, data...))
+	return err
+}
+
+// ldapRead reads an LDAP message from the client.
+func ldapRead(r io.Reader) (ber.Element, error) {
+	msg := make([]byte, 2)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return ber.Element{}, err
+	}
+	length := int(msg[1])
+	if length&0x80 != 0 {
+		lengthBytes := make([]byte, length&0x7f)
+		if _, err := io.ReadFull(r, lengthBytes); err != nil {
+			return ber.Element{}, err
+		}
+		msg = append(msg, lengthBytes...)
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | int(b)
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return ber.Element{}, err
+	}
+	e, _, err := ber.Decode(append(msg, body...))
+	return e, err
+}
+
+// ldapRootDSE accepts the bind of the client, and answers its search of the
+// root DSE.
+func ldapRootDSE(conn net.Conn) error {
+	const (
+		bindRequest       = ber.ClassApplication | ber.Constructed | 0
+		bindResponse      = ber.ClassApplication | ber.Constructed | 1
+		searchRequest     = ber.ClassApplication | ber.Constructed | 3
+		searchResultEntry = ber.ClassApplication | ber.Constructed | 4
+		searchResultDone  = ber.ClassApplication | ber.Constructed | 5
+	)
+	result := func(tag byte) []byte {
+		return ber.Encode(tag, ber.Encode(ber.TagEnumerated, []byte{0}), ber.EncodeString(nil), ber.EncodeString(nil))
+	}
+	attr := func(name, value string) []byte {
+		return ber.Encode(ber.TagSequence, ber.EncodeString([]byte(name)), ber.Encode(ber.TagSet, ber.EncodeString([]byte(value))))
+	}
+	for {
+		msg, err := ldapRead(conn)
+		if err != nil {
+			return nil
+		}
+		children, err := msg.Children()
+		if err != nil || len(children) < 2 {
+			return err
+		}
+		id, _ := children[0].Int()
+		var ops [][]byte
+		switch children[1].Tag {
+		case bindRequest:
+			ops = [][]byte{result(bindResponse)}
+		case searchRequest:
+			ops = [][]byte{
+				ber.Encode(searchResultEntry, ber.EncodeString(nil), ber.Encode(ber.TagSequence,
+					attr("namingContexts", "DC=selftest,DC=example"),
+					attr("supportedLDAPVersion", "3"),
+					attr("dnsHostName", "dc1.selftest.example"),
+				)),
+				result(searchResultDone),
+			}
+		default:
+			return nil
+		}
+		for _, op := range ops {
+			if _, err := conn.Write(ber.Encode(ber.TagSequence, ber.EncodeInt(id), op)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// databaseSelfTests are the self-tests of the database modules.
+var databaseSelfTests = []zgrab2.SelfTest{
+	{
+		Module: "mysql",
+		Server: testserver.Config{Banner: mysqlHandshake()},
+		Expect: "8.0.34-selftest",
+	},
+	{
+		Module: "postgres",
+		Server: testserver.Config{Handler: postgresStartup},
+		Expect: "no PostgreSQL user name specified",
+	},
+	{
+		Module: "mssql",
+		Server: testserver.Config{Handler: mssqlPrelogin},
+		Configure: func(flags interface{}) {
+			flags.(*mssql.Flags).EncryptMode = "ENCRYPT_NOT_SUP"
+		},
+		Expect: `"version":"15.0.2000"`,
+	},
+	{
+		Module: "mongodb",
+		Server: testserver.Config{Handler: mongodbBuildInfo},
+		Expect: "4.0.28",
+	},
+	{
+		Module: "oracle",
+		Server: testserver.Config{Handler: oracleRefuse},
+		Expect: `"refuse_version":"11.2.0.4.0"`,
+	},
+	{
+		Module: "ldap",
+		Server: testserver.Config{Handler: ldapRootDSE},
+		Expect: "dc1.selftest.example",
+	},
+}
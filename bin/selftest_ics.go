@@ -0,0 +1,261 @@
+package bin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/testserver"
+	"github.com/zmap/zgrab2/modules/bacnet"
+	"github.com/zmap/zgrab2/modules/dnp3"
+)
+
+// modbusDeviceID answers the request of the basic device identification
+// objects, and refuses any other function.
+func modbusDeviceID(conn net.Conn) error {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return nil
+		}
+		data := make([]byte, binary.BigEndian.Uint16(header[4:])-2)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return err
+		}
+		function := header[7]
+		pdu := []byte{function | 0x80, 0x01}
+		if function == 0x2B && len(data) >= 2 && data[0] == 0x0E && data[1] == 0x01 {
+			pdu = append([]byte{function, 0x0E, 0x01, 0x01, 0, 0, 3}, "\x00\x08Selftest\x01\x06ST-PLC\x02\x04v1.0"...)
+		}
+		binary.BigEndian.PutUint16(header[4:], uint16(1+len(pdu)))
+		if _, err := conn.Write(append(header[:7], pdu...)); err != nil {
+			return err
+		}
+	}
+}
+
+// bacnetProperties answers the read of each property of a device object.
+func bacnetProperties(request []byte) []byte {
+	// BVLC, NPDU, APDU (type, segment sizes, invoke ID, service), and the
+	// object and property read.
+	if len(request) != 17 || request[0] != 0x81 {
+		return nil
+	}
+	stringValue := func(s string) []byte {
+		return append([]byte{0x75, byte(1 + len(s)), 0}, s...)
+	}
+	var value []byte
+	switch bacnet.PropertyID(request[16]) {
+	case bacnet.PID_OID:
+		value = []byte{0xc4, 0x02, 0x00, 0x01, 0x01}
+	case bacnet.PID_VENDOR_NUMBER:
+		value = []byte{0x21, 0xff}
+	case bacnet.PID_VENDOR_NAME:
+		value = stringValue("Selftest Controls")
+	case bacnet.PID_MODEL_NAME:
+		value = stringValue("ST-BAC 100")
+	default:
+		value = stringValue("")
+	}
+	response := []byte{0x81, 0x0a, 0, 0, 0x01, 0x00, 0x30, request[8], request[9]}
+	response = append(response, request[10:17]...)
+	response = append(append(append(response, 0x3e), value...), 0x3f)
+	binary.BigEndian.PutUint16(response[2:], uint16(len(response)))
+	return response
+}
+
+// dnp3LinkStatus answers the link status requests of the client with the
+// link status of outstation 1.
+func dnp3LinkStatus(conn net.Conn) error {
+	if _, err := conn.Read(make([]byte, 4096)); err != nil {
+		return err
+	}
+	status := []byte{0x05, 0x64, 0x05, 0x0b, 0x00, 0x00, 0x01, 0x00}
+	crc := make([]byte, 2)
+	binary.LittleEndian.PutUint16(crc, dnp3.Crc16(status))
+	_, err := conn.Write(append(status, crc...))
+	return err
+}
+
+// foxHello is the hello of a Niagara station.
+const foxHello = "fox a 0 -1 fox hello\n{\nfox.version=s:1.0.1\nid=i:1\nhostName=s:selftest\nhostAddress=s:127.0.0.1\n" +
+	"app.name=s:Station\napp.version=s:4.10.0.154\nvm.name=s:OpenJDK 64-Bit Server VM\nvm.version=s:25.302-b08\n" +
+	"os.name=s:Linux\nos.version=s:5.15\nstation.name=s:SelftestStation\nlang=s:en\ntimeZone=s:UTC;0;0;null;null\n" +
+	"hostId=s:Qnx-ST00-0000-0000-0000\nvmUuid=s:00000000-0000-0000-0000-000000000000\nbrandId=s:Selftest\n};;\n"
+
+// s7Identification answers the connection, the PDU negotiation and the
+// identification requests of an S7-300 PLC.
+func s7Identification(conn net.Conn) error {
+	s7 := func(pduType byte, params, data []byte) []byte {
+		header := []byte{0x32, pduType, 0, 0, 0, 0, 0, byte(len(params)), 0, byte(len(data))}
+		if pduType == 0x03 {
+			header = append(header, 0, 0)
+		}
+		return append(append(append([]byte{0x02, 0xf0, 0x80}, header...), params...), data...)
+	}
+	szl := func(records ...string) []byte {
+		data := make([]byte, 12)
+		for i, record := range records {
+			data = append(append(data, 0, byte(i+1)), record...)
+			data = append(data, make([]byte, 32-len(record))...)
+		}
+		return data
+	}
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return nil
+		}
+		request := make([]byte, binary.BigEndian.Uint16(header[2:])-4)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return err
+		}
+		var response []byte
+		switch {
+		case request[1] == 0xe0:
+			// Connection confirmation
+			response = []byte{0x11, 0xd0, 0x00, 0x04, 0x00, 0x01, 0x00, 0xc0, 0x01, 0x0a, 0xc1, 0x02, 0x01, 0x00, 0xc2, 0x02, 0x01, 0x02}
+		case len(request) > 4 && request[4] == 0x01:
+			// PDU negotiation
+			response = s7(0x03, []byte{0xf0, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0xf0}, nil)
+		case bytes.HasSuffix(request, []byte{0x00, 0x11, 0x00, 0x01}):
+			response = s7(0x07, nil, szl("6ES7 315-2EH14-0AB0"))
+		default:
+			response = s7(0x07, nil, szl("SIMATIC 300", "CPU 315-2 PN/DP", "", "Original Siemens Equipment", "S C-SELFTEST"))
+		}
+		binary.BigEndian.PutUint16(header[2:], uint16(4+len(response)))
+		if _, err := conn.Write(append(header, response...)); err != nil {
+			return err
+		}
+	}
+}
+
+// enipIdentity answers the ListIdentity and ListServices commands of the
+// client as a CompactLogix controller.
+func enipIdentity(conn net.Conn) error {
+	for {
+		header := make([]byte, 24)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return nil
+		}
+		if _, err := io.ReadFull(conn, make([]byte, binary.LittleEndian.Uint16(header[2:]))); err != nil {
+			return err
+		}
+		var itemType uint16
+		var item []byte
+		switch binary.LittleEndian.Uint16(header) {
+		case 0x0063:
+			// ListIdentity
+			name := "1769-L33ER/A LOGIX5333ER"
+			itemType, item = 0x000c, make([]byte, 33)
+			binary.LittleEndian.PutUint16(item, 1)
+			binary.BigEndian.PutUint16(item[2:], 2)
+			binary.BigEndian.PutUint16(item[4:], 44818)
+			copy(item[6:], net.IPv4(127, 0, 0, 1).To4())
+			binary.LittleEndian.PutUint16(item[18:], 1)
+			binary.LittleEndian.PutUint16(item[20:], 0x0e)
+			binary.LittleEndian.PutUint16(item[22:], 153)
+			item[24], item[25] = 30, 11
+			binary.LittleEndian.PutUint32(item[28:], 0x5e1f7e57)
+			item[32] = byte(len(name))
+			item = append(append(item, name...), 3)
+		case 0x0004:
+			// ListServices
+			itemType, item = 0x0100, make([]byte, 20)
+			binary.LittleEndian.PutUint16(item, 1)
+			binary.LittleEndian.PutUint16(item[2:], 0x0120)
+			copy(item[4:], "Communications")
+		}
+		data := make([]byte, 6)
+		binary.LittleEndian.PutUint16(data, 1)
+		binary.LittleEndian.PutUint16(data[2:], itemType)
+		binary.LittleEndian.PutUint16(data[4:], uint16(len(item)))
+		data = append(data, item...)
+		binary.LittleEndian.PutUint16(header[2:], uint16(len(data)))
+		if _, err := conn.Write(append(header, data...)); err != nil {
+			return err
+		}
+	}
+}
+
+// pndcpLookup answers the endpoint mapper lookup of the client with the
+// PROFINET device interface of an ET 200SP station, and no further entries.
+func pndcpLookup(request []byte) []byte {
+	const headerLength = 80
+	if len(request) != headerLength+40 || binary.LittleEndian.Uint16(request[68:]) != 2 {
+		return nil
+	}
+	var body []byte
+	u32 := func(v uint32) {
+		body = append(body, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+	}
+	annotation := "ET200SP                   6ES7 155-6AU01-0BN0      3 V  4  2  0\x00"
+	body = append(body, make([]byte, 20)...)
+	u32(1)
+	u32(1)
+	u32(0)
+	u32(1)
+	// The object UUID dea00000-6c97-11d1-8271-0001011c002a, and the
+	// interface dea00001-6c97-11d1-8271-00a02442df7d, in little-endian.
+	body = append(body, 0x00, 0x00, 0xa0, 0xde, 0x97, 0x6c, 0xd1, 0x11, 0x82, 0x71, 0x00, 0x01, 0x01, 0x1c, 0x00, 0x2a)
+	u32(3)
+	u32(0)
+	u32(uint32(len(annotation)))
+	body = append(body, annotation...)
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	tower := []byte{1, 0, 19, 0, 0x0d, 0x01, 0x00, 0xa0, 0xde, 0x97, 0x6c, 0xd1, 0x11, 0x82, 0x71, 0x00, 0xa0, 0x24, 0x42, 0xdf, 0x7d, 1, 0, 2, 0, 0, 0}
+	u32(uint32(len(tower)))
+	u32(uint32(len(tower)))
+	body = append(body, tower...)
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	u32(0)
+	response := append([]byte(nil), request[:headerLength]...)
+	response[1] = 2 // response
+	binary.LittleEndian.PutUint16(response[74:], uint16(len(body)))
+	return append(response, body...)
+}
+
+// icsSelfTests are the self-tests of the industrial control system modules.
+var icsSelfTests = []zgrab2.SelfTest{
+	{
+		Module: "modbus",
+		Server: testserver.Config{Handler: modbusDeviceID},
+		Expect: "Selftest",
+	},
+	{
+		Module: "bacnet",
+		UDP:    bacnetProperties,
+		Expect: "Selftest Controls",
+	},
+	{
+		Module: "dnp3",
+		Server: testserver.Config{Handler: dnp3LinkStatus},
+		Expect: `"is_dnp3":true`,
+	},
+	{
+		Module: "fox",
+		Server: testserver.Config{Script: []testserver.Step{testserver.Exchange("fox hello", foxHello)}},
+		Expect: `"station_name":"SelftestStation"`,
+	},
+	{
+		Module: "siemens",
+		Server: testserver.Config{Handler: s7Identification},
+		Expect: `"module_id":"6ES7 315-2EH14-0AB0"`,
+	},
+	{
+		Module: "enip",
+		Server: testserver.Config{Handler: enipIdentity},
+		Expect: "1769-L33ER/A LOGIX5333ER",
+	},
+	{
+		Module: "pndcp",
+		UDP:    pndcpLookup,
+		Expect: "6ES7 155-6AU01-0BN0",
+	},
+}
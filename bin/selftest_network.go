@@ -0,0 +1,293 @@
+package bin
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/ber"
+	"github.com/zmap/zgrab2/lib/testserver"
+	"github.com/zmap/zgrab2/modules/snmp"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsAnswer answers the A query of a recursive resolver.
+func dnsAnswer(query []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, RecursionDesired: h.RecursionDesired, RecursionAvailable: true})
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 300}, dnsmessage.AResource{A: [4]byte{93, 184, 216, 34}})
+	msg, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+// mdnsServices answers the query of the service types of a responder.
+func mdnsServices(query []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true})
+	b.StartAnswers()
+	name := dnsmessage.MustNewName("_services._dns-sd._udp.local.")
+	for _, service := range []string{"_ipp._tcp.local.", "_selftest._tcp.local."} {
+		b.PTRResource(dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: 10}, dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(service)})
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+// snmpSystem answers the v2c requests of the system group with the
+// community "public".
+func snmpSystem(request []byte) []byte {
+	msg, _, err := ber.Decode(request)
+	if err != nil {
+		return nil
+	}
+	fields, err := msg.Children()
+	if err != nil || len(fields) != 3 || string(fields[1].Value) != "public" {
+		return nil
+	}
+	pdu, err := fields[2].Children()
+	if err != nil || len(pdu) != 4 {
+		return nil
+	}
+	requestID, _ := pdu[0].Int()
+	bindings, err := pdu[3].Children()
+	if err != nil {
+		return nil
+	}
+	var varBinds [][]byte
+	for _, binding := range bindings {
+		vb, err := binding.Children()
+		if err != nil || len(vb) != 2 {
+			return nil
+		}
+		name, _ := vb[0].OID()
+		value := ber.Encode(0x80) // noSuchObject
+		switch name {
+		case "1.3.6.1.2.1.1.1.0":
+			value = ber.EncodeString([]byte("Linux selftest 5.15.0 #1 SMP x86_64"))
+		case "1.3.6.1.2.1.1.5.0":
+			value = ber.EncodeString([]byte("selftest"))
+		}
+		oid, _ := ber.ParseOID(name)
+		varBinds = append(varBinds, ber.Encode(ber.TagSequence, ber.EncodeOID(oid), value))
+	}
+	return ber.Encode(ber.TagSequence,
+		ber.EncodeInt(1),
+		ber.EncodeString([]byte("public")),
+		ber.Encode(0xa2, ber.EncodeInt(requestID), ber.EncodeInt(0), ber.EncodeInt(0), ber.Encode(ber.TagSequence, varBinds...)),
+	)
+}
+
+// ikeMainMode answers the IKEv1 main mode proposal of the client with the
+// AES-256, SHA2-256, PSK, MODP-2048 transform and a Dead Peer Detection
+// vendor ID.
+func ikeMainMode(request []byte) []byte {
+	if len(request) < 28 || request[17] != 0x10 || request[18] != 2 {
+		return nil
+	}
+	generic := func(next byte, body []byte) []byte {
+		header := []byte{next, 0, 0, 0}
+		binary.BigEndian.PutUint16(header[2:], uint16(4+len(body)))
+		return append(header, body...)
+	}
+	var attributes []byte
+	for _, attr := range [][2]uint16{{1, 7}, {14, 256}, {2, 4}, {3, 1}, {4, 14}, {11, 1}, {12, 28800}} {
+		attributes = append(attributes, byte(0x80|attr[0]>>8), byte(attr[0]), byte(attr[1]>>8), byte(attr[1]))
+	}
+	transform := generic(0, append([]byte{1, 1, 0, 0}, attributes...))
+	proposal := generic(0, append([]byte{1, 1, 0, 1}, transform...))
+	sa := generic(13, append([]byte{0, 0, 0, 1, 0, 0, 0, 1}, proposal...))
+	vid := generic(0, []byte{0xaf, 0xca, 0xd7, 0x13, 0x68, 0xa1, 0xf1, 0xc9, 0x6b, 0x86, 0x96, 0xfc, 0x77, 0x57, 0x01, 0x00})
+	header := make([]byte, 28)
+	copy(header, request[:8])
+	copy(header[8:], "selftest")
+	header[16], header[17], header[18] = 1, 0x10, 2
+	response := append(append(header, sa...), vid...)
+	binary.BigEndian.PutUint32(response[24:], uint32(len(response)))
+	return response
+}
+
+// openvpnReset answers the client reset with a server reset acknowledging it.
+func openvpnReset(request []byte) []byte {
+	if len(request) < 14 || request[0]>>3 != 7 {
+		return nil
+	}
+	response := []byte{8 << 3, 0x5e, 0x1f, 0x7e, 0x57, 0x00, 0x01, 0x02, 0x03, 1, 0, 0, 0, 0}
+	response = append(response, request[1:9]...)
+	return append(response, 0, 0, 0, 0)
+}
+
+// wireguardResponse answers the handshake initiation of the client with a
+// handshake response, as an endpoint configured with its public key does.
+func wireguardResponse(request []byte) []byte {
+	if len(request) != 148 || request[0] != 1 {
+		return nil
+	}
+	response := make([]byte, 92)
+	response[0] = 2
+	copy(response[4:8], "stst")
+	copy(response[8:12], request[4:8])
+	return response
+}
+
+// ipmiCapabilities answers the Get Channel Authentication Capabilities
+// command of the client as a BMC supporting only IPMI 1.5, with anonymous
+// login.
+func ipmiCapabilities(request []byte) []byte {
+	if len(request) != 23 || request[4] != 0 || request[19] != 0x38 {
+		return nil
+	}
+	checksum := func(data []byte) byte {
+		var sum byte
+		for _, b := range data {
+			sum += b
+		}
+		return -sum
+	}
+	msg := []byte{0x81, 0x07 << 2, 0, 0x20, 0, 0x38, 0}
+	msg[2] = checksum(msg[:2])
+	msg = append(msg, 0x01, 0x15, 0x1f, 0x00, 0, 0, 0, 0)
+	msg = append(msg, checksum(msg[3:]))
+	response := []byte{0x06, 0x00, 0xff, 0x07, 0, 0, 0, 0, 0, 0, 0, 0, 0, byte(len(msg))}
+	return append(response, msg...)
+}
+
+// ssdpResponse is the response of a MiniUPnP gateway to an M-SEARCH of the
+// root device.
+const ssdpResponse = "HTTP/1.1 200 OK\r\n" +
+	"CACHE-CONTROL: max-age=120\r\n" +
+	"ST: upnp:rootdevice\r\n" +
+	"USN: uuid:00000000-0000-0000-0000-000000000000::upnp:rootdevice\r\n" +
+	"EXT:\r\n" +
+	"SERVER: Linux/5.15 UPnP/1.1 MiniUPnPd/2.3.3\r\n" +
+	"LOCATION: http://127.0.0.1:5000/rootDesc.xml\r\n\r\n"
+
+// sipOptions answers the OPTIONS request of the client as Asterisk does.
+func sipOptions(request []byte) []byte {
+	if len(request) < 8 || string(request[:8]) != "OPTIONS " {
+		return nil
+	}
+	return []byte("SIP/2.0 200 OK\r\n" +
+		"Via: SIP/2.0/UDP 127.0.0.1:5060;branch=z9hG4bK1;rport=5060\r\n" +
+		"From: <sip:zgrab@127.0.0.1>;tag=1\r\n" +
+		"To: <sip:127.0.0.1>;tag=as5f2e1b3c\r\n" +
+		"Call-ID: 1\r\n" +
+		"CSeq: 1 OPTIONS\r\n" +
+		"Server: Asterisk PBX 20.5.0\r\n" +
+		"Allow: INVITE, ACK, CANCEL, OPTIONS, BYE\r\n" +
+		"Content-Length: 0\r\n\r\n")
+}
+
+// portmapDump answers the DUMP call of the client with the programs of an
+// NFS server.
+func portmapDump(conn net.Conn) error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	call := make([]byte, binary.BigEndian.Uint32(header)&0x7fffffff)
+	if _, err := io.ReadFull(conn, call); err != nil {
+		return err
+	}
+	var reply []byte
+	u32 := func(v uint32) {
+		reply = append(reply, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	// The XID, then an accepted successful reply with null verifier.
+	reply = append(reply, call[:4]...)
+	for _, v := range []uint32{1, 0, 0, 0, 0} {
+		u32(v)
+	}
+	for _, m := range [][4]uint32{{100000, 2, 6, 111}, {100005, 3, 6, 20048}, {100003, 4, 6, 2049}} {
+		u32(1)
+		for _, v := range m {
+			u32(v)
+		}
+	}
+	u32(0)
+	binary.BigEndian.PutUint32(header, 0x80000000|uint32(len(reply)))
+	_, err := conn.Write(append(header, reply...))
+	return err
+}
+
+// networkSelfTests are the self-tests of the name, management, VPN and
+// discovery modules.
+var networkSelfTests = []zgrab2.SelfTest{
+	{
+		Module: "dns",
+		UDP:    dnsAnswer,
+		Expect: "93.184.216.34",
+	},
+	{
+		Module: "mdns",
+		UDP:    mdnsServices,
+		Expect: "_selftest._tcp.local.",
+	},
+	{
+		Module: "snmp",
+		UDP:    snmpSystem,
+		Configure: func(flags interface{}) {
+			f := flags.(*snmp.Flags)
+			f.Communities, f.Versions = "public", "2c"
+		},
+		Expect: "Linux selftest 5.15.0",
+	},
+	{
+		Module: "ike",
+		UDP:    ikeMainMode,
+		Expect: "Dead Peer Detection v1.0",
+	},
+	{
+		Module: "openvpn",
+		UDP:    openvpnReset,
+		Expect: "P_CONTROL_HARD_RESET_SERVER_V2",
+	},
+	{
+		Module: "wireguard",
+		UDP:    wireguardResponse,
+		Expect: `"response":"handshake_response"`,
+	},
+	{
+		Module: "ipmi",
+		UDP:    ipmiCapabilities,
+		Expect: `"ipmi_1_5":true`,
+	},
+	{
+		Module: "ssdp",
+		UDP: func(request []byte) []byte {
+			return []byte(ssdpResponse)
+		},
+		Expect: "MiniUPnPd/2.3.3",
+	},
+	{
+		Module: "sip",
+		UDP:    sipOptions,
+		Expect: "Asterisk PBX 20.5.0",
+	},
+	{
+		Module: "nfs",
+		Server: testserver.Config{Handler: portmapDump},
+		Expect: `"name":"mountd"`,
+	},
+}
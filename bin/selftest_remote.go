@@ -0,0 +1,258 @@
+package bin
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	nethttp "net/http"
+	"strings"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/smb/gss"
+	"github.com/zmap/zgrab2/lib/smb/smb"
+	"github.com/zmap/zgrab2/lib/smb/smb/encoder"
+	"github.com/zmap/zgrab2/lib/ssh"
+	"github.com/zmap/zgrab2/lib/testserver"
+	"github.com/zmap/zgrab2/modules"
+	"github.com/zmap/zgrab2/modules/rdp"
+)
+
+// sshServer runs the handshake of an SSH server with a new ECDSA host key,
+// letting the client in without authentication.
+func sshServer(conn net.Conn) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return err
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true, ServerVersion: "SSH-2.0-OpenSSH_9.6p1 Selftest"}
+	config.AddHostKey(signer)
+	sshConn, _, _, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		// The client closes the connection once the handshake is done.
+		return nil
+	}
+	return sshConn.Close()
+}
+
+// rdpNLA answers the connection request of the client as a server requiring
+// network level authentication.
+func rdpNLA(conn net.Conn) error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	request := make([]byte, binary.BigEndian.Uint16(header[2:])-4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return err
+	}
+	// RDP_NEG_RSP selecting CredSSP, or RDP_NEG_FAILURE with
+	// HYBRID_REQUIRED_BY_SERVER.
+	neg := []byte{0x03, 0, 8, 0, 5, 0, 0, 0}
+	if len(request) >= 4 && binary.LittleEndian.Uint32(request[len(request)-4:])&0x02 != 0 {
+		neg = []byte{0x02, 0x01, 8, 0, 2, 0, 0, 0}
+	}
+	x224 := append([]byte{byte(6 + len(neg)), 0xd0, 0, 0, 0, 0, 0}, neg...)
+	binary.BigEndian.PutUint16(header[2:], uint16(4+len(x224)))
+	_, err := conn.Write(append(header, x224...))
+	return err
+}
+
+// x11Denied refuses the connection setup of the client, as an X server
+// requiring authorization does.
+func x11Denied(conn net.Conn) error {
+	if _, err := io.ReadFull(conn, make([]byte, 12)); err != nil {
+		return err
+	}
+	reason := "Authorization required, but no authorization protocol specified\n"
+	reply := make([]byte, 8)
+	reply[1] = byte(len(reason))
+	binary.LittleEndian.PutUint16(reply[2:], 11)
+	padded := (len(reason) + 3) / 4 * 4
+	binary.LittleEndian.PutUint16(reply[6:], uint16(padded/4))
+	reply = append(append(reply, reason...), make([]byte, padded-len(reason))...)
+	_, err := conn.Write(reply)
+	return err
+}
+
+// adbConnect answers the CNXN message of the client with the banner of an
+// emulator that does not require authentication.
+func adbConnect(conn net.Conn) error {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, binary.LittleEndian.Uint32(header[12:]))); err != nil {
+		return err
+	}
+	banner := "device::ro.product.name=sdk_gphone64_x86_64;ro.product.model=sdk_gphone64_x86_64;ro.product.device=emu64xa;features=shell_v2,cmd\x00"
+	const cnxn = 0x4e584e43
+	var sum uint32
+	for _, b := range []byte(banner) {
+		sum += uint32(b)
+	}
+	msg := make([]byte, 24)
+	binary.LittleEndian.PutUint32(msg[0:], cnxn)
+	binary.LittleEndian.PutUint32(msg[4:], 0x01000001)
+	binary.LittleEndian.PutUint32(msg[8:], 256*1024)
+	binary.LittleEndian.PutUint32(msg[12:], uint32(len(banner)))
+	binary.LittleEndian.PutUint32(msg[16:], sum)
+	binary.LittleEndian.PutUint32(msg[20:], cnxn^0xffffffff)
+	_, err := conn.Write(append(msg, banner...))
+	return err
+}
+
+// smbNegotiate answers the SMB2 NEGOTIATE request of the client, selecting
+// the SMB 3.1.1 dialect.
+func smbNegotiate(conn net.Conn) error {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(conn, length); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, binary.BigEndian.Uint32(length))); err != nil {
+		return err
+	}
+	blob, err := gss.NewNegTokenInit()
+	if err != nil {
+		return err
+	}
+	res := smb.NewNegotiateRes()
+	res.Header.ProtocolID = []byte(smb.ProtocolSmb2)
+	res.Header.StructureSize = 64
+	res.Header.Flags = 1 // response
+	res.StructureSize = 65
+	res.SecurityMode = smb.SecurityModeSigningEnabled
+	res.DialectRevision = 0x0311
+	res.Capabilities = smb.SMB2_CAP_DFS | smb.SMB2_CAP_LEASING | smb.SMB2_CAP_LARGE_MTU
+	res.MaxTransactSize, res.MaxReadSize, res.MaxWriteSize = 8<<20, 8<<20, 8<<20
+	res.SecurityBlob = &blob
+	buf, err := encoder.Marshal(res)
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(length, uint32(len(buf)))
+	_, err = conn.Write(append(length, buf...))
+	return err
+}
+
+// winrmIdentifyResponse is the answer of Windows to an unauthenticated
+// WS-Management Identify request.
+const winrmIdentifyResponse = `<s:Envelope xml:lang="en-US" xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Header/><s:Body>` +
+	`<wsmid:IdentifyResponse xmlns:wsmid="http://schemas.dmtf.org/wbem/wsman/identity/1/wsmanidentity.xsd">` +
+	`<wsmid:ProtocolVersion>http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd</wsmid:ProtocolVersion>` +
+	`<wsmid:ProductVendor>Microsoft Corporation</wsmid:ProductVendor>` +
+	`<wsmid:ProductVersion>OS: 0.0.0 SP: 0.0 Stack: 3.0</wsmid:ProductVersion>` +
+	`</wsmid:IdentifyResponse></s:Body></s:Envelope>`
+
+// winrmIdentify answers the Identify requests of a connection, and asks for
+// authentication for any other request.
+func winrmIdentify(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	for {
+		req, err := nethttp.ReadRequest(reader)
+		if err != nil {
+			// The client closed the connection.
+			return nil
+		}
+		io.Copy(io.Discard, req.Body)
+		if req.Header.Get("WSMANIDENTIFY") == "unauthenticated" {
+			fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nServer: Microsoft-HTTPAPI/2.0\r\nContent-Type: application/soap+xml;charset=UTF-8\r\nContent-Length: %d\r\n\r\n%s", len(winrmIdentifyResponse), winrmIdentifyResponse)
+			continue
+		}
+		fmt.Fprint(conn, "HTTP/1.1 401 Unauthorized\r\nServer: Microsoft-HTTPAPI/2.0\r\nWWW-Authenticate: Negotiate\r\nContent-Length: 0\r\n\r\n")
+	}
+}
+
+// checkpointTopology answers the two headers of the client with the names of
+// the firewall and of its management server.
+func checkpointTopology(conn net.Conn) error {
+	if _, err := io.ReadFull(conn, make([]byte, 8)); err != nil {
+		return err
+	}
+	if _, err := conn.Write([]byte("Y\x00\x00\x00")); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, 15)); err != nil {
+		return err
+	}
+	names := "CN=fw-selftest,O=mgmt-selftest..x7f5p3"
+	answer := make([]byte, 4)
+	binary.BigEndian.PutUint32(answer, uint32(len(names)+8))
+	_, err := conn.Write(append(append(answer, names...), make([]byte, 8)...))
+	return err
+}
+
+// epmdNames answers the NAMES request of the client with the nodes of a
+// RabbitMQ server.
+func epmdNames(conn net.Conn) error {
+	request := make([]byte, 3)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return err
+	}
+	_, err := conn.Write(append([]byte{0, 0, 0x11, 0x11}, "name rabbit at port 25672\n"...))
+	return err
+}
+
+// remoteSelfTests are the self-tests of the remote access and administration
+// modules.
+var remoteSelfTests = []zgrab2.SelfTest{
+	{
+		Module: "ssh",
+		Server: testserver.Config{Handler: sshServer},
+		Configure: func(flags interface{}) {
+			// The defaults of the algorithms are only set on the command
+			// line options.
+			f, defaults := flags.(*modules.SSHFlags), ssh.MakeSSHConfig()
+			f.HostKeyAlgorithms = strings.Join(defaults.HostKeyAlgorithms, ",")
+			f.KexAlgorithms = strings.Join(defaults.KeyExchanges, ",")
+			f.Ciphers = strings.Join(defaults.Ciphers, ",")
+		},
+		Expect: "SSH-2.0-OpenSSH_9.6p1 Selftest",
+	},
+	{
+		Module: "rdp",
+		Server: testserver.Config{Handler: rdpNLA},
+		Configure: func(flags interface{}) {
+			flags.(*rdp.Flags).NoTLS = true
+		},
+		Expect: `"nla_required":true`,
+	},
+	{
+		Module: "x11",
+		Server: testserver.Config{Handler: x11Denied},
+		Expect: "Authorization required",
+	},
+	{
+		Module: "adb",
+		Server: testserver.Config{Handler: adbConnect},
+		Expect: "sdk_gphone64_x86_64",
+	},
+	{
+		Module: "smb",
+		Server: testserver.Config{Handler: smbNegotiate},
+		Expect: "SMB 3.1.1",
+	},
+	{
+		Module: "winrm",
+		Server: testserver.Config{Handler: winrmIdentify},
+		Expect: "Microsoft Corporation",
+	},
+	{
+		Module: "checkpoint",
+		Server: testserver.Config{Handler: checkpointTopology, KeepOpen: true},
+		Expect: `"firewall_host":"fw-selftest"`,
+	},
+	{
+		Module: "epmd",
+		Server: testserver.Config{Handler: epmdNames},
+		Expect: `"name":"rabbit"`,
+	},
+}
@@ -8,4 +8,10 @@ type Summary struct {
 	StartTime         string                   `json:"start"`
 	EndTime           string                   `json:"end"`
 	Duration          string                   `json:"duration"`
+	Throttling        *zgrab2.ThrottleStats    `json:"throttling,omitempty"`
+	Skipped           *zgrab2.SkipStats        `json:"skipped,omitempty"`
+
+	// Interrupted is true if the scan was stopped by a signal before all
+	// targets were scanned.
+	Interrupted bool `json:"interrupted,omitempty"`
 }
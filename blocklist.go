@@ -0,0 +1,178 @@
+package zgrab2
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrBlocked is returned when dialing an address in the --blocklist-file.
+var ErrBlocked = NewScanError(SCAN_BLOCKED, errors.New("address is in the blocklist"))
+
+// ipRange is a range of addresses, in 16-byte form, first and last included.
+type ipRange struct {
+	first, last net.IP
+}
+
+// Blocklist is a set of networks that must not be scanned.
+type Blocklist struct {
+	// ranges are sorted, and do not overlap.
+	ranges []ipRange
+}
+
+// LoadBlocklist reads a blocklist from the named file (see ParseBlocklist).
+func LoadBlocklist(path string) (*Blocklist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseBlocklist(f)
+}
+
+// ParseBlocklist reads a blocklist with one IP address or CIDR block per
+// line. Everything after a # is a comment, and empty lines are ignored.
+func ParseBlocklist(r io.Reader) (*Blocklist, error) {
+	ret := new(Blocklist)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if ip := net.ParseIP(text); ip != nil {
+			ret.ranges = append(ret.ranges, ipRange{ip.To16(), ip.To16()})
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: can't parse %q as an IP address or CIDR block", line, text)
+		}
+		last := make(net.IP, len(ipnet.IP))
+		for i := range ipnet.IP {
+			last[i] = ipnet.IP[i] | ^ipnet.Mask[i]
+		}
+		ret.ranges = append(ret.ranges, ipRange{ipnet.IP.To16(), last.To16()})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	ret.merge()
+	return ret, nil
+}
+
+// merge sorts the ranges and joins those that overlap.
+func (b *Blocklist) merge() {
+	sort.Slice(b.ranges, func(i, j int) bool {
+		return bytes.Compare(b.ranges[i].first, b.ranges[j].first) < 0
+	})
+	var merged []ipRange
+	for _, r := range b.ranges {
+		if n := len(merged); n > 0 && bytes.Compare(r.first, merged[n-1].last) <= 0 {
+			if bytes.Compare(r.last, merged[n-1].last) > 0 {
+				merged[n-1].last = r.last
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	b.ranges = merged
+}
+
+// Contains returns true if ip is in one of the networks of the blocklist. A
+// nil Blocklist contains no address.
+func (b *Blocklist) Contains(ip net.IP) bool {
+	if b == nil || ip == nil {
+		return false
+	}
+	ip = ip.To16()
+	i := sort.Search(len(b.ranges), func(i int) bool {
+		return bytes.Compare(b.ranges[i].last, ip) >= 0
+	})
+	return i < len(b.ranges) && bytes.Compare(b.ranges[i].first, ip) <= 0
+}
+
+// checkAddress returns ErrBlocked if the host of address, an IP address with
+// an optional port, is in the blocklist.
+func (b *Blocklist) checkAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if b.Contains(net.ParseIP(host)) {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// targetFilter drops the input targets that are in the blocklist and, if
+// seen is not nil, those already read, counting them in the monitor. The seen
+// set is never pruned: it takes of the order of 100 bytes for each
+// distinct target of the input.
+type targetFilter struct {
+	blocklist *Blocklist
+	seen      map[string]struct{}
+	monitor   *Monitor
+}
+
+func newTargetFilter(config *Config, monitor *Monitor) *targetFilter {
+	ret := &targetFilter{blocklist: config.blocklist, monitor: monitor}
+	if config.Dedup {
+		ret.seen = make(map[string]struct{})
+	}
+	return ret
+}
+
+// allow returns true if target is to be scanned. It is not safe for
+// concurrent use.
+func (f *targetFilter) allow(target *ScanTarget) bool {
+	if f.blocklist.Contains(target.IP) {
+		if f.monitor != nil {
+			f.monitor.recordBlocked()
+		}
+		return false
+	}
+	if f.seen == nil {
+		return true
+	}
+	key := dedupKey(target)
+	if _, ok := f.seen[key]; ok {
+		if f.monitor != nil {
+			f.monitor.recordDuplicate()
+		}
+		return false
+	}
+	f.seen[key] = struct{}{}
+	return true
+}
+
+// dedupKey identifies everything that the scan of a target depends on: its
+// IP address and domain, its port, its virtual hosts, proxy and options, and
+// its tags, which select the scanners run on it. Targets differing in any of
+// those (e.g. two domains on the same IP) are scanned separately.
+func dedupKey(target *ScanTarget) string {
+	ip := ""
+	if target.IP != nil {
+		ip = target.IP.String()
+	}
+	port := ""
+	if target.Port != nil {
+		port = strconv.FormatUint(uint64(*target.Port), 10)
+	}
+	fields := []string{ip, strings.ToLower(target.Domain), port, strings.Join(target.VHosts, ","), target.Proxy, target.Tag, strings.Join(target.Tags, ",")}
+	if options := target.Options; options != nil {
+		fields = append(fields, options.Endpoint, options.Host, options.SNI, options.Credentials)
+	}
+	return strings.Join(fields, "|")
+}
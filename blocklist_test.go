@@ -0,0 +1,117 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBlocklist = `
+# reserved ranges
+192.0.2.0/28
+192.0.2.8/30 # inside the previous block
+198.51.100.7
+2001:db8::/126
+`
+
+func TestBlocklist(t *testing.T) {
+	blocklist, err := ParseBlocklist(strings.NewReader(testBlocklist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocklist.ranges) != 3 {
+		t.Errorf("got %d ranges; expected 3", len(blocklist.ranges))
+	}
+	for ip, expected := range map[string]bool{
+		"192.0.2.0":    true,
+		"192.0.2.15":   true,
+		"192.0.2.16":   false,
+		"198.51.100.6": false,
+		"198.51.100.7": true,
+		"198.51.100.8": false,
+		"2001:db8::3":  true,
+		"2001:db8::4":  false,
+		"10.0.0.1":     false,
+	} {
+		if blocklist.Contains(net.ParseIP(ip)) != expected {
+			t.Errorf("Contains(%s) != %v", ip, expected)
+		}
+	}
+	var empty *Blocklist
+	if empty.Contains(net.ParseIP("192.0.2.1")) {
+		t.Error("nil blocklist contains an address")
+	}
+	if _, err := ParseBlocklist(strings.NewReader("192.0.2.0/33\n")); err == nil {
+		t.Error("expected an error for an invalid CIDR block")
+	}
+}
+
+func TestDialBlocked(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	config.blocklist, _ = ParseBlocklist(strings.NewReader("127.0.0.0/8"))
+	defer func() { config.blocklist = nil }()
+
+	// The address of a domain is only known when dialing.
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	_, err = dialTimeoutConnection(context.Background(), nil, "tcp", net.JoinHostPort("localhost", port), time.Second, time.Second, time.Second, time.Second, 0)
+	if status := TryGetScanStatus(err); status != SCAN_BLOCKED {
+		t.Errorf("got status %s, error %v; expected %s", status, err, SCAN_BLOCKED)
+	}
+	_, err = NewDialer(nil).DialContext(context.Background(), "tcp", listener.Addr().String())
+	if status := TryGetScanStatus(err); status != SCAN_BLOCKED {
+		t.Errorf("got status %s, error %v from the Dialer; expected %s", status, err, SCAN_BLOCKED)
+	}
+}
+
+func TestDialBlockedByEngine(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	blocklist, _ := ParseBlocklist(strings.NewReader("127.0.0.0/8"))
+
+	// The blocklist of the Engine applies, while the global one is empty.
+	ctx := withConfig(context.Background(), &Config{blocklist: blocklist})
+	_, err = dialTimeoutConnection(ctx, nil, "tcp", listener.Addr().String(), time.Second, time.Second, time.Second, time.Second, 0)
+	if status := TryGetScanStatus(err); status != SCAN_BLOCKED {
+		t.Errorf("got status %s, error %v; expected %s", status, err, SCAN_BLOCKED)
+	}
+	_, err = NewDialer(nil).DialContext(ctx, "tcp", listener.Addr().String())
+	if status := TryGetScanStatus(err); status != SCAN_BLOCKED {
+		t.Errorf("got status %s, error %v from the Dialer; expected %s", status, err, SCAN_BLOCKED)
+	}
+	target := &ScanTarget{IP: net.ParseIP("127.0.0.1")}
+	_, err = target.OpenUDP(ctx, &BaseFlags{Port: 53, Timeout: time.Second}, nil)
+	if err != ErrBlocked {
+		t.Errorf("got error %v from OpenUDP; expected %v", err, ErrBlocked)
+	}
+}
+
+func TestTargetFilterDedup(t *testing.T) {
+	filter := newTargetFilter(&Config{Dedup: true}, nil)
+	ip := net.ParseIP("192.0.2.1")
+	for _, test := range []struct {
+		target  ScanTarget
+		allowed bool
+	}{
+		{ScanTarget{IP: ip, Domain: "a.com"}, true},
+		{ScanTarget{IP: ip, Domain: "b.com"}, true},
+		{ScanTarget{IP: ip, Domain: "A.com"}, false},
+		{ScanTarget{IP: ip}, true},
+		{ScanTarget{IP: ip, VHosts: []string{"c.com"}}, true},
+		{ScanTarget{IP: ip, Options: &TargetOptions{Endpoint: "/admin"}}, true},
+		{ScanTarget{IP: ip, Options: &TargetOptions{Endpoint: "/admin"}}, false},
+		{ScanTarget{IP: ip, Domain: "b.com"}, false},
+	} {
+		if allowed := filter.allow(&test.target); allowed != test.allowed {
+			t.Errorf("%+v: got allowed %v; expected %v", test.target, allowed, test.allowed)
+		}
+	}
+}
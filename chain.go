@@ -0,0 +1,161 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2/lib/diff"
+)
+
+// scanCondition restricts a scanner to the targets for which the response of
+// an earlier scanner (its --after) matches a condition (its --when).
+type scanCondition struct {
+	after string
+
+	// path is the dotted path of the value tested in the JSON encoding of
+	// the response; if it is empty, any response matches.
+	path   string
+	negate bool
+	value  string
+	re     *regexp.Regexp
+}
+
+// parseCondition parses the --after and --when options of a scanner. The
+// condition is one of PATH=VALUE, PATH!=VALUE or PATH~REGEXP, where PATH is a
+// dotted path in the JSON encoding of the response, such as status or
+// result.response.headers.server.
+func parseCondition(after, when string) (*scanCondition, error) {
+	c := &scanCondition{after: after}
+	when = strings.TrimSpace(when)
+	if when == "" {
+		return c, nil
+	}
+	if i := strings.IndexAny(when, "!=~"); i > 0 {
+		c.path = strings.TrimSpace(when[:i])
+		op := when[i : i+1]
+		rest := when[i+1:]
+		if op == "!" {
+			if !strings.HasPrefix(rest, "=") {
+				return nil, fmt.Errorf("invalid condition %q", when)
+			}
+			c.negate, rest = true, rest[1:]
+		}
+		c.value = strings.TrimSpace(rest)
+		if op == "~" {
+			re, err := regexp.Compile(c.value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid condition %q: %s", when, err)
+			}
+			c.re = re
+		}
+	}
+	if c.path == "" {
+		return nil, fmt.Errorf("invalid condition %q: expected PATH=VALUE, PATH!=VALUE or PATH~REGEXP", when)
+	}
+	return c, nil
+}
+
+// match returns true if res satisfies the condition.
+func (c *scanCondition) match(res ScanResponse) bool {
+	if c.path == "" {
+		return true
+	}
+	encoded, err := json.Marshal(res)
+	if err != nil {
+		return false
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return false
+	}
+	found := false
+	// A condition on a list holds if it holds for any of its elements, so
+	// that e.g. headers, which have a list of values, can be tested.
+	values := []interface{}{diff.Lookup(decoded, c.path)}
+	if list, ok := values[0].([]interface{}); ok {
+		values = list
+	}
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		s := fmt.Sprint(v)
+		if (c.re != nil && c.re.MatchString(s)) || (c.re == nil && s == c.value) {
+			found = true
+			break
+		}
+	}
+	return found != c.negate
+}
+
+// newCondition returns the condition given by the --after and --when options
+// of the named scanner, or nil if it has none. The scanner it runs after must
+// already be registered.
+func (e *Engine) newCondition(name string, flags interface{}) (*scanCondition, error) {
+	base := GetBaseFlags(flags)
+	if base == nil || (base.After == "" && base.When == "") {
+		return nil, nil
+	}
+	if base.After == "" {
+		return nil, fmt.Errorf("%s: --when requires --after", name)
+	}
+	if base.After == name || e.Scanner(base.After) == nil {
+		return nil, fmt.Errorf("%s: --after must name a scanner defined before it, not %q", name, base.After)
+	}
+	c, err := parseCondition(base.After, base.When)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return c, nil
+}
+
+// setCondition restricts the named scanner to the targets matching c.
+func (e *Engine) setCondition(name string, c *scanCondition) {
+	if c == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conditions == nil {
+		e.conditions = make(map[string]*scanCondition)
+	}
+	e.conditions[name] = c
+}
+
+// RegisterScanCondition restricts the named scanner, which must already be
+// registered, to the targets matching the --after and --when options in its
+// flags.
+func RegisterScanCondition(name string, flags interface{}) {
+	c, err := defaultEngine.newCondition(name, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defaultEngine.setCondition(name, c)
+}
+
+// condition returns the condition of the named scanner, or nil if it has
+// none.
+func (e *Engine) condition(name string) *scanCondition {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.conditions[name]
+}
+
+// ready returns whether the named scanner may run given the responses of the
+// scanners that ran so far, and whether it must wait for another scanner
+// that is still to run.
+func (e *Engine) ready(name string, results ...map[string]ScanResponse) (run bool, wait bool) {
+	c := e.condition(name)
+	if c == nil {
+		return true, false
+	}
+	for _, m := range results {
+		if res, ok := m[c.after]; ok {
+			return c.match(res), false
+		}
+	}
+	return false, true
+}
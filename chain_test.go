@@ -0,0 +1,91 @@
+package zgrab2
+
+import (
+	"net"
+	"testing"
+)
+
+func TestScanCondition(t *testing.T) {
+	res := ScanResponse{
+		Status: SCAN_SUCCESS,
+		Result: map[string]interface{}{
+			"headers": map[string][]string{"server": {"Apache-Coyote/1.1"}},
+			"port":    8080,
+		},
+	}
+	for when, expected := range map[string]bool{
+		"":                             true,
+		"status=success":               true,
+		"status != success":            false,
+		"status!=connection-timeout":   true,
+		"result.port=8080":             true,
+		"result.headers.server~Coyote": true,
+		"result.headers.server~nginx":  false,
+		"result.missing=1":             false,
+		"result.missing!=1":            true,
+	} {
+		c, err := parseCondition("http", when)
+		if err != nil {
+			t.Errorf("parseCondition(%q): %s", when, err)
+			continue
+		}
+		if c.match(res) != expected {
+			t.Errorf("condition %q matched = %v", when, !expected)
+		}
+	}
+	for _, when := range []string{"success", "=success", "status!success", "status~("} {
+		if _, err := parseCondition("http", when); err == nil {
+			t.Errorf("parseCondition(%q) succeeded", when)
+		}
+	}
+}
+
+func TestEngineConditions(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		config := &Config{}
+		config.Multiple.Parallel = parallel
+		config.Multiple.ContinueOnError = true
+		engine, _ := NewEngine(config)
+		engine.AddModule("test", new(engineTestModule))
+		newScanner := func(name, message, after, when string, fail bool) error {
+			flags, _ := engine.NewFlags("test")
+			testFlags := flags.(*engineTestFlags)
+			testFlags.Name, testFlags.Message, testFlags.Fail = name, message, fail
+			testFlags.After, testFlags.When = after, when
+			_, err := engine.NewScanner("test", flags)
+			return err
+		}
+		if err := newScanner("early", "", "first", "", false); err == nil {
+			t.Error("registered a scanner running after one that is not defined")
+		}
+		for _, err := range []error{
+			newScanner("first", "Apache Tomcat", "", "", false),
+			newScanner("failing", "", "", "", true),
+			newScanner("tomcat", "", "first", "result~Tomcat", false),
+			newScanner("nginx", "", "first", "result=nginx", false),
+			newScanner("retry", "", "failing", "status!=success", false),
+			// Scanners may be chained after one that is itself conditional.
+			newScanner("manager", "", "tomcat", "", false),
+			newScanner("admin", "", "nginx", "", false),
+		} {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		grab := engine.ScanTarget(ScanTarget{IP: net.ParseIP("192.0.2.1")})
+		for name, ran := range map[string]bool{
+			"first":   true,
+			"failing": true,
+			"tomcat":  true,
+			"nginx":   false,
+			"retry":   true,
+			"manager": true,
+			"admin":   false,
+		} {
+			if _, ok := grab.Data[name]; ok != ran {
+				t.Errorf("parallel=%v: scanner %s ran = %v", parallel, name, ok)
+			}
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// checkpointState is the content of a --resume state file.
+type checkpointState struct {
+	InputFile  string `json:"input_file"`
+	OutputFile string `json:"output_file"`
+
+	// Compression is the compression of the output file, if any.
+	Compression string `json:"compression,omitempty"`
+
+	// Completed is the number of input targets, counted from the start of
+	// the input, that are all done.
+	Completed uint64 `json:"completed"`
+
+	// Done lists the targets after the first Completed that are done, by
+	// their position in the input.
+	Done []uint64 `json:"done,omitempty"`
+
+	// Partial gives the number of records still to be output for the
+	// targets that have only some of theirs (see --connections-per-host) in
+	// the output file.
+	Partial map[uint64]int `json:"partial,omitempty"`
+
+	// OutputOffset is the size of the output file holding exactly the
+	// records of the done targets. A compressed output file ends there with
+	// a complete gzip member or zstd frame.
+	OutputOffset int64 `json:"output_offset"`
+
+	Updated string `json:"updated"`
+}
+
+// checkpoint tracks which targets of a scan have all their records written to
+// the output file, and saves them to a state file so that an interrupted scan
+// can be resumed. Records are attributed to targets by the order in which they
+// are sent to the output, which writes them in that order.
+//
+// A compressed output file is written as a sequence of gzip members or zstd
+// frames, which decompress as a single stream. The current one is ended when
+// the state is saved, so that the output file can be truncated to it; it only
+// ever holds complete records, the rest of a record being kept in tail until
+// the record is written in full.
+type checkpoint struct {
+	path        string
+	input       string
+	output      *os.File
+	compression string
+
+	// sendMu keeps the order of the records in the output queue in step with
+	// order.
+	sendMu sync.Mutex
+
+	mu        sync.Mutex
+	completed uint64
+	done      map[uint64]bool
+	partial   map[uint64]int
+	remaining map[uint64]int
+	runs      int
+	order     []uint64
+	written   int64
+	offset    int64
+	enc       *compressedWriter
+	tail      []byte
+}
+
+// openCheckpoint opens the state file at path and the output file it belongs
+// to. If the state file exists, the output file is truncated to the records of
+// the targets that are done, and further records are appended to it;
+// otherwise, the output file is created. Records are compressed with the given
+// compression, gzip, zstd or none.
+func openCheckpoint(path, input, output, compression string) (*checkpoint, error) {
+	c := &checkpoint{
+		path:        path,
+		input:       input,
+		compression: compression,
+		done:        make(map[uint64]bool),
+		partial:     make(map[uint64]int),
+		remaining:   make(map[uint64]int),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		if c.output, err = os.Create(output); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state checkpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if state.InputFile != input || state.OutputFile != output {
+		return nil, fmt.Errorf("%s is the state of a scan of %s into %s", path, state.InputFile, state.OutputFile)
+	}
+	if state.Compression == "" {
+		state.Compression = "none"
+	}
+	if state.Compression != compression {
+		return nil, fmt.Errorf("%s is the state of a scan with %s compression", path, state.Compression)
+	}
+	if c.output, err = os.OpenFile(output, os.O_RDWR, 0); err != nil {
+		return nil, err
+	}
+	if err := c.output.Truncate(state.OutputOffset); err != nil {
+		c.output.Close()
+		return nil, err
+	}
+	if _, err := c.output.Seek(state.OutputOffset, io.SeekStart); err != nil {
+		c.output.Close()
+		return nil, err
+	}
+	c.completed = state.Completed
+	for _, seq := range state.Done {
+		c.done[seq] = true
+	}
+	for seq, n := range state.Partial {
+		c.partial[seq] = n
+	}
+	c.written, c.offset = state.OutputOffset, state.OutputOffset
+	log.Infof("resuming scan: %d targets already done", c.completed+uint64(len(c.done)))
+	return c, nil
+}
+
+// pending returns the number of times the target at position seq in the input
+// is still to be scanned, out of runs, and records that it will produce as
+// many records.
+func (c *checkpoint) pending(seq uint64, runs int) int {
+	if c == nil {
+		return runs
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.runs = runs
+	if seq < c.completed || c.done[seq] {
+		return 0
+	}
+	if n, ok := c.partial[seq]; ok {
+		delete(c.partial, seq)
+		runs = n
+	}
+	c.remaining[seq] = runs
+	return runs
+}
+
+// send queues a record of the target at position seq for output.
+func (c *checkpoint) send(seq uint64, result []byte, queue chan<- []byte) {
+	if c == nil {
+		queue <- result
+		return
+	}
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	c.mu.Lock()
+	c.order = append(c.order, seq)
+	c.mu.Unlock()
+	queue <- result
+}
+
+// drop records that a record of the target at position seq will not be
+// output.
+func (c *checkpoint) drop(seq uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.finishLocked(seq)
+	c.mu.Unlock()
+}
+
+func (c *checkpoint) finishLocked(seq uint64) {
+	if c.remaining[seq]--; c.remaining[seq] > 0 {
+		return
+	}
+	delete(c.remaining, seq)
+	c.done[seq] = true
+	for c.done[c.completed] {
+		delete(c.done, c.completed)
+		c.completed++
+	}
+}
+
+// Write writes to the output file, and attributes each record completed by p
+// to its target.
+func (c *checkpoint) Write(p []byte) (int, error) {
+	if c.compression != "none" {
+		return c.writeCompressed(p)
+	}
+	n, err := c.output.Write(p)
+	c.mu.Lock()
+	for i, b := range p[:n] {
+		if b != '\n' || len(c.order) == 0 {
+			continue
+		}
+		c.finishLocked(c.order[0])
+		c.order = c.order[1:]
+		c.offset = c.written + int64(i) + 1
+	}
+	c.written += int64(n)
+	c.mu.Unlock()
+	return n, err
+}
+
+// writeCompressed compresses the records completed by p to the current gzip
+// member or zstd frame, starting one if needed, and attributes each to its
+// target. The rest of p is kept until its record is complete.
+func (c *checkpoint) writeCompressed(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := bytes.LastIndexByte(p, '\n') + 1
+	if end == 0 {
+		c.tail = append(c.tail, p...)
+		return len(p), nil
+	}
+	if c.enc == nil {
+		enc, err := newCompressedWriter(c.output, c.compression)
+		if err != nil {
+			return 0, err
+		}
+		c.enc = enc
+	}
+	if _, err := c.enc.Write(append(c.tail, p[:end]...)); err != nil {
+		return 0, err
+	}
+	c.tail = append(c.tail[:0], p[end:]...)
+	for _, b := range p[:end] {
+		if b == '\n' && len(c.order) > 0 {
+			c.finishLocked(c.order[0])
+			c.order = c.order[1:]
+		}
+	}
+	return len(p), nil
+}
+
+// endFrameLocked ends the current gzip member or zstd frame of a compressed
+// output file, which then holds exactly the records of the done targets.
+func (c *checkpoint) endFrameLocked() error {
+	if c.enc == nil {
+		return nil
+	}
+	err := c.enc.Close()
+	c.enc = nil
+	if err != nil {
+		return err
+	}
+	c.offset, err = c.output.Seek(0, io.SeekCurrent)
+	return err
+}
+
+// save syncs the output file, and writes the state file.
+func (c *checkpoint) save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	if err := c.endFrameLocked(); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	state := checkpointState{
+		InputFile:    c.input,
+		OutputFile:   c.output.Name(),
+		Completed:    c.completed,
+		OutputOffset: c.offset,
+		Updated:      time.Now().Format(time.RFC3339),
+	}
+	if c.compression != "none" {
+		state.Compression = c.compression
+	}
+	for seq := range c.done {
+		state.Done = append(state.Done, seq)
+	}
+	state.Partial = make(map[uint64]int)
+	for seq, n := range c.partial {
+		state.Partial[seq] = n
+	}
+	for seq, n := range c.remaining {
+		if n < c.runs {
+			state.Partial[seq] = n
+		}
+	}
+	c.mu.Unlock()
+	sort.Slice(state.Done, func(i, j int) bool { return state.Done[i] < state.Done[j] })
+
+	if err := c.output.Sync(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(&state)
+	if err != nil {
+		return err
+	}
+	// Replace the state file atomically, so that it is never left
+	// half-written.
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// saveEvery saves the state every interval until the returned function is
+// called.
+func (c *checkpoint) saveEvery(interval time.Duration) func() {
+	if c == nil || interval <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(interval)
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.save(); err != nil {
+					log.Errorf("could not save the scan state: %s", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(stop)
+	}
+}
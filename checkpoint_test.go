@@ -0,0 +1,139 @@
+package zgrab2
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zgrab2-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statePath := filepath.Join(dir, "state.json")
+	outputPath := filepath.Join(dir, "output.json")
+
+	c, err := openCheckpoint(statePath, "input.csv", outputPath, "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each target is scanned twice.
+	for seq := uint64(0); seq < 5; seq++ {
+		if runs := c.pending(seq, 2); runs != 2 {
+			t.Fatalf("pending(%d) = %d", seq, runs)
+		}
+	}
+	queue := make(chan []byte, 10)
+	w := bufio.NewWriter(c)
+	// Targets finish out of order; target 2 has no records, and target 3
+	// only one of its two.
+	for _, seq := range []uint64{1, 1, 4, 4, 3, 0, 0} {
+		c.send(seq, []byte{'0' + byte(seq)}, queue)
+	}
+	c.drop(2)
+	c.drop(2)
+	close(queue)
+	if err := OutputResults(w, queue); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+	// Written after the state is saved, as if the scan were interrupted.
+	c.send(3, []byte("3"), make(chan []byte, 1))
+	c.Write([]byte("3\n"))
+	c.output.Close()
+
+	if _, err := openCheckpoint(statePath, "other.csv", outputPath, "none"); err == nil {
+		t.Error("resumed a scan of another input")
+	}
+	resumed, err := openCheckpoint(statePath, "input.csv", outputPath, "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seq, runs := range []int{0, 0, 0, 1, 0, 2} {
+		if n := resumed.pending(uint64(seq), 2); n != runs {
+			t.Errorf("pending(%d) = %d; expected %d", seq, n, runs)
+		}
+	}
+	resumed.send(3, []byte("3"), make(chan []byte, 1))
+	resumed.Write([]byte("3\n"))
+	if resumed.completed != 5 || len(resumed.done) != 0 {
+		t.Errorf("completed %d, done %v; expected 5 targets completed", resumed.completed, resumed.done)
+	}
+	resumed.output.Close()
+	if data, _ := ioutil.ReadFile(outputPath); string(data) != "1\n1\n4\n4\n3\n0\n0\n3\n" {
+		t.Errorf("output %q", data)
+	}
+}
+
+func TestCheckpointCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zgrab2-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statePath := filepath.Join(dir, "state.json")
+
+	for _, name := range []string{"output.json.gz", "output.json.zst"} {
+		outputPath := filepath.Join(dir, name)
+		compression := compressionForName(name)
+		os.Remove(statePath)
+		c, err := openCheckpoint(statePath, "input.csv", outputPath, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for seq := uint64(0); seq < 3; seq++ {
+			c.pending(seq, 1)
+		}
+		c.send(0, nil, make(chan []byte, 1))
+		c.Write([]byte("0\n"))
+		if err := c.save(); err != nil {
+			t.Fatal(err)
+		}
+		// A record written in two parts, and one that is not complete when
+		// the scan is interrupted.
+		c.send(1, nil, make(chan []byte, 1))
+		c.Write([]byte("1"))
+		c.Write([]byte("1\n2"))
+		if err := c.save(); err != nil {
+			t.Fatal(err)
+		}
+		c.send(2, nil, make(chan []byte, 1))
+		c.Write([]byte("2\n"))
+		c.enc.flush()
+		c.output.Close()
+
+		if _, err := openCheckpoint(statePath, "input.csv", outputPath, "none"); err == nil {
+			t.Errorf("%s: resumed a scan with another compression", name)
+		}
+		resumed, err := openCheckpoint(statePath, "input.csv", outputPath, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := resumed.pending(2, 1); n != 1 || resumed.completed != 2 {
+			t.Errorf("%s: pending(2) = %d, completed %d", name, n, resumed.completed)
+		}
+		resumed.send(2, nil, make(chan []byte, 1))
+		resumed.Write([]byte("22\n"))
+		if err := resumed.save(); err != nil {
+			t.Fatal(err)
+		}
+		resumed.output.Close()
+
+		r, err := openOutputFile(outputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || string(data) != "0\n11\n22\n" {
+			t.Errorf("%s: read %q, %v", name, data, err)
+		}
+	}
+}
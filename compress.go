@@ -0,0 +1,173 @@
+package zgrab2
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressFlushInterval bounds how long compressed output may be held in the
+// encoder, and so lost if the process is killed, before it is written out.
+const compressFlushInterval = time.Second
+
+// outputCompression returns the compression of the output file: the given
+// --output-compression, or with auto, the one matching the extension of the
+// file name.
+func outputCompression(compression, name string) string {
+	if compression != "auto" && compression != "" {
+		return compression
+	}
+	return compressionForName(name)
+}
+
+// compressionForName returns the compression implied by the extension of a
+// file name.
+func compressionForName(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return "gzip"
+	case strings.HasSuffix(name, ".zst"):
+		return "zstd"
+	}
+	return "none"
+}
+
+// flushWriteCloser is a streaming encoder.
+type flushWriteCloser interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressedWriter compresses what is written to it. Everything written is
+// flushed to the underlying writer within compressFlushInterval, as a
+// complete block that can be decompressed even if the stream is never
+// closed.
+type compressedWriter struct {
+	mu     sync.Mutex
+	enc    flushWriteCloser
+	timer  *time.Timer
+	closed bool
+	err    error
+}
+
+// newCompressedWriter returns a writer compressing to w with the given
+// compression, gzip or zstd.
+func newCompressedWriter(w io.Writer, compression string) (*compressedWriter, error) {
+	var enc flushWriteCloser
+	var err error
+	switch compression {
+	case "gzip":
+		enc, err = gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	case "zstd":
+		enc, err = zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	default:
+		err = fmt.Errorf("unknown compression %q", compression)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &compressedWriter{enc: enc}, nil
+}
+
+// Write compresses p, and schedules a flush if none is pending.
+func (w *compressedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.enc.Write(p)
+	if err != nil {
+		w.err = err
+		return n, err
+	}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(compressFlushInterval, w.flush)
+	}
+	return n, nil
+}
+
+func (w *compressedWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timer = nil
+	if w.err == nil && !w.closed {
+		w.err = w.enc.Flush()
+	}
+}
+
+// Close ends the compressed stream. It does not close the underlying writer.
+func (w *compressedWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.closed = true
+	if err := w.enc.Close(); w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// closeAfterOutput returns an OutputResultsFunc that passes the results to
+// output, then closes c.
+func closeAfterOutput(output OutputResultsFunc, c io.Closer) OutputResultsFunc {
+	return func(results <-chan []byte) error {
+		err := output(results)
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+}
+
+// decompressedFile is an output file opened for reading, decompressed if its
+// name has a .gz or .zst extension.
+type decompressedFile struct {
+	io.Reader
+	file  *os.File
+	close func()
+}
+
+// openOutputFile opens an output file for reading, decompressing it if its
+// name has a .gz or .zst extension.
+func openOutputFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	ret := &decompressedFile{Reader: f, file: f}
+	switch compressionForName(name) {
+	case "gzip":
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		ret.Reader = zr
+	case "zstd":
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		ret.Reader, ret.close = zr, zr.Close
+	}
+	return ret, nil
+}
+
+// Close releases the decoder and closes the file.
+func (f *decompressedFile) Close() error {
+	if f.close != nil {
+		f.close()
+	}
+	return f.file.Close()
+}
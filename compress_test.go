@@ -0,0 +1,63 @@
+package zgrab2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputCompression(t *testing.T) {
+	tests := []struct {
+		compression, name, expected string
+	}{
+		{"auto", "out.json", "none"},
+		{"auto", "out.json.gz", "gzip"},
+		{"auto", "out.json.zst", "zstd"},
+		{"none", "out.json.gz", "none"},
+		{"zstd", "-", "zstd"},
+	}
+	for _, test := range tests {
+		if got := outputCompression(test.compression, test.name); got != test.expected {
+			t.Errorf("%s, %s: got %s, expected %s", test.compression, test.name, got, test.expected)
+		}
+	}
+}
+
+func TestCompressedOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zgrab2-compress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"out.json.gz", "out.json.zst"} {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := newCompressedWriter(f, compressionForName(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := make(chan []byte, 2)
+		results <- []byte(`{"ip":"10.0.0.1"}`)
+		results <- []byte(`{"ip":"10.0.0.2"}`)
+		close(results)
+		if err := closeAfterOutput(OutputResultsWriterFunc(w), w)(results); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		r, err := openOutputFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || string(data) != "{\"ip\":\"10.0.0.1\"}\n{\"ip\":\"10.0.0.2\"}\n" {
+			t.Errorf("%s: read %q, %v", name, data, err)
+		}
+	}
+}
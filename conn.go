@@ -5,6 +5,8 @@ import (
 	"errors"
 	"io"
 	"net"
+	"net/url"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -38,12 +40,21 @@ var (
 
 	// DefaultSessionTimeout is the default maximum time a connection may be used when no explicit value is provided.
 	DefaultSessionTimeout = 1 * time.Minute
+
+	// DefaultAdaptiveTimeoutFactor is the multiple of the connect time used as the read timeout with
+	// --adaptive-timeouts when no explicit factor is provided.
+	DefaultAdaptiveTimeoutFactor = 10.0
 )
 
 // ErrReadLimitExceeded is returned / panic'd from Read if the read limit is exceeded when the
 // ReadLimitExceededAction is error / panic.
 var ErrReadLimitExceeded = errors.New("read limit exceeded")
 
+// ErrSlowRead is returned from Read once a connection has been open for longer
+// than its read timeout, and has read less than MinReadRate bytes per second
+// on average.
+var ErrSlowRead = NewScanError(SCAN_IO_TIMEOUT, errors.New("read rate below minimum"))
+
 // TimeoutConnection wraps an existing net.Conn connection, overriding the Read/Write methods to use the configured timeouts
 // TODO: Refactor this into TimeoutConnection, BoundedReader, LoggedReader, etc
 type TimeoutConnection struct {
@@ -57,16 +68,24 @@ type TimeoutConnection struct {
 	BytesReadLimit          int
 	ReadLimitExceededAction ReadLimitExceededAction
 	Cancel                  context.CancelFunc
-	explicitReadDeadline    bool
-	explicitWriteDeadline   bool
-	explicitDeadline        bool
+
+	// MinReadRate, if positive, is the minimum average number of bytes per
+	// second to read once the connection has been open for longer than its
+	// read timeout, below which reads fail with ErrSlowRead.
+	MinReadRate int
+
+	// MaxResponseSize, if positive, is the maximum number of bytes of a
+	// response read from the connection by the shared read helpers.
+	MaxResponseSize int
+
+	opened                time.Time
+	explicitReadDeadline  bool
+	explicitWriteDeadline bool
+	explicitDeadline      bool
 }
 
 // TimeoutConnection.Read calls Read() on the underlying connection, using any configured deadlines
 func (c *TimeoutConnection) Read(b []byte) (n int, err error) {
-	if err := c.checkContext(); err != nil {
-		return 0, err
-	}
 	origSize := len(b)
 	if c.BytesRead+len(b) >= c.BytesReadLimit {
 		b = b[0 : c.BytesReadLimit-c.BytesRead]
@@ -79,6 +98,11 @@ func (c *TimeoutConnection) Read(b []byte) (n int, err error) {
 			return 0, err
 		}
 	}
+	// Check the context after setting the deadline, which would otherwise
+	// override the one set to interrupt the connection when it is canceled.
+	if err := c.checkContext(); err != nil {
+		return 0, err
+	}
 	n, err = c.Conn.Read(b)
 	c.BytesRead += n
 	if err == nil && origSize != len(b) && n == len(b) {
@@ -95,14 +119,57 @@ func (c *TimeoutConnection) Read(b []byte) (n int, err error) {
 			logrus.Fatalf("Unrecognized ReadLimitExceededAction: %s", c.ReadLimitExceededAction)
 		}
 	}
+	if err == nil && c.isSlow() {
+		return n, ErrSlowRead
+	}
 	return n, err
 }
 
+func (c *TimeoutConnection) maxResponseSize() int {
+	return c.MaxResponseSize
+}
+
+// isSlow returns true if the connection has been open for longer than its
+// read timeout, and has read less than MinReadRate bytes per second.
+func (c *TimeoutConnection) isSlow() bool {
+	if c.MinReadRate <= 0 || c.opened.IsZero() {
+		return false
+	}
+	elapsed := time.Since(c.opened)
+	if elapsed <= c.getTimeout(c.ReadTimeout) {
+		return false
+	}
+	return float64(c.BytesRead) < float64(c.MinReadRate)*elapsed.Seconds()
+}
+
+// adaptTimeouts shortens the read timeout of the connection, if
+// --adaptive-timeouts is set in config, to the one given by
+// adaptiveReadTimeout for a connection established in connectTime.
+func (c *TimeoutConnection) adaptTimeouts(config *Config, connectTime time.Duration) {
+	if !config.AdaptiveTimeouts {
+		return
+	}
+	timeout := adaptiveReadTimeout(connectTime, config.AdaptiveFactor, config.AdaptiveMin)
+	if current := c.getTimeout(c.ReadTimeout); current <= 0 || timeout < current {
+		c.ReadTimeout = timeout
+	}
+}
+
+// adaptiveReadTimeout returns the read timeout for a connection established
+// in connectTime: factor times the connect time, but at least min.
+func adaptiveReadTimeout(connectTime time.Duration, factor float64, min time.Duration) time.Duration {
+	if factor <= 0 {
+		factor = DefaultAdaptiveTimeoutFactor
+	}
+	ret := time.Duration(float64(connectTime) * factor)
+	if ret < min {
+		return min
+	}
+	return ret
+}
+
 // TimeoutConnection.Write calls Write() on the underlying connection, using any configured deadlines.
 func (c *TimeoutConnection) Write(b []byte) (n int, err error) {
-	if err := c.checkContext(); err != nil {
-		return 0, err
-	}
 	if c.explicitWriteDeadline || c.explicitDeadline {
 		c.explicitWriteDeadline = false
 		c.explicitDeadline = false
@@ -111,6 +178,9 @@ func (c *TimeoutConnection) Write(b []byte) (n int, err error) {
 			return 0, err
 		}
 	}
+	if err := c.checkContext(); err != nil {
+		return 0, err
+	}
 	n, err = c.Conn.Write(b)
 	c.BytesWritten += n
 	return n, err
@@ -173,6 +243,9 @@ func GetTimeoutDialFunc(timeout time.Duration) func(string, string) (net.Conn, e
 
 // Close the underlying connection.
 func (c *TimeoutConnection) Close() error {
+	if c.Cancel != nil {
+		c.Cancel()
+	}
 	return c.Conn.Close()
 }
 
@@ -217,29 +290,85 @@ func (c *TimeoutConnection) SetDefaults() *TimeoutConnection {
 }
 
 // NewTimeoutConnection returns a new TimeoutConnection with the appropriate defaults.
+// If ctx is canceled, any Read or Write in progress is interrupted, and those
+// that follow fail with the context error. The minimum read rate is that of
+// the framework options of the Engine running the scan of ctx, if any.
 func NewTimeoutConnection(ctx context.Context, conn net.Conn, timeout, readTimeout, writeTimeout time.Duration, bytesReadLimit int) *TimeoutConnection {
+	config := configFrom(ctx)
 	ret := (&TimeoutConnection{
-		Conn:           conn,
-		Timeout:        timeout,
-		ReadTimeout:    readTimeout,
-		WriteTimeout:   writeTimeout,
-		BytesReadLimit: bytesReadLimit,
+		Conn:            conn,
+		Timeout:         timeout,
+		ReadTimeout:     readTimeout,
+		WriteTimeout:    writeTimeout,
+		BytesReadLimit:  bytesReadLimit,
+		MinReadRate:     config.MinReadRate,
+		MaxResponseSize: config.MaxResponseSize,
+		opened:          time.Now(),
 	}).SetDefaults()
 	if ctx == nil {
 		ctx = context.Background()
 	}
 	ret.ctx, ret.Cancel = context.WithTimeout(ctx, timeout)
+	if ctx.Done() != nil {
+		go func() {
+			<-ret.ctx.Done()
+			// Only a cancellation of the caller's context interrupts
+			// pending operations; the session timeout fails the next one.
+			if ctx.Err() != nil {
+				conn.SetDeadline(time.Now())
+			}
+		}()
+	}
 	return ret
 }
 
+// InterruptOnCancel interrupts any pending and future Read or Write on conn
+// once ctx is canceled, by setting its deadline in the past, until the
+// returned function is called. It is meant for connections that are not
+// TimeoutConnections, and must be called after any deadline is set on conn.
+func InterruptOnCancel(ctx context.Context, conn net.Conn) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
 // DialTimeoutConnectionEx dials the target and returns a net.Conn that uses the configured timeouts for Read/Write operations.
 func DialTimeoutConnectionEx(proto string, target string, dialTimeout, sessionTimeout, readTimeout, writeTimeout time.Duration, bytesReadLimit int) (net.Conn, error) {
+	return dialTimeoutConnection(context.Background(), config.proxy, proto, target, dialTimeout, sessionTimeout, readTimeout, writeTimeout, bytesReadLimit)
+}
+
+// dialTimeoutConnection implements DialTimeoutConnectionEx, through proxy if it
+// is not nil, with the framework options of the Engine running the scan of
+// ctx. Canceling ctx aborts the dial, and interrupts the connection.
+func dialTimeoutConnection(ctx context.Context, proxy *url.URL, proto string, target string, dialTimeout, sessionTimeout, readTimeout, writeTimeout time.Duration, bytesReadLimit int) (net.Conn, error) {
+	config := configFrom(ctx)
 	var conn net.Conn
 	var err error
-	if dialTimeout > 0 {
-		conn, err = net.DialTimeout(proto, target, dialTimeout)
+	if dialTimeout <= 0 {
+		dialTimeout = sessionTimeout
+	}
+	if err = config.throttle.waitConn(ctx); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	if proxy != nil {
+		conn, err = DialProxy(ctx, proxy, proto, target, dialTimeout)
 	} else {
-		conn, err = net.DialTimeout(proto, target, sessionTimeout)
+		dialer := newNetDialer(config, target)
+		dialer.Timeout = dialTimeout
+		conn, err = dialer.DialContext(ctx, proto, target)
 	}
 	if err != nil {
 		if conn != nil {
@@ -247,7 +376,9 @@ func DialTimeoutConnectionEx(proto string, target string, dialTimeout, sessionTi
 		}
 		return nil, err
 	}
-	return NewTimeoutConnection(context.Background(), conn, sessionTimeout, readTimeout, writeTimeout, bytesReadLimit), nil
+	ret := NewTimeoutConnection(ctx, conn, sessionTimeout, readTimeout, writeTimeout, bytesReadLimit)
+	ret.adaptTimeouts(config, time.Since(start))
+	return ret, nil
 }
 
 // DialTimeoutConnection dials the target and returns a net.Conn that uses the configured single timeout for all operations.
@@ -281,6 +412,10 @@ type Dialer struct {
 	// ReadLimitExceededAction describes how connections dialed with this dialer deal with exceeding
 	// the BytesReadLimit.
 	ReadLimitExceededAction ReadLimitExceededAction
+
+	// Proxy, if not nil, is the proxy connections are dialed through, instead of the one of
+	// --proxy.
+	Proxy *url.URL
 }
 
 func (d *Dialer) getTimeout(field time.Duration) time.Duration {
@@ -291,32 +426,72 @@ func (d *Dialer) getTimeout(field time.Duration) time.Duration {
 }
 
 // DialContext wraps the connection returned by net.Dialer.DialContext() with a TimeoutConnection.
+// The source addresses, blocklist, resolver and proxy are those of the Engine
+// running the scan of ctx, if any.
 func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	config := configFrom(ctx)
+	if err := config.throttle.waitConn(ctx); err != nil {
+		return nil, err
+	}
+	// The session timeout bounds the dial only; the connection gets the
+	// caller's ctx, so that its expiry is not taken for a cancellation.
+	sessionCtx := ctx
 	if d.Timeout != 0 {
-		ctx, _ = context.WithTimeout(ctx, d.Timeout)
+		var cancel context.CancelFunc
+		sessionCtx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	// Dial with a copy of the aux dialer, which is shared by the
+	// connections of the Dialer; copied from http/transport.go
+	dialer := *d.Dialer
+	dialer.Timeout = d.getTimeout(d.ConnectTimeout)
+	dialer.KeepAlive = d.Timeout
+
+	// Use the next source IP if set, or nil
+	if laddr := localTCPAddr(config, address); laddr != nil {
+		dialer.LocalAddr = laddr
+	} else {
+		dialer.LocalAddr = nil
+	}
+	if control := dialControl(config); control != nil {
+		dialer.Control = control
+	}
+	if dialer.Resolver == nil {
+		dialer.Resolver = config.resolver.dialResolver()
 	}
-	// ensure that our aux dialer is up-to-date; copied from http/transport.go
-	d.Dialer.Timeout = d.getTimeout(d.ConnectTimeout)
-	d.Dialer.KeepAlive = d.Timeout
-
-	// Copy over the source IP if set, or nil
-	d.Dialer.LocalAddr = config.localAddr
 
-	dialContext, cancelDial := context.WithTimeout(ctx, d.Dialer.Timeout)
+	dialContext, cancelDial := context.WithTimeout(sessionCtx, dialer.Timeout)
 	defer cancelDial()
-	conn, err := d.Dialer.DialContext(dialContext, network, address)
+	var conn net.Conn
+	var err error
+	start := time.Now()
+	if proxy := d.proxy(config); proxy != nil {
+		conn, err = DialProxy(dialContext, proxy, network, address, 0)
+	} else {
+		conn, err = dialer.DialContext(dialContext, network, address)
+	}
 	if err != nil {
 		return nil, err
 	}
 	ret := NewTimeoutConnection(ctx, conn, d.Timeout, d.ReadTimeout, d.WriteTimeout, d.BytesReadLimit)
 	ret.BytesReadLimit = d.BytesReadLimit
 	ret.ReadLimitExceededAction = d.ReadLimitExceededAction
+	ret.adaptTimeouts(config, time.Since(start))
 	return ret, nil
 }
 
 // Dial returns a connection with the configured timeout.
 func (d *Dialer) Dial(proto string, target string) (net.Conn, error) {
-	return DialTimeoutConnectionEx(proto, target, d.ConnectTimeout, d.Timeout, d.ReadTimeout, d.WriteTimeout, 0)
+	return dialTimeoutConnection(context.Background(), d.proxy(&config), proto, target, d.ConnectTimeout, d.Timeout, d.ReadTimeout, d.WriteTimeout, 0)
+}
+
+// proxy returns the proxy to dial connections through, if any: that of the
+// Dialer, or else that of config.
+func (d *Dialer) proxy(config *Config) *url.URL {
+	if d.Proxy != nil {
+		return d.Proxy
+	}
+	return config.proxy
 }
 
 // GetTimeoutConnectionDialer gets a Dialer that dials connections with the given timeout.
@@ -420,3 +420,136 @@ func TestTimeoutConnectionTimeouts(t *testing.T) {
 		cfg.run(t)
 	}
 }
+
+func TestTimeoutConnectionCancel(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	conn := NewTimeoutConnection(ctx, client, time.Minute, time.Minute, time.Minute, DefaultBytesReadLimit)
+	defer conn.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("read succeeded after cancellation")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read not interrupted by cancellation")
+	}
+	if _, err := conn.Write([]byte("x")); err != context.Canceled {
+		t.Errorf("got write error %v; expected %v", err, context.Canceled)
+	}
+}
+
+func TestTimeoutConnectionMinReadRate(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := NewTimeoutConnection(context.Background(), client, time.Minute, 100*time.Millisecond, time.Minute, DefaultBytesReadLimit)
+	conn.MinReadRate = 100
+	defer conn.Close()
+	go func() {
+		// Trickle one byte at a time, each within the read timeout.
+		for i := 0; i < 10; i++ {
+			if _, err := server.Write([]byte("x")); err != nil {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+	buf := make([]byte, 1)
+	var err error
+	reads := 0
+	for ; reads < 10 && err == nil; reads++ {
+		_, err = conn.Read(buf)
+	}
+	if err != ErrSlowRead {
+		t.Fatalf("got error %v after %d reads; expected %v", err, reads, ErrSlowRead)
+	}
+	if reads > 4 {
+		t.Errorf("slow read detected after %d reads", reads)
+	}
+	if TryGetScanStatus(err) != SCAN_IO_TIMEOUT {
+		t.Errorf("got status %s", TryGetScanStatus(err))
+	}
+}
+
+func TestAdaptiveReadTimeout(t *testing.T) {
+	for _, test := range []struct {
+		connect  time.Duration
+		factor   float64
+		min      time.Duration
+		expected time.Duration
+	}{
+		{time.Millisecond, 10, time.Second, time.Second},
+		{300 * time.Millisecond, 10, time.Second, 3 * time.Second},
+		{300 * time.Millisecond, 0, 0, 3 * time.Second},
+		{300 * time.Millisecond, 2, 0, 600 * time.Millisecond},
+	} {
+		if got := adaptiveReadTimeout(test.connect, test.factor, test.min); got != test.expected {
+			t.Errorf("adaptiveReadTimeout(%s, %f, %s) = %s; expected %s", test.connect, test.factor, test.min, got, test.expected)
+		}
+	}
+
+	config.AdaptiveTimeouts = true
+	config.AdaptiveFactor = 10
+	config.AdaptiveMin = 200 * time.Millisecond
+	defer func() { config.AdaptiveTimeouts = false }()
+	conn := NewTimeoutConnection(context.Background(), nil, time.Minute, 0, 0, 0)
+	conn.adaptTimeouts(&config, time.Millisecond)
+	if conn.ReadTimeout != 200*time.Millisecond {
+		t.Errorf("got read timeout %s", conn.ReadTimeout)
+	}
+	// The read timeout is never lengthened.
+	conn.adaptTimeouts(&config, time.Hour)
+	if conn.ReadTimeout != 200*time.Millisecond {
+		t.Errorf("got lengthened read timeout %s", conn.ReadTimeout)
+	}
+	conn.Cancel()
+}
+
+// TestDialerConcurrent checks that a Dialer can be shared by concurrent
+// dials, as by the workers of a scan, without changing its aux dialer.
+func TestDialerConcurrent(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	dialer := NewDialer(&Dialer{Timeout: 5 * time.Second})
+	aux := *dialer.Dialer
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			conn, err := dialer.DialContext(context.Background(), "tcp", listener.Addr().String())
+			if err == nil {
+				conn.Close()
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+	if dialer.Dialer.LocalAddr != aux.LocalAddr || dialer.Dialer.Resolver != aux.Resolver || dialer.Dialer.Timeout != aux.Timeout {
+		t.Errorf("the aux dialer was changed to %+v", dialer.Dialer)
+	}
+}
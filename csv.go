@@ -0,0 +1,134 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// csvListSeparator separates the values of a field that holds a list, or
+// that is found in several elements of a list.
+const csvListSeparator = ";"
+
+// ParseCSVFields parses the comma-separated --csv-fields value into a list of
+// dotted field paths, such as data.http.result.response.status_code.
+func ParseCSVFields(s string) ([]string, error) {
+	var ret []string
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if strings.HasPrefix(field, ".") || strings.HasSuffix(field, ".") || strings.Contains(field, "..") {
+			return nil, fmt.Errorf("invalid field path %q", field)
+		}
+		ret = append(ret, field)
+	}
+	if len(ret) == 0 {
+		return nil, errors.New("no fields given")
+	}
+	return ret, nil
+}
+
+// OutputResultsCSVFunc returns an OutputResultsFunc that writes the results as
+// CSV to w: a header row naming the fields, then one row per result with the
+// values found at those dotted paths in the result.
+func OutputResultsCSVFunc(w io.Writer, fields []string) OutputResultsFunc {
+	return func(results <-chan []byte) error {
+		out := csv.NewWriter(w)
+		defer out.Flush()
+		if err := out.Write(fields); err != nil {
+			return err
+		}
+		for result := range results {
+			row, err := csvRow(result, fields)
+			if err != nil {
+				log.Errorf("could not convert result to CSV: %s", err)
+				continue
+			}
+			if err := out.Write(row); err != nil {
+				return err
+			}
+		}
+		out.Flush()
+		return out.Error()
+	}
+}
+
+// csvRow returns the values of fields in the JSON-encoded result.
+func csvRow(result []byte, fields []string) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(result))
+	dec.UseNumber()
+	var decoded interface{}
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	row := make([]string, len(fields))
+	for i, field := range fields {
+		values := lookupAll(decoded, strings.Split(field, "."))
+		strs := make([]string, 0, len(values))
+		for _, v := range values {
+			if s, ok := csvValue(v); ok {
+				strs = append(strs, s)
+			}
+		}
+		row[i] = strings.Join(strs, csvListSeparator)
+	}
+	return row, nil
+}
+
+// lookupAll returns the values at the path given by keys in v. A numeric key
+// indexes a list; any other key is looked up in each element of a list, so
+// that e.g. the subjects of all the certificates in a chain are found.
+func lookupAll(v interface{}, keys []string) []interface{} {
+	if len(keys) == 0 {
+		if list, ok := v.([]interface{}); ok {
+			return list
+		}
+		return []interface{}{v}
+	}
+	switch node := v.(type) {
+	case map[string]interface{}:
+		return lookupAll(node[keys[0]], keys[1:])
+	case []interface{}:
+		if i, err := strconv.Atoi(keys[0]); err == nil {
+			if i < 0 || i >= len(node) {
+				return nil
+			}
+			return lookupAll(node[i], keys[1:])
+		}
+		var ret []interface{}
+		for _, elem := range node {
+			ret = append(ret, lookupAll(elem, keys)...)
+		}
+		return ret
+	}
+	return nil
+}
+
+// csvValue formats a single value for a CSV cell. Objects and lists are
+// encoded as JSON. It returns false for missing values.
+func csvValue(v interface{}) (string, bool) {
+	switch value := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	case bool:
+		return strconv.FormatBool(value), true
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return string(encoded), true
+}
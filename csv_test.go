@@ -0,0 +1,46 @@
+package zgrab2
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseCSVFields(t *testing.T) {
+	fields, err := ParseCSVFields(" ip, data.http.status ,")
+	if err != nil || len(fields) != 2 || fields[0] != "ip" || fields[1] != "data.http.status" {
+		t.Errorf("got %v, %v", fields, err)
+	}
+	for _, s := range []string{"", " , ", "data..status", ".ip", "data."} {
+		if _, err := ParseCSVFields(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestOutputResultsCSV(t *testing.T) {
+	fields := []string{
+		"ip",
+		"data.http.result.response.status_code",
+		"data.tls.result.chain.subject",
+		"data.tls.result.chain.0.subject",
+		"data.http.result.response.headers",
+		"data.http.result.tags",
+		"data.ssh.status",
+	}
+	results := make(chan []byte, 3)
+	results <- []byte(`{"ip":"10.0.0.1","data":{"http":{"status":"success","result":{"response":{"status_code":200,"headers":{"server":["nginx"]}},"tags":["a","b"]}},"tls":{"result":{"chain":[{"subject":"CN=leaf"},{"subject":"CN=ca, O=\"x\""}]}}}}`)
+	results <- []byte(`not json`)
+	results <- []byte(`{"domain":"example.com","data":{"ssh":{"status":"io-timeout"}}}`)
+	close(results)
+
+	var buf bytes.Buffer
+	if err := OutputResultsCSVFunc(&buf, fields)(results); err != nil {
+		t.Fatal(err)
+	}
+	expected := "ip,data.http.result.response.status_code,data.tls.result.chain.subject,data.tls.result.chain.0.subject,data.http.result.response.headers,data.http.result.tags,data.ssh.status\n" +
+		`10.0.0.1,200,"CN=leaf;CN=ca, O=""x""",CN=leaf,"{""server"":[""nginx""]}",a;b,` + "\n" +
+		",,,,,,io-timeout\n"
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
@@ -0,0 +1,231 @@
+package zgrab2
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// dashboardLogLines is the number of recent log lines shown at the bottom of
+// the dashboard.
+const dashboardLogLines = 5
+
+// Dashboard periodically renders a live summary of a running scan to a
+// terminal: per-module success / failure rates, throughput, latency
+// percentiles, an error breakdown, and an ETA based on the input size.
+type Dashboard struct {
+	monitor  *Monitor
+	out      io.Writer
+	interval time.Duration
+
+	mu        sync.Mutex
+	logs      []string
+	partial   []byte
+	lastLines int
+	lastDone  uint
+	lastTime  time.Duration
+
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewDashboard returns a Dashboard that renders the state of monitor to out
+// every interval.
+func NewDashboard(monitor *Monitor, out io.Writer, interval time.Duration) *Dashboard {
+	return &Dashboard{
+		monitor:  monitor,
+		out:      out,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// StartDashboard creates a Dashboard on stderr for the given monitor and
+// starts it. If the framework is logging to stderr, log output is captured
+// and shown at the bottom of the dashboard instead.
+func StartDashboard(monitor *Monitor) *Dashboard {
+	d := NewDashboard(monitor, os.Stderr, time.Second)
+	if config.logFile == os.Stderr {
+		log.SetOutput(d)
+	}
+	d.Start()
+	return d
+}
+
+// Start begins rendering the dashboard in the background.
+func (d *Dashboard) Start() {
+	d.stopped.Add(1)
+	go func() {
+		defer d.stopped.Done()
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.render()
+			case <-d.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop renders a final frame and stops the dashboard. Log output is returned
+// to stderr if it was captured by StartDashboard.
+func (d *Dashboard) Stop() {
+	close(d.done)
+	d.stopped.Wait()
+	d.render()
+	if config.logFile == os.Stderr {
+		log.SetOutput(os.Stderr)
+	}
+}
+
+// Write implements io.Writer, so that the dashboard can be used as a log
+// output. Only the most recent complete lines are retained.
+func (d *Dashboard) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.partial = append(d.partial, p...)
+	for {
+		i := bytes.IndexByte(d.partial, '\n')
+		if i < 0 {
+			break
+		}
+		d.logs = append(d.logs, string(d.partial[:i]))
+		d.partial = d.partial[i+1:]
+	}
+	if len(d.logs) > dashboardLogLines {
+		d.logs = d.logs[len(d.logs)-dashboardLogLines:]
+	}
+	return len(p), nil
+}
+
+// percentile returns the pth percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i]
+}
+
+// formatDuration rounds d to a precision suitable for display.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Minute:
+		return d.Round(time.Second).String()
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond).String()
+	default:
+		return d.Round(time.Millisecond).String()
+	}
+}
+
+// inputETA returns the fraction of the input file read so far, and the time
+// left estimated from it and the time elapsed. ok is false if the size of the
+// input is unknown or nothing was read yet.
+func inputETA(elapsed time.Duration) (fraction float64, eta time.Duration, ok bool) {
+	read, size := InputProgress()
+	if size <= 0 || read <= 0 {
+		return 0, 0, false
+	}
+	fraction = float64(read) / float64(size)
+	if fraction > 1 {
+		fraction = 1
+	}
+	return fraction, time.Duration(float64(elapsed) * (1 - fraction) / fraction), true
+}
+
+// render draws one frame of the dashboard, overwriting the previous one.
+func (d *Dashboard) render() {
+	snapshots, elapsed := d.monitor.Snapshot()
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Name < snapshots[j].Name
+	})
+
+	var total uint
+	for _, s := range snapshots {
+		total += s.Successes + s.Failures
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	rate := 0.0
+	if interval := elapsed - d.lastTime; interval > 0 {
+		rate = float64(total-d.lastDone) / interval.Seconds()
+	}
+	d.lastDone, d.lastTime = total, elapsed
+
+	buf := new(bytes.Buffer)
+	header := fmt.Sprintf("zgrab2  elapsed %s  completed %d  rate %.1f/s", formatDuration(elapsed), total, rate)
+	if fraction, eta, ok := inputETA(elapsed); ok {
+		header += fmt.Sprintf("  input %.1f%%  eta %s", 100*fraction, formatDuration(eta))
+	}
+	if throttling := d.monitor.Throttling(); throttling.Delayed > 0 {
+		header += fmt.Sprintf("  throttled %d (%s)", throttling.Delayed, formatDuration(throttling.Wait))
+	}
+	if skipped := d.monitor.Skipped(); skipped != (SkipStats{}) {
+		header += fmt.Sprintf("  skipped %d blocked, %d duplicate", skipped.Blocked, skipped.Duplicate)
+	}
+	fmt.Fprintln(buf, header)
+	fmt.Fprintln(buf)
+
+	w := tabwriter.NewWriter(buf, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "module\tsuccess\tfailure\tsuccess%\tavg/s\tp50\tp90\tp99\t")
+	for _, s := range snapshots {
+		n := s.Successes + s.Failures
+		successRate := 0.0
+		if n > 0 {
+			successRate = 100 * float64(s.Successes) / float64(n)
+		}
+		throughput := 0.0
+		if elapsed > 0 {
+			throughput = float64(n) / elapsed.Seconds()
+		}
+		sort.Slice(s.Latencies, func(i, j int) bool { return s.Latencies[i] < s.Latencies[j] })
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%.1f\t%s\t%s\t%s\t\n", s.Name, s.Successes, s.Failures,
+			successRate, throughput,
+			formatDuration(percentile(s.Latencies, 0.5)),
+			formatDuration(percentile(s.Latencies, 0.9)),
+			formatDuration(percentile(s.Latencies, 0.99)))
+	}
+	w.Flush()
+
+	fmt.Fprintln(buf)
+	for _, s := range snapshots {
+		var errors []string
+		for st, count := range s.Statuses {
+			if st != SCAN_SUCCESS {
+				errors = append(errors, fmt.Sprintf("%s=%d", st, count))
+			}
+		}
+		if len(errors) == 0 {
+			continue
+		}
+		sort.Strings(errors)
+		fmt.Fprintf(buf, "%s errors: %s\n", s.Name, strings.Join(errors, " "))
+	}
+	if len(d.logs) > 0 {
+		fmt.Fprintln(buf)
+		for _, line := range d.logs {
+			fmt.Fprintln(buf, line)
+		}
+	}
+
+	// Move the cursor to the start of the previous frame and clear it.
+	if d.lastLines > 0 {
+		fmt.Fprintf(d.out, "\x1b[%dA\x1b[J", d.lastLines)
+	}
+	d.lastLines = bytes.Count(buf.Bytes(), []byte{'\n'})
+	d.out.Write(buf.Bytes())
+}
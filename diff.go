@@ -0,0 +1,189 @@
+package zgrab2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/zmap/zgrab2/lib/diff"
+)
+
+// DiffCommand contains the command line options for comparing the output of
+// two scans. The old and new output files are given as positional arguments.
+type DiffCommand struct {
+	Fields        string `long:"fields" description:"Comma-separated field paths to compare, relative to each module's response (e.g. result.banner,result.tls.handshake_log.server_certificates.certificate.parsed.fingerprint_sha256); * matches any key. Default: all fields"`
+	Ignore        string `long:"ignore" default:"timestamp,trace" description:"Comma-separated field paths not to compare"`
+	ShowUnchanged bool   `long:"show-unchanged" description:"Also output records that did not change"`
+}
+
+// Validate the options sent to DiffCommand
+func (x *DiffCommand) Validate(args []string) error {
+	if len(args) != 2 {
+		return errors.New("expected an old and a new output file")
+	}
+	return nil
+}
+
+// Help returns a usage string that will be output at the command line
+func (x *DiffCommand) Help() string {
+	return "Records are matched by (ip, domain, port, module). Each line of output is a JSON object describing a record that appeared, disappeared or changed."
+}
+
+// DiffKey identifies a single module's response in scan output.
+type DiffKey struct {
+	IP     string `json:"ip,omitempty"`
+	Domain string `json:"domain,omitempty"`
+	Port   string `json:"port,omitempty"`
+	Module string `json:"module"`
+}
+
+// Values for DiffEntry.Change.
+const (
+	DiffAppeared    = "appeared"
+	DiffDisappeared = "disappeared"
+	DiffChanged     = "changed"
+	DiffUnchanged   = "unchanged"
+)
+
+// DiffEntry describes the difference in a single module's response between
+// two scans.
+type DiffEntry struct {
+	DiffKey
+	Change  string        `json:"change"`
+	Changes []diff.Change `json:"changes,omitempty"`
+}
+
+// diffRecord is the subset of an output record needed for matching.
+type diffRecord struct {
+	IP     string                            `json:"ip"`
+	Domain string                            `json:"domain"`
+	Port   uint                              `json:"port"`
+	Data   map[string]map[string]interface{} `json:"data"`
+}
+
+// readDiffRecords calls f for each module response in the output read from r.
+func readDiffRecords(r io.Reader, f func(key DiffKey, response map[string]interface{})) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			var record diffRecord
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.UseNumber()
+			if err := dec.Decode(&record); err != nil {
+				return fmt.Errorf("line %d: %s", line, err)
+			}
+			for module, response := range record.Data {
+				key := DiffKey{IP: record.IP, Domain: record.Domain, Module: module}
+				if port := diff.Lookup(response, "port"); port != nil {
+					key.Port = fmt.Sprint(port)
+				} else if record.Port != 0 {
+					key.Port = fmt.Sprint(record.Port)
+				}
+				f(key, response)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Diff compares the scan output read from old and new, calling f for each
+// module response that appeared, disappeared or changed (and, if unchanged is
+// set, for those that did not). The old output is held in memory; the new
+// output is streamed.
+func Diff(old, new io.Reader, filter *diff.Filter, unchanged bool, f func(*DiffEntry) error) error {
+	previous := make(map[DiffKey]map[string]interface{})
+	err := readDiffRecords(old, func(key DiffKey, response map[string]interface{}) {
+		previous[key] = response
+	})
+	if err != nil {
+		return fmt.Errorf("old: %s", err)
+	}
+	var outErr error
+	err = readDiffRecords(new, func(key DiffKey, response map[string]interface{}) {
+		if outErr != nil {
+			return
+		}
+		entry := &DiffEntry{DiffKey: key}
+		if prev, ok := previous[key]; !ok {
+			entry.Change = DiffAppeared
+		} else {
+			delete(previous, key)
+			entry.Changes = diff.Compare(prev, response, filter)
+			if len(entry.Changes) > 0 {
+				entry.Change = DiffChanged
+			} else if unchanged {
+				entry.Change = DiffUnchanged
+			} else {
+				return
+			}
+		}
+		outErr = f(entry)
+	})
+	if err != nil {
+		return fmt.Errorf("new: %s", err)
+	}
+	if outErr != nil {
+		return outErr
+	}
+	// Report the disappeared responses in a stable order.
+	var gone []DiffKey
+	for key := range previous {
+		gone = append(gone, key)
+	}
+	sort.Slice(gone, func(i, j int) bool {
+		a, b := gone[i], gone[j]
+		if a.IP != b.IP {
+			return a.IP < b.IP
+		}
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Module < b.Module
+	})
+	for _, key := range gone {
+		if err := f(&DiffEntry{DiffKey: key, Change: DiffDisappeared}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run compares the two output files, writing one JSON object per difference
+// to w.
+func (x *DiffCommand) Run(w io.Writer, oldName, newName string) error {
+	old, err := openOutputFile(oldName)
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+	new, err := openOutputFile(newName)
+	if err != nil {
+		return err
+	}
+	defer new.Close()
+	var fields []string
+	if x.Fields != "" {
+		fields = strings.Split(x.Fields, ",")
+	}
+	filter := diff.NewFilter(fields, strings.Split(x.Ignore, ","))
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+	enc := json.NewEncoder(out)
+	return Diff(old, new, filter, x.ShowUnchanged, func(entry *DiffEntry) error {
+		return enc.Encode(entry)
+	})
+}
@@ -0,0 +1,269 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// esFlushInterval is how often documents are sent to Elasticsearch when a
+// batch fills up slower than that.
+const esFlushInterval = 5 * time.Second
+
+// ElasticsearchOutput indexes results into Elasticsearch or OpenSearch with
+// the bulk API. Each response in a record is indexed as its own document, the
+// record with only that response in its data, in the index named by the
+// prefix and the scanner name. Before the first document of a scanner is
+// indexed, an index template is installed with a mapping derived from the
+// schema of the module's results.
+type ElasticsearchOutput struct {
+	base      *url.URL
+	prefix    string
+	batchSize int
+	retries   int
+	backoff   time.Duration
+	client    *http.Client
+
+	// mapping returns the mapping properties of the records of the named
+	// scanner.
+	mapping   func(scanner string) map[string]interface{}
+	templates map[string]bool
+}
+
+// esDocument is a document to be indexed.
+type esDocument struct {
+	scanner string
+	index   string
+	body    []byte
+}
+
+// esBulkResponse is the part of a bulk API response that reports the outcome
+// of each action, in the order of the request.
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// NewElasticsearchOutput returns an ElasticsearchOutput sending batches of
+// batchSize documents to the cluster at rawURL, in indices named
+// <prefix>-<scanner name>. Documents rejected with 429 Too Many Requests are
+// sent again up to retries times, after waiting a second, doubled each time.
+// Credentials for basic authentication may be given in the URL. The mappings
+// are derived from the modules of the scanners registered with engine.
+func NewElasticsearchOutput(engine *Engine, rawURL, prefix string, batchSize, retries int) (*ElasticsearchOutput, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme %q", base.Scheme)
+	}
+	if prefix == "" {
+		return nil, errors.New("empty index prefix")
+	}
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batch size must be positive, given %d", batchSize)
+	}
+	if retries < 0 {
+		return nil, fmt.Errorf("retries cannot be negative, given %d", retries)
+	}
+	return &ElasticsearchOutput{
+		base:      base,
+		prefix:    strings.ToLower(prefix),
+		batchSize: batchSize,
+		retries:   retries,
+		backoff:   time.Second,
+		client:    &http.Client{Timeout: time.Minute},
+		mapping: func(scanner string) map[string]interface{} {
+			return RecordSchema(scanner, engine.ScannerModule(scanner)).Elasticsearch()
+		},
+		templates: make(map[string]bool),
+	}, nil
+}
+
+// Output is an OutputResultsFunc that indexes the results.
+func (o *ElasticsearchOutput) Output(results <-chan []byte) error {
+	ticker := time.NewTicker(esFlushInterval)
+	defer ticker.Stop()
+	var batch []esDocument
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				return o.flush(batch)
+			}
+			docs, err := o.documents(result)
+			if err != nil {
+				log.Errorf("could not index result: %s", err)
+				continue
+			}
+			if batch = append(batch, docs...); len(batch) < o.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		if err := o.flush(batch); err != nil {
+			return err
+		}
+		batch = nil
+	}
+}
+
+// documents splits a record into one document per scanner response.
+func (o *ElasticsearchOutput) documents(result []byte) ([]esDocument, error) {
+	records, err := splitRecord(result)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]esDocument, 0, len(records))
+	for _, r := range records {
+		ret = append(ret, esDocument{
+			scanner: r.scanner,
+			index:   o.prefix + "-" + strings.ToLower(r.scanner),
+			body:    r.record,
+		})
+	}
+	return ret, nil
+}
+
+// flush installs the templates of new indices and indexes docs, sending
+// those rejected for too many requests again after a delay.
+func (o *ElasticsearchOutput) flush(docs []esDocument) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	for _, doc := range docs {
+		if o.templates[doc.index] {
+			continue
+		}
+		if err := o.putTemplate(doc.index, doc.scanner); err != nil {
+			return fmt.Errorf("could not install the index template of %s: %s", doc.index, err)
+		}
+		o.templates[doc.index] = true
+	}
+	for attempt := 0; ; attempt++ {
+		rejected, err := o.bulk(docs)
+		if err != nil {
+			return err
+		}
+		if len(rejected) == 0 {
+			return nil
+		}
+		if attempt >= o.retries {
+			return fmt.Errorf("%d documents still rejected after %d retries", len(rejected), o.retries)
+		}
+		delay := o.backoff << uint(attempt)
+		log.Warnf("elasticsearch rejected %d documents, retrying in %s", len(rejected), delay)
+		time.Sleep(delay)
+		docs = rejected
+	}
+}
+
+// putTemplate installs the template of the index of the named scanner.
+func (o *ElasticsearchOutput) putTemplate(index, scanner string) error {
+	template := map[string]interface{}{
+		"index_patterns": []string{index},
+		"mappings": map[string]interface{}{
+			"properties": o.mapping(scanner),
+		},
+	}
+	body, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	res, err := o.do(http.MethodPut, "_template/"+index, "application/json", body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return esError(res)
+	}
+	return nil
+}
+
+// bulk sends docs in a single bulk request, and returns those rejected for
+// too many requests. Documents rejected for any other reason are logged and
+// dropped.
+func (o *ElasticsearchOutput) bulk(docs []esDocument) ([]esDocument, error) {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		action, err := json.Marshal(map[string]interface{}{"index": map[string]string{"_index": doc.index}})
+		if err != nil {
+			return nil, err
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc.body)
+		body.WriteByte('\n')
+	}
+	res, err := o.do(http.MethodPost, "_bulk", "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusTooManyRequests {
+		io.Copy(ioutil.Discard, res.Body)
+		return docs, nil
+	}
+	if res.StatusCode/100 != 2 {
+		return nil, esError(res)
+	}
+	var bulk esBulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&bulk); err != nil {
+		return nil, fmt.Errorf("invalid bulk response: %s", err)
+	}
+	if !bulk.Errors {
+		return nil, nil
+	}
+	var rejected []esDocument
+	for i, item := range bulk.Items {
+		if i >= len(docs) {
+			break
+		}
+		for _, result := range item {
+			switch {
+			case result.Status == http.StatusTooManyRequests:
+				rejected = append(rejected, docs[i])
+			case result.Status/100 != 2:
+				log.Errorf("elasticsearch could not index a document in %s: %s", docs[i].index, result.Error)
+			}
+		}
+	}
+	return rejected, nil
+}
+
+// do sends a request to the given path of the cluster.
+func (o *ElasticsearchOutput) do(method, path, contentType string, body []byte) (*http.Response, error) {
+	u := *o.base
+	u.User = nil
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + path
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if o.base.User != nil {
+		password, _ := o.base.User.Password()
+		req.SetBasicAuth(o.base.User.Username(), password)
+	}
+	return o.client.Do(req)
+}
+
+// esError returns an error describing an unsuccessful response.
+func esError(res *http.Response) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(msg))
+}
@@ -0,0 +1,114 @@
+package zgrab2
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestElasticsearchOutput(t *testing.T) {
+	var mu sync.Mutex
+	templates := make(map[string]map[string]interface{})
+	indexed := make(map[string][]string)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if user, password, _ := r.BasicAuth(); user != "elastic" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_template/"):
+			var template map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&template)
+			templates[strings.TrimPrefix(r.URL.Path, "/_template/")] = template
+			fmt.Fprint(w, `{"acknowledged":true}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/_bulk":
+			requests++
+			if requests == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			var items []string
+			scanner := bufio.NewScanner(r.Body)
+			for i := 0; scanner.Scan(); i++ {
+				var action struct {
+					Index struct {
+						Index string `json:"_index"`
+					} `json:"index"`
+				}
+				json.Unmarshal(scanner.Bytes(), &action)
+				scanner.Scan()
+				status := 201
+				// The second request rejects the ssh document.
+				if requests == 2 && action.Index.Index == "scan-ssh" {
+					status = http.StatusTooManyRequests
+				} else {
+					indexed[action.Index.Index] = append(indexed[action.Index.Index], scanner.Text())
+				}
+				items = append(items, fmt.Sprintf(`{"index":{"status":%d}}`, status))
+			}
+			fmt.Fprintf(w, `{"errors":%v,"items":[%s]}`, requests == 2, strings.Join(items, ","))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	es, err := NewElasticsearchOutput(defaultEngine, strings.Replace(server.URL, "http://", "http://elastic:secret@", 1), "Scan", 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	es.backoff = 0
+	es.mapping = func(scanner string) map[string]interface{} {
+		return map[string]interface{}{"scanner": scanner}
+	}
+	results := make(chan []byte, 2)
+	results <- []byte(`{"ip":"10.0.0.1","data":{"HTTP":{"status":"success"},"ssh":{"status":"io-timeout"}}}`)
+	results <- []byte(`{"ip":"10.0.0.2","data":{"HTTP":{"status":"success"}}}`)
+	close(results)
+	if err := es.Output(results); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != 3 {
+		t.Errorf("expected 3 bulk requests, got %d", requests)
+	}
+	if len(templates) != 2 || templates["scan-http"]["mappings"].(map[string]interface{})["properties"].(map[string]interface{})["scanner"] != "HTTP" {
+		t.Errorf("unexpected templates %v", templates)
+	}
+	expected := map[string][]string{
+		"scan-http": {
+			`{"data":{"HTTP":{"status":"success"}},"ip":"10.0.0.1"}`,
+			`{"data":{"HTTP":{"status":"success"}},"ip":"10.0.0.2"}`,
+		},
+		"scan-ssh": {`{"data":{"ssh":{"status":"io-timeout"}},"ip":"10.0.0.1"}`},
+	}
+	if fmt.Sprint(indexed) != fmt.Sprint(expected) {
+		t.Errorf("indexed %v, expected %v", indexed, expected)
+	}
+}
+
+func TestElasticsearchOutputMapping(t *testing.T) {
+	engine, _ := NewEngine(nil)
+	engine.AddModule("test", new(engineTestModule))
+	flags, _ := engine.NewFlags("test")
+	flags.(*engineTestFlags).Name = "banner"
+	if _, err := engine.NewScanner("test", flags); err != nil {
+		t.Fatal(err)
+	}
+	es, err := NewElasticsearchOutput(engine, "http://localhost:9200", "scan", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := es.mapping("banner")["data"].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, ok := data["banner"].(map[string]interface{})["properties"].(map[string]interface{})["result"]; !ok {
+		t.Errorf("no mapping of the module's result in %v", data)
+	}
+}
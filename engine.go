@@ -0,0 +1,691 @@
+package zgrab2
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Engine is a self-contained instance of the scanning framework: a set of
+// modules, the scanners created from them, the framework options used to run
+// them, and a monitor collecting their statuses. Programs embedding zgrab2
+// should create an Engine rather than relying on the command-line entry
+// points, which operate on a process-wide default Engine.
+//
+// Example:
+//
+//	engine, _ := zgrab2.NewEngine(nil)
+//	engine.AddModule("http", &http.Module{})
+//	flags, _ := engine.NewFlags("http")
+//	flags.(*http.Flags).Port = 8080
+//	if _, err := engine.NewScanner("http", flags); err != nil {
+//		...
+//	}
+//	grab := engine.ScanTarget(zgrab2.ScanTarget{IP: net.ParseIP("10.0.0.1")})
+type Engine struct {
+	config    *Config
+	modules   ModuleSet
+	monitor   *Monitor
+	enrichers []Enricher
+
+	mu              sync.RWMutex
+	scanners        map[string]Scanner
+	orderedScanners []string
+	conditions      map[string]*scanCondition
+}
+
+// NewEngine returns an Engine with no modules or scanners, using the given
+// framework options. If config is nil, the defaults are used. Only the options
+// affecting how targets are scanned and encoded are used (senders, connections
+// per host, rate limits, the scan timeout, debug output, output field filters
+// and transforms, tracing and packet captures, the blocklist and deduplication of targets, DNS
+// resolution, and the multiple-module options); the other files named in the
+// config are not opened.
+func NewEngine(config *Config) (*Engine, error) {
+	if config == nil {
+		config = &Config{}
+		config.Multiple.ContinueOnError = true
+	}
+	if config.Senders <= 0 {
+		config.Senders = 1
+	}
+	if config.ConnectionsPerHost <= 0 {
+		config.ConnectionsPerHost = 1
+	}
+	if config.TraceFilter != "" && config.traceFilter == nil {
+		filter, err := regexp.Compile(config.TraceFilter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trace filter %q: %s", config.TraceFilter, err)
+		}
+		config.traceFilter = filter
+	}
+	if config.BlocklistFile != "" && config.blocklist == nil {
+		blocklist, err := LoadBlocklist(config.BlocklistFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocklist %q: %s", config.BlocklistFile, err)
+		}
+		config.blocklist = blocklist
+	}
+	if config.resolver == nil {
+		resolver, err := newResolver(config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DNS options: %s", err)
+		}
+		config.resolver = resolver
+	}
+	if config.throttle == nil {
+		config.throttle = newThrottle(config)
+	}
+	if (config.PcapDir != "" || config.PcapFile != "") && config.capture == nil {
+		capture, err := newPcapCapture(config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid packet capture options: %s", err)
+		}
+		config.capture = capture
+	}
+	if config.outputFilter == nil {
+		config.outputFilter = newOutputFilter(config)
+	}
+	if config.transformer == nil {
+		transformer, err := newOutputTransformer(config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid output transforms: %s", err)
+		}
+		config.transformer = transformer
+	}
+	return &Engine{
+		config:   config,
+		modules:  NewModuleSet(),
+		scanners: make(map[string]Scanner),
+	}, nil
+}
+
+// configKey is the context key of the framework options of the Engine running
+// a scan.
+type configKey struct{}
+
+// withConfig returns a copy of ctx carrying the framework options config,
+// which the connections opened with ctx use.
+func withConfig(ctx context.Context, config *Config) context.Context {
+	return context.WithValue(ctx, configKey{}, config)
+}
+
+// configFrom returns the framework options carried by ctx, or the global ones
+// of the command line if there are none.
+func configFrom(ctx context.Context) *Config {
+	if ctx != nil {
+		if ret, ok := ctx.Value(configKey{}).(*Config); ok {
+			return ret
+		}
+	}
+	return &config
+}
+
+// defaultEngine is the Engine used by the command-line entry points. It shares
+// the global config and the module registry populated by AddCommand.
+var defaultEngine = &Engine{
+	config:   &config,
+	modules:  modules,
+	scanners: make(map[string]Scanner),
+}
+
+// AddModule makes the module available to the Engine under the given name. If
+// the name is already in use, the previous module is replaced.
+func (e *Engine) AddModule(name string, m ScanModule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.modules.AddModule(name, m)
+}
+
+// Module returns the module with the given name, or nil if there is none.
+func (e *Engine) Module(name string) ScanModule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.modules[name]
+}
+
+// SetMonitor sets the Monitor that receives the status of each scan. If no
+// monitor is set, statuses are not recorded.
+func (e *Engine) SetMonitor(m *Monitor) {
+	e.monitor = m
+	e.config.throttle.setMonitor(m)
+}
+
+// AddEnricher adds a stage that is applied to each target's results after all
+// scanners have run. Enrichers are applied in the order in which they were
+// added.
+func (e *Engine) AddEnricher(enricher Enricher) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.enrichers = append(e.enrichers, enricher)
+}
+
+// NewFlags returns the flags for the named module, with each option set to
+// the default given in its `default` struct tag.
+func (e *Engine) NewFlags(module string) (ScanFlags, error) {
+	m := e.Module(module)
+	if m == nil {
+		return nil, fmt.Errorf("unknown module %s", module)
+	}
+	flags, ok := m.NewFlags().(ScanFlags)
+	if !ok {
+		return nil, ErrMismatchedFlags
+	}
+	if err := SetFlagDefaults(flags); err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// NewScanner creates a scanner from the named module, initializes it with the
+// given flags, and registers it with the Engine. If the flags do not specify a
+// name, the module name is used.
+func (e *Engine) NewScanner(module string, flags ScanFlags) (Scanner, error) {
+	m := e.Module(module)
+	if m == nil {
+		return nil, fmt.Errorf("unknown module %s", module)
+	}
+	if err := flags.Validate(nil); err != nil {
+		return nil, err
+	}
+	if base := GetBaseFlags(flags); base != nil && base.Name == "" {
+		base.Name = module
+	}
+	s := m.NewScanner()
+	if err := s.Init(flags); err != nil {
+		return nil, err
+	}
+	condition, err := e.newCondition(s.GetName(), flags)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.RegisterScan(s.GetName(), s); err != nil {
+		return nil, err
+	}
+	e.setCondition(s.GetName(), condition)
+	return s, nil
+}
+
+// RegisterScan adds an initialized scanner to the Engine. Scanners are run
+// in the order in which they were registered, and their results are keyed by
+// name.
+func (e *Engine) RegisterScan(name string, s Scanner) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.scanners[name] != nil {
+		return fmt.Errorf("name: %s already used", name)
+	}
+	e.orderedScanners = append(e.orderedScanners, name)
+	e.scanners[name] = s
+	return nil
+}
+
+// Scanners returns the names of the registered scanners, in the order in which
+// they are run.
+func (e *Engine) Scanners() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]string(nil), e.orderedScanners...)
+}
+
+// Scanner returns the registered scanner with the given name, or nil if there
+// is none.
+func (e *Engine) Scanner(name string) Scanner {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.scanners[name]
+}
+
+// ScannerModule returns the module of the protocol of the registered scanner
+// with the given name, or nil if there is none.
+func (e *Engine) ScannerModule(name string) ScanModule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if s := e.scanners[name]; s != nil {
+		return e.modules[s.Protocol()]
+	}
+	return nil
+}
+
+// InitPerSender calls InitPerSender on each registered scanner. It must be
+// called once by each goroutine that calls ScanTarget.
+func (e *Engine) InitPerSender(senderID int) error {
+	for _, name := range e.Scanners() {
+		if err := e.Scanner(name).InitPerSender(senderID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBaseFlags returns the BaseFlags embedded in flags, or nil if there are
+// none.
+func GetBaseFlags(flags interface{}) *BaseFlags {
+	v := reflect.ValueOf(flags)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	field := v.Elem().FieldByName("BaseFlags")
+	if !field.IsValid() || !field.CanAddr() {
+		return nil
+	}
+	base, _ := field.Addr().Interface().(*BaseFlags)
+	return base
+}
+
+// SetFlagDefaults sets each field of the flags struct to the value given in
+// its `default` struct tag, descending into embedded structs. It is intended
+// for building flags without going through the command-line parser.
+func SetFlagDefaults(flags interface{}) error {
+	v := reflect.ValueOf(flags)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("flags must be a pointer to a struct, got %T", flags)
+	}
+	return setStructDefaults(v.Elem())
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setStructDefaults(v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		field := v.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			if err := setStructDefaults(field); err != nil {
+				return err
+			}
+			continue
+		}
+		def, ok := sf.Tag.Lookup("default")
+		if !ok {
+			continue
+		}
+		if err := setFieldFromString(field, def); err != nil {
+			return fmt.Errorf("invalid default %q for %s: %s", def, sf.Name, err)
+		}
+	}
+	return nil
+}
+
+func setFieldFromString(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		// Defaults are given in the same escaped form as on the command line.
+		if unquoted, err := strconv.Unquote(`"` + value + `"`); err == nil {
+			value = unquoted
+		}
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 0, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// ScanTarget runs each registered scanner whose trigger matches the target's
+// tag, and returns the combined results.
+func (e *Engine) ScanTarget(input ScanTarget) *Grab {
+	return e.ScanTargetContext(context.Background(), input)
+}
+
+// ScanTargetContext is like ScanTarget, but the scans are interrupted once ctx
+// is canceled, and the scanners not yet started are skipped. A target in the
+// blocklist is not scanned: each scanner matching its tag gets a blocked
+// response instead.
+func (e *Engine) ScanTargetContext(ctx context.Context, input ScanTarget) *Grab {
+	if e.config.blocklist.Contains(input.IP) {
+		if e.monitor != nil {
+			e.monitor.recordBlocked()
+		}
+		return BuildGrabFromInputResponse(&input, e.blockedResponses(&input))
+	}
+	return e.buildGrab(&input, e.scanModules(ctx, &input, nil))
+}
+
+// blockedResponses returns the responses of the scanners matching the tag of
+// a target in the blocklist.
+func (e *Engine) blockedResponses(input *ScanTarget) map[string]ScanResponse {
+	msg := ErrBlocked.Error()
+	ret := make(map[string]ScanResponse)
+	for _, name := range e.Scanners() {
+		scanner := e.Scanner(name)
+		if !input.HasTag(scanner.GetTrigger()) {
+			continue
+		}
+		ret[scanner.GetName()] = ScanResponse{
+			Protocol:  scanner.Protocol(),
+			Error:     &msg,
+			Timestamp: time.Now().Format(time.RFC3339),
+			Status:    SCAN_BLOCKED,
+		}
+	}
+	return ret
+}
+
+// scanModules runs each registered scanner whose trigger matches the target's
+// tag, except those named in done, and returns their responses.
+func (e *Engine) scanModules(ctx context.Context, input *ScanTarget, done map[string]ScanResponse) map[string]ScanResponse {
+	// The connections opened by the scanners use the options of the
+	// Engine, not the global ones.
+	ctx = withConfig(ctx, e.config)
+	input.config = e.config
+	trace := e.config.shouldTrace(input)
+	if e.config.Multiple.Parallel {
+		return e.scanTargetParallel(ctx, input, trace, done)
+	}
+	return e.scanTargetSequential(ctx, input, trace, done)
+}
+
+// buildGrab combines the responses of the scanners for the target, and applies
+// the enrichers.
+func (e *Engine) buildGrab(input *ScanTarget, moduleResult map[string]ScanResponse) *Grab {
+	grab := BuildGrabFromInputResponse(input, moduleResult)
+	e.mu.RLock()
+	enrichers := e.enrichers
+	e.mu.RUnlock()
+	for _, enricher := range enrichers {
+		enricher.Enrich(input, grab)
+	}
+	return grab
+}
+
+// scanTargetSequential runs each registered scanner whose trigger matches the
+// target's tag in turn, except those named in done, and returns their
+// responses.
+func (e *Engine) scanTargetSequential(ctx context.Context, input *ScanTarget, trace bool, done map[string]ScanResponse) map[string]ScanResponse {
+	if e.config.resolver.configured() {
+		e.config.resolver.resolveTarget(ctx, input)
+	}
+	moduleResult := make(map[string]ScanResponse)
+	for _, scannerName := range e.Scanners() {
+		if ctx.Err() != nil {
+			break
+		}
+		scanner := e.Scanner(scannerName)
+		if !input.HasTag(scanner.GetTrigger()) {
+			continue
+		}
+		if _, ok := done[scanner.GetName()]; ok {
+			continue
+		}
+		if run, _ := e.ready(scanner.GetName(), moduleResult, done); !run {
+			continue
+		}
+		defer func(name string) {
+			if r := recover(); r != nil {
+				log.Errorf("Panic on scanner %s when scanning target %s: %#v", scannerName, input.String(), r)
+				// Bubble out original error (with original stack) in lieu of explicitly logging the stack / error
+				panic(r)
+			}
+		}(scannerName)
+		input.trace = e.newTrace(trace)
+		name, res := RunScannerTimeout(ctx, scanner, e.monitor, *input, e.config.ScanTimeout)
+		e.finishTrace(input, name, &res, trace)
+		e.config.scanLog.record(input, name, &res)
+		input.trace = nil
+		moduleResult[name] = res
+		if res.Error != nil && !e.config.Multiple.ContinueOnError {
+			break
+		}
+		if res.Status == SCAN_SUCCESS && e.config.Multiple.BreakOnSuccess {
+			break
+		}
+	}
+	return moduleResult
+}
+
+// newTrace returns the Trace recording the connections of a scan, if it is
+// traced or packet captures are enabled, or nil.
+func (e *Engine) newTrace(trace bool) *Trace {
+	if !trace && e.config.capture == nil {
+		return nil
+	}
+	return NewTrace(e.config.TraceMaxBytes)
+}
+
+// finishTrace adds the trace of a scan of target by the named scanner to its
+// response if the target is traced, and writes it to the packet capture.
+func (e *Engine) finishTrace(target *ScanTarget, name string, res *ScanResponse, trace bool) {
+	if target.trace == nil {
+		return
+	}
+	events := target.trace.Events()
+	if trace {
+		res.Trace = events
+	}
+	if e.config.capture != nil {
+		if err := e.config.capture.write(target, name, res, events); err != nil {
+			log.Errorf("could not write the packet capture of %s: %s", target.String(), err)
+		}
+	}
+}
+
+// encodeGrab returns the encoded results of a target.
+func (e *Engine) encodeGrab(raw *Grab) ([]byte, error) {
+	result, err := EncodeGrab(raw, e.config.Debug)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal data: %s", err)
+	}
+	if e.config.outputFilter != nil || e.config.transformer != nil {
+		if result, err = rewriteRecord(result, e.config.outputFilter, e.config.transformer); err != nil {
+			return nil, fmt.Errorf("unable to filter data: %s", err)
+		}
+	}
+	return result, nil
+}
+
+// Run scans the targets received on targets with the configured number of
+// senders, and returns a channel on which the results of each target are
+// sent. The channel is closed once targets is closed and all its targets are
+// done, or once ctx is canceled: the targets not yet scanned by then are
+// dropped, and the results of those being scanned are discarded.
+func (e *Engine) Run(ctx context.Context, targets <-chan ScanTarget) <-chan *Grab {
+	results := make(chan *Grab, e.config.Senders*4)
+	go func() {
+		defer close(results)
+		e.run(ctx, targets, func(uint64) int {
+			return e.config.ConnectionsPerHost
+		}, func(_ uint64, grab *Grab) {
+			select {
+			case results <- grab:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	return results
+}
+
+// run scans the targets received on targets with the configured number of
+// senders until targets is closed and all its targets are done, or ctx is
+// canceled. The number of times to scan each target is given by runs, and
+// the results of each scan are passed to handle, with the position of the
+// target in the input. The targets abandoned when ctx is canceled are not
+// passed to handle.
+func (e *Engine) run(ctx context.Context, targets <-chan ScanTarget, runs func(seq uint64) int, handle func(seq uint64, grab *Grab)) {
+	workers := e.config.Senders
+	filter := newTargetFilter(e.config, e.monitor)
+	retries := newRetryQueue(e.config, workers*4)
+	if resolver := e.config.resolver; resolver != nil && resolver.allIPs {
+		targets = resolver.expandTargets(ctx, targets, workers)
+	}
+
+	var workerDone sync.WaitGroup
+	workerDone.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			defer workerDone.Done()
+			if err := e.InitPerSender(i); err != nil {
+				log.Errorf("could not initialize sender %d: %s", i, err)
+			}
+			for attempt := range retries.work {
+				if ctx.Err() != nil {
+					retries.finish()
+					continue
+				}
+				release := e.config.throttle.waitTarget(ctx, &attempt.target)
+				results := e.scanModules(ctx, &attempt.target, attempt.done)
+				release()
+				if ctx.Err() != nil {
+					// The scans were interrupted: their results are
+					// not those of the target.
+					retries.finish()
+					continue
+				}
+				if retries.retry(attempt, results) {
+					continue
+				}
+				grab := e.buildGrab(&attempt.target, attempt.done)
+				retries.finish()
+				handle(attempt.seq, grab)
+			}
+		}(i)
+	}
+
+	var seq uint64
+loop:
+	for {
+		select {
+		case target, ok := <-targets:
+			if !ok {
+				break loop
+			}
+			if !filter.allow(&target) {
+				// Skipped targets take no position in the input, so
+				// that --resume needs the same blocklist.
+				continue
+			}
+			for run := runs(seq); run > 0; run-- {
+				retries.add(target, seq)
+			}
+			seq++
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	retries.close()
+	workerDone.Wait()
+}
+
+// Process reads targets using the input function, scans them using the
+// configured number of senders, and passes the encoded results to the output
+// function. It returns once all targets have been scanned and all results
+// have been output.
+func (e *Engine) Process(input InputTargetsFunc, output OutputResultsFunc) error {
+	return e.ProcessContext(context.Background(), input, output)
+}
+
+// ProcessContext is like Process, but stops scanning once ctx is canceled: the
+// scans in progress are interrupted and their results discarded, the results
+// of the targets already done are output, and the scan state is saved so that
+// a scan with --resume picks up the remaining targets. It then returns the
+// context error, without waiting for the input function to finish.
+func (e *Engine) ProcessContext(ctx context.Context, input InputTargetsFunc, output OutputResultsFunc) error {
+	workers := e.config.Senders
+	processQueue := make(chan ScanTarget, workers*4)
+	outputQueue := make(chan []byte, workers*4)
+	checkpoint := e.config.checkpoint
+	stopCheckpoints := checkpoint.saveEvery(e.config.ResumeInterval)
+
+	// Start the output encoder
+	var outputDone sync.WaitGroup
+	outputDone.Add(1)
+	var outputErr error
+	go func() {
+		defer outputDone.Done()
+		outputErr = output(outputQueue)
+		// If the output stopped early, discard the remaining results so the
+		// workers are not blocked.
+		for range outputQueue {
+		}
+	}()
+
+	scanDone := make(chan struct{})
+	go func() {
+		defer close(scanDone)
+		e.run(ctx, processQueue, func(seq uint64) int {
+			return checkpoint.pending(seq, e.config.ConnectionsPerHost)
+		}, func(seq uint64, grab *Grab) {
+			result, err := e.encodeGrab(grab)
+			if err != nil {
+				log.Error(err)
+				checkpoint.drop(seq)
+				return
+			}
+			checkpoint.send(seq, result, outputQueue)
+			if e.monitor != nil {
+				e.monitor.recordTarget()
+			}
+		})
+	}()
+	inputDone := make(chan error, 1)
+	go func() {
+		inputDone <- input(processQueue)
+		close(processQueue)
+	}()
+	var inputErr error
+	select {
+	case inputErr = <-inputDone:
+		<-scanDone
+	case <-scanDone:
+		// The scan was canceled. Discard the targets still read so that
+		// the input function is not blocked.
+		go func() {
+			for range processQueue {
+			}
+		}()
+	}
+	close(outputQueue)
+	outputDone.Wait()
+	stopCheckpoints()
+	if err := checkpoint.save(); err != nil {
+		log.Errorf("could not save the scan state: %s", err)
+	}
+	if inputErr != nil {
+		return inputErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return outputErr
+}
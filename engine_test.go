@@ -0,0 +1,400 @@
+package zgrab2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type engineTestFlags struct {
+	BaseFlags
+	Fail    bool          `long:"fail"`
+	Flaky   int           `long:"flaky"`
+	Block   bool          `long:"block"`
+	Hang    time.Duration `long:"hang"`
+	Message string        `long:"message" default:"hello"`
+}
+
+func (f *engineTestFlags) Validate(args []string) error { return nil }
+
+func (f *engineTestFlags) Help() string { return "" }
+
+type engineTestModule struct{}
+
+func (m *engineTestModule) NewFlags() interface{} { return new(engineTestFlags) }
+
+func (m *engineTestModule) NewScanner() Scanner { return new(engineTestScanner) }
+
+func (m *engineTestModule) Description() string { return "test module" }
+
+type engineTestScanner struct {
+	config *engineTestFlags
+	scans  int32
+}
+
+func (s *engineTestScanner) Init(flags ScanFlags) error {
+	s.config = flags.(*engineTestFlags)
+	return nil
+}
+
+func (s *engineTestScanner) InitPerSender(senderID int) error { return nil }
+
+func (s *engineTestScanner) GetName() string { return s.config.Name }
+
+func (s *engineTestScanner) GetTrigger() string { return s.config.Trigger }
+
+func (s *engineTestScanner) Protocol() string { return "test" }
+
+func (s *engineTestScanner) Scan(ctx context.Context, t ScanTarget) (ScanStatus, interface{}, error) {
+	if s.config.Block {
+		<-ctx.Done()
+		return SCAN_UNKNOWN_ERROR, nil, ctx.Err()
+	}
+	if s.config.Hang > 0 {
+		// Ignore ctx, like a scanner stuck in a blocking call.
+		time.Sleep(s.config.Hang)
+	}
+	if s.config.Fail {
+		return SCAN_PROTOCOL_ERROR, nil, errors.New("failed")
+	}
+	if atomic.AddInt32(&s.scans, 1) <= int32(s.config.Flaky) {
+		return SCAN_CONNECTION_TIMEOUT, nil, errors.New("timed out")
+	}
+	return SCAN_SUCCESS, s.config.Message, nil
+}
+
+func TestEngine(t *testing.T) {
+	engine, err := NewEngine(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.AddModule("test", new(engineTestModule))
+
+	flags, err := engine.NewFlags("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testFlags := flags.(*engineTestFlags)
+	if testFlags.Message != "hello" || testFlags.Timeout != 10*time.Second {
+		t.Errorf("defaults not applied: %+v", testFlags)
+	}
+	if _, err := engine.NewScanner("test", flags); err != nil {
+		t.Fatal(err)
+	}
+
+	failFlags, _ := engine.NewFlags("test")
+	failFlags.(*engineTestFlags).Name = "failing"
+	failFlags.(*engineTestFlags).Fail = true
+	if _, err := engine.NewScanner("test", failFlags); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.NewScanner("test", flags); err == nil {
+		t.Error("expected an error registering a duplicate scanner name")
+	}
+	if _, err := engine.NewScanner("missing", flags); err == nil {
+		t.Error("expected an error for an unknown module")
+	}
+
+	grab := engine.ScanTarget(ScanTarget{IP: net.ParseIP("192.0.2.1")})
+	if grab.IP != "192.0.2.1" {
+		t.Errorf("wrong IP %q", grab.IP)
+	}
+	if res := grab.Data["test"]; res.Status != SCAN_SUCCESS || res.Result != "hello" {
+		t.Errorf("unexpected test result %+v", res)
+	}
+	if res := grab.Data["failing"]; res.Status != SCAN_PROTOCOL_ERROR || res.Error == nil {
+		t.Errorf("unexpected failing result %+v", res)
+	}
+
+	// Engines are independent of each other and of the default engine.
+	other, _ := NewEngine(nil)
+	if other.Module("test") != nil || len(other.Scanners()) != 0 {
+		t.Error("engine state leaked into a new engine")
+	}
+	if defaultEngine.Module("test") != nil {
+		t.Error("engine state leaked into the default engine")
+	}
+}
+
+func TestEngineScanTimeout(t *testing.T) {
+	config := &Config{ScanTimeout: 50 * time.Millisecond}
+	config.Multiple.ContinueOnError = true
+	engine, _ := NewEngine(config)
+	engine.AddModule("test", new(engineTestModule))
+	for name, set := range map[string]func(*engineTestFlags){
+		"blocking": func(f *engineTestFlags) { f.Block = true },
+		"hanging":  func(f *engineTestFlags) { f.Hang = 5 * time.Second },
+		"fast":     func(f *engineTestFlags) {},
+	} {
+		flags, _ := engine.NewFlags("test")
+		flags.(*engineTestFlags).Name = name
+		set(flags.(*engineTestFlags))
+		if _, err := engine.NewScanner("test", flags); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	grab := engine.ScanTarget(ScanTarget{IP: net.ParseIP("192.0.2.1")})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("scan took %s", elapsed)
+	}
+	for _, name := range []string{"blocking", "hanging"} {
+		res := grab.Data[name]
+		if res.Status != SCAN_IO_TIMEOUT || res.Error == nil || *res.Error != ErrScanTimeout.Error() {
+			t.Errorf("unexpected %s result %+v", name, res)
+		}
+		if res.Elapsed < 0.05 {
+			t.Errorf("%s scan elapsed %f seconds", name, res.Elapsed)
+		}
+	}
+	if res := grab.Data["fast"]; res.Status != SCAN_SUCCESS || res.Result != "hello" || res.Elapsed <= 0 {
+		t.Errorf("unexpected fast result %+v", res)
+	}
+}
+
+func TestEngineRetries(t *testing.T) {
+	engine, _ := NewEngine(&Config{Retries: 3, RetryBackoff: time.Millisecond})
+	engine.AddModule("test", new(engineTestModule))
+	flags, _ := engine.NewFlags("test")
+	flags.(*engineTestFlags).Flaky = 2
+	if _, err := engine.NewScanner("test", flags); err != nil {
+		t.Fatal(err)
+	}
+	steady, _ := engine.NewFlags("test")
+	steady.(*engineTestFlags).Name = "steady"
+	if _, err := engine.NewScanner("test", steady); err != nil {
+		t.Fatal(err)
+	}
+
+	process := func() Grab {
+		var grabs []Grab
+		err := engine.Process(func(ch chan<- ScanTarget) error {
+			ch <- ScanTarget{IP: net.ParseIP("192.0.2.1")}
+			return nil
+		}, func(results <-chan []byte) error {
+			for result := range results {
+				var grab Grab
+				if err := json.Unmarshal(result, &grab); err != nil {
+					return err
+				}
+				grabs = append(grabs, grab)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(grabs) != 1 {
+			t.Fatalf("got %d results; expected 1", len(grabs))
+		}
+		return grabs[0]
+	}
+
+	grab := process()
+	if res := grab.Data["test"]; res.Status != SCAN_SUCCESS || res.Attempts != 3 {
+		t.Errorf("unexpected result after retries %+v", res)
+	}
+	if res := grab.Data["steady"]; res.Status != SCAN_SUCCESS || res.Attempts != 0 {
+		t.Errorf("scanner without failures was retried: %+v", res)
+	}
+
+	// Once the retries are used up, the last failure is output.
+	flags.(*engineTestFlags).Flaky = 100
+	grab = process()
+	if res := grab.Data["test"]; res.Status != SCAN_CONNECTION_TIMEOUT || res.Attempts != 4 {
+		t.Errorf("unexpected result after failed retries %+v", res)
+	}
+}
+
+// TestEngineRetriesPerScanner checks that the attempts of a scanner count its
+// own runs: a scanner first run on the second attempt of the target, once the
+// failure of the scanner before it no longer stops the scan, is not retried.
+func TestEngineRetriesPerScanner(t *testing.T) {
+	engine, _ := NewEngine(&Config{Retries: 3, RetryBackoff: time.Millisecond})
+	engine.AddModule("test", new(engineTestModule))
+	flags, _ := engine.NewFlags("test")
+	flags.(*engineTestFlags).Flaky = 1
+	if _, err := engine.NewScanner("test", flags); err != nil {
+		t.Fatal(err)
+	}
+	steady, _ := engine.NewFlags("test")
+	steady.(*engineTestFlags).Name = "steady"
+	if _, err := engine.NewScanner("test", steady); err != nil {
+		t.Fatal(err)
+	}
+
+	var grab Grab
+	err := engine.Process(func(ch chan<- ScanTarget) error {
+		ch <- ScanTarget{IP: net.ParseIP("192.0.2.1")}
+		return nil
+	}, func(results <-chan []byte) error {
+		for result := range results {
+			if err := json.Unmarshal(result, &grab); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := grab.Data["test"]; res.Status != SCAN_SUCCESS || res.Attempts != 2 {
+		t.Errorf("unexpected result after a retry %+v", res)
+	}
+	if res := grab.Data["steady"]; res.Status != SCAN_SUCCESS || res.Attempts != 0 {
+		t.Errorf("scanner run once counted %d attempts: %+v", res.Attempts, res)
+	}
+}
+
+func TestEngineRun(t *testing.T) {
+	engine, _ := NewEngine(&Config{Senders: 2})
+	engine.AddModule("test", new(engineTestModule))
+	flags, _ := engine.NewFlags("test")
+	if _, err := engine.NewScanner("test", flags); err != nil {
+		t.Fatal(err)
+	}
+
+	targets := make(chan ScanTarget)
+	results := engine.Run(context.Background(), targets)
+	go func() {
+		for i := 1; i <= 3; i++ {
+			targets <- ScanTarget{IP: net.IPv4(192, 0, 2, byte(i))}
+		}
+		close(targets)
+	}()
+	seen := make(map[string]bool)
+	for grab := range results {
+		if res := grab.Data["test"]; res.Status != SCAN_SUCCESS {
+			t.Errorf("unexpected result %+v", res)
+		}
+		seen[grab.IP] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("got results for %v; expected 3 targets", seen)
+	}
+
+	// Once the context is canceled, the results channel is closed even
+	// though the targets channel is not.
+	ctx, cancel := context.WithCancel(context.Background())
+	results = engine.Run(ctx, make(chan ScanTarget))
+	cancel()
+	select {
+	case _, ok := <-results:
+		if ok {
+			t.Error("got a result for no target")
+		}
+	case <-time.After(time.Second):
+		t.Error("results not closed after cancellation")
+	}
+}
+
+func TestEngineProcessContext(t *testing.T) {
+	engine, _ := NewEngine(&Config{Senders: 1})
+	engine.AddModule("test", new(engineTestModule))
+	flags, _ := engine.NewFlags("test")
+	flags.(*engineTestFlags).Block = true
+	if _, err := engine.NewScanner("test", flags); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// The input never ends: only the cancellation stops the scan.
+	input := func(ch chan<- ScanTarget) error {
+		for i := 0; ; i++ {
+			ch <- ScanTarget{IP: net.IPv4(192, 0, 2, byte(i))}
+		}
+	}
+	var records [][]byte
+	output := func(results <-chan []byte) error {
+		for result := range results {
+			records = append(records, result)
+		}
+		return nil
+	}
+	time.AfterFunc(100*time.Millisecond, cancel)
+	done := make(chan error, 1)
+	go func() {
+		done <- engine.ProcessContext(ctx, input, output)
+	}()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("got error %v; expected %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProcessContext did not return after cancellation")
+	}
+	if len(records) != 0 {
+		t.Errorf("got records %q of interrupted scans", records)
+	}
+}
+
+func TestEngineFilter(t *testing.T) {
+	config := &Config{Dedup: true}
+	config.blocklist, _ = ParseBlocklist(strings.NewReader("192.0.2.0/30"))
+	engine, _ := NewEngine(config)
+	engine.AddModule("test", new(engineTestModule))
+	flags, _ := engine.NewFlags("test")
+	if _, err := engine.NewScanner("test", flags); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	monitor := MakeMonitor(1, &wg)
+	engine.SetMonitor(monitor)
+
+	port := uint(8080)
+	targets := make(chan ScanTarget)
+	results := engine.Run(context.Background(), targets)
+	go func() {
+		for _, target := range []ScanTarget{
+			{IP: net.ParseIP("192.0.2.1")},
+			{IP: net.ParseIP("192.0.2.5")},
+			{IP: net.ParseIP("192.0.2.5")},
+			{IP: net.ParseIP("192.0.2.5"), Port: &port},
+			{IP: net.ParseIP("192.0.2.5"), Tag: "other"},
+			{IP: net.ParseIP("192.0.2.3"), Port: &port},
+			{Domain: "example.com"},
+			{Domain: "example.com"},
+		} {
+			targets <- target
+		}
+		close(targets)
+	}()
+	n := 0
+	for range results {
+		n++
+	}
+	monitor.Stop()
+	wg.Wait()
+	if n != 4 {
+		t.Errorf("got %d results; expected 4", n)
+	}
+	if skipped := monitor.Skipped(); skipped != (SkipStats{Blocked: 2, Duplicate: 2}) {
+		t.Errorf("got skipped %+v", skipped)
+	}
+}
+
+func TestEngineScanTargetBlocked(t *testing.T) {
+	config := &Config{}
+	config.blocklist, _ = ParseBlocklist(strings.NewReader("192.0.2.0/30"))
+	engine, _ := NewEngine(config)
+	engine.AddModule("test", new(engineTestModule))
+	flags, _ := engine.NewFlags("test")
+	if _, err := engine.NewScanner("test", flags); err != nil {
+		t.Fatal(err)
+	}
+	grab := engine.ScanTarget(ScanTarget{IP: net.ParseIP("192.0.2.1")})
+	if res := grab.Data["test"]; res.Status != SCAN_BLOCKED || res.Error == nil {
+		t.Errorf("unexpected result %+v for a blocked target", res)
+	}
+	grab = engine.ScanTarget(ScanTarget{IP: net.ParseIP("192.0.2.5")})
+	if res := grab.Data["test"]; res.Status != SCAN_SUCCESS {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
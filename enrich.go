@@ -0,0 +1,104 @@
+package zgrab2
+
+import (
+	"encoding/json"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2/lib/geo"
+	"github.com/zmap/zgrab2/lib/honeypot"
+)
+
+// Enricher adds information to a target's results after all of its scanners
+// have run.
+type Enricher interface {
+	Enrich(target *ScanTarget, grab *Grab)
+}
+
+// GeoEnricher sets the location and routing information of each target's IP
+// address from offline databases.
+type GeoEnricher struct {
+	Databases geo.Databases
+}
+
+// Enrich implements Enricher.
+func (e *GeoEnricher) Enrich(target *ScanTarget, grab *Grab) {
+	if target.IP == nil {
+		return
+	}
+	grab.Geo = e.Databases.Lookup(target.IP)
+}
+
+// openGeoDatabases opens the enrichment databases given in the config. The
+// routing table is queried first, so that its (more specific) prefixes take
+// precedence over those of the MaxMind ASN databases.
+func openGeoDatabases(config *Config) (geo.Databases, error) {
+	var dbs geo.Databases
+	if config.ASNTable != "" {
+		table, err := geo.OpenRoutingTable(config.ASNTable)
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, table)
+	}
+	for _, path := range config.GeoIPDatabases {
+		db, err := geo.OpenMaxMindDB(path)
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, db)
+	}
+	if config.IP2LocationDB != "" {
+		db, err := geo.OpenIP2LocationDB(config.IP2LocationDB)
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+// HoneypotEnricher scores the likelihood that each target is a honeypot or a
+// middlebox, using heuristics across the results of all of its scanners.
+type HoneypotEnricher struct {
+	Scorer *honeypot.Scorer
+}
+
+// Enrich implements Enricher.
+func (e *HoneypotEnricher) Enrich(target *ScanTarget, grab *Grab) {
+	responses := make([]honeypot.Response, 0, len(grab.Data))
+	for name, res := range grab.Data {
+		r := honeypot.Response{Name: name, Protocol: res.Protocol, Status: string(res.Status)}
+		if res.Result != nil {
+			// The heuristics inspect the results as they appear in the
+			// output, independent of each module's types.
+			encoded, err := json.Marshal(res.Result)
+			if err == nil {
+				err = json.Unmarshal(encoded, &r.Result)
+			}
+			if err != nil {
+				log.Debugf("could not decode %s result for honeypot scoring: %v", name, err)
+			}
+		}
+		responses = append(responses, r)
+	}
+	if len(responses) > 0 {
+		grab.Anomaly = e.Scorer.Score(responses)
+	}
+}
+
+// newHoneypotEnricher returns the HoneypotEnricher configured by config.
+func newHoneypotEnricher(config *Config) (*HoneypotEnricher, error) {
+	fingerprints := honeypot.DefaultFingerprints
+	if config.HoneypotRules != "" {
+		extra, err := honeypot.LoadFingerprints(config.HoneypotRules)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints = append(append([]honeypot.Fingerprint(nil), fingerprints...), extra...)
+	}
+	scorer, err := honeypot.NewScorer(fingerprints)
+	if err != nil {
+		return nil, err
+	}
+	return &HoneypotEnricher{Scorer: scorer}, nil
+}
@@ -3,6 +3,8 @@ module github.com/zmap/zgrab2
 go 1.12
 
 require (
+	github.com/andybalholm/brotli v1.0.0
+	github.com/klauspost/compress v1.10.10
 	github.com/prometheus/client_golang v1.1.0
 	github.com/sirupsen/logrus v1.4.2
 	github.com/zmap/zcrypto v0.0.0-20200508204656-27de22294d44
@@ -1,11 +1,16 @@
 package zgrab2
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -65,6 +70,30 @@ func ParseCSVTarget(fields []string) (ipnet *net.IPNet, domain string, tag strin
 	return
 }
 
+// ParsePorts parses a list of ports and port ranges, separated by commas or
+// spaces, such as "80,443 8000-8010".
+func ParsePorts(s string) ([]uint, error) {
+	var ports []uint
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		first, last := field, field
+		if i := strings.Index(field, "-"); i >= 0 {
+			first, last = field[:i], field[i+1:]
+		}
+		low, err := strconv.ParseUint(first, 10, 16)
+		if err != nil || low == 0 {
+			return nil, fmt.Errorf("invalid port %q", field)
+		}
+		high, err := strconv.ParseUint(last, 10, 16)
+		if err != nil || high < low {
+			return nil, fmt.Errorf("invalid port range %q", field)
+		}
+		for port := low; port <= high; port++ {
+			ports = append(ports, uint(port))
+		}
+	}
+	return ports, nil
+}
+
 func incrementIP(ip net.IP) {
 	for j := len(ip) - 1; j >= 0; j-- {
 		ip[j]++
@@ -80,14 +109,44 @@ func duplicateIP(ip net.IP) net.IP {
 	return dup
 }
 
+// countingReader wraps an io.Reader, keeping track of the number of bytes
+// that have been read from it.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// InputProgress returns the number of bytes consumed from the input file so
+// far, and the total size of the input file. The total is zero if the size is
+// not known in advance (e.g. when reading from a pipe).
+func InputProgress() (read int64, total int64) {
+	if config.inputReader == nil {
+		return 0, 0
+	}
+	return atomic.LoadInt64(&config.inputReader.n), config.inputSize
+}
+
 // InputTargetsCSV is an InputTargetsFunc that calls GetTargetsCSV with
 // the CSV file provided on the command line.
 func InputTargetsCSV(ch chan<- ScanTarget) error {
-	return GetTargetsCSV(config.inputFile, ch)
+	return GetTargetsCSV(config.inputReader, ch)
 }
 
 // GetTargetsCSV reads targets from a CSV source, generates ScanTargets,
 // and delivers them to the provided channel.
+//
+// Besides the fields parsed by ParseCSVTarget, a record may have a fourth
+// field listing, separated by spaces, the virtual hosts to request from the
+// target's IP (see ScanTarget.VHosts), a fifth field with the proxy to
+// connect to the target through (see ScanTarget.Proxy), and a sixth field with
+// the ports to scan (see ParsePorts), each in a ScanTarget of its own:
+//   IP, DOMAIN, TAG, VHOSTS, PROXY, PORTS
 func GetTargetsCSV(source io.Reader, ch chan<- ScanTarget) error {
 	csvreader := csv.NewReader(source)
 	csvreader.Comment = '#'
@@ -102,28 +161,162 @@ func GetTargetsCSV(source io.Reader, ch chan<- ScanTarget) error {
 		if len(fields) == 0 {
 			continue
 		}
+		var vhosts []string
+		var proxy, portList string
+		if len(fields) == 6 {
+			portList = fields[5]
+			fields = fields[:5]
+		}
+		if len(fields) == 5 {
+			proxy = strings.TrimSpace(fields[4])
+			fields = fields[:4]
+		}
+		if len(fields) == 4 {
+			vhosts = strings.Fields(fields[3])
+			fields = fields[:3]
+		}
 		ipnet, domain, tag, err := ParseCSVTarget(fields)
+		if err == nil && proxy != "" {
+			_, err = ParseProxy(proxy)
+		}
+		var ports []uint
+		if err == nil {
+			ports, err = ParsePorts(portList)
+		}
 		if err != nil {
 			log.Errorf("parse error, skipping: %v", err)
 			continue
 		}
-		var ip net.IP
-		if ipnet != nil {
-			if ipnet.Mask != nil {
-				// expand CIDR block into one target for each IP
-				for ip = ipnet.IP.Mask(ipnet.Mask); ipnet.Contains(ip); incrementIP(ip) {
-					ch <- ScanTarget{IP: duplicateIP(ip), Domain: domain, Tag: tag}
-				}
-				continue
-			} else {
-				ip = ipnet.IP
-			}
-		}
-		ch <- ScanTarget{IP: ip, Domain: domain, Tag: tag}
+		sendTargets(ch, ipnet, ScanTarget{Domain: domain, Tag: tag, VHosts: vhosts, Proxy: proxy}, ports)
 	}
 	return nil
 }
 
+// InputTargetsJSON is an InputTargetsFunc that calls GetTargetsJSON with
+// the input file provided on the command line.
+func InputTargetsJSON(ch chan<- ScanTarget) error {
+	return GetTargetsJSON(config.inputReader, ch)
+}
+
+// jsonTarget is a record of the JSON input.
+type jsonTarget struct {
+	IP     string   `json:"ip"`
+	Domain string   `json:"domain"`
+	Port   uint     `json:"port"`
+	Ports  string   `json:"ports"`
+	Tag    string   `json:"tag"`
+	Tags   []string `json:"tags"`
+	VHosts []string `json:"vhosts"`
+	Proxy  string   `json:"proxy"`
+	TargetOptions
+}
+
+// GetTargetsJSON reads targets from a source with one JSON object per line,
+// generates ScanTargets, and delivers them to the provided channel. Besides
+// the fields of the CSV input (ip, which may be a CIDR block, domain, tag,
+// vhosts, proxy and ports, a list as in the CSV input), an object may give a
+// single port, a list of tags, and the options of TargetOptions:
+//   {"ip": "10.0.0.1", "port": 8443, "tags": ["web"], "endpoint": "/admin", "sni": "example.com"}
+// Empty lines and lines beginning with # are ignored.
+func GetTargetsJSON(source io.Reader, ch chan<- ScanTarget) error {
+	scanner := bufio.NewScanner(source)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 || data[0] == '#' {
+			continue
+		}
+		ipnet, target, ports, err := parseJSONTarget(data)
+		if err != nil {
+			log.Errorf("parse error on line %d, skipping: %v", line, err)
+			continue
+		}
+		sendTargets(ch, ipnet, target, ports)
+	}
+	return scanner.Err()
+}
+
+// parseJSONTarget parses a record of the JSON input into the network or
+// address to scan, if any, the other fields of its targets, and their ports.
+func parseJSONTarget(data []byte) (ipnet *net.IPNet, target ScanTarget, ports []uint, err error) {
+	var record jsonTarget
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&record); err != nil {
+		return
+	}
+	if record.IP != "" {
+		if ip := net.ParseIP(record.IP); ip != nil {
+			ipnet = &net.IPNet{IP: ip}
+		} else if _, cidr, er := net.ParseCIDR(record.IP); er == nil {
+			ipnet = cidr
+		} else {
+			err = fmt.Errorf("can't parse %q as an IP address or CIDR block", record.IP)
+			return
+		}
+	}
+	if ipnet == nil && record.Domain == "" {
+		err = fmt.Errorf("record doesn't specify an address, network, or domain: %s", data)
+		return
+	}
+	if record.Proxy != "" {
+		if _, err = ParseProxy(record.Proxy); err != nil {
+			return
+		}
+	}
+	if ports, err = ParsePorts(record.Ports); err != nil {
+		return
+	}
+	if record.Port != 0 {
+		if record.Port > 65535 {
+			err = fmt.Errorf("invalid port %d", record.Port)
+			return
+		}
+		ports = append(ports, record.Port)
+	}
+	target = ScanTarget{Domain: record.Domain, VHosts: record.VHosts, Proxy: record.Proxy}
+	tags := record.Tags
+	if record.Tag != "" {
+		tags = append([]string{record.Tag}, tags...)
+	}
+	if len(tags) > 0 {
+		target.Tag, target.Tags = tags[0], tags[1:]
+	}
+	if record.TargetOptions != (TargetOptions{}) {
+		target.Options = &record.TargetOptions
+	}
+	return
+}
+
+// sendTargets delivers a copy of target to ch for each address of ipnet (once
+// without an address if ipnet is nil), and for each of ports, if any.
+func sendTargets(ch chan<- ScanTarget, ipnet *net.IPNet, target ScanTarget, ports []uint) {
+	send := func(ip net.IP) {
+		target.IP = ip
+		if len(ports) == 0 {
+			ch <- target
+			return
+		}
+		for _, port := range ports {
+			port := port
+			target.Port = &port
+			ch <- target
+		}
+	}
+	if ipnet != nil && ipnet.Mask != nil {
+		// expand CIDR block into one target for each IP
+		for ip := ipnet.IP.Mask(ipnet.Mask); ipnet.Contains(ip); incrementIP(ip) {
+			send(duplicateIP(ip))
+		}
+		return
+	}
+	if ipnet != nil {
+		send(ipnet.IP)
+	} else {
+		send(nil)
+	}
+}
+
 // InputTargetsFunc is a function type for target input functions.
 //
 // A function of this type generates ScanTargets on the provided
@@ -1,6 +1,7 @@
 package zgrab2
 
 import (
+	"fmt"
 	"net"
 	"strings"
 	"testing"
@@ -150,8 +151,11 @@ func TestGetTargetsCSV(t *testing.T) {
 10.0.0.1
 ,example.com
 example.com
-2.2.2.2/30,, tag`
+2.2.2.2/30,, tag
+10.0.0.2,,,a.example.com  b.example.com
+10.0.0.3,,,,,"22, 8080-8081"`
 
+	port := func(p uint) *uint { return &p }
 	expected := []ScanTarget{
 		ScanTarget{IP: net.ParseIP("10.0.0.1"), Domain: "example.com", Tag: "tag"},
 		ScanTarget{IP: net.ParseIP("10.0.0.1"), Domain: "example.com"},
@@ -162,6 +166,10 @@ example.com
 		ScanTarget{IP: net.ParseIP("2.2.2.1"), Tag: "tag"},
 		ScanTarget{IP: net.ParseIP("2.2.2.2"), Tag: "tag"},
 		ScanTarget{IP: net.ParseIP("2.2.2.3"), Tag: "tag"},
+		ScanTarget{IP: net.ParseIP("10.0.0.2"), VHosts: []string{"a.example.com", "b.example.com"}},
+		ScanTarget{IP: net.ParseIP("10.0.0.3"), Port: port(22)},
+		ScanTarget{IP: net.ParseIP("10.0.0.3"), Port: port(8080)},
+		ScanTarget{IP: net.ParseIP("10.0.0.3"), Port: port(8081)},
 	}
 
 	ch := make(chan ScanTarget, 0)
@@ -184,8 +192,65 @@ example.com
 	for i := range expected {
 		if res[i].IP.String() != expected[i].IP.String() ||
 			res[i].Domain != expected[i].Domain ||
-			res[i].Tag != expected[i].Tag {
+			res[i].Tag != expected[i].Tag ||
+			strings.Join(res[i].VHosts, " ") != strings.Join(expected[i].VHosts, " ") ||
+			(res[i].Port == nil) != (expected[i].Port == nil) ||
+			(res[i].Port != nil && *res[i].Port != *expected[i].Port) {
 			t.Errorf("wrong data in ScanTarget %d (got %v; expected %v)", i, res[i], expected[i])
 		}
 	}
 }
+
+func TestParsePorts(t *testing.T) {
+	ports, err := ParsePorts("80,443 8000-8002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ports) != "[80 443 8000 8001 8002]" {
+		t.Errorf("parsed %v", ports)
+	}
+	for _, s := range []string{"0", "65536", "http", "90-80", "1-"} {
+		if _, err := ParsePorts(s); err == nil {
+			t.Errorf("ParsePorts(%q) succeeded", s)
+		}
+	}
+}
+
+func TestGetTargetsJSON(t *testing.T) {
+	input := `# Comment
+{"ip": "10.0.0.1", "domain": "example.com", "tags": ["web", "tls"], "endpoint": "/admin", "sni": "sni.example.com"}
+
+{"ip": "10.0.0.0/31", "port": 8443}
+{"domain": "example.org", "tag": "web", "credentials": "router", "ports": "80 443"}
+{"ip": "10.0.0.300"}
+{"ip": "10.0.0.2", "unknown": 1}`
+
+	ch := make(chan ScanTarget)
+	go func() {
+		if err := GetTargetsJSON(strings.NewReader(input), ch); err != nil {
+			t.Errorf("GetTargetsJSON error: %v", err)
+		}
+		close(ch)
+	}()
+	var res []ScanTarget
+	for r := range ch {
+		res = append(res, r)
+	}
+	if len(res) != 5 {
+		t.Fatalf("wrong number of results (got %d; expected 5): %v", len(res), res)
+	}
+	if res[0].Tag != "web" || !res[0].HasTag("tls") || res[0].HasTag("") ||
+		res[0].GetOptions() != (TargetOptions{Endpoint: "/admin", SNI: "sni.example.com"}) {
+		t.Errorf("wrong data in first target %+v", res[0])
+	}
+	for i, ip := range []string{"10.0.0.0", "10.0.0.1"} {
+		if r := res[1+i]; r.IP.String() != ip || r.Port == nil || *r.Port != 8443 || r.Options != nil || !r.HasTag("") {
+			t.Errorf("wrong data in target %d %+v", 1+i, r)
+		}
+	}
+	for i, port := range []uint{80, 443} {
+		if r := res[3+i]; r.Domain != "example.org" || r.IP != nil || *r.Port != port || r.GetOptions().Credentials != "router" {
+			t.Errorf("wrong data in target %d %+v", 3+i, r)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package zgrab2test provides helpers for the unit tests of the scan modules,
+// which scan a fake server on the loopback interface, such as those of the
+// lib/testserver package.
+package zgrab2test
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/zmap/zgrab2"
+)
+
+// Timeout is the timeout of the scans of Scan, unless their flags set one.
+const Timeout = 5 * time.Second
+
+// Port returns the port of addr, the host:port address of a test server.
+func Port(t testing.TB, addr string) uint {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uint(p)
+}
+
+// Scan initializes scanner with flags, and scans 127.0.0.1 with it on the
+// port of addr, the host:port address of a test server. The port of the
+// BaseFlags of flags is set, and their timeout to Timeout if there is none.
+// The test fails if the scanner can't be initialized.
+func Scan(t testing.TB, scanner zgrab2.Scanner, flags zgrab2.ScanFlags, addr string) (zgrab2.ScanStatus, interface{}, error) {
+	base := zgrab2.GetBaseFlags(flags)
+	if base == nil {
+		t.Fatalf("no BaseFlags in %T", flags)
+	}
+	base.Port = Port(t, addr)
+	if base.Timeout == 0 {
+		base.Timeout = Timeout
+	}
+	if err := scanner.Init(flags); err != nil {
+		t.Fatal(err)
+	}
+	return scanner.Scan(context.Background(), zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")})
+}
+
+// MustScan is like Scan, but fails the test unless the scan succeeds, and
+// only returns its result.
+func MustScan(t testing.TB, scanner zgrab2.Scanner, flags zgrab2.ScanFlags, addr string) interface{} {
+	status, ret, err := Scan(t, scanner, flags, addr)
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	return ret
+}
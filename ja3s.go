@@ -0,0 +1,222 @@
+package zgrab2
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// maxHandshakeLength is the maximum length of a handshake message recorded
+// while waiting for the ServerHelloDone.
+const maxHandshakeLength = 1 << 18
+
+// ServerHelloFingerprint is the JA3S fingerprint of the ServerHello, with the
+// parameters it is computed from.
+type ServerHelloFingerprint struct {
+	// Version is the legacy version of the ServerHello (771 for TLS 1.2 and
+	// TLS 1.3).
+	Version uint16 `json:"version"`
+
+	CipherSuite uint16 `json:"cipher_suite"`
+
+	// Extensions are the types of the extensions, in the order they were
+	// sent.
+	Extensions []uint16 `json:"extensions"`
+
+	// JA3S is the fingerprint string: the version, cipher suite and
+	// extensions, in decimal.
+	JA3S string `json:"ja3s"`
+
+	// JA3SHash is the MD5 hash of JA3S.
+	JA3SHash string `json:"ja3s_hash"`
+}
+
+// isGREASE returns true if v is a GREASE value (RFC 8701), which JA3S
+// ignores.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// tlsExtension is an extension of a handshake message.
+type tlsExtension struct {
+	typ  uint16
+	data []byte
+}
+
+// splitServerHello returns the legacy version, the cipher suite and the
+// extensions of a ServerHello handshake message. ok is false if msg is not a
+// valid ServerHello.
+func splitServerHello(msg []byte) (version, cipher uint16, extensions []tlsExtension, ok bool) {
+	// The type, length, version, random and session ID length.
+	if len(msg) < 4+2+32+1 || msg[0] != 2 {
+		return 0, 0, nil, false
+	}
+	pos := 4 + 2 + 32
+	pos += 1 + int(msg[pos])
+	// The cipher suite and compression method.
+	if len(msg) < pos+3 {
+		return 0, 0, nil, false
+	}
+	version = binary.BigEndian.Uint16(msg[4:])
+	cipher = binary.BigEndian.Uint16(msg[pos:])
+	pos += 3
+	if len(msg) < pos+2 {
+		return version, cipher, nil, true
+	}
+	end := pos + 2 + int(binary.BigEndian.Uint16(msg[pos:]))
+	if end > len(msg) {
+		return 0, 0, nil, false
+	}
+	for pos += 2; pos < end; {
+		if pos+4 > end {
+			return 0, 0, nil, false
+		}
+		typ := binary.BigEndian.Uint16(msg[pos:])
+		length := int(binary.BigEndian.Uint16(msg[pos+2:]))
+		if pos+4+length > end {
+			return 0, 0, nil, false
+		}
+		extensions = append(extensions, tlsExtension{typ: typ, data: msg[pos+4 : pos+4+length]})
+		pos += 4 + length
+	}
+	return version, cipher, extensions, true
+}
+
+// ParseServerHello returns the fingerprint of a ServerHello handshake
+// message, or nil if msg is not a valid ServerHello.
+func ParseServerHello(msg []byte) *ServerHelloFingerprint {
+	version, cipher, extensions, ok := splitServerHello(msg)
+	if !ok {
+		return nil
+	}
+	fp := &ServerHelloFingerprint{
+		Version:     version,
+		CipherSuite: cipher,
+		Extensions:  []uint16{},
+	}
+	var types []string
+	for _, e := range extensions {
+		if !isGREASE(e.typ) {
+			fp.Extensions = append(fp.Extensions, e.typ)
+			types = append(types, fmt.Sprint(e.typ))
+		}
+	}
+	fp.JA3S = fmt.Sprintf("%d,%d,%s", fp.Version, fp.CipherSuite, strings.Join(types, "-"))
+	sum := md5.Sum([]byte(fp.JA3S))
+	fp.JA3SHash = hex.EncodeToString(sum[:])
+	return fp
+}
+
+// helloRecorder wraps the connection of a TLS client, and records the
+// handshake messages read from the server up to the ServerHelloDone, to
+// fingerprint the ServerHello and read the CertificateStatus and
+// CertificateRequest without changing the handshake.
+type helloRecorder struct {
+	net.Conn
+
+	mu sync.Mutex
+
+	// records are the bytes read from the server, until done.
+	records []byte
+
+	// handshake is the payload of the handshake records read, from the
+	// first incomplete message.
+	handshake []byte
+
+	serverHelloMsg        []byte
+	certificateMsg        []byte
+	certificateStatusMsg  []byte
+	certificateRequestMsg []byte
+
+	done bool
+}
+
+func (r *helloRecorder) Read(b []byte) (int, error) {
+	n, err := r.Conn.Read(b)
+	if n > 0 {
+		r.record(b[:n])
+	}
+	return n, err
+}
+
+// record appends data read from the server, and parses the handshake
+// messages of the complete records. Recording stops after the
+// ServerHelloDone, or at the first record other than a handshake record,
+// such as the ChangeCipherSpec of a resumed session or the encrypted records
+// of TLS 1.3.
+func (r *helloRecorder) record(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.records = append(r.records, data...)
+	for !r.done && len(r.records) >= 5 {
+		length := int(binary.BigEndian.Uint16(r.records[3:]))
+		if r.records[0] != 22 || len(r.handshake)+length > maxHandshakeLength {
+			r.done = true
+			break
+		}
+		if len(r.records) < 5+length {
+			break
+		}
+		r.handshake = append(r.handshake, r.records[5:5+length]...)
+		r.records = r.records[5+length:]
+		for len(r.handshake) >= 4 {
+			n := 4 + (int(r.handshake[1])<<16 | int(r.handshake[2])<<8 | int(r.handshake[3]))
+			if len(r.handshake) < n {
+				break
+			}
+			msg := append([]byte(nil), r.handshake[:n]...)
+			r.handshake = r.handshake[n:]
+			switch msg[0] {
+			case 2:
+				r.serverHelloMsg = msg
+			case 11:
+				r.certificateMsg = msg
+			case 13:
+				r.certificateRequestMsg = msg
+			case 22:
+				r.certificateStatusMsg = msg
+			case 14:
+				r.done = true
+			}
+			if r.done {
+				break
+			}
+		}
+	}
+	if r.done {
+		r.records, r.handshake = nil, nil
+	}
+}
+
+// serverHello returns the ServerHello message read, or nil if it was not read
+// completely.
+func (r *helloRecorder) serverHello() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.serverHelloMsg
+}
+
+// isDone returns true once the ServerHelloDone, or a record other than a
+// handshake record, was read.
+func (r *helloRecorder) isDone() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.done
+}
+
+// fingerprint returns the fingerprint of the ServerHello read, or nil if the
+// ServerHello was not read completely.
+func (r *helloRecorder) fingerprint() *ServerHelloFingerprint {
+	msg := r.serverHello()
+	if msg == nil {
+		return nil
+	}
+	return ParseServerHello(msg)
+}
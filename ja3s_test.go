@@ -0,0 +1,68 @@
+package zgrab2
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// serverHello returns a ServerHello message with the given extensions.
+func serverHello(version, cipher uint16, extensions ...uint16) []byte {
+	body := make([]byte, 2+32+1+2+1)
+	binary.BigEndian.PutUint16(body, version)
+	binary.BigEndian.PutUint16(body[35:], cipher)
+	var ext []byte
+	for _, e := range extensions {
+		ext = append(ext, byte(e>>8), byte(e), 0, 1, 0)
+	}
+	body = append(body, byte(len(ext)>>8), byte(len(ext)))
+	body = append(body, ext...)
+	return append([]byte{2, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+func TestParseServerHello(t *testing.T) {
+	fp := ParseServerHello(serverHello(0x0303, 0xc02f, 0xff01, 0x0000, 0x2a2a, 0x000b, 0x0023, 0x0010))
+	want := &ServerHelloFingerprint{
+		Version:     771,
+		CipherSuite: 49199,
+		Extensions:  []uint16{65281, 0, 11, 35, 16},
+		JA3S:        "771,49199,65281-0-11-35-16",
+		JA3SHash:    "47decf033ac4c8fc9b952ff41e549679",
+	}
+	if !reflect.DeepEqual(fp, want) {
+		t.Errorf("got %+v, want %+v", fp, want)
+	}
+	if fp := ParseServerHello(serverHello(0x0303, 0x1301)[:40]); fp != nil {
+		t.Errorf("got %+v for a truncated ServerHello", fp)
+	}
+}
+
+func TestHelloRecorder(t *testing.T) {
+	msg := serverHello(0x0303, 0x1301, 0x002b, 0x0033)
+	// The ServerHello split in two records, followed by a Certificate
+	// record, read in small chunks.
+	var data []byte
+	for _, part := range [][]byte{msg[:10], msg[10:], {11, 0, 0, 0}} {
+		data = append(data, 22, 3, 3, byte(len(part)>>8), byte(len(part)))
+		data = append(data, part...)
+	}
+	var r helloRecorder
+	for i := 0; i < len(data); i += 7 {
+		end := i + 7
+		if end > len(data) {
+			end = len(data)
+		}
+		r.record(data[i:end])
+	}
+	fp := r.fingerprint()
+	if fp == nil || fp.JA3S != "771,4865,43-51" {
+		t.Errorf("got %+v", fp)
+	}
+	if r.isDone() {
+		t.Errorf("done before the ServerHelloDone")
+	}
+	r.record([]byte{22, 3, 3, 0, 4, 14, 0, 0, 0})
+	if !r.isDone() || r.certificateRequest() != nil {
+		t.Errorf("got done %v, CertificateRequest %+v after the ServerHelloDone", r.isDone(), r.certificateRequest())
+	}
+}
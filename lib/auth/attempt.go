@@ -0,0 +1,34 @@
+package auth
+
+// MaxDatabases bounds the number of databases listed by the database modules
+// after a successful login.
+const MaxDatabases = 256
+
+// Attempt is the outcome of a login attempt with a credential.
+type Attempt struct {
+	Username string `json:"username"`
+
+	// Mechanism is the SASL mechanism used, or the authentication method of
+	// the protocol requested by the server (such as the MySQL plugin).
+	Mechanism string `json:"mechanism,omitempty"`
+
+	Success bool `json:"success"`
+
+	// ErrorCode and ErrorMessage are those of the answer of the server
+	// rejecting the credential, if any: the error number, or the SQLSTATE
+	// of PostgreSQL.
+	ErrorCode    string `json:"error_code,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+
+	// Error is set if the attempt could not be completed.
+	Error string `json:"error,omitempty"`
+}
+
+// Result is the outcome of the login attempts, which stop at the first
+// success. The modules embed it in their own results of a login.
+type Result struct {
+	Attempts []Attempt `json:"attempts,omitempty"`
+
+	// Success is true if one of the credentials was accepted.
+	Success bool `json:"success"`
+}
@@ -0,0 +1,282 @@
+// Package auth reads the credentials files (--creds-file) shared by the
+// modules that log in to the servers they scan, and describes the outcome of
+// their login attempts.
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zmap/zgrab2"
+)
+
+// Credential is a username and password to use for a host, or a bearer
+// token (RFC 6750). For NTLM, the username may be given as DOMAIN\user.
+type Credential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Token    string `json:"token,omitempty"`
+}
+
+// Credentials holds the credentials read from a file, keyed by host. Each
+// host has a list of candidate credentials, tried in order.
+type Credentials struct {
+	// hosts maps lower-cased hostnames and IP addresses, with or without a
+	// port, to their credentials (see hostKey).
+	hosts map[string][]*Credential
+
+	// wildcards maps domain suffixes (with a leading dot, as in
+	// ".example.com" for the pattern *.example.com) to their credentials.
+	wildcards map[string][]*Credential
+
+	// networks holds the credentials for CIDR ranges, most specific
+	// first.
+	networks []credentialNetwork
+
+	// defaults are the credentials for hosts matching no other entry.
+	defaults []*Credential
+}
+
+type credentialNetwork struct {
+	network *net.IPNet
+	creds   []*Credential
+}
+
+func newCredentials() *Credentials {
+	return &Credentials{
+		hosts:     make(map[string][]*Credential),
+		wildcards: make(map[string][]*Credential),
+	}
+}
+
+// ReadFile reads the credentials file at path (see Read for the format).
+func ReadFile(path string) (*Credentials, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	creds, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return creds, nil
+}
+
+// Read parses a credentials file. Each line gives a host, followed by
+// one or more whitespace-separated username:password pairs, or bearer:token
+// for a bearer token. The host is one of:
+//
+//   - a hostname or IP address, matched exactly, with an optional port:
+//     example.com, example.com:8080, 10.0.0.1, 2001:db8::1, [2001:db8::1],
+//     [2001:db8::1]:443; an entry without a port matches any port
+//   - a wildcard, matching any subdomain (but not the domain itself):
+//     *.example.com
+//   - a CIDR range, matching the IP address of the server: 10.0.0.0/8
+//   - default, matching any host without another entry
+//
+// The pairs for a host (which may be spread across several lines) are
+// candidates, tried in the order given until one is accepted. See Lookup for
+// the precedence of the entries matching a server. Blank lines and lines
+// starting with # are ignored.
+func Read(r io.Reader) (*Credentials, error) {
+	creds := newCredentials()
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := populate(creds, line); err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(creds.networks, func(i, j int) bool {
+		a, _ := creds.networks[i].network.Mask.Size()
+		b, _ := creds.networks[j].network.Mask.Size()
+		return a > b
+	})
+	return creds, nil
+}
+
+// populate adds the credentials on a single line to creds.
+func populate(creds *Credentials, line string) error {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return fmt.Errorf("expected \"host username:password\"")
+	}
+	var candidates []*Credential
+	for _, pair := range fields[1:] {
+		i := strings.IndexByte(pair, ':')
+		if i < 0 {
+			return fmt.Errorf("expected username:password, got %q", pair)
+		}
+		if strings.EqualFold(pair[:i], "bearer") {
+			if i+1 == len(pair) {
+				return fmt.Errorf("empty bearer token")
+			}
+			candidates = append(candidates, &Credential{Token: pair[i+1:]})
+			continue
+		}
+		candidates = append(candidates, &Credential{Username: pair[:i], Password: pair[i+1:]})
+	}
+	host := strings.TrimSuffix(strings.ToLower(fields[0]), ".")
+
+	if host == "default" {
+		creds.defaults = append(creds.defaults, candidates...)
+		return nil
+	}
+
+	if strings.Contains(host, "/") {
+		_, network, err := net.ParseCIDR(host)
+		if err != nil {
+			return err
+		}
+		for i, n := range creds.networks {
+			if n.network.String() == network.String() {
+				creds.networks[i].creds = append(n.creds, candidates...)
+				return nil
+			}
+		}
+		creds.networks = append(creds.networks, credentialNetwork{network: network, creds: candidates})
+		return nil
+	}
+
+	if strings.HasPrefix(host, "*.") {
+		suffix := host[1:]
+		if suffix == "." || strings.ContainsAny(suffix, "*/:") || strings.HasPrefix(suffix, "..") {
+			return fmt.Errorf("invalid host %q", fields[0])
+		}
+		creds.wildcards[suffix] = append(creds.wildcards[suffix], candidates...)
+		return nil
+	}
+	key, err := hostKey(host)
+	if err != nil {
+		return err
+	}
+	creds.hosts[key] = append(creds.hosts[key], candidates...)
+	return nil
+}
+
+// hostKey returns the key in Credentials.hosts of a hostname or IP address,
+// with an optional port: example.com, example.com:8080, 10.0.0.1,
+// 10.0.0.1:8080, 2001:db8::1, [2001:db8::1] or [2001:db8::1]:8080.
+func hostKey(host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		// A bracketed IPv6 address without a port matches any port, as
+		// the bare address does.
+		if ip := net.ParseIP(host[1 : len(host)-1]); ip != nil && ip.To4() == nil {
+			return ip.String(), nil
+		}
+		return "", fmt.Errorf("invalid host %q", host)
+	}
+	name, port := host, ""
+	if strings.Contains(host, ":") {
+		var err error
+		if name, port, err = net.SplitHostPort(host); err != nil {
+			return "", err
+		}
+		if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+			return "", fmt.Errorf("invalid port %q", port)
+		}
+		name = strings.TrimSuffix(name, ".")
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		name = ip.String()
+	} else if name == "" || strings.ContainsAny(name, "*/[]:") || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid host %q", host)
+	}
+	if port == "" {
+		return name, nil
+	}
+	return net.JoinHostPort(name, port), nil
+}
+
+// Lookup returns the candidate credentials for a server, given the hostname
+// (or IP address) and port of the URL, and the IP address of that host, if
+// known. The caller must not pass the address of another host (e.g. that of
+// the scan target after a redirect to another site), whose IP and CIDR
+// entries would then be sent to the host. The first entries found, in this
+// order, are used:
+//
+//  1. hostname:port
+//  2. hostname
+//  3. wildcards, the longest first
+//  4. ip:port
+//  5. ip
+//  6. CIDR ranges containing ip, the most specific first
+//  7. default
+//
+// A wildcard only matches whole labels: the credentials for *.google.com are
+// sent to mail.google.com, but never to google.com.attacker.net or to
+// evilgoogle.com. If the URL's host is an IP address, it takes the place of
+// ip.
+func (c *Credentials) Lookup(host, port string, ip net.IP) []*Credential {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if hostIP := net.ParseIP(host); hostIP != nil {
+		ip = hostIP
+	} else if host != "" {
+		if creds := c.lookupHost(host, port); creds != nil {
+			return creds
+		}
+		for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+			// host[i:] is a label-aligned suffix, longest first.
+			if creds, ok := c.wildcards[host[i:]]; ok {
+				return creds
+			}
+			host = host[i+1:]
+		}
+	}
+	if ip != nil {
+		if creds := c.lookupHost(ip.String(), port); creds != nil {
+			return creds
+		}
+		for _, n := range c.networks {
+			if n.network.Contains(ip) {
+				return n.creds
+			}
+		}
+	}
+	return c.defaults
+}
+
+// lookupHost returns the credentials for host:port, or else for host.
+func (c *Credentials) lookupHost(host, port string) []*Credential {
+	if port != "" {
+		if creds, ok := c.hosts[net.JoinHostPort(host, port)]; ok {
+			return creds
+		}
+	}
+	return c.hosts[host]
+}
+
+// For returns the candidate credentials for the target, scanned on port
+// unless it has its own: those of the entry named by the Credentials of its
+// options, if any, or else those of its domain or IP address. It returns nil
+// if c is nil.
+func (c *Credentials) For(t *zgrab2.ScanTarget, port uint) []*Credential {
+	if c == nil {
+		return nil
+	}
+	if name := t.GetOptions().Credentials; name != "" {
+		return c.Lookup(name, "", nil)
+	}
+	if t.Port != nil {
+		port = *t.Port
+	}
+	return c.Lookup(t.Domain, strconv.FormatUint(uint64(port), 10), t.IP)
+}
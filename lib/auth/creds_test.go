@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+)
+
+func TestReadCreds(t *testing.T) {
+	creds, err := Read(strings.NewReader("# comment\n\nExample.com admin:pa:ss\nother.com CORP\\user:x\n[2001:DB8::2] v6:x\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := creds.Lookup("example.com", "", nil); len(c) != 1 || c[0].Username != "admin" || c[0].Password != "pa:ss" {
+		t.Errorf("unexpected credentials %+v", c)
+	}
+	if c := creds.Lookup("other.com", "", nil); len(c) != 1 || c[0].Username != "CORP\\user" {
+		t.Errorf("unexpected credentials %+v", c)
+	}
+	if c := creds.Lookup("2001:db8::2", "443", nil); len(c) != 1 || c[0].Username != "v6" {
+		t.Errorf("unexpected credentials %+v", c)
+	}
+	for _, bad := range []string{"example.com admin\n", "example.com a:b admin\n", "example.com bearer:\n", "* a:b\n", "*.* a:b\n", "a*.com a:b\n", "10.0.0.0/33 a:b\n", "a.com:0 a:b\n", "a.com:http a:b\n", "*.a.com:80 a:b\n", "[a.com a:b\n", "[a.com] a:b\n", "[10.0.0.1] a:b\n"} {
+		if _, err := Read(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestCredsLookup(t *testing.T) {
+	creds, err := Read(strings.NewReader(`
+google.com exact:x
+*.google.com wildcard:x
+*.mail.google.com mail:x
+10.0.0.0/8 ten:x
+10.1.0.0/16 ten-one:x
+2001:db8::/32 v6:x
+default any:x
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"google.com":              "exact",
+		"GOOGLE.COM.":             "exact",
+		"www.google.com":          "wildcard",
+		"a.b.google.com":          "wildcard",
+		"smtp.mail.google.com":    "mail",
+		"mail.google.com":         "wildcard",
+		"google.com.attacker.net": "any",
+		"evilgoogle.com":          "any",
+		"com":                     "any",
+		"10.2.3.4":                "ten",
+		"10.1.3.4":                "ten-one",
+		"11.0.0.1":                "any",
+		"2001:db8::1":             "v6",
+	}
+	for host, expected := range tests {
+		got := ""
+		if c := creds.Lookup(host, "", nil); len(c) > 0 {
+			got = c[0].Username
+		}
+		if got != expected {
+			t.Errorf("%s: expected %q, got %q", host, expected, got)
+		}
+	}
+}
+
+func TestCredsPrecedence(t *testing.T) {
+	creds, err := Read(strings.NewReader(`
+example.com:8080 name-port:x
+example.com name:x
+*.com wildcard:x
+192.0.2.1:8080 ip-port:x
+192.0.2.1 ip:x
+[2001:db8::1]:443 v6-port:x
+192.0.2.0/24 network:x
+default any:x
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host, port, ip, expected string
+	}{
+		{"example.com", "8080", "192.0.2.1", "name-port"},
+		{"example.com", "80", "192.0.2.1", "name"},
+		{"www.example.com", "8080", "192.0.2.1", "wildcard"},
+		{"example.net", "8080", "192.0.2.1", "ip-port"},
+		{"example.net", "80", "192.0.2.1", "ip"},
+		{"", "80", "192.0.2.1", "ip"},
+		{"192.0.2.1", "8080", "", "ip-port"},
+		{"192.0.2.1", "8080", "198.51.100.1", "ip-port"},
+		{"example.net", "80", "192.0.2.2", "network"},
+		{"2001:db8::1", "443", "", "v6-port"},
+		{"2001:db8::1", "80", "", "any"},
+		{"example.net", "80", "", "any"},
+	}
+	for _, test := range tests {
+		got := ""
+		if c := creds.Lookup(test.host, test.port, net.ParseIP(test.ip)); len(c) > 0 {
+			got = c[0].Username
+		}
+		if got != test.expected {
+			t.Errorf("%+v: got %q", test, got)
+		}
+	}
+
+}
+
+func TestCredentialsFor(t *testing.T) {
+	creds, err := Read(strings.NewReader(`
+example.com:2222 name-port:x
+192.0.2.1 ip:x
+router-admin admin:x
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := uint(2222)
+	tests := []struct {
+		target   zgrab2.ScanTarget
+		expected string
+	}{
+		{zgrab2.ScanTarget{Domain: "example.com"}, ""},
+		{zgrab2.ScanTarget{Domain: "example.com", Port: &port}, "name-port"},
+		{zgrab2.ScanTarget{Domain: "example.com", IP: net.ParseIP("192.0.2.1")}, "ip"},
+		{zgrab2.ScanTarget{IP: net.ParseIP("192.0.2.1")}, "ip"},
+		{zgrab2.ScanTarget{IP: net.ParseIP("192.0.2.1"), Options: &zgrab2.TargetOptions{Credentials: "router-admin"}}, "admin"},
+		{zgrab2.ScanTarget{IP: net.ParseIP("192.0.2.2")}, ""},
+	}
+	for _, test := range tests {
+		got := ""
+		if c := creds.For(&test.target, 22); len(c) > 0 {
+			got = c[0].Username
+		}
+		if got != test.expected {
+			t.Errorf("%s: got %q, expected %q", test.target.String(), got, test.expected)
+		}
+	}
+	if c := (*Credentials)(nil).For(&tests[1].target, 22); c != nil {
+		t.Errorf("unexpected credentials %+v without a file", c)
+	}
+}
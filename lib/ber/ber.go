@@ -0,0 +1,206 @@
+// Package ber encodes and decodes the subset of the ASN.1 Basic Encoding
+// Rules used by protocols such as SNMP and LDAP. Unlike encoding/asn1, it
+// accepts the non-minimal lengths that some servers send, and leaves the
+// interpretation of the tags to the caller.
+package ber
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Universal tags.
+const (
+	TagBoolean     = 0x01
+	TagInteger     = 0x02
+	TagOctetString = 0x04
+	TagNull        = 0x05
+	TagOID         = 0x06
+	TagEnumerated  = 0x0a
+	TagSequence    = 0x30
+	TagSet         = 0x31
+)
+
+// Tag classes and the constructed bit, to be combined with a tag number.
+const (
+	ClassApplication = 0x40
+	ClassContext     = 0x80
+	Constructed      = 0x20
+)
+
+// ErrMalformed is returned when an element cannot be decoded.
+var ErrMalformed = errors.New("malformed BER encoding")
+
+// Element is a decoded BER element.
+type Element struct {
+	Tag   byte
+	Value []byte
+}
+
+// Encode returns the element with the given tag and the concatenation of
+// contents as its value.
+func Encode(tag byte, contents ...[]byte) []byte {
+	var n int
+	for _, c := range contents {
+		n += len(c)
+	}
+	ret := append([]byte{tag}, encodeLength(n)...)
+	for _, c := range contents {
+		ret = append(ret, c...)
+	}
+	return ret
+}
+
+// encodeLength returns the definite form of a length.
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// EncodeInt returns an INTEGER element, in the shortest two's complement form.
+func EncodeInt(v int64) []byte {
+	b := []byte{byte(v)}
+	for v > 0x7f || v < -0x80 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return Encode(TagInteger, b)
+}
+
+// EncodeString returns an OCTET STRING element.
+func EncodeString(s []byte) []byte {
+	return Encode(TagOctetString, s)
+}
+
+// EncodeOID returns an OBJECT IDENTIFIER element for an OID with at least two
+// arcs.
+func EncodeOID(oid []uint32) []byte {
+	b := encodeArc(oid[0]*40 + oid[1])
+	for _, arc := range oid[2:] {
+		b = append(b, encodeArc(arc)...)
+	}
+	return Encode(TagOID, b)
+}
+
+// encodeArc returns an OID arc in base 128.
+func encodeArc(arc uint32) []byte {
+	b := []byte{byte(arc & 0x7f)}
+	for arc >>= 7; arc > 0; arc >>= 7 {
+		b = append([]byte{0x80 | byte(arc&0x7f)}, b...)
+	}
+	return b
+}
+
+// ParseOID parses an OID in dotted notation.
+func ParseOID(s string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	ret := make([]uint32, len(parts))
+	for i, part := range parts {
+		arc, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		ret[i] = uint32(arc)
+	}
+	return ret, nil
+}
+
+// Decode decodes the first element of b, and returns it with the remaining
+// bytes. Only the definite length form, which SNMP and LDAP require, is
+// supported.
+func Decode(b []byte) (Element, []byte, error) {
+	if len(b) < 2 {
+		return Element{}, nil, ErrMalformed
+	}
+	tag := b[0]
+	n := int(b[1])
+	b = b[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 4 || len(b) < size {
+			return Element{}, nil, ErrMalformed
+		}
+		n = 0
+		for _, c := range b[:size] {
+			n = n<<8 | int(c)
+		}
+		b = b[size:]
+	}
+	if len(b) < n {
+		return Element{}, nil, ErrMalformed
+	}
+	return Element{Tag: tag, Value: b[:n]}, b[n:], nil
+}
+
+// Children decodes the elements of a constructed element.
+func (e Element) Children() ([]Element, error) {
+	var ret []Element
+	for rest := e.Value; len(rest) > 0; {
+		var child Element
+		var err error
+		if child, rest, err = Decode(rest); err != nil {
+			return nil, err
+		}
+		ret = append(ret, child)
+	}
+	return ret, nil
+}
+
+// Int decodes an INTEGER, an ENUMERATED or an unsigned application integer
+// type.
+func (e Element) Int() (int64, error) {
+	if len(e.Value) == 0 || len(e.Value) > 9 {
+		return 0, ErrMalformed
+	}
+	var v int64
+	if (e.Tag == TagInteger || e.Tag == TagEnumerated) && e.Value[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range e.Value {
+		v = v<<8 | int64(c)
+	}
+	return v, nil
+}
+
+// OID decodes an OBJECT IDENTIFIER in dotted notation.
+func (e Element) OID() (string, error) {
+	if e.Tag != TagOID || len(e.Value) == 0 {
+		return "", ErrMalformed
+	}
+	var arcs []string
+	var arc uint64
+	for i, c := range e.Value {
+		arc = arc<<7 | uint64(c&0x7f)
+		if arc > 1<<32 {
+			return "", ErrMalformed
+		}
+		if c&0x80 != 0 {
+			if i == len(e.Value)-1 {
+				return "", ErrMalformed
+			}
+			continue
+		}
+		if arcs == nil {
+			first := arc / 40
+			if first > 2 {
+				first = 2
+			}
+			arcs = append(arcs, strconv.FormatUint(first, 10), strconv.FormatUint(arc-40*first, 10))
+		} else {
+			arcs = append(arcs, strconv.FormatUint(arc, 10))
+		}
+		arc = 0
+	}
+	return strings.Join(arcs, "."), nil
+}
@@ -0,0 +1,56 @@
+package ber
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInt(t *testing.T) {
+	for _, v := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1<<31 - 1, -1 << 31} {
+		e, rest, err := Decode(EncodeInt(v))
+		if err != nil || len(rest) != 0 {
+			t.Fatalf("Decode(EncodeInt(%d)): %v", v, err)
+		}
+		if got, err := e.Int(); err != nil || got != v {
+			t.Errorf("EncodeInt(%d) decodes to %d (%v)", v, got, err)
+		}
+	}
+	if got := EncodeInt(128); !bytes.Equal(got, []byte{TagInteger, 2, 0, 128}) {
+		t.Errorf("EncodeInt(128) = %x", got)
+	}
+}
+
+func TestOID(t *testing.T) {
+	for _, s := range []string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.4.1.8072.3.2.10", "2.999.1"} {
+		oid, err := ParseOID(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, _, err := Decode(EncodeOID(oid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := e.OID(); err != nil || got != s {
+			t.Errorf("OID %s decodes to %s (%v)", s, got, err)
+		}
+	}
+	if _, err := ParseOID("1"); err == nil {
+		t.Error("ParseOID accepted a single arc")
+	}
+}
+
+func TestLongLength(t *testing.T) {
+	value := bytes.Repeat([]byte{'a'}, 300)
+	e, _, err := Decode(EncodeString(value))
+	if err != nil || !bytes.Equal(e.Value, value) {
+		t.Errorf("long string does not round trip: %v", err)
+	}
+	if _, _, err := Decode([]byte{TagOctetString, 0x82, 0x01}); err != ErrMalformed {
+		t.Errorf("truncated length accepted: %v", err)
+	}
+	// Active Directory always sends lengths on four bytes.
+	e, rest, err := Decode([]byte{TagOctetString, 0x84, 0, 0, 0, 1, 'x', 0})
+	if err != nil || string(e.Value) != "x" || len(rest) != 1 {
+		t.Errorf("non-minimal length not decoded: %v", err)
+	}
+}
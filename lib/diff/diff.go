@@ -0,0 +1,254 @@
+// Package diff compares decoded JSON values (as produced by encoding/json
+// into interface{}) and reports the changed fields by dotted path.
+package diff
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Change is a single difference between two values.
+type Change struct {
+	// Path is the dotted path of the changed field; array elements are
+	// addressed by index.
+	Path string `json:"path"`
+
+	// Old is the previous value, absent if the field was added.
+	Old interface{} `json:"old,omitempty"`
+
+	// New is the current value, absent if the field was removed.
+	New interface{} `json:"new,omitempty"`
+}
+
+// Filter selects the field paths to compare. A path pattern is a dotted path
+// in which "*" matches any single key or array index; it selects the field
+// and everything below it.
+type Filter struct {
+	include [][]string
+	exclude [][]string
+}
+
+// NewFilter returns a Filter that compares the fields matching any of the
+// include patterns (or all fields, if there are none), except those matching
+// any of the exclude patterns.
+func NewFilter(include []string, exclude []string) *Filter {
+	split := func(patterns []string) [][]string {
+		var ret [][]string
+		for _, p := range patterns {
+			if p = strings.TrimSpace(p); p != "" {
+				ret = append(ret, strings.Split(p, "."))
+			}
+		}
+		return ret
+	}
+	return &Filter{include: split(include), exclude: split(exclude)}
+}
+
+// matchPrefix returns true if pattern matches the first len(pattern) elements
+// of path (i.e. path is the pattern's field or below it).
+func matchPrefix(pattern []string, path []string) bool {
+	if len(path) < len(pattern) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != "*" && p != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// leadsTo returns true if path is an ancestor of a field matched by pattern.
+func leadsTo(pattern []string, path []string) bool {
+	if len(path) >= len(pattern) {
+		return false
+	}
+	return matchPrefix(pattern[:len(path)], path)
+}
+
+// selected returns true if the field at path is compared.
+func (f *Filter) selected(path []string) bool {
+	for _, p := range f.exclude {
+		if matchPrefix(p, path) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, p := range f.include {
+		if matchPrefix(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// descend returns true if some field below path may be compared.
+func (f *Filter) descend(path []string) bool {
+	for _, p := range f.exclude {
+		if matchPrefix(p, path) {
+			return false
+		}
+	}
+	if f.selected(path) {
+		return true
+	}
+	for _, p := range f.include {
+		if leadsTo(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare returns the differences between old and new that are selected by
+// filter (which may be nil), sorted by path.
+func Compare(old, new interface{}, filter *Filter) []Change {
+	if filter == nil {
+		filter = &Filter{}
+	}
+	var changes []Change
+	compare(old, new, nil, filter, &changes)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func compare(old, new interface{}, path []string, filter *Filter, changes *[]Change) {
+	if !filter.descend(path) {
+		return
+	}
+	if (old == nil) != (new == nil) && filter.selected(path) {
+		// A whole field was added or removed.
+		*changes = append(*changes, Change{Path: strings.Join(path, "."), Old: old, New: new})
+		return
+	}
+	// Below this point, a missing value is compared as an empty container so
+	// that selected fields inside an added or removed subtree are reported.
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if (oldIsMap || old == nil) && (newIsMap || new == nil) && (oldIsMap || newIsMap) {
+		keys := make(map[string]bool, len(oldMap)+len(newMap))
+		for k := range oldMap {
+			keys[k] = true
+		}
+		for k := range newMap {
+			keys[k] = true
+		}
+		for k := range keys {
+			compareChild(oldMap[k], newMap[k], path, k, filter, changes)
+		}
+		return
+	}
+	oldList, oldIsList := old.([]interface{})
+	newList, newIsList := new.([]interface{})
+	if (oldIsList || old == nil) && (newIsList || new == nil) && (oldIsList || newIsList) {
+		n := len(oldList)
+		if len(newList) > n {
+			n = len(newList)
+		}
+		for i := 0; i < n; i++ {
+			var o, c interface{}
+			if i < len(oldList) {
+				o = oldList[i]
+			}
+			if i < len(newList) {
+				c = newList[i]
+			}
+			compareChild(o, c, path, strconv.Itoa(i), filter, changes)
+		}
+		return
+	}
+	if !filter.selected(path) || equal(old, new) {
+		return
+	}
+	*changes = append(*changes, Change{Path: strings.Join(path, "."), Old: old, New: new})
+}
+
+func compareChild(old, new interface{}, path []string, key string, filter *Filter, changes *[]Change) {
+	child := make([]string, len(path)+1)
+	copy(child, path)
+	child[len(path)] = key
+	compare(old, new, child, filter, changes)
+}
+
+// equal compares two decoded JSON scalars (or mismatched values).
+func equal(a, b interface{}) bool {
+	if na, ok := a.(json.Number); ok {
+		if nb, ok := b.(json.Number); ok {
+			if fa, err := na.Float64(); err == nil {
+				if fb, err := nb.Float64(); err == nil {
+					return fa == fb
+				}
+			}
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Prune removes the fields of v that filter does not select, and returns
+// what remains of v. Maps and lists are modified in place. Objects and lists
+// that are not selected themselves are removed if none of their fields are
+// left, and list elements that are removed are left out of the list.
+func Prune(v interface{}, filter *Filter) interface{} {
+	ret, _ := prune(v, nil, filter)
+	return ret
+}
+
+// prune returns what remains of v at path, and false if nothing does.
+func prune(v interface{}, path []string, filter *Filter) (interface{}, bool) {
+	if !filter.descend(path) {
+		return nil, false
+	}
+	selected := filter.selected(path)
+	child := func(key string) []string {
+		return append(path[:len(path):len(path)], key)
+	}
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, c := range node {
+			if c, ok := prune(c, child(k), filter); ok {
+				node[k] = c
+			} else {
+				delete(node, k)
+			}
+		}
+		return node, selected || len(node) > 0
+	case []interface{}:
+		kept := node[:0]
+		for i, c := range node {
+			if c, ok := prune(c, child(strconv.Itoa(i)), filter); ok {
+				kept = append(kept, c)
+			}
+		}
+		return kept, selected || len(kept) > 0
+	}
+	return v, selected
+}
+
+// Lookup returns the value at the dotted path in v, or nil if there is none.
+func Lookup(v interface{}, path string) interface{} {
+	if path == "" {
+		return v
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
@@ -0,0 +1,85 @@
+package diff
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	var ret interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&ret); err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func paths(changes []Change) []string {
+	var ret []string
+	for _, c := range changes {
+		ret = append(ret, c.Path)
+	}
+	return ret
+}
+
+func TestCompare(t *testing.T) {
+	old := decode(t, `{"status":"success","timestamp":"a","result":{"banner":"SSH-2.0-OpenSSH_7.4","keys":["a","b"],"version":1.0}}`)
+	new := decode(t, `{"status":"success","timestamp":"b","result":{"banner":"SSH-2.0-OpenSSH_8.0","keys":["a"],"version":1,"extra":{"x":1}}}`)
+
+	tests := []struct {
+		include, exclude []string
+		expected         []string
+	}{
+		{nil, nil, []string{"result.banner", "result.extra", "result.keys.1", "timestamp"}},
+		{nil, []string{"timestamp"}, []string{"result.banner", "result.extra", "result.keys.1"}},
+		{[]string{"result.banner"}, nil, []string{"result.banner"}},
+		{[]string{"result.keys.*"}, nil, []string{"result.keys.1"}},
+		{[]string{"result.extra.x"}, nil, []string{"result.extra.x"}},
+		{[]string{"result"}, []string{"result.keys"}, []string{"result.banner", "result.extra"}},
+		{[]string{"status"}, nil, nil},
+	}
+	for _, test := range tests {
+		got := paths(Compare(old, new, NewFilter(test.include, test.exclude)))
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("include %v exclude %v: expected %v, got %v", test.include, test.exclude, test.expected, got)
+		}
+	}
+
+	changes := Compare(old, new, NewFilter([]string{"result.banner"}, nil))
+	if changes[0].Old != "SSH-2.0-OpenSSH_7.4" || changes[0].New != "SSH-2.0-OpenSSH_8.0" {
+		t.Errorf("unexpected change %+v", changes[0])
+	}
+}
+
+func TestLookup(t *testing.T) {
+	v := decode(t, `{"a":{"b":[{"c":"x"}]}}`)
+	if got := Lookup(v, "a.b.0.c"); got != "x" {
+		t.Errorf("expected x, got %v", got)
+	}
+	if got := Lookup(v, "a.b.1.c"); got != nil {
+		t.Errorf("expected nil, got %v", got)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	const record = `{"ip":"10.0.0.1","data":{"http":{"status":"success","result":{"response":{"status_code":200,"body":"<html>"}}},"tls":{"result":{"chain":[{"raw":"AA==","parsed":{"cn":"a"}},{"raw":"AB==","parsed":{"cn":"b"}}]}}}}`
+	tests := []struct {
+		include, exclude []string
+		expected         string
+	}{
+		{nil, nil, record},
+		{nil, []string{"data.*.result.response.body", "data.tls.result.chain.*.raw"}, `{"ip":"10.0.0.1","data":{"http":{"status":"success","result":{"response":{"status_code":200}}},"tls":{"result":{"chain":[{"parsed":{"cn":"a"}},{"parsed":{"cn":"b"}}]}}}}`},
+		{[]string{"ip", "data.http.result.response.status_code", "data.ssh.status"}, nil, `{"ip":"10.0.0.1","data":{"http":{"result":{"response":{"status_code":200}}}}}`},
+		{[]string{"data.tls.result.chain.1"}, []string{"data.tls.result.chain.*.raw"}, `{"data":{"tls":{"result":{"chain":[{"parsed":{"cn":"b"}}]}}}}`},
+		{[]string{"data.ssh"}, nil, `{}`},
+	}
+	for _, test := range tests {
+		got := Prune(decode(t, record), NewFilter(test.include, test.exclude))
+		if !reflect.DeepEqual(got, decode(t, test.expected)) {
+			t.Errorf("include %v exclude %v: expected %s, got %v", test.include, test.exclude, test.expected, got)
+		}
+	}
+}
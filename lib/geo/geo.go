@@ -0,0 +1,98 @@
+// Package geo looks up the location and routing information of IP addresses
+// in offline databases: MaxMind DB files (GeoLite2/GeoIP2 Country, City and
+// ASN), IP2Location CSV databases, and pyasn-style routing table dumps.
+package geo
+
+import (
+	"net"
+)
+
+// Record is the information known about a single IP address.
+type Record struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country.
+	Country string `json:"country,omitempty"`
+
+	// CountryName is the English name of the country.
+	CountryName string `json:"country_name,omitempty"`
+
+	// ASN is the number of the autonomous system announcing the address.
+	ASN uint32 `json:"asn,omitempty"`
+
+	// ASOrg is the name of the organization operating the autonomous system.
+	ASOrg string `json:"as_org,omitempty"`
+
+	// Prefix is the most specific network containing the address, as
+	// given by the routing table (if available) or the ASN database.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// merge fills the empty fields of r from other.
+func (r *Record) merge(other *Record) {
+	if r.Country == "" {
+		r.Country = other.Country
+	}
+	if r.CountryName == "" {
+		r.CountryName = other.CountryName
+	}
+	if r.ASN == 0 {
+		r.ASN = other.ASN
+	}
+	if r.ASOrg == "" && r.ASN == other.ASN {
+		r.ASOrg = other.ASOrg
+	}
+	if r.Prefix == "" {
+		r.Prefix = other.Prefix
+	}
+}
+
+// empty returns true if no field of r is set.
+func (r *Record) empty() bool {
+	return *r == Record{}
+}
+
+// Database is a source of information about IP addresses.
+type Database interface {
+	// Lookup returns the information the database holds about ip, or nil if
+	// there is none.
+	Lookup(ip net.IP) *Record
+}
+
+// Databases is a list of databases queried in order. For each field of the
+// combined record, the first database that provides it wins.
+type Databases []Database
+
+// Lookup returns the combined information held by all databases about ip, or
+// nil if there is none.
+func (dbs Databases) Lookup(ip net.IP) *Record {
+	ret := new(Record)
+	for _, db := range dbs {
+		if rec := db.Lookup(ip); rec != nil {
+			ret.merge(rec)
+		}
+	}
+	if ret.empty() {
+		return nil
+	}
+	return ret
+}
+
+// normalize returns the 4-byte form of IPv4 addresses, and the 16-byte form of
+// all others.
+func normalize(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+// bit returns the ith most significant bit of ip.
+func bit(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+// prefixString returns the network of the given length containing ip, in CIDR
+// notation.
+func prefixString(ip net.IP, length int) string {
+	mask := net.CIDRMask(length, len(ip)*8)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
@@ -0,0 +1,158 @@
+package geo
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+// Helpers for encoding MaxMind DB data section values (sizes below 285 only).
+
+func mmdbCtrl(typ byte, size int) []byte {
+	if size >= 29 {
+		return []byte{typ<<5 | 29, byte(size - 29)}
+	}
+	return []byte{typ<<5 | byte(size)}
+}
+
+func mmdbEncString(s string) []byte {
+	return append(mmdbCtrl(mmdbString, len(s)), s...)
+}
+
+func mmdbEncUint(typ byte, v uint32, n int) []byte {
+	ret := mmdbCtrl(typ, n)
+	for i := n - 1; i >= 0; i-- {
+		ret = append(ret, byte(v>>(8*uint(i))))
+	}
+	return ret
+}
+
+func mmdbEncMap(pairs ...[]byte) []byte {
+	ret := mmdbCtrl(mmdbMap, len(pairs)/2)
+	for _, p := range pairs {
+		ret = append(ret, p...)
+	}
+	return ret
+}
+
+// testMaxMindDB returns an IPv4 database with a single network, 0.0.0.0/2.
+func testMaxMindDB() []byte {
+	var buf bytes.Buffer
+	// node 0: left -> node 1, right -> not found
+	// node 1: left -> data at offset 3, right -> not found
+	const nodeCount = 2
+	dataRecord := nodeCount + dataSectionSeparator + 3
+	buf.Write([]byte{0, 0, 1, 0, 0, nodeCount})
+	buf.Write([]byte{0, 0, byte(dataRecord), 0, 0, nodeCount})
+	buf.Write(make([]byte, dataSectionSeparator))
+	// offset 0: a string referenced by a pointer
+	buf.Write(mmdbEncString("US"))
+	// offset 3: the record
+	buf.Write(mmdbEncMap(
+		mmdbEncString("country"), mmdbEncMap(
+			mmdbEncString("iso_code"), []byte{mmdbPointer << 5, 0},
+			mmdbEncString("names"), mmdbEncMap(mmdbEncString("en"), mmdbEncString("United States")),
+		),
+		mmdbEncString("autonomous_system_number"), mmdbEncUint(mmdbUint32, 15169, 2),
+		mmdbEncString("autonomous_system_organization"), mmdbEncString("GOOGLE"),
+	))
+	buf.Write(metadataMarker)
+	buf.Write(mmdbEncMap(
+		mmdbEncString("node_count"), mmdbEncUint(mmdbUint32, nodeCount, 1),
+		mmdbEncString("record_size"), mmdbEncUint(mmdbUint16, 24, 1),
+		mmdbEncString("ip_version"), mmdbEncUint(mmdbUint16, 4, 1),
+		mmdbEncString("database_type"), mmdbEncString("Test"),
+	))
+	return buf.Bytes()
+}
+
+func TestMaxMindDB(t *testing.T) {
+	db, err := NewMaxMindDB(testMaxMindDB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.DatabaseType != "Test" {
+		t.Errorf("wrong database type %q", db.DatabaseType)
+	}
+	rec := db.Lookup(net.ParseIP("10.1.2.3"))
+	expected := Record{Country: "US", CountryName: "United States", ASN: 15169, ASOrg: "GOOGLE", Prefix: "0.0.0.0/2"}
+	if rec == nil || *rec != expected {
+		t.Errorf("expected %+v, got %+v", expected, rec)
+	}
+	if rec := db.Lookup(net.ParseIP("200.1.2.3")); rec != nil {
+		t.Errorf("expected no record, got %+v", rec)
+	}
+	if rec := db.Lookup(net.ParseIP("2001:db8::1")); rec != nil {
+		t.Errorf("expected no record for IPv6 in IPv4 database, got %+v", rec)
+	}
+	if _, err := NewMaxMindDB([]byte("garbage")); err == nil {
+		t.Error("expected error for invalid database")
+	}
+}
+
+const testIP2Location = `"0","16777215","-","-"
+"16777216","16777471","AU","Australia"
+"16777472","16778239","CN","China"
+"58563916267414320822195468097273462784","58563936549823924473865892044524748799","DE","Germany"
+`
+
+func TestIP2LocationDB(t *testing.T) {
+	db, err := ReadIP2LocationDB(strings.NewReader(testIP2Location))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"1.0.0.1":     "AU",
+		"1.0.1.255":   "CN",
+		"0.0.0.1":     "",
+		"1.0.4.0":     "",
+		"2c0f:ff00::": "",
+		"2c0f::1":     "DE",
+	}
+	for ip, country := range tests {
+		rec := db.Lookup(net.ParseIP(ip))
+		got := ""
+		if rec != nil {
+			got = rec.Country
+		}
+		if got != country {
+			t.Errorf("%s: expected %q, got %q", ip, country, got)
+		}
+	}
+}
+
+const testRoutingTable = `; IP-ASN32-DAT file
+; Original source:	rib.20200101.0000.bz2
+1.0.0.0/24	13335
+1.0.0.0/16	64500
+2001:db8::/32	64501
+`
+
+func TestRoutingTable(t *testing.T) {
+	table, err := ReadRoutingTable(strings.NewReader(testRoutingTable))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]Record{
+		"1.0.0.1":     {ASN: 13335, Prefix: "1.0.0.0/24"},
+		"1.0.5.1":     {ASN: 64500, Prefix: "1.0.0.0/16"},
+		"2001:db8::1": {ASN: 64501, Prefix: "2001:db8::/32"},
+	}
+	for ip, expected := range tests {
+		rec := table.Lookup(net.ParseIP(ip))
+		if rec == nil || *rec != expected {
+			t.Errorf("%s: expected %+v, got %+v", ip, expected, rec)
+		}
+	}
+	if rec := table.Lookup(net.ParseIP("8.8.8.8")); rec != nil {
+		t.Errorf("expected no record, got %+v", rec)
+	}
+
+	mmdb, _ := NewMaxMindDB(testMaxMindDB())
+	combined := Databases{table, mmdb}.Lookup(net.ParseIP("1.0.0.1"))
+	expected := Record{Country: "US", CountryName: "United States", ASN: 13335, Prefix: "1.0.0.0/24"}
+	if combined == nil || *combined != expected {
+		t.Errorf("expected %+v, got %+v", expected, combined)
+	}
+}
@@ -0,0 +1,115 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+)
+
+// ip2LocationRange is a single row of an IP2Location database.
+type ip2LocationRange struct {
+	from, to    [net.IPv6len]byte
+	country     string
+	countryName string
+}
+
+// IP2LocationDB is an IP2Location (or IP2Location LITE) country database in
+// CSV format. Both the IPv4 and IPv6 variants are supported; additional
+// columns beyond the country name are ignored.
+type IP2LocationDB struct {
+	ranges []ip2LocationRange
+}
+
+// OpenIP2LocationDB reads the IP2Location CSV database at path.
+func OpenIP2LocationDB(path string) (*IP2LocationDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	db, err := ReadIP2LocationDB(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return db, nil
+}
+
+var maxIPv4 = big.NewInt(0xffffffff)
+
+// parseIPNumber converts the decimal representation of an address used by
+// IP2Location to the 16-byte form of the address. Numbers that fit in 32 bits
+// are IPv4 addresses.
+func parseIPNumber(s string) ([net.IPv6len]byte, error) {
+	var ret [net.IPv6len]byte
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return ret, fmt.Errorf("invalid address number %q", s)
+	}
+	b := n.Bytes()
+	copy(ret[net.IPv6len-len(b):], b)
+	if n.Cmp(maxIPv4) <= 0 {
+		ret[10], ret[11] = 0xff, 0xff
+	}
+	return ret, nil
+}
+
+// ReadIP2LocationDB reads an IP2Location CSV database from r.
+func ReadIP2LocationDB(r io.Reader) (*IP2LocationDB, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	db := new(IP2LocationDB)
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(row) < 3 {
+			return nil, fmt.Errorf("line %d: expected at least 3 columns", line)
+		}
+		var rng ip2LocationRange
+		if rng.from, err = parseIPNumber(row[0]); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		if rng.to, err = parseIPNumber(row[1]); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		if row[2] == "-" {
+			// Unallocated / reserved space.
+			continue
+		}
+		rng.country = row[2]
+		if len(row) > 3 {
+			rng.countryName = row[3]
+		}
+		db.ranges = append(db.ranges, rng)
+	}
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].from[:], db.ranges[j].from[:]) < 0
+	})
+	return db, nil
+}
+
+// Lookup implements Database.
+func (db *IP2LocationDB) Lookup(ip net.IP) *Record {
+	ip = ip.To16()
+	if ip == nil {
+		return nil
+	}
+	// Find the last range starting at or before ip.
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].from[:], ip) > 0
+	}) - 1
+	if i < 0 || bytes.Compare(ip, db.ranges[i].to[:]) > 0 {
+		return nil
+	}
+	return &Record{Country: db.ranges[i].country, CountryName: db.ranges[i].countryName}
+}
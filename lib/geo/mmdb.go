@@ -0,0 +1,406 @@
+package geo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+)
+
+// metadataMarker precedes the metadata section at the end of a MaxMind DB
+// file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// maxMetadataSize is the maximum distance of the metadata marker from the end
+// of the file.
+const maxMetadataSize = 128 * 1024
+
+// dataSectionSeparator is the number of zero bytes between the search tree and
+// the data section.
+const dataSectionSeparator = 16
+
+// MaxMindDB is a database in the MaxMind DB format
+// (https://maxmind.github.io/MaxMind-DB/). Country and city databases provide
+// the country; ASN databases provide the ASN, organization and prefix.
+type MaxMindDB struct {
+	buf        []byte
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+	ipv4Depth  int
+
+	// DatabaseType is the type given in the database metadata, e.g.
+	// "GeoLite2-Country".
+	DatabaseType string
+}
+
+// OpenMaxMindDB reads the MaxMind DB file at path into memory.
+func OpenMaxMindDB(path string) (*MaxMindDB, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := NewMaxMindDB(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return db, nil
+}
+
+// NewMaxMindDB parses a MaxMind DB held in buf.
+func NewMaxMindDB(buf []byte) (*MaxMindDB, error) {
+	start := len(buf) - maxMetadataSize
+	if start < 0 {
+		start = 0
+	}
+	idx := bytes.LastIndex(buf[start:], metadataMarker)
+	if idx < 0 {
+		return nil, errors.New("not a MaxMind DB file (metadata not found)")
+	}
+	metaStart := start + idx + len(metadataMarker)
+	meta, _, err := (&mmdbDecoder{buf: buf[metaStart:]}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %s", err)
+	}
+	metaMap, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("invalid metadata")
+	}
+	db := &MaxMindDB{buf: buf}
+	db.nodeCount = uint(asUint(metaMap["node_count"]))
+	db.recordSize = uint(asUint(metaMap["record_size"]))
+	db.ipVersion = uint(asUint(metaMap["ip_version"]))
+	db.DatabaseType, _ = metaMap["database_type"].(string)
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported IP version %d", db.ipVersion)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(start+idx) {
+		return nil, errors.New("search tree exceeds file size")
+	}
+	db.tree = buf[:treeSize]
+	db.data = buf[treeSize+dataSectionSeparator : start+idx]
+
+	// In IPv6 databases, IPv4 addresses live under ::/96.
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node, _ = db.readNode(node, 0)
+		}
+		db.ipv4Start = node
+		db.ipv4Depth = 96
+	}
+	return db, nil
+}
+
+// readNode returns the given record (0 = left, 1 = right) of the node.
+func (db *MaxMindDB) readNode(node uint, side int) (uint, error) {
+	size := db.recordSize / 4
+	off := node * size
+	if off+size > uint(len(db.tree)) {
+		return 0, errors.New("invalid node")
+	}
+	b := db.tree[off : off+size]
+	switch db.recordSize {
+	case 24:
+		if side == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5]), nil
+	case 28:
+		if side == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		if side == 0 {
+			return uint(binary.BigEndian.Uint32(b[0:4])), nil
+		}
+		return uint(binary.BigEndian.Uint32(b[4:8])), nil
+	}
+}
+
+// lookup returns the decoded data for ip and the length of the matching
+// network prefix.
+func (db *MaxMindDB) lookup(ip net.IP) (interface{}, int, error) {
+	ip = normalize(ip)
+	if ip == nil {
+		return nil, 0, errors.New("invalid IP")
+	}
+	if len(ip) == net.IPv6len && db.ipVersion == 4 {
+		return nil, 0, nil
+	}
+	node, depth := uint(0), 0
+	if len(ip) == net.IPv4len && db.ipVersion == 6 {
+		node, depth = db.ipv4Start, db.ipv4Depth
+	}
+	bits := len(ip) * 8
+	for i := 0; i < bits && node < db.nodeCount; i++ {
+		var err error
+		if node, err = db.readNode(node, bit(ip, i)); err != nil {
+			return nil, 0, err
+		}
+		depth++
+	}
+	if node <= db.nodeCount {
+		// Either not found, or the tree is malformed.
+		return nil, 0, nil
+	}
+	offset := node - db.nodeCount - dataSectionSeparator
+	value, _, err := (&mmdbDecoder{buf: db.data}).decode(offset, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	prefixLen := depth
+	if len(ip) == net.IPv4len && db.ipVersion == 6 {
+		prefixLen -= 96
+	}
+	return value, prefixLen, nil
+}
+
+// Lookup implements Database.
+func (db *MaxMindDB) Lookup(ip net.IP) *Record {
+	value, prefixLen, err := db.lookup(ip)
+	if err != nil || value == nil {
+		return nil
+	}
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	ret := new(Record)
+	country, ok := m["country"].(map[string]interface{})
+	if !ok {
+		country, _ = m["registered_country"].(map[string]interface{})
+	}
+	if country != nil {
+		ret.Country, _ = country["iso_code"].(string)
+		if names, ok := country["names"].(map[string]interface{}); ok {
+			ret.CountryName, _ = names["en"].(string)
+		}
+	}
+	if asn := asUint(m["autonomous_system_number"]); asn != 0 {
+		ret.ASN = uint32(asn)
+		ret.ASOrg, _ = m["autonomous_system_organization"].(string)
+		ret.Prefix = prefixString(normalize(ip), prefixLen)
+	}
+	if ret.empty() {
+		return nil
+	}
+	return ret
+}
+
+// asUint returns v as a uint64 if it is an unsigned integer, or 0.
+func asUint(v interface{}) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case uint32:
+		return uint64(n)
+	case uint16:
+		return uint64(n)
+	}
+	return 0
+}
+
+// MaxMind DB data section field types.
+const (
+	mmdbExtended  = 0
+	mmdbPointer   = 1
+	mmdbString    = 2
+	mmdbDouble    = 3
+	mmdbBytes     = 4
+	mmdbUint16    = 5
+	mmdbUint32    = 6
+	mmdbMap       = 7
+	mmdbInt32     = 8
+	mmdbUint64    = 9
+	mmdbUint128   = 10
+	mmdbArray     = 11
+	mmdbContainer = 12
+	mmdbEndMarker = 13
+	mmdbBool      = 14
+	mmdbFloat     = 15
+)
+
+// maxDecodeDepth bounds the nesting of decoded values, to guard against
+// malformed files.
+const maxDecodeDepth = 32
+
+// mmdbDecoder decodes values from a MaxMind DB data section.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+var errTruncated = errors.New("truncated data")
+
+// bytes returns the n bytes at offset.
+func (d *mmdbDecoder) bytes(offset uint, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.buf)) || offset+n < offset {
+		return nil, errTruncated
+	}
+	return d.buf[offset : offset+n], nil
+}
+
+// uintValue decodes a big-endian unsigned integer of n bytes at offset.
+func (d *mmdbDecoder) uintValue(offset uint, n uint) (uint64, error) {
+	b, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, err
+	}
+	var ret uint64
+	for _, c := range b {
+		ret = ret<<8 | uint64(c)
+	}
+	return ret, nil
+}
+
+// decode decodes the value at offset, returning it and the offset of the
+// following value.
+func (d *mmdbDecoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	ctrl, err := d.bytes(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+	typ := uint(ctrl[0] >> 5)
+	if typ == mmdbPointer {
+		ptr, next, err := d.pointer(ctrl[0], offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(ptr, depth+1)
+		return value, next, err
+	}
+	if typ == mmdbExtended {
+		ext, err := d.bytes(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset++
+		typ = 7 + uint(ext[0])
+	}
+	size := uint(ctrl[0] & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		extra, err := d.uintValue(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		switch n {
+		case 1:
+			size = 29 + uint(extra)
+		case 2:
+			size = 285 + uint(extra)
+		default:
+			size = 65821 + uint(extra)
+		}
+	}
+	switch typ {
+	case mmdbString:
+		b, err := d.bytes(offset, size)
+		return string(b), offset + size, err
+	case mmdbBytes:
+		b, err := d.bytes(offset, size)
+		return append([]byte(nil), b...), offset + size, err
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		v, err := d.uintValue(offset, 8)
+		return math.Float64frombits(v), offset + 8, err
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		v, err := d.uintValue(offset, 4)
+		return math.Float32frombits(uint32(v)), offset + 4, err
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		if size > 8 {
+			return nil, 0, errors.New("invalid integer size")
+		}
+		v, err := d.uintValue(offset, size)
+		return v, offset + size, err
+	case mmdbInt32:
+		if size > 4 {
+			return nil, 0, errors.New("invalid integer size")
+		}
+		v, err := d.uintValue(offset, size)
+		return int32(uint32(v)), offset + size, err
+	case mmdbUint128:
+		b, err := d.bytes(offset, size)
+		return append([]byte(nil), b...), offset + size, err
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbMap:
+		ret := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			ret[keyString] = value
+			offset = next
+		}
+		return ret, offset, nil
+	case mmdbArray:
+		ret := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			ret = append(ret, value)
+			offset = next
+		}
+		return ret, offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+	}
+}
+
+// pointer decodes the pointer with the given control byte whose payload starts
+// at offset, returning the offset it points to and the offset following it.
+func (d *mmdbDecoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint((ctrl>>3)&0x3) + 1
+	v, err := d.uintValue(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	high := uint64(ctrl & 0x7)
+	var ptr uint64
+	switch n {
+	case 1:
+		ptr = high<<8 | v
+	case 2:
+		ptr = (high<<16 | v) + 2048
+	case 3:
+		ptr = (high<<24 | v) + 526336
+	default:
+		ptr = v
+	}
+	return uint(ptr), offset + n, nil
+}
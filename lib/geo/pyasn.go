@@ -0,0 +1,107 @@
+package geo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RoutingTable maps announced prefixes to their origin ASN, loaded from a
+// pyasn-style routing table dump (as produced by pyasn_util_convert.py): one
+// "prefix<TAB>asn" entry per line, with comments starting with ';'.
+type RoutingTable struct {
+	// prefixes maps each prefix length (in bits of the 16-byte address form)
+	// to the prefixes of that length.
+	prefixes map[int]map[[net.IPv6len]byte]uint32
+
+	// lengths holds the keys of prefixes, longest first.
+	lengths []int
+}
+
+// OpenRoutingTable reads the routing table dump at path.
+func OpenRoutingTable(path string) (*RoutingTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	table, err := ReadRoutingTable(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return table, nil
+}
+
+// ReadRoutingTable reads a routing table dump from r.
+func ReadRoutingTable(r io.Reader) (*RoutingTable, error) {
+	table := &RoutingTable{prefixes: make(map[int]map[[net.IPv6len]byte]uint32)}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, ";") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected prefix and ASN", line)
+		}
+		_, network, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		asn, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid ASN %q", line, fields[1])
+		}
+		table.add(network, uint32(asn))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
+
+// add records the origin ASN of the network.
+func (t *RoutingTable) add(network *net.IPNet, asn uint32) {
+	ones, bits := network.Mask.Size()
+	length := ones + (net.IPv6len*8 - bits)
+	byLength, ok := t.prefixes[length]
+	if !ok {
+		byLength = make(map[[net.IPv6len]byte]uint32)
+		t.prefixes[length] = byLength
+		t.lengths = append(t.lengths, length)
+		sort.Sort(sort.Reverse(sort.IntSlice(t.lengths)))
+	}
+	var key [net.IPv6len]byte
+	copy(key[:], network.IP.To16())
+	byLength[key] = asn
+}
+
+// Lookup implements Database. The returned record holds the ASN and the
+// longest matching prefix.
+func (t *RoutingTable) Lookup(ip net.IP) *Record {
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return nil
+	}
+	isV4 := ip.To4() != nil
+	for _, length := range t.lengths {
+		if isV4 && length < 96 {
+			break
+		}
+		var key [net.IPv6len]byte
+		copy(key[:], ip16.Mask(net.CIDRMask(length, net.IPv6len*8)))
+		if asn, ok := t.prefixes[length][key]; ok {
+			if isV4 {
+				return &Record{ASN: asn, Prefix: prefixString(ip.To4(), length-96)}
+			}
+			return &Record{ASN: asn, Prefix: prefixString(ip16, length)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+// Package honeypot scores the likelihood that a host is a honeypot or that its
+// responses come from a middlebox, by applying heuristics across the results
+// of all protocols scanned on the host.
+package honeypot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of signals.
+const (
+	KindHoneypot  = "honeypot"
+	KindMiddlebox = "middlebox"
+)
+
+// Response is the result of a single scanner on the host, decoded from JSON
+// into generic values.
+type Response struct {
+	Name     string
+	Protocol string
+	Status   string
+	Result   interface{}
+}
+
+// Signal is a single heuristic that matched.
+type Signal struct {
+	Name   string  `json:"name"`
+	Kind   string  `json:"kind"`
+	Weight float64 `json:"weight"`
+	Detail string  `json:"detail,omitempty"`
+}
+
+// Score is the outcome of scoring a host. Each likelihood is the sum of the
+// weights of the matching signals of that kind, capped at 1.
+type Score struct {
+	Honeypot  float64  `json:"honeypot"`
+	Middlebox float64  `json:"middlebox"`
+	Signals   []Signal `json:"signals,omitempty"`
+}
+
+func (s *Score) add(signal Signal) {
+	s.Signals = append(s.Signals, signal)
+	switch signal.Kind {
+	case KindHoneypot:
+		s.Honeypot += signal.Weight
+		if s.Honeypot > 1 {
+			s.Honeypot = 1
+		}
+	case KindMiddlebox:
+		s.Middlebox += signal.Weight
+		if s.Middlebox > 1 {
+			s.Middlebox = 1
+		}
+	}
+}
+
+// Fingerprint identifies a known honeypot (or middlebox) by a pattern in its
+// responses.
+type Fingerprint struct {
+	// Name identifies the fingerprinted software.
+	Name string `json:"name"`
+
+	// Kind is KindHoneypot (the default) or KindMiddlebox.
+	Kind string `json:"kind,omitempty"`
+
+	// Protocol, if set, restricts the fingerprint to responses of that
+	// protocol.
+	Protocol string `json:"protocol,omitempty"`
+
+	// Pattern is a regular expression matched against each string in the
+	// response.
+	Pattern string `json:"pattern"`
+
+	// Weight is the weight of the signal (default 0.9).
+	Weight float64 `json:"weight,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// DefaultFingerprints are the default configurations of common open-source
+// honeypots.
+var DefaultFingerprints = []Fingerprint{
+	{Name: "kippo", Protocol: "ssh", Pattern: `^SSH-2\.0-OpenSSH_5\.1p1 Debian-5$`},
+	{Name: "cowrie", Protocol: "ssh", Pattern: `^SSH-2\.0-OpenSSH_6\.0p1 Debian-4\+deb7u2$`},
+	{Name: "dionaea", Protocol: "ftp", Pattern: `^220 DiskStation FTP server ready\.`},
+	{Name: "dionaea", Protocol: "mssql", Pattern: `^Dionaea$`},
+	{Name: "conpot", Pattern: `\b(Technodrome|Mouser Factory)\b`},
+	{Name: "conpot", Protocol: "siemens", Pattern: `^88111222$`},
+	{Name: "glastopf", Protocol: "http", Pattern: `<h2>Blog Comments</h2>`},
+	{Name: "amun", Protocol: "ftp", Pattern: `^220 Welcome to my FTP Server`},
+	{Name: "honeypy", Protocol: "telnet", Pattern: `Debian GNU/Linux 7\b.*\bhoneypy\b`},
+}
+
+// LoadFingerprints reads a JSON array of fingerprints from path.
+func LoadFingerprints(path string) ([]Fingerprint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ret []Fingerprint
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return ret, nil
+}
+
+// osPatterns identify the operating system family named in a response.
+var osPatterns = map[string]*regexp.Regexp{
+	"windows":  regexp.MustCompile(`(?i)\b(windows|microsoft-iis|win32|win64)\b`),
+	"linux":    regexp.MustCompile(`(?i)\b(ubuntu|debian|centos|red ?hat|fedora|raspbian)\b`),
+	"freebsd":  regexp.MustCompile(`(?i)\bfreebsd\b`),
+	"cisco":    regexp.MustCompile(`(?i)\bcisco\b`),
+	"mikrotik": regexp.MustCompile(`(?i)\bmikrotik\b`),
+}
+
+// icsProtocols are industrial control protocols, which are rarely all spoken
+// by a single real device but are commonly emulated together by honeypots.
+var icsProtocols = map[string]bool{
+	"bacnet":  true,
+	"dnp3":    true,
+	"fox":     true,
+	"modbus":  true,
+	"siemens": true,
+}
+
+// bannerKeys are the keys of the fields holding protocol banners.
+var bannerKeys = map[string]bool{
+	"banner":   true,
+	"greeting": true,
+	"raw":      true,
+	"server":   true,
+}
+
+// skipKeys are the keys of subtrees that are shared legitimately across
+// protocols (e.g. TLS certificates), and are not inspected.
+var skipKeys = map[string]bool{
+	"tls":                 true,
+	"tls_log":             true,
+	"handshake_log":       true,
+	"server_certificates": true,
+	"certificate":         true,
+	"chain":               true,
+}
+
+// Scorer applies the heuristics to hosts.
+type Scorer struct {
+	fingerprints []Fingerprint
+
+	// ManyProtocols is the number of successful protocols at which a host
+	// is considered suspicious (0 disables the heuristic).
+	ManyProtocols int
+
+	// MinResponses is the number of scanned protocols needed before the
+	// cross-protocol heuristics are applied.
+	MinResponses int
+}
+
+// NewScorer returns a Scorer that uses the given fingerprints.
+func NewScorer(fingerprints []Fingerprint) (*Scorer, error) {
+	s := &Scorer{ManyProtocols: 6, MinResponses: 3}
+	for _, f := range fingerprints {
+		re, err := regexp.Compile(f.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("fingerprint %s: %s", f.Name, err)
+		}
+		f.re = re
+		if f.Kind == "" {
+			f.Kind = KindHoneypot
+		}
+		if f.Weight == 0 {
+			f.Weight = 0.9
+		}
+		s.fingerprints = append(s.fingerprints, f)
+	}
+	return s, nil
+}
+
+// walkStrings calls f for each string in v, with the key it was found under.
+func walkStrings(v interface{}, key string, f func(key, value string)) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, child := range node {
+			if skipKeys[k] {
+				continue
+			}
+			walkStrings(child, k, f)
+		}
+	case []interface{}:
+		for _, child := range node {
+			walkStrings(child, key, f)
+		}
+	case string:
+		f(key, node)
+	}
+}
+
+// Score applies the heuristics to the responses of a single host.
+func (s *Scorer) Score(responses []Response) *Score {
+	score := new(Score)
+	succeeded := make(map[string]bool)
+	connected := 0
+	bannerProtocols := make(map[string]map[string]bool)
+	osFamilies := make(map[string]bool)
+	matched := make(map[string]bool)
+
+	for _, r := range responses {
+		if r.Status == "success" {
+			succeeded[r.Protocol] = true
+		}
+		switch r.Status {
+		case "success", "protocol-error", "io-timeout", "connection-closed", "application-error":
+			connected++
+		}
+		walkStrings(r.Result, "", func(key, value string) {
+			for _, f := range s.fingerprints {
+				if f.Protocol != "" && f.Protocol != r.Protocol {
+					continue
+				}
+				if matched[f.Name] || !f.re.MatchString(value) {
+					continue
+				}
+				matched[f.Name] = true
+				score.add(Signal{
+					Name:   "fingerprint",
+					Kind:   f.Kind,
+					Weight: f.Weight,
+					Detail: fmt.Sprintf("%s (%s)", f.Name, r.Name),
+				})
+			}
+			if bannerKeys[key] && len(strings.TrimSpace(value)) >= 4 {
+				value = strings.TrimSpace(value)
+				if bannerProtocols[value] == nil {
+					bannerProtocols[value] = make(map[string]bool)
+				}
+				bannerProtocols[value][r.Protocol] = true
+			}
+			for family, re := range osPatterns {
+				if re.MatchString(value) {
+					osFamilies[family] = true
+				}
+			}
+		})
+	}
+
+	if len(osFamilies) > 1 {
+		var families []string
+		for family := range osFamilies {
+			families = append(families, family)
+		}
+		sort.Strings(families)
+		score.add(Signal{Name: "conflicting_os", Kind: KindHoneypot, Weight: 0.4, Detail: strings.Join(families, ",")})
+	}
+
+	var ics []string
+	for p := range succeeded {
+		if icsProtocols[p] {
+			ics = append(ics, p)
+		}
+	}
+	if len(ics) > 1 {
+		sort.Strings(ics)
+		score.add(Signal{Name: "multiple_ics_protocols", Kind: KindHoneypot, Weight: 0.5, Detail: strings.Join(ics, ",")})
+	}
+
+	if s.ManyProtocols > 0 && len(succeeded) >= s.ManyProtocols {
+		score.add(Signal{Name: "many_protocols", Kind: KindHoneypot, Weight: 0.3, Detail: fmt.Sprintf("%d protocols", len(succeeded))})
+	}
+
+	var shared []string
+	for banner, protocols := range bannerProtocols {
+		if len(protocols) > 1 {
+			shared = append(shared, banner)
+		}
+	}
+	if len(shared) > 0 {
+		sort.Strings(shared)
+		detail := shared[0]
+		if len(detail) > 64 {
+			detail = detail[:64]
+		}
+		score.add(Signal{Name: "identical_banners", Kind: KindMiddlebox, Weight: 0.5, Detail: detail})
+		score.add(Signal{Name: "identical_banners", Kind: KindHoneypot, Weight: 0.2, Detail: detail})
+	}
+
+	if len(responses) >= s.MinResponses && connected == len(responses) && len(succeeded) == 0 {
+		// Every port accepted a connection, but nothing spoke the expected
+		// protocol: typical of SYN proxies, tarpits and transparent
+		// firewalls.
+		score.add(Signal{Name: "accepts_all_connections", Kind: KindMiddlebox, Weight: 0.6, Detail: fmt.Sprintf("%d connections", connected)})
+	}
+	return score
+}
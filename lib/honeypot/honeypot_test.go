@@ -0,0 +1,67 @@
+package honeypot
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	var ret interface{}
+	if err := json.Unmarshal([]byte(s), &ret); err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func signalNames(score *Score) map[string]bool {
+	ret := make(map[string]bool)
+	for _, s := range score.Signals {
+		ret[s.Name+"/"+s.Kind] = true
+	}
+	return ret
+}
+
+func TestScore(t *testing.T) {
+	scorer, err := NewScorer(DefaultFingerprints)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	score := scorer.Score([]Response{
+		{Name: "ssh", Protocol: "ssh", Status: "success", Result: decode(t, `{"server_id":{"raw":"SSH-2.0-OpenSSH_6.0p1 Debian-4+deb7u2"}}`)},
+		{Name: "http", Protocol: "http", Status: "success", Result: decode(t, `{"response":{"headers":{"server":["Microsoft-IIS/7.5"]}}}`)},
+		{Name: "s7", Protocol: "siemens", Status: "success", Result: decode(t, `{"system":"Technodrome"}`)},
+		{Name: "modbus", Protocol: "modbus", Status: "success", Result: decode(t, `{}`)},
+	})
+	names := signalNames(score)
+	for _, expected := range []string{"fingerprint/honeypot", "conflicting_os/honeypot", "multiple_ics_protocols/honeypot"} {
+		if !names[expected] {
+			t.Errorf("missing signal %s in %+v", expected, score.Signals)
+		}
+	}
+	if score.Honeypot != 1 || score.Middlebox != 0 {
+		t.Errorf("unexpected scores %+v", score)
+	}
+
+	score = scorer.Score([]Response{
+		{Name: "ftp", Protocol: "ftp", Status: "protocol-error", Result: decode(t, `{"banner":"HTTP/1.1 400 Bad Request"}`)},
+		{Name: "smtp", Protocol: "smtp", Status: "protocol-error", Result: decode(t, `{"banner":"HTTP/1.1 400 Bad Request"}`)},
+		{Name: "ssh", Protocol: "ssh", Status: "io-timeout"},
+	})
+	names = signalNames(score)
+	if !names["identical_banners/middlebox"] || !names["accepts_all_connections/middlebox"] {
+		t.Errorf("missing middlebox signals in %+v", score.Signals)
+	}
+	if score.Middlebox != 1 {
+		t.Errorf("unexpected scores %+v", score)
+	}
+
+	score = scorer.Score([]Response{
+		{Name: "ssh", Protocol: "ssh", Status: "success", Result: decode(t, `{"server_id":{"raw":"SSH-2.0-OpenSSH_8.2p1 Ubuntu-4ubuntu0.1"}}`)},
+		{Name: "http", Protocol: "http", Status: "success", Result: decode(t, `{"response":{"headers":{"server":["nginx/1.18.0 (Ubuntu)"]}}}`)},
+		{Name: "ftp", Protocol: "ftp", Status: "connection-refused"},
+	})
+	if len(score.Signals) != 0 {
+		t.Errorf("unexpected signals for an ordinary host: %+v", score.Signals)
+	}
+}
@@ -0,0 +1,317 @@
+// Package httpauth answers HTTP authentication challenges (401 responses)
+// using credentials read from a file, so that scans can get past login
+// prompts. The Basic, Digest, NTLM, Negotiate and Bearer schemes are
+// supported; Negotiate with Kerberos, given a keytab or credential cache, and
+// with NTLM. Proxy authentication challenges (407 responses) are answered
+// with the Basic and Digest schemes.
+package httpauth
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/zmap/zgrab2/lib/auth"
+	"github.com/zmap/zgrab2/lib/http"
+	"github.com/zmap/zgrab2/lib/kerberos"
+)
+
+// Credential is a credential of a credentials file (see auth.Read). For NTLM,
+// the username may be given as DOMAIN\user.
+type Credential = auth.Credential
+
+// The headers carrying credentials for the origin server and for a proxy.
+const (
+	authorizationHeader      = "Authorization"
+	proxyAuthorizationHeader = "Proxy-Authorization"
+)
+
+// Attempt is an answer to an authentication challenge.
+type Attempt struct {
+	// Header is the name of the header with which to retry the request:
+	// Authorization, or Proxy-Authorization in answer to a proxy's
+	// challenge.
+	Header string
+
+	// Authorization is the value of the header.
+	Authorization string
+
+	// SameConn is true if the scheme is connection-oriented (as NTLM is):
+	// the retry must be sent on the connection the challenge was read
+	// from, so the caller must drain the response's body and keep the
+	// connection alive.
+	SameConn bool
+
+	// Scheme is the lower-cased name of the scheme answered.
+	Scheme string
+
+	// Realm and Algorithm are the realm and (for Digest) algorithm of the
+	// challenge answered, if given.
+	Realm     string
+	Algorithm string
+
+	// Credential is the credential used.
+	Credential *Credential
+
+	// candidate is the index of Credential among the candidates for the
+	// host.
+	candidate int
+
+	// opening is true if the attempt opened a handshake (as the NTLM
+	// NEGOTIATE message does), which the server continues with another
+	// challenge rather than rejecting.
+	opening bool
+}
+
+// Authenticator computes the credentials to send in response to an
+// authentication challenge.
+type Authenticator interface {
+	// TryGetAuth returns the answer with which to retry req, sent to the
+	// IP address ip (if known), given the challenge in resp (a 401 or 407
+	// response), or nil if there are no (more) credentials for the server
+	// or none of the offered schemes is supported. prev is the attempt req
+	// was sent with, if any: when a server has several candidate
+	// credentials, each is tried in turn as the previous one is rejected.
+	// ip must be nil if req is not sent to the host at ip, as after a
+	// redirect to another site.
+	TryGetAuth(req *http.Request, ip net.IP, resp *http.Response, prev *Attempt) *Attempt
+
+	// Authorize sets the Authorization and Proxy-Authorization headers of
+	// req for which an authentication session has been established with
+	// its host, so that it can be sent without waiting for a challenge.
+	Authorize(req *http.Request)
+
+	// Observe updates the session state from the response to an
+	// authorized request (e.g. the next nonce to use).
+	Observe(resp *http.Response)
+}
+
+// credsAuthenticator is an Authenticator that uses a fixed set of
+// credentials for each host.
+type credsAuthenticator struct {
+	creds *auth.Credentials
+
+	// kerberos, if not nil, answers the Negotiate challenges of all hosts
+	// before their credentials are tried, with kerberosCred as the
+	// credential (whose username is the principal).
+	kerberos     *kerberos.Client
+	kerberosCred *Credential
+
+	// sessions maps the servers that answered a Digest challenge to their
+	// session state (see sessionKey).
+	mu       sync.Mutex
+	sessions map[string]*digestSession
+}
+
+// maxSessions bounds the number of Digest sessions kept; when it is reached,
+// all sessions are dropped.
+const maxSessions = 4096
+
+// ReadCredentials returns an Authenticator using the credentials in the file
+// at path (see auth.Read for the format).
+func ReadCredentials(path string) (Authenticator, error) {
+	creds, err := auth.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewAuthenticator(creds, nil), nil
+}
+
+// NewAuthenticator returns an Authenticator using creds, if not nil, and
+// Kerberos with krb, if not nil. Kerberos is tried first with the hosts
+// offering the Negotiate scheme; if it is rejected, their credentials are
+// tried next.
+func NewAuthenticator(creds *auth.Credentials, krb *kerberos.Client) Authenticator {
+	a := &credsAuthenticator{creds: creds, kerberos: krb, sessions: make(map[string]*digestSession)}
+	if krb != nil {
+		a.kerberosCred = &Credential{Username: krb.Principal()}
+	}
+	return a
+}
+
+// credentialsNameKey is the context key of the name set by
+// WithCredentialsName.
+type credentialsNameKey struct{}
+
+// WithCredentialsName returns a copy of req for which the credentials are
+// looked up under name (a host in the credentials file) instead of the host
+// it is sent to. An empty name restores the lookup by host.
+func WithCredentialsName(req *http.Request, name string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), credentialsNameKey{}, name))
+}
+
+// lookup returns the candidate credentials for the server req is sent to, or
+// those named with WithCredentialsName, after the Kerberos credential if any.
+func (a *credsAuthenticator) lookup(req *http.Request, ip net.IP) []*Credential {
+	var ret []*Credential
+	if a.kerberosCred != nil {
+		ret = append(ret, a.kerberosCred)
+	}
+	if a.creds == nil {
+		return ret
+	}
+	return append(ret, a.lookupCredentials(req, ip)...)
+}
+
+// lookupCredentials returns the credentials of the file for the server req is
+// sent to, or those named with WithCredentialsName.
+func (a *credsAuthenticator) lookupCredentials(req *http.Request, ip net.IP) []*Credential {
+	if name, _ := req.Context().Value(credentialsNameKey{}).(string); name != "" {
+		return a.creds.Lookup(name, "", nil)
+	}
+	port := req.URL.Port()
+	if port == "" {
+		switch strings.ToLower(req.URL.Scheme) {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+	return a.creds.Lookup(req.URL.Hostname(), port, ip)
+}
+
+// TryGetAuth implements the Authenticator interface. The next candidate is
+// used, unless prev opened a handshake that the server continued, or answered
+// a challenge of the other kind (as when a proxy accepted its credentials and
+// the origin server then asks for its own).
+func (a *credsAuthenticator) TryGetAuth(req *http.Request, ip net.IP, resp *http.Response, prev *Attempt) *Attempt {
+	header := authorizationHeader
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		header = proxyAuthorizationHeader
+	}
+	candidates := a.lookup(req, ip)
+	challenges := responseChallenges(resp)
+	i := 0
+	if prev != nil && prev.Header == header {
+		i = prev.candidate + 1
+		if c := findChallenge(challenges, prev.Scheme); prev.opening && c != nil && continues(c) {
+			i = prev.candidate
+		}
+	}
+	for ; i < len(candidates); i++ {
+		// Candidates that cannot answer any of the schemes offered (as a
+		// bearer token for Basic) are skipped.
+		if attempt := a.answer(candidates[i], req, header, challenges); attempt != nil {
+			c := findChallenge(challenges, attempt.Scheme)
+			attempt.Header = header
+			attempt.Realm = c.params["realm"]
+			attempt.Algorithm = c.params["algorithm"]
+			attempt.Credential = candidates[i]
+			attempt.candidate = i
+			return attempt
+		}
+	}
+	return nil
+}
+
+// answer answers the challenges with the given credential, to be sent in the
+// given header. The Kerberos credential only answers the Negotiate scheme,
+// and a bearer token only the Bearer scheme. Otherwise, of the schemes
+// offered by the server, Digest is preferred, then NTLM, then Negotiate
+// (which wraps NTLM), and finally Basic, which sends the password in the
+// clear. Proxies are only answered with Digest or Basic.
+func (a *credsAuthenticator) answer(cred *Credential, req *http.Request, header string, challenges []challenge) *Attempt {
+	if cred == a.kerberosCred {
+		if c := findChallenge(challenges, "negotiate"); c != nil && header == authorizationHeader {
+			if auth := getKerberosAuth(a.kerberos, req); auth != "" {
+				return &Attempt{Authorization: auth, Scheme: c.scheme}
+			}
+		}
+		return nil
+	}
+	if cred.Token != "" {
+		if c := findChallenge(challenges, "bearer"); c != nil {
+			return &Attempt{Authorization: "Bearer " + cred.Token, Scheme: c.scheme}
+		}
+		return nil
+	}
+	if c := findChallenge(challenges, "digest"); c != nil {
+		if auth := a.digestAuth(cred, req, header, c.params); auth != "" {
+			return &Attempt{Authorization: auth, Scheme: c.scheme}
+		}
+	}
+	if header == authorizationHeader {
+		if c := findChallenge(challenges, "ntlm"); c != nil {
+			if auth := getNTLMAuth(cred, c.token); auth != "" {
+				return &Attempt{Authorization: auth, Scheme: c.scheme, SameConn: true, opening: c.token == ""}
+			}
+		}
+		if c := findChallenge(challenges, "negotiate"); c != nil {
+			if auth := getNegotiateAuth(cred, c.token); auth != "" {
+				return &Attempt{Authorization: auth, Scheme: c.scheme, SameConn: true, opening: !continues(c)}
+			}
+		}
+	}
+	if c := findChallenge(challenges, "basic"); c != nil {
+		return &Attempt{Authorization: getBasicAuth(cred), Scheme: c.scheme}
+	}
+	return nil
+}
+
+// digestAuth answers a Digest challenge, reusing the session with the host if
+// the challenge's nonce is the one already in use.
+func (a *credsAuthenticator) digestAuth(cred *Credential, req *http.Request, header string, params map[string]string) string {
+	key := sessionKey(req, header)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.sessions[key]
+	if s == nil || s.params["nonce"] != params["nonce"] {
+		if len(a.sessions) >= maxSessions {
+			a.sessions = make(map[string]*digestSession)
+		}
+		s = newDigestSession(params)
+		a.sessions[key] = s
+	}
+	s.cred = cred
+	return s.authorize(req)
+}
+
+// Authorize implements the Authenticator interface. The credential last
+// used with the host is sent again.
+func (a *credsAuthenticator) Authorize(req *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, header := range []string{authorizationHeader, proxyAuthorizationHeader} {
+		if s := a.sessions[sessionKey(req, header)]; s != nil {
+			req.Header.Set(header, s.authorize(req))
+		}
+	}
+}
+
+// infoHeaders maps the headers carrying credentials to the headers in which
+// the server may send the next nonce to use (RFC 7615).
+var infoHeaders = map[string]string{
+	authorizationHeader:      "Authentication-Info",
+	proxyAuthorizationHeader: "Proxy-Authentication-Info",
+}
+
+// Observe implements the Authenticator interface.
+func (a *credsAuthenticator) Observe(resp *http.Response) {
+	if resp.Request == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for header, infoHeader := range infoHeaders {
+		info := resp.Header.Get(infoHeader)
+		if info == "" {
+			continue
+		}
+		nonce := parseAuthParams(info)["nextnonce"]
+		if nonce == "" {
+			continue
+		}
+		if s := a.sessions[sessionKey(resp.Request, header)]; s != nil {
+			s.nextNonce(nonce)
+		}
+	}
+}
+
+// sessionKey returns the key of the session for the given header with the
+// server req is sent to. The proxy is taken to be the server itself, as when
+// scanning proxies.
+func sessionKey(req *http.Request, header string) string {
+	return header + " " + strings.ToLower(req.URL.Host)
+}
@@ -0,0 +1,422 @@
+package httpauth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zmap/zgrab2/lib/auth"
+	"github.com/zmap/zgrab2/lib/http"
+	"github.com/zmap/zgrab2/lib/kerberos"
+	"github.com/zmap/zgrab2/lib/smb/gss"
+	"github.com/zmap/zgrab2/lib/smb/ntlmssp"
+	"github.com/zmap/zgrab2/lib/smb/smb/encoder"
+)
+
+func TestParseChallenges(t *testing.T) {
+	challenges := parseChallenges([]string{
+		`Digest realm="a \"b\"", qop="auth,auth-int", nonce=abc, Basic realm=x`,
+		`NTLM`,
+		`NTLM TlRMTVNTUAACAAAA==, Negotiate`,
+	})
+	expected := []challenge{
+		{scheme: "digest", params: map[string]string{"realm": `a "b"`, "qop": "auth,auth-int", "nonce": "abc"}},
+		{scheme: "basic", params: map[string]string{"realm": "x"}},
+		{scheme: "ntlm", params: map[string]string{}},
+		{scheme: "ntlm", token: "TlRMTVNTUAACAAAA==", params: map[string]string{}},
+		{scheme: "negotiate", params: map[string]string{}},
+	}
+	if !reflect.DeepEqual(challenges, expected) {
+		t.Errorf("expected %+v, got %+v", expected, challenges)
+	}
+}
+
+// newTestAuthenticator returns an authenticator using the given credentials
+// file contents.
+func newTestAuthenticator(t *testing.T, file string) *credsAuthenticator {
+	creds, err := auth.Read(strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &credsAuthenticator{creds: creds, sessions: make(map[string]*digestSession)}
+}
+
+func TestSplitUsername(t *testing.T) {
+	if domain, user := splitUsername(&Credential{Username: "CORP\\user"}); domain != "CORP" || user != "user" {
+		t.Errorf("unexpected domain %q and user %q", domain, user)
+	}
+	if domain, user := splitUsername(&Credential{Username: "user"}); domain != "" || user != "user" {
+		t.Errorf("unexpected domain %q and user %q", domain, user)
+	}
+}
+
+func TestCredentialsName(t *testing.T) {
+	a := newTestAuthenticator(t, "example.com site:x\nrouter-admin admin:x\n")
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	if c := a.lookup(WithCredentialsName(req, "router-admin"), nil); len(c) != 1 || c[0].Username != "admin" {
+		t.Errorf("unexpected credentials %+v for router-admin", c)
+	}
+	if c := a.lookup(req, nil); len(c) != 1 || c[0].Username != "site" {
+		t.Errorf("unexpected credentials %+v for example.com", c)
+	}
+}
+
+func TestCredsDefaultPort(t *testing.T) {
+	a := newTestAuthenticator(t, "[2001:db8::1]:443 v6-port:x\n[2001:db8::1] v6:x\n")
+	// The port of the URL defaults from its scheme.
+	req, _ := http.NewRequest("GET", "https://[2001:db8::1]/", nil)
+	if c := a.lookup(req, nil); len(c) == 0 || c[0].Username != "v6-port" {
+		t.Errorf("unexpected credentials %+v", c)
+	}
+}
+
+func TestDigestAuth(t *testing.T) {
+	// Example from RFC 2617 section 3.5.
+	req, _ := http.NewRequest("GET", "http://www.nowhere.org/dir/index.html", nil)
+	cred := &Credential{Username: "Mufasa", Password: "Circle Of Life"}
+	params := parseChallenges([]string{`Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`})[0].params
+	auth := getDigestAuth(cred, req, params, 1, "0a4f113b")
+	if !strings.Contains(auth, `response="6629fae49393a05397450978507c4ef1"`) {
+		t.Errorf("unexpected digest response %s", auth)
+	}
+	if !strings.Contains(auth, `nc=00000001`) || !strings.Contains(auth, `opaque="5ccc069c403ebaf9f0171e9517f40e41"`) {
+		t.Errorf("missing fields in %s", auth)
+	}
+
+	params["qop"] = "auth-int"
+	for body, expected := range map[string]string{
+		"":    "4bb0e26e65bdae3e89570d68fd7a073b",
+		"a=b": "31acff116b570c1d227b3736bd60821d",
+	} {
+		var r io.Reader
+		if body != "" {
+			r = strings.NewReader(body)
+		}
+		req, _ := http.NewRequest("POST", "http://www.nowhere.org/dir/index.html", r)
+		auth := getDigestAuth(cred, req, params, 1, "0a4f113b")
+		if !strings.Contains(auth, `response="`+expected+`"`) || !strings.Contains(auth, "qop=auth-int") {
+			t.Errorf("unexpected auth-int answer for body %q: %s", body, auth)
+		}
+	}
+}
+
+// authorize returns the Authorization header that a sets on req.
+func authorize(a Authenticator, req *http.Request) string {
+	req.Header.Del("Authorization")
+	a.Authorize(req)
+	return req.Header.Get("Authorization")
+}
+
+func TestDigestSession(t *testing.T) {
+	a := newTestAuthenticator(t, "example.com user:password")
+	req, _ := http.NewRequest("GET", "http://example.com/a", nil)
+	resp := &http.Response{Header: http.Header{"Www-Authenticate": {`Digest realm="r", nonce="n1", qop="auth", algorithm=MD5-sess`}}}
+	if auth := authorize(a, req); auth != "" {
+		t.Errorf("request authorized before any challenge: %s", auth)
+	}
+	first := a.TryGetAuth(req, nil, resp, nil).Authorization
+	second := a.TryGetAuth(req, nil, resp, nil).Authorization
+	if !strings.Contains(first, "nc=00000001") || !strings.Contains(second, "nc=00000002") {
+		t.Errorf("nonce count not incremented: %s, %s", first, second)
+	}
+	cnonce := parseAuthParams(first[len("Digest "):])["cnonce"]
+	if cnonce == "" || parseAuthParams(second[len("Digest "):])["cnonce"] != cnonce {
+		t.Errorf("cnonce not reused for -sess: %s, %s", first, second)
+	}
+
+	redirect, _ := http.NewRequest("GET", "http://example.com/b", nil)
+	auth := authorize(a, redirect)
+	if !strings.Contains(auth, "nc=00000003") || !strings.Contains(auth, `uri="/b"`) {
+		t.Errorf("unexpected preemptive authorization %s", auth)
+	}
+
+	a.Observe(&http.Response{Request: redirect, Header: http.Header{"Authentication-Info": {`nextnonce="n2", qop=auth`}}})
+	params := parseAuthParams(authorize(a, req)[len("Digest "):])
+	if params["nonce"] != "n2" || params["nc"] != "00000001" {
+		t.Errorf("nextnonce not honored: %v", params)
+	}
+
+	other, _ := http.NewRequest("GET", "http://example.com:8080/", nil)
+	if auth := authorize(a, other); auth != "" {
+		t.Errorf("session used for another port: %s", auth)
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	a := newTestAuthenticator(t, "example.com a:1 b:2\nexample.com c:3\ndefault d:4\n")
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	resp := &http.Response{Header: http.Header{"Www-Authenticate": {"Basic realm=x"}}}
+	var tried []string
+	var attempt *Attempt
+	for {
+		if attempt = a.TryGetAuth(req, nil, resp, attempt); attempt == nil {
+			break
+		}
+		tried = append(tried, attempt.Credential.Username)
+	}
+	if !reflect.DeepEqual(tried, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected candidates %v", tried)
+	}
+
+	req, _ = http.NewRequest("GET", "http://other.com/", nil)
+	if attempt := a.TryGetAuth(req, nil, resp, nil); attempt == nil || attempt.Authorization != "Basic ZDo0" {
+		t.Errorf("default credentials not used: %+v", attempt)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	a := newTestAuthenticator(t, "api.example.com Bearer:eyJ.a.b user:password\n")
+	req, _ := http.NewRequest("GET", "http://api.example.com/", nil)
+	resp := &http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{"Www-Authenticate": {`Basic realm=x, Bearer realm="api"`}}}
+	attempt := a.TryGetAuth(req, nil, resp, nil)
+	if attempt == nil || attempt.Authorization != "Bearer eyJ.a.b" || attempt.Credential.Token != "eyJ.a.b" {
+		t.Fatalf("unexpected answer %+v", attempt)
+	}
+	if attempt = a.TryGetAuth(req, nil, resp, attempt); attempt == nil || attempt.Scheme != "basic" {
+		t.Errorf("unexpected answer %+v", attempt)
+	}
+
+	// A token is not sent to servers that do not ask for one.
+	resp.Header.Set("Www-Authenticate", "Basic realm=x")
+	if attempt := a.TryGetAuth(req, nil, resp, nil); attempt == nil || attempt.Credential.Username != "user" {
+		t.Errorf("unexpected answer %+v", attempt)
+	}
+}
+
+func TestProxyAuth(t *testing.T) {
+	a := newTestAuthenticator(t, "proxy.example.com user:password")
+	req, _ := http.NewRequest("GET", "http://proxy.example.com/", nil)
+	resp := &http.Response{StatusCode: http.StatusProxyAuthRequired, Header: http.Header{
+		"Www-Authenticate":   {"Basic realm=origin"},
+		"Proxy-Authenticate": {"NTLM", `Digest realm="proxy", nonce="n", qop="auth"`},
+	}}
+	attempt := a.TryGetAuth(req, nil, resp, nil)
+	if attempt == nil || attempt.Header != "Proxy-Authorization" || attempt.Scheme != "digest" {
+		t.Fatalf("unexpected answer %+v", attempt)
+	}
+	if params := parseAuthParams(attempt.Authorization[len("Digest "):]); params["realm"] != "proxy" || attempt.Realm != "proxy" {
+		t.Errorf("unexpected realm in %s", attempt.Authorization)
+	}
+	expected := []Challenge{{Scheme: "ntlm"}, {Scheme: "digest", Realm: "proxy"}}
+	if offered := Challenges(resp); !reflect.DeepEqual(offered, expected) {
+		t.Errorf("expected challenges %+v, got %+v", expected, offered)
+	}
+
+	a.Authorize(req)
+	if auth := req.Header.Get("Proxy-Authorization"); !strings.Contains(auth, "nc=00000002") || req.Header.Get("Authorization") != "" {
+		t.Errorf("unexpected preemptive authorization %v", req.Header)
+	}
+
+	// The proxy accepted the credentials, and the origin server asks for
+	// its own: the first candidate is tried again.
+	resp = &http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{"Www-Authenticate": {"Basic realm=origin"}}}
+	if attempt = a.TryGetAuth(req, nil, resp, attempt); attempt == nil || attempt.Header != "Authorization" || attempt.Scheme != "basic" {
+		t.Errorf("unexpected answer %+v", attempt)
+	}
+
+	// Proxies are not answered with NTLM.
+	resp = &http.Response{StatusCode: http.StatusProxyAuthRequired, Header: http.Header{"Proxy-Authenticate": {"NTLM"}}}
+	if attempt := a.TryGetAuth(req, nil, resp, nil); attempt != nil {
+		t.Errorf("unexpected answer %+v", attempt)
+	}
+}
+
+func decodeNTLM(t *testing.T, auth string) []byte {
+	if !strings.HasPrefix(auth, "NTLM ") {
+		t.Fatalf("unexpected header %q", auth)
+	}
+	data, err := base64.StdEncoding.DecodeString(auth[len("NTLM "):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestNTLMAuth(t *testing.T) {
+	a := newTestAuthenticator(t, `192.0.2.1 CORP\user:password`)
+	req, _ := http.NewRequest("GET", "http://192.0.2.1/", nil)
+	resp := &http.Response{Header: http.Header{"Www-Authenticate": {"NTLM", "Basic realm=x"}}}
+	attempt := a.TryGetAuth(req, nil, resp, nil)
+	if !attempt.SameConn {
+		t.Error("NTLM must be answered on the same connection")
+	}
+	var negotiate ntlmssp.Negotiate
+	if err := encoder.Unmarshal(decodeNTLM(t, attempt.Authorization), &negotiate); err != nil || negotiate.MessageType != ntlmssp.TypeNtLmNegotiate {
+		t.Fatalf("expected a NEGOTIATE message, got %+v (%v)", negotiate, err)
+	}
+
+	challenge := ntlmssp.NewChallenge()
+	challenge.ServerChallenge = 0x0123456789abcdef
+	challenge.TargetInfo = &ntlmssp.AvPairSlice{{AvID: ntlmssp.MsvAvEOL}}
+	data, err := encoder.Marshal(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Header.Set("Www-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(data))
+	attempt = a.TryGetAuth(req, nil, resp, attempt)
+	if attempt == nil {
+		t.Fatal("NTLM handshake not continued")
+	}
+	var authenticate ntlmssp.Authenticate
+	if err := encoder.Unmarshal(decodeNTLM(t, attempt.Authorization), &authenticate); err != nil || authenticate.MessageType != ntlmssp.TypeNtLmAuthenticate {
+		t.Fatalf("expected an AUTHENTICATE message, got %+v (%v)", authenticate, err)
+	}
+	if len(authenticate.NtChallengeResponse) == 0 {
+		t.Error("empty NT challenge response")
+	}
+
+	// No credentials for the host.
+	req, _ = http.NewRequest("GET", "http://192.0.2.1.attacker.net/", nil)
+	if attempt := a.TryGetAuth(req, nil, resp, nil); attempt != nil {
+		t.Errorf("credentials sent to the wrong host: %s", attempt.Authorization)
+	}
+}
+
+func TestNegotiateAuth(t *testing.T) {
+	a := newTestAuthenticator(t, `example.com CORP\user:password`)
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	resp := &http.Response{Header: http.Header{"Www-Authenticate": {"Negotiate"}}}
+	attempt := a.TryGetAuth(req, nil, resp, nil)
+	if attempt == nil || !attempt.SameConn || !strings.HasPrefix(attempt.Authorization, "Negotiate ") {
+		t.Fatalf("unexpected answer %+v", attempt)
+	}
+	data, _ := base64.StdEncoding.DecodeString(attempt.Authorization[len("Negotiate "):])
+	var init gss.NegTokenInit
+	if err := init.UnmarshalBinary(data, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(init.Data.MechTypes) != 1 || init.Data.MechTypes[0].String() != gss.NtLmSSPMechTypeOid {
+		t.Errorf("unexpected mechanisms %v", init.Data.MechTypes)
+	}
+
+	challenge := ntlmssp.NewChallenge()
+	challenge.TargetInfo = &ntlmssp.AvPairSlice{{AvID: ntlmssp.MsvAvEOL}}
+	challengeMsg, err := encoder.Marshal(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ntlmOID, _ := gss.ObjectIDStrToInt(gss.NtLmSSPMechTypeOid)
+	serverResp := gss.NegTokenResp{State: gss.GssStateAcceptIncomplete, SupportedMech: ntlmOID, ResponseToken: challengeMsg}
+	data, err = serverResp.MarshalBinary(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Header.Set("Www-Authenticate", "Negotiate "+base64.StdEncoding.EncodeToString(data))
+	if mechs := NegotiateMechanisms(resp); !reflect.DeepEqual(mechs, []string{"ntlm"}) {
+		t.Errorf("unexpected accepted mechanisms %v", mechs)
+	}
+	attempt = a.TryGetAuth(req, nil, resp, attempt)
+	if attempt == nil {
+		t.Fatal("Negotiate handshake not continued")
+	}
+	data, _ = base64.StdEncoding.DecodeString(strings.TrimPrefix(attempt.Authorization, "Negotiate "))
+	var clientResp gss.NegTokenResp
+	if err := clientResp.UnmarshalBinary(data, nil); err != nil {
+		t.Fatal(err)
+	}
+	var authenticate ntlmssp.Authenticate
+	if err := encoder.Unmarshal(clientResp.ResponseToken, &authenticate); err != nil || authenticate.MessageType != ntlmssp.TypeNtLmAuthenticate {
+		t.Fatalf("expected an AUTHENTICATE message, got %+v (%v)", authenticate, err)
+	}
+}
+
+// kerberosClient returns a Kerberos client for alice@EXAMPLE.COM, with a
+// credential cache holding a ticket for HTTP/example.com only.
+func kerberosClient(t *testing.T) *kerberos.Client {
+	var b bytes.Buffer
+	put := func(v interface{}) { binary.Write(&b, binary.BigEndian, v) }
+	data := func(s string) {
+		put(uint32(len(s)))
+		b.WriteString(s)
+	}
+	principal := func(components ...string) {
+		put(uint32(1))
+		put(uint32(len(components)))
+		data("EXAMPLE.COM")
+		for _, c := range components {
+			data(c)
+		}
+	}
+	put(uint16(0x504))
+	put(uint16(0))
+	principal("alice")
+	principal("alice")
+	principal("HTTP", "example.com")
+	put(uint16(kerberos.ETypeAES128CTSHMACSHA196))
+	data("0123456789abcdef")
+	put([]uint32{0, 0, uint32(time.Now().Add(time.Hour).Unix()), 0})
+	put(uint8(0))
+	put([]uint32{0, 0, 0})
+	// The ticket is opaque to the client.
+	data("\x61\x00")
+	data("")
+	cc, err := kerberos.ParseCCache(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The KDC is never contacted.
+	krb, err := kerberos.NewCCacheClient(cc, "127.0.0.1:1", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return krb
+}
+
+func TestKerberosAuth(t *testing.T) {
+	creds, err := auth.Read(strings.NewReader(`example.com CORP\user:password`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAuthenticator(creds, kerberosClient(t))
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	resp := &http.Response{Header: http.Header{"Www-Authenticate": {"Negotiate", "Basic realm=x"}}}
+	attempt := a.TryGetAuth(req, nil, resp, nil)
+	if attempt == nil || attempt.SameConn || attempt.Credential.Username != "alice@EXAMPLE.COM" {
+		t.Fatalf("unexpected answer %+v", attempt)
+	}
+	data, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(attempt.Authorization, "Negotiate "))
+	var init gss.NegTokenInit
+	if err := init.UnmarshalBinary(data, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(init.Data.MechTypes) != 1 || mechanismName(init.Data.MechTypes[0]) != "kerberos" || len(init.Data.MechToken) == 0 || init.Data.MechToken[0] != 0x60 {
+		t.Errorf("unexpected token %+v", init.Data)
+	}
+
+	// Once Kerberos is rejected, the credentials of the host are tried with
+	// NTLM.
+	reject := gss.NegTokenResp{State: gss.GssStateReject}
+	data, err = reject.MarshalBinary(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Header.Set("Www-Authenticate", "Negotiate "+base64.StdEncoding.EncodeToString(data))
+	attempt = a.TryGetAuth(req, nil, resp, attempt)
+	if attempt == nil || !attempt.SameConn || attempt.Credential.Username != `CORP\user` {
+		t.Fatalf("unexpected answer %+v", attempt)
+	}
+	data, _ = base64.StdEncoding.DecodeString(strings.TrimPrefix(attempt.Authorization, "Negotiate "))
+	if err := init.UnmarshalBinary(data, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(init.Data.MechTypes) != 1 || init.Data.MechTypes[0].String() != gss.NtLmSSPMechTypeOid {
+		t.Errorf("unexpected mechanisms %v", init.Data.MechTypes)
+	}
+
+	// A host with neither a ticket nor credentials is not answered, and
+	// Kerberos does not answer the other schemes.
+	req, _ = http.NewRequest("GET", "http://www.example.com/", nil)
+	if attempt := a.TryGetAuth(req, nil, resp, nil); attempt != nil {
+		t.Errorf("unexpected answer %+v", attempt)
+	}
+	resp.Header.Set("Www-Authenticate", "Basic realm=x")
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	if attempt := a.TryGetAuth(req, nil, resp, nil); attempt == nil || attempt.Scheme != "basic" || attempt.candidate != 1 {
+		t.Errorf("unexpected answer %+v", attempt)
+	}
+}
@@ -0,0 +1,190 @@
+package httpauth
+
+import (
+	"strings"
+
+	"github.com/zmap/zgrab2/lib/http"
+)
+
+// Challenge describes an authentication challenge offered by a server.
+type Challenge struct {
+	// Scheme is the lower-cased scheme name.
+	Scheme string `json:"scheme"`
+
+	// Realm is the protection space, if given.
+	Realm string `json:"realm,omitempty"`
+
+	// Algorithm is the Digest algorithm, if given.
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+// Challenges returns the challenges in a 401 or 407 response, in the order
+// the server sent them.
+func Challenges(resp *http.Response) []Challenge {
+	var ret []Challenge
+	for _, c := range responseChallenges(resp) {
+		ret = append(ret, Challenge{Scheme: c.scheme, Realm: c.params["realm"], Algorithm: c.params["algorithm"]})
+	}
+	return ret
+}
+
+// challenge is a single challenge from a WWW-Authenticate header (RFC 7235
+// section 2.1): a scheme followed by either a token68 (as used by NTLM) or a
+// list of parameters.
+type challenge struct {
+	// scheme is the lower-cased scheme name.
+	scheme string
+
+	// token is the token68, if any.
+	token string
+
+	// params maps lower-cased parameter names to their unquoted values.
+	params map[string]string
+}
+
+// findChallenge returns the first challenge for the given scheme, or nil.
+func findChallenge(challenges []challenge, scheme string) *challenge {
+	for i := range challenges {
+		if challenges[i].scheme == scheme {
+			return &challenges[i]
+		}
+	}
+	return nil
+}
+
+// responseChallenges returns the challenges in resp: those of the
+// Proxy-Authenticate header for a 407 response, and of the WWW-Authenticate
+// header otherwise.
+func responseChallenges(resp *http.Response) []challenge {
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return parseChallenges(resp.Header["Proxy-Authenticate"])
+	}
+	return parseChallenges(resp.Header["Www-Authenticate"])
+}
+
+// parseChallenges parses the challenges in each of the given header values.
+// A single value may hold several comma-separated challenges.
+func parseChallenges(values []string) []challenge {
+	var ret []challenge
+	for _, v := range values {
+		p := &challengeParser{s: v}
+		for {
+			p.skip(" \t,")
+			scheme := p.token()
+			if scheme == "" {
+				break
+			}
+			c := challenge{scheme: strings.ToLower(scheme), params: make(map[string]string)}
+			p.parseParams(&c)
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// parseAuthParams parses a list of parameters, as in the Authentication-Info
+// header (RFC 7615).
+func parseAuthParams(s string) map[string]string {
+	c := challenge{params: make(map[string]string)}
+	p := &challengeParser{s: s}
+	p.parseParams(&c)
+	return c.params
+}
+
+type challengeParser struct {
+	s   string
+	pos int
+}
+
+func (p *challengeParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *challengeParser) skip(chars string) {
+	for p.pos < len(p.s) && strings.IndexByte(chars, p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// token reads a run of characters up to whitespace, a comma or an equals
+// sign.
+func (p *challengeParser) token() string {
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(" \t,=", p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// quoted reads a quoted string, starting at the opening quote.
+func (p *challengeParser) quoted() string {
+	var b strings.Builder
+	p.pos++
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return b.String()
+		case '\\':
+			if p.pos < len(p.s) {
+				b.WriteByte(p.s[p.pos])
+				p.pos++
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// parseParams reads the token68 or parameters following a scheme, stopping
+// at the start of the next challenge.
+func (p *challengeParser) parseParams(c *challenge) {
+	p.skip(" \t")
+	start := p.pos
+	name := p.token()
+	if name == "" {
+		return
+	}
+	p.skip(" \t")
+	if p.peek() != '=' {
+		// A bare token after the scheme can only be a token68.
+		c.token = name
+		return
+	}
+	p.pos++
+	p.skip(" \t")
+	if next := p.peek(); next == 0 || next == ',' || next == '=' {
+		// Base64 padding: the whole thing is a token68.
+		p.skip("=")
+		c.token = p.s[start:p.pos]
+		return
+	}
+	for {
+		if p.peek() == '"' {
+			c.params[strings.ToLower(name)] = p.quoted()
+		} else {
+			c.params[strings.ToLower(name)] = p.token()
+		}
+		p.skip(" \t")
+		if p.peek() != ',' {
+			return
+		}
+		p.skip(" \t,")
+		// The next item is either another parameter, or the scheme of
+		// the next challenge.
+		mark := p.pos
+		name = p.token()
+		p.skip(" \t")
+		if name == "" || p.peek() != '=' {
+			p.pos = mark
+			return
+		}
+		p.pos++
+		p.skip(" \t")
+	}
+}
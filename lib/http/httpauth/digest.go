@@ -0,0 +1,183 @@
+package httpauth
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"strings"
+
+	"github.com/zmap/zgrab2/lib/http"
+)
+
+// getBasicAuth returns the Authorization header value for the Basic scheme
+// (RFC 7617).
+func getBasicAuth(cred *Credential) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(cred.Username+":"+cred.Password))
+}
+
+// digestAlgorithms maps the Digest algorithm names (without the -sess
+// suffix) to their hash functions.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"MD5":         md5.New,
+	"SHA-256":     sha256.New,
+	"SHA-512-256": sha512.New512_256,
+}
+
+// newCnonce returns a random client nonce.
+func newCnonce() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// digestSession is the state kept for a host after answering its Digest
+// challenge, so that later requests to the host can be authorized without a
+// new challenge, using an incremented nonce count (RFC 7616 section 3.4).
+type digestSession struct {
+	cred   *Credential
+	params map[string]string
+	nc     uint32
+
+	// cnonce is reused for all requests of a -sess algorithm, whose
+	// session key is derived from the first cnonce.
+	cnonce string
+}
+
+func newDigestSession(params map[string]string) *digestSession {
+	return &digestSession{params: params, cnonce: newCnonce()}
+}
+
+// authorize returns the Authorization header value for req, using the next
+// nonce count.
+func (s *digestSession) authorize(req *http.Request) string {
+	s.nc++
+	cnonce := s.cnonce
+	if !strings.HasSuffix(strings.ToLower(s.params["algorithm"]), "-sess") {
+		cnonce = newCnonce()
+	}
+	return getDigestAuth(s.cred, req, s.params, s.nc, cnonce)
+}
+
+// nextNonce switches the session to the nonce the server sent in the
+// nextnonce parameter of its Authentication-Info header.
+func (s *digestSession) nextNonce(nonce string) {
+	params := make(map[string]string, len(s.params))
+	for k, v := range s.params {
+		params[k] = v
+	}
+	params["nonce"] = nonce
+	s.params = params
+	s.nc = 0
+	s.cnonce = newCnonce()
+}
+
+// getDigestAuth returns the Authorization header value for the Digest scheme
+// (RFC 7616) given the challenge parameters, nonce count and client nonce, or
+// "" if the challenge cannot be answered.
+func getDigestAuth(cred *Credential, req *http.Request, params map[string]string, nonceCount uint32, cnonce string) string {
+	nonce := params["nonce"]
+	if nonce == "" {
+		return ""
+	}
+	algorithm := params["algorithm"]
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+	upper := strings.ToUpper(algorithm)
+	sess := strings.HasSuffix(upper, "-SESS")
+	newHash, ok := digestAlgorithms[strings.TrimSuffix(upper, "-SESS")]
+	if !ok {
+		return ""
+	}
+	h := func(s string) string {
+		d := newHash()
+		d.Write([]byte(s))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+
+	// auth is preferred, since auth-int needs the request body.
+	qop := ""
+	if offered, ok := params["qop"]; ok {
+		for _, q := range strings.Split(offered, ",") {
+			switch strings.TrimSpace(q) {
+			case "auth":
+				qop = "auth"
+			case "auth-int":
+				if qop == "" {
+					qop = "auth-int"
+				}
+			}
+		}
+		if qop == "" {
+			return ""
+		}
+	}
+
+	realm := params["realm"]
+	uri := req.URL.RequestURI()
+	nc := fmt.Sprintf("%08x", nonceCount)
+
+	ha1 := h(cred.Username + ":" + realm + ":" + cred.Password)
+	if sess {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+	if qop == "auth-int" {
+		body, err := requestBody(req)
+		if err != nil {
+			return ""
+		}
+		ha2 = h(req.Method + ":" + uri + ":" + h(string(body)))
+	}
+	var response string
+	if qop != "" {
+		response = h(strings.Join([]string{ha1, nonce, nc, cnonce, qop, ha2}, ":"))
+	} else {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	}
+
+	fields := []string{
+		fmt.Sprintf("username=%s", quote(cred.Username)),
+		fmt.Sprintf("realm=%s", quote(realm)),
+		fmt.Sprintf("nonce=%s", quote(nonce)),
+		fmt.Sprintf("uri=%s", quote(uri)),
+		fmt.Sprintf("algorithm=%s", algorithm),
+		fmt.Sprintf("response=%s", quote(response)),
+	}
+	if opaque, ok := params["opaque"]; ok {
+		fields = append(fields, fmt.Sprintf("opaque=%s", quote(opaque)))
+	}
+	if qop != "" {
+		fields = append(fields, "qop="+qop, "nc="+nc, fmt.Sprintf("cnonce=%s", quote(cnonce)))
+	}
+	return "Digest " + strings.Join(fields, ", ")
+}
+
+// requestBody returns a copy of the body of req, without consuming it. A
+// request without a body has an empty body.
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("request body cannot be read twice")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ioutil.ReadAll(body)
+}
+
+// quote returns s as an HTTP quoted-string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
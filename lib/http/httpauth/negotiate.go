@@ -0,0 +1,163 @@
+package httpauth
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/base64"
+
+	"github.com/zmap/zgrab2/lib/http"
+	"github.com/zmap/zgrab2/lib/kerberos"
+	"github.com/zmap/zgrab2/lib/smb/gss"
+	"github.com/zmap/zgrab2/lib/smb/ntlmssp"
+)
+
+// mechanismNames maps the OIDs of common GSS-API mechanisms to short names.
+var mechanismNames = map[string]string{
+	gss.NtLmSSPMechTypeOid:   "ntlm",
+	"1.2.840.113554.1.2.2":   "kerberos",
+	"1.2.840.48018.1.2.2":    "kerberos",
+	"1.2.840.113554.1.2.2.3": "kerberos-u2u",
+	"1.3.6.1.4.1.311.2.2.30": "negoex",
+	"1.3.6.1.5.2.5":          "iakerb",
+}
+
+func mechanismName(oid asn1.ObjectIdentifier) string {
+	if name, ok := mechanismNames[oid.String()]; ok {
+		return name
+	}
+	return oid.String()
+}
+
+// getKerberosAuth returns the Authorization header value of the Negotiate
+// scheme with the Kerberos ticket of krb for the HTTP service of the host req
+// is sent to, in a SPNEGO initial token offering only Kerberos. It returns ""
+// if no ticket could be obtained, as when the host has no service principal.
+func getKerberosAuth(krb *kerberos.Client, req *http.Request) string {
+	token, err := krb.GSSToken(req.Context(), "HTTP", req.URL.Hostname())
+	if err != nil {
+		return ""
+	}
+	init, err := gss.NewNegTokenInit()
+	if err != nil {
+		return ""
+	}
+	init.Data.MechTypes = []asn1.ObjectIdentifier{kerberosOID()}
+	init.Data.MechToken = token
+	data, err := init.MarshalBinary(nil)
+	if err != nil {
+		return ""
+	}
+	return "Negotiate " + base64.StdEncoding.EncodeToString(data)
+}
+
+func kerberosOID() asn1.ObjectIdentifier {
+	oid := make(asn1.ObjectIdentifier, len(kerberos.OID))
+	for i, arc := range kerberos.OID {
+		oid[i] = int(arc)
+	}
+	return oid
+}
+
+// continues returns whether the challenge c continues an NTLM handshake,
+// possibly wrapped in SPNEGO: with the Negotiate scheme, a token rejecting
+// another mechanism (as Kerberos) or offering mechanisms does not.
+func continues(c *challenge) bool {
+	if c.scheme != "negotiate" || c.token == "" {
+		return c.token != ""
+	}
+	data, err := base64.StdEncoding.DecodeString(c.token)
+	if err != nil {
+		return false
+	}
+	if bytes.HasPrefix(data, []byte(ntlmssp.Signature)) {
+		return true
+	}
+	var resp gss.NegTokenResp
+	if err := resp.UnmarshalBinary(data, nil); err != nil {
+		return false
+	}
+	return len(resp.ResponseToken) > 0 && (len(resp.SupportedMech) == 0 || resp.SupportedMech.String() == gss.NtLmSSPMechTypeOid)
+}
+
+// getNegotiateAuth returns the Authorization header value for the next step
+// of the Negotiate scheme (RFC 4559), using NTLM as the SPNEGO mechanism.
+// Servers that send raw NTLM messages rather than SPNEGO tokens are answered
+// in kind. A token that does not continue an NTLM handshake, as one rejecting
+// Kerberos, is answered with a new handshake. It returns "" if the NTLM
+// challenge is invalid.
+func getNegotiateAuth(cred *Credential, token string) string {
+	if !continues(&challenge{scheme: "negotiate", token: token}) {
+		init, err := gss.NewNegTokenInit()
+		if err != nil {
+			return ""
+		}
+		init.Data.MechToken = ntlmNegotiateMessage(cred)
+		data, err := init.MarshalBinary(nil)
+		if err != nil {
+			return ""
+		}
+		return "Negotiate " + base64.StdEncoding.EncodeToString(data)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return ""
+	}
+	if bytes.HasPrefix(data, []byte(ntlmssp.Signature)) {
+		msg := ntlmAuthenticateMessage(cred, data)
+		if msg == nil {
+			return ""
+		}
+		return "Negotiate " + base64.StdEncoding.EncodeToString(msg)
+	}
+	var resp gss.NegTokenResp
+	if err := resp.UnmarshalBinary(data, nil); err != nil {
+		return ""
+	}
+	msg := ntlmAuthenticateMessage(cred, resp.ResponseToken)
+	if msg == nil {
+		return ""
+	}
+	out := gss.NegTokenResp{ResponseToken: msg}
+	data, err = out.MarshalBinary(nil)
+	if err != nil {
+		return ""
+	}
+	return "Negotiate " + base64.StdEncoding.EncodeToString(data)
+}
+
+// NegotiateMechanisms returns the names of the mechanisms found in the
+// Negotiate challenge in resp: the mechanism the server accepted, if it sent
+// a SPNEGO response, or the mechanisms it offers, if it sent an initial
+// token. A raw NTLM message counts as accepting NTLM.
+func NegotiateMechanisms(resp *http.Response) []string {
+	c := findChallenge(parseChallenges(resp.Header["Www-Authenticate"]), "negotiate")
+	if c == nil || c.token == "" {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(c.token)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	if bytes.HasPrefix(data, []byte(ntlmssp.Signature)) {
+		return []string{"ntlm"}
+	}
+	var ret []string
+	switch data[0] {
+	case 0x60:
+		var init gss.NegTokenInit
+		if err := init.UnmarshalBinary(data, nil); err != nil {
+			return nil
+		}
+		for _, oid := range init.Data.MechTypes {
+			ret = append(ret, mechanismName(oid))
+		}
+	case 0xa1:
+		var resp gss.NegTokenResp
+		if err := resp.UnmarshalBinary(data, nil); err != nil || len(resp.SupportedMech) == 0 {
+			return nil
+		}
+		ret = append(ret, mechanismName(resp.SupportedMech))
+	}
+	return ret
+}
@@ -0,0 +1,66 @@
+package httpauth
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/zmap/zgrab2/lib/smb/ntlmssp"
+	"github.com/zmap/zgrab2/lib/smb/smb/encoder"
+)
+
+// getNTLMAuth returns the Authorization header value for the next step of
+// the NTLM handshake (MS-NTHT): the NEGOTIATE message if the server sent a
+// bare NTLM challenge, or the AUTHENTICATE message answering the server's
+// CHALLENGE message. It returns "" if the server's message is invalid.
+func getNTLMAuth(cred *Credential, token string) string {
+	var msg []byte
+	if token == "" {
+		msg = ntlmNegotiateMessage(cred)
+	} else {
+		data, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return ""
+		}
+		msg = ntlmAuthenticateMessage(cred, data)
+	}
+	if msg == nil {
+		return ""
+	}
+	return "NTLM " + base64.StdEncoding.EncodeToString(msg)
+}
+
+// splitUsername returns the NTLM domain and user name of the credential.
+func splitUsername(cred *Credential) (domain, user string) {
+	if i := strings.IndexByte(cred.Username, '\\'); i >= 0 {
+		return cred.Username[:i], cred.Username[i+1:]
+	}
+	return "", cred.Username
+}
+
+// ntlmNegotiateMessage returns the encoded NTLM NEGOTIATE message.
+func ntlmNegotiateMessage(cred *Credential) []byte {
+	domain, _ := splitUsername(cred)
+	data, err := encoder.Marshal(ntlmssp.NewNegotiate(domain, ""))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// ntlmAuthenticateMessage returns the encoded NTLM AUTHENTICATE message
+// answering the given CHALLENGE message, or nil if it is invalid.
+func ntlmAuthenticateMessage(cred *Credential, challengeMsg []byte) []byte {
+	challenge := ntlmssp.NewChallenge()
+	if err := encoder.Unmarshal(challengeMsg, &challenge); err != nil {
+		return nil
+	}
+	if challenge.MessageType != ntlmssp.TypeNtLmChallenge {
+		return nil
+	}
+	domain, user := splitUsername(cred)
+	data, err := encoder.Marshal(ntlmssp.NewAuthenticatePass(domain, user, "", cred.Password, challenge))
+	if err != nil {
+		return nil
+	}
+	return data
+}
@@ -14,6 +14,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/textproto"
 	"net/url"
 	"strconv"
@@ -90,6 +91,28 @@ type Response struct {
 	// the server, set Transport.DisableCompression to true.
 	Uncompressed bool `json:"-"`
 
+	// ContentEncoding is the encoding ("gzip", "br" or "zstd") of the
+	// body as sent by the server, if it was decompressed by the Transport.
+	ContentEncoding string `json:"content_encoding,omitempty"`
+
+	// DecompressedLength is the number of bytes of the body read after
+	// decompression, set by the caller that read it.
+	DecompressedLength int64 `json:"decompressed_length,omitempty"`
+
+	// Truncated is true if the body was longer than the number of bytes
+	// read from it, because of Transport.MaxResponseSize or the limit given
+	// to ReadBody.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// OriginalContentLength is the Content-Length sent by the server, if
+	// the body was truncated. Unlike ContentLength, it is kept when the
+	// body is decompressed.
+	OriginalContentLength int64 `json:"original_content_length,omitempty"`
+
+	// compressedLength is the ContentLength of a body decompressed by the
+	// Transport.
+	compressedLength int64
+
 	// Trailer maps trailer keys to values in the same
 	// format as Header.
 	//
@@ -104,6 +127,11 @@ type Response struct {
 	// any trailer values sent by the server.
 	Trailer Header `json:"trailers,omitempty"`
 
+	// CookieJar holds the cookies of the client's cookie jar that apply to
+	// the URL of Request, once this Response was received. It is only
+	// populated when the client has a Jar.
+	CookieJar []*Cookie `json:"cookie_jar,omitempty"`
+
 	// Request is the request that was sent to obtain this Response.
 	// Request's Body is nil (having already been consumed).
 	// This is only populated for Client requests.
@@ -127,6 +155,64 @@ func (f *PageFingerprint) MarshalJSON() ([]byte, error) {
 	return json.Marshal(f.Hex())
 }
 
+// ReadBody copies up to limit bytes of the body to w, and returns the number
+// of bytes copied. If the body is longer, the Response is marked as
+// Truncated.
+func (r *Response) ReadBody(w io.Writer, limit int64) (int64, error) {
+	n, err := io.CopyN(w, r.Body, limit)
+	if err == io.EOF {
+		return n, nil
+	}
+	if err == nil {
+		// Check whether the body ends here.
+		if more, _ := io.CopyN(ioutil.Discard, r.Body, 1); more > 0 {
+			r.markTruncated()
+		}
+	}
+	return n, err
+}
+
+// markTruncated marks the Response as Truncated, and records the
+// Content-Length sent by the server, if any.
+func (r *Response) markTruncated() {
+	r.Truncated = true
+	length := r.ContentLength
+	if r.Uncompressed {
+		length = r.compressedLength
+	}
+	if length > 0 {
+		r.OriginalContentLength = length
+	}
+}
+
+// limitedBody is a response body that ends after remaining bytes, marking
+// the response as Truncated if it is longer.
+type limitedBody struct {
+	io.ReadCloser
+	res       *Response
+	remaining int64
+	checked   bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		if !b.checked {
+			b.checked = true
+			var one [1]byte
+			if n, _ := io.ReadFull(b.ReadCloser, one[:]); n > 0 {
+				b.res.markTruncated()
+			}
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
 // Cookies parses and returns the cookies set in the Set-Cookie headers.
 func (r *Response) Cookies() []*Cookie {
 	return readSetCookies(r.Header)
@@ -834,6 +834,39 @@ func TestResponseContentLengthShortBody(t *testing.T) {
 	}
 }
 
+func TestResponseReadBody(t *testing.T) {
+	for _, test := range []struct {
+		body      string
+		limit     int64
+		read      string
+		truncated bool
+	}{
+		{"0123456789", 4, "0123", true},
+		{"0123456789", 10, "0123456789", false},
+		{"0123456789", 20, "0123456789", false},
+	} {
+		br := bufio.NewReader(strings.NewReader("HTTP/1.1 200 OK\r\n" +
+			fmt.Sprintf("Content-Length: %d\r\n", len(test.body)) +
+			"\r\n" +
+			test.body))
+		res, err := ReadResponse(br, &Request{Method: "GET"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		n, err := res.ReadBody(&buf, test.limit)
+		if err != nil || n != int64(len(test.read)) || buf.String() != test.read {
+			t.Errorf("limit %d: read %q (%d bytes), error %v; want %q", test.limit, buf.String(), n, err, test.read)
+		}
+		if res.Truncated != test.truncated {
+			t.Errorf("limit %d: Truncated = %v; want %v", test.limit, res.Truncated, test.truncated)
+		}
+		if test.truncated && res.OriginalContentLength != int64(len(test.body)) {
+			t.Errorf("limit %d: OriginalContentLength = %d; want %d", test.limit, res.OriginalContentLength, len(test.body))
+		}
+	}
+}
+
 // Test various ReadResponse error cases. (also tests success cases, but mostly
 // it's about errors).  This does not test anything involving the bodies. Only
 // the return value from ReadResponse itself.
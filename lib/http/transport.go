@@ -26,6 +26,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 	"github.com/zmap/zcrypto/tls"
 	"github.com/zmap/zgrab2"
 	"github.com/zmap/zgrab2/lib/http/httptrace"
@@ -139,6 +141,17 @@ type Transport struct {
 	// uncompressed.
 	DisableCompression bool
 
+	// AcceptEncodings lists the content encodings the Transport requests
+	// and transparently decodes, among "gzip", "br" (brotli) and "zstd",
+	// when it sets Accept-Encoding itself. If empty, only gzip is
+	// requested.
+	AcceptEncodings []string
+
+	// MaxResponseSize, if positive, is the maximum number of bytes of a
+	// response body (after decoding) that can be read: the body ends
+	// there, and the Response is marked as Truncated if it is longer.
+	MaxResponseSize int64
+
 	// MaxIdleConns controls the maximum number of idle (keep-alive)
 	// connections across all hosts. Zero means no limit.
 	MaxIdleConns int
@@ -1590,12 +1603,17 @@ func (pc *persistConn) readLoop() {
 		}
 
 		resp.Body = body
-		if rc.addedGzip && resp.Header.Get("Content-Encoding") == "gzip" {
-			resp.Body = &gzipReader{body: body}
+		if encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); rc.addedEncodings[encoding] {
+			resp.Body = &decodingReader{body: body, encoding: encoding}
 			resp.Header.Del("Content-Encoding")
 			resp.Header.Del("Content-Length")
+			resp.compressedLength = resp.ContentLength
 			resp.ContentLength = -1
 			resp.Uncompressed = true
+			resp.ContentEncoding = encoding
+		}
+		if pc.t.MaxResponseSize > 0 {
+			resp.Body = &limitedBody{ReadCloser: resp.Body, res: resp, remaining: pc.t.MaxResponseSize}
 		}
 
 		select {
@@ -1774,10 +1792,10 @@ type requestAndChan struct {
 	req *Request
 	ch  chan responseAndError // unbuffered; always send in select on callerGone
 
-	// whether the Transport (as opposed to the user client code)
-	// added the Accept-Encoding gzip header. If the Transport
-	// set it, only then do we transparently decode the gzip.
-	addedGzip bool
+	// the encodings of the Accept-Encoding header, if the Transport (as
+	// opposed to the user client code) added it. If the Transport set
+	// it, only then do we transparently decode the response.
+	addedEncodings map[string]bool
 
 	// Optional blocking chan for Expect: 100-continue (for send).
 	// If the request has an "Expect: 100-continue" header and
@@ -1848,7 +1866,7 @@ func (pc *persistConn) roundTrip(req *transportRequest) (resp *Response, err err
 	// own value for Accept-Encoding. We only attempt to
 	// uncompress the gzip stream if we were the layer that
 	// requested it.
-	requestedGzip := false
+	var requestedEncodings map[string]bool
 	if !pc.t.DisableCompression &&
 		req.Header.Get("Accept-Encoding") == "" &&
 		req.Header.Get("Range") == "" &&
@@ -1865,8 +1883,15 @@ func (pc *persistConn) roundTrip(req *transportRequest) (resp *Response, err err
 		// We don't request gzip if the request is for a range, since
 		// auto-decoding a portion of a gzipped document will just fail
 		// anyway. See https://golang.org/issue/8923
-		requestedGzip = true
-		req.extraHeaders().Set("Accept-Encoding", "gzip")
+		encodings := pc.t.AcceptEncodings
+		if len(encodings) == 0 {
+			encodings = []string{"gzip"}
+		}
+		requestedEncodings = make(map[string]bool, len(encodings))
+		for _, encoding := range encodings {
+			requestedEncodings[encoding] = true
+		}
+		req.extraHeaders().Set("Accept-Encoding", strings.Join(encodings, ", "))
 	}
 
 	var continueCh chan struct{}
@@ -1890,11 +1915,11 @@ func (pc *persistConn) roundTrip(req *transportRequest) (resp *Response, err err
 
 	resc := make(chan responseAndError)
 	pc.reqch <- requestAndChan{
-		req:        req.Request,
-		ch:         resc,
-		addedGzip:  requestedGzip,
-		continueCh: continueCh,
-		callerGone: gone,
+		req:            req.Request,
+		ch:             resc,
+		addedEncodings: requestedEncodings,
+		continueCh:     continueCh,
+		callerGone:     gone,
 	}
 
 	var re responseAndError
@@ -2077,38 +2102,55 @@ func (es *bodyEOFSignal) condfn(err error) error {
 	return err
 }
 
-// gzipReader wraps a response body so it can lazily
-// call gzip.NewReader on the first call to Read
-type gzipReader struct {
-	body *bodyEOFSignal // underlying HTTP/1 response body framing
-	zr   *gzip.Reader   // lazily-initialized gzip reader
-	zerr error          // any error from gzip.NewReader; sticky
-}
-
-func (gz *gzipReader) Read(p []byte) (n int, err error) {
-	if gz.zr == nil {
-		if gz.zerr == nil {
-			gz.zr, gz.zerr = gzip.NewReader(gz.body)
+// decodingReader wraps a response body so it can lazily create the
+// decompressing reader of its encoding on the first call to Read.
+type decodingReader struct {
+	body     *bodyEOFSignal // underlying HTTP/1 response body framing
+	encoding string         // "gzip", "br" or "zstd"
+	zr       io.Reader      // lazily-initialized decompressing reader
+	zclose   func()         // releases zr, if needed
+	zerr     error          // any error from creating zr; sticky
+}
+
+func (dr *decodingReader) Read(p []byte) (n int, err error) {
+	if dr.zr == nil {
+		if dr.zerr == nil {
+			switch dr.encoding {
+			case "gzip":
+				dr.zr, dr.zerr = gzip.NewReader(dr.body)
+			case "br":
+				dr.zr = brotli.NewReader(dr.body)
+			case "zstd":
+				var zr *zstd.Decoder
+				if zr, dr.zerr = zstd.NewReader(dr.body); dr.zerr == nil {
+					dr.zr, dr.zclose = zr, zr.Close
+				}
+			default:
+				dr.zerr = fmt.Errorf("net/http: unsupported content encoding %q", dr.encoding)
+			}
 		}
-		if gz.zerr != nil {
-			return 0, gz.zerr
+		if dr.zerr != nil {
+			return 0, dr.zerr
 		}
 	}
 
-	gz.body.mu.Lock()
-	if gz.body.closed {
+	dr.body.mu.Lock()
+	if dr.body.closed {
 		err = errReadOnClosedResBody
 	}
-	gz.body.mu.Unlock()
+	dr.body.mu.Unlock()
 
 	if err != nil {
 		return 0, err
 	}
-	return gz.zr.Read(p)
+	return dr.zr.Read(p)
 }
 
-func (gz *gzipReader) Close() error {
-	return gz.body.Close()
+func (dr *decodingReader) Close() error {
+	if dr.zclose != nil {
+		dr.zclose()
+	}
+	return dr.body.Close()
 }
 
 type readerAndCloser struct {
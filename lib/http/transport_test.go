@@ -1081,6 +1081,41 @@ func TestTransportGzipShort(t *testing.T) {
 	}
 }
 
+func TestTransportMaxResponseSize(t *testing.T) {
+	defer afterTest(t)
+	body := strings.Repeat("a", 10000)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(body))
+		gz.Close()
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+		w.Write(buf.Bytes())
+	}))
+	defer ts.Close()
+
+	tr := &Transport{MaxResponseSize: 100}
+	defer tr.CloseIdleConnections()
+	c := MakeNewClient()
+	c.Transport = tr
+	res, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	read, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(read) != body[:100] {
+		t.Errorf("read %d bytes; want 100", len(read))
+	}
+	if !res.Truncated || res.OriginalContentLength <= 0 || res.OriginalContentLength >= int64(len(body)) {
+		t.Errorf("Truncated = %v, OriginalContentLength = %d; want the compressed length", res.Truncated, res.OriginalContentLength)
+	}
+}
+
 // Wait until number of goroutines is no greater than nmax, or time out.
 func waitNumGoroutine(nmax int) int {
 	nfinal := runtime.NumGoroutine()
@@ -0,0 +1,220 @@
+// Package jsonapi sends requests to the JSON HTTP APIs of services such as
+// Elasticsearch, Docker and Kubernetes, over plain HTTP or HTTPS.
+//
+// Each request is sent on a new connection opened with the zgrab2 dialer, so
+// that the scan timeouts apply, and redirects are not followed.
+package jsonapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/zmap/zgrab2"
+)
+
+// DefaultMaxSize is the maximum size of a response body read, if the client
+// does not set one.
+const DefaultMaxSize = 1 << 20
+
+// Client sends requests to a scan target.
+type Client struct {
+	Target    *zgrab2.ScanTarget
+	BaseFlags *zgrab2.BaseFlags
+
+	// TLSFlags configures the TLS handshake, if UseTLS is set.
+	TLSFlags *zgrab2.TLSFlags
+	UseTLS   bool
+
+	// UserAgent and Header are sent with each request.
+	UserAgent string
+	Header    http.Header
+
+	// MaxSize is the maximum size of a response body read; the rest is
+	// discarded.
+	MaxSize int
+
+	// TLSLog is the log of the first TLS handshake.
+	TLSLog *zgrab2.TLSLog
+}
+
+// Response is the response to a request.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// Truncated is true if the body was larger than the maximum size.
+	Truncated bool
+}
+
+// OK returns true if the status code is 2xx.
+func (r *Response) OK() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// AuthRequired returns true if the server refused the request for lack of
+// credentials or permissions.
+func (r *Response) AuthRequired() bool {
+	return r.StatusCode == http.StatusUnauthorized || r.StatusCode == http.StatusForbidden
+}
+
+// url returns the URL of path on the target.
+func (c *Client) url(path string) string {
+	host := c.Target.Domain
+	if host == "" {
+		host = c.Target.IP.String()
+	}
+	port := c.BaseFlags.Port
+	if c.Target.Port != nil {
+		port = *c.Target.Port
+	}
+	scheme := "http"
+	if c.UseTLS {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10)) + path
+}
+
+// dial opens a connection to the target, negotiating TLS if UseTLS is set.
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	conn, err := c.Target.Open(ctx, c.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	if !c.UseTLS {
+		return conn, nil
+	}
+	// Only the first handshake, whose log is kept, runs the checks needing
+	// new connections.
+	var dial func() (net.Conn, error)
+	if c.TLSLog == nil {
+		dial = func() (net.Conn, error) {
+			return c.Target.Open(ctx, c.BaseFlags)
+		}
+	}
+	tlsConn, err := c.TLSFlags.GetTLSConnectionForTarget(conn, nil, dial)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if c.TLSLog == nil {
+		c.TLSLog = tlsConn.GetLog()
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// Do sends a request for path, with body unless it is nil, and with header,
+// whose values replace those sent by default. It serves the APIs which do
+// not speak JSON, such as the SOAP API of WinRM.
+func (c *Client) Do(ctx context.Context, method string, path string, header http.Header, body []byte) (*Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.url(path), reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	for name, values := range header {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	req.Close = true
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return nil, zgrab2.NewScanError(zgrab2.SCAN_PROTOCOL_ERROR, err)
+	}
+	defer resp.Body.Close()
+	max := c.MaxSize
+	if max <= 0 {
+		max = DefaultMaxSize
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(max)+1))
+	ret := &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: data}
+	if len(data) > max {
+		ret.Body = data[:max]
+		ret.Truncated = true
+	}
+	return ret, err
+}
+
+// decode decodes the body of a successful response into v.
+func decode(path string, resp *Response, err error, v interface{}) (*Response, error) {
+	if err != nil || !resp.OK() {
+		return resp, err
+	}
+	if err := json.Unmarshal(resp.Body, v); err != nil {
+		return resp, fmt.Errorf("invalid JSON response to %s: %s", path, err)
+	}
+	return resp, nil
+}
+
+// Get sends a GET request for path, which may include a query.
+func (c *Client) Get(ctx context.Context, path string) (*Response, error) {
+	return c.Do(ctx, "GET", path, nil, nil)
+}
+
+// GetJSON sends a GET request for path, and if the response is successful,
+// decodes its body into v. The response is returned even if it cannot be
+// decoded.
+func (c *Client) GetJSON(ctx context.Context, path string, v interface{}) (*Response, error) {
+	resp, err := c.Get(ctx, path)
+	return decode(path, resp, err, v)
+}
+
+// Post sends a POST request for path, with a JSON body.
+func (c *Client) Post(ctx context.Context, path string, body []byte) (*Response, error) {
+	return c.Do(ctx, "POST", path, nil, body)
+}
+
+// PostJSON sends a POST request for path with in encoded as JSON, and if the
+// response is successful, decodes its body into out, as GetJSON does.
+func (c *Client) PostJSON(ctx context.Context, path string, in interface{}, out interface{}) (*Response, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Post(ctx, path, body)
+	return decode(path, resp, err, out)
+}
+
+// ClientCertificateRequired returns true if err is the failure of a TLS
+// handshake in which the server required a client certificate.
+func ClientCertificateRequired(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "bad certificate") || strings.Contains(msg, "certificate required")
+}
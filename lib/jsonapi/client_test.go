@@ -0,0 +1,136 @@
+package jsonapi
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+)
+
+func newClient(t *testing.T, server *httptest.Server) *Client {
+	return &Client{
+		Target:    &zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1")},
+		BaseFlags: &zgrab2.BaseFlags{Port: zgrab2test.Port(t, server.Listener.Addr().String()), Timeout: zgrab2test.Timeout},
+		UserAgent: "test-agent",
+		Header:    http.Header{"Authorization": {"Bearer token"}},
+	}
+}
+
+func TestGetJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" || r.URL.RawQuery != "pretty" || r.UserAgent() != "test-agent" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"version": "1.2.3"}`))
+	}))
+	defer server.Close()
+	var v struct {
+		Version string `json:"version"`
+	}
+	resp, err := newClient(t, server).GetJSON(context.Background(), "/version?pretty", &v)
+	if err != nil || resp.StatusCode != http.StatusOK || v.Version != "1.2.3" {
+		t.Errorf("got %+v, %+v, error %v", resp, v, err)
+	}
+}
+
+func TestPostJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" || string(body) != `{"key":"a"}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"count": "3"}`))
+	}))
+	defer server.Close()
+	var v struct {
+		Count string `json:"count"`
+	}
+	resp, err := newClient(t, server).PostJSON(context.Background(), "/range", map[string]string{"key": "a"}, &v)
+	if err != nil || resp.StatusCode != http.StatusOK || v.Count != "3" {
+		t.Errorf("got %+v, %+v, error %v", resp, v, err)
+	}
+}
+
+func TestDo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/soap+xml" || r.Header.Get("Wsmanidentify") != "unauthenticated" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("<ok/>"))
+	}))
+	defer server.Close()
+	header := http.Header{"Content-Type": {"application/soap+xml"}, "WSMANIDENTIFY": {"unauthenticated"}}
+	resp, err := newClient(t, server).Do(context.Background(), "POST", "/wsman", header, []byte("<Identify/>"))
+	if err != nil || resp.StatusCode != http.StatusOK || string(resp.Body) != "<ok/>" {
+		t.Errorf("got %+v, error %v", resp, err)
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("not json"))
+	}))
+	defer server.Close()
+	var v interface{}
+	resp, err := newClient(t, server).GetJSON(context.Background(), "/", &v)
+	if err != nil || !resp.AuthRequired() || v != nil {
+		t.Errorf("got %+v, error %v", resp, err)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 100))
+	}))
+	defer server.Close()
+	client := newClient(t, server)
+	client.MaxSize = 10
+	resp, err := client.Get(context.Background(), "/")
+	if err != nil || !resp.Truncated || len(resp.Body) != 10 {
+		t.Errorf("got %+v, error %v", resp, err)
+	}
+}
+
+func TestTLSResumption(t *testing.T) {
+	var conns int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+	client := newClient(t, server)
+	client.UseTLS = true
+	client.TLSFlags = &zgrab2.TLSFlags{Resumption: true}
+	var v struct{}
+	if _, err := client.GetJSON(context.Background(), "/", &v); err != nil {
+		t.Fatal(err)
+	}
+	if client.TLSLog == nil || client.TLSLog.Resumption == nil {
+		t.Fatalf("got TLS log %+v", client.TLSLog)
+	}
+	// Only the first connection tries to resume the session.
+	before := atomic.LoadInt32(&conns)
+	if _, err := client.GetJSON(context.Background(), "/", &v); err != nil {
+		t.Fatal(err)
+	}
+	if after := atomic.LoadInt32(&conns); after != before+1 {
+		t.Errorf("got %d connections for the second request", after-before)
+	}
+}
@@ -0,0 +1,113 @@
+package kerberos
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// CCacheCredential is a ticket of a credential cache, with its session key.
+type CCacheCredential struct {
+	Client      PrincipalName
+	ClientRealm string
+	Server      PrincipalName
+	ServerRealm string
+	Key         EncryptionKey
+	EndTime     time.Time
+
+	// Ticket is the encoded Ticket.
+	Ticket []byte
+}
+
+// CCache is a credential cache, as written by kinit.
+type CCache struct {
+	// Principal and Realm are those of the default client principal.
+	Principal   PrincipalName
+	Realm       string
+	Credentials []CCacheCredential
+}
+
+// ReadCCache reads the credential cache file at path. A FILE: prefix, as in
+// KRB5CCNAME, is ignored.
+func ReadCCache(path string) (*CCache, error) {
+	data, err := ioutil.ReadFile(strings.TrimPrefix(path, "FILE:"))
+	if err != nil {
+		return nil, err
+	}
+	return ParseCCache(data)
+}
+
+// ParseCCache parses a credential cache in the file format of MIT Kerberos
+// (versions 0x503 and 0x504).
+func ParseCCache(data []byte) (*CCache, error) {
+	r := &reader{b: data}
+	version := r.uint16()
+	switch version {
+	case 0x504:
+		// The header's tags, such as the KDC time offset, are skipped.
+		r.next(int(r.uint16()))
+	case 0x503:
+	default:
+		return nil, errors.New("kerberos: unsupported credential cache version")
+	}
+	cc := new(CCache)
+	cc.Principal, cc.Realm = r.principal()
+	for len(r.b) > 0 && r.err == nil {
+		var c CCacheCredential
+		c.Client, c.ClientRealm = r.principal()
+		c.Server, c.ServerRealm = r.principal()
+		c.Key.Type = int32(r.uint16())
+		if version == 0x503 {
+			r.uint16()
+		}
+		c.Key.Value = r.next(int(r.uint32()))
+		r.uint32() // authtime
+		r.uint32() // starttime
+		c.EndTime = time.Unix(int64(r.uint32()), 0)
+		r.uint32() // renew-till
+		r.uint8()  // is_skey
+		r.uint32() // ticket flags
+		for n := r.uint32(); n > 0 && r.err == nil; n-- {
+			r.uint16()
+			r.next(int(r.uint32()))
+		}
+		for n := r.uint32(); n > 0 && r.err == nil; n-- {
+			r.uint16()
+			r.next(int(r.uint32()))
+		}
+		c.Ticket = r.next(int(r.uint32()))
+		r.next(int(r.uint32())) // second ticket
+		// Configuration entries, such as the realm of the KDC that issued
+		// the tickets, are not tickets.
+		if r.err == nil && c.ServerRealm != "X-CACHECONF:" {
+			cc.Credentials = append(cc.Credentials, c)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return cc, nil
+}
+
+// principal reads a principal of a credential cache.
+func (r *reader) principal() (PrincipalName, string) {
+	p := PrincipalName{Type: int32(r.uint32())}
+	n := int(r.uint32())
+	realm := string(r.next(int(r.uint32())))
+	for i := 0; i < n && r.err == nil; i++ {
+		p.Components = append(p.Components, string(r.next(int(r.uint32()))))
+	}
+	return p, realm
+}
+
+// find returns the valid ticket for the server principal, if any.
+func (cc *CCache) find(server string, now time.Time) *CCacheCredential {
+	for i := range cc.Credentials {
+		c := &cc.Credentials[i]
+		if strings.EqualFold(principalString(c.Server, c.ServerRealm), server) && now.Before(c.EndTime) {
+			return c
+		}
+	}
+	return nil
+}
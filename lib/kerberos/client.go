@@ -0,0 +1,360 @@
+// Package kerberos implements the client side of Kerberos 5 (RFC 4120) as
+// needed to authenticate to services, such as HTTP servers with the
+// Negotiate scheme: tickets are obtained from a KDC with the keys of a
+// keytab, or taken from the credential cache of kinit, and presented in the
+// initial token of the Kerberos GSS-API mechanism (RFC 4121).
+//
+// Only the AES and RC4-HMAC encryption types are supported, and only
+// services of the realm of the client.
+package kerberos
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zmap/zgrab2/lib/ber"
+)
+
+// OID is the object identifier of the Kerberos GSS-API mechanism.
+var OID = []uint32{1, 2, 840, 113554, 1, 2, 2}
+
+// maxReplySize bounds the size of the replies of the KDC.
+const maxReplySize = 1 << 20
+
+// clockSkew is the margin by which tickets are renewed before they expire.
+const clockSkew = time.Minute
+
+// credential is a ticket with its session key.
+type credential struct {
+	ticket  []byte
+	key     EncryptionKey
+	endTime time.Time
+}
+
+// valid returns whether the ticket can still be used at now.
+func (c *credential) valid(now time.Time) bool {
+	return now.Add(clockSkew).Before(c.endTime)
+}
+
+// Client obtains service tickets for a principal. It is safe for concurrent
+// use, and requests a ticket-granting ticket only once for all of them, and
+// each service ticket once until it expires.
+type Client struct {
+	principal PrincipalName
+	realm     string
+	kdc       string
+	timeout   time.Duration
+
+	// keys are the long-term keys of the principal by encryption type, if
+	// the client was created from a keytab.
+	keys map[int32]EncryptionKey
+
+	// ccache is the credential cache, if the client was created from one.
+	ccache *CCache
+
+	mu  sync.Mutex
+	tgt *credential
+
+	// tickets are the service tickets obtained from the KDC, by service
+	// principal.
+	ticketsMu sync.Mutex
+	tickets   map[string]*credential
+}
+
+// NewKeytabClient returns a Client authenticating as principal
+// (name@REALM) with its keys in kt, or as the principal of the first entry
+// of kt if principal is empty. kdc is the address of the KDC, with port 88
+// by default; if empty, it is looked up in the SRV records of the realm.
+// timeout bounds each exchange with the KDC.
+func NewKeytabClient(kt *Keytab, principal, kdc string, timeout time.Duration) (*Client, error) {
+	c := &Client{timeout: timeout}
+	if principal == "" {
+		if len(kt.Entries) == 0 {
+			return nil, errors.New("kerberos: empty keytab")
+		}
+		c.principal, c.realm = kt.Entries[0].Principal, kt.Entries[0].Realm
+	} else {
+		var err error
+		if c.principal, c.realm, err = ParsePrincipal(principal); err != nil {
+			return nil, err
+		}
+	}
+	c.keys = make(map[int32]EncryptionKey)
+	for etype, key := range kt.keys(c.principal, c.realm) {
+		if keySize(etype) != 0 {
+			c.keys[etype] = key
+		}
+	}
+	if len(c.keys) == 0 {
+		return nil, fmt.Errorf("kerberos: no supported key for %s in the keytab", c.Principal())
+	}
+	c.kdc = kdcAddr(kdc, c.realm)
+	return c, nil
+}
+
+// NewCCacheClient returns a Client using the tickets of cc, for its default
+// principal. Service tickets missing from cc are requested with its
+// ticket-granting ticket. kdc and timeout are as with NewKeytabClient.
+func NewCCacheClient(cc *CCache, kdc string, timeout time.Duration) (*Client, error) {
+	if len(cc.Principal.Components) == 0 {
+		return nil, errors.New("kerberos: no default principal in the credential cache")
+	}
+	c := &Client{principal: cc.Principal, realm: cc.Realm, ccache: cc, timeout: timeout}
+	c.kdc = kdcAddr(kdc, c.realm)
+	return c, nil
+}
+
+// kdcAddr returns the address of the KDC of realm: kdc, with the default
+// port, if not empty, or else the first target of the SRV records of realm,
+// or else the realm itself.
+func kdcAddr(kdc, realm string) string {
+	if kdc != "" {
+		if _, _, err := net.SplitHostPort(kdc); err != nil {
+			kdc = net.JoinHostPort(kdc, "88")
+		}
+		return kdc
+	}
+	if _, addrs, err := net.LookupSRV("kerberos", "tcp", realm); err == nil && len(addrs) > 0 {
+		return net.JoinHostPort(strings.TrimSuffix(addrs[0].Target, "."), strconv.Itoa(int(addrs[0].Port)))
+	}
+	return net.JoinHostPort(strings.ToLower(realm), "88")
+}
+
+// Principal returns the client principal, with its realm.
+func (c *Client) Principal() string {
+	return principalString(c.principal, c.realm)
+}
+
+// GSSToken returns the initial context token of the Kerberos GSS-API
+// mechanism for the service principal service/host (e.g. HTTP/www.example.com)
+// in the realm of the client. The token requests no flags, and thus no
+// mutual authentication.
+func (c *Client) GSSToken(ctx context.Context, service, host string) ([]byte, error) {
+	cred, err := c.serviceTicket(ctx, PrincipalName{Type: nameTypeSrvInst, Components: []string{service, strings.ToLower(host)}})
+	if err != nil {
+		return nil, err
+	}
+	// The checksum holds the length of the channel bindings, which are
+	// left empty, the bindings themselves, and the flags (RFC 4121, section
+	// 4.1.1).
+	cksum := make([]byte, 24)
+	binary.LittleEndian.PutUint32(cksum, 16)
+	authenticator, err := encrypt(cred.key, usageAPReqAuthenticator,
+		encodeAuthenticator(c.realm, c.principal, gssChecksumType, cksum, time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	// The AP-REQ follows the mechanism OID and the token ID of the
+	// KRB_AP_REQ token.
+	apReq := encodeAPReq(cred.ticket, cred.key.Type, authenticator)
+	return ber.Encode(ber.ClassApplication|ber.Constructed, ber.EncodeOID(OID), []byte{0x01, 0x00}, apReq), nil
+}
+
+// serviceTicket returns a ticket for sname, from the credential cache, or
+// else from the tickets already obtained, or else from the KDC.
+func (c *Client) serviceTicket(ctx context.Context, sname PrincipalName) (*credential, error) {
+	spn := principalString(sname, c.realm)
+	now := time.Now()
+	if c.ccache != nil {
+		if cc := c.ccache.find(spn, now.Add(clockSkew)); cc != nil {
+			return &credential{ticket: cc.Ticket, key: cc.Key, endTime: cc.EndTime}, nil
+		}
+	}
+	c.ticketsMu.Lock()
+	cred := c.tickets[spn]
+	if cred != nil && !cred.valid(now) {
+		delete(c.tickets, spn)
+		cred = nil
+	}
+	c.ticketsMu.Unlock()
+	if cred != nil {
+		return cred, nil
+	}
+	tgt, err := c.ticketGrantingTicket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cred, err = c.tgsExchange(ctx, tgt, sname); err != nil {
+		return nil, err
+	}
+	c.ticketsMu.Lock()
+	if c.tickets == nil {
+		c.tickets = make(map[string]*credential)
+	}
+	c.tickets[spn] = cred
+	c.ticketsMu.Unlock()
+	return cred, nil
+}
+
+// ticketGrantingTicket returns the ticket-granting ticket, from the
+// credential cache or, with a keytab, from the KDC once it expired.
+func (c *Client) ticketGrantingTicket(ctx context.Context) (*credential, error) {
+	krbtgt := PrincipalName{Type: nameTypeSrvInst, Components: []string{"krbtgt", c.realm}}
+	now := time.Now()
+	if c.ccache != nil {
+		cc := c.ccache.find(principalString(krbtgt, c.realm), now.Add(clockSkew))
+		if cc == nil {
+			return nil, errors.New("kerberos: no valid ticket-granting ticket in the credential cache")
+		}
+		return &credential{ticket: cc.Ticket, key: cc.Key, endTime: cc.EndTime}, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tgt != nil && c.tgt.valid(now) {
+		return c.tgt, nil
+	}
+	tgt, err := c.asExchange(ctx, krbtgt)
+	if err != nil {
+		return nil, err
+	}
+	c.tgt = tgt
+	return tgt, nil
+}
+
+// asExchange requests a ticket-granting ticket with the keys of the keytab,
+// with the encrypted timestamp pre-authentication if the KDC requires it.
+func (c *Client) asExchange(ctx context.Context, krbtgt PrincipalName) (*credential, error) {
+	now := time.Now()
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	body := encodeKDCReqBody(&c.principal, c.realm, krbtgt, nonce, now)
+	rep, err := c.exchange(ctx, encodeKDCReq(msgASReq, nil, body))
+	if kerr, ok := err.(*Error); ok && kerr.Code == errPreauthRequired {
+		var padata []byte
+		if padata, err = c.preauthData(kerr, now); err != nil {
+			return nil, err
+		}
+		rep, err = c.exchange(ctx, encodeKDCReq(msgASReq, [][]byte{padata}, body))
+	}
+	if err != nil {
+		return nil, err
+	}
+	r, err := decodeKDCRep(rep, msgASRep)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := c.keys[r.encPart.etype]
+	if !ok {
+		return nil, errUnsupportedEType(r.encPart.etype)
+	}
+	return decryptKDCRep(r, key, usageASRepEncPart, nonce)
+}
+
+// preauthData returns the encrypted timestamp, with the key of the first
+// encryption type of the ETYPE-INFO2 of kerr found in the keytab.
+func (c *Client) preauthData(kerr *Error, now time.Time) ([]byte, error) {
+	infos, err := decodeETypeInfo2(kerr.data)
+	if err != nil {
+		return nil, err
+	}
+	etypes := supportedETypes
+	if len(infos) > 0 {
+		etypes = nil
+		for _, info := range infos {
+			etypes = append(etypes, info.etype)
+		}
+	}
+	for _, etype := range etypes {
+		if key, ok := c.keys[etype]; ok {
+			return encodeEncTimestamp(key, now)
+		}
+	}
+	return nil, errors.New("kerberos: no key in the keytab for the encryption types of the KDC")
+}
+
+// tgsExchange requests a ticket for sname with the ticket-granting ticket.
+func (c *Client) tgsExchange(ctx context.Context, tgt *credential, sname PrincipalName) (*credential, error) {
+	now := time.Now()
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	body := encodeKDCReqBody(nil, c.realm, sname, nonce, now)
+	cksumType, cksum, err := checksum(tgt.key, usageTGSReqAuthChecksum, body)
+	if err != nil {
+		return nil, err
+	}
+	authenticator, err := encrypt(tgt.key, usageTGSReqAuthenticator,
+		encodeAuthenticator(c.realm, c.principal, cksumType, cksum, now))
+	if err != nil {
+		return nil, err
+	}
+	padata := encodePAData(paTGSReq, encodeAPReq(tgt.ticket, tgt.key.Type, authenticator))
+	rep, err := c.exchange(ctx, encodeKDCReq(msgTGSReq, [][]byte{padata}, body))
+	if err != nil {
+		return nil, err
+	}
+	r, err := decodeKDCRep(rep, msgTGSRep)
+	if err != nil {
+		return nil, err
+	}
+	return decryptKDCRep(r, tgt.key, usageTGSRepEncPart, nonce)
+}
+
+// decryptKDCRep decrypts the encrypted part of a KDC reply, and returns the
+// ticket with its session key.
+func decryptKDCRep(r *kdcRep, key EncryptionKey, usage uint32, nonce int64) (*credential, error) {
+	plaintext, err := decrypt(key, usage, r.encPart.cipher)
+	if err != nil {
+		return nil, err
+	}
+	part, err := decodeEncKDCRepPart(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if part.nonce != nonce {
+		return nil, errors.New("kerberos: nonce mismatch in the reply of the KDC")
+	}
+	return &credential{ticket: r.ticket, key: part.key, endTime: part.endTime}, nil
+}
+
+// exchange sends a request to the KDC over TCP, and returns its reply, or
+// the KRB-ERROR it sent as an *Error.
+func (c *Client) exchange(ctx context.Context, req []byte) ([]byte, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.kdc)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if c.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	// Messages are prefixed with their length over TCP (RFC 4120, section
+	// 7.2.2).
+	msg := make([]byte, 4, 4+len(req))
+	binary.BigEndian.PutUint32(msg, uint32(len(req)))
+	if _, err := conn.Write(append(msg, req...)); err != nil {
+		return nil, err
+	}
+	var length [4]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n > maxReplySize {
+		return nil, fmt.Errorf("kerberos: reply of %d bytes from the KDC", n)
+	}
+	rep := make([]byte, n)
+	if _, err := io.ReadFull(conn, rep); err != nil {
+		return nil, err
+	}
+	if len(rep) > 0 && rep[0] == ber.ClassApplication|ber.Constructed|msgError {
+		kerr, err := decodeError(rep)
+		if err != nil {
+			return nil, err
+		}
+		return nil, kerr
+	}
+	return rep, nil
+}
@@ -0,0 +1,525 @@
+package kerberos
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zmap/zgrab2/lib/ber"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+const testRealm = "EXAMPLE.COM"
+
+var testService = PrincipalName{Type: nameTypeSrvInst, Components: []string{"HTTP", "www.example.com"}}
+
+func randomKey(t *testing.T) EncryptionKey {
+	key := EncryptionKey{Type: ETypeAES256CTSHMACSHA196, Value: make([]byte, 32)}
+	if _, err := rand.Read(key.Value); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// binaryWriter writes the big-endian fields of keytabs and credential
+// caches.
+type binaryWriter struct {
+	bytes.Buffer
+}
+
+func (w *binaryWriter) put(v interface{}) {
+	binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *binaryWriter) data16(b []byte) {
+	w.put(uint16(len(b)))
+	w.Write(b)
+}
+
+func (w *binaryWriter) data32(b []byte) {
+	w.put(uint32(len(b)))
+	w.Write(b)
+}
+
+// keytab returns a keytab with an old and a current key for alice, and a key
+// for bob.
+func keytab(t *testing.T, key EncryptionKey) []byte {
+	w := new(binaryWriter)
+	w.put(uint16(0x502))
+	for _, e := range []struct {
+		name string
+		kvno uint8
+		key  EncryptionKey
+	}{
+		{"alice", 1, randomKey(t)},
+		{"alice", 2, key},
+		{"bob", 1, randomKey(t)},
+	} {
+		entry := new(binaryWriter)
+		entry.put(uint16(1))
+		entry.data16([]byte(testRealm))
+		entry.data16([]byte(e.name))
+		entry.put(uint32(nameTypePrincipal))
+		entry.put(uint32(0))
+		entry.put(e.kvno)
+		entry.put(uint16(e.key.Type))
+		entry.data16(e.key.Value)
+		w.put(uint32(entry.Len()))
+		w.Write(entry.Bytes())
+		// A hole, as left by kadmin.
+		w.put(int32(-4))
+		w.put(uint32(0))
+	}
+	return w.Bytes()
+}
+
+// ccache returns a credential cache of version 0x504 with the given
+// credentials of alice.
+func ccache(creds map[string]*credential) []byte {
+	w := new(binaryWriter)
+	w.put(uint16(0x504))
+	// A header with the KDC time offset.
+	w.put(uint16(12))
+	w.put(uint16(1))
+	w.put(uint16(8))
+	w.put(uint64(0))
+	principal := func(realm string, components ...string) {
+		w.put(uint32(nameTypePrincipal))
+		w.put(uint32(len(components)))
+		w.data32([]byte(realm))
+		for _, c := range components {
+			w.data32([]byte(c))
+		}
+	}
+	principal(testRealm, "alice")
+	// A configuration entry, which is not a ticket.
+	principal(testRealm, "alice")
+	principal("X-CACHECONF:", "krb5_ccache_conf_data", "pa_type", "krbtgt/"+testRealm+"@"+testRealm)
+	w.put(uint16(0))
+	w.data32(nil)
+	w.Write(make([]byte, 21))
+	w.put(uint64(0))
+	w.data32([]byte("2"))
+	w.data32(nil)
+	for name, cred := range creds {
+		principal(testRealm, "alice")
+		realm := testRealm
+		p, _, _ := ParsePrincipal(name + "@" + realm)
+		principal(realm, p.Components...)
+		w.put(uint16(cred.key.Type))
+		w.data32(cred.key.Value)
+		now := uint32(time.Now().Unix())
+		w.put([]uint32{now, now, uint32(cred.endTime.Unix()), 0})
+		w.put(uint8(0))
+		w.put(uint32(0))
+		w.put(uint64(0)) // no addresses nor authorization data
+		w.data32(cred.ticket)
+		w.data32(nil)
+	}
+	return w.Bytes()
+}
+
+// kdc is a fake KDC for alice, with the given key, requiring
+// pre-authentication.
+type kdc struct {
+	userKey, tgsKey, serviceKey EncryptionKey
+
+	mu          sync.Mutex
+	asRequests  int
+	tgsRequests int
+}
+
+func newKDC(t *testing.T, userKey EncryptionKey) (*kdc, *testserver.Server) {
+	k := &kdc{userKey: userKey, tgsKey: randomKey(t), serviceKey: randomKey(t)}
+	server, err := testserver.New(testserver.Config{Handler: k.handle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, server
+}
+
+// requests returns the number of AS requests received so far.
+func (k *kdc) requests() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.asRequests
+}
+
+// serviceRequests returns the number of TGS requests received so far.
+func (k *kdc) serviceRequests() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.tgsRequests
+}
+
+func (k *kdc) handle(conn net.Conn) error {
+	var length [4]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return err
+	}
+	req := make([]byte, binary.BigEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return err
+	}
+	var rep []byte
+	var err error
+	switch req[0] {
+	case ber.ClassApplication | ber.Constructed | msgASReq:
+		rep, err = k.asReply(req)
+	case ber.ClassApplication | ber.Constructed | msgTGSReq:
+		rep, err = k.tgsReply(req)
+	default:
+		err = fmt.Errorf("unexpected request %x", req)
+	}
+	if err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint32(length[:], uint32(len(rep)))
+	_, err = conn.Write(append(length[:], rep...))
+	return err
+}
+
+// padata returns the value of the pre-authentication data of the given type
+// in the fields of a KDC request.
+func padata(f map[int]ber.Element, padataType int32) ([]byte, error) {
+	list, err := f[3].Children()
+	if err != nil {
+		return nil, err
+	}
+	for _, pa := range list {
+		pf, err := fields(pa)
+		if err != nil {
+			return nil, err
+		}
+		if t, err := decodeInt(pf, 1); err == nil && t == padataType {
+			return pf[2].Value, nil
+		}
+	}
+	return nil, nil
+}
+
+func (k *kdc) asReply(req []byte) ([]byte, error) {
+	k.mu.Lock()
+	k.asRequests++
+	k.mu.Unlock()
+	f, err := decodeApplication(req, msgASReq)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := padata(f, paEncTimestamp)
+	if err != nil {
+		return nil, err
+	}
+	if ts == nil {
+		// The ETYPE-INFO2 offers RC4-HMAC first, for which there is no key.
+		info := ber.Encode(ber.TagSequence,
+			ber.Encode(ber.TagSequence, explicit(0, ber.EncodeInt(ETypeRC4HMAC))),
+			ber.Encode(ber.TagSequence,
+				explicit(0, ber.EncodeInt(ETypeAES256CTSHMACSHA196)),
+				explicit(1, encodeString(testRealm+"alice"))))
+		return application(msgError,
+			explicit(0, ber.EncodeInt(5)),
+			explicit(1, ber.EncodeInt(msgError)),
+			explicit(4, encodeTime(time.Now())),
+			explicit(5, ber.EncodeInt(0)),
+			explicit(6, ber.EncodeInt(errPreauthRequired)),
+			explicit(9, encodeString(testRealm)),
+			explicit(10, encodePrincipal(PrincipalName{Type: nameTypeSrvInst, Components: []string{"krbtgt", testRealm}})),
+			explicit(12, ber.EncodeString(ber.Encode(ber.TagSequence, encodePAData(paETypeInfo2, info))))), nil
+	}
+	e, _, err := ber.Decode(ts)
+	if err != nil {
+		return nil, err
+	}
+	encTS, err := decodeEncryptedData(e)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decrypt(k.userKey, usageASReqTimestamp, encTS.cipher); err != nil {
+		return nil, fmt.Errorf("timestamp: %s", err)
+	}
+	return k.reply(f, msgASRep, tagEncASRepPart, k.tgsKey, k.userKey, usageASRepEncPart)
+}
+
+func (k *kdc) tgsReply(req []byte) ([]byte, error) {
+	k.mu.Lock()
+	k.tgsRequests++
+	k.mu.Unlock()
+	f, err := decodeApplication(req, msgTGSReq)
+	if err != nil {
+		return nil, err
+	}
+	apReq, err := padata(f, paTGSReq)
+	if err != nil {
+		return nil, err
+	}
+	sessionKey, authenticator, err := k.checkAPReq(apReq, k.tgsKey, usageTGSReqAuthenticator)
+	if err != nil {
+		return nil, err
+	}
+	af, err := fields(authenticator)
+	if err != nil {
+		return nil, err
+	}
+	cf, err := fields(af[3])
+	if err != nil {
+		return nil, err
+	}
+	body := ber.Encode(f[4].Tag, f[4].Value)
+	if _, want, _ := checksum(sessionKey, usageTGSReqAuthChecksum, body); !bytes.Equal(cf[1].Value, want) {
+		return nil, fmt.Errorf("wrong checksum of the request body")
+	}
+	return k.reply(f, msgTGSRep, tagEncTGSRepPart, k.serviceKey, sessionKey, usageTGSRepEncPart)
+}
+
+// reply returns a reply to the request of fields f, with a ticket encrypted
+// with serverKey, and the session key encrypted with replyKey.
+func (k *kdc) reply(f map[int]ber.Element, msgType, encPartTag int, serverKey, replyKey EncryptionKey, usage uint32) ([]byte, error) {
+	bf, err := fields(f[4])
+	if err != nil {
+		return nil, err
+	}
+	sessionKey := EncryptionKey{Type: ETypeAES128CTSHMACSHA196, Value: make([]byte, 16)}
+	rand.Read(sessionKey.Value)
+	encodedKey := ber.Encode(ber.TagSequence,
+		explicit(0, ber.EncodeInt(int64(sessionKey.Type))),
+		explicit(1, ber.EncodeString(sessionKey.Value)))
+	// The fake tickets only hold the session key.
+	ticketPart, err := encrypt(serverKey, 2, encodedKey)
+	if err != nil {
+		return nil, err
+	}
+	ticket := application(tagTicket,
+		explicit(0, ber.EncodeInt(5)),
+		explicit(1, encodeString(testRealm)),
+		explicit(2, ber.Encode(bf[3].Tag, bf[3].Value)),
+		explicit(3, encodeEncryptedData(serverKey.Type, ticketPart)))
+	encPart, err := encrypt(replyKey, usage, application(encPartTag,
+		explicit(0, encodedKey),
+		explicit(1, ber.Encode(ber.TagSequence)),
+		explicit(2, ber.Encode(bf[7].Tag, bf[7].Value)),
+		explicit(4, ber.Encode(tagBitString, []byte{0, 0, 0, 0, 0})),
+		explicit(5, encodeTime(time.Now())),
+		explicit(7, encodeTime(time.Now().Add(time.Hour))),
+		explicit(9, encodeString(testRealm)),
+		explicit(10, ber.Encode(bf[3].Tag, bf[3].Value))))
+	if err != nil {
+		return nil, err
+	}
+	return application(msgType,
+		explicit(0, ber.EncodeInt(5)),
+		explicit(1, ber.EncodeInt(int64(msgType))),
+		explicit(3, encodeString(testRealm)),
+		explicit(4, encodePrincipal(PrincipalName{Type: nameTypePrincipal, Components: []string{"alice"}})),
+		explicit(5, ticket),
+		explicit(6, encodeEncryptedData(replyKey.Type, encPart))), nil
+}
+
+// checkAPReq decrypts the ticket of an AP-REQ with serverKey, and its
+// authenticator with the session key of the ticket.
+func (k *kdc) checkAPReq(apReq []byte, serverKey EncryptionKey, usage uint32) (EncryptionKey, ber.Element, error) {
+	f, err := decodeApplication(apReq, msgAPReq)
+	if err != nil {
+		return EncryptionKey{}, ber.Element{}, err
+	}
+	tf, err := fields(f[3])
+	if err != nil {
+		return EncryptionKey{}, ber.Element{}, err
+	}
+	ticketPart, err := decodeEncryptedData(tf[3])
+	if err != nil {
+		return EncryptionKey{}, ber.Element{}, err
+	}
+	plaintext, err := decrypt(serverKey, 2, ticketPart.cipher)
+	if err != nil {
+		return EncryptionKey{}, ber.Element{}, fmt.Errorf("ticket: %s", err)
+	}
+	e, _, err := ber.Decode(plaintext)
+	if err != nil {
+		return EncryptionKey{}, ber.Element{}, err
+	}
+	kf, err := fields(e)
+	if err != nil {
+		return EncryptionKey{}, ber.Element{}, err
+	}
+	keyType, _ := decodeInt(kf, 0)
+	sessionKey := EncryptionKey{Type: keyType, Value: kf[1].Value}
+	encAuth, err := decodeEncryptedData(f[4])
+	if err != nil {
+		return EncryptionKey{}, ber.Element{}, err
+	}
+	plaintext, err = decrypt(sessionKey, usage, encAuth.cipher)
+	if err != nil {
+		return EncryptionKey{}, ber.Element{}, fmt.Errorf("authenticator: %s", err)
+	}
+	authenticator, _, err := ber.Decode(plaintext)
+	return sessionKey, authenticator, err
+}
+
+// checkToken checks that token is a GSS-API token with an AP-REQ for the
+// service, from alice.
+func (k *kdc) checkToken(t *testing.T, token []byte) {
+	t.Helper()
+	e, _, err := ber.Decode(token)
+	if err != nil || e.Tag != ber.ClassApplication|ber.Constructed {
+		t.Fatalf("invalid token %x (%v)", token, err)
+	}
+	oid, rest, err := ber.Decode(e.Value)
+	if err != nil || !bytes.Equal(ber.Encode(oid.Tag, oid.Value), ber.EncodeOID(OID)) || !bytes.HasPrefix(rest, []byte{0x01, 0x00}) {
+		t.Fatalf("invalid token %x (%v)", token, err)
+	}
+	_, authenticator, err := k.checkAPReq(rest[2:], k.serviceKey, usageAPReqAuthenticator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := fields(authenticator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cname, err := decodePrincipal(f[2]); err != nil || cname.String() != "alice" {
+		t.Errorf("got client %v (%v)", cname, err)
+	}
+	cf, err := fields(f[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cksumType, err := decodeInt(cf, 0); err != nil || cksumType != gssChecksumType || len(cf[1].Value) != 24 {
+		t.Errorf("got checksum type %#x, value %x", cksumType, cf[1].Value)
+	}
+}
+
+func TestKeytabClient(t *testing.T) {
+	userKey, err := StringToKey(ETypeAES256CTSHMACSHA196, "secret", testRealm+"alice", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, server := newKDC(t, userKey)
+	defer server.Close()
+	kt, err := ParseKeytab(keytab(t, userKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kt.Entries) != 3 || kt.Entries[1].KVNO != 2 {
+		t.Fatalf("got keytab %+v", kt)
+	}
+	// The principal of the first entry is the default, and the key of
+	// its latest version is used.
+	client, err := NewKeytabClient(kt, "", server.Addr(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.Principal(); got != "alice@"+testRealm {
+		t.Errorf("got principal %s", got)
+	}
+	for i := 0; i < 2; i++ {
+		token, err := client.GSSToken(context.Background(), "HTTP", "WWW.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		k.checkToken(t, token)
+	}
+	if err := server.Err(); err != nil {
+		t.Fatal(err)
+	}
+	// The ticket-granting ticket is requested once, after the
+	// pre-authentication error, and the service ticket once.
+	if n := k.requests(); n != 2 {
+		t.Errorf("got %d AS requests", n)
+	}
+	if n := k.serviceRequests(); n != 1 {
+		t.Errorf("got %d TGS requests", n)
+	}
+	if _, err := NewKeytabClient(kt, "carol@"+testRealm, server.Addr(), time.Second); err == nil {
+		t.Error("got a client for a principal missing from the keytab")
+	}
+}
+
+func TestPreauthFailed(t *testing.T) {
+	k, server := newKDC(t, randomKey(t))
+	defer server.Close()
+	kt, err := ParseKeytab(keytab(t, randomKey(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewKeytabClient(kt, "alice@"+testRealm, server.Addr(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GSSToken(context.Background(), "HTTP", "www.example.com"); err == nil {
+		t.Error("got a token with the wrong key")
+	}
+	if n := k.requests(); n != 2 {
+		t.Errorf("got %d AS requests", n)
+	}
+}
+
+func TestCCacheClient(t *testing.T) {
+	k, server := newKDC(t, randomKey(t))
+	defer server.Close()
+	tgt, err := k.reply(map[int]ber.Element{4: asBody(t)}, msgASRep, tagEncASRepPart, k.tgsKey, k.userKey, usageASRepEncPart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := decodeKDCRep(tgt, msgASRep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := decryptKDCRep(r, k.userKey, usageASRepEncPart, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc, err := ParseCCache(ccache(map[string]*credential{"krbtgt/" + testRealm: cred}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cc.Credentials) != 1 || cc.Principal.String() != "alice" || cc.Realm != testRealm {
+		t.Fatalf("got credential cache %+v", cc)
+	}
+	client, err := NewCCacheClient(cc, server.Addr(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := client.GSSToken(context.Background(), "HTTP", "www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.checkToken(t, token)
+	if err := server.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n := k.requests(); n != 0 {
+		t.Errorf("got %d AS requests", n)
+	}
+
+	// A cached service ticket is used without contacting the KDC.
+	cc, err = ParseCCache(ccache(map[string]*credential{testService.String(): cred}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err = NewCCacheClient(cc, "127.0.0.1:1", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GSSToken(context.Background(), "HTTP", "www.example.com"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// asBody returns the body of a request for a ticket-granting ticket with
+// nonce 1.
+func asBody(t *testing.T) ber.Element {
+	cname := PrincipalName{Type: nameTypePrincipal, Components: []string{"alice"}}
+	krbtgt := PrincipalName{Type: nameTypeSrvInst, Components: []string{"krbtgt", testRealm}}
+	e, _, err := ber.Decode(encodeKDCReqBody(&cname, testRealm, krbtgt, 1, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
@@ -0,0 +1,360 @@
+package kerberos
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4"
+)
+
+// Encryption types (RFC 3962, RFC 4757).
+const (
+	ETypeAES128CTSHMACSHA196 = 17
+	ETypeAES256CTSHMACSHA196 = 18
+	ETypeRC4HMAC             = 23
+)
+
+// Checksum types of the encryption types (RFC 3962, RFC 4757).
+const (
+	checksumHMACSHA196AES128 = 15
+	checksumHMACSHA196AES256 = 16
+	checksumHMACMD5          = -138
+)
+
+// supportedETypes are the encryption types offered to the KDC, in order of
+// preference.
+var supportedETypes = []int32{ETypeAES256CTSHMACSHA196, ETypeAES128CTSHMACSHA196, ETypeRC4HMAC}
+
+// Key usage numbers (RFC 4120, section 7.5.1).
+const (
+	usageASReqTimestamp      = 1
+	usageASRepEncPart        = 3
+	usageTGSReqAuthChecksum  = 6
+	usageTGSReqAuthenticator = 7
+	usageTGSRepEncPart       = 8
+	usageAPReqAuthenticator  = 11
+)
+
+// ErrIntegrity is returned when the checksum of decrypted data is wrong, as
+// when it was encrypted with another key.
+var ErrIntegrity = errors.New("kerberos: integrity check failed")
+
+// EncryptionKey is a key of a given encryption type.
+type EncryptionKey struct {
+	Type  int32
+	Value []byte
+}
+
+// errUnsupportedEType returns the error for an unsupported encryption type.
+func errUnsupportedEType(etype int32) error {
+	return fmt.Errorf("kerberos: unsupported encryption type %d", etype)
+}
+
+// keySize returns the size of the keys of an encryption type, or 0 if it is
+// not supported.
+func keySize(etype int32) int {
+	switch etype {
+	case ETypeAES128CTSHMACSHA196, ETypeRC4HMAC:
+		return 16
+	case ETypeAES256CTSHMACSHA196:
+		return 32
+	}
+	return 0
+}
+
+// nfold stretches or folds in to n bytes (RFC 3961, section 5.1): the
+// least common multiple of the sizes is filled with copies of in, each
+// rotated 13 bits to the right of the previous one, and cut into n-byte
+// blocks that are added with ones' complement addition.
+func nfold(in []byte, n int) []byte {
+	inBits := len(in) * 8
+	lcm := len(in) * n / gcd(len(in), n)
+	buf := make([]byte, lcm)
+	for i := 0; i < lcm/len(in); i++ {
+		rot := 13 * i % inBits
+		for j := range in {
+			// Bit k of the copy is bit k-rot of in.
+			var b byte
+			for bit := 0; bit < 8; bit++ {
+				src := ((j*8+bit-rot)%inBits + inBits) % inBits
+				if in[src/8]&(0x80>>uint(src%8)) != 0 {
+					b |= 0x80 >> uint(bit)
+				}
+			}
+			buf[i*len(in)+j] = b
+		}
+	}
+	out := make([]byte, n)
+	for i := 0; i < lcm; i += n {
+		var carry int
+		for j := n - 1; j >= 0; j-- {
+			sum := int(out[j]) + int(buf[i+j]) + carry
+			out[j] = byte(sum)
+			carry = sum >> 8
+		}
+		// End-around carry.
+		for j := n - 1; carry != 0 && j >= 0; j-- {
+			sum := int(out[j]) + carry
+			out[j] = byte(sum)
+			carry = sum >> 8
+		}
+	}
+	return out
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// deriveKey returns DK(key, constant) for the AES encryption types (RFC
+// 3961, section 5.1): the constant, n-folded to the block size, is
+// encrypted repeatedly until there are enough bytes for a key.
+func deriveKey(key, constant []byte) []byte {
+	block, _ := aes.NewCipher(key)
+	in := nfold(constant, aes.BlockSize)
+	var out []byte
+	for len(out) < len(key) {
+		next := make([]byte, aes.BlockSize)
+		block.Encrypt(next, in)
+		out = append(out, next...)
+		in = next
+	}
+	return out[:len(key)]
+}
+
+// usageKey returns the key derived from key for a key usage, with the
+// suffix 0x99 (checksums), 0xAA (encryption) or 0x55 (integrity).
+func usageKey(key []byte, usage uint32, suffix byte) []byte {
+	constant := make([]byte, 5)
+	binary.BigEndian.PutUint32(constant, usage)
+	constant[4] = suffix
+	return deriveKey(key, constant)
+}
+
+// pbkdf2 returns PBKDF2 with HMAC-SHA1 (RFC 2898) of the given size.
+func pbkdf2(password, salt []byte, iterations, size int) []byte {
+	mac := hmac.New(sha1.New, password)
+	var ret []byte
+	for block := uint32(1); len(ret) < size; block++ {
+		mac.Reset()
+		mac.Write(salt)
+		binary.Write(mac, binary.BigEndian, block)
+		u := mac.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		ret = append(ret, t...)
+	}
+	return ret[:size]
+}
+
+// defaultIterations is the PBKDF2 iteration count of the AES string-to-key
+// function when the KDC gives no s2kparams.
+const defaultIterations = 4096
+
+// StringToKey derives the key of a password for an encryption type. For the
+// AES types, the salt is usually the realm followed by the components of the
+// principal name, unless the KDC gives another, and iterations is the
+// PBKDF2 iteration count (0 for the default). RC4-HMAC ignores both.
+func StringToKey(etype int32, password, salt string, iterations int) (EncryptionKey, error) {
+	switch etype {
+	case ETypeAES128CTSHMACSHA196, ETypeAES256CTSHMACSHA196:
+		if iterations == 0 {
+			iterations = defaultIterations
+		}
+		tkey := pbkdf2([]byte(password), []byte(salt), iterations, keySize(etype))
+		return EncryptionKey{Type: etype, Value: deriveKey(tkey, []byte("kerberos"))}, nil
+	case ETypeRC4HMAC:
+		h := md4.New()
+		for _, c := range utf16.Encode([]rune(password)) {
+			h.Write([]byte{byte(c), byte(c >> 8)})
+		}
+		return EncryptionKey{Type: etype, Value: h.Sum(nil)}, nil
+	}
+	return EncryptionKey{}, errUnsupportedEType(etype)
+}
+
+// ctsEncrypt encrypts in with AES in CBC mode with ciphertext stealing and a
+// zero IV (RFC 3962, section 5): the last two blocks are swapped, and the
+// last one truncated to the size of the last block of in.
+func ctsEncrypt(block cipher.Block, in []byte) []byte {
+	if len(in) <= aes.BlockSize {
+		out := make([]byte, aes.BlockSize)
+		copy(out, in)
+		block.Encrypt(out, out)
+		return out
+	}
+	n := (len(in) + aes.BlockSize - 1) / aes.BlockSize * aes.BlockSize
+	out := make([]byte, n)
+	copy(out, in)
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(out, out)
+	last := append([]byte{}, out[n-aes.BlockSize:]...)
+	copy(out[n-aes.BlockSize:], out[n-2*aes.BlockSize:n-aes.BlockSize])
+	copy(out[n-2*aes.BlockSize:], last)
+	return out[:len(in)]
+}
+
+// ctsDecrypt reverses ctsEncrypt.
+func ctsDecrypt(block cipher.Block, in []byte) ([]byte, error) {
+	if len(in) < aes.BlockSize {
+		return nil, ErrIntegrity
+	}
+	if len(in) == aes.BlockSize {
+		out := make([]byte, aes.BlockSize)
+		block.Decrypt(out, in)
+		return out, nil
+	}
+	// The blocks before the last two are plain CBC.
+	full := (len(in) - 1) / aes.BlockSize * aes.BlockSize
+	head := full - aes.BlockSize
+	out := make([]byte, len(in))
+	iv := make([]byte, aes.BlockSize)
+	if head > 0 {
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(out[:head], in[:head])
+		copy(iv, in[head-aes.BlockSize:head])
+	}
+	// in[head:full] is the encryption of the last (padded) block, and the
+	// rest the head of the one before it, whose tail was stolen.
+	tail := in[full:]
+	d := make([]byte, aes.BlockSize)
+	block.Decrypt(d, in[head:full])
+	prev := append(append([]byte{}, tail...), d[len(tail):]...)
+	for i := range tail {
+		out[full+i] = d[i] ^ tail[i]
+	}
+	block.Decrypt(out[head:full], prev)
+	for i := 0; i < aes.BlockSize; i++ {
+		out[head+i] ^= iv[i]
+	}
+	return out, nil
+}
+
+// rc4Usage maps a key usage to the message type of RC4-HMAC (RFC 4757,
+// section 3).
+func rc4Usage(usage uint32) []byte {
+	if usage == usageASRepEncPart {
+		usage = usageTGSRepEncPart
+	}
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, usage)
+	return b
+}
+
+func hmacSum(newHash func() hash.Hash, key []byte, data ...[]byte) []byte {
+	mac := hmac.New(newHash, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+// encrypt encrypts plaintext with key for a key usage, with a random
+// confounder.
+func encrypt(key EncryptionKey, usage uint32, plaintext []byte) ([]byte, error) {
+	switch key.Type {
+	case ETypeAES128CTSHMACSHA196, ETypeAES256CTSHMACSHA196:
+		data := make([]byte, aes.BlockSize, aes.BlockSize+len(plaintext))
+		if _, err := rand.Read(data); err != nil {
+			return nil, err
+		}
+		data = append(data, plaintext...)
+		block, err := aes.NewCipher(usageKey(key.Value, usage, 0xaa))
+		if err != nil {
+			return nil, err
+		}
+		mac := hmacSum(sha1.New, usageKey(key.Value, usage, 0x55), data)
+		return append(ctsEncrypt(block, data), mac[:12]...), nil
+	case ETypeRC4HMAC:
+		data := make([]byte, 8, 8+len(plaintext))
+		if _, err := rand.Read(data); err != nil {
+			return nil, err
+		}
+		data = append(data, plaintext...)
+		k1 := hmacSum(md5.New, key.Value, rc4Usage(usage))
+		sum := hmacSum(md5.New, k1, data)
+		c, err := rc4.NewCipher(hmacSum(md5.New, k1, sum))
+		if err != nil {
+			return nil, err
+		}
+		c.XORKeyStream(data, data)
+		return append(sum, data...), nil
+	}
+	return nil, errUnsupportedEType(key.Type)
+}
+
+// decrypt decrypts and checks ciphertext, encrypted with key for a key
+// usage, and returns the plaintext without the confounder.
+func decrypt(key EncryptionKey, usage uint32, ciphertext []byte) ([]byte, error) {
+	switch key.Type {
+	case ETypeAES128CTSHMACSHA196, ETypeAES256CTSHMACSHA196:
+		if len(ciphertext) < aes.BlockSize+12 {
+			return nil, ErrIntegrity
+		}
+		n := len(ciphertext) - 12
+		block, err := aes.NewCipher(usageKey(key.Value, usage, 0xaa))
+		if err != nil {
+			return nil, err
+		}
+		data, err := ctsDecrypt(block, ciphertext[:n])
+		if err != nil {
+			return nil, err
+		}
+		mac := hmacSum(sha1.New, usageKey(key.Value, usage, 0x55), data)
+		if !hmac.Equal(mac[:12], ciphertext[n:]) {
+			return nil, ErrIntegrity
+		}
+		return data[aes.BlockSize:], nil
+	case ETypeRC4HMAC:
+		if len(ciphertext) < 16+8 {
+			return nil, ErrIntegrity
+		}
+		sum := ciphertext[:16]
+		k1 := hmacSum(md5.New, key.Value, rc4Usage(usage))
+		c, err := rc4.NewCipher(hmacSum(md5.New, k1, sum))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, len(ciphertext)-16)
+		c.XORKeyStream(data, ciphertext[16:])
+		if !hmac.Equal(hmacSum(md5.New, k1, data), sum) {
+			return nil, ErrIntegrity
+		}
+		return data[8:], nil
+	}
+	return nil, errUnsupportedEType(key.Type)
+}
+
+// checksum returns the type and value of the keyed checksum of data with
+// key for a key usage (RFC 3962, section 6, and RFC 4757, section 4).
+func checksum(key EncryptionKey, usage uint32, data []byte) (int32, []byte, error) {
+	switch key.Type {
+	case ETypeAES128CTSHMACSHA196:
+		return checksumHMACSHA196AES128, hmacSum(sha1.New, usageKey(key.Value, usage, 0x99), data)[:12], nil
+	case ETypeAES256CTSHMACSHA196:
+		return checksumHMACSHA196AES256, hmacSum(sha1.New, usageKey(key.Value, usage, 0x99), data)[:12], nil
+	case ETypeRC4HMAC:
+		ksign := hmacSum(md5.New, key.Value, []byte("signaturekey\x00"))
+		tmp := md5.Sum(append(rc4Usage(usage), data...))
+		return checksumHMACMD5, hmacSum(md5.New, ksign, tmp[:]), nil
+	}
+	return 0, nil, errUnsupportedEType(key.Type)
+}
@@ -0,0 +1,106 @@
+package kerberos
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// The n-fold vectors of RFC 3961, appendix A.1.
+func TestNFold(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		bits int
+		want string
+	}{
+		{"012345", 64, "be072631276b1955"},
+		{"password", 56, "78a07b6caf85fa"},
+		{"Rough Consensus, and Running Code", 64, "bb6ed30870b7f0e0"},
+		{"password", 168, "59e4a8ca7c0385c3c37b3f6d2000247cb6e6bd5b3e"},
+		{"kerberos", 64, "6b65726265726f73"},
+		{"kerberos", 128, "6b65726265726f737b9b5b2b93132b93"},
+	} {
+		if got := hex.EncodeToString(nfold([]byte(test.in), test.bits/8)); got != test.want {
+			t.Errorf("%d-fold(%q) = %s, want %s", test.bits, test.in, got, test.want)
+		}
+	}
+}
+
+// The string-to-key vectors of RFC 3962, appendix B.
+func TestStringToKey(t *testing.T) {
+	for _, test := range []struct {
+		etype      int32
+		iterations int
+		want       string
+	}{
+		{ETypeAES128CTSHMACSHA196, 1, "42263c6e89f4fc28b8df68ee09799f15"},
+		{ETypeAES256CTSHMACSHA196, 1, "fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161"},
+		{ETypeAES128CTSHMACSHA196, 2, "c651bf29e2300ac27fa469d693bdda13"},
+		{ETypeAES128CTSHMACSHA196, 1200, "4c01cd46d632d01e6dbe230a01ed642a"},
+		{ETypeAES256CTSHMACSHA196, 1200, "55a6ac740ad17b4846941051e1e8b0a7548d93b0ab30a8bc3ff16280382b8c2a"},
+		// The NT hash of the password.
+		{ETypeRC4HMAC, 0, "8846f7eaee8fb117ad06bdd830b7586c"},
+	} {
+		key, err := StringToKey(test.etype, "password", "ATHENA.MIT.EDUraeburn", test.iterations)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(key.Value); got != test.want {
+			t.Errorf("etype %d, %d iterations: got key %s, want %s", test.etype, test.iterations, got, test.want)
+		}
+	}
+}
+
+// The AES-CTS vectors of RFC 3962, appendix B.
+func TestCTS(t *testing.T) {
+	block, err := aes.NewCipher([]byte("chicken teriyaki"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		in, want string
+	}{
+		{"I would like the ", "c6353568f2bf8cb4d8a580362da7ff7f97"},
+		{"I would like the General Gau's ", "fc00783e0efdb2c1d445d4c8eff7ed2297687268d6ecccc0c07b25e25ecfe5"},
+		{"I would like the General Gau's C", "39312523a78662d5be7fcbcc98ebf5a897687268d6ecccc0c07b25e25ecfe584"},
+		{"I would like the General Gau's Chicken, please, and wonton soup.", "97687268d6ecccc0c07b25e25ecfe58439312523a78662d5be7fcbcc98ebf5a84807efe836ee89a526730dbc2f7bc8409dad8bbb96c4cdc03bc103e1a194bbd8"},
+	} {
+		got := ctsEncrypt(block, []byte(test.in))
+		if hex.EncodeToString(got) != test.want {
+			t.Errorf("%q encrypts to %x, want %s", test.in, got, test.want)
+		}
+		if plain, err := ctsDecrypt(block, got); err != nil || string(plain) != test.in {
+			t.Errorf("%x decrypts to %q (%v)", got, plain, err)
+		}
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	for _, etype := range supportedETypes {
+		key, err := StringToKey(etype, "secret", "EXAMPLE.COMuser", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, plaintext := range [][]byte{{}, []byte("short"), bytes.Repeat([]byte("0123456789"), 10)} {
+			ciphertext, err := encrypt(key, usageAPReqAuthenticator, plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := decrypt(key, usageAPReqAuthenticator, ciphertext); err != nil || !bytes.Equal(got, plaintext) {
+				t.Errorf("etype %d: %q decrypts to %q (%v)", etype, plaintext, got, err)
+			}
+			if _, err := decrypt(key, usageTGSRepEncPart, ciphertext); err != ErrIntegrity {
+				t.Errorf("etype %d: decrypted with the wrong usage (%v)", etype, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package kerberos
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+// errTruncated is returned when a keytab or credential cache ends in the
+// middle of an entry.
+var errTruncated = errors.New("kerberos: truncated file")
+
+// KeytabEntry is a key of a keytab.
+type KeytabEntry struct {
+	Principal PrincipalName
+	Realm     string
+	KVNO      uint32
+	Key       EncryptionKey
+}
+
+// Keytab is a keytab file, holding the long-term keys of principals.
+type Keytab struct {
+	Entries []KeytabEntry
+}
+
+// ReadKeytab reads the keytab file at path.
+func ReadKeytab(path string) (*Keytab, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeytab(data)
+}
+
+// reader reads the big-endian fields of keytabs and credential caches.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.b) < n {
+		r.err = errTruncated
+		return nil
+	}
+	ret := r.b[:n]
+	r.b = r.b[n:]
+	return ret
+}
+
+func (r *reader) uint8() uint8 {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// ParseKeytab parses a keytab in the format of MIT Kerberos (version 0x502,
+// which is also the one of Heimdal, ktpass and Java's ktab).
+func ParseKeytab(data []byte) (*Keytab, error) {
+	r := &reader{b: data}
+	if r.uint16() != 0x502 {
+		return nil, errors.New("kerberos: unsupported keytab version")
+	}
+	kt := new(Keytab)
+	for len(r.b) > 0 && r.err == nil {
+		size := int32(r.uint32())
+		if size < 0 {
+			// A hole left by a deleted entry.
+			r.next(int(-size))
+			continue
+		}
+		e := &reader{b: r.next(int(size))}
+		var entry KeytabEntry
+		n := int(e.uint16())
+		entry.Realm = string(e.next(int(e.uint16())))
+		for i := 0; i < n; i++ {
+			entry.Principal.Components = append(entry.Principal.Components, string(e.next(int(e.uint16()))))
+		}
+		entry.Principal.Type = int32(e.uint32())
+		e.uint32() // timestamp
+		entry.KVNO = uint32(e.uint8())
+		entry.Key.Type = int32(e.uint16())
+		entry.Key.Value = e.next(int(e.uint16()))
+		if len(e.b) >= 4 {
+			// The 32-bit key version number, if present, supersedes the
+			// 8-bit one.
+			if kvno := e.uint32(); kvno != 0 {
+				entry.KVNO = kvno
+			}
+		}
+		if e.err != nil {
+			return nil, e.err
+		}
+		kt.Entries = append(kt.Entries, entry)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return kt, nil
+}
+
+// keys returns the keys of the latest version of a principal, by encryption
+// type.
+func (kt *Keytab) keys(principal PrincipalName, realm string) map[int32]EncryptionKey {
+	ret := make(map[int32]EncryptionKey)
+	kvnos := make(map[int32]uint32)
+	for _, entry := range kt.Entries {
+		if entry.Realm != realm || entry.Principal.String() != principal.String() {
+			continue
+		}
+		if kvno, ok := kvnos[entry.Key.Type]; ok && kvno > entry.KVNO {
+			continue
+		}
+		ret[entry.Key.Type] = entry.Key
+		kvnos[entry.Key.Type] = entry.KVNO
+	}
+	return ret
+}
+
+// principalString returns the principal with its realm.
+func principalString(p PrincipalName, realm string) string {
+	return strings.Join(p.Components, "/") + "@" + realm
+}
@@ -0,0 +1,492 @@
+package kerberos
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zmap/zgrab2/lib/ber"
+)
+
+// Message types (RFC 4120, section 5.10), which are also the application
+// tags of the messages.
+const (
+	msgASReq  = 10
+	msgASRep  = 11
+	msgTGSReq = 12
+	msgTGSRep = 13
+	msgAPReq  = 14
+	msgError  = 30
+)
+
+// Application tags of the other types.
+const (
+	tagTicket        = 1
+	tagAuthenticator = 2
+	tagEncASRepPart  = 25
+	tagEncTGSRepPart = 26
+)
+
+// Name types (RFC 4120, section 6.2).
+const (
+	nameTypePrincipal = 1
+	nameTypeSrvInst   = 2
+)
+
+// Pre-authentication data types (RFC 4120, section 7.5.2).
+const (
+	paTGSReq       = 1
+	paEncTimestamp = 2
+	paETypeInfo2   = 19
+)
+
+// Error codes (RFC 4120, section 7.5.9).
+const (
+	errPreauthRequired = 25
+)
+
+// Universal tags used by Kerberos, besides those of the ber package.
+const (
+	tagBitString       = 0x03
+	tagGeneralizedTime = 0x18
+	tagGeneralString   = 0x1b
+)
+
+// kdcOptions are the options of the ticket requests: forwardable, renewable
+// and canonicalize.
+var kdcOptions = []byte{0x40, 0x81, 0x00, 0x00}
+
+// gssChecksumType is the checksum type of the authenticators of the GSS-API
+// mechanism (RFC 4121, section 4.1.1).
+const gssChecksumType = 0x8003
+
+// Error is a KRB-ERROR message from a KDC.
+type Error struct {
+	Code int32
+	Text string
+
+	// data is the e-data of the error, if any.
+	data []byte
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	name := errorNames[e.Code]
+	if name == "" {
+		name = fmt.Sprintf("error %d", e.Code)
+	}
+	if e.Text != "" {
+		return fmt.Sprintf("kerberos: %s (%s)", name, e.Text)
+	}
+	return "kerberos: " + name
+}
+
+// errorNames are the names of the common error codes.
+var errorNames = map[int32]string{
+	6:  "KDC_ERR_C_PRINCIPAL_UNKNOWN",
+	7:  "KDC_ERR_S_PRINCIPAL_UNKNOWN",
+	14: "KDC_ERR_ETYPE_NOSUPP",
+	18: "KDC_ERR_CLIENT_REVOKED",
+	23: "KDC_ERR_KEY_EXPIRED",
+	24: "KDC_ERR_PREAUTH_FAILED",
+	25: "KDC_ERR_PREAUTH_REQUIRED",
+	31: "KRB_AP_ERR_BAD_INTEGRITY",
+	32: "KRB_AP_ERR_TKT_EXPIRED",
+	37: "KRB_AP_ERR_SKEW",
+	41: "KRB_AP_ERR_MODIFIED",
+	68: "KDC_ERR_WRONG_REALM",
+}
+
+// PrincipalName is the name of a principal, without its realm.
+type PrincipalName struct {
+	Type       int32
+	Components []string
+}
+
+// String returns the components separated by slashes.
+func (p PrincipalName) String() string {
+	return strings.Join(p.Components, "/")
+}
+
+// ParsePrincipal parses a principal name with its realm, e.g.
+// user@EXAMPLE.COM or HTTP/www.example.com@EXAMPLE.COM.
+func ParsePrincipal(s string) (PrincipalName, string, error) {
+	i := strings.LastIndexByte(s, '@')
+	if i <= 0 || i == len(s)-1 {
+		return PrincipalName{}, "", fmt.Errorf("kerberos: invalid principal %q, expected name@REALM", s)
+	}
+	components := strings.Split(s[:i], "/")
+	nameType := int32(nameTypePrincipal)
+	if len(components) > 1 {
+		nameType = nameTypeSrvInst
+	}
+	return PrincipalName{Type: nameType, Components: components}, s[i+1:], nil
+}
+
+// explicit returns the element with a context-specific tag wrapping the
+// given contents.
+func explicit(tag int, contents ...[]byte) []byte {
+	return ber.Encode(byte(ber.ClassContext|ber.Constructed|tag), contents...)
+}
+
+// application returns a sequence of the given fields with an application
+// tag.
+func application(tag int, fields ...[]byte) []byte {
+	return ber.Encode(byte(ber.ClassApplication|ber.Constructed|tag), ber.Encode(ber.TagSequence, fields...))
+}
+
+func encodeString(s string) []byte {
+	return ber.Encode(tagGeneralString, []byte(s))
+}
+
+func encodeTime(t time.Time) []byte {
+	return ber.Encode(tagGeneralizedTime, []byte(t.UTC().Format("20060102150405Z")))
+}
+
+func encodePrincipal(p PrincipalName) []byte {
+	var components [][]byte
+	for _, c := range p.Components {
+		components = append(components, encodeString(c))
+	}
+	return ber.Encode(ber.TagSequence,
+		explicit(0, ber.EncodeInt(int64(p.Type))),
+		explicit(1, ber.Encode(ber.TagSequence, components...)))
+}
+
+func encodeEncryptedData(etype int32, cipher []byte) []byte {
+	return ber.Encode(ber.TagSequence,
+		explicit(0, ber.EncodeInt(int64(etype))),
+		explicit(2, ber.EncodeString(cipher)))
+}
+
+func encodePAData(padataType int, value []byte) []byte {
+	return ber.Encode(ber.TagSequence,
+		explicit(1, ber.EncodeInt(int64(padataType))),
+		explicit(2, ber.EncodeString(value)))
+}
+
+// newNonce returns a random nonce.
+func newNonce() (int64, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint32(b[:]) & 0x7fffffff), nil
+}
+
+// encodeKDCReqBody returns the body of a ticket request for sname in realm,
+// with cname for the AS exchange.
+func encodeKDCReqBody(cname *PrincipalName, realm string, sname PrincipalName, nonce int64, now time.Time) []byte {
+	var etypes [][]byte
+	for _, etype := range supportedETypes {
+		etypes = append(etypes, ber.EncodeInt(int64(etype)))
+	}
+	fields := [][]byte{explicit(0, ber.Encode(tagBitString, append([]byte{0}, kdcOptions...)))}
+	if cname != nil {
+		fields = append(fields, explicit(1, encodePrincipal(*cname)))
+	}
+	fields = append(fields,
+		explicit(2, encodeString(realm)),
+		explicit(3, encodePrincipal(sname)),
+		explicit(5, encodeTime(now.Add(24*time.Hour))),
+		explicit(7, ber.EncodeInt(nonce)),
+		explicit(8, ber.Encode(ber.TagSequence, etypes...)))
+	return ber.Encode(ber.TagSequence, fields...)
+}
+
+// encodeKDCReq returns a KDC request (AS-REQ or TGS-REQ) with the given
+// pre-authentication data and body.
+func encodeKDCReq(msgType int, padata [][]byte, body []byte) []byte {
+	fields := [][]byte{
+		explicit(1, ber.EncodeInt(5)),
+		explicit(2, ber.EncodeInt(int64(msgType))),
+	}
+	if len(padata) > 0 {
+		fields = append(fields, explicit(3, ber.Encode(ber.TagSequence, padata...)))
+	}
+	fields = append(fields, explicit(4, body))
+	return application(msgType, fields...)
+}
+
+// encodeEncTimestamp returns the PA-ENC-TIMESTAMP pre-authentication data
+// proving the knowledge of key.
+func encodeEncTimestamp(key EncryptionKey, now time.Time) ([]byte, error) {
+	ts := ber.Encode(ber.TagSequence,
+		explicit(0, encodeTime(now)),
+		explicit(1, ber.EncodeInt(int64(now.Nanosecond()/1000))))
+	cipher, err := encrypt(key, usageASReqTimestamp, ts)
+	if err != nil {
+		return nil, err
+	}
+	return encodePAData(paEncTimestamp, encodeEncryptedData(key.Type, cipher)), nil
+}
+
+// encodeAuthenticator returns an authenticator of the client, with the
+// given checksum type and value.
+func encodeAuthenticator(realm string, cname PrincipalName, cksumType int32, cksum []byte, now time.Time) []byte {
+	fields := [][]byte{
+		explicit(0, ber.EncodeInt(5)),
+		explicit(1, encodeString(realm)),
+		explicit(2, encodePrincipal(cname)),
+	}
+	if cksum != nil {
+		fields = append(fields, explicit(3, ber.Encode(ber.TagSequence,
+			explicit(0, ber.EncodeInt(int64(cksumType))),
+			explicit(1, ber.EncodeString(cksum)))))
+	}
+	fields = append(fields,
+		explicit(4, ber.EncodeInt(int64(now.Nanosecond()/1000))),
+		explicit(5, encodeTime(now)))
+	return application(tagAuthenticator, fields...)
+}
+
+// encodeAPReq returns an AP-REQ presenting ticket (an encoded Ticket) with
+// the given encrypted authenticator.
+func encodeAPReq(ticket []byte, etype int32, authenticator []byte) []byte {
+	return application(msgAPReq,
+		explicit(0, ber.EncodeInt(5)),
+		explicit(1, ber.EncodeInt(msgAPReq)),
+		explicit(2, ber.Encode(tagBitString, []byte{0, 0, 0, 0, 0})),
+		explicit(3, ticket),
+		explicit(4, encodeEncryptedData(etype, authenticator)))
+}
+
+// fields decodes a sequence, possibly wrapped in an application tag, and
+// returns the elements of its context-specific tags by tag number.
+func fields(e ber.Element) (map[int]ber.Element, error) {
+	if e.Tag&ber.ClassApplication != 0 {
+		var err error
+		if e, _, err = ber.Decode(e.Value); err != nil {
+			return nil, err
+		}
+	}
+	if e.Tag != ber.TagSequence {
+		return nil, ber.ErrMalformed
+	}
+	children, err := e.Children()
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[int]ber.Element)
+	for _, child := range children {
+		if child.Tag&(ber.ClassContext|ber.Constructed) != ber.ClassContext|ber.Constructed {
+			return nil, ber.ErrMalformed
+		}
+		inner, _, err := ber.Decode(child.Value)
+		if err != nil {
+			return nil, err
+		}
+		ret[int(child.Tag&0x1f)] = inner
+	}
+	return ret, nil
+}
+
+// decodeApplication decodes a message with the given application tag, and
+// returns its fields.
+func decodeApplication(b []byte, tag int) (map[int]ber.Element, error) {
+	e, _, err := ber.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	if e.Tag != byte(ber.ClassApplication|ber.Constructed|tag) {
+		return nil, fmt.Errorf("kerberos: expected application tag %d, got %#x", tag, e.Tag)
+	}
+	return fields(e)
+}
+
+func decodeInt(f map[int]ber.Element, tag int) (int32, error) {
+	e, ok := f[tag]
+	if !ok || e.Tag != ber.TagInteger {
+		return 0, ber.ErrMalformed
+	}
+	v, err := e.Int()
+	return int32(v), err
+}
+
+func decodeTime(f map[int]ber.Element, tag int) (time.Time, error) {
+	e, ok := f[tag]
+	if !ok || e.Tag != tagGeneralizedTime {
+		return time.Time{}, ber.ErrMalformed
+	}
+	return time.Parse("20060102150405Z", string(e.Value))
+}
+
+func decodePrincipal(e ber.Element) (PrincipalName, error) {
+	f, err := fields(e)
+	if err != nil {
+		return PrincipalName{}, err
+	}
+	nameType, err := decodeInt(f, 0)
+	if err != nil {
+		return PrincipalName{}, err
+	}
+	components, err := f[1].Children()
+	if err != nil {
+		return PrincipalName{}, err
+	}
+	p := PrincipalName{Type: nameType}
+	for _, c := range components {
+		p.Components = append(p.Components, string(c.Value))
+	}
+	return p, nil
+}
+
+// encryptedData is a decoded EncryptedData.
+type encryptedData struct {
+	etype  int32
+	cipher []byte
+}
+
+func decodeEncryptedData(e ber.Element) (*encryptedData, error) {
+	f, err := fields(e)
+	if err != nil {
+		return nil, err
+	}
+	etype, err := decodeInt(f, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedData{etype: etype, cipher: f[2].Value}, nil
+}
+
+// decodeError decodes a KRB-ERROR.
+func decodeError(b []byte) (*Error, error) {
+	f, err := decodeApplication(b, msgError)
+	if err != nil {
+		return nil, err
+	}
+	code, err := decodeInt(f, 6)
+	if err != nil {
+		return nil, err
+	}
+	return &Error{Code: code, Text: string(f[11].Value), data: f[12].Value}, nil
+}
+
+// etypeInfo is an entry of ETYPE-INFO2: the salt and string-to-key
+// parameters of the key of an encryption type.
+type etypeInfo struct {
+	etype      int32
+	salt       string
+	iterations int
+	hasSalt    bool
+}
+
+// decodeETypeInfo2 returns the ETYPE-INFO2 in the METHOD-DATA of a
+// KDC_ERR_PREAUTH_REQUIRED error, in the KDC's order of preference.
+func decodeETypeInfo2(methodData []byte) ([]etypeInfo, error) {
+	e, _, err := ber.Decode(methodData)
+	if err != nil {
+		return nil, err
+	}
+	padata, err := e.Children()
+	if err != nil {
+		return nil, err
+	}
+	var ret []etypeInfo
+	for _, pa := range padata {
+		f, err := fields(pa)
+		if err != nil {
+			return nil, err
+		}
+		if t, err := decodeInt(f, 1); err != nil || t != paETypeInfo2 {
+			continue
+		}
+		info, _, err := ber.Decode(f[2].Value)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := info.Children()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			f, err := fields(entry)
+			if err != nil {
+				return nil, err
+			}
+			etype, err := decodeInt(f, 0)
+			if err != nil {
+				return nil, err
+			}
+			i := etypeInfo{etype: etype}
+			if salt, ok := f[1]; ok {
+				i.salt, i.hasSalt = string(salt.Value), true
+			}
+			if params, ok := f[2]; ok && len(params.Value) == 4 {
+				i.iterations = int(binary.BigEndian.Uint32(params.Value))
+			}
+			ret = append(ret, i)
+		}
+	}
+	return ret, nil
+}
+
+// kdcRep is a decoded AS-REP or TGS-REP.
+type kdcRep struct {
+	// ticket is the encoded Ticket.
+	ticket  []byte
+	encPart *encryptedData
+}
+
+// decodeKDCRep decodes a reply of the given type.
+func decodeKDCRep(b []byte, msgType int) (*kdcRep, error) {
+	f, err := decodeApplication(b, msgType)
+	if err != nil {
+		return nil, err
+	}
+	ticket, ok := f[5]
+	if !ok {
+		return nil, ber.ErrMalformed
+	}
+	encPart, err := decodeEncryptedData(f[6])
+	if err != nil {
+		return nil, err
+	}
+	return &kdcRep{ticket: ber.Encode(ticket.Tag, ticket.Value), encPart: encPart}, nil
+}
+
+// encKDCRepPart is the decrypted part of a KDC reply.
+type encKDCRepPart struct {
+	key     EncryptionKey
+	nonce   int64
+	endTime time.Time
+}
+
+// decodeEncKDCRepPart decodes the decrypted part of a KDC reply. Some KDCs
+// use the tag of EncTGSRepPart in AS replies too.
+func decodeEncKDCRepPart(b []byte) (*encKDCRepPart, error) {
+	e, _, err := ber.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	if e.Tag != ber.ClassApplication|ber.Constructed|tagEncASRepPart && e.Tag != ber.ClassApplication|ber.Constructed|tagEncTGSRepPart {
+		return nil, ber.ErrMalformed
+	}
+	f, err := fields(e)
+	if err != nil {
+		return nil, err
+	}
+	kf, err := fields(f[0])
+	if err != nil {
+		return nil, err
+	}
+	keyType, err := decodeInt(kf, 0)
+	if err != nil {
+		return nil, err
+	}
+	nonce, ok := f[2]
+	if !ok {
+		return nil, ber.ErrMalformed
+	}
+	n, err := nonce.Int()
+	if err != nil {
+		return nil, err
+	}
+	endTime, err := decodeTime(f, 7)
+	if err != nil {
+		return nil, err
+	}
+	return &encKDCRepPart{key: EncryptionKey{Type: keyType, Value: kf[1].Value}, nonce: n, endTime: endTime}, nil
+}
@@ -0,0 +1,173 @@
+// Package matcher tags HTTP responses with rules over their status code,
+// headers and body.
+//
+// A rules file is a JSON or YAML list of rules:
+//
+//	# Exchange 2016 servers of vulnerable builds
+//	- tag: "status: vulnerable-exchange"
+//	  status_codes: [200]
+//	  headers:
+//	    X-OWA-Version: "^15\\.1\\.(1[0-9]{3}|2[0-3][0-9]{2})\\."
+//	  body_contains: "/owa/auth/"
+//	  scan_status: application-error
+//	  stop: true
+//
+// All the conditions of a rule must hold for it to match. Patterns are regular
+// expressions, and an empty header pattern only requires the header to be
+// present.
+package matcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/textproto"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Rule attaches a tag to the responses matching its conditions.
+type Rule struct {
+	// Tag is added to the tags of the matching responses.
+	Tag string `json:"tag" yaml:"tag"`
+
+	// StatusCodes, if set, lists the status codes the response must have
+	// one of.
+	StatusCodes []int `json:"status_codes,omitempty" yaml:"status_codes,omitempty"`
+
+	// Headers maps header names to patterns that one of the values of the
+	// header must match.
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+
+	// Body is a pattern the body must match, and BodyContains a string it
+	// must contain.
+	Body         string `json:"body,omitempty" yaml:"body,omitempty"`
+	BodyContains string `json:"body_contains,omitempty" yaml:"body_contains,omitempty"`
+
+	// ScanStatus, if set, replaces the status of the scan when the rule
+	// matches (e.g. "application-error").
+	ScanStatus string `json:"scan_status,omitempty" yaml:"scan_status,omitempty"`
+
+	// Stop ends the scan once the rule matches, skipping the redirects and
+	// requests that would follow.
+	Stop bool `json:"stop,omitempty" yaml:"stop,omitempty"`
+
+	headers map[string]*regexp.Regexp
+	body    *regexp.Regexp
+}
+
+// Response holds the parts of an HTTP response that rules match.
+type Response struct {
+	StatusCode int
+	Headers    map[string][]string
+	Body       string
+}
+
+// Rules is a compiled list of rules.
+type Rules struct {
+	rules []*Rule
+}
+
+// Load reads the rules file at path, as YAML unless its extension is .json.
+func Load(path string) (*Rules, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*Rule
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &rules)
+	} else {
+		err = yaml.Unmarshal(data, &rules)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	ret, err := Compile(rules)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return ret, nil
+}
+
+// Compile compiles the patterns of rules.
+func Compile(rules []*Rule) (*Rules, error) {
+	for i, r := range rules {
+		if r.Tag == "" {
+			return nil, fmt.Errorf("rule %d has no tag", i+1)
+		}
+		r.headers = make(map[string]*regexp.Regexp, len(r.Headers))
+		for name, pattern := range r.Headers {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s: header %s: %s", r.Tag, name, err)
+			}
+			r.headers[textproto.CanonicalMIMEHeaderKey(name)] = re
+		}
+		if r.Body != "" {
+			re, err := regexp.Compile(r.Body)
+			if err != nil {
+				return nil, fmt.Errorf("%s: body: %s", r.Tag, err)
+			}
+			r.body = re
+		}
+	}
+	return &Rules{rules: rules}, nil
+}
+
+// List returns the rules, in order.
+func (rules *Rules) List() []*Rule {
+	return rules.rules
+}
+
+// matches returns true if resp meets all the conditions of r.
+func (r *Rule) matches(resp *Response, headers map[string][]string) bool {
+	if len(r.StatusCodes) > 0 {
+		found := false
+		for _, code := range r.StatusCodes {
+			found = found || code == resp.StatusCode
+		}
+		if !found {
+			return false
+		}
+	}
+	for name, re := range r.headers {
+		values, ok := headers[name]
+		if !ok {
+			return false
+		}
+		found := false
+		for _, v := range values {
+			found = found || re.MatchString(v)
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.BodyContains != "" && !strings.Contains(resp.Body, r.BodyContains) {
+		return false
+	}
+	if r.body != nil && !r.body.MatchString(resp.Body) {
+		return false
+	}
+	return true
+}
+
+// Match returns the rules that resp matches, in order.
+func (rules *Rules) Match(resp *Response) []*Rule {
+	headers := make(map[string][]string, len(resp.Headers))
+	for k, v := range resp.Headers {
+		k = textproto.CanonicalMIMEHeaderKey(k)
+		headers[k] = append(headers[k], v...)
+	}
+	var ret []*Rule
+	for _, r := range rules.rules {
+		if r.matches(resp, headers) {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,56 @@
+package matcher
+
+import (
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	rules, err := Compile([]*Rule{
+		{Tag: "exchange", Headers: map[string]string{"x-owa-version": `^15\.`}, BodyContains: "/owa/"},
+		{Tag: "not-found", StatusCodes: []int{404, 410}},
+		{Tag: "nginx", Headers: map[string]string{"Server": ""}, Body: `(?i)<center>nginx</center>`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := func(resp *Response) []string {
+		var ret []string
+		for _, r := range rules.Match(resp) {
+			ret = append(ret, r.Tag)
+		}
+		return ret
+	}
+	tests := []struct {
+		resp     *Response
+		expected []string
+	}{
+		{
+			resp:     &Response{StatusCode: 200, Headers: map[string][]string{"X-Owa-Version": {"15.1.2176.2"}}, Body: `<a href="/owa/auth/logon.aspx">`},
+			expected: []string{"exchange"},
+		},
+		{
+			resp: &Response{StatusCode: 200, Headers: map[string][]string{"X-Owa-Version": {"14.3.123.4"}}, Body: `<a href="/owa/auth/logon.aspx">`},
+		},
+		{
+			resp:     &Response{StatusCode: 404, Headers: map[string][]string{"server": {"cloudflare"}}, Body: "<CENTER>nginx</CENTER>"},
+			expected: []string{"not-found", "nginx"},
+		},
+		{
+			resp: &Response{StatusCode: 200, Body: "<center>nginx</center>"},
+		},
+	}
+	for i, test := range tests {
+		if got := tags(test.resp); len(got) != len(test.expected) || (len(got) > 0 && got[0] != test.expected[0]) || (len(got) > 1 && got[1] != test.expected[1]) {
+			t.Errorf("test %d: got tags %v; expected %v", i, got, test.expected)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	if _, err := Compile([]*Rule{{Tag: "bad", Body: "("}}); err == nil {
+		t.Errorf("Compile accepted an invalid pattern")
+	}
+	if _, err := Compile([]*Rule{{Body: "x"}}); err == nil {
+		t.Errorf("Compile accepted a rule without a tag")
+	}
+}
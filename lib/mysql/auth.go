@@ -0,0 +1,388 @@
+package mysql
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Authentication plugins: See https://dev.mysql.com/doc/dev/mysql-server/8.0.11/page_protocol_connection_phase_authentication_methods.html
+const (
+	AUTH_NATIVE_PASSWORD = "mysql_native_password"
+	AUTH_CACHING_SHA2    = "caching_sha2_password"
+	AUTH_SHA256_PASSWORD = "sha256_password"
+	AUTH_CLEAR_PASSWORD  = "mysql_clear_password"
+	DEFAULT_AUTH_PLUGIN  = AUTH_NATIVE_PASSWORD
+)
+
+// COM_QUERY is the command of a text query: See https://dev.mysql.com/doc/internals/en/com-query.html
+const COM_QUERY byte = 0x03
+
+// authClientCapabilities are the capabilities the client sends in the
+// HandshakeResponse41 packet (restricted to those of the server).
+const authClientCapabilities = CLIENT_LONG_PASSWORD | CLIENT_PROTOCOL_41 | CLIENT_TRANSACTIONS | CLIENT_SECURE_CONNECTION | CLIENT_PLUGIN_AUTH | CLIENT_PLUGIN_AUTH_LEN_ENC_CLIENT_DATA
+
+// Defaults of the HandshakeResponse41 packet, if unset in the Config:
+// utf8_general_ci and the maximum packet size of the protocol.
+const (
+	authDefaultCharSet       = 33
+	authDefaultMaxPacketSize = 0xffffff
+)
+
+// maxAuthRoundTrips bounds the number of packets exchanged during the
+// authentication.
+const maxAuthRoundTrips = 8
+
+var (
+	// ErrInsecureCleartext is returned when the server asks for the
+	// password in cleartext over an unencrypted connection.
+	ErrInsecureCleartext = errors.New("refusing to send a cleartext password without TLS")
+
+	// ErrUnsupportedPlugin is returned when the server asks for an
+	// unsupported authentication plugin.
+	ErrUnsupportedPlugin = errors.New("unsupported authentication plugin")
+)
+
+// rawPacket is a WritablePacket whose body is given as is.
+type rawPacket []byte
+
+// EncodeBody returns the body.
+func (p rawPacket) EncodeBody() []byte {
+	return p
+}
+
+// HandshakeResponsePacket is the client's response to the HandshakePacket,
+// with the credentials.
+// It is defined at https://dev.mysql.com/doc/internals/en/connection-phase-packets.html#packet-Protocol::HandshakeResponse41
+type HandshakeResponsePacket struct {
+	CapabilityFlags uint32
+	MaxPacketSize   uint32
+	CharacterSet    byte
+	Username        string
+	AuthResponse    []byte
+	AuthPluginName  string
+}
+
+// EncodeBody encodes the HandshakeResponsePacket for transport to the
+// server.
+func (p *HandshakeResponsePacket) EncodeBody() []byte {
+	var ret bytes.Buffer
+	var fixed [32]byte
+	binary.LittleEndian.PutUint32(fixed[0:], p.CapabilityFlags)
+	binary.LittleEndian.PutUint32(fixed[4:], p.MaxPacketSize)
+	fixed[8] = p.CharacterSet
+	ret.Write(fixed[:])
+	ret.WriteString(p.Username)
+	ret.WriteByte(0)
+	if p.CapabilityFlags&CLIENT_PLUGIN_AUTH_LEN_ENC_CLIENT_DATA != 0 {
+		ret.Write(encodeLenInt(uint64(len(p.AuthResponse))))
+	} else {
+		ret.WriteByte(byte(len(p.AuthResponse)))
+	}
+	ret.Write(p.AuthResponse)
+	if p.CapabilityFlags&CLIENT_PLUGIN_AUTH != 0 {
+		ret.WriteString(p.AuthPluginName)
+		ret.WriteByte(0)
+	}
+	return ret.Bytes()
+}
+
+// encodeLenInt encodes a LEN INT (see readLenInt).
+func encodeLenInt(v uint64) []byte {
+	switch {
+	case v < 0xfb:
+		return []byte{byte(v)}
+	case v <= 0xffff:
+		return []byte{0xfc, byte(v), byte(v >> 8)}
+	case v <= 0xffffff:
+		return []byte{0xfd, byte(v), byte(v >> 8), byte(v >> 16)}
+	}
+	ret := make([]byte, 9)
+	ret[0] = 0xfe
+	binary.LittleEndian.PutUint64(ret[1:], v)
+	return ret
+}
+
+// AuthLog is the outcome of an authentication attempt.
+type AuthLog struct {
+	// Plugin is the authentication plugin used last (the server may ask
+	// the client to switch from the plugin of the HandshakePacket).
+	Plugin string `json:"plugin,omitempty"`
+
+	// Success is true if the server accepted the credentials.
+	Success bool `json:"success"`
+
+	// Error is the ERRPacket returned by the server, if any.
+	Error *ERRPacket `json:"error,omitempty"`
+}
+
+// isSecure returns true if the connection was upgraded to TLS.
+func (c *Connection) isSecure() bool {
+	return c.ConnectionLog.SSLRequest != nil
+}
+
+// xorBytes returns a XOR b, repeating b as needed.
+func xorBytes(a, b []byte) []byte {
+	ret := make([]byte, len(a))
+	for i := range a {
+		ret[i] = a[i] ^ b[i%len(b)]
+	}
+	return ret
+}
+
+// scramblePassword computes the response of the plugin to the scramble
+// (nonce) sent by the server.
+func (c *Connection) scramblePassword(plugin string, password string, scramble []byte) ([]byte, error) {
+	switch plugin {
+	case AUTH_NATIVE_PASSWORD:
+		if password == "" {
+			return []byte{}, nil
+		}
+		// SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+		hash1 := sha1.Sum([]byte(password))
+		hash2 := sha1.Sum(hash1[:])
+		h := sha1.New()
+		h.Write(scramble)
+		h.Write(hash2[:])
+		return xorBytes(hash1[:], h.Sum(nil)), nil
+	case AUTH_CACHING_SHA2:
+		if password == "" {
+			return []byte{}, nil
+		}
+		// SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+		hash1 := sha256.Sum256([]byte(password))
+		hash2 := sha256.Sum256(hash1[:])
+		h := sha256.New()
+		h.Write(hash2[:])
+		h.Write(scramble)
+		return xorBytes(hash1[:], h.Sum(nil)), nil
+	case AUTH_SHA256_PASSWORD:
+		if password == "" {
+			return []byte{0}, nil
+		}
+		if c.isSecure() {
+			return append([]byte(password), 0), nil
+		}
+		// Request the server's public key.
+		return []byte{1}, nil
+	case AUTH_CLEAR_PASSWORD:
+		if !c.isSecure() {
+			return nil, ErrInsecureCleartext
+		}
+		return append([]byte(password), 0), nil
+	}
+	return nil, ErrUnsupportedPlugin
+}
+
+// encryptPassword encrypts the password (XORed with the scramble) with the
+// PEM-encoded RSA public key of the server.
+func encryptPassword(password string, scramble []byte, key []byte) ([]byte, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, fmt.Errorf("invalid server public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("server public key is not an RSA key")
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaKey, xorBytes(append([]byte(password), 0), scramble), nil)
+}
+
+// Authenticate sends the HandshakeResponse41 packet with the given
+// credentials, after Connect() (and NegotiateTLS() and the TLS handshake, if
+// applicable), and follows the server's authentication exchange until it
+// accepts or rejects them. It returns an error only if the exchange could
+// not be completed.
+func (c *Connection) Authenticate(username, password string) (*AuthLog, error) {
+	handshake := c.GetHandshake()
+	if handshake == nil {
+		return nil, fmt.Errorf("not connected")
+	}
+	scramble := append(append([]byte{}, handshake.AuthPluginData1...), handshake.AuthPluginData2...)
+	if len(scramble) > 20 {
+		scramble = scramble[:20]
+	}
+	ret := &AuthLog{Plugin: handshake.AuthPluginName}
+	switch ret.Plugin {
+	case AUTH_NATIVE_PASSWORD, AUTH_CACHING_SHA2, AUTH_SHA256_PASSWORD:
+	default:
+		ret.Plugin = DEFAULT_AUTH_PLUGIN
+	}
+	authResponse, err := c.scramblePassword(ret.Plugin, password, scramble)
+	if err != nil {
+		return ret, err
+	}
+	flags := authClientCapabilities & handshake.CapabilityFlags
+	if c.isSecure() {
+		flags |= CLIENT_SSL
+	}
+	response := HandshakeResponsePacket{
+		CapabilityFlags: flags,
+		MaxPacketSize:   c.Config.MaxPacketSize,
+		CharacterSet:    c.Config.CharSet,
+		Username:        username,
+		AuthResponse:    authResponse,
+		AuthPluginName:  ret.Plugin,
+	}
+	if response.MaxPacketSize == 0 {
+		response.MaxPacketSize = authDefaultMaxPacketSize
+	}
+	if response.CharacterSet == 0 {
+		response.CharacterSet = authDefaultCharSet
+	}
+	if _, err := c.sendPacket(&response); err != nil {
+		return ret, fmt.Errorf("Error sending HandshakeResponse packet: %s", err)
+	}
+	for i := 0; i < maxAuthRoundTrips; i++ {
+		_, body, err := c.readRawPacket()
+		if err != nil {
+			return ret, err
+		}
+		if len(body) == 0 {
+			return ret, fmt.Errorf("empty packet during authentication")
+		}
+		var toSend []byte
+		switch body[0] {
+		case 0x00:
+			ret.Success = true
+			c.State = STATE_FINISHED
+			return ret, nil
+		case 0xff:
+			errPacket, err := c.readERRPacket(body)
+			if err != nil {
+				return ret, err
+			}
+			ret.Error = errPacket
+			return ret, nil
+		case 0xfe:
+			// AuthSwitchRequest: the plugin name, then its scramble.
+			plugin, rest := readNulString(append(body[1:], 0))
+			ret.Plugin = plugin
+			scramble = bytes.TrimRight(rest, "\x00")
+			if toSend, err = c.scramblePassword(plugin, password, scramble); err != nil {
+				return ret, err
+			}
+		case 0x01:
+			// AuthMoreData
+			data := body[1:]
+			switch {
+			case bytes.HasPrefix(data, []byte("-----BEGIN")):
+				if toSend, err = encryptPassword(password, scramble, data); err != nil {
+					return ret, err
+				}
+			case ret.Plugin == AUTH_CACHING_SHA2 && len(data) == 1 && data[0] == 3:
+				// Fast authentication succeeded; the OK packet follows.
+				continue
+			case ret.Plugin == AUTH_CACHING_SHA2 && len(data) == 1 && data[0] == 4:
+				// Full authentication: send the password in cleartext over
+				// TLS, or request the server's public key.
+				if c.isSecure() {
+					toSend = append([]byte(password), 0)
+				} else {
+					toSend = []byte{2}
+				}
+			default:
+				return ret, fmt.Errorf("unexpected AuthMoreData packet %s", trunc(body, len(body)))
+			}
+		default:
+			return ret, fmt.Errorf("unexpected packet type 0x%02x during authentication", body[0])
+		}
+		if _, err := c.sendPacket(rawPacket(toSend)); err != nil {
+			return ret, err
+		}
+	}
+	return ret, fmt.Errorf("too many packets during authentication")
+}
+
+// isEOFPacket returns true if body is an EOF_Packet (as opposed to a row
+// starting with a long LEN INT).
+func isEOFPacket(body []byte) bool {
+	return len(body) > 0 && len(body) < 9 && body[0] == 0xfe
+}
+
+// Query sends a COM_QUERY with the given query, after a successful
+// Authenticate(), and returns (at most maxRows of) the rows of the result set,
+// with NULL values as empty strings.
+func (c *Connection) Query(query string, maxRows int) ([][]string, error) {
+	c.SequenceNumber = 0
+	if _, err := c.sendPacket(rawPacket(append([]byte{COM_QUERY}, query...))); err != nil {
+		return nil, err
+	}
+	_, body, err := c.readRawPacket()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(body) == 0:
+		return nil, fmt.Errorf("empty response to COM_QUERY")
+	case body[0] == 0xff:
+		errPacket, err := c.readERRPacket(body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errPacket
+	case body[0] == 0x00:
+		// An OK_Packet: the query returned no result set.
+		return nil, nil
+	}
+	columns, _, err := readLenInt(body)
+	if err != nil {
+		return nil, err
+	}
+	// Skip the column definitions, up to the EOF_Packet following them.
+	for {
+		_, body, err := c.readRawPacket()
+		if err != nil {
+			return nil, err
+		}
+		if isEOFPacket(body) {
+			break
+		}
+	}
+	var rows [][]string
+	for {
+		_, body, err := c.readRawPacket()
+		if err != nil {
+			return rows, err
+		}
+		if isEOFPacket(body) {
+			return rows, nil
+		}
+		if len(body) > 0 && body[0] == 0xff {
+			errPacket, err := c.readERRPacket(body)
+			if err != nil {
+				return rows, err
+			}
+			return rows, errPacket
+		}
+		if len(rows) >= maxRows {
+			// Drain the remaining rows.
+			continue
+		}
+		row := make([]string, 0, columns)
+		for rest := body; len(rest) > 0; {
+			if rest[0] == 0xfb {
+				row = append(row, "")
+				rest = rest[1:]
+				continue
+			}
+			var value string
+			if value, rest, err = readLenString(rest); err != nil {
+				return rows, err
+			}
+			row = append(row, value)
+		}
+		rows = append(rows, row)
+	}
+}
@@ -199,6 +199,11 @@ type Connection struct {
 
 	// ConnectionLog is a log of MySQL packets received/sent.
 	ConnectionLog ConnectionLog
+
+	// reader buffers the reads from Connection (it is replaced if
+	// Connection is, e.g. after the TLS handshake).
+	reader     *bufio.Reader
+	readerConn net.Conn
 }
 
 // NewConnection creates a new connection object with the given config
@@ -434,9 +439,12 @@ func (c *Connection) readOKPacket(body []byte) (*OKPacket, error) {
 			rest = rest[2:]
 		}
 	}
-	ret.Info, rest, err = readLenString(rest[:])
-	if err != nil {
-		return nil, fmt.Errorf("Error reading OKPacket.Info: %s", err)
+	// Info is absent from the OK_Packet of most servers.
+	if len(rest) > 0 {
+		ret.Info, rest, err = readLenString(rest[:])
+		if err != nil {
+			return nil, fmt.Errorf("Error reading OKPacket.Info: %s", err)
+		}
 	}
 	if len(rest) > 0 {
 		log.Debugf("readOKPacket: %d bytes left after Info, reading SessionStateChanges", len(rest))
@@ -644,15 +652,35 @@ func trunc(body []byte, n int) (result string) {
 
 // Read a packet and sequence identifier off of the given connection
 func (c *Connection) readPacket() (*ConnectionLogEntry, error) {
-	reader := bufio.NewReader(c.Connection)
+	packet, body, err := c.readRawPacket()
+	if err != nil {
+		return nil, err
+	}
+	ret, err := c.decodePacket(body)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding packet body (length = %d, sequence number = %d, body=%s): %s", packet.Length, packet.SequenceNumber, trunc(body, len(body)), err)
+	}
+	packet.Parsed = ret
+
+	return packet, nil
+}
+
+// readRawPacket reads a packet off of the connection without decoding it,
+// returning its log entry (without Parsed) and body.
+func (c *Connection) readRawPacket() (*ConnectionLogEntry, []byte, error) {
+	if c.reader == nil || c.readerConn != c.Connection {
+		c.reader = bufio.NewReader(c.Connection)
+		c.readerConn = c.Connection
+	}
+	reader := c.reader
 	var header [4]byte
 	n, err := io.ReadFull(reader, header[:])
 	if err != nil {
-		return nil, fmt.Errorf("error reading packet header: %s", err)
+		return nil, nil, fmt.Errorf("error reading packet header: %s", err)
 	}
 	if n != 4 {
 		// Note -- because of ReadFull, this should be unreachable
-		return nil, fmt.Errorf("wrong number of bytes returned (got %d, expected 4)", n)
+		return nil, nil, fmt.Errorf("wrong number of bytes returned (got %d, expected 4)", n)
 	}
 	seq := header[3]
 	// packetSize is actually uint24; clear the bogus MSB before decoding
@@ -672,7 +700,7 @@ func (c *Connection) readPacket() (*ConnectionLogEntry, error) {
 			// it looks like an ERRPacket: return SCAN_APPLICATION_ERROR
 			status = zgrab2.SCAN_APPLICATION_ERROR
 		}
-		return nil, zgrab2.NewScanError(status, err)
+		return nil, nil, zgrab2.NewScanError(status, err)
 	}
 	packet := ConnectionLogEntry{
 		Length:         packetSize,
@@ -682,7 +710,7 @@ func (c *Connection) readPacket() (*ConnectionLogEntry, error) {
 	var body = make([]byte, packetSize, packetSize)
 	n, err = io.ReadFull(reader, body)
 	if err != nil {
-		return nil, fmt.Errorf("error reading %d bytes (sequence number = %d, partial body=%s): %s", packetSize, c.SequenceNumber, trunc(body, n), err)
+		return nil, nil, fmt.Errorf("error reading %d bytes (sequence number = %d, partial body=%s): %s", packetSize, c.SequenceNumber, trunc(body, n), err)
 	}
 	// Log the raw body, even if the parsing fails
 	packet.Raw = base64.StdEncoding.EncodeToString(body)
@@ -692,13 +720,8 @@ func (c *Connection) readPacket() (*ConnectionLogEntry, error) {
 	}
 	// Update sequence number
 	c.SequenceNumber = seq + 1
-	ret, err := c.decodePacket(body)
-	if err != nil {
-		return nil, fmt.Errorf("error decoding packet body (length = %d, sequence number = %d, body=%s): %s", packetSize, seq, trunc(body, n), err)
-	}
-	packet.Parsed = ret
 
-	return &packet, nil
+	return &packet, body, nil
 }
 
 // GetHandshake attempts to get the Handshake packet from the
@@ -835,5 +858,5 @@ func readLenString(body []byte) (string, []byte, error) {
 	if uint64(len(rest)) < length {
 		return "", nil, fmt.Errorf("String length 0x%x longer than remaining body size 0x%x", length, len(rest))
 	}
-	return string(rest[:length]), rest[length+1:], nil
+	return string(rest[:length]), rest[length:], nil
 }
@@ -0,0 +1,183 @@
+// Package sasl implements the client side of the SASL mechanisms (RFC 4422)
+// with which the mail modules attempt to log in: PLAIN, LOGIN, CRAM-MD5 and
+// OAUTHBEARER, and of the SCRAM mechanisms of the database modules.
+package sasl
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// The names of the supported mechanisms, in the order they are attempted.
+const (
+	Plain       = "PLAIN"
+	Login       = "LOGIN"
+	CRAMMD5     = "CRAM-MD5"
+	OAuthBearer = "OAUTHBEARER"
+)
+
+// Mechanisms are the supported mechanisms, in the order they are attempted.
+var Mechanisms = []string{Plain, Login, CRAMMD5, OAuthBearer}
+
+// errUnexpectedChallenge is returned for a challenge sent once the exchange
+// is over.
+var errUnexpectedChallenge = errors.New("unexpected challenge")
+
+// A Client computes the responses of a mechanism to the server's challenges.
+type Client interface {
+	// Next returns the response to the (decoded) challenge. The initial
+	// response of the mechanisms sending one is the response to the first
+	// challenge, which is empty.
+	Next(challenge []byte) ([]byte, error)
+}
+
+// NewClient returns a Client of the mechanism with the given name, or nil if
+// it is not supported or does not apply to the credentials: OAUTHBEARER
+// authenticates with a bearer token, and the other mechanisms with a
+// username and password.
+func NewClient(mechanism, username, password, token string) Client {
+	mechanism = strings.ToUpper(mechanism)
+	if (mechanism == OAuthBearer) != (token != "") {
+		return nil
+	}
+	switch mechanism {
+	case Plain:
+		return &plainClient{username: username, password: password}
+	case Login:
+		return &loginClient{username: username, password: password}
+	case CRAMMD5:
+		return &cramMD5Client{username: username, password: password}
+	case OAuthBearer:
+		return &oauthBearerClient{username: username, token: token}
+	}
+	return nil
+}
+
+// plainClient implements PLAIN (RFC 4616).
+type plainClient struct {
+	username, password string
+	done               bool
+}
+
+func (c *plainClient) Next(challenge []byte) ([]byte, error) {
+	if c.done {
+		return nil, errUnexpectedChallenge
+	}
+	c.done = true
+	return []byte("\x00" + c.username + "\x00" + c.password), nil
+}
+
+// loginClient implements LOGIN (draft-murchison-sasl-login), answering the
+// username and password prompts in turn.
+type loginClient struct {
+	username, password string
+	step               int
+}
+
+func (c *loginClient) Next(challenge []byte) ([]byte, error) {
+	c.step++
+	switch {
+	case c.step == 1 && !strings.HasPrefix(strings.ToLower(string(challenge)), "pass"):
+		// Some servers send a "Username:" prompt, others an empty
+		// challenge.
+		return []byte(c.username), nil
+	case c.step <= 2:
+		c.step = 2
+		return []byte(c.password), nil
+	}
+	return nil, errUnexpectedChallenge
+}
+
+// cramMD5Client implements CRAM-MD5 (RFC 2195).
+type cramMD5Client struct {
+	username, password string
+	done               bool
+}
+
+func (c *cramMD5Client) Next(challenge []byte) ([]byte, error) {
+	if c.done || len(challenge) == 0 {
+		return nil, errUnexpectedChallenge
+	}
+	c.done = true
+	mac := hmac.New(md5.New, []byte(c.password))
+	mac.Write(challenge)
+	return []byte(c.username + " " + hex.EncodeToString(mac.Sum(nil))), nil
+}
+
+// oauthBearerClient implements OAUTHBEARER (RFC 7628).
+type oauthBearerClient struct {
+	username, token string
+	step            int
+}
+
+func (c *oauthBearerClient) Next(challenge []byte) ([]byte, error) {
+	c.step++
+	switch c.step {
+	case 1:
+		authzid := ""
+		if c.username != "" {
+			authzid = "a=" + c.username
+		}
+		return []byte("n," + authzid + ",\x01auth=Bearer " + c.token + "\x01\x01"), nil
+	case 2:
+		// The server sends an error status on failure, to which the
+		// client answers with a dummy response (section 3.2.3).
+		return []byte{1}, nil
+	}
+	return nil, errUnexpectedChallenge
+}
+
+// Attempt is the outcome of a login attempt of a scan.
+type Attempt struct {
+	Username string `json:"username,omitempty"`
+
+	// Command is the command sent, e.g. AUTHENTICATE or LOGIN for IMAP.
+	Command string `json:"command"`
+
+	// Mechanism is the SASL mechanism of the AUTHENTICATE (or AUTH)
+	// command, if any.
+	Mechanism string `json:"mechanism,omitempty"`
+
+	Success bool `json:"success"`
+
+	// Response is the final response of the server.
+	Response string `json:"response,omitempty"`
+}
+
+// Result is the outcome of the login attempts of a scan, which stop at the
+// first success.
+type Result struct {
+	// Advertised is the mechanisms advertised by the server.
+	Advertised []string `json:"advertised,omitempty"`
+
+	// Accepted is the mechanism (or the command, if it is not a SASL
+	// exchange) of the successful attempt, if any.
+	Accepted string `json:"accepted,omitempty"`
+
+	Attempts []Attempt `json:"attempts,omitempty"`
+}
+
+// Add records a. It returns a.Success.
+func (r *Result) Add(a Attempt) bool {
+	r.Attempts = append(r.Attempts, a)
+	if a.Success {
+		r.Accepted = a.Mechanism
+		if r.Accepted == "" {
+			r.Accepted = a.Command
+		}
+	}
+	return a.Success
+}
+
+// Advertises returns true if mechanism is among the mechanisms advertised.
+func (r *Result) Advertises(mechanism string) bool {
+	for _, m := range r.Advertised {
+		if strings.EqualFold(m, mechanism) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package sasl
+
+import (
+	"testing"
+)
+
+// exchange runs c through challenges, returning its responses.
+func exchange(t *testing.T, c Client, challenges ...string) []string {
+	var responses []string
+	for _, challenge := range challenges {
+		resp, err := c.Next([]byte(challenge))
+		if err != nil {
+			t.Fatalf("challenge %q: %v", challenge, err)
+		}
+		responses = append(responses, string(resp))
+	}
+	return responses
+}
+
+func TestClients(t *testing.T) {
+	tests := []struct {
+		mechanism, username, password, token string
+		challenges                           []string
+		responses                            []string
+	}{
+		{Plain, "tim", "secret", "", []string{""}, []string{"\x00tim\x00secret"}},
+		{Login, "tim", "secret", "", []string{"Username:", "Password:"}, []string{"tim", "secret"}},
+		{Login, "tim", "secret", "", []string{"", ""}, []string{"tim", "secret"}},
+		// RFC 2195, section 2.
+		{CRAMMD5, "tim", "tanstaaftanstaaf", "", []string{"<1896.697170952@postoffice.reston.mci.net>"}, []string{"tim b913a602c7eda7a495b4e6e7334d3890"}},
+		{"oauthbearer", "", "", "vF9dft4qmTc2Nvb3RlckBhbHRhdmlzdGEuY29tCg==", []string{"", `{"status":"invalid_token"}`}, []string{"n,,\x01auth=Bearer vF9dft4qmTc2Nvb3RlckBhbHRhdmlzdGEuY29tCg==\x01\x01", "\x01"}},
+	}
+	for _, test := range tests {
+		c := NewClient(test.mechanism, test.username, test.password, test.token)
+		if c == nil {
+			t.Errorf("no client for %s", test.mechanism)
+			continue
+		}
+		responses := exchange(t, c, test.challenges...)
+		for i := range responses {
+			if responses[i] != test.responses[i] {
+				t.Errorf("%s: got response %q, want %q", test.mechanism, responses[i], test.responses[i])
+			}
+		}
+		if _, err := c.Next([]byte("more")); err == nil {
+			t.Errorf("%s: no error for an unexpected challenge", test.mechanism)
+		}
+	}
+	if NewClient(OAuthBearer, "tim", "secret", "") != nil || NewClient(Plain, "", "", "token") != nil || NewClient("GSSAPI", "tim", "secret", "") != nil {
+		t.Errorf("got a client for inapplicable credentials")
+	}
+}
+
+func TestScram(t *testing.T) {
+	tests := []struct {
+		mechanism, nonce, serverFirst, clientFinal, serverFinal string
+	}{
+		// RFC 5802, section 5.
+		{ScramSHA1, "fyko+d2lbbFgONRv9qkxdawL", "r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096", "c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=", "v=rmF9pqV8S7suAoZWja4dJRkFsKQ="},
+		// RFC 7677, section 3.
+		{ScramSHA256, "rOprNGfwEbeRWgbNEkqO", "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096", "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="},
+	}
+	for _, test := range tests {
+		c := NewScramClient(test.mechanism, "user", "pencil").(*scramClient)
+		c.nonce = test.nonce
+		responses := exchange(t, c, "", test.serverFirst, test.serverFinal)
+		if responses[0] != "n,,n=user,r="+test.nonce || responses[1] != test.clientFinal || responses[2] != "" {
+			t.Errorf("%s: got responses %q", test.mechanism, responses)
+		}
+		c = NewScramClient(test.mechanism, "user", "wrong").(*scramClient)
+		c.nonce = test.nonce
+		exchange(t, c, "", test.serverFirst)
+		if _, err := c.Next([]byte(test.serverFinal)); err != errServerSignature {
+			t.Errorf("%s: got error %v for the signature of another password", test.mechanism, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package sasl
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// The names of the SCRAM mechanisms (RFC 5802, RFC 7677).
+const (
+	ScramSHA1   = "SCRAM-SHA-1"
+	ScramSHA256 = "SCRAM-SHA-256"
+)
+
+// errServerSignature is returned if the server's signature does not match
+// the password, i.e. it does not know it.
+var errServerSignature = errors.New("invalid server signature")
+
+// scramClient implements the SCRAM mechanisms, without channel binding.
+type scramClient struct {
+	newHash            func() hash.Hash
+	username, password string
+	nonce              string
+	step               int
+
+	// clientFirstBare and serverSignature are kept from one step to the
+	// next.
+	clientFirstBare string
+	serverSignature []byte
+}
+
+// NewScramClient returns a Client of the SCRAM mechanism with the given name
+// (ScramSHA1 or ScramSHA256), or nil if it is not supported. The password is
+// used as is, without SASLprep; some protocols (such as MongoDB with
+// SCRAM-SHA-1) first derive it from the user's password.
+func NewScramClient(mechanism, username, password string) Client {
+	var newHash func() hash.Hash
+	switch strings.ToUpper(mechanism) {
+	case ScramSHA1:
+		newHash = sha1.New
+	case ScramSHA256:
+		newHash = sha256.New
+	default:
+		return nil
+	}
+	var nonce [18]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil
+	}
+	return &scramClient{
+		newHash:  newHash,
+		username: username,
+		password: password,
+		nonce:    base64.StdEncoding.EncodeToString(nonce[:]),
+	}
+}
+
+func (c *scramClient) hmac(key []byte, s string) []byte {
+	mac := hmac.New(c.newHash, key)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+// saltPassword returns Hi(password, salt, iterations) (RFC 5802, section
+// 2.2), which is PBKDF2 with a single block.
+func (c *scramClient) saltPassword(salt []byte, iterations int) []byte {
+	mac := hmac.New(c.newHash, []byte(c.password))
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	ret := append([]byte{}, u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range ret {
+			ret[j] ^= u[j]
+		}
+	}
+	return ret
+}
+
+// parseAttributes parses a SCRAM message, e.g. "r=nonce,s=salt,i=4096".
+func parseAttributes(msg string) map[byte]string {
+	ret := make(map[byte]string)
+	for _, attr := range strings.Split(msg, ",") {
+		if len(attr) >= 2 && attr[1] == '=' {
+			ret[attr[0]] = attr[2:]
+		}
+	}
+	return ret
+}
+
+func (c *scramClient) Next(challenge []byte) ([]byte, error) {
+	c.step++
+	switch c.step {
+	case 1:
+		username := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(c.username)
+		c.clientFirstBare = "n=" + username + ",r=" + c.nonce
+		return []byte("n,," + c.clientFirstBare), nil
+	case 2:
+		serverFirst := string(challenge)
+		attrs := parseAttributes(serverFirst)
+		nonce := attrs['r']
+		if !strings.HasPrefix(nonce, c.nonce) || len(nonce) == len(c.nonce) {
+			return nil, fmt.Errorf("invalid server nonce %q", nonce)
+		}
+		salt, err := base64.StdEncoding.DecodeString(attrs['s'])
+		if err != nil {
+			return nil, fmt.Errorf("invalid salt: %s", err)
+		}
+		iterations, err := strconv.Atoi(attrs['i'])
+		if err != nil || iterations < 1 {
+			return nil, fmt.Errorf("invalid iteration count %q", attrs['i'])
+		}
+		salted := c.saltPassword(salt, iterations)
+		clientKey := c.hmac(salted, "Client Key")
+		h := c.newHash()
+		h.Write(clientKey)
+		storedKey := h.Sum(nil)
+		clientFinal := "c=biws,r=" + nonce
+		authMessage := c.clientFirstBare + "," + serverFirst + "," + clientFinal
+		proof := c.hmac(storedKey, authMessage)
+		for i := range proof {
+			proof[i] ^= clientKey[i]
+		}
+		c.serverSignature = c.hmac(c.hmac(salted, "Server Key"), authMessage)
+		return []byte(clientFinal + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+	case 3:
+		attrs := parseAttributes(string(challenge))
+		if e, ok := attrs['e']; ok {
+			return nil, fmt.Errorf("server error: %s", e)
+		}
+		signature, err := base64.StdEncoding.DecodeString(attrs['v'])
+		if err != nil || !bytes.Equal(signature, c.serverSignature) {
+			return nil, errServerSignature
+		}
+		return []byte{}, nil
+	}
+	return nil, errUnexpectedChallenge
+}
@@ -0,0 +1,58 @@
+package schema
+
+// BigQueryField is a column definition in a BigQuery table schema.
+type BigQueryField struct {
+	Name   string           `json:"name"`
+	Type   string           `json:"type"`
+	Mode   string           `json:"mode"`
+	Fields []*BigQueryField `json:"fields,omitempty"`
+}
+
+// BigQuery renders the fields of an object node as a BigQuery table schema.
+// Values without a fixed shape (maps, interfaces, and recursive references)
+// are represented as JSON-encoded strings.
+func (n *Node) BigQuery() []*BigQueryField {
+	var ret []*BigQueryField
+	for _, f := range n.Fields {
+		ret = append(ret, f.Node.bigQueryField(f.Name, "NULLABLE"))
+	}
+	return ret
+}
+
+func (n *Node) bigQueryField(name string, mode string) *BigQueryField {
+	ret := &BigQueryField{Name: name, Mode: mode}
+	switch n.Kind {
+	case KindBoolean:
+		ret.Type = "BOOLEAN"
+	case KindInteger:
+		ret.Type = "INTEGER"
+	case KindNumber:
+		ret.Type = "FLOAT"
+	case KindString:
+		switch n.Format {
+		case FormatBase64:
+			ret.Type = "BYTES"
+		case FormatDateTime:
+			ret.Type = "TIMESTAMP"
+		default:
+			ret.Type = "STRING"
+		}
+	case KindArray:
+		if n.Elem.Kind == KindArray {
+			// BigQuery has no nested arrays
+			ret.Type = "STRING"
+			break
+		}
+		ret = n.Elem.bigQueryField(name, "REPEATED")
+	case KindObject:
+		if n.Recursive || len(n.Fields) == 0 {
+			ret.Type = "STRING"
+			break
+		}
+		ret.Type = "RECORD"
+		ret.Fields = n.BigQuery()
+	default:
+		ret.Type = "STRING"
+	}
+	return ret
+}
@@ -0,0 +1,52 @@
+package schema
+
+// disabledMapping is the Elasticsearch mapping of a field whose contents are
+// kept in the document source but not indexed: values of any type, maps with
+// arbitrary keys, nested lists and recursive types.
+func disabledMapping() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "enabled": false}
+}
+
+// Elasticsearch returns the properties of an Elasticsearch (or OpenSearch)
+// mapping for the fields of an object node.
+func (n *Node) Elasticsearch() map[string]interface{} {
+	props := make(map[string]interface{}, len(n.Fields))
+	for _, f := range n.Fields {
+		props[f.Name] = f.Node.elasticsearchField()
+	}
+	return props
+}
+
+func (n *Node) elasticsearchField() map[string]interface{} {
+	switch n.Kind {
+	case KindBoolean:
+		return map[string]interface{}{"type": "boolean"}
+	case KindInteger:
+		return map[string]interface{}{"type": "long"}
+	case KindNumber:
+		return map[string]interface{}{"type": "double"}
+	case KindString:
+		switch n.Format {
+		case FormatBase64:
+			return map[string]interface{}{"type": "binary"}
+		case FormatDateTime:
+			return map[string]interface{}{"type": "date"}
+		case FormatIP:
+			return map[string]interface{}{"type": "ip"}
+		}
+		return map[string]interface{}{"type": "keyword"}
+	case KindArray:
+		// Elasticsearch has no array type: any field may hold a list of
+		// values of its type.
+		if n.Elem.Kind == KindArray {
+			return disabledMapping()
+		}
+		return n.Elem.elasticsearchField()
+	case KindObject:
+		if n.Recursive || len(n.Fields) == 0 {
+			return disabledMapping()
+		}
+		return map[string]interface{}{"properties": n.Elasticsearch()}
+	}
+	return disabledMapping()
+}
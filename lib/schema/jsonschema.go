@@ -0,0 +1,55 @@
+package schema
+
+// JSONSchemaDraft is the JSON Schema dialect emitted by JSONSchema.
+const JSONSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema renders the node as a JSON Schema (draft 7) object.
+func (n *Node) JSONSchema() map[string]interface{} {
+	ret := make(map[string]interface{})
+	if n.TypeName != "" {
+		ret["title"] = n.TypeName
+	}
+	switch n.Kind {
+	case KindAny:
+		// No constraints
+	case KindArray:
+		ret["type"] = []string{"array", "null"}
+		ret["items"] = n.Elem.JSONSchema()
+	case KindMap:
+		ret["type"] = []string{"object", "null"}
+		ret["additionalProperties"] = n.Elem.JSONSchema()
+	case KindObject:
+		ret["type"] = "object"
+		if n.Recursive {
+			ret["description"] = "recursive reference to " + n.TypeName
+			break
+		}
+		props := make(map[string]interface{}, len(n.Fields))
+		var required []string
+		for _, f := range n.Fields {
+			prop := f.Node.JSONSchema()
+			if f.Debug {
+				prop["description"] = "only present in debug output"
+			}
+			props[f.Name] = prop
+			if !f.OmitEmpty && !f.Debug {
+				required = append(required, f.Name)
+			}
+		}
+		ret["properties"] = props
+		if len(required) > 0 {
+			ret["required"] = required
+		}
+	default:
+		ret["type"] = string(n.Kind)
+	}
+	switch n.Format {
+	case FormatBase64:
+		ret["contentEncoding"] = "base64"
+	case FormatDateTime:
+		ret["format"] = "date-time"
+	case FormatIP:
+		ret["anyOf"] = []map[string]interface{}{{"format": "ipv4"}, {"format": "ipv6"}}
+	}
+	return ret
+}
@@ -0,0 +1,220 @@
+// Package schema derives machine-readable descriptions of zgrab2 output
+// records from the Go types that produce them, using the same `json` and
+// `zgrab` struct tags that control encoding.
+package schema
+
+import (
+	"encoding"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Kind is the JSON-level kind of a Node.
+type Kind string
+
+const (
+	// KindAny is used for values whose shape cannot be determined statically
+	// (interfaces, and types with custom JSON encodings).
+	KindAny     = Kind("any")
+	KindBoolean = Kind("boolean")
+	KindInteger = Kind("integer")
+	KindNumber  = Kind("number")
+	KindString  = Kind("string")
+	KindArray   = Kind("array")
+	KindObject  = Kind("object")
+	// KindMap is an object with arbitrary keys, all of whose values share the
+	// same schema (Elem).
+	KindMap = Kind("map")
+)
+
+// Format gives additional detail about the encoding of a string value.
+type Format string
+
+const (
+	FormatNone     = Format("")
+	FormatBase64   = Format("base64")
+	FormatDateTime = Format("date-time")
+	FormatIP       = Format("ip")
+)
+
+// Node describes the JSON encoding of a single Go type.
+type Node struct {
+	Kind   Kind
+	Format Format
+
+	// TypeName is the Go type the node was derived from.
+	TypeName string
+
+	// Fields holds the properties of an object, in declaration order.
+	Fields []*Field
+
+	// Elem is the schema of the array elements or map values.
+	Elem *Node
+
+	// Recursive is set if the node refers back to a type that is already
+	// being described; its contents are not expanded.
+	Recursive bool
+}
+
+// Field is a single property of an object.
+type Field struct {
+	Name string
+	Node *Node
+
+	// OmitEmpty is set if the property may be absent from the output.
+	OmitEmpty bool
+
+	// Debug is set if the property is only included in debug output.
+	Debug bool
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	ipType            = reflect.TypeOf(net.IP{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Describe returns the Node describing the JSON encoding of v's type.
+func Describe(v interface{}) *Node {
+	if v == nil {
+		return &Node{Kind: KindAny}
+	}
+	return describe(reflect.TypeOf(v), make(map[reflect.Type]bool))
+}
+
+// DescribeType returns the Node describing the JSON encoding of t.
+func DescribeType(t reflect.Type) *Node {
+	return describe(t, make(map[reflect.Type]bool))
+}
+
+func implements(t reflect.Type, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+func describe(t reflect.Type, visiting map[reflect.Type]bool) *Node {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	ret := &Node{TypeName: t.String()}
+	switch {
+	case t == timeType:
+		ret.Kind, ret.Format = KindString, FormatDateTime
+		return ret
+	case t == ipType:
+		ret.Kind, ret.Format = KindString, FormatIP
+		return ret
+	case implements(t, jsonMarshalerType):
+		ret.Kind = KindAny
+		return ret
+	case implements(t, textMarshalerType):
+		ret.Kind = KindString
+		return ret
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		ret.Kind = KindBoolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		ret.Kind = KindInteger
+	case reflect.Float32, reflect.Float64:
+		ret.Kind = KindNumber
+	case reflect.String:
+		ret.Kind = KindString
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			ret.Kind, ret.Format = KindString, FormatBase64
+			return ret
+		}
+		ret.Kind = KindArray
+		ret.Elem = describe(t.Elem(), visiting)
+	case reflect.Map:
+		ret.Kind = KindMap
+		ret.Elem = describe(t.Elem(), visiting)
+	case reflect.Struct:
+		if visiting[t] {
+			ret.Kind = KindObject
+			ret.Recursive = true
+			return ret
+		}
+		visiting[t] = true
+		ret.Kind = KindObject
+		ret.Fields = describeFields(t, visiting)
+		delete(visiting, t)
+	default:
+		// interfaces, channels, functions
+		ret.Kind = KindAny
+	}
+	return ret
+}
+
+// describeFields returns the properties of the struct type t, following the
+// encoding/json rules for names and embedded structs.
+func describeFields(t reflect.Type, visiting map[reflect.Type]bool) []*Field {
+	var ret []*Field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct &&
+			!implements(ft, jsonMarshalerType) && ft != timeType {
+			// Promote the fields of embedded structs.
+			if !visiting[ft] {
+				visiting[ft] = true
+				ret = append(ret, describeFields(ft, visiting)...)
+				delete(visiting, ft)
+			}
+			continue
+		}
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		field := &Field{
+			Name:      name,
+			Node:      describe(sf.Type, visiting),
+			OmitEmpty: hasOption(opts, "omitempty"),
+			Debug:     hasOption(sf.Tag.Get("zgrab"), "debug"),
+		}
+		if hasOption(opts, "string") {
+			field.Node = &Node{Kind: KindString, TypeName: field.Node.TypeName}
+		}
+		ret = append(ret, field)
+	}
+	return ret
+}
+
+func hasOption(opts string, option string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if strings.TrimSpace(o) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the field with the given name, or nil if there is none.
+func (n *Node) Lookup(name string) *Field {
+	for _, f := range n.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
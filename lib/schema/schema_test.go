@@ -0,0 +1,125 @@
+package schema
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Value int `json:"value"`
+}
+
+type embedded struct {
+	Promoted string `json:"promoted"`
+}
+
+type sample struct {
+	embedded
+	Name     string            `json:"name"`
+	Optional *inner            `json:"optional,omitempty"`
+	Raw      []byte            `json:"raw,omitempty"`
+	When     time.Time         `json:"when"`
+	IP       net.IP            `json:"ip"`
+	List     []inner           `json:"list"`
+	Extra    map[string]string `json:"extra,omitempty"`
+	Any      interface{}       `json:"any"`
+	Debug    string            `json:"debug,omitempty" zgrab:"debug"`
+	Skipped  string            `json:"-"`
+	Self     *sample           `json:"self,omitempty"`
+	hidden   string
+}
+
+func TestDescribe(t *testing.T) {
+	node := Describe(&sample{})
+	if node.Kind != KindObject {
+		t.Fatalf("expected object, got %s", node.Kind)
+	}
+	var names []string
+	for _, f := range node.Fields {
+		names = append(names, f.Name)
+	}
+	expected := []string{"promoted", "name", "optional", "raw", "when", "ip", "list", "extra", "any", "debug", "self"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected fields %v, got %v", expected, names)
+	}
+	checks := []struct {
+		field  string
+		kind   Kind
+		format Format
+	}{
+		{"name", KindString, FormatNone},
+		{"optional", KindObject, FormatNone},
+		{"raw", KindString, FormatBase64},
+		{"when", KindString, FormatDateTime},
+		{"ip", KindString, FormatIP},
+		{"list", KindArray, FormatNone},
+		{"extra", KindMap, FormatNone},
+		{"any", KindAny, FormatNone},
+	}
+	for _, check := range checks {
+		f := node.Lookup(check.field)
+		if f.Node.Kind != check.kind || f.Node.Format != check.format {
+			t.Errorf("%s: expected %s/%s, got %s/%s", check.field, check.kind, check.format, f.Node.Kind, f.Node.Format)
+		}
+	}
+	if !node.Lookup("optional").OmitEmpty || node.Lookup("name").OmitEmpty {
+		t.Errorf("omitempty not detected correctly")
+	}
+	if !node.Lookup("debug").Debug {
+		t.Errorf("debug tag not detected")
+	}
+	if !node.Lookup("self").Node.Recursive {
+		t.Errorf("recursive reference not detected")
+	}
+}
+
+func TestBigQuery(t *testing.T) {
+	fields := Describe(&sample{}).BigQuery()
+	byName := make(map[string]*BigQueryField)
+	for _, f := range fields {
+		byName[f.Name] = f
+	}
+	checks := map[string][2]string{
+		"name":  {"STRING", "NULLABLE"},
+		"raw":   {"BYTES", "NULLABLE"},
+		"when":  {"TIMESTAMP", "NULLABLE"},
+		"list":  {"RECORD", "REPEATED"},
+		"extra": {"STRING", "NULLABLE"},
+		"self":  {"STRING", "NULLABLE"},
+	}
+	for name, check := range checks {
+		f := byName[name]
+		if f == nil || f.Type != check[0] || f.Mode != check[1] {
+			t.Errorf("%s: expected %v, got %+v", name, check, f)
+		}
+	}
+	if len(byName["list"].Fields) != 1 || byName["list"].Fields[0].Type != "INTEGER" {
+		t.Errorf("unexpected nested fields: %+v", byName["list"].Fields)
+	}
+}
+
+func TestElasticsearch(t *testing.T) {
+	props := Describe(&sample{}).Elasticsearch()
+	checks := map[string]string{
+		"name": "keyword",
+		"raw":  "binary",
+		"when": "date",
+		"ip":   "ip",
+	}
+	for name, typ := range checks {
+		if f := props[name].(map[string]interface{}); f["type"] != typ {
+			t.Errorf("%s: expected %s, got %v", name, typ, f)
+		}
+	}
+	for _, name := range []string{"extra", "any", "self"} {
+		if f := props[name].(map[string]interface{}); f["enabled"] != false {
+			t.Errorf("%s: expected a disabled object, got %v", name, f)
+		}
+	}
+	list := props["list"].(map[string]interface{})["properties"].(map[string]interface{})
+	if f := list["value"].(map[string]interface{}); f["type"] != "long" {
+		t.Errorf("unexpected list mapping: %v", list)
+	}
+}
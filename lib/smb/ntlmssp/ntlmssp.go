@@ -255,6 +255,31 @@ func NewAuthenticateHash(domain, user, workstation, hash string, c Challenge) Au
 	return newAuthenticate(domain, user, workstation, buf, buf, c)
 }
 
+// NewAuthenticateAnonymous returns the Authenticate message of an anonymous
+// (null session) authentication, as in [MS-NLMP] Sect. 3.1.5.1.2.
+func NewAuthenticateAnonymous() Authenticate {
+	return Authenticate{
+		Header: Header{
+			Signature:   []byte(Signature),
+			MessageType: TypeNtLmAuthenticate,
+		},
+		DomainName:  []byte{},
+		UserName:    []byte{},
+		Workstation: []byte{},
+		NegotiateFlags: FlgNeg56 |
+			FlgNeg128 |
+			FlgNegTargetInfo |
+			FlgNegExtendedSessionSecurity |
+			FlgNegAnonymous |
+			FlgNegNtLm |
+			FlgNegRequestTarget |
+			FlgNegUnicode,
+		EncryptedRandomSessionKey: []byte{},
+		LmChallengeResponse:       []byte{0},
+		NtChallengeResponse:       []byte{},
+	}
+}
+
 func newAuthenticate(domain, user, workstation string, nthash, lmhash []byte, c Challenge) Authenticate {
 	// Assumes domain, user, and workstation are not unicode
 	var timestamp []byte
@@ -0,0 +1,284 @@
+package smb
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"unicode/utf16"
+
+	"github.com/zmap/zgrab2/lib/smb/gss"
+	"github.com/zmap/zgrab2/lib/smb/ntlmssp"
+	"github.com/zmap/zgrab2/lib/smb/smb/encoder"
+)
+
+// ProbedDialects are the SMB2 dialects probed by ProbeDialects, in order.
+var ProbedDialects = []uint16{
+	DialectSmb_2_0_2,
+	DialectSmb_2_1,
+	DialectSmb_3_0,
+	DialectSmb_3_0_2,
+	DialectSmb_3_1_1,
+}
+
+// headerV1Len is the length of an SMB1 header.
+const headerV1Len = 32
+
+// SMBv1Log contains the relevant parts of the server's responses to the SMB1
+// negotiation (offering NT LM 0.12 only) and session setup requests.
+type SMBv1Log struct {
+	// SecurityMode is the server's SMB1 security mode.
+	SecurityMode uint8 `json:"security_mode"`
+
+	// SigningRequired is true if the security mode requires signing.
+	SigningRequired bool `json:"signing_required"`
+
+	// Capabilities specifies protocol capabilities for the server.
+	Capabilities uint32 `json:"capabilities"`
+
+	// NativeOS is the operating system of the server, from the session
+	// setup response (e.g. "Windows Server 2003 3790 Service Pack 2").
+	NativeOS string `json:"native_os,omitempty"`
+
+	// NativeLanManager is the LAN Manager of the server, from the session
+	// setup response (e.g. "Samba 4.9.5-Debian").
+	NativeLanManager string `json:"native_lan_manager,omitempty"`
+}
+
+// SessionSetupAndXReqV1 is an SMB1 SESSION_SETUP_ANDX request with extended
+// security; Trailer holds the padding and the (empty) native OS and LAN
+// Manager strings.
+type SessionSetupAndXReqV1 struct {
+	HeaderV1
+	WordCount          uint8
+	AndXCommand        uint8
+	AndXReserved       uint8
+	AndXOffset         uint16
+	MaxBufferSize      uint16
+	MaxMpxCount        uint16
+	VcNumber           uint16
+	SessionKey         uint32
+	SecurityBlobLength uint16 `smb:"len:SecurityBlob"`
+	Reserved           uint32
+	Capabilities       uint32
+	ByteCount          uint16
+	SecurityBlob       []byte
+	Trailer            []byte
+}
+
+func newProbeSession(conn net.Conn, debug bool) *Session {
+	return &newLoggedSession(conn, debug).Session
+}
+
+// ProbeDialect returns true if the server accepts an SMB2 negotiation
+// offering only dialect.
+func ProbeDialect(conn net.Conn, dialect uint16, debug bool) (bool, error) {
+	s := newProbeSession(conn, debug)
+	req := s.NewNegotiateReq()
+	req.Dialects = []uint16{dialect}
+	req.DialectCount = 1
+	if _, err := rand.Read(req.ClientGuid); err != nil {
+		return false, err
+	}
+	var msg interface{} = req
+	if dialect == DialectSmb_3_1_1 {
+		// 3.1.1 requires a preauthentication integrity capabilities
+		// negotiate context ([MS-SMB2] Sect. 2.2.3.1), after the dialects,
+		// 8-byte aligned. ClientStartTime is replaced by its offset and
+		// count.
+		offset := uint64(64 + 36 + 2)
+		padding := make([]byte, (8-offset%8)%8)
+		offset += uint64(len(padding))
+		req.ClientStartTime = offset | 1<<32
+		buf, err := encoder.Marshal(req)
+		if err != nil {
+			return false, err
+		}
+		context := make([]byte, 8+6+32)
+		binary.LittleEndian.PutUint16(context[0:], 1) // SMB2_PREAUTH_INTEGRITY_CAPABILITIES
+		binary.LittleEndian.PutUint16(context[2:], 6+32)
+		binary.LittleEndian.PutUint16(context[8:], 1)   // HashAlgorithmCount
+		binary.LittleEndian.PutUint16(context[10:], 32) // SaltLength
+		binary.LittleEndian.PutUint16(context[12:], 1)  // SHA-512
+		if _, err := rand.Read(context[14:]); err != nil {
+			return false, err
+		}
+		msg = append(append(buf, padding...), context...)
+	}
+	s.Debug(fmt.Sprintf("Probing dialect 0x%04x", dialect), nil)
+	buf, err := s.send(msg)
+	if err != nil {
+		return false, err
+	}
+	var header Header
+	if err := encoder.Unmarshal(buf, &header); err != nil {
+		return false, err
+	}
+	if string(header.ProtocolID) != ProtocolSmb2 || header.Status != StatusOk || len(buf) < 70 {
+		return false, nil
+	}
+	return binary.LittleEndian.Uint16(buf[68:70]) == dialect, nil
+}
+
+// ProbeSMBv1 negotiates SMB1, offering only the NT LM 0.12 dialect, and, if
+// the server supports extended security, sends a session setup request to
+// get its native OS and LAN Manager strings. It returns an error if the
+// server does not accept the dialect.
+func ProbeSMBv1(conn net.Conn, debug bool) (*SMBv1Log, error) {
+	s := newProbeSession(conn, debug)
+	negReq := s.NewNegotiateReqV1()
+	negReq.Flags = FlagsV1CaseInsensitive | FlagsV1CanonicalizedPaths
+	negReq.Flags2 = Flags2V1LongNames | Flags2V1ExtendedSecurity | Flags2V1NTStatus | Flags2V1Unicode
+	negReq.SecurityFeatures = make([]byte, 8)
+	negReq.ByteCount = uint16(len(negReq.Dialects))
+	s.Debug("Sending SMB1 negotiate request", nil)
+	buf, err := s.send(negReq)
+	if err != nil {
+		return nil, err
+	}
+	if string(buf[0:4]) != ProtocolSmb {
+		return nil, errors.New("Server replied to SMB1 negotiation with SMB2")
+	}
+	var negRes NegotiateResV1
+	if err := encoder.Unmarshal(buf, &negRes); err != nil {
+		return nil, err
+	}
+	if negRes.Status != StatusOk || negRes.WordCount != 17 || negRes.DialectIndex != 0 {
+		return nil, fmt.Errorf("SMB1 dialect rejected (status 0x%08x)", negRes.Status)
+	}
+	ret := &SMBv1Log{
+		SecurityMode:    negRes.SecurityMode,
+		SigningRequired: negRes.SecurityMode&SecurityModeV1SigningRequired != 0,
+		Capabilities:    negRes.Capabilities,
+	}
+	if negRes.Capabilities&CapV1ExtendedSecurity == 0 {
+		return ret, nil
+	}
+
+	init, err := gss.NewNegTokenInit()
+	if err != nil {
+		return ret, err
+	}
+	init.Data.MechToken, err = encoder.Marshal(ntlmssp.NewNegotiate("", ""))
+	if err != nil {
+		return ret, err
+	}
+	blob, err := init.MarshalBinary(nil)
+	if err != nil {
+		return ret, err
+	}
+	// The strings are 2-byte aligned from the start of the header, after the
+	// security blob at offset 59.
+	trailer := make([]byte, 4+(59+len(blob))%2)
+	header := negReq.HeaderV1
+	header.Command = 0x73 // SMB1 Session Setup AndX
+	header.MID = 1
+	ssReq := SessionSetupAndXReqV1{
+		HeaderV1:      header,
+		WordCount:     12,
+		AndXCommand:   0xff,
+		MaxBufferSize: 0xffff,
+		MaxMpxCount:   2,
+		SessionKey:    negRes.SessionKey,
+		Capabilities:  CapV1ExtendedSecurity | CapV1NTStatus | CapV1Unicode,
+		ByteCount:     uint16(len(blob) + len(trailer)),
+		SecurityBlob:  blob,
+		Trailer:       trailer,
+	}
+	s.Debug("Sending SMB1 session setup request", nil)
+	buf, err = s.send(ssReq)
+	if err != nil {
+		return ret, err
+	}
+	ret.NativeOS, ret.NativeLanManager, err = parseSessionSetupAndXResV1(buf)
+	return ret, err
+}
+
+// parseSessionSetupAndXResV1 returns the native OS and LAN Manager strings
+// of an SMB1 SESSION_SETUP_ANDX response with extended security.
+func parseSessionSetupAndXResV1(buf []byte) (nativeOS string, nativeLanManager string, err error) {
+	if len(buf) < headerV1Len+1 || string(buf[0:4]) != ProtocolSmb {
+		return "", "", errors.New("Invalid SMB1 session setup response")
+	}
+	if buf[headerV1Len] != 4 {
+		status := binary.LittleEndian.Uint32(buf[5:9])
+		return "", "", fmt.Errorf("SMB1 session setup failed (status 0x%08x)", status)
+	}
+	const blobOffset = headerV1Len + 1 + 4*2 + 2
+	if len(buf) < blobOffset {
+		return "", "", errors.New("Truncated SMB1 session setup response")
+	}
+	blobLength := int(binary.LittleEndian.Uint16(buf[headerV1Len+7:]))
+	byteCount := int(binary.LittleEndian.Uint16(buf[headerV1Len+9:]))
+	end := blobOffset + byteCount
+	if end > len(buf) || blobLength > byteCount {
+		return "", "", errors.New("Truncated SMB1 session setup response")
+	}
+	data := buf[blobOffset+blobLength : end]
+	flags2 := binary.LittleEndian.Uint16(buf[10:12])
+	if flags2&Flags2V1Unicode == 0 {
+		strs := splitStrings(data, 1, 2)
+		return strs[0], strs[1], nil
+	}
+	if (blobOffset+blobLength)%2 == 1 && len(data) > 0 {
+		data = data[1:]
+	}
+	strs := splitStrings(data, 2, 2)
+	return strs[0], strs[1], nil
+}
+
+// splitStrings returns the first n null-terminated strings of data, with
+// characters of width bytes (2 for UTF-16LE); missing strings are empty.
+func splitStrings(data []byte, width int, n int) []string {
+	ret := make([]string, n)
+	for i := 0; i < n && len(data) >= width; i++ {
+		end := 0
+		for ; end+width <= len(data); end += width {
+			if data[end] == 0 && (width == 1 || data[end+1] == 0) {
+				break
+			}
+		}
+		if width == 1 {
+			ret[i] = string(data[:end])
+		} else {
+			u16 := make([]uint16, end/2)
+			for j := range u16 {
+				u16[j] = binary.LittleEndian.Uint16(data[2*j:])
+			}
+			ret[i] = string(utf16.Decode(u16))
+		}
+		if end+width > len(data) {
+			break
+		}
+		data = data[end+width:]
+	}
+	return ret
+}
+
+// ProbeDialects probes SMB1 and each of ProbedDialects on its own
+// connection, returned by dial, and returns the supported dialects and the
+// SMB1 log (nil if SMB1 is not supported). A dialect is not supported if the
+// connection fails.
+func ProbeDialects(dial func() (net.Conn, error), debug bool) ([]string, *SMBv1Log) {
+	var dialects []string
+	var v1 *SMBv1Log
+	if conn, err := dial(); err == nil {
+		v1, _ = ProbeSMBv1(conn, debug)
+		if v1 != nil {
+			dialects = append(dialects, "SMB 1.0")
+		}
+		conn.Close()
+	}
+	for _, dialect := range ProbedDialects {
+		conn, err := dial()
+		if err != nil {
+			continue
+		}
+		if ok, _ := ProbeDialect(conn, dialect, debug); ok {
+			dialects = append(dialects, dialectString(dialect))
+		}
+		conn.Close()
+	}
+	return dialects, v1
+}
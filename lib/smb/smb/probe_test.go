@@ -0,0 +1,29 @@
+package smb
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/zmap/zgrab2/lib/smb/smb/encoder"
+)
+
+func TestParseSessionSetupAndXResV1(t *testing.T) {
+	blob := []byte{0xa1, 0x03, 0x30, 0x01, 0x00}
+	buf := make([]byte, headerV1Len+11)
+	copy(buf, ProtocolSmb)
+	binary.LittleEndian.PutUint16(buf[10:], Flags2V1Unicode)
+	buf[headerV1Len] = 4
+	binary.LittleEndian.PutUint16(buf[headerV1Len+7:], uint16(len(blob)))
+	buf = append(buf, blob...)
+	// The strings are aligned after the blob, which ends at an even offset.
+	data := append(encoder.ToUnicode("Windows 5.1\x00"), encoder.ToUnicode("Windows 2000 LAN Manager\x00")...)
+	buf = append(buf, data...)
+	binary.LittleEndian.PutUint16(buf[headerV1Len+9:], uint16(len(blob)+len(data)))
+	nativeOS, nativeLanManager, err := parseSessionSetupAndXResV1(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nativeOS != "Windows 5.1" || nativeLanManager != "Windows 2000 LAN Manager" {
+		t.Errorf("got %q, %q", nativeOS, nativeLanManager)
+	}
+}
@@ -0,0 +1,511 @@
+package smb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"unicode/utf16"
+
+	"github.com/zmap/zgrab2/lib/smb/ntlmssp"
+	"github.com/zmap/zgrab2/lib/smb/smb/encoder"
+)
+
+// FSCTL_PIPE_TRANSCEIVE writes a message to a named pipe and reads the reply.
+const fsctlPipeTransceive = 0x0011c017
+
+// maxFragment is the maximum DCE/RPC fragment size negotiated in the bind.
+const maxFragment = 4280
+
+// maxPipeResponse is the maximum size of the DCE/RPC response read.
+const maxPipeResponse = 1 << 20
+
+// DCE/RPC packet types and flags; see C706 Sect. 12.
+const (
+	rpcRequest  = 0
+	rpcResponse = 2
+	rpcFault    = 3
+	rpcBind     = 11
+	rpcBindAck  = 12
+
+	rpcFirstFrag = 0x01
+	rpcLastFrag  = 0x02
+)
+
+// opNetrShareEnum is the NetrShareEnum operation of srvsvc ([MS-SRVS] Sect.
+// 3.1.4.8).
+const opNetrShareEnum = 15
+
+// The srvsvc interface (4b324fc8-1670-01d3-1278-5a47bf6ee188 v3.0), and the
+// NDR transfer syntax (8a885d04-1ceb-11c9-9fe8-08002b104860 v2.0).
+var (
+	srvsvcSyntax = []byte{
+		0xc8, 0x4f, 0x32, 0x4b, 0x70, 0x16, 0xd3, 0x01,
+		0x12, 0x78, 0x5a, 0x47, 0xbf, 0x6e, 0xe1, 0x88,
+		3, 0, 0, 0,
+	}
+	ndrSyntax = []byte{
+		0x04, 0x5d, 0x88, 0x8a, 0xeb, 0x1c, 0xc9, 0x11,
+		0x9f, 0xe8, 0x08, 0x00, 0x2b, 0x10, 0x48, 0x60,
+		2, 0, 0, 0,
+	}
+)
+
+// Share types; see [MS-SRVS] Sect. 2.2.2.4.
+const (
+	shareTypeMask    = 0x0fffffff
+	shareTypeSpecial = 0x80000000
+)
+
+var shareTypeNames = map[uint32]string{
+	0: "disk",
+	1: "printer",
+	2: "device",
+	3: "ipc",
+}
+
+// ShareLog is a share listed by the server.
+type ShareLog struct {
+	Name string `json:"name"`
+
+	// Type is the share type from the server (e.g. 0x80000000 for the
+	// special IPC$ share).
+	Type uint32 `json:"type"`
+
+	// TypeName is "disk", "printer", "device" or "ipc".
+	TypeName string `json:"type_name,omitempty"`
+
+	// Special is true for the administrative shares (e.g. C$).
+	Special bool `json:"special,omitempty"`
+
+	Remark string `json:"remark,omitempty"`
+}
+
+// NullSessionLog is the outcome of an anonymous session setup, and of the
+// share listing with it.
+type NullSessionLog struct {
+	// Allowed is true if the server accepted the anonymous session setup.
+	Allowed bool `json:"allowed"`
+
+	// SessionFlags are the flags of the session setup response (e.g. 0x2
+	// for a null session, 0x1 for a guest session).
+	SessionFlags uint16 `json:"session_flags,omitempty"`
+
+	// IPCShareFlags are the flags of the IPC$ share.
+	IPCShareFlags uint32 `json:"ipc_share_flags,omitempty"`
+
+	// Shares are the shares returned by NetrShareEnum.
+	Shares []ShareLog `json:"shares,omitempty"`
+
+	// Error is set if the session setup was rejected, or the shares could
+	// not be listed.
+	Error string `json:"error,omitempty"`
+}
+
+// GetSMBLogWithNullSession performs the same operations as GetSMBLog with a
+// session setup, then attempts a null session with the server host (see
+// LoggedNullSession).
+func GetSMBLogWithNullSession(conn net.Conn, host string, debug bool) (*SMBLog, error) {
+	s := newLoggedSession(conn, debug)
+	if err := s.LoggedNegotiateProtocol(true); err != nil {
+		return s.Log, err
+	}
+	s.LoggedNullSession(host)
+	return s.Log, nil
+}
+
+// LoggedNullSession completes the session setup started by
+// LoggedNegotiateProtocol(true) with an anonymous authentication and, if the
+// server accepts it, lists the shares of host with the srvsvc pipe of IPC$.
+// The outcome is logged in Log.NullSession.
+func (ls *LoggedSession) LoggedNullSession(host string) {
+	s := &ls.Session
+	s.options.Host = host
+	ret := new(NullSessionLog)
+	ls.Log.NullSession = ret
+	if err := s.anonymousSessionSetup(ret); err != nil {
+		ret.Error = err.Error()
+		return
+	}
+	if ret.SessionFlags&SessionFlagEncryptData != 0 {
+		ls.Log.EncryptionRequired = true
+		ret.Error = "Session requires encryption"
+		return
+	}
+	treeID, shareFlags, err := s.treeConnect("IPC$")
+	if err != nil {
+		ret.Error = err.Error()
+		return
+	}
+	ret.IPCShareFlags = shareFlags
+	if shareFlags&ShareFlagEncryptData != 0 {
+		ls.Log.EncryptionRequired = true
+		ret.Error = "IPC$ share requires encryption"
+		return
+	}
+	ret.Shares, err = s.listShares(treeID)
+	if err != nil {
+		ret.Error = err.Error()
+	}
+}
+
+// anonymousSessionSetup sends the second session setup request, with an
+// anonymous NTLM authentication.
+func (s *Session) anonymousSessionSetup(ret *NullSessionLog) error {
+	s.Debug("Sending anonymous SessionSetup2 request", nil)
+	ss2req, err := s.NewSessionSetup2Req()
+	if err != nil {
+		return err
+	}
+	responseToken, err := encoder.Marshal(ntlmssp.NewAuthenticateAnonymous())
+	if err != nil {
+		return err
+	}
+	ss2req.SecurityBlob.ResponseToken = responseToken
+	ss2req.Header.Credits = 127
+	buf, err := s.send(ss2req)
+	if err != nil {
+		return err
+	}
+	var res Header
+	if err := encoder.Unmarshal(buf, &res); err != nil {
+		s.Debug("Raw:\n"+hex.Dump(buf), err)
+		return err
+	}
+	if res.Status != StatusOk {
+		return statusError(res.Status)
+	}
+	ret.Allowed = true
+	if len(buf) >= 68 {
+		ret.SessionFlags = binary.LittleEndian.Uint16(buf[66:68])
+	}
+	return nil
+}
+
+// statusError returns an error with the name (or number) of an NT status.
+func statusError(status uint32) error {
+	if name, ok := StatusMap[status]; ok {
+		return errors.New("NT Status Error: " + name)
+	}
+	return fmt.Errorf("NT Status Error: 0x%08x", status)
+}
+
+// treeConnect connects to the share name, and returns its tree ID and share
+// flags.
+func (s *Session) treeConnect(name string) (uint32, uint32, error) {
+	s.Debug("Sending TreeConnect request ["+name+"]", nil)
+	req, err := s.NewTreeConnectReq(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	buf, err := s.send(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	var res TreeConnectRes
+	if err := encoder.Unmarshal(buf, &res); err != nil {
+		s.Debug("Raw:\n"+hex.Dump(buf), err)
+		return 0, 0, err
+	}
+	if res.Header.Status != StatusOk {
+		return 0, 0, statusError(res.Header.Status)
+	}
+	s.trees[name] = res.Header.TreeID
+	return res.Header.TreeID, res.ShareFlags, nil
+}
+
+// listShares opens the srvsvc pipe of the IPC$ tree treeID, and calls
+// NetrShareEnum.
+func (s *Session) listShares(treeID uint32) ([]ShareLog, error) {
+	s.Debug("Sending Create request [srvsvc]", nil)
+	buf, err := s.send(s.NewCreateReq(treeID, "srvsvc"))
+	if err != nil {
+		return nil, err
+	}
+	var createRes CreateRes
+	if err := encoder.Unmarshal(buf, &createRes); err != nil {
+		s.Debug("Raw:\n"+hex.Dump(buf), err)
+		return nil, err
+	}
+	if createRes.Header.Status != StatusOk {
+		return nil, statusError(createRes.Header.Status)
+	}
+	fileID := createRes.FileID
+	defer func() {
+		s.send(s.NewCloseReq(treeID, fileID))
+	}()
+
+	fragments, err := s.transceive(treeID, fileID, newBind())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBindAck(fragments[0]); err != nil {
+		return nil, err
+	}
+	fragments, err = s.transceive(treeID, fileID, newRequest(opNetrShareEnum, netrShareEnumStub(s.options.Host)))
+	if err != nil {
+		return nil, err
+	}
+	var stub []byte
+	for _, fragment := range fragments {
+		if len(fragment) < 28 && fragment[2] == rpcFault || len(fragment) < 24 {
+			return nil, errors.New("Truncated DCE/RPC response")
+		}
+		if fragment[2] == rpcFault {
+			return nil, fmt.Errorf("DCE/RPC fault 0x%08x", binary.LittleEndian.Uint32(fragment[24:]))
+		}
+		if fragment[2] != rpcResponse {
+			return nil, errors.New("Unexpected DCE/RPC response")
+		}
+		stub = append(stub, fragment[24:]...)
+	}
+	return parseNetrShareEnumResponse(stub)
+}
+
+// transceive sends the DCE/RPC message input on the pipe fileID, and returns
+// the fragments of the reply, reading the pipe until the last one.
+func (s *Session) transceive(treeID uint32, fileID []byte, input []byte) ([][]byte, error) {
+	buf, err := s.send(s.NewIoctlReq(treeID, fileID, fsctlPipeTransceive, input, maxFragment))
+	if err != nil {
+		return nil, err
+	}
+	var res IoctlRes
+	if err := encoder.Unmarshal(buf, &res); err != nil {
+		s.Debug("Raw:\n"+hex.Dump(buf), err)
+		return nil, err
+	}
+	if res.Header.Status != StatusOk && res.Header.Status != StatusBufferOverflow {
+		return nil, statusError(res.Header.Status)
+	}
+	if uint64(res.OutputOffset)+uint64(res.OutputCount) > uint64(len(buf)) {
+		return nil, errors.New("Invalid IOCTL output")
+	}
+	data := append([]byte{}, buf[res.OutputOffset:res.OutputOffset+res.OutputCount]...)
+	var fragments [][]byte
+	for {
+		for len(data) < 16 || len(data) < int(binary.LittleEndian.Uint16(data[8:10])) {
+			more, err := s.read(treeID, fileID)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, more...)
+			if len(data) > maxPipeResponse {
+				return nil, errors.New("DCE/RPC response too long")
+			}
+		}
+		length := int(binary.LittleEndian.Uint16(data[8:10]))
+		if length < 16 {
+			return nil, errors.New("Invalid DCE/RPC fragment")
+		}
+		fragments = append(fragments, data[:length])
+		last := data[3]&rpcLastFrag != 0
+		data = data[length:]
+		if last {
+			return fragments, nil
+		}
+	}
+}
+
+// read reads the next part of a message from the pipe fileID.
+func (s *Session) read(treeID uint32, fileID []byte) ([]byte, error) {
+	buf, err := s.send(s.NewReadReq(treeID, fileID, maxFragment))
+	if err != nil {
+		return nil, err
+	}
+	var res ReadRes
+	if err := encoder.Unmarshal(buf, &res); err != nil {
+		s.Debug("Raw:\n"+hex.Dump(buf), err)
+		return nil, err
+	}
+	if res.Header.Status != StatusOk && res.Header.Status != StatusBufferOverflow {
+		return nil, statusError(res.Header.Status)
+	}
+	if res.DataLength == 0 || uint64(res.DataOffset)+uint64(res.DataLength) > uint64(len(buf)) {
+		return nil, errors.New("Invalid READ response")
+	}
+	return buf[res.DataOffset : uint32(res.DataOffset)+res.DataLength], nil
+}
+
+// rpcHeader returns the common header of a DCE/RPC packet of type ptype,
+// with a body of length bodyLength.
+func rpcHeader(ptype byte, callID uint32, bodyLength int) []byte {
+	ret := make([]byte, 16)
+	ret[0] = 5 // Version 5.0
+	ret[2] = ptype
+	ret[3] = rpcFirstFrag | rpcLastFrag
+	ret[4] = 0x10 // Little-endian, ASCII, IEEE floating point
+	binary.LittleEndian.PutUint16(ret[8:], uint16(16+bodyLength))
+	binary.LittleEndian.PutUint32(ret[12:], callID)
+	return ret
+}
+
+// newBind returns the bind to the srvsvc interface.
+func newBind() []byte {
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint16(body[0:], maxFragment)
+	binary.LittleEndian.PutUint16(body[2:], maxFragment)
+	body[8] = 1  // One context
+	body[14] = 1 // Context 0, with one transfer syntax
+	body = append(body, srvsvcSyntax...)
+	body = append(body, ndrSyntax...)
+	return append(rpcHeader(rpcBind, 1, len(body)), body...)
+}
+
+// checkBindAck returns an error if the reply to the bind is not an
+// acceptance.
+func checkBindAck(fragment []byte) error {
+	if fragment[2] != rpcBindAck {
+		return fmt.Errorf("DCE/RPC bind rejected (type %d)", fragment[2])
+	}
+	if len(fragment) < 26 {
+		return errors.New("Invalid DCE/RPC bind_ack")
+	}
+	// The secondary address follows the fragment sizes and the association
+	// group; the results are 4-byte aligned after it.
+	offset := 26 + int(binary.LittleEndian.Uint16(fragment[24:26]))
+	offset += (4 - offset%4) % 4
+	if len(fragment) < offset+6 || fragment[offset] == 0 {
+		return errors.New("Invalid DCE/RPC bind_ack")
+	}
+	if result := binary.LittleEndian.Uint16(fragment[offset+4:]); result != 0 {
+		return fmt.Errorf("DCE/RPC bind rejected (result %d)", result)
+	}
+	return nil
+}
+
+// newRequest returns the request for the operation opnum with stub.
+func newRequest(opnum uint16, stub []byte) []byte {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint32(body[0:], uint32(len(stub)))
+	binary.LittleEndian.PutUint16(body[6:], opnum)
+	body = append(body, stub...)
+	return append(rpcHeader(rpcRequest, 2, len(body)), body...)
+}
+
+// ndrWriter writes NDR data, little-endian.
+type ndrWriter []byte
+
+func (w *ndrWriter) uint32(v uint32) {
+	*w = append(*w, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// string writes a conformant varying null-terminated UTF-16 string, 4-byte
+// aligned.
+func (w *ndrWriter) string(s string) {
+	u16 := append(utf16.Encode([]rune(s)), 0)
+	w.uint32(uint32(len(u16)))
+	w.uint32(0)
+	w.uint32(uint32(len(u16)))
+	for _, c := range u16 {
+		*w = append(*w, byte(c), byte(c>>8))
+	}
+	for len(*w)%4 != 0 {
+		*w = append(*w, 0)
+	}
+}
+
+// netrShareEnumStub returns the parameters of NetrShareEnum for the server
+// name host, requesting level 1 (name, type and remark) for all shares.
+func netrShareEnumStub(host string) []byte {
+	var w ndrWriter
+	w.uint32(0x00020000) // ServerName referent
+	w.string(`\\` + host)
+	w.uint32(1)          // Level
+	w.uint32(1)          // Union switch
+	w.uint32(0x00020004) // SHARE_INFO_1_CONTAINER referent
+	w.uint32(0)          // EntriesRead
+	w.uint32(0)          // Null Buffer
+	w.uint32(0xffffffff) // PreferedMaximumLength
+	w.uint32(0)          // Null ResumeHandle
+	return w
+}
+
+// ndrReader reads NDR data, little-endian.
+type ndrReader struct {
+	buf    []byte
+	offset int
+	err    error
+}
+
+func (r *ndrReader) uint32() uint32 {
+	r.offset += (4 - r.offset%4) % 4
+	if r.err != nil || r.offset+4 > len(r.buf) {
+		r.err = errors.New("Truncated NDR data")
+		return 0
+	}
+	ret := binary.LittleEndian.Uint32(r.buf[r.offset:])
+	r.offset += 4
+	return ret
+}
+
+// string reads a conformant varying UTF-16 string, without its terminator.
+func (r *ndrReader) string() string {
+	r.uint32() // Maximum count
+	r.uint32() // Offset
+	count := int(r.uint32())
+	if r.err != nil || count < 0 || r.offset+2*count > len(r.buf) {
+		r.err = errors.New("Truncated NDR data")
+		return ""
+	}
+	u16 := make([]uint16, count)
+	for i := range u16 {
+		u16[i] = binary.LittleEndian.Uint16(r.buf[r.offset+2*i:])
+	}
+	r.offset += 2 * count
+	if count > 0 && u16[count-1] == 0 {
+		u16 = u16[:count-1]
+	}
+	return string(utf16.Decode(u16))
+}
+
+// parseNetrShareEnumResponse parses the results of NetrShareEnum at level 1.
+func parseNetrShareEnumResponse(stub []byte) ([]ShareLog, error) {
+	r := &ndrReader{buf: stub}
+	level := r.uint32()
+	r.uint32() // Union switch
+	if r.uint32() == 0 {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, errors.New("No share container")
+	}
+	count := r.uint32()
+	if level != 1 || r.uint32() == 0 {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, nil
+	}
+	if r.uint32() != count || int(count)*12 > len(stub) {
+		return nil, errors.New("Invalid share count")
+	}
+	type entry struct {
+		name, remark uint32
+	}
+	entries := make([]entry, count)
+	ret := make([]ShareLog, count)
+	for i := range ret {
+		entries[i].name = r.uint32()
+		ret[i].Type = r.uint32()
+		entries[i].remark = r.uint32()
+		ret[i].TypeName = shareTypeNames[ret[i].Type&shareTypeMask]
+		ret[i].Special = ret[i].Type&shareTypeSpecial != 0
+	}
+	for i := range ret {
+		if entries[i].name != 0 {
+			ret[i].Name = r.string()
+		}
+		if entries[i].remark != 0 {
+			ret[i].Remark = r.string()
+		}
+	}
+	r.uint32() // TotalEntries
+	if r.uint32() != 0 {
+		r.uint32() // ResumeHandle
+	}
+	if status := r.uint32(); r.err == nil && status != 0 {
+		return ret, fmt.Errorf("NetrShareEnum error 0x%08x", status)
+	}
+	return ret, r.err
+}
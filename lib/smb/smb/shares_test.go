@@ -0,0 +1,50 @@
+package smb
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestNewBind(t *testing.T) {
+	bind := newBind()
+	if len(bind) != 72 || binary.LittleEndian.Uint16(bind[8:]) != 72 || bind[2] != rpcBind {
+		t.Errorf("got bind %x", bind)
+	}
+}
+
+func TestParseNetrShareEnumResponse(t *testing.T) {
+	var w ndrWriter
+	w.uint32(1)          // Level
+	w.uint32(1)          // Union switch
+	w.uint32(0x00020000) // Container referent
+	w.uint32(2)          // EntriesRead
+	w.uint32(0x00020004) // Buffer referent
+	w.uint32(2)          // Maximum count
+	w.uint32(0x00020008) // Name
+	w.uint32(0x80000003) // Type
+	w.uint32(0x0002000c) // Remark
+	w.uint32(0x00020010) // Name
+	w.uint32(0)          // Type
+	w.uint32(0)          // Null remark
+	w.string("IPC$")
+	w.string("Remote IPC")
+	w.string("public")
+	w.uint32(2) // TotalEntries
+	w.uint32(0) // Null ResumeHandle
+	w.uint32(0) // WERROR
+	shares, err := parseNetrShareEnumResponse(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ShareLog{
+		{Name: "IPC$", Type: 0x80000003, TypeName: "ipc", Special: true, Remark: "Remote IPC"},
+		{Name: "public", Type: 0, TypeName: "disk"},
+	}
+	if !reflect.DeepEqual(shares, expected) {
+		t.Errorf("got shares %+v", shares)
+	}
+	if _, err := parseNetrShareEnumResponse(w[:40]); err == nil {
+		t.Error("truncated response parsed")
+	}
+}
@@ -17,6 +17,8 @@ const StatusMoreProcessingRequired = 0xc0000016
 const StatusInvalidParameter = 0xc000000d
 const StatusLogonFailure = 0xc000006d
 const StatusUserSessionDeleted = 0xc0000203
+const StatusBufferOverflow = 0x80000005
+const StatusAccessDenied = 0xc0000022
 
 var StatusMap = map[uint32]string{
 	StatusOk:                     "OK",
@@ -24,6 +26,8 @@ var StatusMap = map[uint32]string{
 	StatusInvalidParameter:       "Invalid Parameter",
 	StatusLogonFailure:           "Logon failed",
 	StatusUserSessionDeleted:     "User session deleted",
+	StatusBufferOverflow:         "Buffer overflow",
+	StatusAccessDenied:           "Access denied",
 }
 
 const DialectSmb_2_0_2 = 0x0202
@@ -63,6 +67,33 @@ const (
 	SecurityModeSigningRequired
 )
 
+// SMB1 security modes; see [MS-CIFS] Sect. 2.2.4.52.2.
+const (
+	SecurityModeV1SigningEnabled  uint8 = 0x04
+	SecurityModeV1SigningRequired uint8 = 0x08
+)
+
+// SMB1 header flags and capabilities; see [MS-CIFS] Sect. 2.2.3.1 and
+// [MS-SMB] Sect. 2.2.4.5.2.1.
+const (
+	FlagsV1CaseInsensitive    uint8  = 0x08
+	FlagsV1CanonicalizedPaths uint8  = 0x10
+	Flags2V1LongNames         uint16 = 0x0001
+	Flags2V1ExtendedSecurity  uint16 = 0x0800
+	Flags2V1NTStatus          uint16 = 0x4000
+	Flags2V1Unicode           uint16 = 0x8000
+	CapV1Unicode              uint32 = 0x00000004
+	CapV1NTStatus             uint32 = 0x00000040
+	CapV1ExtendedSecurity     uint32 = 0x80000000
+)
+
+// Session flags of a session setup response; see [MS-SMB2] Sect. 2.2.6.
+const (
+	SessionFlagIsGuest     uint16 = 0x0001
+	SessionFlagIsNull      uint16 = 0x0002
+	SessionFlagEncryptData uint16 = 0x0004
+)
+
 const (
 	_ byte = iota
 	ShareTypeDisk
@@ -245,6 +276,114 @@ type TreeConnectRes struct {
 	MaximalAccess uint32
 }
 
+type CreateReq struct {
+	Header
+	StructureSize        uint16
+	SecurityFlags        uint8
+	RequestedOplockLevel uint8
+	ImpersonationLevel   uint32
+	SmbCreateFlags       uint64
+	Reserved             uint64
+	DesiredAccess        uint32
+	FileAttributes       uint32
+	ShareAccess          uint32
+	CreateDisposition    uint32
+	CreateOptions        uint32
+	NameOffset           uint16 `smb:"offset:Buffer"`
+	NameLength           uint16 `smb:"len:Buffer"`
+	CreateContextsOffset uint32
+	CreateContextsLength uint32
+	Buffer               []byte
+}
+
+type CreateRes struct {
+	Header
+	StructureSize        uint16
+	OplockLevel          uint8
+	Flags                uint8
+	CreateAction         uint32
+	CreationTime         uint64
+	LastAccessTime       uint64
+	LastWriteTime        uint64
+	ChangeTime           uint64
+	AllocationSize       uint64
+	EndofFile            uint64
+	FileAttributes       uint32
+	Reserved2            uint32
+	FileID               []byte `smb:"fixed:16"`
+	CreateContextsOffset uint32
+	CreateContextsLength uint32
+}
+
+type CloseReq struct {
+	Header
+	StructureSize uint16
+	Flags         uint16
+	Reserved      uint32
+	FileID        []byte `smb:"fixed:16"`
+}
+
+type IoctlReq struct {
+	Header
+	StructureSize     uint16
+	Reserved          uint16
+	CtlCode           uint32
+	FileID            []byte `smb:"fixed:16"`
+	InputOffset       uint32 `smb:"offset:Buffer"`
+	InputCount        uint32 `smb:"len:Buffer"`
+	MaxInputResponse  uint32
+	OutputOffset      uint32
+	OutputCount       uint32
+	MaxOutputResponse uint32
+	Flags             uint32
+	Reserved2         uint32
+	Buffer            []byte
+}
+
+// IoctlRes is the fixed part of an IOCTL response; the output is at
+// OutputOffset from the start of the header.
+type IoctlRes struct {
+	Header
+	StructureSize uint16
+	Reserved      uint16
+	CtlCode       uint32
+	FileID        []byte `smb:"fixed:16"`
+	InputOffset   uint32
+	InputCount    uint32
+	OutputOffset  uint32
+	OutputCount   uint32
+	Flags         uint32
+	Reserved2     uint32
+}
+
+type ReadReq struct {
+	Header
+	StructureSize         uint16
+	Padding               uint8
+	Flags                 uint8
+	Length                uint32
+	Offset                uint64
+	FileID                []byte `smb:"fixed:16"`
+	MinimumCount          uint32
+	Channel               uint32
+	RemainingBytes        uint32
+	ReadChannelInfoOffset uint16
+	ReadChannelInfoLength uint16
+	Buffer                []byte
+}
+
+// ReadRes is the fixed part of a READ response; the data is at DataOffset
+// from the start of the header.
+type ReadRes struct {
+	Header
+	StructureSize uint16
+	DataOffset    uint8
+	Reserved      uint8
+	DataLength    uint32
+	DataRemaining uint32
+	Reserved2     uint32
+}
+
 type TreeDisconnectReq struct {
 	Header
 	StructureSize uint16
@@ -477,3 +616,80 @@ func (s *Session) NewTreeDisconnectReq(treeId uint32) (TreeDisconnectReq, error)
 func NewTreeDisconnectRes() (TreeDisconnectRes, error) {
 	return TreeDisconnectRes{}, nil
 }
+
+// NewCreateReq creates a CREATE message opening the named pipe name of the
+// tree treeID for reading and writing.
+func (s *Session) NewCreateReq(treeID uint32, name string) CreateReq {
+	header := newHeader()
+	header.Command = CommandCreate
+	header.CreditCharge = 1
+	header.MessageID = s.messageID
+	header.SessionID = s.sessionID
+	header.TreeID = treeID
+
+	return CreateReq{
+		Header:             header,
+		StructureSize:      57,
+		ImpersonationLevel: 2, // Impersonation
+		DesiredAccess:      0x0012019f,
+		ShareAccess:        0x00000003, // FILE_SHARE_READ | FILE_SHARE_WRITE
+		CreateDisposition:  1,          // FILE_OPEN
+		CreateOptions:      0x00000040, // FILE_NON_DIRECTORY_FILE
+		Buffer:             encoder.ToUnicode(name),
+	}
+}
+
+func (s *Session) NewCloseReq(treeID uint32, fileID []byte) CloseReq {
+	header := newHeader()
+	header.Command = CommandClose
+	header.CreditCharge = 1
+	header.MessageID = s.messageID
+	header.SessionID = s.sessionID
+	header.TreeID = treeID
+
+	return CloseReq{
+		Header:        header,
+		StructureSize: 24,
+		FileID:        fileID,
+	}
+}
+
+// NewIoctlReq creates an IOCTL message sending the file system control
+// ctlCode to the file fileID, with input, accepting up to maxOutput bytes of
+// output.
+func (s *Session) NewIoctlReq(treeID uint32, fileID []byte, ctlCode uint32, input []byte, maxOutput uint32) IoctlReq {
+	header := newHeader()
+	header.Command = CommandIOCtl
+	header.CreditCharge = 1
+	header.MessageID = s.messageID
+	header.SessionID = s.sessionID
+	header.TreeID = treeID
+
+	return IoctlReq{
+		Header:            header,
+		StructureSize:     57,
+		CtlCode:           ctlCode,
+		FileID:            fileID,
+		MaxOutputResponse: maxOutput,
+		Flags:             1, // SMB2_0_IOCTL_IS_FSCTL
+		Buffer:            input,
+	}
+}
+
+func (s *Session) NewReadReq(treeID uint32, fileID []byte, length uint32) ReadReq {
+	header := newHeader()
+	header.Command = CommandRead
+	header.CreditCharge = 1
+	header.MessageID = s.messageID
+	header.SessionID = s.sessionID
+	header.TreeID = treeID
+
+	return ReadReq{
+		Header:        header,
+		StructureSize: 49,
+		Padding:       0x50,
+		Length:        length,
+		FileID:        fileID,
+		Buffer:        []byte{0},
+	}
+}
@@ -79,6 +79,17 @@ type SessionSetupLog struct {
 
 	// NegotiateFlags are the flags from the challenge packet
 	NegotiateFlags uint32 `json:"negotiate_flags"`
+
+	// OSVersion is the Windows version (major.minor.build) from the challenge
+	// packet, if present.
+	OSVersion string `json:"os_version,omitempty"`
+
+	// The names of the server from the target info of the challenge packet.
+	NetBIOSComputerName string `json:"netbios_computer_name,omitempty"`
+	NetBIOSDomainName   string `json:"netbios_domain_name,omitempty"`
+	DNSComputerName     string `json:"dns_computer_name,omitempty"`
+	DNSDomainName       string `json:"dns_domain_name,omitempty"`
+	DNSForestName       string `json:"dns_forest_name,omitempty"`
 }
 
 // Parse the SMB version and dialect; version string
@@ -151,6 +162,26 @@ type SMBLog struct {
 	// SessionSetupLog, if present, contains the server's response to the
 	// session setup request.
 	SessionSetupLog *SessionSetupLog `json:"session_setup_log,omitempty"`
+
+	// SigningRequired is true if the server's security mode requires
+	// messages to be signed.
+	SigningRequired bool `json:"signing_required"`
+
+	// EncryptionRequired is true if the null session, or its IPC$ share,
+	// requires encryption.
+	EncryptionRequired bool `json:"encryption_required,omitempty"`
+
+	// SupportedDialects, if present, lists the dialects (e.g. "SMB 2.1")
+	// accepted by the server when offered alone; see ProbeDialects.
+	SupportedDialects []string `json:"supported_dialects,omitempty"`
+
+	// SMBv1Log, if present, contains the server's responses to the SMB1
+	// dialect probe.
+	SMBv1Log *SMBv1Log `json:"smbv1_log,omitempty"`
+
+	// NullSession, if present, is the outcome of the anonymous session
+	// setup.
+	NullSession *NullSessionLog `json:"null_session,omitempty"`
 }
 
 // LoggedSession wraps the Session struct, and holds a Log struct alongside it
@@ -187,12 +218,50 @@ func fillHeaderLog(src *Header, dest *HeaderLog) *HeaderLog {
 	return dest
 }
 
-// GetSMBLog() determines the Protocol version and dialect, and optionally
-// negotiates a session.
-func GetSMBLog(conn net.Conn, session bool, v1 bool, debug bool) (smbLog *SMBLog, err error) {
-	opt := Options{}
+// dialectString returns the version string of an SMB2 dialect revision
+// (e.g. "SMB 2.1" for 0x0210).
+func dialectString(dialect uint16) string {
+	major := uint8(0x0f & (dialect >> 8))
+	minor := uint8(0x0f & (dialect >> 4))
+	revision := uint8(0x0f & dialect)
+	// To be pedantic, to match the MS documents in reference to SMB
+	// versions, we will not include revision values of '0' in the
+	// version string.  E.g., SMB 2.1 instead of SMB 2.1.0
+	if revision > 0 {
+		return fmt.Sprintf("SMB %d.%d.%d", major, minor, revision)
+	}
+	return fmt.Sprintf("SMB %d.%d", major, minor)
+}
 
-	s := &LoggedSession{
+// fillChallengeLog sets the OS version and the names of the server from an
+// NTLM challenge.
+func fillChallengeLog(challenge *ntlmssp.Challenge, dest *SessionSetupLog) {
+	if challenge.NegotiateFlags&ntlmssp.FlgNegVersion != 0 && challenge.Version != 0 {
+		version := challenge.Version
+		dest.OSVersion = fmt.Sprintf("%d.%d.%d", uint8(version), uint8(version>>8), uint16(version>>16))
+	}
+	if challenge.TargetInfo == nil {
+		return
+	}
+	for _, av := range *challenge.TargetInfo {
+		switch av.AvID {
+		case ntlmssp.MsvAvNbComputerName:
+			dest.NetBIOSComputerName = wstring(av.Value)
+		case ntlmssp.MsvAvNbDomainName:
+			dest.NetBIOSDomainName = wstring(av.Value)
+		case ntlmssp.MsvAvDnsComputerName:
+			dest.DNSComputerName = wstring(av.Value)
+		case ntlmssp.MsvAvDnsDomainName:
+			dest.DNSDomainName = wstring(av.Value)
+		case ntlmssp.MsvAvDnsTreeName:
+			dest.DNSForestName = wstring(av.Value)
+		}
+	}
+}
+
+// newLoggedSession returns a LoggedSession on conn.
+func newLoggedSession(conn net.Conn, debug bool) *LoggedSession {
+	return &LoggedSession{
 		Session: Session{
 			IsSigningRequired: false,
 			IsAuthenticated:   false,
@@ -202,10 +271,16 @@ func GetSMBLog(conn net.Conn, session bool, v1 bool, debug bool) (smbLog *SMBLog
 			sessionID:         0,
 			dialect:           0,
 			conn:              conn,
-			options:           opt,
+			options:           Options{},
 			trees:             make(map[string]uint32),
 		},
 	}
+}
+
+// GetSMBLog() determines the Protocol version and dialect, and optionally
+// negotiates a session.
+func GetSMBLog(conn net.Conn, session bool, v1 bool, debug bool) (smbLog *SMBLog, err error) {
+	s := newLoggedSession(conn, debug)
 
 	if v1 {
 		err = s.LoggedNegotiateProtocolv1(session)
@@ -262,6 +337,8 @@ func (ls *LoggedSession) LoggedNegotiateProtocolv1(setup bool) error {
 		s.Debug("Raw:\n"+hex.Dump(buf), err)
 		// Not returning error here, because the NegotiationResV1 is
 		// only valid for the extended NT LM 0.12 dialect of SMB1.
+	} else if negRes.WordCount == 17 && negRes.DialectIndex != 0xffff {
+		ls.Log.SigningRequired = negRes.SecurityMode&SecurityModeV1SigningRequired != 0
 	}
 
 	// TODO: Parse capabilities and return those results
@@ -304,6 +381,7 @@ func (ls *LoggedSession) LoggedNegotiateProtocol(setup bool) error {
 			Revision:  0,
 			VerString: "SMB 1.0"}
 	case ProtocolSmb2:
+		ls.Log.SigningRequired = negRes.SecurityMode&SecurityModeSigningRequired != 0
 		major := uint8(0x0f & (negRes.DialectRevision >> 8))
 		minor := uint8(0x0f & (negRes.DialectRevision >> 4))
 		revision := uint8(0x0f & negRes.DialectRevision)
@@ -334,21 +412,11 @@ func (ls *LoggedSession) LoggedNegotiateProtocol(setup bool) error {
 			// can decode them for all versions.  We also node the computed
 			// major/minor/revision numbers are valid, and match the explicitly
 			// defined versions in [MS-SMB2].
-			var verString string
-
-			// To be pedantic, to match the MS documents in reference to SMB
-			// versions, we will not include revision values of '0' in the
-			// version string.  E.g., SMB 2.1 instead of SMB 2.1.0
-			if revision > 0 {
-				verString = fmt.Sprintf("SMB %d.%d.%d", major, minor, revision)
-			} else {
-				verString = fmt.Sprintf("SMB %d.%d", major, minor)
-			}
 			ls.Log.Version = &SMBVersions{
 				Major:     major,
 				Minor:     minor,
 				Revision:  revision,
-				VerString: verString,
+				VerString: dialectString(negRes.DialectRevision),
 			}
 			ls.Log.Capabilities = &SMBCapabilities{
 				DFSSupport: caps&SMB2_CAP_DFS != 0,
@@ -468,6 +536,8 @@ func (ls *LoggedSession) LoggedNegotiateProtocol(setup bool) error {
 	}
 	logStruct.SessionSetupLog.TargetName = wstring(challenge.TargetName)
 	logStruct.SessionSetupLog.NegotiateFlags = challenge.NegotiateFlags
+	fillChallengeLog(&challenge, logStruct.SessionSetupLog)
+	s.sessionID = ssres.Header.SessionID
 
 	return nil
 }
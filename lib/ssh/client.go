@@ -281,6 +281,12 @@ type ClientConfig struct {
 	Timeout time.Duration
 
 	// If true, send the "none" Authentication Request to collect the advertised
-	// userauth method names, but do not attempt to authenticate.
+	// userauth method names, but do not attempt to authenticate, except with
+	// Credentials.
 	DontAuthenticate bool
+
+	// Credentials are attempted in turn after the "none" Authentication
+	// Request of DontAuthenticate, with the password or keyboard-interactive
+	// method, until one is accepted.
+	Credentials []Credential
 }
@@ -49,6 +49,7 @@ func (c *connection) clientAuthenticate(config *ClientConfig) error {
 			c.transport.config.ConnLog.UserAuth = methods
 		}
 		if config.DontAuthenticate {
+			c.tryCredentials(config, methods)
 			return nil
 		}
 
@@ -77,6 +78,63 @@ func (c *connection) clientAuthenticate(config *ClientConfig) error {
 	return fmt.Errorf("ssh: unable to authenticate, attempted methods %v, no supported methods remain", keys(tried))
 }
 
+// A Credential is a username and password attempted by a scan (see
+// ClientConfig.Credentials).
+type Credential struct {
+	User     string
+	Password string
+}
+
+// tryCredentials attempts each of config.Credentials in turn, with the
+// methods allowed by the server, until one is accepted, and records the
+// outcomes in ConnLog. It stops at the first error, as the connection is then
+// unusable.
+func (c *connection) tryCredentials(config *ClientConfig, methods []string) {
+	for _, cred := range config.Credentials {
+		auth := credentialAuth(cred, methods)
+		if auth == nil {
+			return
+		}
+		ok, next, err := auth.auth(c.transport.getSessionID(), cred.User, c.transport, config.Rand)
+		attempt := AuthAttempt{Username: cred.User, Method: auth.method(), Success: ok}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		if c.transport.config.ConnLog != nil {
+			c.transport.config.ConnLog.UserAuthAttempts = append(c.transport.config.ConnLog.UserAuthAttempts, attempt)
+		}
+		if ok || err != nil {
+			return
+		}
+		if next != nil {
+			methods = next
+		}
+	}
+}
+
+// credentialAuth returns the AuthMethod with which to attempt cred: password
+// if the server allows it, or else keyboard-interactive, answering every
+// prompt with the password. It returns nil if neither is allowed.
+func credentialAuth(cred Credential, methods []string) AuthMethod {
+	allowed := make(map[string]bool)
+	for _, method := range methods {
+		allowed[method] = true
+	}
+	switch {
+	case allowed["password"]:
+		return Password(cred.Password)
+	case allowed["keyboard-interactive"]:
+		return KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = cred.Password
+			}
+			return answers, nil
+		})
+	}
+	return nil
+}
+
 func keys(m map[string]bool) []string {
 	s := make([]string, 0, len(m))
 
@@ -470,3 +470,30 @@ func TestClientAuthNone(t *testing.T) {
 		t.Fatalf("server: got %q, want %q", serverConn.User(), user)
 	}
 }
+
+func TestTryCredentials(t *testing.T) {
+	log := new(HandshakeLog)
+	config := &ClientConfig{
+		User: "nobody",
+		Credentials: []Credential{
+			{User: "testuser", Password: "wrong"},
+			{User: "testuser", Password: clientPassword},
+			{User: "unused", Password: "x"},
+		},
+		DontAuthenticate: true,
+	}
+	config.ConnLog = log
+	if err := tryAuth(t, config); err != nil {
+		t.Fatalf("unable to dial remote side: %s", err)
+	}
+	if len(log.UserAuth) == 0 {
+		t.Errorf("no userauth methods recorded")
+	}
+	want := []AuthAttempt{
+		{Username: "testuser", Method: "password"},
+		{Username: "testuser", Method: "password", Success: true},
+	}
+	if fmt.Sprint(log.UserAuthAttempts) != fmt.Sprint(want) {
+		t.Errorf("got attempts %+v, want %+v", log.UserAuthAttempts, want)
+	}
+}
@@ -17,15 +17,34 @@ package ssh
 // HandshakeLog contains detailed information about each step of the
 // SSH handshake, and can be encoded to JSON.
 type HandshakeLog struct {
-	Banner             string       `json:"banner,omitempty"`
-	ServerID           *EndpointId  `json:"server_id,omitempty"`
-	ClientID           *EndpointId  `json:"client_id,omitempty"`
-	ServerKex          *KexInitMsg  `json:"server_key_exchange,omitempty"`
-	ClientKex          *KexInitMsg  `json:"client_key_exchange,omitempty"`
-	AlgorithmSelection *Algorithms  `json:"algorithm_selection,omitempty"`
-	DHKeyExchange      kexAlgorithm `json:"key_exchange,omitempty"`
-	UserAuth           []string     `json:"userauth,omitempty"`
-	Crypto             *kexResult   `json:"crypto,omitempty"`
+	Banner             string        `json:"banner,omitempty"`
+	ServerID           *EndpointId   `json:"server_id,omitempty"`
+	ClientID           *EndpointId   `json:"client_id,omitempty"`
+	ServerKex          *KexInitMsg   `json:"server_key_exchange,omitempty"`
+	ClientKex          *KexInitMsg   `json:"client_key_exchange,omitempty"`
+	AlgorithmSelection *Algorithms   `json:"algorithm_selection,omitempty"`
+	DHKeyExchange      kexAlgorithm  `json:"key_exchange,omitempty"`
+	UserAuth           []string      `json:"userauth,omitempty"`
+	UserAuthAttempts   []AuthAttempt `json:"userauth_attempts,omitempty"`
+	HostKeys           []HostKey     `json:"host_keys,omitempty"`
+	Crypto             *kexResult    `json:"crypto,omitempty"`
+}
+
+// AuthAttempt is the outcome of an attempt to authenticate with one of the
+// Credentials of the ClientConfig.
+type AuthAttempt struct {
+	Username string `json:"username"`
+	Method   string `json:"method"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+}
+
+// HostKey is the host key of the server for a host key algorithm, collected
+// by a handshake offering only that algorithm.
+type HostKey struct {
+	Algorithm string                `json:"algorithm"`
+	Key       *ServerHostKeyJsonLog `json:"key,omitempty"`
+	Error     string                `json:"error,omitempty"`
 }
 
 type EndpointId struct {
@@ -0,0 +1,396 @@
+// Package technology identifies the technologies (servers, frameworks,
+// applications) behind HTTP responses, with rules in the format of the
+// Wappalyzer technologies files.
+//
+// A rules file is a JSON object mapping technology names to rules:
+//
+//	{
+//	  "WordPress": {
+//	    "headers": {"X-Pingback": "/xmlrpc\\.php$"},
+//	    "cookies": {"wordpress_test_cookie": ""},
+//	    "html": ["<link [^>]+wp-(?:content|includes)"],
+//	    "meta": {"generator": "^WordPress ?([\\d.]+)?\\;version:\\1"},
+//	    "implies": ["PHP"],
+//	    "requests": ["/wp-login.php"]
+//	  }
+//	}
+//
+// Patterns are case-insensitive regular expressions, and an empty pattern
+// matches any value. As in Wappalyzer, a pattern may be followed by
+// "\;version:\1" to extract a version from a capture group, and by
+// "\;confidence:50" to lower the confidence of the match from 100. The
+// "requests" field, specific to zgrab2, lists paths to request from the server
+// when the technology is detected, whose responses are matched in turn.
+package technology
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Match is a technology detected in a response.
+type Match struct {
+	Name string `json:"name"`
+
+	// Version is the version extracted by the matching patterns, if any.
+	Version string `json:"version,omitempty"`
+
+	// Confidence is the sum of the confidences of the matching patterns,
+	// capped at 100.
+	Confidence int `json:"confidence"`
+
+	// Implied is true if the technology was not matched itself, but is
+	// implied by one that was.
+	Implied bool `json:"implied,omitempty"`
+}
+
+// Response holds the parts of an HTTP response that rules match.
+type Response struct {
+	// Headers maps header names to values; names are matched
+	// case-insensitively.
+	Headers map[string][]string
+
+	// Cookies maps the names of the cookies set by the response to their
+	// values.
+	Cookies map[string]string
+
+	// Body is the response body.
+	Body string
+}
+
+// pattern is a compiled rule pattern.
+type pattern struct {
+	re         *regexp.Regexp
+	version    string
+	confidence int
+}
+
+// rule holds the compiled patterns of a technology.
+type rule struct {
+	name     string
+	headers  map[string]*pattern
+	cookies  map[string]*pattern
+	html     []*pattern
+	meta     map[string]*pattern
+	implies  []string
+	requests []string
+}
+
+// Rules is a compiled set of technology rules.
+type Rules struct {
+	rules []*rule
+}
+
+// stringList is a JSON string or array of strings.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+// ruleJSON is the JSON representation of a rule. Fields of Wappalyzer rules
+// that do not apply to a single HTTP response (e.g. "js", "dom") are ignored.
+type ruleJSON struct {
+	Headers  map[string]string `json:"headers"`
+	Cookies  map[string]string `json:"cookies"`
+	HTML     stringList        `json:"html"`
+	Meta     map[string]string `json:"meta"`
+	Implies  stringList        `json:"implies"`
+	Requests stringList        `json:"requests"`
+}
+
+// Load reads the rules file at path.
+func Load(path string) (*Rules, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return rules, nil
+}
+
+// Parse compiles the rules in data, a JSON object mapping technology names to
+// rules. A Wappalyzer file whose technologies are under a "technologies" key
+// is also accepted.
+func Parse(data []byte) (*Rules, error) {
+	var file struct {
+		Technologies map[string]ruleJSON `json:"technologies"`
+	}
+	if err := json.Unmarshal(data, &file); err == nil && len(file.Technologies) > 0 {
+		return compile(file.Technologies)
+	}
+	var techs map[string]ruleJSON
+	if err := json.Unmarshal(data, &techs); err != nil {
+		return nil, err
+	}
+	return compile(techs)
+}
+
+func compile(techs map[string]ruleJSON) (*Rules, error) {
+	names := make([]string, 0, len(techs))
+	for name := range techs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ret := new(Rules)
+	for _, name := range names {
+		t := techs[name]
+		r := &rule{name: name, implies: t.Implies, requests: t.Requests}
+		var err error
+		if r.headers, err = compileMap(t.Headers, true); err != nil {
+			return nil, fmt.Errorf("%s: headers: %s", name, err)
+		}
+		if r.cookies, err = compileMap(t.Cookies, false); err != nil {
+			return nil, fmt.Errorf("%s: cookies: %s", name, err)
+		}
+		if r.meta, err = compileMap(t.Meta, true); err != nil {
+			return nil, fmt.Errorf("%s: meta: %s", name, err)
+		}
+		for _, s := range t.HTML {
+			p, err := compilePattern(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: html: %s", name, err)
+			}
+			r.html = append(r.html, p)
+		}
+		for i, implied := range r.implies {
+			// Implied technologies may carry a confidence, which is
+			// not used.
+			r.implies[i] = strings.SplitN(implied, `\;`, 2)[0]
+		}
+		ret.rules = append(ret.rules, r)
+	}
+	return ret, nil
+}
+
+func compileMap(m map[string]string, lower bool) (map[string]*pattern, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	ret := make(map[string]*pattern, len(m))
+	for k, v := range m {
+		p, err := compilePattern(v)
+		if err != nil {
+			return nil, err
+		}
+		if lower {
+			k = strings.ToLower(k)
+		}
+		ret[k] = p
+	}
+	return ret, nil
+}
+
+// compilePattern compiles a pattern with its optional version and confidence
+// tags.
+func compilePattern(s string) (*pattern, error) {
+	parts := strings.Split(s, `\;`)
+	re, err := regexp.Compile("(?i)" + parts[0])
+	if err != nil {
+		return nil, err
+	}
+	p := &pattern{re: re, confidence: 100}
+	for _, tag := range parts[1:] {
+		kv := strings.SplitN(tag, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "version":
+			p.version = kv[1]
+		case "confidence":
+			if c, err := strconv.Atoi(kv[1]); err == nil {
+				p.confidence = c
+			}
+		}
+	}
+	return p, nil
+}
+
+// backref matches the capture group references of version templates.
+var backref = regexp.MustCompile(`\\(\d)`)
+
+// match matches p against s, returning whether it matched and the version it
+// extracted.
+func (p *pattern) match(s string) (bool, string) {
+	groups := p.re.FindStringSubmatch(s)
+	if groups == nil {
+		return false, ""
+	}
+	if p.version == "" {
+		return true, ""
+	}
+	version := backref.ReplaceAllStringFunc(p.version, func(ref string) string {
+		i := int(ref[1] - '0')
+		if i < len(groups) {
+			return groups[i]
+		}
+		return ""
+	})
+	return true, strings.TrimSpace(version)
+}
+
+// metaTag matches the <meta> elements of a page, and metaAttr their
+// attributes.
+var (
+	metaTag  = regexp.MustCompile(`(?i)<meta\s[^>]*>`)
+	metaAttr = regexp.MustCompile(`(?i)\b(name|property|http-equiv|content)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// metaTags returns the contents of the named <meta> elements of body, by
+// lower-case name.
+func metaTags(body string) map[string][]string {
+	ret := make(map[string][]string)
+	for _, tag := range metaTag.FindAllString(body, -1) {
+		var name, content string
+		hasContent := false
+		for _, attr := range metaAttr.FindAllStringSubmatch(tag, -1) {
+			value := attr[2] + attr[3] + attr[4]
+			if strings.EqualFold(attr[1], "content") {
+				content, hasContent = value, true
+			} else if name == "" {
+				name = strings.ToLower(value)
+			}
+		}
+		if name != "" && hasContent {
+			ret[name] = append(ret[name], content)
+		}
+	}
+	return ret
+}
+
+// Match returns the technologies detected in resp, in the order of the
+// rules, followed by the technologies they imply.
+func (r *Rules) Match(resp *Response) []Match {
+	headers := make(map[string][]string, len(resp.Headers))
+	for k, v := range resp.Headers {
+		headers[strings.ToLower(k)] = append(headers[strings.ToLower(k)], v...)
+	}
+	var meta map[string][]string
+	var ret []Match
+	index := make(map[string]int)
+	for _, rule := range r.rules {
+		m := Match{Name: rule.name}
+		matched := false
+		add := func(p *pattern, values ...string) {
+			for _, v := range values {
+				if ok, version := p.match(v); ok {
+					matched = true
+					m.Confidence += p.confidence
+					if m.Version == "" {
+						m.Version = version
+					}
+					return
+				}
+			}
+		}
+		for name, p := range rule.headers {
+			add(p, headers[name]...)
+		}
+		for name, p := range rule.cookies {
+			if v, ok := resp.Cookies[name]; ok {
+				add(p, v)
+			}
+		}
+		for _, p := range rule.html {
+			add(p, resp.Body)
+		}
+		if len(rule.meta) > 0 {
+			if meta == nil {
+				meta = metaTags(resp.Body)
+			}
+			for name, p := range rule.meta {
+				add(p, meta[name]...)
+			}
+		}
+		if !matched {
+			continue
+		}
+		if m.Confidence > 100 {
+			m.Confidence = 100
+		}
+		index[m.Name] = len(ret)
+		ret = append(ret, m)
+	}
+	// Add the implied technologies, transitively.
+	for i := 0; i < len(ret); i++ {
+		rule := r.find(ret[i].Name)
+		if rule == nil {
+			continue
+		}
+		for _, name := range rule.implies {
+			if _, ok := index[name]; ok {
+				continue
+			}
+			index[name] = len(ret)
+			ret = append(ret, Match{Name: name, Confidence: ret[i].Confidence, Implied: true})
+		}
+	}
+	return ret
+}
+
+// Requests returns the paths to request for the matched technologies,
+// without duplicates.
+func (r *Rules) Requests(matches []Match) []string {
+	var ret []string
+	seen := make(map[string]bool)
+	for _, m := range matches {
+		rule := r.find(m.Name)
+		if rule == nil {
+			continue
+		}
+		for _, path := range rule.requests {
+			if !seen[path] {
+				seen[path] = true
+				ret = append(ret, path)
+			}
+		}
+	}
+	return ret
+}
+
+func (r *Rules) find(name string) *rule {
+	i := sort.Search(len(r.rules), func(i int) bool { return r.rules[i].name >= name })
+	if i < len(r.rules) && r.rules[i].name == name {
+		return r.rules[i]
+	}
+	return nil
+}
+
+// Merge adds the matches of more to matches, keeping for each technology the
+// highest confidence and the first version found.
+func Merge(matches []Match, more []Match) []Match {
+	for _, m := range more {
+		found := false
+		for i := range matches {
+			if matches[i].Name != m.Name {
+				continue
+			}
+			found = true
+			if m.Confidence > matches[i].Confidence {
+				matches[i].Confidence = m.Confidence
+			}
+			if matches[i].Version == "" {
+				matches[i].Version = m.Version
+			}
+			matches[i].Implied = matches[i].Implied && m.Implied
+		}
+		if !found {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,89 @@
+package technology
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testRules = `{
+  "WordPress": {
+    "cats": [1],
+    "html": ["<link [^>]+wp-(?:content|includes)", "<script [^>]+wp-emoji\\;confidence:20"],
+    "meta": {"generator": "^WordPress ?([\\d.]+)?\\;version:\\1"},
+    "implies": ["PHP", "MySQL\\;confidence:50"],
+    "requests": ["/wp-login.php"]
+  },
+  "PHP": {
+    "headers": {"X-Powered-By": "^php/?([\\d.]+)?\\;version:\\1"},
+    "cookies": {"PHPSESSID": ""}
+  },
+  "nginx": {
+    "headers": {"Server": "nginx(?:/([\\d.]+))?\\;version:\\1"},
+    "requests": "/nginx_status"
+  },
+  "Varnish": {
+    "headers": {"Via": "varnish\\;confidence:50", "X-Varnish": ""}
+  },
+  "MySQL": {}
+}`
+
+func TestMatch(t *testing.T) {
+	rules, err := Parse([]byte(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &Response{
+		Headers: map[string][]string{
+			"server":       {"nginx/1.14.0 (Ubuntu)"},
+			"X-Powered-By": {"PHP/7.2.1"},
+			"Via":          {"1.1 varnish"},
+		},
+		Cookies: map[string]string{"PHPSESSID": "abc"},
+		Body:    `<html><head><meta content='WordPress 5.2.3' name="generator"><link rel='stylesheet' href='/wp-content/a.css'></head></html>`,
+	}
+	expected := []Match{
+		{Name: "PHP", Version: "7.2.1", Confidence: 100},
+		{Name: "Varnish", Confidence: 50},
+		{Name: "WordPress", Version: "5.2.3", Confidence: 100},
+		{Name: "nginx", Version: "1.14.0", Confidence: 100},
+		{Name: "MySQL", Confidence: 100, Implied: true},
+	}
+	matches := rules.Match(resp)
+	if !reflect.DeepEqual(matches, expected) {
+		t.Errorf("Match = %+v; expected %+v", matches, expected)
+	}
+	if requests := rules.Requests(matches); !reflect.DeepEqual(requests, []string{"/wp-login.php", "/nginx_status"}) {
+		t.Errorf("Requests = %v", requests)
+	}
+
+	if matches := rules.Match(&Response{Body: "<script src='wp-emoji.js'>"}); !reflect.DeepEqual(matches, []Match{
+		{Name: "WordPress", Confidence: 20},
+		{Name: "PHP", Confidence: 20, Implied: true},
+		{Name: "MySQL", Confidence: 20, Implied: true},
+	}) {
+		t.Errorf("Match of a weak pattern = %+v", matches)
+	}
+}
+
+func TestParse(t *testing.T) {
+	// The technologies may be under a "technologies" key.
+	rules, err := Parse([]byte(`{"technologies": {"IIS": {"headers": {"Server": "^Microsoft-IIS"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := rules.Match(&Response{Headers: map[string][]string{"Server": {"Microsoft-IIS/10.0"}}}); len(m) != 1 || m[0].Name != "IIS" {
+		t.Errorf("Match = %+v", m)
+	}
+	if _, err := Parse([]byte(`{"Bad": {"html": "("}}`)); err == nil {
+		t.Errorf("Parse accepted an invalid pattern")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	matches := []Match{{Name: "PHP", Confidence: 50, Implied: true}}
+	matches = Merge(matches, []Match{{Name: "PHP", Version: "7.2", Confidence: 100}, {Name: "nginx", Confidence: 100}})
+	expected := []Match{{Name: "PHP", Version: "7.2", Confidence: 100}, {Name: "nginx", Confidence: 100}}
+	if !reflect.DeepEqual(matches, expected) {
+		t.Errorf("Merge = %+v; expected %+v", matches, expected)
+	}
+}
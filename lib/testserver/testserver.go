@@ -0,0 +1,290 @@
+// Package testserver runs fake servers on the loopback interface for testing
+// scan modules: servers sending a canned banner, running a scripted exchange
+// of requests and responses or a handler for the protocols a script cannot
+// describe, optionally over TLS with a generated certificate, and UDP servers
+// answering each datagram.
+package testserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout bounds each connection of a Server whose Config has no
+// Timeout.
+const DefaultTimeout = 10 * time.Second
+
+// Step is a single step of the exchange a Server runs on each connection.
+type Step struct {
+	// Expect, if not nil, must match the data received since the previous
+	// step before Send is sent.
+	Expect *regexp.Regexp
+
+	// Send is sent once Expect matches.
+	Send []byte
+}
+
+// Exchange returns a Step sending response once the data received matches
+// the regular expression request.
+func Exchange(request, response string) Step {
+	return Step{Expect: regexp.MustCompile(request), Send: []byte(response)}
+}
+
+// Config describes the behavior of a Server on each connection.
+type Config struct {
+	// Banner is sent as soon as the connection is accepted (after the TLS
+	// handshake, with TLS).
+	Banner []byte
+
+	// Script is run after the banner is sent.
+	Script []Step
+
+	// Handler, if not nil, is run on the connection once the script is
+	// done, for the exchanges a script cannot describe. Its error is
+	// recorded like those of the script.
+	Handler func(conn net.Conn) error
+
+	// TLS, if true, makes the server speak TLS.
+	TLS bool
+
+	// Certificate is the certificate of the TLS server. If nil, a
+	// self-signed certificate for localhost is generated.
+	Certificate *tls.Certificate
+
+	// KeepOpen, if true, keeps the connection open once the script is done,
+	// until the client closes it.
+	KeepOpen bool
+
+	// Timeout bounds each connection (default DefaultTimeout).
+	Timeout time.Duration
+}
+
+// Server is a fake TCP server listening on the loopback interface.
+type Server struct {
+	config   Config
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// New starts a Server with the given configuration on a free port.
+func New(config Config) (*Server, error) {
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	if config.TLS {
+		if config.Certificate == nil {
+			cert, err := GenerateCertificate("localhost", "127.0.0.1")
+			if err != nil {
+				listener.Close()
+				return nil, err
+			}
+			config.Certificate = &cert
+		}
+		listener = tls.NewListener(listener, &tls.Config{Certificates: []tls.Certificate{*config.Certificate}})
+	}
+	s := &Server{config: config, listener: listener}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Port returns the port the server listens on.
+func (s *Server) Port() uint {
+	return uint(s.listener.Addr().(*net.TCPAddr).Port)
+}
+
+// Close stops the server, and waits for the connections in progress to end.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+// Err returns the first error of the connections handled so far, e.g. a
+// script step whose request was not received, or nil.
+func (s *Server) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.errs) == 0 {
+		return nil
+	}
+	return s.errs[0]
+}
+
+func (s *Server) fail(err error) {
+	s.mu.Lock()
+	s.errs = append(s.errs, err)
+	s.mu.Unlock()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			if err := s.handle(conn); err != nil {
+				s.fail(err)
+			}
+		}()
+	}
+}
+
+// handle runs the exchange of the configuration on conn.
+func (s *Server) handle(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(s.config.Timeout))
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			return fmt.Errorf("TLS handshake: %s", err)
+		}
+	}
+	if len(s.config.Banner) > 0 {
+		if _, err := conn.Write(s.config.Banner); err != nil {
+			return err
+		}
+	}
+	var received []byte
+	buf := make([]byte, 4096)
+	for i, step := range s.config.Script {
+		for step.Expect != nil {
+			if loc := step.Expect.FindIndex(received); loc != nil {
+				// Keep what follows the match for the next steps.
+				received = received[loc[1]:]
+				break
+			}
+			n, err := conn.Read(buf)
+			if err != nil {
+				return fmt.Errorf("step %d: expected %q, received %q: %s", i, step.Expect, received, err)
+			}
+			received = append(received, buf[:n]...)
+		}
+		if _, err := conn.Write(step.Send); err != nil {
+			return err
+		}
+	}
+	if s.config.Handler != nil {
+		if err := s.config.Handler(conn); err != nil {
+			return err
+		}
+	}
+	if s.config.KeepOpen {
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// UDPServer is a fake UDP server listening on the loopback interface.
+type UDPServer struct {
+	conn net.PacketConn
+	done chan struct{}
+}
+
+// NewUDP starts a UDPServer on a free port, answering each datagram received
+// with the response returned by handler, if it is not empty.
+func NewUDP(handler func(request []byte) []byte) (*UDPServer, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &UDPServer{conn: conn, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response := handler(buf[:n]); len(response) > 0 {
+				conn.WriteTo(response, addr)
+			}
+		}
+	}()
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *UDPServer) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Port returns the port the server listens on.
+func (s *UDPServer) Port() uint {
+	return uint(s.conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+// Close stops the server.
+func (s *UDPServer) Close() error {
+	err := s.conn.Close()
+	<-s.done
+	return err
+}
+
+// GenerateCertificate returns a self-signed ECDSA certificate, valid for a
+// day, for the given host names and IP addresses.
+func GenerateCertificate(hosts ...string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"zgrab2 test server"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(hosts) > 0 {
+		template.Subject.CommonName = hosts[0]
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
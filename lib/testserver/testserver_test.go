@@ -0,0 +1,142 @@
+package testserver
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerScript(t *testing.T) {
+	s, err := New(Config{
+		Banner: []byte("220 ready\r\n"),
+		Script: []Step{
+			Exchange(`HELO \S+\r\n`, "250 hello\r\n"),
+			Exchange(`QUIT\r\n`, "221 bye\r\n"),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	// Both requests are sent at once: the second is kept for the next step.
+	conn.Write([]byte("HELO example.com\r\nQUIT\r\n"))
+	reader := bufio.NewReader(conn)
+	for _, expected := range []string{"220 ready\r\n", "250 hello\r\n", "221 bye\r\n"} {
+		line, err := reader.ReadString('\n')
+		if err != nil || line != expected {
+			t.Fatalf("got %q, %v; expected %q", line, err, expected)
+		}
+	}
+	s.Close()
+	if err := s.Err(); err != nil {
+		t.Error(err)
+	}
+
+	// A request that does not match fails the exchange.
+	s, _ = New(Config{Script: []Step{Exchange(`^PING`, "+PONG\r\n")}, Timeout: time.Second})
+	conn, _ = net.Dial("tcp", s.Addr())
+	conn.Write([]byte("INFO\r\n"))
+	conn.Close()
+	s.Close()
+	if err := s.Err(); err == nil || !strings.Contains(err.Error(), "step 0") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestServerHandler(t *testing.T) {
+	s, err := New(Config{
+		Banner: []byte("+OK\r\n"),
+		Handler: func(conn net.Conn) error {
+			// Echo each line, until QUIT.
+			reader := bufio.NewReader(conn)
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return err
+				}
+				if line == "QUIT\r\n" {
+					return nil
+				}
+				conn.Write([]byte(line))
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("one\r\ntwo\r\nQUIT\r\n"))
+	reader := bufio.NewReader(conn)
+	for _, expected := range []string{"+OK\r\n", "one\r\n", "two\r\n"} {
+		line, err := reader.ReadString('\n')
+		if err != nil || line != expected {
+			t.Fatalf("got %q, %v; expected %q", line, err, expected)
+		}
+	}
+	s.Close()
+	if err := s.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServerTLS(t *testing.T) {
+	s, err := New(Config{TLS: true, Banner: []byte("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	conn, err := tls.Dial("tcp", s.Addr(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) != 1 || certs[0].Subject.CommonName != "localhost" {
+		t.Fatalf("got certificates %v", certs)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(certs[0])
+	if _, err := certs[0].Verify(x509.VerifyOptions{Roots: roots, DNSName: "127.0.0.1"}); err != nil {
+		t.Error(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "hello" {
+		t.Errorf("got banner %q, %v", buf, err)
+	}
+}
+
+func TestUDPServer(t *testing.T) {
+	s, err := NewUDP(func(request []byte) []byte {
+		return append([]byte("echo "), request...)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	conn, err := net.Dial("udp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "echo ping" {
+		t.Errorf("got %q, %v", buf[:n], err)
+	}
+}
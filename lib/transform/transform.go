@@ -0,0 +1,392 @@
+// Package transform rewrites the fields of decoded JSON records (as produced
+// by encoding/json into interface{}) so that scan results can be shared
+// without the personal data they may contain: fields can be replaced by a
+// hash or an HMAC, IP addresses truncated to their prefix, matches of a
+// regular expression redacted, or fields dropped.
+package transform
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The actions of a Rule.
+const (
+	// Hash replaces the field with the hex SHA-256 hash of its value. Hashes
+	// of values from a small set, such as IP addresses, can be reversed by
+	// brute force; use HMAC for those.
+	Hash = "hash"
+
+	// HMAC replaces the field with the hex HMAC-SHA256 of its value, keyed
+	// with the key of the Transformer.
+	HMAC = "hmac"
+
+	// TruncateIP replaces an IP address with the first address of its
+	// prefix. The address can have a port, as in 192.0.2.1:80 or
+	// [2001:db8::1]:80, which is kept, or a prefix length, as in
+	// 192.0.2.0/28, which is shortened to that of the rule if longer.
+	// Values that are not IP addresses are left unchanged.
+	TruncateIP = "truncate-ip"
+
+	// Redact replaces the matches of the rule's pattern, or of its groups if
+	// it has any, with the rule's replacement.
+	Redact = "redact"
+
+	// Drop removes the field.
+	Drop = "drop"
+)
+
+// DefaultReplacement replaces the matches of a Redact rule without a
+// replacement.
+const DefaultReplacement = "[redacted]"
+
+// Rule is a transformation of the fields at a path.
+type Rule struct {
+	// Path is the dotted path of the fields, in which "*" matches any key or
+	// array index. If a field is an object or an array, the rule applies to
+	// all the values below it.
+	Path string `json:"path"`
+
+	// Action is one of Hash, HMAC, TruncateIP, Redact or Drop.
+	Action string `json:"action"`
+
+	// Pattern is the regular expression of a Redact rule.
+	Pattern string `json:"pattern,omitempty"`
+
+	// Replacement replaces the matches of a Redact rule (default
+	// DefaultReplacement).
+	Replacement string `json:"replacement,omitempty"`
+
+	// IPv4Prefix and IPv6Prefix are the prefix lengths kept by a TruncateIP
+	// rule (default 24 and 48).
+	IPv4Prefix int `json:"ipv4_prefix,omitempty"`
+	IPv6Prefix int `json:"ipv6_prefix,omitempty"`
+
+	// Everywhere, for a Hash, HMAC or TruncateIP rule, replaces the
+	// occurrences of the string values at Path in all the strings of the
+	// record, such as URLs, host names and addresses with a port, with
+	// their transformed value. It is meant for IP addresses, whose
+	// occurrences are only replaced if not part of a longer address or
+	// number.
+	Everywhere bool `json:"everywhere,omitempty"`
+}
+
+// LoadRules reads a JSON array of rules from a file.
+func LoadRules(name string) ([]Rule, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules in %s: %s", name, err)
+	}
+	return rules, nil
+}
+
+// rule is a validated Rule.
+type rule struct {
+	Rule
+	path    []string
+	pattern *regexp.Regexp
+	v4Mask  net.IPMask
+	v6Mask  net.IPMask
+}
+
+// Transformer applies a list of rules to records.
+type Transformer struct {
+	rules []*rule
+	key   []byte
+}
+
+// New returns a Transformer applying the rules in order. The key is used by
+// the HMAC rules, and is required if there are any.
+func New(rules []Rule, key []byte) (*Transformer, error) {
+	t := &Transformer{key: key}
+	for i, r := range rules {
+		compiled := &rule{Rule: r}
+		if compiled.Path = strings.TrimSpace(r.Path); compiled.Path == "" {
+			return nil, fmt.Errorf("rule %d has no path", i)
+		}
+		compiled.path = strings.Split(compiled.Path, ".")
+		switch r.Action {
+		case Hash, Drop:
+		case HMAC:
+			if len(key) == 0 {
+				return nil, fmt.Errorf("rule %d (%s) needs an HMAC key", i, r.Path)
+			}
+		case TruncateIP:
+			v4, v6 := r.IPv4Prefix, r.IPv6Prefix
+			if v4 == 0 {
+				v4 = 24
+			}
+			if v6 == 0 {
+				v6 = 48
+			}
+			if v4 < 0 || v4 > 32 || v6 < 0 || v6 > 128 {
+				return nil, fmt.Errorf("rule %d (%s) has an invalid prefix length", i, r.Path)
+			}
+			compiled.v4Mask, compiled.v6Mask = net.CIDRMask(v4, 32), net.CIDRMask(v6, 128)
+		case Redact:
+			var err error
+			if compiled.pattern, err = regexp.Compile(r.Pattern); err != nil {
+				return nil, fmt.Errorf("rule %d (%s) has an invalid pattern: %s", i, r.Path, err)
+			}
+			if compiled.Replacement == "" {
+				compiled.Replacement = DefaultReplacement
+			}
+		default:
+			return nil, fmt.Errorf("rule %d (%s) has an unknown action %q", i, r.Path, r.Action)
+		}
+		if r.Everywhere && r.Action != Hash && r.Action != HMAC && r.Action != TruncateIP {
+			return nil, fmt.Errorf("rule %d (%s) can't apply everywhere with action %q", i, r.Path, r.Action)
+		}
+		t.rules = append(t.rules, compiled)
+	}
+	return t, nil
+}
+
+// Apply applies the rules to v, and returns the transformed value. Maps and
+// lists are modified in place.
+func (t *Transformer) Apply(v interface{}) interface{} {
+	for _, r := range t.rules {
+		if r.Everywhere {
+			for _, old := range collect(r.path, v, nil) {
+				v = replaceAddress(v, old, t.value(r, old))
+			}
+			continue
+		}
+		v, _ = t.apply(r, v, 0)
+	}
+	return v
+}
+
+// collect appends the non-empty string values at path in v to values.
+func collect(path []string, v interface{}, values []string) []string {
+	if len(path) == 0 {
+		if s, ok := v.(string); ok && s != "" {
+			values = append(values, s)
+		}
+		return values
+	}
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, c := range node {
+			if path[0] == "*" || path[0] == k {
+				values = collect(path[1:], c, values)
+			}
+		}
+	case []interface{}:
+		for i, c := range node {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				values = collect(path[1:], c, values)
+			}
+		}
+	}
+	return values
+}
+
+// replaceAddress returns v with the occurrences of the address old in all
+// the strings in it replaced by new. Maps and lists are modified in place.
+func replaceAddress(v interface{}, old, new string) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, c := range node {
+			node[k] = replaceAddress(c, old, new)
+		}
+	case []interface{}:
+		for i, c := range node {
+			node[i] = replaceAddress(c, old, new)
+		}
+	case string:
+		var b strings.Builder
+		last := 0
+		for i := 0; i <= len(node)-len(old); {
+			j := strings.Index(node[i:], old)
+			if j < 0 {
+				break
+			}
+			start, end := i+j, i+j+len(old)
+			if (start == 0 || !isAddressByte(node[start-1], true)) && (end == len(node) || !isAddressByte(node[end], strings.Contains(old, ":"))) {
+				b.WriteString(node[last:start])
+				b.WriteString(new)
+				last = end
+				i = end
+			} else {
+				i = start + 1
+			}
+		}
+		if last == 0 {
+			return node
+		}
+		b.WriteString(node[last:])
+		return b.String()
+	}
+	return v
+}
+
+// isAddressByte returns true if c can continue an IP address: a hex digit or
+// a dot, or a colon if colon is set.
+func isAddressByte(c byte, colon bool) bool {
+	switch {
+	case c >= '0' && c <= '9', c >= 'a' && c <= 'f', c >= 'A' && c <= 'F', c == '.':
+		return true
+	case c == ':':
+		return colon
+	}
+	return false
+}
+
+// apply applies r to v, the value at depth in the record, and returns the
+// transformed value, and false if it is dropped.
+func (t *Transformer) apply(r *rule, v interface{}, depth int) (interface{}, bool) {
+	if depth == len(r.path) {
+		if r.Action == Drop {
+			return nil, false
+		}
+		return t.rewrite(r, v), true
+	}
+	key := r.path[depth]
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, c := range node {
+			if key != "*" && key != k {
+				continue
+			}
+			if c, ok := t.apply(r, c, depth+1); ok {
+				node[k] = c
+			} else {
+				delete(node, k)
+			}
+		}
+	case []interface{}:
+		kept := node[:0]
+		for i, c := range node {
+			if key == "*" || key == strconv.Itoa(i) {
+				var ok bool
+				if c, ok = t.apply(r, c, depth+1); !ok {
+					continue
+				}
+			}
+			kept = append(kept, c)
+		}
+		return kept, true
+	}
+	return v, true
+}
+
+// rewrite returns v with all the values in it transformed by r.
+func (t *Transformer) rewrite(r *rule, v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, c := range node {
+			node[k] = t.rewrite(r, c)
+		}
+		return node
+	case []interface{}:
+		for i, c := range node {
+			node[i] = t.rewrite(r, c)
+		}
+		return node
+	case string:
+		return t.value(r, node)
+	case json.Number:
+		if r.Action == Hash || r.Action == HMAC {
+			return t.value(r, string(node))
+		}
+	case float64:
+		if r.Action == Hash || r.Action == HMAC {
+			return t.value(r, strconv.FormatFloat(node, 'f', -1, 64))
+		}
+	}
+	return v
+}
+
+// value returns the string s transformed by r.
+func (t *Transformer) value(r *rule, s string) string {
+	switch r.Action {
+	case Hash:
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	case HMAC:
+		mac := hmac.New(sha256.New, t.key)
+		mac.Write([]byte(s))
+		return hex.EncodeToString(mac.Sum(nil))
+	case TruncateIP:
+		return truncateIP(r, s)
+	case Redact:
+		return redact(r.pattern, r.Replacement, s)
+	}
+	return s
+}
+
+// truncateIP returns the address s, with an optional port or prefix length,
+// truncated to the prefix of r, or s if it is not an address.
+func truncateIP(r *rule, s string) string {
+	if ip := net.ParseIP(s); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4.Mask(r.v4Mask).String()
+		}
+		return ip.Mask(r.v6Mask).String()
+	}
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			return net.JoinHostPort(truncateIP(r, host), port)
+		}
+		return s
+	}
+	if ip, network, err := net.ParseCIDR(s); err == nil {
+		mask := r.v6Mask
+		if ip.To4() != nil {
+			mask = r.v4Mask
+		}
+		keep, _ := mask.Size()
+		if length, _ := network.Mask.Size(); keep < length {
+			network.Mask = mask
+			network.IP = network.IP.Mask(mask)
+		}
+		return network.String()
+	}
+	return s
+}
+
+// redact replaces the matches of pattern in s, or of its groups if it has
+// any, with replacement.
+func redact(pattern *regexp.Regexp, replacement, s string) string {
+	matches := pattern.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		spans := [][]int{m[:2]}
+		if len(m) > 2 {
+			spans = spans[:0]
+			for g := 2; g < len(m); g += 2 {
+				if m[g] >= 0 {
+					spans = append(spans, m[g:g+2])
+				}
+			}
+		}
+		for _, span := range spans {
+			if span[0] < last {
+				// Nested groups: the outer one is already redacted.
+				continue
+			}
+			b.WriteString(s[last:span[0]])
+			b.WriteString(replacement)
+			last = span[1]
+		}
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
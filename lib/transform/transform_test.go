@@ -0,0 +1,123 @@
+package transform
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	var ret interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&ret); err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func encode(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestTransformer(t *testing.T) {
+	key := []byte("secret")
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("example.com"))
+	domainMAC := hex.EncodeToString(mac.Sum(nil))
+	sum := sha256.Sum256([]byte("2222"))
+	portHash := hex.EncodeToString(sum[:])
+
+	record := `{"ip":"192.0.2.77","domain":"example.com","port":2222,"data":{"ftp":{"result":{"banner":"220 welcome user=alice, uid 1000","users":["alice","bob"]}},"telnet":{"result":{"banner":"login: "}}}}`
+	tests := []struct {
+		rules    []Rule
+		expected string
+	}{
+		{
+			[]Rule{{Path: "ip", Action: TruncateIP}},
+			`{"data":{"ftp":{"result":{"banner":"220 welcome user=alice, uid 1000","users":["alice","bob"]}},"telnet":{"result":{"banner":"login: "}}},"domain":"example.com","ip":"192.0.2.0","port":2222}`,
+		},
+		{
+			[]Rule{{Path: "domain", Action: HMAC}, {Path: "port", Action: Hash}, {Path: "ip", Action: TruncateIP, IPv4Prefix: 16}},
+			`{"data":{"ftp":{"result":{"banner":"220 welcome user=alice, uid 1000","users":["alice","bob"]}},"telnet":{"result":{"banner":"login: "}}},"domain":"` + domainMAC + `","ip":"192.0.0.0","port":"` + portHash + `"}`,
+		},
+		{
+			// A redaction with a group only replaces the group, in every
+			// result.
+			[]Rule{{Path: "data.*.result.banner", Action: Redact, Pattern: `user=(\w+)`}, {Path: "data.ftp.result.users", Action: Drop}, {Path: "ip", Action: Drop}},
+			`{"data":{"ftp":{"result":{"banner":"220 welcome user=[redacted], uid 1000"}},"telnet":{"result":{"banner":"login: "}}},"domain":"example.com","port":2222}`,
+		},
+		{
+			[]Rule{{Path: "data.ftp.result.users.1", Action: Drop}, {Path: "data.ftp.result.banner", Action: Redact, Pattern: `\d+`, Replacement: "N"}},
+			`{"data":{"ftp":{"result":{"banner":"N welcome user=alice, uid N","users":["alice"]}},"telnet":{"result":{"banner":"login: "}}},"domain":"example.com","ip":"192.0.2.77","port":2222}`,
+		},
+	}
+	for i, test := range tests {
+		transformer, err := New(test.rules, key)
+		if err != nil {
+			t.Fatalf("test %d: %s", i, err)
+		}
+		if got := encode(t, transformer.Apply(decode(t, record))); got != test.expected {
+			t.Errorf("test %d: got %s\nexpected %s", i, got, test.expected)
+		}
+	}
+
+	transformer, _ := New([]Rule{{Path: "ip", Action: TruncateIP}}, nil)
+	if got := encode(t, transformer.Apply(decode(t, `{"ip":"2001:db8:1:2::1"}`))); got != `{"ip":"2001:db8:1::"}` {
+		t.Errorf("got %s", got)
+	}
+
+	// Addresses with a port or a prefix length are truncated too.
+	for value, expected := range map[string]string{
+		"192.0.2.77:8080":       "192.0.2.0:8080",
+		"[2001:db8:1:2::1]:443": "[2001:db8:1::]:443",
+		"192.0.2.64/26":         "192.0.2.0/24",
+		"192.0.0.0/16":          "192.0.0.0/16",
+		"2001:db8:1:2::/64":     "2001:db8:1::/48",
+		"example.com:80":        "example.com:80",
+		"not an address":        "not an address",
+	} {
+		got := transformer.Apply(map[string]interface{}{"ip": value})
+		if got := got.(map[string]interface{})["ip"]; got != expected {
+			t.Errorf("truncating %s: got %v; expected %s", value, got, expected)
+		}
+	}
+
+	// The occurrences of the address in the other strings are replaced,
+	// but not those in longer numbers or addresses.
+	transformer, _ = New([]Rule{{Path: "ip", Action: TruncateIP, Everywhere: true}}, nil)
+	record = `{"ip":"192.0.2.7","data":{"http":{"result":{"request":{"host":"192.0.2.7","url":"http://192.0.2.7:8080/x?from=192.0.2.77"}},"trace":[{"remote":"192.0.2.7:8080"},{"remote":"10.192.0.2.7"}]}}}`
+	expected := `{"data":{"http":{"result":{"request":{"host":"192.0.2.0","url":"http://192.0.2.0:8080/x?from=192.0.2.77"}},"trace":[{"remote":"192.0.2.0:8080"},{"remote":"10.192.0.2.7"}]}},"ip":"192.0.2.0"}`
+	if got := encode(t, transformer.Apply(decode(t, record))); got != expected {
+		t.Errorf("got %s\nexpected %s", got, expected)
+	}
+	transformer, _ = New([]Rule{{Path: "ip", Action: HMAC, Everywhere: true}}, key)
+	mac = hmac.New(sha256.New, key)
+	mac.Write([]byte("2001:db8::1"))
+	ipMAC := hex.EncodeToString(mac.Sum(nil))
+	record = `{"ip":"2001:db8::1","url":"http://[2001:db8::1]:80/","other":"2001:db8::10"}`
+	expected = `{"ip":"` + ipMAC + `","other":"2001:db8::10","url":"http://[` + ipMAC + `]:80/"}`
+	if got := encode(t, transformer.Apply(decode(t, record))); got != expected {
+		t.Errorf("got %s\nexpected %s", got, expected)
+	}
+
+	for _, rules := range [][]Rule{
+		{{Path: "ip", Action: HMAC}},
+		{{Path: "banner", Action: Drop, Everywhere: true}},
+		{{Path: "ip", Action: "encrypt"}},
+		{{Path: "", Action: Hash}},
+		{{Path: "ip", Action: TruncateIP, IPv4Prefix: 33}},
+		{{Path: "banner", Action: Redact, Pattern: "("}},
+	} {
+		if _, err := New(rules, nil); err == nil {
+			t.Errorf("expected an error for rules %v", rules)
+		}
+	}
+}
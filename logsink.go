@@ -0,0 +1,195 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// logSinkTimeout bounds the connections to a logstash endpoint, and the
+// writes on them.
+const logSinkTimeout = 5 * time.Second
+
+// logSinkRetryDelay is how long log entries are dropped after a logstash
+// endpoint could not be reached, so that a dead endpoint does not slow down
+// the scan.
+const logSinkRetryDelay = 10 * time.Second
+
+// logHostname is the host name attached to the log entries sent to the sinks.
+var logHostname, _ = os.Hostname()
+
+// encodeLogEntry returns the JSON encoding of a log entry, with the field
+// names used by logstash.
+func encodeLogEntry(entry *log.Entry) ([]byte, error) {
+	data := make(log.Fields, len(entry.Data)+6)
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		data[k] = v
+	}
+	data["@timestamp"] = entry.Time.UTC().Format(time.RFC3339Nano)
+	data["@version"] = "1"
+	data["level"] = entry.Level.String()
+	data["message"] = entry.Message
+	data["host"] = logHostname
+	data["program"] = "zgrab2"
+	return json.Marshal(data)
+}
+
+// logstashHook is a logrus hook sending log entries as JSON lines to a
+// logstash tcp or udp input.
+type logstashHook struct {
+	network string
+	addr    string
+
+	mu         sync.Mutex
+	conn       net.Conn
+	retryAfter time.Time
+}
+
+// newLogstashHook returns a hook sending the log entries to the endpoint
+// given as tcp://host:port or udp://host:port.
+func newLogstashHook(endpoint string) (*logstashHook, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "tcp" && u.Scheme != "udp" {
+		return nil, fmt.Errorf("unsupported scheme %q (must be tcp or udp)", u.Scheme)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("no port in %q", endpoint)
+	}
+	return &logstashHook{network: u.Scheme, addr: u.Host}, nil
+}
+
+// Levels returns the levels of the entries sent by the hook: all of them.
+func (h *logstashHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire sends a log entry to the endpoint, connecting to it first if needed.
+// Entries are dropped for a while after a failure.
+func (h *logstashHook) Fire(entry *log.Entry) error {
+	line, err := encodeLogEntry(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn == nil {
+		if time.Now().Before(h.retryAfter) {
+			return nil
+		}
+		if h.conn, err = net.DialTimeout(h.network, h.addr, logSinkTimeout); err != nil {
+			h.retryAfter = time.Now().Add(logSinkRetryDelay)
+			return fmt.Errorf("could not connect to logstash at %s: %s", h.addr, err)
+		}
+	}
+	h.conn.SetWriteDeadline(time.Now().Add(logSinkTimeout))
+	if _, err := h.conn.Write(line); err != nil {
+		h.conn.Close()
+		h.conn = nil
+		h.retryAfter = time.Now().Add(logSinkRetryDelay)
+		return fmt.Errorf("could not send log entry to logstash at %s: %s", h.addr, err)
+	}
+	return nil
+}
+
+// newLogHooks returns the hooks sending the log entries to the syslog and
+// logstash destinations of the config.
+func newLogHooks(config *Config) ([]log.Hook, error) {
+	var hooks []log.Hook
+	if config.LogSyslog != "" {
+		hook, err := newSyslogHook(config.LogSyslog)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --log-syslog: %s", err)
+		}
+		hooks = append(hooks, hook)
+	}
+	if config.LogLogstash != "" {
+		hook, err := newLogstashHook(config.LogLogstash)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --log-logstash: %s", err)
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// scanLog sends an event for each scan ending with one of a set of statuses
+// to the log sinks, without writing it to the log file.
+type scanLog struct {
+	logger   *log.Logger
+	statuses map[ScanStatus]bool
+}
+
+// newScanLog returns a scanLog sending the events to the given hooks, for the
+// scans ending with one of the comma-separated statuses.
+func newScanLog(hooks []log.Hook, statuses string) (*scanLog, error) {
+	ret := &scanLog{
+		logger:   log.New(),
+		statuses: make(map[ScanStatus]bool),
+	}
+	ret.logger.Out = ioutil.Discard
+	for _, hook := range hooks {
+		ret.logger.AddHook(hook)
+	}
+	for _, field := range strings.Split(statuses, ",") {
+		status := ScanStatus(strings.TrimSpace(field))
+		if status == "" {
+			continue
+		}
+		if !retryableStatuses[status] && status != SCAN_SUCCESS && status != SCAN_BLOCKED {
+			return nil, fmt.Errorf("unknown scan status %q", field)
+		}
+		ret.statuses[status] = true
+	}
+	return ret, nil
+}
+
+// record sends an event for the response of the named scanner to target, if
+// its status is one of those logged.
+func (l *scanLog) record(target *ScanTarget, name string, res *ScanResponse) {
+	if l == nil || !l.statuses[res.Status] {
+		return
+	}
+	fields := log.Fields{
+		"event":    "scan",
+		"scanner":  name,
+		"protocol": res.Protocol,
+		"status":   res.Status,
+	}
+	if target.IP != nil {
+		fields["ip"] = target.IP.String()
+	}
+	if target.Domain != "" {
+		fields["domain"] = target.Domain
+	}
+	if target.Port != nil {
+		fields["port"] = *target.Port
+	}
+	if target.Tag != "" {
+		fields["tag"] = target.Tag
+	}
+	entry := l.logger.WithFields(fields)
+	if res.Error != nil {
+		entry = entry.WithField("error", *res.Error)
+	}
+	if res.Status == SCAN_SUCCESS {
+		entry.Infof("scan of %s by %s succeeded", target.String(), name)
+	} else {
+		entry.Warnf("scan of %s by %s failed: %s", target.String(), name, res.Status)
+	}
+}
@@ -0,0 +1,14 @@
+// +build windows plan9
+
+package zgrab2
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// newSyslogHook fails: syslog is not supported on this platform.
+func newSyslogHook(dest string) (log.Hook, error) {
+	return nil, fmt.Errorf("syslog is not supported on this platform")
+}
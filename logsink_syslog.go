@@ -0,0 +1,68 @@
+// +build !windows,!plan9
+
+package zgrab2
+
+import (
+	"fmt"
+	"log/syslog"
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// syslogHook is a logrus hook sending log entries as JSON to syslog, with the
+// @cee: cookie recognized by rsyslog and syslog-ng.
+type syslogHook struct {
+	writer *syslog.Writer
+}
+
+// newSyslogHook returns a hook sending the log entries to the local syslog
+// daemon if dest is "local", or to the server given as udp://host:port or
+// tcp://host:port.
+func newSyslogHook(dest string) (log.Hook, error) {
+	var network, addr string
+	if dest != "local" {
+		u, err := url.Parse(dest)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "tcp" && u.Scheme != "udp" {
+			return nil, fmt.Errorf("unsupported scheme %q (must be tcp or udp, or use local)", u.Scheme)
+		}
+		network, addr = u.Scheme, u.Host
+		if u.Port() == "" {
+			addr += ":514"
+		}
+	}
+	writer, err := syslog.Dial(network, addr, syslog.LOG_DAEMON|syslog.LOG_INFO, "zgrab2")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogHook{writer: writer}, nil
+}
+
+// Levels returns the levels of the entries sent by the hook: all of them.
+func (h *syslogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire sends a log entry to syslog, with the severity of its level.
+func (h *syslogHook) Fire(entry *log.Entry) error {
+	line, err := encodeLogEntry(entry)
+	if err != nil {
+		return err
+	}
+	msg := "@cee: " + string(line)
+	switch entry.Level {
+	case log.PanicLevel, log.FatalLevel:
+		return h.writer.Crit(msg)
+	case log.ErrorLevel:
+		return h.writer.Err(msg)
+	case log.WarnLevel:
+		return h.writer.Warning(msg)
+	case log.InfoLevel:
+		return h.writer.Info(msg)
+	default:
+		return h.writer.Debug(msg)
+	}
+}
@@ -0,0 +1,86 @@
+package zgrab2
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestLogstashHook(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	lines := make(chan map[string]interface{}, 4)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var entry map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Errorf("invalid log line %q: %s", scanner.Text(), err)
+			}
+			lines <- entry
+		}
+	}()
+	next := func() map[string]interface{} {
+		select {
+		case entry := <-lines:
+			return entry
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a log entry")
+			return nil
+		}
+	}
+
+	hook, err := newLogstashHook("tcp://" + listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	logger.WithError(errors.New("boom")).Error("could not write")
+	entry := next()
+	if entry["message"] != "could not write" || entry["level"] != "error" || entry["error"] != "boom" || entry["program"] != "zgrab2" || entry["@timestamp"] == nil {
+		t.Errorf("got entry %v", entry)
+	}
+
+	// Scan events are sent for the selected statuses only.
+	scanLog, err := newScanLog([]log.Hook{hook}, "protocol-error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := uint(2222)
+	target := &ScanTarget{IP: net.ParseIP("192.0.2.1"), Port: &port, Tag: "ssh"}
+	scanLog.record(target, "ssh", &ScanResponse{Status: SCAN_CONNECTION_TIMEOUT, Protocol: "ssh"})
+	msg := "unexpected banner"
+	scanLog.record(target, "ssh", &ScanResponse{Status: SCAN_PROTOCOL_ERROR, Protocol: "ssh", Error: &msg})
+	entry = next()
+	if entry["event"] != "scan" || entry["ip"] != "192.0.2.1" || entry["port"] != float64(2222) || entry["status"] != "protocol-error" || entry["error"] != msg || entry["level"] != "warning" {
+		t.Errorf("got scan event %v", entry)
+	}
+	select {
+	case entry := <-lines:
+		t.Errorf("got unexpected entry %v", entry)
+	default:
+	}
+
+	if _, err := newScanLog(nil, "bogus"); err == nil {
+		t.Error("expected an error for an unknown status")
+	}
+	if _, err := newLogstashHook("http://localhost:5000"); err == nil {
+		t.Error("expected an error for an unsupported scheme")
+	}
+}
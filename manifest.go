@@ -0,0 +1,421 @@
+package zgrab2
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// ManifestVersion is the version of the manifest format.
+const ManifestVersion = 1
+
+// Manifest is a signed record of the output files written by a scan. Each
+// output file is described by the SHA-256 hash of its contents and by the
+// head of a hash chain over its records, so that the file, or any prefix of it
+// that was covered by a checkpoint, can be shown to be unmodified.
+type Manifest struct {
+	Version   int    `json:"version"`
+	Algorithm string `json:"algorithm"`
+
+	// PublicKey is the base64-encoded Ed25519 public key that verifies the
+	// signature.
+	PublicKey string `json:"public_key"`
+
+	// Updated is the time the manifest was last written, in RFC3339 format.
+	Updated string `json:"updated"`
+
+	// Complete is set once all output has been written. A manifest written
+	// at a checkpoint covers only the records written up to that point.
+	Complete bool `json:"complete"`
+
+	Files []*ManifestFile `json:"files"`
+
+	// Signature is the base64-encoded Ed25519 signature of the JSON encoding
+	// of the manifest with Signature empty.
+	Signature string `json:"signature,omitempty"`
+}
+
+// ManifestFile describes a single output file.
+type ManifestFile struct {
+	// Name is the name of the output file; "-" for stdout.
+	Name string `json:"name"`
+
+	// Records is the number of records (lines) covered by the manifest.
+	Records uint64 `json:"records"`
+
+	// Bytes is the number of bytes covered by the manifest.
+	Bytes int64 `json:"bytes"`
+
+	// SHA256 is the hex-encoded SHA-256 hash of the covered bytes.
+	SHA256 string `json:"sha256"`
+
+	// Chain is the hex-encoded head of the hash chain over the covered
+	// records, where chain[0] is all zeros and
+	// chain[i] = SHA256(chain[i-1] || record[i]), excluding the newline.
+	Chain string `json:"chain"`
+}
+
+// signedBytes returns the bytes covered by the manifest's signature.
+func (m *Manifest) signedBytes() ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = ""
+	return json.Marshal(&unsigned)
+}
+
+// Sign sets the manifest's public key and signature using the given key.
+func (m *Manifest) Sign(key ed25519.PrivateKey) error {
+	m.Algorithm = "ed25519"
+	m.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	data, err := m.signedBytes()
+	if err != nil {
+		return err
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	return nil
+}
+
+// VerifySignature checks the manifest's signature against its embedded
+// public key, and, if pub is non-nil, that the embedded key is pub.
+func (m *Manifest) VerifySignature(pub ed25519.PublicKey) error {
+	if m.Algorithm != "ed25519" {
+		return fmt.Errorf("unsupported signature algorithm %q", m.Algorithm)
+	}
+	key, err := base64.StdEncoding.DecodeString(m.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("invalid public key")
+	}
+	if pub != nil && !bytes.Equal(key, pub) {
+		return errors.New("manifest was signed by a different key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return errors.New("invalid signature encoding")
+	}
+	data, err := m.signedBytes()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), data, sig) {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
+
+// recordDigest accumulates the hash and hash chain of a stream of records.
+type recordDigest struct {
+	hash  hash.Hash
+	chain [sha256.Size]byte
+	file  ManifestFile
+}
+
+func newRecordDigest(name string) *recordDigest {
+	return &recordDigest{hash: sha256.New(), file: ManifestFile{Name: name}}
+}
+
+func (d *recordDigest) add(record []byte) {
+	d.hash.Write(record)
+	d.hash.Write([]byte{'\n'})
+	link := sha256.New()
+	link.Write(d.chain[:])
+	link.Write(record)
+	link.Sum(d.chain[:0])
+	d.file.Records++
+	d.file.Bytes += int64(len(record)) + 1
+}
+
+// snapshot returns the ManifestFile for the records added so far.
+func (d *recordDigest) snapshot() *ManifestFile {
+	ret := d.file
+	ret.SHA256 = hex.EncodeToString(d.hash.Sum(nil))
+	ret.Chain = hex.EncodeToString(d.chain[:])
+	return &ret
+}
+
+// OutputSigner maintains a signed manifest of the records written to one or
+// more output files.
+type OutputSigner struct {
+	key        ed25519.PrivateKey
+	path       string
+	checkpoint uint64
+
+	mu      sync.Mutex
+	digests []*recordDigest
+	active  int
+}
+
+// NewOutputSigner returns an OutputSigner that writes the manifest to path.
+// If checkpoint is non-zero, the manifest is also rewritten every checkpoint
+// records, so that the output of an interrupted scan can still be verified.
+func NewOutputSigner(key ed25519.PrivateKey, path string, checkpoint uint64) *OutputSigner {
+	return &OutputSigner{key: key, path: path, checkpoint: checkpoint}
+}
+
+// manifestName returns the name under which the output file is listed in the
+// manifest: its path relative to the manifest, if possible.
+func (s *OutputSigner) manifestName(name string) string {
+	if name == "-" {
+		return name
+	}
+	dir, err := filepath.Abs(filepath.Dir(s.path))
+	if err != nil {
+		return name
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return name
+	}
+	if rel, err := filepath.Rel(dir, abs); err == nil {
+		return rel
+	}
+	return abs
+}
+
+// Wrap returns an OutputResultsFunc that records each result in the manifest
+// under the given file name before passing it on to output. The manifest is
+// written when all wrapped functions have returned.
+func (s *OutputSigner) Wrap(name string, output OutputResultsFunc) OutputResultsFunc {
+	s.mu.Lock()
+	digest := newRecordDigest(s.manifestName(name))
+	s.digests = append(s.digests, digest)
+	s.active++
+	s.mu.Unlock()
+	return func(results <-chan []byte) error {
+		forward := make(chan []byte, cap(results))
+		done := make(chan error, 1)
+		go func() {
+			done <- output(forward)
+		}()
+		var err error
+		for result := range results {
+			s.mu.Lock()
+			digest.add(result)
+			if s.checkpoint > 0 && digest.file.Records%s.checkpoint == 0 {
+				err = s.writeLocked(false)
+			}
+			s.mu.Unlock()
+			if err != nil {
+				break
+			}
+			select {
+			case forward <- result:
+			case err = <-done:
+				// The output stopped early; report why.
+				if err == nil {
+					err = errors.New("output closed before all results were written")
+				}
+				return err
+			}
+		}
+		close(forward)
+		if outputErr := <-done; err == nil {
+			err = outputErr
+		}
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.active--
+		return s.writeLocked(s.active == 0)
+	}
+}
+
+// writeLocked signs the current manifest and atomically replaces the manifest
+// file with it. The caller must hold s.mu.
+func (s *OutputSigner) writeLocked(complete bool) error {
+	m := &Manifest{
+		Version:  ManifestVersion,
+		Updated:  time.Now().Format(time.RFC3339),
+		Complete: complete,
+	}
+	for _, d := range s.digests {
+		m.Files = append(m.Files, d.snapshot())
+	}
+	if err := m.Sign(s.key); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// ReadManifest reads a JSON-encoded manifest from path.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := new(Manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %s", path, err)
+	}
+	return m, nil
+}
+
+// oidEd25519 is the algorithm identifier for Ed25519 keys (RFC 8410).
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// pkcs8 is the ASN.1 structure of a PKCS #8 private key.
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// LoadSigningKey reads a PEM-encoded PKCS #8 Ed25519 private key (as written
+// by `openssl genpkey -algorithm ed25519`) from path.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	var info pkcs8
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		return nil, fmt.Errorf("%s: invalid PKCS #8 key: %s", path, err)
+	}
+	if !info.Algo.Algorithm.Equal(oidEd25519) {
+		return nil, fmt.Errorf("%s: not an Ed25519 private key", path)
+	}
+	// The PKCS #8 private key is itself a DER-encoded OCTET STRING holding
+	// the seed.
+	var seed []byte
+	if _, err := asn1.Unmarshal(info.PrivateKey, &seed); err != nil {
+		return nil, fmt.Errorf("%s: invalid Ed25519 private key: %s", path, err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s: invalid Ed25519 seed length %d", path, len(seed))
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// VerifyRecords checks that the records read from r match the manifest entry.
+// Records beyond those covered by the entry (which are expected when the
+// manifest was written at a checkpoint) are counted and returned; it is up to
+// the caller to decide whether they are acceptable.
+func (f *ManifestFile) VerifyRecords(r io.Reader) (uint64, error) {
+	digest := newRecordDigest(f.Name)
+	reader := bufio.NewReader(r)
+	var extra uint64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if line[len(line)-1] != '\n' {
+				return extra, fmt.Errorf("record %d is not newline-terminated", digest.file.Records+extra+1)
+			}
+			if digest.file.Records < f.Records {
+				digest.add(line[:len(line)-1])
+			} else {
+				extra++
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return extra, err
+		}
+	}
+	got := digest.snapshot()
+	if got.Records != f.Records {
+		return extra, fmt.Errorf("expected %d records, found %d", f.Records, got.Records)
+	}
+	if got.SHA256 != f.SHA256 || got.Chain != f.Chain || got.Bytes != f.Bytes {
+		return extra, errors.New("contents do not match the manifest")
+	}
+	return extra, nil
+}
+
+// VerifyCommand contains the command line options for verifying the output
+// files listed in a signed manifest. The manifest is given as a positional
+// argument.
+type VerifyCommand struct {
+	PublicKey string `long:"public-key" description:"Base64-encoded Ed25519 public key the manifest must be signed with"`
+	File      string `long:"file" description:"Verify this file instead of the one named in a single-file manifest (e.g. when the output went to stdout)"`
+}
+
+// Validate the options sent to VerifyCommand
+func (x *VerifyCommand) Validate(args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one manifest file")
+	}
+	return nil
+}
+
+// Help returns a usage string that will be output at the command line
+func (x *VerifyCommand) Help() string {
+	return ""
+}
+
+// Run verifies the manifest at path and each of the files it lists, writing a
+// line per file to w. Files are looked up relative to the manifest.
+func (x *VerifyCommand) Run(w io.Writer, path string) error {
+	m, err := ReadManifest(path)
+	if err != nil {
+		return err
+	}
+	var pub ed25519.PublicKey
+	if x.PublicKey != "" {
+		if pub, err = base64.StdEncoding.DecodeString(x.PublicKey); err != nil {
+			return fmt.Errorf("invalid public key: %s", err)
+		}
+	}
+	if err := m.VerifySignature(pub); err != nil {
+		return err
+	}
+	if x.File != "" && len(m.Files) != 1 {
+		return errors.New("--file can only be used with single-file manifests")
+	}
+	for _, entry := range m.Files {
+		name := entry.Name
+		if x.File != "" {
+			name = x.File
+		} else if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(path), name)
+		}
+		f, err := openOutputFile(name)
+		if err != nil {
+			return err
+		}
+		extra, err := entry.VerifyRecords(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		if extra > 0 && m.Complete {
+			return fmt.Errorf("%s: %d records not covered by the manifest", name, extra)
+		}
+		fmt.Fprintf(w, "%s: OK (%d records)", name, entry.Records)
+		if extra > 0 {
+			fmt.Fprintf(w, ", %d unsigned records after last checkpoint", extra)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
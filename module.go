@@ -1,6 +1,9 @@
 package zgrab2
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // Scanner is an interface that represents all functions necessary to run a scan
 type Scanner interface {
@@ -20,8 +23,10 @@ type Scanner interface {
 	// Protocol returns the protocol identifier for the scan.
 	Protocol() string
 
-	// Scan connects to a host. The result should be JSON-serializable
-	Scan(t ScanTarget) (ScanStatus, interface{}, error)
+	// Scan connects to a host. The result should be JSON-serializable. Once
+	// ctx is canceled, the scan should be abandoned as soon as possible:
+	// connections opened with ctx are interrupted.
+	Scan(ctx context.Context, t ScanTarget) (ScanStatus, interface{}, error)
 }
 
 // ScanResponse is the result of a scan on a single host
@@ -36,6 +41,17 @@ type ScanResponse struct {
 	Result    interface{} `json:"result,omitempty"`
 	Timestamp string      `json:"timestamp,omitempty"`
 	Error     *string     `json:"error,omitempty"`
+
+	// Elapsed is the time the scan took, in seconds.
+	Elapsed float64 `json:"elapsed,omitempty"`
+
+	// Trace holds the wire-level trace of the scan, if tracing was enabled
+	// for this target.
+	Trace []TraceEvent `json:"trace,omitempty"`
+
+	// Attempts is the number of times the target was scanned, if it was
+	// retried after a transient failure (see --retries).
+	Attempts int `json:"attempts,omitempty"`
 }
 
 // ScanModule is an interface which represents a module that the framework can
@@ -71,6 +87,8 @@ type BaseFlags struct {
 	Name           string        `short:"n" long:"name" description:"Specify name for output json, only necessary if scanning multiple modules"`
 	Timeout        time.Duration `short:"t" long:"timeout" description:"Set connection timeout (0 = no timeout)" default:"10s"`
 	Trigger        string        `short:"g" long:"trigger" description:"Invoke only on targets with specified tag"`
+	After          string        `long:"after" description:"With multiple, run only after the named scanner, defined earlier, has a result for the target that matches --when"`
+	When           string        `long:"when" description:"Condition on the result of the --after scanner: PATH=VALUE, PATH!=VALUE or PATH~REGEXP, where PATH is a dotted path in its JSON output (e.g. status=success or result.response.headers.server~Tomcat)"`
 	BytesReadLimit int           `short:"m" long:"maxbytes" description:"Maximum byte read limit per scan (0 = defaults)"`
 }
 
@@ -91,8 +109,4 @@ func GetModule(name string) ScanModule {
 	return modules[name]
 }
 
-var modules map[string]ScanModule
-
-func init() {
-	modules = make(map[string]ScanModule)
-}
+var modules = NewModuleSet()
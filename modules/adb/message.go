@@ -0,0 +1,74 @@
+package adb
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// The commands of the messages.
+const (
+	cmdConnect = 0x4e584e43 // CNXN
+	cmdAuth    = 0x48545541 // AUTH
+	cmdTLS     = 0x534c5453 // STLS
+)
+
+// headerLength is the length of the message header.
+const headerLength = 24
+
+// maxPayload is the maximum length of a payload read.
+const maxPayload = 64 * 1024
+
+// ErrInvalidMessage is returned if the header of a message is not an ADB
+// header, or its payload is too large.
+var ErrInvalidMessage = errors.New("invalid ADB message")
+
+// message is an ADB message: a header of six little-endian words (the
+// command, two arguments, the payload length and checksum, and the command
+// XOR 0xffffffff), then the payload.
+type message struct {
+	command uint32
+	arg0    uint32
+	arg1    uint32
+	payload []byte
+}
+
+// encode returns the header and payload of the message. The checksum, the
+// sum of the payload bytes, is only checked by devices before version
+// 0x01000001.
+func (m *message) encode() []byte {
+	buf := make([]byte, headerLength, headerLength+len(m.payload))
+	var sum uint32
+	for _, b := range m.payload {
+		sum += uint32(b)
+	}
+	binary.LittleEndian.PutUint32(buf[0:], m.command)
+	binary.LittleEndian.PutUint32(buf[4:], m.arg0)
+	binary.LittleEndian.PutUint32(buf[8:], m.arg1)
+	binary.LittleEndian.PutUint32(buf[12:], uint32(len(m.payload)))
+	binary.LittleEndian.PutUint32(buf[16:], sum)
+	binary.LittleEndian.PutUint32(buf[20:], m.command^0xffffffff)
+	return append(buf, m.payload...)
+}
+
+// readMessage reads a message.
+func readMessage(r io.Reader) (*message, error) {
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	m := &message{
+		command: binary.LittleEndian.Uint32(header[0:]),
+		arg0:    binary.LittleEndian.Uint32(header[4:]),
+		arg1:    binary.LittleEndian.Uint32(header[8:]),
+	}
+	length := binary.LittleEndian.Uint32(header[12:])
+	if binary.LittleEndian.Uint32(header[20:]) != m.command^0xffffffff || length > maxPayload {
+		return nil, ErrInvalidMessage
+	}
+	m.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, m.payload); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
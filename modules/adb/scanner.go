@@ -0,0 +1,219 @@
+// Package adb provides a zgrab2 module that connects to the Android Debug
+// Bridge daemon of devices, and records whether it accepts unauthenticated
+// hosts.
+// Default Port: 5555 (TCP)
+//
+// The scanner sends a CNXN message, as the adb client does. A device
+// accepting any host answers with its own CNXN message, whose banner gives
+// the device type and properties such as the product name, model and device,
+// and the features of the daemon. A device requiring authentication answers
+// with an AUTH token to sign with an authorized key, and a device with
+// wireless debugging (Android 11 and later) requires TLS with STLS.
+package adb
+
+import (
+	"context"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// The version and maximum payload length of the CNXN message sent.
+const (
+	version = 0x01000001
+	maxData = 256 * 1024
+)
+
+// Flags holds the command-line configuration for the adb module.
+type Flags struct {
+	zgrab2.BaseFlags
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results is the output of the adb module.
+type Results struct {
+	// Command is the command of the response: CNXN, AUTH or STLS.
+	Command string `json:"command"`
+
+	// Unauthenticated is true if the device accepted the connection,
+	// AuthRequired if it sent an AUTH token, and TLSRequired if it requested
+	// TLS.
+	Unauthenticated bool `json:"unauthenticated"`
+	AuthRequired    bool `json:"auth_required,omitempty"`
+	TLSRequired     bool `json:"tls_required,omitempty"`
+
+	// Version is the protocol version of the device, and MaxData the
+	// maximum payload length it accepts.
+	Version uint32 `json:"version,omitempty"`
+	MaxData uint32 `json:"max_data,omitempty"`
+
+	// Banner is the connection string of the CNXN response, such as
+	// "device::ro.product.name=...;ro.product.model=...;features=...".
+	Banner string `json:"banner,omitempty"`
+
+	// SystemType is the type of the banner: device, bootloader, recovery or
+	// sideload.
+	SystemType string `json:"system_type,omitempty"`
+
+	// Properties holds the properties of the banner, except the features.
+	Properties map[string]string `json:"properties,omitempty"`
+
+	ProductName   string `json:"product_name,omitempty"`
+	ProductModel  string `json:"product_model,omitempty"`
+	ProductDevice string `json:"product_device,omitempty"`
+
+	// AndroidVersion is the ro.build.version.release property, if the banner
+	// has it.
+	AndroidVersion string `json:"android_version,omitempty"`
+
+	Features []string `json:"features,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("adb", "ADB", module.Description(), 5555, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Connect to an Android Debug Bridge daemon, and read its banner or authentication requirement"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "adb"
+}
+
+// banner records the connection string of a CNXN response:
+// "systemtype:serial:prop=value;prop=value;...".
+func (results *Results) banner(payload []byte) {
+	results.Banner = strings.TrimRight(string(payload), "\x00")
+	parts := strings.SplitN(results.Banner, ":", 3)
+	results.SystemType = parts[0]
+	if len(parts) < 3 {
+		return
+	}
+	for _, prop := range strings.Split(parts[2], ";") {
+		kv := strings.SplitN(prop, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if kv[0] == "features" {
+			results.Features = strings.Split(kv[1], ",")
+			continue
+		}
+		if results.Properties == nil {
+			results.Properties = make(map[string]string)
+		}
+		results.Properties[kv[0]] = kv[1]
+	}
+	results.ProductName = results.Properties["ro.product.name"]
+	results.ProductModel = results.Properties["ro.product.model"]
+	results.ProductDevice = results.Properties["ro.product.device"]
+	results.AndroidVersion = results.Properties["ro.build.version.release"]
+}
+
+// Scan sends the CNXN message, and reads the response. The scan fails if the
+// response is not a CNXN, AUTH or STLS message.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	connect := &message{command: cmdConnect, arg0: version, arg1: maxData, payload: []byte("host::\x00")}
+	if _, err := conn.Write(connect.encode()); err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	resp, err := readMessage(conn)
+	if err == ErrInvalidMessage {
+		return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+	}
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	results := new(Results)
+	switch resp.command {
+	case cmdConnect:
+		results.Command = "CNXN"
+		results.Unauthenticated = true
+		results.Version = resp.arg0
+		results.MaxData = resp.arg1
+		results.banner(resp.payload)
+	case cmdAuth:
+		results.Command = "AUTH"
+		results.AuthRequired = true
+	case cmdTLS:
+		results.Command = "STLS"
+		results.TLSRequired = true
+		results.Version = resp.arg0
+	default:
+		return zgrab2.SCAN_PROTOCOL_ERROR, nil, ErrInvalidMessage
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
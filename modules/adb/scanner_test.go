@@ -0,0 +1,76 @@
+package adb
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// serve runs a fake adbd answering the CNXN message with resp.
+func serve(t *testing.T, resp *message) (*testserver.Server, chan *message) {
+	requests := make(chan *message, 1)
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		m, err := readMessage(conn)
+		if err != nil {
+			return err
+		}
+		requests <- m
+		buf := resp.encode()
+		conn.Write(buf[:10])
+		_, err = conn.Write(buf[10:])
+		return err
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, requests
+}
+
+func scan(t *testing.T, server *testserver.Server) (zgrab2.ScanStatus, *Results, error) {
+	defer server.Close()
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), new(Flags), server.Addr())
+	results, _ := ret.(*Results)
+	return status, results, err
+}
+
+func TestUnauthenticated(t *testing.T) {
+	banner := "device::ro.product.name=sdk_gphone_x86;ro.product.model=Android SDK built for x86;ro.product.device=generic_x86;features=shell_v2,cmd,stat_v2\x00"
+	server, requests := serve(t, &message{command: cmdConnect, arg0: 0x01000001, arg1: 1024 * 1024, payload: []byte(banner)})
+	status, results, err := scan(t, server)
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	request := <-requests
+	if request.command != cmdConnect || request.arg0 != version || string(request.payload) != "host::\x00" {
+		t.Errorf("got request %+v", request)
+	}
+	if !results.Unauthenticated || results.Command != "CNXN" || results.SystemType != "device" || results.MaxData != 1024*1024 {
+		t.Errorf("got %+v", results)
+	}
+	if results.ProductName != "sdk_gphone_x86" || results.ProductModel != "Android SDK built for x86" || results.ProductDevice != "generic_x86" || len(results.Properties) != 3 {
+		t.Errorf("got %+v", results)
+	}
+	if !reflect.DeepEqual(results.Features, []string{"shell_v2", "cmd", "stat_v2"}) {
+		t.Errorf("got features %v", results.Features)
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	server, _ := serve(t, &message{command: cmdAuth, arg0: 1, payload: make([]byte, 20)})
+	status, results, err := scan(t, server)
+	if status != zgrab2.SCAN_SUCCESS || err != nil || !results.AuthRequired || results.Unauthenticated || results.Banner != "" {
+		t.Errorf("got status %s, %+v, error %v", status, results, err)
+	}
+}
+
+func TestInvalidMessage(t *testing.T) {
+	server, _ := serve(t, &message{command: 0x4e45504f, payload: []byte("shell:")})
+	status, _, err := scan(t, server)
+	if status != zgrab2.SCAN_PROTOCOL_ERROR || err != ErrInvalidMessage {
+		t.Errorf("got status %s, error %v", status, err)
+	}
+}
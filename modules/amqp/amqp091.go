@@ -0,0 +1,261 @@
+package amqp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The protocol headers of AMQP 0-9-1 and 1.0, the latter for the AMQP and
+// the SASL layers.
+var (
+	header091    = []byte{'A', 'M', 'Q', 'P', 0, 0, 9, 1}
+	header10     = []byte{'A', 'M', 'Q', 'P', 0, 1, 0, 0}
+	header10SASL = []byte{'A', 'M', 'Q', 'P', 3, 1, 0, 0}
+)
+
+// The method frame type, and the frame end octet (AMQP 0-9-1 section 4.2.3).
+const (
+	frameMethod = 1
+	frameEnd    = 0xce
+)
+
+// The class and method IDs of Connection.Start.
+const (
+	classConnection = 10
+	methodStart     = 10
+)
+
+// maxFrameSize bounds the size of a frame read from the server.
+const maxFrameSize = 1 << 20
+
+var (
+	// ErrInvalidFrame is returned if the server sends a malformed frame.
+	ErrInvalidFrame = errors.New("invalid AMQP frame")
+
+	// ErrTooLarge is returned if a frame is larger than maxFrameSize.
+	ErrTooLarge = errors.New("AMQP frame too large")
+)
+
+// headerError is returned if the server answers the protocol header with
+// the header of the version it supports.
+type headerError struct {
+	header []byte
+}
+
+func (e *headerError) Error() string {
+	return fmt.Sprintf("server requested protocol header %q", e.header)
+}
+
+// readHeader reads a protocol header if the server sent one, returning nil if
+// it sent something else.
+func readHeader(r *bufio.Reader) ([]byte, error) {
+	prefix, err := r.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	if string(prefix) != "AMQP" {
+		return nil, nil
+	}
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// connectionStart holds the fields of Connection.Start.
+type connectionStart struct {
+	versionMajor byte
+	versionMinor byte
+	properties   map[string]interface{}
+	mechanisms   []byte
+	locales      []byte
+}
+
+// readConnectionStart reads the Connection.Start method frame sent in reply
+// to the AMQP 0-9-1 protocol header. If the server instead sends the header
+// of another version, it is returned in a *headerError.
+func readConnectionStart(r *bufio.Reader) (*connectionStart, error) {
+	header, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		return nil, &headerError{header: header}
+	}
+	frame := make([]byte, 7)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	if frame[0] != frameMethod {
+		return nil, ErrInvalidFrame
+	}
+	size := binary.BigEndian.Uint32(frame[3:])
+	if size > maxFrameSize {
+		return nil, ErrTooLarge
+	}
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	if payload[size] != frameEnd {
+		return nil, ErrInvalidFrame
+	}
+	return parseConnectionStart(payload[:size])
+}
+
+// parseConnectionStart decodes the payload of Connection.Start.
+func parseConnectionStart(b []byte) (*connectionStart, error) {
+	if len(b) < 6 || binary.BigEndian.Uint16(b) != classConnection || binary.BigEndian.Uint16(b[2:]) != methodStart {
+		return nil, ErrInvalidFrame
+	}
+	d := &decoder{b: b[6:]}
+	ret := &connectionStart{versionMajor: b[4], versionMinor: b[5]}
+	ret.properties = d.table()
+	ret.mechanisms = d.longString()
+	ret.locales = d.longString()
+	if d.err != nil {
+		return nil, d.err
+	}
+	return ret, nil
+}
+
+// decoder decodes the fields of AMQP 0-9-1 methods. After an error, all the
+// methods return zero values, and err holds the first error.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil || n > len(d.b) {
+		d.err = ErrInvalidFrame
+		return nil
+	}
+	ret := d.b[:n]
+	d.b = d.b[n:]
+	return ret
+}
+
+func (d *decoder) uint8() uint8 {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) shortString() string {
+	return string(d.next(int(d.uint8())))
+}
+
+func (d *decoder) longString() []byte {
+	n := d.uint32()
+	if n > maxFrameSize {
+		d.err = ErrInvalidFrame
+		return nil
+	}
+	return d.next(int(n))
+}
+
+// table decodes a field table.
+func (d *decoder) table() map[string]interface{} {
+	t := &decoder{b: d.longString()}
+	ret := make(map[string]interface{})
+	for d.err == nil && t.err == nil && len(t.b) > 0 {
+		name := t.shortString()
+		ret[name] = t.value()
+	}
+	if d.err == nil {
+		d.err = t.err
+	}
+	return ret
+}
+
+// value decodes a field value, using the types of the errata of RabbitMQ,
+// which most servers follow.
+func (d *decoder) value() interface{} {
+	switch d.uint8() {
+	case 't':
+		return d.uint8() != 0
+	case 'b':
+		return int64(int8(d.uint8()))
+	case 'B':
+		return int64(d.uint8())
+	case 's':
+		return int64(int16(d.uint16()))
+	case 'u':
+		return int64(d.uint16())
+	case 'I':
+		return int64(int32(d.uint32()))
+	case 'i':
+		return int64(d.uint32())
+	case 'l':
+		return int64(d.uint64())
+	case 'f':
+		return float64(math.Float32frombits(d.uint32()))
+	case 'd':
+		return math.Float64frombits(d.uint64())
+	case 'D':
+		scale := d.uint8()
+		return fmt.Sprintf("%de-%d", int32(d.uint32()), scale)
+	case 'S':
+		return string(d.longString())
+	case 'x':
+		return d.longString()
+	case 'A':
+		a := &decoder{b: d.longString()}
+		var ret []interface{}
+		for d.err == nil && a.err == nil && len(a.b) > 0 {
+			ret = append(ret, a.value())
+		}
+		if d.err == nil {
+			d.err = a.err
+		}
+		return ret
+	case 'T':
+		return int64(d.uint64())
+	case 'F':
+		return d.table()
+	case 'V':
+		return nil
+	}
+	if d.err == nil {
+		d.err = ErrInvalidFrame
+	}
+	return nil
+}
+
+// splitList splits the space separated lists of Connection.Start.
+func splitList(b []byte) []string {
+	var ret []string
+	for _, f := range bytes.Fields(b) {
+		ret = append(ret, string(f))
+	}
+	return ret
+}
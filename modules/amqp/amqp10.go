@@ -0,0 +1,307 @@
+package amqp
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// The frame types of AMQP 1.0 (section 2.3).
+const (
+	frameAMQP = 0
+	frameSASL = 1
+)
+
+// The descriptors of the performatives used (sections 2.7 and 5.3.3).
+const (
+	descriptorOpen           = 0x10
+	descriptorSASLMechanisms = 0x40
+	descriptorSASLInit       = 0x41
+	descriptorSASLOutcome    = 0x44
+)
+
+// saslOutcomes names the codes of a SASL outcome (section 5.3.3.6).
+var saslOutcomes = map[uint64]string{
+	0: "ok",
+	1: "auth",
+	2: "sys",
+	3: "sys-perm",
+	4: "sys-temp",
+}
+
+// described is a described value.
+type described struct {
+	descriptor interface{}
+	value      interface{}
+}
+
+// symbol is a symbolic value, such as a SASL mechanism.
+type symbol string
+
+// amqpMap is a map, as its alternating keys and values.
+type amqpMap []interface{}
+
+// encodeFrame returns a frame of the given type on channel 0, holding the
+// performative with the given descriptor and fields (an encoded list).
+func encodeFrame(typ byte, descriptor byte, fields ...[]byte) []byte {
+	var list []byte
+	for _, f := range fields {
+		list = append(list, f...)
+	}
+	body := append([]byte{0x00, 0x53, descriptor, 0xd0, 0, 0, 0, 0, 0, 0, 0, 0}, list...)
+	binary.BigEndian.PutUint32(body[4:], uint32(4+len(list)))
+	binary.BigEndian.PutUint32(body[8:], uint32(len(fields)))
+	frame := []byte{0, 0, 0, 0, 2, typ, 0, 0}
+	binary.BigEndian.PutUint32(frame, uint32(len(frame)+len(body)))
+	return append(frame, body...)
+}
+
+// encodeSymbol returns a symbol, and encodeString a string.
+func encodeSymbol(s string) []byte {
+	return encodeVariable(0xb3, s)
+}
+
+func encodeString(s string) []byte {
+	return encodeVariable(0xb1, s)
+}
+
+// encodeVariable returns a variable width value with a 32-bit size.
+func encodeVariable(code byte, s string) []byte {
+	b := []byte{code, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], uint32(len(s)))
+	return append(b, s...)
+}
+
+// encodeSASLInit returns a SASL init frame selecting a mechanism, without an
+// initial response.
+func encodeSASLInit(mechanism string) []byte {
+	return encodeFrame(frameSASL, descriptorSASLInit, encodeSymbol(mechanism))
+}
+
+// encodeOpen returns an open frame with the given container ID.
+func encodeOpen(containerID string) []byte {
+	return encodeFrame(frameAMQP, descriptorOpen, encodeString(containerID))
+}
+
+// readFrame reads a frame, and returns its type and the performative it
+// holds. Empty frames, used as heartbeats, are skipped.
+func readFrame(r io.Reader) (byte, *described, error) {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0, nil, err
+		}
+		size := binary.BigEndian.Uint32(header)
+		offset := uint32(header[4]) * 4
+		if offset < 8 || size < offset {
+			return 0, nil, ErrInvalidFrame
+		}
+		if size > maxFrameSize {
+			return 0, nil, ErrTooLarge
+		}
+		frame := make([]byte, size-8)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return 0, nil, err
+		}
+		body := frame[offset-8:]
+		if len(body) == 0 {
+			continue
+		}
+		v, _, err := decodeValue(body)
+		if err != nil {
+			return 0, nil, err
+		}
+		d, ok := v.(*described)
+		if !ok {
+			return 0, nil, ErrInvalidFrame
+		}
+		return header[5], d, nil
+	}
+}
+
+// code returns the numeric descriptor of a performative, or 0 if it is
+// symbolic.
+func (d *described) code() uint64 {
+	c, _ := d.descriptor.(uint64)
+	return c
+}
+
+// field returns the field of a performative at index i, or nil if it is
+// absent.
+func (d *described) field(i int) interface{} {
+	fields, _ := d.value.([]interface{})
+	if i < len(fields) {
+		return fields[i]
+	}
+	return nil
+}
+
+// symbols returns the values of a multiple symbol field, which holds either
+// a single symbol or an array of them.
+func symbols(v interface{}) []string {
+	var ret []string
+	switch v := v.(type) {
+	case symbol:
+		ret = append(ret, string(v))
+	case []interface{}:
+		for _, e := range v {
+			if s, ok := e.(symbol); ok {
+				ret = append(ret, string(s))
+			}
+		}
+	}
+	return ret
+}
+
+// decodeValue decodes an AMQP 1.0 value (section 1.6), returning the rest of
+// b. Numbers are decoded as int64, uint64 or float64, strings and symbols as
+// string and symbol, lists and arrays as []interface{}, and maps as amqpMap.
+func decodeValue(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, ErrInvalidFrame
+	}
+	code, b := b[0], b[1:]
+	if code == 0x00 {
+		descriptor, rest, err := decodeValue(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		value, rest, err := decodeValue(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &described{descriptor: descriptor, value: value}, rest, nil
+	}
+	return decodeConstructor(code, b)
+}
+
+// decodeConstructor decodes the value following a primitive constructor.
+func decodeConstructor(code byte, b []byte) (interface{}, []byte, error) {
+	// The width of the fixed size values is given by the high nibble.
+	var width int
+	switch code >> 4 {
+	case 0x4:
+		width = 0
+	case 0x5:
+		width = 1
+	case 0x6:
+		width = 2
+	case 0x7:
+		width = 4
+	case 0x8:
+		width = 8
+	case 0x9:
+		width = 16
+	case 0xa, 0xc, 0xe:
+		width = 1
+	case 0xb, 0xd, 0xf:
+		width = 4
+	default:
+		return nil, nil, ErrInvalidFrame
+	}
+	if len(b) < width {
+		return nil, nil, ErrInvalidFrame
+	}
+	if code < 0xa0 {
+		return decodeFixed(code, b[:width]), b[width:], nil
+	}
+	// Variable width values are preceded by their size.
+	var size int
+	if width == 1 {
+		size = int(b[0])
+	} else {
+		size = int(binary.BigEndian.Uint32(b))
+	}
+	b = b[width:]
+	if size > len(b) {
+		return nil, nil, ErrInvalidFrame
+	}
+	data, rest := b[:size], b[size:]
+	switch code {
+	case 0xa0, 0xb0:
+		return data, rest, nil
+	case 0xa1, 0xb1:
+		return string(data), rest, nil
+	case 0xa3, 0xb3:
+		return symbol(data), rest, nil
+	case 0xc0, 0xd0, 0xc1, 0xd1:
+		if len(data) < width {
+			return nil, nil, ErrInvalidFrame
+		}
+		data = data[width:]
+		var values []interface{}
+		for len(data) > 0 {
+			v, more, err := decodeValue(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			values = append(values, v)
+			data = more
+		}
+		if code == 0xc1 || code == 0xd1 {
+			return amqpMap(values), rest, nil
+		}
+		return values, rest, nil
+	case 0xe0, 0xf0:
+		// The count, then a single constructor for all the elements.
+		if len(data) < width+1 {
+			return nil, nil, ErrInvalidFrame
+		}
+		count := int(data[0])
+		if width == 4 {
+			count = int(binary.BigEndian.Uint32(data))
+		}
+		element, data := data[width], data[width+1:]
+		var values []interface{}
+		for i := 0; i < count; i++ {
+			v, more, err := decodeConstructor(element, data)
+			if err != nil {
+				return nil, nil, err
+			}
+			values = append(values, v)
+			data = more
+		}
+		return values, rest, nil
+	}
+	return nil, nil, ErrInvalidFrame
+}
+
+// decodeFixed decodes a fixed width value. Types without a useful Go
+// representation, such as UUIDs and decimals, are returned as bytes.
+func decodeFixed(code byte, b []byte) interface{} {
+	switch code {
+	case 0x40:
+		return nil
+	case 0x41:
+		return true
+	case 0x42:
+		return false
+	case 0x43, 0x44:
+		return uint64(0)
+	case 0x45:
+		return []interface{}(nil)
+	case 0x56:
+		return b[0] != 0
+	case 0x50, 0x52, 0x53:
+		return uint64(b[0])
+	case 0x51, 0x54, 0x55:
+		return int64(int8(b[0]))
+	case 0x60:
+		return uint64(binary.BigEndian.Uint16(b))
+	case 0x61:
+		return int64(int16(binary.BigEndian.Uint16(b)))
+	case 0x70:
+		return uint64(binary.BigEndian.Uint32(b))
+	case 0x71:
+		return int64(int32(binary.BigEndian.Uint32(b)))
+	case 0x72:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case 0x80:
+		return binary.BigEndian.Uint64(b)
+	case 0x81, 0x83:
+		return int64(binary.BigEndian.Uint64(b))
+	case 0x82:
+		return math.Float64frombits(binary.BigEndian.Uint64(b))
+	}
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,371 @@
+// Package amqp provides a zgrab2 module that reads the properties advertised
+// by AMQP brokers, such as RabbitMQ, ActiveMQ and Qpid.
+// Default Port: 5672 (TCP)
+//
+// For AMQP 0-9-1, the scanner sends the protocol header and reads the
+// Connection.Start method, which holds the server properties (product,
+// version, platform and capabilities), the authentication mechanisms and the
+// locales. For AMQP 1.0, it sends the SASL protocol header and reads the
+// mechanisms offered; if ANONYMOUS is among them, it authenticates and reads
+// the open performative of the server, which holds its container ID and
+// properties. With --protocol-version auto, the default, 0-9-1 is tried first,
+// and 1.0 if the server answers with the 1.0 header. TLS is negotiated first
+// if --amqps is set, as on port 5671.
+package amqp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// containerID is the container ID sent in the open performative.
+const containerID = "zgrab2"
+
+// Flags holds the command-line configuration for the amqp module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	ProtocolVersion string `long:"protocol-version" default:"auto" choice:"auto" choice:"0-9-1" choice:"1.0" description:"AMQP version to speak: 0-9-1, 1.0, or 0-9-1 then 1.0 if the server requests it."`
+	AMQPS           bool   `long:"amqps" description:"Negotiate TLS immediately after connecting, as on port 5671."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// ServerProperties holds the properties of interest advertised by the
+// server.
+type ServerProperties struct {
+	Product     string `json:"product,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Platform    string `json:"platform,omitempty"`
+	Copyright   string `json:"copyright,omitempty"`
+	Information string `json:"information,omitempty"`
+	ClusterName string `json:"cluster_name,omitempty"`
+
+	// Capabilities lists the capabilities enabled (0-9-1) or offered (1.0).
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// Results is the output of the amqp module.
+type Results struct {
+	// Protocol is the AMQP version spoken with the server: 0-9-1 or 1.0.
+	Protocol string `json:"protocol,omitempty"`
+
+	// ServerVersion is the protocol version of Connection.Start (0-9-1).
+	ServerVersion string `json:"server_version,omitempty"`
+
+	// ServerProperties are the properties of Connection.Start (0-9-1) or of
+	// the open performative (1.0).
+	ServerProperties *ServerProperties `json:"server_properties,omitempty"`
+
+	// Mechanisms lists the SASL mechanisms offered.
+	Mechanisms []string `json:"mechanisms,omitempty"`
+
+	// Locales lists the locales of Connection.Start (0-9-1).
+	Locales []string `json:"locales,omitempty"`
+
+	// SASLOutcome is the outcome of the ANONYMOUS authentication (1.0).
+	SASLOutcome string `json:"sasl_outcome,omitempty"`
+
+	// ContainerID is the container ID of the open performative (1.0).
+	ContainerID string `json:"container_id,omitempty"`
+
+	// TLSLog is the standard TLS log, if --amqps is enabled.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("amqp", "AMQP", module.Description(), 5672, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Read the server properties and authentication mechanisms of an AMQP 0-9-1 or 1.0 broker"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "amqp"
+}
+
+// open connects to the target, negotiating TLS with --amqps.
+func (scanner *Scanner) open(ctx context.Context, target *zgrab2.ScanTarget, results *Results) (net.Conn, error) {
+	if !scanner.config.AMQPS {
+		return target.Open(ctx, &scanner.config.BaseFlags)
+	}
+	conn, err := target.OpenTLS(ctx, &scanner.config.BaseFlags, &scanner.config.TLSFlags)
+	if conn == nil {
+		return nil, err
+	}
+	results.TLSLog = conn.GetLog()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// scan091 sends the AMQP 0-9-1 protocol header and reads Connection.Start.
+func scan091(conn net.Conn, results *Results) error {
+	if _, err := conn.Write(header091); err != nil {
+		return err
+	}
+	start, err := readConnectionStart(bufio.NewReader(conn))
+	if err != nil {
+		return err
+	}
+	results.Protocol = "0-9-1"
+	results.ServerVersion = fmt.Sprintf("%d-%d", start.versionMajor, start.versionMinor)
+	results.ServerProperties = newServerProperties(start.properties)
+	if capabilities, ok := start.properties["capabilities"].(map[string]interface{}); ok {
+		for name, enabled := range capabilities {
+			if enabled == true {
+				results.ServerProperties.Capabilities = append(results.ServerProperties.Capabilities, name)
+			}
+		}
+		sort.Strings(results.ServerProperties.Capabilities)
+	}
+	results.Mechanisms = splitList(start.mechanisms)
+	results.Locales = splitList(start.locales)
+	return nil
+}
+
+// scan10 sends the AMQP 1.0 SASL protocol header, and reads the mechanisms
+// offered. If ANONYMOUS is offered, it authenticates and opens the
+// connection. It returns true if the server does not support SASL, and
+// closed the connection after answering with the AMQP header.
+func scan10(conn net.Conn, results *Results) (bool, error) {
+	if _, err := conn.Write(header10SASL); err != nil {
+		return false, err
+	}
+	reader := bufio.NewReader(conn)
+	header, err := readHeader(reader)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case header == nil:
+		return false, ErrInvalidFrame
+	case bytes.Equal(header, header10):
+		return true, nil
+	case !bytes.Equal(header, header10SASL):
+		return false, &headerError{header: header}
+	}
+	results.Protocol = "1.0"
+	typ, frame, err := readFrame(reader)
+	if err != nil {
+		return false, err
+	}
+	if typ != frameSASL || frame.code() != descriptorSASLMechanisms {
+		return false, ErrInvalidFrame
+	}
+	results.Mechanisms = symbols(frame.field(0))
+	anonymous := false
+	for _, m := range results.Mechanisms {
+		anonymous = anonymous || m == "ANONYMOUS"
+	}
+	if !anonymous {
+		return false, nil
+	}
+	if _, err := conn.Write(encodeSASLInit("ANONYMOUS")); err != nil {
+		return false, err
+	}
+	if typ, frame, err = readFrame(reader); err != nil {
+		return false, err
+	}
+	if typ != frameSASL || frame.code() != descriptorSASLOutcome {
+		return false, ErrInvalidFrame
+	}
+	code, _ := frame.field(0).(uint64)
+	results.SASLOutcome = saslOutcomes[code]
+	if results.SASLOutcome == "" {
+		results.SASLOutcome = fmt.Sprintf("unknown (%d)", code)
+	}
+	if code != 0 {
+		return false, nil
+	}
+	return false, open10(conn, reader, results)
+}
+
+// open10 sends the AMQP 1.0 protocol header and the open performative, and
+// reads those of the server.
+func open10(conn net.Conn, reader *bufio.Reader, results *Results) error {
+	if _, err := conn.Write(append(append([]byte(nil), header10...), encodeOpen(containerID)...)); err != nil {
+		return err
+	}
+	header, err := readHeader(reader)
+	if err != nil {
+		return err
+	}
+	if header == nil {
+		return ErrInvalidFrame
+	}
+	if !bytes.Equal(header, header10) {
+		return &headerError{header: header}
+	}
+	results.Protocol = "1.0"
+	typ, frame, err := readFrame(reader)
+	if err != nil {
+		return err
+	}
+	if typ != frameAMQP || frame.code() != descriptorOpen {
+		return ErrInvalidFrame
+	}
+	results.ContainerID, _ = frame.field(0).(string)
+	properties := make(map[string]interface{})
+	if m, ok := frame.field(9).(amqpMap); ok {
+		for i := 0; i+1 < len(m); i += 2 {
+			if key, ok := m[i].(symbol); ok {
+				properties[string(key)] = m[i+1]
+			}
+		}
+	}
+	results.ServerProperties = newServerProperties(properties)
+	results.ServerProperties.Capabilities = symbols(frame.field(7))
+	return nil
+}
+
+// newServerProperties extracts the string properties of interest.
+func newServerProperties(properties map[string]interface{}) *ServerProperties {
+	str := func(name string) string {
+		s, _ := properties[name].(string)
+		return s
+	}
+	return &ServerProperties{
+		Product:     str("product"),
+		Version:     str("version"),
+		Platform:    str("platform"),
+		Copyright:   str("copyright"),
+		Information: str("information"),
+		ClusterName: str("cluster_name"),
+	}
+}
+
+// Scan performs the following:
+//  1. Connect, and with --amqps, negotiate TLS.
+//  2. Unless --protocol-version is 1.0, send the 0-9-1 protocol header and
+//     read Connection.Start. With --protocol-version auto, if the server
+//     answers with the 1.0 header, continue on a new connection.
+//  3. For 1.0, send the SASL protocol header and read the mechanisms; if
+//     ANONYMOUS is offered, authenticate and read the open performative. If
+//     the server does not support SASL, open the connection without it, on a
+//     new connection.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	results := new(Results)
+	conn, err := scanner.open(ctx, &target, results)
+	if err != nil {
+		return finish(results, err)
+	}
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	if scanner.config.ProtocolVersion != "1.0" {
+		err := scan091(conn, results)
+		herr, ok := err.(*headerError)
+		if !ok || scanner.config.ProtocolVersion != "auto" || !bytes.Equal(herr.header, header10) && !bytes.Equal(herr.header, header10SASL) {
+			return finish(results, err)
+		}
+		conn.Close()
+		if conn, err = scanner.open(ctx, &target, results); err != nil {
+			return finish(results, err)
+		}
+	}
+	noSASL, err := scan10(conn, results)
+	if err != nil || !noSASL {
+		return finish(results, err)
+	}
+	conn.Close()
+	if conn, err = scanner.open(ctx, &target, results); err != nil {
+		return finish(results, err)
+	}
+	return finish(results, open10(conn, bufio.NewReader(conn), results))
+}
+
+// finish returns the outcome of a scan, which failed if err is not nil. The
+// results are omitted if the server did not answer.
+func finish(results *Results, err error) (zgrab2.ScanStatus, interface{}, error) {
+	if err == nil {
+		return zgrab2.SCAN_SUCCESS, results, nil
+	}
+	status := zgrab2.TryGetScanStatus(err)
+	if _, ok := err.(*headerError); ok || err == ErrInvalidFrame || err == ErrTooLarge {
+		status = zgrab2.SCAN_PROTOCOL_ERROR
+	}
+	if results.Protocol == "" && results.TLSLog == nil {
+		return status, nil, err
+	}
+	return status, results, err
+}
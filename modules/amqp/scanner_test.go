@@ -0,0 +1,133 @@
+package amqp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// longString returns a string prefixed by its 32-bit length.
+func longString(s []byte) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// field returns a field table entry.
+func field(name string, typ byte, value []byte) []byte {
+	return append(append([]byte{byte(len(name))}, name...), append([]byte{typ}, value...)...)
+}
+
+// rabbitMQStart returns the Connection.Start frame of a RabbitMQ server.
+func rabbitMQStart() []byte {
+	capabilities := append(field("publisher_confirms", 't', []byte{1}), field("basic.nack", 't', []byte{0})...)
+	var properties []byte
+	properties = append(properties, field("capabilities", 'F', longString(capabilities))...)
+	properties = append(properties, field("cluster_name", 'S', longString([]byte("rabbit@host")))...)
+	properties = append(properties, field("product", 'S', longString([]byte("RabbitMQ")))...)
+	properties = append(properties, field("version", 'S', longString([]byte("3.12.2")))...)
+	properties = append(properties, field("platform", 'S', longString([]byte("Erlang/OTP 25.3")))...)
+	payload := []byte{0, classConnection, 0, methodStart, 0, 9}
+	payload = append(payload, longString(properties)...)
+	payload = append(payload, longString([]byte("PLAIN AMQPLAIN"))...)
+	payload = append(payload, longString([]byte("en_US"))...)
+	frame := []byte{frameMethod, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[3:], uint32(len(payload)))
+	return append(append(frame, payload...), frameEnd)
+}
+
+// serve returns a handler passing the protocol header received to handle,
+// which answers it.
+func serve(handle func(conn net.Conn, header []byte)) func(conn net.Conn) error {
+	return func(conn net.Conn) error {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return err
+		}
+		handle(conn, header)
+		return nil
+	}
+}
+
+func scan(t *testing.T, handle func(conn net.Conn, header []byte)) *Results {
+	server, err := testserver.New(testserver.Config{Handler: serve(handle)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	return zgrab2test.MustScan(t, new(Scanner), &Flags{ProtocolVersion: "auto"}, server.Addr()).(*Results)
+}
+
+func TestAMQP091(t *testing.T) {
+	results := scan(t, func(conn net.Conn, header []byte) {
+		if bytes.Equal(header, header091) {
+			conn.Write(rabbitMQStart())
+		}
+	})
+	expected := &Results{
+		Protocol:      "0-9-1",
+		ServerVersion: "0-9",
+		ServerProperties: &ServerProperties{
+			Product:      "RabbitMQ",
+			Version:      "3.12.2",
+			Platform:     "Erlang/OTP 25.3",
+			ClusterName:  "rabbit@host",
+			Capabilities: []string{"publisher_confirms"},
+		},
+		Mechanisms: []string{"PLAIN", "AMQPLAIN"},
+		Locales:    []string{"en_US"},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("got %+v, expected %+v", results, expected)
+	}
+}
+
+func TestAMQP10(t *testing.T) {
+	// The mechanisms, as an array of symbols.
+	mechanisms := []byte{0xe0, 0, 2, 0xa3, 9, 'A', 'N', 'O', 'N', 'Y', 'M', 'O', 'U', 'S', 5, 'P', 'L', 'A', 'I', 'N'}
+	mechanisms[1] = byte(len(mechanisms) - 2)
+	// The properties of the open performative, as a map.
+	properties := []byte{0xc1, 0, 2, 0xa3, 7, 'p', 'r', 'o', 'd', 'u', 'c', 't', 0xa1, 12, 'a', 'p', 'a', 'c', 'h', 'e', '-', 'q', 'p', 'i', 'd', '!'}
+	properties[1] = byte(len(properties) - 2)
+	open := [][]byte{
+		encodeString("broker"), {0x40}, {0x40}, {0x40}, {0x40}, {0x40}, {0x40},
+		{0xa3, 4, 'A', 'N', 'O', 'N'}, {0x40}, properties,
+	}
+	results := scan(t, func(conn net.Conn, header []byte) {
+		switch {
+		case bytes.Equal(header, header091):
+			conn.Write(header10SASL)
+		case bytes.Equal(header, header10SASL):
+			conn.Write(header10SASL)
+			conn.Write(encodeFrame(frameSASL, descriptorSASLMechanisms, mechanisms))
+			if _, _, err := readFrame(conn); err != nil {
+				return
+			}
+			conn.Write(encodeFrame(frameSASL, descriptorSASLOutcome, []byte{0x50, 0}))
+			if _, err := io.ReadFull(conn, header); err != nil || !bytes.Equal(header, header10) {
+				return
+			}
+			if _, frame, err := readFrame(conn); err != nil || frame.field(0) != containerID {
+				return
+			}
+			conn.Write(header10)
+			conn.Write(encodeFrame(frameAMQP, descriptorOpen, open...))
+		}
+	})
+	expected := &Results{
+		Protocol:         "1.0",
+		ServerProperties: &ServerProperties{Product: "apache-qpid!", Capabilities: []string{"ANON"}},
+		Mechanisms:       []string{"ANONYMOUS", "PLAIN"},
+		SASLOutcome:      "ok",
+		ContainerID:      "broker",
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("got %+v, expected %+v", results, expected)
+	}
+}
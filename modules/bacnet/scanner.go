@@ -5,6 +5,8 @@
 package bacnet
 
 import (
+	"context"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
 )
@@ -48,6 +50,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Log)
+}
+
 // Description returns text uses in the help for this module.
 func (module *Module) Description() string {
 	return "Probe for devices that speak Bacnet, commonly used for HVAC control."
@@ -107,8 +114,8 @@ func (scanner *Scanner) Protocol() string {
 // 8. Description
 // 9. Location
 // The result is a bacnet.Log, and contains any of the above.
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	conn, err := target.OpenUDP(&scanner.config.BaseFlags, &scanner.config.UDPFlags)
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
@@ -4,6 +4,7 @@
 package banner
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -37,6 +38,9 @@ type Scanner struct {
 type Results struct {
 	Banner string `json:"banner,omitempty"`
 	Length int    `json:"length,omitempty"`
+
+	// Truncated is true if the server sent more than the banner read.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 // RegisterModule is called by modules/banner.go to register the scanner.
@@ -78,6 +82,11 @@ func (m *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (m *Module) NewResults() interface{} {
+	return new(Results)
+}
+
 // Validate validates the flags and returns nil on success.
 func (f *Flags) Validate(args []string) error {
 	return nil
@@ -108,7 +117,7 @@ func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 
 var NoMatchError = errors.New("pattern did not match")
 
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
 	try := 0
 	var (
 		conn    net.Conn
@@ -117,7 +126,7 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	)
 	for try < scanner.config.MaxTries {
 		try += 1
-		conn, err = target.Open(&scanner.config.BaseFlags)
+		conn, err = target.Open(ctx, &scanner.config.BaseFlags)
 		if err != nil {
 			continue
 		}
@@ -129,11 +138,12 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	defer conn.Close()
 
 	var ret []byte
+	var truncated bool
 	try = 0
 	for try < scanner.config.MaxTries {
 		try += 1
 		_, err = conn.Write(scanner.probe)
-		ret, readerr = zgrab2.ReadAvailable(conn)
+		ret, truncated, readerr = zgrab2.ReadAvailableTruncated(conn)
 		if err != nil {
 			continue
 		}
@@ -148,7 +158,7 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	if readerr != io.EOF && readerr != nil {
 		return zgrab2.TryGetScanStatus(readerr), nil, readerr
 	}
-	results := Results{Banner: string(ret), Length: len(ret)}
+	results := Results{Banner: string(ret), Length: len(ret), Truncated: truncated}
 	if scanner.regex.Match(ret) {
 		return zgrab2.SCAN_SUCCESS, &results, nil
 	}
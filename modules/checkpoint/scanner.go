@@ -5,6 +5,7 @@
 package checkpoint
 
 import (
+	"context"
 	"net"
 	"strings"
 
@@ -65,6 +66,11 @@ func (m *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (m *Module) NewResults() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (m *Module) Description() string {
 	return "Get the Checkpoint Admin interface hostname"
@@ -149,9 +155,9 @@ func (cnx *Connection)decodeAnswer(answer []byte) {
 // * Send a first header
 // * If the answer if indeed from checkpoint, sends a second header
 // * Grab the hostname returned
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (status zgrab2.ScanStatus, result interface{}, thrown error) {
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (status zgrab2.ScanStatus, result interface{}, thrown error) {
 	var err error
-	conn, err := target.Open(&scanner.config.BaseFlags)
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
@@ -6,6 +6,8 @@
 package dnp3
 
 import (
+	"context"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
 )
@@ -46,6 +48,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(DNP3Log)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for DNP3, a SCADA protocol"
@@ -92,9 +99,9 @@ func (scanner *Scanner) Protocol() string {
 
 // Scan probes for a DNP3 service.
 // Connects to the configured TCP port (default 20000) and reads the banner.
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
 	// TODO: Allow UDP?
-	conn, err := target.Open(&scanner.config.BaseFlags)
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
@@ -0,0 +1,7 @@
+package modules
+
+import "github.com/zmap/zgrab2/modules/dns"
+
+func init() {
+	dns.RegisterModule()
+}
@@ -0,0 +1,350 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// The header bits that dnsmessage.Header does not expose.
+const (
+	flagAuthenticData    = 1 << 5
+	flagCheckingDisabled = 1 << 4
+)
+
+// optionNSID is the EDNS option code of the name server identifier (RFC 5001).
+const optionNSID = 3
+
+var (
+	// ErrInvalidResponse is returned if the response cannot be parsed as a
+	// DNS message.
+	ErrInvalidResponse = errors.New("invalid DNS response")
+
+	// ErrMismatchedID is returned if the response does not answer the query
+	// that was sent.
+	ErrMismatchedID = errors.New("response ID does not match the query")
+)
+
+var typeNames = map[dnsmessage.Type]string{
+	dnsmessage.TypeA:     "A",
+	dnsmessage.TypeNS:    "NS",
+	dnsmessage.TypeCNAME: "CNAME",
+	dnsmessage.TypeSOA:   "SOA",
+	dnsmessage.TypePTR:   "PTR",
+	dnsmessage.TypeMX:    "MX",
+	dnsmessage.TypeTXT:   "TXT",
+	dnsmessage.TypeAAAA:  "AAAA",
+	dnsmessage.TypeSRV:   "SRV",
+	dnsmessage.TypeOPT:   "OPT",
+	dnsmessage.TypeWKS:   "WKS",
+	dnsmessage.TypeHINFO: "HINFO",
+	dnsmessage.TypeMINFO: "MINFO",
+	dnsmessage.TypeAXFR:  "AXFR",
+	dnsmessage.TypeALL:   "ANY",
+	43:                   "DS",
+	46:                   "RRSIG",
+	47:                   "NSEC",
+	48:                   "DNSKEY",
+	52:                   "TLSA",
+	64:                   "SVCB",
+	65:                   "HTTPS",
+	257:                  "CAA",
+}
+
+var rcodeNames = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+// typeName returns the mnemonic of a record type, or TYPE<n> for the others
+// (RFC 3597).
+func typeName(t dnsmessage.Type) string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", t)
+}
+
+// parseType parses a record type given by its mnemonic, as TYPE<n>, or as a
+// number.
+func parseType(s string) (dnsmessage.Type, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for t, name := range typeNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(s, "TYPE"), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("unknown query type %q", s)
+	}
+	return dnsmessage.Type(n), nil
+}
+
+// rcodeName returns the mnemonic of a response code.
+func rcodeName(rcode dnsmessage.RCode) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+// Question is an entry of the question section.
+type Question struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Query describes the query sent to the server.
+type Query struct {
+	Question
+
+	// RecursionDesired is true if the RD bit was set.
+	RecursionDesired bool `json:"recursion_desired"`
+
+	// EDNS is true if an OPT record was added.
+	EDNS bool `json:"edns,omitempty"`
+}
+
+// HeaderFlags are the header bits of the response.
+type HeaderFlags struct {
+	Authoritative      bool `json:"authoritative"`
+	Truncated          bool `json:"truncated"`
+	RecursionDesired   bool `json:"recursion_desired"`
+	RecursionAvailable bool `json:"recursion_available"`
+	AuthenticData      bool `json:"authentic_data"`
+	CheckingDisabled   bool `json:"checking_disabled"`
+}
+
+// Record is a resource record of the response, with its data in
+// presentation format. Data is empty for the types the module cannot decode.
+type Record struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Class uint16 `json:"class"`
+	TTL   uint32 `json:"ttl"`
+	Data  string `json:"data,omitempty"`
+}
+
+// EDNS is the content of the OPT record of the response.
+type EDNS struct {
+	Version uint8  `json:"version"`
+	UDPSize uint16 `json:"udp_size"`
+	DNSSEC  bool   `json:"dnssec_ok"`
+
+	// NSID is the name server identifier, if requested and returned.
+	NSID string `json:"nsid,omitempty"`
+
+	// Options lists the codes of all the options returned.
+	Options []uint16 `json:"options,omitempty"`
+}
+
+// Response is the parsed response to the query.
+type Response struct {
+	ID     uint16      `json:"id"`
+	Opcode int         `json:"opcode"`
+	RCode  string      `json:"rcode"`
+	Flags  HeaderFlags `json:"flags"`
+
+	Questions   []Question `json:"questions,omitempty"`
+	Answers     []Record   `json:"answers,omitempty"`
+	Authorities []Record   `json:"authorities,omitempty"`
+	Additionals []Record   `json:"additionals,omitempty"`
+	EDNS        *EDNS      `json:"edns,omitempty"`
+}
+
+// queryOptions are the parameters of the query to send.
+type queryOptions struct {
+	name      dnsmessage.Name
+	qtype     dnsmessage.Type
+	recursion bool
+	edns      bool
+	udpSize   int
+	dnssec    bool
+	nsid      bool
+}
+
+// buildQuery encodes the query with the given ID.
+func buildQuery(id uint16, opts *queryOptions) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), dnsmessage.Header{
+		ID:               id,
+		RecursionDesired: opts.recursion,
+	})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	q := dnsmessage.Question{Name: opts.name, Type: opts.qtype, Class: dnsmessage.ClassINET}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if opts.edns {
+		if err := b.StartAdditionals(); err != nil {
+			return nil, err
+		}
+		var h dnsmessage.ResourceHeader
+		if err := h.SetEDNS0(opts.udpSize, dnsmessage.RCodeSuccess, opts.dnssec); err != nil {
+			return nil, err
+		}
+		var opt dnsmessage.OPTResource
+		if opts.nsid {
+			opt.Options = append(opt.Options, dnsmessage.Option{Code: optionNSID})
+		}
+		if err := b.OPTResource(h, opt); err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// parseResponse decodes a response.
+func parseResponse(msg []byte) (*Response, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	if !h.Response {
+		return nil, ErrInvalidResponse
+	}
+	ret := &Response{
+		ID:     h.ID,
+		Opcode: int(h.OpCode),
+		Flags: HeaderFlags{
+			Authoritative:      h.Authoritative,
+			Truncated:          h.Truncated,
+			RecursionDesired:   h.RecursionDesired,
+			RecursionAvailable: h.RecursionAvailable,
+			AuthenticData:      msg[3]&flagAuthenticData != 0,
+			CheckingDisabled:   msg[3]&flagCheckingDisabled != 0,
+		},
+	}
+	rcode := h.RCode
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	for _, q := range questions {
+		ret.Questions = append(ret.Questions, Question{Name: q.Name.String(), Type: typeName(q.Type)})
+	}
+	// A truncated response may end anywhere: keep the records read so far.
+	sections := []struct {
+		records *[]Record
+		header  func() (dnsmessage.ResourceHeader, error)
+		skip    func() error
+	}{
+		{&ret.Answers, p.AnswerHeader, p.SkipAnswer},
+		{&ret.Authorities, p.AuthorityHeader, p.SkipAuthority},
+		{&ret.Additionals, p.AdditionalHeader, p.SkipAdditional},
+	}
+parse:
+	for _, section := range sections {
+		for {
+			rh, err := section.header()
+			if err == dnsmessage.ErrSectionDone {
+				break
+			}
+			if err != nil {
+				if h.Truncated {
+					break parse
+				}
+				return nil, ErrInvalidResponse
+			}
+			if rh.Type == dnsmessage.TypeOPT {
+				opt, err := p.OPTResource()
+				if err != nil {
+					return nil, ErrInvalidResponse
+				}
+				ret.EDNS = parseEDNS(&rh, &opt)
+				rcode = rh.ExtendedRCode(rcode)
+				continue
+			}
+			data, err := recordData(&p, &rh, section.skip)
+			if err != nil {
+				if h.Truncated {
+					break parse
+				}
+				return nil, ErrInvalidResponse
+			}
+			*section.records = append(*section.records, Record{
+				Name:  rh.Name.String(),
+				Type:  typeName(rh.Type),
+				Class: uint16(rh.Class),
+				TTL:   rh.TTL,
+				Data:  data,
+			})
+		}
+	}
+	ret.RCode = rcodeName(rcode)
+	return ret, nil
+}
+
+// isOpenResolver returns true if the response shows that the server resolved
+// the recursive query for a name it is not authoritative for.
+func isOpenResolver(query *queryOptions, response *Response) bool {
+	return query.recursion && response.Flags.RecursionAvailable && !response.Flags.Authoritative &&
+		response.RCode == rcodeName(dnsmessage.RCodeSuccess) && len(response.Answers) > 0
+}
+
+// parseEDNS decodes an OPT record.
+func parseEDNS(h *dnsmessage.ResourceHeader, opt *dnsmessage.OPTResource) *EDNS {
+	ret := &EDNS{
+		Version: uint8(h.TTL >> 16),
+		UDPSize: uint16(h.Class),
+		DNSSEC:  h.DNSSECAllowed(),
+	}
+	for _, o := range opt.Options {
+		ret.Options = append(ret.Options, o.Code)
+		if o.Code == optionNSID {
+			ret.NSID = string(o.Data)
+		}
+	}
+	return ret
+}
+
+// recordData reads the body of the current record and formats it. The
+// records of other types are skipped with skip.
+func recordData(p *dnsmessage.Parser, h *dnsmessage.ResourceHeader, skip func() error) (string, error) {
+	switch h.Type {
+	case dnsmessage.TypeA:
+		r, err := p.AResource()
+		return net.IP(r.A[:]).String(), err
+	case dnsmessage.TypeAAAA:
+		r, err := p.AAAAResource()
+		return net.IP(r.AAAA[:]).String(), err
+	case dnsmessage.TypeNS:
+		r, err := p.NSResource()
+		return r.NS.String(), err
+	case dnsmessage.TypeCNAME:
+		r, err := p.CNAMEResource()
+		return r.CNAME.String(), err
+	case dnsmessage.TypePTR:
+		r, err := p.PTRResource()
+		return r.PTR.String(), err
+	case dnsmessage.TypeMX:
+		r, err := p.MXResource()
+		return fmt.Sprintf("%d %s", r.Pref, r.MX.String()), err
+	case dnsmessage.TypeSRV:
+		r, err := p.SRVResource()
+		return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Target.String()), err
+	case dnsmessage.TypeSOA:
+		r, err := p.SOAResource()
+		return fmt.Sprintf("%s %s %d %d %d %d %d", r.NS.String(), r.MBox.String(), r.Serial, r.Refresh, r.Retry, r.Expire, r.MinTTL), err
+	case dnsmessage.TypeTXT:
+		r, err := p.TXTResource()
+		quoted := make([]string, len(r.TXT))
+		for i, s := range r.TXT {
+			quoted[i] = strconv.Quote(s)
+		}
+		return strings.Join(quoted, " "), err
+	}
+	return "", skip()
+}
@@ -0,0 +1,120 @@
+package dns
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseType(t *testing.T) {
+	tests := map[string]dnsmessage.Type{
+		"A":      dnsmessage.TypeA,
+		"aaaa":   dnsmessage.TypeAAAA,
+		"ANY":    dnsmessage.TypeALL,
+		"TYPE99": 99,
+		"257":    257,
+	}
+	for s, want := range tests {
+		got, err := parseType(s)
+		if err != nil {
+			t.Errorf("parseType(%q): %s", s, err)
+		} else if got != want {
+			t.Errorf("parseType(%q) = %d, want %d", s, got, want)
+		}
+	}
+	if _, err := parseType("BOGUS"); err == nil {
+		t.Error("parseType accepted an unknown type")
+	}
+}
+
+// buildResponse returns a response to query, answering with an A record and
+// an OPT record carrying an NSID.
+func buildResponse(t *testing.T, query []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := p.Question()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 h.ID,
+		Response:           true,
+		RecursionDesired:   h.RecursionDesired,
+		RecursionAvailable: true,
+	})
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 300}, dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}})
+	b.MXResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 300}, dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mail.example.com.")})
+	b.StartAuthorities()
+	b.TXTResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.TXTResource{TXT: []string{"a b", "c"}})
+	b.StartAdditionals()
+	var rh dnsmessage.ResourceHeader
+	rh.SetEDNS0(4096, dnsmessage.RCodeSuccess, true)
+	b.OPTResource(rh, dnsmessage.OPTResource{Options: []dnsmessage.Option{{Code: optionNSID, Data: []byte("ns1")}}})
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestQueryResponse(t *testing.T) {
+	opts := queryOptions{
+		name:      dnsmessage.MustNewName("example.com."),
+		qtype:     dnsmessage.TypeA,
+		recursion: true,
+		edns:      true,
+		udpSize:   1232,
+		nsid:      true,
+	}
+	query, err := buildQuery(1234, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseResponse(query); err != ErrInvalidResponse {
+		t.Errorf("a query was parsed as a response")
+	}
+	response, err := parseResponse(buildResponse(t, query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.ID != 1234 || response.RCode != "NOERROR" || !response.Flags.RecursionDesired || !response.Flags.RecursionAvailable {
+		t.Errorf("wrong header: %+v", response)
+	}
+	if len(response.Questions) != 1 || response.Questions[0] != (Question{Name: "example.com.", Type: "A"}) {
+		t.Errorf("wrong questions: %+v", response.Questions)
+	}
+	wantAnswers := []Record{
+		{Name: "example.com.", Type: "A", Class: 1, TTL: 300, Data: "192.0.2.1"},
+		{Name: "example.com.", Type: "MX", Class: 1, TTL: 300, Data: "10 mail.example.com."},
+	}
+	if len(response.Answers) != len(wantAnswers) {
+		t.Fatalf("wrong answers: %+v", response.Answers)
+	}
+	for i, want := range wantAnswers {
+		if response.Answers[i] != want {
+			t.Errorf("answer %d: got %+v, want %+v", i, response.Answers[i], want)
+		}
+	}
+	if len(response.Authorities) != 1 || response.Authorities[0].Data != `"a b" "c"` {
+		t.Errorf("wrong authorities: %+v", response.Authorities)
+	}
+	if len(response.Additionals) != 0 {
+		t.Errorf("the OPT record was reported as an additional record: %+v", response.Additionals)
+	}
+	if e := response.EDNS; e == nil || e.UDPSize != 4096 || !e.DNSSEC || e.NSID != "ns1" {
+		t.Errorf("wrong EDNS: %+v", e)
+	}
+	if !isOpenResolver(&opts, response) {
+		t.Error("recursive answer not reported as an open resolver")
+	}
+	opts.recursion = false
+	if isOpenResolver(&opts, response) {
+		t.Error("non-recursive query reported as an open resolver")
+	}
+}
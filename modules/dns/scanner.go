@@ -0,0 +1,346 @@
+// Package dns provides a zgrab2 module that sends a DNS query and records the
+// parsed response.
+// Default Port: 53 (UDP)
+//
+// The query (name, type, recursion desired bit and EDNS options) is set with
+// the flags, and can be sent over UDP, TCP, TLS (DNS over TLS, RFC 7858,
+// usually on port 853) or HTTPS (DNS over HTTPS, RFC 8484, usually on port
+// 443). The output reports the response code, the header flags and all the
+// records of the response, and whether the server acts as an open resolver.
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// maxMessageSize is the largest possible DNS message.
+const maxMessageSize = 65535
+
+// Flags holds the command-line configuration for the dns module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+	zgrab2.TLSFlags
+
+	Transport   string `long:"transport" default:"udp" choice:"udp" choice:"tcp" choice:"tls" choice:"https" description:"Transport of the query: plain UDP or TCP, DNS over TLS, or DNS over HTTPS."`
+	QueryName   string `long:"query-name" default:"example.com" description:"Name to query."`
+	QueryType   string `long:"query-type" default:"A" description:"Type of the records to query, as a mnemonic (A, AAAA, TXT, ANY...) or a number."`
+	NoRecursion bool   `long:"no-recursion" description:"Do not set the recursion desired (RD) bit."`
+	EDNS        bool   `long:"edns" description:"Add an EDNS(0) OPT record to the query."`
+	UDPSize     int    `long:"edns-udp-size" default:"1232" description:"UDP payload size advertised in the OPT record."`
+	DNSSEC      bool   `long:"dnssec" description:"Set the DNSSEC OK (DO) bit. Implies --edns."`
+	NSID        bool   `long:"nsid" description:"Request the name server identifier (NSID). Implies --edns."`
+	DoHPath     string `long:"doh-path" default:"/dns-query" description:"Path of the DNS over HTTPS endpoint."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+	query  queryOptions
+}
+
+// Results is the output of the dns module.
+type Results struct {
+	// Transport is the transport the query was sent over.
+	Transport string `json:"transport"`
+
+	// Query is the query that was sent.
+	Query *Query `json:"query"`
+
+	// Response is the parsed response.
+	Response *Response `json:"response,omitempty"`
+
+	// RawResponse is the response as received.
+	RawResponse []byte `json:"raw_response,omitempty"`
+
+	// OpenResolver is true if the server answered a recursive query with
+	// records for which it is not authoritative.
+	OpenResolver bool `json:"open_resolver"`
+
+	// HTTPStatus is the status code of the DNS over HTTPS response.
+	HTTPStatus int `json:"http_status,omitempty"`
+
+	// TLSLog is the TLS handshake log of DNS over TLS and DNS over HTTPS.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("dns", "DNS", module.Description(), 53, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Send a DNS query over UDP, TCP, TLS or HTTPS and record the response"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if _, err := parseType(flags.QueryType); err != nil {
+		log.Errorf("invalid --query-type: %s", err)
+		return zgrab2.ErrInvalidArguments
+	}
+	if _, err := dnsmessage.NewName(fqdn(flags.QueryName)); err != nil {
+		log.Errorf("invalid --query-name %q: %s", flags.QueryName, err)
+		return zgrab2.ErrInvalidArguments
+	}
+	if flags.UDPSize < 512 || flags.UDPSize > maxMessageSize {
+		return zgrab2.ErrInvalidArguments
+	}
+	if !strings.HasPrefix(flags.DoHPath, "/") {
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	qtype, err := parseType(f.QueryType)
+	if err != nil {
+		return err
+	}
+	name, err := dnsmessage.NewName(fqdn(f.QueryName))
+	if err != nil {
+		return err
+	}
+	scanner.query = queryOptions{
+		name:      name,
+		qtype:     qtype,
+		recursion: !f.NoRecursion,
+		edns:      f.EDNS || f.DNSSEC || f.NSID,
+		udpSize:   f.UDPSize,
+		dnssec:    f.DNSSEC,
+		nsid:      f.NSID,
+	}
+	if f.Transport == "https" && f.NextProtos == "" {
+		f.NextProtos = "http/1.1"
+	}
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "dns"
+}
+
+// fqdn returns name with a trailing dot.
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// newQuery returns the description of the query to output.
+func (scanner *Scanner) newQuery() *Query {
+	q := &scanner.query
+	return &Query{
+		Question:         Question{Name: q.name.String(), Type: typeName(q.qtype)},
+		RecursionDesired: q.recursion,
+		EDNS:             q.edns,
+	}
+}
+
+// Scan sends the query over the configured transport, and parses the
+// response. A response with any response code is a success.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	results := &Results{
+		Transport: scanner.config.Transport,
+		Query:     scanner.newQuery(),
+	}
+	// DNS over HTTPS queries use ID 0, so that they can be cached.
+	var id uint16
+	if scanner.config.Transport != "https" {
+		var b [2]byte
+		rand.Read(b[:])
+		id = binary.BigEndian.Uint16(b[:])
+	}
+	msg, err := buildQuery(id, &scanner.query)
+	if err != nil {
+		return zgrab2.SCAN_UNKNOWN_ERROR, nil, err
+	}
+	var raw []byte
+	switch scanner.config.Transport {
+	case "udp":
+		raw, err = scanner.exchangeUDP(ctx, &target, msg)
+	case "tcp":
+		var conn net.Conn
+		if conn, err = target.Open(ctx, &scanner.config.BaseFlags); err != nil {
+			return zgrab2.TryGetScanStatus(err), nil, err
+		}
+		defer conn.Close()
+		raw, err = exchangeStream(conn, msg)
+	case "tls", "https":
+		conn, tlsErr := target.OpenTLS(ctx, &scanner.config.BaseFlags, &scanner.config.TLSFlags)
+		if conn != nil {
+			defer conn.Close()
+			results.TLSLog = conn.GetLog()
+		}
+		if tlsErr != nil {
+			if results.TLSLog != nil {
+				return zgrab2.TryGetScanStatus(tlsErr), results, tlsErr
+			}
+			return zgrab2.TryGetScanStatus(tlsErr), nil, tlsErr
+		}
+		if scanner.config.Transport == "tls" {
+			raw, err = exchangeStream(conn, msg)
+		} else {
+			raw, results.HTTPStatus, err = scanner.exchangeHTTPS(conn, &target, msg)
+		}
+	}
+	results.RawResponse = raw
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), results, err
+	}
+	response, err := parseResponse(raw)
+	if err != nil {
+		return zgrab2.SCAN_PROTOCOL_ERROR, results, err
+	}
+	results.Response = response
+	if response.ID != id {
+		return zgrab2.SCAN_PROTOCOL_ERROR, results, ErrMismatchedID
+	}
+	results.OpenResolver = isOpenResolver(&scanner.query, response)
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
+
+// exchangeUDP sends the query in a datagram, and returns the first datagram
+// received.
+func (scanner *Scanner) exchangeUDP(ctx context.Context, target *zgrab2.ScanTarget, msg []byte) ([]byte, error) {
+	conn, err := target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	if timeout := scanner.config.Timeout; timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	buf := make([]byte, maxMessageSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// exchangeStream sends the query over a TCP or TLS connection, each message
+// prefixed by its length, and returns the response.
+func exchangeStream(conn net.Conn, msg []byte) ([]byte, error) {
+	framed := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(framed, uint16(len(msg)))
+	copy(framed[2:], msg)
+	if _, err := conn.Write(framed); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	ret := make([]byte, binary.BigEndian.Uint16(length[:]))
+	n, err := io.ReadFull(conn, ret)
+	if err != nil && n > 0 {
+		return ret[:n], err
+	}
+	return ret, err
+}
+
+// exchangeHTTPS posts the query to the DNS over HTTPS endpoint on an
+// established TLS connection, and returns the response body and status code.
+func (scanner *Scanner) exchangeHTTPS(conn net.Conn, target *zgrab2.ScanTarget, msg []byte) ([]byte, int, error) {
+	host := target.Host()
+	if target.Domain != "" {
+		host = target.Domain
+	}
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "POST %s HTTP/1.1\r\n", scanner.config.DoHPath)
+	fmt.Fprintf(&req, "Host: %s\r\n", host)
+	req.WriteString("Accept: application/dns-message\r\n")
+	req.WriteString("Content-Type: application/dns-message\r\n")
+	fmt.Fprintf(&req, "Content-Length: %d\r\n", len(msg))
+	req.WriteString("Connection: close\r\n\r\n")
+	req.Write(msg)
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return nil, 0, err
+	}
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxMessageSize))
+	if err != nil {
+		return nil, res.StatusCode, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, res.StatusCode, zgrab2.NewScanError(zgrab2.SCAN_APPLICATION_ERROR, fmt.Errorf("unexpected HTTP status %s", res.Status))
+	}
+	return body, res.StatusCode, nil
+}
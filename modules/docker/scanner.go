@@ -0,0 +1,287 @@
+// Package docker provides a zgrab2 module that reads the details exposed by
+// the API of Docker daemons.
+// Default Port: 2375 (TCP)
+//
+// The scanner requests /version and /info, over HTTPS if --use-https is set
+// (as on port 2376). A daemon answering without credentials gives anyone
+// control of its containers, and usually of the host. A daemon listening with
+// TLS is only protected if it requires a client certificate, which is
+// recorded when the handshake fails for lack of one; a plain HTTP request to
+// a TLS port is recorded too.
+package docker
+
+import (
+	"bytes"
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/jsonapi"
+)
+
+// Flags holds the command-line configuration for the docker module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	UseHTTPS  bool   `long:"use-https" description:"Perform an HTTPS connection on the initial host"`
+	UserAgent string `long:"user-agent" default:"Mozilla/5.0 zgrab/0.x" description:"Set a custom user agent"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Version holds the response of /version.
+type Version struct {
+	Version       string `json:"version,omitempty"`
+	APIVersion    string `json:"api_version,omitempty"`
+	MinAPIVersion string `json:"min_api_version,omitempty"`
+	GitCommit     string `json:"git_commit,omitempty"`
+	GoVersion     string `json:"go_version,omitempty"`
+	OS            string `json:"os,omitempty"`
+	Arch          string `json:"arch,omitempty"`
+	KernelVersion string `json:"kernel_version,omitempty"`
+	BuildTime     string `json:"build_time,omitempty"`
+	Platform      string `json:"platform,omitempty"`
+}
+
+// Info holds the fields of interest of /info.
+type Info struct {
+	ID                string   `json:"id,omitempty"`
+	Name              string   `json:"name,omitempty"`
+	ServerVersion     string   `json:"server_version,omitempty"`
+	OperatingSystem   string   `json:"operating_system,omitempty"`
+	OSType            string   `json:"os_type,omitempty"`
+	Architecture      string   `json:"architecture,omitempty"`
+	KernelVersion     string   `json:"kernel_version,omitempty"`
+	Containers        int      `json:"containers"`
+	ContainersRunning int      `json:"containers_running"`
+	ContainersPaused  int      `json:"containers_paused"`
+	ContainersStopped int      `json:"containers_stopped"`
+	Images            int      `json:"images"`
+	Driver            string   `json:"driver,omitempty"`
+	NCPU              int      `json:"ncpu,omitempty"`
+	MemTotal          int64    `json:"mem_total,omitempty"`
+	DockerRootDir     string   `json:"docker_root_dir,omitempty"`
+	SwarmState        string   `json:"swarm_state,omitempty"`
+	SecurityOptions   []string `json:"security_options,omitempty"`
+}
+
+// Results is the output of the docker module.
+type Results struct {
+	// Unauthenticated is true if the daemon returned its version without
+	// credentials.
+	Unauthenticated bool `json:"unauthenticated"`
+
+	// AuthRequired is true if the request was refused, as by an
+	// authorization plugin.
+	AuthRequired bool `json:"auth_required"`
+
+	// ClientCertificateRequired is true if the TLS handshake failed for lack
+	// of a client certificate.
+	ClientCertificateRequired bool `json:"client_certificate_required"`
+
+	// TLSRequired is true if the daemon refused a plain HTTP request.
+	TLSRequired bool `json:"tls_required"`
+
+	// StatusCode is the status code of the response to /version.
+	StatusCode int `json:"status_code,omitempty"`
+
+	Version *Version `json:"version,omitempty"`
+	Info    *Info    `json:"info,omitempty"`
+
+	// TLSLog is the log of the TLS handshake, with --use-https.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("docker", "Docker", module.Description(), 2375, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Read the version and details of an exposed Docker daemon, and whether it requires a TLS client certificate"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "docker"
+}
+
+// versionResponse is the response of /version.
+type versionResponse struct {
+	Version       string
+	APIVersion    string `json:"ApiVersion"`
+	MinAPIVersion string `json:"MinAPIVersion"`
+	GitCommit     string
+	GoVersion     string
+	Os            string
+	Arch          string
+	KernelVersion string
+	BuildTime     string
+	Platform      struct {
+		Name string
+	}
+}
+
+// infoResponse is the response of /info.
+type infoResponse struct {
+	ID                string
+	Name              string
+	ServerVersion     string
+	OperatingSystem   string
+	OSType            string
+	Architecture      string
+	KernelVersion     string
+	Containers        int
+	ContainersRunning int
+	ContainersPaused  int
+	ContainersStopped int
+	Images            int
+	Driver            string
+	NCPU              int
+	MemTotal          int64
+	DockerRootDir     string
+	Swarm             struct {
+		LocalNodeState string
+	}
+	SecurityOptions []string
+}
+
+// Scan requests /version, then /info if the daemon answered. The scan
+// succeeds if the daemon answered, or if the TLS handshake failed for lack
+// of a client certificate.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	client := &jsonapi.Client{
+		Target:    &target,
+		BaseFlags: &scanner.config.BaseFlags,
+		TLSFlags:  &scanner.config.TLSFlags,
+		UseTLS:    scanner.config.UseHTTPS,
+		UserAgent: scanner.config.UserAgent,
+	}
+	results := new(Results)
+	var v versionResponse
+	resp, err := client.GetJSON(ctx, "/version", &v)
+	results.TLSLog = client.TLSLog
+	if resp == nil {
+		if scanner.config.UseHTTPS && jsonapi.ClientCertificateRequired(err) {
+			results.ClientCertificateRequired = true
+			return zgrab2.SCAN_SUCCESS, results, nil
+		}
+		if results.TLSLog != nil {
+			return zgrab2.TryGetScanStatus(err), results, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	results.StatusCode = resp.StatusCode
+	results.AuthRequired = resp.AuthRequired()
+	results.TLSRequired = resp.StatusCode == 400 && bytes.Contains(resp.Body, []byte("HTTP request to an HTTPS server"))
+	if err != nil {
+		return zgrab2.SCAN_PROTOCOL_ERROR, results, err
+	}
+	if !resp.OK() {
+		return zgrab2.SCAN_SUCCESS, results, nil
+	}
+	results.Unauthenticated = v.APIVersion != ""
+	results.Version = &Version{
+		Version:       v.Version,
+		APIVersion:    v.APIVersion,
+		MinAPIVersion: v.MinAPIVersion,
+		GitCommit:     v.GitCommit,
+		GoVersion:     v.GoVersion,
+		OS:            v.Os,
+		Arch:          v.Arch,
+		KernelVersion: v.KernelVersion,
+		BuildTime:     v.BuildTime,
+		Platform:      v.Platform.Name,
+	}
+	var i infoResponse
+	if resp, err := client.GetJSON(ctx, "/info", &i); err != nil || !resp.OK() {
+		log.Debugf("docker: request of /info from %s failed: %v", target.String(), err)
+		return zgrab2.SCAN_SUCCESS, results, nil
+	}
+	results.Info = &Info{
+		ID:                i.ID,
+		Name:              i.Name,
+		ServerVersion:     i.ServerVersion,
+		OperatingSystem:   i.OperatingSystem,
+		OSType:            i.OSType,
+		Architecture:      i.Architecture,
+		KernelVersion:     i.KernelVersion,
+		Containers:        i.Containers,
+		ContainersRunning: i.ContainersRunning,
+		ContainersPaused:  i.ContainersPaused,
+		ContainersStopped: i.ContainersStopped,
+		Images:            i.Images,
+		Driver:            i.Driver,
+		NCPU:              i.NCPU,
+		MemTotal:          i.MemTotal,
+		DockerRootDir:     i.DockerRootDir,
+		SwarmState:        i.Swarm.LocalNodeState,
+		SecurityOptions:   i.SecurityOptions,
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
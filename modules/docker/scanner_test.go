@@ -0,0 +1,56 @@
+package docker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+)
+
+const versionResponseBody = `{"Platform":{"Name":"Docker Engine - Community"},"Version":"24.0.5","ApiVersion":"1.43","MinAPIVersion":"1.12","GitCommit":"a61e2b4","GoVersion":"go1.20.6","Os":"linux","Arch":"amd64","KernelVersion":"5.15.0-78-generic","BuildTime":"2023-07-21T20:35:20.000000000+00:00"}`
+
+const infoResponseBody = `{"ID":"7TRN:IPZB","Containers":14,"ContainersRunning":3,"ContainersPaused":0,"ContainersStopped":11,"Images":52,"Driver":"overlay2","NCPU":8,"MemTotal":33536741376,"DockerRootDir":"/var/lib/docker","Name":"build-01","ServerVersion":"24.0.5","OperatingSystem":"Ubuntu 22.04.3 LTS","OSType":"linux","Architecture":"x86_64","Swarm":{"LocalNodeState":"inactive"},"SecurityOptions":["name=apparmor","name=seccomp,profile=builtin"]}`
+
+func scan(t *testing.T, handler http.HandlerFunc) *Results {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	return zgrab2test.MustScan(t, new(Scanner), new(Flags), server.Listener.Addr().String()).(*Results)
+}
+
+func TestExposed(t *testing.T) {
+	results := scan(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			w.Write([]byte(versionResponseBody))
+		case "/info":
+			w.Write([]byte(infoResponseBody))
+		}
+	})
+	if !results.Unauthenticated || results.Version == nil || results.Version.APIVersion != "1.43" || results.Version.Platform != "Docker Engine - Community" {
+		t.Errorf("got %+v, version %+v", results, results.Version)
+	}
+	if results.Info == nil || results.Info.Containers != 14 || results.Info.Images != 52 || results.Info.SwarmState != "inactive" || len(results.Info.SecurityOptions) != 2 {
+		t.Errorf("got info %+v", results.Info)
+	}
+}
+
+func TestTLSRequired(t *testing.T) {
+	results := scan(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Client sent an HTTP request to an HTTPS server.\n"))
+	})
+	if results.Unauthenticated || !results.TLSRequired || results.StatusCode != http.StatusBadRequest || results.Version != nil {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestAuthorizationPlugin(t *testing.T) {
+	results := scan(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"authorization denied by plugin opa-docker-authz"}`))
+	})
+	if results.Unauthenticated || !results.AuthRequired || results.Info != nil {
+		t.Errorf("got %+v", results)
+	}
+}
@@ -0,0 +1,286 @@
+// Package elasticsearch provides a zgrab2 module that reads the cluster
+// details exposed by the REST API of Elasticsearch and OpenSearch.
+// Default Port: 9200 (TCP)
+//
+// The scanner requests each of the --endpoints, over HTTPS if --use-https is
+// set. The responses of the known endpoints are parsed: the root endpoint
+// gives the cluster name and version, /_cluster/health the number of nodes
+// and the health, and /_cat/indices the indices. A cluster answering the root
+// endpoint without credentials is unauthenticated, and lets anyone read (and
+// usually write) its data.
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/jsonapi"
+)
+
+// Flags holds the command-line configuration for the elasticsearch module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	Endpoints  string `long:"endpoints" default:"/,/_cluster/health,/_cat/indices?format=json" description:"Comma-separated endpoints to request; the first is expected to be the root endpoint."`
+	UseHTTPS   bool   `long:"use-https" description:"Perform an HTTPS connection on the initial host"`
+	UserAgent  string `long:"user-agent" default:"Mozilla/5.0 zgrab/0.x" description:"Set a custom user agent"`
+	MaxSize    int    `long:"max-size" default:"1024" description:"Max kilobytes to read in response to each request"`
+	MaxIndices int    `long:"max-indices" default:"100" description:"Max number of indices to record"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config    *Flags
+	endpoints []string
+}
+
+// Version is the version of the root endpoint.
+type Version struct {
+	Number                           string `json:"number,omitempty"`
+	Distribution                     string `json:"distribution,omitempty"`
+	BuildFlavor                      string `json:"build_flavor,omitempty"`
+	BuildType                        string `json:"build_type,omitempty"`
+	BuildHash                        string `json:"build_hash,omitempty"`
+	BuildDate                        string `json:"build_date,omitempty"`
+	LuceneVersion                    string `json:"lucene_version,omitempty"`
+	MinimumWireCompatibilityVersion  string `json:"minimum_wire_compatibility_version,omitempty"`
+	MinimumIndexCompatibilityVersion string `json:"minimum_index_compatibility_version,omitempty"`
+}
+
+// Health is the response of /_cluster/health.
+type Health struct {
+	Status              string `json:"status,omitempty"`
+	TimedOut            bool   `json:"timed_out"`
+	NumberOfNodes       int    `json:"number_of_nodes"`
+	NumberOfDataNodes   int    `json:"number_of_data_nodes"`
+	ActivePrimaryShards int    `json:"active_primary_shards"`
+	ActiveShards        int    `json:"active_shards"`
+	UnassignedShards    int    `json:"unassigned_shards"`
+}
+
+// Index is an index listed by /_cat/indices, whose fields are all strings.
+type Index struct {
+	Index     string `json:"index"`
+	Health    string `json:"health,omitempty"`
+	Status    string `json:"status,omitempty"`
+	UUID      string `json:"uuid,omitempty"`
+	DocsCount string `json:"docs.count,omitempty"`
+	StoreSize string `json:"store.size,omitempty"`
+}
+
+// Endpoint is the outcome of the request of an endpoint.
+type Endpoint struct {
+	Path       string `json:"path"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+
+	// Body is the body of the response to an endpoint which is not parsed.
+	Body string `json:"body,omitempty"`
+}
+
+// Results is the output of the elasticsearch module.
+type Results struct {
+	// Unauthenticated is true if the root endpoint returned the cluster
+	// details without credentials, and AuthRequired if the first request was
+	// refused.
+	Unauthenticated bool `json:"unauthenticated"`
+	AuthRequired    bool `json:"auth_required"`
+
+	// The fields of the root endpoint.
+	Name        string   `json:"name,omitempty"`
+	ClusterName string   `json:"cluster_name,omitempty"`
+	ClusterUUID string   `json:"cluster_uuid,omitempty"`
+	Version     *Version `json:"version,omitempty"`
+	Tagline     string   `json:"tagline,omitempty"`
+
+	// Health is the cluster health.
+	Health *Health `json:"health,omitempty"`
+
+	// IndexCount is the number of indices, and Indices the first of them.
+	IndexCount int     `json:"index_count,omitempty"`
+	Indices    []Index `json:"indices,omitempty"`
+
+	// Endpoints lists the outcome of each request.
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+
+	// TLSLog is the log of the TLS handshake, with --use-https.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("elasticsearch", "Elasticsearch", module.Description(), 9200, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Read the cluster name, version, health and indices exposed by the REST API of Elasticsearch or OpenSearch"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	for _, endpoint := range strings.Split(flags.Endpoints, ",") {
+		if !strings.HasPrefix(strings.TrimSpace(endpoint), "/") {
+			log.Errorf("Invalid endpoint %q: must start with /", endpoint)
+			return zgrab2.ErrInvalidArguments
+		}
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	scanner.endpoints = nil
+	for _, endpoint := range strings.Split(f.Endpoints, ",") {
+		scanner.endpoints = append(scanner.endpoints, strings.TrimSpace(endpoint))
+	}
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "elasticsearch"
+}
+
+// root holds the fields of the root endpoint.
+type root struct {
+	Name        string   `json:"name"`
+	ClusterName string   `json:"cluster_name"`
+	ClusterUUID string   `json:"cluster_uuid"`
+	Version     *Version `json:"version"`
+	Tagline     string   `json:"tagline"`
+}
+
+// parse decodes the response to a known endpoint into results, returning
+// false if the endpoint is unknown.
+func (scanner *Scanner) parse(path string, body []byte, results *Results) (bool, error) {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	switch strings.TrimSuffix(path, "/") {
+	case "":
+		var r root
+		if err := json.Unmarshal(body, &r); err != nil {
+			return true, err
+		}
+		results.Name, results.ClusterName, results.ClusterUUID = r.Name, r.ClusterName, r.ClusterUUID
+		results.Version, results.Tagline = r.Version, r.Tagline
+		results.Unauthenticated = r.Version != nil || r.ClusterName != ""
+	case "/_cluster/health":
+		results.Health = new(Health)
+		return true, json.Unmarshal(body, results.Health)
+	case "/_cat/indices":
+		var indices []Index
+		if err := json.Unmarshal(body, &indices); err != nil {
+			return true, err
+		}
+		results.IndexCount = len(indices)
+		if len(indices) > scanner.config.MaxIndices {
+			indices = indices[:scanner.config.MaxIndices]
+		}
+		results.Indices = indices
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// Scan requests each endpoint in turn. The scan fails if the first request
+// gets no HTTP response.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	client := &jsonapi.Client{
+		Target:    &target,
+		BaseFlags: &scanner.config.BaseFlags,
+		TLSFlags:  &scanner.config.TLSFlags,
+		UseTLS:    scanner.config.UseHTTPS,
+		UserAgent: scanner.config.UserAgent,
+		MaxSize:   scanner.config.MaxSize * 1024,
+	}
+	results := new(Results)
+	for i, path := range scanner.endpoints {
+		endpoint := Endpoint{Path: path}
+		resp, err := client.Get(ctx, path)
+		if err != nil && i == 0 {
+			if client.TLSLog != nil {
+				results.TLSLog = client.TLSLog
+				return zgrab2.TryGetScanStatus(err), results, err
+			}
+			return zgrab2.TryGetScanStatus(err), nil, err
+		}
+		if err != nil {
+			endpoint.Error = err.Error()
+			results.Endpoints = append(results.Endpoints, endpoint)
+			continue
+		}
+		endpoint.StatusCode = resp.StatusCode
+		if i == 0 {
+			results.AuthRequired = resp.AuthRequired()
+		}
+		if resp.OK() {
+			known, err := scanner.parse(path, resp.Body, results)
+			if err != nil {
+				endpoint.Error = err.Error()
+			}
+			if !known {
+				endpoint.Body = string(resp.Body)
+			}
+		}
+		results.Endpoints = append(results.Endpoints, endpoint)
+	}
+	results.TLSLog = client.TLSLog
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
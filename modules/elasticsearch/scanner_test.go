@@ -0,0 +1,85 @@
+package elasticsearch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+)
+
+const rootResponse = `{
+  "name" : "node-1",
+  "cluster_name" : "logs",
+  "cluster_uuid" : "hQ9ZU-DBQ5ejqsRxz3yVbw",
+  "version" : {
+    "number" : "7.17.9",
+    "build_flavor" : "default",
+    "build_type" : "docker",
+    "lucene_version" : "8.11.1"
+  },
+  "tagline" : "You Know, for Search"
+}`
+
+const healthResponse = `{"cluster_name":"logs","status":"yellow","timed_out":false,"number_of_nodes":3,"number_of_data_nodes":2,"active_primary_shards":10,"active_shards":20,"unassigned_shards":1}`
+
+const indicesResponse = `[
+  {"health":"yellow","status":"open","index":"customers","uuid":"u1","pri":"1","rep":"1","docs.count":"1200","docs.deleted":"0","store.size":"2mb","pri.store.size":"1mb"},
+  {"health":"green","status":"open","index":"orders","uuid":"u2","pri":"1","rep":"1","docs.count":"5","docs.deleted":"0","store.size":"10kb","pri.store.size":"5kb"}
+]`
+
+func scan(t *testing.T, handler http.HandlerFunc, flags *Flags) *Results {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	if flags.Endpoints == "" {
+		flags.Endpoints = "/,/_cluster/health,/_cat/indices?format=json,/_nodes"
+	}
+	return zgrab2test.MustScan(t, new(Scanner), flags, server.Listener.Addr().String()).(*Results)
+}
+
+func TestUnauthenticated(t *testing.T) {
+	results := scan(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(rootResponse))
+		case "/_cluster/health":
+			w.Write([]byte(healthResponse))
+		case "/_cat/indices":
+			if r.URL.Query().Get("format") == "json" {
+				w.Write([]byte(indicesResponse))
+			}
+		case "/_nodes":
+			w.Write([]byte(`{"_nodes":{}}`))
+		}
+	}, &Flags{MaxIndices: 1})
+	if !results.Unauthenticated || results.AuthRequired || results.ClusterName != "logs" || results.Version.Number != "7.17.9" {
+		t.Errorf("got %+v", results)
+	}
+	if results.Health == nil || results.Health.Status != "yellow" || results.Health.NumberOfNodes != 3 {
+		t.Errorf("got health %+v", results.Health)
+	}
+	expected := []Index{{Index: "customers", Health: "yellow", Status: "open", UUID: "u1", DocsCount: "1200", StoreSize: "2mb"}}
+	if results.IndexCount != 2 || !reflect.DeepEqual(results.Indices, expected) {
+		t.Errorf("got %d indices %+v", results.IndexCount, results.Indices)
+	}
+	if len(results.Endpoints) != 4 || results.Endpoints[3].Body != `{"_nodes":{}}` || results.Endpoints[0].Body != "" {
+		t.Errorf("got endpoints %+v", results.Endpoints)
+	}
+}
+
+func TestAuthRequired(t *testing.T) {
+	results := scan(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="security" charset="UTF-8"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"type":"security_exception"},"status":401}`))
+	}, &Flags{MaxIndices: 100})
+	if results.Unauthenticated || !results.AuthRequired || results.Version != nil || results.Health != nil {
+		t.Errorf("got %+v", results)
+	}
+	for _, e := range results.Endpoints {
+		if e.StatusCode != http.StatusUnauthorized {
+			t.Errorf("got endpoint %+v", e)
+		}
+	}
+}
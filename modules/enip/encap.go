@@ -0,0 +1,233 @@
+package enip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// The encapsulation commands sent by the scanner.
+const (
+	cmdListServices = 0x0004
+	cmdListIdentity = 0x0063
+)
+
+// The item types of the responses.
+const (
+	itemIdentity = 0x000c
+	itemServices = 0x0100
+)
+
+const (
+	// headerLength is the length of the encapsulation header.
+	headerLength = 24
+
+	// maxLength is the maximum length of the data of a response.
+	maxLength = 65511
+
+	// identityLength is the length of an identity item, up to its product
+	// name.
+	identityLength = 33
+
+	// serviceLength is the length of a service item.
+	serviceLength = 20
+)
+
+// The capability flags of a service.
+const (
+	capabilityTCP = 0x0020
+	capabilityUDP = 0x0100
+)
+
+// ErrInvalidResponse is returned if a response is not an encapsulation
+// message answering the command.
+var ErrInvalidResponse = errors.New("invalid EtherNet/IP response")
+
+// deviceTypeNames names the device types (the device profiles of the CIP
+// specification).
+var deviceTypeNames = map[uint16]string{
+	0x00: "Generic Device (deprecated)",
+	0x02: "AC Drive",
+	0x03: "Motor Overload",
+	0x04: "Limit Switch",
+	0x05: "Inductive Proximity Switch",
+	0x06: "Photoelectric Sensor",
+	0x07: "General Purpose Discrete I/O",
+	0x09: "Resolver",
+	0x0c: "Communications Adapter",
+	0x0e: "Programmable Logic Controller",
+	0x10: "Position Controller",
+	0x13: "DC Drive",
+	0x15: "Contactor",
+	0x16: "Motor Starter",
+	0x17: "Soft Start",
+	0x18: "Human-Machine Interface",
+	0x1a: "Mass Flow Controller",
+	0x1b: "Pneumatic Valve",
+	0x1c: "Vacuum Pressure Gauge",
+	0x1d: "Process Control Value",
+	0x1e: "Residual Gas Analyzer",
+	0x1f: "DC Power Generator",
+	0x20: "RF Power Generator",
+	0x21: "Turbomolecular Vacuum Pump",
+	0x22: "Encoder",
+	0x23: "Safety Discrete I/O Device",
+	0x24: "Fluid Flow Controller",
+	0x25: "CIP Motion Drive",
+	0x26: "CompoNet Repeater",
+	0x2b: "Generic Device (keyable)",
+	0x2c: "Managed Ethernet Switch",
+	0xc8: "Embedded Component",
+}
+
+// Identity is the identity item of a ListIdentity response.
+type Identity struct {
+	EncapsulationVersion uint16 `json:"encapsulation_version"`
+
+	// SocketAddress and SocketPort are the address and port of the device,
+	// as configured on the device.
+	SocketAddress string `json:"socket_address,omitempty"`
+	SocketPort    uint16 `json:"socket_port,omitempty"`
+
+	VendorID       uint16 `json:"vendor_id"`
+	DeviceType     uint16 `json:"device_type"`
+	DeviceTypeName string `json:"device_type_name,omitempty"`
+	ProductCode    uint16 `json:"product_code"`
+	Revision       string `json:"revision"`
+	Status         uint16 `json:"status"`
+	SerialNumber   string `json:"serial_number"`
+	ProductName    string `json:"product_name"`
+	State          uint8  `json:"state"`
+}
+
+// Service is a service item of a ListServices response.
+type Service struct {
+	Name         string `json:"name"`
+	Version      uint16 `json:"version"`
+	Capabilities uint16 `json:"capabilities"`
+
+	// TCP and UDP are true if the service supports CIP encapsulation over
+	// TCP, and class 0 and 1 I/O over UDP.
+	TCP bool `json:"tcp"`
+	UDP bool `json:"udp"`
+}
+
+// encodeCommand returns the encapsulation message of a command without data.
+func encodeCommand(command uint16, context []byte) []byte {
+	buf := make([]byte, headerLength)
+	binary.LittleEndian.PutUint16(buf, command)
+	copy(buf[12:20], context)
+	return buf
+}
+
+// readMessage reads an encapsulation message from a stream.
+func readMessage(r io.Reader) ([]byte, error) {
+	buf := make([]byte, headerLength)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	length := int(binary.LittleEndian.Uint16(buf[2:]))
+	if length > maxLength {
+		return nil, ErrInvalidResponse
+	}
+	buf = append(buf, make([]byte, length)...)
+	if _, err := io.ReadFull(r, buf[headerLength:]); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// parseItems checks that msg answers command, and returns its items of type
+// typ. The returned status is the status of the encapsulation header.
+func parseItems(msg []byte, command uint16, typ uint16) (uint32, [][]byte, error) {
+	if len(msg) < headerLength || binary.LittleEndian.Uint16(msg) != command {
+		return 0, nil, ErrInvalidResponse
+	}
+	status := binary.LittleEndian.Uint32(msg[8:])
+	data := msg[headerLength:]
+	if int(binary.LittleEndian.Uint16(msg[2:])) != len(data) {
+		return 0, nil, ErrInvalidResponse
+	}
+	if status != 0 {
+		return status, nil, nil
+	}
+	if len(data) < 2 {
+		return 0, nil, ErrInvalidResponse
+	}
+	count := int(binary.LittleEndian.Uint16(data))
+	data = data[2:]
+	var items [][]byte
+	for i := 0; i < count; i++ {
+		if len(data) < 4 {
+			return 0, nil, ErrInvalidResponse
+		}
+		itemType := binary.LittleEndian.Uint16(data)
+		length := int(binary.LittleEndian.Uint16(data[2:]))
+		if len(data) < 4+length {
+			return 0, nil, ErrInvalidResponse
+		}
+		if itemType == typ {
+			items = append(items, data[4:4+length])
+		}
+		data = data[4+length:]
+	}
+	return 0, items, nil
+}
+
+// parseIdentity parses an identity item.
+func parseIdentity(item []byte) (*Identity, error) {
+	if len(item) < identityLength {
+		return nil, ErrInvalidResponse
+	}
+	id := &Identity{
+		EncapsulationVersion: binary.LittleEndian.Uint16(item),
+		// The socket address is in network byte order.
+		SocketPort:   binary.BigEndian.Uint16(item[4:]),
+		VendorID:     binary.LittleEndian.Uint16(item[18:]),
+		DeviceType:   binary.LittleEndian.Uint16(item[20:]),
+		ProductCode:  binary.LittleEndian.Uint16(item[22:]),
+		Revision:     fmt.Sprintf("%d.%d", item[24], item[25]),
+		Status:       binary.LittleEndian.Uint16(item[26:]),
+		SerialNumber: fmt.Sprintf("0x%08x", binary.LittleEndian.Uint32(item[28:])),
+	}
+	if addr := net.IP(item[6:10]); !addr.IsUnspecified() {
+		id.SocketAddress = addr.String()
+	}
+	id.DeviceTypeName = deviceTypeNames[id.DeviceType]
+	n := int(item[32])
+	if len(item) < identityLength+n {
+		return nil, ErrInvalidResponse
+	}
+	id.ProductName = string(item[identityLength : identityLength+n])
+	if len(item) > identityLength+n {
+		id.State = item[identityLength+n]
+	}
+	return id, nil
+}
+
+// parseService parses a service item.
+func parseService(item []byte) (*Service, error) {
+	if len(item) < serviceLength {
+		return nil, ErrInvalidResponse
+	}
+	s := &Service{
+		Version:      binary.LittleEndian.Uint16(item),
+		Capabilities: binary.LittleEndian.Uint16(item[2:]),
+		Name:         string(trimNull(item[4:serviceLength])),
+	}
+	s.TCP = s.Capabilities&capabilityTCP != 0
+	s.UDP = s.Capabilities&capabilityUDP != 0
+	return s, nil
+}
+
+// trimNull returns buf up to its first null byte.
+func trimNull(buf []byte) []byte {
+	for i, b := range buf {
+		if b == 0 {
+			return buf[:i]
+		}
+	}
+	return buf
+}
@@ -0,0 +1,201 @@
+// Package enip provides a zgrab2 module that sends the EtherNet/IP List
+// Identity and List Services commands, and records the identity of the
+// device.
+// Default Port: 44818 (TCP)
+//
+// The scanner sends the ListIdentity encapsulation command over TCP, or over
+// UDP with --transport=udp, and parses the identity item of the response:
+// the vendor ID, device type, product code, revision, serial number and
+// product name of the device, with its state and the socket address
+// configured on the device. It then sends the ListServices command, and
+// records the services of the device, such as the "Communications" service
+// of CIP.
+package enip
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// senderContext is the sender context of the commands.
+const senderContext = "zgrab2\x00\x00"
+
+// Flags holds the command-line configuration for the enip module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+
+	Transport string `long:"transport" default:"tcp" choice:"tcp" choice:"udp" description:"Transport of the commands: TCP, or UDP."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results is the output of the enip module.
+type Results struct {
+	Transport string `json:"transport"`
+
+	// EncapsulationStatus is the non-zero status of a response, if any.
+	EncapsulationStatus uint32 `json:"encapsulation_status,omitempty"`
+
+	Identity *Identity `json:"identity,omitempty"`
+	Services []Service `json:"services,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("enip", "EtherNet/IP", module.Description(), 44818, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Send the EtherNet/IP List Identity and List Services commands over TCP or UDP, and record the identity of the device"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "enip"
+}
+
+// exchange sends command over conn, and returns the response.
+func (scanner *Scanner) exchange(conn net.Conn, command uint16) ([]byte, error) {
+	if _, err := conn.Write(encodeCommand(command, []byte(senderContext))); err != nil {
+		return nil, err
+	}
+	if scanner.config.Transport == "tcp" {
+		return readMessage(conn)
+	}
+	buf := make([]byte, headerLength+maxLength)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// list sends command, and returns the items of type typ of the response. A
+// response with a non-zero status is reported in results.
+func (scanner *Scanner) list(conn net.Conn, command, typ uint16, results *Results) ([][]byte, zgrab2.ScanStatus, error) {
+	msg, err := scanner.exchange(conn, command)
+	if err != nil {
+		return nil, zgrab2.TryGetScanStatus(err), err
+	}
+	status, items, err := parseItems(msg, command, typ)
+	if err != nil {
+		return nil, zgrab2.SCAN_PROTOCOL_ERROR, err
+	}
+	if status != 0 {
+		results.EncapsulationStatus = status
+		return nil, zgrab2.SCAN_APPLICATION_ERROR, fmt.Errorf("encapsulation status 0x%x", status)
+	}
+	return items, zgrab2.SCAN_SUCCESS, nil
+}
+
+// Scan sends the ListIdentity command, and parses the identity of the device,
+// then sends the ListServices command. An error of ListServices is reported
+// with the identity.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	var conn net.Conn
+	var err error
+	if scanner.config.Transport == "tcp" {
+		conn, err = target.Open(ctx, &scanner.config.BaseFlags)
+	} else {
+		conn, err = target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	}
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	results := &Results{Transport: scanner.config.Transport}
+	items, status, err := scanner.list(conn, cmdListIdentity, itemIdentity, results)
+	if err != nil {
+		if status == zgrab2.SCAN_APPLICATION_ERROR {
+			return status, results, err
+		}
+		return status, nil, err
+	}
+	if len(items) == 0 {
+		return zgrab2.SCAN_PROTOCOL_ERROR, nil, ErrInvalidResponse
+	}
+	if results.Identity, err = parseIdentity(items[0]); err != nil {
+		return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+	}
+	items, status, err = scanner.list(conn, cmdListServices, itemServices, results)
+	if err != nil {
+		return status, results, err
+	}
+	for _, item := range items {
+		service, err := parseService(item)
+		if err != nil {
+			return zgrab2.SCAN_PROTOCOL_ERROR, results, err
+		}
+		results.Services = append(results.Services, *service)
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,150 @@
+package enip
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// response returns the response of a 1756-L61 controller to a command.
+func response(command uint16, request []byte) []byte {
+	var item []byte
+	var typ uint16
+	switch command {
+	case cmdListIdentity:
+		typ = itemIdentity
+		name := "1756-L61/B LOGIX5561"
+		item = make([]byte, identityLength)
+		binary.LittleEndian.PutUint16(item, 1)
+		binary.BigEndian.PutUint16(item[2:], 2)
+		binary.BigEndian.PutUint16(item[4:], 44818)
+		copy(item[6:], []byte{192, 168, 1, 10})
+		binary.LittleEndian.PutUint16(item[18:], 1)
+		binary.LittleEndian.PutUint16(item[20:], 0x0e)
+		binary.LittleEndian.PutUint16(item[22:], 54)
+		item[24], item[25] = 20, 11
+		binary.LittleEndian.PutUint16(item[26:], 0x3060)
+		binary.LittleEndian.PutUint32(item[28:], 0x00c0ffee)
+		item[32] = byte(len(name))
+		item = append(append(item, name...), 3)
+	case cmdListServices:
+		typ = itemServices
+		item = make([]byte, serviceLength)
+		binary.LittleEndian.PutUint16(item, 1)
+		binary.LittleEndian.PutUint16(item[2:], capabilityTCP|capabilityUDP)
+		copy(item[4:], "Communications")
+	}
+	data := make([]byte, 6)
+	binary.LittleEndian.PutUint16(data, 1)
+	binary.LittleEndian.PutUint16(data[2:], typ)
+	binary.LittleEndian.PutUint16(data[4:], uint16(len(item)))
+	data = append(data, item...)
+	msg := make([]byte, headerLength)
+	copy(msg, request[:headerLength])
+	binary.LittleEndian.PutUint16(msg[2:], uint16(len(data)))
+	return append(msg, data...)
+}
+
+// serveTCP runs a fake device over TCP.
+func serveTCP(t *testing.T) *testserver.Server {
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		for {
+			request, err := readMessage(conn)
+			if err != nil {
+				// The scanner closes the connection once done.
+				return nil
+			}
+			if _, err := conn.Write(response(binary.LittleEndian.Uint16(request), request)); err != nil {
+				return err
+			}
+		}
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func scan(t *testing.T, transport string, addr string) (zgrab2.ScanStatus, *Results, error) {
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), &Flags{Transport: transport}, addr)
+	results, _ := ret.(*Results)
+	return status, results, err
+}
+
+func checkResults(t *testing.T, results *Results) {
+	want := &Identity{
+		EncapsulationVersion: 1,
+		SocketAddress:        "192.168.1.10",
+		SocketPort:           44818,
+		VendorID:             1,
+		DeviceType:           0x0e,
+		DeviceTypeName:       "Programmable Logic Controller",
+		ProductCode:          54,
+		Revision:             "20.11",
+		Status:               0x3060,
+		SerialNumber:         "0x00c0ffee",
+		ProductName:          "1756-L61/B LOGIX5561",
+		State:                3,
+	}
+	if !reflect.DeepEqual(results.Identity, want) {
+		t.Errorf("got identity %+v, want %+v", results.Identity, want)
+	}
+	services := []Service{{Name: "Communications", Version: 1, Capabilities: 0x120, TCP: true, UDP: true}}
+	if !reflect.DeepEqual(results.Services, services) {
+		t.Errorf("got services %+v, want %+v", results.Services, services)
+	}
+}
+
+func TestTCP(t *testing.T) {
+	server := serveTCP(t)
+	defer server.Close()
+	status, results, err := scan(t, "tcp", server.Addr())
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	checkResults(t, results)
+}
+
+func TestUDP(t *testing.T) {
+	server, err := testserver.NewUDP(func(request []byte) []byte {
+		if len(request) < headerLength {
+			return nil
+		}
+		return response(binary.LittleEndian.Uint16(request), request)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	status, results, err := scan(t, "udp", server.Addr())
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	checkResults(t, results)
+}
+
+func TestEncapsulationError(t *testing.T) {
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		request, err := readMessage(conn)
+		if err != nil {
+			return err
+		}
+		// Unsupported encapsulation protocol revision.
+		binary.LittleEndian.PutUint32(request[8:], 0x69)
+		_, err = conn.Write(request)
+		return err
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	status, results, err := scan(t, "tcp", server.Addr())
+	if status != zgrab2.SCAN_APPLICATION_ERROR || err == nil || results.EncapsulationStatus != 0x69 {
+		t.Errorf("got status %s, error %v, results %+v", status, err, results)
+	}
+}
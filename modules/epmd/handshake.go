@@ -0,0 +1,137 @@
+package epmd
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// The distribution flags sent: those required by OTP 25, the distributed
+// monitors, and the OTP 23 handshake, which lets newer nodes answer with
+// their 64-bit flags and creation.
+const (
+	flagHandshake23 = 0x01000000
+
+	sendFlags = 0x04 | 0x08 | 0x10 | 0x80 | 0x100 | 0x200 | 0x400 | 0x800 |
+		0x10000 | 0x20000 | 0x40000 | flagHandshake23
+)
+
+// distVersion is the distribution version of the old send_name message.
+const distVersion = 5
+
+// flagNames names the distribution flags.
+var flagNames = []struct {
+	flag uint64
+	name string
+}{
+	{0x01, "published"},
+	{0x02, "atom_cache"},
+	{0x04, "extended_references"},
+	{0x08, "dist_monitor"},
+	{0x10, "fun_tags"},
+	{0x20, "dist_monitor_name"},
+	{0x40, "hidden_atom_cache"},
+	{0x80, "new_fun_tags"},
+	{0x100, "extended_pids_ports"},
+	{0x200, "export_ptr_tag"},
+	{0x400, "bit_binaries"},
+	{0x800, "new_floats"},
+	{0x1000, "unicode_io"},
+	{0x2000, "dist_hdr_atom_cache"},
+	{0x4000, "small_atom_tags"},
+	{0x10000, "utf8_atoms"},
+	{0x20000, "map_tag"},
+	{0x40000, "big_creation"},
+	{0x80000, "send_sender"},
+	{0x100000, "big_seqtrace_labels"},
+	{0x400000, "exit_payload"},
+	{0x800000, "fragments"},
+	{0x1000000, "handshake_23"},
+	{0x2000000, "unlink_id"},
+	{0x4000000, "mandatory_25_digest"},
+	{1 << 32, "spawn"},
+	{1 << 33, "name_me"},
+	{1 << 34, "v4_nc"},
+	{1 << 35, "alias"},
+}
+
+// flagStrings returns the names of the flags set.
+func flagStrings(flags uint64) []string {
+	var ret []string
+	for _, f := range flagNames {
+		if flags&f.flag != 0 {
+			ret = append(ret, f.name)
+		}
+	}
+	return ret
+}
+
+// encodeSendName returns the old send_name message with name.
+func encodeSendName(name string) []byte {
+	buf := make([]byte, 9, 9+len(name))
+	binary.BigEndian.PutUint16(buf, uint16(7+len(name)))
+	buf[2] = 'n'
+	binary.BigEndian.PutUint16(buf[3:], distVersion)
+	binary.BigEndian.PutUint32(buf[5:], sendFlags)
+	return append(buf, name...)
+}
+
+// readMessage reads a message of the handshake: its tag, and the rest.
+func readMessage(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint16(header)
+	if length == 0 {
+		return 0, nil, ErrInvalidResponse
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return 0, nil, err
+	}
+	return msg[0], msg[1:], nil
+}
+
+// handshake sends send_name, and records the status and the challenge of the
+// node in node.
+func handshake(rw io.ReadWriter, name string, node *Node) error {
+	if _, err := rw.Write(encodeSendName(name)); err != nil {
+		return err
+	}
+	tag, msg, err := readMessage(rw)
+	if err != nil {
+		return err
+	}
+	if tag != 's' {
+		return ErrInvalidResponse
+	}
+	node.Status = string(msg)
+	if !strings.HasPrefix(node.Status, "ok") {
+		return nil
+	}
+	tag, msg, err = readMessage(rw)
+	if err != nil {
+		return err
+	}
+	switch {
+	case tag == 'n' && len(msg) >= 10:
+		// The version, flags, challenge and name.
+		node.Version = binary.BigEndian.Uint16(msg)
+		node.Flags = uint64(binary.BigEndian.Uint32(msg[2:]))
+		node.NodeName = string(msg[10:])
+	case tag == 'N' && len(msg) >= 18:
+		// The flags, challenge, creation, name length and name.
+		node.Flags = binary.BigEndian.Uint64(msg)
+		node.Creation = binary.BigEndian.Uint32(msg[12:])
+		length := int(binary.BigEndian.Uint16(msg[16:]))
+		if len(msg) < 18+length {
+			return ErrInvalidResponse
+		}
+		node.NodeName = string(msg[18 : 18+length])
+	default:
+		return ErrInvalidResponse
+	}
+	node.FlagNames = flagStrings(node.Flags)
+	return nil
+}
@@ -0,0 +1,217 @@
+// Package epmd provides a zgrab2 module that lists the Erlang nodes
+// registered with the Erlang Port Mapper Daemon, as `epmd -names` does.
+// Default Port: 4369 (TCP)
+//
+// The scanner sends a NAMES request, which EPMD answers with the name and
+// distribution port of each node of the host, such as the rabbit node of
+// RabbitMQ or the couchdb node of CouchDB. With --handshake, the scanner then
+// starts the distribution handshake with the first node, and records its
+// status and, if the node accepts the connection, its challenge: the full
+// node name, the distribution flags and the creation. The handshake stops
+// before the challenge is answered, which requires the cookie.
+package epmd
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// namesRequest is the NAMES request.
+var namesRequest = []byte{0x00, 0x01, 110}
+
+// maxNamesLength is the maximum length of the NAMES response read.
+const maxNamesLength = 64 * 1024
+
+// nameLine matches a node of the NAMES response.
+var nameLine = regexp.MustCompile(`(?m)^name (\S+) at port (\d+)$`)
+
+// ErrInvalidResponse is returned if a response is not an EPMD or
+// distribution protocol response.
+var ErrInvalidResponse = errors.New("invalid EPMD response")
+
+// Flags holds the command-line configuration for the epmd module.
+type Flags struct {
+	zgrab2.BaseFlags
+
+	Handshake bool   `long:"handshake" description:"Start the distribution handshake with the first node"`
+	NodeName  string `long:"node-name" default:"zgrab@zgrab" description:"Node name sent in the distribution handshake"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Node is a node registered with EPMD.
+type Node struct {
+	Name string `json:"name"`
+	Port uint16 `json:"port"`
+
+	// Status is the status sent by the node in the distribution handshake:
+	// ok, ok_simultaneous, nok, not_allowed or alive.
+	Status string `json:"status,omitempty"`
+
+	// NodeName is the full name of the node, such as rabbit@host, Version the
+	// distribution version of old nodes, Flags the distribution flags, and
+	// Creation the creation of newer nodes, all from the challenge of the
+	// node.
+	NodeName  string   `json:"node_name,omitempty"`
+	Version   uint16   `json:"version,omitempty"`
+	Flags     uint64   `json:"flags,omitempty"`
+	FlagNames []string `json:"flag_names,omitempty"`
+	Creation  uint32   `json:"creation,omitempty"`
+
+	// Error is the error of the handshake.
+	Error string `json:"error,omitempty"`
+}
+
+// Results is the output of the epmd module.
+type Results struct {
+	// EPMDPort is the port of EPMD, from the NAMES response.
+	EPMDPort uint32 `json:"epmd_port"`
+
+	Nodes []*Node `json:"nodes,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("epmd", "EPMD", module.Description(), 4369, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "List the Erlang nodes registered with EPMD, and optionally start the distribution handshake with one"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "epmd"
+}
+
+// names sends the NAMES request, and reads the response: the port of EPMD,
+// then a line per node, until EPMD closes the connection.
+func names(rw io.ReadWriter) (*Results, error) {
+	if _, err := rw.Write(namesRequest); err != nil {
+		return nil, err
+	}
+	resp, err := ioutil.ReadAll(io.LimitReader(rw, maxNamesLength))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 4 {
+		return nil, ErrInvalidResponse
+	}
+	results := &Results{EPMDPort: binary.BigEndian.Uint32(resp)}
+	for _, m := range nameLine.FindAllStringSubmatch(string(resp[4:]), -1) {
+		port, err := strconv.ParseUint(m[2], 10, 16)
+		if err != nil {
+			continue
+		}
+		results.Nodes = append(results.Nodes, &Node{Name: m[1], Port: uint16(port)})
+	}
+	return results, nil
+}
+
+// handshake starts the distribution handshake with node.
+func (scanner *Scanner) handshake(ctx context.Context, target zgrab2.ScanTarget, node *Node) error {
+	port := uint(node.Port)
+	target.Port = &port
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return handshake(conn, scanner.config.NodeName, node)
+}
+
+// Scan lists the nodes, then starts the handshake with the first node with
+// --handshake. The scan fails if the NAMES response is invalid.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	results, err := names(conn)
+	conn.Close()
+	if err == ErrInvalidResponse {
+		return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+	}
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	if scanner.config.Handshake && len(results.Nodes) > 0 {
+		node := results.Nodes[0]
+		if err := scanner.handshake(ctx, target, node); err != nil {
+			node.Error = err.Error()
+		}
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,119 @@
+package epmd
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// listen runs handle on each connection of a new test server.
+func listen(t *testing.T, handle func(net.Conn)) *testserver.Server {
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		handle(conn)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// writeMessage writes a message of the handshake.
+func writeMessage(w io.Writer, tag byte, msg []byte) {
+	header := make([]byte, 3)
+	binary.BigEndian.PutUint16(header, uint16(1+len(msg)))
+	header[2] = tag
+	w.Write(append(header, msg...))
+}
+
+func scan(t *testing.T, epmd *testserver.Server, handshake bool) (zgrab2.ScanStatus, *Results, error) {
+	flags := &Flags{Handshake: handshake, NodeName: "zgrab@zgrab"}
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), flags, epmd.Addr())
+	results, _ := ret.(*Results)
+	return status, results, err
+}
+
+func TestHandshake(t *testing.T) {
+	names := make(chan string, 1)
+	node := listen(t, func(conn net.Conn) {
+		tag, msg, err := readMessage(conn)
+		if err != nil || tag != 'n' || len(msg) < 6 {
+			return
+		}
+		names <- string(msg[6:])
+		writeMessage(conn, 's', []byte("ok"))
+		challenge := make([]byte, 18)
+		binary.BigEndian.PutUint64(challenge, 1<<34|0x1000000|0x10000|0x04)
+		binary.BigEndian.PutUint32(challenge[12:], 1700000000)
+		binary.BigEndian.PutUint16(challenge[16:], uint16(len("rabbit@mq1")))
+		writeMessage(conn, 'N', append(challenge, "rabbit@mq1"...))
+	})
+	defer node.Close()
+	nodePort := int(node.Port())
+	epmd := listen(t, func(conn net.Conn) {
+		request := make([]byte, 3)
+		if _, err := io.ReadFull(conn, request); err != nil || request[2] != 110 {
+			return
+		}
+		conn.Write([]byte{0, 0, 0x11, 0x11})
+		conn.Write([]byte("name rabbit at port " + strconv.Itoa(nodePort) + "\nname ejabberd at port 4200\n"))
+	})
+	defer epmd.Close()
+	status, results, err := scan(t, epmd, true)
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if name := <-names; name != "zgrab@zgrab" {
+		t.Errorf("got name %q", name)
+	}
+	if results.EPMDPort != 4369 || len(results.Nodes) != 2 || !reflect.DeepEqual(results.Nodes[1], &Node{Name: "ejabberd", Port: 4200}) {
+		t.Errorf("got %+v", results)
+	}
+	expected := &Node{
+		Name:      "rabbit",
+		Port:      uint16(nodePort),
+		Status:    "ok",
+		NodeName:  "rabbit@mq1",
+		Flags:     1<<34 | 0x1000000 | 0x10000 | 0x04,
+		FlagNames: []string{"extended_references", "utf8_atoms", "handshake_23", "v4_nc"},
+		Creation:  1700000000,
+	}
+	if !reflect.DeepEqual(results.Nodes[0], expected) {
+		t.Errorf("got node %+v", results.Nodes[0])
+	}
+}
+
+func TestNotAllowed(t *testing.T) {
+	node := listen(t, func(conn net.Conn) {
+		readMessage(conn)
+		writeMessage(conn, 's', []byte("not_allowed"))
+	})
+	defer node.Close()
+	epmd := listen(t, func(conn net.Conn) {
+		io.ReadFull(conn, make([]byte, 3))
+		conn.Write(append([]byte{0, 0, 0x11, 0x11}, "name couchdb at port "+strconv.Itoa(int(node.Port()))+"\n"...))
+	})
+	defer epmd.Close()
+	status, results, err := scan(t, epmd, true)
+	if status != zgrab2.SCAN_SUCCESS || err != nil || len(results.Nodes) != 1 || results.Nodes[0].Status != "not_allowed" || results.Nodes[0].NodeName != "" {
+		t.Errorf("got status %s, %+v, error %v", status, results, err)
+	}
+}
+
+func TestInvalidResponse(t *testing.T) {
+	epmd := listen(t, func(conn net.Conn) {
+		conn.Write([]byte{0})
+	})
+	defer epmd.Close()
+	status, _, err := scan(t, epmd, false)
+	if status != zgrab2.SCAN_PROTOCOL_ERROR || err != ErrInvalidResponse {
+		t.Errorf("got status %s, error %v", status, err)
+	}
+}
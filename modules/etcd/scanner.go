@@ -0,0 +1,373 @@
+// Package etcd provides a zgrab2 module that reads the version, cluster
+// members and authentication status of etcd servers.
+// Default Port: 2379 (TCP)
+//
+// The scanner requests /version, then calls the Status and MemberList
+// methods of the v3 API through its gRPC gateway, which serves them as JSON
+// over HTTP on the client port, over HTTPS if --use-https is set. The prefix
+// of the gateway depends on the version: /v3 since 3.4, /v3beta in 3.3 and
+// /v3alpha before.
+//
+// Whether authentication is enabled is read from the AuthStatus method,
+// available since 3.5. Otherwise, or if authentication is disabled, the
+// scanner counts the keys with a Range request, which does not read their
+// values: a server answering it without credentials exposes all its data.
+package etcd
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/jsonapi"
+)
+
+// Flags holds the command-line configuration for the etcd module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	UseHTTPS  bool   `long:"use-https" description:"Perform an HTTPS connection on the initial host"`
+	UserAgent string `long:"user-agent" default:"Mozilla/5.0 zgrab/0.x" description:"Set a custom user agent"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Member is a member of the cluster. Its ID is in hexadecimal, as printed by
+// etcdctl.
+type Member struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name,omitempty"`
+	PeerURLs   []string `json:"peer_urls,omitempty"`
+	ClientURLs []string `json:"client_urls,omitempty"`
+	IsLearner  bool     `json:"is_learner,omitempty"`
+}
+
+// Endpoint is the outcome of the request of an endpoint.
+type Endpoint struct {
+	Path       string `json:"path"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Results is the output of the etcd module.
+type Results struct {
+	// ServerVersion and ClusterVersion are read from /version.
+	ServerVersion  string `json:"server_version,omitempty"`
+	ClusterVersion string `json:"cluster_version,omitempty"`
+
+	// The fields of the Status method. The IDs are in hexadecimal.
+	ClusterID string `json:"cluster_id,omitempty"`
+	MemberID  string `json:"member_id,omitempty"`
+	Leader    string `json:"leader,omitempty"`
+	DBSize    int64  `json:"db_size,omitempty"`
+	RaftTerm  uint64 `json:"raft_term,omitempty"`
+	IsLearner bool   `json:"is_learner,omitempty"`
+
+	// Members lists the members of the cluster.
+	Members []Member `json:"members,omitempty"`
+
+	// AuthEnabled is true if authentication is enabled, and is not set if
+	// it is unknown.
+	AuthEnabled *bool `json:"auth_enabled,omitempty"`
+
+	// Unauthenticated is true if the keys were counted without credentials,
+	// and KeyCount is their number.
+	Unauthenticated bool  `json:"unauthenticated"`
+	KeyCount        int64 `json:"key_count,omitempty"`
+
+	// Endpoints lists the outcome of each request.
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+
+	// TLSLog is the log of the TLS handshake, with --use-https.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("etcd", "etcd", module.Description(), 2379, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Read the version, cluster members and authentication status of an etcd server"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "etcd"
+}
+
+// header is the header of the responses of the v3 API. The gateway encodes
+// 64-bit integers as strings.
+type header struct {
+	ClusterID string `json:"cluster_id"`
+	MemberID  string `json:"member_id"`
+	RaftTerm  string `json:"raft_term"`
+}
+
+// statusResponse is the response of the Status method.
+type statusResponse struct {
+	Header    header `json:"header"`
+	Version   string `json:"version"`
+	DBSize    string `json:"dbSize"`
+	Leader    string `json:"leader"`
+	RaftTerm  string `json:"raftTerm"`
+	IsLearner bool   `json:"isLearner"`
+}
+
+// memberListResponse is the response of the MemberList method.
+type memberListResponse struct {
+	Members []struct {
+		ID         string   `json:"ID"`
+		Name       string   `json:"name"`
+		PeerURLs   []string `json:"peerURLs"`
+		ClientURLs []string `json:"clientURLs"`
+		IsLearner  bool     `json:"isLearner"`
+	} `json:"members"`
+}
+
+// authStatusResponse is the response of the AuthStatus method.
+type authStatusResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+// rangeRequest counts all the keys: the range from "\x00" to "\x00" is the
+// whole key space, and the keys are base64 encoded.
+var rangeRequest = map[string]interface{}{
+	"key":        "AA==",
+	"range_end":  "AA==",
+	"count_only": true,
+}
+
+// rangeResponse is the response of the Range method.
+type rangeResponse struct {
+	Count string `json:"count"`
+}
+
+// authErrors are the errors of a call requiring credentials.
+var authErrors = []string{
+	"user name is empty",
+	"permission denied",
+	"invalid auth token",
+}
+
+// hexID formats a decimal ID in hexadecimal.
+func hexID(id string) string {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return id
+	}
+	return strconv.FormatUint(n, 16)
+}
+
+// prefix returns the prefix of the gateway of the given server version.
+func prefix(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return "/v3"
+	}
+	major, err1 := strconv.Atoi(parts[0])
+	minor, err2 := strconv.Atoi(parts[1])
+	switch {
+	case err1 != nil || err2 != nil || major > 3 || major == 3 && minor >= 4:
+		return "/v3"
+	case major == 3 && minor == 3:
+		return "/v3beta"
+	}
+	return "/v3alpha"
+}
+
+// probe holds the state of a scan.
+type probe struct {
+	ctx     context.Context
+	client  *jsonapi.Client
+	results *Results
+}
+
+// call records the outcome of a request.
+func (p *probe) call(path string, resp *jsonapi.Response, err error) {
+	endpoint := Endpoint{Path: path}
+	if resp != nil {
+		endpoint.StatusCode = resp.StatusCode
+	}
+	if err != nil {
+		endpoint.Error = err.Error()
+	}
+	p.results.Endpoints = append(p.results.Endpoints, endpoint)
+}
+
+// post calls a method of the v3 API.
+func (p *probe) post(path string, in interface{}, out interface{}) (*jsonapi.Response, error) {
+	if in == nil {
+		in = struct{}{}
+	}
+	resp, err := p.client.PostJSON(p.ctx, path, in, out)
+	p.call(path, resp, err)
+	return resp, err
+}
+
+// authFailure returns true if resp is the failure of a call for lack of
+// credentials.
+func authFailure(resp *jsonapi.Response) bool {
+	if resp == nil || resp.OK() {
+		return false
+	}
+	if resp.AuthRequired() {
+		return true
+	}
+	body := string(resp.Body)
+	for _, e := range authErrors {
+		if strings.Contains(body, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// v3 calls the methods of the v3 API.
+func (p *probe) v3(prefix string) {
+	var status statusResponse
+	if resp, err := p.post(prefix+"/maintenance/status", nil, &status); err == nil && resp.OK() {
+		p.results.ClusterID = hexID(status.Header.ClusterID)
+		p.results.MemberID = hexID(status.Header.MemberID)
+		p.results.Leader = hexID(status.Leader)
+		p.results.DBSize, _ = strconv.ParseInt(status.DBSize, 10, 64)
+		p.results.RaftTerm, _ = strconv.ParseUint(status.RaftTerm, 10, 64)
+		p.results.IsLearner = status.IsLearner
+		if p.results.ServerVersion == "" {
+			p.results.ServerVersion = status.Version
+		}
+	}
+	var members memberListResponse
+	if resp, err := p.post(prefix+"/cluster/member/list", nil, &members); err == nil && resp.OK() {
+		for _, m := range members.Members {
+			p.results.Members = append(p.results.Members, Member{
+				ID:         hexID(m.ID),
+				Name:       m.Name,
+				PeerURLs:   m.PeerURLs,
+				ClientURLs: m.ClientURLs,
+				IsLearner:  m.IsLearner,
+			})
+		}
+	}
+	var auth authStatusResponse
+	if resp, err := p.post(prefix+"/auth/status", nil, &auth); err == nil && resp.OK() {
+		p.results.AuthEnabled = &auth.Enabled
+		if auth.Enabled {
+			return
+		}
+	}
+	var count rangeResponse
+	resp, err := p.post(prefix+"/kv/range", rangeRequest, &count)
+	switch {
+	case err == nil && resp.OK():
+		p.results.Unauthenticated = true
+		p.results.KeyCount, _ = strconv.ParseInt(count.Count, 10, 64)
+		if p.results.AuthEnabled == nil {
+			enabled := false
+			p.results.AuthEnabled = &enabled
+		}
+	case authFailure(resp):
+		enabled := true
+		p.results.AuthEnabled = &enabled
+	}
+}
+
+// Scan requests /version, then calls the methods of the v3 API. The scan
+// fails if /version gets no HTTP response.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	p := &probe{
+		ctx: ctx,
+		client: &jsonapi.Client{
+			Target:    &target,
+			BaseFlags: &scanner.config.BaseFlags,
+			TLSFlags:  &scanner.config.TLSFlags,
+			UseTLS:    scanner.config.UseHTTPS,
+			UserAgent: scanner.config.UserAgent,
+		},
+		results: new(Results),
+	}
+	var version struct {
+		Server  string `json:"etcdserver"`
+		Cluster string `json:"etcdcluster"`
+	}
+	resp, err := p.client.GetJSON(ctx, "/version", &version)
+	p.call("/version", resp, err)
+	p.results.TLSLog = p.client.TLSLog
+	if resp == nil {
+		if p.results.TLSLog != nil {
+			return zgrab2.TryGetScanStatus(err), p.results, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	p.results.ServerVersion = version.Server
+	p.results.ClusterVersion = version.Cluster
+	p.v3(prefix(version.Server))
+	return zgrab2.SCAN_SUCCESS, p.results, nil
+}
@@ -0,0 +1,80 @@
+package etcd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+)
+
+const statusResponseBody = `{"header":{"cluster_id":"14841639068965178418","member_id":"10276657743932975437","revision":"5","raft_term":"2"},"version":"3.5.9","dbSize":"20480","leader":"10276657743932975437","raftIndex":"8","raftTerm":"2","raftAppliedIndex":"8","dbSizeInUse":"16384"}`
+
+const memberListResponseBody = `{"header":{"cluster_id":"14841639068965178418","member_id":"10276657743932975437","raft_term":"2"},"members":[{"ID":"10276657743932975437","name":"etcd-1","peerURLs":["http://10.0.0.1:2380"],"clientURLs":["http://10.0.0.1:2379"]}]}`
+
+func scan(t *testing.T, handler http.HandlerFunc) *Results {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	return zgrab2test.MustScan(t, new(Scanner), new(Flags), server.Listener.Addr().String()).(*Results)
+}
+
+func TestUnauthenticated(t *testing.T) {
+	results := scan(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			w.Write([]byte(`{"etcdserver":"3.5.9","etcdcluster":"3.5.0"}`))
+		case "/v3/maintenance/status":
+			w.Write([]byte(statusResponseBody))
+		case "/v3/cluster/member/list":
+			w.Write([]byte(memberListResponseBody))
+		case "/v3/auth/status":
+			w.Write([]byte(`{"header":{},"authRevision":"1"}`))
+		case "/v3/kv/range":
+			w.Write([]byte(`{"header":{},"count":"42"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	if results.ServerVersion != "3.5.9" || results.ClusterVersion != "3.5.0" || results.ClusterID != "cdf818194e3a8c32" || results.Leader != "8e9e05c52164694d" || results.DBSize != 20480 || results.RaftTerm != 2 {
+		t.Errorf("got %+v", results)
+	}
+	expected := []Member{{ID: "8e9e05c52164694d", Name: "etcd-1", PeerURLs: []string{"http://10.0.0.1:2380"}, ClientURLs: []string{"http://10.0.0.1:2379"}}}
+	if !reflect.DeepEqual(results.Members, expected) {
+		t.Errorf("got members %+v", results.Members)
+	}
+	if results.AuthEnabled == nil || *results.AuthEnabled || !results.Unauthenticated || results.KeyCount != 42 {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestAuthEnabledBefore35(t *testing.T) {
+	var paths []string
+	results := scan(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/version":
+			w.Write([]byte(`{"etcdserver":"3.3.25","etcdcluster":"3.3.0"}`))
+		case "/v3beta/kv/range":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"etcdserver: user name is empty","code":3}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	if results.AuthEnabled == nil || !*results.AuthEnabled || results.Unauthenticated {
+		t.Errorf("got %+v", results)
+	}
+	expected := []string{"/version", "/v3beta/maintenance/status", "/v3beta/cluster/member/list", "/v3beta/auth/status", "/v3beta/kv/range"}
+	if !reflect.DeepEqual(paths, expected) || len(results.Endpoints) != len(expected) {
+		t.Errorf("got paths %v, endpoints %+v", paths, results.Endpoints)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	for version, expected := range map[string]string{"3.5.9": "/v3", "3.4.0": "/v3", "3.3.25": "/v3beta", "3.2.32": "/v3alpha", "": "/v3"} {
+		if p := prefix(version); p != expected {
+			t.Errorf("got %s for %q, expected %s", p, version, expected)
+		}
+	}
+}
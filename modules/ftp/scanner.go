@@ -4,16 +4,23 @@
 // connection to TLS. Settings for the TLS handshake / probe can be set with
 // the standard TLSFlags.
 //
-// The scan performs a banner grab and (optionally) a TLS handshake.
+// The scan performs a banner grab and (optionally) a TLS handshake. With the
+// --login flag, it then logs in and sends the FEAT, SYST and PWD commands, and
+// with --list, it retrieves the first page of the directory listing over a
+// passive data connection.
 //
 // The output is the banner, any responses to the AUTH TLS/AUTH SSL commands,
-// and any TLS logs.
+// any TLS logs, and the responses and listing of --login and --list.
 package ftp
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"regexp"
+	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -41,6 +48,60 @@ type ScanResults struct {
 	// TLSLog is the standard shared TLS handshake log.
 	// Only present if the FTPAuthTLS flag is set.
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+
+	// Login is the outcome of the login of --login.
+	Login *LoginResult `json:"login,omitempty"`
+
+	// FeatResp is the response to the FEAT command, and Features the
+	// features it lists.
+	FeatResp string   `json:"feat,omitempty"`
+	Features []string `json:"features,omitempty"`
+
+	// SystResp is the response to the SYST command.
+	SystResp string `json:"syst,omitempty"`
+
+	// PWDResp is the response to the PWD command, sent once logged in.
+	PWDResp string `json:"pwd,omitempty"`
+
+	// List is the directory listing of --list.
+	List *ListResult `json:"list,omitempty"`
+}
+
+// LoginResult is the outcome of the login of the --login flag.
+type LoginResult struct {
+	Username string `json:"username"`
+
+	// UserResp is the response to the USER command.
+	UserResp string `json:"user,omitempty"`
+
+	// PassResp is the response to the PASS command, which is not sent if
+	// the server rejects the username, or logs in without a password.
+	PassResp string `json:"pass,omitempty"`
+
+	// Success is true if the server accepted the credentials.
+	Success bool `json:"success"`
+}
+
+// ListResult is the first page of the listing of the current directory,
+// retrieved with the --list flag.
+type ListResult struct {
+	// PassiveResp is the response to the EPSV command, or to the PASV
+	// command if the server does not support EPSV.
+	PassiveResp string `json:"passive,omitempty"`
+
+	// ListResp is the response to the LIST command, and CompleteResp the
+	// one sent after the listing was transferred.
+	ListResp     string `json:"list,omitempty"`
+	CompleteResp string `json:"complete,omitempty"`
+
+	// Listing is the listing, up to --list-max-size bytes.
+	Listing string `json:"listing,omitempty"`
+
+	// Truncated is true if the listing is longer than --list-max-size.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Error is the error of the data connection, if any.
+	Error string `json:"error,omitempty"`
 }
 
 // Flags are the FTP-specific command-line flags. Taken from the original zgrab.
@@ -49,9 +110,16 @@ type Flags struct {
 	zgrab2.BaseFlags
 	zgrab2.TLSFlags
 
-	Verbose     bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
-	FTPAuthTLS  bool `long:"authtls" description:"Collect FTPS certificates in addition to FTP banners"`
-	ImplicitTLS bool `long:"implicit-tls" description:"Attempt to connect via a TLS wrapped connection"`
+	Verbose     bool   `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	FTPAuthTLS  bool   `long:"authtls" description:"Collect FTPS certificates in addition to FTP banners"`
+	ImplicitTLS bool   `long:"implicit-tls" description:"Attempt to connect via a TLS wrapped connection"`
+	Login       bool   `long:"login" description:"Log in (anonymously, unless --username is given), then send the FEAT, SYST and PWD commands"`
+	Username    string `long:"username" default:"anonymous" description:"Username of --login"`
+	Password    string `long:"password" default:"anonymous@" description:"Password of --login"`
+	List        bool   `long:"list" description:"Once logged in, retrieve the listing of the current directory over a passive data connection"`
+	ListMaxSize int    `long:"list-max-size" default:"8192" description:"Maximum number of bytes of the listing of --list to read"`
+
+	PassiveAnyAddress bool `long:"passive-any-address" description:"Open the data connection of --list to the address given in the response to PASV even if it is not that of the server"`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -72,6 +140,14 @@ type Connection struct {
 	config  *Flags
 	results ScanResults
 	conn    net.Conn
+
+	// secure is true if the control connection is wrapped in TLS, in which
+	// case the data connection is too.
+	secure bool
+
+	// dial opens a data connection to the given port of the server, or of
+	// the address given in the response to PASV, if any.
+	dial func(host string, port int) (net.Conn, error)
 }
 
 // RegisterModule registers the ftp zgrab2 module.
@@ -94,6 +170,11 @@ func (m *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (m *Module) NewResults() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (m *Module) Description() string {
 	return "Grab an FTP banner"
@@ -104,6 +185,14 @@ func (f *Flags) Validate(args []string) (err error) {
 	if f.FTPAuthTLS && f.ImplicitTLS {
 		err = fmt.Errorf("Cannot specify both '--authtls' and '--implicit-tls' together")
 	}
+	if f.List && !f.Login {
+		err = fmt.Errorf("'--list' requires '--login'")
+	}
+	if f.FTPAuthTLS {
+		if redialErr := f.TLSFlags.CheckRedial("--authtls"); redialErr != nil {
+			err = redialErr
+		}
+	}
 	return
 }
 
@@ -235,20 +324,228 @@ func (ftp *Connection) GetFTPSCertificates() error {
 		return err
 	}
 	ftp.conn = conn
+	ftp.secure = true
+	return nil
+}
+
+// Login sends the USER and PASS commands with the configured credentials.
+// Returns true if and only if the server accepted them.
+func (ftp *Connection) Login() (bool, error) {
+	login := &LoginResult{Username: ftp.config.Username}
+	ftp.results.Login = login
+	ret, retCode, err := ftp.sendCommand("USER " + ftp.config.Username)
+	if err != nil {
+		return false, err
+	}
+	login.UserResp = ret
+	// 230 logs in without a password; 331 (or 332 for an account) asks for
+	// one.
+	if !strings.HasPrefix(retCode, "3") {
+		login.Success = ftp.isOKResponse(retCode)
+		return login.Success, nil
+	}
+	ret, retCode, err = ftp.sendCommand("PASS " + ftp.config.Password)
+	if err != nil {
+		return false, err
+	}
+	login.PassResp = ret
+	login.Success = ftp.isOKResponse(retCode)
+	return login.Success, nil
+}
+
+// parseFeatures returns the features listed in a FEAT response, one per line
+// between the first and the last.
+func parseFeatures(resp string) []string {
+	lines := strings.Split(strings.TrimRight(resp, "\r\n"), "\n")
+	if len(lines) < 3 {
+		return nil
+	}
+	var features []string
+	for _, line := range lines[1 : len(lines)-1] {
+		if feature := strings.TrimSpace(line); feature != "" {
+			features = append(features, feature)
+		}
+	}
+	return features
+}
+
+// GetSystemInfo sends the FEAT and SYST commands, and the PWD command if
+// loggedIn.
+func (ftp *Connection) GetSystemInfo(loggedIn bool) error {
+	ret, retCode, err := ftp.sendCommand("FEAT")
+	if err != nil {
+		return err
+	}
+	ftp.results.FeatResp = ret
+	if ftp.isOKResponse(retCode) {
+		ftp.results.Features = parseFeatures(ret)
+	}
+	if ftp.results.SystResp, _, err = ftp.sendCommand("SYST"); err != nil {
+		return err
+	}
+	if loggedIn {
+		if ftp.results.PWDResp, _, err = ftp.sendCommand("PWD"); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// epsvRegex and pasvRegex match the data port of the responses to EPSV,
+// e.g. "229 Entering Extended Passive Mode (|||6446|)", and to PASV, e.g.
+// "227 Entering Passive Mode (192,168,1,2,25,46)".
+var (
+	epsvRegex = regexp.MustCompile(`\(\|\|\|([0-9]+)\|\)`)
+	pasvRegex = regexp.MustCompile(`([0-9]+),([0-9]+),([0-9]+),([0-9]+),([0-9]+),([0-9]+)`)
+)
+
+// enterPassiveMode sends the EPSV command, or the PASV command if the server
+// does not support EPSV, and returns the data port, along with the address
+// given in the response to PASV (which is empty for EPSV, whose data
+// connection is made to the address of the control connection).
+func (ftp *Connection) enterPassiveMode() (string, int, error) {
+	list := ftp.results.List
+	ret, retCode, err := ftp.sendCommand("EPSV")
+	if err != nil {
+		return "", 0, err
+	}
+	list.PassiveResp = ret
+	if m := epsvRegex.FindStringSubmatch(ret); retCode == "229" && m != nil {
+		port, err := strconv.Atoi(m[1])
+		return "", port, err
+	}
+	if ret, retCode, err = ftp.sendCommand("PASV"); err != nil {
+		return "", 0, err
+	}
+	list.PassiveResp = ret
+	if m := pasvRegex.FindStringSubmatch(ret); retCode == "227" && m != nil {
+		hi, _ := strconv.Atoi(m[5])
+		lo, _ := strconv.Atoi(m[6])
+		return strings.Join(m[1:5], "."), hi<<8 | lo, nil
+	}
+	return "", 0, nil
+}
+
+// GetListing retrieves the first --list-max-size bytes of the listing of the
+// current directory. Errors of the data connection are recorded in the
+// results rather than returned.
+func (ftp *Connection) GetListing() error {
+	list := new(ListResult)
+	ftp.results.List = list
+	if ftp.secure {
+		// Protect the data connection with TLS, as the control connection.
+		if _, _, err := ftp.sendCommand("PBSZ 0"); err != nil {
+			return err
+		}
+		if _, _, err := ftp.sendCommand("PROT P"); err != nil {
+			return err
+		}
+	}
+	host, port, err := ftp.enterPassiveMode()
+	if err != nil {
+		return err
+	}
+	if port <= 0 || port > 65535 {
+		list.Error = "no passive data port"
+		return nil
+	}
+	data, err := ftp.dial(host, port)
+	if err != nil {
+		list.Error = err.Error()
+		return nil
+	}
+	defer data.Close()
+	ret, retCode, err := ftp.sendCommand("LIST")
+	if err != nil {
+		return err
+	}
+	list.ListResp = ret
+	// The listing follows a 1XX response (e.g. 150 Here comes the directory
+	// listing), which may have been read together with the reply completing
+	// the transfer.
+	if !strings.HasPrefix(ret, "1") {
+		return nil
+	}
+	if !strings.HasPrefix(retCode, "1") {
+		i := strings.Index(ret, "\n") + 1
+		list.ListResp, list.CompleteResp = ret[:i], ret[i:]
+	}
+	if ftp.secure {
+		tlsConn, err := ftp.config.TLSFlags.GetTLSConnection(data)
+		if err != nil {
+			list.Error = err.Error()
+			return nil
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			list.Error = err.Error()
+			return nil
+		}
+		data = tlsConn
+	}
+	listing, err := ioutil.ReadAll(io.LimitReader(data, int64(ftp.config.ListMaxSize)+1))
+	if len(listing) > ftp.config.ListMaxSize {
+		listing = listing[:ftp.config.ListMaxSize]
+		list.Truncated = true
+	} else if err != nil {
+		list.Error = err.Error()
+	}
+	list.Listing = string(listing)
+	// Closing the data connection early aborts the transfer of a truncated
+	// listing, which the server acknowledges like a complete one.
+	data.Close()
+	if list.CompleteResp == "" {
+		if list.CompleteResp, _, err = ftp.readResponse(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dialData opens a data connection to the given port of the server of t,
+// whose control connection is to peer. The address host given in the
+// response to PASV, if any, is refused if it is not peer (or unspecified),
+// unless --passive-any-address is set, so that a server cannot point the
+// scanner to another host. The connection is dialed like that of any other
+// module, subject to the blocklist.
+func (s *Scanner) dialData(ctx context.Context, t zgrab2.ScanTarget, peer net.IP, host string, port int) (net.Conn, error) {
+	address := t.Host()
+	if host != "" {
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid passive address %q", host)
+		}
+		if !ip.IsUnspecified() && !ip.Equal(peer) {
+			if !s.config.PassiveAnyAddress {
+				return nil, fmt.Errorf("passive address %s is not that of the server", ip)
+			}
+			address = ip.String()
+		}
+	}
+	dialer := zgrab2.GetTimeoutConnectionDialer(s.config.Timeout)
+	dialer.Proxy = t.ProxyURL()
+	// The data connection does not take a connection of the target (see
+	// ScanTarget.AcquireConn), which the control connection holds until the
+	// transfer is complete.
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	return t.TraceConn(conn), nil
+}
+
 // Scan performs the configured scan on the FTP server, as follows:
-// * Read the banner into results.Banner (if it is not a 2XX response, bail)
-// * If the FTPAuthTLS flag is not set, finish.
-// * Send the AUTH TLS command to the server. If the response is not 2XX, then
-//   send the AUTH SSL command. If the response is not 2XX, then finish.
-// * Perform ths TLS handshake / any configured TLS scans, populating
-//   results.TLSLog.
-// * Return SCAN_SUCCESS, &results, nil
-func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result interface{}, thrown error) {
+//   - Read the banner into results.Banner (if it is not a 2XX response, bail)
+//   - If the FTPAuthTLS flag is not set, finish.
+//   - Send the AUTH TLS command to the server. If the response is not 2XX, then
+//     send the AUTH SSL command. If the response is not 2XX, then finish.
+//   - Perform ths TLS handshake / any configured TLS scans, populating
+//     results.TLSLog.
+//   - If the Login flag is set, log in, then send the FEAT, SYST and PWD
+//     commands, and if the List flag is set, retrieve the directory listing.
+//   - Return SCAN_SUCCESS, &results, nil
+func (s *Scanner) Scan(ctx context.Context, t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result interface{}, thrown error) {
 	var err error
-	conn, err := t.Open(&s.config.BaseFlags)
+	conn, err := t.Open(ctx, &s.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
@@ -258,18 +555,28 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 	}()
 
 	results := ScanResults{}
+	secure := false
 	if s.config.ImplicitTLS {
-		tlsConn, err := s.config.TLSFlags.GetTLSConnection(conn)
+		tlsConn, err := s.config.TLSFlags.GetTLSConnectionForTarget(conn, nil, func() (net.Conn, error) {
+			return t.Open(ctx, &s.config.BaseFlags)
+		})
 		if err != nil {
 			return zgrab2.TryGetScanStatus(err), nil, err
 		}
 		results.ImplicitTLS = true
 		results.TLSLog = tlsConn.GetLog()
-		tlsConn.Handshake()
+		secure = tlsConn.Handshake() == nil
 		cn = tlsConn
 	}
 
-	ftp := Connection{conn: cn, config: s.config, results: results}
+	ftp := Connection{conn: cn, config: s.config, results: results, secure: secure}
+	peer := t.IP
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok && peer == nil {
+		peer = addr.IP
+	}
+	ftp.dial = func(host string, port int) (net.Conn, error) {
+		return s.dialData(ctx, t, peer, host, port)
+	}
 	is200Banner, err := ftp.GetFTPBanner()
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), &ftp.results, err
@@ -279,5 +586,17 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 			return zgrab2.SCAN_APPLICATION_ERROR, &ftp.results, err
 		}
 	}
+	if s.config.Login && is200Banner {
+		loggedIn, err := ftp.Login()
+		if err == nil {
+			err = ftp.GetSystemInfo(loggedIn)
+		}
+		if err == nil && loggedIn && s.config.List {
+			err = ftp.GetListing()
+		}
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), &ftp.results, err
+		}
+	}
 	return zgrab2.SCAN_SUCCESS, &ftp.results, nil
 }
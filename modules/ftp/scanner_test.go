@@ -0,0 +1,151 @@
+package ftp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// serve runs a fake FTP server accepting the given password for the
+// anonymous user, and serving listing over a passive data connection. If
+// epsv is false, it answers EPSV with an error, so that PASV is used, giving
+// the address pasvAddr (e.g. "10,0,0,1"), or else that of the data listener.
+func serve(t *testing.T, password string, epsv bool, pasvAddr string, listing string) *testserver.Server {
+	server, err := testserver.New(testserver.Config{
+		Banner: []byte("220 Welcome\r\n"),
+		Handler: func(conn net.Conn) error {
+			return handle(conn, password, epsv, pasvAddr, listing)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func handle(conn net.Conn, password string, epsv bool, pasvAddr string, listing string) error {
+	reader := bufio.NewReader(conn)
+	var data net.Listener
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// The scanner closes the connection once done.
+			return nil
+		}
+		cmd := strings.TrimSpace(line)
+		switch {
+		case cmd == "USER anonymous":
+			fmt.Fprintf(conn, "331 Please specify the password.\r\n")
+		case strings.HasPrefix(cmd, "PASS "):
+			if cmd[5:] == password {
+				fmt.Fprintf(conn, "230 Login successful.\r\n")
+			} else {
+				fmt.Fprintf(conn, "530 Login incorrect.\r\n")
+			}
+		case cmd == "FEAT":
+			fmt.Fprintf(conn, "211-Features:\r\n EPSV\r\n MDTM\r\n UTF8\r\n211 End\r\n")
+		case cmd == "SYST":
+			fmt.Fprintf(conn, "215 UNIX Type: L8\r\n")
+		case cmd == "PWD":
+			fmt.Fprintf(conn, "257 \"/\" is the current directory\r\n")
+		case cmd == "EPSV" && epsv, cmd == "PASV":
+			if data, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				return err
+			}
+			port := data.Addr().(*net.TCPAddr).Port
+			if cmd == "EPSV" {
+				fmt.Fprintf(conn, "229 Entering Extended Passive Mode (|||%d|)\r\n", port)
+			} else {
+				addr := pasvAddr
+				if addr == "" {
+					addr = "127,0,0,1"
+				}
+				fmt.Fprintf(conn, "227 Entering Passive Mode (%s,%d,%d).\r\n", addr, port>>8, port&0xff)
+			}
+		case cmd == "LIST" && data != nil:
+			dataConn, err := data.Accept()
+			data.Close()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(conn, "150 Here comes the directory listing.\r\n")
+			dataConn.Write([]byte(listing))
+			dataConn.Close()
+			fmt.Fprintf(conn, "226 Directory send OK.\r\n")
+		default:
+			fmt.Fprintf(conn, "500 Unknown command.\r\n")
+		}
+	}
+}
+
+func scan(t *testing.T, server *testserver.Server, password string, maxSize int) *ScanResults {
+	defer server.Close()
+	flags := &Flags{
+		Login:       true,
+		Username:    "anonymous",
+		Password:    password,
+		List:        true,
+		ListMaxSize: maxSize,
+	}
+	return zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*ScanResults)
+}
+
+func TestLoginAndList(t *testing.T) {
+	listing := "drwxr-xr-x 2 0 0 4096 Jan 01 00:00 pub\r\n"
+	for _, epsv := range []bool{true, false} {
+		results := scan(t, serve(t, "anonymous@", epsv, "", listing), "anonymous@", 8192)
+		if results.Login == nil || !results.Login.Success || results.Login.PassResp != "230 Login successful.\r\n" {
+			t.Errorf("got login %+v", results.Login)
+		}
+		if !reflect.DeepEqual(results.Features, []string{"EPSV", "MDTM", "UTF8"}) {
+			t.Errorf("got features %q", results.Features)
+		}
+		if results.SystResp != "215 UNIX Type: L8\r\n" || results.PWDResp != "257 \"/\" is the current directory\r\n" {
+			t.Errorf("got SYST %q, PWD %q", results.SystResp, results.PWDResp)
+		}
+		list := results.List
+		if list == nil || list.Listing != listing || list.Truncated || list.CompleteResp != "226 Directory send OK.\r\n" || list.Error != "" {
+			t.Errorf("EPSV %v: got listing %+v", epsv, list)
+		}
+	}
+}
+
+func TestListPassiveAddress(t *testing.T) {
+	listing := "drwxr-xr-x 2 0 0 4096 Jan 01 00:00 pub\r\n"
+	// An unspecified address stands for that of the server.
+	results := scan(t, serve(t, "anonymous@", false, "0,0,0,0", listing), "anonymous@", 8192)
+	if list := results.List; list == nil || list.Listing != listing || list.Error != "" {
+		t.Errorf("got listing %+v", list)
+	}
+	// The data connection is not made to another host.
+	results = scan(t, serve(t, "anonymous@", false, "192,0,2,1", listing), "anonymous@", 8192)
+	if list := results.List; list == nil || list.Listing != "" || list.Error != "passive address 192.0.2.1 is not that of the server" {
+		t.Errorf("got listing %+v", list)
+	}
+}
+
+func TestListTruncated(t *testing.T) {
+	results := scan(t, serve(t, "anonymous@", true, "", strings.Repeat("x", 100)), "anonymous@", 10)
+	if list := results.List; list == nil || list.Listing != "xxxxxxxxxx" || !list.Truncated {
+		t.Errorf("got listing %+v", list)
+	}
+}
+
+func TestLoginFailed(t *testing.T) {
+	results := scan(t, serve(t, "secret", true, "", ""), "anonymous@", 8192)
+	if results.Login == nil || results.Login.Success || results.Login.PassResp != "530 Login incorrect.\r\n" {
+		t.Errorf("got login %+v", results.Login)
+	}
+	if results.PWDResp != "" || results.List != nil {
+		t.Errorf("got PWD %q, listing %+v without logging in", results.PWDResp, results.List)
+	}
+	if results.SystResp == "" {
+		t.Errorf("no SYST response")
+	}
+}
@@ -0,0 +1,7 @@
+package modules
+
+import "github.com/zmap/zgrab2/modules/git"
+
+func init() {
+	git.RegisterModule()
+}
@@ -0,0 +1,47 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxPktLen is the maximum length of a pkt-line, including its length.
+const maxPktLen = 65520
+
+var (
+	// ErrInvalidPktLine is returned if the response is not a pkt-line.
+	ErrInvalidPktLine = errors.New("invalid pkt-line")
+
+	// errFlush is returned by readPktLine on a flush-pkt (0000).
+	errFlush = errors.New("flush-pkt")
+)
+
+// encodePktLine prefixes data with its length, as four hex digits.
+func encodePktLine(data string) []byte {
+	return []byte(fmt.Sprintf("%04x%s", len(data)+4, data))
+}
+
+// readPktLine reads a pkt-line, returning errFlush on a flush-pkt.
+func readPktLine(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	n, err := strconv.ParseUint(string(header[:]), 16, 16)
+	if err != nil {
+		return nil, ErrInvalidPktLine
+	}
+	switch {
+	case n == 0:
+		return nil, errFlush
+	case n < 4 || n > maxPktLen:
+		return nil, ErrInvalidPktLine
+	}
+	data := make([]byte, n-4)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
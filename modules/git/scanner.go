@@ -0,0 +1,217 @@
+// Package git provides a zgrab2 module that requests the references of a
+// repository from git daemons.
+// Default Port: 9418 (TCP)
+//
+// The scanner sends a git-upload-pack request for --path, and reads the
+// references and capabilities the daemon advertises, or the error it sends
+// if the repository does not exist or is not exported. Either response
+// identifies a git daemon; the root path (the default) is served when the
+// daemon exports its base path as a repository.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// Flags holds the command-line configuration for the git module.
+type Flags struct {
+	zgrab2.BaseFlags
+
+	Path    string `long:"path" default:"/" description:"Path of the repository to request"`
+	Host    string `long:"host" description:"Host name sent with the request; defaults to the domain or IP of the target"`
+	MaxRefs int    `long:"max-refs" default:"100" description:"Max number of references to record"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Ref is an advertised reference.
+type Ref struct {
+	Name     string `json:"name"`
+	ObjectID string `json:"object_id"`
+}
+
+// Results is the output of the git module.
+type Results struct {
+	// Path is the requested path.
+	Path string `json:"path"`
+
+	// Error is the error sent by the daemon.
+	Error string `json:"error,omitempty"`
+
+	// RefCount is the number of advertised references, and Refs the first
+	// of them.
+	RefCount int   `json:"ref_count,omitempty"`
+	Refs     []Ref `json:"refs,omitempty"`
+
+	// Capabilities lists the capabilities advertised with the first
+	// reference. Head is the target of HEAD and Agent the version of the
+	// daemon, when advertised.
+	Capabilities []string `json:"capabilities,omitempty"`
+	Head         string   `json:"head,omitempty"`
+	Agent        string   `json:"agent,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("git", "git", module.Description(), 9418, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Request the references and capabilities of a repository from a git daemon"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if !strings.HasPrefix(flags.Path, "/") && !strings.HasPrefix(flags.Path, "~") {
+		log.Errorf("Invalid path %q: must start with / or ~", flags.Path)
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "git"
+}
+
+// addRef records a line of the reference advertisement. The first line
+// carries the capabilities after a NUL byte; an empty repository advertises
+// them with the capabilities^{} pseudo-reference.
+func (scanner *Scanner) addRef(line []byte, results *Results) error {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	if i := bytes.IndexByte(line, 0); i >= 0 {
+		results.Capabilities = strings.Fields(string(line[i+1:]))
+		for _, c := range results.Capabilities {
+			switch {
+			case strings.HasPrefix(c, "symref=HEAD:"):
+				results.Head = strings.TrimPrefix(c, "symref=HEAD:")
+			case strings.HasPrefix(c, "agent="):
+				results.Agent = strings.TrimPrefix(c, "agent=")
+			}
+		}
+		line = line[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) != 2 {
+		return ErrInvalidPktLine
+	}
+	if fields[1] == "capabilities^{}" {
+		return nil
+	}
+	results.RefCount++
+	if len(results.Refs) < scanner.config.MaxRefs {
+		results.Refs = append(results.Refs, Ref{Name: fields[1], ObjectID: fields[0]})
+	}
+	return nil
+}
+
+// Scan sends the git-upload-pack request and reads the references until the
+// flush-pkt, which it answers with a flush-pkt to end the session.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	host := scanner.config.Host
+	if host == "" {
+		host = target.Domain
+	}
+	if host == "" {
+		host = target.IP.String()
+	}
+	request := "git-upload-pack " + scanner.config.Path + "\x00host=" + host + "\x00"
+	if _, err := conn.Write(encodePktLine(request)); err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	results := &Results{Path: scanner.config.Path}
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := readPktLine(reader)
+		if err == errFlush {
+			conn.Write([]byte("0000"))
+			return zgrab2.SCAN_SUCCESS, results, nil
+		}
+		if err == ErrInvalidPktLine {
+			return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+		}
+		if err != nil {
+			if results.RefCount > 0 {
+				return zgrab2.TryGetScanStatus(err), results, err
+			}
+			return zgrab2.TryGetScanStatus(err), nil, err
+		}
+		if bytes.HasPrefix(line, []byte("ERR ")) {
+			results.Error = strings.TrimSpace(string(line[4:]))
+			return zgrab2.SCAN_SUCCESS, results, nil
+		}
+		if err := scanner.addRef(line, results); err != nil {
+			return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// serve returns the handler of a fake git daemon, answering the request with
+// response and recording the request.
+func serve(response string, requests chan<- string) func(conn net.Conn) error {
+	return func(conn net.Conn) error {
+		line, err := readPktLine(bufio.NewReader(conn))
+		if err != nil {
+			return err
+		}
+		requests <- string(line)
+		_, err = conn.Write([]byte(response))
+		return err
+	}
+}
+
+func scan(t *testing.T, response string, flags *Flags) (*Results, string) {
+	requests := make(chan string, 1)
+	server, err := testserver.New(testserver.Config{Handler: serve(response, requests)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	return zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*Results), <-requests
+}
+
+func TestRefs(t *testing.T) {
+	var response bytes.Buffer
+	response.Write(encodePktLine("6f2e3c1d4b5a69788796a5b4c3d2e1f00a1b2c3d HEAD\x00multi_ack thin-pack side-band side-band-64k ofs-delta shallow no-progress include-tag symref=HEAD:refs/heads/main agent=git/2.39.2\n"))
+	response.Write(encodePktLine("6f2e3c1d4b5a69788796a5b4c3d2e1f00a1b2c3d refs/heads/main\n"))
+	response.Write(encodePktLine("1a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d refs/tags/v1.0\n"))
+	response.WriteString("0000")
+	results, request := scan(t, response.String(), &Flags{Path: "/project.git", Host: "git.example.com", MaxRefs: 2})
+	if request != "git-upload-pack /project.git\x00host=git.example.com\x00" {
+		t.Errorf("got request %q", request)
+	}
+	expected := []Ref{
+		{Name: "HEAD", ObjectID: "6f2e3c1d4b5a69788796a5b4c3d2e1f00a1b2c3d"},
+		{Name: "refs/heads/main", ObjectID: "6f2e3c1d4b5a69788796a5b4c3d2e1f00a1b2c3d"},
+	}
+	if results.RefCount != 3 || !reflect.DeepEqual(results.Refs, expected) || results.Head != "refs/heads/main" || results.Agent != "git/2.39.2" || len(results.Capabilities) != 10 {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestEmptyRepository(t *testing.T) {
+	response := string(encodePktLine("0000000000000000000000000000000000000000 capabilities^{}\x00multi_ack agent=git/2.30.1\n")) + "0000"
+	results, request := scan(t, response, &Flags{Path: "/", MaxRefs: 100})
+	if request != "git-upload-pack /\x00host=127.0.0.1\x00" {
+		t.Errorf("got request %q", request)
+	}
+	if results.RefCount != 0 || results.Refs != nil || results.Agent != "git/2.30.1" {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestError(t *testing.T) {
+	response := string(encodePktLine("ERR access denied or repository not exported: /\n"))
+	results, _ := scan(t, response, &Flags{Path: "/", MaxRefs: 100})
+	if results.Error != "access denied or repository not exported: /" || results.RefCount != 0 {
+		t.Errorf("got %+v", results)
+	}
+}
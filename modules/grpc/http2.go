@@ -0,0 +1,413 @@
+package grpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// preface is the client connection preface.
+const preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// The frame types.
+const (
+	frameData         = 0x0
+	frameHeaders      = 0x1
+	frameRSTStream    = 0x3
+	frameSettings     = 0x4
+	framePing         = 0x6
+	frameGoAway       = 0x7
+	frameWindowUpdate = 0x8
+	frameContinuation = 0x9
+)
+
+// The frame flags.
+const (
+	flagEndStream  = 0x1
+	flagAck        = 0x1
+	flagEndHeaders = 0x4
+	flagPadded     = 0x8
+	flagPriority   = 0x20
+)
+
+const (
+	// frameHeaderLength is the length of the frame header.
+	frameHeaderLength = 9
+
+	// maxFrameSize is the default maximum frame size, which the client
+	// keeps.
+	maxFrameSize = 16384
+
+	// maxReadFrameSize is the maximum size of the frames read.
+	maxReadFrameSize = 1 << 20
+
+	// windowSize is the flow control window of the client, large enough for
+	// the client never to send WINDOW_UPDATE frames.
+	windowSize = 1 << 30
+)
+
+var (
+	// ErrNotHTTP2 is returned if the server does not start the connection
+	// with a SETTINGS frame.
+	ErrNotHTTP2 = errors.New("server did not answer with HTTP/2 settings")
+
+	// errGoAway is returned if the server closes the connection before
+	// processing a stream.
+	errGoAway = errors.New("server sent GOAWAY")
+)
+
+// settingNames names the settings, as in the output of the http3 module.
+var settingNames = map[uint16]string{
+	0x1: "header_table_size",
+	0x2: "enable_push",
+	0x3: "max_concurrent_streams",
+	0x4: "initial_window_size",
+	0x5: "max_frame_size",
+	0x6: "max_header_list_size",
+	0x8: "enable_connect_protocol",
+}
+
+// errorCodeNames names the error codes of RST_STREAM and GOAWAY frames.
+var errorCodeNames = map[uint32]string{
+	0x0: "NO_ERROR",
+	0x1: "PROTOCOL_ERROR",
+	0x2: "INTERNAL_ERROR",
+	0x3: "FLOW_CONTROL_ERROR",
+	0x4: "SETTINGS_TIMEOUT",
+	0x5: "STREAM_CLOSED",
+	0x6: "FRAME_SIZE_ERROR",
+	0x7: "REFUSED_STREAM",
+	0x8: "CANCEL",
+	0x9: "COMPRESSION_ERROR",
+	0xa: "CONNECT_ERROR",
+	0xb: "ENHANCE_YOUR_CALM",
+	0xc: "INADEQUATE_SECURITY",
+	0xd: "HTTP_1_1_REQUIRED",
+}
+
+// errorCodeName returns the name of an error code.
+func errorCodeName(code uint32) string {
+	if name, ok := errorCodeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%x", code)
+}
+
+// GoAway is the content of a GOAWAY frame.
+type GoAway struct {
+	LastStreamID uint32 `json:"last_stream_id"`
+	ErrorCode    string `json:"error_code"`
+	DebugData    string `json:"debug_data,omitempty"`
+}
+
+// frame is a frame, with its payload.
+type frame struct {
+	typ     byte
+	flags   byte
+	stream  uint32
+	payload []byte
+}
+
+// response is the response to a request on a stream.
+type response struct {
+	headers  map[string]string
+	trailers map[string]string
+	data     []byte
+
+	// reset is the error code of the RST_STREAM frame ending the stream, if
+	// any.
+	reset *uint32
+}
+
+// conn is an HTTP/2 client connection, sending one request at a time.
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	encoder *hpack.Encoder
+	encoded bytes.Buffer
+	decoder *hpack.Decoder
+
+	nextStream uint32
+	maxData    int
+
+	// settings are the settings of the server, and goAway the GOAWAY frame
+	// received, if any.
+	settings map[string]uint32
+	goAway   *GoAway
+}
+
+// newConn returns a client connection over c, reading at most maxData bytes
+// of data per response.
+func newConn(c net.Conn, maxData int) *conn {
+	ret := &conn{
+		conn:       c,
+		reader:     bufio.NewReader(c),
+		decoder:    hpack.NewDecoder(4096, nil),
+		nextStream: 1,
+		maxData:    maxData,
+		settings:   make(map[string]uint32),
+	}
+	ret.encoder = hpack.NewEncoder(&ret.encoded)
+	return ret
+}
+
+// appendFrame appends a frame to buf.
+func appendFrame(buf []byte, typ, flags byte, stream uint32, payload []byte) []byte {
+	header := make([]byte, frameHeaderLength)
+	header[0] = byte(len(payload) >> 16)
+	header[1] = byte(len(payload) >> 8)
+	header[2] = byte(len(payload))
+	header[3] = typ
+	header[4] = flags
+	binary.BigEndian.PutUint32(header[5:], stream)
+	return append(append(buf, header...), payload...)
+}
+
+// writeFrame writes a frame.
+func (c *conn) writeFrame(typ, flags byte, stream uint32, payload []byte) error {
+	_, err := c.conn.Write(appendFrame(nil, typ, flags, stream, payload))
+	return err
+}
+
+// readFrame reads a frame.
+func (c *conn) readFrame() (*frame, error) {
+	header := make([]byte, frameHeaderLength)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return nil, err
+	}
+	length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+	if length > maxReadFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes", length)
+	}
+	f := &frame{
+		typ:     header[3],
+		flags:   header[4],
+		stream:  binary.BigEndian.Uint32(header[5:]) & 0x7fffffff,
+		payload: make([]byte, length),
+	}
+	if _, err := io.ReadFull(c.reader, f.payload); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// handshake sends the connection preface, with the settings of the client,
+// and reads the settings of the server.
+func (c *conn) handshake() error {
+	settings := make([]byte, 6)
+	binary.BigEndian.PutUint16(settings, 0x4)
+	binary.BigEndian.PutUint32(settings[2:], windowSize)
+	update := make([]byte, 4)
+	binary.BigEndian.PutUint32(update, windowSize-65535)
+	buf := appendFrame([]byte(preface), frameSettings, 0, 0, settings)
+	buf = appendFrame(buf, frameWindowUpdate, 0, 0, update)
+	if _, err := c.conn.Write(buf); err != nil {
+		return err
+	}
+	// Check the type of the first frame before trusting its length.
+	header, err := c.reader.Peek(frameHeaderLength)
+	if err == io.EOF || (err == nil && header[3] != frameSettings) {
+		return ErrNotHTTP2
+	}
+	if err != nil {
+		return err
+	}
+	f, err := c.readFrame()
+	if err == io.ErrUnexpectedEOF {
+		return ErrNotHTTP2
+	}
+	if err != nil {
+		return err
+	}
+	if f.typ != frameSettings || f.stream != 0 || f.flags&flagAck != 0 || len(f.payload)%6 != 0 {
+		return ErrNotHTTP2
+	}
+	return c.handleSettings(f)
+}
+
+// handleSettings records the settings of the server, and acknowledges them.
+func (c *conn) handleSettings(f *frame) error {
+	if f.flags&flagAck != 0 {
+		return nil
+	}
+	for b := f.payload; len(b) >= 6; b = b[6:] {
+		id := binary.BigEndian.Uint16(b)
+		name, ok := settingNames[id]
+		if !ok {
+			name = fmt.Sprintf("0x%x", id)
+		}
+		c.settings[name] = binary.BigEndian.Uint32(b[2:])
+	}
+	return c.writeFrame(frameSettings, flagAck, 0, nil)
+}
+
+// encodeHeaders returns the header block of fields, in order.
+func (c *conn) encodeHeaders(fields [][2]string) []byte {
+	c.encoded.Reset()
+	for _, field := range fields {
+		c.encoder.WriteField(hpack.HeaderField{Name: field[0], Value: field[1]})
+	}
+	return append([]byte(nil), c.encoded.Bytes()...)
+}
+
+// headerBlock returns the header block fragment of a HEADERS frame, without
+// its padding and priority.
+func headerBlock(f *frame) ([]byte, error) {
+	b := f.payload
+	padding := 0
+	if f.flags&flagPadded != 0 {
+		if len(b) < 1 {
+			return nil, ErrNotHTTP2
+		}
+		padding = int(b[0])
+		b = b[1:]
+	}
+	if f.flags&flagPriority != 0 {
+		if len(b) < 5 {
+			return nil, ErrNotHTTP2
+		}
+		b = b[5:]
+	}
+	if padding > len(b) {
+		return nil, ErrNotHTTP2
+	}
+	return b[:len(b)-padding], nil
+}
+
+// dataPayload returns the payload of a DATA frame, without its padding.
+func dataPayload(f *frame) ([]byte, error) {
+	if f.flags&flagPadded == 0 {
+		return f.payload, nil
+	}
+	if len(f.payload) < 1 || int(f.payload[0]) > len(f.payload)-1 {
+		return nil, ErrNotHTTP2
+	}
+	return f.payload[1 : len(f.payload)-int(f.payload[0])], nil
+}
+
+// roundTrip sends a request with the header fields and the body on a new
+// stream, and reads the response. Frames of other streams are skipped.
+func (c *conn) roundTrip(fields [][2]string, body []byte) (*response, error) {
+	id := c.nextStream
+	c.nextStream += 2
+	block := c.encodeHeaders(fields)
+	if len(block) > maxFrameSize {
+		return nil, fmt.Errorf("header block of %d bytes", len(block))
+	}
+	flags := byte(flagEndHeaders)
+	if len(body) == 0 {
+		flags |= flagEndStream
+	}
+	if err := c.writeFrame(frameHeaders, flags, id, block); err != nil {
+		return nil, err
+	}
+	for len(body) > 0 {
+		n := len(body)
+		flags = flagEndStream
+		if n > maxFrameSize {
+			n = maxFrameSize
+			flags = 0
+		}
+		if err := c.writeFrame(frameData, flags, id, body[:n]); err != nil {
+			return nil, err
+		}
+		body = body[n:]
+	}
+	resp := new(response)
+	var fragment []byte
+	var fragmentStream uint32
+	var fragmentEnd bool
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return resp, err
+		}
+		switch f.typ {
+		case frameSettings:
+			if err := c.handleSettings(f); err != nil {
+				return resp, err
+			}
+		case framePing:
+			if f.flags&flagAck == 0 {
+				if err := c.writeFrame(framePing, flagAck, 0, f.payload); err != nil {
+					return resp, err
+				}
+			}
+		case frameGoAway:
+			if len(f.payload) < 8 {
+				return resp, ErrNotHTTP2
+			}
+			c.goAway = &GoAway{
+				LastStreamID: binary.BigEndian.Uint32(f.payload) & 0x7fffffff,
+				ErrorCode:    errorCodeName(binary.BigEndian.Uint32(f.payload[4:])),
+				DebugData:    string(f.payload[8:]),
+			}
+			if c.goAway.LastStreamID < id {
+				return resp, errGoAway
+			}
+		case frameRSTStream:
+			if f.stream == id && len(f.payload) >= 4 {
+				code := binary.BigEndian.Uint32(f.payload)
+				resp.reset = &code
+				return resp, nil
+			}
+		case frameHeaders, frameContinuation:
+			if f.typ == frameHeaders {
+				b, err := headerBlock(f)
+				if err != nil {
+					return resp, err
+				}
+				fragment = append([]byte(nil), b...)
+				fragmentStream = f.stream
+				fragmentEnd = f.flags&flagEndStream != 0
+			} else {
+				fragment = append(fragment, f.payload...)
+			}
+			if f.flags&flagEndHeaders == 0 {
+				continue
+			}
+			// Every header block updates the decoding table.
+			decoded, err := c.decoder.DecodeFull(fragment)
+			if err != nil {
+				return resp, err
+			}
+			if fragmentStream != id {
+				continue
+			}
+			fields := make(map[string]string)
+			for _, field := range decoded {
+				fields[field.Name] = field.Value
+			}
+			if resp.headers == nil {
+				resp.headers = fields
+			} else {
+				resp.trailers = fields
+			}
+			if fragmentEnd {
+				return resp, nil
+			}
+		case frameData:
+			if f.stream != id {
+				continue
+			}
+			b, err := dataPayload(f)
+			if err != nil {
+				return resp, err
+			}
+			if len(resp.data)+len(b) > c.maxData {
+				return resp, fmt.Errorf("response larger than %d bytes", c.maxData)
+			}
+			resp.data = append(resp.data, b...)
+			if f.flags&flagEndStream != 0 {
+				return resp, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The paths of the ServerReflectionInfo method of the two versions of the
+// reflection service.
+const (
+	pathReflectionV1      = "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"
+	pathReflectionV1Alpha = "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"
+)
+
+// The fields of ServerReflectionRequest.
+const (
+	requestFileContainingSymbol = 4
+	requestListServices         = 7
+)
+
+// The fields of ServerReflectionResponse.
+const (
+	responseFileDescriptor = 4
+	responseListServices   = 6
+	responseError          = 7
+)
+
+// The wire types of protobuf.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// The gRPC status codes handled by the scanner.
+const (
+	statusOK            = 0
+	statusUnimplemented = 12
+)
+
+// errInvalidMessage is returned if a message cannot be decoded.
+var errInvalidMessage = errors.New("invalid protobuf message")
+
+// statusNames names the gRPC status codes.
+var statusNames = map[int]string{
+	0:  "OK",
+	1:  "CANCELLED",
+	2:  "UNKNOWN",
+	3:  "INVALID_ARGUMENT",
+	4:  "DEADLINE_EXCEEDED",
+	5:  "NOT_FOUND",
+	6:  "ALREADY_EXISTS",
+	7:  "PERMISSION_DENIED",
+	8:  "RESOURCE_EXHAUSTED",
+	9:  "FAILED_PRECONDITION",
+	10: "ABORTED",
+	11: "OUT_OF_RANGE",
+	12: "UNIMPLEMENTED",
+	13: "INTERNAL",
+	14: "UNAVAILABLE",
+	15: "DATA_LOSS",
+	16: "UNAUTHENTICATED",
+}
+
+// statusName returns the name of a gRPC status code.
+func statusName(code int) string {
+	if name, ok := statusNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", code)
+}
+
+// field is a field of a protobuf message. Value is the value of varint and
+// fixed fields, and data the content of length-delimited fields.
+type field struct {
+	num   uint64
+	value uint64
+	data  []byte
+}
+
+// appendVarint appends v as a varint.
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+// appendString appends a length-delimited field.
+func appendString(buf []byte, num uint64, s string) []byte {
+	buf = appendVarint(buf, num<<3|wireBytes)
+	buf = appendVarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// parseFields decodes the fields of a message.
+func parseFields(buf []byte) ([]field, error) {
+	var fields []field
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errInvalidMessage
+		}
+		buf = buf[n:]
+		f := field{num: key >> 3}
+		switch key & 7 {
+		case wireVarint:
+			f.value, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return nil, errInvalidMessage
+			}
+			buf = buf[n:]
+		case wireFixed64:
+			if len(buf) < 8 {
+				return nil, errInvalidMessage
+			}
+			f.value = binary.LittleEndian.Uint64(buf)
+			buf = buf[8:]
+		case wireFixed32:
+			if len(buf) < 4 {
+				return nil, errInvalidMessage
+			}
+			f.value = uint64(binary.LittleEndian.Uint32(buf))
+			buf = buf[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(buf)
+			if n <= 0 || length > uint64(len(buf)-n) {
+				return nil, errInvalidMessage
+			}
+			f.data = buf[n : n+int(length)]
+			buf = buf[n+int(length):]
+		default:
+			return nil, errInvalidMessage
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// frameMessages returns the messages prefixed with their gRPC message header,
+// uncompressed.
+func frameMessages(messages ...[]byte) []byte {
+	var buf []byte
+	for _, m := range messages {
+		header := make([]byte, 5)
+		binary.BigEndian.PutUint32(header[1:], uint32(len(m)))
+		buf = append(append(buf, header...), m...)
+	}
+	return buf
+}
+
+// splitMessages returns the messages of the data of a response.
+func splitMessages(data []byte) ([][]byte, error) {
+	var messages [][]byte
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, errInvalidMessage
+		}
+		length := binary.BigEndian.Uint32(data[1:])
+		if data[0] != 0 || uint64(length) > uint64(len(data)-5) {
+			return nil, errInvalidMessage
+		}
+		messages = append(messages, data[5:5+length])
+		data = data[5+length:]
+	}
+	return messages, nil
+}
+
+// Method is a method of a service.
+type Method struct {
+	Name            string `json:"name"`
+	InputType       string `json:"input_type,omitempty"`
+	OutputType      string `json:"output_type,omitempty"`
+	ClientStreaming bool   `json:"client_streaming,omitempty"`
+	ServerStreaming bool   `json:"server_streaming,omitempty"`
+}
+
+// Service is a service listed by the reflection service.
+type Service struct {
+	Name    string    `json:"name"`
+	Methods []*Method `json:"methods,omitempty"`
+
+	// Error is the error returned by the reflection service for the file of
+	// the service.
+	Error string `json:"error,omitempty"`
+}
+
+// reflectionError returns the error of an ErrorResponse.
+func reflectionError(buf []byte) error {
+	fields, err := parseFields(buf)
+	if err != nil {
+		return err
+	}
+	code, message := 0, ""
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			code = int(int32(f.value))
+		case 2:
+			message = string(f.data)
+		}
+	}
+	return fmt.Errorf("%s: %s", statusName(code), message)
+}
+
+// parseListServices returns the names of the services of the responses to a
+// list_services request.
+func parseListServices(messages [][]byte) ([]string, error) {
+	var names []string
+	for _, m := range messages {
+		fields, err := parseFields(m)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			switch f.num {
+			case responseError:
+				return nil, reflectionError(f.data)
+			case responseListServices:
+				services, err := parseFields(f.data)
+				if err != nil {
+					return nil, err
+				}
+				for _, s := range services {
+					if s.num != 1 {
+						continue
+					}
+					service, err := parseFields(s.data)
+					if err != nil {
+						return nil, err
+					}
+					for _, sf := range service {
+						if sf.num == 1 {
+							names = append(names, string(sf.data))
+						}
+					}
+				}
+			}
+		}
+	}
+	return names, nil
+}
+
+// parseMethod decodes a MethodDescriptorProto.
+func parseMethod(buf []byte) (*Method, error) {
+	fields, err := parseFields(buf)
+	if err != nil {
+		return nil, err
+	}
+	m := new(Method)
+	for _, f := range fields {
+		switch f.num {
+		case 1:
+			m.Name = string(f.data)
+		case 2:
+			m.InputType = string(f.data)
+		case 3:
+			m.OutputType = string(f.data)
+		case 5:
+			m.ClientStreaming = f.value != 0
+		case 6:
+			m.ServerStreaming = f.value != 0
+		}
+	}
+	return m, nil
+}
+
+// parseFileDescriptor adds the methods of the services of a
+// FileDescriptorProto to methods, by full service name.
+func parseFileDescriptor(buf []byte, methods map[string][]*Method) error {
+	fields, err := parseFields(buf)
+	if err != nil {
+		return err
+	}
+	pkg := ""
+	for _, f := range fields {
+		if f.num == 2 {
+			pkg = string(f.data) + "."
+		}
+	}
+	for _, f := range fields {
+		if f.num != 6 {
+			continue
+		}
+		service, err := parseFields(f.data)
+		if err != nil {
+			return err
+		}
+		name := ""
+		var serviceMethods []*Method
+		for _, sf := range service {
+			switch sf.num {
+			case 1:
+				name = string(sf.data)
+			case 2:
+				m, err := parseMethod(sf.data)
+				if err != nil {
+					return err
+				}
+				serviceMethods = append(serviceMethods, m)
+			}
+		}
+		methods[pkg+name] = serviceMethods
+	}
+	return nil
+}
+
+// parseFileResponses fills the methods of services from the responses to
+// file_containing_symbol requests, in the order of services.
+func parseFileResponses(messages [][]byte, services []*Service) error {
+	methods := make(map[string][]*Method)
+	for i, m := range messages {
+		fields, err := parseFields(m)
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			switch f.num {
+			case responseError:
+				if i < len(services) {
+					services[i].Error = reflectionError(f.data).Error()
+				}
+			case responseFileDescriptor:
+				files, err := parseFields(f.data)
+				if err != nil {
+					return err
+				}
+				for _, file := range files {
+					if file.num != 1 {
+						continue
+					}
+					if err := parseFileDescriptor(file.data, methods); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	for _, s := range services {
+		s.Methods = methods[s.Name]
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+// Package grpc provides a zgrab2 module that connects to a gRPC server over
+// HTTP/2, and lists its services and methods with the reflection service.
+// Default Port: 50051 (TCP)
+//
+// The scanner opens an HTTP/2 connection, over TLS with --use-tls or in
+// cleartext with prior knowledge, and calls the ServerReflectionInfo method
+// of the v1 reflection service, then of the v1alpha one if v1 is not
+// implemented, to list the services of the server. It then requests the file
+// descriptor of each service, and records its methods. Servers without
+// reflection answer with an UNIMPLEMENTED status, and other HTTP/2 servers
+// with an HTTP status, a stream reset or a GOAWAY frame, which are recorded
+// along with the settings of the server.
+package grpc
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// maxServices is the maximum number of services whose methods are requested.
+const maxServices = 64
+
+// Flags holds the command-line configuration for the grpc module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	UseTLS    bool   `long:"use-tls" description:"Negotiate TLS, with the h2 ALPN protocol, before HTTP/2"`
+	NoMethods bool   `long:"no-methods" description:"Only list the services, without requesting their methods"`
+	UserAgent string `long:"user-agent" default:"grpc-zgrab2/0.x" description:"Set a custom user agent"`
+	MaxSize   int    `long:"max-size" default:"256" description:"Max kilobytes of each response to read"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results is the output of the grpc module.
+type Results struct {
+	// Settings are the HTTP/2 settings of the server.
+	Settings map[string]uint32 `json:"settings,omitempty"`
+
+	// StatusCode and ContentType are the HTTP status and content type of the
+	// last reflection call.
+	StatusCode  int    `json:"status_code,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+
+	// GRPCStatus and GRPCMessage are the gRPC status of the last reflection
+	// call, such as UNIMPLEMENTED if reflection is disabled.
+	GRPCStatus  string `json:"grpc_status,omitempty"`
+	GRPCMessage string `json:"grpc_message,omitempty"`
+
+	// Reflection is true if the server listed its services, with the
+	// ReflectionVersion of the reflection service.
+	Reflection        bool       `json:"reflection"`
+	ReflectionVersion string     `json:"reflection_version,omitempty"`
+	Services          []*Service `json:"services,omitempty"`
+
+	// ResetCode is the error code of the stream reset of the last call, and
+	// GoAway the GOAWAY frame of the server.
+	ResetCode string  `json:"reset_code,omitempty"`
+	GoAway    *GoAway `json:"goaway,omitempty"`
+
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("grpc", "gRPC", module.Description(), 50051, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "List the services and methods of a gRPC server with the reflection service, or record the HTTP/2 error"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	if f.UseTLS && f.NextProtos == "" {
+		f.NextProtos = "h2"
+	}
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "grpc"
+}
+
+// scanStatus returns the status of a scan failing with err.
+func scanStatus(err error) zgrab2.ScanStatus {
+	if err == ErrNotHTTP2 || err == errInvalidMessage {
+		return zgrab2.SCAN_PROTOCOL_ERROR
+	}
+	return zgrab2.TryGetScanStatus(err)
+}
+
+// open connects to the target, negotiating TLS with --use-tls.
+func (scanner *Scanner) open(ctx context.Context, target *zgrab2.ScanTarget, results *Results) (net.Conn, error) {
+	if !scanner.config.UseTLS {
+		return target.Open(ctx, &scanner.config.BaseFlags)
+	}
+	conn, err := target.OpenTLS(ctx, &scanner.config.BaseFlags, &scanner.config.TLSFlags)
+	if conn == nil {
+		return nil, err
+	}
+	results.TLSLog = conn.GetLog()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// call calls the reflection method at path with the messages, and records
+// the status of the call. It returns the messages of the response, or nil if
+// the call failed.
+func (scanner *Scanner) call(c *conn, target *zgrab2.ScanTarget, path string, messages [][]byte, results *Results) ([][]byte, error) {
+	scheme := "http"
+	if scanner.config.UseTLS {
+		scheme = "https"
+	}
+	authority := target.Host()
+	if target.Domain != "" {
+		authority = target.Domain
+	}
+	if target.Port != nil {
+		authority = net.JoinHostPort(authority, strconv.FormatUint(uint64(*target.Port), 10))
+	} else {
+		authority = net.JoinHostPort(authority, strconv.FormatUint(uint64(scanner.config.Port), 10))
+	}
+	resp, err := c.roundTrip([][2]string{
+		{":method", "POST"},
+		{":scheme", scheme},
+		{":path", path},
+		{":authority", authority},
+		{"content-type", "application/grpc"},
+		{"te", "trailers"},
+		{"user-agent", scanner.config.UserAgent},
+	}, frameMessages(messages...))
+	results.StatusCode, results.ContentType, results.GRPCStatus, results.GRPCMessage, results.ResetCode = 0, "", "", "", ""
+	if resp != nil {
+		if resp.reset != nil {
+			results.ResetCode = errorCodeName(*resp.reset)
+		}
+		if resp.headers != nil {
+			results.StatusCode, _ = strconv.Atoi(resp.headers[":status"])
+			results.ContentType = resp.headers["content-type"]
+		}
+		// Trailers-only responses carry the status in the headers.
+		status := resp.trailers
+		if status == nil {
+			status = resp.headers
+		}
+		if code, ok := status["grpc-status"]; ok {
+			n, _ := strconv.Atoi(code)
+			results.GRPCStatus = statusName(n)
+			results.GRPCMessage = status["grpc-message"]
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.reset != nil || results.GRPCStatus != statusName(statusOK) {
+		return nil, nil
+	}
+	return splitMessages(resp.data)
+}
+
+// listMethods requests the file descriptor of each service, and records its
+// methods.
+func (scanner *Scanner) listMethods(c *conn, target *zgrab2.ScanTarget, path string, results *Results) error {
+	var requests [][]byte
+	services := results.Services
+	if len(services) > maxServices {
+		services = services[:maxServices]
+	}
+	for _, s := range services {
+		requests = append(requests, appendString(nil, requestFileContainingSymbol, s.Name))
+	}
+	messages, err := scanner.call(c, target, path, requests, results)
+	if err != nil || messages == nil {
+		return err
+	}
+	return parseFileResponses(messages, services)
+}
+
+// Scan opens the HTTP/2 connection, and calls the reflection service. Any
+// answer over HTTP/2 is a success, with Reflection set if the services were
+// listed. The scan fails if the server does not speak HTTP/2.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	results := new(Results)
+	netConn, err := scanner.open(ctx, &target, results)
+	if err != nil {
+		if results.TLSLog != nil {
+			return zgrab2.TryGetScanStatus(err), results, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer netConn.Close()
+	c := newConn(netConn, scanner.config.MaxSize*1024)
+	if err := c.handshake(); err != nil {
+		return scanStatus(err), nil, err
+	}
+	results.Settings = c.settings
+	listServices := [][]byte{appendString(nil, requestListServices, "")}
+	var messages [][]byte
+	for _, version := range []struct{ name, path string }{{"v1", pathReflectionV1}, {"v1alpha", pathReflectionV1Alpha}} {
+		messages, err = scanner.call(c, &target, version.path, listServices, results)
+		results.GoAway = c.goAway
+		if err == errGoAway {
+			return zgrab2.SCAN_SUCCESS, results, nil
+		}
+		if err != nil {
+			return scanStatus(err), results, err
+		}
+		if messages != nil {
+			results.ReflectionVersion = version.name
+			names, err := parseListServices(messages)
+			if err != nil {
+				return zgrab2.SCAN_PROTOCOL_ERROR, results, err
+			}
+			results.Reflection = true
+			for _, name := range names {
+				results.Services = append(results.Services, &Service{Name: name})
+			}
+			if !scanner.config.NoMethods && len(results.Services) > 0 {
+				err := scanner.listMethods(c, &target, version.path, results)
+				results.GoAway = c.goAway
+				if err != nil && err != errGoAway {
+					return scanStatus(err), results, err
+				}
+			}
+			break
+		}
+		if results.GRPCStatus != statusName(statusUnimplemented) {
+			break
+		}
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,189 @@
+package grpc
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// fileDescriptor returns the FileDescriptorProto of the helloworld example,
+// with a Greeter service of two methods.
+func fileDescriptor() []byte {
+	sayHello := appendString(nil, 1, "SayHello")
+	sayHello = appendString(sayHello, 2, ".helloworld.HelloRequest")
+	sayHello = appendString(sayHello, 3, ".helloworld.HelloReply")
+	streamHello := appendString(nil, 1, "StreamHello")
+	streamHello = appendString(streamHello, 2, ".helloworld.HelloRequest")
+	streamHello = appendString(streamHello, 3, ".helloworld.HelloReply")
+	streamHello = append(streamHello, 6<<3|wireVarint, 1)
+	service := appendString(nil, 1, "Greeter")
+	service = appendString(service, 2, string(sayHello))
+	service = appendString(service, 2, string(streamHello))
+	file := appendString(nil, 1, "helloworld.proto")
+	file = appendString(file, 2, "helloworld")
+	return appendString(file, 6, string(service))
+}
+
+// reflectionResponse returns the response of the fake reflection service to
+// a request.
+func reflectionResponse(t *testing.T, request []byte) []byte {
+	fields, err := parseFields(request)
+	if err != nil || len(fields) != 1 {
+		t.Fatalf("got request %x", request)
+	}
+	switch fields[0].num {
+	case requestListServices:
+		list := appendString(nil, 1, string(appendString(nil, 1, "helloworld.Greeter")))
+		list = appendString(list, 1, string(appendString(nil, 1, "grpc.health.v1.Health")))
+		return appendString(nil, responseListServices, string(list))
+	case requestFileContainingSymbol:
+		if string(fields[0].data) == "helloworld.Greeter" {
+			return appendString(nil, responseFileDescriptor, string(appendString(nil, 1, string(fileDescriptor()))))
+		}
+		e := append([]byte{1 << 3, 5}, appendString(nil, 2, "symbol not found")...)
+		return appendString(nil, responseError, string(e))
+	}
+	t.Fatalf("got request field %d", fields[0].num)
+	return nil
+}
+
+// serve runs a fake gRPC server implementing the reflection service at the
+// paths of reflection, and answering UNIMPLEMENTED at the other paths.
+func serve(t *testing.T, reflection map[string]bool) *testserver.Server {
+	server, err := testserver.New(testserver.Config{Handler: func(netConn net.Conn) error {
+		c := newConn(netConn, 1<<20)
+		p := make([]byte, len(preface))
+		if _, err := io.ReadFull(c.reader, p); err != nil {
+			return err
+		}
+		if string(p) != preface {
+			return fmt.Errorf("got preface %q", p)
+		}
+		c.writeFrame(frameSettings, 0, 0, []byte{0, 3, 0, 0, 0, 100})
+		path := make(map[uint32]string)
+		body := make(map[uint32][]byte)
+		for {
+			f, err := c.readFrame()
+			if err != nil {
+				// The scanner closes the connection once done.
+				return nil
+			}
+			switch f.typ {
+			case frameHeaders:
+				fields, err := c.decoder.DecodeFull(f.payload)
+				if err != nil {
+					return err
+				}
+				for _, field := range fields {
+					if field.Name == ":path" {
+						path[f.stream] = field.Value
+					}
+				}
+			case frameData:
+				body[f.stream] = append(body[f.stream], f.payload...)
+				if f.flags&flagEndStream == 0 {
+					continue
+				}
+				if !reflection[path[f.stream]] {
+					c.writeFrame(frameHeaders, flagEndHeaders|flagEndStream, f.stream, c.encodeHeaders([][2]string{
+						{":status", "200"},
+						{"content-type", "application/grpc"},
+						{"grpc-status", "12"},
+						{"grpc-message", "unknown service"},
+					}))
+					continue
+				}
+				requests, err := splitMessages(body[f.stream])
+				if err != nil {
+					return err
+				}
+				var responses [][]byte
+				for _, request := range requests {
+					responses = append(responses, reflectionResponse(t, request))
+				}
+				c.writeFrame(frameHeaders, flagEndHeaders, f.stream, c.encodeHeaders([][2]string{
+					{":status", "200"},
+					{"content-type", "application/grpc"},
+				}))
+				c.writeFrame(frameData, 0, f.stream, frameMessages(responses...))
+				c.writeFrame(frameHeaders, flagEndHeaders|flagEndStream, f.stream, c.encodeHeaders([][2]string{
+					{"grpc-status", "0"},
+				}))
+			}
+		}
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func scan(t *testing.T, server *testserver.Server) (zgrab2.ScanStatus, *Results, error) {
+	defer server.Close()
+	flags := &Flags{UserAgent: "grpc-zgrab2/0.x", MaxSize: 256}
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), flags, server.Addr())
+	results, _ := ret.(*Results)
+	return status, results, err
+}
+
+func TestReflection(t *testing.T) {
+	status, results, err := scan(t, serve(t, map[string]bool{pathReflectionV1: true}))
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if !results.Reflection || results.ReflectionVersion != "v1" || results.GRPCStatus != "OK" || results.Settings["max_concurrent_streams"] != 100 {
+		t.Errorf("got %+v", results)
+	}
+	want := []*Service{
+		{Name: "helloworld.Greeter", Methods: []*Method{
+			{Name: "SayHello", InputType: ".helloworld.HelloRequest", OutputType: ".helloworld.HelloReply"},
+			{Name: "StreamHello", InputType: ".helloworld.HelloRequest", OutputType: ".helloworld.HelloReply", ServerStreaming: true},
+		}},
+		{Name: "grpc.health.v1.Health", Error: "NOT_FOUND: symbol not found"},
+	}
+	if !reflect.DeepEqual(results.Services, want) {
+		t.Errorf("got services %+v", results.Services)
+		for _, s := range results.Services {
+			t.Errorf("%+v", s)
+		}
+	}
+}
+
+func TestReflectionV1Alpha(t *testing.T) {
+	status, results, err := scan(t, serve(t, map[string]bool{pathReflectionV1Alpha: true}))
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if !results.Reflection || results.ReflectionVersion != "v1alpha" || len(results.Services) != 2 {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestReflectionDisabled(t *testing.T) {
+	status, results, err := scan(t, serve(t, nil))
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if results.Reflection || results.GRPCStatus != "UNIMPLEMENTED" || results.GRPCMessage != "unknown service" || results.StatusCode != 200 {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestNotHTTP2(t *testing.T) {
+	server, err := testserver.New(testserver.Config{Script: []testserver.Step{
+		testserver.Exchange(`^PRI \* HTTP/2\.0\r\n\r\nSM\r\n\r\n`, "HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _, err := scan(t, server)
+	if status != zgrab2.SCAN_PROTOCOL_ERROR || err != ErrNotHTTP2 {
+		t.Errorf("got status %s, error %v", status, err)
+	}
+}
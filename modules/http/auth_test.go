@@ -0,0 +1,151 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	gohttp "net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+)
+
+// newAuthFlags returns the flags of a scanner answering authentication
+// challenges with the given credentials file contents, and the name of the
+// credentials file, to be removed by the caller.
+func newAuthFlags(t *testing.T, creds string) (*Flags, string) {
+	f, err := ioutil.TempFile("", "creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(creds)
+	f.Close()
+
+	var module Module
+	flags := module.NewFlags().(*Flags)
+	flags.Endpoint = "/"
+	flags.Method = "GET"
+	flags.UserAgent = "Mozilla/5.0 zgrab/0.x"
+	flags.MaxSize = 256
+	flags.MaxRedirects = 3
+	flags.MaxAuthTries = 3
+	flags.FollowLocalhostRedirects = true
+	flags.CredsFile = f.Name()
+	return flags, f.Name()
+}
+
+// TestAuthAfterRedirect checks that a challenge from the target of a redirect
+// is answered by retrying that target, not the first URL.
+func TestAuthAfterRedirect(t *testing.T) {
+	server := httptest.NewServer(gohttp.HandlerFunc(func(w gohttp.ResponseWriter, r *gohttp.Request) {
+		switch r.URL.Path {
+		case "/":
+			if r.Header.Get("Authorization") != "" {
+				gohttp.Error(w, "credentials sent to the wrong resource", gohttp.StatusBadRequest)
+				return
+			}
+			gohttp.Redirect(w, r, "/protected", gohttp.StatusFound)
+		case "/protected":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="protected"`)
+				w.WriteHeader(gohttp.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, "welcome")
+		default:
+			gohttp.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	flags, creds := newAuthFlags(t, "127.0.0.1 admin:secret\n")
+	defer os.Remove(creds)
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), flags, server.Listener.Addr().String())
+	if status != zgrab2.SCAN_SUCCESS {
+		t.Fatalf("got status %s (%v)", status, err)
+	}
+	results := ret.(*Results)
+	if results.Auth == nil || !results.Auth.Success || len(results.Auth.Attempts) != 1 || results.Auth.Attempts[0].Realm != "protected" {
+		t.Errorf("got auth results %+v", results.Auth)
+	}
+	if results.Response.StatusCode != 200 || results.Response.Request.URL.Path != "/protected" || results.Response.BodyText != "welcome" {
+		t.Errorf("got final response %d for %s: %q", results.Response.StatusCode, results.Response.Request.URL, results.Response.BodyText)
+	}
+}
+
+// TestAuthCrossHostRedirect checks that the credentials for the address of
+// the target are not sent to another host after a redirect.
+func TestAuthCrossHostRedirect(t *testing.T) {
+	server := httptest.NewServer(gohttp.HandlerFunc(func(w gohttp.ResponseWriter, r *gohttp.Request) {
+		if host, port, _ := net.SplitHostPort(r.Host); host == "127.0.0.1" {
+			gohttp.Redirect(w, r, "http://localhost:"+port+"/protected", gohttp.StatusFound)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="other site"`)
+			w.WriteHeader(gohttp.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "leaked")
+	}))
+	defer server.Close()
+
+	flags, creds := newAuthFlags(t, "127.0.0.1 admin:secret\nlocalhost guest:guest\n")
+	defer os.Remove(creds)
+	_, ret, _ := zgrab2test.Scan(t, new(Scanner), flags, server.Listener.Addr().String())
+	results := ret.(*Results)
+	if results.Auth == nil || results.Auth.Success {
+		t.Fatalf("got auth results %+v", results.Auth)
+	}
+	// Only the credentials for the name of the other host are tried.
+	for _, attempt := range results.Auth.Attempts {
+		if attempt.Username != "guest" {
+			t.Errorf("sent the credentials of %s to another host", attempt.Username)
+		}
+	}
+	if len(results.Auth.Attempts) != 1 {
+		t.Errorf("got %d attempts; expected 1", len(results.Auth.Attempts))
+	}
+}
+
+// TestAuthNamedCrossHostRedirect checks that the credentials named in the
+// input for the target are not sent to another host after a redirect.
+func TestAuthNamedCrossHostRedirect(t *testing.T) {
+	authorized := make(chan string, 10)
+	server := httptest.NewServer(gohttp.HandlerFunc(func(w gohttp.ResponseWriter, r *gohttp.Request) {
+		if host, port, _ := net.SplitHostPort(r.Host); host == "127.0.0.1" {
+			gohttp.Redirect(w, r, "http://localhost:"+port+"/protected", gohttp.StatusFound)
+			return
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			authorized <- auth
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="other site"`)
+		w.WriteHeader(gohttp.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	flags, creds := newAuthFlags(t, "router-admin admin:secret\n")
+	defer os.Remove(creds)
+	flags.Port = zgrab2test.Port(t, server.Listener.Addr().String())
+	flags.Timeout = zgrab2test.Timeout
+	var scanner Scanner
+	if err := scanner.Init(flags); err != nil {
+		t.Fatal(err)
+	}
+	target := zgrab2.ScanTarget{IP: net.ParseIP("127.0.0.1"), Options: &zgrab2.TargetOptions{Credentials: "router-admin"}}
+	_, ret, _ := scanner.Scan(context.Background(), target)
+	results := ret.(*Results)
+	if results.Auth == nil || results.Auth.Success || len(results.Auth.Attempts) != 0 {
+		t.Errorf("got auth results %+v", results.Auth)
+	}
+	select {
+	case auth := <-authorized:
+		t.Errorf("sent %q to another host", auth)
+	default:
+	}
+}
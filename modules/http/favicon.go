@@ -0,0 +1,165 @@
+package http
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"github.com/zmap/zgrab2/lib/http"
+	"golang.org/x/net/html"
+)
+
+// Favicon describes the favicon of the scanned site, fetched with
+// --fetch-favicon.
+type Favicon struct {
+	// URL is the URL of the favicon: the icon linked from the HTML of the
+	// response, or /favicon.ico.
+	URL string `json:"url"`
+
+	StatusCode int `json:"status_code,omitempty"`
+
+	// Size is the number of bytes of the favicon read.
+	Size int `json:"size,omitempty"`
+
+	// MD5 is the hex MD5 digest of the favicon.
+	MD5 string `json:"md5,omitempty"`
+
+	// MMH3 is the MurmurHash3 of the base64 encoding of the favicon, as
+	// computed by Shodan (http.favicon.hash).
+	MMH3 int32 `json:"mmh3,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// faviconURL returns the URL of the favicon of a page at base, from the first
+// <link rel="icon"> of body, or /favicon.ico.
+func faviconURL(base *url.URL, body string) *url.URL {
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			u, _ := base.Parse("/favicon.ico")
+			return u
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) == "body" {
+				// Links belong in the head.
+				u, _ := base.Parse("/favicon.ico")
+				return u
+			}
+			if string(name) != "link" || !hasAttr {
+				continue
+			}
+			var rel, href string
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				switch string(key) {
+				case "rel":
+					rel = string(val)
+				case "href":
+					href = string(val)
+				}
+			}
+			if href == "" {
+				continue
+			}
+			for _, r := range strings.Fields(strings.ToLower(rel)) {
+				if r != "icon" {
+					continue
+				}
+				u, err := base.Parse(strings.TrimSpace(href))
+				if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+					return u
+				}
+			}
+		}
+	}
+}
+
+// faviconHash returns the MurmurHash3 (x86, 32 bits, seed 0) of the base64
+// encoding of data, wrapped every 76 characters with a trailing newline
+// (Python's base64.encodebytes), which is the favicon hash used by Shodan.
+func faviconHash(data []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b bytes.Buffer
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteByte('\n')
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	b.WriteByte('\n')
+	return int32(murmur3(b.Bytes(), 0))
+}
+
+// murmur3 returns the MurmurHash3_x86_32 of data.
+func murmur3(data []byte, seed uint32) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+	h := seed
+	n := len(data)
+	for ; len(data) >= 4; data = data[4:] {
+		k := binary.LittleEndian.Uint32(data)
+		k *= c1
+		k = k<<15 | k>>17
+		k *= c2
+		h ^= k
+		h = h<<13 | h>>19
+		h = h*5 + 0xe6546b64
+	}
+	var k uint32
+	switch len(data) {
+	case 3:
+		k ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[0])
+		k *= c1
+		k = k<<15 | k>>17
+		k *= c2
+		h ^= k
+	}
+	h ^= uint32(n)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// fetchFavicon requests the favicon of the final response and records its
+// hashes.
+func (scan *scan) fetchFavicon() {
+	resp := scan.results.Response
+	if resp == nil || resp.Request == nil || resp.Request.URL == nil {
+		return
+	}
+	u := faviconURL(resp.Request.URL, resp.BodyText)
+	favicon := &Favicon{URL: u.String()}
+	scan.results.Favicon = favicon
+
+	res, body, err := scan.fetch(favicon.URL)
+	if err != nil {
+		favicon.Error = err.Error()
+		return
+	}
+	favicon.StatusCode = res.StatusCode
+	if res.StatusCode != http.StatusOK || len(body) == 0 {
+		return
+	}
+	sum := md5.Sum(body)
+	favicon.Size = len(body)
+	favicon.MD5 = hex.EncodeToString(sum[:])
+	favicon.MMH3 = faviconHash(body)
+}
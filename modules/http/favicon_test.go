@@ -0,0 +1,57 @@
+package http
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+)
+
+func TestMurmur3(t *testing.T) {
+	tests := []struct {
+		data     string
+		seed     uint32
+		expected uint32
+	}{
+		{"", 0, 0},
+		{"", 1, 0x514e28b7},
+		{"hello", 0, 0x248bfa47},
+		{"Hello, world!", 1234, 0xfaf6cdb3},
+		{"The quick brown fox jumps over the lazy dog", 0, 0x2e4ff723},
+	}
+	for _, test := range tests {
+		if h := murmur3([]byte(test.data), test.seed); h != test.expected {
+			t.Errorf("murmur3(%q, %d) = %#x; expected %#x", test.data, test.seed, h, test.expected)
+		}
+	}
+}
+
+func TestFaviconHash(t *testing.T) {
+	// 60 bytes encode to 80 base64 characters, wrapped after 76.
+	data := bytes.Repeat([]byte{0}, 60)
+	encoded := bytes.Repeat([]byte("A"), 80)
+	wrapped := append(append(append([]byte(nil), encoded[:76]...), '\n'), encoded[76:]...)
+	wrapped = append(wrapped, '\n')
+	if h, expected := faviconHash(data), int32(murmur3(wrapped, 0)); h != expected {
+		t.Errorf("faviconHash = %d; expected %d", h, expected)
+	}
+}
+
+func TestFaviconURL(t *testing.T) {
+	base, _ := url.Parse("https://example.com/app/index.html")
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{"", "https://example.com/favicon.ico"},
+		{`<html><head><link rel="stylesheet" href="a.css"></head></html>`, "https://example.com/favicon.ico"},
+		{`<html><head><LINK REL="Shortcut Icon" HREF="img/fav.png"></head></html>`, "https://example.com/app/img/fav.png"},
+		{`<link rel="icon" href="//cdn.example.net/f.ico"/>`, "https://cdn.example.net/f.ico"},
+		{`<link rel="icon" href="data:image/png;base64,AAAA"><link rel="icon" href="/f.ico">`, "https://example.com/f.ico"},
+		{`<head></head><body><link rel="icon" href="/late.ico"></body>`, "https://example.com/favicon.ico"},
+	}
+	for _, test := range tests {
+		if u := faviconURL(base, test.body).String(); u != test.expected {
+			t.Errorf("faviconURL(%q) = %s; expected %s", test.body, u, test.expected)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package http
+
+import (
+	"mime"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTMLMetadata holds the fields extracted from an HTML response body with
+// --extract-html.
+type HTMLMetadata struct {
+	// Title is the text of the first <title> element.
+	Title string `json:"title,omitempty"`
+
+	// Generator is the content of the first <meta name="generator">.
+	Generator string `json:"generator,omitempty"`
+
+	// Charset is the character set declared by a <meta> element, or else by
+	// the Content-Type header.
+	Charset string `json:"charset,omitempty"`
+
+	// LoginForms lists the forms with a password field.
+	LoginForms []LoginForm `json:"login_forms,omitempty"`
+
+	// ScriptHosts lists the hosts, other than the page's own, that scripts
+	// are loaded from.
+	ScriptHosts []string `json:"script_hosts,omitempty"`
+}
+
+// LoginForm describes a form with a password field.
+type LoginForm struct {
+	// Action is the URL the form is submitted to.
+	Action string `json:"action,omitempty"`
+	Method string `json:"method,omitempty"`
+
+	// Fields lists the names of the form's input fields.
+	Fields []string `json:"fields,omitempty"`
+}
+
+// maxLoginForms bounds the number of login forms recorded for a page.
+const maxLoginForms = 16
+
+// extractHTMLMetadata parses the HTML body of a page at base. It returns nil if
+// nothing was found.
+func extractHTMLMetadata(base *url.URL, body string) *HTMLMetadata {
+	meta := new(HTMLMetadata)
+	var (
+		inTitle  bool
+		title    strings.Builder
+		form     *LoginForm
+		password bool
+	)
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			meta.Title = strings.Join(strings.Fields(title.String()), " ")
+			if meta.Title == "" && meta.Generator == "" && meta.Charset == "" && meta.LoginForms == nil && meta.ScriptHosts == nil {
+				return nil
+			}
+			return meta
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				if inTitle {
+					inTitle = false
+					meta.Title = title.String()
+				}
+			case "form":
+				if form != nil && password && len(meta.LoginForms) < maxLoginForms {
+					meta.LoginForms = append(meta.LoginForms, *form)
+				}
+				form = nil
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := make(map[string]string)
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if _, ok := attrs[string(key)]; !ok {
+					attrs[string(key)] = string(val)
+				}
+			}
+			switch string(name) {
+			case "title":
+				inTitle = meta.Title == "" && tt == html.StartTagToken
+			case "meta":
+				switch {
+				case strings.EqualFold(attrs["name"], "generator"):
+					if meta.Generator == "" {
+						meta.Generator = strings.TrimSpace(attrs["content"])
+					}
+				case attrs["charset"] != "":
+					if meta.Charset == "" {
+						meta.Charset = strings.ToLower(strings.TrimSpace(attrs["charset"]))
+					}
+				case strings.EqualFold(attrs["http-equiv"], "content-type"):
+					if meta.Charset == "" {
+						meta.Charset = contentTypeCharset(attrs["content"])
+					}
+				}
+			case "form":
+				form = &LoginForm{Method: strings.ToUpper(attrs["method"])}
+				password = false
+				if form.Method == "" {
+					form.Method = "GET"
+				}
+				action := base
+				if attrs["action"] != "" {
+					if u, err := base.Parse(strings.TrimSpace(attrs["action"])); err == nil {
+						action = u
+					}
+				}
+				form.Action = action.String()
+			case "input":
+				if form == nil {
+					continue
+				}
+				if strings.EqualFold(attrs["type"], "password") {
+					password = true
+				}
+				if attrs["name"] != "" && len(form.Fields) < 64 {
+					form.Fields = append(form.Fields, attrs["name"])
+				}
+			case "script":
+				src := strings.TrimSpace(attrs["src"])
+				if src == "" {
+					continue
+				}
+				u, err := base.Parse(src)
+				if err != nil || u.Host == "" || strings.EqualFold(u.Hostname(), base.Hostname()) {
+					continue
+				}
+				host := strings.ToLower(u.Hostname())
+				found := false
+				for _, h := range meta.ScriptHosts {
+					found = found || h == host
+				}
+				if !found {
+					meta.ScriptHosts = append(meta.ScriptHosts, host)
+				}
+			}
+		}
+	}
+}
+
+// contentTypeCharset returns the charset parameter of a Content-Type value, in
+// lower case, or "".
+func contentTypeCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(params["charset"])
+}
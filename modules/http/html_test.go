@@ -0,0 +1,48 @@
+package http
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestExtractHTMLMetadata(t *testing.T) {
+	base, _ := url.Parse("https://example.com/app/")
+	body := `<!DOCTYPE html>
+<html><head>
+<meta charset="UTF-8">
+<meta name="Generator" content="WordPress 5.2.3">
+<title>
+  Log in &amp; more
+</title>
+<script src="/local.js"></script>
+<script src="https://cdn.Example.net/lib.js"></script>
+<script src="//cdn.example.net/other.js"></script>
+<script src="https://static.example.org/x.js"></script>
+</head><body>
+<form action="search"><input name="q"></form>
+<form method="post" action="/login"><input name="user"><input type="password" name="pass"></form>
+<title>Not the title</title>
+</body></html>`
+	expected := &HTMLMetadata{
+		Title:     "Log in & more",
+		Generator: "WordPress 5.2.3",
+		Charset:   "utf-8",
+		LoginForms: []LoginForm{
+			{Action: "https://example.com/login", Method: "POST", Fields: []string{"user", "pass"}},
+		},
+		ScriptHosts: []string{"cdn.example.net", "static.example.org"},
+	}
+	if meta := extractHTMLMetadata(base, body); !reflect.DeepEqual(meta, expected) {
+		t.Errorf("extractHTMLMetadata = %+v; expected %+v", meta, expected)
+	}
+
+	if meta := extractHTMLMetadata(base, "not html"); meta != nil {
+		t.Errorf("extractHTMLMetadata of text = %+v; expected nil", meta)
+	}
+
+	body = `<meta http-equiv="Content-Type" content="text/html; charset=ISO-8859-1">`
+	if meta := extractHTMLMetadata(base, body); meta == nil || meta.Charset != "iso-8859-1" {
+		t.Errorf("extractHTMLMetadata(%q) = %+v", body, meta)
+	}
+}
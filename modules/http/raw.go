@@ -0,0 +1,136 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/http"
+)
+
+// RawExchange is the request sent from the --raw-request template, and the
+// raw bytes read in response.
+type RawExchange struct {
+	Request  string         `json:"request"`
+	Response string         `json:"response,omitempty"`
+	TLSLog   *zgrab2.TLSLog `json:"tls_log,omitempty"`
+}
+
+// rawPlaceholder matches the placeholders of a raw request template.
+var rawPlaceholder = regexp.MustCompile(`\{\{(host|ip|port|random)\}\}`)
+
+// expandRawTemplate replaces the placeholders of a raw request template:
+// {{host}} with the target's domain (or IP), {{ip}} with its IP, {{port}}
+// with the port and {{random}} with 16 random hex digits, different for each
+// occurrence.
+func expandRawTemplate(template []byte, host, ip, port string) []byte {
+	return rawPlaceholder.ReplaceAllFunc(template, func(placeholder []byte) []byte {
+		switch string(placeholder) {
+		case "{{host}}":
+			return []byte(host)
+		case "{{ip}}":
+			return []byte(ip)
+		case "{{port}}":
+			return []byte(port)
+		default:
+			b := make([]byte, 8)
+			rand.Read(b)
+			return []byte(hex.EncodeToString(b))
+		}
+	})
+}
+
+// hostPort returns the host (the target's domain, or else its IP), the IP and
+// the port of the target.
+func (scan *scan) hostPort() (host, ip, port string) {
+	t := scan.target
+	host = t.Domain
+	if t.IP != nil {
+		ip = t.IP.String()
+		if host == "" {
+			host = ip
+		}
+	}
+	port = strconv.FormatUint(uint64(scan.scanner.config.BaseFlags.Port), 10)
+	if t.Port != nil {
+		port = strconv.FormatUint(uint64(*t.Port), 10)
+	}
+	return host, ip, port
+}
+
+// dialTarget opens a connection to the target, over TLS if the scan uses
+// HTTPS, and returns it with its TLS log, if any.
+func (scan *scan) dialTarget() (net.Conn, *zgrab2.TLSLog, error) {
+	host, _, port := scan.hostPort()
+	addr := net.JoinHostPort(host, port)
+	if !strings.HasPrefix(scan.url, "https://") {
+		conn, err := scan.dialContext(context.Background(), "tcp", addr)
+		return conn, nil, err
+	}
+	conn, err := scan.getTLSDialer(scan.target)("tcp", addr)
+	var tlsLog *zgrab2.TLSLog
+	if tlsConn, ok := conn.(*zgrab2.TLSConnection); ok {
+		tlsLog = tlsConn.GetLog()
+	}
+	return conn, tlsLog, err
+}
+
+// grabRaw sends the raw request template, verbatim once its placeholders are
+// expanded, and records the raw response. If the response parses as HTTP, it
+// is also recorded as the Response. Any bytes read make the scan a success.
+func (scan *scan) grabRaw() *zgrab2.ScanError {
+	host, ip, port := scan.hostPort()
+	raw := &RawExchange{Request: string(expandRawTemplate(scan.scanner.rawTemplate, host, ip, port))}
+	scan.results.Raw = raw
+
+	conn, tlsLog, err := scan.dialTarget()
+	raw.TLSLog = tlsLog
+	if err != nil {
+		return zgrab2.DetectScanError(err)
+	}
+	conn.SetDeadline(scan.globalDeadline)
+	if _, err := conn.Write([]byte(raw.Request)); err != nil {
+		return zgrab2.DetectScanError(err)
+	}
+
+	// Read one response if it parses, or else everything until the
+	// connection is closed or times out.
+	maxReadLen := int64(scan.scanner.config.MaxSize) * 1024
+	buf := new(bytes.Buffer)
+	reader := bufio.NewReader(io.TeeReader(io.LimitReader(conn, maxReadLen), buf))
+	resp, err := http.ReadResponse(reader, nil)
+	if err == nil {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.BodyText = string(body)
+		if len(body) > 0 {
+			if scan.scanner.decodedHashFn != nil {
+				resp.BodyHash = scan.scanner.decodedHashFn(body)
+			} else {
+				m := sha256.Sum256(body)
+				resp.BodySHA256 = m[:]
+			}
+		}
+		scan.results.Response = resp
+	} else {
+		io.Copy(ioutil.Discard, reader)
+	}
+	raw.Response = buf.String()
+	if raw.Response == "" {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return zgrab2.NewScanError(zgrab2.SCAN_PROTOCOL_ERROR, err)
+		}
+		return zgrab2.DetectScanError(err)
+	}
+	return nil
+}
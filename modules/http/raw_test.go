@@ -0,0 +1,19 @@
+package http
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestExpandRawTemplate(t *testing.T) {
+	template := []byte("GET /{{random}} HTTP/1.1\r\nHost: {{host}}:{{port}}\r\nX-IP: {{ip}}\r\nX-Id: {{random}}\r\nX-Other: {{unknown}}\r\n\r\n")
+	got := string(expandRawTemplate(template, "example.com", "192.0.2.1", "8080"))
+	re := regexp.MustCompile(`^GET /([0-9a-f]{16}) HTTP/1\.1\r\nHost: example\.com:8080\r\nX-IP: 192\.0\.2\.1\r\nX-Id: ([0-9a-f]{16})\r\nX-Other: \{\{unknown\}\}\r\n\r\n$`)
+	m := re.FindStringSubmatch(got)
+	if m == nil {
+		t.Fatalf("expandRawTemplate = %q", got)
+	}
+	if m[1] == m[2] {
+		t.Errorf("{{random}} expanded twice to %s", m[1])
+	}
+}
@@ -0,0 +1,52 @@
+package http
+
+import (
+	"fmt"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/http"
+	"github.com/zmap/zgrab2/lib/matcher"
+)
+
+// ruleStatuses are the scan statuses that --match-rules rules may set.
+var ruleStatuses = map[zgrab2.ScanStatus]bool{
+	zgrab2.SCAN_SUCCESS:           true,
+	zgrab2.SCAN_PROTOCOL_ERROR:    true,
+	zgrab2.SCAN_APPLICATION_ERROR: true,
+	zgrab2.SCAN_UNKNOWN_ERROR:     true,
+}
+
+// applyRules adds the tags of the rules matching res to the results, and
+// returns true if one of them ends the scan.
+func (scan *scan) applyRules(res *http.Response) bool {
+	stop := false
+	for _, rule := range scan.scanner.rules.Match(&matcher.Response{
+		StatusCode: res.StatusCode,
+		Headers:    res.Header,
+		Body:       res.BodyText,
+	}) {
+		found := false
+		for _, tag := range scan.results.Tags {
+			found = found || tag == rule.Tag
+		}
+		if !found {
+			scan.results.Tags = append(scan.results.Tags, rule.Tag)
+		}
+		if rule.ScanStatus != "" {
+			scan.ruleStatus = zgrab2.ScanStatus(rule.ScanStatus)
+			scan.ruleTag = rule.Tag
+		}
+		stop = stop || rule.Stop
+	}
+	scan.stopped = scan.stopped || stop
+	return stop
+}
+
+// ruleError returns the error of the scan status set by the matching rules, if
+// any but success.
+func (scan *scan) ruleError() *zgrab2.ScanError {
+	if scan.ruleStatus == "" || scan.ruleStatus == zgrab2.SCAN_SUCCESS {
+		return nil
+	}
+	return zgrab2.NewScanError(scan.ruleStatus, fmt.Errorf("matched rule %s", scan.ruleTag))
+}
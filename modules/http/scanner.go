@@ -15,15 +15,23 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zcrypto/tls"
 	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/auth"
 	"github.com/zmap/zgrab2/lib/http"
+	"github.com/zmap/zgrab2/lib/http/cookiejar"
+	"github.com/zmap/zgrab2/lib/http/httpauth"
+	"github.com/zmap/zgrab2/lib/kerberos"
+	"github.com/zmap/zgrab2/lib/matcher"
+	"github.com/zmap/zgrab2/lib/technology"
 	"golang.org/x/net/html/charset"
 )
 
@@ -55,6 +63,16 @@ type Flags struct {
 	// ErrRedirLocalhost whenever a redirect points to localhost.
 	FollowLocalhostRedirects bool `long:"follow-localhost-redirects" description:"Follow HTTP redirects to localhost"`
 
+	// NoCrossHostRedirects and NoCrossProtocolRedirects stop the redirect
+	// chain, without an error, at a redirect to another host or from HTTP
+	// to HTTPS (or back); the redirect is then the final response.
+	NoCrossHostRedirects     bool `long:"no-cross-host-redirects" description:"Do not follow HTTP redirects to another host"`
+	NoCrossProtocolRedirects bool `long:"no-cross-protocol-redirects" description:"Do not follow HTTP redirects between HTTP and HTTPS"`
+
+	// PreserveHost sends the Host header of the first request with every
+	// redirected request, rather than the host of the redirect's URL.
+	PreserveHost bool `long:"preserve-host" description:"Send the Host header of the initial request when following redirects"`
+
 	// UseHTTPS causes the first request to be over TLS, without requiring a
 	// redirect to HTTPS. It does not change the port used for the connection.
 	UseHTTPS bool `long:"use-https" description:"Perform an HTTPS connection on the initial host"`
@@ -70,17 +88,177 @@ type Flags struct {
 
 	// WithBodyLength enables adding the body_size field to the Response
 	WithBodyLength bool `long:"with-body-size" description:"Enable the body_size attribute, for how many bytes actually read"`
+
+	// CredsFile holds the credentials used to answer authentication
+	// challenges, one "host username:password..." per line.
+	CredsFile string `long:"creds-file" description:"File of credentials (host username:password... or host bearer:token per line, with host 'default' matching any other host) used to answer 401 and 407 authentication challenges, with the Basic, Digest, NTLM, Negotiate (with NTLM, or with Kerberos given --kerberos-keytab or --kerberos-ccache) and Bearer schemes"`
+
+	// KerberosKeytab and KerberosCCache answer the Negotiate challenges
+	// with Kerberos tickets for the HTTP service of the host, before the
+	// credentials of CredsFile are tried. KerberosPrincipal selects the
+	// principal of the keytab, and KerberosKDC overrides the KDC found in
+	// the SRV records of the realm.
+	KerberosKeytab    string `long:"kerberos-keytab" description:"Keytab with the keys of the Kerberos principal used to answer Negotiate challenges"`
+	KerberosCCache    string `long:"kerberos-ccache" description:"Kerberos credential cache (as written by kinit) used to answer Negotiate challenges"`
+	KerberosPrincipal string `long:"kerberos-principal" description:"Principal (name@REALM) of --kerberos-keytab to use, by default that of its first key"`
+	KerberosKDC       string `long:"kerberos-kdc" description:"Address of the KDC of the Kerberos realm, by default found in its _kerberos._tcp SRV records"`
+
+	// UseCookieJar keeps the cookies set by the server across the requests
+	// of a scan, e.g. along a redirect chain. Each target gets its own jar.
+	UseCookieJar bool `long:"use-cookie-jar" description:"Store cookies set by the server and send them in the following requests to the target, including redirects"`
+
+	// FetchFavicon requests the favicon of the site after the final
+	// response, and records its hashes.
+	FetchFavicon bool `long:"fetch-favicon" description:"Fetch the favicon linked from the final response (or /favicon.ico) and record its MD5 and Shodan-compatible MurmurHash3"`
+
+	// ExtractHTML parses the body of the final response for its title,
+	// generator, charset, login forms and external script hosts.
+	ExtractHTML bool `long:"extract-html" description:"Extract the title, generator, charset, login forms and external script hosts from the HTML of the final response"`
+
+	// SecurityHeaders analyzes the security-relevant headers of the final
+	// response.
+	SecurityHeaders bool `long:"security-headers" description:"Analyze the security headers of the final response (HSTS, CSP, X-Frame-Options, cross-origin policies)"`
+
+	// TechnologiesFile holds Wappalyzer-style rules identifying the
+	// technologies behind the final response.
+	TechnologiesFile string `long:"technologies-file" description:"File of Wappalyzer-style technology rules, matched against the headers, cookies and body of the final response"`
+
+	// RawRequest holds a request template sent verbatim, instead of the
+	// request built from the other flags.
+	RawRequest string `long:"raw-request" description:"File of a raw request to send verbatim, after replacing {{host}}, {{ip}}, {{port}} and {{random}}, recording the raw response"`
+
+	// WebSocket sends a WebSocket handshake to WebSocketPath after the
+	// scan's request, on a new connection.
+	WebSocket            bool          `long:"websocket" description:"Attempt a WebSocket handshake and record the response and the first frame from the server"`
+	WebSocketPath        string        `long:"websocket-path" default:"/" description:"Path of the WebSocket handshake request"`
+	WebSocketProtocols   string        `long:"websocket-protocols" description:"Comma-separated subprotocols to offer in the WebSocket handshake"`
+	WebSocketReadTimeout time.Duration `long:"websocket-read-timeout" default:"1s" description:"How long to wait for a first frame from the server after the WebSocket handshake"`
+
+	// AcceptEncoding lists the content encodings requested and decoded,
+	// among gzip, br and zstd. If empty, responses are not decompressed.
+	AcceptEncoding string `long:"accept-encoding" default:"gzip" description:"Comma-separated content encodings (gzip, br, zstd) to request and decompress; empty to disable compression"`
+
+	// VHostFile lists virtual hosts to request from the IP of every
+	// target, besides those of the input.
+	VHostFile string `long:"vhost-file" description:"File of virtual hosts, one per line, to request from the IP of every target in addition to its own domain, each with its own Host header and SNI"`
+
+	// MatchRules holds rules over the status, headers and body of the
+	// responses that tag the result, and may set the scan status.
+	MatchRules string `long:"match-rules" description:"YAML (or .json) file of rules over the status code, headers and body of the responses, adding tags to the result and optionally setting the scan status or ending the scan"`
+
+	// MaxAuthTries bounds the number of requests sent in answer to
+	// authentication challenges, across all candidate credentials.
+	MaxAuthTries int `long:"max-auth-tries" default:"10" description:"Max number of requests to send in answer to authentication challenges"`
 }
 
 // A Results object is returned by the HTTP module's Scanner.Scan()
 // implementation.
 type Results struct {
-	// Result is the final HTTP response in the RedirectResponseChain
+	// Response is the final HTTP response.
 	Response *http.Response `json:"response,omitempty"`
 
-	// RedirectResponseChain is non-empty is the scanner follows a redirect.
-	// It contains all redirect response prior to the final response.
-	RedirectResponseChain []*http.Response `json:"redirect_response_chain,omitempty"`
+	// Hops lists every response of the scan in order: the redirects, then
+	// the final response, whose headers and TLS log are those of Response.
+	Hops []*Hop `json:"hops,omitempty"`
+
+	// Favicon describes the favicon of the site, with --fetch-favicon.
+	Favicon *Favicon `json:"favicon,omitempty"`
+
+	// HTML holds the metadata extracted from the body of the final
+	// response, with --extract-html.
+	HTML *HTMLMetadata `json:"html,omitempty"`
+
+	// SecurityHeaders is the analysis of the security headers of the final
+	// response, with --security-headers.
+	SecurityHeaders *SecurityHeaders `json:"security_headers,omitempty"`
+
+	// Technologies lists the technologies detected, with
+	// --technologies-file.
+	Technologies []technology.Match `json:"technologies,omitempty"`
+
+	// TechnologyRequests lists the responses to the requests sent because
+	// of the technologies detected in the final response.
+	TechnologyRequests []*Hop `json:"technology_requests,omitempty"`
+
+	// Raw holds the request sent and the response read, with
+	// --raw-request.
+	Raw *RawExchange `json:"raw,omitempty"`
+
+	// WebSocket is the result of the WebSocket handshake, with
+	// --websocket.
+	WebSocket *WebSocket `json:"websocket,omitempty"`
+
+	// VHosts holds the results of the scans of the virtual hosts of the
+	// target, from the input or --vhost-file.
+	VHosts []*VHostResult `json:"vhosts,omitempty"`
+
+	// Tags lists the tags of the --match-rules rules that matched a
+	// response.
+	Tags []string `json:"tags,omitempty"`
+
+	// NegotiateMechanisms lists the mechanisms the server offered or
+	// accepted in its Negotiate (SPNEGO) challenges, if any.
+	NegotiateMechanisms []string `json:"negotiate_mechanisms,omitempty"`
+
+	// Credential is the credential that was accepted by the server, if
+	// any.
+	Credential *httpauth.Credential `json:"credential,omitempty"`
+
+	// Auth describes the authentication challenge of the server and the
+	// attempts to answer it, if the server asked for credentials and a
+	// credentials file was given.
+	Auth *AuthResults `json:"auth,omitempty"`
+}
+
+// Hop describes one response of a redirect chain.
+type Hop struct {
+	// URL is the URL of the request.
+	URL string `json:"url"`
+
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+
+	// TLSLog is the TLS handshake of the connection the request was sent
+	// on, if it used TLS and was a new connection.
+	TLSLog *zgrab2.TLSLog `json:"tls_log,omitempty"`
+}
+
+// AuthResults describes the answers to the authentication challenges of a
+// server.
+type AuthResults struct {
+	// Offered lists the challenges of the first 401 or 407 response.
+	Offered []httpauth.Challenge `json:"offered,omitempty"`
+
+	// Attempted is true if a credential was sent.
+	Attempted bool `json:"attempted"`
+
+	// Attempts lists the requests sent in answer to the challenges.
+	Attempts []AuthAttempt `json:"attempts,omitempty"`
+
+	// StatusCode is the status code of the final response.
+	StatusCode int `json:"status_code"`
+
+	// Success is true if a credential was sent and the final response
+	// did not ask for credentials again.
+	Success bool `json:"success"`
+}
+
+// AuthAttempt describes a request sent in answer to an authentication
+// challenge.
+type AuthAttempt struct {
+	// Scheme, Realm and Algorithm describe the challenge answered.
+	Scheme    string `json:"scheme"`
+	Realm     string `json:"realm,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// Proxy is true if the challenge came from a proxy (a 407 response).
+	Proxy bool `json:"proxy,omitempty"`
+
+	// Username is the username sent, if any (bearer tokens have none).
+	Username string `json:"username,omitempty"`
+
+	// StatusCode is the status code of the response to the request.
+	StatusCode int `json:"status_code"`
 }
 
 // Module is an implementation of the zgrab2.Module interface.
@@ -91,11 +269,18 @@ type Module struct {
 type Scanner struct {
 	config        *Flags
 	decodedHashFn func([]byte) string
+	auth          httpauth.Authenticator
+	technologies  *technology.Rules
+	rawTemplate   []byte
+	encodings     []string
+	vhosts        []string
+	rules         *matcher.Rules
 }
 
 // scan holds the state for a single scan. This may entail multiple connections.
 // It is used to implement the zgrab2.Scanner interface.
 type scan struct {
+	ctx            context.Context
 	connections    []net.Conn
 	scanner        *Scanner
 	target         *zgrab2.ScanTarget
@@ -104,6 +289,20 @@ type scan struct {
 	results        Results
 	url            string
 	globalDeadline time.Time
+
+	// redirects holds the responses redirecting the scan, in order.
+	redirects []*http.Response
+
+	// ruleStatus is the scan status set by the last matching rule with a
+	// scan_status, and ruleTag its tag. stopped is true if a matching rule
+	// ended the scan.
+	ruleStatus zgrab2.ScanStatus
+	ruleTag    string
+	stopped    bool
+
+	// tlsRedialed is true once a TLS connection was given the dialer of the
+	// checks needing new connections, which only run on the first.
+	tlsRedialed bool
 }
 
 // NewFlags returns an empty Flags object.
@@ -116,6 +315,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Send an HTTP request and read the response, optionally following redirects."
@@ -123,9 +327,56 @@ func (module *Module) Description() string {
 
 // Validate performs any needed validation on the arguments
 func (flags *Flags) Validate(args []string) error {
+	for _, encoding := range acceptEncodings(flags.AcceptEncoding) {
+		switch encoding {
+		case "gzip", "br", "zstd":
+		default:
+			log.Errorf("Unsupported content encoding %q in --accept-encoding", encoding)
+			return zgrab2.ErrInvalidArguments
+		}
+	}
+	if flags.KerberosKeytab != "" && flags.KerberosCCache != "" {
+		log.Errorf("--kerberos-keytab and --kerberos-ccache are mutually exclusive")
+		return zgrab2.ErrInvalidArguments
+	}
+	if flags.KerberosPrincipal != "" && flags.KerberosKeytab == "" {
+		log.Errorf("--kerberos-principal requires --kerberos-keytab")
+		return zgrab2.ErrInvalidArguments
+	}
 	return nil
 }
 
+// acceptEncodings splits the comma-separated encodings of --accept-encoding.
+func acceptEncodings(s string) []string {
+	var ret []string
+	for _, encoding := range strings.Split(s, ",") {
+		if encoding = strings.ToLower(strings.TrimSpace(encoding)); encoding != "" {
+			ret = append(ret, encoding)
+		}
+	}
+	return ret
+}
+
+// newKerberosClient returns the Kerberos client of the keytab or credential
+// cache of the flags, or nil if there is none.
+func newKerberosClient(fl *Flags) (*kerberos.Client, error) {
+	switch {
+	case fl.KerberosKeytab != "":
+		kt, err := kerberos.ReadKeytab(fl.KerberosKeytab)
+		if err != nil {
+			return nil, err
+		}
+		return kerberos.NewKeytabClient(kt, fl.KerberosPrincipal, fl.KerberosKDC, fl.Timeout)
+	case fl.KerberosCCache != "":
+		cc, err := kerberos.ReadCCache(fl.KerberosCCache)
+		if err != nil {
+			return nil, err
+		}
+		return kerberos.NewCCacheClient(cc, fl.KerberosKDC, fl.Timeout)
+	}
+	return nil, nil
+}
+
 // Help returns module-specific help
 func (flags *Flags) Help() string {
 	return ""
@@ -140,6 +391,7 @@ func (s *Scanner) Protocol() string {
 func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	fl, _ := flags.(*Flags)
 	scanner.config = fl
+	scanner.encodings = acceptEncodings(fl.AcceptEncoding)
 
 	if fl.ComputeDecodedBodyHashAlgorithm == "sha1" {
 		scanner.decodedHashFn = func(body []byte) string {
@@ -155,6 +407,58 @@ func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 		log.Panicf("Invalid ComputeDecodedBodyHashAlgorithm choice made it through zflags: %s", scanner.config.ComputeDecodedBodyHashAlgorithm)
 	}
 
+	if fl.CredsFile != "" || fl.KerberosKeytab != "" || fl.KerberosCCache != "" {
+		var creds *auth.Credentials
+		if fl.CredsFile != "" {
+			var err error
+			if creds, err = auth.ReadFile(fl.CredsFile); err != nil {
+				return err
+			}
+		}
+		krb, err := newKerberosClient(fl)
+		if err != nil {
+			return err
+		}
+		scanner.auth = httpauth.NewAuthenticator(creds, krb)
+	}
+
+	if fl.RawRequest != "" {
+		template, err := ioutil.ReadFile(fl.RawRequest)
+		if err != nil {
+			return err
+		}
+		scanner.rawTemplate = template
+	}
+
+	if fl.TechnologiesFile != "" {
+		rules, err := technology.Load(fl.TechnologiesFile)
+		if err != nil {
+			return err
+		}
+		scanner.technologies = rules
+	}
+
+	if fl.MatchRules != "" {
+		rules, err := matcher.Load(fl.MatchRules)
+		if err != nil {
+			return err
+		}
+		for _, rule := range rules.List() {
+			if rule.ScanStatus != "" && !ruleStatuses[zgrab2.ScanStatus(rule.ScanStatus)] {
+				return fmt.Errorf("%s: rule %s: invalid scan status %q", fl.MatchRules, rule.Tag, rule.ScanStatus)
+			}
+		}
+		scanner.rules = rules
+	}
+
+	if fl.VHostFile != "" {
+		vhosts, err := readVHosts(fl.VHostFile)
+		if err != nil {
+			return err
+		}
+		scanner.vhosts = vhosts
+	}
+
 	return nil
 }
 
@@ -198,6 +502,7 @@ func (scan *scan) withDeadlineContext(ctx context.Context) context.Context {
 // add the connection to the list of connections to be cleaned up.
 func (scan *scan) dialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
 	dialer := zgrab2.GetTimeoutConnectionDialer(scan.scanner.config.Timeout)
+	dialer.Proxy = scan.target.ProxyURL()
 
 	switch network {
 	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
@@ -216,7 +521,11 @@ func (scan *scan) dialContext(ctx context.Context, network string, addr string)
 				// resolver if the domain originally specified for the scan
 				// target matches the current address being looked up in this
 				// DialContext.
-				if host == scan.target.Domain {
+				if host == scan.target.Domain && dialer.Proxy != nil {
+					// The proxy would resolve the name itself.
+					_, port, _ := net.SplitHostPort(addr)
+					addr = net.JoinHostPort(scan.target.IP.String(), port)
+				} else if host == scan.target.Domain {
 					resolver, err := zgrab2.NewFakeResolver(scan.target.IP.String())
 					if err != nil {
 						return nil, err
@@ -227,12 +536,15 @@ func (scan *scan) dialContext(ctx context.Context, network string, addr string)
 		}
 	}
 
-	timeoutContext, _ := context.WithTimeout(context.Background(), scan.scanner.config.Timeout)
+	timeoutContext, _ := context.WithTimeout(scan.ctx, scan.scanner.config.Timeout)
 
+	release := scan.target.AcquireConn()
 	conn, err := dialer.DialContext(scan.withDeadlineContext(timeoutContext), network, addr)
 	if err != nil {
+		release()
 		return nil, err
 	}
+	conn = scan.target.TraceConn(zgrab2.ReleaseOnClose(conn, release))
 	scan.connections = append(scan.connections, conn)
 	return conn, nil
 }
@@ -240,8 +552,8 @@ func (scan *scan) dialContext(ctx context.Context, network string, addr string)
 // getTLSDialer returns a Dial function that connects using the
 // zgrab2.GetTLSConnection()
 func (scan *scan) getTLSDialer(t *zgrab2.ScanTarget) func(net, addr string) (net.Conn, error) {
-	return func(net, addr string) (net.Conn, error) {
-		outer, err := scan.dialContext(context.Background(), net, addr)
+	return func(network, addr string) (net.Conn, error) {
+		outer, err := scan.dialContext(context.Background(), network, addr)
 		if err != nil {
 			return nil, err
 		}
@@ -263,7 +575,14 @@ func (scan *scan) getTLSDialer(t *zgrab2.ScanTarget) func(net, addr string) (net
 			}
 		}
 
-		tlsConn := scan.scanner.config.TLSFlags.GetWrappedConnection(outer, cfg)
+		var dial func() (net.Conn, error)
+		if !scan.tlsRedialed {
+			scan.tlsRedialed = true
+			dial = func() (net.Conn, error) {
+				return scan.dialContext(context.Background(), network, addr)
+			}
+		}
+		tlsConn := scan.scanner.config.TLSFlags.GetWrappedConnection(outer, cfg, dial)
 
 		// lib/http/transport.go fills in the TLSLog in the http.Request instance(s)
 		err = tlsConn.Handshake()
@@ -299,17 +618,33 @@ func (scan *scan) getCheckRedirect() func(*http.Request, *http.Response, []*http
 		if !scan.scanner.config.FollowLocalhostRedirects && redirectsToLocalhost(req.URL.Hostname()) {
 			return ErrRedirLocalhost
 		}
-		scan.results.RedirectResponseChain = append(scan.results.RedirectResponseChain, res)
-		b := new(bytes.Buffer)
-		maxReadLen := int64(scan.scanner.config.MaxSize) * 1024
-		readLen := maxReadLen
-		if res.ContentLength >= 0 && res.ContentLength < maxReadLen {
-			readLen = res.ContentLength
+		prev := via[len(via)-1].URL
+		if scan.scanner.config.NoCrossHostRedirects && !strings.EqualFold(req.URL.Hostname(), prev.Hostname()) {
+			return http.ErrUseLastResponse
 		}
-		bytesRead, _ := io.CopyN(b, res.Body, readLen)
+		if scan.scanner.config.NoCrossProtocolRedirects && req.URL.Scheme != prev.Scheme {
+			return http.ErrUseLastResponse
+		}
+		if scan.scanner.config.PreserveHost {
+			req.Host = via[0].Host
+			if req.Host == "" {
+				req.Host = via[0].URL.Host
+			}
+		}
+		scan.redirects = append(scan.redirects, res)
+		scan.recordCookies(res)
+		if scan.scanner.auth != nil {
+			scan.scanner.auth.Observe(res)
+			scan.scanner.auth.Authorize(req)
+		}
+		b := new(bytes.Buffer)
+		bytesRead, _ := res.ReadBody(b, int64(scan.scanner.config.MaxSize)*1024)
 		if scan.scanner.config.WithBodyLength {
 			res.BodyTextLength = bytesRead
 		}
+		if res.ContentEncoding != "" {
+			res.DecompressedLength = bytesRead
+		}
 		res.BodyText = b.String()
 		if len(res.BodyText) > 0 {
 			if scan.scanner.decodedHashFn != nil {
@@ -321,6 +656,10 @@ func (scan *scan) getCheckRedirect() func(*http.Request, *http.Response, []*http
 			}
 		}
 
+		if scan.scanner.rules != nil && scan.applyRules(res) {
+			return http.ErrUseLastResponse
+		}
+
 		if len(via) > scan.scanner.config.MaxRedirects {
 			return ErrTooManyRedirects
 		}
@@ -349,16 +688,20 @@ func getHTTPURL(https bool, host string, port uint16, endpoint string) string {
 	return proto + "://" + net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10)) + endpoint
 }
 
-// NewHTTPScan gets a new Scan instance for the given target
-func (scanner *Scanner) newHTTPScan(t *zgrab2.ScanTarget, useHTTPS bool) *scan {
+// NewHTTPScan gets a new Scan instance for the given target, whose connections
+// are interrupted once ctx is canceled.
+func (scanner *Scanner) newHTTPScan(ctx context.Context, t *zgrab2.ScanTarget, useHTTPS bool) *scan {
 	ret := scan{
+		ctx:     ctx,
 		scanner: scanner,
 		target:  t,
 		transport: &http.Transport{
 			Proxy:               nil, // TODO: implement proxying
 			DisableKeepAlives:   false,
-			DisableCompression:  false,
+			DisableCompression:  len(scanner.encodings) == 0,
+			AcceptEncodings:     scanner.encodings,
 			MaxIdleConnsPerHost: scanner.config.MaxRedirects,
+			MaxResponseSize:     int64(zgrab2.MaxResponseSize(ctx)),
 		},
 		client:         http.MakeNewClient(),
 		globalDeadline: time.Now().Add(scanner.config.Timeout),
@@ -368,7 +711,11 @@ func (scanner *Scanner) newHTTPScan(t *zgrab2.ScanTarget, useHTTPS bool) *scan {
 	ret.client.UserAgent = scanner.config.UserAgent
 	ret.client.CheckRedirect = ret.getCheckRedirect()
 	ret.client.Transport = ret.transport
-	ret.client.Jar = nil // Don't send or receive cookies (otherwise use CookieJar)
+	ret.client.Jar = nil // Don't send or receive cookies unless asked to
+	if scanner.config.UseCookieJar {
+		// cookiejar.New only fails on invalid options.
+		ret.client.Jar, _ = cookiejar.New(nil)
+	}
 	ret.client.Timeout = scanner.config.Timeout
 	host := t.Domain
 	if host == "" {
@@ -381,13 +728,273 @@ func (scanner *Scanner) newHTTPScan(t *zgrab2.ScanTarget, useHTTPS bool) *scan {
 	} else {
 		port = uint16(scanner.config.BaseFlags.Port)
 	}
-	ret.url = getHTTPURL(useHTTPS, host, port, scanner.config.Endpoint)
+	endpoint := scanner.config.Endpoint
+	if options := t.GetOptions(); options.Endpoint != "" {
+		endpoint = options.Endpoint
+	}
+	ret.url = getHTTPURL(useHTTPS, host, port, endpoint)
 
 	return &ret
 }
 
+// challenged returns true if resp asks for credentials, for the origin server
+// or for a proxy.
+func challenged(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusProxyAuthRequired
+}
+
+// authenticate answers the authentication challenges in resp (the response to
+// request) with the configured credentials, trying each candidate for the host
+// in turn, and returns the final response.
+func (scan *scan) authenticate(request *http.Request, resp *http.Response) (*http.Response, error) {
+	scan.recordMechanisms(resp)
+	if !challenged(resp) {
+		scan.scanner.auth.Observe(resp)
+		return resp, nil
+	}
+	results := &AuthResults{Offered: httpauth.Challenges(resp), StatusCode: resp.StatusCode}
+	scan.results.Auth = results
+	var last *httpauth.Attempt
+	for i := 0; i < scan.scanner.config.MaxAuthTries && challenged(resp); i++ {
+		// The challenge comes from the last request sent, which differs
+		// from request if redirects were followed: the credentials are for
+		// that resource, and the retry is sent there.
+		if resp.Request != nil && resp.Request.URL != nil {
+			request = resp.Request
+		}
+		if !scan.toTarget(request) {
+			// The credentials named in the input for the target are not
+			// sent to the hosts it redirects to.
+			request = httpauth.WithCredentialsName(request, "")
+		}
+		attempt := scan.scanner.auth.TryGetAuth(request, scan.authIP(request), resp, last)
+		if attempt == nil || (attempt.SameConn && resp.Close) {
+			break
+		}
+		last = attempt
+		// Read the whole body, so that the transport can reuse the
+		// connection for the next request.
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, int64(scan.scanner.config.MaxSize)*1024))
+		resp.Body.Close()
+
+		next, err := http.NewRequest(request.Method, request.URL.String(), nil)
+		if err != nil {
+			return resp, err
+		}
+		next.Host = request.Host
+		next = next.WithContext(request.Context())
+		for k, v := range request.Header {
+			if k == "Cookie" && scan.client.Jar != nil {
+				// The client adds the jar's cookies itself.
+				continue
+			}
+			next.Header[k] = v
+		}
+		// Refresh the credentials already accepted (e.g. by a proxy)
+		// before adding the new ones.
+		scan.scanner.auth.Authorize(next)
+		next.Header.Set(attempt.Header, attempt.Authorization)
+		request = next
+		results.Attempted = true
+		if resp, err = scan.client.Do(request); err != nil {
+			return resp, err
+		}
+		results.StatusCode = resp.StatusCode
+		results.Attempts = append(results.Attempts, AuthAttempt{
+			Scheme:     attempt.Scheme,
+			Realm:      attempt.Realm,
+			Algorithm:  attempt.Algorithm,
+			Proxy:      attempt.Header == "Proxy-Authorization",
+			Username:   attempt.Credential.Username,
+			StatusCode: resp.StatusCode,
+		})
+		scan.recordMechanisms(resp)
+	}
+	if last != nil && !challenged(resp) {
+		scan.results.Credential = last.Credential
+		results.Success = true
+	}
+	scan.scanner.auth.Observe(resp)
+	return resp, nil
+}
+
+// authIP returns the IP address of the target if req is sent to the target,
+// so that the credentials for its address are candidates. After a redirect to
+// another host or port, it returns nil: only the credentials for that host's
+// name are used.
+func (scan *scan) authIP(req *http.Request) net.IP {
+	if !scan.toTarget(req) {
+		return nil
+	}
+	return scan.target.IP
+}
+
+// toTarget returns true if req is sent to the target, by its IP address or
+// its domain, on the port scanned.
+func (scan *scan) toTarget(req *http.Request) bool {
+	u, err := url.Parse(scan.url)
+	if err != nil || urlPort(req.URL) != urlPort(u) {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(req.URL.Hostname()), ".")
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.Equal(scan.target.IP)
+	}
+	return host != "" && host == strings.TrimSuffix(strings.ToLower(scan.target.Domain), ".")
+}
+
+// urlPort returns the port of u, or the default port of its scheme.
+func urlPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	return strconv.Itoa(int(protoToPort[strings.ToLower(u.Scheme)]))
+}
+
+// recordCookies sets the CookieJar of res to the cookies of the jar, if any,
+// for the URL res answered.
+func (scan *scan) recordCookies(res *http.Response) {
+	if scan.client.Jar == nil || res.Request == nil || res.Request.URL == nil {
+		return
+	}
+	res.CookieJar = scan.client.Jar.Cookies(res.Request.URL)
+}
+
+// fetch sends a GET request for u, besides the scan's own request, and returns
+// the response and up to MaxSize KB of its body. Redirects are followed, up to
+// MaxRedirects, but not recorded in the redirect chain.
+func (scan *scan) fetch(u string) (*http.Response, []byte, error) {
+	client := *scan.client
+	client.CheckRedirect = func(req *http.Request, res *http.Response, via []*http.Request) error {
+		if !scan.scanner.config.FollowLocalhostRedirects && redirectsToLocalhost(req.URL.Hostname()) {
+			return ErrRedirLocalhost
+		}
+		if len(via) > scan.scanner.config.MaxRedirects {
+			return ErrTooManyRedirects
+		}
+		return nil
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "*/*")
+	res, err := client.Do(req)
+	if err != nil {
+		if urlError, ok := err.(*url.Error); ok {
+			err = urlError.Err
+		}
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	buf := new(bytes.Buffer)
+	res.ReadBody(buf, int64(scan.scanner.config.MaxSize)*1024)
+	return res, buf.Bytes(), nil
+}
+
+// recordHops fills the Hops of the results from the redirects and the final
+// response. The hop of the final response only gives its URL and status code.
+func (scan *scan) recordHops() {
+	resp := scan.results.Response
+	for _, res := range scan.redirects {
+		if res != resp {
+			scan.results.Hops = append(scan.results.Hops, newHop(res))
+		}
+	}
+	if resp != nil {
+		hop := &Hop{StatusCode: resp.StatusCode}
+		if resp.Request != nil {
+			hop.URL = resp.Request.URL.String()
+		}
+		scan.results.Hops = append(scan.results.Hops, hop)
+	}
+}
+
+// newHop returns the Hop describing res.
+func newHop(res *http.Response) *Hop {
+	hop := &Hop{StatusCode: res.StatusCode}
+	if res.Header != nil {
+		// Header.MarshalJSON rewrites the map, so it cannot be shared
+		// with the response.
+		hop.Headers = make(http.Header, len(res.Header))
+		for k, v := range res.Header {
+			hop.Headers[k] = append([]string(nil), v...)
+		}
+	}
+	if res.Request != nil {
+		hop.URL = res.Request.URL.String()
+		hop.TLSLog = res.Request.TLSLog
+	}
+	return hop
+}
+
+// maxTechnologyRequests bounds the number of requests sent for the
+// technologies detected.
+const maxTechnologyRequests = 8
+
+// technologyResponse returns the parts of res matched by technology rules.
+func technologyResponse(res *http.Response, body string) *technology.Response {
+	ret := &technology.Response{
+		Headers: make(map[string][]string, len(res.Header)),
+		Cookies: make(map[string]string),
+		Body:    body,
+	}
+	for k, v := range res.Header {
+		ret.Headers[k] = v
+	}
+	for _, c := range res.Cookies() {
+		ret.Cookies[c.Name] = c.Value
+	}
+	return ret
+}
+
+// detectTechnologies matches the technology rules against the final response,
+// then sends the requests of the detected technologies and matches their
+// responses in turn.
+func (scan *scan) detectTechnologies() {
+	resp := scan.results.Response
+	rules := scan.scanner.technologies
+	matches := rules.Match(technologyResponse(resp, resp.BodyText))
+	if resp.Request != nil && resp.Request.URL != nil {
+		requests := rules.Requests(matches)
+		if len(requests) > maxTechnologyRequests {
+			requests = requests[:maxTechnologyRequests]
+		}
+		for _, path := range requests {
+			u, err := resp.Request.URL.Parse(path)
+			if err != nil {
+				continue
+			}
+			res, body, err := scan.fetch(u.String())
+			if err != nil {
+				log.Debugf("http: technology request %s: %v", u, err)
+				continue
+			}
+			scan.results.TechnologyRequests = append(scan.results.TechnologyRequests, newHop(res))
+			matches = technology.Merge(matches, rules.Match(technologyResponse(res, string(body))))
+		}
+	}
+	scan.results.Technologies = matches
+}
+
+// recordMechanisms adds any Negotiate mechanisms named in resp to the results.
+func (scan *scan) recordMechanisms(resp *http.Response) {
+	for _, mech := range httpauth.NegotiateMechanisms(resp) {
+		found := false
+		for _, m := range scan.results.NegotiateMechanisms {
+			found = found || m == mech
+		}
+		if !found {
+			scan.results.NegotiateMechanisms = append(scan.results.NegotiateMechanisms, mech)
+		}
+	}
+}
+
 // Grab performs the HTTP scan -- implementation taken from zgrab/zlib/grabber.go
 func (scan *scan) Grab() *zgrab2.ScanError {
+	if scan.scanner.rawTemplate != nil {
+		return scan.grabRaw()
+	}
 	// TODO: Allow body?
 	request, err := http.NewRequest(scan.scanner.config.Method, scan.url, nil)
 	if err != nil {
@@ -395,11 +1002,28 @@ func (scan *scan) Grab() *zgrab2.ScanError {
 	}
 	// TODO: Headers from input?
 	request.Header.Set("Accept", "*/*")
+	options := scan.target.GetOptions()
+	if options.Host != "" {
+		request.Host = options.Host
+	}
+	if options.Credentials != "" {
+		request = httpauth.WithCredentialsName(request, options.Credentials)
+	}
+	if scan.scanner.auth != nil {
+		scan.scanner.auth.Authorize(request)
+	}
 	resp, err := scan.client.Do(request)
+	if err == nil && scan.scanner.auth != nil {
+		resp, err = scan.authenticate(request, resp)
+	}
 	if resp != nil && resp.Body != nil {
 		defer resp.Body.Close()
 	}
 	scan.results.Response = resp
+	if resp != nil {
+		scan.recordCookies(resp)
+	}
+	scan.recordHops()
 	if err != nil {
 		if urlError, ok := err.(*url.Error); ok {
 			err = urlError.Err
@@ -418,18 +1042,21 @@ func (scan *scan) Grab() *zgrab2.ScanError {
 			return zgrab2.DetectScanError(err)
 		}
 	}
+	if scan.stopped {
+		// A rule matched a redirect, whose body was already read.
+		return scan.ruleError()
+	}
 
 	buf := new(bytes.Buffer)
-	maxReadLen := int64(scan.scanner.config.MaxSize) * 1024
-	readLen := maxReadLen
-	if resp.ContentLength >= 0 && resp.ContentLength < maxReadLen {
-		readLen = resp.ContentLength
-	}
-	// EOF ignored here because that's the way it was, CopyN goes up to readLen bytes
-	bytesRead, _ := io.CopyN(buf, resp.Body, readLen)
+	// Errors ignored here because that's the way it was, ReadBody goes up to
+	// MaxSize KB, and marks the response as truncated if there is more.
+	bytesRead, _ := resp.ReadBody(buf, int64(scan.scanner.config.MaxSize)*1024)
 	if scan.scanner.config.WithBodyLength {
 		scan.results.Response.BodyTextLength = bytesRead
 	}
+	if resp.ContentEncoding != "" {
+		scan.results.Response.DecompressedLength = bytesRead
+	}
 	bufAsString := buf.String()
 
 	// do best effort attempt to determine the response's encoding
@@ -456,28 +1083,71 @@ func (scan *scan) Grab() *zgrab2.ScanError {
 		}
 	}
 
-	return nil
+	if scan.scanner.rules != nil && scan.applyRules(resp) {
+		return scan.ruleError()
+	}
+
+	if scan.scanner.config.ExtractHTML && resp.Request != nil {
+		scan.results.HTML = extractHTMLMetadata(resp.Request.URL, scan.results.Response.BodyText)
+		if scan.results.HTML == nil || scan.results.HTML.Charset == "" {
+			if charset := contentTypeCharset(resp.Header.Get("Content-Type")); charset != "" {
+				if scan.results.HTML == nil {
+					scan.results.HTML = new(HTMLMetadata)
+				}
+				scan.results.HTML.Charset = charset
+			}
+		}
+	}
+
+	if scan.scanner.config.SecurityHeaders {
+		scan.results.SecurityHeaders = analyzeSecurityHeaders(resp.Header)
+	}
+
+	if scan.scanner.config.FetchFavicon {
+		scan.fetchFavicon()
+	}
+
+	if scan.scanner.technologies != nil {
+		scan.detectTechnologies()
+	}
+
+	if scan.scanner.config.WebSocket {
+		scan.probeWebSocket()
+	}
+
+	return scan.ruleError()
 }
 
 // Scan implements the zgrab2.Scanner interface and performs the full scan of
 // the target. If the scanner is configured to follow redirects, this may entail
-// multiple TCP connections to hosts other than target.
-func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	scan := scanner.newHTTPScan(&t, scanner.config.UseHTTPS)
+// multiple TCP connections to hosts other than target. The virtual hosts of the
+// target, if any, are then scanned in turn, and their results added to the
+// target's.
+func (scanner *Scanner) Scan(ctx context.Context, t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	status, results, err := scanner.scanTarget(ctx, t)
+	if vhosts := scanner.vhostsFor(&t); len(vhosts) > 0 {
+		results.VHosts = scanner.scanVHosts(ctx, t, vhosts)
+	}
+	return status, results, err
+}
+
+// scanTarget performs the scan of t, retrying with HTTPS if so configured.
+func (scanner *Scanner) scanTarget(ctx context.Context, t zgrab2.ScanTarget) (zgrab2.ScanStatus, *Results, error) {
+	scan := scanner.newHTTPScan(ctx, &t, scanner.config.UseHTTPS)
 	defer scan.Cleanup()
 	err := scan.Grab()
 	if err != nil {
 		if scanner.config.RetryHTTPS && !scanner.config.UseHTTPS {
 			scan.Cleanup()
-			retry := scanner.newHTTPScan(&t, true)
+			retry := scanner.newHTTPScan(ctx, &t, true)
 			defer retry.Cleanup()
 			retryError := retry.Grab()
 			if retryError != nil {
-				return retryError.Unpack(&retry.results)
+				return retryError.Status, &retry.results, retryError.Err
 			}
 			return zgrab2.SCAN_SUCCESS, &retry.results, nil
 		}
-		return err.Unpack(&scan.results)
+		return err.Status, &scan.results, err.Err
 	}
 	return zgrab2.SCAN_SUCCESS, &scan.results, nil
 }
@@ -0,0 +1,38 @@
+package http
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/zmap/zgrab2/lib/http"
+)
+
+func TestRecordHops(t *testing.T) {
+	response := func(rawURL string, status int) *http.Response {
+		u, _ := url.Parse(rawURL)
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Server": []string{"test"}},
+			Request:    &http.Request{URL: u},
+		}
+	}
+	redirect := response("http://example.com/", 301)
+	final := response("https://example.com/", 200)
+	// A redirect that is not followed is both in the redirects and the
+	// final response.
+	for _, redirects := range [][]*http.Response{{redirect}, {redirect, final}} {
+		scan := &scan{redirects: redirects}
+		scan.results.Response = final
+		scan.recordHops()
+		hops := scan.results.Hops
+		if len(hops) != 2 {
+			t.Fatalf("%d hops; expected 2", len(hops))
+		}
+		if hops[0].URL != "http://example.com/" || hops[0].StatusCode != 301 || hops[0].Headers.Get("Server") != "test" {
+			t.Errorf("unexpected redirect hop %+v", hops[0])
+		}
+		if hops[1].URL != "https://example.com/" || hops[1].StatusCode != 200 || hops[1].Headers != nil {
+			t.Errorf("unexpected final hop %+v", hops[1])
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/zmap/zgrab2/lib/http"
+)
+
+// SecurityHeaders is the analysis of the security-relevant headers of the
+// final response, with --security-headers.
+type SecurityHeaders struct {
+	// HSTS is the Strict-Transport-Security policy. Browsers ignore it
+	// when it is not sent over HTTPS.
+	HSTS *HSTS `json:"hsts,omitempty"`
+
+	// CSP and CSPReportOnly are the Content-Security-Policy and
+	// Content-Security-Policy-Report-Only policies.
+	CSP           *CSP `json:"csp,omitempty"`
+	CSPReportOnly *CSP `json:"csp_report_only,omitempty"`
+
+	XFrameOptions       string `json:"x_frame_options,omitempty"`
+	XContentTypeOptions string `json:"x_content_type_options,omitempty"`
+	XXSSProtection      string `json:"x_xss_protection,omitempty"`
+	ReferrerPolicy      string `json:"referrer_policy,omitempty"`
+	PermissionsPolicy   string `json:"permissions_policy,omitempty"`
+
+	CrossOriginOpenerPolicy   string `json:"cross_origin_opener_policy,omitempty"`
+	CrossOriginEmbedderPolicy string `json:"cross_origin_embedder_policy,omitempty"`
+	CrossOriginResourcePolicy string `json:"cross_origin_resource_policy,omitempty"`
+
+	AccessControlAllowOrigin      string `json:"access_control_allow_origin,omitempty"`
+	AccessControlAllowCredentials bool   `json:"access_control_allow_credentials,omitempty"`
+}
+
+// HSTS is a Strict-Transport-Security policy (RFC 6797).
+type HSTS struct {
+	Raw string `json:"raw"`
+
+	// Valid is false if the header has no max-age, or repeats a directive.
+	Valid bool `json:"valid"`
+
+	MaxAge            int64 `json:"max_age"`
+	IncludeSubDomains bool  `json:"include_subdomains,omitempty"`
+	Preload           bool  `json:"preload,omitempty"`
+}
+
+// CSP is a Content Security Policy.
+type CSP struct {
+	Raw string `json:"raw"`
+
+	// Directives lists the names of the directives of the policy.
+	Directives []string `json:"directives,omitempty"`
+
+	// UnsafeInline and UnsafeEval are true if a source list of the policy
+	// allows 'unsafe-inline' or 'unsafe-eval'.
+	UnsafeInline bool `json:"unsafe_inline,omitempty"`
+	UnsafeEval   bool `json:"unsafe_eval,omitempty"`
+}
+
+// parseHSTS parses a Strict-Transport-Security header.
+func parseHSTS(value string) *HSTS {
+	ret := &HSTS{Raw: value, Valid: true}
+	seen := make(map[string]bool)
+	hasMaxAge := false
+	for _, directive := range strings.Split(value, ";") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" {
+			continue
+		}
+		name, arg := directive, ""
+		if i := strings.IndexByte(directive, '='); i >= 0 {
+			name, arg = strings.TrimSpace(directive[:i]), strings.Trim(strings.TrimSpace(directive[i+1:]), `"`)
+		}
+		name = strings.ToLower(name)
+		if seen[name] {
+			ret.Valid = false
+		}
+		seen[name] = true
+		switch name {
+		case "max-age":
+			maxAge, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil || maxAge < 0 {
+				ret.Valid = false
+				continue
+			}
+			ret.MaxAge = maxAge
+			hasMaxAge = true
+		case "includesubdomains":
+			ret.IncludeSubDomains = true
+		case "preload":
+			ret.Preload = true
+		}
+	}
+	ret.Valid = ret.Valid && hasMaxAge
+	return ret
+}
+
+// parseCSP parses a Content-Security-Policy header.
+func parseCSP(value string) *CSP {
+	ret := &CSP{Raw: value}
+	for _, directive := range strings.Split(value, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) == 0 {
+			continue
+		}
+		ret.Directives = append(ret.Directives, strings.ToLower(fields[0]))
+		for _, source := range fields[1:] {
+			switch strings.ToLower(source) {
+			case "'unsafe-inline'":
+				ret.UnsafeInline = true
+			case "'unsafe-eval'":
+				ret.UnsafeEval = true
+			}
+		}
+	}
+	return ret
+}
+
+// analyzeSecurityHeaders returns the analysis of the security headers in h, or
+// nil if there are none.
+func analyzeSecurityHeaders(h http.Header) *SecurityHeaders {
+	ret := &SecurityHeaders{
+		XFrameOptions:             h.Get("X-Frame-Options"),
+		XContentTypeOptions:       h.Get("X-Content-Type-Options"),
+		XXSSProtection:            h.Get("X-XSS-Protection"),
+		ReferrerPolicy:            h.Get("Referrer-Policy"),
+		PermissionsPolicy:         h.Get("Permissions-Policy"),
+		CrossOriginOpenerPolicy:   h.Get("Cross-Origin-Opener-Policy"),
+		CrossOriginEmbedderPolicy: h.Get("Cross-Origin-Embedder-Policy"),
+		CrossOriginResourcePolicy: h.Get("Cross-Origin-Resource-Policy"),
+		AccessControlAllowOrigin:  h.Get("Access-Control-Allow-Origin"),
+
+		AccessControlAllowCredentials: strings.EqualFold(h.Get("Access-Control-Allow-Credentials"), "true"),
+	}
+	if ret.PermissionsPolicy == "" {
+		ret.PermissionsPolicy = h.Get("Feature-Policy")
+	}
+	// Only the first Strict-Transport-Security header is processed.
+	if v := h.Get("Strict-Transport-Security"); v != "" {
+		ret.HSTS = parseHSTS(v)
+	}
+	// Multiple policies are all enforced; they are combined here.
+	if v := h["Content-Security-Policy"]; len(v) > 0 {
+		ret.CSP = parseCSP(strings.Join(v, "; "))
+	}
+	if v := h["Content-Security-Policy-Report-Only"]; len(v) > 0 {
+		ret.CSPReportOnly = parseCSP(strings.Join(v, "; "))
+	}
+	if *ret == (SecurityHeaders{}) {
+		return nil
+	}
+	return ret
+}
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/lib/http"
+)
+
+func TestParseHSTS(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected HSTS
+	}{
+		{
+			value:    "max-age=31536000; includeSubDomains; preload",
+			expected: HSTS{Valid: true, MaxAge: 31536000, IncludeSubDomains: true, Preload: true},
+		},
+		{
+			value:    `Max-Age="600"`,
+			expected: HSTS{Valid: true, MaxAge: 600},
+		},
+		{
+			value:    "includeSubDomains",
+			expected: HSTS{IncludeSubDomains: true},
+		},
+		{
+			value:    "max-age=0; max-age=600",
+			expected: HSTS{MaxAge: 600},
+		},
+		{
+			value:    "max-age=forever",
+			expected: HSTS{},
+		},
+	}
+	for _, test := range tests {
+		test.expected.Raw = test.value
+		if got := parseHSTS(test.value); *got != test.expected {
+			t.Errorf("parseHSTS(%q) = %+v; expected %+v", test.value, *got, test.expected)
+		}
+	}
+}
+
+func TestParseCSP(t *testing.T) {
+	value := "default-src 'self'; Script-Src 'self' 'UNSAFE-INLINE' cdn.example.com;; upgrade-insecure-requests"
+	expected := &CSP{
+		Raw:          value,
+		Directives:   []string{"default-src", "script-src", "upgrade-insecure-requests"},
+		UnsafeInline: true,
+	}
+	if got := parseCSP(value); !reflect.DeepEqual(got, expected) {
+		t.Errorf("parseCSP(%q) = %+v; expected %+v", value, got, expected)
+	}
+}
+
+func TestAnalyzeSecurityHeaders(t *testing.T) {
+	if got := analyzeSecurityHeaders(http.Header{"Server": {"nginx"}}); got != nil {
+		t.Errorf("analyzeSecurityHeaders without security headers = %+v", got)
+	}
+	got := analyzeSecurityHeaders(http.Header{
+		"Strict-Transport-Security":        {"max-age=300"},
+		"Content-Security-Policy":          {"default-src 'self'", "script-src 'unsafe-eval'"},
+		"X-Frame-Options":                  {"DENY"},
+		"Feature-Policy":                   {"camera 'none'"},
+		"Access-Control-Allow-Origin":      {"*"},
+		"Access-Control-Allow-Credentials": {"TRUE"},
+	})
+	if got == nil {
+		t.Fatal("analyzeSecurityHeaders returned nil")
+	}
+	if got.HSTS == nil || got.HSTS.MaxAge != 300 || !got.HSTS.Valid {
+		t.Errorf("HSTS = %+v", got.HSTS)
+	}
+	if got.CSP == nil || !reflect.DeepEqual(got.CSP.Directives, []string{"default-src", "script-src"}) || !got.CSP.UnsafeEval {
+		t.Errorf("CSP = %+v", got.CSP)
+	}
+	if got.XFrameOptions != "DENY" || got.PermissionsPolicy != "camera 'none'" || got.AccessControlAllowOrigin != "*" || !got.AccessControlAllowCredentials {
+		t.Errorf("analyzeSecurityHeaders = %+v", got)
+	}
+}
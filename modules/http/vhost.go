@@ -0,0 +1,81 @@
+package http
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+
+	"github.com/zmap/zgrab2"
+)
+
+// VHostResult is the result of the scan of one virtual host of a target.
+type VHostResult struct {
+	// Host is the virtual host, sent as the Host header and TLS SNI.
+	Host string `json:"host"`
+
+	Status zgrab2.ScanStatus `json:"status"`
+	Error  string            `json:"error,omitempty"`
+	Result *Results          `json:"result,omitempty"`
+}
+
+// readVHosts reads the hostnames of the file at path, one per line. Empty
+// lines and lines starting with # are ignored.
+func readVHosts(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ret = append(ret, line)
+	}
+	return ret, nil
+}
+
+// vhostsFor returns the virtual hosts to scan on t: those of the input, then
+// those of --vhost-file, without duplicates or t's own domain. Virtual hosts
+// are only scanned on targets with an IP.
+func (scanner *Scanner) vhostsFor(t *zgrab2.ScanTarget) []string {
+	if t.IP == nil {
+		return nil
+	}
+	var ret []string
+	seen := map[string]bool{strings.ToLower(t.Domain): true}
+	for _, lists := range [][]string{t.VHosts, scanner.vhosts} {
+		for _, vhost := range lists {
+			if key := strings.ToLower(vhost); !seen[key] {
+				seen[key] = true
+				ret = append(ret, vhost)
+			}
+		}
+	}
+	return ret
+}
+
+// scanVHosts scans each of vhosts on the IP of t in turn, as if it were the
+// domain of the target.
+func (scanner *Scanner) scanVHosts(ctx context.Context, t zgrab2.ScanTarget, vhosts []string) []*VHostResult {
+	ret := make([]*VHostResult, 0, len(vhosts))
+	for _, vhost := range vhosts {
+		target := t
+		target.Domain = vhost
+		target.VHosts = nil
+		if t.Options != nil {
+			// The Host header and server name are those of the vhost.
+			options := *t.Options
+			options.Host, options.SNI = "", ""
+			target.Options = &options
+		}
+		status, results, err := scanner.scanTarget(ctx, target)
+		vr := &VHostResult{Host: vhost, Status: status, Result: results}
+		if err != nil {
+			vr.Error = err.Error()
+		}
+		ret = append(ret, vr)
+	}
+	return ret
+}
@@ -0,0 +1,186 @@
+package http
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/zmap/zgrab2/lib/http"
+)
+
+// websocketGUID is appended to the key of a WebSocket handshake to compute the
+// accept value (RFC 6455 section 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWebSocketPayload bounds the payload recorded from the first frame.
+const maxWebSocketPayload = 4096
+
+// WebSocket describes the result of a WebSocket handshake, with --websocket.
+type WebSocket struct {
+	// URL is the URL of the handshake request.
+	URL string `json:"url"`
+
+	StatusCode int         `json:"status_code,omitempty"`
+	Headers    http.Header `json:"headers,omitempty"`
+
+	// Upgraded is true if the server answered with 101 Switching
+	// Protocols.
+	Upgraded bool `json:"upgraded"`
+
+	// AcceptValid is true if the Sec-WebSocket-Accept header matches the
+	// key sent.
+	AcceptValid bool `json:"accept_valid,omitempty"`
+
+	// Subprotocol and Extensions are the ones the server selected.
+	Subprotocol string `json:"subprotocol,omitempty"`
+	Extensions  string `json:"extensions,omitempty"`
+
+	// FirstFrame is the first frame sent by the server after the
+	// handshake, if any arrived within --websocket-read-timeout.
+	FirstFrame *WebSocketFrame `json:"first_frame,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// WebSocketFrame is a WebSocket frame.
+type WebSocketFrame struct {
+	Fin    bool  `json:"fin"`
+	Opcode uint8 `json:"opcode"`
+
+	// Length is the length of the payload, of which at most 4 KB is
+	// recorded in Payload.
+	Length  uint64 `json:"length"`
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// websocketAccept returns the Sec-WebSocket-Accept value for key.
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// readWebSocketFrame reads the header of a frame and up to max bytes of its
+// payload.
+func readWebSocketFrame(r io.Reader, max int) (*WebSocketFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	frame := &WebSocketFrame{Fin: header[0]&0x80 != 0, Opcode: header[0] & 0x0f}
+	frame.Length = uint64(header[1] & 0x7f)
+	switch frame.Length {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, err
+		}
+		frame.Length = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, err
+		}
+		frame.Length = binary.BigEndian.Uint64(b[:])
+	}
+	var mask [4]byte
+	masked := header[1]&0x80 != 0
+	if masked {
+		// Servers must not mask their frames, but some do.
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return nil, err
+		}
+	}
+	n := frame.Length
+	if n > uint64(max) {
+		n = uint64(max)
+	}
+	frame.Payload = make([]byte, n)
+	read, err := io.ReadFull(r, frame.Payload)
+	frame.Payload = frame.Payload[:read]
+	if masked {
+		for i := range frame.Payload {
+			frame.Payload[i] ^= mask[i%4]
+		}
+	}
+	if err != nil && read == 0 {
+		return frame, err
+	}
+	return frame, nil
+}
+
+// probeWebSocket sends a WebSocket handshake on a new connection to the
+// target, and reads the first frame from the server if it upgrades.
+func (scan *scan) probeWebSocket() {
+	cfg := scan.scanner.config
+	host, _, port := scan.hostPort()
+	scheme := "ws"
+	if strings.HasPrefix(scan.url, "https://") {
+		scheme = "wss"
+	}
+	authority := host
+	if (scheme == "ws" && port != "80") || (scheme == "wss" && port != "443") {
+		authority = net.JoinHostPort(host, port)
+	}
+	ws := &WebSocket{URL: scheme + "://" + authority + cfg.WebSocketPath}
+	scan.results.WebSocket = ws
+
+	conn, _, err := scan.dialTarget()
+	if err != nil {
+		ws.Error = err.Error()
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(scan.globalDeadline)
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	var req strings.Builder
+	fmt.Fprintf(&req, "GET %s HTTP/1.1\r\n", cfg.WebSocketPath)
+	fmt.Fprintf(&req, "Host: %s\r\n", authority)
+	fmt.Fprintf(&req, "User-Agent: %s\r\n", cfg.UserAgent)
+	req.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+	fmt.Fprintf(&req, "Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n", key)
+	if cfg.WebSocketProtocols != "" {
+		fmt.Fprintf(&req, "Sec-WebSocket-Protocol: %s\r\n", cfg.WebSocketProtocols)
+	}
+	req.WriteString("\r\n")
+	if _, err := io.WriteString(conn, req.String()); err != nil {
+		ws.Error = err.Error()
+		return
+	}
+
+	reader := bufio.NewReader(io.LimitReader(conn, int64(cfg.MaxSize)*1024))
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		ws.Error = err.Error()
+		return
+	}
+	ws.StatusCode = resp.StatusCode
+	ws.Headers = resp.Header
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return
+	}
+	ws.Upgraded = true
+	ws.AcceptValid = resp.Header.Get("Sec-WebSocket-Accept") == websocketAccept(key)
+	ws.Subprotocol = resp.Header.Get("Sec-WebSocket-Protocol")
+	ws.Extensions = resp.Header.Get("Sec-WebSocket-Extensions")
+
+	deadline := time.Now().Add(cfg.WebSocketReadTimeout)
+	if deadline.After(scan.globalDeadline) {
+		deadline = scan.globalDeadline
+	}
+	conn.SetReadDeadline(deadline)
+	if frame, err := readWebSocketFrame(reader, maxWebSocketPayload); err == nil {
+		ws.FirstFrame = frame
+	} else if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		ws.Error = err.Error()
+	}
+}
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWebSocketAccept(t *testing.T) {
+	// RFC 6455 section 1.3.
+	if accept := websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("websocketAccept = %s", accept)
+	}
+}
+
+func TestReadWebSocketFrame(t *testing.T) {
+	// Examples of RFC 6455 section 5.7.
+	tests := []struct {
+		name     string
+		data     []byte
+		expected WebSocketFrame
+	}{
+		{"unmasked", []byte{0x81, 0x05, 0x48, 0x65, 0x6c, 0x6c, 0x6f}, WebSocketFrame{Fin: true, Opcode: 1, Length: 5, Payload: []byte("Hello")}},
+		{"masked", []byte{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58}, WebSocketFrame{Fin: true, Opcode: 1, Length: 5, Payload: []byte("Hello")}},
+		{"fragment", []byte{0x01, 0x03, 0x48, 0x65, 0x6c}, WebSocketFrame{Opcode: 1, Length: 3, Payload: []byte("Hel")}},
+		{"256 bytes", append([]byte{0x82, 0x7e, 0x01, 0x00}, make([]byte, 256)...), WebSocketFrame{Fin: true, Opcode: 2, Length: 256, Payload: make([]byte, 16)}},
+		{"64 KiB", append([]byte{0x82, 0x7f, 0, 0, 0, 0, 0, 1, 0, 0}, make([]byte, 16)...), WebSocketFrame{Fin: true, Opcode: 2, Length: 65536, Payload: make([]byte, 16)}},
+	}
+	for _, test := range tests {
+		frame, err := readWebSocketFrame(bytes.NewReader(test.data), 16)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if frame.Fin != test.expected.Fin || frame.Opcode != test.expected.Opcode || frame.Length != test.expected.Length || !bytes.Equal(frame.Payload, test.expected.Payload) {
+			t.Errorf("%s: got %+v; expected %+v", test.name, frame, test.expected)
+		}
+	}
+	if _, err := readWebSocketFrame(bytes.NewReader([]byte{0x81}), 16); err == nil {
+		t.Errorf("readWebSocketFrame accepted a truncated header")
+	}
+}
@@ -0,0 +1,7 @@
+package modules
+
+import "github.com/zmap/zgrab2/modules/http3"
+
+func init() {
+	http3.RegisterModule()
+}
@@ -0,0 +1,777 @@
+package http3
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/zmap/zgrab2/lib/http"
+	"golang.org/x/net/http2/hpack"
+)
+
+// maxDatagramSize is the largest UDP payload the client accepts.
+const maxDatagramSize = 1452
+
+// minInitialSize is the size to which datagrams holding Initial packets
+// are padded (RFC 9000 section 14.1).
+const minInitialSize = 1200
+
+// Encryption levels.
+const (
+	levelInitial = iota
+	levelHandshake
+	levelApp
+)
+
+// Streams used by the client: the request stream, and the control stream.
+const (
+	requestStream = 0
+	controlStream = 2
+)
+
+var (
+	errVersionNegotiation = errors.New("server does not support QUIC version 1")
+	errConnectionClosed   = errors.New("server closed the connection")
+	errUnknownFrame       = errors.New("unknown frame type")
+)
+
+// level holds the state of an encryption level.
+type level struct {
+	client, server *keys
+
+	// nextPN is the number of the next packet sent.
+	nextPN uint64
+
+	// received holds the numbers of the ack-eliciting packets received
+	// since the last acknowledgment, and largest the largest number
+	// received.
+	received map[uint64]bool
+	largest  int64
+
+	// crypto is the CRYPTO stream of the server.
+	crypto stream
+
+	// out holds the CRYPTO data to send next.
+	out       []byte
+	outOffset uint64
+}
+
+// stream reassembles the data of a stream.
+type stream struct {
+	data    []byte
+	read    int
+	pending map[uint64][]byte
+	fin     bool
+	size    uint64
+}
+
+// add adds the data received at the given offset.
+func (s *stream) add(offset uint64, data []byte, fin bool) {
+	if fin {
+		s.fin = true
+		s.size = offset + uint64(len(data))
+	}
+	if s.pending == nil {
+		s.pending = make(map[uint64][]byte)
+	}
+	s.pending[offset] = append([]byte(nil), data...)
+	for progress := true; progress; {
+		progress = false
+		for off, d := range s.pending {
+			end := off + uint64(len(d))
+			if off > uint64(len(s.data)) {
+				continue
+			}
+			if end > uint64(len(s.data)) {
+				s.data = append(s.data, d[uint64(len(s.data))-off:]...)
+				progress = true
+			}
+			delete(s.pending, off)
+		}
+	}
+}
+
+// complete returns true if all the data of the stream has been received.
+func (s *stream) complete() bool {
+	return s.fin && uint64(len(s.data)) == s.size
+}
+
+// conn is a client QUIC connection making a single HTTP/3 request.
+type conn struct {
+	sock    net.Conn
+	scanner *Scanner
+	results *Results
+
+	dcid, scid []byte
+	token      []byte
+
+	hs     *handshake
+	levels [3]*level
+
+	// initialDone is set once the first Handshake packet is sent, after
+	// which Initial packets are neither sent nor processed.
+	initialDone bool
+
+	// undecryptable holds packets received before their keys.
+	undecryptable [][]byte
+
+	// lastFlight holds the datagrams last sent, for retransmission.
+	lastFlight [][]byte
+
+	// response is the request stream, and uni the unidirectional streams
+	// opened by the server.
+	response  stream
+	uni       map[uint64]*stream
+	body      []byte
+	headersOK bool
+	done      bool
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func newLevel() *level {
+	return &level{received: make(map[uint64]bool), largest: -1}
+}
+
+// probeVersions sends a packet with a reserved version, to which the server
+// answers with the versions it supports (RFC 9000 section 6).
+func (c *conn) probeVersions() ([]uint32, error) {
+	header := []byte{0xc0}
+	header = appendUint32(header, 0x1a2a3a4a)
+	header = appendVector(header, 1, randomBytes(8))
+	header = appendVector(header, 1, randomBytes(8))
+	packet := append(header, make([]byte, minInitialSize-len(header))...)
+	if _, err := c.sock.Write(packet); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1<<16)
+	c.sock.SetReadDeadline(time.Now().Add(c.scanner.config.RetransmitTimeout))
+	for {
+		n, err := c.sock.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n > 5 && buf[0]&0x80 != 0 {
+			if p, _, err := parseLongPacket(buf[:n]); err == nil && p.version == 0 {
+				return p.versions, nil
+			}
+		}
+	}
+}
+
+// run performs the QUIC handshake and, unless only the handshake was
+// requested, the HTTP/3 request.
+func (c *conn) run(serverName string, alpn []string) error {
+	c.dcid = randomBytes(8)
+	c.scid = randomBytes(8)
+	for i := range c.levels {
+		c.levels[i] = newLevel()
+	}
+	if err := c.setInitialKeys(); err != nil {
+		return err
+	}
+	hs, err := newHandshake(serverName, alpn, c.scid)
+	if err != nil {
+		return err
+	}
+	c.hs = hs
+	c.uni = make(map[uint64]*stream)
+	c.levels[levelInitial].out = hs.clientHello()
+	if err := c.flush(); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 1<<16)
+	pto := c.scanner.config.RetransmitTimeout
+	retransmits := 0
+	for !c.done {
+		c.sock.SetReadDeadline(time.Now().Add(pto))
+		n, err := c.sock.Read(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() && retransmits < c.scanner.config.Retransmits {
+				retransmits++
+				pto *= 2
+				for _, d := range c.lastFlight {
+					if _, err := c.sock.Write(d); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			return err
+		}
+		if err := c.handleDatagram(append([]byte(nil), buf[:n]...)); err != nil {
+			return err
+		}
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *conn) setInitialKeys() error {
+	client, server, err := initialKeys(c.dcid)
+	if err != nil {
+		return err
+	}
+	c.levels[levelInitial].client = client
+	c.levels[levelInitial].server = server
+	return nil
+}
+
+// handleDatagram processes the (possibly coalesced) packets in a datagram.
+func (c *conn) handleDatagram(d []byte) error {
+	for len(d) > 0 {
+		if d[0]&0x80 == 0 {
+			// A short header packet takes the rest of the datagram.
+			return c.handlePacket(levelApp, d, 1+len(c.scid))
+		}
+		p, rest, err := parseLongPacket(d)
+		if err != nil {
+			return nil
+		}
+		d = rest
+		switch {
+		case p.version == 0:
+			c.results.SupportedVersions = versionNames(p.versions)
+			return errVersionNegotiation
+		case p.version != Version1:
+			continue
+		case p.typ == packetRetry:
+			// A Retry with an invalid integrity tag is discarded (RFC
+			// 9001 section 5.8).
+			if c.results.Retry || c.levels[levelInitial].largest >= 0 || !validRetry(p.raw, c.dcid) {
+				continue
+			}
+			c.results.Retry = true
+			c.dcid = append([]byte(nil), p.scid...)
+			c.token = append([]byte(nil), p.token...)
+			if err := c.setInitialKeys(); err != nil {
+				return err
+			}
+			// Send the ClientHello again, with the token.
+			l := c.levels[levelInitial]
+			l.out, l.outOffset = c.hs.hello, 0
+		case p.typ == packetInitial:
+			if c.initialDone {
+				continue
+			}
+			if err := c.handlePacket(levelInitial, p.raw, p.pnOffset); err != nil {
+				return err
+			}
+			if c.levels[levelInitial].largest >= 0 {
+				c.dcid = append([]byte(nil), p.scid...)
+			}
+		case p.typ == packetHandshake:
+			if err := c.handlePacket(levelHandshake, p.raw, p.pnOffset); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handlePacket decrypts and processes a packet.
+func (c *conn) handlePacket(lvl int, packet []byte, pnOffset int) error {
+	l := c.levels[lvl]
+	if l.server == nil {
+		if len(c.undecryptable) < 8 {
+			c.undecryptable = append(c.undecryptable, packet)
+		}
+		return nil
+	}
+	pn, payload, err := l.server.open(packet, pnOffset, l.largest)
+	if err != nil {
+		// Undecryptable packets are dropped.
+		return nil
+	}
+	if int64(pn) > l.largest {
+		l.largest = int64(pn)
+	}
+	ackEliciting, err := c.handleFrames(lvl, payload)
+	if ackEliciting {
+		l.received[pn] = true
+	}
+	return err
+}
+
+// handleFrames processes the frames in a packet payload, returning whether
+// any of them is ack-eliciting.
+func (c *conn) handleFrames(lvl int, payload []byte) (bool, error) {
+	r := &reader{b: payload}
+	ackEliciting := false
+	for len(r.b) > 0 && r.err == nil {
+		typ := r.varint()
+		if typ != 0x00 && typ != 0x02 && typ != 0x03 && typ != 0x1c && typ != 0x1d {
+			ackEliciting = true
+		}
+		switch {
+		case typ == 0x00, typ == 0x01, typ == 0x1e:
+			// PADDING, PING and HANDSHAKE_DONE.
+		case typ == 0x02 || typ == 0x03:
+			// ACK.
+			r.varint()
+			r.varint()
+			ranges := r.varint()
+			r.varint()
+			for i := uint64(0); i < ranges && r.err == nil; i++ {
+				r.varint()
+				r.varint()
+			}
+			if typ == 0x03 {
+				r.varint()
+				r.varint()
+				r.varint()
+			}
+		case typ == 0x04:
+			// RESET_STREAM.
+			id := r.varint()
+			code := r.varint()
+			r.varint()
+			if id == requestStream && r.err == nil {
+				return ackEliciting, fmt.Errorf("server reset the request stream with error 0x%x", code)
+			}
+		case typ == 0x05, typ == 0x11, typ == 0x15:
+			// STOP_SENDING, MAX_STREAM_DATA and STREAM_DATA_BLOCKED.
+			r.varint()
+			r.varint()
+		case typ == 0x06:
+			// CRYPTO.
+			offset := r.varint()
+			data := r.bytes(r.varint())
+			if r.err == nil {
+				c.levels[lvl].crypto.add(offset, data, false)
+				if err := c.handleCrypto(lvl); err != nil {
+					return ackEliciting, err
+				}
+			}
+		case typ == 0x07:
+			// NEW_TOKEN.
+			r.bytes(r.varint())
+		case typ >= 0x08 && typ <= 0x0f:
+			// STREAM.
+			id := r.varint()
+			var offset uint64
+			if typ&0x04 != 0 {
+				offset = r.varint()
+			}
+			var data []byte
+			if typ&0x02 != 0 {
+				data = r.bytes(r.varint())
+			} else {
+				data = r.bytes(uint64(len(r.b)))
+			}
+			if r.err == nil {
+				if err := c.handleStream(id, offset, data, typ&0x01 != 0); err != nil {
+					return ackEliciting, err
+				}
+			}
+		case typ == 0x10, typ == 0x12, typ == 0x13, typ == 0x14, typ == 0x16, typ == 0x17, typ == 0x19:
+			// MAX_DATA, MAX_STREAMS, DATA_BLOCKED, STREAMS_BLOCKED and
+			// RETIRE_CONNECTION_ID.
+			r.varint()
+		case typ == 0x18:
+			// NEW_CONNECTION_ID.
+			r.varint()
+			r.varint()
+			r.bytes(uint64(r.byte()))
+			r.bytes(16)
+		case typ == 0x1a, typ == 0x1b:
+			// PATH_CHALLENGE and PATH_RESPONSE.
+			r.bytes(8)
+		case typ == 0x1c || typ == 0x1d:
+			// CONNECTION_CLOSE.
+			cc := &ConnectionClose{ErrorCode: r.varint(), Application: typ == 0x1d}
+			if typ == 0x1c {
+				cc.FrameType = r.varint()
+			}
+			cc.Reason = string(r.bytes(r.varint()))
+			c.results.ConnectionClose = cc
+			return ackEliciting, errConnectionClosed
+		case typ == 0x30:
+			// DATAGRAM, to the end of the packet.
+			r.b = nil
+		case typ == 0x31:
+			r.bytes(r.varint())
+		default:
+			return ackEliciting, errUnknownFrame
+		}
+	}
+	return ackEliciting, r.err
+}
+
+// handleCrypto processes the complete handshake messages received at a
+// level.
+func (c *conn) handleCrypto(lvl int) error {
+	s := &c.levels[lvl].crypto
+	for {
+		msg, _ := readMessage(s.data[s.read:])
+		if msg == nil {
+			return nil
+		}
+		s.read += len(msg)
+		switch lvl {
+		case levelInitial:
+			if err := c.hs.serverHello(msg); err != nil {
+				return err
+			}
+			// serverHello rejects any suite but the one offered.
+			c.results.CipherSuite = "TLS_AES_128_GCM_SHA256"
+			if err := c.setKeys(levelHandshake, c.hs.clientHandshake, c.hs.serverHandshake); err != nil {
+				return err
+			}
+		case levelHandshake:
+			finished, err := c.hs.handshakeMessage(msg)
+			if err != nil {
+				return err
+			}
+			if finished == nil {
+				continue
+			}
+			c.results.HandshakeComplete = true
+			c.results.ALPN = c.hs.alpnResult
+			c.results.TransportParameters = c.hs.params
+			c.results.Certificates = c.hs.certificates
+			c.levels[levelHandshake].out = finished
+			if err := c.setKeys(levelApp, c.hs.clientApp, c.hs.serverApp); err != nil {
+				return err
+			}
+			if c.scanner.config.HandshakeOnly || c.hs.alpnResult != "h3" {
+				c.done = true
+				return nil
+			}
+			c.sendRequest()
+		}
+	}
+}
+
+// setKeys installs the keys of a level, and processes the packets that
+// arrived before them.
+func (c *conn) setKeys(lvl int, clientSecret, serverSecret []byte) error {
+	client, err := newKeys(clientSecret)
+	if err != nil {
+		return err
+	}
+	server, err := newKeys(serverSecret)
+	if err != nil {
+		return err
+	}
+	c.levels[lvl].client = client
+	c.levels[lvl].server = server
+	pending := c.undecryptable
+	c.undecryptable = nil
+	for _, packet := range pending {
+		if err := c.handleDatagram(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendRequest queues the control stream and the request.
+func (c *conn) sendRequest() {
+	cfg := c.scanner.config
+	authority := c.hs.serverName
+	if authority == "" {
+		authority = c.sock.RemoteAddr().String()
+	}
+	fields := encodeFieldSection([]hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: authority},
+		{Name: ":path", Value: cfg.Endpoint},
+		{Name: "user-agent", Value: cfg.UserAgent},
+		{Name: "accept", Value: "*/*"},
+	})
+	headers := appendVarint(nil, 0x01)
+	headers = appendVarint(headers, uint64(len(fields)))
+	headers = append(headers, fields...)
+
+	// The control stream type, then an empty SETTINGS frame.
+	control := []byte{0x00, 0x04, 0x00}
+
+	var frames []byte
+	frames = appendVarint(frames, 0x0a)
+	frames = appendVarint(frames, controlStream)
+	frames = appendVarint(frames, uint64(len(control)))
+	frames = append(frames, control...)
+	frames = appendVarint(frames, 0x0b)
+	frames = appendVarint(frames, requestStream)
+	frames = appendVarint(frames, uint64(len(headers)))
+	frames = append(frames, headers...)
+	c.levels[levelApp].out = frames
+}
+
+// handleStream processes data received on a stream.
+func (c *conn) handleStream(id, offset uint64, data []byte, fin bool) error {
+	switch {
+	case id == requestStream:
+		c.response.add(offset, data, fin)
+		return c.handleResponse()
+	case id&0x03 == 0x03:
+		// A unidirectional stream opened by the server, one of which is
+		// the control stream.
+		s := c.uni[id]
+		if s == nil {
+			if len(c.uni) >= 16 {
+				return nil
+			}
+			s = new(stream)
+			c.uni[id] = s
+		}
+		s.add(offset, data, fin)
+		c.handleControl(s)
+	}
+	return nil
+}
+
+// readFrame splits the first complete HTTP/3 frame off b, returning its
+// type and payload, or ok = false if b does not hold one yet.
+func readFrame(b []byte) (typ uint64, payload []byte, n int, ok bool) {
+	r := &reader{b: b}
+	typ = r.varint()
+	payload = r.bytes(r.varint())
+	if r.err != nil {
+		return 0, nil, 0, false
+	}
+	return typ, payload, len(b) - len(r.b), true
+}
+
+// handleControl records the SETTINGS frame of the server, if s is its
+// control stream.
+func (c *conn) handleControl(s *stream) {
+	if s.read == 0 {
+		// The stream type.
+		if len(s.data) == 0 || s.data[0] != 0x00 {
+			return
+		}
+		s.read = 1
+	}
+	for c.results.Settings == nil {
+		typ, payload, n, ok := readFrame(s.data[s.read:])
+		if !ok {
+			return
+		}
+		s.read += n
+		if typ != 0x04 {
+			continue
+		}
+		c.results.Settings = make(map[string]uint64)
+		r := &reader{b: payload}
+		for len(r.b) > 0 && r.err == nil {
+			id, v := r.varint(), r.varint()
+			if r.err == nil {
+				c.results.Settings[settingName(id)] = v
+			}
+		}
+	}
+}
+
+// settingName returns the name of an HTTP/3 setting.
+func settingName(id uint64) string {
+	switch id {
+	case 0x01:
+		return "qpack_max_table_capacity"
+	case 0x06:
+		return "max_field_section_size"
+	case 0x07:
+		return "qpack_blocked_streams"
+	case 0x08:
+		return "enable_connect_protocol"
+	case 0x33:
+		return "h3_datagram"
+	}
+	return "0x" + strconv.FormatUint(id, 16)
+}
+
+// handleResponse processes the frames received on the request stream.
+func (c *conn) handleResponse() error {
+	s := &c.response
+	maxSize := c.scanner.config.MaxSize * 1024
+	for !c.done {
+		typ, payload, n, ok := readFrame(s.data[s.read:])
+		if !ok {
+			break
+		}
+		s.read += n
+		switch typ {
+		case 0x01:
+			// HEADERS: informational responses are skipped, and
+			// trailers ignored.
+			if c.headersOK {
+				continue
+			}
+			fields, err := decodeFieldSection(payload)
+			if err != nil {
+				return err
+			}
+			resp := &Response{Headers: make(http.Header)}
+			for _, f := range fields {
+				if f.Name == ":status" {
+					resp.StatusCode, _ = strconv.Atoi(f.Value)
+				} else {
+					resp.Headers.Add(f.Name, f.Value)
+				}
+			}
+			c.results.Response = resp
+			c.headersOK = resp.StatusCode >= 200
+		case 0x00:
+			// DATA.
+			if len(c.body)+len(payload) >= maxSize {
+				payload = payload[:maxSize-len(c.body)]
+				c.done = true
+			}
+			c.body = append(c.body, payload...)
+		}
+	}
+	if c.results.Response != nil {
+		c.results.Response.Body = string(c.body)
+	}
+	if s.complete() && s.read == len(s.data) {
+		c.done = true
+	}
+	return nil
+}
+
+// flush sends the pending CRYPTO and STREAM data and acknowledgments, as
+// coalesced packets in a single datagram.
+func (c *conn) flush() error {
+	var packets [][]byte
+	var initialPayload []byte
+	hasData := false
+	for lvl, l := range c.levels {
+		if l.client == nil || (lvl == levelInitial && c.initialDone) {
+			continue
+		}
+		payload := l.ackFrame()
+		if len(l.out) > 0 {
+			hasData = true
+			if lvl == levelApp {
+				payload = append(payload, l.out...)
+			} else {
+				payload = appendVarint(payload, 0x06)
+				payload = appendVarint(payload, l.outOffset)
+				payload = appendVarint(payload, uint64(len(l.out)))
+				payload = append(payload, l.out...)
+				l.outOffset += uint64(len(l.out))
+			}
+			l.out = nil
+		}
+		if len(payload) == 0 {
+			continue
+		}
+		if lvl == levelInitial {
+			initialPayload = payload
+			continue
+		}
+		pn := l.nextPN
+		l.nextPN++
+		var header []byte
+		if lvl == levelHandshake {
+			header = longHeader(packetHandshake, Version1, c.dcid, c.scid, nil, pn, len(payload))
+			c.initialDone = true
+		} else {
+			header = shortHeader(c.dcid, pn)
+		}
+		packets = append(packets, l.client.seal(header, pn, payload))
+	}
+	if initialPayload != nil {
+		// Pad the datagram holding an Initial packet to the minimum
+		// size, in the Initial packet itself.
+		size := 0
+		for _, p := range packets {
+			size += len(p)
+		}
+		overhead := len(longHeader(packetInitial, Version1, c.dcid, c.scid, c.token, 0, 0)) + 16
+		if pad := minInitialSize - size - overhead - len(initialPayload); pad > 0 {
+			initialPayload = append(initialPayload, make([]byte, pad)...)
+		}
+		l := c.levels[levelInitial]
+		pn := l.nextPN
+		l.nextPN++
+		header := longHeader(packetInitial, Version1, c.dcid, c.scid, c.token, pn, len(initialPayload))
+		packets = append([][]byte{l.client.seal(header, pn, initialPayload)}, packets...)
+	}
+	if len(packets) == 0 {
+		return nil
+	}
+	var datagram []byte
+	for _, p := range packets {
+		datagram = append(datagram, p...)
+	}
+	if hasData {
+		c.lastFlight = [][]byte{datagram}
+	}
+	_, err := c.sock.Write(datagram)
+	return err
+}
+
+// ackFrame returns an ACK frame for the ack-eliciting packets received since
+// the last one, or nil.
+func (l *level) ackFrame() []byte {
+	if len(l.received) == 0 {
+		return nil
+	}
+	pns := make([]uint64, 0, len(l.received))
+	for pn := range l.received {
+		pns = append(pns, pn)
+	}
+	sort.Slice(pns, func(i, j int) bool { return pns[i] > pns[j] })
+	l.received = make(map[uint64]bool)
+
+	// Split the numbers, largest first, into ranges of consecutive
+	// numbers.
+	type ackRange struct{ largest, smallest uint64 }
+	ranges := []ackRange{{pns[0], pns[0]}}
+	for _, pn := range pns[1:] {
+		last := &ranges[len(ranges)-1]
+		if pn == last.smallest-1 {
+			last.smallest = pn
+		} else {
+			ranges = append(ranges, ackRange{pn, pn})
+		}
+	}
+	b := appendVarint(nil, 0x02)
+	b = appendVarint(b, ranges[0].largest)
+	b = appendVarint(b, 0)
+	b = appendVarint(b, uint64(len(ranges)-1))
+	b = appendVarint(b, ranges[0].largest-ranges[0].smallest)
+	for i := 1; i < len(ranges); i++ {
+		b = appendVarint(b, ranges[i-1].smallest-ranges[i].largest-2)
+		b = appendVarint(b, ranges[i].largest-ranges[i].smallest)
+	}
+	return b
+}
+
+// close sends a CONNECTION_CLOSE frame with the H3_NO_ERROR code, if the
+// handshake completed.
+func (c *conn) close() {
+	l := c.levels[levelApp]
+	if l == nil || l.client == nil {
+		return
+	}
+	payload := appendVarint(nil, 0x1d)
+	payload = appendVarint(payload, 0x100)
+	payload = appendVarint(payload, 0)
+	pn := l.nextPN
+	l.nextPN++
+	c.sock.Write(l.client.seal(shortHeader(c.dcid, pn), pn, payload))
+}
+
+// versionNames returns the names of the given versions.
+func versionNames(versions []uint32) []string {
+	names := make([]string, len(versions))
+	for i, v := range versions {
+		names[i] = versionName(v)
+	}
+	return names
+}
@@ -0,0 +1,438 @@
+package http3
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// TLS handshake message types (RFC 8446 section 4).
+const (
+	typeClientHello         = 1
+	typeServerHello         = 2
+	typeNewSessionTicket    = 4
+	typeEncryptedExtensions = 8
+	typeCertificate         = 11
+	typeCertificateRequest  = 13
+	typeCertificateVerify   = 15
+	typeFinished            = 20
+)
+
+// TLS extensions.
+const (
+	extensionServerName          = 0
+	extensionSupportedGroups     = 10
+	extensionSignatureAlgorithms = 13
+	extensionALPN                = 16
+	extensionSupportedVersions   = 43
+	extensionKeyShare            = 51
+	extensionTransportParameters = 57
+)
+
+const (
+	tls13            = 0x0304
+	cipherAES128GCM  = 0x1301
+	groupX25519      = 0x001d
+	helloRetryMarker = "\xcf\x21\xad\x74\xe5\x9a\x61\x11\xbe\x1d\x8c\x02\x1e\x65\xb8\x91\xc2\xa2\x11\x16\x7a\xbb\x8c\x5e\x07\x9e\x09\xe2\xc8\xa8\x33\x9c"
+)
+
+var (
+	errHelloRetry  = errors.New("server sent a HelloRetryRequest")
+	errBadFinished = errors.New("invalid server Finished message")
+)
+
+// Transport parameter IDs (RFC 9000 section 18.2).
+const (
+	paramOriginalDestinationConnectionID = 0x00
+	paramMaxIdleTimeout                  = 0x01
+	paramStatelessResetToken             = 0x02
+	paramMaxUDPPayloadSize               = 0x03
+	paramInitialMaxData                  = 0x04
+	paramInitialMaxStreamDataBidiLocal   = 0x05
+	paramInitialMaxStreamDataBidiRemote  = 0x06
+	paramInitialMaxStreamDataUni         = 0x07
+	paramInitialMaxStreamsBidi           = 0x08
+	paramInitialMaxStreamsUni            = 0x09
+	paramAckDelayExponent                = 0x0a
+	paramMaxAckDelay                     = 0x0b
+	paramDisableActiveMigration          = 0x0c
+	paramPreferredAddress                = 0x0d
+	paramActiveConnectionIDLimit         = 0x0e
+	paramInitialSourceConnectionID       = 0x0f
+	paramRetrySourceConnectionID         = 0x10
+)
+
+// TransportParameters are the QUIC transport parameters sent by the server
+// (RFC 9000 section 18.2).
+type TransportParameters struct {
+	OriginalDestinationConnectionID []byte `json:"original_destination_connection_id,omitempty"`
+	MaxIdleTimeout                  uint64 `json:"max_idle_timeout,omitempty"`
+	StatelessResetToken             []byte `json:"stateless_reset_token,omitempty"`
+	MaxUDPPayloadSize               uint64 `json:"max_udp_payload_size,omitempty"`
+	InitialMaxData                  uint64 `json:"initial_max_data,omitempty"`
+	InitialMaxStreamDataBidiLocal   uint64 `json:"initial_max_stream_data_bidi_local,omitempty"`
+	InitialMaxStreamDataBidiRemote  uint64 `json:"initial_max_stream_data_bidi_remote,omitempty"`
+	InitialMaxStreamDataUni         uint64 `json:"initial_max_stream_data_uni,omitempty"`
+	InitialMaxStreamsBidi           uint64 `json:"initial_max_streams_bidi,omitempty"`
+	InitialMaxStreamsUni            uint64 `json:"initial_max_streams_uni,omitempty"`
+	AckDelayExponent                uint64 `json:"ack_delay_exponent,omitempty"`
+	MaxAckDelay                     uint64 `json:"max_ack_delay,omitempty"`
+	DisableActiveMigration          bool   `json:"disable_active_migration,omitempty"`
+	PreferredAddress                []byte `json:"preferred_address,omitempty"`
+	ActiveConnectionIDLimit         uint64 `json:"active_connection_id_limit,omitempty"`
+	InitialSourceConnectionID       []byte `json:"initial_source_connection_id,omitempty"`
+	RetrySourceConnectionID         []byte `json:"retry_source_connection_id,omitempty"`
+
+	// Unknown holds the parameters not listed above, such as GREASE and
+	// extensions.
+	Unknown []UnknownParameter `json:"unknown,omitempty"`
+}
+
+// UnknownParameter is a transport parameter this module does not decode.
+type UnknownParameter struct {
+	ID    uint64 `json:"id"`
+	Value []byte `json:"value,omitempty"`
+}
+
+// parseTransportParameters parses the quic_transport_parameters extension.
+func parseTransportParameters(b []byte) (*TransportParameters, error) {
+	params := new(TransportParameters)
+	r := &reader{b: b}
+	for len(r.b) > 0 && r.err == nil {
+		id := r.varint()
+		value := r.bytes(r.varint())
+		if r.err != nil {
+			break
+		}
+		v, _, _ := readVarint(value)
+		switch id {
+		case paramOriginalDestinationConnectionID:
+			params.OriginalDestinationConnectionID = value
+		case paramMaxIdleTimeout:
+			params.MaxIdleTimeout = v
+		case paramStatelessResetToken:
+			params.StatelessResetToken = value
+		case paramMaxUDPPayloadSize:
+			params.MaxUDPPayloadSize = v
+		case paramInitialMaxData:
+			params.InitialMaxData = v
+		case paramInitialMaxStreamDataBidiLocal:
+			params.InitialMaxStreamDataBidiLocal = v
+		case paramInitialMaxStreamDataBidiRemote:
+			params.InitialMaxStreamDataBidiRemote = v
+		case paramInitialMaxStreamDataUni:
+			params.InitialMaxStreamDataUni = v
+		case paramInitialMaxStreamsBidi:
+			params.InitialMaxStreamsBidi = v
+		case paramInitialMaxStreamsUni:
+			params.InitialMaxStreamsUni = v
+		case paramAckDelayExponent:
+			params.AckDelayExponent = v
+		case paramMaxAckDelay:
+			params.MaxAckDelay = v
+		case paramDisableActiveMigration:
+			params.DisableActiveMigration = true
+		case paramPreferredAddress:
+			params.PreferredAddress = value
+		case paramActiveConnectionIDLimit:
+			params.ActiveConnectionIDLimit = v
+		case paramInitialSourceConnectionID:
+			params.InitialSourceConnectionID = value
+		case paramRetrySourceConnectionID:
+			params.RetrySourceConnectionID = value
+		default:
+			params.Unknown = append(params.Unknown, UnknownParameter{ID: id, Value: value})
+		}
+	}
+	return params, r.err
+}
+
+// clientTransportParameters returns the transport parameters sent by the
+// client. Only the streams needed for a single request are allowed.
+func clientTransportParameters(scid []byte) []byte {
+	var b []byte
+	param := func(id uint64, value []byte) {
+		b = appendVarint(b, id)
+		b = appendVarint(b, uint64(len(value)))
+		b = append(b, value...)
+	}
+	intParam := func(id, v uint64) {
+		param(id, appendVarint(nil, v))
+	}
+	intParam(paramMaxIdleTimeout, 30000)
+	intParam(paramMaxUDPPayloadSize, maxDatagramSize)
+	intParam(paramInitialMaxData, 1<<20)
+	intParam(paramInitialMaxStreamDataBidiLocal, 1<<20)
+	intParam(paramInitialMaxStreamDataUni, 1<<16)
+	intParam(paramInitialMaxStreamsUni, 3)
+	param(paramInitialSourceConnectionID, scid)
+	return b
+}
+
+// appendVector appends data prefixed with its length in n bytes.
+func appendVector(b []byte, n int, data []byte) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(len(data)>>(8*uint(i))))
+	}
+	return append(b, data...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+// handshake is the client side of a TLS 1.3 handshake carried over QUIC
+// (RFC 9001), offering only TLS_AES_128_GCM_SHA256 and X25519.
+type handshake struct {
+	serverName string
+	alpn       []string
+	scid       []byte
+
+	private [32]byte
+	public  [32]byte
+
+	// hello is the ClientHello message, and transcript hashes the
+	// handshake messages.
+	hello      []byte
+	transcript hash.Hash
+
+	handshakeSecret []byte
+	clientHandshake []byte
+	serverHandshake []byte
+	clientApp       []byte
+	serverApp       []byte
+
+	// Results of the handshake.
+	cipherSuite  uint16
+	alpnResult   string
+	params       *TransportParameters
+	certificates [][]byte
+	finished     bool
+}
+
+func newHandshake(serverName string, alpn []string, scid []byte) (*handshake, error) {
+	h := &handshake{serverName: serverName, alpn: alpn, scid: scid, transcript: sha256.New()}
+	if _, err := rand.Read(h.private[:]); err != nil {
+		return nil, err
+	}
+	curve25519.ScalarBaseMult(&h.public, &h.private)
+	return h, nil
+}
+
+// clientHello returns the ClientHello message, and adds it to the
+// transcript.
+func (h *handshake) clientHello() []byte {
+	var body []byte
+	body = appendUint16(body, 0x0303)
+	random := make([]byte, 32)
+	rand.Read(random)
+	body = append(body, random...)
+	// An empty legacy_session_id, the only cipher suite, and the null
+	// compression method.
+	body = append(body, 0)
+	body = appendVector(body, 2, appendUint16(nil, cipherAES128GCM))
+	body = append(body, 1, 0)
+
+	var exts []byte
+	ext := func(typ uint16, data []byte) {
+		exts = appendUint16(exts, typ)
+		exts = appendVector(exts, 2, data)
+	}
+	if h.serverName != "" {
+		name := append([]byte{0}, appendVector(nil, 2, []byte(h.serverName))...)
+		ext(extensionServerName, appendVector(nil, 2, name))
+	}
+	ext(extensionSupportedGroups, appendVector(nil, 2, appendUint16(nil, groupX25519)))
+	var sigAlgs []byte
+	for _, alg := range []uint16{0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601, 0x0807} {
+		sigAlgs = appendUint16(sigAlgs, alg)
+	}
+	ext(extensionSignatureAlgorithms, appendVector(nil, 2, sigAlgs))
+	ext(extensionSupportedVersions, appendVector(nil, 1, appendUint16(nil, tls13)))
+	keyShare := appendUint16(nil, groupX25519)
+	keyShare = appendVector(keyShare, 2, h.public[:])
+	ext(extensionKeyShare, appendVector(nil, 2, keyShare))
+	if len(h.alpn) > 0 {
+		var protos []byte
+		for _, p := range h.alpn {
+			protos = appendVector(protos, 1, []byte(p))
+		}
+		ext(extensionALPN, appendVector(nil, 2, protos))
+	}
+	ext(extensionTransportParameters, clientTransportParameters(h.scid))
+	body = appendVector(body, 2, exts)
+
+	h.hello = appendVector([]byte{typeClientHello}, 3, body)
+	h.transcript.Write(h.hello)
+	return h.hello
+}
+
+// readMessage splits the first complete handshake message off b, returning
+// nil if b does not hold one yet.
+func readMessage(b []byte) (msg, rest []byte) {
+	if len(b) < 4 {
+		return nil, b
+	}
+	n := 4 + readUint24(b[1:])
+	if len(b) < n {
+		return nil, b
+	}
+	return b[:n], b[n:]
+}
+
+// readExtensions parses a list of extensions, calling f on each.
+func readExtensions(b []byte, f func(typ uint16, data []byte) error) error {
+	r := &reader{b: b}
+	for len(r.b) > 0 {
+		typ := r.uint16()
+		data := r.bytes(uint64(r.uint16()))
+		if r.err != nil {
+			return r.err
+		}
+		if err := f(typ, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serverHello processes the ServerHello message, deriving the handshake
+// secrets.
+func (h *handshake) serverHello(msg []byte) error {
+	if msg[0] != typeServerHello {
+		return fmt.Errorf("expected a ServerHello, got message type %d", msg[0])
+	}
+	r := &reader{b: msg[4:]}
+	r.bytes(2)
+	random := r.bytes(32)
+	r.bytes(uint64(r.byte()))
+	suite := r.bytes(2)
+	r.byte()
+	exts := r.bytes(uint64(r.uint16()))
+	if r.err != nil {
+		return r.err
+	}
+	if string(random) == helloRetryMarker {
+		return errHelloRetry
+	}
+	h.cipherSuite = binary.BigEndian.Uint16(suite)
+	if h.cipherSuite != cipherAES128GCM {
+		return fmt.Errorf("unexpected cipher suite 0x%04x", h.cipherSuite)
+	}
+	var serverKey []byte
+	err := readExtensions(exts, func(typ uint16, data []byte) error {
+		if typ == extensionKeyShare {
+			if len(data) < 4 || binary.BigEndian.Uint16(data) != groupX25519 {
+				return errors.New("unexpected key share")
+			}
+			serverKey = data[4:]
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(serverKey) != 32 {
+		return errors.New("missing X25519 key share")
+	}
+	var peer, shared [32]byte
+	copy(peer[:], serverKey)
+	curve25519.ScalarMult(&shared, &h.private, &peer)
+
+	h.transcript.Write(msg)
+	early := hkdfExtract(nil, make([]byte, sha256.Size))
+	h.handshakeSecret = hkdfExtract(deriveSecret(early, "derived", nil), shared[:])
+	h.clientHandshake = deriveSecret(h.handshakeSecret, "c hs traffic", h.transcript)
+	h.serverHandshake = deriveSecret(h.handshakeSecret, "s hs traffic", h.transcript)
+	return nil
+}
+
+// deriveSecret is Derive-Secret (RFC 8446 section 7.1), given the running
+// transcript hash (or nil for the empty transcript).
+func deriveSecret(secret []byte, label string, transcript hash.Hash) []byte {
+	var sum []byte
+	if transcript == nil {
+		empty := sha256.Sum256(nil)
+		sum = empty[:]
+	} else {
+		sum = transcript.Sum(nil)
+	}
+	return hkdfExpandLabel(secret, label, sum, sha256.Size)
+}
+
+// handshakeMessage processes a message received at the Handshake level. On
+// the server's Finished message, the application secrets are derived and
+// the client's Finished message is returned.
+func (h *handshake) handshakeMessage(msg []byte) ([]byte, error) {
+	switch msg[0] {
+	case typeEncryptedExtensions:
+		r := &reader{b: msg[4:]}
+		exts := r.bytes(uint64(r.uint16()))
+		if r.err != nil {
+			return nil, r.err
+		}
+		err := readExtensions(exts, func(typ uint16, data []byte) error {
+			switch typ {
+			case extensionALPN:
+				if len(data) > 3 {
+					h.alpnResult = string(data[3:])
+				}
+			case extensionTransportParameters:
+				params, err := parseTransportParameters(data)
+				if err != nil {
+					return err
+				}
+				h.params = params
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	case typeCertificate:
+		r := &reader{b: msg[4:]}
+		r.bytes(uint64(r.byte()))
+		list := &reader{b: r.bytes(uint64(readUint24(r.bytes(3))))}
+		for len(list.b) > 0 && list.err == nil {
+			cert := list.bytes(uint64(readUint24(list.bytes(3))))
+			list.bytes(uint64(list.uint16()))
+			if list.err == nil {
+				h.certificates = append(h.certificates, cert)
+			}
+		}
+	case typeCertificateRequest:
+		return nil, errors.New("server requested a client certificate")
+	case typeFinished:
+		// The server's Finished message authenticates the handshake
+		// (RFC 8446 section 4.4.4), but its certificate is not verified.
+		mac := hmac.New(sha256.New, hkdfExpandLabel(h.serverHandshake, "finished", nil, sha256.Size))
+		mac.Write(h.transcript.Sum(nil))
+		if !hmac.Equal(mac.Sum(nil), msg[4:]) {
+			return nil, errBadFinished
+		}
+		h.transcript.Write(msg)
+		h.finished = true
+		master := hkdfExtract(deriveSecret(h.handshakeSecret, "derived", nil), make([]byte, sha256.Size))
+		h.clientApp = deriveSecret(master, "c ap traffic", h.transcript)
+		h.serverApp = deriveSecret(master, "s ap traffic", h.transcript)
+
+		mac = hmac.New(sha256.New, hkdfExpandLabel(h.clientHandshake, "finished", nil, sha256.Size))
+		mac.Write(h.transcript.Sum(nil))
+		return appendVector([]byte{typeFinished}, 3, mac.Sum(nil)), nil
+	}
+	h.transcript.Write(msg)
+	return nil, nil
+}
+
+func readUint24(b []byte) int {
+	if len(b) < 3 {
+		return 0
+	}
+	return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+}
@@ -0,0 +1,197 @@
+package http3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestVarint checks the examples of RFC 9000 appendix A.1.
+func TestVarint(t *testing.T) {
+	tests := []struct {
+		encoded string
+		value   uint64
+	}{
+		{"c2197c5eff14e88c", 151288809941952652},
+		{"9d7f3e7d", 494878333},
+		{"7bbd", 15293},
+		{"25", 37},
+	}
+	for _, test := range tests {
+		b := unhex(t, test.encoded)
+		v, n, err := readVarint(b)
+		if err != nil || v != test.value || n != len(b) {
+			t.Errorf("readVarint(%s) = %d, %d, %v; expected %d", test.encoded, v, n, err, test.value)
+		}
+		if enc := appendVarint(nil, test.value); !bytes.Equal(enc, b) {
+			t.Errorf("appendVarint(%d) = %x; expected %s", test.value, enc, test.encoded)
+		}
+	}
+	if _, _, err := readVarint([]byte{0x80, 0x01}); err == nil {
+		t.Errorf("readVarint accepted a truncated integer")
+	}
+}
+
+// TestInitialKeys checks the keys of RFC 9001 appendix A.1.
+func TestInitialKeys(t *testing.T) {
+	dcid := unhex(t, "8394c8f03e515708")
+	client, server, err := initialKeys(dcid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSecret, serverSecret := initialSecrets(dcid)
+	tests := []struct {
+		name     string
+		got      []byte
+		expected string
+	}{
+		{"client key", hkdfExpandLabel(clientSecret, "quic key", nil, 16), "1f369613dd76d5467730efcbe3b1a22d"},
+		{"client iv", client.iv, "fa044b2f42a3fd3b46fb255c"},
+		{"client hp", hkdfExpandLabel(clientSecret, "quic hp", nil, 16), "9f50449e04a0e810283a1e9933adedd2"},
+		{"server key", hkdfExpandLabel(serverSecret, "quic key", nil, 16), "cf3a5331653c364c88f0f379b6067e37"},
+		{"server iv", server.iv, "0ac1493ca1905853b0bba03e"},
+		{"server hp", hkdfExpandLabel(serverSecret, "quic hp", nil, 16), "c206b8d9b9f0f37644430b490eeaa314"},
+		// RFC 9001 appendix A.2.
+		{"client mask", client.mask(unhex(t, "d1b1c98dd7689fb8ec11d242b123dc9b"))[:5], "437b9aec36"},
+	}
+	for _, test := range tests {
+		if hex.EncodeToString(test.got) != test.expected {
+			t.Errorf("%s = %x; expected %s", test.name, test.got, test.expected)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	dcid := unhex(t, "8394c8f03e515708")
+	client, _, err := initialKeys(dcid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("crypto frames and padding, at least long enough to sample")
+	header := longHeader(packetInitial, Version1, dcid, nil, nil, 2, len(payload))
+	packet := client.seal(header, 2, payload)
+
+	p, rest, err := parseLongPacket(packet)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("parseLongPacket: %v, %d bytes left", err, len(rest))
+	}
+	if p.typ != packetInitial || !bytes.Equal(p.dcid, dcid) {
+		t.Errorf("parsed type %d, dcid %x", p.typ, p.dcid)
+	}
+	pn, got, err := client.open(p.raw, p.pnOffset, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pn != 2 || !bytes.Equal(got, payload) {
+		t.Errorf("open = %d, %q", pn, got)
+	}
+
+	packet[len(packet)-1] ^= 1
+	if _, _, err := client.open(packet, p.pnOffset, 1); err == nil {
+		t.Errorf("open accepted a corrupted packet")
+	}
+}
+
+// TestDecodePacketNumber checks the example of RFC 9000 appendix A.3.
+func TestDecodePacketNumber(t *testing.T) {
+	if pn := decodePacketNumber(0xa82f30ea, 0x9b32, 16); pn != 0xa82f9b32 {
+		t.Errorf("decodePacketNumber = %x; expected a82f9b32", pn)
+	}
+	if pn := decodePacketNumber(-1, 0, 32); pn != 0 {
+		t.Errorf("decodePacketNumber of the first packet = %d", pn)
+	}
+}
+
+func TestFieldSection(t *testing.T) {
+	fields := []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: "example.com"},
+		{Name: ":path", Value: "/index.html"},
+		{Name: "user-agent", Value: "Mozilla/5.0 zgrab/0.x"},
+		{Name: "x-custom", Value: "value"},
+	}
+	got, err := decodeFieldSection(encodeFieldSection(fields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, fields) {
+		t.Errorf("decoded %v; expected %v", got, fields)
+	}
+
+	// A field section with a Required Insert Count refers to the dynamic
+	// table.
+	if _, err := decodeFieldSection([]byte{0x02, 0x00, 0x80}); err != errQPACKDynamic {
+		t.Errorf("dynamic field section: %v", err)
+	}
+}
+
+func TestTransportParameters(t *testing.T) {
+	scid := unhex(t, "0102030405060708")
+	params, err := parseTransportParameters(clientTransportParameters(scid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(params.InitialSourceConnectionID, scid) || params.MaxUDPPayloadSize != maxDatagramSize {
+		t.Errorf("parsed %+v", params)
+	}
+}
+
+// TestValidRetry checks the Retry packet of RFC 9001 appendix A.4.
+func TestValidRetry(t *testing.T) {
+	odcid := unhex(t, "8394c8f03e515708")
+	packet := unhex(t, "ff000000010008f067a5502a4262b5746f6b656e04a265ba2eff4d829058fb3f0f2496ba")
+	if !validRetry(packet, odcid) {
+		t.Errorf("validRetry rejected the Retry packet")
+	}
+	if validRetry(packet, unhex(t, "0102030405060708")) {
+		t.Errorf("validRetry accepted another original connection ID")
+	}
+	packet[len(packet)-1] ^= 1
+	if validRetry(packet, odcid) {
+		t.Errorf("validRetry accepted a corrupted tag")
+	}
+}
+
+func TestServerFinished(t *testing.T) {
+	finished := func(h *handshake) []byte {
+		mac := hmac.New(sha256.New, hkdfExpandLabel(h.serverHandshake, "finished", nil, sha256.Size))
+		mac.Write(h.transcript.Sum(nil))
+		return appendVector([]byte{typeFinished}, 3, mac.Sum(nil))
+	}
+	newTestHandshake := func() *handshake {
+		h, err := newHandshake("example.com", []string{"h3"}, unhex(t, "0102030405060708"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.handshakeSecret = bytes.Repeat([]byte{1}, sha256.Size)
+		h.clientHandshake = bytes.Repeat([]byte{2}, sha256.Size)
+		h.serverHandshake = bytes.Repeat([]byte{3}, sha256.Size)
+		return h
+	}
+
+	h := newTestHandshake()
+	if out, err := h.handshakeMessage(finished(h)); err != nil || out == nil || !h.finished {
+		t.Errorf("handshakeMessage = %x, %v", out, err)
+	}
+
+	h = newTestHandshake()
+	msg := finished(h)
+	msg[len(msg)-1] ^= 1
+	if out, err := h.handshakeMessage(msg); err != errBadFinished || out != nil || h.finished {
+		t.Errorf("handshakeMessage accepted a corrupted Finished: %x, %v", out, err)
+	}
+}
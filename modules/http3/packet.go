@@ -0,0 +1,411 @@
+package http3
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// QUIC versions (RFC 9000, RFC 9369 and the drafts).
+const (
+	Version1     uint32 = 0x00000001
+	Version2     uint32 = 0x6b3343cf
+	VersionDraft uint32 = 0xff000000
+)
+
+// versionName returns a readable name for a QUIC version number.
+func versionName(v uint32) string {
+	switch {
+	case v == Version1:
+		return "1"
+	case v == Version2:
+		return "2"
+	case v&0xffffff00 == VersionDraft:
+		return fmt.Sprintf("draft-%d", v&0xff)
+	case v&0x0f0f0f0f == 0x0a0a0a0a:
+		return fmt.Sprintf("reserved-0x%08x", v)
+	}
+	return fmt.Sprintf("0x%08x", v)
+}
+
+// initialSalt is the salt used to derive the Initial keys of QUIC version 1
+// (RFC 9001 section 5.2).
+var initialSalt = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+	0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+// retryKey and retryNonce protect the Retry packets of QUIC version 1 (RFC
+// 9001 section 5.8).
+var (
+	retryKey   = []byte{0xbe, 0x0c, 0x69, 0x0b, 0x9f, 0x66, 0x57, 0x5a, 0x1d, 0x76, 0x6b, 0x54, 0xe3, 0x68, 0xc8, 0x4e}
+	retryNonce = []byte{0x46, 0x15, 0x99, 0xd3, 0x5d, 0x63, 0x2b, 0xf2, 0x23, 0x98, 0x25, 0xbb}
+)
+
+// Packet types, as in bits 4-5 of the first byte of a long header.
+const (
+	packetInitial   = 0
+	packet0RTT      = 1
+	packetHandshake = 2
+	packetRetry     = 3
+)
+
+// Errors returned while parsing packets.
+var (
+	errShortPacket = errors.New("packet too short")
+	errBadVarint   = errors.New("invalid variable-length integer")
+)
+
+// appendVarint appends v as a QUIC variable-length integer (RFC 9000 section
+// 16).
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, byte(v>>8)|0x40, byte(v))
+	case v < 1<<30:
+		return append(b, byte(v>>24)|0x80, byte(v>>16), byte(v>>8), byte(v))
+	}
+	return append(b, byte(v>>56)|0xc0, byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// readVarint reads a variable-length integer from the start of b, returning
+// it and the number of bytes read.
+func readVarint(b []byte) (uint64, int, error) {
+	if len(b) == 0 {
+		return 0, 0, errBadVarint
+	}
+	n := 1 << (b[0] >> 6)
+	if len(b) < n {
+		return 0, 0, errBadVarint
+	}
+	v := uint64(b[0] & 0x3f)
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n, nil
+}
+
+// reader reads the fields of packets and frames, recording the first error.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) varint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n, err := readVarint(r.b)
+	if err != nil {
+		r.err = err
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.b)) < n {
+		r.err = errShortPacket
+		return nil
+	}
+	ret := r.b[:n]
+	r.b = r.b[n:]
+	return ret
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// hkdfExtract is HKDF-Extract (RFC 5869) with SHA-256.
+func hkdfExtract(salt, ikm []byte) []byte {
+	if salt == nil {
+		salt = make([]byte, sha256.Size)
+	}
+	h := hmac.New(sha256.New, salt)
+	h.Write(ikm)
+	return h.Sum(nil)
+}
+
+// hkdfExpandLabel is HKDF-Expand-Label (RFC 8446 section 7.1) with SHA-256.
+func hkdfExpandLabel(secret []byte, label string, context []byte, length int) []byte {
+	info := []byte{byte(length >> 8), byte(length), byte(len("tls13 ") + len(label))}
+	info = append(info, "tls13 "+label...)
+	info = append(info, byte(len(context)))
+	info = append(info, context...)
+
+	var out, prev []byte
+	for i := byte(1); len(out) < length; i++ {
+		h := hmac.New(sha256.New, secret)
+		h.Write(prev)
+		h.Write(info)
+		h.Write([]byte{i})
+		prev = h.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length]
+}
+
+// keys are the packet protection keys for one direction at one encryption
+// level (RFC 9001 section 5).
+type keys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+// newKeys derives the packet protection keys from a traffic secret, for the
+// AEAD_AES_128_GCM cipher suite.
+func newKeys(secret []byte) (*keys, error) {
+	block, err := aes.NewCipher(hkdfExpandLabel(secret, "quic key", nil, 16))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	hp, err := aes.NewCipher(hkdfExpandLabel(secret, "quic hp", nil, 16))
+	if err != nil {
+		return nil, err
+	}
+	return &keys{aead: aead, iv: hkdfExpandLabel(secret, "quic iv", nil, 12), hp: hp}, nil
+}
+
+// validRetry reports whether the integrity tag ending a Retry packet is
+// valid for odcid, the destination connection ID of the client's first
+// Initial packet.
+func validRetry(packet, odcid []byte) bool {
+	if len(packet) < 16 {
+		return false
+	}
+	block, err := aes.NewCipher(retryKey)
+	if err != nil {
+		return false
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return false
+	}
+	// The tag authenticates the Retry pseudo-packet, with an empty
+	// plaintext.
+	pseudo := append([]byte{byte(len(odcid))}, odcid...)
+	pseudo = append(pseudo, packet[:len(packet)-16]...)
+	return hmac.Equal(aead.Seal(nil, retryNonce, nil, pseudo), packet[len(packet)-16:])
+}
+
+// initialSecrets returns the client and server Initial secrets for the
+// given destination connection ID.
+func initialSecrets(dcid []byte) (client, server []byte) {
+	secret := hkdfExtract(initialSalt, dcid)
+	return hkdfExpandLabel(secret, "client in", nil, 32), hkdfExpandLabel(secret, "server in", nil, 32)
+}
+
+// initialKeys returns the client and server Initial keys for the given
+// destination connection ID.
+func initialKeys(dcid []byte) (client, server *keys, err error) {
+	clientSecret, serverSecret := initialSecrets(dcid)
+	if client, err = newKeys(clientSecret); err != nil {
+		return nil, nil, err
+	}
+	if server, err = newKeys(serverSecret); err != nil {
+		return nil, nil, err
+	}
+	return client, server, nil
+}
+
+func (k *keys) nonce(pn uint64) []byte {
+	nonce := make([]byte, len(k.iv))
+	copy(nonce, k.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * uint(i)))
+	}
+	return nonce
+}
+
+// mask returns the header protection mask for the given sample.
+func (k *keys) mask(sample []byte) []byte {
+	mask := make([]byte, aes.BlockSize)
+	k.hp.Encrypt(mask, sample)
+	return mask
+}
+
+// seal protects a packet: header is the unprotected header, ending with a
+// 4-byte packet number pn, and payload its plaintext payload.
+func (k *keys) seal(header []byte, pn uint64, payload []byte) []byte {
+	pnOffset := len(header) - 4
+	packet := k.aead.Seal(header, k.nonce(pn), payload, header)
+	mask := k.mask(packet[pnOffset+4 : pnOffset+4+16])
+	if packet[0]&0x80 != 0 {
+		packet[0] ^= mask[0] & 0x0f
+	} else {
+		packet[0] ^= mask[0] & 0x1f
+	}
+	for i := 0; i < 4; i++ {
+		packet[pnOffset+i] ^= mask[1+i]
+	}
+	return packet
+}
+
+// open removes the protection of a packet whose packet number starts at
+// pnOffset, returning the packet number and the payload. largest is the
+// largest packet number received so far at this level, used to decode the
+// truncated packet number.
+func (k *keys) open(packet []byte, pnOffset int, largest int64) (uint64, []byte, error) {
+	if len(packet) < pnOffset+4+16 {
+		return 0, nil, errShortPacket
+	}
+	header := make([]byte, pnOffset+4)
+	copy(header, packet)
+	mask := k.mask(packet[pnOffset+4 : pnOffset+4+16])
+	if header[0]&0x80 != 0 {
+		header[0] ^= mask[0] & 0x0f
+	} else {
+		header[0] ^= mask[0] & 0x1f
+	}
+	pnLen := int(header[0]&0x03) + 1
+	var truncated uint64
+	for i := 0; i < pnLen; i++ {
+		header[pnOffset+i] ^= mask[1+i]
+		truncated = truncated<<8 | uint64(header[pnOffset+i])
+	}
+	pn := decodePacketNumber(largest, truncated, uint(pnLen*8))
+	header = header[:pnOffset+pnLen]
+	payload, err := k.aead.Open(nil, k.nonce(pn), packet[pnOffset+pnLen:], header)
+	if err != nil {
+		return 0, nil, err
+	}
+	return pn, payload, nil
+}
+
+// decodePacketNumber recovers a full packet number from its truncated
+// encoding (RFC 9000 appendix A.3).
+func decodePacketNumber(largest int64, truncated uint64, bits uint) uint64 {
+	expected := largest + 1
+	win := int64(1) << bits
+	hwin := win / 2
+	mask := win - 1
+	candidate := (expected &^ mask) | int64(truncated)
+	if candidate <= expected-hwin && candidate < (1<<62)-win {
+		return uint64(candidate + win)
+	}
+	if candidate > expected+hwin && candidate >= win {
+		return uint64(candidate - win)
+	}
+	return uint64(candidate)
+}
+
+// longHeader returns the unprotected long header of a packet of the given
+// type, with a 4-byte packet number and room for a payload of payloadLen
+// bytes (before encryption).
+func longHeader(typ byte, version uint32, dcid, scid, token []byte, pn uint64, payloadLen int) []byte {
+	b := []byte{0xc0 | typ<<4 | 0x03}
+	b = appendUint32(b, version)
+	b = append(b, byte(len(dcid)))
+	b = append(b, dcid...)
+	b = append(b, byte(len(scid)))
+	b = append(b, scid...)
+	if typ == packetInitial {
+		b = appendVarint(b, uint64(len(token)))
+		b = append(b, token...)
+	}
+	// The length covers the packet number, the payload and the AEAD tag.
+	b = append(b, byte(0x40|(4+payloadLen+16)>>8), byte(4+payloadLen+16))
+	return appendUint32(b, uint32(pn))
+}
+
+// shortHeader returns the unprotected short header of a 1-RTT packet, with
+// a 4-byte packet number.
+func shortHeader(dcid []byte, pn uint64) []byte {
+	b := []byte{0x40 | 0x03}
+	b = append(b, dcid...)
+	return appendUint32(b, uint32(pn))
+}
+
+// longPacket is a parsed (but still protected) long header packet.
+type longPacket struct {
+	typ     byte
+	version uint32
+	dcid    []byte
+	scid    []byte
+	token   []byte
+
+	// raw is the whole packet, and pnOffset the offset of its packet
+	// number.
+	raw      []byte
+	pnOffset int
+
+	// versions holds the versions of a Version Negotiation packet.
+	versions []uint32
+}
+
+// parseLongPacket parses the long header packet at the start of b, and
+// returns it and the rest of the datagram (which may hold more, coalesced,
+// packets).
+func parseLongPacket(b []byte) (*longPacket, []byte, error) {
+	if len(b) < 7 {
+		return nil, nil, errShortPacket
+	}
+	p := &longPacket{version: binary.BigEndian.Uint32(b[1:5]), typ: (b[0] >> 4) & 0x03}
+	r := &reader{b: b[5:]}
+	p.dcid = r.bytes(uint64(r.byte()))
+	p.scid = r.bytes(uint64(r.byte()))
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	if p.version == 0 {
+		for len(r.b) >= 4 {
+			p.versions = append(p.versions, binary.BigEndian.Uint32(r.b))
+			r.b = r.b[4:]
+		}
+		p.raw = b
+		return p, nil, nil
+	}
+	if p.typ == packetRetry {
+		// The rest is the retry token, then a 16-byte integrity tag.
+		if len(r.b) < 16 {
+			return nil, nil, errShortPacket
+		}
+		p.token = r.b[:len(r.b)-16]
+		p.raw = b
+		return p, nil, nil
+	}
+	if p.typ == packetInitial {
+		p.token = r.bytes(r.varint())
+	}
+	length := r.varint()
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	p.pnOffset = len(b) - len(r.b)
+	if uint64(len(r.b)) < length {
+		return nil, nil, errShortPacket
+	}
+	end := p.pnOffset + int(length)
+	p.raw = b[:end]
+	return p, b[end:], nil
+}
@@ -0,0 +1,268 @@
+package http3
+
+import (
+	"errors"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// staticTable is the QPACK static table (RFC 9204 appendix A).
+var staticTable = [...]hpack.HeaderField{
+	{Name: ":authority"},
+	{Name: ":path", Value: "/"},
+	{Name: "age", Value: "0"},
+	{Name: "content-disposition"},
+	{Name: "content-length", Value: "0"},
+	{Name: "cookie"},
+	{Name: "date"},
+	{Name: "etag"},
+	{Name: "if-modified-since"},
+	{Name: "if-none-match"},
+	{Name: "last-modified"},
+	{Name: "link"},
+	{Name: "location"},
+	{Name: "referer"},
+	{Name: "set-cookie"},
+	{Name: ":method", Value: "CONNECT"},
+	{Name: ":method", Value: "DELETE"},
+	{Name: ":method", Value: "GET"},
+	{Name: ":method", Value: "HEAD"},
+	{Name: ":method", Value: "OPTIONS"},
+	{Name: ":method", Value: "POST"},
+	{Name: ":method", Value: "PUT"},
+	{Name: ":scheme", Value: "http"},
+	{Name: ":scheme", Value: "https"},
+	{Name: ":status", Value: "103"},
+	{Name: ":status", Value: "200"},
+	{Name: ":status", Value: "304"},
+	{Name: ":status", Value: "404"},
+	{Name: ":status", Value: "503"},
+	{Name: "accept", Value: "*/*"},
+	{Name: "accept", Value: "application/dns-message"},
+	{Name: "accept-encoding", Value: "gzip, deflate, br"},
+	{Name: "accept-ranges", Value: "bytes"},
+	{Name: "access-control-allow-headers", Value: "cache-control"},
+	{Name: "access-control-allow-headers", Value: "content-type"},
+	{Name: "access-control-allow-origin", Value: "*"},
+	{Name: "cache-control", Value: "max-age=0"},
+	{Name: "cache-control", Value: "max-age=2592000"},
+	{Name: "cache-control", Value: "max-age=604800"},
+	{Name: "cache-control", Value: "no-cache"},
+	{Name: "cache-control", Value: "no-store"},
+	{Name: "cache-control", Value: "public, max-age=31536000"},
+	{Name: "content-encoding", Value: "br"},
+	{Name: "content-encoding", Value: "gzip"},
+	{Name: "content-type", Value: "application/dns-message"},
+	{Name: "content-type", Value: "application/javascript"},
+	{Name: "content-type", Value: "application/json"},
+	{Name: "content-type", Value: "application/x-www-form-urlencoded"},
+	{Name: "content-type", Value: "image/gif"},
+	{Name: "content-type", Value: "image/jpeg"},
+	{Name: "content-type", Value: "image/png"},
+	{Name: "content-type", Value: "text/css"},
+	{Name: "content-type", Value: "text/html; charset=utf-8"},
+	{Name: "content-type", Value: "text/plain"},
+	{Name: "content-type", Value: "text/plain;charset=utf-8"},
+	{Name: "range", Value: "bytes=0-"},
+	{Name: "strict-transport-security", Value: "max-age=31536000"},
+	{Name: "strict-transport-security", Value: "max-age=31536000; includesubdomains"},
+	{Name: "strict-transport-security", Value: "max-age=31536000; includesubdomains; preload"},
+	{Name: "vary", Value: "accept-encoding"},
+	{Name: "vary", Value: "origin"},
+	{Name: "x-content-type-options", Value: "nosniff"},
+	{Name: "x-xss-protection", Value: "1; mode=block"},
+	{Name: ":status", Value: "100"},
+	{Name: ":status", Value: "204"},
+	{Name: ":status", Value: "206"},
+	{Name: ":status", Value: "302"},
+	{Name: ":status", Value: "400"},
+	{Name: ":status", Value: "403"},
+	{Name: ":status", Value: "421"},
+	{Name: ":status", Value: "425"},
+	{Name: ":status", Value: "500"},
+	{Name: "accept-language"},
+	{Name: "access-control-allow-credentials", Value: "FALSE"},
+	{Name: "access-control-allow-credentials", Value: "TRUE"},
+	{Name: "access-control-allow-headers", Value: "*"},
+	{Name: "access-control-allow-methods", Value: "get"},
+	{Name: "access-control-allow-methods", Value: "get, post, options"},
+	{Name: "access-control-allow-methods", Value: "options"},
+	{Name: "access-control-expose-headers", Value: "content-length"},
+	{Name: "access-control-request-headers", Value: "content-type"},
+	{Name: "access-control-request-method", Value: "get"},
+	{Name: "access-control-request-method", Value: "post"},
+	{Name: "alt-svc", Value: "clear"},
+	{Name: "authorization"},
+	{Name: "content-security-policy", Value: "script-src 'none'; object-src 'none'; base-uri 'none'"},
+	{Name: "early-data", Value: "1"},
+	{Name: "expect-ct"},
+	{Name: "forwarded"},
+	{Name: "if-range"},
+	{Name: "origin"},
+	{Name: "purpose", Value: "prefetch"},
+	{Name: "server"},
+	{Name: "timing-allow-origin", Value: "*"},
+	{Name: "upgrade-insecure-requests", Value: "1"},
+	{Name: "user-agent"},
+	{Name: "x-forwarded-for"},
+	{Name: "x-frame-options", Value: "deny"},
+	{Name: "x-frame-options", Value: "sameorigin"},
+}
+
+var (
+	errQPACKDynamic = errors.New("field section refers to the QPACK dynamic table")
+	errQPACKInvalid = errors.New("invalid QPACK field section")
+)
+
+// appendQPACKInt appends v as an integer with an n-bit prefix (RFC 7541
+// section 5.1), or-ing the first byte with flags.
+func appendQPACKInt(b []byte, flags byte, n uint, v uint64) []byte {
+	max := uint64(1)<<n - 1
+	if v < max {
+		return append(b, flags|byte(v))
+	}
+	b = append(b, flags|byte(max))
+	for v -= max; v >= 0x80; v >>= 7 {
+		b = append(b, byte(v)|0x80)
+	}
+	return append(b, byte(v))
+}
+
+// readQPACKInt reads an integer with an n-bit prefix.
+func readQPACKInt(r *reader, n uint) uint64 {
+	max := uint64(1)<<n - 1
+	v := uint64(r.byte()) & max
+	if v < max {
+		return v
+	}
+	for shift := uint(0); r.err == nil; shift += 7 {
+		c := r.byte()
+		if shift > 56 {
+			r.err = errQPACKInvalid
+			return 0
+		}
+		v += uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			break
+		}
+	}
+	return v
+}
+
+// appendQPACKString appends a string literal with an n-bit length prefix,
+// without Huffman encoding.
+func appendQPACKString(b []byte, flags byte, n uint, s string) []byte {
+	b = appendQPACKInt(b, flags, n, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readQPACKString reads a string literal whose Huffman flag is the bit above
+// its n-bit length prefix.
+func readQPACKString(r *reader, n uint) string {
+	if len(r.b) == 0 {
+		r.err = errQPACKInvalid
+		return ""
+	}
+	huffman := r.b[0]&(1<<n) != 0
+	data := r.bytes(readQPACKInt(r, n))
+	if r.err != nil {
+		return ""
+	}
+	if !huffman {
+		return string(data)
+	}
+	s, err := hpack.HuffmanDecodeToString(data)
+	if err != nil {
+		r.err = err
+	}
+	return s
+}
+
+// encodeFieldSection encodes the header fields without using the dynamic
+// table: fields in the static table are indexed, and others are literals,
+// with their name indexed when possible.
+func encodeFieldSection(fields []hpack.HeaderField) []byte {
+	// Required Insert Count and Delta Base are both zero.
+	b := []byte{0, 0}
+	for _, f := range fields {
+		nameIndex := -1
+		index := -1
+		for i, s := range staticTable {
+			if s.Name == f.Name {
+				if nameIndex < 0 {
+					nameIndex = i
+				}
+				if s.Value == f.Value {
+					index = i
+					break
+				}
+			}
+		}
+		switch {
+		case index >= 0:
+			// Indexed field line, static table.
+			b = appendQPACKInt(b, 0xc0, 6, uint64(index))
+		case nameIndex >= 0:
+			// Literal field line with a static name reference.
+			b = appendQPACKInt(b, 0x50, 4, uint64(nameIndex))
+			b = appendQPACKString(b, 0, 7, f.Value)
+		default:
+			// Literal field line with a literal name.
+			b = appendQPACKString(b, 0x20, 3, f.Name)
+			b = appendQPACKString(b, 0, 7, f.Value)
+		}
+	}
+	return b
+}
+
+// decodeFieldSection decodes a field section that only uses the static
+// table, as the client allows no dynamic table.
+func decodeFieldSection(b []byte) ([]hpack.HeaderField, error) {
+	r := &reader{b: b}
+	if readQPACKInt(r, 8) != 0 {
+		return nil, errQPACKDynamic
+	}
+	readQPACKInt(r, 7)
+	var fields []hpack.HeaderField
+	static := func(i uint64) (hpack.HeaderField, bool) {
+		if i >= uint64(len(staticTable)) {
+			r.err = errQPACKInvalid
+			return hpack.HeaderField{}, false
+		}
+		return staticTable[i], true
+	}
+	for len(r.b) > 0 && r.err == nil {
+		c := r.b[0]
+		switch {
+		case c&0x80 != 0:
+			// Indexed field line.
+			if c&0x40 == 0 {
+				return nil, errQPACKDynamic
+			}
+			if f, ok := static(readQPACKInt(r, 6)); ok {
+				fields = append(fields, f)
+			}
+		case c&0x40 != 0:
+			// Literal field line with a name reference.
+			if c&0x10 == 0 {
+				return nil, errQPACKDynamic
+			}
+			f, ok := static(readQPACKInt(r, 4))
+			if ok {
+				f.Value = readQPACKString(r, 7)
+				fields = append(fields, f)
+			}
+		case c&0x20 != 0:
+			// Literal field line with a literal name.
+			name := readQPACKString(r, 3)
+			fields = append(fields, hpack.HeaderField{Name: name, Value: readQPACKString(r, 7)})
+		default:
+			// Post-base references are only used with the dynamic table.
+			return nil, errQPACKDynamic
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return fields, nil
+}
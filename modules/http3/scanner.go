@@ -0,0 +1,223 @@
+// Package http3 provides a zgrab2 module that performs a QUIC (RFC 9000)
+// handshake with a server and sends an HTTP/3 (RFC 9114) GET request,
+// recording the QUIC versions and transport parameters of the server, the
+// negotiated ALPN protocol, and the response.
+//
+// The QUIC and TLS 1.3 client is minimal: it offers only QUIC version 1, the
+// TLS_AES_128_GCM_SHA256 cipher suite and the X25519 group, and does not use
+// the QPACK dynamic table. It checks the integrity tag of Retry packets and
+// the server's Finished message, but verifies neither the server's
+// certificate chain nor its CertificateVerify signature: the handshake may
+// be completed with a man in the middle.
+package http3
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/http"
+)
+
+// Flags holds the command-line configuration for the http3 module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+
+	Endpoint          string        `long:"endpoint" default:"/" description:"Send an HTTP request to an endpoint"`
+	UserAgent         string        `long:"user-agent" default:"Mozilla/5.0 zgrab/0.x" description:"Set a custom user agent"`
+	MaxSize           int           `long:"max-size" default:"256" description:"Max kilobytes to read in response to an HTTP request"`
+	ServerName        string        `long:"server-name" description:"Server name used for the SNI extension and the :authority of the request (defaults to the target's domain)"`
+	NextProtos        string        `long:"next-protos" default:"h3" description:"Comma-separated list of ALPN protocols to offer; the request is only sent if h3 is negotiated"`
+	HandshakeOnly     bool          `long:"handshake-only" description:"Stop after the QUIC handshake, without sending a request"`
+	ProbeVersions     bool          `long:"probe-versions" description:"First send a packet with a reserved version, to list the QUIC versions the server supports"`
+	RetransmitTimeout time.Duration `long:"retransmit-timeout" default:"1s" description:"How long to wait for a packet before resending the last one (doubled on each retransmission)"`
+	Retransmits       int           `long:"retransmits" default:"2" description:"Max number of retransmissions"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results is the output of the http3 module.
+type Results struct {
+	// SupportedVersions lists the versions the server sent in a Version
+	// Negotiation packet, if any.
+	SupportedVersions []string `json:"supported_versions,omitempty"`
+
+	// Retry is true if the server sent a Retry packet.
+	Retry bool `json:"retry,omitempty"`
+
+	// CipherSuite is the TLS cipher suite chosen by the server.
+	CipherSuite string `json:"cipher_suite,omitempty"`
+
+	// HandshakeComplete is true if the server's Finished message was
+	// received and valid.
+	HandshakeComplete bool `json:"handshake_complete"`
+
+	// CertificateVerified is always false: neither the certificate chain
+	// nor the CertificateVerify signature of the server are verified.
+	CertificateVerified bool `json:"certificate_verified"`
+
+	// ALPN is the application protocol the server selected.
+	ALPN string `json:"alpn,omitempty"`
+
+	// TransportParameters are the QUIC transport parameters of the server.
+	TransportParameters *TransportParameters `json:"transport_parameters,omitempty"`
+
+	// Certificates is the server's certificate chain (DER), unverified.
+	Certificates [][]byte `json:"certificates,omitempty"`
+
+	// Settings are the HTTP/3 settings of the server, by name.
+	Settings map[string]uint64 `json:"settings,omitempty"`
+
+	// Response is the response to the request.
+	Response *Response `json:"response,omitempty"`
+
+	// ConnectionClose is the CONNECTION_CLOSE frame sent by the server, if
+	// any.
+	ConnectionClose *ConnectionClose `json:"connection_close,omitempty"`
+}
+
+// Response is an HTTP/3 response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// ConnectionClose describes a CONNECTION_CLOSE frame.
+type ConnectionClose struct {
+	// Application is true for the application (HTTP/3) variant of the
+	// frame, whose error codes are those of RFC 9114 section 8.1.
+	Application bool   `json:"application,omitempty"`
+	ErrorCode   uint64 `json:"error_code"`
+	FrameType   uint64 `json:"frame_type,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("http3", "HTTP/3 over QUIC", module.Description(), 443, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Perform a QUIC handshake and send an HTTP/3 GET request"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if flags.MaxSize <= 0 || flags.RetransmitTimeout <= 0 || flags.Retransmits < 0 {
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the name of the scanner.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "http3"
+}
+
+// Scan performs the QUIC handshake and the HTTP/3 request. A result is
+// returned whenever the server answered with any QUIC packet.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	sock, err := target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer sock.Close()
+
+	results := new(Results)
+	c := &conn{sock: sock, scanner: scanner, results: results}
+	if scanner.config.ProbeVersions {
+		// Servers may ignore the probe, so a timeout is not an error.
+		versions, err := c.probeVersions()
+		if netErr, ok := err.(net.Error); err != nil && !(ok && netErr.Timeout()) {
+			return zgrab2.TryGetScanStatus(err), nil, err
+		}
+		if err == nil {
+			results.SupportedVersions = versionNames(versions)
+		}
+	}
+
+	serverName := scanner.config.ServerName
+	if serverName == "" {
+		serverName = target.Domain
+	}
+	var alpn []string
+	for _, proto := range strings.Split(scanner.config.NextProtos, ",") {
+		if proto = strings.TrimSpace(proto); proto != "" {
+			alpn = append(alpn, proto)
+		}
+	}
+	err = c.run(serverName, alpn)
+	c.close()
+	if err != nil {
+		if c.levels[levelInitial].largest < 0 && !results.Retry && results.SupportedVersions == nil {
+			// Nothing was received from the server.
+			return zgrab2.TryGetScanStatus(err), nil, err
+		}
+		return zgrab2.SCAN_PROTOCOL_ERROR, results, err
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
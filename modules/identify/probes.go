@@ -0,0 +1,180 @@
+package identify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"regexp"
+)
+
+// Service names returned by the classifiers. Where a zgrab2 module exists
+// for the service, the name matches the module's protocol.
+const (
+	ServiceUnknown  = "unknown"
+	ServiceFTP      = "ftp"
+	ServiceHTTP     = "http"
+	ServiceIMAP     = "imap"
+	ServiceMySQL    = "mysql"
+	ServicePOP3     = "pop3"
+	ServicePostgres = "postgres"
+	ServiceRedis    = "redis"
+	ServiceSMTP     = "smtp"
+	ServiceSSH      = "ssh"
+	ServiceTelnet   = "telnet"
+	ServiceTLS      = "tls"
+	ServiceVNC      = "vnc"
+)
+
+// A probe is a single step of the decision tree: it sends payload (or nothing,
+// to wait for a server banner) on a fresh connection and classifies whatever
+// comes back.
+type probe struct {
+	name     string
+	payload  func(host string) []byte
+	classify func(response []byte) string
+}
+
+// probes are tried in order until one classifies the service. Banner waits
+// come first since they are passive; the TLS hello comes before the HTTP
+// request because many TLS servers answer plaintext with an HTTP error.
+var probes = []probe{
+	{name: "banner", classify: classifyBanner},
+	{name: "tls", payload: tlsClientHello, classify: classifyTLS},
+	{name: "http", payload: httpRequest, classify: classifyHTTP},
+	{name: "postgres", payload: postgresSSLRequest, classify: classifyPostgres},
+}
+
+var smtpBanner = regexp.MustCompile(`(?i)\b(e?smtp|postfix|exim|sendmail|mail)\b`)
+
+// classifyBanner identifies services that speak first.
+func classifyBanner(b []byte) string {
+	switch {
+	case len(b) == 0:
+		return ""
+	case bytes.HasPrefix(b, []byte("SSH-")):
+		return ServiceSSH
+	case bytes.HasPrefix(b, []byte("220")):
+		if smtpBanner.Match(b) {
+			return ServiceSMTP
+		}
+		return ServiceFTP
+	case bytes.HasPrefix(b, []byte("+OK")):
+		return ServicePOP3
+	case bytes.HasPrefix(b, []byte("* OK")), bytes.HasPrefix(b, []byte("* PREAUTH")):
+		return ServiceIMAP
+	case bytes.HasPrefix(b, []byte("RFB ")):
+		return ServiceVNC
+	case b[0] == 0xff:
+		// Telnet IAC
+		return ServiceTelnet
+	case isMySQLHandshake(b):
+		return ServiceMySQL
+	}
+	return ""
+}
+
+// isMySQLHandshake checks for a packet header (3-byte length, sequence 0)
+// followed by protocol version 10, or an error packet (0xff), which MySQL
+// sends to hosts it refuses.
+func isMySQLHandshake(b []byte) bool {
+	if len(b) < 5 || b[3] != 0 {
+		return false
+	}
+	if b[0] == 0 && b[1] == 0 && b[2] == 0 {
+		return false
+	}
+	return b[4] == 0x0a || b[4] == 0xff
+}
+
+// classifyTLS accepts any TLS handshake or alert record, since an alert in
+// response to the hello is as good an indication as a ServerHello.
+func classifyTLS(b []byte) string {
+	if len(b) >= 5 && (b[0] == 0x16 || b[0] == 0x15) && b[1] == 0x03 && b[2] <= 0x04 {
+		return ServiceTLS
+	}
+	return ""
+}
+
+// classifyHTTP identifies HTTP servers, and the plaintext protocols that
+// answer an HTTP request with a recognizable error.
+func classifyHTTP(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("HTTP/")):
+		return ServiceHTTP
+	case bytes.HasPrefix(b, []byte("-ERR")), bytes.HasPrefix(b, []byte("-NOAUTH")), bytes.HasPrefix(b, []byte("-DENIED")):
+		return ServiceRedis
+	}
+	return ""
+}
+
+// classifyPostgres identifies the single-byte answer to an SSLRequest.
+func classifyPostgres(b []byte) string {
+	if len(b) == 1 && (b[0] == 'S' || b[0] == 'N') {
+		return ServicePostgres
+	}
+	return ""
+}
+
+func httpRequest(host string) []byte {
+	return []byte("GET / HTTP/1.0\r\nHost: " + host + "\r\nUser-Agent: Mozilla/5.0 zgrab/0.x\r\nAccept: */*\r\n\r\n")
+}
+
+func postgresSSLRequest(host string) []byte {
+	return []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}
+}
+
+// tlsClientHello builds a TLS 1.2 ClientHello offering common cipher suites,
+// with an SNI extension if host is a domain name.
+func tlsClientHello(host string) []byte {
+	ciphers := []uint16{
+		0xc02f, 0xc02b, 0xc030, 0xc02c, 0xc013, 0xc009, 0xc014, 0xc00a,
+		0x009c, 0x009d, 0x002f, 0x0035, 0x000a,
+	}
+
+	var ext bytes.Buffer
+	if host != "" && net.ParseIP(host) == nil {
+		name := []byte(host)
+		writeUint16(&ext, 0x0000)
+		writeUint16(&ext, uint16(len(name)+5))
+		writeUint16(&ext, uint16(len(name)+3))
+		ext.WriteByte(0)
+		writeUint16(&ext, uint16(len(name)))
+		ext.Write(name)
+	}
+	// supported_groups: x25519, secp256r1, secp384r1, secp521r1
+	ext.Write([]byte{0x00, 0x0a, 0x00, 0x0a, 0x00, 0x08, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x18, 0x00, 0x19})
+	// ec_point_formats: uncompressed
+	ext.Write([]byte{0x00, 0x0b, 0x00, 0x02, 0x01, 0x00})
+	// signature_algorithms
+	ext.Write([]byte{0x00, 0x0d, 0x00, 0x0e, 0x00, 0x0c,
+		0x04, 0x01, 0x04, 0x03, 0x05, 0x01, 0x05, 0x03, 0x06, 0x01, 0x02, 0x01})
+
+	var hello bytes.Buffer
+	writeUint16(&hello, 0x0303)
+	random := make([]byte, 32)
+	rand.Read(random)
+	hello.Write(random)
+	hello.WriteByte(0)
+	writeUint16(&hello, uint16(2*len(ciphers)))
+	for _, c := range ciphers {
+		writeUint16(&hello, c)
+	}
+	hello.Write([]byte{0x01, 0x00})
+	writeUint16(&hello, uint16(ext.Len()))
+	hello.Write(ext.Bytes())
+
+	var record bytes.Buffer
+	record.Write([]byte{0x16, 0x03, 0x01})
+	writeUint16(&record, uint16(hello.Len()+4))
+	record.WriteByte(0x01)
+	record.Write([]byte{byte(hello.Len() >> 16), byte(hello.Len() >> 8), byte(hello.Len())})
+	record.Write(hello.Bytes())
+	return record.Bytes()
+}
+
+func writeUint16(b *bytes.Buffer, v uint16) {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], v)
+	b.Write(buf[:])
+}
@@ -0,0 +1,54 @@
+package identify
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		probe    string
+		response string
+		expected string
+	}{
+		{"banner", "SSH-2.0-OpenSSH_8.2p1\r\n", ServiceSSH},
+		{"banner", "220 mail.example.com ESMTP Postfix\r\n", ServiceSMTP},
+		{"banner", "220 ProFTPD Server ready.\r\n", ServiceFTP},
+		{"banner", "+OK Dovecot ready.\r\n", ServicePOP3},
+		{"banner", "* OK [CAPABILITY IMAP4rev1] ready\r\n", ServiceIMAP},
+		{"banner", "\xff\xfd\x18\xff\xfd\x20", ServiceTelnet},
+		{"banner", "J\x00\x00\x00\x0a5.7.33\x00", ServiceMySQL},
+		{"banner", "RFB 003.008\n", ServiceVNC},
+		{"banner", "", ""},
+		{"tls", "\x16\x03\x03\x00\x5d\x02", ServiceTLS},
+		{"tls", "\x15\x03\x01\x00\x02\x02\x28", ServiceTLS},
+		{"tls", "HTTP/1.1 400 Bad Request\r\n", ""},
+		{"http", "HTTP/1.1 200 OK\r\n", ServiceHTTP},
+		{"http", "-ERR wrong number of arguments for 'get' command\r\n", ServiceRedis},
+		{"postgres", "N", ServicePostgres},
+		{"postgres", "NO", ""},
+	}
+	for _, test := range tests {
+		for _, p := range probes {
+			if p.name != test.probe {
+				continue
+			}
+			if got := p.classify([]byte(test.response)); got != test.expected {
+				t.Errorf("%s probe, response %q: expected %q, got %q", test.probe, test.response, test.expected, got)
+			}
+		}
+	}
+}
+
+func TestClientHello(t *testing.T) {
+	hello := tlsClientHello("example.com")
+	if len(hello) < 9 || hello[0] != 0x16 || hello[5] != 0x01 {
+		t.Fatalf("malformed ClientHello %x", hello)
+	}
+	if recordLength := int(hello[3])<<8 | int(hello[4]); recordLength != len(hello)-5 {
+		t.Errorf("record length %d does not match payload length %d", recordLength, len(hello)-5)
+	}
+	if helloLength := int(hello[6])<<16 | int(hello[7])<<8 | int(hello[8]); helloLength != len(hello)-9 {
+		t.Errorf("handshake length %d does not match body length %d", helloLength, len(hello)-9)
+	}
+	if len(tlsClientHello("192.0.2.1")) >= len(hello) {
+		t.Errorf("SNI extension sent for an IP address")
+	}
+}
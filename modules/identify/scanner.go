@@ -0,0 +1,256 @@
+// Package identify provides a zgrab2 module that classifies the service
+// listening on a port by trying a sequence of lightweight probes: waiting for
+// a banner, sending a TLS ClientHello, an HTTP request, and common binary
+// hellos. Optionally, the full zgrab2 module for the identified service is
+// then run against the port, and its result included.
+package identify
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// Flags holds the command-line configuration for the identify module.
+type Flags struct {
+	zgrab2.BaseFlags
+	BannerWait      time.Duration `long:"banner-wait" default:"2s" description:"How long to wait for the server to send a banner before probing."`
+	MaxResponseSize int           `long:"max-response-size" default:"512" description:"Maximum number of bytes of each probe response to read and return."`
+	Dispatch        bool          `long:"dispatch" description:"Run the matching zgrab2 module (with its default options) against the port once the service is identified."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+
+	// dispatch maps the names of the services that can be dispatched to
+	// the initialized scanners of the corresponding modules.
+	dispatch map[string]zgrab2.Scanner
+}
+
+// Results is the output of the identify module.
+type Results struct {
+	// Service is the identified service, or "unknown".
+	Service string `json:"service"`
+
+	// Probe is the name of the probe that identified the service.
+	Probe string `json:"probe,omitempty"`
+
+	// Banner is whatever the server sent before receiving any data.
+	Banner string `json:"banner,omitempty"`
+
+	// Response is the response to the probe that identified the service,
+	// when that was not the banner wait.
+	Response []byte `json:"response,omitempty"`
+
+	// Dispatch is the result of the module run for the identified service,
+	// if --dispatch was given.
+	Dispatch *DispatchResult `json:"dispatch,omitempty"`
+}
+
+// DispatchResult is the result of running the full module matching the
+// identified service.
+type DispatchResult struct {
+	Module string            `json:"module"`
+	Status zgrab2.ScanStatus `json:"status"`
+	Result interface{}       `json:"result,omitempty"`
+	Error  *string           `json:"error,omitempty"`
+}
+
+// ErrUnidentified is returned when no probe identified the service.
+var ErrUnidentified = errors.New("could not identify service")
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("identify", "Service identification", module.Description(), 0, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Identify the service on a port using lightweight probes, optionally running the matching module"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if flags.Port == 0 {
+		return zgrab2.ErrInvalidArguments
+	}
+	if flags.MaxResponseSize <= 0 {
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	if f.Dispatch {
+		return scanner.initDispatch()
+	}
+	return nil
+}
+
+// initDispatch creates a scanner, with default flags, for each identifiable
+// service that has a registered module.
+func (scanner *Scanner) initDispatch() error {
+	scanner.dispatch = make(map[string]zgrab2.Scanner)
+	for _, service := range []string{
+		ServiceFTP, ServiceHTTP, ServiceIMAP, ServiceMySQL, ServicePOP3, ServicePostgres,
+		ServiceRedis, ServiceSMTP, ServiceSSH, ServiceTelnet, ServiceTLS, ServiceVNC,
+	} {
+		module := zgrab2.GetModule(service)
+		if module == nil {
+			continue
+		}
+		flags, ok := module.NewFlags().(zgrab2.ScanFlags)
+		if !ok {
+			continue
+		}
+		if err := zgrab2.SetFlagDefaults(flags); err != nil {
+			return err
+		}
+		if base := zgrab2.GetBaseFlags(flags); base != nil {
+			base.Name = scanner.config.Name + "-" + service
+			base.Port = scanner.config.Port
+			base.Timeout = scanner.config.Timeout
+			base.BytesReadLimit = scanner.config.BytesReadLimit
+		}
+		if err := flags.Validate(nil); err != nil {
+			return err
+		}
+		s := module.NewScanner()
+		if err := s.Init(flags); err != nil {
+			return err
+		}
+		scanner.dispatch[service] = s
+	}
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	for _, s := range scanner.dispatch {
+		if err := s.InitPerSender(senderID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "identify"
+}
+
+// runProbe sends the probe's payload (if any) on a new connection, and
+// returns what the server sent back. Read errors are not reported, since
+// timeouts and closed connections are expected answers to a wrong probe.
+func (scanner *Scanner) runProbe(ctx context.Context, target *zgrab2.ScanTarget, p probe) ([]byte, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var wait time.Duration
+	if p.payload == nil {
+		wait = scanner.config.BannerWait
+		conn.SetReadDeadline(time.Now().Add(wait))
+	} else if _, err := conn.Write(p.payload(target.Host())); err != nil {
+		return nil, nil
+	}
+	response, _ := zgrab2.ReadAvailableWithOptions(conn, scanner.config.MaxResponseSize, 100*time.Millisecond, wait, scanner.config.MaxResponseSize)
+	return response, nil
+}
+
+// Scan tries each probe in turn on a new connection until one identifies the
+// service. If the first connection fails, the port is considered closed and
+// the error is returned.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	results := &Results{Service: ServiceUnknown}
+	for i, p := range probes {
+		response, err := scanner.runProbe(ctx, &target, p)
+		if err != nil {
+			if i == 0 {
+				return zgrab2.TryGetScanStatus(err), nil, err
+			}
+			continue
+		}
+		if p.payload == nil {
+			results.Banner = string(response)
+		}
+		service := p.classify(response)
+		if service == "" {
+			continue
+		}
+		results.Service = service
+		results.Probe = p.name
+		if p.payload != nil {
+			results.Response = response
+		}
+		break
+	}
+	if results.Service == ServiceUnknown {
+		return zgrab2.SCAN_PROTOCOL_ERROR, results, ErrUnidentified
+	}
+	if s, ok := scanner.dispatch[results.Service]; ok {
+		status, result, err := s.Scan(ctx, target)
+		results.Dispatch = &DispatchResult{
+			Module: s.Protocol(),
+			Status: status,
+			Result: result,
+		}
+		if err != nil {
+			msg := err.Error()
+			results.Dispatch.Error = &msg
+		}
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
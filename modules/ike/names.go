@@ -0,0 +1,159 @@
+package ike
+
+import "fmt"
+
+// v1Encryptions names the IKEv1 encryption algorithms.
+var v1Encryptions = map[uint32]string{
+	1: "DES-CBC",
+	2: "IDEA-CBC",
+	3: "Blowfish-CBC",
+	4: "RC5-R16-B64-CBC",
+	5: "3DES-CBC",
+	6: "CAST-CBC",
+	7: "AES-CBC",
+	8: "Camellia-CBC",
+}
+
+// v1Hashes names the IKEv1 hash algorithms.
+var v1Hashes = map[uint32]string{
+	1: "MD5",
+	2: "SHA1",
+	3: "Tiger",
+	4: "SHA2-256",
+	5: "SHA2-384",
+	6: "SHA2-512",
+}
+
+// v1AuthMethods names the IKEv1 authentication methods.
+var v1AuthMethods = map[uint32]string{
+	1:     "PSK",
+	2:     "DSS-Signature",
+	3:     "RSA-Signature",
+	4:     "RSA-Encryption",
+	5:     "RSA-Revised-Encryption",
+	65001: "XAUTH-PSK",
+	65005: "XAUTH-RSA-Signature",
+}
+
+// v2Encryptions names the IKEv2 encryption algorithms.
+var v2Encryptions = map[uint32]string{
+	2:  "DES",
+	3:  "3DES",
+	12: "AES-CBC",
+	13: "AES-CTR",
+	18: "AES-GCM-8",
+	19: "AES-GCM-12",
+	20: "AES-GCM-16",
+	28: "ChaCha20-Poly1305",
+}
+
+// v2PRFs names the IKEv2 pseudorandom functions.
+var v2PRFs = map[uint32]string{
+	1: "HMAC-MD5",
+	2: "HMAC-SHA1",
+	5: "HMAC-SHA2-256",
+	6: "HMAC-SHA2-384",
+	7: "HMAC-SHA2-512",
+}
+
+// v2Integrities names the IKEv2 integrity algorithms.
+var v2Integrities = map[uint32]string{
+	1:  "HMAC-MD5-96",
+	2:  "HMAC-SHA1-96",
+	12: "HMAC-SHA2-256-128",
+	13: "HMAC-SHA2-384-192",
+	14: "HMAC-SHA2-512-256",
+}
+
+// groups names the Diffie-Hellman groups, of IKEv1 and IKEv2.
+var groups = map[uint32]string{
+	1:  "MODP-768",
+	2:  "MODP-1024",
+	5:  "MODP-1536",
+	14: "MODP-2048",
+	15: "MODP-3072",
+	16: "MODP-4096",
+	19: "ECP-256",
+	20: "ECP-384",
+	21: "ECP-521",
+}
+
+// groupSizes gives the length of the public values of the groups.
+var groupSizes = map[uint32]int{
+	1:  96,
+	2:  128,
+	5:  192,
+	14: 256,
+	15: 384,
+	16: 512,
+	19: 64,
+	20: 96,
+	21: 132,
+}
+
+// v1Notifications names the IKEv1 notify message types.
+var v1Notifications = map[uint32]string{
+	1:  "INVALID-PAYLOAD-TYPE",
+	2:  "DOI-NOT-SUPPORTED",
+	3:  "SITUATION-NOT-SUPPORTED",
+	4:  "INVALID-COOKIE",
+	5:  "INVALID-MAJOR-VERSION",
+	6:  "INVALID-MINOR-VERSION",
+	7:  "INVALID-EXCHANGE-TYPE",
+	8:  "INVALID-FLAGS",
+	9:  "INVALID-MESSAGE-ID",
+	10: "INVALID-PROTOCOL-ID",
+	11: "INVALID-SPI",
+	12: "INVALID-TRANSFORM-ID",
+	13: "ATTRIBUTES-NOT-SUPPORTED",
+	14: "NO-PROPOSAL-CHOSEN",
+	15: "BAD-PROPOSAL-SYNTAX",
+	16: "PAYLOAD-MALFORMED",
+	17: "INVALID-KEY-INFORMATION",
+	18: "INVALID-ID-INFORMATION",
+	24: "AUTHENTICATION-FAILED",
+}
+
+// v2Notifications names the IKEv2 notify message types.
+var v2Notifications = map[uint32]string{
+	1:     "UNSUPPORTED_CRITICAL_PAYLOAD",
+	4:     "INVALID_IKE_SPI",
+	5:     "INVALID_MAJOR_VERSION",
+	7:     "INVALID_SYNTAX",
+	9:     "INVALID_MESSAGE_ID",
+	11:    "INVALID_SPI",
+	14:    "NO_PROPOSAL_CHOSEN",
+	17:    "INVALID_KE_PAYLOAD",
+	24:    "AUTHENTICATION_FAILED",
+	16388: "NAT_DETECTION_SOURCE_IP",
+	16389: "NAT_DETECTION_DESTINATION_IP",
+	16390: "COOKIE",
+	16404: "MULTIPLE_AUTH_SUPPORTED",
+	16430: "IKEV2_FRAGMENTATION_SUPPORTED",
+	16431: "SIGNATURE_HASH_ALGORITHMS",
+}
+
+// vendorIDs names the known vendor IDs, by the prefix of their hexadecimal
+// value. natT is set for the vendor IDs of NAT traversal.
+var vendorIDs = []struct {
+	prefix string
+	name   string
+	natT   bool
+}{
+	{"4a131c81070358455c5728f20e95452f", "RFC 3947 NAT-T", true},
+	{"90cb80913ebb696e086381b5ec427b1f", "draft-ietf-ipsec-nat-t-ike-02", true},
+	{"7d9419a65310ca6f2c179d9215529d56", "draft-ietf-ipsec-nat-t-ike-03", true},
+	{"afcad71368a1f1c96b8696fc77570100", "Dead Peer Detection v1.0", false},
+	{"4048b7d56ebce88525e7de7f00d6c2d3", "IKE Fragmentation", false},
+	{"09002689dfd6b712", "XAUTH", false},
+	{"12f5f28c457168a9702d9fe274cc01", "Cisco Unity", false},
+	{"1e2b516905991c7d7c96fcbfb587e461", "Microsoft Windows", false},
+}
+
+// name returns the name of id in names, or id in decimal.
+func name(names map[uint32]string, id uint32) string {
+	if n, ok := names[id]; ok {
+		return n
+	}
+	return fmt.Sprintf("%d", id)
+}
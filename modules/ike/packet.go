@@ -0,0 +1,238 @@
+package ike
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The exchange types.
+const (
+	exchangeMain       = 2
+	exchangeAggressive = 4
+	exchangeSAInit     = 34
+)
+
+// The payload types of IKEv1.
+const (
+	payloadNone      = 0
+	payloadSA        = 1
+	payloadTransform = 3
+	payloadKE        = 4
+	payloadID        = 5
+	payloadNonce     = 10
+	payloadNotify    = 11
+	payloadVendorID  = 13
+	payloadNATD      = 20
+	payloadNATDDraft = 130
+)
+
+// The payload types of IKEv2.
+const (
+	payloadSAv2       = 33
+	payloadKEv2       = 34
+	payloadNoncev2    = 40
+	payloadNotifyv2   = 41
+	payloadVendorIDv2 = 43
+)
+
+// The IKEv2 notify types sent or handled by the scanner.
+const (
+	notifyInvalidKE        = 17
+	notifyNATSourceIP      = 16388
+	notifyNATDestinationIP = 16389
+	notifyCookie           = 16390
+)
+
+const (
+	// headerLength is the length of the message header.
+	headerLength = 28
+
+	// genericHeaderLength is the length of the generic payload header.
+	genericHeaderLength = 4
+
+	// maxPayloads is the maximum number of payloads parsed in a message.
+	maxPayloads = 64
+)
+
+// ErrInvalidMessage is returned if a response is not an IKE message.
+var ErrInvalidMessage = errors.New("invalid IKE message")
+
+// exchangeNames names the exchange types.
+var exchangeNames = map[uint32]string{
+	1:  "base",
+	2:  "identity_protection",
+	3:  "authentication_only",
+	4:  "aggressive",
+	5:  "informational",
+	32: "quick_mode",
+	33: "new_group_mode",
+	34: "ike_sa_init",
+	35: "ike_auth",
+	36: "create_child_sa",
+	37: "informational",
+}
+
+// payloadNames names the payload types of IKEv1 (1 to 130) and IKEv2 (33 and
+// above).
+var payloadNames = map[uint32]string{
+	1:   "SA",
+	2:   "P",
+	3:   "T",
+	4:   "KE",
+	5:   "ID",
+	6:   "CERT",
+	7:   "CR",
+	8:   "HASH",
+	9:   "SIG",
+	10:  "NONCE",
+	11:  "N",
+	12:  "D",
+	13:  "VID",
+	14:  "ATTR",
+	20:  "NAT-D",
+	21:  "NAT-OA",
+	33:  "SA",
+	34:  "KE",
+	35:  "IDi",
+	36:  "IDr",
+	37:  "CERT",
+	38:  "CERTREQ",
+	39:  "AUTH",
+	40:  "NONCE",
+	41:  "N",
+	42:  "D",
+	43:  "VID",
+	44:  "TSi",
+	45:  "TSr",
+	46:  "SK",
+	47:  "CP",
+	48:  "EAP",
+	53:  "SKF",
+	130: "NAT-D",
+}
+
+// payload is a payload of a message, without its generic header.
+type payload struct {
+	typ  byte
+	body []byte
+}
+
+// message is an ISAKMP (IKEv1) or IKEv2 message.
+type message struct {
+	initiatorSPI []byte
+	responderSPI []byte
+	version      byte
+	exchangeType byte
+	flags        byte
+	messageID    uint32
+	payloads     []payload
+}
+
+// encode returns the header and the chained payloads of the message.
+func (m *message) encode() []byte {
+	buf := make([]byte, headerLength)
+	copy(buf[0:8], m.initiatorSPI)
+	copy(buf[8:16], m.responderSPI)
+	if len(m.payloads) > 0 {
+		buf[16] = m.payloads[0].typ
+	}
+	buf[17] = m.version
+	buf[18] = m.exchangeType
+	buf[19] = m.flags
+	binary.BigEndian.PutUint32(buf[20:], m.messageID)
+	for i, p := range m.payloads {
+		next := byte(payloadNone)
+		if i+1 < len(m.payloads) {
+			next = m.payloads[i+1].typ
+		}
+		buf = appendGeneric(buf, next, p.body)
+	}
+	binary.BigEndian.PutUint32(buf[24:], uint32(len(buf)))
+	return buf
+}
+
+// appendGeneric appends body to buf, after a generic payload header.
+func appendGeneric(buf []byte, next byte, body []byte) []byte {
+	header := []byte{next, 0, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(genericHeaderLength+len(body)))
+	return append(append(buf, header...), body...)
+}
+
+// parseMessage parses a message, and its chain of payloads.
+func parseMessage(buf []byte) (*message, error) {
+	if len(buf) < headerLength {
+		return nil, ErrInvalidMessage
+	}
+	length := binary.BigEndian.Uint32(buf[24:])
+	major := buf[17] >> 4
+	if (major != 1 && major != 2) || length < headerLength || int(length) > len(buf) {
+		return nil, ErrInvalidMessage
+	}
+	m := &message{
+		initiatorSPI: buf[0:8],
+		responderSPI: buf[8:16],
+		version:      buf[17],
+		exchangeType: buf[18],
+		flags:        buf[19],
+		messageID:    binary.BigEndian.Uint32(buf[20:]),
+	}
+	next := buf[16]
+	buf = buf[headerLength:length]
+	for next != payloadNone && len(m.payloads) < maxPayloads {
+		if len(buf) < genericHeaderLength {
+			return nil, ErrInvalidMessage
+		}
+		size := int(binary.BigEndian.Uint16(buf[2:]))
+		if size < genericHeaderLength || size > len(buf) {
+			return nil, ErrInvalidMessage
+		}
+		m.payloads = append(m.payloads, payload{typ: next, body: buf[genericHeaderLength:size]})
+		next = buf[0]
+		buf = buf[size:]
+	}
+	return m, nil
+}
+
+// attribute is a data attribute of an IKEv1 transform, or the key length
+// attribute of an IKEv2 transform.
+type attribute struct {
+	typ   uint16
+	value uint32
+}
+
+// appendAttributes appends attributes in the TV format, whose values fit in
+// 16 bits.
+func appendAttributes(buf []byte, attributes []attribute) []byte {
+	for _, a := range attributes {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint16(b, 0x8000|a.typ)
+		binary.BigEndian.PutUint16(b[2:], uint16(a.value))
+		buf = append(buf, b...)
+	}
+	return buf
+}
+
+// parseAttributes parses attributes in the TV or TLV formats. The values of
+// TLV attributes longer than 4 bytes are their last 4 bytes.
+func parseAttributes(buf []byte) []attribute {
+	var attributes []attribute
+	for len(buf) >= 4 {
+		typ := binary.BigEndian.Uint16(buf)
+		if typ&0x8000 != 0 {
+			attributes = append(attributes, attribute{typ: typ & 0x7fff, value: uint32(binary.BigEndian.Uint16(buf[2:]))})
+			buf = buf[4:]
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(buf[2:]))
+		if len(buf) < 4+length {
+			break
+		}
+		var value uint32
+		for _, b := range buf[4 : 4+length] {
+			value = value<<8 | uint32(b)
+		}
+		attributes = append(attributes, attribute{typ: typ, value: value})
+		buf = buf[4+length:]
+	}
+	return attributes
+}
@@ -0,0 +1,386 @@
+// Package ike provides a zgrab2 module that sends IKEv1 or IKEv2 proposals to
+// IPsec VPN gateways, and records the transform they accept, their vendor IDs
+// and their support of NAT traversal.
+// Default Port: 500 (UDP)
+//
+// With --ike-version=1 (the default), the scanner sends the first message of
+// an IKEv1 main mode exchange, or with --mode=aggressive of an aggressive
+// mode exchange, which also carries a key exchange of --dh-group, a nonce,
+// and --identity. The SA proposes AES and 3DES with SHA-2, SHA-1 and MD5, and
+// pre-shared key or RSA signature authentication; the message announces NAT
+// traversal with its vendor IDs.
+//
+// With --ike-version=2, the scanner sends an IKE_SA_INIT request proposing
+// AES-CBC, 3DES and AES-GCM, with a key exchange of --dh-group and the NAT
+// detection notifications. If the gateway asks for a cookie, or for the key
+// exchange of another group it supports, the request is sent again once with
+// it.
+//
+// The responses are parsed for the accepted transform, the vendor IDs, the
+// notifications, such as NO-PROPOSAL-CHOSEN, and the NAT traversal vendor IDs
+// or NAT detection payloads. With --nat-t, the messages are prefixed with the
+// non-ESP marker, as on UDP port 4500.
+package ike
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// maxRequests is the maximum number of IKE_SA_INIT requests sent, after a
+// cookie or key exchange group is requested.
+const maxRequests = 3
+
+// nonceLength is the length of the nonces sent.
+const nonceLength = 32
+
+// Flags holds the command-line configuration for the ike module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+
+	IKEVersion uint   `long:"ike-version" default:"1" description:"IKE version of the request: 1 or 2"`
+	Mode       string `long:"mode" default:"main" choice:"main" choice:"aggressive" description:"IKEv1 exchange mode"`
+	Group      uint   `long:"dh-group" default:"14" description:"Diffie-Hellman group of the key exchange of IKEv1 aggressive mode and IKEv2: 1, 2, 5, 14, 15, 16, 19, 20 or 21"`
+	Identity   string `long:"identity" default:"zgrab" description:"Identity sent in IKEv1 aggressive mode, as a user FQDN"`
+	NATT       bool   `long:"nat-t" description:"Prefix the messages with the non-ESP marker, as on UDP port 4500"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Transform is the transform accepted by the gateway. Hash, AuthMethod and
+// LifeDuration are only set with IKEv1, and PRF and Integrity with IKEv2.
+type Transform struct {
+	Encryption   string `json:"encryption,omitempty"`
+	KeyLength    uint16 `json:"key_length,omitempty"`
+	Hash         string `json:"hash,omitempty"`
+	PRF          string `json:"prf,omitempty"`
+	Integrity    string `json:"integrity,omitempty"`
+	AuthMethod   string `json:"auth_method,omitempty"`
+	Group        string `json:"group,omitempty"`
+	LifeDuration uint32 `json:"life_duration,omitempty"`
+}
+
+// VendorID is a vendor ID payload of the response.
+type VendorID struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// Notification is a notification payload of the response.
+type Notification struct {
+	Type uint16 `json:"type"`
+	Name string `json:"name,omitempty"`
+	Data string `json:"data,omitempty"`
+}
+
+// Results is the output of the ike module.
+type Results struct {
+	// Version is the major version of the response, and ExchangeType its
+	// exchange type.
+	Version      uint8  `json:"version"`
+	ExchangeType string `json:"exchange_type"`
+
+	// ResponderSPI is the SPI (cookie) of the gateway, in hexadecimal.
+	ResponderSPI string `json:"responder_spi,omitempty"`
+
+	// Payloads lists the types of the payloads of the response.
+	Payloads []string `json:"payloads,omitempty"`
+
+	// Transform is the transform accepted by the gateway.
+	Transform *Transform `json:"transform,omitempty"`
+
+	VendorIDs     []VendorID     `json:"vendor_ids,omitempty"`
+	Notifications []Notification `json:"notifications,omitempty"`
+
+	// NATT is true if the response has a NAT traversal vendor ID, or NAT
+	// detection payloads.
+	NATT bool `json:"nat_t"`
+
+	// Cookie is true if the gateway asked for a cookie, and PreferredGroup is
+	// the group it asked for, with IKEv2.
+	Cookie         bool   `json:"cookie,omitempty"`
+	PreferredGroup string `json:"preferred_group,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("ike", "IKE", module.Description(), 500, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Send IKEv1 or IKEv2 proposals to an IPsec gateway, and read the accepted transform, vendor IDs and NAT traversal support"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if flags.IKEVersion != 1 && flags.IKEVersion != 2 {
+		log.Errorf("--ike-version must be 1 or 2")
+		return zgrab2.ErrInvalidArguments
+	}
+	if _, ok := groupSizes[uint32(flags.Group)]; !ok {
+		log.Errorf("unsupported --dh-group %d", flags.Group)
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "ike"
+}
+
+// random returns n random bytes.
+func random(n int) []byte {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return buf
+}
+
+// v1Request returns the first message of the IKEv1 exchange.
+func (scanner *Scanner) v1Request(spi []byte) *message {
+	m := &message{initiatorSPI: spi, version: 0x10, exchangeType: exchangeMain}
+	if scanner.config.Mode == "aggressive" {
+		group := uint32(scanner.config.Group)
+		m.exchangeType = exchangeAggressive
+		m.payloads = []payload{
+			{payloadSA, encodeV1SA([]uint32{group})},
+			{payloadKE, random(groupSizes[group])},
+			{payloadNonce, random(nonceLength)},
+			{payloadID, encodeV1ID(scanner.config.Identity)},
+		}
+	} else {
+		m.payloads = []payload{{payloadSA, encodeV1SA(v1ProposedGroups)}}
+	}
+	for _, id := range v1VendorIDs {
+		vid, _ := hex.DecodeString(id)
+		m.payloads = append(m.payloads, payload{payloadVendorID, vid})
+	}
+	return m
+}
+
+// v2Request returns the IKE_SA_INIT request with the key exchange of group,
+// and cookie if it is not nil.
+func v2Request(conn net.Conn, spi []byte, group uint16, cookie []byte) *message {
+	m := &message{initiatorSPI: spi, version: 0x20, exchangeType: exchangeSAInit, flags: 0x08}
+	if cookie != nil {
+		m.payloads = append(m.payloads, payload{payloadNotifyv2, encodeV2Notify(notifyCookie, cookie)})
+	}
+	m.payloads = append(m.payloads,
+		payload{payloadSAv2, encodeV2SA(group)},
+		payload{payloadKEv2, encodeV2KE(group, random(groupSizes[uint32(group)]))},
+		payload{payloadNoncev2, random(nonceLength)},
+		payload{payloadNotifyv2, encodeV2Notify(notifyNATSourceIP, natDetection(spi, conn.LocalAddr()))},
+		payload{payloadNotifyv2, encodeV2Notify(notifyNATDestinationIP, natDetection(spi, conn.RemoteAddr()))},
+	)
+	return m
+}
+
+// exchange sends request, and returns the response.
+func (scanner *Scanner) exchange(conn net.Conn, request *message) (*message, error) {
+	buf := request.encode()
+	if scanner.config.NATT {
+		buf = append([]byte{0, 0, 0, 0}, buf...)
+	}
+	if _, err := conn.Write(buf); err != nil {
+		return nil, err
+	}
+	buf = make([]byte, 65536)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	buf = buf[:n]
+	if scanner.config.NATT && len(buf) >= 4 && binary.BigEndian.Uint32(buf) == 0 {
+		buf = buf[4:]
+	}
+	resp, err := parseMessage(buf)
+	if err != nil {
+		return nil, err
+	}
+	if string(resp.initiatorSPI) != string(request.initiatorSPI) {
+		return nil, ErrInvalidMessage
+	}
+	return resp, nil
+}
+
+// notify returns the data of the first IKEv2 notify payload of typ in m.
+func notify(m *message, typ uint16) []byte {
+	for _, p := range m.payloads {
+		if p.typ != payloadNotifyv2 {
+			continue
+		}
+		if t, data, ok := parseV2Notify(p.body); ok && t == typ {
+			return data
+		}
+	}
+	return nil
+}
+
+// v2Exchange sends the IKE_SA_INIT request, and sends it again with the
+// cookie or key exchange group requested by the gateway.
+func (scanner *Scanner) v2Exchange(conn net.Conn, spi []byte, results *Results) (*message, error) {
+	group := uint16(scanner.config.Group)
+	var cookie []byte
+	for i := 0; ; i++ {
+		resp, err := scanner.exchange(conn, v2Request(conn, spi, group, cookie))
+		if err != nil || i == maxRequests-1 {
+			return resp, err
+		}
+		if c := notify(resp, notifyCookie); c != nil && cookie == nil {
+			results.Cookie = true
+			cookie = c
+			continue
+		}
+		if g := notify(resp, notifyInvalidKE); len(g) == 2 {
+			preferred := binary.BigEndian.Uint16(g)
+			results.PreferredGroup = name(groups, uint32(preferred))
+			if _, ok := groupSizes[uint32(preferred)]; ok && preferred != group {
+				group = preferred
+				continue
+			}
+		}
+		return resp, nil
+	}
+}
+
+// record records the payloads of the response.
+func (results *Results) record(resp *message) {
+	results.Version = resp.version >> 4
+	results.ExchangeType = name(exchangeNames, uint32(resp.exchangeType))
+	results.ResponderSPI = hex.EncodeToString(resp.responderSPI)
+	for _, p := range resp.payloads {
+		results.Payloads = append(results.Payloads, name(payloadNames, uint32(p.typ)))
+		switch p.typ {
+		case payloadSA, payloadSAv2:
+			parse := parseV1SA
+			if p.typ == payloadSAv2 {
+				parse = parseV2SA
+			}
+			t, err := parse(p.body)
+			if err != nil {
+				log.Debugf("ike: %v", err)
+				continue
+			}
+			results.Transform = t
+		case payloadVendorID, payloadVendorIDv2:
+			vid := VendorID{ID: hex.EncodeToString(p.body)}
+			for _, v := range vendorIDs {
+				if strings.HasPrefix(vid.ID, v.prefix) {
+					vid.Name = v.name
+					results.NATT = results.NATT || v.natT
+					break
+				}
+			}
+			results.VendorIDs = append(results.VendorIDs, vid)
+		case payloadNotify, payloadNotifyv2:
+			parse, names := parseV1Notify, v1Notifications
+			if p.typ == payloadNotifyv2 {
+				parse, names = parseV2Notify, v2Notifications
+			}
+			typ, data, ok := parse(p.body)
+			if !ok {
+				continue
+			}
+			n := Notification{Type: typ, Name: name(names, uint32(typ)), Data: hex.EncodeToString(data)}
+			results.Notifications = append(results.Notifications, n)
+			if p.typ == payloadNotifyv2 && (typ == notifyNATSourceIP || typ == notifyNATDestinationIP) {
+				results.NATT = true
+			}
+		case payloadNATD, payloadNATDDraft:
+			results.NATT = true
+		}
+	}
+}
+
+// Scan sends the IKEv1 or IKEv2 request, and records the response. The scan
+// fails if the gateway sends no IKE response.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	spi := random(8)
+	results := new(Results)
+	var resp *message
+	if scanner.config.IKEVersion == 2 {
+		resp, err = scanner.v2Exchange(conn, spi, results)
+	} else {
+		resp, err = scanner.exchange(conn, scanner.v1Request(spi))
+	}
+	if err == ErrInvalidMessage {
+		return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+	}
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	results.record(resp)
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,164 @@
+package ike
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// responderSPI is the SPI of the fake gateway.
+var responderSPI = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+// serve runs a fake gateway answering each request with the payloads
+// returned by respond, or nothing if it returns nil.
+func serve(t *testing.T, respond func(request *message) (byte, []payload)) *testserver.UDPServer {
+	server, err := testserver.NewUDP(func(buf []byte) []byte {
+		request, err := parseMessage(buf)
+		if err != nil {
+			return nil
+		}
+		exchangeType, payloads := respond(request)
+		if payloads == nil {
+			return nil
+		}
+		resp := &message{initiatorSPI: request.initiatorSPI, responderSPI: responderSPI, version: request.version, exchangeType: exchangeType, flags: 0x20, payloads: payloads}
+		return resp.encode()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func scan(t *testing.T, server *testserver.UDPServer, flags *Flags) *Results {
+	defer server.Close()
+	if flags.Mode == "" {
+		flags.Mode = "main"
+	}
+	if flags.Group == 0 {
+		flags.Group = 14
+	}
+	if err := flags.Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	return zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*Results)
+}
+
+func mustHex(s string) []byte {
+	b, _ := hex.DecodeString(s)
+	return b
+}
+
+func TestMainMode(t *testing.T) {
+	server := serve(t, func(request *message) (byte, []payload) {
+		if request.exchangeType != exchangeMain || len(request.payloads) != 3 || request.payloads[0].typ != payloadSA || request.payloads[2].typ != payloadVendorID {
+			return 0, nil
+		}
+		transform := appendAttributes([]byte{1, 1, 0, 0}, []attribute{
+			{attrEncryption, 7}, {attrKeyLength, 256}, {attrHash, 4}, {attrAuthMethod, 1}, {attrGroup, 14}, {attrLifeType, 1}, {attrLifeDuration, 28800},
+		})
+		proposal := appendGeneric([]byte{1, 1, 0, 1}, payloadNone, transform)
+		sa := appendGeneric([]byte{0, 0, 0, 1, 0, 0, 0, 1}, payloadNone, proposal)
+		return exchangeMain, []payload{
+			{payloadSA, sa},
+			{payloadVendorID, mustHex("4a131c81070358455c5728f20e95452f")},
+			{payloadVendorID, mustHex("afcad71368a1f1c96b8696fc77570100")},
+			{payloadVendorID, mustHex("0123456789abcdef")},
+		}
+	})
+	results := scan(t, server, &Flags{IKEVersion: 1})
+	expected := &Transform{Encryption: "AES-CBC", KeyLength: 256, Hash: "SHA2-256", AuthMethod: "PSK", Group: "MODP-2048", LifeDuration: 28800}
+	if results.Version != 1 || results.ExchangeType != "identity_protection" || results.ResponderSPI != "0102030405060708" || !reflect.DeepEqual(results.Transform, expected) {
+		t.Errorf("got %+v, transform %+v", results, results.Transform)
+	}
+	vids := []VendorID{
+		{ID: "4a131c81070358455c5728f20e95452f", Name: "RFC 3947 NAT-T"},
+		{ID: "afcad71368a1f1c96b8696fc77570100", Name: "Dead Peer Detection v1.0"},
+		{ID: "0123456789abcdef"},
+	}
+	if !results.NATT || !reflect.DeepEqual(results.VendorIDs, vids) || !reflect.DeepEqual(results.Payloads, []string{"SA", "VID", "VID", "VID"}) {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestAggressiveModeNoProposal(t *testing.T) {
+	server := serve(t, func(request *message) (byte, []payload) {
+		if request.exchangeType != exchangeAggressive || len(request.payloads) != 6 || len(request.payloads[1].body) != 128 || !bytes.Equal(request.payloads[3].body, encodeV1ID("vpn@example.com")) {
+			return 0, nil
+		}
+		notification := []byte{0, 0, 0, 1, 1, 0, 0, 14}
+		return 5, []payload{{payloadNotify, notification}}
+	})
+	results := scan(t, server, &Flags{IKEVersion: 1, Mode: "aggressive", Group: 2, Identity: "vpn@example.com"})
+	if results.ExchangeType != "informational" || results.Transform != nil || !reflect.DeepEqual(results.Notifications, []Notification{{Type: 14, Name: "NO-PROPOSAL-CHOSEN"}}) {
+		t.Errorf("got %+v", results)
+	}
+}
+
+// v2Accept returns the IKE_SA_INIT response accepting AES-GCM with group.
+func v2Accept(group uint16) []payload {
+	var transforms []byte
+	for i, t := range []v2Transform{{transformEncryption, 20, 256}, {transformPRF, 5, 0}, {transformGroup, group, 0}} {
+		body := []byte{t.typ, 0, 0, 0}
+		binary.BigEndian.PutUint16(body[2:], t.id)
+		if t.keyLength != 0 {
+			body = appendAttributes(body, []attribute{{attrKeyLength, t.keyLength}})
+		}
+		more := byte(3)
+		if i == 2 {
+			more = 0
+		}
+		transforms = appendGeneric(transforms, more, body)
+	}
+	sa := appendGeneric(nil, 0, append([]byte{2, 1, 0, 3}, transforms...))
+	return []payload{
+		{payloadSAv2, sa},
+		{payloadKEv2, encodeV2KE(group, make([]byte, groupSizes[uint32(group)]))},
+		{payloadNoncev2, make([]byte, 32)},
+		{payloadNotifyv2, encodeV2Notify(notifyNATSourceIP, make([]byte, 20))},
+		{payloadNotifyv2, encodeV2Notify(16430, nil)},
+	}
+}
+
+func TestSAInitInvalidKE(t *testing.T) {
+	server := serve(t, func(request *message) (byte, []payload) {
+		if request.exchangeType != exchangeSAInit || request.flags != 0x08 || len(request.payloads) != 5 {
+			return 0, nil
+		}
+		group := binary.BigEndian.Uint16(request.payloads[1].body)
+		if group != 19 {
+			return exchangeSAInit, []payload{{payloadNotifyv2, encodeV2Notify(notifyInvalidKE, []byte{0, 19})}}
+		}
+		if len(request.payloads[1].body) != 4+64 {
+			return 0, nil
+		}
+		return exchangeSAInit, v2Accept(19)
+	})
+	results := scan(t, server, &Flags{IKEVersion: 2})
+	expected := &Transform{Encryption: "AES-GCM-16", KeyLength: 256, PRF: "HMAC-SHA2-256", Group: "ECP-256"}
+	if results.Version != 2 || results.ExchangeType != "ike_sa_init" || !reflect.DeepEqual(results.Transform, expected) || results.PreferredGroup != "ECP-256" {
+		t.Errorf("got %+v, transform %+v", results, results.Transform)
+	}
+	if !results.NATT || len(results.Notifications) != 2 || results.Notifications[1].Name != "IKEV2_FRAGMENTATION_SUPPORTED" {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestSAInitCookie(t *testing.T) {
+	cookie := []byte("cookie-of-the-gateway")
+	server := serve(t, func(request *message) (byte, []payload) {
+		if typ, data, ok := parseV2Notify(request.payloads[0].body); request.payloads[0].typ == payloadNotifyv2 && ok && typ == notifyCookie && bytes.Equal(data, cookie) {
+			return exchangeSAInit, []payload{{payloadNotifyv2, encodeV2Notify(14, nil)}}
+		}
+		return exchangeSAInit, []payload{{payloadNotifyv2, encodeV2Notify(notifyCookie, cookie)}}
+	})
+	results := scan(t, server, &Flags{IKEVersion: 2})
+	if !results.Cookie || results.NATT || !reflect.DeepEqual(results.Notifications, []Notification{{Type: 14, Name: "NO_PROPOSAL_CHOSEN"}}) {
+		t.Errorf("got %+v", results)
+	}
+}
@@ -0,0 +1,131 @@
+package ike
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The IKEv1 transform attribute types.
+const (
+	attrEncryption   = 1
+	attrHash         = 2
+	attrAuthMethod   = 3
+	attrGroup        = 4
+	attrLifeType     = 11
+	attrLifeDuration = 12
+	attrKeyLength    = 14
+)
+
+// The IKEv1 identification type of the aggressive mode identity.
+const idUserFQDN = 3
+
+// v1Ciphers lists the encryption algorithms and key lengths proposed.
+var v1Ciphers = []struct {
+	id        uint32
+	keyLength uint32
+}{
+	{7, 256},
+	{7, 128},
+	{5, 0},
+}
+
+// The hash algorithms, authentication methods and groups proposed in main
+// mode. Aggressive mode only proposes the group of its KE payload.
+var (
+	v1ProposedHashes      = []uint32{4, 2, 1}
+	v1ProposedAuthMethods = []uint32{1, 3}
+	v1ProposedGroups      = []uint32{14, 2}
+)
+
+// v1VendorIDs lists the vendor IDs sent, announcing NAT traversal.
+var v1VendorIDs = []string{
+	"4a131c81070358455c5728f20e95452f",
+	"90cb80913ebb696e086381b5ec427b1f",
+}
+
+// errInvalidSA is returned if an SA payload cannot be parsed.
+var errInvalidSA = errors.New("invalid SA payload")
+
+// encodeV1SA returns the body of the SA payload proposing every combination
+// of the ciphers, hashes and authentication methods with groups.
+func encodeV1SA(groups []uint32) []byte {
+	var transforms [][]byte
+	for _, c := range v1Ciphers {
+		for _, h := range v1ProposedHashes {
+			for _, a := range v1ProposedAuthMethods {
+				for _, g := range groups {
+					attributes := []attribute{{attrEncryption, c.id}}
+					if c.keyLength != 0 {
+						attributes = append(attributes, attribute{attrKeyLength, c.keyLength})
+					}
+					attributes = append(attributes, attribute{attrHash, h}, attribute{attrAuthMethod, a}, attribute{attrGroup, g},
+						attribute{attrLifeType, 1}, attribute{attrLifeDuration, 28800})
+					// The transform number, KEY_IKE, and two reserved bytes.
+					body := []byte{byte(len(transforms) + 1), 1, 0, 0}
+					transforms = append(transforms, appendAttributes(body, attributes))
+				}
+			}
+		}
+	}
+	// The proposal number, PROTO_ISAKMP, no SPI, and the transforms.
+	proposal := []byte{1, 1, 0, byte(len(transforms))}
+	for i, t := range transforms {
+		next := byte(payloadTransform)
+		if i == len(transforms)-1 {
+			next = payloadNone
+		}
+		proposal = appendGeneric(proposal, next, t)
+	}
+	// The IPsec DOI, and the SIT_IDENTITY_ONLY situation.
+	sa := []byte{0, 0, 0, 1, 0, 0, 0, 1}
+	return appendGeneric(sa, payloadNone, proposal)
+}
+
+// parseV1SA parses the transform of the first proposal of an SA payload.
+func parseV1SA(body []byte) (*Transform, error) {
+	if len(body) < 8+genericHeaderLength+4 {
+		return nil, errInvalidSA
+	}
+	proposal := body[8+genericHeaderLength:]
+	spiSize := int(proposal[2])
+	if len(proposal) < 4+spiSize+genericHeaderLength+4 {
+		return nil, errInvalidSA
+	}
+	transform := proposal[4+spiSize:]
+	length := int(binary.BigEndian.Uint16(transform[2:]))
+	if length < genericHeaderLength+4 || length > len(transform) {
+		return nil, errInvalidSA
+	}
+	t := new(Transform)
+	for _, a := range parseAttributes(transform[genericHeaderLength+4 : length]) {
+		switch a.typ {
+		case attrEncryption:
+			t.Encryption = name(v1Encryptions, a.value)
+		case attrKeyLength:
+			t.KeyLength = uint16(a.value)
+		case attrHash:
+			t.Hash = name(v1Hashes, a.value)
+		case attrAuthMethod:
+			t.AuthMethod = name(v1AuthMethods, a.value)
+		case attrGroup:
+			t.Group = name(groups, a.value)
+		case attrLifeDuration:
+			t.LifeDuration = a.value
+		}
+	}
+	return t, nil
+}
+
+// encodeV1ID returns the body of the ID payload of identity, as a user FQDN.
+func encodeV1ID(identity string) []byte {
+	return append([]byte{idUserFQDN, 0, 0, 0}, identity...)
+}
+
+// parseV1Notify parses the type and data of a notification payload: the DOI,
+// the protocol ID, the SPI size, the type, the SPI, and the data.
+func parseV1Notify(body []byte) (uint16, []byte, bool) {
+	if len(body) < 8 || len(body) < 8+int(body[5]) {
+		return 0, nil, false
+	}
+	return binary.BigEndian.Uint16(body[6:]), body[8+int(body[5]):], true
+}
@@ -0,0 +1,167 @@
+package ike
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"net"
+	"strconv"
+)
+
+// The IKEv2 transform types.
+const (
+	transformEncryption = 1
+	transformPRF        = 2
+	transformIntegrity  = 3
+	transformGroup      = 4
+)
+
+// v2Transform is a transform of an IKEv2 proposal.
+type v2Transform struct {
+	typ       byte
+	id        uint16
+	keyLength uint32
+}
+
+// v2Groups lists the groups proposed, after the group of the KE payload.
+var v2Groups = []uint16{14, 19, 20, 21, 15, 16, 5, 2}
+
+// v2Proposals lists the transforms of the proposals, without the groups: AES
+// and 3DES with HMACs, then AES-GCM.
+var v2Proposals = [][]v2Transform{
+	{
+		{transformEncryption, 12, 256},
+		{transformEncryption, 12, 128},
+		{transformEncryption, 3, 0},
+		{transformPRF, 5, 0},
+		{transformPRF, 6, 0},
+		{transformPRF, 2, 0},
+		{transformIntegrity, 12, 0},
+		{transformIntegrity, 13, 0},
+		{transformIntegrity, 2, 0},
+	},
+	{
+		{transformEncryption, 20, 256},
+		{transformEncryption, 20, 128},
+		{transformPRF, 5, 0},
+		{transformPRF, 6, 0},
+		{transformPRF, 2, 0},
+	},
+}
+
+// encodeV2SA returns the body of the SA payload, with group first in the
+// groups of each proposal.
+func encodeV2SA(group uint16) []byte {
+	groupTransforms := []v2Transform{{transformGroup, group, 0}}
+	for _, g := range v2Groups {
+		if g != group {
+			groupTransforms = append(groupTransforms, v2Transform{transformGroup, g, 0})
+		}
+	}
+	var sa []byte
+	for i, p := range v2Proposals {
+		transforms := append(append([]v2Transform{}, p...), groupTransforms...)
+		// The proposal number, IKE, no SPI, and the transforms.
+		proposal := []byte{byte(i + 1), 1, 0, byte(len(transforms))}
+		for j, t := range transforms {
+			body := []byte{t.typ, 0, 0, 0}
+			binary.BigEndian.PutUint16(body[2:], t.id)
+			if t.keyLength != 0 {
+				body = appendAttributes(body, []attribute{{attrKeyLength, t.keyLength}})
+			}
+			// The first byte of the header is 3 if more transforms follow.
+			more := byte(3)
+			if j == len(transforms)-1 {
+				more = 0
+			}
+			proposal = appendGeneric(proposal, more, body)
+		}
+		// The first byte of the header is 2 if more proposals follow.
+		more := byte(2)
+		if i == len(v2Proposals)-1 {
+			more = 0
+		}
+		sa = appendGeneric(sa, more, proposal)
+	}
+	return sa
+}
+
+// parseV2SA parses the transforms of the first proposal of an SA payload.
+func parseV2SA(body []byte) (*Transform, error) {
+	if len(body) < genericHeaderLength+4 {
+		return nil, errInvalidSA
+	}
+	length := int(binary.BigEndian.Uint16(body[2:]))
+	spiSize := int(body[genericHeaderLength+2])
+	if length > len(body) || length < genericHeaderLength+4+spiSize {
+		return nil, errInvalidSA
+	}
+	transforms := body[genericHeaderLength+4+spiSize : length]
+	t := new(Transform)
+	for len(transforms) >= genericHeaderLength+4 {
+		size := int(binary.BigEndian.Uint16(transforms[2:]))
+		if size < genericHeaderLength+4 || size > len(transforms) {
+			return nil, errInvalidSA
+		}
+		id := uint32(binary.BigEndian.Uint16(transforms[genericHeaderLength+2:]))
+		switch transforms[genericHeaderLength] {
+		case transformEncryption:
+			t.Encryption = name(v2Encryptions, id)
+			for _, a := range parseAttributes(transforms[genericHeaderLength+4 : size]) {
+				if a.typ == attrKeyLength {
+					t.KeyLength = uint16(a.value)
+				}
+			}
+		case transformPRF:
+			t.PRF = name(v2PRFs, id)
+		case transformIntegrity:
+			t.Integrity = name(v2Integrities, id)
+		case transformGroup:
+			t.Group = name(groups, id)
+		}
+		transforms = transforms[size:]
+	}
+	return t, nil
+}
+
+// encodeV2KE returns the body of the KE payload of group, with data.
+func encodeV2KE(group uint16, data []byte) []byte {
+	body := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint16(body, group)
+	return append(body, data...)
+}
+
+// encodeV2Notify returns the body of a notify payload without SPI.
+func encodeV2Notify(typ uint16, data []byte) []byte {
+	body := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint16(body[2:], typ)
+	return append(body, data...)
+}
+
+// parseV2Notify parses the type and data of a notify payload: the protocol
+// ID, the SPI size, the type, the SPI, and the data.
+func parseV2Notify(body []byte) (uint16, []byte, bool) {
+	if len(body) < 4 || len(body) < 4+int(body[1]) {
+		return 0, nil, false
+	}
+	return binary.BigEndian.Uint16(body[2:]), body[4+int(body[1]):], true
+}
+
+// natDetection returns the data of the NAT detection notify of addr: the
+// SHA-1 hash of the SPIs, the IP address and the port.
+func natDetection(initiatorSPI []byte, addr net.Addr) []byte {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return make([]byte, sha1.Size)
+	}
+	ip := net.ParseIP(host)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	p, _ := strconv.Atoi(port)
+	h := sha1.New()
+	h.Write(initiatorSPI)
+	h.Write(make([]byte, 8))
+	h.Write(ip)
+	h.Write([]byte{byte(p >> 8), byte(p)})
+	return h.Sum(nil)
+}
@@ -0,0 +1,181 @@
+package imap
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/auth"
+	"github.com/zmap/zgrab2/lib/sasl"
+)
+
+// Capabilities are the capabilities listed by the server in its response to
+// CAPABILITY (RFC 3501, section 7.2.1).
+type Capabilities struct {
+	// List is the capabilities, as listed (e.g. IMAP4rev1, IDLE,
+	// AUTH=PLAIN).
+	List []string `json:"list,omitempty"`
+
+	// AuthMechanisms are the SASL mechanisms of the AUTH= capabilities.
+	AuthMechanisms []string `json:"auth_mechanisms,omitempty"`
+
+	StartTLS bool `json:"starttls,omitempty"`
+
+	// LoginDisabled is true if the server refuses the LOGIN command (until
+	// TLS is negotiated).
+	LoginDisabled bool `json:"login_disabled,omitempty"`
+}
+
+// parseCapabilities returns the capabilities of the untagged CAPABILITY
+// responses in response, or nil if there is none.
+func parseCapabilities(response string) *Capabilities {
+	var caps *Capabilities
+	for _, line := range strings.Split(response, "\r\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "*" || !strings.EqualFold(fields[1], "CAPABILITY") {
+			continue
+		}
+		if caps == nil {
+			caps = new(Capabilities)
+		}
+		for _, capability := range fields[2:] {
+			caps.List = append(caps.List, capability)
+			upper := strings.ToUpper(capability)
+			switch {
+			case strings.HasPrefix(upper, "AUTH="):
+				caps.AuthMechanisms = append(caps.AuthMechanisms, upper[5:])
+			case upper == "STARTTLS":
+				caps.StartTLS = true
+			case upper == "LOGINDISABLED":
+				caps.LoginDisabled = true
+			}
+		}
+	}
+	return caps
+}
+
+// nextTag returns the tag of a new command. The tags of the commands sent
+// with SendCommand are a001.
+func (conn *Connection) nextTag() string {
+	conn.tags++
+	return fmt.Sprintf("a%03d", conn.tags+1)
+}
+
+// ReadTaggedResponse reads from the connection until the line completing the
+// command tagged tag, or a continuation request.
+func (conn *Connection) ReadTaggedResponse(tag string) (string, error) {
+	end := regexp.MustCompile(`(?:^|\r\n)(?:` + regexp.QuoteMeta(tag) + ` |\+)[^\r\n]*\r\n$`)
+	ret := make([]byte, readBufferSize)
+	n, err := zgrab2.ReadUntilRegex(conn.Conn, ret, end)
+	if err != nil {
+		return "", err
+	}
+	return string(ret[:n]), nil
+}
+
+// lastLine returns the last line of a response.
+func lastLine(response string) string {
+	response = strings.TrimSuffix(response, "\r\n")
+	if i := strings.LastIndex(response, "\r\n"); i >= 0 {
+		return response[i+2:]
+	}
+	return response
+}
+
+// GetCapabilities sends the CAPABILITY command and returns the response.
+func (conn *Connection) GetCapabilities() (string, error) {
+	tag := conn.nextTag()
+	if _, err := conn.Conn.Write([]byte(tag + " CAPABILITY\r\n")); err != nil {
+		return "", err
+	}
+	return conn.ReadTaggedResponse(tag)
+}
+
+// quote returns s as an IMAP quoted string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// sendLogin sends the LOGIN command, and returns whether it succeeded and the
+// server's response.
+func (conn *Connection) sendLogin(username, password string) (bool, string, error) {
+	tag := conn.nextTag()
+	if _, err := conn.Conn.Write([]byte(tag + " LOGIN " + quote(username) + " " + quote(password) + "\r\n")); err != nil {
+		return false, "", err
+	}
+	ret, err := conn.ReadTaggedResponse(tag)
+	if err != nil {
+		return false, "", err
+	}
+	last := lastLine(ret)
+	return strings.HasPrefix(last, tag+" OK"), last, nil
+}
+
+// authenticate sends the AUTHENTICATE command with the mechanism of client,
+// answers the server's challenges, and returns whether it succeeded and the
+// server's final response.
+func (conn *Connection) authenticate(mechanism string, client sasl.Client) (bool, string, error) {
+	tag := conn.nextTag()
+	if _, err := conn.Conn.Write([]byte(tag + " AUTHENTICATE " + mechanism + "\r\n")); err != nil {
+		return false, "", err
+	}
+	for {
+		ret, err := conn.ReadTaggedResponse(tag)
+		if err != nil {
+			return false, "", err
+		}
+		last := lastLine(ret)
+		if !strings.HasPrefix(last, "+") {
+			return strings.HasPrefix(last, tag+" OK"), last, nil
+		}
+		// An invalid challenge, or one the mechanism cannot answer, cancels
+		// the exchange.
+		answer := "*"
+		if challenge, err := base64.StdEncoding.DecodeString(strings.TrimSpace(last[1:])); err == nil {
+			if response, err := client.Next(challenge); err == nil {
+				answer = base64.StdEncoding.EncodeToString(response)
+			}
+		}
+		if _, err := conn.Conn.Write([]byte(answer + "\r\n")); err != nil {
+			return false, "", err
+		}
+	}
+}
+
+// Login attempts each credential in turn, with the SASL mechanisms
+// advertised in caps, then with the LOGIN command (unless it is disabled),
+// until one logs in.
+func (conn *Connection) Login(caps *Capabilities, creds []*auth.Credential) (*sasl.Result, error) {
+	result := new(sasl.Result)
+	if caps != nil {
+		result.Advertised = caps.AuthMechanisms
+	}
+	for _, cred := range creds {
+		for _, mechanism := range sasl.Mechanisms {
+			client := sasl.NewClient(mechanism, cred.Username, cred.Password, cred.Token)
+			if client == nil || !result.Advertises(mechanism) {
+				continue
+			}
+			ok, ret, err := conn.authenticate(mechanism, client)
+			if err != nil {
+				return result, err
+			}
+			if result.Add(sasl.Attempt{Username: cred.Username, Command: "AUTHENTICATE", Mechanism: mechanism, Success: ok, Response: ret}) {
+				return result, nil
+			}
+		}
+		if cred.Token != "" || (caps != nil && caps.LoginDisabled) {
+			continue
+		}
+		ok, ret, err := conn.sendLogin(cred.Username, cred.Password)
+		if err != nil {
+			return result, err
+		}
+		if result.Add(sasl.Attempt{Username: cred.Username, Command: "LOGIN", Success: ok, Response: ret}) {
+			return result, nil
+		}
+	}
+	return result, nil
+}
@@ -16,6 +16,9 @@ const readBufferSize int = 0x10000
 // Connection wraps the state and access to the SMTP connection.
 type Connection struct {
 	Conn net.Conn
+
+	// tags is the number of commands sent with tags from nextTag.
+	tags int
 }
 
 // ReadResponse reads from the connection until it matches the imapEndRegex. Copied from the original zgrab.
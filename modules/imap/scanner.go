@@ -12,6 +12,13 @@
 // --imaps does not change the default port number from 143, so
 // it should usually be coupled with e.g. --port 993.
 //
+// The --send-capability flag tells the scanner to send the CAPABILITY
+// command, and again after STARTTLS.
+//
+// The --creds-file flag tells the scanner to attempt to log in with the
+// credentials of the target, with the advertised AUTHENTICATE mechanisms
+// and the LOGIN command.
+//
 // The --send-close flag tells the scanner to send a CLOSE command
 // before disconnecting.
 //
@@ -23,13 +30,16 @@
 package imap
 
 import (
+	"context"
 	"fmt"
 	"errors"
-
+	"net"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/auth"
+	"github.com/zmap/zgrab2/lib/sasl"
 )
 
 // ScanResults instances are returned by the module's Scan function.
@@ -40,6 +50,19 @@ type ScanResults struct {
 	// StartTLS is the server's response to the STARTTLS command, if it is sent.
 	StartTLS string `json:"starttls,omitempty"`
 
+	// CAPABILITY is the server's response to the CAPABILITY command, if it
+	// is sent, and Capabilities the capabilities it lists.
+	CAPABILITY   string        `json:"capability,omitempty"`
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+
+	// CAPABILITYTLS is the server's response to the CAPABILITY command sent
+	// after STARTTLS, and TLSCapabilities the capabilities it lists.
+	CAPABILITYTLS   string        `json:"capability_tls,omitempty"`
+	TLSCapabilities *Capabilities `json:"tls_capabilities,omitempty"`
+
+	// Auth is the outcome of the login attempts, if --creds-file is set.
+	Auth *sasl.Result `json:"auth,omitempty"`
+
 	// CLOSE is the server's response to the CLOSE command, if it is sent.
 	CLOSE string `json:"close,omitempty"`
 
@@ -62,6 +85,12 @@ type Flags struct {
 	// StartTLS indicates that the client should attempt to update the connection to TLS.
 	StartTLS bool `long:"starttls" description:"Send STLS before negotiating"`
 
+	// SendCAPABILITY indicates that the CAPABILITY command should be sent.
+	SendCAPABILITY bool `long:"send-capability" description:"Send the CAPABILITY command (again after STARTTLS)"`
+
+	// CredsFile holds the credentials to attempt to log in with.
+	CredsFile string `long:"creds-file" description:"File of credentials (host username:password... or host bearer:token per line, as for the http module) attempted with the advertised AUTHENTICATE mechanisms (PLAIN, LOGIN, CRAM-MD5, OAUTHBEARER) and LOGIN. Implies --send-capability."`
+
 	// Verbose indicates that there should be more verbose logging.
 	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
 }
@@ -73,6 +102,7 @@ type Module struct {
 // Scanner implements the zgrab2.Scanner interface.
 type Scanner struct {
 	config *Flags
+	creds  *auth.Credentials
 }
 
 // RegisterModule registers the zgrab2 module.
@@ -94,6 +124,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Fetch an IMAP banner, optionally over TLS"
@@ -107,6 +142,12 @@ func (flags *Flags) Validate(args []string) error {
 		log.Error("Cannot send both --starttls and --imaps")
 		return zgrab2.ErrInvalidArguments
 	}
+	if flags.CredsFile != "" {
+		flags.SendCAPABILITY = true
+	}
+	if flags.StartTLS {
+		return flags.TLSFlags.CheckRedial("--starttls")
+	}
 	return nil
 }
 
@@ -119,6 +160,13 @@ func (flags *Flags) Help() string {
 func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	f, _ := flags.(*Flags)
 	scanner.config = f
+	if f.CredsFile != "" {
+		creds, err := auth.ReadFile(f.CredsFile)
+		if err != nil {
+			return err
+		}
+		scanner.creds = creds
+	}
 	return nil
 }
 
@@ -177,19 +225,24 @@ func VerifyIMAPContents(banner string) zgrab2.ScanStatus {
 // 2. If --imaps is set, perform a TLS handshake using the command-line
 //    flags.
 // 3. Read the banner.
+// 4. If --send-capability is sent, send CAPABILITY, read the result.
 // 6. If --starttls is sent, send a001 STARTTLS, read the result, negotiate a
-//    TLS connection using the command-line flags.
-// 7. If --send-close is sent, send a001 CLOSE and read the result.
-// 8. Close the connection.
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	c, err := target.Open(&scanner.config.BaseFlags)
+//    TLS connection using the command-line flags, and send CAPABILITY again.
+// 7. If --creds-file is sent, attempt to log in with the credentials of the
+//    target.
+// 8. If --send-close is sent, send a001 CLOSE and read the result.
+// 9. Close the connection.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	c, err := target.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
 	defer c.Close()
 	result := &ScanResults{}
 	if scanner.config.IMAPSecure {
-		tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(c)
+		tlsConn, err := scanner.config.TLSFlags.GetTLSConnectionForTarget(c, nil, func() (net.Conn, error) {
+			return target.Open(ctx, &scanner.config.BaseFlags)
+		})
 		if err != nil {
 			return zgrab2.TryGetScanStatus(err), nil, err
 		}
@@ -211,6 +264,18 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		return sr, nil, errors.New("Invalid response for IMAP")
 	}
 	result.Banner = banner
+	caps := parseCapabilities(banner)
+	if scanner.config.SendCAPABILITY {
+		ret, err := conn.GetCapabilities()
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+		result.CAPABILITY = ret
+		if c := parseCapabilities(ret); c != nil {
+			caps = c
+		}
+		result.Capabilities = caps
+	}
 	if scanner.config.StartTLS {
 		ret, err := conn.SendCommand("a001 STARTTLS")
 		if err != nil {
@@ -229,6 +294,22 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 			return zgrab2.TryGetScanStatus(err), result, err
 		}
 		conn.Conn = tlsConn
+		// The capabilities may change once TLS is negotiated.
+		if scanner.config.SendCAPABILITY {
+			ret, err := conn.GetCapabilities()
+			if err != nil {
+				return zgrab2.TryGetScanStatus(err), result, err
+			}
+			result.CAPABILITYTLS = ret
+			caps = parseCapabilities(ret)
+			result.TLSCapabilities = caps
+		}
+	}
+	if creds := scanner.creds.For(&target, scanner.config.Port); len(creds) > 0 {
+		result.Auth, err = conn.Login(caps, creds)
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
 	}
 	if scanner.config.SendCLOSE {
 		ret, err := conn.SendCommand("a001 CLOSE")
@@ -0,0 +1,93 @@
+package imap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/sasl"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// serve runs a fake IMAP server accepting the password secret for tim, with
+// AUTHENTICATE PLAIN only.
+func serve(t *testing.T) *testserver.Server {
+	handler := func(conn net.Conn) error {
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				// The scanner closes the connection once done.
+				return nil
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				return fmt.Errorf("got command %q", line)
+			}
+			tag, cmd := fields[0], strings.Join(fields[1:], " ")
+			switch {
+			case cmd == "CAPABILITY":
+				fmt.Fprintf(conn, "* CAPABILITY IMAP4rev1 IDLE AUTH=PLAIN AUTH=GSSAPI\r\n%s OK CAPABILITY completed\r\n", tag)
+			case cmd == "AUTHENTICATE PLAIN":
+				fmt.Fprintf(conn, "+ \r\n")
+				answer, _ := reader.ReadString('\n')
+				response, _ := base64.StdEncoding.DecodeString(strings.TrimSpace(answer))
+				if string(response) == "\x00tim\x00secret" {
+					fmt.Fprintf(conn, "%s OK AUTHENTICATE completed\r\n", tag)
+				} else {
+					fmt.Fprintf(conn, "%s NO AUTHENTICATE failed\r\n", tag)
+				}
+			case strings.HasPrefix(cmd, "LOGIN "):
+				fmt.Fprintf(conn, "%s NO LOGIN failed\r\n", tag)
+			default:
+				fmt.Fprintf(conn, "%s BAD unknown command\r\n", tag)
+			}
+		}
+	}
+	server, err := testserver.New(testserver.Config{Banner: []byte("* OK IMAP4rev1 Service Ready\r\n"), Handler: handler})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func TestLogin(t *testing.T) {
+	credsFile, err := ioutil.TempFile("", "creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(credsFile.Name())
+	credsFile.WriteString("127.0.0.1 tim:wrong tim:secret\n")
+	credsFile.Close()
+
+	server := serve(t)
+	defer server.Close()
+	flags := &Flags{CredsFile: credsFile.Name()}
+	if err := flags.Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	result := zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*ScanResults)
+	expectedCaps := &Capabilities{List: []string{"IMAP4rev1", "IDLE", "AUTH=PLAIN", "AUTH=GSSAPI"}, AuthMechanisms: []string{"PLAIN", "GSSAPI"}}
+	if !reflect.DeepEqual(result.Capabilities, expectedCaps) {
+		t.Errorf("got capabilities %+v", result.Capabilities)
+	}
+	expected := &sasl.Result{
+		Advertised: []string{"PLAIN", "GSSAPI"},
+		Accepted:   "PLAIN",
+		Attempts: []sasl.Attempt{
+			{Username: "tim", Command: "AUTHENTICATE", Mechanism: "PLAIN", Response: "a003 NO AUTHENTICATE failed"},
+			{Username: "tim", Command: "LOGIN", Response: "a004 NO LOGIN failed"},
+			{Username: "tim", Command: "AUTHENTICATE", Mechanism: "PLAIN", Success: true, Response: "a005 OK AUTHENTICATE completed"},
+		},
+	}
+	if !reflect.DeepEqual(result.Auth, expected) {
+		t.Errorf("got %+v", result.Auth)
+	}
+}
@@ -0,0 +1,191 @@
+package ipmi
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The RMCP header of IPMI messages: version 6, no acknowledgement, class 7.
+var rmcpHeader = []byte{0x06, 0x00, 0xff, 0x07}
+
+// The authentication types of the session header.
+const (
+	authTypeNone  = 0x00
+	authTypeRMCPP = 0x06
+)
+
+// The RMCP+ payload types.
+const (
+	payloadOpenSessionRequest  = 0x10
+	payloadOpenSessionResponse = 0x11
+)
+
+const (
+	// cmdGetChannelAuthCapabilities is the command of the App network
+	// function (6) reading the authentication capabilities of a channel.
+	cmdGetChannelAuthCapabilities = 0x38
+
+	// currentChannel, with the bit requesting the IPMI 2.0 extended data.
+	currentChannel = 0x8e
+
+	// privilegeAdmin is the administrator privilege level.
+	privilegeAdmin = 0x04
+)
+
+// ErrInvalidResponse is returned if the response is not an IPMI response to
+// the request.
+var ErrInvalidResponse = errors.New("invalid IPMI response")
+
+// authTypeNames names the bits of the authentication type support byte.
+var authTypeNames = []struct {
+	bit  byte
+	name string
+}{
+	{0x01, "none"},
+	{0x02, "md2"},
+	{0x04, "md5"},
+	{0x10, "password"},
+	{0x20, "oem"},
+}
+
+// openSessionStatuses names the status codes of RMCP+ (IPMI 2.0, section
+// 13.24).
+var openSessionStatuses = map[byte]string{
+	0x00: "no errors",
+	0x01: "insufficient resources to create a session",
+	0x02: "invalid session ID",
+	0x03: "invalid payload type",
+	0x04: "invalid authentication algorithm",
+	0x05: "invalid integrity algorithm",
+	0x06: "no matching authentication payload",
+	0x07: "no matching integrity payload",
+	0x08: "inactive session ID",
+	0x09: "invalid role",
+	0x0a: "unauthorized role or privilege level requested",
+	0x0b: "insufficient resources to create a session at the requested role",
+	0x0c: "invalid name length",
+	0x0d: "unauthorized name",
+	0x0e: "unauthorized GUID",
+	0x0f: "invalid integrity check value",
+	0x10: "invalid confidentiality algorithm",
+	0x11: "no cipher suite match with proposed security algorithms",
+	0x12: "illegal or unrecognized parameter",
+}
+
+// oemNames names the IANA enterprise numbers of common BMC vendors.
+var oemNames = map[uint32]string{
+	2:     "IBM",
+	9:     "Cisco",
+	11:    "Hewlett-Packard",
+	42:    "Sun Microsystems",
+	343:   "Intel",
+	674:   "Dell",
+	2011:  "Huawei",
+	10876: "Super Micro",
+	19046: "Lenovo",
+	20974: "American Megatrends",
+}
+
+// checksum returns the two's complement checksum of data.
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return -sum
+}
+
+// encodeGetChannelAuthCapabilities returns the session-less IPMI 1.5
+// request of the authentication capabilities of the current channel.
+func encodeGetChannelAuthCapabilities() []byte {
+	header := []byte{0x20, 0x06 << 2}
+	body := []byte{0x81, 0x00, cmdGetChannelAuthCapabilities, currentChannel, privilegeAdmin}
+	msg := append(append(header, checksum(header)), body...)
+	msg = append(msg, checksum(body))
+	packet := append([]byte{}, rmcpHeader...)
+	// The session header: no authentication, sequence number and session ID
+	// of zero.
+	packet = append(packet, authTypeNone, 0, 0, 0, 0, 0, 0, 0, 0, byte(len(msg)))
+	return append(packet, msg...)
+}
+
+// encodeOpenSession returns the RMCP+ Open Session request proposing cipher
+// suite zero: no authentication, integrity or confidentiality.
+func encodeOpenSession(tag byte, consoleID uint32) []byte {
+	payload := []byte{tag, 0x00, 0x00, 0x00, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(payload[4:], consoleID)
+	for typ := byte(0); typ < 3; typ++ {
+		// The payload type, two reserved bytes, the length (8), the
+		// algorithm (0) and three reserved bytes.
+		payload = append(payload, typ, 0, 0, 8, 0, 0, 0, 0)
+	}
+	packet := append([]byte{}, rmcpHeader...)
+	packet = append(packet, authTypeRMCPP, payloadOpenSessionRequest, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint16(packet[len(packet)-2:], uint16(len(payload)))
+	return append(packet, payload...)
+}
+
+// capabilities is the response to Get Channel Authentication Capabilities.
+type capabilities struct {
+	completionCode byte
+	data           []byte
+}
+
+// parseCapabilities parses the response to Get Channel Authentication
+// Capabilities.
+func parseCapabilities(packet []byte) (*capabilities, error) {
+	if len(packet) < 14 || packet[0] != rmcpHeader[0] || packet[3] != rmcpHeader[3] {
+		return nil, ErrInvalidResponse
+	}
+	offset := 4 + 1 + 4 + 4
+	if packet[4] != authTypeNone {
+		// The authentication code follows the session ID.
+		offset += 16
+	}
+	if len(packet) <= offset {
+		return nil, ErrInvalidResponse
+	}
+	length := int(packet[offset])
+	msg := packet[offset+1:]
+	if len(msg) < length || length < 8 {
+		return nil, ErrInvalidResponse
+	}
+	msg = msg[:length]
+	// rqAddr, netFn/rqLUN, checksum, rsAddr, rqSeq/rsLUN, command,
+	// completion code, data and checksum.
+	if msg[1]>>2 != 0x07 || msg[5] != cmdGetChannelAuthCapabilities {
+		return nil, ErrInvalidResponse
+	}
+	return &capabilities{completionCode: msg[6], data: msg[7 : len(msg)-1]}, nil
+}
+
+// openSessionResponse is the RMCP+ Open Session response.
+type openSessionResponse struct {
+	tag    byte
+	status byte
+
+	// algorithms holds the authentication, integrity and confidentiality
+	// algorithms of the session, if it was opened.
+	algorithms []byte
+}
+
+// parseOpenSession parses the RMCP+ Open Session response.
+func parseOpenSession(packet []byte) (*openSessionResponse, error) {
+	if len(packet) < 16 || packet[0] != rmcpHeader[0] || packet[3] != rmcpHeader[3] {
+		return nil, ErrInvalidResponse
+	}
+	if packet[4] != authTypeRMCPP || packet[5]&0x3f != payloadOpenSessionResponse {
+		return nil, ErrInvalidResponse
+	}
+	length := int(binary.LittleEndian.Uint16(packet[14:]))
+	payload := packet[16:]
+	if len(payload) < length || length < 2 {
+		return nil, ErrInvalidResponse
+	}
+	payload = payload[:length]
+	resp := &openSessionResponse{tag: payload[0], status: payload[1]}
+	if len(payload) >= 36 {
+		resp.algorithms = []byte{payload[16] & 0x3f, payload[24] & 0x3f, payload[32] & 0x3f}
+	}
+	return resp, nil
+}
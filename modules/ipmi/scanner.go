@@ -0,0 +1,259 @@
+// Package ipmi provides a zgrab2 module that reads the authentication
+// capabilities of IPMI BMCs, and checks whether they accept cipher suite zero.
+// Default Port: 623 (UDP)
+//
+// The scanner sends a session-less Get Channel Authentication Capabilities
+// request, which lists the IPMI 1.5 authentication types of the channel, the
+// kinds of logins it allows (anonymous, null or non-null usernames), the IPMI
+// versions it supports, and the OEM ID (the IANA enterprise number of the
+// vendor) for OEM authentication. If the channel supports IPMI 2.0, the
+// scanner then sends an RMCP+ Open Session request proposing cipher suite
+// zero, with no authentication, integrity or confidentiality. A BMC accepting
+// it lets anyone with a valid username log in without the password. The
+// --no-open-session flag skips this request.
+package ipmi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// Flags holds the command-line configuration for the ipmi module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+
+	NoOpenSession bool `long:"no-open-session" description:"Do not send the RMCP+ Open Session request checking cipher suite zero"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// OpenSession is the response to the RMCP+ Open Session request.
+type OpenSession struct {
+	StatusCode uint8  `json:"status_code"`
+	Status     string `json:"status,omitempty"`
+
+	// CipherZero is true if the BMC opened the session with cipher suite
+	// zero.
+	CipherZero bool `json:"cipher_zero"`
+}
+
+// Results is the output of the ipmi module.
+type Results struct {
+	// CompletionCode is the completion code of the response to Get Channel
+	// Authentication Capabilities, if not zero.
+	CompletionCode uint8 `json:"completion_code,omitempty"`
+
+	ChannelNumber uint8 `json:"channel_number"`
+
+	// AuthTypes lists the IPMI 1.5 authentication types of the channel:
+	// none, md2, md5, password and oem.
+	AuthTypes []string `json:"auth_types,omitempty"`
+
+	// IPMI15 and IPMI20 are true if the channel supports IPMI 1.5 and IPMI
+	// 2.0 (RMCP+) connections.
+	IPMI15 bool `json:"ipmi_1_5"`
+	IPMI20 bool `json:"ipmi_2_0"`
+
+	// KGSet is true if the BMC key (K_g) is not the default of zeros.
+	KGSet bool `json:"kg_set"`
+
+	PerMessageAuthDisabled bool `json:"per_message_auth_disabled"`
+	UserLevelAuthDisabled  bool `json:"user_level_auth_disabled"`
+	NonNullUsernames       bool `json:"non_null_usernames"`
+	NullUsernames          bool `json:"null_usernames"`
+	AnonymousLogin         bool `json:"anonymous_login"`
+
+	// OEMID is the IANA enterprise number of the vendor of the OEM
+	// authentication type, OEMName its name, and OEMData the OEM auxiliary
+	// data.
+	OEMID   uint32 `json:"oem_id,omitempty"`
+	OEMName string `json:"oem_name,omitempty"`
+	OEMData uint8  `json:"oem_data,omitempty"`
+
+	// OpenSession is the response to the RMCP+ Open Session request, and
+	// OpenSessionError the error of the request.
+	OpenSession      *OpenSession `json:"open_session,omitempty"`
+	OpenSessionError string       `json:"open_session_error,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("ipmi", "IPMI", module.Description(), 623, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Read the authentication capabilities of an IPMI BMC, and check whether it accepts cipher suite zero"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "ipmi"
+}
+
+// exchange sends request, and returns the response.
+func exchange(conn net.Conn, request []byte) ([]byte, error) {
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// capabilities records the response to Get Channel Authentication
+// Capabilities.
+func (results *Results) capabilities(data []byte) {
+	results.ChannelNumber = data[0]
+	for _, t := range authTypeNames {
+		if data[1]&t.bit != 0 {
+			results.AuthTypes = append(results.AuthTypes, t.name)
+		}
+	}
+	results.KGSet = data[2]&0x20 != 0
+	results.PerMessageAuthDisabled = data[2]&0x10 != 0
+	results.UserLevelAuthDisabled = data[2]&0x08 != 0
+	results.NonNullUsernames = data[2]&0x04 != 0
+	results.NullUsernames = data[2]&0x02 != 0
+	results.AnonymousLogin = data[2]&0x01 != 0
+	if data[1]&0x80 != 0 {
+		// The extended capabilities are only set with IPMI 2.0.
+		results.IPMI15 = data[3]&0x01 != 0
+		results.IPMI20 = data[3]&0x02 != 0
+	} else {
+		results.IPMI15 = true
+	}
+	results.OEMID = uint32(data[4]) | uint32(data[5])<<8 | uint32(data[6])<<16
+	results.OEMName = oemNames[results.OEMID]
+	results.OEMData = data[7]
+}
+
+// openSession sends the RMCP+ Open Session request proposing cipher suite
+// zero.
+func openSession(conn net.Conn) (*OpenSession, error) {
+	tag := byte(rand.Intn(256))
+	packet, err := exchange(conn, encodeOpenSession(tag, rand.Uint32()))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := parseOpenSession(packet)
+	if err != nil {
+		return nil, err
+	}
+	if resp.tag != tag {
+		return nil, ErrInvalidResponse
+	}
+	session := &OpenSession{StatusCode: resp.status, Status: openSessionStatuses[resp.status]}
+	session.CipherZero = resp.status == 0 && bytes.Equal(resp.algorithms, []byte{0, 0, 0})
+	return session, nil
+}
+
+// Scan sends Get Channel Authentication Capabilities, then the RMCP+ Open
+// Session request if the channel supports IPMI 2.0. The scan fails if the
+// first request gets no IPMI response.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	packet, err := exchange(conn, encodeGetChannelAuthCapabilities())
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	resp, err := parseCapabilities(packet)
+	if err != nil {
+		return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+	}
+	results := new(Results)
+	if resp.completionCode != 0 {
+		results.CompletionCode = resp.completionCode
+		return zgrab2.SCAN_APPLICATION_ERROR, results, fmt.Errorf("completion code 0x%02x", resp.completionCode)
+	}
+	if len(resp.data) < 8 {
+		return zgrab2.SCAN_PROTOCOL_ERROR, nil, ErrInvalidResponse
+	}
+	results.capabilities(resp.data)
+	if !results.IPMI20 || scanner.config.NoOpenSession {
+		return zgrab2.SCAN_SUCCESS, results, nil
+	}
+	results.OpenSession, err = openSession(conn)
+	if err != nil {
+		log.Debugf("ipmi: Open Session request to %s failed: %v", target.String(), err)
+		results.OpenSessionError = err.Error()
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
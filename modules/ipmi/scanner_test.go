@@ -0,0 +1,87 @@
+package ipmi
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// serve runs a fake BMC answering Get Channel Authentication Capabilities
+// with data, and the Open Session request with status.
+func serve(t *testing.T, data []byte, status byte) *testserver.UDPServer {
+	server, err := testserver.NewUDP(func(request []byte) []byte {
+		switch {
+		case len(request) == 23 && request[4] == authTypeNone && request[19] == cmdGetChannelAuthCapabilities:
+			msg := []byte{0x81, 0x07 << 2, 0, 0x20, 0, cmdGetChannelAuthCapabilities, 0}
+			msg[2] = checksum(msg[:2])
+			msg = append(msg, data...)
+			msg = append(msg, checksum(msg[3:]))
+			packet := append(append([]byte{}, rmcpHeader...), authTypeNone, 0, 0, 0, 0, 0, 0, 0, 0, byte(len(msg)))
+			return append(packet, msg...)
+		case request[4] == authTypeRMCPP && request[5] == payloadOpenSessionRequest:
+			payload := make([]byte, 36)
+			payload[0] = request[16]
+			payload[1] = status
+			copy(payload[4:8], request[20:24])
+			for i, typ := range []byte{0, 1, 2} {
+				copy(payload[12+8*i:], []byte{typ, 0, 0, 8})
+			}
+			packet := append(append([]byte{}, rmcpHeader...), authTypeRMCPP, payloadOpenSessionResponse, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+			binary.LittleEndian.PutUint16(packet[14:], uint16(len(payload)))
+			return append(packet, payload...)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func scan(t *testing.T, server *testserver.UDPServer) (zgrab2.ScanStatus, *Results, error) {
+	defer server.Close()
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), new(Flags), server.Addr())
+	results, _ := ret.(*Results)
+	return status, results, err
+}
+
+func TestCipherZero(t *testing.T) {
+	status, results, err := scan(t, serve(t, []byte{0x01, 0x97, 0x04, 0x02, 0xa2, 0x02, 0x00, 0x00}, 0))
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if results.ChannelNumber != 1 || !reflect.DeepEqual(results.AuthTypes, []string{"none", "md2", "md5", "password"}) || results.IPMI15 || !results.IPMI20 {
+		t.Errorf("got %+v", results)
+	}
+	if !results.NonNullUsernames || results.NullUsernames || results.AnonymousLogin || results.KGSet || results.OEMID != 674 || results.OEMName != "Dell" {
+		t.Errorf("got %+v", results)
+	}
+	if results.OpenSession == nil || !results.OpenSession.CipherZero || results.OpenSession.Status != "no errors" {
+		t.Errorf("got open session %+v, error %q", results.OpenSession, results.OpenSessionError)
+	}
+}
+
+func TestCipherZeroRejected(t *testing.T) {
+	status, results, err := scan(t, serve(t, []byte{0x01, 0x84, 0x04, 0x03, 0, 0, 0, 0}, 0x11))
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	expected := &OpenSession{StatusCode: 0x11, Status: "no cipher suite match with proposed security algorithms"}
+	if !results.IPMI15 || !results.IPMI20 || !reflect.DeepEqual(results.AuthTypes, []string{"md5"}) || !reflect.DeepEqual(results.OpenSession, expected) {
+		t.Errorf("got %+v, open session %+v", results, results.OpenSession)
+	}
+}
+
+func TestIPMI15(t *testing.T) {
+	status, results, err := scan(t, serve(t, []byte{0x01, 0x15, 0x1f, 0x00, 0, 0, 0, 0}, 0))
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if !results.IPMI15 || results.IPMI20 || !results.AnonymousLogin || !results.NullUsernames || !results.PerMessageAuthDisabled || results.OpenSession != nil {
+		t.Errorf("got %+v", results)
+	}
+}
@@ -4,6 +4,7 @@ package ipp
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
@@ -46,12 +47,17 @@ var (
 )
 
 type scan struct {
+	ctx         context.Context
 	connections []net.Conn
 	transport   *http.Transport
 	client      *http.Client
 	results     ScanResults
 	url         string
 	tls         bool
+
+	// tlsRedialed is true once a TLS connection was given the dialer of the
+	// checks needing new connections, which only run on the first.
+	tlsRedialed bool
 }
 
 //TODO: Tag relevant results and exlain in comments
@@ -134,6 +140,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for printers via IPP"
@@ -459,6 +470,7 @@ func sendIPPRequest(scan *scan, body *bytes.Buffer) (*http.Response, *zgrab2.Sca
 		// TODO: Log the error to see what exactly went wrong
 		return nil, zgrab2.DetectScanError(err)
 	}
+	request = request.WithContext(scan.ctx)
 	request.Header.Set("Accept", "*/*")
 	request.Header.Set("Content-Type", ContentType)
 	resp, err := scan.client.Do(request)
@@ -623,19 +635,31 @@ func (scan *scan) getCheckRedirect(scanner *Scanner) func(*http.Request, *http.R
 
 // Taken from zgrab2 http library, slightly modified to use slightly leaner scan object
 func (scan *scan) getTLSDialer(scanner *Scanner) func(net, addr string) (net.Conn, error) {
-	return func(net, addr string) (net.Conn, error) {
-		outer, err := zgrab2.DialTimeoutConnection(net, addr, scanner.config.BaseFlags.Timeout, 0)
+	return func(network, addr string) (net.Conn, error) {
+		dialer := zgrab2.GetTimeoutConnectionDialer(scanner.config.BaseFlags.Timeout)
+		outer, err := dialer.DialContext(scan.ctx, network, addr)
 		if err != nil {
 			return nil, err
 		}
 		scan.connections = append(scan.connections, outer)
-		tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(outer)
+		var dial func() (net.Conn, error)
+		if !scan.tlsRedialed {
+			scan.tlsRedialed = true
+			dial = func() (net.Conn, error) {
+				return dialer.DialContext(scan.ctx, network, addr)
+			}
+		}
+		tlsConn, err := scanner.config.TLSFlags.GetTLSConnectionForTarget(outer, nil, dial)
 		if err != nil {
 			return nil, err
 		}
 		// lib/http/transport.go fills in the TLSLog in the http.Request instance(s)
 		err = tlsConn.Handshake()
-		scan.results.TLSLog = tlsConn.GetLog()
+		if dial != nil {
+			// The log is that of the first connection, which ran the checks
+			// (the transport usually reuses it for the other requests).
+			scan.results.TLSLog = tlsConn.GetLog()
+		}
 		return tlsConn, err
 	}
 }
@@ -653,8 +677,9 @@ func getHTTPURL(https bool, host string, port uint16, endpoint string) string {
 }
 
 // Adapted from newHTTPScan in zgrab2 http module
-func (scanner *Scanner) newIPPScan(target *zgrab2.ScanTarget, tls bool) *scan {
+func (scanner *Scanner) newIPPScan(ctx context.Context, target *zgrab2.ScanTarget, tls bool) *scan {
 	newScan := scan{
+		ctx:    ctx,
 		client: http.MakeNewClient(),
 	}
 	newScan.results = ScanResults{}
@@ -700,8 +725,8 @@ func (scan *scan) Cleanup() {
 }
 
 // TODO: Do you want to retry with TLS for all versions? Just one's you've already tried? Haven't tried? Just the same version?
-func (scanner *Scanner) tryGrabForVersions(target *zgrab2.ScanTarget, versions []version, tls bool) (*scan, *zgrab2.ScanError) {
-	scan := scanner.newIPPScan(target, tls)
+func (scanner *Scanner) tryGrabForVersions(ctx context.Context, target *zgrab2.ScanTarget, versions []version, tls bool) (*scan, *zgrab2.ScanError) {
+	scan := scanner.newIPPScan(ctx, target, tls)
 	defer scan.Cleanup()
 	var err *zgrab2.ScanError
 	for i := 0; i < len(versions); i++ {
@@ -729,9 +754,9 @@ func (scan *scan) shouldReportResult(scanner *Scanner) bool {
 // Scan TODO: describe how scan operates in appropriate detail
 //1. Send a request (currently get-printer-attributes)
 //2. Take in that response & read out version numbers
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
 	// Try all known IPP versions from newest to oldest until we reach a supported version
-	scan, err := scanner.tryGrabForVersions(&target, Versions, scanner.config.TLSRetry || scanner.config.IPPSecure)
+	scan, err := scanner.tryGrabForVersions(ctx, &target, Versions, scanner.config.TLSRetry || scanner.config.IPPSecure)
 	if err != nil {
 		// If versionNotSupported error was confirmed, the scanner was connecting w/o TLS, so don't retry
 		// Same goes for a protocol error of any kind. It means we got something back but it didn't conform.
@@ -739,7 +764,7 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 			return err.Unpack(&scan.results)
 		}
 		if scanner.config.TLSRetry && !scanner.config.IPPSecure {
-			retry, retryErr := scanner.tryGrabForVersions(&target, Versions, false)
+			retry, retryErr := scanner.tryGrabForVersions(ctx, &target, Versions, false)
 			if retryErr != nil {
 				if retry.shouldReportResult(scanner) {
 					return retryErr.Unpack(&retry.results)
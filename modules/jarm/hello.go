@@ -0,0 +1,325 @@
+package jarm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// The orders of the cipher suites, ALPN protocols and versions of a probe.
+const (
+	orderForward = iota
+	orderReverse
+	orderTopHalf
+	orderBottomHalf
+	orderMiddleOut
+)
+
+// probe is one of the ClientHellos of JARM.
+type probe struct {
+	// version is the version of the ClientHello, 0x0304 for TLS 1.3.
+	version uint16
+
+	// noTLS13 excludes the TLS 1.3 cipher suites.
+	noTLS13 bool
+
+	cipherOrder int
+	grease      bool
+
+	// rareALPN offers only the uncommon ALPN protocols.
+	rareALPN bool
+
+	// supportedVersions is the highest version of the supported_versions
+	// extension, or 0 to leave it out.
+	supportedVersions uint16
+
+	// extensionOrder is the order of the ALPN protocols and versions.
+	extensionOrder int
+}
+
+// probes are the ten ClientHellos of JARM, in order.
+var probes = []probe{
+	{version: 0x0303, cipherOrder: orderForward, supportedVersions: 0x0303, extensionOrder: orderReverse},
+	{version: 0x0303, cipherOrder: orderReverse, supportedVersions: 0x0303, extensionOrder: orderForward},
+	{version: 0x0303, cipherOrder: orderTopHalf, extensionOrder: orderForward},
+	{version: 0x0303, cipherOrder: orderBottomHalf, rareALPN: true, extensionOrder: orderForward},
+	{version: 0x0303, cipherOrder: orderMiddleOut, grease: true, rareALPN: true, extensionOrder: orderReverse},
+	{version: 0x0302, cipherOrder: orderForward, extensionOrder: orderForward},
+	{version: 0x0304, cipherOrder: orderForward, supportedVersions: 0x0304, extensionOrder: orderReverse},
+	{version: 0x0304, cipherOrder: orderReverse, supportedVersions: 0x0304, extensionOrder: orderForward},
+	{version: 0x0304, noTLS13: true, cipherOrder: orderForward, supportedVersions: 0x0304, extensionOrder: orderForward},
+	{version: 0x0304, cipherOrder: orderMiddleOut, grease: true, supportedVersions: 0x0304, extensionOrder: orderReverse},
+}
+
+// ciphers are the cipher suites offered by the probes, in their forward
+// order.
+var ciphers = []uint16{
+	0x0016, 0x0033, 0x0067, 0xc09e, 0xc0a2, 0x009e, 0x0039, 0x006b,
+	0xc09f, 0xc0a3, 0x009f, 0x0045, 0x00be, 0x0088, 0x00c4, 0x009a,
+	0xc008, 0xc009, 0xc023, 0xc0ac, 0xc0ae, 0xc02b, 0xc00a, 0xc024,
+	0xc0ad, 0xc0af, 0xc02c, 0xc072, 0xc073, 0xcca9, 0x1302, 0x1301,
+	0xcc14, 0xc007, 0xc012, 0xc013, 0xc027, 0xc02f, 0xc014, 0xc028,
+	0xc030, 0xc060, 0xc061, 0xc076, 0xc077, 0xcca8, 0x1305, 0x1304,
+	0x1303, 0xcc13, 0xc011, 0x000a, 0x002f, 0x003c, 0xc09c, 0xc0a0,
+	0x009c, 0x0035, 0x003d, 0xc09d, 0xc0a1, 0x009d, 0x0041, 0x00ba,
+	0x0084, 0x00c0, 0x0007, 0x0004, 0x0005,
+}
+
+// alpns are the ALPN protocols offered by the probes, from the weakest to
+// the strongest.
+var alpns = []string{"http/0.9", "http/1.0", "http/1.1", "spdy/1", "spdy/2", "spdy/3", "h2", "h2c", "hq"}
+
+// rareALPNs are the ALPN protocols offered by the probes with rareALPN.
+var rareALPNs = []string{"http/0.9", "http/1.0", "spdy/1", "spdy/2", "spdy/3", "h2c", "hq"}
+
+// errNoServerHello is returned if the response to a probe is not a
+// ServerHello.
+var errNoServerHello = errors.New("response is not a ServerHello")
+
+// reorder returns the elements of s in the given order. The top half is the
+// middle element of an odd-length s, followed by the first half in reverse.
+func reorder(s []interface{}, order int) []interface{} {
+	n := len(s)
+	var out []interface{}
+	switch order {
+	case orderForward:
+		out = append(out, s...)
+	case orderReverse:
+		for i := n - 1; i >= 0; i-- {
+			out = append(out, s[i])
+		}
+	case orderBottomHalf:
+		out = append(out, s[(n+1)/2:]...)
+	case orderTopHalf:
+		if n%2 == 1 {
+			out = append(out, s[n/2])
+		}
+		out = append(out, reorder(reorder(s, orderReverse), orderBottomHalf)...)
+	case orderMiddleOut:
+		middle := n / 2
+		if n%2 == 1 {
+			out = append(out, s[middle])
+			for i := 1; i <= middle; i++ {
+				out = append(out, s[middle+i], s[middle-i])
+			}
+		} else {
+			for i := 1; i <= middle; i++ {
+				out = append(out, s[middle-1+i], s[middle-i])
+			}
+		}
+	}
+	return out
+}
+
+// reorderUint16 returns the values of s in the given order.
+func reorderUint16(s []uint16, order int) []uint16 {
+	in := make([]interface{}, len(s))
+	for i, v := range s {
+		in[i] = v
+	}
+	out := make([]uint16, 0, len(s))
+	for _, v := range reorder(in, order) {
+		out = append(out, v.(uint16))
+	}
+	return out
+}
+
+// reorderString returns the strings of s in the given order.
+func reorderString(s []string, order int) []string {
+	in := make([]interface{}, len(s))
+	for i, v := range s {
+		in[i] = v
+	}
+	out := make([]string, 0, len(s))
+	for _, v := range reorder(in, order) {
+		out = append(out, v.(string))
+	}
+	return out
+}
+
+// grease returns a random GREASE value (RFC 8701).
+func grease() uint16 {
+	n, _ := rand.Int(rand.Reader, big.NewInt(16))
+	v := uint16(n.Int64())<<4 | 0x0a
+	return v<<8 | v
+}
+
+func writeUint16(b *bytes.Buffer, v uint16) {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], v)
+	b.Write(buf[:])
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+// extensions returns the extensions of the probe for host.
+func (p *probe) extensions(host string) []byte {
+	var ext bytes.Buffer
+	if p.grease {
+		writeUint16(&ext, grease())
+		writeUint16(&ext, 0)
+	}
+	name := []byte(host)
+	writeUint16(&ext, 0x0000)
+	writeUint16(&ext, uint16(len(name)+5))
+	writeUint16(&ext, uint16(len(name)+3))
+	ext.WriteByte(0)
+	writeUint16(&ext, uint16(len(name)))
+	ext.Write(name)
+	// extended_master_secret, max_fragment_length (512), renegotiation_info
+	ext.Write([]byte{0x00, 0x17, 0x00, 0x00})
+	ext.Write([]byte{0x00, 0x01, 0x00, 0x01, 0x01})
+	ext.Write([]byte{0xff, 0x01, 0x00, 0x01, 0x00})
+	// supported_groups: x25519, secp256r1, secp384r1, secp521r1
+	ext.Write([]byte{0x00, 0x0a, 0x00, 0x0a, 0x00, 0x08, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x18, 0x00, 0x19})
+	// ec_point_formats: uncompressed; session_ticket
+	ext.Write([]byte{0x00, 0x0b, 0x00, 0x02, 0x01, 0x00})
+	ext.Write([]byte{0x00, 0x23, 0x00, 0x00})
+
+	protocols := alpns
+	if p.rareALPN {
+		protocols = rareALPNs
+	}
+	var list bytes.Buffer
+	for _, proto := range reorderString(protocols, p.extensionOrder) {
+		list.WriteByte(byte(len(proto)))
+		list.WriteString(proto)
+	}
+	writeUint16(&ext, 0x0010)
+	writeUint16(&ext, uint16(list.Len()+2))
+	writeUint16(&ext, uint16(list.Len()))
+	ext.Write(list.Bytes())
+
+	// signature_algorithms
+	ext.Write([]byte{0x00, 0x0d, 0x00, 0x14, 0x00, 0x12,
+		0x04, 0x03, 0x08, 0x04, 0x04, 0x01, 0x05, 0x03, 0x08, 0x05, 0x05, 0x01, 0x08, 0x06, 0x06, 0x01, 0x02, 0x01})
+
+	// key_share: a random x25519 share, after a GREASE share if any.
+	var shares bytes.Buffer
+	if p.grease {
+		writeUint16(&shares, grease())
+		shares.Write([]byte{0x00, 0x01, 0x00})
+	}
+	writeUint16(&shares, 0x001d)
+	writeUint16(&shares, 32)
+	shares.Write(random(32))
+	writeUint16(&ext, 0x0033)
+	writeUint16(&ext, uint16(shares.Len()+2))
+	writeUint16(&ext, uint16(shares.Len()))
+	ext.Write(shares.Bytes())
+
+	// psk_key_exchange_modes: psk_dhe_ke
+	ext.Write([]byte{0x00, 0x2d, 0x00, 0x02, 0x01, 0x01})
+
+	if p.supportedVersions != 0 {
+		var versions bytes.Buffer
+		if p.grease {
+			writeUint16(&versions, grease())
+		}
+		var offered []uint16
+		for v := uint16(0x0301); v <= p.supportedVersions; v++ {
+			offered = append(offered, v)
+		}
+		for _, v := range reorderUint16(offered, p.extensionOrder) {
+			writeUint16(&versions, v)
+		}
+		writeUint16(&ext, 0x002b)
+		writeUint16(&ext, uint16(versions.Len()+1))
+		ext.WriteByte(byte(versions.Len()))
+		ext.Write(versions.Bytes())
+	}
+	return ext.Bytes()
+}
+
+// encode returns the ClientHello record of the probe, with host as its
+// server name.
+func (p *probe) encode(host string) []byte {
+	version := p.version
+	recordVersion := p.version
+	if p.version == 0x0304 {
+		version, recordVersion = 0x0303, 0x0301
+	}
+	var suites []uint16
+	for _, c := range ciphers {
+		if p.noTLS13 && c>>8 == 0x13 {
+			continue
+		}
+		suites = append(suites, c)
+	}
+	suites = reorderUint16(suites, p.cipherOrder)
+	if p.grease {
+		suites = append([]uint16{grease()}, suites...)
+	}
+
+	var hello bytes.Buffer
+	writeUint16(&hello, version)
+	hello.Write(random(32))
+	hello.WriteByte(32)
+	hello.Write(random(32))
+	writeUint16(&hello, uint16(2*len(suites)))
+	for _, c := range suites {
+		writeUint16(&hello, c)
+	}
+	// The compression methods: null.
+	hello.Write([]byte{0x01, 0x00})
+	ext := p.extensions(host)
+	writeUint16(&hello, uint16(len(ext)))
+	hello.Write(ext)
+
+	var record bytes.Buffer
+	record.WriteByte(0x16)
+	writeUint16(&record, recordVersion)
+	writeUint16(&record, uint16(hello.Len()+4))
+	record.WriteByte(0x01)
+	record.Write([]byte{byte(hello.Len() >> 16), byte(hello.Len() >> 8), byte(hello.Len())})
+	record.Write(hello.Bytes())
+	return record.Bytes()
+}
+
+// parseServerHello returns the JARM component of a ServerHello handshake
+// message: the selected cipher suite and version, the selected ALPN protocol
+// and the extension types, separated by "|".
+func parseServerHello(msg []byte) (string, error) {
+	// The type, length, version, random and session ID length.
+	if len(msg) < 4+2+32+1 || msg[0] != 2 {
+		return "", errNoServerHello
+	}
+	version := msg[4:6]
+	pos := 4 + 2 + 32
+	pos += 1 + int(msg[pos])
+	if len(msg) < pos+3 {
+		return "", errNoServerHello
+	}
+	cipher := msg[pos : pos+2]
+	pos += 3
+	var alpn string
+	var types []string
+	if len(msg) >= pos+2 {
+		end := pos + 2 + int(binary.BigEndian.Uint16(msg[pos:]))
+		if end > len(msg) {
+			return "", errNoServerHello
+		}
+		for pos += 2; pos+4 <= end; {
+			typ := binary.BigEndian.Uint16(msg[pos:])
+			length := int(binary.BigEndian.Uint16(msg[pos+2:]))
+			if pos+4+length > end {
+				return "", errNoServerHello
+			}
+			data := msg[pos+4 : pos+4+length]
+			if typ == 0x0010 && len(data) > 3 {
+				alpn = string(data[3:])
+			}
+			types = append(types, hex.EncodeToString(msg[pos:pos+2]))
+			pos += 4 + length
+		}
+	}
+	return strings.Join([]string{hex.EncodeToString(cipher), hex.EncodeToString(version), alpn, strings.Join(types, "-")}, "|"), nil
+}
@@ -0,0 +1,255 @@
+// Package jarm provides a zgrab2 module that computes the JARM fingerprint of
+// a TLS server.
+// Default Port: 443 (TCP)
+//
+// The scanner opens one connection for each of the ten ClientHellos of JARM,
+// which vary the TLS version, the cipher suites and their order, GREASE, the
+// ALPN protocols and the supported_versions extension, and records the cipher
+// suite, version, ALPN protocol and extensions of each ServerHello. The JARM
+// hash is made of the fuzzy hash of the cipher suites and versions, followed
+// by the truncated SHA-256 of the ALPN protocols and extensions. A probe that
+// is refused by the server (with an alert, or by closing the connection)
+// contributes an empty component, and the hash of a server refusing all the
+// probes is 62 zeros.
+package jarm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// Record content types.
+const (
+	recordAlert     = 21
+	recordHandshake = 22
+)
+
+// maxRecordLength is the maximum length of a TLS record.
+const maxRecordLength = 16384 + 2048
+
+// emptyComponent is the component of a probe without a ServerHello.
+const emptyComponent = "|||"
+
+// hashCiphers are the cipher suites in the order of their index in the fuzzy
+// hash, starting from 1. Other cipher suites have the index 0x46.
+var hashCiphers = []uint16{
+	0x0004, 0x0005, 0x0007, 0x000a, 0x0016, 0x002f, 0x0033, 0x0035,
+	0x0039, 0x003c, 0x003d, 0x0041, 0x0045, 0x0067, 0x006b, 0x0084,
+	0x0088, 0x009a, 0x009c, 0x009d, 0x009e, 0x009f, 0x00ba, 0x00be,
+	0x00c0, 0x00c4, 0xc007, 0xc008, 0xc009, 0xc00a, 0xc011, 0xc012,
+	0xc013, 0xc014, 0xc023, 0xc024, 0xc027, 0xc028, 0xc02b, 0xc02c,
+	0xc02f, 0xc030, 0xc060, 0xc061, 0xc072, 0xc073, 0xc076, 0xc077,
+	0xc09c, 0xc09d, 0xc09e, 0xc09f, 0xc0a0, 0xc0a1, 0xc0a2, 0xc0a3,
+	0xc0ac, 0xc0ad, 0xc0ae, 0xc0af, 0xcc13, 0xcc14, 0xcca8, 0xcca9,
+	0x1301, 0x1302, 0x1303, 0x1304, 0x1305,
+}
+
+// Flags holds the command-line configuration for the jarm module.
+type Flags struct {
+	zgrab2.BaseFlags
+
+	ServerName string `long:"server-name" description:"Server name of the ClientHellos. Defaults to the domain of the target, or its IP address."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results is the output of the jarm module.
+type Results struct {
+	// Hash is the JARM hash of the server.
+	Hash string `json:"hash"`
+
+	// Raw is the comma-separated components of the ten ServerHellos: the
+	// cipher suite, version, ALPN protocol and extension types of each.
+	Raw string `json:"raw"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("jarm", "JARM", module.Description(), 443, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Send the ten ClientHellos of JARM, and compute the JARM fingerprint of the TLS server"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "jarm"
+}
+
+// readServerHello reads the first record of the server, and returns the
+// JARM component of its ServerHello, or emptyComponent for an alert.
+func readServerHello(r io.Reader) (string, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	length := int(binary.BigEndian.Uint16(header[3:]))
+	switch {
+	case header[0] == recordAlert:
+		return emptyComponent, nil
+	case header[0] != recordHandshake || length > maxRecordLength:
+		return "", errNoServerHello
+	}
+	record := make([]byte, length)
+	if _, err := io.ReadFull(r, record); err != nil {
+		return "", err
+	}
+	if len(record) < 4 {
+		return "", errNoServerHello
+	}
+	msgLength := 4 + (int(record[1])<<16 | int(record[2])<<8 | int(record[3]))
+	if msgLength < len(record) {
+		record = record[:msgLength]
+	}
+	return parseServerHello(record)
+}
+
+// cipherIndex returns the index of a cipher suite in the fuzzy hash.
+func cipherIndex(cipher string) string {
+	if cipher == "" {
+		return "00"
+	}
+	for i, c := range hashCiphers {
+		if fmt.Sprintf("%04x", c) == cipher {
+			return fmt.Sprintf("%02x", i+1)
+		}
+	}
+	return fmt.Sprintf("%02x", len(hashCiphers)+1)
+}
+
+// versionIndex returns the letter of a version in the fuzzy hash: "a" for SSL
+// 3.0 to "e" for TLS 1.3.
+func versionIndex(version string) string {
+	if len(version) != 4 || version[3] < '0' || version[3] > '5' {
+		return "0"
+	}
+	return string("abcdef"[version[3]-'0'])
+}
+
+// hash returns the JARM hash of the components of the probes.
+func hash(components []string) string {
+	var fuzzy, rest strings.Builder
+	empty := true
+	for _, c := range components {
+		fields := strings.SplitN(c, "|", 4)
+		if len(fields) != 4 {
+			fields = []string{"", "", "", ""}
+		}
+		if c != emptyComponent {
+			empty = false
+		}
+		fuzzy.WriteString(cipherIndex(fields[0]))
+		fuzzy.WriteString(versionIndex(fields[1]))
+		rest.WriteString(fields[2])
+		rest.WriteString(fields[3])
+	}
+	if empty {
+		return strings.Repeat("0", 62)
+	}
+	sum := sha256.Sum256([]byte(rest.String()))
+	return fuzzy.String() + hex.EncodeToString(sum[:])[:32]
+}
+
+// Scan sends each probe on a new connection, and computes the hash of the
+// ServerHellos. The scan fails only if the first connection cannot be
+// opened.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	host := scanner.config.ServerName
+	if host == "" {
+		host = target.Domain
+	}
+	if host == "" {
+		host = target.IP.String()
+	}
+	components := make([]string, len(probes))
+	for i, p := range probes {
+		components[i] = emptyComponent
+		conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+		if err != nil {
+			if i == 0 {
+				return zgrab2.TryGetScanStatus(err), nil, err
+			}
+			continue
+		}
+		if _, err := conn.Write(p.encode(host)); err == nil {
+			if component, err := readServerHello(conn); err == nil {
+				components[i] = component
+			}
+		}
+		conn.Close()
+	}
+	return zgrab2.SCAN_SUCCESS, &Results{Hash: hash(components), Raw: strings.Join(components, ",")}, nil
+}
@@ -0,0 +1,69 @@
+package jarm
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+)
+
+func TestReorder(t *testing.T) {
+	odd := []uint16{1, 2, 3, 4, 5}
+	even := []uint16{1, 2, 3, 4}
+	tests := []struct {
+		in    []uint16
+		order int
+		want  []uint16
+	}{
+		{odd, orderReverse, []uint16{5, 4, 3, 2, 1}},
+		{odd, orderBottomHalf, []uint16{4, 5}},
+		{even, orderBottomHalf, []uint16{3, 4}},
+		{odd, orderTopHalf, []uint16{3, 2, 1}},
+		{even, orderTopHalf, []uint16{2, 1}},
+		{odd, orderMiddleOut, []uint16{3, 4, 2, 5, 1}},
+		{even, orderMiddleOut, []uint16{3, 2, 4, 1}},
+	}
+	for _, test := range tests {
+		if got := reorderUint16(test.in, test.order); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("order %d of %v: got %v, want %v", test.order, test.in, got, test.want)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	components := []string{"c02f|0303|h2|ff01-0000-0017-0010", emptyComponent, "1301|0303||002b-0033"}
+	if got, want := hash(components), "29d00041dd41f9d1dcbd8b4056a121f20c741ed18"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	empty := make([]string, len(probes))
+	for i := range empty {
+		empty[i] = emptyComponent
+	}
+	if got := hash(empty); got != strings.Repeat("0", 62) {
+		t.Errorf("got %s for a server refusing all the probes", got)
+	}
+}
+
+func TestScan(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	results := zgrab2test.MustScan(t, new(Scanner), new(Flags), server.Listener.Addr().String()).(*Results)
+	components := strings.Split(results.Raw, ",")
+	if len(components) != len(probes) || len(results.Hash) != 62 {
+		t.Fatalf("got %+v", results)
+	}
+	// The first probe offers TLS 1.2 at most, and the seventh TLS 1.3.
+	if !strings.Contains(components[0], "|0303|http/1.1|") {
+		t.Errorf("got %s for the first probe", components[0])
+	}
+	if !strings.HasPrefix(components[6], "130") || !strings.Contains(components[6], "002b") {
+		t.Errorf("got %s for the seventh probe", components[6])
+	}
+}
@@ -0,0 +1,7 @@
+package modules
+
+import "github.com/zmap/zgrab2/modules/k8s"
+
+func init() {
+	k8s.RegisterModule()
+}
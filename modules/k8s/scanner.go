@@ -0,0 +1,317 @@
+// Package k8s provides a zgrab2 module that probes the Kubernetes API server
+// and kubelet for their version and their handling of anonymous requests.
+// Default Port: 6443 (TCP)
+//
+// By default, the scanner probes an API server over HTTPS: it requests
+// /version and /healthz, which are public, and /api, whose status tells
+// whether anonymous requests are rejected (401), authenticated but forbidden
+// (403) or allowed. With --kubelet, it probes a kubelet instead, on its secure
+// port (10250) or, with --no-tls, its read-only port (10255): it requests
+// /pods, which leaks the specifications of all the pods of the node if
+// allowed, and /stats/summary.
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/jsonapi"
+)
+
+// Flags holds the command-line configuration for the k8s module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	Kubelet   bool   `long:"kubelet" description:"Probe a kubelet instead of an API server."`
+	NoTLS     bool   `long:"no-tls" description:"Use plain HTTP, as on the read-only port of the kubelet (10255)."`
+	UserAgent string `long:"user-agent" default:"Mozilla/5.0 zgrab/0.x" description:"Set a custom user agent"`
+	MaxSize   int    `long:"max-size" default:"1024" description:"Max kilobytes to read in response to each request"`
+	MaxPods   int    `long:"max-pods" default:"100" description:"Max number of pods to record"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Version is the response of /version.
+type Version struct {
+	Major      string `json:"major,omitempty"`
+	Minor      string `json:"minor,omitempty"`
+	GitVersion string `json:"gitVersion,omitempty"`
+	GitCommit  string `json:"gitCommit,omitempty"`
+	BuildDate  string `json:"buildDate,omitempty"`
+	GoVersion  string `json:"goVersion,omitempty"`
+	Platform   string `json:"platform,omitempty"`
+}
+
+// Pod is a pod listed by the kubelet.
+type Pod struct {
+	Namespace string   `json:"namespace,omitempty"`
+	Name      string   `json:"name"`
+	Images    []string `json:"images,omitempty"`
+}
+
+// Endpoint is the outcome of the request of an endpoint.
+type Endpoint struct {
+	Path       string `json:"path"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Results is the output of the k8s module.
+type Results struct {
+	// Component is apiserver or kubelet.
+	Component string `json:"component"`
+
+	// Anonymous is the outcome of an anonymous request of /api (API server)
+	// or /pods (kubelet): unauthorized if anonymous requests are rejected,
+	// forbidden if they are not authorized, or allowed.
+	Anonymous string `json:"anonymous,omitempty"`
+
+	// The fields of the API server.
+	Version     *Version `json:"version,omitempty"`
+	Healthz     string   `json:"healthz,omitempty"`
+	APIVersions []string `json:"api_versions,omitempty"`
+
+	// The fields of the kubelet. PodsExposed is true if the pods were
+	// listed, and Pods lists the first of them.
+	PodsExposed  bool   `json:"pods_exposed,omitempty"`
+	PodCount     int    `json:"pod_count,omitempty"`
+	Pods         []Pod  `json:"pods,omitempty"`
+	StatsExposed bool   `json:"stats_exposed,omitempty"`
+	NodeName     string `json:"node_name,omitempty"`
+
+	// Endpoints lists the outcome of each request.
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+
+	// TLSLog is the log of the TLS handshake, unless --no-tls is set.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("k8s", "Kubernetes", module.Description(), 6443, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Probe a Kubernetes API server or kubelet for its version and anonymous access"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "k8s"
+}
+
+// anonymous names the outcome of an anonymous request.
+func anonymous(resp *jsonapi.Response) string {
+	switch {
+	case resp.OK():
+		return "allowed"
+	case resp.StatusCode == http.StatusUnauthorized:
+		return "unauthorized"
+	case resp.StatusCode == http.StatusForbidden:
+		return "forbidden"
+	}
+	return ""
+}
+
+// podList is the response of /pods.
+type podList struct {
+	Kind  string `json:"kind"`
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Spec struct {
+			Containers []struct {
+				Image string `json:"image"`
+			} `json:"containers"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// statsSummary is the part of interest of /stats/summary.
+type statsSummary struct {
+	Node struct {
+		NodeName string `json:"nodeName"`
+	} `json:"node"`
+}
+
+// probe holds the state of a scan.
+type probe struct {
+	ctx     context.Context
+	client  *jsonapi.Client
+	results *Results
+}
+
+// get requests path, recording the outcome, and returns the response, or nil
+// if the request failed. If the response is successful and v is not nil,
+// the body is decoded into v.
+func (s *probe) get(path string, v interface{}) (*jsonapi.Response, error) {
+	endpoint := Endpoint{Path: path}
+	resp, err := s.client.Get(s.ctx, path)
+	if resp != nil {
+		endpoint.StatusCode = resp.StatusCode
+		if err == nil && v != nil && resp.OK() {
+			err = json.Unmarshal(resp.Body, v)
+		}
+	}
+	if err != nil {
+		endpoint.Error = err.Error()
+	}
+	s.results.Endpoints = append(s.results.Endpoints, endpoint)
+	return resp, err
+}
+
+// apiServer probes an API server.
+func (s *probe) apiServer() error {
+	version := new(Version)
+	resp, err := s.get("/version", version)
+	if resp == nil {
+		return err
+	}
+	if resp.OK() && err == nil {
+		s.results.Version = version
+	}
+	if resp, err := s.get("/healthz", nil); err == nil && resp.OK() {
+		s.results.Healthz = strings.TrimSpace(string(resp.Body))
+	}
+	var api struct {
+		Versions []string `json:"versions"`
+	}
+	if resp, _ := s.get("/api", &api); resp != nil {
+		s.results.Anonymous = anonymous(resp)
+		s.results.APIVersions = api.Versions
+	}
+	return nil
+}
+
+// kubelet probes a kubelet.
+func (s *probe) kubelet(maxPods int) error {
+	var pods podList
+	resp, err := s.get("/pods", &pods)
+	if resp == nil {
+		return err
+	}
+	s.results.Anonymous = anonymous(resp)
+	if resp.OK() && pods.Kind == "PodList" {
+		s.results.PodsExposed = true
+		s.results.PodCount = len(pods.Items)
+		for i, item := range pods.Items {
+			if i == maxPods {
+				break
+			}
+			pod := Pod{Namespace: item.Metadata.Namespace, Name: item.Metadata.Name}
+			for _, c := range item.Spec.Containers {
+				pod.Images = append(pod.Images, c.Image)
+			}
+			s.results.Pods = append(s.results.Pods, pod)
+		}
+	}
+	var stats statsSummary
+	if resp, err := s.get("/stats/summary", &stats); err == nil && resp.OK() {
+		s.results.StatsExposed = true
+		s.results.NodeName = stats.Node.NodeName
+	}
+	return nil
+}
+
+// Scan probes the API server, or the kubelet with --kubelet. The scan fails
+// if the first request gets no HTTP response.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	s := &probe{
+		ctx: ctx,
+		client: &jsonapi.Client{
+			Target:    &target,
+			BaseFlags: &scanner.config.BaseFlags,
+			TLSFlags:  &scanner.config.TLSFlags,
+			UseTLS:    !scanner.config.NoTLS,
+			UserAgent: scanner.config.UserAgent,
+			MaxSize:   scanner.config.MaxSize * 1024,
+		},
+		results: &Results{Component: "apiserver"},
+	}
+	var err error
+	if scanner.config.Kubelet {
+		s.results.Component = "kubelet"
+		err = s.kubelet(scanner.config.MaxPods)
+	} else {
+		err = s.apiServer()
+	}
+	s.results.TLSLog = s.client.TLSLog
+	if err != nil {
+		if s.results.TLSLog != nil {
+			return zgrab2.TryGetScanStatus(err), s.results, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	return zgrab2.SCAN_SUCCESS, s.results, nil
+}
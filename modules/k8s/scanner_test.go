@@ -0,0 +1,84 @@
+package k8s
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+)
+
+const versionResponse = `{
+  "major": "1",
+  "minor": "27",
+  "gitVersion": "v1.27.4",
+  "gitCommit": "fa3d7990104d7c1f16943a67f11b154b71f6a132",
+  "buildDate": "2023-07-19T12:14:49Z",
+  "goVersion": "go1.20.6",
+  "compiler": "gc",
+  "platform": "linux/amd64"
+}`
+
+const podsResponse = `{"kind":"PodList","apiVersion":"v1","metadata":{},"items":[
+  {"metadata":{"name":"web-7d4b9c","namespace":"default"},"spec":{"nodeName":"node-1","containers":[{"name":"web","image":"nginx:1.25"},{"name":"sidecar","image":"envoy:1.27"}]}},
+  {"metadata":{"name":"kube-proxy-x2k4p","namespace":"kube-system"},"spec":{"containers":[{"name":"kube-proxy","image":"registry.k8s.io/kube-proxy:v1.27.4"}]}}
+]}`
+
+func scan(t *testing.T, handler http.HandlerFunc, flags *Flags) *Results {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	flags.NoTLS = true
+	return zgrab2test.MustScan(t, new(Scanner), flags, server.Listener.Addr().String()).(*Results)
+}
+
+func TestAPIServer(t *testing.T) {
+	results := scan(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			w.Write([]byte(versionResponse))
+		case "/healthz":
+			w.Write([]byte("ok"))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"kind":"Status","status":"Failure","message":"forbidden: User \"system:anonymous\" cannot get path \"/api\"","reason":"Forbidden","code":403}`))
+		}
+	}, &Flags{MaxSize: 1024})
+	if results.Component != "apiserver" || results.Version == nil || results.Version.GitVersion != "v1.27.4" || results.Version.Platform != "linux/amd64" {
+		t.Errorf("got %+v, version %+v", results, results.Version)
+	}
+	if results.Healthz != "ok" || results.Anonymous != "forbidden" || results.APIVersions != nil {
+		t.Errorf("got %+v", results)
+	}
+	if len(results.Endpoints) != 3 || results.Endpoints[2].StatusCode != http.StatusForbidden {
+		t.Errorf("got endpoints %+v", results.Endpoints)
+	}
+}
+
+func TestKubeletExposed(t *testing.T) {
+	results := scan(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pods":
+			w.Write([]byte(podsResponse))
+		case "/stats/summary":
+			w.Write([]byte(`{"node":{"nodeName":"node-1","cpu":{}},"pods":[]}`))
+		}
+	}, &Flags{Kubelet: true, MaxSize: 1024, MaxPods: 1})
+	expected := []Pod{{Namespace: "default", Name: "web-7d4b9c", Images: []string{"nginx:1.25", "envoy:1.27"}}}
+	if results.Component != "kubelet" || results.Anonymous != "allowed" || !results.PodsExposed || results.PodCount != 2 || !reflect.DeepEqual(results.Pods, expected) {
+		t.Errorf("got %+v", results)
+	}
+	if !results.StatsExposed || results.NodeName != "node-1" {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestKubeletUnauthorized(t *testing.T) {
+	results := scan(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Unauthorized"))
+	}, &Flags{Kubelet: true, MaxSize: 1024, MaxPods: 100})
+	if results.Anonymous != "unauthorized" || results.PodsExposed || results.StatsExposed || len(results.Endpoints) != 2 {
+		t.Errorf("got %+v", results)
+	}
+}
@@ -0,0 +1,237 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/zmap/zgrab2/lib/ber"
+)
+
+// The protocol operations (RFC 4511 section 4.2 to 4.12).
+const (
+	tagBindRequest       = ber.ClassApplication | ber.Constructed | 0
+	tagBindResponse      = ber.ClassApplication | ber.Constructed | 1
+	tagUnbindRequest     = ber.ClassApplication | 2
+	tagSearchRequest     = ber.ClassApplication | ber.Constructed | 3
+	tagSearchResultEntry = ber.ClassApplication | ber.Constructed | 4
+	tagSearchResultDone  = ber.ClassApplication | ber.Constructed | 5
+	tagSearchResultRef   = ber.ClassApplication | ber.Constructed | 19
+	tagExtendedRequest   = ber.ClassApplication | ber.Constructed | 23
+	tagExtendedResponse  = ber.ClassApplication | ber.Constructed | 24
+
+	tagSimpleAuth    = ber.ClassContext | 0
+	tagFilterPresent = ber.ClassContext | 7
+	tagExtendedName  = ber.ClassContext | 0
+)
+
+// startTLSOID is the name of the StartTLS extended operation (RFC 4511
+// section 4.14).
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// maxMessageSize bounds the size of a message read from the server.
+const maxMessageSize = 1 << 20
+
+var (
+	// ErrInvalidResponse is returned if a response is not a valid LDAP
+	// message.
+	ErrInvalidResponse = errors.New("invalid LDAP response")
+
+	// ErrTooLarge is returned if a message is larger than maxMessageSize.
+	ErrTooLarge = errors.New("LDAP message too large")
+)
+
+// resultCodes names the result codes of RFC 4511 appendix A.
+var resultCodes = map[int64]string{
+	0:  "success",
+	1:  "operationsError",
+	2:  "protocolError",
+	3:  "timeLimitExceeded",
+	4:  "sizeLimitExceeded",
+	7:  "authMethodNotSupported",
+	8:  "strongerAuthRequired",
+	10: "referral",
+	11: "adminLimitExceeded",
+	12: "unavailableCriticalExtension",
+	13: "confidentialityRequired",
+	14: "saslBindInProgress",
+	32: "noSuchObject",
+	34: "invalidDNSyntax",
+	48: "inappropriateAuthentication",
+	49: "invalidCredentials",
+	50: "insufficientAccessRights",
+	51: "busy",
+	52: "unavailable",
+	53: "unwillingToPerform",
+	80: "other",
+}
+
+// Result is the outcome of an operation.
+type Result struct {
+	Code              int64  `json:"result_code"`
+	Name              string `json:"result_name,omitempty"`
+	MatchedDN         string `json:"matched_dn,omitempty"`
+	DiagnosticMessage string `json:"diagnostic_message,omitempty"`
+}
+
+// Success returns true if the operation succeeded.
+func (r *Result) Success() bool {
+	return r.Code == 0
+}
+
+// message is a decoded LDAPMessage.
+type message struct {
+	id int64
+	op ber.Element
+}
+
+// encodeMessage returns the LDAPMessage with the given ID and operation.
+func encodeMessage(id int64, op []byte) []byte {
+	return ber.Encode(ber.TagSequence, ber.EncodeInt(id), op)
+}
+
+// encodeAnonymousBind returns an LDAPv3 simple bind with an empty name and
+// password.
+func encodeAnonymousBind() []byte {
+	return ber.Encode(tagBindRequest, ber.EncodeInt(3), ber.EncodeString(nil), ber.Encode(tagSimpleAuth))
+}
+
+// encodeStartTLS returns the StartTLS extended request.
+func encodeStartTLS() []byte {
+	return ber.Encode(tagExtendedRequest, ber.Encode(tagExtendedName, []byte(startTLSOID)))
+}
+
+// encodeRootDSESearch returns a base search of the root DSE for the given
+// attributes.
+func encodeRootDSESearch(attributes []string) []byte {
+	var attrs [][]byte
+	for _, a := range attributes {
+		attrs = append(attrs, ber.EncodeString([]byte(a)))
+	}
+	return ber.Encode(tagSearchRequest,
+		ber.EncodeString(nil),                    // baseObject
+		ber.Encode(ber.TagEnumerated, []byte{0}), // scope: baseObject
+		ber.Encode(ber.TagEnumerated, []byte{0}), // derefAliases: neverDerefAliases
+		ber.EncodeInt(0),                         // sizeLimit
+		ber.EncodeInt(0),                         // timeLimit
+		ber.Encode(ber.TagBoolean, []byte{0}),    // typesOnly
+		ber.Encode(tagFilterPresent, []byte("objectClass")),
+		ber.Encode(ber.TagSequence, attrs...),
+	)
+}
+
+// encodeUnbind returns the unbind request.
+func encodeUnbind() []byte {
+	return ber.Encode(tagUnbindRequest)
+}
+
+// readMessage reads the next LDAPMessage.
+func readMessage(r *bufio.Reader) (*message, error) {
+	// Read the tag and the length to know the size of the message.
+	header := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != ber.TagSequence {
+		return nil, ErrInvalidResponse
+	}
+	size := int(header[1])
+	if size&0x80 != 0 {
+		n := size & 0x7f
+		if n == 0 || n > 4 {
+			return nil, ErrInvalidResponse
+		}
+		header = header[:2+n]
+		if _, err := io.ReadFull(r, header[2:]); err != nil {
+			return nil, err
+		}
+		size = 0
+		for _, c := range header[2:] {
+			size = size<<8 | int(c)
+		}
+	}
+	if size > maxMessageSize {
+		return nil, ErrTooLarge
+	}
+	buf := make([]byte, len(header)+size)
+	copy(buf, header)
+	if _, err := io.ReadFull(r, buf[len(header):]); err != nil {
+		return nil, err
+	}
+	return decodeMessage(buf)
+}
+
+// decodeMessage decodes an LDAPMessage.
+func decodeMessage(b []byte) (*message, error) {
+	msg, _, err := ber.Decode(b)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	fields, err := msg.Children()
+	if err != nil || len(fields) < 2 || fields[0].Tag != ber.TagInteger {
+		return nil, ErrInvalidResponse
+	}
+	id, err := fields[0].Int()
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	return &message{id: id, op: fields[1]}, nil
+}
+
+// result decodes the LDAPResult at the start of an operation.
+func (m *message) result() (*Result, error) {
+	fields, err := m.op.Children()
+	if err != nil || len(fields) < 3 || fields[0].Tag != ber.TagEnumerated {
+		return nil, ErrInvalidResponse
+	}
+	code, err := fields[0].Int()
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	name := resultCodes[code]
+	if name == "" {
+		name = fmt.Sprintf("resultCode%d", code)
+	}
+	return &Result{
+		Code:              code,
+		Name:              name,
+		MatchedDN:         string(fields[1].Value),
+		DiagnosticMessage: string(fields[2].Value),
+	}, nil
+}
+
+// Attribute is an attribute of an entry.
+type Attribute struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// attributes decodes the attributes of a SearchResultEntry.
+func (m *message) attributes() ([]Attribute, error) {
+	fields, err := m.op.Children()
+	if err != nil || len(fields) != 2 {
+		return nil, ErrInvalidResponse
+	}
+	list, err := fields[1].Children()
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	ret := []Attribute{}
+	for _, attr := range list {
+		pair, err := attr.Children()
+		if err != nil || len(pair) != 2 {
+			return nil, ErrInvalidResponse
+		}
+		values, err := pair[1].Children()
+		if err != nil {
+			return nil, ErrInvalidResponse
+		}
+		a := Attribute{Name: string(pair[0].Value), Values: []string{}}
+		for _, v := range values {
+			a.Values = append(a.Values, string(v.Value))
+		}
+		ret = append(ret, a)
+	}
+	return ret, nil
+}
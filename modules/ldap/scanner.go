@@ -0,0 +1,359 @@
+// Package ldap provides a zgrab2 module that reads the root DSE of LDAP
+// servers.
+// Default Port: 389 (TCP)
+//
+// The scanner optionally negotiates TLS, either directly (--ldaps, usually on
+// port 636) or with the StartTLS extended operation (--starttls), then sends
+// an anonymous bind and a base search of the root DSE. The output includes
+// the bind result and the naming contexts, supported versions, SASL
+// mechanisms, controls and extensions, vendor and Active Directory details
+// advertised in the root DSE, and the TLS log if TLS was negotiated.
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// rootDSEAttributes are the attributes requested from the root DSE: all the
+// user attributes, and all the operational ones (RFC 3673), which many
+// servers only return when asked.
+var rootDSEAttributes = []string{"*", "+"}
+
+// Flags holds the command-line configuration for the ldap module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	StartTLS bool `long:"starttls" description:"Send StartTLS before the bind."`
+	LDAPS    bool `long:"ldaps" description:"Negotiate TLS immediately after connecting, as on port 636."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// RootDSE holds the root DSE attributes of interest.
+type RootDSE struct {
+	NamingContexts          []string `json:"naming_contexts,omitempty"`
+	DefaultNamingContext    string   `json:"default_naming_context,omitempty"`
+	SupportedLDAPVersion    []string `json:"supported_ldap_version,omitempty"`
+	SupportedSASLMechanisms []string `json:"supported_sasl_mechanisms,omitempty"`
+	SupportedControl        []string `json:"supported_control,omitempty"`
+	SupportedExtension      []string `json:"supported_extension,omitempty"`
+	VendorName              string   `json:"vendor_name,omitempty"`
+	VendorVersion           string   `json:"vendor_version,omitempty"`
+
+	// The attributes of Active Directory domain controllers.
+	DNSHostName                   string `json:"dns_host_name,omitempty"`
+	ServerName                    string `json:"server_name,omitempty"`
+	LDAPServiceName               string `json:"ldap_service_name,omitempty"`
+	DomainFunctionality           string `json:"domain_functionality,omitempty"`
+	ForestFunctionality           string `json:"forest_functionality,omitempty"`
+	DomainControllerFunctionality string `json:"domain_controller_functionality,omitempty"`
+
+	// Attributes lists all the attributes returned.
+	Attributes []Attribute `json:"attributes,omitempty"`
+}
+
+// Results is the output of the ldap module.
+type Results struct {
+	// StartTLS is the result of the StartTLS operation, if sent.
+	StartTLS *Result `json:"starttls,omitempty"`
+
+	// Bind is the result of the anonymous bind.
+	Bind *Result `json:"bind,omitempty"`
+
+	// Search is the result of the root DSE search.
+	Search *Result `json:"search,omitempty"`
+
+	// RootDSE is the root DSE entry, if returned.
+	RootDSE *RootDSE `json:"root_dse,omitempty"`
+
+	// TLSLog is the standard TLS log, if --starttls or --ldaps is enabled.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("ldap", "LDAP", module.Description(), 389, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Bind anonymously to an LDAP server and read its root DSE, optionally with StartTLS or LDAPS"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if flags.StartTLS && flags.LDAPS {
+		log.Error("Cannot send both --starttls and --ldaps")
+		return zgrab2.ErrInvalidArguments
+	}
+	if flags.StartTLS {
+		return flags.TLSFlags.CheckRedial("--starttls")
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "ldap"
+}
+
+// connection sends requests and reads their responses.
+type connection struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	lastID int64
+}
+
+func newConnection(conn net.Conn) *connection {
+	return &connection{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// send sends an operation in a new message, and returns its ID.
+func (c *connection) send(op []byte) (int64, error) {
+	c.lastID++
+	_, err := c.conn.Write(encodeMessage(c.lastID, op))
+	return c.lastID, err
+}
+
+// read returns the next response to the message with the given ID. A notice
+// of disconnection (an unsolicited message, with ID 0) is returned as an
+// error.
+func (c *connection) read(id int64) (*message, error) {
+	for {
+		m, err := readMessage(c.reader)
+		if err != nil {
+			return nil, err
+		}
+		if m.id == 0 {
+			msg := "server disconnected"
+			if res, err := m.result(); err == nil {
+				msg += ": " + res.DiagnosticMessage
+			}
+			return nil, zgrab2.NewScanError(zgrab2.SCAN_APPLICATION_ERROR, errors.New(msg))
+		}
+		if m.id == id {
+			return m, nil
+		}
+	}
+}
+
+// request sends an operation expecting a single response with the given
+// tag, and returns its result.
+func (c *connection) request(op []byte, tag byte) (*Result, error) {
+	id, err := c.send(op)
+	if err != nil {
+		return nil, err
+	}
+	m, err := c.read(id)
+	if err != nil {
+		return nil, err
+	}
+	if m.op.Tag != tag {
+		return nil, ErrInvalidResponse
+	}
+	return m.result()
+}
+
+// searchRootDSE searches the root DSE, and returns the result and the
+// attributes of the entry, if any.
+func (c *connection) searchRootDSE() (*Result, []Attribute, error) {
+	id, err := c.send(encodeRootDSESearch(rootDSEAttributes))
+	if err != nil {
+		return nil, nil, err
+	}
+	var attributes []Attribute
+	for {
+		m, err := c.read(id)
+		if err != nil {
+			return nil, attributes, err
+		}
+		switch m.op.Tag {
+		case tagSearchResultEntry:
+			if attributes, err = m.attributes(); err != nil {
+				return nil, nil, err
+			}
+		case tagSearchResultRef:
+		case tagSearchResultDone:
+			res, err := m.result()
+			return res, attributes, err
+		default:
+			return nil, attributes, ErrInvalidResponse
+		}
+	}
+}
+
+// tls negotiates TLS on conn, recording the log in results. dial, if not nil,
+// opens a new connection for the TLS checks needing one.
+func (scanner *Scanner) tls(conn net.Conn, dial func() (net.Conn, error), results *Results) (net.Conn, error) {
+	tlsConn, err := scanner.config.TLSFlags.GetTLSConnectionForTarget(conn, nil, dial)
+	if err != nil {
+		return nil, err
+	}
+	results.TLSLog = tlsConn.GetLog()
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// Scan performs the following:
+//  1. Connect, and with --ldaps, negotiate TLS.
+//  2. With --starttls, send the StartTLS extended operation, and negotiate
+//     TLS if it succeeded.
+//  3. Bind anonymously.
+//  4. Search the root DSE, whatever the result of the bind, since servers
+//     usually allow it without authentication.
+//  5. Unbind and close the connection.
+//
+// The scan succeeds if the server answered the bind.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	results := new(Results)
+	if scanner.config.LDAPS {
+		dial := func() (net.Conn, error) {
+			return target.Open(ctx, &scanner.config.BaseFlags)
+		}
+		if conn, err = scanner.tls(conn, dial, results); err != nil {
+			return zgrab2.TryGetScanStatus(err), results, err
+		}
+	}
+	c := newConnection(conn)
+	if scanner.config.StartTLS {
+		res, err := c.request(encodeStartTLS(), tagExtendedResponse)
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), nil, err
+		}
+		results.StartTLS = res
+		if !res.Success() {
+			return zgrab2.SCAN_APPLICATION_ERROR, results, fmt.Errorf("StartTLS failed: %s", res.Name)
+		}
+		if conn, err = scanner.tls(conn, nil, results); err != nil {
+			return zgrab2.TryGetScanStatus(err), results, err
+		}
+		c = newConnection(conn)
+	}
+	if results.Bind, err = c.request(encodeAnonymousBind(), tagBindResponse); err != nil {
+		if results.TLSLog == nil {
+			return zgrab2.TryGetScanStatus(err), nil, err
+		}
+		return zgrab2.TryGetScanStatus(err), results, err
+	}
+	res, attributes, err := c.searchRootDSE()
+	results.Search = res
+	if attributes != nil {
+		results.RootDSE = newRootDSE(attributes)
+	}
+	if err != nil {
+		log.Debugf("ldap: root DSE search of %s failed: %s", target.String(), err)
+		return zgrab2.SCAN_SUCCESS, results, nil
+	}
+	c.send(encodeUnbind())
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
+
+// newRootDSE extracts the attributes of interest, whose names are case
+// insensitive.
+func newRootDSE(attributes []Attribute) *RootDSE {
+	all := func(name string) []string {
+		for _, a := range attributes {
+			if strings.EqualFold(a.Name, name) {
+				return a.Values
+			}
+		}
+		return nil
+	}
+	first := func(name string) string {
+		if v := all(name); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	return &RootDSE{
+		NamingContexts:                all("namingContexts"),
+		DefaultNamingContext:          first("defaultNamingContext"),
+		SupportedLDAPVersion:          all("supportedLDAPVersion"),
+		SupportedSASLMechanisms:       all("supportedSASLMechanisms"),
+		SupportedControl:              all("supportedControl"),
+		SupportedExtension:            all("supportedExtension"),
+		VendorName:                    first("vendorName"),
+		VendorVersion:                 first("vendorVersion"),
+		DNSHostName:                   first("dnsHostName"),
+		ServerName:                    first("serverName"),
+		LDAPServiceName:               first("ldapServiceName"),
+		DomainFunctionality:           first("domainFunctionality"),
+		ForestFunctionality:           first("forestFunctionality"),
+		DomainControllerFunctionality: first("domainControllerFunctionality"),
+		Attributes:                    attributes,
+	}
+}
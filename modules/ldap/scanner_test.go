@@ -0,0 +1,112 @@
+package ldap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/ber"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// encodeResult returns an operation with an LDAPResult.
+func encodeResult(tag byte, code int, diagnostic string) []byte {
+	return ber.Encode(tag, ber.Encode(ber.TagEnumerated, []byte{byte(code)}), ber.EncodeString(nil), ber.EncodeString([]byte(diagnostic)))
+}
+
+// longForm re-encodes the length of a message on four bytes, as Active
+// Directory does.
+func longForm(msg []byte) []byte {
+	e, _, err := ber.Decode(msg)
+	if err != nil {
+		panic(err)
+	}
+	ret := []byte{e.Tag, 0x84, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(ret[2:], uint32(len(e.Value)))
+	return append(ret, e.Value...)
+}
+
+// serve answers the bind and the root DSE search of a client. If denyBind is
+// set, the bind is refused.
+func serve(conn net.Conn, denyBind bool) error {
+	r := bufio.NewReader(conn)
+	for {
+		m, err := readMessage(r)
+		if err != nil {
+			return nil
+		}
+		switch m.op.Tag {
+		case tagBindRequest:
+			code := 0
+			if denyBind {
+				code = 48
+			}
+			conn.Write(encodeMessage(m.id, encodeResult(tagBindResponse, code, "")))
+		case tagSearchRequest:
+			attr := func(name string, values ...string) []byte {
+				var vals [][]byte
+				for _, v := range values {
+					vals = append(vals, ber.EncodeString([]byte(v)))
+				}
+				return ber.Encode(ber.TagSequence, ber.EncodeString([]byte(name)), ber.Encode(ber.TagSet, vals...))
+			}
+			entry := ber.Encode(tagSearchResultEntry, ber.EncodeString(nil), ber.Encode(ber.TagSequence,
+				attr("namingContexts", "DC=example,DC=com", "CN=Configuration,DC=example,DC=com"),
+				attr("supportedLDAPVersion", "3", "2"),
+				attr("supportedSASLMechanisms", "GSSAPI", "GSS-SPNEGO"),
+				attr("dnsHostName", "dc1.example.com"),
+				attr("domainFunctionality", "7"),
+			))
+			conn.Write(longForm(encodeMessage(m.id, entry)))
+			conn.Write(encodeMessage(m.id, encodeResult(tagSearchResultDone, 0, "")))
+		case tagUnbindRequest:
+			return nil
+		}
+	}
+}
+
+func scan(t *testing.T, denyBind bool) *Results {
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		return serve(conn, denyBind)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	return zgrab2test.MustScan(t, new(Scanner), new(Flags), server.Addr()).(*Results)
+}
+
+func TestScan(t *testing.T) {
+	results := scan(t, false)
+	if results.Bind == nil || !results.Bind.Success() || results.Bind.Name != "success" {
+		t.Errorf("wrong bind result: %+v", results.Bind)
+	}
+	if results.Search == nil || !results.Search.Success() {
+		t.Errorf("wrong search result: %+v", results.Search)
+	}
+	dse := results.RootDSE
+	if dse == nil {
+		t.Fatal("no root DSE")
+	}
+	if len(dse.NamingContexts) != 2 || dse.NamingContexts[0] != "DC=example,DC=com" {
+		t.Errorf("wrong naming contexts: %v", dse.NamingContexts)
+	}
+	if len(dse.SupportedLDAPVersion) != 2 || len(dse.SupportedSASLMechanisms) != 2 {
+		t.Errorf("wrong supported versions or mechanisms: %+v", dse)
+	}
+	if dse.DNSHostName != "dc1.example.com" || dse.DomainFunctionality != "7" || len(dse.Attributes) != 5 {
+		t.Errorf("wrong Active Directory attributes: %+v", dse)
+	}
+}
+
+func TestScanBindRefused(t *testing.T) {
+	results := scan(t, true)
+	if results.Bind == nil || results.Bind.Code != 48 || results.Bind.Name != "inappropriateAuthentication" {
+		t.Errorf("wrong bind result: %+v", results.Bind)
+	}
+	if results.RootDSE == nil || len(results.RootDSE.NamingContexts) != 2 {
+		t.Errorf("root DSE not read after a refused bind: %+v", results.RootDSE)
+	}
+}
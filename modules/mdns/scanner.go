@@ -0,0 +1,411 @@
+// Package mdns provides a zgrab2 module that sends a unicast DNS-SD query to
+// an mDNS responder, and records the services it advertises.
+// Default Port: 5353 (UDP)
+//
+// The scanner sends a PTR query for _services._dns-sd._udp.local, the list of
+// the service types of the responder, and for the --services service types,
+// from an ephemeral port: responders answer such queries with a unicast
+// response to the source port (RFC 6762, section 6.7). With --browse, it then
+// queries the instances of the service types found. The output lists the
+// service types, the instances with their host, port and TXT records, and the
+// hosts and addresses of the responder, with the lengths of the queries and
+// responses: responders reachable from the Internet can amplify traffic.
+package mdns
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// servicesName is the name of the service type enumeration (RFC 6763,
+// section 9).
+const servicesName = "_services._dns-sd._udp.local."
+
+// classUnicastResponse is the bit of the question class requesting a unicast
+// response (the QU bit).
+const classUnicastResponse = 0x8000
+
+// maxQuestions is the maximum number of service types queried with --browse.
+const maxQuestions = 32
+
+// ErrInvalidResponse is returned if the response cannot be parsed as an mDNS
+// response.
+var ErrInvalidResponse = errors.New("invalid mDNS response")
+
+// Flags holds the command-line configuration for the mdns module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+
+	Services string `long:"services" description:"Comma-separated list of service types to query, such as _http._tcp.local"`
+	Browse   bool   `long:"browse" description:"Query the instances of the service types advertised by the responder"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config   *Flags
+	services []dnsmessage.Name
+}
+
+// Instance is an instance of a service.
+type Instance struct {
+	Name    string `json:"name"`
+	Service string `json:"service,omitempty"`
+
+	// Target and Port are the host and port of the SRV record of the instance.
+	Target string `json:"target,omitempty"`
+	Port   uint16 `json:"port,omitempty"`
+
+	// TXT lists the strings of the TXT record of the instance.
+	TXT []string `json:"txt,omitempty"`
+}
+
+// Host is a host name, with its addresses.
+type Host struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// Results is the output of the mdns module.
+type Results struct {
+	// ServiceTypes lists the service types advertised by the responder.
+	ServiceTypes []string `json:"service_types,omitempty"`
+
+	Instances []*Instance `json:"instances,omitempty"`
+	Hosts     []*Host     `json:"hosts,omitempty"`
+
+	// QueryLength and ResponseLength are the total lengths of the queries
+	// sent and of the responses received.
+	QueryLength    int `json:"query_length"`
+	ResponseLength int `json:"response_length"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("mdns", "mDNS", module.Description(), 5353, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Send a unicast DNS-SD query to an mDNS responder, and record the services it advertises"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if _, err := parseServices(flags.Services); err != nil {
+		log.Errorf("invalid --services: %s", err)
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	services, err := parseServices(f.Services)
+	if err != nil {
+		return err
+	}
+	scanner.services = append([]dnsmessage.Name{dnsmessage.MustNewName(servicesName)}, services...)
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "mdns"
+}
+
+// parseServices parses a comma-separated list of service types, adding the
+// .local domain to the types without it.
+func parseServices(s string) ([]dnsmessage.Name, error) {
+	var ret []dnsmessage.Name
+	for _, service := range strings.Split(s, ",") {
+		service = strings.TrimSuffix(strings.TrimSpace(service), ".")
+		if service == "" {
+			continue
+		}
+		if !strings.HasSuffix(service, ".local") {
+			service += ".local"
+		}
+		name, err := dnsmessage.NewName(service + ".")
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, name)
+	}
+	return ret, nil
+}
+
+// buildQuery encodes a PTR query for names, requesting unicast responses.
+func buildQuery(id uint16, names []dnsmessage.Name) ([]byte, error) {
+	b := dnsmessage.NewBuilder(make([]byte, 0, 512), dnsmessage.Header{ID: id})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		q := dnsmessage.Question{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET | classUnicastResponse}
+		if err := b.Question(q); err != nil {
+			return nil, err
+		}
+	}
+	return b.Finish()
+}
+
+// results accumulates the records of the responses.
+type results struct {
+	*Results
+	services  map[string]bool
+	instances map[string]*Instance
+	hosts     map[string]*Host
+}
+
+// instance returns the instance named name, adding it if needed.
+func (r *results) instance(name string) *Instance {
+	if i, ok := r.instances[name]; ok {
+		return i
+	}
+	i := &Instance{Name: name}
+	r.instances[name] = i
+	r.Instances = append(r.Instances, i)
+	return i
+}
+
+// host returns the host named name, adding it if needed.
+func (r *results) host(name string) *Host {
+	if h, ok := r.hosts[name]; ok {
+		return h
+	}
+	h := &Host{Name: name}
+	r.hosts[name] = h
+	r.Hosts = append(r.Hosts, h)
+	return h
+}
+
+// add adds the records of the answer and additional sections of a response.
+func (r *results) add(msg []byte) error {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil || !h.Response {
+		return ErrInvalidResponse
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return ErrInvalidResponse
+	}
+	for {
+		rh, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return ErrInvalidResponse
+		}
+		if err := r.addRecord(&p, &rh, p.SkipAnswer); err != nil {
+			return ErrInvalidResponse
+		}
+	}
+	if err := p.SkipAllAuthorities(); err != nil {
+		return ErrInvalidResponse
+	}
+	for {
+		rh, err := p.AdditionalHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return ErrInvalidResponse
+		}
+		if err := r.addRecord(&p, &rh, p.SkipAdditional); err != nil {
+			return ErrInvalidResponse
+		}
+	}
+	return nil
+}
+
+// addRecord reads the body of the current record, and adds it to the results.
+// The records of other types are skipped with skip.
+func (r *results) addRecord(p *dnsmessage.Parser, h *dnsmessage.ResourceHeader, skip func() error) error {
+	name := h.Name.String()
+	switch h.Type {
+	case dnsmessage.TypePTR:
+		ptr, err := p.PTRResource()
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(name, servicesName) {
+			service := ptr.PTR.String()
+			if !r.services[service] {
+				r.services[service] = true
+				r.ServiceTypes = append(r.ServiceTypes, service)
+			}
+			return nil
+		}
+		r.instance(ptr.PTR.String()).Service = name
+	case dnsmessage.TypeSRV:
+		srv, err := p.SRVResource()
+		if err != nil {
+			return err
+		}
+		i := r.instance(name)
+		i.Target = srv.Target.String()
+		i.Port = srv.Port
+	case dnsmessage.TypeTXT:
+		txt, err := p.TXTResource()
+		if err != nil {
+			return err
+		}
+		i := r.instance(name)
+		i.TXT = txt.TXT
+	case dnsmessage.TypeA:
+		a, err := p.AResource()
+		if err != nil {
+			return err
+		}
+		h := r.host(name)
+		h.Addresses = append(h.Addresses, net.IP(a.A[:]).String())
+	case dnsmessage.TypeAAAA:
+		aaaa, err := p.AAAAResource()
+		if err != nil {
+			return err
+		}
+		h := r.host(name)
+		h.Addresses = append(h.Addresses, net.IP(aaaa.AAAA[:]).String())
+	default:
+		return skip()
+	}
+	return nil
+}
+
+// exchange sends a query for names, and adds the response to the results.
+func (scanner *Scanner) exchange(conn net.Conn, names []dnsmessage.Name, r *results) error {
+	var b [2]byte
+	rand.Read(b[:])
+	msg, err := buildQuery(binary.BigEndian.Uint16(b[:]), names)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+	r.QueryLength += len(msg)
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+	r.ResponseLength += n
+	return r.add(buf[:n])
+}
+
+// browse returns the service types found that were not queried, up to
+// maxQuestions.
+func (scanner *Scanner) browse(r *results) []dnsmessage.Name {
+	queried := make(map[string]bool)
+	for _, name := range scanner.services {
+		queried[strings.ToLower(name.String())] = true
+	}
+	var names []dnsmessage.Name
+	for _, service := range r.ServiceTypes {
+		if queried[strings.ToLower(service)] || len(names) == maxQuestions {
+			continue
+		}
+		name, err := dnsmessage.NewName(service)
+		if err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// Scan sends the query for the service types, and reads the response, then
+// queries the instances of the service types found with --browse. A response
+// without any record is a success. An error of the browse query is reported
+// with the results of the first query.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	r := &results{
+		Results:   new(Results),
+		services:  make(map[string]bool),
+		instances: make(map[string]*Instance),
+		hosts:     make(map[string]*Host),
+	}
+	if err := scanner.exchange(conn, scanner.services, r); err != nil {
+		if err == ErrInvalidResponse {
+			return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	if scanner.config.Browse {
+		if names := scanner.browse(r); len(names) > 0 {
+			if err := scanner.exchange(conn, names, r); err != nil {
+				if err == ErrInvalidResponse {
+					return zgrab2.SCAN_PROTOCOL_ERROR, r.Results, err
+				}
+				return zgrab2.TryGetScanStatus(err), r.Results, err
+			}
+		}
+	}
+	return zgrab2.SCAN_SUCCESS, r.Results, nil
+}
@@ -0,0 +1,114 @@
+package mdns
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// respond returns the response of a responder advertising an HTTP service and
+// an SSH service to query, with the records of the instances of the service
+// types queried.
+func respond(t *testing.T, query []byte) []byte {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, Authoritative: true})
+	b.EnableCompression()
+	b.StartAnswers()
+	rh := func(name string) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: 10}
+	}
+	http := false
+	for _, q := range questions {
+		if q.Class&classUnicastResponse == 0 {
+			t.Errorf("question %s without the QU bit", q.Name)
+		}
+		switch q.Name.String() {
+		case servicesName:
+			b.PTRResource(rh(servicesName), dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("_http._tcp.local.")})
+			b.PTRResource(rh(servicesName), dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("_ssh._tcp.local.")})
+		case "_http._tcp.local.":
+			b.PTRResource(rh("_http._tcp.local."), dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("Printer._http._tcp.local.")})
+			http = true
+		}
+	}
+	if http {
+		b.StartAdditionals()
+		b.SRVResource(rh("Printer._http._tcp.local."), dnsmessage.SRVResource{Port: 8080, Target: dnsmessage.MustNewName("printer.local.")})
+		b.TXTResource(rh("Printer._http._tcp.local."), dnsmessage.TXTResource{TXT: []string{"path=/", "model=X1"}})
+		b.AResource(rh("printer.local."), dnsmessage.AResource{A: [4]byte{192, 168, 1, 20}})
+		b.AAAAResource(rh("printer.local."), dnsmessage.AAAAResource{AAAA: [16]byte{0xfe, 0x80, 15: 1}})
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func scan(t *testing.T, flags *Flags) (zgrab2.ScanStatus, *Results, error) {
+	server, err := testserver.NewUDP(func(query []byte) []byte {
+		return respond(t, query)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), flags, server.Addr())
+	results, _ := ret.(*Results)
+	return status, results, err
+}
+
+func TestServices(t *testing.T) {
+	status, results, err := scan(t, &Flags{})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if want := []string{"_http._tcp.local.", "_ssh._tcp.local."}; !reflect.DeepEqual(results.ServiceTypes, want) {
+		t.Errorf("got service types %v, want %v", results.ServiceTypes, want)
+	}
+	if len(results.Instances) != 0 || results.QueryLength == 0 || results.ResponseLength == 0 {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	status, results, err := scan(t, &Flags{Browse: true})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	want := []*Instance{{
+		Name:    "Printer._http._tcp.local.",
+		Service: "_http._tcp.local.",
+		Target:  "printer.local.",
+		Port:    8080,
+		TXT:     []string{"path=/", "model=X1"},
+	}}
+	if !reflect.DeepEqual(results.Instances, want) {
+		t.Errorf("got instances %+v, want %+v", results.Instances, want)
+	}
+	if len(results.Hosts) != 1 || results.Hosts[0].Name != "printer.local." || !reflect.DeepEqual(results.Hosts[0].Addresses, []string{"192.168.1.20", "fe80::1"}) {
+		t.Errorf("got hosts %+v", results.Hosts)
+	}
+}
+
+func TestParseServices(t *testing.T) {
+	names, err := parseServices("_http._tcp, _ipp._tcp.local.,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0].String() != "_http._tcp.local." || names[1].String() != "_ipp._tcp.local." {
+		t.Errorf("got %v", names)
+	}
+}
@@ -0,0 +1,7 @@
+package modules
+
+import "github.com/zmap/zgrab2/modules/memcached"
+
+func init() {
+	memcached.RegisterModule()
+}
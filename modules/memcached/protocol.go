@@ -0,0 +1,178 @@
+package memcached
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The magic bytes and the opcodes of the binary protocol.
+const (
+	magicRequest  = 0x80
+	magicResponse = 0x81
+
+	opcodeStat    = 0x10
+	opcodeVersion = 0x0b
+)
+
+// binaryHeaderSize is the size of the header of a binary packet.
+const binaryHeaderSize = 24
+
+// udpHeaderSize is the size of the frame header of a UDP datagram.
+const udpHeaderSize = 8
+
+// maxResponseSize bounds the size of a response read from the server.
+const maxResponseSize = 1 << 20
+
+var (
+	// ErrInvalidResponse is returned if a response cannot be parsed.
+	ErrInvalidResponse = errors.New("invalid memcached response")
+
+	// ErrTooLarge is returned if a response is larger than maxResponseSize.
+	ErrTooLarge = errors.New("memcached response too large")
+)
+
+// command is a request, in both protocols.
+type command struct {
+	text   string
+	opcode byte
+}
+
+var (
+	commandVersion = command{text: "version", opcode: opcodeVersion}
+	commandStats   = command{text: "stats", opcode: opcodeStat}
+)
+
+// encode returns the request for cmd in the text or binary protocol.
+func (cmd command) encode(binaryProtocol bool) []byte {
+	if !binaryProtocol {
+		return []byte(cmd.text + "\r\n")
+	}
+	header := make([]byte, binaryHeaderSize)
+	header[0] = magicRequest
+	header[1] = cmd.opcode
+	return header
+}
+
+// response is the response to a command: its values, keyed by name for
+// stats, and the error reported by the server, if any.
+type response struct {
+	values [][2]string
+	err    error
+}
+
+// parseText parses the response to a text command, returning nil if it is
+// incomplete.
+func parseText(b []byte) (*response, error) {
+	if !bytes.HasSuffix(b, []byte("\r\n")) {
+		return nil, nil
+	}
+	ret := new(response)
+	for _, line := range strings.Split(string(b[:len(b)-2]), "\r\n") {
+		fields := strings.SplitN(line, " ", 3)
+		switch {
+		case line == "END":
+			return ret, nil
+		case fields[0] == "VERSION" && len(fields) >= 2:
+			ret.values = append(ret.values, [2]string{"version", strings.Join(fields[1:], " ")})
+			return ret, nil
+		case fields[0] == "STAT" && len(fields) == 3:
+			ret.values = append(ret.values, [2]string{fields[1], fields[2]})
+		case fields[0] == "ERROR" || fields[0] == "CLIENT_ERROR" || fields[0] == "SERVER_ERROR":
+			ret.err = errors.New(line)
+			return ret, nil
+		default:
+			return nil, ErrInvalidResponse
+		}
+	}
+	return nil, nil
+}
+
+// parseBinary parses the packets responding to a binary command, returning
+// nil if they are incomplete. The stats are terminated by a packet without a
+// key, and the version is the value of a single packet.
+func parseBinary(b []byte, opcode byte) (*response, error) {
+	ret := new(response)
+	for len(b) >= binaryHeaderSize {
+		if b[0] != magicResponse || b[1] != opcode {
+			return nil, ErrInvalidResponse
+		}
+		keyLength := int(binary.BigEndian.Uint16(b[2:]))
+		extrasLength := int(b[4])
+		status := binary.BigEndian.Uint16(b[6:])
+		bodyLength := int(binary.BigEndian.Uint32(b[8:]))
+		if keyLength+extrasLength > bodyLength {
+			return nil, ErrInvalidResponse
+		}
+		if len(b) < binaryHeaderSize+bodyLength {
+			return nil, nil
+		}
+		body := b[binaryHeaderSize : binaryHeaderSize+bodyLength]
+		b = b[binaryHeaderSize+bodyLength:]
+		key := string(body[extrasLength : extrasLength+keyLength])
+		value := string(body[extrasLength+keyLength:])
+		switch {
+		case status != 0:
+			ret.err = fmt.Errorf("status %#04x: %s", status, value)
+			return ret, nil
+		case opcode == opcodeVersion:
+			ret.values = append(ret.values, [2]string{"version", value})
+			return ret, nil
+		case key == "":
+			return ret, nil
+		}
+		ret.values = append(ret.values, [2]string{key, value})
+	}
+	return nil, nil
+}
+
+// encodeUDP prepends the frame header of a single datagram request.
+func encodeUDP(id uint16, req []byte) []byte {
+	header := make([]byte, udpHeaderSize)
+	binary.BigEndian.PutUint16(header, id)
+	binary.BigEndian.PutUint16(header[4:], 1)
+	return append(header, req...)
+}
+
+// datagrams reassembles a response sent over UDP, which is split into
+// datagrams numbered from 0.
+type datagrams struct {
+	id    uint16
+	total int
+	parts map[int][]byte
+	size  int
+}
+
+// add adds a datagram, returning the reassembled response once all the
+// datagrams have been received. Datagrams of other requests are ignored.
+func (d *datagrams) add(b []byte) ([]byte, error) {
+	if len(b) < udpHeaderSize || binary.BigEndian.Uint16(b) != d.id {
+		return nil, nil
+	}
+	seq := int(binary.BigEndian.Uint16(b[2:]))
+	total := int(binary.BigEndian.Uint16(b[4:]))
+	if total == 0 || seq >= total || d.total != 0 && total != d.total {
+		return nil, ErrInvalidResponse
+	}
+	d.total = total
+	if d.parts == nil {
+		d.parts = make(map[int][]byte)
+	}
+	if _, ok := d.parts[seq]; !ok {
+		d.parts[seq] = append([]byte(nil), b[udpHeaderSize:]...)
+		d.size += len(b) - udpHeaderSize
+	}
+	if d.size > maxResponseSize {
+		return nil, ErrTooLarge
+	}
+	if len(d.parts) < d.total {
+		return nil, nil
+	}
+	var ret []byte
+	for i := 0; i < d.total; i++ {
+		ret = append(ret, d.parts[i]...)
+	}
+	return ret, nil
+}
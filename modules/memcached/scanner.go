@@ -0,0 +1,294 @@
+// Package memcached provides a zgrab2 module that reads the version and
+// statistics of memcached servers.
+// Default Port: 11211 (TCP)
+//
+// The scanner sends the version and stats commands, in the text protocol or,
+// with --binary, in the binary protocol. With --udp, the commands are sent
+// over UDP in the frame format of the UDP interface, which answers with far
+// more data than it receives and is abused for reflection attacks: the sizes
+// of the requests and responses are recorded to measure the amplification.
+package memcached
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// Flags holds the command-line configuration for the memcached module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+
+	Binary bool `long:"binary" description:"Use the binary protocol instead of the text protocol."`
+	UDP    bool `long:"udp" description:"Send the commands over UDP instead of TCP."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Stat is a statistic returned by the stats command.
+type Stat struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Stats holds the statistics of interest.
+type Stats struct {
+	PID              uint64 `json:"pid,omitempty"`
+	Uptime           uint64 `json:"uptime,omitempty"`
+	Threads          uint64 `json:"threads,omitempty"`
+	CurrConnections  uint64 `json:"curr_connections,omitempty"`
+	TotalConnections uint64 `json:"total_connections,omitempty"`
+	CurrItems        uint64 `json:"curr_items,omitempty"`
+	TotalItems       uint64 `json:"total_items,omitempty"`
+	Bytes            uint64 `json:"bytes,omitempty"`
+	LimitMaxBytes    uint64 `json:"limit_maxbytes,omitempty"`
+}
+
+// Results is the output of the memcached module.
+type Results struct {
+	// Protocol is text or binary, and Transport is tcp or udp.
+	Protocol  string `json:"protocol"`
+	Transport string `json:"transport"`
+
+	// Version is the server version, from the version command, or from the
+	// stats if the command failed.
+	Version string `json:"version,omitempty"`
+
+	// Stats holds the statistics of interest, and AllStats all of them, in
+	// the order they were returned.
+	Stats    *Stats `json:"stats,omitempty"`
+	AllStats []Stat `json:"all_stats,omitempty"`
+
+	// Errors lists the errors reported by the server, such as a refusal
+	// before authentication.
+	Errors []string `json:"errors,omitempty"`
+
+	// RequestBytes and ResponseBytes are the total sizes of the requests
+	// sent and of the responses received.
+	RequestBytes  int `json:"request_bytes"`
+	ResponseBytes int `json:"response_bytes"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("memcached", "memcached", module.Description(), 11211, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Read the version and statistics of a memcached server over TCP or UDP, in the text or binary protocol"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "memcached"
+}
+
+// exchange sends a command and reads the response, reassembling the
+// datagrams of the response over UDP.
+func (scanner *Scanner) exchange(conn net.Conn, cmd command, results *Results) (*response, error) {
+	req := cmd.encode(scanner.config.Binary)
+	id := uint16(rand.Intn(1 << 16))
+	if scanner.config.UDP {
+		req = encodeUDP(id, req)
+	}
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	results.RequestBytes += len(req)
+	var deadline time.Time
+	if scanner.config.Timeout > 0 {
+		deadline = time.Now().Add(scanner.config.Timeout)
+	}
+	var buf []byte
+	reassembly := &datagrams{id: id}
+	chunk := make([]byte, 1<<16)
+	for {
+		if scanner.config.UDP {
+			// The deadline of a TimeoutConnection only holds for one read.
+			conn.SetReadDeadline(deadline)
+		}
+		n, err := conn.Read(chunk)
+		if err != nil {
+			return nil, err
+		}
+		results.ResponseBytes += n
+		if scanner.config.UDP {
+			data, err := reassembly.add(chunk[:n])
+			if err != nil {
+				return nil, err
+			}
+			if data == nil {
+				continue
+			}
+			buf = data
+		} else {
+			if len(buf)+n > maxResponseSize {
+				return nil, ErrTooLarge
+			}
+			buf = append(buf, chunk[:n]...)
+		}
+		var resp *response
+		if scanner.config.Binary {
+			resp, err = parseBinary(buf, cmd.opcode)
+		} else {
+			resp, err = parseText(buf)
+		}
+		if err != nil || resp != nil {
+			return resp, err
+		}
+		if scanner.config.UDP {
+			// All the datagrams were received.
+			return nil, ErrInvalidResponse
+		}
+	}
+}
+
+// newStats extracts the statistics of interest.
+func newStats(all []Stat) *Stats {
+	ret := new(Stats)
+	fields := map[string]*uint64{
+		"pid":               &ret.PID,
+		"uptime":            &ret.Uptime,
+		"threads":           &ret.Threads,
+		"curr_connections":  &ret.CurrConnections,
+		"total_connections": &ret.TotalConnections,
+		"curr_items":        &ret.CurrItems,
+		"total_items":       &ret.TotalItems,
+		"bytes":             &ret.Bytes,
+		"limit_maxbytes":    &ret.LimitMaxBytes,
+	}
+	for _, s := range all {
+		if field, ok := fields[s.Name]; ok {
+			*field, _ = strconv.ParseUint(s.Value, 10, 64)
+		}
+	}
+	return ret
+}
+
+// Scan sends the version command, then the stats command. The scan succeeds
+// if the server answered either.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	var conn net.Conn
+	var err error
+	results := &Results{Protocol: "text", Transport: "tcp"}
+	if scanner.config.Binary {
+		results.Protocol = "binary"
+	}
+	if scanner.config.UDP {
+		results.Transport = "udp"
+		conn, err = target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	} else {
+		conn, err = target.Open(ctx, &scanner.config.BaseFlags)
+	}
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	answered := false
+	for _, cmd := range []command{commandVersion, commandStats} {
+		resp, err := scanner.exchange(conn, cmd, results)
+		if err != nil {
+			status := zgrab2.TryGetScanStatus(err)
+			if err == ErrInvalidResponse || err == ErrTooLarge {
+				status = zgrab2.SCAN_PROTOCOL_ERROR
+			}
+			if answered {
+				return status, results, err
+			}
+			return status, nil, err
+		}
+		answered = true
+		if resp.err != nil {
+			results.Errors = append(results.Errors, cmd.text+": "+resp.err.Error())
+			continue
+		}
+		for _, v := range resp.values {
+			if cmd == commandVersion {
+				results.Version = v[1]
+			} else {
+				results.AllStats = append(results.AllStats, Stat{Name: v[0], Value: v[1]})
+			}
+		}
+	}
+	if results.AllStats != nil {
+		results.Stats = newStats(results.AllStats)
+		if results.Version == "" {
+			for _, s := range results.AllStats {
+				if s.Name == "version" {
+					results.Version = s.Value
+				}
+			}
+		}
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
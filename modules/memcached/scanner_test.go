@@ -0,0 +1,134 @@
+package memcached
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+const textStats = "STAT pid 42\r\nSTAT uptime 3600\r\nSTAT version 1.6.21\r\nSTAT curr_connections 2\r\nSTAT total_items 17\r\nEND\r\n"
+
+// binaryPacket returns a binary response packet.
+func binaryPacket(opcode byte, key, value string) []byte {
+	b := make([]byte, binaryHeaderSize)
+	b[0] = magicResponse
+	b[1] = opcode
+	binary.BigEndian.PutUint16(b[2:], uint16(len(key)))
+	binary.BigEndian.PutUint32(b[8:], uint32(len(key)+len(value)))
+	return append(append(b, key...), value...)
+}
+
+// serveTCP answers the requests of a connection, in the text or binary
+// protocol.
+func serveTCP(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return nil
+		}
+		if first[0] != magicRequest {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			switch line {
+			case "version\r\n":
+				conn.Write([]byte("VERSION 1.6.21\r\n"))
+			case "stats\r\n":
+				// Split the response to check that it is reassembled.
+				conn.Write([]byte(textStats[:20]))
+				conn.Write([]byte(textStats[20:]))
+			}
+			continue
+		}
+		header := make([]byte, binaryHeaderSize)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return err
+		}
+		switch header[1] {
+		case opcodeVersion:
+			conn.Write(binaryPacket(opcodeVersion, "", "1.4.15"))
+		case opcodeStat:
+			var b []byte
+			b = append(b, binaryPacket(opcodeStat, "pid", "7")...)
+			b = append(b, binaryPacket(opcodeStat, "curr_items", "3")...)
+			b = append(b, binaryPacket(opcodeStat, "", "")...)
+			conn.Write(b)
+		}
+	}
+}
+
+// serveUDP answers requests with the text stats split in two datagrams, sent
+// in reverse order, and an error to the version command.
+func serveUDP(conn net.PacketConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if n < udpHeaderSize {
+			continue
+		}
+		header := append([]byte(nil), buf[:udpHeaderSize]...)
+		binary.BigEndian.PutUint16(header[4:], 2)
+		switch string(buf[udpHeaderSize:n]) {
+		case "version\r\n":
+			binary.BigEndian.PutUint16(header[4:], 1)
+			conn.WriteTo(append(header, "ERROR\r\n"...), addr)
+		case "stats\r\n":
+			second := append([]byte(nil), header...)
+			binary.BigEndian.PutUint16(second[2:], 1)
+			conn.WriteTo(append(second, textStats[30:]...), addr)
+			conn.WriteTo(append(header, textStats[:30]...), addr)
+		}
+	}
+}
+
+// scanTCP scans a server answering with serveTCP.
+func scanTCP(t *testing.T, flags *Flags) *Results {
+	server, err := testserver.New(testserver.Config{Handler: serveTCP})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	return zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*Results)
+}
+
+func TestText(t *testing.T) {
+	results := scanTCP(t, &Flags{})
+	if results.Version != "1.6.21" || len(results.AllStats) != 5 || results.Stats.PID != 42 || results.Stats.TotalItems != 17 {
+		t.Errorf("got %+v", results)
+	}
+	if results.RequestBytes != len("version\r\nstats\r\n") || results.ResponseBytes != len("VERSION 1.6.21\r\n")+len(textStats) {
+		t.Errorf("got %d request bytes, %d response bytes", results.RequestBytes, results.ResponseBytes)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	results := scanTCP(t, &Flags{Binary: true})
+	if results.Protocol != "binary" || results.Version != "1.4.15" || len(results.AllStats) != 2 || results.Stats.CurrItems != 3 {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go serveUDP(conn)
+	// The stats are answered in two datagrams, which a testserver.UDPServer
+	// can't send.
+	results := zgrab2test.MustScan(t, new(Scanner), &Flags{UDP: true}, conn.LocalAddr().String()).(*Results)
+	if results.Transport != "udp" || results.Version != "1.6.21" || len(results.Errors) != 1 || results.Stats.Uptime != 3600 {
+		t.Errorf("got %+v", results)
+	}
+}
@@ -0,0 +1,86 @@
+package modbus
+
+import "fmt"
+
+// Read Device Identification codes (categories), with the first object ID
+// of each.
+var deviceIDCategories = []struct {
+	name        string
+	code        byte
+	firstObject byte
+}{
+	{"basic", 0x01, 0x00},
+	{"regular", 0x02, 0x03},
+	{"extended", 0x03, 0x80},
+}
+
+// maxDeviceIDRequests is the maximum number of requests for a category, when
+// the server keeps setting MoreFollows.
+const maxDeviceIDRequests = 16
+
+// DeviceIdentification is the device identification read with --device-id.
+type DeviceIdentification struct {
+	// ConformityLevel is the conformity level of the last response.
+	ConformityLevel int `json:"conformity_level"`
+
+	// Objects are the objects of all the categories read.
+	Objects MEIObjectSet `json:"objects,omitempty"`
+
+	// Exceptions are the exceptions returned by the server, by category
+	// ("basic", "regular" or "extended").
+	Exceptions map[string]*ExceptionResponse `json:"exceptions,omitempty"`
+
+	// Error is set if a response could not be read or parsed.
+	Error string `json:"error,omitempty"`
+}
+
+// readDeviceIdentification reads the objects of the basic, regular and
+// extended categories, stopping at the first one the server does not
+// support.
+func (c *Conn) readDeviceIdentification(unitID int) *DeviceIdentification {
+	ret := new(DeviceIdentification)
+	seen := make(map[MEIObjectID]bool)
+	for _, category := range deviceIDCategories {
+		objectID := category.firstObject
+		for i := 0; i < maxDeviceIDRequests; i++ {
+			res, err := c.request(&ModbusRequest{
+				UnitID:   unitID,
+				Function: FunctionCodeMEI,
+				Data:     []byte{0x0E, category.code, objectID},
+			})
+			if res == nil {
+				ret.Error = err.Error()
+				return ret
+			}
+			if res.IsException() {
+				if ret.Exceptions == nil {
+					ret.Exceptions = make(map[string]*ExceptionResponse)
+				}
+				ret.Exceptions[category.name], _ = res.getExceptionResponse(false)
+				return ret
+			}
+			mei, err := res.parseMEIResponse(false, category.code)
+			if err != nil {
+				ret.Error = fmt.Sprintf("%s category: %s", category.name, err)
+				return ret
+			}
+			ret.ConformityLevel = mei.ConformityLevel
+			for _, obj := range mei.Objects {
+				if !seen[obj.OID] {
+					seen[obj.OID] = true
+					ret.Objects = append(ret.Objects, obj)
+				}
+			}
+			if !mei.MoreFollows || byte(mei.NextObjectID) <= objectID {
+				break
+			}
+			objectID = byte(mei.NextObjectID)
+		}
+		// The conformity level (without the individual access bit) is the
+		// highest category supported.
+		if int(category.code) >= ret.ConformityLevel&0x7F {
+			break
+		}
+	}
+	return ret
+}
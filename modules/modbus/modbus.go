@@ -156,6 +156,13 @@ type ModbusEvent struct {
 
 	// Raw is the full raw response from the server, including the header.
 	Raw []byte `json:"raw,omitempty"`
+
+	// DeviceIdentification is the device identification of all categories,
+	// read with --device-id.
+	DeviceIdentification *DeviceIdentification `json:"device_identification,omitempty"`
+
+	// Reads are the results of the reads of --reads.
+	Reads []RegisterRead `json:"reads,omitempty"`
 }
 
 // IsException returns true if this response indicates an exception has occurred.
@@ -205,6 +212,12 @@ func (m *ModbusResponse) getExceptionResponse(strict bool) (*ExceptionResponse,
 }
 
 func (m *ModbusResponse) getMEIResponse(strict bool) (*MEIResponse, error) {
+	return m.parseMEIResponse(strict, 0x01)
+}
+
+// parseMEIResponse parses the response to a Read Device Identification
+// request with the given read device ID code (category).
+func (m *ModbusResponse) parseMEIResponse(strict bool, category byte) (*MEIResponse, error) {
 	if m.Function != FunctionCodeMEI {
 		return nil, fmt.Errorf("Invalid function code 0x%02x", m.Function)
 	}
@@ -215,10 +228,9 @@ func (m *ModbusResponse) getMEIResponse(strict bool) (*MEIResponse, error) {
 	if meiType != 0x0E {
 		return nil, fmt.Errorf("Invalid response data (expected 0xee, got 0x%02x)", meiType)
 	}
-	// TODO: Allow different values here
 	readType := m.Data[1]
-	if readType != 1 {
-		return nil, fmt.Errorf("Invalid response data (expected 0x01, got 0x%02x)", readType)
+	if readType != category {
+		return nil, fmt.Errorf("Invalid response data (expected 0x%02x, got 0x%02x)", category, readType)
 	}
 	conformityLevel := m.Data[2]
 	moreFollows := (m.Data[3] != 0)
@@ -236,6 +248,7 @@ func (m *ModbusResponse) getMEIResponse(strict bool) (*MEIResponse, error) {
 		n, obj := parseMEIObject(m.Data[it:])
 		it += n
 		if obj == nil {
+			objects = objects[:idx]
 			break
 		}
 		objects[idx] = *obj
@@ -306,6 +319,23 @@ func (c *Conn) MarshalRequest(r *ModbusRequest) (data []byte, err error) {
 	return
 }
 
+// request sends r, and reads the response.
+func (c *Conn) request(r *ModbusRequest) (*ModbusResponse, error) {
+	data, err := c.MarshalRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	w := 0
+	for w < len(data) {
+		written, err := c.getUnderlyingConn().Write(data[w:])
+		w += written
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c.GetModbusResponse()
+}
+
 // ModbusResponse wraps the data returned by the server in response to the ModbusRequest.
 type ModbusResponse struct {
 	// Length is the number of bytes the server says it will return.
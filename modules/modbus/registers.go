@@ -0,0 +1,131 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The read functions allowed in --reads.
+const (
+	FunctionCodeReadCoils            = FunctionCode(0x01)
+	FunctionCodeReadDiscreteInputs   = FunctionCode(0x02)
+	FunctionCodeReadHoldingRegisters = FunctionCode(0x03)
+	FunctionCodeReadInputRegisters   = FunctionCode(0x04)
+)
+
+// maxReadCount is the maximum count of a read, by function (see sections
+// 6.1 to 6.4 of the Modbus Application Protocol).
+var maxReadCount = map[FunctionCode]int{
+	FunctionCodeReadCoils:            2000,
+	FunctionCodeReadDiscreteInputs:   2000,
+	FunctionCodeReadHoldingRegisters: 125,
+	FunctionCodeReadInputRegisters:   125,
+}
+
+// RegisterRead is a read of coils, discrete inputs or registers, and its
+// result.
+type RegisterRead struct {
+	Function FunctionCode `json:"function_code"`
+	Address  uint16       `json:"address"`
+	Count    uint16       `json:"count"`
+
+	// Bits are the values of the coils or discrete inputs read.
+	Bits []bool `json:"bits,omitempty"`
+
+	// Registers are the values of the holding or input registers read.
+	Registers []uint16 `json:"registers,omitempty"`
+
+	// ExceptionResponse is the exception returned by the server, if any.
+	ExceptionResponse *ExceptionResponse `json:"exception_response,omitempty"`
+
+	// Error is set if the response could not be read or parsed.
+	Error string `json:"error,omitempty"`
+}
+
+// parseReads parses the comma-separated function:address:count reads of
+// --reads. Numbers may be decimal or hexadecimal (with a 0x prefix).
+func parseReads(reads string) ([]RegisterRead, error) {
+	var ret []RegisterRead
+	for _, read := range strings.Split(reads, ",") {
+		read = strings.TrimSpace(read)
+		if read == "" {
+			continue
+		}
+		fields := strings.Split(read, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("read %s is not function:address:count", read)
+		}
+		var values [3]uint64
+		for i, field := range fields {
+			value, err := strconv.ParseUint(field, 0, 16)
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %s", read, err)
+			}
+			values[i] = value
+		}
+		function := FunctionCode(values[0])
+		max, ok := maxReadCount[function]
+		if !ok || values[0] > 0xff {
+			return nil, fmt.Errorf("read %s: function %d is not a read of coils, discrete inputs or registers", read, values[0])
+		}
+		if values[2] < 1 || int(values[2]) > max {
+			return nil, fmt.Errorf("read %s: count must be between 1 and %d", read, max)
+		}
+		ret = append(ret, RegisterRead{
+			Function: function,
+			Address:  uint16(values[1]),
+			Count:    uint16(values[2]),
+		})
+	}
+	return ret, nil
+}
+
+// request returns the request of the read.
+func (r *RegisterRead) request(unitID int) *ModbusRequest {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint16(data[0:2], r.Address)
+	binary.BigEndian.PutUint16(data[2:4], r.Count)
+	return &ModbusRequest{
+		UnitID:   unitID,
+		Function: r.Function,
+		Data:     data,
+	}
+}
+
+// parseResponse sets the values (or exception) of the read from res.
+func (r *RegisterRead) parseResponse(res *ModbusResponse) {
+	if res.Function&0x7F != r.Function {
+		r.Error = fmt.Sprintf("invalid response function code 0x%02x", res.Function)
+		return
+	}
+	if res.IsException() {
+		r.ExceptionResponse, _ = res.getExceptionResponse(false)
+		return
+	}
+	if len(res.Data) < 1 || len(res.Data) < 1+int(res.Data[0]) {
+		r.Error = "response too short"
+		return
+	}
+	values := res.Data[1 : 1+int(res.Data[0])]
+	if r.Function == FunctionCodeReadCoils || r.Function == FunctionCodeReadDiscreteInputs {
+		if len(values)*8 < int(r.Count) {
+			r.Error = fmt.Sprintf("response has %d bytes for %d bits", len(values), r.Count)
+			return
+		}
+		r.Bits = make([]bool, r.Count)
+		for i := range r.Bits {
+			r.Bits[i] = values[i/8]&(1<<uint(i%8)) != 0
+		}
+		return
+	}
+	if len(values) < 2*int(r.Count) {
+		r.Error = fmt.Sprintf("response has %d bytes for %d registers", len(values), r.Count)
+		return
+	}
+	r.Registers = make([]uint16, r.Count)
+	for i := range r.Registers {
+		r.Registers[i] = binary.BigEndian.Uint16(values[2*i:])
+	}
+}
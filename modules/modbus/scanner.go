@@ -14,12 +14,18 @@
 // The --strict flag allows turning on new validity checks beyond those
 // done in the original zgrab, to help rule out false matches.
 //
+// The --device-id flag reads the objects of all the Read Device
+// Identification categories (basic, regular and extended), and the --reads
+// flag reads a list of coils, discrete inputs or registers, after a
+// successful probe.
+//
 // The output is the same as the original ZGrab: a "modbus event" object,
 // with either the parsed MEI response or the parsed exception info.
 // The only addition is a "raw" field containing the raw response data.
 package modbus
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"net"
@@ -38,6 +44,8 @@ type Flags struct {
 	Strict    bool   `long:"strict" description:"If set, perform stricter checks on the response data to get fewer false positives"`
 	RequestID uint16 `long:"request-id" description:"Override the default request ID." default:"0x5A47"`
 	Verbose   bool   `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	DeviceID  bool   `long:"device-id" description:"Read the device identification objects of the basic, regular and extended categories"`
+	Reads     string `long:"reads" description:"Comma-separated reads of coils (1), discrete inputs (2), holding registers (3) or input registers (4), as function:address:count"`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -47,6 +55,7 @@ type Module struct {
 // Scanner implements the zgrab2.Scanner interface.
 type Scanner struct {
 	config *Flags
+	reads  []RegisterRead
 }
 
 // RegisterModule registers the zgrab2 module.
@@ -68,6 +77,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(ModbusEvent)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for Modbus devices, usually PLCs as part of a SCADA system"
@@ -83,6 +97,10 @@ func (flags *Flags) Validate(args []string) error {
 			log.Warnf("ObjectIDs 0x07...0x7F are reserved (requested 0x%02x)", flags.ObjectID)
 		}
 	}
+	if _, err := parseReads(flags.Reads); err != nil {
+		log.Errorf("invalid --reads: %s", err)
+		return zgrab2.ErrInvalidArguments
+	}
 	return nil
 }
 
@@ -95,6 +113,11 @@ func (flags *Flags) Help() string {
 func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	f, _ := flags.(*Flags)
 	scanner.config = f
+	reads, err := parseReads(f.Reads)
+	if err != nil {
+		return err
+	}
+	scanner.reads = reads
 	return nil
 }
 
@@ -137,9 +160,10 @@ func (c *Conn) getUnderlyingConn() net.Conn {
 //   Category = 0x01: Basic
 //	 ObjectID = <flags.ObjectID, default 0: VendorName>
 // If the response is not a valid modbus response to this packet, then fail with a SCAN_PROTOCOL_ERROR.
-// Otherwise, return the parsed response and status (SCAN_SUCCESS or SCAN_APPLICATION_ERROR)
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	conn, err := target.Open(&scanner.config.BaseFlags)
+// Otherwise, read the device identification and registers (if configured), and return the parsed response and
+// status (SCAN_SUCCESS or SCAN_APPLICATION_ERROR)
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
@@ -202,6 +226,19 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
 	}
 
+	if scanner.config.DeviceID {
+		ret.DeviceIdentification = c.readDeviceIdentification(int(scanner.config.UnitID))
+	}
+	for _, read := range scanner.reads {
+		res, err := c.request(read.request(int(scanner.config.UnitID)))
+		if res == nil {
+			read.Error = err.Error()
+		} else {
+			read.parseResponse(res)
+		}
+		ret.Reads = append(ret.Reads, read)
+	}
+
 	status := zgrab2.SCAN_SUCCESS
 	if res.IsException() {
 		// Note the exception, but note that the modbus protocol was detected
@@ -0,0 +1,124 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// writeResponse writes a response with the transaction ID of header.
+func writeResponse(w io.Writer, header []byte, function byte, data []byte) {
+	ret := append([]byte{}, header[:7]...)
+	binary.BigEndian.PutUint16(ret[4:], uint16(2+len(data)))
+	ret = append(append(ret, function), data...)
+	w.Write(ret)
+}
+
+// handle serves a connection of a device with regular conformity, with the
+// regular objects split in two responses, and holding registers 0 to 9.
+func handle(conn net.Conn) {
+	for {
+		header := make([]byte, 8)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		data := make([]byte, binary.BigEndian.Uint16(header[4:])-2)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+		switch function := header[7]; function {
+		case 0x2B:
+			switch data[1] {
+			case 0x01:
+				writeResponse(conn, header, function, []byte{0x0E, 0x01, 0x02, 0, 0, 3, 0, 4, 'A', 'c', 'm', 'e', 1, 2, 'X', '1', 2, 4, 'v', '1', '.', '0'})
+			case 0x02:
+				if data[2] == 3 {
+					writeResponse(conn, header, function, []byte{0x0E, 0x02, 0x02, 0xFF, 5, 1, 4, 4, 'P', 'L', 'C', '1'})
+				} else {
+					writeResponse(conn, header, function, []byte{0x0E, 0x02, 0x02, 0, 0, 1, 5, 2, 'M', '1'})
+				}
+			default:
+				writeResponse(conn, header, function|0x80, []byte{0x03})
+			}
+		case 0x03:
+			address := binary.BigEndian.Uint16(data)
+			count := binary.BigEndian.Uint16(data[2:])
+			if address+count > 10 {
+				writeResponse(conn, header, function|0x80, []byte{0x02})
+				continue
+			}
+			values := []byte{byte(2 * count)}
+			for i := address; i < address+count; i++ {
+				values = append(values, 0, byte(i))
+			}
+			writeResponse(conn, header, function, values)
+		case 0x01:
+			writeResponse(conn, header, function, []byte{2, 0x05, 0x01})
+		default:
+			writeResponse(conn, header, function|0x80, []byte{0x01})
+		}
+	}
+}
+
+func TestParseReads(t *testing.T) {
+	reads, err := parseReads("3:0:10, 0x01:0x10:9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RegisterRead{
+		{Function: 3, Address: 0, Count: 10},
+		{Function: 1, Address: 16, Count: 9},
+	}
+	if !reflect.DeepEqual(reads, expected) {
+		t.Errorf("got reads %+v", reads)
+	}
+	for _, invalid := range []string{"5:0:1", "3:0", "3:0:126", "1:0:0", "3:x:1"} {
+		if _, err := parseReads(invalid); err == nil {
+			t.Errorf("%s: no error", invalid)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		handle(conn)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	flags := &Flags{
+		UnitID:    1,
+		RequestID: 0x5A47,
+		DeviceID:  true,
+		Reads:     "3:2:3,3:8:3,1:0:9",
+	}
+	result := zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*ModbusEvent)
+	expected := &DeviceIdentification{
+		ConformityLevel: 2,
+		Objects: MEIObjectSet{
+			{OID: OIDVendor, Value: "Acme"},
+			{OID: OIDProductCode, Value: "X1"},
+			{OID: OIDRevision, Value: "v1.0"},
+			{OID: OIDProductName, Value: "PLC1"},
+			{OID: OIDModelName, Value: "M1"},
+		},
+	}
+	if !reflect.DeepEqual(result.DeviceIdentification, expected) {
+		t.Errorf("got device identification %+v", result.DeviceIdentification)
+	}
+	reads := []RegisterRead{
+		{Function: 3, Address: 2, Count: 3, Registers: []uint16{2, 3, 4}},
+		{Function: 3, Address: 8, Count: 3, ExceptionResponse: &ExceptionResponse{ExceptionFunction: 3, ExceptionType: 2}},
+		{Function: 1, Address: 0, Count: 9, Bits: []bool{true, false, true, false, false, false, false, false, true}},
+	}
+	if !reflect.DeepEqual(result.Reads, reads) {
+		t.Errorf("got reads %+v", result.Reads)
+	}
+}
@@ -0,0 +1,187 @@
+package mongodb
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/zmap/zgrab2/lib/auth"
+	"github.com/zmap/zgrab2/lib/sasl"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// maxReplyLen bounds the length of the replies to the commands sent
+	// during and after authentication.
+	maxReplyLen = 1024 * 1024
+
+	// maxSASLSteps bounds the number of saslContinue commands.
+	maxSASLSteps = 8
+)
+
+// AuthResult is the outcome of the login attempts, in which the ErrorCode is
+// the code of the command failing the authentication.
+type AuthResult struct {
+	auth.Result
+
+	// Databases are the databases returned by listDatabases after a
+	// successful login.
+	Databases []string `json:"databases,omitempty"`
+
+	// QueryError is the error of listDatabases after a successful login, if
+	// any.
+	QueryError string `json:"query_error,omitempty"`
+}
+
+// commandReply is the part of a command reply common to all commands.
+type commandReply struct {
+	OK       float64 `bson:"ok"`
+	ErrMsg   string  `bson:"errmsg"`
+	Code     int     `bson:"code"`
+	CodeName string  `bson:"codeName"`
+}
+
+// commandError is a reply with ok: 0.
+type commandError struct {
+	code    int
+	message string
+}
+
+func (err *commandError) Error() string {
+	return fmt.Sprintf("command failed (code %d): %s", err.code, err.message)
+}
+
+// saslReply is the reply to saslStart and saslContinue.
+type saslReply struct {
+	ConversationID int    `bson:"conversationId"`
+	Done           bool   `bson:"done"`
+	Payload        []byte `bson:"payload"`
+}
+
+// listDatabasesReply is the reply to listDatabases.
+type listDatabasesReply struct {
+	Databases []struct {
+		Name string `bson:"name"`
+	} `bson:"databases"`
+}
+
+// runCommand sends command to database, in an OP_MSG if the server's
+// MaxWireVersion is at least 7 and in an OP_QUERY otherwise (as for
+// buildInfo), and decodes the reply into ret. It returns a *commandError if
+// the command failed.
+func (conn *Connection) runCommand(wireVersion int32, database string, command bson.D, ret interface{}) error {
+	var msg []byte
+	var docOffset int
+	if wireVersion < 7 {
+		query, err := bson.Marshal(command)
+		if err != nil {
+			return err
+		}
+		msg = getOpQuery(database+".$cmd", query)
+		docOffset = MSGHEADER_LEN + 20
+	} else {
+		payload, err := bson.Marshal(append(command, bson.DocElem{Name: "$db", Value: database}))
+		if err != nil {
+			return err
+		}
+		msg = getOpMsg(append([]byte{0}, payload...))
+		docOffset = MSGHEADER_LEN + 5
+	}
+	if err := conn.Write(msg); err != nil {
+		return err
+	}
+	reply, err := conn.readMsg(maxReplyLen)
+	if err != nil {
+		return err
+	}
+	if len(reply) < docOffset+4 {
+		return fmt.Errorf("Server truncated message - no command reply (%d bytes: %s)", len(reply), hex.EncodeToString(reply))
+	}
+	doc := reply[docOffset:]
+	if int(binary.LittleEndian.Uint32(doc)) > len(doc) {
+		return fmt.Errorf("Server truncated BSON reply doc (%d bytes: %s)", len(doc), hex.EncodeToString(reply))
+	}
+	var status commandReply
+	if err := bson.Unmarshal(doc, &status); err != nil {
+		return fmt.Errorf("Server sent invalid BSON reply doc: %v", err)
+	}
+	if status.OK != 1 {
+		return &commandError{code: status.Code, message: status.ErrMsg}
+	}
+	return bson.Unmarshal(doc, ret)
+}
+
+// authenticate authenticates with the SCRAM mechanism matching the server's
+// MaxWireVersion: SCRAM-SHA-256 from 7 (MongoDB 4.0) on, and SCRAM-SHA-1,
+// with the password digest of MongoDB, before.
+func (conn *Connection) authenticate(wireVersion int32, database, username, password string) (*auth.Attempt, error) {
+	ret := &auth.Attempt{Username: username, Mechanism: sasl.ScramSHA256}
+	if wireVersion < 7 {
+		ret.Mechanism = sasl.ScramSHA1
+		digest := md5.Sum([]byte(username + ":mongo:" + password))
+		password = hex.EncodeToString(digest[:])
+	}
+	client := sasl.NewScramClient(ret.Mechanism, username, password)
+	if client == nil {
+		return ret, fmt.Errorf("could not initialize %s", ret.Mechanism)
+	}
+	payload, err := client.Next(nil)
+	if err != nil {
+		return ret, err
+	}
+	var reply saslReply
+	err = conn.runCommand(wireVersion, database, bson.D{
+		{Name: "saslStart", Value: 1},
+		{Name: "mechanism", Value: ret.Mechanism},
+		{Name: "payload", Value: payload},
+		{Name: "autoAuthorize", Value: 1},
+	}, &reply)
+	for i := 0; err == nil && !reply.Done; i++ {
+		if i == maxSASLSteps {
+			return ret, fmt.Errorf("too many SASL steps")
+		}
+		if payload, err = client.Next(reply.Payload); err != nil {
+			return ret, err
+		}
+		conversationID := reply.ConversationID
+		reply = saslReply{}
+		err = conn.runCommand(wireVersion, database, bson.D{
+			{Name: "saslContinue", Value: 1},
+			{Name: "conversationId", Value: conversationID},
+			{Name: "payload", Value: payload},
+		}, &reply)
+	}
+	if cmdErr, ok := err.(*commandError); ok {
+		ret.ErrorCode = strconv.Itoa(cmdErr.code)
+		ret.ErrorMessage = cmdErr.message
+		return ret, nil
+	}
+	if err != nil {
+		return ret, err
+	}
+	ret.Success = true
+	return ret, nil
+}
+
+// listDatabases returns (at most auth.MaxDatabases of) the names of the databases,
+// after a successful login.
+func (conn *Connection) listDatabases(wireVersion int32) ([]string, error) {
+	var reply listDatabasesReply
+	err := conn.runCommand(wireVersion, "admin", bson.D{
+		{Name: "listDatabases", Value: 1},
+		{Name: "nameOnly", Value: true},
+	}, &reply)
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, database := range reply.Databases {
+		if len(ret) == auth.MaxDatabases {
+			break
+		}
+		ret = append(ret, database.Name)
+	}
+	return ret, nil
+}
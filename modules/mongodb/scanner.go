@@ -1,12 +1,14 @@
 package mongodb
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/auth"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -17,6 +19,8 @@ type Module struct {
 // Flags contains mongodb-specific command-line flags.
 type Flags struct {
 	zgrab2.BaseFlags
+	CredsFile    string `long:"creds-file" description:"File of credentials (host username:password... per line, as for the http module) to attempt with SCRAM after the handshake; on success, the databases are listed"`
+	AuthDatabase string `long:"auth-database" description:"The database to authenticate against" default:"admin"`
 }
 
 // Scanner implements the zgrab2.Scanner interface
@@ -25,6 +29,7 @@ type Scanner struct {
 	isMasterMsg         []byte
 	buildInfoCommandMsg []byte
 	buildInfoOpMsg      []byte
+	creds               *auth.Credentials
 }
 
 // scan holds the state for the scan of an individual target
@@ -184,6 +189,9 @@ type IsMaster_t struct {
 type Result struct {
 	IsMaster  *IsMaster_t  `json:"is_master,omitempty"`
 	BuildInfo *BuildInfo_t `json:"build_info,omitempty"`
+
+	// Auth is the outcome of the login attempts, if --creds-file is set.
+	Auth *AuthResult `json:"auth,omitempty"`
 }
 
 // Init initializes the scanner
@@ -193,6 +201,13 @@ func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	scanner.isMasterMsg = getIsMasterMsg()
 	scanner.buildInfoCommandMsg = getBuildInfoCommandMsg()
 	scanner.buildInfoOpMsg = getBuildInfoOpMsg()
+	if f.CredsFile != "" {
+		creds, err := auth.ReadFile(f.CredsFile)
+		if err != nil {
+			return err
+		}
+		scanner.creds = creds
+	}
 	return nil
 }
 
@@ -236,14 +251,19 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Result)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Perform a handshake with a MongoDB server"
 }
 
 // StartScan opens a connection to the target and sets up a scan instance for it.
-func (scanner *Scanner) StartScan(target *zgrab2.ScanTarget) (*scan, error) {
-	conn, err := target.Open(&scanner.config.BaseFlags)
+func (scanner *Scanner) StartScan(ctx context.Context, target *zgrab2.ScanTarget) (*scan, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return nil, err
 	}
@@ -295,9 +315,39 @@ func getIsMaster(conn *Connection) (*IsMaster_t, error) {
 	return document, nil
 }
 
+// authenticate attempts each credential in turn, on the same connection,
+// until one is accepted, then lists the databases.
+func (scan *scan) authenticate(creds []*auth.Credential) *AuthResult {
+	result := new(AuthResult)
+	wireVersion := scan.result.IsMaster.MaxWireVersion
+	for _, cred := range creds {
+		if cred.Token != "" {
+			continue
+		}
+		attempt, err := scan.conn.authenticate(wireVersion, scan.scanner.config.AuthDatabase, cred.Username, cred.Password)
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		result.Attempts = append(result.Attempts, *attempt)
+		if err != nil {
+			return result
+		}
+		if attempt.Success {
+			result.Success = true
+			if result.Databases, err = scan.conn.listDatabases(wireVersion); err != nil {
+				result.QueryError = err.Error()
+			}
+			return result
+		}
+	}
+	return result
+}
+
 // Scan connects to a host and performs a scan.
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	scan, err := scanner.StartScan(&target)
+// If --creds-file is set, the credentials of the target are attempted after
+// the buildInfo query.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	scan, err := scanner.StartScan(ctx, &target)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
@@ -346,6 +396,10 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	}
 	bson.Unmarshal(msg[MSGHEADER_LEN+resp_offset:], &result.BuildInfo)
 
+	if creds := scanner.creds.For(&target, scanner.config.Port); len(creds) > 0 {
+		result.Auth = scan.authenticate(creds)
+	}
+
 	return zgrab2.SCAN_SUCCESS, &result, err
 }
 
@@ -0,0 +1,156 @@
+package mongodb
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/auth"
+	"github.com/zmap/zgrab2/lib/testserver"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// salt is the SCRAM salt of the fake server.
+var salt = []byte("0123456789abcdef")
+
+// writeReply writes an OP_REPLY (opcode OP_REPLY) or OP_MSG with doc.
+func writeReply(w io.Writer, opCode int, doc interface{}) {
+	payload, _ := bson.Marshal(doc)
+	var body []byte
+	if opCode == OP_REPLY {
+		body = append(make([]byte, 20), payload...)
+		binary.LittleEndian.PutUint32(body[16:], 1)
+	} else {
+		body = append(make([]byte, 5), payload...)
+	}
+	header := make([]byte, MSGHEADER_LEN)
+	binary.LittleEndian.PutUint32(header[0:], uint32(MSGHEADER_LEN+len(body)))
+	binary.LittleEndian.PutUint32(header[12:], uint32(opCode))
+	w.Write(append(header, body...))
+}
+
+// readCommand reads an OP_MSG (or the OP_QUERY of isMaster) and returns its
+// command document.
+func readCommand(r io.Reader) (bson.M, error) {
+	header := make([]byte, MSGHEADER_LEN)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.LittleEndian.Uint32(header)-MSGHEADER_LEN)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	var doc []byte
+	if binary.LittleEndian.Uint32(header[12:]) == OP_QUERY {
+		doc = body[4+bytes.IndexByte(body[4:], 0)+9:]
+	} else {
+		doc = body[5:]
+	}
+	ret := bson.M{}
+	return ret, bson.Unmarshal(doc, ret)
+}
+
+// hmacSHA256 returns HMAC-SHA-256(key, s).
+func hmacSHA256(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+// handle serves a connection, accepting the password secret for admin with
+// SCRAM-SHA-256.
+func handle(conn net.Conn) {
+	if _, err := readCommand(conn); err != nil {
+		return
+	}
+	writeReply(conn, OP_REPLY, bson.M{"ismaster": true, "maxWireVersion": 7, "ok": 1})
+	var clientFirstBare, serverFirst string
+	for {
+		cmd, err := readCommand(conn)
+		if err != nil {
+			return
+		}
+		switch {
+		case cmd["buildinfo"] != nil:
+			writeReply(conn, OP_MSG, bson.M{"version": "4.0.0", "ok": 1})
+		case cmd["saslStart"] != nil:
+			clientFirstBare = strings.TrimPrefix(string(cmd["payload"].([]byte)), "n,,")
+			nonce := clientFirstBare[strings.Index(clientFirstBare, ",r=")+3:]
+			serverFirst = "r=" + nonce + "server,s=" + base64.StdEncoding.EncodeToString(salt) + ",i=1"
+			writeReply(conn, OP_MSG, bson.M{"conversationId": 1, "done": false, "payload": []byte(serverFirst), "ok": 1})
+		case cmd["saslContinue"] != nil:
+			clientFinal := string(cmd["payload"].([]byte))
+			if clientFinal == "" {
+				writeReply(conn, OP_MSG, bson.M{"conversationId": 1, "done": true, "payload": []byte{}, "ok": 1})
+				continue
+			}
+			// With i=1, the salted password is HMAC(password, salt + INT(1)).
+			salted := hmacSHA256([]byte("secret"), string(salt)+"\x00\x00\x00\x01")
+			withoutProof := clientFinal[:strings.Index(clientFinal, ",p=")]
+			authMessage := clientFirstBare + "," + serverFirst + "," + withoutProof
+			clientKey := hmacSHA256(salted, "Client Key")
+			storedKey := sha256.Sum256(clientKey)
+			proof := hmacSHA256(storedKey[:], authMessage)
+			for i := range proof {
+				proof[i] ^= clientKey[i]
+			}
+			if !strings.HasPrefix(clientFirstBare, "n=admin,") || clientFinal != withoutProof+",p="+base64.StdEncoding.EncodeToString(proof) {
+				writeReply(conn, OP_MSG, bson.M{"ok": 0, "errmsg": "Authentication failed.", "code": 18, "codeName": "AuthenticationFailed"})
+				continue
+			}
+			signature := hmacSHA256(hmacSHA256(salted, "Server Key"), authMessage)
+			writeReply(conn, OP_MSG, bson.M{"conversationId": 1, "done": false, "payload": []byte("v=" + base64.StdEncoding.EncodeToString(signature)), "ok": 1})
+		case cmd["listDatabases"] != nil:
+			writeReply(conn, OP_MSG, bson.M{"databases": []bson.M{{"name": "admin"}, {"name": "local"}}, "ok": 1})
+		default:
+			return
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		handle(conn)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	credsFile, err := ioutil.TempFile("", "creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(credsFile.Name())
+	credsFile.WriteString("127.0.0.1 admin:wrong admin:secret\n")
+	credsFile.Close()
+
+	flags := &Flags{
+		CredsFile:    credsFile.Name(),
+		AuthDatabase: "admin",
+	}
+	ret := zgrab2test.MustScan(t, new(Scanner), flags, server.Addr())
+	expected := &AuthResult{
+		Result: auth.Result{
+			Attempts: []auth.Attempt{
+				{Username: "admin", Mechanism: "SCRAM-SHA-256", ErrorCode: "18", ErrorMessage: "Authentication failed."},
+				{Username: "admin", Mechanism: "SCRAM-SHA-256", Success: true},
+			},
+			Success: true,
+		},
+		Databases: []string{"admin", "local"},
+	}
+	if authResult := (*ret.(**Result)).Auth; !reflect.DeepEqual(authResult, expected) {
+		t.Errorf("got auth %+v", authResult)
+	}
+}
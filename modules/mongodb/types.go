@@ -48,13 +48,19 @@ type Connection struct {
 
 // ReadMsg reads a full MongoDB message from the connection.
 func (conn *Connection) ReadMsg() ([]byte, error) {
+	return conn.readMsg(5125)
+}
+
+// readMsg reads a full MongoDB message of at most maxlen bytes from the
+// connection.
+func (conn *Connection) readMsg(maxlen uint32) ([]byte, error) {
 	var msglen_buf [4]byte
 	_, err := io.ReadFull(conn.conn, msglen_buf[:])
 	if err != nil {
 		return nil, err
 	}
 	msglen := binary.LittleEndian.Uint32(msglen_buf[:])
-	if msglen < 4 || msglen > 5125 {
+	if msglen < 4 || msglen > maxlen {
 	        // msglen is length of message which includes msglen itself; Less than
 		// four is invalid. More than a few K probably mean this isn't actually
 		// a mongodb server.
@@ -0,0 +1,181 @@
+package mqtt
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// The control packet types of MQTT 3.1.1 (section 2.2.1).
+const (
+	typeConnect    = 1
+	typeConnAck    = 2
+	typePublish    = 3
+	typeSubscribe  = 8
+	typeSubAck     = 9
+	typeDisconnect = 14
+)
+
+// The flags of a CONNECT packet (section 3.1.2.3).
+const (
+	flagCleanSession = 0x02
+	flagPassword     = 0x40
+	flagUsername     = 0x80
+)
+
+// protocolLevel is the protocol level of MQTT 3.1.1.
+const protocolLevel = 4
+
+// keepAlive is the keep alive interval sent in the CONNECT, in seconds.
+const keepAlive = 60
+
+// maxPacketSize bounds the size of a packet read from the broker.
+const maxPacketSize = 1 << 16
+
+var (
+	// ErrInvalidPacket is returned if the broker sends a malformed packet.
+	ErrInvalidPacket = errors.New("invalid MQTT packet")
+
+	// ErrTooLarge is returned if a packet is larger than maxPacketSize.
+	ErrTooLarge = errors.New("MQTT packet too large")
+)
+
+// returnCodes names the return codes of a CONNACK (section 3.2.2.3).
+var returnCodes = map[byte]string{
+	0: "accepted",
+	1: "unacceptable_protocol_version",
+	2: "identifier_rejected",
+	3: "server_unavailable",
+	4: "bad_username_or_password",
+	5: "not_authorized",
+}
+
+// packet is a control packet.
+type packet struct {
+	typ   byte
+	flags byte
+	body  []byte
+}
+
+// encodePacket returns a packet with its fixed header.
+func encodePacket(typ, flags byte, body []byte) []byte {
+	ret := []byte{typ<<4 | flags}
+	n := len(body)
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n > 0 {
+			b |= 0x80
+		}
+		ret = append(ret, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(ret, body...)
+}
+
+// appendString appends a string prefixed by its 16-bit length.
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+// encodeConnect returns a CONNECT packet, with a clean session. The username
+// and password are only sent if not empty.
+func encodeConnect(clientID, username, password string) []byte {
+	var flags byte = flagCleanSession
+	if username != "" {
+		flags |= flagUsername
+	}
+	if password != "" {
+		flags |= flagPassword
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel, flags, keepAlive>>8, keepAlive&0xff)
+	body = appendString(body, clientID)
+	if username != "" {
+		body = appendString(body, username)
+	}
+	if password != "" {
+		body = appendString(body, password)
+	}
+	return encodePacket(typeConnect, 0, body)
+}
+
+// encodeSubscribe returns a SUBSCRIBE packet for a single topic filter with
+// QoS 0.
+func encodeSubscribe(id uint16, filter string) []byte {
+	body := []byte{byte(id >> 8), byte(id)}
+	body = appendString(body, filter)
+	body = append(body, 0)
+	return encodePacket(typeSubscribe, 0x02, body)
+}
+
+// encodeDisconnect returns a DISCONNECT packet.
+func encodeDisconnect() []byte {
+	return encodePacket(typeDisconnect, 0, nil)
+}
+
+// readPacket reads the next control packet.
+func readPacket(r io.ByteReader) (*packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	for i := 0; ; i++ {
+		if i == 4 {
+			return nil, ErrInvalidPacket
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		size |= int(b&0x7f) << (7 * uint(i))
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if size > maxPacketSize {
+		return nil, ErrTooLarge
+	}
+	body := make([]byte, size)
+	for i := range body {
+		if body[i], err = r.ReadByte(); err != nil {
+			return nil, err
+		}
+	}
+	return &packet{typ: first >> 4, flags: first & 0x0f, body: body}, nil
+}
+
+// connAck decodes a CONNACK, returning the session present flag and the
+// return code.
+func (p *packet) connAck() (bool, byte, error) {
+	if p.typ != typeConnAck || len(p.body) != 2 {
+		return false, 0, ErrInvalidPacket
+	}
+	return p.body[0]&0x01 != 0, p.body[1], nil
+}
+
+// publish decodes the topic and payload of a PUBLISH.
+func (p *packet) publish() (string, []byte, error) {
+	if p.typ != typePublish || len(p.body) < 2 {
+		return "", nil, ErrInvalidPacket
+	}
+	n := int(binary.BigEndian.Uint16(p.body))
+	rest := p.body[2:]
+	if len(rest) < n {
+		return "", nil, ErrInvalidPacket
+	}
+	topic := string(rest[:n])
+	rest = rest[n:]
+	// A packet identifier follows the topic if QoS > 0.
+	if p.flags&0x06 != 0 {
+		if len(rest) < 2 {
+			return "", nil, ErrInvalidPacket
+		}
+		rest = rest[2:]
+	}
+	return topic, rest, nil
+}
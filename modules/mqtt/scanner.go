@@ -0,0 +1,277 @@
+// Package mqtt provides a zgrab2 module that connects to MQTT brokers.
+// Default Port: 1883 (TCP)
+//
+// The scanner sends an MQTT 3.1.1 CONNECT, with the configured client ID and
+// optional credentials, over TLS if --mqtts is set (usually on port 8883),
+// and records the return code of the CONNACK. A broker accepting clients
+// without credentials is open to anyone. With --subscribe-sys, the scanner
+// then subscribes to the $SYS/# topics for --sys-wait, and records the
+// messages published there, such as the broker version and uptime.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// sysFilter is the topic filter of the broker statistics.
+const sysFilter = "$SYS/#"
+
+// maxSysTopics bounds the number of $SYS messages recorded.
+const maxSysTopics = 256
+
+// Flags holds the command-line configuration for the mqtt module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	ClientID     string        `long:"client-id" default:"zgrab2" description:"Client identifier to send in the CONNECT."`
+	Username     string        `long:"username" description:"User name to send in the CONNECT, if any."`
+	Password     string        `long:"password" description:"Password to send in the CONNECT, if any."`
+	MQTTS        bool          `long:"mqtts" description:"Negotiate TLS immediately after connecting, as on port 8883."`
+	SubscribeSys bool          `long:"subscribe-sys" description:"If the connection is accepted, subscribe to $SYS/# and record the messages received."`
+	SysWait      time.Duration `long:"sys-wait" default:"3s" description:"How long to wait for $SYS messages."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Topic is a message published on a topic.
+type Topic struct {
+	Topic   string `json:"topic"`
+	Payload string `json:"payload"`
+}
+
+// Sys holds the messages received on the $SYS topics.
+type Sys struct {
+	// Subscribed is true if the broker granted the subscription.
+	Subscribed bool `json:"subscribed"`
+
+	// Version and Uptime are the payloads of the first topics ending in
+	// /version and /uptime, such as $SYS/broker/version.
+	Version string `json:"version,omitempty"`
+	Uptime  string `json:"uptime,omitempty"`
+
+	// Topics lists the messages received.
+	Topics []Topic `json:"topics,omitempty"`
+}
+
+// Results is the output of the mqtt module.
+type Results struct {
+	// ReturnCode is the return code of the CONNACK.
+	ReturnCode     byte   `json:"return_code"`
+	ReturnCodeName string `json:"return_code_name,omitempty"`
+
+	// SessionPresent is the session present flag of the CONNACK.
+	SessionPresent bool `json:"session_present,omitempty"`
+
+	// Accepted is true if the broker accepted the connection.
+	Accepted bool `json:"accepted"`
+
+	// Anonymous is true if the broker accepted the connection without a
+	// user name.
+	Anonymous bool `json:"anonymous"`
+
+	// Sys holds the $SYS messages, with --subscribe-sys.
+	Sys *Sys `json:"sys,omitempty"`
+
+	// TLSLog is the standard TLS log, if --mqtts is enabled.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("mqtt", "MQTT", module.Description(), 1883, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Connect to an MQTT broker, optionally with TLS and credentials, and read its $SYS topics"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if flags.Password != "" && flags.Username == "" {
+		log.Error("Cannot send --password without --username")
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "mqtt"
+}
+
+// open connects to the target, negotiating TLS with --mqtts.
+func (scanner *Scanner) open(ctx context.Context, target *zgrab2.ScanTarget, results *Results) (net.Conn, error) {
+	if !scanner.config.MQTTS {
+		return target.Open(ctx, &scanner.config.BaseFlags)
+	}
+	conn, err := target.OpenTLS(ctx, &scanner.config.BaseFlags, &scanner.config.TLSFlags)
+	if conn == nil {
+		return nil, err
+	}
+	results.TLSLog = conn.GetLog()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// readSys subscribes to the $SYS topics, and records the messages received
+// until the deadline.
+func readSys(conn net.Conn, reader *bufio.Reader, deadline time.Time) (*Sys, error) {
+	const id = 1
+	if _, err := conn.Write(encodeSubscribe(id, sysFilter)); err != nil {
+		return nil, err
+	}
+	sys := new(Sys)
+	for len(sys.Topics) < maxSysTopics {
+		// An explicit deadline only holds for one read of the connection.
+		conn.SetReadDeadline(deadline)
+		p, err := readPacket(reader)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			return sys, err
+		}
+		switch p.typ {
+		case typeSubAck:
+			// The packet ID, then the granted QoS, or 0x80 for a failure.
+			sys.Subscribed = len(p.body) == 3 && p.body[2]&0x80 == 0
+		case typePublish:
+			topic, payload, err := p.publish()
+			if err != nil {
+				return sys, err
+			}
+			sys.Topics = append(sys.Topics, Topic{Topic: topic, Payload: string(payload)})
+			if strings.HasSuffix(topic, "/version") && sys.Version == "" {
+				sys.Version = string(payload)
+			}
+			if strings.HasSuffix(topic, "/uptime") && sys.Uptime == "" {
+				sys.Uptime = string(payload)
+			}
+		}
+	}
+	return sys, nil
+}
+
+// Scan performs the following:
+//  1. Connect, and with --mqtts, negotiate TLS.
+//  2. Send a CONNECT, and read the CONNACK.
+//  3. With --subscribe-sys, if the connection was accepted, subscribe to
+//     $SYS/# and read the messages published until --sys-wait elapses.
+//  4. Send a DISCONNECT and close the connection.
+//
+// The scan succeeds if the broker answered the CONNECT, even if it refused
+// the connection.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	results := new(Results)
+	conn, err := scanner.open(ctx, &target, results)
+	if err != nil {
+		if results.TLSLog != nil {
+			return zgrab2.TryGetScanStatus(err), results, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	if _, err := conn.Write(encodeConnect(scanner.config.ClientID, scanner.config.Username, scanner.config.Password)); err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	p, err := readPacket(reader)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	sessionPresent, code, err := p.connAck()
+	if err != nil {
+		return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+	}
+	results.ReturnCode = code
+	results.ReturnCodeName = returnCodes[code]
+	if results.ReturnCodeName == "" {
+		results.ReturnCodeName = fmt.Sprintf("unknown (%d)", code)
+	}
+	results.SessionPresent = sessionPresent
+	results.Accepted = code == 0
+	results.Anonymous = results.Accepted && scanner.config.Username == ""
+	if !results.Accepted {
+		return zgrab2.SCAN_SUCCESS, results, nil
+	}
+	if scanner.config.SubscribeSys {
+		sys, err := readSys(conn, reader, time.Now().Add(scanner.config.SysWait))
+		results.Sys = sys
+		if err != nil {
+			log.Debugf("mqtt: reading $SYS of %s failed: %s", target.String(), err)
+		}
+	}
+	conn.Write(encodeDisconnect())
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,95 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// publish returns a PUBLISH packet with QoS 0.
+func publish(topic, payload string) []byte {
+	return encodePacket(typePublish, 0, append(appendString(nil, topic), payload...))
+}
+
+// serve returns the handler of a broker answering the CONNECT with code, and
+// the SUBSCRIBE with a SUBACK followed by two $SYS messages. The CONNECT
+// received is sent to connects.
+func serve(code byte, connects chan<- []byte) func(conn net.Conn) error {
+	return func(conn net.Conn) error {
+		reader := bufio.NewReader(conn)
+		for {
+			p, err := readPacket(reader)
+			if err != nil {
+				return err
+			}
+			switch p.typ {
+			case typeConnect:
+				connects <- encodePacket(p.typ, p.flags, p.body)
+				conn.Write(encodePacket(typeConnAck, 0, []byte{0, code}))
+			case typeSubscribe:
+				conn.Write(encodePacket(typeSubAck, 0, []byte{p.body[0], p.body[1], 0}))
+				conn.Write(publish("$SYS/broker/version", "mosquitto version 2.0.18"))
+				conn.Write(publish("$SYS/broker/uptime", "4242 seconds"))
+			case typeDisconnect:
+				return nil
+			}
+		}
+	}
+}
+
+func scan(t *testing.T, flags *Flags, code byte) (*Results, []byte) {
+	connects := make(chan []byte, 1)
+	server, err := testserver.New(testserver.Config{Handler: serve(code, connects)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	return zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*Results), <-connects
+}
+
+func TestAnonymous(t *testing.T) {
+	results, connect := scan(t, &Flags{ClientID: "zgrab2", SubscribeSys: true, SysWait: 500 * time.Millisecond}, 0)
+	expected := append([]byte{0x10, 18, 0, 4, 'M', 'Q', 'T', 'T', 4, flagCleanSession, 0, 60, 0, 6}, "zgrab2"...)
+	if !bytes.Equal(connect, expected) {
+		t.Errorf("sent CONNECT %x, expected %x", connect, expected)
+	}
+	if !results.Accepted || !results.Anonymous || results.ReturnCodeName != "accepted" {
+		t.Errorf("got %+v", results)
+	}
+	sys := &Sys{
+		Subscribed: true,
+		Version:    "mosquitto version 2.0.18",
+		Uptime:     "4242 seconds",
+		Topics: []Topic{
+			{"$SYS/broker/version", "mosquitto version 2.0.18"},
+			{"$SYS/broker/uptime", "4242 seconds"},
+		},
+	}
+	if !reflect.DeepEqual(results.Sys, sys) {
+		t.Errorf("got $SYS %+v, expected %+v", results.Sys, sys)
+	}
+}
+
+func TestRefused(t *testing.T) {
+	results, connect := scan(t, &Flags{ClientID: "c", Username: "u", Password: "p"}, 5)
+	if connect[9] != flagCleanSession|flagUsername|flagPassword {
+		t.Errorf("got connect flags %#x", connect[9])
+	}
+	if results.Accepted || results.Anonymous || results.ReturnCodeName != "not_authorized" || results.Sys != nil {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestRemainingLength(t *testing.T) {
+	body := make([]byte, 321)
+	p, err := readPacket(bufio.NewReader(bytes.NewReader(encodePacket(typePublish, 0, body))))
+	if err != nil || p.typ != typePublish || len(p.body) != 321 {
+		t.Errorf("got %+v, error %v", p, err)
+	}
+}
@@ -916,20 +916,6 @@ func NewConnection(conn net.Conn) *Connection {
 	return ret
 }
 
-// Login sends the LOGIN packet. Called after Handshake(). If
-// self.getEncryptMode() == EncryptModeOff, disables TLS afterwards.
-// NOTE: Not currently implemented.
-func (connection *Connection) Login() {
-	panic("unimplemented")
-	// TODO: send login
-	if connection.getEncryptMode() != EncryptModeOn {
-		// Client was only using encryption for login, so switch back to rawConn
-		connection.tdsConn = &tdsConnection{conn: connection.rawConn, enabled: true, session: connection}
-		// tdsConnection.Write(rawData) -> net.Conn.Write(header + rawData)
-		// conn.Read() -> header + rawData -> tdsConnection.Read() -> rawData
-	}
-}
-
 // getEncryptMode returns the EncryptMode enum returned by the server in the
 // PRELOGIN step. If PRELOGIN has not yet been called or if the ENCRYPTION token
 // was not included / was invalid, returns EncryptModeUnknown.
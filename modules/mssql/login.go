@@ -0,0 +1,375 @@
+package mssql
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Token types of the tabular result stream.
+// See https://msdn.microsoft.com/en-us/library/dd304523.aspx
+const (
+	tokenReturnStatus  = 0x79
+	tokenColMetadata   = 0x81
+	tokenOrder         = 0xA9
+	tokenError         = 0xAA
+	tokenInfo          = 0xAB
+	tokenLoginAck      = 0xAD
+	tokenFeatureExtAck = 0xAE
+	tokenRow           = 0xD1
+	tokenNBCRow        = 0xD2
+	tokenEnvChange     = 0xE3
+	tokenSSPI          = 0xED
+	tokenDone          = 0xFD
+	tokenDoneProc      = 0xFE
+	tokenDoneInProc    = 0xFF
+)
+
+// Column types supported in query results (those with a USHORTLEN maximum
+// length and a collation).
+const (
+	typeBigVarChar  = 0xA7
+	typeBigChar     = 0xAF
+	typeNVarChar    = 0xE7
+	typeNChar       = 0xEF
+	tdsVersion74    = 0x74000004
+	login7FixedSize = 94
+	maxResponseSize = 1024 * 1024
+)
+
+// ErrUnsupportedColumn is returned for query results with a column type
+// other than (N)(VAR)CHAR.
+var ErrUnsupportedColumn = errors.New("unsupported column type")
+
+// LoginAck is the LOGINACK token returned by the server on a successful
+// login.
+type LoginAck struct {
+	// Interface is the type of interface (1 for SQL).
+	Interface byte `json:"interface"`
+
+	// TDSVersion is the TDS version chosen by the server.
+	TDSVersion uint32 `json:"tds_version"`
+
+	// ProgName is the name of the server (e.g. "Microsoft SQL Server").
+	ProgName string `json:"prog_name,omitempty"`
+
+	// ProgVersion is the version of the server, "MAJOR.MINOR.BUILD_NUMBER".
+	ProgVersion string `json:"prog_version,omitempty"`
+}
+
+// ServerMessage is an ERROR or INFO token returned by the server.
+type ServerMessage struct {
+	Number     int32  `json:"number"`
+	State      byte   `json:"state"`
+	Class      byte   `json:"class"`
+	Message    string `json:"message,omitempty"`
+	ServerName string `json:"server_name,omitempty"`
+	ProcName   string `json:"proc_name,omitempty"`
+	LineNumber int32  `json:"line_number,omitempty"`
+}
+
+// Error implements the error interface.
+func (msg *ServerMessage) Error() string {
+	return fmt.Sprintf("error %d (state %d, class %d): %s", msg.Number, msg.State, msg.Class, msg.Message)
+}
+
+// tokens is the content of a tabular result stream.
+type tokens struct {
+	loginAck *LoginAck
+	errors   []ServerMessage
+	columns  []byte
+	rows     [][]string
+}
+
+// encodeUCS2 encodes s in UTF-16LE.
+func encodeUCS2(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	ret := make([]byte, 2*len(units))
+	for i, unit := range units {
+		binary.LittleEndian.PutUint16(ret[2*i:], unit)
+	}
+	return ret
+}
+
+// decodeUCS2 decodes UTF-16LE.
+func decodeUCS2(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// obfuscatePassword applies the LOGIN7 password encoding: each byte has its
+// nibbles swapped, then is XORed with 0xA5.
+func obfuscatePassword(password string) []byte {
+	ret := encodeUCS2(password)
+	for i, b := range ret {
+		ret[i] = (b<<4 | b>>4) ^ 0xA5
+	}
+	return ret
+}
+
+// encodeLogin7 encodes a LOGIN7 message.
+// See https://msdn.microsoft.com/en-us/library/dd304019.aspx
+func encodeLogin7(username, password, appName string) []byte {
+	ret := make([]byte, login7FixedSize)
+	binary.LittleEndian.PutUint32(ret[4:], tdsVersion74)
+	// PacketSize
+	binary.LittleEndian.PutUint32(ret[8:], 4096)
+	// ClientProgVer
+	binary.LittleEndian.PutUint32(ret[12:], 0x07)
+	// OptionFlags1: USE_DB_ON | INIT_DB_FATAL | SET_LANG_ON
+	ret[24] = 0xE0
+	// OptionFlags2: INIT_LANG_FATAL | ODBC_ON
+	ret[25] = 0x03
+	// ClientLCID: en-US
+	binary.LittleEndian.PutUint32(ret[32:], 0x409)
+	// HostName, UserName, Password, AppName, ServerName, Extension,
+	// CltIntName, Language, Database
+	fields := [][]byte{nil, encodeUCS2(username), obfuscatePassword(password), encodeUCS2(appName), nil, nil, encodeUCS2(appName), nil, nil}
+	for i, field := range fields {
+		binary.LittleEndian.PutUint16(ret[36+4*i:], uint16(len(ret)))
+		binary.LittleEndian.PutUint16(ret[38+4*i:], uint16(len(field)/2))
+		ret = append(ret, field...)
+	}
+	// ClientID (72-77) is zero; SSPI, AtchDBFile and ChangePassword are
+	// empty, at the end of the data.
+	for _, offset := range []int{78, 82, 86} {
+		binary.LittleEndian.PutUint16(ret[offset:], uint16(len(ret)))
+	}
+	binary.LittleEndian.PutUint32(ret[0:], uint32(len(ret)))
+	return ret
+}
+
+// readMessage reads the packets of a message, up to the end of message,
+// and returns their concatenated bodies.
+func (connection *Connection) readMessage() ([]byte, error) {
+	var ret []byte
+	for {
+		packet, err := connection.tdsConn.ReadPacket()
+		if err != nil {
+			return nil, err
+		}
+		if packet.Type != TDSPacketTypeTabularResult {
+			return nil, fmt.Errorf("unexpected packet type 0x%02x", packet.Type)
+		}
+		ret = append(ret, packet.Body...)
+		if len(ret) > maxResponseSize {
+			return nil, ErrTooLarge
+		}
+		if packet.Status&TDSStatusEOM != 0 {
+			return ret, nil
+		}
+	}
+}
+
+// tokenReader reads the fields of a token stream.
+type tokenReader struct {
+	buf []byte
+	err error
+}
+
+func (r *tokenReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.buf) {
+		r.err = ErrInvalidData
+		return nil
+	}
+	ret := r.buf[:n]
+	r.buf = r.buf[n:]
+	return ret
+}
+
+func (r *tokenReader) readByte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *tokenReader) readUint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *tokenReader) readUint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// readBVarChar reads a B_VARCHAR (US_VARCHAR if long): a character count,
+// followed by UTF-16LE characters.
+func (r *tokenReader) readBVarChar(long bool) string {
+	var n int
+	if long {
+		n = int(r.readUint16())
+	} else {
+		n = int(r.readByte())
+	}
+	return decodeUCS2(r.next(2 * n))
+}
+
+// serverMessage reads the body of an ERROR or INFO token.
+func (r *tokenReader) serverMessage() ServerMessage {
+	var msg ServerMessage
+	msg.Number = int32(r.readUint32())
+	msg.State = r.readByte()
+	msg.Class = r.readByte()
+	msg.Message = r.readBVarChar(true)
+	msg.ServerName = r.readBVarChar(false)
+	msg.ProcName = r.readBVarChar(false)
+	msg.LineNumber = int32(r.readUint32())
+	return msg
+}
+
+// parseTokens decodes a tabular result stream.
+func parseTokens(buf []byte) (*tokens, error) {
+	ret := new(tokens)
+	r := &tokenReader{buf: buf}
+	for len(r.buf) > 0 && r.err == nil {
+		token := r.readByte()
+		switch token {
+		case tokenLoginAck:
+			body := &tokenReader{buf: r.next(int(r.readUint16()))}
+			ack := &LoginAck{Interface: body.readByte()}
+			if v := body.next(4); v != nil {
+				ack.TDSVersion = binary.BigEndian.Uint32(v)
+			}
+			ack.ProgName = body.readBVarChar(false)
+			if v := body.next(4); v != nil {
+				ack.ProgVersion = fmt.Sprintf("%d.%d.%d", v[0], v[1], binary.BigEndian.Uint16(v[2:]))
+			}
+			ret.loginAck = ack
+		case tokenError:
+			body := &tokenReader{buf: r.next(int(r.readUint16()))}
+			ret.errors = append(ret.errors, body.serverMessage())
+		case tokenInfo, tokenEnvChange, tokenOrder, tokenSSPI:
+			r.next(int(r.readUint16()))
+		case tokenDone, tokenDoneProc, tokenDoneInProc:
+			r.next(12)
+		case tokenReturnStatus:
+			r.next(4)
+		case tokenFeatureExtAck:
+			for r.err == nil && r.readByte() != 0xFF {
+				r.next(int(r.readUint32()))
+			}
+		case tokenColMetadata:
+			n := r.readUint16()
+			if n == 0xFFFF {
+				continue
+			}
+			ret.columns = nil
+			for i := 0; i < int(n) && r.err == nil; i++ {
+				// UserType, Flags
+				r.next(6)
+				columnType := r.readByte()
+				switch columnType {
+				case typeBigVarChar, typeBigChar, typeNVarChar, typeNChar:
+				default:
+					return ret, ErrUnsupportedColumn
+				}
+				if r.readUint16() == 0xFFFF {
+					// (N)VARCHAR(MAX) is sent in PLP chunks.
+					return ret, ErrUnsupportedColumn
+				}
+				// Collation
+				r.next(5)
+				r.readBVarChar(false)
+				ret.columns = append(ret.columns, columnType)
+			}
+		case tokenRow, tokenNBCRow:
+			var nulls []byte
+			if token == tokenNBCRow {
+				nulls = r.next((len(ret.columns) + 7) / 8)
+			}
+			row := make([]string, len(ret.columns))
+			for i, columnType := range ret.columns {
+				if nulls != nil && nulls[i/8]&(1<<uint(i%8)) != 0 {
+					continue
+				}
+				length := r.readUint16()
+				if length == 0xFFFF {
+					continue
+				}
+				value := r.next(int(length))
+				if columnType == typeNVarChar || columnType == typeNChar {
+					row[i] = decodeUCS2(value)
+				} else {
+					row[i] = string(value)
+				}
+			}
+			ret.rows = append(ret.rows, row)
+		default:
+			return ret, fmt.Errorf("unexpected token 0x%02x", token)
+		}
+	}
+	return ret, r.err
+}
+
+// Login sends the LOGIN7 message with the given credentials, after
+// Handshake(), and returns the LOGINACK of the server on success, or else
+// the first error it returned. If the encryption was negotiated for the
+// login only (EncryptModeOff), the connection is switched back to the raw
+// connection after sending the login.
+func (connection *Connection) Login(username, password string) (*LoginAck, *ServerMessage, error) {
+	if err := connection.SendTDSPacket(TDSPacketTypeTDS7Login, encodeLogin7(username, password, "zgrab2")); err != nil {
+		return nil, nil, err
+	}
+	if connection.tlsConn != nil && connection.getEncryptMode() == EncryptModeOff {
+		// Client was only using encryption for login, so switch back to rawConn
+		connection.tdsConn = &tdsConnection{conn: connection.rawConn, enabled: true, session: connection}
+	}
+	response, err := connection.readMessage()
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := parseTokens(response)
+	if result.loginAck != nil {
+		return result.loginAck, nil, nil
+	}
+	if len(result.errors) > 0 {
+		return nil, &result.errors[0], nil
+	}
+	if err == nil {
+		err = fmt.Errorf("no LOGINACK in the response to LOGIN7")
+	}
+	return nil, nil, err
+}
+
+// Query sends a SQL batch, after a successful Login(), and returns (at most
+// maxRows of) the rows of its result, which must have (N)(VAR)CHAR columns
+// only. NULL values are returned as empty strings.
+func (connection *Connection) Query(query string, maxRows int) ([][]string, error) {
+	// ALL_HEADERS, with the transaction descriptor header (auto-commit).
+	headers := make([]byte, 22)
+	binary.LittleEndian.PutUint32(headers[0:], 22)
+	binary.LittleEndian.PutUint32(headers[4:], 18)
+	binary.LittleEndian.PutUint16(headers[8:], 2)
+	binary.LittleEndian.PutUint32(headers[18:], 1)
+	if err := connection.SendTDSPacket(uint8(TDSPacketTypeSQLBatch), append(headers, encodeUCS2(query)...)); err != nil {
+		return nil, err
+	}
+	response, err := connection.readMessage()
+	if err != nil {
+		return nil, err
+	}
+	result, err := parseTokens(response)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.errors) > 0 {
+		return nil, &result.errors[0]
+	}
+	if len(result.rows) > maxRows {
+		result.rows = result.rows[:maxRows]
+	}
+	return result.rows, nil
+}
@@ -9,13 +9,19 @@
 //
 // The output is the the server version and instance name, and if applicable the
 // TLS output.
+//
+// If --creds-file is set, the credentials of the target are then attempted
+// with LOGIN7, and on success the server version and databases are queried.
 package mssql
 
 import (
+	"context"
+	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/auth"
 )
 
 // ScanResults contains detailed information about each step of the
@@ -39,6 +45,29 @@ type ScanResults struct {
 
 	// TLSLog is the shared TLS handshake/scan log.
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+
+	// Auth is the outcome of the login attempts, if --creds-file is set.
+	Auth *AuthResult `json:"auth,omitempty"`
+}
+
+// AuthResult is the outcome of the login attempts, in which the ErrorCode is
+// the number of the ERROR token rejecting a credential.
+type AuthResult struct {
+	auth.Result
+
+	// LoginAck is the LOGINACK token of the successful login.
+	LoginAck *LoginAck `json:"login_ack,omitempty"`
+
+	// Version is the result of SELECT @@VERSION after a successful login.
+	Version string `json:"version,omitempty"`
+
+	// Databases are the databases of sys.databases, listed after a
+	// successful login.
+	Databases []string `json:"databases,omitempty"`
+
+	// QueryError is the error of the queries after a successful login, if
+	// any.
+	QueryError string `json:"query_error,omitempty"`
 }
 
 // Flags defines the command-line configuration options for the module.
@@ -47,6 +76,7 @@ type Flags struct {
 	zgrab2.TLSFlags
 	EncryptMode string `long:"encrypt-mode" description:"The type of encryption to request in the pre-login step. One of ENCRYPT_ON, ENCRYPT_OFF, ENCRYPT_NOT_SUP." default:"ENCRYPT_ON"`
 	Verbose     bool   `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+	CredsFile   string `long:"creds-file" description:"File of credentials (host username:password... per line, as for the http module) to attempt after the handshake; on success, the server version and databases are queried"`
 }
 
 // Module is the implementation of zgrab2.Module for the MSSQL protocol.
@@ -56,6 +86,7 @@ type Module struct {
 // Scanner is the implementation of zgrab2.Scanner for the MSSQL protocol.
 type Scanner struct {
 	config *Flags
+	creds  *auth.Credentials
 }
 
 // NewFlags returns a default Flags instance to be populated by the command
@@ -69,14 +100,20 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Perform a handshake for MSSQL databases"
 }
 
-// Validate does nothing in this module.
+// Validate rejects the TLS checks needing new connections, since TLS is
+// negotiated within the TDS PRELOGIN exchange.
 func (flags *Flags) Validate(args []string) error {
-	return nil
+	return flags.TLSFlags.CheckRedial("the mssql module")
 }
 
 // Help returns the help string for this module.
@@ -91,6 +128,13 @@ func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	if f.Verbose {
 		log.SetLevel(log.DebugLevel)
 	}
+	if f.CredsFile != "" {
+		creds, err := auth.ReadFile(f.CredsFile)
+		if err != nil {
+			return err
+		}
+		scanner.creds = creds
+	}
 	return nil
 }
 
@@ -114,6 +158,85 @@ func (scanner *Scanner) GetTrigger() string {
 	return scanner.config.Trigger
 }
 
+// connect opens a new connection to the target for another login attempt,
+// and performs the handshake.
+func (scanner *Scanner) connect(ctx context.Context, target zgrab2.ScanTarget) (*Connection, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	sql := NewConnection(conn)
+	if _, err := sql.Handshake(scanner.config); err != nil {
+		sql.Close()
+		return nil, err
+	}
+	return sql, nil
+}
+
+// authenticate attempts each credential in turn (the first on sql, the
+// others on new connections, since the server closes the connection after a
+// failed login) until one is accepted, then queries the server version and
+// databases.
+func (scanner *Scanner) authenticate(ctx context.Context, target zgrab2.ScanTarget, sql *Connection, creds []*auth.Credential) *AuthResult {
+	result := new(AuthResult)
+	first := true
+	for _, cred := range creds {
+		if cred.Token != "" {
+			continue
+		}
+		if !first {
+			var err error
+			if sql, err = scanner.connect(ctx, target); err != nil {
+				result.Attempts = append(result.Attempts, auth.Attempt{Username: cred.Username, Error: err.Error()})
+				return result
+			}
+			defer sql.Close()
+		}
+		first = false
+		ack, serverErr, err := sql.Login(cred.Username, cred.Password)
+		attempt := auth.Attempt{Username: cred.Username, Success: ack != nil}
+		if serverErr != nil {
+			attempt.ErrorCode = strconv.Itoa(int(serverErr.Number))
+			attempt.ErrorMessage = serverErr.Message
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		result.Attempts = append(result.Attempts, attempt)
+		if err != nil {
+			return result
+		}
+		if attempt.Success {
+			result.Success = true
+			result.LoginAck = ack
+			scanner.query(sql, result)
+			return result
+		}
+	}
+	return result
+}
+
+// query fills in the server version and databases of result, after a
+// successful login.
+func (scanner *Scanner) query(sql *Connection, result *AuthResult) {
+	rows, err := sql.Query("SELECT CAST(@@VERSION AS NVARCHAR(4000))", 1)
+	if err != nil {
+		result.QueryError = err.Error()
+		return
+	}
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		result.Version = rows[0][0]
+	}
+	if rows, err = sql.Query("SELECT CAST(name AS NVARCHAR(128)) FROM sys.databases", auth.MaxDatabases); err != nil {
+		result.QueryError = err.Error()
+	}
+	for _, row := range rows {
+		if len(row) > 0 {
+			result.Databases = append(result.Databases, row[0])
+		}
+	}
+}
+
 // Scan performs the MSSQL scan.
 // 1. Open a TCP connection to the target port (default 1433).
 // 2. Send a PRELOGIN packet to the server.
@@ -121,8 +244,9 @@ func (scanner *Scanner) GetTrigger() string {
 // 4. If the server encrypt mode is EncryptModeNotSupported, break.
 // 5. Perform a TLS handshake, with the packets wrapped in TDS headers.
 // 6. Decode the Version and InstanceName from the PRELOGIN response
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	conn, err := target.Open(&scanner.config.BaseFlags)
+// 7. If --creds-file is set, attempt the credentials of the target.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
@@ -172,6 +296,9 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 			return zgrab2.TryGetScanStatus(handshakeErr), result, handshakeErr
 		}
 	}
+	if creds := scanner.creds.For(&target, scanner.config.Port); len(creds) > 0 {
+		result.Auth = scanner.authenticate(ctx, target, sql, creds)
+	}
 	return zgrab2.SCAN_SUCCESS, result, nil
 }
 
@@ -0,0 +1,152 @@
+package mssql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/auth"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// writeMessage writes a tabular result packet with the given body.
+func writeMessage(w io.Writer, body []byte) {
+	packet := &TDSPacket{TDSHeader: TDSHeader{Type: TDSPacketTypeTabularResult, Status: TDSStatusEOM}, Body: body}
+	encoded, _ := packet.Encode()
+	w.Write(encoded)
+}
+
+// readMessage reads a client packet.
+func readMessage(r io.Reader) (*TDSPacket, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[2:4])-8)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return &TDSPacket{TDSHeader: TDSHeader{Type: header[0], Status: header[1]}, Body: body}, nil
+}
+
+// bVarChar encodes a B_VARCHAR (US_VARCHAR if long).
+func bVarChar(s string, long bool) []byte {
+	encoded := encodeUCS2(s)
+	if long {
+		return append([]byte{byte(len(encoded) / 2), 0}, encoded...)
+	}
+	return append([]byte{byte(len(encoded) / 2)}, encoded...)
+}
+
+// token encodes a token with a USHORT length.
+func token(tokenType byte, body []byte) []byte {
+	return append([]byte{tokenType, byte(len(body)), byte(len(body) >> 8)}, body...)
+}
+
+// done is a DONE token.
+var done = append([]byte{tokenDone}, make([]byte, 12)...)
+
+// resultSet encodes the tokens of a result with a single NVARCHAR column.
+func resultSet(values ...string) []byte {
+	ret := []byte{tokenColMetadata, 1, 0, 0, 0, 0, 0, 0, 0, typeNVarChar, 0, 2, 0, 0, 0, 0, 0}
+	ret = append(ret, bVarChar("x", false)...)
+	for _, value := range values {
+		encoded := encodeUCS2(value)
+		ret = append(ret, tokenRow, byte(len(encoded)), byte(len(encoded)>>8))
+		ret = append(ret, encoded...)
+	}
+	return append(ret, done...)
+}
+
+// handle serves a connection, accepting the password secret for sa.
+func handle(conn net.Conn) {
+	if _, err := readMessage(conn); err != nil {
+		return
+	}
+	options := PreloginOptions{
+		PreloginVersion:    {15, 0, 0x07, 0xd0, 0, 0},
+		PreloginEncryption: {EncryptModeNotSupported},
+	}
+	body, _ := options.Encode()
+	writeMessage(conn, body)
+
+	login, err := readMessage(conn)
+	if err != nil || login.Type != TDSPacketTypeTDS7Login {
+		return
+	}
+	expected := encodeLogin7("sa", "secret", "zgrab2")
+	if !bytes.Equal(login.Body, expected) {
+		msg := []byte{0x18, 0x48, 0, 0, 1, 14}
+		msg = append(msg, bVarChar("Login failed for user 'sa'.", true)...)
+		msg = append(msg, bVarChar("test", false)...)
+		msg = append(msg, 0, 1, 0, 0, 0)
+		writeMessage(conn, append(token(tokenError, msg), done...))
+		return
+	}
+	ack := []byte{1, 0x74, 0, 0, 4}
+	ack = append(ack, bVarChar("Microsoft SQL Server", false)...)
+	ack = append(ack, 15, 0, 0x07, 0xd0)
+	writeMessage(conn, append(token(tokenLoginAck, ack), done...))
+	for {
+		batch, err := readMessage(conn)
+		if err != nil || batch.Type != uint8(TDSPacketTypeSQLBatch) || len(batch.Body) < 22 {
+			return
+		}
+		switch decodeUCS2(batch.Body[22:]) {
+		case "SELECT CAST(@@VERSION AS NVARCHAR(4000))":
+			writeMessage(conn, resultSet("Microsoft SQL Server 2019"))
+		case "SELECT CAST(name AS NVARCHAR(128)) FROM sys.databases":
+			writeMessage(conn, resultSet("master", "tempdb"))
+		default:
+			return
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		handle(conn)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	credsFile, err := ioutil.TempFile("", "creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(credsFile.Name())
+	credsFile.WriteString("127.0.0.1 sa:wrong sa:secret\n")
+	credsFile.Close()
+
+	flags := &Flags{
+		EncryptMode: "ENCRYPT_NOT_SUP",
+		CredsFile:   credsFile.Name(),
+	}
+	result := zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*ScanResults)
+	if result.Version != "15.0.2000" {
+		t.Errorf("got version %s", result.Version)
+	}
+	expected := &AuthResult{
+		Result: auth.Result{
+			Attempts: []auth.Attempt{
+				{Username: "sa", ErrorCode: "18456", ErrorMessage: "Login failed for user 'sa'."},
+				{Username: "sa", Success: true},
+			},
+			Success: true,
+		},
+		LoginAck:  &LoginAck{Interface: 1, TDSVersion: tdsVersion74, ProgName: "Microsoft SQL Server", ProgVersion: "15.0.2000"},
+		Version:   "Microsoft SQL Server 2019",
+		Databases: []string{"master", "tempdb"},
+	}
+	if !reflect.DeepEqual(result.Auth, expected) {
+		t.Errorf("got auth %+v", result.Auth)
+	}
+}
@@ -2,13 +2,18 @@
 // Grabs the HandshakePacket (or ERRPacket) that the server sends
 // immediately upon connecting, and then if applicable negotiate an SSL
 // connection.
+// If --creds-file is set, the credentials of the target are then
+// attempted, and on success the server version and databases are queried.
 package mysql
 
 import (
+	"context"
 	"reflect"
+	"strconv"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/auth"
 	"github.com/zmap/zgrab2/lib/mysql"
 )
 
@@ -71,6 +76,26 @@ type ScanResults struct {
 
 	// TLSLog contains the usual shared TLS logs.
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+
+	// Auth is the outcome of the login attempts, if --creds-file is set.
+	Auth *AuthResult `json:"auth,omitempty"`
+}
+
+// AuthResult is the outcome of the login attempts, in which the Mechanism is
+// the authentication plugin negotiated with the server.
+type AuthResult struct {
+	auth.Result
+
+	// Version is the result of SELECT @@version after a successful login.
+	Version string `json:"version,omitempty"`
+
+	// Databases are the databases listed by SHOW DATABASES after a
+	// successful login.
+	Databases []string `json:"databases,omitempty"`
+
+	// QueryError is the error of the queries after a successful login, if
+	// any.
+	QueryError string `json:"query_error,omitempty"`
 }
 
 // Put the error into the results.
@@ -135,6 +160,8 @@ type Flags struct {
 	zgrab2.BaseFlags
 	zgrab2.TLSFlags
 	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+
+	CredsFile string `long:"creds-file" description:"File of credentials (host username:password... per line, as for the http module) to attempt after the handshake; on success, the server version and databases are queried"`
 }
 
 // Module is the implementation of the zgrab2.Module interface.
@@ -144,6 +171,7 @@ type Module struct {
 // Scanner is the implementation of the zgrab2.Scanner interface.
 type Scanner struct {
 	config *Flags
+	creds  *auth.Credentials
 }
 
 // RegisterModule is called by modules/mysql.go to register the scanner.
@@ -165,6 +193,11 @@ func (m *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (m *Module) NewResults() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (m *Module) Description() string {
 	return "Perform a handshake with a MySQL database"
@@ -172,7 +205,8 @@ func (m *Module) Description() string {
 
 // Validate validates the flags and returns nil on success.
 func (f *Flags) Validate(args []string) error {
-	return nil
+	// TLS is negotiated within the MySQL handshake.
+	return f.TLSFlags.CheckRedial("the mysql module")
 }
 
 // Help returns the module's help string.
@@ -187,6 +221,13 @@ func (s *Scanner) Init(flags zgrab2.ScanFlags) error {
 	if f.Verbose {
 		log.SetLevel(log.DebugLevel)
 	}
+	if f.CredsFile != "" {
+		creds, err := auth.ReadFile(f.CredsFile)
+		if err != nil {
+			return err
+		}
+		s.creds = creds
+	}
 	return nil
 }
 
@@ -210,13 +251,113 @@ func (scanner *Scanner) GetTrigger() string {
 	return scanner.config.Trigger
 }
 
+// reconnect opens a new connection to the target for another login
+// attempt, reads the handshake, and negotiates TLS if possible.
+func (s *Scanner) reconnect(ctx context.Context, t zgrab2.ScanTarget) (*mysql.Connection, error) {
+	conn, err := t.Open(ctx, &s.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	sql := mysql.NewConnection(&mysql.Config{})
+	if err = sql.Connect(conn); err != nil {
+		sql.Disconnect()
+		return nil, err
+	}
+	if sql.SupportsTLS() {
+		if err = sql.NegotiateTLS(); err != nil {
+			sql.Disconnect()
+			return nil, err
+		}
+		tlsConn, err := s.config.TLSFlags.GetTLSConnection(sql.Connection)
+		if err != nil {
+			sql.Disconnect()
+			return nil, err
+		}
+		if err = tlsConn.Handshake(); err != nil {
+			tlsConn.Close()
+			return nil, err
+		}
+		sql.Connection = tlsConn
+	}
+	return sql, nil
+}
+
+// authenticate attempts each credential in turn (the first on sql, the
+// others on new connections, since the server closes the connection after a
+// failed attempt) until one is accepted, then queries the server version and
+// databases.
+func (s *Scanner) authenticate(ctx context.Context, t zgrab2.ScanTarget, sql *mysql.Connection, creds []*auth.Credential) *AuthResult {
+	result := new(AuthResult)
+	first := true
+	for _, cred := range creds {
+		if cred.Token != "" {
+			continue
+		}
+		if !first {
+			var err error
+			if sql, err = s.reconnect(ctx, t); err != nil {
+				result.Attempts = append(result.Attempts, auth.Attempt{Username: cred.Username, Error: err.Error()})
+				return result
+			}
+			defer sql.Disconnect()
+		}
+		first = false
+		authLog, err := sql.Authenticate(cred.Username, cred.Password)
+		attempt := auth.Attempt{Username: cred.Username}
+		if authLog != nil {
+			attempt.Mechanism = authLog.Plugin
+			attempt.Success = authLog.Success
+			if authLog.Error != nil {
+				attempt.ErrorCode = strconv.Itoa(int(authLog.Error.ErrorCode))
+				attempt.ErrorMessage = authLog.Error.ErrorMessage
+			}
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		result.Attempts = append(result.Attempts, attempt)
+		if err != nil {
+			return result
+		}
+		if attempt.Success {
+			result.Success = true
+			s.query(sql, result)
+			return result
+		}
+	}
+	return result
+}
+
+// query fills in the server version and databases of result, after a
+// successful login.
+func (s *Scanner) query(sql *mysql.Connection, result *AuthResult) {
+	rows, err := sql.Query("SELECT @@version", 1)
+	if err != nil {
+		result.QueryError = err.Error()
+		return
+	}
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		result.Version = rows[0][0]
+	}
+	if rows, err = sql.Query("SHOW DATABASES", auth.MaxDatabases); err != nil {
+		result.QueryError = err.Error()
+	}
+	for _, row := range rows {
+		if len(row) > 0 {
+			result.Databases = append(result.Databases, row[0])
+		}
+	}
+}
+
 // Scan probles the target for a MySQL server.
 // 1. Connects and waits to receive the handshake packet.
 // 2. If the server supports SSL, send an SSLRequest packet, then
 //    perform the standard TLS actions.
-// 3. Process and return the results.
-func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result interface{}, thrown error) {
+// 3. If --creds-file is set, attempt the credentials of the target.
+// 4. Process and return the results.
+func (s *Scanner) Scan(ctx context.Context, t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result interface{}, thrown error) {
 	var tlsConn *zgrab2.TLSConnection
+	var authResult *AuthResult
 	sql := mysql.NewConnection(&mysql.Config{})
 	defer func() {
 		recovered := recover()
@@ -225,14 +366,18 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 			status = zgrab2.TryGetScanStatus(thrown)
 			// TODO FIXME: do more to distinguish errors
 		}
-		result = readResultsFromConnectionLog(&sql.ConnectionLog)
-		if tlsConn != nil {
-			result.(*ScanResults).TLSLog = tlsConn.GetLog()
+		results := readResultsFromConnectionLog(&sql.ConnectionLog)
+		if results != nil {
+			if tlsConn != nil {
+				results.TLSLog = tlsConn.GetLog()
+			}
+			results.Auth = authResult
 		}
+		result = results
 	}()
 	defer sql.Disconnect()
 	var err error
-	conn, err := t.Open(&s.config.BaseFlags)
+	conn, err := t.Open(ctx, &s.config.BaseFlags)
 	if err != nil {
 		panic(err)
 	}
@@ -249,9 +394,12 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 		if err = tlsConn.Handshake(); err != nil {
 			panic(err)
 		}
-		// Replace sql.Connection to allow hypothetical future calls to go over the secure connection
+		// Replace sql.Connection to allow future calls to go over the secure connection
 		sql.Connection = tlsConn
 	}
+	if creds := s.creds.For(&t, s.config.Port); len(creds) > 0 {
+		authResult = s.authenticate(ctx, t, sql, creds)
+	}
 	// If we made it this far, the scan was a success. The result will be grabbed in the defer block above.
 	return zgrab2.SCAN_SUCCESS, nil, nil
 }
@@ -0,0 +1,146 @@
+package mysql
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/auth"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// scramble is the nonce sent by the fake server.
+var scramble = []byte("0123456789abcdefghij")
+
+// writePacket writes body with the given sequence number.
+func writePacket(w io.Writer, seq byte, body []byte) {
+	header := make([]byte, 4)
+	binary.LittleEndian.PutUint32(header, uint32(len(body)))
+	header[3] = seq
+	w.Write(append(header, body...))
+}
+
+// readPacket reads a packet body.
+func readPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	header[3] = 0
+	body := make([]byte, binary.LittleEndian.Uint32(header))
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+// checkPassword returns true if response is the mysql_native_password
+// response for password.
+func checkPassword(response []byte, password string) bool {
+	hash1 := sha1.Sum([]byte(password))
+	stored := sha1.Sum(hash1[:])
+	h := sha1.New()
+	h.Write(scramble)
+	h.Write(stored[:])
+	candidate := h.Sum(nil)
+	for i := range candidate {
+		candidate[i] ^= response[i]
+	}
+	return len(response) == 20 && sha1.Sum(candidate) == stored
+}
+
+// resultSet writes a result set with a single column.
+func resultSet(w io.Writer, values ...string) {
+	writePacket(w, 1, []byte{1})
+	writePacket(w, 2, []byte("\x03def\x00\x00\x00\x01x\x00\x0c\x21\x00\x00\x01\x00\x00\xfd\x00\x00\x00\x00\x00"))
+	writePacket(w, 3, []byte{0xfe, 0, 0, 2, 0})
+	for i, value := range values {
+		writePacket(w, byte(4+i), append([]byte{byte(len(value))}, value...))
+	}
+	writePacket(w, byte(4+len(values)), []byte{0xfe, 0, 0, 2, 0})
+}
+
+// handle serves a connection, accepting the password secret for root.
+func handle(conn net.Conn) {
+	var handshake bytes.Buffer
+	handshake.WriteString("\x0a8.0.0-test\x00\x01\x00\x00\x00")
+	handshake.Write(scramble[:8])
+	flags := uint32(1 | 1<<9 | 1<<13 | 1<<15 | 1<<19 | 1<<21)
+	handshake.Write([]byte{0, byte(flags), byte(flags >> 8), 33, 2, 0, byte(flags >> 16), byte(flags >> 24), 21})
+	handshake.Write(make([]byte, 10))
+	handshake.Write(scramble[8:])
+	handshake.WriteString("\x00mysql_native_password\x00")
+	writePacket(conn, 0, handshake.Bytes())
+
+	body, err := readPacket(conn)
+	if err != nil || len(body) < 33 {
+		return
+	}
+	fields := bytes.SplitN(body[32:], []byte{0}, 2)
+	username, rest := string(fields[0]), fields[1]
+	response := rest[1 : 1+rest[0]]
+	if username != "root" || !checkPassword(response, "secret") {
+		writePacket(conn, 2, []byte("\xff\x15\x04#28000Access denied for user"))
+		return
+	}
+	writePacket(conn, 2, []byte{0, 0, 0, 2, 0, 0, 0})
+	for {
+		body, err := readPacket(conn)
+		if err != nil || len(body) == 0 || body[0] != 3 {
+			return
+		}
+		switch string(body[1:]) {
+		case "SELECT @@version":
+			resultSet(conn, "8.0.0-test")
+		case "SHOW DATABASES":
+			resultSet(conn, "information_schema", "mysql", "test")
+		default:
+			writePacket(conn, 1, []byte("\xff\x28\x04#42000You have an error in your SQL syntax"))
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		handle(conn)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	credsFile, err := ioutil.TempFile("", "creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(credsFile.Name())
+	credsFile.WriteString("127.0.0.1 root:wrong root:secret\n")
+	credsFile.Close()
+
+	flags := &Flags{CredsFile: credsFile.Name()}
+	result := zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*ScanResults)
+	if result.ServerVersion != "8.0.0-test" || result.AuthPluginName != "mysql_native_password" {
+		t.Errorf("got handshake %+v", result)
+	}
+	authResult := result.Auth
+	if authResult == nil || len(authResult.Attempts) != 2 {
+		t.Fatalf("got auth %+v", authResult)
+	}
+	if first := authResult.Attempts[0]; first.Success || first.ErrorCode != "1045" || !strings.HasPrefix(first.ErrorMessage, "Access denied") {
+		t.Errorf("got first attempt %+v", first)
+	}
+	expected := &AuthResult{
+		Result:    auth.Result{Attempts: authResult.Attempts, Success: true},
+		Version:   "8.0.0-test",
+		Databases: []string{"information_schema", "mysql", "test"},
+	}
+	if !authResult.Attempts[1].Success || authResult.Attempts[1].Mechanism != "mysql_native_password" || !reflect.DeepEqual(authResult, expected) {
+		t.Errorf("got auth %+v", authResult)
+	}
+}
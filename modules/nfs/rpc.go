@@ -0,0 +1,203 @@
+package nfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+
+	"github.com/zmap/zgrab2"
+)
+
+// maxReplySize is the maximum size of an RPC reply read.
+const maxReplySize = 1 << 20
+
+// lastFragment is the bit of a record marking the last fragment.
+const lastFragment = 0x80000000
+
+// The message types and reply statuses (RFC 5531).
+const (
+	msgCall  = 0
+	msgReply = 1
+
+	replyAccepted = 0
+
+	acceptSuccess = 0
+)
+
+var (
+	// ErrInvalidReply is returned if the response is not an RPC reply to
+	// the call.
+	ErrInvalidReply = errors.New("invalid RPC reply")
+
+	// ErrTooLarge is returned if a reply is larger than maxReplySize.
+	ErrTooLarge = errors.New("RPC reply too large")
+
+	// ErrDenied is returned if the server denied the call.
+	ErrDenied = errors.New("RPC call denied")
+)
+
+// acceptStatuses names the statuses of an accepted call.
+var acceptStatuses = map[uint32]string{
+	1: "PROG_UNAVAIL",
+	2: "PROG_MISMATCH",
+	3: "PROC_UNAVAIL",
+	4: "GARBAGE_ARGS",
+	5: "SYSTEM_ERR",
+}
+
+// AcceptError is returned if the server accepted a call but could not
+// execute it, as when the program is not available.
+type AcceptError uint32
+
+func (e AcceptError) Error() string {
+	name, ok := acceptStatuses[uint32(e)]
+	if !ok {
+		name = fmt.Sprintf("%d", uint32(e))
+	}
+	return "RPC call not executed: " + name
+}
+
+// errorStatus returns the scan status of an error of call.
+func errorStatus(err error) zgrab2.ScanStatus {
+	switch err.(type) {
+	case AcceptError:
+		return zgrab2.SCAN_APPLICATION_ERROR
+	}
+	switch err {
+	case ErrInvalidReply, ErrTooLarge:
+		return zgrab2.SCAN_PROTOCOL_ERROR
+	case ErrDenied:
+		return zgrab2.SCAN_APPLICATION_ERROR
+	}
+	return zgrab2.TryGetScanStatus(err)
+}
+
+// xdrWriter encodes XDR values.
+type xdrWriter struct {
+	buf []byte
+}
+
+func (w *xdrWriter) uint32(v uint32) {
+	w.buf = append(w.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// xdrReader decodes XDR values, recording the first error.
+type xdrReader struct {
+	buf []byte
+	err error
+}
+
+func (r *xdrReader) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.buf) < 4 {
+		r.err = ErrInvalidReply
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v
+}
+
+func (r *xdrReader) bool() bool {
+	return r.uint32() != 0
+}
+
+// opaque decodes variable-length opaque data, padded to four bytes.
+func (r *xdrReader) opaque() []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	padded := (uint64(n) + 3) &^ 3
+	if uint64(len(r.buf)) < padded {
+		r.err = ErrInvalidReply
+		return nil
+	}
+	data := r.buf[:n]
+	r.buf = r.buf[padded:]
+	return data
+}
+
+func (r *xdrReader) string() string {
+	return string(r.opaque())
+}
+
+// encodeCall encodes a call with AUTH_NULL credentials, in a single record
+// fragment.
+func encodeCall(xid, program, version, procedure uint32) []byte {
+	w := &xdrWriter{buf: make([]byte, 4, 44)}
+	w.uint32(xid)
+	w.uint32(msgCall)
+	w.uint32(2)
+	w.uint32(program)
+	w.uint32(version)
+	w.uint32(procedure)
+	// The credentials and verifier: AUTH_NULL, with no body.
+	w.uint32(0)
+	w.uint32(0)
+	w.uint32(0)
+	w.uint32(0)
+	binary.BigEndian.PutUint32(w.buf, lastFragment|uint32(len(w.buf)-4))
+	return w.buf
+}
+
+// readRecord reads the fragments of a record.
+func readRecord(r io.Reader) ([]byte, error) {
+	var record []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		marker := binary.BigEndian.Uint32(header[:])
+		n := marker &^ lastFragment
+		if len(record)+int(n) > maxReplySize {
+			return nil, ErrTooLarge
+		}
+		fragment := make([]byte, n)
+		if _, err := io.ReadFull(r, fragment); err != nil {
+			return nil, err
+		}
+		record = append(record, fragment...)
+		if marker&lastFragment != 0 {
+			return record, nil
+		}
+	}
+}
+
+// call sends a call and returns a reader of the results of the reply.
+func call(rw io.ReadWriter, program, version, procedure uint32) (*xdrReader, error) {
+	xid := rand.Uint32()
+	if _, err := rw.Write(encodeCall(xid, program, version, procedure)); err != nil {
+		return nil, err
+	}
+	record, err := readRecord(rw)
+	if err != nil {
+		return nil, err
+	}
+	r := &xdrReader{buf: record}
+	if r.uint32() != xid || r.uint32() != msgReply {
+		return nil, ErrInvalidReply
+	}
+	if r.uint32() != replyAccepted {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, ErrDenied
+	}
+	// The verifier.
+	r.uint32()
+	r.opaque()
+	status := r.uint32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if status != acceptSuccess {
+		return nil, AcceptError(status)
+	}
+	return r, nil
+}
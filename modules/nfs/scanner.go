@@ -0,0 +1,262 @@
+// Package nfs provides a zgrab2 module that lists the RPC programs registered
+// with rpcbind and the exports of the NFS MOUNT service.
+// Default Port: 111 (TCP)
+//
+// The scanner sends a portmapper DUMP call (program 100000, version 2) over
+// TCP, which lists the registered programs with their versions, protocols and
+// ports. With --exports, it then sends a MOUNT EXPORT call to the TCP port of
+// the MOUNT service (program 100005), which lists the exported directories
+// and the groups of hosts allowed to mount them; an export without groups is
+// mountable by any host.
+package nfs
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// The programs, versions and procedures called.
+const (
+	programPortmap = 100000
+	programMount   = 100005
+
+	portmapVersion = 2
+	portmapDump    = 4
+
+	mountVersion = 3
+	mountExport  = 5
+)
+
+// maxEntries is the maximum number of entries decoded from a list.
+const maxEntries = 4096
+
+// programNames names the common RPC programs.
+var programNames = map[uint32]string{
+	100000: "portmapper",
+	100003: "nfs",
+	100004: "ypserv",
+	100005: "mountd",
+	100007: "ypbind",
+	100009: "yppasswdd",
+	100011: "rquotad",
+	100021: "nlockmgr",
+	100024: "status",
+	100227: "nfs_acl",
+	150001: "pcnfsd",
+}
+
+// protocols names the protocols of the portmapper.
+var protocols = map[uint32]string{
+	6:  "tcp",
+	17: "udp",
+}
+
+// Flags holds the command-line configuration for the nfs module.
+type Flags struct {
+	zgrab2.BaseFlags
+
+	Exports bool `long:"exports" description:"List the exports of the MOUNT service"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Program is a program registered with rpcbind.
+type Program struct {
+	Program  uint32 `json:"program"`
+	Name     string `json:"name,omitempty"`
+	Version  uint32 `json:"version"`
+	Protocol string `json:"protocol"`
+	Port     uint32 `json:"port"`
+}
+
+// Export is a directory exported by the MOUNT service.
+type Export struct {
+	Directory string   `json:"directory"`
+	Groups    []string `json:"groups,omitempty"`
+
+	// WorldMountable is true if any host may mount the directory: the export
+	// has no groups, or the * wildcard.
+	WorldMountable bool `json:"world_mountable"`
+}
+
+// Results is the output of the nfs module.
+type Results struct {
+	// Programs lists the registered programs.
+	Programs []Program `json:"programs,omitempty"`
+
+	// MountPort is the TCP port of the MOUNT service called with --exports,
+	// and MountError the error of the call.
+	MountPort  uint32 `json:"mount_port,omitempty"`
+	MountError string `json:"mount_error,omitempty"`
+
+	// Exports lists the exports of the MOUNT service.
+	Exports []Export `json:"exports,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("nfs", "NFS", module.Description(), 111, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "List the RPC programs registered with rpcbind, and optionally the NFS exports of the MOUNT service"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "nfs"
+}
+
+// decodeDump decodes the list of mappings of a DUMP reply.
+func decodeDump(r *xdrReader) ([]Program, error) {
+	var programs []Program
+	for i := 0; r.bool() && i < maxEntries; i++ {
+		p := Program{Program: r.uint32(), Version: r.uint32()}
+		protocol := r.uint32()
+		p.Port = r.uint32()
+		p.Name = programNames[p.Program]
+		p.Protocol = protocols[protocol]
+		if p.Protocol == "" {
+			p.Protocol = fmt.Sprintf("%d", protocol)
+		}
+		programs = append(programs, p)
+	}
+	return programs, r.err
+}
+
+// decodeExports decodes the list of exports of an EXPORT reply.
+func decodeExports(r *xdrReader) ([]Export, error) {
+	var exports []Export
+	for i := 0; r.bool() && i < maxEntries; i++ {
+		e := Export{Directory: r.string()}
+		for j := 0; r.bool() && j < maxEntries; j++ {
+			e.Groups = append(e.Groups, r.string())
+		}
+		e.WorldMountable = len(e.Groups) == 0
+		for _, g := range e.Groups {
+			if g == "*" {
+				e.WorldMountable = true
+			}
+		}
+		exports = append(exports, e)
+	}
+	return exports, r.err
+}
+
+// exports calls the EXPORT procedure of the MOUNT service on port.
+func (scanner *Scanner) exports(ctx context.Context, target zgrab2.ScanTarget, port uint32) ([]Export, error) {
+	p := uint(port)
+	target.Port = &p
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	r, err := call(conn, programMount, mountVersion, mountExport)
+	if err != nil {
+		return nil, err
+	}
+	return decodeExports(r)
+}
+
+// Scan dumps the registered programs, then lists the exports with --exports.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	r, err := call(conn, programPortmap, portmapVersion, portmapDump)
+	conn.Close()
+	if err != nil {
+		return errorStatus(err), nil, err
+	}
+	results := new(Results)
+	results.Programs, err = decodeDump(r)
+	if err != nil {
+		return zgrab2.SCAN_PROTOCOL_ERROR, results, err
+	}
+	if !scanner.config.Exports {
+		return zgrab2.SCAN_SUCCESS, results, nil
+	}
+	for _, p := range results.Programs {
+		if p.Program == programMount && p.Version == mountVersion && p.Protocol == "tcp" {
+			results.MountPort = p.Port
+		}
+	}
+	if results.MountPort == 0 {
+		results.MountError = "no TCP MOUNT version 3 service registered"
+		return zgrab2.SCAN_SUCCESS, results, nil
+	}
+	results.Exports, err = scanner.exports(ctx, target, results.MountPort)
+	if err != nil {
+		results.MountError = err.Error()
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
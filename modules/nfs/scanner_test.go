@@ -0,0 +1,135 @@
+package nfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// string appends an XDR string.
+func (w *xdrWriter) string(s string) {
+	w.uint32(uint32(len(s)))
+	w.buf = append(w.buf, s...)
+	for len(w.buf)%4 != 0 {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+// serve runs a fake RPC server, answering the call of each connection with
+// the reply built by results for its program and procedure, split in two
+// fragments.
+func serve(t *testing.T, results func(program, procedure uint32, w *xdrWriter) uint32) *testserver.Server {
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		record, err := readRecord(conn)
+		if err != nil {
+			return err
+		}
+		if len(record) < 24 {
+			return fmt.Errorf("got a call of %d bytes", len(record))
+		}
+		w := &xdrWriter{}
+		w.uint32(binary.BigEndian.Uint32(record))
+		w.uint32(msgReply)
+		w.uint32(replyAccepted)
+		w.uint32(0)
+		w.uint32(0)
+		body := &xdrWriter{}
+		w.uint32(results(binary.BigEndian.Uint32(record[12:]), binary.BigEndian.Uint32(record[20:]), body))
+		w.buf = append(w.buf, body.buf...)
+		half := len(w.buf) / 2
+		header := make([]byte, 4)
+		binary.BigEndian.PutUint32(header, uint32(half))
+		conn.Write(append(header, w.buf[:half]...))
+		binary.BigEndian.PutUint32(header, lastFragment|uint32(len(w.buf)-half))
+		_, err = conn.Write(append(header, w.buf[half:]...))
+		return err
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func scan(t *testing.T, server *testserver.Server, exports bool) (zgrab2.ScanStatus, *Results, error) {
+	defer server.Close()
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), &Flags{Exports: exports}, server.Addr())
+	results, _ := ret.(*Results)
+	return status, results, err
+}
+
+func TestExports(t *testing.T) {
+	var port uint32
+	server := serve(t, func(program, procedure uint32, w *xdrWriter) uint32 {
+		switch {
+		case program == programPortmap && procedure == portmapDump:
+			for _, m := range [][4]uint32{{100000, 2, 6, 111}, {100005, 3, 17, 20048}, {100005, 3, 6, port}, {100003, 4, 6, 2049}} {
+				w.uint32(1)
+				for _, v := range m {
+					w.uint32(v)
+				}
+			}
+			w.uint32(0)
+		case program == programMount && procedure == mountExport:
+			w.uint32(1)
+			w.string("/srv/public")
+			w.uint32(0)
+			w.uint32(1)
+			w.string("/srv/home")
+			w.uint32(1)
+			w.string("10.0.0.0/8")
+			w.uint32(1)
+			w.string("backup.example.com")
+			w.uint32(0)
+			w.uint32(0)
+		default:
+			return 1
+		}
+		return acceptSuccess
+	})
+	port = uint32(server.Port())
+	status, results, err := scan(t, server, true)
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if len(results.Programs) != 4 || results.Programs[1] != (Program{Program: 100005, Name: "mountd", Version: 3, Protocol: "udp", Port: 20048}) || results.Programs[3].Name != "nfs" {
+		t.Errorf("got programs %+v", results.Programs)
+	}
+	expected := []Export{
+		{Directory: "/srv/public", WorldMountable: true},
+		{Directory: "/srv/home", Groups: []string{"10.0.0.0/8", "backup.example.com"}},
+	}
+	if results.MountPort != port || results.MountError != "" || !reflect.DeepEqual(results.Exports, expected) {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestNoMount(t *testing.T) {
+	server := serve(t, func(program, procedure uint32, w *xdrWriter) uint32 {
+		w.uint32(1)
+		for _, v := range []uint32{100000, 4, 6, 111} {
+			w.uint32(v)
+		}
+		w.uint32(0)
+		return acceptSuccess
+	})
+	status, results, err := scan(t, server, true)
+	if status != zgrab2.SCAN_SUCCESS || err != nil || len(results.Programs) != 1 || results.MountError == "" || results.Exports != nil {
+		t.Errorf("got status %s, %+v, error %v", status, results, err)
+	}
+}
+
+func TestProgramUnavailable(t *testing.T) {
+	server := serve(t, func(program, procedure uint32, w *xdrWriter) uint32 {
+		return 1
+	})
+	status, _, err := scan(t, server, false)
+	if status != zgrab2.SCAN_APPLICATION_ERROR || err != AcceptError(1) || err.Error() != "RPC call not executed: PROG_UNAVAIL" {
+		t.Errorf("got status %s, error %v", status, err)
+	}
+}
@@ -0,0 +1,271 @@
+package ntp
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// ControlOpReadVariables is the mode 6 READVAR operation code, from
+// ntp/include/ntp_control.h.
+const ControlOpReadVariables = 2
+
+// controlHeaderLen is the length of a mode 6 header.
+const controlHeaderLen = 12
+
+// maxResponsePackets is the maximum number of packets read in response to
+// a mode 6 or mode 7 request.
+const maxResponsePackets = 128
+
+// ControlHeader represents a header for a mode-6 (control) packet, roughly
+// corresponding to struct ntp_control in ntp_control.h
+type ControlHeader struct {
+	Version       uint8  `json:"version"`
+	IsResponse    bool   `json:"is_response"`
+	IsError       bool   `json:"is_error"`
+	HasMore       bool   `json:"has_more"`
+	OpCode        uint8  `json:"op_code"`
+	Sequence      uint16 `json:"sequence"`
+	Status        uint16 `json:"status"`
+	AssociationID uint16 `json:"association_id"`
+	Offset        uint16 `json:"offset"`
+	Count         uint16 `json:"count"`
+}
+
+// Encode encodes the packet header as a struct ntp_control, without data
+func (header *ControlHeader) Encode() ([]byte, error) {
+	ret := make([]byte, controlHeaderLen)
+	if (header.Version>>3) != 0 || (header.OpCode>>5) != 0 {
+		return nil, ErrInvalidHeader
+	}
+	ret[0] = header.Version<<3 | uint8(Control)
+	ret[1] = header.OpCode
+	if header.IsResponse {
+		ret[1] |= 0x80
+	}
+	if header.IsError {
+		ret[1] |= 0x40
+	}
+	if header.HasMore {
+		ret[1] |= 0x20
+	}
+	binary.BigEndian.PutUint16(ret[2:4], header.Sequence)
+	binary.BigEndian.PutUint16(ret[4:6], header.Status)
+	binary.BigEndian.PutUint16(ret[6:8], header.AssociationID)
+	binary.BigEndian.PutUint16(ret[8:10], header.Offset)
+	binary.BigEndian.PutUint16(ret[10:12], header.Count)
+	return ret, nil
+}
+
+// Decode a Control packet header from the first 12 bytes of buf
+func decodeControlHeader(buf []byte) (*ControlHeader, error) {
+	if len(buf) < controlHeaderLen || AssociationMode(buf[0]&0x07) != Control {
+		return nil, ErrInvalidHeader
+	}
+	return &ControlHeader{
+		Version:       buf[0] >> 3 & 0x07,
+		IsResponse:    buf[1]&0x80 != 0,
+		IsError:       buf[1]&0x40 != 0,
+		HasMore:       buf[1]&0x20 != 0,
+		OpCode:        buf[1] & 0x1f,
+		Sequence:      binary.BigEndian.Uint16(buf[2:4]),
+		Status:        binary.BigEndian.Uint16(buf[4:6]),
+		AssociationID: binary.BigEndian.Uint16(buf[6:8]),
+		Offset:        binary.BigEndian.Uint16(buf[8:10]),
+		Count:         binary.BigEndian.Uint16(buf[10:12]),
+	}, nil
+}
+
+// ReadVarResponse is the response to a mode 6 READVAR request for the system
+// variables.
+type ReadVarResponse struct {
+	// Variables are the system variables returned by the server, by name
+	// (e.g. "processor", "system", "leap", "rootdelay").
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// Version is the "version" variable, e.g. "ntpd 4.2.6p5@1.2349-o".
+	Version string `json:"version,omitempty"`
+
+	// RefID is the "refid" variable.
+	RefID string `json:"refid,omitempty"`
+
+	// Stratum is the "stratum" variable.
+	Stratum *uint8 `json:"stratum,omitempty"`
+
+	// Status is the system status word of the response.
+	Status uint16 `json:"status"`
+
+	// Packets is the number of packets of the response.
+	Packets int `json:"packets"`
+
+	// ResponseBytes is the total size of the packets of the response.
+	ResponseBytes int `json:"response_bytes"`
+
+	// Header is the header of the first packet of the response. Debug only.
+	Header *ControlHeader `json:"header,omitempty" zgrab:"debug"`
+}
+
+// parseVariables parses the comma-separated name=value pairs of a READVAR
+// response, without the quotes of the values.
+func parseVariables(data string) map[string]string {
+	ret := make(map[string]string)
+	var fields []string
+	quoted := false
+	start := 0
+	for i, c := range data {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			fields = append(fields, data[start:i])
+			start = i + 1
+		}
+	}
+	fields = append(fields, data[start:])
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		nameValue := strings.SplitN(field, "=", 2)
+		name := strings.TrimSpace(nameValue[0])
+		value := ""
+		if len(nameValue) == 2 {
+			value = strings.Trim(strings.TrimSpace(nameValue[1]), `"`)
+		}
+		ret[name] = value
+	}
+	return ret
+}
+
+// ReadVar sends a mode 6 READVAR request for the system variables (association
+// 0), and reads the fragments of the response until the last one.
+func (scanner *Scanner) ReadVar(sock net.Conn) (*ReadVarResponse, int, error) {
+	outPacket, err := (&ControlHeader{
+		Version:  scanner.config.Version,
+		OpCode:   ControlOpReadVariables,
+		Sequence: 1,
+	}).Encode()
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := sock.Write(outPacket); err != nil {
+		return nil, 0, err
+	}
+	var ret *ReadVarResponse
+	var data []byte
+	buf := make([]byte, 1024)
+	for ret == nil || ret.Packets < maxResponsePackets {
+		n, err := sock.Read(buf)
+		if err != nil {
+			if ret != nil {
+				// Keep the fragments received before the timeout.
+				break
+			}
+			return nil, len(outPacket), err
+		}
+		header, err := decodeControlHeader(buf[:n])
+		if err != nil || !header.IsResponse || header.OpCode != ControlOpReadVariables {
+			log.Debugf("Received invalid mode 6 response (%d bytes)", n)
+			if ret == nil {
+				return nil, len(outPacket), ErrInvalidResponse
+			}
+			continue
+		}
+		if ret == nil {
+			ret = &ReadVarResponse{Status: header.Status, Header: header}
+		}
+		ret.Packets++
+		ret.ResponseBytes += n
+		if header.IsError {
+			return ret, len(outPacket), ErrInvalidResponse
+		}
+		end := int(header.Offset) + int(header.Count)
+		if controlHeaderLen+int(header.Count) > n {
+			return ret, len(outPacket), ErrInvalidResponse
+		}
+		if end > len(data) {
+			data = append(data, make([]byte, end-len(data))...)
+		}
+		copy(data[header.Offset:end], buf[controlHeaderLen:controlHeaderLen+int(header.Count)])
+		if !header.HasMore {
+			break
+		}
+	}
+	ret.Variables = parseVariables(string(data))
+	ret.Version = ret.Variables["version"]
+	ret.RefID = ret.Variables["refid"]
+	if stratum, err := strconv.ParseUint(ret.Variables["stratum"], 10, 8); err == nil {
+		value := uint8(stratum)
+		ret.Stratum = &value
+	}
+	return ret, len(outPacket), nil
+}
+
+// readMore reads the packets following a mode 7 response with the "more"
+// bit set, until the last one, and returns their number and total size.
+func readMore(sock net.Conn) (int, int) {
+	packets, size := 0, 0
+	buf := make([]byte, 512)
+	for packets < maxResponsePackets {
+		n, err := sock.Read(buf)
+		if err != nil {
+			break
+		}
+		packets++
+		size += n
+		header, err := decodePrivatePacketHeader(buf[:n])
+		if err != nil || !header.HasMore {
+			break
+		}
+	}
+	return packets, size
+}
+
+// Amplification is the ratio of the size of a response to the size of the
+// request.
+type Amplification struct {
+	RequestBytes  int     `json:"request_bytes"`
+	ResponseBytes int     `json:"response_bytes"`
+	Packets       int     `json:"packets"`
+	Factor        float64 `json:"factor"`
+}
+
+// newAmplification returns the Amplification of a response.
+func newAmplification(requestBytes int, responseBytes int, packets int) *Amplification {
+	ret := &Amplification{
+		RequestBytes:  requestBytes,
+		ResponseBytes: responseBytes,
+		Packets:       packets,
+	}
+	if requestBytes > 0 {
+		ret.Factor = float64(responseBytes) / float64(requestBytes)
+	}
+	return ret
+}
+
+// setAmplificationRisk sets result.AmplificationRisk, if a mode 6 or mode 7
+// request was sent: it is true if one of the responses is larger than its
+// request.
+func setAmplificationRisk(result *Results) {
+	if result.ReadVarAmplification == nil && result.MonListAmplification == nil {
+		return
+	}
+	risk := false
+	for _, amplification := range []*Amplification{result.ReadVarAmplification, result.MonListAmplification} {
+		risk = risk || (amplification != nil && amplification.Factor > 1)
+	}
+	result.AmplificationRisk = &risk
+}
+
+// readVarStatus returns the status of a failed READVAR, as MonList does.
+func readVarStatus(err error) zgrab2.ScanStatus {
+	if err == ErrInvalidResponse {
+		return zgrab2.SCAN_PROTOCOL_ERROR
+	}
+	return zgrab2.TryGetScanStatus(err)
+}
@@ -0,0 +1,146 @@
+package ntp
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+)
+
+// systemVariables is the READVAR response data of the fake server.
+const systemVariables = `version="ntpd 4.2.6p5@1.2349-o", processor="x86_64", system="Linux/3.2.0", leap=0, stratum=2, precision=-20, refid=192.0.2.1, clock=0xdb3a3ae1.4b61a0dc`
+
+// controlResponse returns a READVAR response fragment with data at offset.
+func controlResponse(offset int, data string, more bool) []byte {
+	header, _ := (&ControlHeader{
+		Version:    2,
+		IsResponse: true,
+		HasMore:    more,
+		OpCode:     ControlOpReadVariables,
+		Sequence:   1,
+		Status:     0x0615,
+		Offset:     uint16(offset),
+		Count:      uint16(len(data)),
+	}).Encode()
+	ret := append(header, data...)
+	return append(ret, make([]byte, (4-len(ret)%4)%4)...)
+}
+
+// privateResponse returns a monlist response with one 72-byte item.
+func privateResponse(more bool) []byte {
+	header, _ := (&PrivatePacketHeader{
+		IsResponse:           true,
+		HasMore:              more,
+		Version:              2,
+		Mode:                 Private,
+		ImplementationNumber: ImplXNTPD,
+		RequestCode:          ReqMonGetList,
+		NumItems:             1,
+		ItemSize:             72,
+	}).Encode()
+	return append(header, make([]byte, 72)...)
+}
+
+// serve answers READVAR requests with the system variables split in two
+// fragments, and monlist requests with two packets.
+func serve(conn net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		switch AssociationMode(buf[0] & 0x07) {
+		case Control:
+			if n != controlHeaderLen || binary.BigEndian.Uint16(buf[2:4]) != 1 {
+				continue
+			}
+			conn.WriteTo(controlResponse(0, systemVariables[:50], true), addr)
+			conn.WriteTo(controlResponse(50, systemVariables[50:], false), addr)
+		case Private:
+			conn.WriteTo(privateResponse(true), addr)
+			conn.WriteTo(privateResponse(false), addr)
+		}
+	}
+}
+
+func TestParseVariables(t *testing.T) {
+	variables := parseVariables(`version="ntpd 4.2.8p15, built", stratum=3, ,leap=0, flag`)
+	expected := map[string]string{
+		"version": "ntpd 4.2.8p15, built",
+		"stratum": "3",
+		"leap":    "0",
+		"flag":    "",
+	}
+	if !reflect.DeepEqual(variables, expected) {
+		t.Errorf("got variables %v", variables)
+	}
+}
+
+func TestControlHeader(t *testing.T) {
+	header := &ControlHeader{
+		Version:    4,
+		IsResponse: true,
+		HasMore:    true,
+		OpCode:     ControlOpReadVariables,
+		Sequence:   7,
+		Status:     0x0615,
+		Offset:     468,
+		Count:      12,
+	}
+	encoded, err := header.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded[0] != 0x26 || encoded[1] != 0xa2 {
+		t.Errorf("got header bytes %x", encoded[:2])
+	}
+	decoded, err := decodeControlHeader(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, header) {
+		t.Errorf("got header %+v", decoded)
+	}
+}
+
+func TestScanReadVarMonList(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go serve(conn)
+	flags := &Flags{
+		Version:     2,
+		SkipGetTime: true,
+		MonList:     true,
+		RequestCode: "REQ_MON_GETLIST",
+		ReadVar:     true,
+	}
+	// The responses span two datagrams, which a testserver.UDPServer can't
+	// send.
+	result := zgrab2test.MustScan(t, new(Scanner), flags, conn.LocalAddr().String()).(*Results)
+	readVar := result.ReadVar
+	if readVar == nil || readVar.Packets != 2 || readVar.Status != 0x0615 {
+		t.Fatalf("got readvar %+v", readVar)
+	}
+	if readVar.Version != "ntpd 4.2.6p5@1.2349-o" || readVar.RefID != "192.0.2.1" || readVar.Stratum == nil || *readVar.Stratum != 2 {
+		t.Errorf("got version %q, refid %q, stratum %v", readVar.Version, readVar.RefID, readVar.Stratum)
+	}
+	if len(readVar.Variables) != 8 || readVar.Variables["clock"] != "0xdb3a3ae1.4b61a0dc" {
+		t.Errorf("got variables %v", readVar.Variables)
+	}
+	expected := &Amplification{RequestBytes: 48, ResponseBytes: 160, Packets: 2, Factor: 160.0 / 48}
+	if !reflect.DeepEqual(result.MonListAmplification, expected) {
+		t.Errorf("got monlist amplification %+v", result.MonListAmplification)
+	}
+	if result.ReadVarAmplification == nil || result.ReadVarAmplification.Factor <= 1 {
+		t.Errorf("got readvar amplification %+v", result.ReadVarAmplification)
+	}
+	if result.AmplificationRisk == nil || !*result.AmplificationRisk {
+		t.Errorf("got amplification risk %v", result.AmplificationRisk)
+	}
+}
@@ -13,6 +13,7 @@
 package ntp
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
@@ -789,6 +790,26 @@ type Results struct {
 	// MonListHeader is the header returned by the call to monlist.
 	// Only present if --monlist is set. Debug only.
 	MonListHeader *PrivatePacketHeader `json:"monlist_header,omitempty" zgrab:"debug"`
+
+	// MonListAmplification is the size of the monlist request and of all
+	// the packets of its response.
+	// Only present if --monlist is set.
+	MonListAmplification *Amplification `json:"monlist_amplification,omitempty"`
+
+	// ReadVar is the response to the mode 6 READVAR request for the system
+	// variables.
+	// Only present if --readvar is set.
+	ReadVar *ReadVarResponse `json:"readvar,omitempty"`
+
+	// ReadVarAmplification is the size of the READVAR request and of all
+	// the packets of its response.
+	// Only present if --readvar is set.
+	ReadVarAmplification *Amplification `json:"readvar_amplification,omitempty"`
+
+	// AmplificationRisk is true if the response to the monlist or READVAR
+	// request is larger than the request.
+	// Only present if --monlist or --readvar is set.
+	AmplificationRisk *bool `json:"amplification_risk,omitempty"`
 }
 
 // Flags holds the command-line flags for the scanner.
@@ -801,6 +822,7 @@ type Flags struct {
 	SkipGetTime   bool   `long:"skip-get-time" description:"If set, don't request the Server time"`
 	MonList       bool   `long:"monlist" description:"Perform a ReqMonGetList request"`
 	RequestCode   string `long:"request-code" description:"Specify a request code for MonList other than ReqMonGetList" default:"REQ_MON_GETLIST"`
+	ReadVar       bool   `long:"readvar" description:"Perform a mode 6 READVAR request for the system variables"`
 }
 
 // Module is the zgrab2 module implementation
@@ -831,6 +853,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Scan for NTP"
@@ -953,6 +980,13 @@ func (scanner *Scanner) MonList(sock net.Conn, result *Results) (zgrab2.ScanStat
 	}
 	if header != nil {
 		result.MonListHeader = header
+		packets, size := 1, 8+len(ret)
+		if header.HasMore {
+			morePackets, moreSize := readMore(sock)
+			packets += morePackets
+			size += moreSize
+		}
+		result.MonListAmplification = newAmplification(8+len(body), size, packets)
 	}
 	if err != nil {
 		switch {
@@ -999,15 +1033,17 @@ func (scanner *Scanner) GetTime(sock net.Conn) (*NTPHeader, error) {
 // line arguments as follows:
 // 1. If SkipGetTime is not set, send a GetTime packet to the server and read
 //    the response packet into the result.
-// 2. If MonList is set, send a MONLIST packet to the server and read the
+// 2. If ReadVar is set, send a mode 6 READVAR packet to the server and read
+//    the system variables into the result.
+// 3. If MonList is set, send a MONLIST packet to the server and read the
 //    response packet into the result.
 // The presence of an NTP service at the target can be inferred by a non-nil
 // result -- if the service does not return any data or if the response is not
 // a valid NTP packet, then the result will be nil.
 // The presence of a DDoS-amplifying target can be inferred by
-// result.MonListReponse being present.
-func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	sock, err := t.OpenUDP(&scanner.config.BaseFlags, &scanner.config.UDPFlags)
+// result.MonListReponse being present, or by result.AmplificationRisk.
+func (scanner *Scanner) Scan(ctx context.Context, t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	sock, err := t.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
@@ -1024,17 +1060,37 @@ func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{
 		result.Time = &temp
 		result.Version = &inPacket.Version
 	}
+	status, err := zgrab2.SCAN_SUCCESS, error(nil)
+	// detected is set if the mode 6 or mode 7 request got a valid response.
+	detected := false
+	if scanner.config.ReadVar {
+		readVar, requestBytes, readVarErr := scanner.ReadVar(sock)
+		if readVar != nil {
+			result.ReadVar = readVar
+			result.ReadVarAmplification = newAmplification(requestBytes, readVar.ResponseBytes, readVar.Packets)
+			detected = true
+		}
+		if readVarErr != nil {
+			// Keep going with the monlist request, which may still succeed.
+			status, err = readVarStatus(readVarErr), readVarErr
+		}
+	}
 	if scanner.config.MonList {
-		status, err := scanner.MonList(sock, result)
-		if err != nil {
-			if scanner.config.SkipGetTime {
-				// TODO: Currently, returning a non-nil result means that the service was positively detected.
-				// It may be safer to add an explicit flag for this (status == success is not sufficient, since e.g. you can get a timeout after positively identifying the service)
-				// This also means that partial TLS handshakes cannot be returned
-				return status, nil, err
-			}
-			return status, result, err
+		monListStatus, monListErr := scanner.MonList(sock, result)
+		if monListErr != nil && err == nil {
+			status, err = monListStatus, monListErr
+		}
+		detected = detected || monListErr == nil
+	}
+	setAmplificationRisk(result)
+	if err != nil {
+		if scanner.config.SkipGetTime && !detected {
+			// TODO: Currently, returning a non-nil result means that the service was positively detected.
+			// It may be safer to add an explicit flag for this (status == success is not sufficient, since e.g. you can get a timeout after positively identifying the service)
+			// This also means that partial TLS handshakes cannot be returned
+			return status, nil, err
 		}
+		return status, result, err
 	}
 
 	return zgrab2.SCAN_SUCCESS, result, nil
@@ -0,0 +1,126 @@
+package openvpn
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// The opcodes of the packets.
+const (
+	opResetServerV1 = 2
+	opAck           = 5
+	opDataV1        = 6
+	opResetClientV2 = 7
+	opResetServerV2 = 8
+	opDataV2        = 9
+)
+
+// opcodeNames names the opcodes.
+var opcodeNames = map[byte]string{
+	1:  "P_CONTROL_HARD_RESET_CLIENT_V1",
+	2:  "P_CONTROL_HARD_RESET_SERVER_V1",
+	3:  "P_CONTROL_SOFT_RESET_V1",
+	4:  "P_CONTROL_V1",
+	5:  "P_ACK_V1",
+	6:  "P_DATA_V1",
+	7:  "P_CONTROL_HARD_RESET_CLIENT_V2",
+	8:  "P_CONTROL_HARD_RESET_SERVER_V2",
+	9:  "P_DATA_V2",
+	10: "P_CONTROL_HARD_RESET_CLIENT_V3",
+	11: "P_CONTROL_WKC_V1",
+}
+
+// maxAcks is the maximum length of the ack array of a packet.
+const maxAcks = 8
+
+// ErrInvalidPacket is returned if a response is not an OpenVPN control
+// packet.
+var ErrInvalidPacket = errors.New("invalid OpenVPN packet")
+
+// packet is an OpenVPN control packet, without the HMAC of tls-auth.
+type packet struct {
+	opcode    byte
+	keyID     byte
+	sessionID []byte
+
+	// acks lists the packet IDs acknowledged, and remoteSessionID is the
+	// session ID of the peer, if acks is not empty.
+	acks            []uint32
+	remoteSessionID []byte
+
+	packetID uint32
+	payload  []byte
+}
+
+// encodeClientReset returns the P_CONTROL_HARD_RESET_CLIENT_V2 packet of the
+// session, with no acks and packet ID 0.
+func encodeClientReset(sessionID []byte) []byte {
+	buf := append([]byte{opResetClientV2 << 3}, sessionID...)
+	return append(buf, 0, 0, 0, 0, 0)
+}
+
+// parsePacket parses a control packet.
+func parsePacket(buf []byte) (*packet, error) {
+	if len(buf) < 10 {
+		return nil, ErrInvalidPacket
+	}
+	p := &packet{opcode: buf[0] >> 3, keyID: buf[0] & 0x07, sessionID: buf[1:9]}
+	if _, ok := opcodeNames[p.opcode]; !ok || p.opcode == opDataV1 || p.opcode == opDataV2 {
+		return nil, ErrInvalidPacket
+	}
+	n := int(buf[9])
+	buf = buf[10:]
+	if n > maxAcks {
+		return nil, ErrInvalidPacket
+	}
+	if n > 0 {
+		if len(buf) < 4*n+8 {
+			return nil, ErrInvalidPacket
+		}
+		for i := 0; i < n; i++ {
+			p.acks = append(p.acks, binary.BigEndian.Uint32(buf[4*i:]))
+		}
+		p.remoteSessionID = buf[4*n : 4*n+8]
+		buf = buf[4*n+8:]
+	}
+	if p.opcode == opAck {
+		return p, nil
+	}
+	if len(buf) < 4 {
+		return nil, ErrInvalidPacket
+	}
+	p.packetID = binary.BigEndian.Uint32(buf)
+	p.payload = buf[4:]
+	return p, nil
+}
+
+// writeFrame writes a packet over TCP, prefixed with its length.
+func writeFrame(w io.Writer, buf []byte) error {
+	frame := make([]byte, 2, 2+len(buf))
+	binary.BigEndian.PutUint16(frame, uint16(len(buf)))
+	_, err := w.Write(append(frame, buf...))
+	return err
+}
+
+// readFrame reads a packet over TCP.
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(header))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// hexID returns a session ID in hexadecimal.
+func hexID(id []byte) string {
+	if id == nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
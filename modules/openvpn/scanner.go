@@ -0,0 +1,201 @@
+// Package openvpn provides a zgrab2 module that sends the initial reset of
+// the OpenVPN handshake, and records the reset of the server.
+// Default Port: 1194 (UDP)
+//
+// The scanner sends a P_CONTROL_HARD_RESET_CLIENT_V2 packet over UDP, or over
+// TCP with --transport=tcp. A server without tls-auth or tls-crypt answers
+// with a P_CONTROL_HARD_RESET_SERVER_V2 packet, which acknowledges the reset
+// and gives the session ID of the server. A server with tls-auth or tls-crypt
+// drops the packet, which has no valid HMAC: over UDP, it cannot be told
+// apart from a closed port, while over TCP it closes the connection or keeps
+// it silent.
+package openvpn
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// Flags holds the command-line configuration for the openvpn module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+
+	Transport string `long:"transport" default:"udp" choice:"udp" choice:"tcp" description:"Transport of the reset: UDP, or TCP."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results is the output of the openvpn module.
+type Results struct {
+	Transport string `json:"transport"`
+
+	// Reset is true if the server answered with a hard reset.
+	Reset bool `json:"reset"`
+
+	// TLSAuth is true if the server accepted the TCP connection, but closed
+	// it or timed out without answering, as servers with tls-auth or
+	// tls-crypt do.
+	TLSAuth bool `json:"tls_auth,omitempty"`
+
+	// Opcode is the opcode of the response, and KeyID its key ID.
+	Opcode string `json:"opcode,omitempty"`
+	KeyID  uint8  `json:"key_id,omitempty"`
+
+	// SessionID is the session ID of the server, in hexadecimal.
+	SessionID string `json:"session_id,omitempty"`
+
+	// AckedPacketIDs lists the packet IDs acknowledged by the server, and
+	// RemoteSessionID is the session ID of the scanner sent back with them.
+	AckedPacketIDs  []uint32 `json:"acked_packet_ids,omitempty"`
+	RemoteSessionID string   `json:"remote_session_id,omitempty"`
+
+	// PacketID is the packet ID of the response, and PayloadLength the
+	// length of its payload.
+	PacketID      uint32 `json:"packet_id"`
+	PayloadLength int    `json:"payload_length,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("openvpn", "OpenVPN", module.Description(), 1194, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Send the initial reset of the OpenVPN handshake over UDP or TCP, and read the reset of the server"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "openvpn"
+}
+
+// exchange sends the reset over conn, and returns the response.
+func (scanner *Scanner) exchange(conn net.Conn, reset []byte) ([]byte, error) {
+	if scanner.config.Transport == "tcp" {
+		if err := writeFrame(conn, reset); err != nil {
+			return nil, err
+		}
+		return readFrame(conn)
+	}
+	if _, err := conn.Write(reset); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// Scan sends the client reset, and reads the response. Over TCP, a
+// connection closed or silent after the reset is reported with TLSAuth set.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	var conn net.Conn
+	var err error
+	if scanner.config.Transport == "tcp" {
+		conn, err = target.Open(ctx, &scanner.config.BaseFlags)
+	} else {
+		conn, err = target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	}
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	sessionID := make([]byte, 8)
+	if _, err := rand.Read(sessionID); err != nil {
+		return zgrab2.SCAN_UNKNOWN_ERROR, nil, err
+	}
+	results := &Results{Transport: scanner.config.Transport}
+	buf, err := scanner.exchange(conn, encodeClientReset(sessionID))
+	if err != nil {
+		if scanner.config.Transport == "tcp" && (err == io.ErrUnexpectedEOF || zgrab2.TryGetScanStatus(err) == zgrab2.SCAN_IO_TIMEOUT) {
+			results.TLSAuth = true
+			return zgrab2.TryGetScanStatus(err), results, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	p, err := parsePacket(buf)
+	if err != nil {
+		return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+	}
+	results.Reset = p.opcode == opResetServerV2 || p.opcode == opResetServerV1
+	results.Opcode = opcodeNames[p.opcode]
+	results.KeyID = p.keyID
+	results.SessionID = hexID(p.sessionID)
+	results.AckedPacketIDs = p.acks
+	results.RemoteSessionID = hexID(p.remoteSessionID)
+	results.PacketID = p.packetID
+	results.PayloadLength = len(p.payload)
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,90 @@
+package openvpn
+
+import (
+	"encoding/hex"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// serverReset returns the P_CONTROL_HARD_RESET_SERVER_V2 answering the client
+// reset.
+func serverReset(reset []byte) []byte {
+	p, err := parsePacket(reset)
+	if err != nil || p.opcode != opResetClientV2 {
+		return nil
+	}
+	buf := []byte{opResetServerV2 << 3, 0x5e, 0x55, 0x10, 0x9d, 0x00, 0x01, 0x02, 0x03, 1, 0, 0, 0, 0}
+	buf = append(buf, p.sessionID...)
+	return append(buf, 0, 0, 0, 0)
+}
+
+func scan(t *testing.T, addr string, transport string) (zgrab2.ScanStatus, *Results, error) {
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), &Flags{Transport: transport}, addr)
+	results, _ := ret.(*Results)
+	return status, results, err
+}
+
+func TestUDP(t *testing.T) {
+	sessionIDs := make(chan string, 1)
+	server, err := testserver.NewUDP(func(request []byte) []byte {
+		select {
+		case sessionIDs <- hex.EncodeToString(request[1:9]):
+		default:
+			// A retransmission.
+		}
+		return serverReset(request)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	status, results, err := scan(t, server.Addr(), "udp")
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if !results.Reset || results.Opcode != "P_CONTROL_HARD_RESET_SERVER_V2" || results.SessionID != "5e55109d00010203" || results.TLSAuth {
+		t.Errorf("got %+v", results)
+	}
+	if !reflect.DeepEqual(results.AckedPacketIDs, []uint32{0}) || results.RemoteSessionID != <-sessionIDs {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestTCP(t *testing.T) {
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		frame, err := readFrame(conn)
+		if err != nil {
+			return err
+		}
+		return writeFrame(conn, serverReset(frame))
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	status, results, err := scan(t, server.Addr(), "tcp")
+	if status != zgrab2.SCAN_SUCCESS || err != nil || !results.Reset || results.Transport != "tcp" || len(results.AckedPacketIDs) != 1 {
+		t.Errorf("got status %s, %+v, error %v", status, results, err)
+	}
+}
+
+func TestTLSAuth(t *testing.T) {
+	// The server drops the reset, as with --tls-auth.
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		_, err := readFrame(conn)
+		return err
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	_, results, err := scan(t, server.Addr(), "tcp")
+	if err == nil || results == nil || !results.TLSAuth || results.Reset {
+		t.Errorf("got %+v, error %v", results, err)
+	}
+}
@@ -21,7 +21,9 @@
 package oracle
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"strconv"
 
 	log "github.com/sirupsen/logrus"
@@ -122,6 +124,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Perform a handshake with Oracle database servers"
@@ -217,15 +224,17 @@ func (scanner *Scanner) getTNSDriver() *TNSDriver {
 //     into the results, then send a Native Security Negotiation Data packet.
 //  8. If the response is not a Data packet, exit with SCAN_APPLICATION_ERROR.
 //  9. Pull the versions out of the response and exit with SCAN_SUCCESS.
-func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+func (scanner *Scanner) Scan(ctx context.Context, t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
 	var results *ScanResults
 
-	sock, err := t.Open(&scanner.config.BaseFlags)
+	sock, err := t.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
 	if scanner.config.TCPS {
-		tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(sock)
+		tlsConn, err := scanner.config.TLSFlags.GetTLSConnectionForTarget(sock, nil, func() (net.Conn, error) {
+			return t.Open(ctx, &scanner.config.BaseFlags)
+		})
 		if err != nil {
 			// GetTLSConnection can only fail if the input flags are bad
 			panic(err)
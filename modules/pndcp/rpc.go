@@ -0,0 +1,273 @@
+package pndcp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The packet types of connectionless DCE/RPC.
+const (
+	ptypeRequest  = 0
+	ptypeResponse = 2
+	ptypeFault    = 3
+	ptypeReject   = 6
+)
+
+const (
+	// headerLength is the length of the connectionless DCE/RPC header.
+	headerLength = 80
+
+	// flagIdempotent is the flag of idempotent requests.
+	flagIdempotent = 0x20
+
+	// drepLittleEndian is the integer representation of little-endian
+	// packets, with ASCII characters.
+	drepLittleEndian = 0x10
+
+	// opLookup is the number of the ept_lookup operation of the endpoint
+	// mapper.
+	opLookup = 2
+
+	// epmVersion is the version of the endpoint mapper interface.
+	epmVersion = 3
+
+	// statusNotRegistered is the status of a lookup past the last entry.
+	statusNotRegistered = 0x16c9a0d6
+)
+
+// epmInterface is the UUID of the endpoint mapper interface, in its wire
+// format.
+var epmInterface = mustUUID("e1af8308-5d1f-11c9-91a4-08002b14a0fa")
+
+// pnioObject is the prefix of the UUIDs of the PNIO objects, followed by the
+// instance, device ID and vendor ID of the device.
+const pnioObject = "dea00000-6c97-11d1-8271-"
+
+// pnioSuffix is the suffix of the UUIDs of the PNIO interfaces.
+const pnioSuffix = "-6c97-11d1-8271-00a02442df7d"
+
+// roles names the PNIO interfaces by the role they give the device.
+var roles = map[string]string{
+	"dea00001" + pnioSuffix: "device",
+	"dea00002" + pnioSuffix: "controller",
+	"dea00003" + pnioSuffix: "supervisor",
+	"dea00004" + pnioSuffix: "parameter_server",
+}
+
+var (
+	// ErrInvalidResponse is returned if a response is not a DCE/RPC response
+	// to the lookup.
+	ErrInvalidResponse = errors.New("invalid DCE/RPC response")
+
+	// errRejected is returned if the lookup is rejected or fails.
+	errRejected = errors.New("endpoint mapper lookup rejected")
+)
+
+// mustUUID returns the wire format of a UUID, with its first three fields in
+// little-endian.
+func mustUUID(s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != 16 {
+		panic("invalid UUID " + s)
+	}
+	swapUUID(b)
+	return b
+}
+
+// swapUUID swaps the byte order of the first three fields of a UUID.
+func swapUUID(b []byte) {
+	b[0], b[1], b[2], b[3] = b[3], b[2], b[1], b[0]
+	b[4], b[5] = b[5], b[4]
+	b[6], b[7] = b[7], b[6]
+}
+
+// formatUUID formats the wire format of a UUID, in the byte order order.
+func formatUUID(b []byte, order binary.ByteOrder) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x", order.Uint32(b), order.Uint16(b[4:]), order.Uint16(b[6:]), b[8:10], b[10:16])
+}
+
+// encodeLookup returns an ept_lookup request for all the entries of the
+// endpoint mapper, one at a time, from handle.
+func encodeLookup(activity []byte, seq uint32, handle []byte) []byte {
+	body := make([]byte, 0, 76)
+	u32 := func(v uint32) {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, v)
+		body = append(body, b...)
+	}
+	// The inquiry type (all the elements), and null pointers to the object
+	// and the interface.
+	u32(0)
+	u32(0)
+	u32(0)
+	// The version option (all versions), the entry handle and max_ents.
+	u32(1)
+	body = append(body, handle...)
+	u32(1)
+	buf := make([]byte, headerLength, headerLength+len(body))
+	buf[0] = 4
+	buf[1] = ptypeRequest
+	buf[2] = flagIdempotent
+	buf[4] = drepLittleEndian
+	copy(buf[24:], epmInterface)
+	copy(buf[40:], activity)
+	binary.LittleEndian.PutUint32(buf[60:], epmVersion)
+	binary.LittleEndian.PutUint32(buf[64:], seq)
+	binary.LittleEndian.PutUint16(buf[68:], opLookup)
+	binary.LittleEndian.PutUint16(buf[70:], 0xffff)
+	binary.LittleEndian.PutUint16(buf[72:], 0xffff)
+	binary.LittleEndian.PutUint16(buf[74:], uint16(len(body)))
+	return append(buf, body...)
+}
+
+// Entry is an entry of the endpoint mapper.
+type Entry struct {
+	Object           string `json:"object"`
+	Interface        string `json:"interface,omitempty"`
+	InterfaceVersion uint16 `json:"interface_version,omitempty"`
+	Annotation       string `json:"annotation,omitempty"`
+}
+
+// lookupResponse is the parsed response to a lookup.
+type lookupResponse struct {
+	handle  []byte
+	entries []*Entry
+	status  uint32
+}
+
+// reader reads the NDR representation of a response body.
+type reader struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+	err   error
+}
+
+// bytes returns the next n bytes, or nil past the end of the body.
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.buf) {
+		r.err = ErrInvalidResponse
+		return nil
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) u32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return r.order.Uint32(b)
+}
+
+func (r *reader) align() {
+	if r.pos%4 != 0 && r.err == nil {
+		r.bytes(4 - r.pos%4)
+	}
+}
+
+// parseLookup parses a response packet to a lookup.
+func parseLookup(pkt []byte) (*lookupResponse, error) {
+	if len(pkt) < headerLength || pkt[0] != 4 {
+		return nil, ErrInvalidResponse
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if pkt[4]&drepLittleEndian != 0 {
+		order = binary.LittleEndian
+	}
+	switch pkt[1] {
+	case ptypeResponse:
+	case ptypeFault, ptypeReject:
+		return nil, errRejected
+	default:
+		return nil, ErrInvalidResponse
+	}
+	length := int(order.Uint16(pkt[74:]))
+	if headerLength+length > len(pkt) {
+		return nil, ErrInvalidResponse
+	}
+	r := &reader{buf: pkt[headerLength : headerLength+length], order: order}
+	resp := &lookupResponse{handle: append([]byte(nil), r.bytes(20)...)}
+	r.u32() // num_ents
+	r.u32() // max_count
+	r.u32() // offset
+	count := int(r.u32())
+	if r.err != nil || count > length/24 {
+		return nil, ErrInvalidResponse
+	}
+	towers := make([]bool, count)
+	for i := 0; i < count; i++ {
+		object := r.bytes(16)
+		if object == nil {
+			return nil, r.err
+		}
+		e := &Entry{Object: formatUUID(object, order)}
+		towers[i] = r.u32() != 0
+		r.u32() // offset
+		e.Annotation = string(bytes.TrimRight(r.bytes(int(r.u32())), "\x00"))
+		r.align()
+		resp.entries = append(resp.entries, e)
+	}
+	for i, e := range resp.entries {
+		if !towers[i] {
+			continue
+		}
+		r.u32() // max_count
+		tower := r.bytes(int(r.u32()))
+		r.align()
+		if r.err == nil {
+			e.Interface, e.InterfaceVersion = parseTower(tower)
+		}
+	}
+	resp.status = r.u32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return resp, nil
+}
+
+// parseTower returns the interface UUID and major version of the first floor
+// of a protocol tower. The floors are always little-endian.
+func parseTower(tower []byte) (string, uint16) {
+	// The floor count, the length of the left-hand side, and its protocol
+	// identifier, UUID and version.
+	if len(tower) < 2+2+1+16+2 || tower[4] != 0x0d {
+		return "", 0
+	}
+	return formatUUID(tower[5:21], binary.LittleEndian), binary.LittleEndian.Uint16(tower[21:])
+}
+
+// Annotation is the PNIO annotation of an entry: the device type, order ID,
+// and hardware and software revisions of the device.
+type Annotation struct {
+	DeviceType string `json:"device_type,omitempty"`
+	OrderID    string `json:"order_id,omitempty"`
+	HWRevision string `json:"hw_revision,omitempty"`
+	SWRevision string `json:"sw_revision,omitempty"`
+}
+
+// parseAnnotation parses a PNIO annotation: the device type (25 characters),
+// the order ID (20 characters), the hardware revision (5 digits), and the
+// software revision prefix, major, minor and bugfix revisions (1 and 3 times
+// 3 characters), separated by spaces. It returns nil for other annotations.
+func parseAnnotation(s string) *Annotation {
+	if len(s) < 63 || s[25] != ' ' || s[46] != ' ' || s[52] != ' ' {
+		return nil
+	}
+	field := func(from, to int) string {
+		return strings.TrimSpace(s[from:to])
+	}
+	a := &Annotation{
+		DeviceType: field(0, 25),
+		OrderID:    field(26, 46),
+		HWRevision: field(47, 52),
+	}
+	a.SWRevision = fmt.Sprintf("%s%s.%s.%s", field(53, 54), field(54, 57), field(57, 60), field(60, 63))
+	return a
+}
@@ -0,0 +1,218 @@
+// Package pndcp provides a zgrab2 module that identifies PROFINET IO devices
+// through their PNIO context manager.
+// Default Port: 34964 (UDP)
+//
+// PROFINET DCP, which gives the station name of a device, is a layer 2
+// protocol, and cannot be sent to a device over IP. The scanner instead sends
+// the PN-IO signature probe: an ept_lookup request to the DCE/RPC endpoint
+// mapper of the PNIO context manager, repeated to read all the entries. The
+// object UUIDs of the entries encode the vendor ID, device ID and instance
+// of the device, and their interfaces give its roles (IO device, controller,
+// supervisor or parameter server). The annotation of the entries gives the
+// device type, order ID, and hardware and software revisions, as in
+// "S7-1500 6ES7 516-3AN01-0AB0 5 V2.5.1".
+package pndcp
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// maxLookups is the maximum number of entries read from the endpoint mapper.
+const maxLookups = 16
+
+// Flags holds the command-line configuration for the pndcp module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results is the output of the pndcp module.
+type Results struct {
+	// VendorID, DeviceID and Instance are those of the PNIO object UUID.
+	VendorID uint16 `json:"vendor_id"`
+	DeviceID uint16 `json:"device_id"`
+	Instance uint16 `json:"instance"`
+
+	// Roles lists the roles of the PNIO interfaces of the device.
+	Roles []string `json:"roles,omitempty"`
+
+	// Annotation is the first PNIO annotation of the entries.
+	Annotation *Annotation `json:"annotation,omitempty"`
+
+	Entries []*Entry `json:"entries,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("pndcp", "PROFINET IO", module.Description(), 34964, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Identify PROFINET IO devices by the endpoint mapper entries of their PNIO context manager"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "pndcp"
+}
+
+// isZero returns true if all the bytes of b are zero.
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// identify fills the identification of the device from the entries.
+func (results *Results) identify() {
+	seen := make(map[string]bool)
+	for _, e := range results.Entries {
+		if strings.HasPrefix(e.Object, pnioObject) && results.VendorID == 0 && results.DeviceID == 0 {
+			node := strings.TrimPrefix(e.Object, pnioObject)
+			if len(node) == 12 {
+				instance, _ := strconv.ParseUint(node[0:4], 16, 16)
+				device, _ := strconv.ParseUint(node[4:8], 16, 16)
+				vendor, _ := strconv.ParseUint(node[8:12], 16, 16)
+				results.Instance, results.DeviceID, results.VendorID = uint16(instance), uint16(device), uint16(vendor)
+			}
+		}
+		if role, ok := roles[e.Interface]; ok && !seen[role] {
+			seen[role] = true
+			results.Roles = append(results.Roles, role)
+		}
+		if results.Annotation == nil {
+			results.Annotation = parseAnnotation(e.Annotation)
+		}
+	}
+}
+
+// lookup sends a lookup from handle, and parses the response.
+func lookup(conn net.Conn, activity []byte, seq uint32, handle []byte) (*lookupResponse, zgrab2.ScanStatus, error) {
+	if _, err := conn.Write(encodeLookup(activity, seq, handle)); err != nil {
+		return nil, zgrab2.TryGetScanStatus(err), err
+	}
+	buf := make([]byte, 65536)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, zgrab2.TryGetScanStatus(err), err
+	}
+	resp, err := parseLookup(buf[:n])
+	if err == errRejected {
+		return nil, zgrab2.SCAN_APPLICATION_ERROR, err
+	}
+	if err != nil {
+		return nil, zgrab2.SCAN_PROTOCOL_ERROR, err
+	}
+	return resp, zgrab2.SCAN_SUCCESS, nil
+}
+
+// Scan reads the entries of the endpoint mapper, one per lookup, until the
+// last one. The scan fails if the first lookup fails, while an error of a
+// later lookup is reported with the entries read.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	activity := make([]byte, 16)
+	rand.Read(activity)
+	handle := make([]byte, 20)
+	results := new(Results)
+	for seq := uint32(0); seq < maxLookups; seq++ {
+		resp, status, err := lookup(conn, activity, seq, handle)
+		if err == nil && resp.status != 0 && resp.status != statusNotRegistered {
+			status, err = zgrab2.SCAN_APPLICATION_ERROR, errRejected
+		}
+		if err != nil {
+			if seq == 0 {
+				return status, nil, err
+			}
+			results.identify()
+			return status, results, err
+		}
+		results.Entries = append(results.Entries, resp.entries...)
+		handle = resp.handle
+		if resp.status == statusNotRegistered || isZero(handle) {
+			break
+		}
+	}
+	results.identify()
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
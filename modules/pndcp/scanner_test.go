@@ -0,0 +1,128 @@
+package pndcp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// annotation is the annotation of an S7-1500 controller.
+var annotation = fmt.Sprintf("%-25s %-20s %5s %1s%3s%3s%3s", "S7-1500", "6ES7 516-3AN01-0AB0", "5", "V", "2", "5", "1")
+
+// tower returns a protocol tower whose first floor is the interface.
+func tower(iface string) []byte {
+	buf := []byte{1, 0, 19, 0, 0x0d}
+	buf = append(buf, mustUUID(iface)...)
+	buf = append(buf, 1, 0, 2, 0, 0, 0)
+	return buf
+}
+
+// encodeResponse returns a response to the request with the next handle and
+// one entry.
+func encodeResponse(request []byte, handle []byte, object, iface string) []byte {
+	var body []byte
+	u32 := func(v uint32) {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, v)
+		body = append(body, b...)
+	}
+	align := func() {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+	}
+	body = append(body, handle...)
+	u32(1)
+	u32(1)
+	u32(0)
+	u32(1)
+	body = append(body, mustUUID(object)...)
+	u32(3)
+	u32(0)
+	u32(uint32(len(annotation) + 1))
+	body = append(append(body, annotation...), 0)
+	align()
+	t := tower(iface)
+	u32(uint32(len(t)))
+	u32(uint32(len(t)))
+	body = append(body, t...)
+	align()
+	u32(0)
+	pkt := make([]byte, headerLength)
+	copy(pkt, request[:headerLength])
+	pkt[1] = ptypeResponse
+	binary.LittleEndian.PutUint16(pkt[74:], uint16(len(body)))
+	return append(pkt, body...)
+}
+
+// serve runs a fake endpoint mapper, answering each lookup with respond.
+func serve(t *testing.T, respond func(request, handle []byte) []byte) *testserver.UDPServer {
+	server, err := testserver.NewUDP(func(request []byte) []byte {
+		if len(request) != headerLength+40 || binary.LittleEndian.Uint16(request[68:]) != opLookup {
+			return nil
+		}
+		return respond(request, request[headerLength+16:headerLength+36])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func scan(t *testing.T, server *testserver.UDPServer) (zgrab2.ScanStatus, *Results, error) {
+	defer server.Close()
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), new(Flags), server.Addr())
+	results, _ := ret.(*Results)
+	return status, results, err
+}
+
+func TestLookup(t *testing.T) {
+	server := serve(t, func(request, handle []byte) []byte {
+		if isZero(handle) {
+			next := make([]byte, 20)
+			next[0] = 1
+			return encodeResponse(request, next, "dea00000-6c97-11d1-8271-0001010e002a", "dea00001-6c97-11d1-8271-00a02442df7d")
+		}
+		return encodeResponse(request, make([]byte, 20), "dea00000-6c97-11d1-8271-0001010e002a", "dea00002-6c97-11d1-8271-00a02442df7d")
+	})
+	status, results, err := scan(t, server)
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if results.VendorID != 0x002a || results.DeviceID != 0x010e || results.Instance != 1 || len(results.Entries) != 2 {
+		t.Errorf("got %+v", results)
+	}
+	if want := []string{"device", "controller"}; !reflect.DeepEqual(results.Roles, want) {
+		t.Errorf("got roles %v, want %v", results.Roles, want)
+	}
+	want := &Annotation{DeviceType: "S7-1500", OrderID: "6ES7 516-3AN01-0AB0", HWRevision: "5", SWRevision: "V2.5.1"}
+	if !reflect.DeepEqual(results.Annotation, want) {
+		t.Errorf("got annotation %+v, want %+v", results.Annotation, want)
+	}
+	if e := results.Entries[0]; e.Object != "dea00000-6c97-11d1-8271-0001010e002a" || e.InterfaceVersion != 1 || e.Annotation != annotation {
+		t.Errorf("got entry %+v", e)
+	}
+}
+
+func TestFault(t *testing.T) {
+	server := serve(t, func(request, handle []byte) []byte {
+		response := append([]byte(nil), request[:headerLength]...)
+		response[1] = ptypeFault
+		return response
+	})
+	status, results, err := scan(t, server)
+	if status != zgrab2.SCAN_APPLICATION_ERROR || err != errRejected || results != nil {
+		t.Errorf("got status %s, error %v, results %+v", status, err, results)
+	}
+}
+
+func TestParseAnnotation(t *testing.T) {
+	if a := parseAnnotation("Windows RPC"); a != nil {
+		t.Errorf("got %+v", a)
+	}
+}
@@ -0,0 +1,150 @@
+package pop3
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strings"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/auth"
+	"github.com/zmap/zgrab2/lib/sasl"
+)
+
+// pop3MultilineEndRegex matches the end of a multi-line response, or of an
+// error response.
+var pop3MultilineEndRegex = regexp.MustCompile(`(?:^-[^\r\n]*\r\n$)|(?:\r\n\.\r\n$)`)
+
+// Capabilities are the capabilities listed by the server in its response to
+// CAPA (RFC 2449).
+type Capabilities struct {
+	// List is the capabilities, as listed, with their parameters (e.g.
+	// "SASL PLAIN LOGIN").
+	List []string `json:"list,omitempty"`
+
+	// AuthMechanisms are the SASL mechanisms of the SASL capability.
+	AuthMechanisms []string `json:"auth_mechanisms,omitempty"`
+
+	// StartTLS is true if the STLS capability is listed.
+	StartTLS bool `json:"starttls,omitempty"`
+
+	// User is true if the USER capability is listed.
+	User bool `json:"user,omitempty"`
+}
+
+// parseCapabilities parses a response to CAPA, or returns nil if it is not a
+// successful one.
+func parseCapabilities(response string) *Capabilities {
+	if !strings.HasPrefix(response, "+OK") {
+		return nil
+	}
+	caps := new(Capabilities)
+	lines := strings.Split(response, "\r\n")
+	for _, line := range lines[1:] {
+		if line == "." {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		caps.List = append(caps.List, line)
+		switch strings.ToUpper(fields[0]) {
+		case "SASL":
+			for _, mechanism := range fields[1:] {
+				caps.AuthMechanisms = append(caps.AuthMechanisms, strings.ToUpper(mechanism))
+			}
+		case "STLS":
+			caps.StartTLS = true
+		case "USER":
+			caps.User = true
+		}
+	}
+	return caps
+}
+
+// GetCapabilities sends the CAPA command and returns the response.
+func (conn *Connection) GetCapabilities() (string, error) {
+	if _, err := conn.Conn.Write([]byte("CAPA\r\n")); err != nil {
+		return "", err
+	}
+	ret := make([]byte, readBufferSize)
+	n, err := zgrab2.ReadUntilRegex(conn.Conn, ret, pop3MultilineEndRegex)
+	if err != nil {
+		return "", err
+	}
+	return string(ret[:n]), nil
+}
+
+// sendUser sends the USER and PASS commands, and returns whether they
+// succeeded and the server's last response.
+func (conn *Connection) sendUser(username, password string) (bool, string, error) {
+	ret, err := conn.SendCommand("USER " + username)
+	if err != nil || !strings.HasPrefix(ret, "+OK") {
+		return false, ret, err
+	}
+	ret, err = conn.SendCommand("PASS " + password)
+	if err != nil {
+		return false, "", err
+	}
+	return strings.HasPrefix(ret, "+OK"), ret, nil
+}
+
+// authenticate sends the AUTH command (RFC 5034) with the mechanism of
+// client, answers the server's challenges, and returns whether it succeeded
+// and the server's final response.
+func (conn *Connection) authenticate(mechanism string, client sasl.Client) (bool, string, error) {
+	ret, err := conn.SendCommand("AUTH " + mechanism)
+	for ; err == nil; ret, err = conn.SendCommand(ret) {
+		// Continuation requests start with "+ ", final responses with +OK
+		// or -ERR.
+		if !strings.HasPrefix(ret, "+") || strings.HasPrefix(ret, "+OK") {
+			return strings.HasPrefix(ret, "+OK"), ret, nil
+		}
+		// An invalid challenge, or one the mechanism cannot answer, cancels
+		// the exchange.
+		answer := "*"
+		if challenge, err := base64.StdEncoding.DecodeString(strings.TrimSpace(ret[1:])); err == nil {
+			if response, err := client.Next(challenge); err == nil {
+				answer = base64.StdEncoding.EncodeToString(response)
+			}
+		}
+		ret = answer
+	}
+	return false, "", err
+}
+
+// Login attempts each credential in turn, with the SASL mechanisms
+// advertised in caps, then with the USER and PASS commands (unless the
+// server lists its capabilities, without USER), until one logs in.
+func (conn *Connection) Login(caps *Capabilities, creds []*auth.Credential) (*sasl.Result, error) {
+	result := new(sasl.Result)
+	if caps != nil {
+		result.Advertised = caps.AuthMechanisms
+	}
+	for _, cred := range creds {
+		for _, mechanism := range sasl.Mechanisms {
+			client := sasl.NewClient(mechanism, cred.Username, cred.Password, cred.Token)
+			if client == nil || !result.Advertises(mechanism) {
+				continue
+			}
+			ok, ret, err := conn.authenticate(mechanism, client)
+			if err != nil {
+				return result, err
+			}
+			if result.Add(sasl.Attempt{Username: cred.Username, Command: "AUTH", Mechanism: mechanism, Success: ok, Response: ret}) {
+				return result, nil
+			}
+		}
+		if cred.Token != "" || (caps != nil && !caps.User) {
+			continue
+		}
+		ok, ret, err := conn.sendUser(cred.Username, cred.Password)
+		if err != nil {
+			return result, err
+		}
+		if result.Add(sasl.Attempt{Username: cred.Username, Command: "USER", Success: ok, Response: ret}) {
+			return result, nil
+		}
+	}
+	return result, nil
+}
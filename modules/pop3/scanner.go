@@ -15,6 +15,13 @@
 // --pop3s does not change the default port number from 110, so
 // it should usually be coupled with e.g. --port 995.
 //
+// The --send-capa flag tells the scanner to send the CAPA command, and
+// again after STLS.
+//
+// The --creds-file flag tells the scanner to attempt to log in with the
+// credentials of the target, with the advertised AUTH mechanisms and the
+// USER and PASS commands.
+//
 // The --send-quit flag tells the scanner to send a QUIT command
 // before disconnecting.
 //
@@ -26,12 +33,16 @@
 package pop3
 
 import (
+	"context"
 	"fmt"
 	"errors"
+	"net"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/auth"
+	"github.com/zmap/zgrab2/lib/sasl"
 )
 
 // ScanResults instances are returned by the module's Scan function.
@@ -48,6 +59,19 @@ type ScanResults struct {
 	// StartTLS is the server's response to the STARTTLS command, if it is sent.
 	StartTLS string `json:"starttls,omitempty"`
 
+	// CAPA is the server's response to the CAPA command, if it is sent, and
+	// Capabilities the capabilities it lists.
+	CAPA         string        `json:"capa,omitempty"`
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+
+	// CAPATLS is the server's response to the CAPA command sent after STLS,
+	// and TLSCapabilities the capabilities it lists.
+	CAPATLS         string        `json:"capa_tls,omitempty"`
+	TLSCapabilities *Capabilities `json:"tls_capabilities,omitempty"`
+
+	// Auth is the outcome of the login attempts, if --creds-file is set.
+	Auth *sasl.Result `json:"auth,omitempty"`
+
 	// QUIT is the server's response to the QUIT command, if it is sent.
 	QUIT string `json:"quit,omitempty"`
 
@@ -76,6 +100,12 @@ type Flags struct {
 	// StartTLS indicates that the client should attempt to update the connection to TLS.
 	StartTLS bool `long:"starttls" description:"Send STLS before negotiating"`
 
+	// SendCAPA indicates that the CAPA command should be sent.
+	SendCAPA bool `long:"send-capa" description:"Send the CAPA command (again after STLS)"`
+
+	// CredsFile holds the credentials to attempt to log in with.
+	CredsFile string `long:"creds-file" description:"File of credentials (host username:password... or host bearer:token per line, as for the http module) attempted with the advertised AUTH mechanisms (PLAIN, LOGIN, CRAM-MD5, OAUTHBEARER) and USER/PASS. Implies --send-capa."`
+
 	// Verbose indicates that there should be more verbose logging.
 	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
 }
@@ -87,6 +117,7 @@ type Module struct {
 // Scanner implements the zgrab2.Scanner interface.
 type Scanner struct {
 	config *Flags
+	creds  *auth.Credentials
 }
 
 // RegisterModule registers the zgrab2 module.
@@ -108,6 +139,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Fetch POP3 banners, optionally over TLS"
@@ -121,6 +157,12 @@ func (flags *Flags) Validate(args []string) error {
 		log.Error("Cannot send both --starttls and --pop3s")
 		return zgrab2.ErrInvalidArguments
 	}
+	if flags.CredsFile != "" {
+		flags.SendCAPA = true
+	}
+	if flags.StartTLS {
+		return flags.TLSFlags.CheckRedial("--starttls")
+	}
 	return nil
 }
 
@@ -133,6 +175,13 @@ func (flags *Flags) Help() string {
 func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	f, _ := flags.(*Flags)
 	scanner.config = f
+	if f.CredsFile != "" {
+		creds, err := auth.ReadFile(f.CredsFile)
+		if err != nil {
+			return err
+		}
+		scanner.creds = creds
+	}
 	return nil
 }
 
@@ -191,19 +240,24 @@ func VerifyPOP3Contents(banner string) zgrab2.ScanStatus {
 // 3. Read the banner.
 // 4. If --send-help is sent, send HELP, read the result.
 // 5. If --send-noop is sent, send NOOP, read the result.
-// 6. If --starttls is sent, send STLS, read the result, negotiate a
-//    TLS connection using the command-line flags.
-// 7. If --send-quit is sent, send QUIT and read the result.
-// 8. Close the connection.
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	c, err := target.Open(&scanner.config.BaseFlags)
+// 6. If --send-capa is sent, send CAPA, read the result.
+// 7. If --starttls is sent, send STLS, read the result, negotiate a
+//    TLS connection using the command-line flags, and send CAPA again.
+// 8. If --creds-file is sent, attempt to log in with the credentials of the
+//    target.
+// 9. If --send-quit is sent, send QUIT and read the result.
+// 10. Close the connection.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	c, err := target.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
 	defer c.Close()
 	result := &ScanResults{}
 	if scanner.config.POP3Secure {
-		tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(c)
+		tlsConn, err := scanner.config.TLSFlags.GetTLSConnectionForTarget(c, nil, func() (net.Conn, error) {
+			return target.Open(ctx, &scanner.config.BaseFlags)
+		})
 		if err != nil {
 			return zgrab2.TryGetScanStatus(err), nil, err
 		}
@@ -239,6 +293,16 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 		}
 		result.NOOP = ret
 	}
+	var caps *Capabilities
+	if scanner.config.SendCAPA {
+		ret, err := conn.GetCapabilities()
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+		result.CAPA = ret
+		caps = parseCapabilities(ret)
+		result.Capabilities = caps
+	}
 	if scanner.config.StartTLS {
 		ret, err := conn.SendCommand("STLS")
 		if err != nil {
@@ -257,6 +321,22 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 			return zgrab2.TryGetScanStatus(err), result, err
 		}
 		conn.Conn = tlsConn
+		// The capabilities may change once TLS is negotiated.
+		if scanner.config.SendCAPA {
+			ret, err := conn.GetCapabilities()
+			if err != nil {
+				return zgrab2.TryGetScanStatus(err), result, err
+			}
+			result.CAPATLS = ret
+			caps = parseCapabilities(ret)
+			result.TLSCapabilities = caps
+		}
+	}
+	if creds := scanner.creds.For(&target, scanner.config.Port); len(creds) > 0 {
+		result.Auth, err = conn.Login(caps, creds)
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
 	}
 	if scanner.config.SendQUIT {
 		ret, err := conn.SendCommand("QUIT")
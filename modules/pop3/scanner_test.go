@@ -0,0 +1,96 @@
+package pop3
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/sasl"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// serve runs a fake POP3 server accepting the password secret for tim, with
+// USER and PASS only; AUTH LOGIN always fails.
+func serve(t *testing.T) *testserver.Server {
+	handler := func(conn net.Conn) error {
+		reader := bufio.NewReader(conn)
+		user := ""
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				// The scanner closes the connection once done.
+				return nil
+			}
+			cmd := strings.TrimSpace(line)
+			switch {
+			case cmd == "CAPA":
+				fmt.Fprintf(conn, "+OK Capability list follows\r\nTOP\r\nUSER\r\nSASL LOGIN\r\nUIDL\r\n.\r\n")
+			case cmd == "AUTH LOGIN":
+				var answers []string
+				for _, prompt := range []string{"Username:", "Password:"} {
+					fmt.Fprintf(conn, "+ %s\r\n", base64.StdEncoding.EncodeToString([]byte(prompt)))
+					answer, _ := reader.ReadString('\n')
+					decoded, _ := base64.StdEncoding.DecodeString(strings.TrimSpace(answer))
+					answers = append(answers, string(decoded))
+				}
+				fmt.Fprintf(conn, "-ERR [AUTH] Authentication failed (%s)\r\n", strings.Join(answers, "/"))
+			case strings.HasPrefix(cmd, "USER "):
+				user = cmd[5:]
+				fmt.Fprintf(conn, "+OK\r\n")
+			case strings.HasPrefix(cmd, "PASS "):
+				if user == "tim" && cmd[5:] == "secret" {
+					fmt.Fprintf(conn, "+OK Logged in.\r\n")
+				} else {
+					fmt.Fprintf(conn, "-ERR [AUTH] Authentication failed.\r\n")
+				}
+			default:
+				fmt.Fprintf(conn, "-ERR Unknown command\r\n")
+			}
+		}
+	}
+	server, err := testserver.New(testserver.Config{Banner: []byte("+OK POP3 server ready\r\n"), Handler: handler})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func TestLogin(t *testing.T) {
+	credsFile, err := ioutil.TempFile("", "creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(credsFile.Name())
+	credsFile.WriteString("127.0.0.1 tim:secret\n")
+	credsFile.Close()
+
+	server := serve(t)
+	defer server.Close()
+	flags := &Flags{CredsFile: credsFile.Name()}
+	if err := flags.Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	result := zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*ScanResults)
+	expectedCaps := &Capabilities{List: []string{"TOP", "USER", "SASL LOGIN", "UIDL"}, AuthMechanisms: []string{"LOGIN"}, User: true}
+	if !reflect.DeepEqual(result.Capabilities, expectedCaps) {
+		t.Errorf("got capabilities %+v", result.Capabilities)
+	}
+	expected := &sasl.Result{
+		Advertised: []string{"LOGIN"},
+		Accepted:   "USER",
+		Attempts: []sasl.Attempt{
+			{Username: "tim", Command: "AUTH", Mechanism: "LOGIN", Response: "-ERR [AUTH] Authentication failed (tim/secret)\r\n"},
+			{Username: "tim", Command: "USER", Success: true, Response: "+OK Logged in.\r\n"},
+		},
+	}
+	if !reflect.DeepEqual(result.Auth, expected) {
+		t.Errorf("got %+v", result.Auth)
+	}
+}
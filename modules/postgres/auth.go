@@ -0,0 +1,192 @@
+package postgres
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/zmap/zgrab2/lib/auth"
+	"github.com/zmap/zgrab2/lib/sasl"
+)
+
+// AuthResult is the outcome of the login attempts, in which the Mechanism is
+// the authentication method requested by the server (see decodeAuthMode), or
+// the SASL mechanism used, and the ErrorCode the SQLSTATE of the error
+// rejecting a credential.
+type AuthResult struct {
+	auth.Result
+
+	// Version is the result of SELECT version() after a successful login.
+	Version string `json:"version,omitempty"`
+
+	// Databases are the databases of pg_database, listed after a
+	// successful login.
+	Databases []string `json:"databases,omitempty"`
+
+	// QueryError is the error of the queries after a successful login, if
+	// any.
+	QueryError string `json:"query_error,omitempty"`
+}
+
+// md5Password returns the response to an AuthenticationMD5Password request:
+// "md5" + md5(md5(password + user) + salt), in hex.
+func md5Password(user, password string, salt []byte) string {
+	inner := md5.Sum([]byte(password + user))
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+// sendPassword sends a PasswordMessage (or a SASL response).
+func (c *Connection) sendPassword(body []byte) error {
+	return c.SendMessage('p', body)
+}
+
+// Authenticate answers the authentication requests of the server after a
+// StartupMessage for user, with password. Cleartext, MD5 and SCRAM-SHA-256
+// are supported. Afterwards, on success, the server's ParameterStatus
+// messages up to ReadyForQuery are read. It returns an error if the exchange
+// could not be completed.
+func (c *Connection) Authenticate(user, password string) (*auth.Attempt, error) {
+	ret := &auth.Attempt{Username: user}
+	var client sasl.Client
+	for i := 0; i < maxReadAllPackets; i++ {
+		packet, readErr := c.ReadPacket()
+		if readErr != nil {
+			return ret, readErr
+		}
+		switch packet.Type {
+		case 'E':
+			serverErr := *decodeError(packet.Body)
+			ret.ErrorCode, ret.ErrorMessage = serverErr["code"], serverErr["message"]
+			return ret, nil
+		case 'R':
+		default:
+			// e.g. a NoticeResponse
+			continue
+		}
+		if len(packet.Body) < 4 {
+			return ret, fmt.Errorf("authentication request too short: %s", packet.OutputValue())
+		}
+		mode := binary.BigEndian.Uint32(packet.Body[0:4])
+		data := packet.Body[4:]
+		if mode != 0 && mode < 11 {
+			ret.Mechanism = decodeAuthMode(packet.Body).Mode
+		}
+		var err error
+		switch mode {
+		case 0:
+			ret.Success = true
+			_, readErr := c.ReadAll()
+			if readErr != nil {
+				return ret, readErr
+			}
+			return ret, nil
+		case 3:
+			err = c.sendPassword(append([]byte(password), 0))
+		case 5:
+			if len(data) < 4 {
+				return ret, fmt.Errorf("MD5 salt too short: %s", packet.OutputValue())
+			}
+			err = c.sendPassword(append([]byte(md5Password(user, password, data[:4])), 0))
+		case 10:
+			// The mechanisms are a list of strings, ending with an empty one.
+			mechanisms := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+			for _, mechanism := range mechanisms {
+				if mechanism == sasl.ScramSHA256 {
+					ret.Mechanism = mechanism
+					// The user name of the StartupMessage is used.
+					client = sasl.NewScramClient(mechanism, "", password)
+				}
+			}
+			if client == nil {
+				return ret, fmt.Errorf("unsupported SASL mechanisms %q", mechanisms)
+			}
+			var response []byte
+			if response, err = client.Next(nil); err != nil {
+				return ret, err
+			}
+			body := make([]byte, len(ret.Mechanism)+5)
+			copy(body, ret.Mechanism)
+			binary.BigEndian.PutUint32(body[len(ret.Mechanism)+1:], uint32(len(response)))
+			err = c.sendPassword(append(body, response...))
+		case 11, 12:
+			if client == nil {
+				return ret, fmt.Errorf("unexpected SASL message: %s", packet.OutputValue())
+			}
+			var response []byte
+			if response, err = client.Next(data); err != nil {
+				return ret, err
+			}
+			if mode == 11 {
+				err = c.sendPassword(response)
+			}
+		default:
+			return ret, fmt.Errorf("unsupported authentication method %s", decodeAuthMode(packet.Body).Mode)
+		}
+		if err != nil {
+			return ret, err
+		}
+	}
+	return ret, fmt.Errorf("too many packets during authentication")
+}
+
+// Query sends a simple Query message, after a successful Authenticate(), and
+// returns (at most maxRows of) the rows of the result, with NULL values as
+// empty strings.
+func (c *Connection) Query(query string, maxRows int) ([][]string, error) {
+	if err := c.SendMessage('Q', append([]byte(query), 0)); err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	var err error
+	for {
+		packet, readErr := c.ReadPacket()
+		if readErr != nil {
+			return rows, readErr
+		}
+		switch packet.Type {
+		case 'Z':
+			return rows, err
+		case 'E':
+			err = fmt.Errorf("%s", (*decodeError(packet.Body))["message"])
+		case 'D':
+			if len(rows) >= maxRows {
+				continue
+			}
+			row, decodeErr := decodeDataRow(packet.Body)
+			if decodeErr != nil {
+				return rows, decodeErr
+			}
+			rows = append(rows, row)
+		}
+	}
+}
+
+// decodeDataRow decodes the values of a DataRow message.
+func decodeDataRow(body []byte) ([]string, error) {
+	if len(body) < 2 {
+		return nil, fmt.Errorf("DataRow too short")
+	}
+	n := int(binary.BigEndian.Uint16(body[0:2]))
+	rest := body[2:]
+	row := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if len(rest) < 4 {
+			return nil, fmt.Errorf("DataRow too short")
+		}
+		length := int32(binary.BigEndian.Uint32(rest[0:4]))
+		rest = rest[4:]
+		if length < 0 {
+			row = append(row, "")
+			continue
+		}
+		if int(length) > len(rest) {
+			return nil, fmt.Errorf("DataRow value too long")
+		}
+		row = append(row, string(rest[:length]))
+		rest = rest[length:]
+	}
+	return row, nil
+}
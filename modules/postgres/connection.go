@@ -95,6 +95,17 @@ func (c *Connection) Send(body []byte) error {
 	return err
 }
 
+// SendMessage sends a typed client message: the type, followed by a
+// big-endian uint32 length and the body.
+func (c *Connection) SendMessage(msgType byte, body []byte) error {
+	toSend := make([]byte, len(body)+5)
+	toSend[0] = msgType
+	copy(toSend[5:], body)
+	binary.BigEndian.PutUint32(toSend[1:], uint32(len(body)+4))
+	_, err := c.Connection.Write(toSend)
+	return err
+}
+
 // SendU32 sends an uint32 packet to the server.
 func (c *Connection) SendU32(val uint32) error {
 	toSend := make([]byte, 8)
@@ -7,9 +7,13 @@
 // may allow additional data, such as detailed server parameters, to be
 // collected. Absent these, version information must be inferred from
 // the values in the results (e.g. line numbers in error strings).
+// If --creds-file is set, the credentials of the target are then attempted,
+// each on a new connection, and on success the server version and databases
+// are queried.
 package postgres
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"net"
@@ -19,6 +23,7 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/auth"
 )
 
 const (
@@ -77,6 +82,9 @@ type Results struct {
 	// TransactionStatus is the value of the 'Z'-type packet returned by
 	// the server after the final StartupMessage.
 	TransactionStatus string `json:"transaction_status,omitempty"`
+
+	// Auth is the outcome of the login attempts, if --creds-file is set.
+	Auth *AuthResult `json:"auth,omitempty"`
 }
 
 // PostgresError is parsed the payload of an 'E'-type packet, mapping
@@ -124,11 +132,13 @@ type Flags struct {
 	User            string `long:"user" description:"Username to pass to StartupMessage. If omitted, no user will be sent." default:""`
 	Database        string `long:"database" description:"Database to pass to StartupMessage. If omitted, none will be sent." default:""`
 	ApplicationName string `long:"application-name" description:"application_name value to pass in StartupMessage. If omitted, none will be sent." default:""`
+	CredsFile       string `long:"creds-file" description:"File of credentials (host username:password... per line, as for the http module) to attempt, with the --database (or postgres); on success, the server version and databases are queried"`
 }
 
 // Scanner is the zgrab2 scanner type for the postgres protocol
 type Scanner struct {
 	Config *Flags
+	creds  *auth.Credentials
 }
 
 // Module is the zgrab2 module for the postgres protocol
@@ -280,6 +290,11 @@ func (m *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (m *Module) NewResults() interface{} {
+	return new(Results)
+}
+
 // Description returns an overview of this module.
 func (m *Module) Description() string {
 	return "Perform a handshake with a PostgreSQL server"
@@ -287,7 +302,8 @@ func (m *Module) Description() string {
 
 // Validate checks the arguments; on success, returns nil.
 func (f *Flags) Validate(args []string) error {
-	return nil
+	// TLS is negotiated after an SSLRequest.
+	return f.TLSFlags.CheckRedial("the postgres module")
 }
 
 // Help returns the module's help string.
@@ -302,6 +318,13 @@ func (s *Scanner) Init(flags zgrab2.ScanFlags) error {
 	if f.Verbose {
 		log.SetLevel(log.DebugLevel)
 	}
+	if f.CredsFile != "" {
+		creds, err := auth.ReadFile(f.CredsFile)
+		if err != nil {
+			return err
+		}
+		s.creds = creds
+	}
 	return nil
 }
 
@@ -341,11 +364,11 @@ func (s *Scanner) DoSSL(sql *Connection) error {
 }
 
 // newConnection opens up a new connection to the ScanTarget, and if necessary, attempts to update the connection to SSL
-func (s *Scanner) newConnection(t *zgrab2.ScanTarget, mgr *connectionManager, nossl bool) (*Connection, *zgrab2.ScanError) {
+func (s *Scanner) newConnection(ctx context.Context, t *zgrab2.ScanTarget, mgr *connectionManager, nossl bool) (*Connection, *zgrab2.ScanError) {
 	var conn net.Conn
 	var err error
 	// Open a managed connection to the ScanTarget, register it for automatic cleanup
-	if conn, err = t.Open(&s.Config.BaseFlags); err != nil {
+	if conn, err = t.Open(ctx, &s.Config.BaseFlags); err != nil {
 		return nil, zgrab2.DetectScanError(err)
 	}
 	mgr.addConnection(conn)
@@ -374,6 +397,74 @@ func (s *Scanner) getDefaultKVPs() map[string]string {
 	}
 }
 
+// authenticate attempts each credential in turn, on a new connection, until
+// one is accepted, then queries the server version and databases.
+func (s *Scanner) authenticate(ctx context.Context, t *zgrab2.ScanTarget, mgr *connectionManager, creds []*auth.Credential) *AuthResult {
+	result := new(AuthResult)
+	database := s.Config.Database
+	if database == "" {
+		database = "postgres"
+	}
+	for _, cred := range creds {
+		if cred.Token != "" {
+			continue
+		}
+		sql, connectErr := s.newConnection(ctx, t, mgr, false)
+		if connectErr != nil {
+			result.Attempts = append(result.Attempts, auth.Attempt{Username: cred.Username, Error: connectErr.Error()})
+			return result
+		}
+		kvps := s.getDefaultKVPs()
+		kvps["user"] = cred.Username
+		kvps["database"] = database
+		if s.Config.ApplicationName != "" {
+			kvps["application_name"] = s.Config.ApplicationName
+		}
+		err := sql.SendStartupMessage(s.Config.ProtocolVersion, kvps)
+		attempt := &auth.Attempt{Username: cred.Username}
+		if err == nil {
+			attempt, err = sql.Authenticate(cred.Username, cred.Password)
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		result.Attempts = append(result.Attempts, *attempt)
+		if err != nil {
+			mgr.closeConnection(sql)
+			return result
+		}
+		if attempt.Success {
+			result.Success = true
+			s.query(sql, result)
+			mgr.closeConnection(sql)
+			return result
+		}
+		mgr.closeConnection(sql)
+	}
+	return result
+}
+
+// query fills in the server version and databases of result, after a
+// successful login.
+func (s *Scanner) query(sql *Connection, result *AuthResult) {
+	rows, err := sql.Query("SELECT version()", 1)
+	if err != nil {
+		result.QueryError = err.Error()
+		return
+	}
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		result.Version = rows[0][0]
+	}
+	if rows, err = sql.Query("SELECT datname FROM pg_database", auth.MaxDatabases); err != nil {
+		result.QueryError = err.Error()
+	}
+	for _, row := range rows {
+		if len(row) > 0 {
+			result.Databases = append(result.Databases, row[0])
+		}
+	}
+}
+
 // Scan does the actual scanning. It opens up to four connections:
 // 1. Sends a bogus protocol version in hopes of getting a list of
 //    supported protcols back. Results here are supported_versions and
@@ -389,10 +480,12 @@ func (s *Scanner) getDefaultKVPs() map[string]string {
 //    any/all of user/database/application-name. This is where it gets
 //    backend_key_data, server_parameters, authentication_mode,
 //    transaction_status and user_startup_error.
+// Then, if --creds-file is set, it attempts each credential of the target on
+// a new connection, until one is accepted (see authenticate).
 //
 // * NOTE: TLS is only used for the first connection, and then only if
 //   both client and server support it.
-func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result interface{}, thrown error) {
+func (s *Scanner) Scan(ctx context.Context, t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result interface{}, thrown error) {
 	var results Results
 
 	mgr := newConnectionManager()
@@ -401,7 +494,7 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 	// Send too-low protocol version (0.0) StartupMessage to get a simple supported-protocols error string
 	// Also do TLS handshake, if configured / supported
 	{
-		sql, connectErr := s.newConnection(&t, mgr, false)
+		sql, connectErr := s.newConnection(ctx, &t, mgr, false)
 		if connectErr != nil {
 			return connectErr.Unpack(nil)
 		}
@@ -441,7 +534,7 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 
 	// Send too-high protocol version (255.255) StartupMessage to get full error message (including line numbers, useful for probing server version)
 	{
-		sql, connectErr := s.newConnection(&t, mgr, true)
+		sql, connectErr := s.newConnection(ctx, &t, mgr, true)
 		if connectErr != nil {
 			return connectErr.Unpack(&results)
 		}
@@ -475,7 +568,7 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 		var err error
 		var response *ServerPacket
 		var readErr *zgrab2.ScanError
-		sql, connectErr := s.newConnection(&t, mgr, true)
+		sql, connectErr := s.newConnection(ctx, &t, mgr, true)
 		if connectErr != nil {
 			return connectErr.Unpack(&results)
 		}
@@ -504,7 +597,7 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 
 	// If user / database / application_name are provided, do a final scan with those
 	if s.Config.User != "" || s.Config.Database != "" || s.Config.ApplicationName != "" {
-		sql, connectErr := s.newConnection(&t, mgr, false)
+		sql, connectErr := s.newConnection(ctx, &t, mgr, false)
 		if connectErr != nil {
 			return connectErr.Unpack(&results)
 		}
@@ -532,6 +625,10 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 			return err.Unpack(&results)
 		}
 	}
+
+	if creds := s.creds.For(&t, s.Config.Port); len(creds) > 0 {
+		results.Auth = s.authenticate(ctx, &t, mgr, creds)
+	}
 	return zgrab2.SCAN_SUCCESS, &results, thrown
 }
 
@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/auth"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// writeMessage writes a server message.
+func writeMessage(w io.Writer, msgType byte, body []byte) {
+	header := make([]byte, 5)
+	header[0] = msgType
+	binary.BigEndian.PutUint32(header[1:], uint32(len(body)+4))
+	w.Write(append(header, body...))
+}
+
+// readBody reads a length-prefixed body.
+func readBody(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(length[:])-4)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+// readMessage reads a typed client message.
+func readMessage(r io.Reader) (byte, []byte, error) {
+	var msgType [1]byte
+	if _, err := io.ReadFull(r, msgType[:]); err != nil {
+		return 0, nil, err
+	}
+	body, err := readBody(r)
+	return msgType[0], body, err
+}
+
+// dataRow encodes a DataRow with a single value.
+func dataRow(value string) []byte {
+	ret := []byte{0, 1, 0, 0, 0, byte(len(value))}
+	return append(ret, value...)
+}
+
+// handle serves a connection, accepting the password secret for postgres
+// with MD5 authentication.
+func handle(conn net.Conn) {
+	startup, err := readBody(conn)
+	if err != nil || len(startup) < 4 {
+		return
+	}
+	params := bytes.Split(startup[4:], []byte{0})
+	user := ""
+	for i := 0; i+1 < len(params); i += 2 {
+		if string(params[i]) == "user" {
+			user = string(params[i+1])
+		}
+	}
+	if !bytes.Equal(startup[0:4], []byte{0, 3, 0, 0}) || user == "" {
+		writeMessage(conn, 'E', []byte("SFATAL\x00C28000\x00Mno PostgreSQL user name specified in startup packet\x00\x00"))
+		return
+	}
+	salt := []byte{1, 2, 3, 4}
+	writeMessage(conn, 'R', append([]byte{0, 0, 0, 5}, salt...))
+	msgType, body, err := readMessage(conn)
+	if err != nil || msgType != 'p' {
+		return
+	}
+	if user != "postgres" || string(body) != md5Password("postgres", "secret", salt)+"\x00" {
+		writeMessage(conn, 'E', []byte("SFATAL\x00C28P01\x00Mpassword authentication failed for user \""+user+"\"\x00\x00"))
+		return
+	}
+	writeMessage(conn, 'R', []byte{0, 0, 0, 0})
+	writeMessage(conn, 'S', []byte("server_version\x0012.0\x00"))
+	writeMessage(conn, 'Z', []byte("I"))
+	for {
+		msgType, body, err := readMessage(conn)
+		if err != nil || msgType != 'Q' {
+			return
+		}
+		writeMessage(conn, 'T', []byte{0, 1, 'x', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 25, 255, 255, 255, 255, 255, 255, 0, 0})
+		switch string(body) {
+		case "SELECT version()\x00":
+			writeMessage(conn, 'D', dataRow("PostgreSQL 12.0"))
+		case "SELECT datname FROM pg_database\x00":
+			writeMessage(conn, 'D', dataRow("postgres"))
+			writeMessage(conn, 'D', dataRow("template1"))
+		}
+		writeMessage(conn, 'C', []byte("SELECT 1\x00"))
+		writeMessage(conn, 'Z', []byte("I"))
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		handle(conn)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	credsFile, err := ioutil.TempFile("", "creds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(credsFile.Name())
+	credsFile.WriteString("127.0.0.1 postgres:wrong postgres:secret\n")
+	credsFile.Close()
+
+	flags := &Flags{
+		SkipSSL:         true,
+		ProtocolVersion: "3.0",
+		CredsFile:       credsFile.Name(),
+	}
+	authResult := zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*Results).Auth
+	if authResult == nil || len(authResult.Attempts) != 2 {
+		t.Fatalf("got auth %+v", authResult)
+	}
+	first := authResult.Attempts[0]
+	if first.Success || first.Mechanism != "password_md5" || first.ErrorCode != "28P01" {
+		t.Errorf("got first attempt %+v", first)
+	}
+	expected := &AuthResult{
+		Result: auth.Result{
+			Attempts: []auth.Attempt{first, {Username: "postgres", Mechanism: "password_md5", Success: true}},
+			Success:  true,
+		},
+		Version:   "PostgreSQL 12.0",
+		Databases: []string{"postgres", "template1"},
+	}
+	if !reflect.DeepEqual(authResult, expected) {
+		t.Errorf("got auth %+v", authResult)
+	}
+}
@@ -0,0 +1,472 @@
+package probe
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultRarity is the rarity of probes that do not give one.
+const defaultRarity = 5
+
+// Probe is a payload sent to the service, with the signatures its response
+// is matched against.
+type Probe struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Payload is sent once connected; the NULL probe has none, and waits for
+	// a banner.
+	Payload string `json:"payload,omitempty" yaml:"payload,omitempty"`
+
+	// Ports, if set, are the ports the probe is most likely to get an
+	// answer on, as a list of ports and ranges ("21,80-90"). They are tried
+	// first.
+	Ports string `json:"ports,omitempty" yaml:"ports,omitempty"`
+
+	// Rarity, from 1 to 9, is how unlikely the probe is to get an answer.
+	Rarity int `json:"rarity,omitempty" yaml:"rarity,omitempty"`
+
+	// WaitMS is how long to wait for the response, in milliseconds.
+	WaitMS int `json:"wait_ms,omitempty" yaml:"wait_ms,omitempty"`
+
+	// Fallback names the probes whose signatures are also matched against
+	// the response.
+	Fallback []string `json:"fallback,omitempty" yaml:"fallback,omitempty"`
+
+	Matches []*Match `json:"matches" yaml:"matches"`
+
+	payload  []byte
+	ports    []portRange
+	fallback []*Probe
+}
+
+// Match is a signature identifying a service from a response.
+type Match struct {
+	Service string `json:"service" yaml:"service"`
+
+	// Pattern is a regular expression over the bytes of the response, each
+	// byte standing for the character of the same code (so \xff matches the
+	// byte 0xff). Flags may hold i (case-insensitive) and s (. matches
+	// newlines).
+	Pattern string `json:"pattern" yaml:"pattern"`
+	Flags   string `json:"flags,omitempty" yaml:"flags,omitempty"`
+
+	// Soft matches identify the service but not its version: probing
+	// continues in search of a match that does.
+	Soft bool `json:"soft,omitempty" yaml:"soft,omitempty"`
+
+	// Version information, in which $1 to $9 are replaced by the submatches
+	// of the pattern.
+	Product    string   `json:"product,omitempty" yaml:"product,omitempty"`
+	Version    string   `json:"version,omitempty" yaml:"version,omitempty"`
+	Info       string   `json:"info,omitempty" yaml:"info,omitempty"`
+	Hostname   string   `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	OS         string   `json:"os,omitempty" yaml:"os,omitempty"`
+	DeviceType string   `json:"device_type,omitempty" yaml:"device_type,omitempty"`
+	CPE        []string `json:"cpe,omitempty" yaml:"cpe,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// portRange is an inclusive range of ports.
+type portRange struct {
+	from, to uint
+}
+
+// Load reads the probes file at path: a list of probes in YAML, or JSON with
+// a .json extension, or otherwise an nmap-service-probes file.
+func Load(path string) ([]*Probe, error) {
+	var probes []*Probe
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		var data []byte
+		if data, err = ioutil.ReadFile(path); err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			err = json.Unmarshal(data, &probes)
+		} else {
+			err = yaml.Unmarshal(data, &probes)
+		}
+		if err == nil {
+			for _, p := range probes {
+				if p.payload, err = unescape(p.Payload); err != nil {
+					err = fmt.Errorf("probe %s: %s", p.Name, err)
+					break
+				}
+			}
+		}
+	default:
+		var f *os.File
+		if f, err = os.Open(path); err != nil {
+			return nil, err
+		}
+		probes, err = parseNmap(f)
+		f.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	if err := compile(probes); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return probes, nil
+}
+
+// parseNmap parses the TCP probes of an nmap-service-probes file. UDP probes,
+// and the Exclude and sslports directives, are ignored.
+func parseNmap(r io.Reader) ([]*Probe, error) {
+	var probes []*Probe
+	var cur *Probe
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		directive, rest := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			directive, rest = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		if directive == "Probe" {
+			p, err := parseNmapProbe(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			cur = p
+			if p != nil {
+				probes = append(probes, p)
+			}
+			continue
+		}
+		if cur == nil {
+			// Directives of UDP probes, or before the first probe.
+			continue
+		}
+		var err error
+		switch directive {
+		case "match", "softmatch":
+			var m *Match
+			if m, err = parseNmapMatch(rest); err == nil {
+				m.Soft = directive == "softmatch"
+				cur.Matches = append(cur.Matches, m)
+			}
+		case "ports":
+			cur.Ports = rest
+		case "rarity":
+			cur.Rarity, err = strconv.Atoi(rest)
+		case "totalwaitms":
+			cur.WaitMS, err = strconv.Atoi(rest)
+		case "fallback":
+			cur.Fallback = strings.Split(rest, ",")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return probes, nil
+}
+
+// parseNmapProbe parses the arguments of a Probe directive, "TCP name q|..|",
+// and returns nil for UDP probes.
+func parseNmapProbe(s string) (*Probe, error) {
+	fields := strings.SplitN(s, " ", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid probe %q", s)
+	}
+	if fields[0] != "TCP" {
+		return nil, nil
+	}
+	payload, rest, err := delimited(fields[2], "q")
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %s", fields[1], err)
+	}
+	if rest = strings.TrimSpace(rest); rest != "" && rest != "no-payload" {
+		return nil, fmt.Errorf("probe %s: unexpected %q", fields[1], rest)
+	}
+	p := &Probe{Name: fields[1], Payload: payload}
+	if p.payload, err = unescape(payload); err != nil {
+		return nil, fmt.Errorf("probe %s: %s", p.Name, err)
+	}
+	return p, nil
+}
+
+// parseNmapMatch parses the arguments of a match or softmatch directive:
+// "service m|pattern|flags" followed by the version information fields.
+func parseNmapMatch(s string) (*Match, error) {
+	i := strings.IndexByte(s, ' ')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid match %q", s)
+	}
+	m := &Match{Service: s[:i]}
+	pattern, rest, err := delimited(strings.TrimSpace(s[i+1:]), "m")
+	if err != nil {
+		return nil, fmt.Errorf("match %s: %s", m.Service, err)
+	}
+	m.Pattern = pattern
+	for len(rest) > 0 && rest[0] != ' ' {
+		m.Flags += rest[:1]
+		rest = rest[1:]
+	}
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		var field, value string
+		if strings.HasPrefix(rest, "cpe:") {
+			field = "cpe:"
+		} else {
+			field = rest[:1]
+		}
+		if value, rest, err = delimited(rest, field); err != nil {
+			return nil, fmt.Errorf("match %s: %s", m.Service, err)
+		}
+		// Skip the flags following the field (the a of cpe:/../a).
+		if i := strings.IndexByte(rest, ' '); i >= 0 {
+			rest = rest[i:]
+		} else {
+			rest = ""
+		}
+		switch field {
+		case "p":
+			m.Product = value
+		case "v":
+			m.Version = value
+		case "i":
+			m.Info = value
+		case "h":
+			m.Hostname = value
+		case "o":
+			m.OS = value
+		case "d":
+			m.DeviceType = value
+		case "cpe:":
+			m.CPE = append(m.CPE, "cpe:/"+value)
+		}
+	}
+	return m, nil
+}
+
+// delimited parses a value of the form <prefix><delimiter>value<delimiter>,
+// where the delimiter is any character, and returns the value and what
+// follows it.
+func delimited(s, prefix string) (string, string, error) {
+	if !strings.HasPrefix(s, prefix) || len(s) < len(prefix)+2 {
+		return "", "", fmt.Errorf("expected %s followed by a delimited value in %q", prefix, s)
+	}
+	s = s[len(prefix):]
+	end := strings.IndexByte(s[1:], s[0])
+	if end < 0 {
+		return "", "", fmt.Errorf("unterminated value in %q", s)
+	}
+	return s[1 : end+1], s[end+2:], nil
+}
+
+// unescape decodes the escapes of a probe payload: \\, \0, \a, \b, \f, \n,
+// \r, \t, \v and \xHH.
+func unescape(s string) ([]byte, error) {
+	ret := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			ret = append(ret, s[i])
+			continue
+		}
+		if i++; i == len(s) {
+			return nil, fmt.Errorf("trailing backslash in %q", s)
+		}
+		switch c := s[i]; c {
+		case '0':
+			ret = append(ret, 0)
+		case 'a':
+			ret = append(ret, '\a')
+		case 'b':
+			ret = append(ret, '\b')
+		case 'f':
+			ret = append(ret, '\f')
+		case 'n':
+			ret = append(ret, '\n')
+		case 'r':
+			ret = append(ret, '\r')
+		case 't':
+			ret = append(ret, '\t')
+		case 'v':
+			ret = append(ret, '\v')
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, fmt.Errorf("truncated \\x escape in %q", s)
+			}
+			b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid \\x escape in %q", s)
+			}
+			ret = append(ret, byte(b))
+			i += 2
+		default:
+			ret = append(ret, c)
+		}
+	}
+	return ret, nil
+}
+
+// compile parses the ports, resolves the fallbacks, and compiles the patterns
+// of probes. Signatures whose patterns use Perl features that Go regular
+// expressions lack (such as backreferences) are dropped.
+func compile(probes []*Probe) error {
+	byName := make(map[string]*Probe, len(probes))
+	for _, p := range probes {
+		if p.Name == "" {
+			return fmt.Errorf("probe without a name")
+		}
+		byName[p.Name] = p
+	}
+	dropped := 0
+	for _, p := range probes {
+		if p.Rarity == 0 {
+			p.Rarity = defaultRarity
+		}
+		var err error
+		if p.ports, err = parsePorts(p.Ports); err != nil {
+			return fmt.Errorf("probe %s: %s", p.Name, err)
+		}
+		for _, name := range p.Fallback {
+			fallback, ok := byName[strings.TrimSpace(name)]
+			if !ok {
+				return fmt.Errorf("probe %s: unknown fallback %s", p.Name, name)
+			}
+			p.fallback = append(p.fallback, fallback)
+		}
+		matches := p.Matches[:0]
+		for _, m := range p.Matches {
+			if m.re, err = compilePattern(m.Pattern, m.Flags); err != nil {
+				dropped++
+				log.Debugf("probe %s: dropping signature of %s: %s", p.Name, m.Service, err)
+				continue
+			}
+			matches = append(matches, m)
+		}
+		p.Matches = matches
+	}
+	if dropped > 0 {
+		log.Infof("dropped %d signatures with unsupported patterns", dropped)
+	}
+	return nil
+}
+
+// compilePattern compiles a pattern to match against responses decoded by
+// latin1.
+func compilePattern(pattern, flags string) (*regexp.Regexp, error) {
+	prefix := ""
+	for _, f := range flags {
+		switch f {
+		case 'i', 's':
+			prefix += string(f)
+		}
+	}
+	if prefix != "" {
+		prefix = "(?" + prefix + ")"
+	}
+	// Non-ASCII bytes of the pattern stand for themselves, like those of
+	// the responses.
+	return regexp.Compile(prefix + latin1([]byte(pattern)))
+}
+
+// latin1 returns the string with a character for each byte of b, of the same
+// code.
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// parsePorts parses a comma-separated list of ports and port ranges.
+func parsePorts(s string) ([]portRange, error) {
+	var ret []portRange
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := strconv.ParseUint(bounds[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", part)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.ParseUint(bounds[1], 10, 16); err != nil || to < from {
+				return nil, fmt.Errorf("invalid port range %q", part)
+			}
+		}
+		ret = append(ret, portRange{uint(from), uint(to)})
+	}
+	return ret, nil
+}
+
+// hasPort returns true if port is among the probe's ports.
+func (p *Probe) hasPort(port uint) bool {
+	for _, r := range p.ports {
+		if port >= r.from && port <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// match matches response against the signatures of the probe, then against
+// those of its fallbacks, and returns the first hard match, or if there is
+// none the first soft match, with the submatches of its pattern.
+func (p *Probe) match(response []byte) (*Match, []string) {
+	text := latin1(response)
+	var soft *Match
+	var softGroups []string
+	for _, probe := range append([]*Probe{p}, p.fallback...) {
+		for _, m := range probe.Matches {
+			groups := m.re.FindStringSubmatch(text)
+			if groups == nil {
+				continue
+			}
+			if !m.Soft {
+				return m, groups
+			}
+			if soft == nil {
+				soft, softGroups = m, groups
+			}
+		}
+	}
+	return soft, softGroups
+}
+
+// substitute replaces $1 to $9 in s by the submatches of the pattern, decoded
+// back to bytes.
+func substitute(s string, groups []string) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+	var ret strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '$' && i+1 < len(s) && s[i+1] >= '1' && s[i+1] <= '9' {
+			if n := int(s[i+1] - '0'); n < len(groups) {
+				for _, r := range groups[n] {
+					ret.WriteByte(byte(r))
+				}
+			}
+			i++
+			continue
+		}
+		ret.WriteByte(s[i])
+	}
+	return ret.String()
+}
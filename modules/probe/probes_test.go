@@ -0,0 +1,147 @@
+package probe
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testNmapProbes = `# Test probes
+Exclude T:9100-9107
+
+Probe TCP NULL q||
+totalwaitms 6000
+match ftp m/^220 ProFTPD (\d[-.\w]+) Server/ p/ProFTPD/ v/$1/ cpe:/a:proftpd:proftpd:$1/a
+match ssh m|^SSH-([\d.]+)-OpenSSH_([\w._-]+)\r?\n| p/OpenSSH/ v/$2/ i/protocol $1/
+softmatch ftp m/^220 [-.\w ]+ftp/i
+match backref m/^(a)\1/
+
+Probe UDP DNSStatusRequest q|\0\0\x10\0\0\0\0\0\0\0\0\0|
+match dns m|^\0\0\x90|
+
+Probe TCP GenericLines q|\r\n\r\n|
+rarity 1
+ports 21,23,80-90
+match binary m|^\x00\xff(\w+)| p/Binary $1/
+`
+
+func parseTestProbes(t *testing.T) []*Probe {
+	probes, err := parseNmap(strings.NewReader(testNmapProbes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compile(probes); err != nil {
+		t.Fatal(err)
+	}
+	return probes
+}
+
+func TestParseNmap(t *testing.T) {
+	probes := parseTestProbes(t)
+	if len(probes) != 2 {
+		t.Fatalf("got %d probes; expected the 2 TCP ones", len(probes))
+	}
+	null, generic := probes[0], probes[1]
+	if null.Name != "NULL" || len(null.payload) != 0 || null.WaitMS != 6000 || null.Rarity != defaultRarity {
+		t.Errorf("unexpected NULL probe %+v", null)
+	}
+	// The signature with a backreference is dropped.
+	if len(null.Matches) != 3 || !null.Matches[2].Soft {
+		t.Errorf("unexpected NULL signatures %+v", null.Matches)
+	}
+	if string(generic.payload) != "\r\n\r\n" || generic.Rarity != 1 {
+		t.Errorf("unexpected GenericLines probe %+v", generic)
+	}
+	if !generic.hasPort(85) || generic.hasPort(22) {
+		t.Errorf("unexpected ports %v", generic.ports)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	probes := parseTestProbes(t)
+	tests := []struct {
+		probe    int
+		response string
+		service  string
+		soft     bool
+		version  string
+	}{
+		{0, "220 ProFTPD 1.3.5e Server (Debian)\r\n", "ftp", false, "1.3.5e"},
+		{0, "SSH-2.0-OpenSSH_8.2p1\r\n", "ssh", false, "8.2p1"},
+		{0, "220 Example FTP server\r\n", "ftp", true, ""},
+		{0, "HTTP/1.1 400 Bad Request\r\n", "", false, ""},
+		{1, "\x00\xffabc", "binary", false, ""},
+	}
+	for _, test := range tests {
+		m, groups := probes[test.probe].match([]byte(test.response))
+		if test.service == "" {
+			if m != nil {
+				t.Errorf("%q matched %s", test.response, m.Service)
+			}
+			continue
+		}
+		if m == nil || m.Service != test.service || m.Soft != test.soft {
+			t.Errorf("%q: got %+v; expected %s", test.response, m, test.service)
+			continue
+		}
+		if v := substitute(m.Version, groups); v != test.version {
+			t.Errorf("%q: got version %q; expected %q", test.response, v, test.version)
+		}
+	}
+
+	var results Results
+	response := []byte("220 ProFTPD 1.3.5e Server (Debian)\r\n")
+	m, groups := probes[0].match(response)
+	results.set("NULL", m, groups, response)
+	if !reflect.DeepEqual(results.CPE, []string{"cpe:/a:proftpd:proftpd:1.3.5e"}) || results.Product != "ProFTPD" {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zgrab2-probes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "probes.yaml")
+	data := `
+- name: Hello
+  payload: 'HELLO\r\n'
+  ports: "7000"
+  matches:
+    - service: hello
+      pattern: '^HI ([\d.]+)'
+      version: $1
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	probes, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(probes) != 1 || string(probes[0].payload) != "HELLO\r\n" || !probes[0].hasPort(7000) {
+		t.Fatalf("unexpected probes %+v", probes)
+	}
+	m, groups := probes[0].match([]byte("HI 1.2\n"))
+	if m == nil || substitute(m.Version, groups) != "1.2" {
+		t.Errorf("unexpected match %+v", m)
+	}
+}
+
+func TestProbesFor(t *testing.T) {
+	probes := parseTestProbes(t)
+	scanner := &Scanner{config: &Flags{Intensity: 7}, probes: []*Probe{probes[1], probes[0]}}
+	order := scanner.probesFor(80)
+	if len(order) != 2 || order[0].Name != "NULL" || order[1].Name != "GenericLines" {
+		t.Errorf("unexpected order %v", order)
+	}
+	scanner.config.Intensity = 0
+	if order := scanner.probesFor(80); len(order) != 1 || order[0].Name != "NULL" {
+		t.Errorf("unexpected probes at intensity 0: %v", order)
+	}
+}
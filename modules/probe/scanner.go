@@ -0,0 +1,275 @@
+// Package probe provides a zgrab2 module that identifies services with the
+// probes and signatures of an nmap-service-probes file (or of a simpler YAML
+// or JSON equivalent), covering the many TCP services that have no dedicated
+// module.
+//
+// Each probe is sent on a new connection, in the order nmap uses: the NULL
+// probe (which only waits for a banner) first, then the probes listing the
+// target port, then the others, skipping those rarer than --intensity. The
+// response is matched against the signatures of the probe and of its
+// fallbacks, and the scan stops at the first hard match. A soft match is
+// reported if no hard match is found.
+package probe
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// Flags holds the command-line configuration for the probe module.
+type Flags struct {
+	zgrab2.BaseFlags
+	ProbesFile      string        `long:"probes-file" default:"/usr/share/nmap/nmap-service-probes" description:"nmap-service-probes file, or YAML or JSON list of probes (by extension), to load."`
+	Intensity       int           `long:"intensity" default:"7" description:"Only send the probes with a rarity up to this value, from 1 to 9."`
+	MaxProbes       int           `long:"max-probes" description:"Maximum number of probes to send to each target (0 for no limit)."`
+	MaxWait         time.Duration `long:"max-wait" default:"3s" description:"Maximum time to wait for the response to a probe, whatever its own wait time."`
+	MaxResponseSize int           `long:"max-response-size" default:"8192" description:"Maximum number of bytes of each probe response to read."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+	probes []*Probe
+}
+
+// Results is the output of the probe module.
+type Results struct {
+	// Service is the service named by the matching signature.
+	Service string `json:"service,omitempty"`
+
+	// Probe is the name of the probe whose response matched.
+	Probe string `json:"probe,omitempty"`
+
+	// SoftMatch is true if only a soft signature, which does not give the
+	// version, matched.
+	SoftMatch bool `json:"soft_match,omitempty"`
+
+	// Pattern is the pattern of the matching signature.
+	Pattern string `json:"pattern,omitempty"`
+
+	Product    string   `json:"product,omitempty"`
+	Version    string   `json:"version,omitempty"`
+	Info       string   `json:"info,omitempty"`
+	Hostname   string   `json:"hostname,omitempty"`
+	OS         string   `json:"os,omitempty"`
+	DeviceType string   `json:"device_type,omitempty"`
+	CPE        []string `json:"cpe,omitempty"`
+
+	// Response is the response that matched, or if none did, the first
+	// non-empty response.
+	Response []byte `json:"response,omitempty"`
+
+	// ProbesSent is the number of probes sent.
+	ProbesSent int `json:"probes_sent"`
+}
+
+// ErrNoMatch is returned when no signature matched any response.
+var ErrNoMatch = errors.New("no signature matched")
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("probe", "Service probes", module.Description(), 0, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Identify the service and version on a port with nmap service probes and signatures"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if flags.Port == 0 {
+		return zgrab2.ErrInvalidArguments
+	}
+	if flags.Intensity < 0 || flags.Intensity > 9 || flags.MaxProbes < 0 || flags.MaxResponseSize <= 0 {
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner, loading the probes.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	probes, err := Load(f.ProbesFile)
+	if err != nil {
+		return err
+	}
+	scanner.probes = probes
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "probe"
+}
+
+// probesFor returns the probes to send to port, in order.
+func (scanner *Scanner) probesFor(port uint) []*Probe {
+	var ret []*Probe
+	for _, p := range scanner.probes {
+		if p.Rarity <= scanner.config.Intensity || len(p.payload) == 0 {
+			ret = append(ret, p)
+		}
+	}
+	// The NULL probe goes first, then those listing the port.
+	rank := func(p *Probe) int {
+		switch {
+		case len(p.payload) == 0:
+			return 0
+		case p.hasPort(port):
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return rank(ret[i]) < rank(ret[j]) })
+	if max := scanner.config.MaxProbes; max > 0 && len(ret) > max {
+		ret = ret[:max]
+	}
+	return ret
+}
+
+// runProbe sends the payload of p (if any) on a new connection, and returns
+// what the server sent back. Read errors are not reported, since timeouts and
+// closed connections are expected answers to a wrong probe.
+func (scanner *Scanner) runProbe(ctx context.Context, target *zgrab2.ScanTarget, p *Probe) ([]byte, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if len(p.payload) > 0 {
+		if _, err := conn.Write(p.payload); err != nil {
+			return nil, nil
+		}
+	}
+	wait := scanner.config.MaxWait
+	if w := time.Duration(p.WaitMS) * time.Millisecond; w > 0 && w < wait {
+		wait = w
+	}
+	conn.SetReadDeadline(time.Now().Add(wait))
+	size := scanner.config.MaxResponseSize
+	response, _ := zgrab2.ReadAvailableWithOptions(conn, size, 100*time.Millisecond, wait, size)
+	return response, nil
+}
+
+// Scan sends the probes in turn until a response matches a signature. If the
+// first connection fails, the port is considered closed and the error is
+// returned.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	port := scanner.config.Port
+	if target.Port != nil {
+		port = *target.Port
+	}
+	results := new(Results)
+	var soft *Match
+	var softGroups []string
+	var softProbe string
+	var softResponse []byte
+	for _, p := range scanner.probesFor(port) {
+		if ctx.Err() != nil {
+			break
+		}
+		response, err := scanner.runProbe(ctx, &target, p)
+		results.ProbesSent++
+		if err != nil {
+			if results.ProbesSent == 1 {
+				return zgrab2.TryGetScanStatus(err), nil, err
+			}
+			continue
+		}
+		if len(response) == 0 {
+			continue
+		}
+		if results.Response == nil {
+			results.Response = response
+		}
+		m, groups := p.match(response)
+		if m == nil {
+			continue
+		}
+		if !m.Soft {
+			results.set(p.Name, m, groups, response)
+			return zgrab2.SCAN_SUCCESS, results, nil
+		}
+		if soft == nil {
+			soft, softGroups, softProbe, softResponse = m, groups, p.Name, response
+		}
+	}
+	if soft != nil {
+		results.set(softProbe, soft, softGroups, softResponse)
+		return zgrab2.SCAN_SUCCESS, results, nil
+	}
+	return zgrab2.SCAN_PROTOCOL_ERROR, results, ErrNoMatch
+}
+
+// set records the signature m that matched the response to the named probe.
+func (results *Results) set(probe string, m *Match, groups []string, response []byte) {
+	results.Service = m.Service
+	results.Probe = probe
+	results.SoftMatch = m.Soft
+	results.Pattern = m.Pattern
+	results.Product = substitute(m.Product, groups)
+	results.Version = substitute(m.Version, groups)
+	results.Info = substitute(m.Info, groups)
+	results.Hostname = substitute(m.Hostname, groups)
+	results.OS = substitute(m.OS, groups)
+	results.DeviceType = substitute(m.DeviceType, groups)
+	for _, cpe := range m.CPE {
+		results.CPE = append(results.CPE, substitute(cpe, groups))
+	}
+	results.Response = response
+}
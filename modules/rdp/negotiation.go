@@ -0,0 +1,203 @@
+package rdp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The security protocols of the RDP negotiation (MS-RDPBCGR 2.2.1.1.1).
+const (
+	protocolRDP      = 0x00
+	protocolSSL      = 0x01
+	protocolHybrid   = 0x02
+	protocolRDSTLS   = 0x04
+	protocolHybridEx = 0x08
+)
+
+// The types of the negotiation structures.
+const (
+	typeNegRequest = 0x01
+	typeNegRsp     = 0x02
+	typeNegFailure = 0x03
+)
+
+// The flags of a negotiation response (MS-RDPBCGR 2.2.1.2.1).
+const (
+	flagExtendedClientData = 0x01
+	flagDynVCGFX           = 0x02
+	flagRestrictedAdmin    = 0x08
+	flagRedirectedAuth     = 0x10
+)
+
+// The TPDU codes of X.224 (ITU-T X.224 13.3 and 13.4).
+const (
+	x224ConnectionRequest = 0xe0
+	x224ConnectionConfirm = 0xd0
+)
+
+// maxTPKTSize bounds the size of a TPKT read from the server.
+const maxTPKTSize = 1 << 16
+
+// ErrInvalidResponse is returned if the response is not an X.224 connection
+// confirm.
+var ErrInvalidResponse = errors.New("invalid X.224 response")
+
+// protocolNames names the security protocols, in the order they are listed.
+var protocolNames = []struct {
+	protocol uint32
+	name     string
+}{
+	{protocolSSL, "tls"},
+	{protocolHybrid, "credssp"},
+	{protocolRDSTLS, "rdstls"},
+	{protocolHybridEx, "credssp_early_user_auth"},
+}
+
+// protocolList returns the names of the protocols set in a bit mask, with
+// "rdp" for standard RDP security (no bit set).
+func protocolList(protocols uint32) []string {
+	if protocols == protocolRDP {
+		return []string{"rdp"}
+	}
+	var ret []string
+	for _, p := range protocolNames {
+		if protocols&p.protocol != 0 {
+			ret = append(ret, p.name)
+		}
+	}
+	return ret
+}
+
+// protocolName returns the name of a single selected protocol.
+func protocolName(protocol uint32) string {
+	if names := protocolList(protocol); len(names) == 1 {
+		return names[0]
+	}
+	return fmt.Sprintf("unknown (%#x)", protocol)
+}
+
+// failureCodes names the failure codes of a negotiation failure
+// (MS-RDPBCGR 2.2.1.2.2).
+var failureCodes = map[uint32]string{
+	1: "SSL_REQUIRED_BY_SERVER",
+	2: "SSL_NOT_ALLOWED_BY_SERVER",
+	3: "SSL_CERT_NOT_ON_SERVER",
+	4: "INCONSISTENT_FLAGS",
+	5: "HYBRID_REQUIRED_BY_SERVER",
+	6: "SSL_WITH_USER_AUTH_REQUIRED_BY_SERVER",
+}
+
+// NegotiationFlags are the flags of a successful negotiation.
+type NegotiationFlags struct {
+	ExtendedClientData bool `json:"extended_client_data_supported"`
+	DynVCGFX           bool `json:"dynvc_gfx_protocol_supported"`
+	RestrictedAdmin    bool `json:"restricted_admin_mode_supported"`
+	RedirectedAuth     bool `json:"redirected_authentication_mode_supported"`
+}
+
+// Negotiation is the outcome of a connection request.
+type Negotiation struct {
+	// Requested lists the protocols offered in the request.
+	Requested []string `json:"requested"`
+
+	// Selected is the protocol chosen by the server, if it accepted one.
+	Selected string `json:"selected,omitempty"`
+
+	// Flags are the flags of the server's response, if it accepted.
+	Flags *NegotiationFlags `json:"flags,omitempty"`
+
+	// Failure names the reason the server refused the request, if it did.
+	Failure     string `json:"failure,omitempty"`
+	FailureCode uint32 `json:"failure_code,omitempty"`
+
+	// Legacy is true if the server confirmed the connection without any
+	// negotiation data, as servers older than Windows Server 2003 SP1 do:
+	// only standard RDP security is then available.
+	Legacy bool `json:"legacy,omitempty"`
+
+	selected uint32
+	accepted bool
+}
+
+// encodeConnectionRequest returns the TPKT of an X.224 connection request
+// with an RDP negotiation request for the given protocols, preceded by the
+// routing cookie if not empty (MS-RDPBCGR 2.2.1.1).
+func encodeConnectionRequest(cookie string, protocols uint32) []byte {
+	var data []byte
+	if cookie != "" {
+		data = append(data, "Cookie: mstshash="+cookie+"\r\n"...)
+	}
+	neg := make([]byte, 8)
+	neg[0] = typeNegRequest
+	binary.LittleEndian.PutUint16(neg[2:], 8)
+	binary.LittleEndian.PutUint32(neg[4:], protocols)
+	data = append(data, neg...)
+
+	// The length indicator counts the X.224 header after itself.
+	x224 := append([]byte{byte(6 + len(data)), x224ConnectionRequest, 0, 0, 0, 0, 0}, data...)
+	tpkt := []byte{3, 0, 0, 0}
+	binary.BigEndian.PutUint16(tpkt[2:], uint16(4+len(x224)))
+	return append(tpkt, x224...)
+}
+
+// readConnectionConfirm reads the TPKT of the connection confirm, and decodes
+// the negotiation response or failure it carries.
+func readConnectionConfirm(r io.Reader, requested uint32) (*Negotiation, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != 3 {
+		return nil, ErrInvalidResponse
+	}
+	size := int(binary.BigEndian.Uint16(header[2:]))
+	if size < 4+7 || size > maxTPKTSize {
+		return nil, ErrInvalidResponse
+	}
+	x224 := make([]byte, size-4)
+	if _, err := io.ReadFull(r, x224); err != nil {
+		return nil, err
+	}
+	return parseConnectionConfirm(x224, requested)
+}
+
+// parseConnectionConfirm decodes the X.224 connection confirm.
+func parseConnectionConfirm(x224 []byte, requested uint32) (*Negotiation, error) {
+	if len(x224) < 7 || x224[1]&0xf0 != x224ConnectionConfirm {
+		return nil, ErrInvalidResponse
+	}
+	ret := &Negotiation{Requested: protocolList(requested)}
+	neg := x224[7:]
+	if len(neg) < 8 {
+		ret.Legacy = true
+		ret.accepted = true
+		ret.selected = protocolRDP
+		ret.Selected = protocolName(protocolRDP)
+		return ret, nil
+	}
+	value := binary.LittleEndian.Uint32(neg[4:])
+	switch neg[0] {
+	case typeNegRsp:
+		flags := neg[1]
+		ret.accepted = true
+		ret.selected = value
+		ret.Selected = protocolName(value)
+		ret.Flags = &NegotiationFlags{
+			ExtendedClientData: flags&flagExtendedClientData != 0,
+			DynVCGFX:           flags&flagDynVCGFX != 0,
+			RestrictedAdmin:    flags&flagRestrictedAdmin != 0,
+			RedirectedAuth:     flags&flagRedirectedAuth != 0,
+		}
+	case typeNegFailure:
+		ret.FailureCode = value
+		ret.Failure = failureCodes[value]
+		if ret.Failure == "" {
+			ret.Failure = fmt.Sprintf("unknown (%d)", value)
+		}
+	default:
+		return nil, ErrInvalidResponse
+	}
+	return ret, nil
+}
@@ -0,0 +1,215 @@
+// Package rdp provides a zgrab2 module that probes the security protocols of
+// Remote Desktop servers.
+// Default Port: 3389 (TCP)
+//
+// The scanner sends X.224 connection requests carrying an RDP negotiation
+// request, each on a new connection: first offering TLS and CredSSP, the
+// protocols of Network Level Authentication (NLA), to learn the protocol the
+// server prefers and to capture its certificate in a TLS handshake, then
+// standard RDP security alone and TLS alone. A server that refuses both of
+// those but accepts CredSSP requires NLA.
+package rdp
+
+import (
+	"context"
+	"net"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// Flags holds the command-line configuration for the rdp module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	Cookie string `long:"cookie" description:"User name to send in the routing cookie (mstshash), if any."`
+	NoTLS  bool   `long:"no-tls" description:"Do not negotiate TLS to capture the server certificate."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results is the output of the rdp module.
+type Results struct {
+	// SelectedProtocol is the protocol the server chose when offered TLS and
+	// CredSSP.
+	SelectedProtocol string `json:"selected_protocol,omitempty"`
+
+	// SupportedProtocols lists the protocols the server accepted.
+	SupportedProtocols []string `json:"supported_protocols,omitempty"`
+
+	// NLARequired is true if the server refused both standard RDP security
+	// and TLS without CredSSP.
+	NLARequired bool `json:"nla_required"`
+
+	// Negotiations are the outcomes of the connection requests, in order.
+	Negotiations []*Negotiation `json:"negotiations,omitempty"`
+
+	// TLSLog is the TLS handshake log, if TLS was negotiated.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("rdp", "RDP", module.Description(), 3389, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Probe the security protocols of an RDP server, whether it requires NLA, and its certificate"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	// TLS is negotiated after the X.224 connection request.
+	return flags.TLSFlags.CheckRedial("the rdp module")
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "rdp"
+}
+
+// negotiate sends a connection request offering protocols on a new
+// connection. If handshake is set and the server selected a protocol running
+// over TLS, the TLS handshake is performed, and its log is recorded in
+// results.
+func (scanner *Scanner) negotiate(ctx context.Context, target *zgrab2.ScanTarget, protocols uint32, handshake bool, results *Results) (*Negotiation, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write(encodeConnectionRequest(scanner.config.Cookie, protocols)); err != nil {
+		return nil, err
+	}
+	n, err := readConnectionConfirm(conn, protocols)
+	if err != nil {
+		return nil, err
+	}
+	results.Negotiations = append(results.Negotiations, n)
+	if handshake && n.accepted && n.selected != protocolRDP {
+		scanner.handshake(conn, results)
+	}
+	return n, nil
+}
+
+// handshake performs the TLS handshake that follows the negotiation of a TLS
+// based protocol. A failed handshake is recorded in the log, but not reported
+// as an error, since the negotiation succeeded.
+func (scanner *Scanner) handshake(conn net.Conn, results *Results) {
+	tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(conn)
+	if err != nil {
+		log.Debugf("rdp: could not set up TLS: %s", err)
+		return
+	}
+	results.TLSLog = tlsConn.GetLog()
+	if err := tlsConn.Handshake(); err != nil {
+		log.Debugf("rdp: TLS handshake failed: %s", err)
+	}
+}
+
+// Scan sends the connection requests in turn. The scan fails only if the
+// first one does.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	results := new(Results)
+	preferred, err := scanner.negotiate(ctx, &target, protocolSSL|protocolHybrid|protocolHybridEx, !scanner.config.NoTLS, results)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	var supported uint32
+	standard := false
+	if preferred.accepted {
+		results.SelectedProtocol = preferred.Selected
+		supported |= preferred.selected
+		standard = preferred.selected == protocolRDP
+		if preferred.selected == protocolHybridEx {
+			supported |= protocolHybrid
+		}
+	}
+	refused := 0
+	for _, protocols := range []uint32{protocolRDP, protocolSSL} {
+		if ctx.Err() != nil {
+			break
+		}
+		n, err := scanner.negotiate(ctx, &target, protocols, false, results)
+		if err != nil {
+			log.Debugf("rdp: negotiation of %v with %s failed: %s", protocolList(protocols), target.String(), err)
+			continue
+		}
+		switch {
+		case !n.accepted:
+			refused++
+		case n.selected == protocolRDP:
+			standard = true
+		default:
+			supported |= n.selected
+		}
+	}
+	if standard {
+		results.SupportedProtocols = append(results.SupportedProtocols, "rdp")
+	}
+	if supported != 0 {
+		results.SupportedProtocols = append(results.SupportedProtocols, protocolList(supported)...)
+	}
+	results.NLARequired = refused == 2 && supported&protocolHybrid != 0
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,115 @@
+package rdp
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// connectionConfirm returns a connection confirm carrying neg.
+func connectionConfirm(neg []byte) []byte {
+	x224 := append([]byte{byte(6 + len(neg)), x224ConnectionConfirm, 0, 0, 0, 0, 0}, neg...)
+	tpkt := []byte{3, 0, 0, 0}
+	binary.BigEndian.PutUint16(tpkt[2:], uint16(4+len(x224)))
+	return append(tpkt, x224...)
+}
+
+// negotiationData returns an RDP_NEG_RSP or RDP_NEG_FAILURE.
+func negotiationData(typ byte, flags byte, value uint32) []byte {
+	neg := []byte{typ, flags, 8, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(neg[4:], value)
+	return neg
+}
+
+// serve returns a handler answering the connection request with the response
+// returned by policy for the requested protocols.
+func serve(policy func(requested uint32) []byte) func(conn net.Conn) error {
+	return func(conn net.Conn) error {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return err
+		}
+		req := make([]byte, binary.BigEndian.Uint16(header[2:])-4)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return err
+		}
+		requested := binary.LittleEndian.Uint32(req[len(req)-4:])
+		_, err := conn.Write(connectionConfirm(policy(requested)))
+		return err
+	}
+}
+
+func scan(t *testing.T, policy func(requested uint32) []byte) *Results {
+	server, err := testserver.New(testserver.Config{Handler: serve(policy)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	flags := &Flags{Cookie: "test", NoTLS: true}
+	return zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*Results)
+}
+
+func TestNLARequired(t *testing.T) {
+	results := scan(t, func(requested uint32) []byte {
+		if requested&protocolHybrid != 0 {
+			return negotiationData(typeNegRsp, flagExtendedClientData|flagRestrictedAdmin, protocolHybrid)
+		}
+		return negotiationData(typeNegFailure, 0, 5)
+	})
+	if !results.NLARequired || results.SelectedProtocol != "credssp" {
+		t.Errorf("NLA not required: %+v", results)
+	}
+	if !reflect.DeepEqual(results.SupportedProtocols, []string{"credssp"}) {
+		t.Errorf("got supported protocols %v", results.SupportedProtocols)
+	}
+	if len(results.Negotiations) != 3 || results.Negotiations[1].Failure != "HYBRID_REQUIRED_BY_SERVER" {
+		t.Fatalf("wrong negotiations: %+v", results.Negotiations)
+	}
+	if f := results.Negotiations[0].Flags; f == nil || !f.ExtendedClientData || !f.RestrictedAdmin || f.DynVCGFX {
+		t.Errorf("wrong flags: %+v", f)
+	}
+}
+
+func TestNLAOptional(t *testing.T) {
+	results := scan(t, func(requested uint32) []byte {
+		switch {
+		case requested&protocolHybrid != 0:
+			return negotiationData(typeNegRsp, 0, protocolHybrid)
+		case requested&protocolSSL != 0:
+			return negotiationData(typeNegRsp, 0, protocolSSL)
+		}
+		return negotiationData(typeNegRsp, 0, protocolRDP)
+	})
+	if results.NLARequired {
+		t.Error("NLA required")
+	}
+	if !reflect.DeepEqual(results.SupportedProtocols, []string{"rdp", "tls", "credssp"}) {
+		t.Errorf("got supported protocols %v", results.SupportedProtocols)
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	results := scan(t, func(requested uint32) []byte {
+		return nil
+	})
+	if results.NLARequired || results.SelectedProtocol != "rdp" || !results.Negotiations[0].Legacy {
+		t.Errorf("wrong results for a legacy server: %+v", results)
+	}
+	if !reflect.DeepEqual(results.SupportedProtocols, []string{"rdp"}) {
+		t.Errorf("got supported protocols %v", results.SupportedProtocols)
+	}
+}
+
+func TestConnectionRequest(t *testing.T) {
+	req := encodeConnectionRequest("user", protocolSSL|protocolHybrid)
+	want := append([]byte{3, 0, 0, 42, 37, 0xe0, 0, 0, 0, 0, 0}, "Cookie: mstshash=user\r\n"...)
+	want = append(want, 1, 0, 8, 0, 3, 0, 0, 0)
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("got request %x, want %x", req, want)
+	}
+}
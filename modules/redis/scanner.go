@@ -3,16 +3,20 @@
 // defined at https://redis.io/topics/protocol.
 // Servers can be configured to require (cleartext) password authentication,
 // which is omitted from our probe by default (pass --password <your password>
-// to supply one).
+// to supply one, and --username for servers with ACLs).
 // Further, admins can rename commands, so even if authentication is not
 // required we may not get the expected output.
 // However, we should always get output in the expected format, which is fairly
 // distinct. The probe sends a sequence of commands and checks that the response
 // is well-formed redis data, which should be possible whatever the
 // configuration.
+// With --script, an allow-listed sequence of read-only commands (such as
+// INFO sections, CONFIG GET maxmemory or CLUSTER INFO) is sent instead of
+// INFO and the non-existent command, and their responses are parsed.
 package redis
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -35,6 +39,8 @@ type Flags struct {
 	Mappings         string `long:"mappings" description:"Pathname for JSON/YAML file that contains mappings for command names."`
 	MaxInputFileSize int64  `long:"max-input-file-size" default:"102400" description:"Maximum size for either input file."`
 	Password         string `long:"password" description:"Set a password to use to authenticate to the server. WARNING: This is sent in the clear."`
+	Username         string `long:"username" description:"Set a username to send with --password in AUTH, for servers with ACLs (Redis 6+)."`
+	Script           string `long:"script" description:"Comma-separated commands to send instead of INFO and the non-existent command, among INFO [section], CONFIG GET (of non-secret parameters, without globs), CLUSTER INFO/NODES/MYID, COMMAND COUNT, MODULE LIST, ACL WHOAMI, DBSIZE, ROLE, TIME and LASTSAVE (e.g. 'INFO server,CONFIG GET maxmemory,CLUSTER INFO')."`
 	DoInline         bool   `long:"inline" description:"Send commands using the inline syntax"`
 	Verbose          bool   `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
 }
@@ -48,6 +54,7 @@ type Scanner struct {
 	config          *Flags
 	commandMappings map[string]string
 	customCommands  []string
+	script          [][]string
 }
 
 // scan holds the state for the scan of an individual target
@@ -146,6 +153,9 @@ type Result struct {
 	// auth is required, this may give a different error than existing commands.
 	NonexistentResponse string `json:"nonexistent_response,omitempty"`
 
+	// ScriptResponses are the parsed responses to the commands of --script.
+	ScriptResponses []ScriptResponse `json:"script_responses,omitempty"`
+
 	// CustomResponses is an array that holds the commands, arguments, and
 	// responses from user-inputted commands.
 	CustomResponses []CustomResponse `json:"custom_responses,omitempty"`
@@ -175,6 +185,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Result)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for Redis"
@@ -182,6 +197,14 @@ func (module *Module) Description() string {
 
 // Validate checks that the flags are valid
 func (flags *Flags) Validate(args []string) error {
+	if flags.Username != "" && flags.Password == "" {
+		log.Errorf("--username requires --password")
+		return zgrab2.ErrInvalidArguments
+	}
+	if _, err := parseScript(flags.Script); err != nil {
+		log.Errorf("invalid --script: %s", err)
+		return zgrab2.ErrInvalidArguments
+	}
 	return nil
 }
 
@@ -270,6 +293,14 @@ func (scanner *Scanner) initCommands() error {
 		"QUIT":        "QUIT",
 	}
 
+	if scanner.config.Script != "" {
+		script, err := parseScript(scanner.config.Script)
+		if err != nil {
+			return err
+		}
+		scanner.script = script
+	}
+
 	if scanner.config.CustomCommands != "" {
 		var customCommands []string
 		err := scanner.getFileContents(scanner.config.CustomCommands, &customCommands)
@@ -311,8 +342,8 @@ func (scan *scan) SendCommand(cmd string, args ...string) (RedisValue, error) {
 }
 
 // StartScan opens a connection to the target and sets up a scan instance for it
-func (scanner *Scanner) StartScan(target *zgrab2.ScanTarget) (*scan, error) {
-	conn, err := target.Open(&scanner.config.BaseFlags)
+func (scanner *Scanner) StartScan(ctx context.Context, target *zgrab2.ScanTarget) (*scan, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return nil, err
 	}
@@ -354,6 +385,79 @@ func (scanner *Scanner) Protocol() string {
 	return "redis"
 }
 
+// readInfo reads the version and the other fields of result from the
+// response to INFO.
+func (result *Result) readInfo(info string) {
+	for _, line := range strings.Split(info, "\r\n") {
+		linePrefixSuffix := strings.SplitN(line, ":", 2)
+		prefix := linePrefixSuffix[0]
+		var suffix string
+		if len(linePrefixSuffix) > 1 {
+			suffix = linePrefixSuffix[1]
+		}
+		switch prefix {
+		case "redis_version":
+			result.Version = suffix
+			versionSegments := strings.SplitN(suffix, ".", 3)
+			if len(versionSegments) > 0 {
+				major := convToUint32(versionSegments[0])
+				result.Major = &major
+			}
+			if len(versionSegments) > 1 {
+				minor := convToUint32(versionSegments[1])
+				result.Minor = &minor
+			}
+			if len(versionSegments) > 2 {
+				patchlevel := convToUint32(versionSegments[2])
+				result.Patchlevel = &patchlevel
+			}
+		case "os":
+			result.OS = suffix
+		case "arch_bits":
+			result.ArchBits = suffix
+		case "redis_mode":
+			result.Mode = suffix
+		case "redis_git_sha1":
+			result.GitSha1 = suffix
+		case "redis_build_id":
+			result.BuildID = suffix
+		case "gcc_version":
+			result.GCCVersion = suffix
+		case "mem_allocator":
+			result.MemAllocator = suffix
+		case "uptime_in_seconds":
+			result.Uptime = convToUint32(suffix)
+		case "used_memory":
+			result.UsedMemory = convToUint32(suffix)
+		case "total_connections_received":
+			result.ConnectionsReceived = convToUint32(suffix)
+		case "total_commands_processed":
+			result.CommandsProcessed = convToUint32(suffix)
+		}
+	}
+}
+
+// runScript sends the commands of --script, with the command names mapped
+// by --mappings, and parses their responses. The version is read from the
+// responses to INFO.
+func (scan *scan) runScript() error {
+	for _, command := range scan.scanner.script {
+		name, ok := scan.scanner.commandMappings[command[0]]
+		if !ok {
+			name = command[0]
+		}
+		resp, err := scan.SendCommand(name, command[1:]...)
+		if err != nil {
+			return err
+		}
+		if info, ok := resp.(BulkString); ok && command[0] == "INFO" {
+			scan.result.readInfo(string(info))
+		}
+		scan.result.ScriptResponses = append(scan.result.ScriptResponses, *parseScriptResponse(command, resp))
+	}
+	return nil
+}
+
 // Converts the string to a Uint32 if possible. If not, returns 0 (the zero value of a uin32)
 func convToUint32(s string) uint32 {
 	s64, err := strconv.ParseUint(s, 10, 32)
@@ -365,16 +469,16 @@ func convToUint32(s string) uint32 {
 
 // Scan executes the following commands:
 // 1. PING
-// 2. (only if --password is provided) AUTH <password>
-// 3. INFO
-// 4. NONEXISTENT
+// 2. (only if --password is provided) AUTH [<username>] <password>
+// 3. INFO, or the commands of --script if provided
+// 4. NONEXISTENT (unless --script is provided)
 // 5. (only if --custom-commands is provided) CustomCommands <args>
 // 6. QUIT
 // The responses for each of these is logged, and if INFO succeeds, the version
 // is scraped from it.
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
 	// ping, info, quit
-	scan, err := scanner.StartScan(&target)
+	scan, err := scanner.StartScan(ctx, &target)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
@@ -390,71 +494,35 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	// we have positively identified that a redis service is present.
 	result.PingResponse = forceToString(pingResponse)
 	if scanner.config.Password != "" {
-		authResponse, err := scan.SendCommand(scanner.commandMappings["AUTH"], scanner.config.Password)
+		args := []string{scanner.config.Password}
+		if scanner.config.Username != "" {
+			args = []string{scanner.config.Username, scanner.config.Password}
+		}
+		authResponse, err := scan.SendCommand(scanner.commandMappings["AUTH"], args...)
 		if err != nil {
 			return zgrab2.TryGetScanStatus(err), result, err
 		}
 		result.AuthResponse = forceToString(authResponse)
 	}
-	infoResponse, err := scan.SendCommand(scanner.commandMappings["INFO"])
-	if err != nil {
-		return zgrab2.TryGetScanStatus(err), result, err
-	}
-	result.InfoResponse = forceToString(infoResponse)
-	if infoResponseBulk, ok := infoResponse.(BulkString); ok {
-		for _, line := range strings.Split(string(infoResponseBulk), "\r\n") {
-			linePrefixSuffix := strings.SplitN(line, ":", 2)
-			prefix := linePrefixSuffix[0]
-			var suffix string
-			if len(linePrefixSuffix) > 1 {
-				suffix = linePrefixSuffix[1]
-			}
-			switch prefix {
-			case "redis_version":
-				result.Version = suffix
-				versionSegments := strings.SplitN(suffix, ".", 3)
-				if len(versionSegments) > 0 {
-					major := convToUint32(versionSegments[0])
-					result.Major = &major
-				}
-				if len(versionSegments) > 1 {
-					minor := convToUint32(versionSegments[1])
-					result.Minor = &minor
-				}
-				if len(versionSegments) > 2 {
-					patchlevel := convToUint32(versionSegments[2])
-					result.Patchlevel = &patchlevel
-				}
-			case "os":
-				result.OS = suffix
-			case "arch_bits":
-				result.ArchBits = suffix
-			case "redis_mode":
-				result.Mode = suffix
-			case "redis_git_sha1":
-				result.GitSha1 = suffix
-			case "redis_build_id":
-				result.BuildID = suffix
-			case "gcc_version":
-				result.GCCVersion = suffix
-			case "mem_allocator":
-				result.MemAllocator = suffix
-			case "uptime_in_seconds":
-				result.Uptime = convToUint32(suffix)
-			case "used_memory":
-				result.UsedMemory = convToUint32(suffix)
-			case "total_connections_received":
-				result.ConnectionsReceived = convToUint32(suffix)
-			case "total_commands_processed":
-				result.CommandsProcessed = convToUint32(suffix)
-			}
+	if len(scanner.script) > 0 {
+		if err := scan.runScript(); err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
 		}
+	} else {
+		infoResponse, err := scan.SendCommand(scanner.commandMappings["INFO"])
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+		result.InfoResponse = forceToString(infoResponse)
+		if infoResponseBulk, ok := infoResponse.(BulkString); ok {
+			result.readInfo(string(infoResponseBulk))
+		}
+		bogusResponse, err := scan.SendCommand(scanner.commandMappings["NONEXISTENT"])
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
+		result.NonexistentResponse = forceToString(bogusResponse)
 	}
-	bogusResponse, err := scan.SendCommand(scanner.commandMappings["NONEXISTENT"])
-	if err != nil {
-		return zgrab2.TryGetScanStatus(err), result, err
-	}
-	result.NonexistentResponse = forceToString(bogusResponse)
 	for i := range scanner.customCommands {
 		fullCmd := strings.Fields(scanner.customCommands[i])
 		resp, err := scan.SendCommand(fullCmd[0], fullCmd[1:]...)
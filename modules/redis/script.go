@@ -0,0 +1,167 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// scriptCommands are the commands allowed in --script, by name, with the
+// subcommands allowed (none for commands without subcommands). All are
+// read-only.
+var scriptCommands = map[string][]string{
+	"INFO":     nil,
+	"CONFIG":   {"GET"},
+	"CLUSTER":  {"INFO", "NODES", "MYID"},
+	"COMMAND":  {"COUNT"},
+	"MODULE":   {"LIST"},
+	"ACL":      {"WHOAMI"},
+	"DBSIZE":   nil,
+	"ROLE":     nil,
+	"TIME":     nil,
+	"LASTSAVE": nil,
+}
+
+// scriptConfigParameters are the parameters allowed in CONFIG GET, which
+// exclude those holding secrets (such as requirepass or masterauth). Glob
+// patterns, which could match those, are not allowed.
+var scriptConfigParameters = map[string]bool{
+	"appendonly":       true,
+	"bind":             true,
+	"cluster-enabled":  true,
+	"databases":        true,
+	"io-threads":       true,
+	"maxclients":       true,
+	"maxmemory":        true,
+	"maxmemory-policy": true,
+	"port":             true,
+	"protected-mode":   true,
+	"save":             true,
+	"tcp-keepalive":    true,
+	"timeout":          true,
+}
+
+// ScriptResponse is the parsed response to a --script command.
+type ScriptResponse struct {
+	// Command is the command sent, in inline format.
+	Command string `json:"command"`
+
+	// Fields are the "field:value" lines of an INFO or CLUSTER INFO
+	// response (without the section names of INFO), or the parameter/value
+	// pairs of a CONFIG GET response.
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// Values are the elements of another array response.
+	Values []string `json:"values,omitempty"`
+
+	// Response is another response, as a string.
+	Response string `json:"response,omitempty"`
+
+	// Error is the error returned by the server, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// parseScript parses the comma-separated commands of --script, and returns
+// an error if one of them is not in scriptCommands, or gets a parameter of
+// CONFIG GET that is not in scriptConfigParameters.
+func parseScript(script string) ([][]string, error) {
+	var ret [][]string
+	for _, command := range strings.Split(script, ",") {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = strings.ToUpper(fields[0])
+		subcommands, ok := scriptCommands[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("command %s is not allowed in --script", fields[0])
+		}
+		if subcommands != nil {
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("command %s requires a subcommand", fields[0])
+			}
+			fields[1] = strings.ToUpper(fields[1])
+			allowed := false
+			for _, subcommand := range subcommands {
+				allowed = allowed || fields[1] == subcommand
+			}
+			if !allowed {
+				return nil, fmt.Errorf("command %s %s is not allowed in --script", fields[0], fields[1])
+			}
+		}
+		if fields[0] == "CONFIG" {
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("command CONFIG GET requires a parameter")
+			}
+			for i, parameter := range fields[2:] {
+				parameter = strings.ToLower(parameter)
+				if !scriptConfigParameters[parameter] {
+					return nil, fmt.Errorf("parameter %s of CONFIG GET is not allowed in --script", parameter)
+				}
+				fields[2+i] = parameter
+			}
+		}
+		ret = append(ret, fields)
+	}
+	return ret, nil
+}
+
+// parseFields parses the "field:value" lines of an INFO or CLUSTER INFO
+// response, skipping the section names and blank lines.
+func parseFields(response string) map[string]string {
+	ret := make(map[string]string)
+	for _, line := range strings.Split(response, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fieldValue := strings.SplitN(line, ":", 2)
+		if len(fieldValue) == 2 {
+			ret[fieldValue[0]] = fieldValue[1]
+		}
+	}
+	return ret
+}
+
+// scriptString is forceToString, with the elements of (nested) arrays
+// separated by spaces.
+func scriptString(value RedisValue) string {
+	array, ok := value.(RedisArray)
+	if !ok {
+		return forceToString(value)
+	}
+	elements := make([]string, len(array))
+	for i, element := range array {
+		elements[i] = scriptString(element)
+	}
+	return strings.Join(elements, " ")
+}
+
+// parseScriptResponse parses the response to the command with the given
+// name and arguments.
+func parseScriptResponse(command []string, value RedisValue) *ScriptResponse {
+	ret := &ScriptResponse{Command: getInlineCommand(command[0], command[1:]...)}
+	switch v := value.(type) {
+	case ErrorMessage:
+		ret.Error = string(v)
+	case BulkString:
+		if command[0] == "INFO" || (command[0] == "CLUSTER" && command[1] == "INFO") {
+			ret.Fields = parseFields(string(v))
+		} else {
+			ret.Response = string(v)
+		}
+	case RedisArray:
+		if command[0] == "CONFIG" {
+			ret.Fields = make(map[string]string)
+			for i := 0; i+1 < len(v); i += 2 {
+				ret.Fields[scriptString(v[i])] = scriptString(v[i+1])
+			}
+		} else {
+			for _, element := range v {
+				ret.Values = append(ret.Values, scriptString(element))
+			}
+		}
+	default:
+		ret.Response = forceToString(v)
+	}
+	return ret
+}
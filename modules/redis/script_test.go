@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseScript(t *testing.T) {
+	script, err := parseScript("INFO server, config get maxmemory,CLUSTER INFO,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{{"INFO", "server"}, {"CONFIG", "GET", "maxmemory"}, {"CLUSTER", "INFO"}}
+	if !reflect.DeepEqual(script, expected) {
+		t.Errorf("got %q", script)
+	}
+	for _, invalid := range []string{"FLUSHALL", "CONFIG SET maxmemory 0", "CONFIG GET", "CONFIG GET *", "CONFIG GET requirepass", "CONFIG GET maxmemory masterauth", "CONFIG GET max*", "CLUSTER", "INFO,KEYS *"} {
+		if _, err := parseScript(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestParseScriptResponse(t *testing.T) {
+	tests := []struct {
+		command  []string
+		value    RedisValue
+		expected ScriptResponse
+	}{
+		{
+			command:  []string{"INFO", "server"},
+			value:    BulkString("# Server\r\nredis_version:6.0.0\r\nos:Linux\r\n\r\n"),
+			expected: ScriptResponse{Command: "INFO server", Fields: map[string]string{"redis_version": "6.0.0", "os": "Linux"}},
+		},
+		{
+			command:  []string{"CONFIG", "GET", "maxmemory"},
+			value:    RedisArray{BulkString("maxmemory"), BulkString("0")},
+			expected: ScriptResponse{Command: "CONFIG GET maxmemory", Fields: map[string]string{"maxmemory": "0"}},
+		},
+		{
+			command:  []string{"CLUSTER", "INFO"},
+			value:    ErrorMessage("ERR This instance has cluster support disabled"),
+			expected: ScriptResponse{Command: "CLUSTER INFO", Error: "ERR This instance has cluster support disabled"},
+		},
+		{
+			command:  []string{"ROLE"},
+			value:    RedisArray{BulkString("master"), Integer(0), RedisArray{}},
+			expected: ScriptResponse{Command: "ROLE", Values: []string{"master", "0", ""}},
+		},
+		{
+			command:  []string{"DBSIZE"},
+			value:    Integer(42),
+			expected: ScriptResponse{Command: "DBSIZE", Response: "42"},
+		},
+	}
+	for _, test := range tests {
+		if ret := parseScriptResponse(test.command, test.value); !reflect.DeepEqual(*ret, test.expected) {
+			t.Errorf("%q: got %+v", test.command, ret)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+package modules
+
+import "github.com/zmap/zgrab2/modules/rsync"
+
+func init() {
+	rsync.RegisterModule()
+}
@@ -0,0 +1,297 @@
+// Package rsync provides a zgrab2 module that lists the modules exported by
+// rsync daemons, as `rsync host::` does.
+// Default Port: 873 (TCP)
+//
+// The scanner reads the greeting of the daemon, which gives its protocol
+// version, answers it, and requests the list of modules. The daemon sends its
+// message of the day, then a line per listed module, and closes the
+// connection. Unless --max-modules is 0, the scanner then requests each
+// module on a new connection: the daemon either accepts it (anonymous
+// access), asks for credentials, or refuses it.
+package rsync
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// clientGreeting is the greeting sent to the daemon. Protocol 30 does not
+// negotiate the checksums.
+const clientGreeting = "@RSYNCD: 30.0\n"
+
+// maxLines is the maximum number of lines read in response to a request.
+const maxLines = 1024
+
+// Flags holds the command-line configuration for the rsync module.
+type Flags struct {
+	zgrab2.BaseFlags
+
+	MaxModules int `long:"max-modules" default:"20" description:"Max number of modules to check for anonymous access; 0 only lists them"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// RsyncModule is a module exported by the daemon.
+type RsyncModule struct {
+	Name    string `json:"name"`
+	Comment string `json:"comment,omitempty"`
+
+	// Anonymous is true if the module was accepted without credentials, and
+	// AuthRequired if credentials were requested. Error is the error sent by
+	// the daemon if it refused the module, or the error of the connection.
+	Anonymous    bool   `json:"anonymous,omitempty"`
+	AuthRequired bool   `json:"auth_required,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Results is the output of the rsync module.
+type Results struct {
+	// Banner is the greeting of the daemon.
+	Banner string `json:"banner,omitempty"`
+
+	// ProtocolVersion is the protocol version of the greeting, and Digests
+	// the checksums it lists, since protocol 31.
+	ProtocolVersion string   `json:"protocol_version,omitempty"`
+	Digests         []string `json:"digests,omitempty"`
+
+	// MOTD is the message of the day.
+	MOTD string `json:"motd,omitempty"`
+
+	// Modules lists the modules, and ListError is the error sent by the
+	// daemon if it refused to list them.
+	Modules   []RsyncModule `json:"modules,omitempty"`
+	ListError string        `json:"list_error,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("rsync", "rsync", module.Description(), 873, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "List the modules exported by an rsync daemon, and check which accept anonymous access"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if flags.MaxModules < 0 {
+		log.Errorf("Invalid --max-modules %d: must not be negative", flags.MaxModules)
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "rsync"
+}
+
+// ErrInvalidGreeting is returned if the server does not greet as an rsync
+// daemon.
+var ErrInvalidGreeting = errors.New("invalid rsync greeting")
+
+// session is a connection to the daemon.
+type session struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// errorMessage returns the message of an @ERROR line.
+func errorMessage(line string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(line, "@ERROR"), ":"))
+}
+
+// readLine reads a line without its line ending.
+func (s *session) readLine() (string, error) {
+	line, err := s.reader.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// open connects to the daemon and exchanges the greetings, returning the
+// greeting of the daemon.
+func (scanner *Scanner) open(ctx context.Context, target *zgrab2.ScanTarget) (*session, string, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return nil, "", err
+	}
+	s := &session{conn: conn, reader: bufio.NewReader(conn)}
+	greeting, err := s.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, greeting, err
+	}
+	if !strings.HasPrefix(greeting, "@RSYNCD: ") {
+		conn.Close()
+		return nil, greeting, zgrab2.NewScanError(zgrab2.SCAN_PROTOCOL_ERROR, ErrInvalidGreeting)
+	}
+	if _, err := conn.Write([]byte(clientGreeting)); err != nil {
+		conn.Close()
+		return nil, greeting, err
+	}
+	return s, greeting, nil
+}
+
+// list requests the list of modules, and reads the message of the day and
+// the modules until the daemon closes the connection or exits.
+func (s *session) list(results *Results) error {
+	if _, err := s.conn.Write([]byte("#list\n")); err != nil {
+		return err
+	}
+	var motd []string
+	for i := 0; i < maxLines; i++ {
+		line, err := s.readLine()
+		if strings.HasPrefix(line, "@RSYNCD: EXIT") {
+			break
+		}
+		if strings.HasPrefix(line, "@ERROR") {
+			results.ListError = errorMessage(line)
+			break
+		}
+		if strings.Contains(line, "\t") && !strings.HasPrefix(line, "\t") {
+			// The modules are listed as "%-15s\t%s".
+			parts := strings.SplitN(line, "\t", 2)
+			results.Modules = append(results.Modules, RsyncModule{
+				Name:    strings.TrimSpace(parts[0]),
+				Comment: strings.TrimSpace(parts[1]),
+			})
+		} else if results.Modules == nil && (line != "" || err == nil) {
+			motd = append(motd, line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	results.MOTD = strings.TrimSpace(strings.Join(motd, "\n"))
+	return nil
+}
+
+// check requests a module, and records whether the daemon accepted it.
+func (s *session) check(module *RsyncModule) error {
+	if _, err := s.conn.Write([]byte(module.Name + "\n")); err != nil {
+		return err
+	}
+	for i := 0; i < maxLines; i++ {
+		line, err := s.readLine()
+		switch {
+		case strings.HasPrefix(line, "@RSYNCD: OK"):
+			module.Anonymous = true
+			return nil
+		case strings.HasPrefix(line, "@RSYNCD: AUTHREQD"):
+			module.AuthRequired = true
+			return nil
+		case strings.HasPrefix(line, "@ERROR"):
+			module.Error = errorMessage(line)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scan lists the modules, then checks each of the first --max-modules of
+// them on a new connection.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	s, greeting, err := scanner.open(ctx, &target)
+	if err != nil {
+		if greeting != "" {
+			return zgrab2.TryGetScanStatus(err), &Results{Banner: greeting}, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	results := &Results{Banner: greeting}
+	fields := strings.Fields(strings.TrimPrefix(greeting, "@RSYNCD: "))
+	if len(fields) > 0 {
+		results.ProtocolVersion = fields[0]
+		results.Digests = fields[1:]
+		if len(results.Digests) == 0 {
+			results.Digests = nil
+		}
+	}
+	err = s.list(results)
+	s.conn.Close()
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), results, err
+	}
+	for i := range results.Modules {
+		if i == scanner.config.MaxModules {
+			break
+		}
+		module := &results.Modules[i]
+		s, _, err := scanner.open(ctx, &target)
+		if err == nil {
+			err = s.check(module)
+			s.conn.Close()
+		}
+		if err != nil {
+			module.Error = err.Error()
+		}
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,88 @@
+package rsync
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// serve runs a fake rsync daemon, answering each module request with the
+// response of the module.
+func serve(t *testing.T, greeting string, listing string, responses map[string]string) *testserver.Server {
+	server, err := testserver.New(testserver.Config{
+		Banner: []byte(greeting),
+		Handler: func(conn net.Conn) error {
+			reader := bufio.NewReader(conn)
+			if version, err := reader.ReadString('\n'); err != nil || version != clientGreeting {
+				return fmt.Errorf("got greeting %q, error %v", version, err)
+			}
+			request, _ := reader.ReadString('\n')
+			request = strings.TrimSuffix(request, "\n")
+			if request == "#list" {
+				conn.Write([]byte(listing))
+			} else {
+				conn.Write([]byte("Welcome\n\n" + responses[request]))
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func scan(t *testing.T, server *testserver.Server, maxModules int) *Results {
+	defer server.Close()
+	return zgrab2test.MustScan(t, new(Scanner), &Flags{MaxModules: maxModules}, server.Addr()).(*Results)
+}
+
+func TestModules(t *testing.T) {
+	listing := "Welcome\n\nto the mirror\n\npub            \tPublic files\nbackup         \tNightly backups\nsecret         \t\n@RSYNCD: EXIT\n"
+	responses := map[string]string{
+		"pub":    "@RSYNCD: OK\n",
+		"backup": "@RSYNCD: AUTHREQD 8dD4qEHZ0xUWzW2N8C1C0A\n",
+		"secret": "@ERROR: access denied to secret from unknown (10.0.0.1)\n",
+	}
+	results := scan(t, serve(t, "@RSYNCD: 31.0 sha512 sha256 sha1 md5 md4\n", listing, responses), 20)
+	if results.ProtocolVersion != "31.0" || !reflect.DeepEqual(results.Digests, []string{"sha512", "sha256", "sha1", "md5", "md4"}) {
+		t.Errorf("got %+v", results)
+	}
+	if results.MOTD != "Welcome\n\nto the mirror" {
+		t.Errorf("got MOTD %q", results.MOTD)
+	}
+	expected := []RsyncModule{
+		{Name: "pub", Comment: "Public files", Anonymous: true},
+		{Name: "backup", Comment: "Nightly backups", AuthRequired: true},
+		{Name: "secret", Error: "access denied to secret from unknown (10.0.0.1)"},
+	}
+	if !reflect.DeepEqual(results.Modules, expected) {
+		t.Errorf("got modules %+v", results.Modules)
+	}
+}
+
+func TestListOnly(t *testing.T) {
+	results := scan(t, serve(t, "@RSYNCD: 29\n", "data\tfiles\n", nil), 0)
+	if results.ProtocolVersion != "29" || results.Digests != nil || results.MOTD != "" {
+		t.Errorf("got %+v", results)
+	}
+	if !reflect.DeepEqual(results.Modules, []RsyncModule{{Name: "data", Comment: "files"}}) {
+		t.Errorf("got modules %+v", results.Modules)
+	}
+}
+
+func TestInvalidGreeting(t *testing.T) {
+	server := serve(t, "SSH-2.0-OpenSSH_8.9\r\n", "", nil)
+	defer server.Close()
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), new(Flags), server.Addr())
+	if status != zgrab2.SCAN_PROTOCOL_ERROR || err == nil || ret.(*Results).Banner != "SSH-2.0-OpenSSH_8.9" {
+		t.Errorf("got status %s, %+v, error %v", status, ret, err)
+	}
+}
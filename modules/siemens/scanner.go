@@ -4,6 +4,7 @@
 package siemens
 
 import (
+	"context"
 	"net"
 
 	log "github.com/sirupsen/logrus"
@@ -46,6 +47,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(S7Log)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for Siemens S7 devices"
@@ -98,15 +104,15 @@ func (scanner *Scanner) Protocol() string {
 // 5. Request to read the module identification (and store it in the output)
 // 6. Request to read the component identification (and store it in the output)
 // 7. Return the output
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	conn, err := target.Open(&scanner.config.BaseFlags)
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
 	defer conn.Close()
 	result := new(S7Log)
 
-	err = GetS7Banner(result, conn, func() (net.Conn, error) { return target.Open(&scanner.config.BaseFlags) })
+	err = GetS7Banner(result, conn, func() (net.Conn, error) { return target.Open(ctx, &scanner.config.BaseFlags) })
 	if !result.IsS7 {
 		result = nil
 	}
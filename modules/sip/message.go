@@ -0,0 +1,159 @@
+package sip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidResponse is returned if the response is not a SIP response.
+var ErrInvalidResponse = errors.New("invalid SIP response")
+
+// compactForms maps the compact forms of the headers of interest to their
+// names (RFC 3261, section 20).
+var compactForms = map[string]string{
+	"c": "Content-Type",
+	"f": "From",
+	"i": "Call-ID",
+	"k": "Supported",
+	"l": "Content-Length",
+	"m": "Contact",
+	"t": "To",
+	"u": "Allow-Events",
+	"v": "Via",
+}
+
+// request holds the fields of an OPTIONS request.
+type request struct {
+	// transport is UDP, TCP or TLS, as written in the Via header.
+	transport string
+	target    string
+	local     string
+	userAgent string
+	branch    string
+	tag       string
+	callID    string
+}
+
+// encode returns the OPTIONS request.
+func (r *request) encode() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "OPTIONS sip:%s SIP/2.0\r\n", r.target)
+	fmt.Fprintf(&b, "Via: SIP/2.0/%s %s;branch=z9hG4bK%s;rport\r\n", r.transport, r.local, r.branch)
+	b.WriteString("Max-Forwards: 70\r\n")
+	fmt.Fprintf(&b, "To: <sip:%s>\r\n", r.target)
+	fmt.Fprintf(&b, "From: <sip:zgrab@%s>;tag=%s\r\n", r.local, r.tag)
+	fmt.Fprintf(&b, "Call-ID: %s\r\n", r.callID)
+	b.WriteString("CSeq: 1 OPTIONS\r\n")
+	fmt.Fprintf(&b, "Contact: <sip:zgrab@%s>\r\n", r.local)
+	b.WriteString("Accept: application/sdp\r\n")
+	if r.userAgent != "" {
+		fmt.Fprintf(&b, "User-Agent: %s\r\n", r.userAgent)
+	}
+	b.WriteString("Content-Length: 0\r\n\r\n")
+	return b.Bytes()
+}
+
+// response is a parsed SIP response.
+type response struct {
+	version      string
+	statusCode   int
+	reasonPhrase string
+	headers      map[string][]string
+}
+
+// get returns the first value of a header.
+func (r *response) get(name string) string {
+	if values := r.headers[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// list returns the comma-separated values of all the occurrences of a
+// header.
+func (r *response) list(name string) []string {
+	var ret []string
+	for _, value := range r.headers[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				ret = append(ret, item)
+			}
+		}
+	}
+	return ret
+}
+
+// canonicalName returns the name of a header in its canonical form, expanding
+// the compact forms.
+func canonicalName(name string) string {
+	if long, ok := compactForms[strings.ToLower(name)]; ok {
+		return long
+	}
+	parts := strings.Split(strings.ToLower(name), "-")
+	for i, part := range parts {
+		switch part {
+		case "id":
+			parts[i] = "ID"
+		case "cseq":
+			parts[i] = "CSeq"
+		case "www":
+			parts[i] = "WWW"
+		default:
+			if part != "" {
+				parts[i] = strings.ToUpper(part[:1]) + part[1:]
+			}
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// headerEnd returns the length of the status line and headers of a message,
+// including the empty line ending them, or -1 if they are incomplete.
+func headerEnd(data []byte) int {
+	if i := bytes.Index(data, []byte("\r\n\r\n")); i >= 0 {
+		return i + 4
+	}
+	if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
+		return i + 2
+	}
+	return -1
+}
+
+// parseResponse parses the status line and headers of a response. Folded
+// header lines are joined to the previous line.
+func parseResponse(data []byte) (*response, error) {
+	lines := strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n")
+	status := strings.SplitN(lines[0], " ", 3)
+	if len(status) < 2 || !strings.HasPrefix(status[0], "SIP/") {
+		return nil, ErrInvalidResponse
+	}
+	code, err := strconv.Atoi(status[1])
+	if err != nil || code < 100 || code > 699 {
+		return nil, ErrInvalidResponse
+	}
+	resp := &response{version: status[0], statusCode: code, headers: make(map[string][]string)}
+	if len(status) == 3 {
+		resp.reasonPhrase = status[2]
+	}
+	var last string
+	for _, line := range lines[1:] {
+		if line == "" {
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && last != "" {
+			values := resp.headers[last]
+			values[len(values)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			continue
+		}
+		last = canonicalName(strings.TrimSpace(line[:i]))
+		resp.headers[last] = append(resp.headers[last], strings.TrimSpace(line[i+1:]))
+	}
+	return resp, nil
+}
@@ -0,0 +1,281 @@
+// Package sip provides a zgrab2 module that sends an OPTIONS request to SIP
+// servers and user agents.
+// Default Port: 5060 (UDP)
+//
+// The request is sent over UDP by default, or over TCP or TLS (usually on
+// port 5061) with --transport. The scanner reads the final response,
+// skipping provisional (1xx) ones, and records its status, the Server or
+// User-Agent header identifying the implementation, the methods of the
+// Allow header and the extensions of the Supported header.
+package sip
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+const (
+	// maxProvisional is the maximum number of provisional responses skipped.
+	maxProvisional = 8
+
+	// maxHeaderLines is the maximum number of header lines read over TCP.
+	maxHeaderLines = 256
+)
+
+// Flags holds the command-line configuration for the sip module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+	zgrab2.TLSFlags
+
+	Transport string `long:"transport" default:"udp" choice:"udp" choice:"tcp" choice:"tls" description:"Transport of the request: UDP, TCP, or TLS (usually on port 5061)."`
+	UserAgent string `long:"user-agent" default:"zgrab/0.x" description:"Set a custom user agent"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results is the output of the sip module.
+type Results struct {
+	// Transport is the transport of the request.
+	Transport string `json:"transport"`
+
+	// The status line of the response.
+	Version      string `json:"version,omitempty"`
+	StatusCode   int    `json:"status_code,omitempty"`
+	ReasonPhrase string `json:"reason_phrase,omitempty"`
+
+	// Server and UserAgent identify the implementation.
+	Server    string `json:"server,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// Allow lists the supported methods, Supported the supported extensions
+	// and Accept the accepted body types.
+	Allow     []string `json:"allow,omitempty"`
+	Supported []string `json:"supported,omitempty"`
+	Accept    []string `json:"accept,omitempty"`
+
+	// Headers holds all the headers of the response, by canonical name.
+	Headers map[string][]string `json:"headers,omitempty"`
+
+	// TLSLog is the log of the TLS handshake, with --transport=tls.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("sip", "SIP", module.Description(), 5060, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Send a SIP OPTIONS request over UDP, TCP or TLS, and read the server, methods and extensions of the response"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "sip"
+}
+
+// open connects to the target over the transport of the request.
+func (scanner *Scanner) open(ctx context.Context, target *zgrab2.ScanTarget, results *Results) (net.Conn, error) {
+	switch scanner.config.Transport {
+	case "udp":
+		return target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	case "tls":
+		conn, err := target.OpenTLS(ctx, &scanner.config.BaseFlags, &scanner.config.TLSFlags)
+		if conn == nil {
+			return nil, err
+		}
+		results.TLSLog = conn.GetLog()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	return target.Open(ctx, &scanner.config.BaseFlags)
+}
+
+// randomToken returns a random token for the branch, tag and Call-ID.
+func randomToken() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
+
+// uriHost returns the host of the target in a SIP URI.
+func uriHost(target *zgrab2.ScanTarget) string {
+	if target.Domain != "" {
+		return target.Domain
+	}
+	if target.IP.To4() == nil {
+		return "[" + target.IP.String() + "]"
+	}
+	return target.IP.String()
+}
+
+// readDatagram reads a response over UDP.
+func readDatagram(conn net.Conn) (*response, error) {
+	buf := make([]byte, 65536)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return parseResponse(buf[:n])
+}
+
+// readStream reads a response over TCP or TLS, discarding its body.
+func readStream(reader *bufio.Reader) (*response, error) {
+	var header []byte
+	for i := 0; ; i++ {
+		if i == maxHeaderLines {
+			return nil, ErrInvalidResponse
+		}
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		header = append(header, line...)
+		if headerEnd(header) >= 0 {
+			break
+		}
+		if i == 0 && !strings.HasPrefix(string(line), "SIP/") {
+			return nil, ErrInvalidResponse
+		}
+	}
+	resp, err := parseResponse(header)
+	if err != nil {
+		return nil, err
+	}
+	if length, err := strconv.ParseInt(resp.get("Content-Length"), 10, 64); err == nil && length > 0 {
+		if _, err := io.CopyN(ioutil.Discard, reader, length); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// Scan sends the OPTIONS request, and reads the responses until the final
+// one.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	results := &Results{Transport: scanner.config.Transport}
+	conn, err := scanner.open(ctx, &target, results)
+	if err != nil {
+		if results.TLSLog != nil {
+			return zgrab2.TryGetScanStatus(err), results, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	req := &request{
+		transport: strings.ToUpper(scanner.config.Transport),
+		target:    uriHost(&target),
+		local:     conn.LocalAddr().String(),
+		userAgent: scanner.config.UserAgent,
+		branch:    randomToken(),
+		tag:       randomToken(),
+		callID:    randomToken(),
+	}
+	if _, err := conn.Write(req.encode()); err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	reader := bufio.NewReader(conn)
+	var resp *response
+	for i := 0; i <= maxProvisional; i++ {
+		if scanner.config.Transport == "udp" {
+			resp, err = readDatagram(conn)
+		} else {
+			resp, err = readStream(reader)
+		}
+		if err != nil {
+			if err == ErrInvalidResponse {
+				return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+			}
+			return zgrab2.TryGetScanStatus(err), nil, err
+		}
+		if resp.statusCode >= 200 {
+			break
+		}
+	}
+	results.Version = resp.version
+	results.StatusCode = resp.statusCode
+	results.ReasonPhrase = resp.reasonPhrase
+	results.Server = resp.get("Server")
+	results.UserAgent = resp.get("User-Agent")
+	results.Allow = resp.list("Allow")
+	results.Supported = resp.list("Supported")
+	results.Accept = resp.list("Accept")
+	results.Headers = resp.headers
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,82 @@
+package sip
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+const okResponse = "SIP/2.0 200 OK\r\n" +
+	"Via: SIP/2.0/UDP 127.0.0.1:5060;branch=z9hG4bK1;rport=5060\r\n" +
+	"From: <sip:zgrab@127.0.0.1>;tag=1\r\n" +
+	"To: <sip:127.0.0.1>;tag=as5f2e1b3c\r\n" +
+	"Call-ID: 1\r\n" +
+	"CSeq: 1 OPTIONS\r\n" +
+	"Server: Asterisk PBX 18.15.0\r\n" +
+	"Allow: INVITE, ACK, CANCEL, OPTIONS, BYE, REFER,\r\n" +
+	" SUBSCRIBE, NOTIFY, INFO, PUBLISH, MESSAGE\r\n" +
+	"k: replaces, timer\r\n" +
+	"Accept: application/sdp\r\n" +
+	"l: 0\r\n\r\n"
+
+func TestUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	requests := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 65536)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		requests <- string(buf[:n])
+		conn.WriteTo([]byte("SIP/2.0 100 Trying\r\nl: 0\r\n\r\n"), addr)
+		conn.WriteTo([]byte(okResponse), addr)
+	}()
+	// The server answers with two datagrams, which a testserver.UDPServer
+	// can't send.
+	flags := &Flags{Transport: "udp", UserAgent: "zgrab/0.x"}
+	results := zgrab2test.MustScan(t, new(Scanner), flags, conn.LocalAddr().String()).(*Results)
+	request := <-requests
+	if !strings.HasPrefix(request, "OPTIONS sip:127.0.0.1 SIP/2.0\r\nVia: SIP/2.0/UDP 127.0.0.1:") || !strings.Contains(request, "User-Agent: zgrab/0.x\r\n") || !strings.HasSuffix(request, "Content-Length: 0\r\n\r\n") {
+		t.Errorf("got request %q", request)
+	}
+	if results.StatusCode != 200 || results.ReasonPhrase != "OK" || results.Server != "Asterisk PBX 18.15.0" || results.Version != "SIP/2.0" {
+		t.Errorf("got %+v", results)
+	}
+	allow := []string{"INVITE", "ACK", "CANCEL", "OPTIONS", "BYE", "REFER", "SUBSCRIBE", "NOTIFY", "INFO", "PUBLISH", "MESSAGE"}
+	if !reflect.DeepEqual(results.Allow, allow) || !reflect.DeepEqual(results.Supported, []string{"replaces", "timer"}) || !reflect.DeepEqual(results.Accept, []string{"application/sdp"}) {
+		t.Errorf("got %+v", results)
+	}
+	if results.Headers["Call-ID"][0] != "1" || results.Headers["CSeq"][0] != "1 OPTIONS" || results.Headers["Content-Length"][0] != "0" {
+		t.Errorf("got headers %v", results.Headers)
+	}
+}
+
+func TestTCP(t *testing.T) {
+	server, err := testserver.New(testserver.Config{Script: []testserver.Step{
+		testserver.Exchange(`(?s)^OPTIONS .*?\r\n\r\n`, "SIP/2.0 100 Trying\r\nContent-Length: 5\r\n\r\nhello"+
+			"SIP/2.0 401 Unauthorized\r\nUser-Agent: FRITZ!OS\r\nWWW-Authenticate: Digest realm=\"fritz.box\"\r\nContent-Length: 0\r\n\r\n"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	results := zgrab2test.MustScan(t, new(Scanner), &Flags{Transport: "tcp"}, server.Addr()).(*Results)
+	if results.Transport != "tcp" || results.StatusCode != 401 || results.UserAgent != "FRITZ!OS" || results.Headers["WWW-Authenticate"] == nil {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestInvalidResponse(t *testing.T) {
+	if _, err := parseResponse([]byte("HTTP/1.1 400 Bad Request\r\n\r\n")); err != ErrInvalidResponse {
+		t.Errorf("got error %v", err)
+	}
+}
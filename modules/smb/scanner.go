@@ -3,6 +3,9 @@
 package smb
 
 import (
+	"context"
+	"net"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
 	"github.com/zmap/zgrab2/lib/smb/smb"
@@ -16,6 +19,12 @@ type Flags struct {
 	// SetupSession tells the client to continue the handshake up to the point where credentials would be needed.
 	SetupSession bool `long:"setup-session" description:"After getting the response from the negotiation request, send a setup session packet."`
 
+	// Dialects tells the client to probe SMB1 and each SMB2/3 dialect on its own connection.
+	Dialects bool `long:"dialects" description:"Probe SMB1 and each SMB2/3 dialect on its own connection, to list the supported dialects"`
+
+	// NullSession tells the client to attempt an anonymous session, and to list the shares if it is accepted.
+	NullSession bool `long:"null-session" description:"After the setup session, attempt a null session and list the shares with it"`
+
 	// Verbose requests more verbose logging / output.
 	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
 }
@@ -48,6 +57,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(smb.SMBLog)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Probe for SMB servers (Windows filesharing / SAMBA)"
@@ -100,24 +114,31 @@ func (scanner *Scanner) Protocol() string {
 // 3. Read response from server; on failure, exit with log = nil.
 //      If the server returns a protocol ID indicating support for version 1, set smbv1_support = true
 //      Pull out the relevant information from the response packet
-// 4. If --setup-session is not set, exit with success.
+// 4. If neither --setup-session nor --null-session is set, skip to 8.
 // 5. Send a setup session packet to the server with appropriate values
 // 6. Read the response from the server; on failure, exit with the log so far.
-// 7. Return the log.
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	conn, err := target.Open(&scanner.config.BaseFlags)
+// 7. If --null-session is set, complete the session setup anonymously and,
+//      if the server accepts it, list the shares.
+// 8. If --dialects is set, probe each dialect on a new connection.
+// 9. Return the log.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
 	defer conn.Close()
 	var result *smb.SMBLog
-	setupSession := scanner.config.SetupSession
+	setupSession := scanner.config.SetupSession || scanner.config.NullSession
 	verbose := scanner.config.Verbose
-	result, err = smb.GetSMBLog(conn, setupSession, false, verbose)
+	if scanner.config.NullSession {
+		result, err = smb.GetSMBLogWithNullSession(conn, target.Host(), verbose)
+	} else {
+		result, err = smb.GetSMBLog(conn, setupSession, false, verbose)
+	}
 	if err != nil {
 		if result == nil {
 			conn.Close()
-			conn, err = target.Open(&scanner.config.BaseFlags)
+			conn, err = target.Open(ctx, &scanner.config.BaseFlags)
 			if err != nil {
 				return zgrab2.TryGetScanStatus(err), nil, err
 			}
@@ -130,5 +151,13 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 			return zgrab2.TryGetScanStatus(err), result, err
 		}
 	}
+	if scanner.config.Dialects {
+		result.SupportedDialects, result.SMBv1Log = smb.ProbeDialects(func() (net.Conn, error) {
+			return target.Open(ctx, &scanner.config.BaseFlags)
+		}, verbose)
+		if result.SMBv1Log != nil {
+			result.SupportV1 = true
+		}
+	}
 	return zgrab2.SCAN_SUCCESS, result, nil
 }
@@ -0,0 +1,101 @@
+package smtp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Extensions are the SMTP service extensions listed by the server in its
+// response to EHLO (RFC 5321, section 4.1.1.1).
+type Extensions struct {
+	// Domain is the domain the server greets the client with.
+	Domain string `json:"domain,omitempty"`
+
+	// Keywords are the extensions, as listed, with their parameters (e.g.
+	// "SIZE 35882577").
+	Keywords []string `json:"keywords,omitempty"`
+
+	// Size is the maximum message size of the SIZE extension (RFC 1870),
+	// if given.
+	Size int64 `json:"size,omitempty"`
+
+	// Auth is the SASL mechanisms of the AUTH extension (RFC 4954).
+	Auth []string `json:"auth,omitempty"`
+
+	StartTLS            bool `json:"starttls,omitempty"`
+	Pipelining          bool `json:"pipelining,omitempty"`
+	EightBitMIME        bool `json:"8bitmime,omitempty"`
+	SMTPUTF8            bool `json:"smtputf8,omitempty"`
+	Chunking            bool `json:"chunking,omitempty"`
+	DSN                 bool `json:"dsn,omitempty"`
+	EnhancedStatusCodes bool `json:"enhancedstatuscodes,omitempty"`
+}
+
+// parseExtensions parses a response to EHLO, e.g.
+// "250-mx.example.com Hello\r\n250-SIZE 1000\r\n250 STARTTLS\r\n". It returns
+// nil if the response is not a successful one.
+func parseExtensions(response string) *Extensions {
+	if !strings.HasPrefix(response, "250") {
+		return nil
+	}
+	ext := new(Extensions)
+	lines := strings.Split(strings.TrimRight(response, "\r\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if len(line) < 4 || !strings.HasPrefix(line, "250") {
+			continue
+		}
+		line = strings.TrimSpace(line[4:])
+		if i == 0 {
+			ext.Domain = strings.SplitN(line, " ", 2)[0]
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		ext.Keywords = append(ext.Keywords, line)
+		fields := strings.Fields(line)
+		keyword := strings.ToUpper(fields[0])
+		// Some servers also list the mechanisms in the pre-standard form
+		// AUTH=LOGIN PLAIN.
+		if strings.HasPrefix(keyword, "AUTH=") {
+			fields = append([]string{"AUTH", fields[0][5:]}, fields[1:]...)
+			keyword = "AUTH"
+		}
+		switch keyword {
+		case "SIZE":
+			if len(fields) > 1 {
+				ext.Size, _ = strconv.ParseInt(fields[1], 10, 64)
+			}
+		case "AUTH":
+			for _, mech := range fields[1:] {
+				ext.addAuth(strings.ToUpper(mech))
+			}
+		case "STARTTLS":
+			ext.StartTLS = true
+		case "PIPELINING":
+			ext.Pipelining = true
+		case "8BITMIME":
+			ext.EightBitMIME = true
+		case "SMTPUTF8":
+			ext.SMTPUTF8 = true
+		case "CHUNKING":
+			ext.Chunking = true
+		case "DSN":
+			ext.DSN = true
+		case "ENHANCEDSTATUSCODES":
+			ext.EnhancedStatusCodes = true
+		}
+	}
+	return ext
+}
+
+// addAuth adds mech to the AUTH mechanisms, unless it is already listed.
+func (ext *Extensions) addAuth(mech string) {
+	for _, m := range ext.Auth {
+		if m == mech {
+			return
+		}
+	}
+	ext.Auth = append(ext.Auth, mech)
+}
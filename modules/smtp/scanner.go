@@ -16,6 +16,10 @@
 // and then negotiate a TLS connection.
 // The scanner uses the standard TLS flags for the handshake.
 //
+// The --relay-check flag tells the scanner to check whether the server is
+// an open relay: it sends MAIL FROM and RCPT TO commands with the addresses
+// of --relay-from and --relay-to, then RSET; DATA is never sent.
+//
 // The --send-quit flag tells the scanner to send a QUIT command.
 //
 // So, if no flags are specified, the scanner simply reads the banner
@@ -26,8 +30,10 @@
 package smtp
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 
@@ -49,12 +55,25 @@ type ScanResults struct {
 	// EHLO is the server's response to the EHLO command, if one is sent.
 	EHLO string `json:"ehlo,omitempty"`
 
+	// Extensions are the service extensions listed in the response to EHLO.
+	Extensions *Extensions `json:"extensions,omitempty"`
+
 	// HELP is the server's response to the HELP command, if it is sent.
 	HELP string `json:"help,omitempty"`
 
 	// StartTLS is the server's response to the STARTTLS command, if it is sent.
 	StartTLS string `json:"starttls,omitempty"`
 
+	// HELOTLS and EHLOTLS are the server's responses to the HELO or EHLO
+	// command sent again after STARTTLS, and TLSExtensions the extensions
+	// listed in the response to EHLO.
+	HELOTLS       string      `json:"helo_tls,omitempty"`
+	EHLOTLS       string      `json:"ehlo_tls,omitempty"`
+	TLSExtensions *Extensions `json:"tls_extensions,omitempty"`
+
+	// Relay is the outcome of the open relay check, if --relay-check is sent.
+	Relay *RelayCheck `json:"relay,omitempty"`
+
 	// QUIT is the server's response to the QUIT command, if it is sent.
 	QUIT string `json:"quit,omitempty"`
 
@@ -66,6 +85,24 @@ type ScanResults struct {
 	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
 }
 
+// RelayStep is a command sent by the open relay check, with the server's
+// response.
+type RelayStep struct {
+	Command  string `json:"command"`
+	Code     int    `json:"code,omitempty"`
+	Response string `json:"response,omitempty"`
+}
+
+// RelayCheck is the outcome of the open relay check: the MAIL FROM and RCPT
+// TO commands (the latter only if the sender was accepted), followed by RSET.
+type RelayCheck struct {
+	Steps []RelayStep `json:"steps"`
+
+	// OpenRelay is true if the server accepted the recipient, which is in a
+	// domain it should not relay mail to.
+	OpenRelay bool `json:"open_relay"`
+}
+
 // Flags holds the command-line configuration for the HTTP scan module.
 // Populated by the framework.
 type Flags struct {
@@ -96,6 +133,15 @@ type Flags struct {
 	// StartTLS indicates that the client should attempt to update the connection to TLS.
 	StartTLS bool `long:"starttls" description:"Send STARTTLS before negotiating"`
 
+	// RelayCheck indicates that the client should check whether the server is an open relay.
+	RelayCheck bool `long:"relay-check" description:"Check whether the server relays mail, with MAIL FROM and RCPT TO (DATA is never sent). Implies --send-ehlo, unless --send-helo is set."`
+
+	// RelayFrom is the sender address of the relay check.
+	RelayFrom string `long:"relay-from" default:"probe@example.com" description:"Set the sender address of --relay-check"`
+
+	// RelayTo is the recipient address of the relay check.
+	RelayTo string `long:"relay-to" default:"probe@example.net" description:"Set the recipient address of --relay-check, in a domain the server should not relay to"`
+
 	// Verbose indicates that there should be more verbose logging.
 	Verbose bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
 }
@@ -128,6 +174,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(ScanResults)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Fetch an SMTP server banner, optionally over TLS"
@@ -151,6 +202,12 @@ func (flags *Flags) Validate(args []string) error {
 		log.Errorln("Cannot provide both EHLO and HELO")
 		return zgrab2.ErrInvalidArguments
 	}
+	if flags.RelayCheck && !flags.SendHELO {
+		flags.SendEHLO = true
+	}
+	if flags.StartTLS {
+		return flags.TLSFlags.CheckRedial("--starttls")
+	}
 	return nil
 }
 
@@ -205,6 +262,35 @@ func getCommand(cmd string, arg string) string {
 	return cmd + " " + arg
 }
 
+// checkRelay runs the open relay check on conn. The error is that of the
+// connection, if it failed.
+func (scanner *Scanner) checkRelay(conn *Connection) (*RelayCheck, error) {
+	check := &RelayCheck{Steps: []RelayStep{}}
+	step := func(cmd string) (int, error) {
+		ret, err := conn.SendCommand(cmd)
+		if err != nil {
+			return 0, err
+		}
+		code, _ := getSMTPCode(ret)
+		check.Steps = append(check.Steps, RelayStep{Command: cmd, Code: code, Response: ret})
+		return code, nil
+	}
+	code, err := step("MAIL FROM:<" + scanner.config.RelayFrom + ">")
+	if err != nil {
+		return check, err
+	}
+	if code >= 200 && code < 300 {
+		if code, err = step("RCPT TO:<" + scanner.config.RelayTo + ">"); err != nil {
+			return check, err
+		}
+		check.OpenRelay = code == 250 || code == 251
+	}
+	if _, err := step("RSET"); err != nil {
+		return check, err
+	}
+	return check, nil
+}
+
 // Verify that an SMTP code was returned, and that it is a successful one!
 // Return code on SCAN_APPLICATION_ERROR for better info
 func VerifySMTPContents(banner string) (zgrab2.ScanStatus, int) {
@@ -234,18 +320,21 @@ func VerifySMTPContents(banner string) (zgrab2.ScanStatus, int) {
 //    or HELO command.
 // 5. If --send-help is sent, send HELP, read the result.
 // 6. If --starttls is sent, send STARTTLS, read the result, negotiate a
-//    TLS connection.
-// 7. If --send-quit is sent, send QUIT and read the result.
-// 8. Close the connection.
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	c, err := target.Open(&scanner.config.BaseFlags)
+//    TLS connection, and send the EHLO or HELO command again.
+// 7. If --relay-check is sent, send MAIL FROM, RCPT TO and RSET.
+// 8. If --send-quit is sent, send QUIT and read the result.
+// 9. Close the connection.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	c, err := target.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
 	defer c.Close()
 	result := &ScanResults{}
 	if scanner.config.SMTPSecure {
-		tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(c)
+		tlsConn, err := scanner.config.TLSFlags.GetTLSConnectionForTarget(c, nil, func() (net.Conn, error) {
+			return target.Open(ctx, &scanner.config.BaseFlags)
+		})
 		if err != nil {
 			return zgrab2.TryGetScanStatus(err), nil, err
 		}
@@ -284,6 +373,7 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 			return zgrab2.TryGetScanStatus(err), result, err
 		}
 		result.EHLO = ret
+		result.Extensions = parseExtensions(ret)
 	}
 	if scanner.config.SendHELP {
 		ret, err := conn.SendCommand("HELP")
@@ -314,6 +404,24 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 			return zgrab2.TryGetScanStatus(err), result, err
 		}
 		conn.Conn = tlsConn
+		// The server forgets the greeting once TLS is negotiated.
+		if scanner.config.SendHELO {
+			if result.HELOTLS, err = conn.SendCommand(getCommand("HELO", scanner.config.HELODomain)); err != nil {
+				return zgrab2.TryGetScanStatus(err), result, err
+			}
+		}
+		if scanner.config.SendEHLO {
+			if result.EHLOTLS, err = conn.SendCommand(getCommand("EHLO", scanner.config.EHLODomain)); err != nil {
+				return zgrab2.TryGetScanStatus(err), result, err
+			}
+			result.TLSExtensions = parseExtensions(result.EHLOTLS)
+		}
+	}
+	if scanner.config.RelayCheck {
+		result.Relay, err = scanner.checkRelay(&conn)
+		if err != nil {
+			return zgrab2.TryGetScanStatus(err), result, err
+		}
 	}
 	if scanner.config.SendQUIT {
 		ret, err := conn.SendCommand("QUIT")
@@ -0,0 +1,133 @@
+package smtp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+func TestParseExtensions(t *testing.T) {
+	ext := parseExtensions("250-mx.example.com Hello [192.0.2.1]\r\n250-SIZE 35882577\r\n250-8BITMIME\r\n250-AUTH LOGIN PLAIN\r\n250-AUTH=LOGIN CRAM-MD5\r\n250-STARTTLS\r\n250-ENHANCEDSTATUSCODES\r\n250-PIPELINING\r\n250-CHUNKING\r\n250 SMTPUTF8\r\n")
+	expected := &Extensions{
+		Domain:              "mx.example.com",
+		Keywords:            []string{"SIZE 35882577", "8BITMIME", "AUTH LOGIN PLAIN", "AUTH=LOGIN CRAM-MD5", "STARTTLS", "ENHANCEDSTATUSCODES", "PIPELINING", "CHUNKING", "SMTPUTF8"},
+		Size:                35882577,
+		Auth:                []string{"LOGIN", "PLAIN", "CRAM-MD5"},
+		StartTLS:            true,
+		Pipelining:          true,
+		EightBitMIME:        true,
+		SMTPUTF8:            true,
+		Chunking:            true,
+		EnhancedStatusCodes: true,
+	}
+	if !reflect.DeepEqual(ext, expected) {
+		t.Errorf("got %+v", ext)
+	}
+	if ext := parseExtensions("502 Command not implemented\r\n"); ext != nil {
+		t.Errorf("got %+v for an error", ext)
+	}
+}
+
+// serve runs a fake SMTP server, accepting recipients in the domain
+// example.net only if relay is true.
+func serve(t *testing.T, relay bool) (*testserver.Server, chan []string) {
+	commands := make(chan []string, 1)
+	handler := func(conn net.Conn) error {
+		var received []string
+		defer func() { commands <- received }()
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			cmd := strings.TrimSpace(line)
+			received = append(received, cmd)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				fmt.Fprintf(conn, "250-mx.example.com\r\n250 SIZE 1000\r\n")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				fmt.Fprintf(conn, "250 2.1.0 Ok\r\n")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				if relay {
+					fmt.Fprintf(conn, "250 2.1.5 Ok\r\n")
+				} else {
+					fmt.Fprintf(conn, "554 5.7.1 Relay access denied\r\n")
+				}
+			case cmd == "RSET":
+				fmt.Fprintf(conn, "250 2.0.0 Ok\r\n")
+			case cmd == "QUIT":
+				_, err := fmt.Fprintf(conn, "221 2.0.0 Bye\r\n")
+				return err
+			default:
+				fmt.Fprintf(conn, "502 5.5.2 Error: command not recognized\r\n")
+			}
+		}
+	}
+	server, err := testserver.New(testserver.Config{Banner: []byte("220 mx.example.com ESMTP\r\n"), Handler: handler})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, commands
+}
+
+func TestRelayCheck(t *testing.T) {
+	for _, relay := range []bool{false, true} {
+		server, commands := serve(t, relay)
+		flags := &Flags{
+			RelayCheck: true,
+			RelayFrom:  "probe@example.com",
+			RelayTo:    "probe@example.net",
+			SendQUIT:   true,
+		}
+		if err := flags.Validate(nil); err != nil {
+			t.Fatal(err)
+		}
+		result := zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*ScanResults)
+		server.Close()
+		if result.Extensions == nil || result.Extensions.Size != 1000 {
+			t.Errorf("got extensions %+v", result.Extensions)
+		}
+		check := result.Relay
+		if check == nil || check.OpenRelay != relay || len(check.Steps) != 3 {
+			t.Fatalf("relay %v: got %+v", relay, check)
+		}
+		rcptCode := 554
+		if relay {
+			rcptCode = 250
+		}
+		if check.Steps[1].Command != "RCPT TO:<probe@example.net>" || check.Steps[1].Code != rcptCode || check.Steps[2].Code != 250 {
+			t.Errorf("relay %v: got steps %+v", relay, check.Steps)
+		}
+		expected := []string{"EHLO", "MAIL FROM:<probe@example.com>", "RCPT TO:<probe@example.net>", "RSET", "QUIT"}
+		if received := <-commands; !reflect.DeepEqual(received, expected) {
+			t.Errorf("relay %v: server received %q", relay, received)
+		}
+	}
+}
+
+func TestTLSVulnChecks(t *testing.T) {
+	server, err := testserver.New(testserver.Config{TLS: true, Banner: []byte("220 mx.example.com ESMTP\r\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	flags := &Flags{SMTPSecure: true}
+	flags.VulnChecks = true
+	result := zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*ScanResults)
+	if result.TLSLog == nil || result.TLSLog.VulnChecks == nil {
+		t.Errorf("got TLS log %+v", result.TLSLog)
+	}
+
+	flags = &Flags{StartTLS: true}
+	flags.VulnChecks = true
+	if err := flags.Validate(nil); err == nil {
+		t.Errorf("--tls-vuln-checks accepted with --starttls")
+	}
+}
@@ -0,0 +1,7 @@
+package modules
+
+import "github.com/zmap/zgrab2/modules/snmp"
+
+func init() {
+	snmp.RegisterModule()
+}
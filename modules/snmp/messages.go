@@ -0,0 +1,343 @@
+package snmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/zmap/zgrab2/lib/ber"
+)
+
+// The SNMP types and PDUs (RFC 2578, RFC 3416).
+const (
+	tagIPAddress = ber.ClassApplication | 0
+	tagCounter32 = ber.ClassApplication | 1
+	tagGauge32   = ber.ClassApplication | 2
+	tagTimeTicks = ber.ClassApplication | 3
+	tagOpaque    = ber.ClassApplication | 4
+	tagCounter64 = ber.ClassApplication | 6
+
+	tagNoSuchObject   = ber.ClassContext | 0
+	tagNoSuchInstance = ber.ClassContext | 1
+	tagEndOfMibView   = ber.ClassContext | 2
+
+	tagGetRequest  = ber.ClassContext | ber.Constructed | 0
+	tagGetResponse = ber.ClassContext | ber.Constructed | 2
+	tagReport      = ber.ClassContext | ber.Constructed | 8
+)
+
+// Message versions, as encoded in the version field.
+const (
+	versionV1  = 0
+	versionV2c = 1
+	versionV3  = 3
+)
+
+// usmSecurityModel is the User-based Security Model (RFC 3414).
+const usmSecurityModel = 3
+
+// maxMessageSize is the largest message accepted in v3 requests.
+const maxMessageSize = 65507
+
+// systemOIDs are the scalar objects of the system group (RFC 3418).
+var systemOIDs = []string{
+	"1.3.6.1.2.1.1.1.0", // sysDescr
+	"1.3.6.1.2.1.1.2.0", // sysObjectID
+	"1.3.6.1.2.1.1.3.0", // sysUpTime
+	"1.3.6.1.2.1.1.4.0", // sysContact
+	"1.3.6.1.2.1.1.5.0", // sysName
+	"1.3.6.1.2.1.1.6.0", // sysLocation
+	"1.3.6.1.2.1.1.7.0", // sysServices
+}
+
+// ErrInvalidResponse is returned if a response is not a valid SNMP message.
+var ErrInvalidResponse = errors.New("invalid SNMP response")
+
+// varBind is a variable binding of a PDU.
+type varBind struct {
+	oid   string
+	value ber.Element
+}
+
+// pdu is a decoded v1 or v2c message.
+type pdu struct {
+	version     int64
+	community   string
+	tag         byte
+	requestID   int64
+	errorStatus int64
+	errorIndex  int64
+	varBinds    []varBind
+}
+
+// encodeGetRequest returns a v1 or v2c GetRequest for the given OIDs.
+func encodeGetRequest(version int, community string, requestID int32, oids [][]uint32) []byte {
+	var varBinds [][]byte
+	for _, oid := range oids {
+		varBinds = append(varBinds, ber.Encode(ber.TagSequence, ber.EncodeOID(oid), ber.Encode(ber.TagNull)))
+	}
+	return ber.Encode(ber.TagSequence,
+		ber.EncodeInt(int64(version)),
+		ber.EncodeString([]byte(community)),
+		ber.Encode(tagGetRequest,
+			ber.EncodeInt(int64(requestID)),
+			ber.EncodeInt(0),
+			ber.EncodeInt(0),
+			ber.Encode(ber.TagSequence, varBinds...),
+		),
+	)
+}
+
+// decodePDU decodes a v1 or v2c message.
+func decodePDU(b []byte) (*pdu, error) {
+	msg, _, err := ber.Decode(b)
+	if err != nil || msg.Tag != ber.TagSequence {
+		return nil, ErrInvalidResponse
+	}
+	fields, err := msg.Children()
+	if err != nil || len(fields) != 3 || fields[1].Tag != ber.TagOctetString {
+		return nil, ErrInvalidResponse
+	}
+	ret := &pdu{community: string(fields[1].Value), tag: fields[2].Tag}
+	if ret.version, err = fields[0].Int(); err != nil {
+		return nil, ErrInvalidResponse
+	}
+	pduFields, err := fields[2].Children()
+	if err != nil || len(pduFields) != 4 {
+		return nil, ErrInvalidResponse
+	}
+	if ret.requestID, err = pduFields[0].Int(); err != nil {
+		return nil, ErrInvalidResponse
+	}
+	if ret.errorStatus, err = pduFields[1].Int(); err != nil {
+		return nil, ErrInvalidResponse
+	}
+	if ret.errorIndex, err = pduFields[2].Int(); err != nil {
+		return nil, ErrInvalidResponse
+	}
+	varBinds, err := pduFields[3].Children()
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	for _, vb := range varBinds {
+		pair, err := vb.Children()
+		if err != nil || len(pair) != 2 {
+			return nil, ErrInvalidResponse
+		}
+		oid, err := pair[0].OID()
+		if err != nil {
+			return nil, ErrInvalidResponse
+		}
+		ret.varBinds = append(ret.varBinds, varBind{oid: oid, value: pair[1]})
+	}
+	return ret, nil
+}
+
+// System holds the objects of the system group.
+type System struct {
+	Descr    string `json:"sys_descr,omitempty"`
+	ObjectID string `json:"sys_object_id,omitempty"`
+	// UpTime is in hundredths of a second.
+	UpTime   uint32 `json:"sys_up_time,omitempty"`
+	Contact  string `json:"sys_contact,omitempty"`
+	Name     string `json:"sys_name,omitempty"`
+	Location string `json:"sys_location,omitempty"`
+	Services int    `json:"sys_services,omitempty"`
+}
+
+// system returns the system group objects of a response. Bindings reporting
+// an exception (v2c noSuchObject and the like) are ignored.
+func (p *pdu) system() *System {
+	ret := new(System)
+	for _, vb := range p.varBinds {
+		v := vb.value
+		switch vb.oid {
+		case systemOIDs[0]:
+			ret.Descr = octetString(v)
+		case systemOIDs[1]:
+			ret.ObjectID, _ = v.OID()
+		case systemOIDs[2]:
+			if v.Tag == tagTimeTicks {
+				ticks, _ := v.Int()
+				ret.UpTime = uint32(ticks)
+			}
+		case systemOIDs[3]:
+			ret.Contact = octetString(v)
+		case systemOIDs[4]:
+			ret.Name = octetString(v)
+		case systemOIDs[5]:
+			ret.Location = octetString(v)
+		case systemOIDs[6]:
+			if v.Tag == ber.TagInteger {
+				services, _ := v.Int()
+				ret.Services = int(services)
+			}
+		}
+	}
+	return ret
+}
+
+// octetString returns the value of an OCTET STRING, or "" for other types.
+func octetString(e ber.Element) string {
+	if e.Tag != ber.TagOctetString {
+		return ""
+	}
+	return strings.TrimRight(string(e.Value), "\x00")
+}
+
+// encodeDiscovery returns the unauthenticated v3 request that makes an agent
+// report its engine ID, boots and time (RFC 3414 section 4).
+func encodeDiscovery(msgID int32) []byte {
+	usm := ber.Encode(ber.TagSequence,
+		ber.EncodeString(nil), // msgAuthoritativeEngineID
+		ber.EncodeInt(0),      // msgAuthoritativeEngineBoots
+		ber.EncodeInt(0),      // msgAuthoritativeEngineTime
+		ber.EncodeString(nil), // msgUserName
+		ber.EncodeString(nil), // msgAuthenticationParameters
+		ber.EncodeString(nil), // msgPrivacyParameters
+	)
+	return ber.Encode(ber.TagSequence,
+		ber.EncodeInt(versionV3),
+		ber.Encode(ber.TagSequence,
+			ber.EncodeInt(int64(msgID)),
+			ber.EncodeInt(maxMessageSize),
+			ber.EncodeString([]byte{0x04}), // reportable, no authentication or privacy
+			ber.EncodeInt(usmSecurityModel),
+		),
+		ber.EncodeString(usm),
+		ber.Encode(ber.TagSequence,
+			ber.EncodeString(nil), // contextEngineID
+			ber.EncodeString(nil), // contextName
+			ber.Encode(tagGetRequest, ber.EncodeInt(int64(msgID)), ber.EncodeInt(0), ber.EncodeInt(0), ber.Encode(ber.TagSequence)),
+		),
+	)
+}
+
+// Engine is the identity of an SNMPv3 engine, as reported to a discovery
+// request.
+type Engine struct {
+	// ID is the snmpEngineID of the agent.
+	ID []byte `json:"engine_id"`
+
+	// Enterprise is the IANA private enterprise number of the vendor that
+	// built the engine ID, and Vendor is its name, if known.
+	Enterprise uint32 `json:"enterprise,omitempty"`
+	Vendor     string `json:"vendor,omitempty"`
+
+	// Format is the format of the rest of the engine ID (RFC 3411), and Data
+	// is that rest, decoded for the address and text formats.
+	Format string `json:"format,omitempty"`
+	Data   string `json:"data,omitempty"`
+
+	// Boots is the number of times the engine has restarted, and Time the
+	// number of seconds since the last restart.
+	Boots int64 `json:"engine_boots"`
+	Time  int64 `json:"engine_time"`
+}
+
+// decodeDiscovery decodes the report to a discovery request, and returns the
+// message ID and the engine.
+func decodeDiscovery(b []byte) (int64, *Engine, error) {
+	msg, _, err := ber.Decode(b)
+	if err != nil || msg.Tag != ber.TagSequence {
+		return 0, nil, ErrInvalidResponse
+	}
+	fields, err := msg.Children()
+	if err != nil || len(fields) < 3 || fields[2].Tag != ber.TagOctetString {
+		return 0, nil, ErrInvalidResponse
+	}
+	if version, err := fields[0].Int(); err != nil || version != versionV3 {
+		return 0, nil, ErrInvalidResponse
+	}
+	header, err := fields[1].Children()
+	if err != nil || len(header) != 4 {
+		return 0, nil, ErrInvalidResponse
+	}
+	msgID, err := header[0].Int()
+	if err != nil {
+		return 0, nil, ErrInvalidResponse
+	}
+	usm, _, err := ber.Decode(fields[2].Value)
+	if err != nil {
+		return 0, nil, ErrInvalidResponse
+	}
+	params, err := usm.Children()
+	if err != nil || len(params) != 6 || params[0].Tag != ber.TagOctetString {
+		return 0, nil, ErrInvalidResponse
+	}
+	engine := parseEngineID(params[0].Value)
+	if engine.Boots, err = params[1].Int(); err != nil {
+		return 0, nil, ErrInvalidResponse
+	}
+	if engine.Time, err = params[2].Int(); err != nil {
+		return 0, nil, ErrInvalidResponse
+	}
+	return msgID, engine, nil
+}
+
+// parseEngineID decodes the structure of an engine ID (RFC 3411 section 5).
+func parseEngineID(id []byte) *Engine {
+	ret := &Engine{ID: id}
+	if len(id) < 5 {
+		return ret
+	}
+	ret.Enterprise = binary.BigEndian.Uint32(id) &^ (1 << 31)
+	ret.Vendor = vendors[ret.Enterprise]
+	if id[0]&0x80 == 0 {
+		// The SNMPv1 format: the enterprise number and 8 octets chosen by
+		// the vendor.
+		ret.Format = "legacy"
+		return ret
+	}
+	data := id[5:]
+	switch id[4] {
+	case 1:
+		ret.Format = "ipv4"
+		if len(data) == net.IPv4len {
+			ret.Data = net.IP(data).String()
+		}
+	case 2:
+		ret.Format = "ipv6"
+		if len(data) == net.IPv6len {
+			ret.Data = net.IP(data).String()
+		}
+	case 3:
+		ret.Format = "mac"
+		ret.Data = net.HardwareAddr(data).String()
+	case 4:
+		ret.Format = "text"
+		ret.Data = string(data)
+	case 5:
+		ret.Format = "octets"
+		ret.Data = fmt.Sprintf("%x", data)
+	default:
+		ret.Format = "enterprise"
+		ret.Data = fmt.Sprintf("%x", data)
+	}
+	return ret
+}
+
+// vendors names the private enterprise numbers commonly found in engine IDs.
+var vendors = map[uint32]string{
+	9:     "Cisco",
+	11:    "Hewlett-Packard",
+	43:    "3Com",
+	311:   "Microsoft",
+	674:   "Dell",
+	1991:  "Brocade (Foundry)",
+	2011:  "Huawei",
+	2021:  "UC Davis (ucd-snmp)",
+	2636:  "Juniper",
+	3375:  "F5",
+	4526:  "Netgear",
+	6876:  "VMware",
+	8072:  "Net-SNMP",
+	12356: "Fortinet",
+	14988: "MikroTik",
+	25461: "Palo Alto Networks",
+	25506: "H3C",
+	30065: "Arista",
+	41112: "Ubiquiti",
+}
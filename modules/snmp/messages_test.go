@@ -0,0 +1,132 @@
+package snmp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/zmap/zgrab2/lib/ber"
+)
+
+// getResponse returns the response of an agent to req, with the given system
+// description and name.
+func getResponse(t *testing.T, req []byte, descr, name string) []byte {
+	p, err := decodePDU(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var varBinds [][]byte
+	for _, vb := range p.varBinds {
+		oid, _ := ber.ParseOID(vb.oid)
+		var value []byte
+		switch vb.oid {
+		case systemOIDs[0]:
+			value = ber.EncodeString([]byte(descr))
+		case systemOIDs[2]:
+			value = ber.Encode(tagTimeTicks, []byte{0x01, 0x00})
+		case systemOIDs[4]:
+			value = ber.EncodeString([]byte(name))
+		case systemOIDs[6]:
+			value = ber.EncodeInt(72)
+		default:
+			value = ber.Encode(tagNoSuchObject)
+		}
+		varBinds = append(varBinds, ber.Encode(ber.TagSequence, ber.EncodeOID(oid), value))
+	}
+	return ber.Encode(ber.TagSequence,
+		ber.EncodeInt(p.version),
+		ber.EncodeString([]byte(p.community)),
+		ber.Encode(tagGetResponse, ber.EncodeInt(p.requestID), ber.EncodeInt(0), ber.EncodeInt(0), ber.Encode(ber.TagSequence, varBinds...)),
+	)
+}
+
+func TestGetRequest(t *testing.T) {
+	var oids [][]uint32
+	for _, s := range systemOIDs {
+		oid, _ := ber.ParseOID(s)
+		oids = append(oids, oid)
+	}
+	req := encodeGetRequest(versionV2c, "public", 42, oids)
+	p, err := decodePDU(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.version != versionV2c || p.community != "public" || p.tag != tagGetRequest || p.requestID != 42 || len(p.varBinds) != len(systemOIDs) {
+		t.Fatalf("wrong request: %+v", p)
+	}
+	res, err := decodePDU(getResponse(t, req, "Linux router 5.4", "router1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := System{Descr: "Linux router 5.4", UpTime: 256, Name: "router1", Services: 72}
+	if got := res.system(); *got != want {
+		t.Errorf("got system %+v, want %+v", got, want)
+	}
+}
+
+// report returns the report of an agent to a discovery request.
+func report(t *testing.T, req []byte, engineID []byte) []byte {
+	msg, _, err := ber.Decode(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := msg.Children()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := fields[1].Children()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgID, _ := header[0].Int()
+	usm := ber.Encode(ber.TagSequence, ber.EncodeString(engineID), ber.EncodeInt(3), ber.EncodeInt(86400), ber.EncodeString(nil), ber.EncodeString(nil), ber.EncodeString(nil))
+	oid, _ := ber.ParseOID("1.3.6.1.6.3.15.1.1.4.0") // usmStatsUnknownEngineIDs
+	return ber.Encode(ber.TagSequence,
+		ber.EncodeInt(versionV3),
+		ber.Encode(ber.TagSequence, ber.EncodeInt(msgID), ber.EncodeInt(maxMessageSize), ber.EncodeString([]byte{0}), ber.EncodeInt(usmSecurityModel)),
+		ber.EncodeString(usm),
+		ber.Encode(ber.TagSequence,
+			ber.EncodeString(engineID),
+			ber.EncodeString(nil),
+			ber.Encode(tagReport, ber.EncodeInt(msgID), ber.EncodeInt(0), ber.EncodeInt(0), ber.Encode(ber.TagSequence,
+				ber.Encode(ber.TagSequence, ber.EncodeOID(oid), ber.Encode(tagCounter32, []byte{1})),
+			)),
+		),
+	)
+}
+
+func TestDiscovery(t *testing.T) {
+	engineID := []byte{0x80, 0x00, 0x1f, 0x88, 0x80, 0xde, 0xad, 0xbe, 0xef}
+	msgID, engine, err := decodeDiscovery(report(t, encodeDiscovery(1234), engineID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgID != 1234 {
+		t.Errorf("got message ID %d", msgID)
+	}
+	if !bytes.Equal(engine.ID, engineID) || engine.Enterprise != 8072 || engine.Vendor != "Net-SNMP" || engine.Boots != 3 || engine.Time != 86400 {
+		t.Errorf("wrong engine: %+v", engine)
+	}
+	if engine.Format != "enterprise" || engine.Data != "deadbeef" {
+		t.Errorf("wrong engine ID format: %+v", engine)
+	}
+}
+
+func TestParseEngineID(t *testing.T) {
+	tests := []struct {
+		id     []byte
+		vendor string
+		format string
+		data   string
+	}{
+		{[]byte{0x80, 0, 0, 9, 1, 192, 0, 2, 1}, "Cisco", "ipv4", "192.0.2.1"},
+		{[]byte{0x80, 0, 0, 9, 3, 0, 0x11, 0x22, 0x33, 0x44, 0x55}, "Cisco", "mac", "00:11:22:33:44:55"},
+		{[]byte{0x80, 0, 0x0a, 0x4c, 4, 'c', 'o', 'r', 'e'}, "Juniper", "text", "core"},
+		{[]byte{0, 0, 0, 9, 1, 2, 3, 4, 5, 6, 7, 8}, "Cisco", "legacy", ""},
+	}
+	for _, test := range tests {
+		e := parseEngineID(test.id)
+		if e.Vendor != test.vendor || e.Format != test.format || e.Data != test.data {
+			t.Errorf("parseEngineID(%x) = %+v", test.id, e)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+// Package snmp provides a zgrab2 module that discovers SNMP agents.
+// Default Port: 161 (UDP)
+//
+// For SNMPv1 and SNMPv2c, the objects of the system group (sysDescr, sysName
+// and so on) are requested with each community of --communities in turn,
+// until one is answered. For SNMPv3, an unauthenticated discovery request
+// makes the agent report its engine ID, from which the vendor can often be
+// told, and its boot count and uptime.
+package snmp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/ber"
+)
+
+// Flags holds the command-line configuration for the snmp module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+
+	Communities     string        `long:"communities" default:"public,private" description:"Comma-separated list of the community strings to try with SNMPv1 and SNMPv2c."`
+	Versions        string        `long:"versions" default:"2c,1,3" description:"Comma-separated list of the SNMP versions to try, among 1, 2c and 3."`
+	ResponseTimeout time.Duration `long:"response-timeout" default:"2s" description:"How long to wait for the response to each request."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config      *Flags
+	communities []string
+	versions    []string
+	oids        [][]uint32
+}
+
+// Community is the response of an agent to a v1 or v2c request.
+type Community struct {
+	// Community is the first community string that was answered.
+	Community string `json:"community"`
+
+	// ErrorStatus is the error status of the response, if not noError. A
+	// v1 agent reports noSuchName (2) if any object is missing.
+	ErrorStatus int `json:"error_status,omitempty"`
+
+	System *System `json:"system,omitempty"`
+}
+
+// Results is the output of the snmp module.
+type Results struct {
+	V1  *Community `json:"v1,omitempty"`
+	V2c *Community `json:"v2c,omitempty"`
+	V3  *Engine    `json:"v3,omitempty"`
+}
+
+// ErrNoResponse is returned if the agent answered none of the requests.
+var ErrNoResponse = errors.New("no SNMP response")
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("snmp", "SNMP", module.Description(), 161, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Query the system group of SNMPv1/v2c agents with a list of communities, and discover SNMPv3 engines"
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var ret []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	versions := splitList(flags.Versions)
+	if len(versions) == 0 {
+		return zgrab2.ErrInvalidArguments
+	}
+	for _, v := range versions {
+		switch v {
+		case "1", "2c":
+			if len(splitList(flags.Communities)) == 0 {
+				log.Errorf("SNMP version %s requires at least one community", v)
+				return zgrab2.ErrInvalidArguments
+			}
+		case "3":
+		default:
+			log.Errorf("unknown SNMP version %q", v)
+			return zgrab2.ErrInvalidArguments
+		}
+	}
+	if flags.ResponseTimeout <= 0 {
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	scanner.communities = splitList(f.Communities)
+	scanner.versions = splitList(f.Versions)
+	scanner.oids = nil
+	for _, s := range systemOIDs {
+		oid, err := ber.ParseOID(s)
+		if err != nil {
+			return err
+		}
+		scanner.oids = append(scanner.oids, oid)
+	}
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "snmp"
+}
+
+// newID returns a random positive request ID.
+func newID() int32 {
+	var b [4]byte
+	rand.Read(b[:])
+	return int32(binary.BigEndian.Uint32(b[:]) &^ (1 << 31))
+}
+
+// exchange sends req, and returns the first response accepted by match
+// within the response timeout. Since all the requests of a scan share the
+// socket, late answers to previous requests are skipped this way.
+func (scanner *Scanner) exchange(conn net.Conn, req []byte, match func([]byte) bool) ([]byte, error) {
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(scanner.config.ResponseTimeout)
+	buf := make([]byte, maxMessageSize)
+	for {
+		// The deadline of a TimeoutConnection only holds for one read.
+		conn.SetReadDeadline(deadline)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if match(buf[:n]) {
+			return append([]byte(nil), buf[:n]...), nil
+		}
+	}
+}
+
+// isTimeout returns true if err is a read timeout.
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
+// getSystem requests the system group with each community in turn, and
+// returns the first response.
+func (scanner *Scanner) getSystem(ctx context.Context, conn net.Conn, version int) (*Community, error) {
+	for _, community := range scanner.communities {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		id := newID()
+		var response *pdu
+		_, err := scanner.exchange(conn, encodeGetRequest(version, community, id, scanner.oids), func(b []byte) bool {
+			p, err := decodePDU(b)
+			if err != nil || p.tag != tagGetResponse || p.requestID != int64(id) {
+				return false
+			}
+			response = p
+			return true
+		})
+		if isTimeout(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Community{
+			Community:   community,
+			ErrorStatus: int(response.errorStatus),
+			System:      response.system(),
+		}, nil
+	}
+	return nil, nil
+}
+
+// discoverEngine sends a v3 discovery request, and returns the reported
+// engine.
+func (scanner *Scanner) discoverEngine(conn net.Conn) (*Engine, error) {
+	id := newID()
+	var engine *Engine
+	_, err := scanner.exchange(conn, encodeDiscovery(id), func(b []byte) bool {
+		msgID, e, err := decodeDiscovery(b)
+		if err != nil || msgID != int64(id) {
+			return false
+		}
+		engine = e
+		return true
+	})
+	if isTimeout(err) {
+		return nil, nil
+	}
+	return engine, err
+}
+
+// Scan tries each configured version in turn. It succeeds if the agent
+// answered at least one request.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	results := new(Results)
+	for _, version := range scanner.versions {
+		switch version {
+		case "1":
+			results.V1, err = scanner.getSystem(ctx, conn, versionV1)
+		case "2c":
+			results.V2c, err = scanner.getSystem(ctx, conn, versionV2c)
+		case "3":
+			results.V3, err = scanner.discoverEngine(conn)
+		}
+		if err != nil {
+			break
+		}
+	}
+	if results.V1 == nil && results.V2c == nil && results.V3 == nil {
+		if err == nil {
+			return zgrab2.SCAN_IO_TIMEOUT, nil, ErrNoResponse
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,51 @@
+package snmp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// agent returns the handler of a fake agent answering v2c requests with the
+// community "secret" and v3 discovery requests.
+func agent(t *testing.T) func(req []byte) []byte {
+	return func(req []byte) []byte {
+		if p, err := decodePDU(req); err == nil {
+			if p.version == versionV2c && p.community == "secret" {
+				return getResponse(t, req, "test agent", "agent1")
+			}
+			return nil
+		}
+		return report(t, req, []byte{0x80, 0, 0, 9, 4, 'x'})
+	}
+}
+
+func TestScan(t *testing.T) {
+	server, err := testserver.NewUDP(agent(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	flags := &Flags{
+		Communities:     "public,secret",
+		Versions:        "1,2c,3",
+		ResponseTimeout: 200 * time.Millisecond,
+	}
+	flags.Timeout = time.Second
+	if err := flags.Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	results := zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*Results)
+	if results.V1 != nil {
+		t.Errorf("got a v1 response: %+v", results.V1)
+	}
+	if results.V2c == nil || results.V2c.Community != "secret" || results.V2c.System.Descr != "test agent" || results.V2c.System.Name != "agent1" {
+		t.Errorf("wrong v2c response: %+v", results.V2c)
+	}
+	if results.V3 == nil || results.V3.Vendor != "Cisco" || results.V3.Data != "x" {
+		t.Errorf("wrong v3 engine: %+v", results.V3)
+	}
+}
@@ -0,0 +1,260 @@
+// Package ssdp provides a zgrab2 module that sends an SSDP M-SEARCH request
+// to UPnP devices, and optionally fetches their device description.
+// Default Port: 1900 (UDP)
+//
+// The scanner sends a unicast M-SEARCH request for the --st search target,
+// and parses the HTTP-like response: the LOCATION of the device description,
+// the SERVER (the OS, UPnP version and product), and the USN of the device.
+// With --fetch-description, it then fetches the description over HTTP, from
+// the port and path of the LOCATION on the scanned host, and parses the
+// device: its friendly name, manufacturer and model, its services, and its
+// embedded devices.
+package ssdp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/jsonapi"
+)
+
+// Flags holds the command-line configuration for the ssdp module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+
+	ST               string `long:"st" default:"upnp:rootdevice" description:"Search target of the M-SEARCH request, such as ssdp:all"`
+	FetchDescription bool   `long:"fetch-description" description:"Fetch and parse the device description at the LOCATION of the response"`
+	UserAgent        string `long:"user-agent" default:"Mozilla/5.0 zgrab/0.x" description:"Set a custom user agent"`
+	MaxSize          int    `long:"max-size" default:"256" description:"Max kilobytes of the device description to read"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Service is a service of a device.
+type Service struct {
+	ServiceType string `json:"service_type,omitempty" xml:"serviceType"`
+	ServiceID   string `json:"service_id,omitempty" xml:"serviceId"`
+	ControlURL  string `json:"control_url,omitempty" xml:"controlURL"`
+	EventSubURL string `json:"event_sub_url,omitempty" xml:"eventSubURL"`
+	SCPDURL     string `json:"scpd_url,omitempty" xml:"SCPDURL"`
+}
+
+// Device is a device of the device description.
+type Device struct {
+	DeviceType       string `json:"device_type,omitempty" xml:"deviceType"`
+	FriendlyName     string `json:"friendly_name,omitempty" xml:"friendlyName"`
+	Manufacturer     string `json:"manufacturer,omitempty" xml:"manufacturer"`
+	ManufacturerURL  string `json:"manufacturer_url,omitempty" xml:"manufacturerURL"`
+	ModelDescription string `json:"model_description,omitempty" xml:"modelDescription"`
+	ModelName        string `json:"model_name,omitempty" xml:"modelName"`
+	ModelNumber      string `json:"model_number,omitempty" xml:"modelNumber"`
+	ModelURL         string `json:"model_url,omitempty" xml:"modelURL"`
+	SerialNumber     string `json:"serial_number,omitempty" xml:"serialNumber"`
+	UDN              string `json:"udn,omitempty" xml:"UDN"`
+	PresentationURL  string `json:"presentation_url,omitempty" xml:"presentationURL"`
+
+	Services []Service `json:"services,omitempty" xml:"serviceList>service"`
+	Devices  []Device  `json:"devices,omitempty" xml:"deviceList>device"`
+}
+
+// description is the root of the device description.
+type description struct {
+	Device Device `xml:"device"`
+}
+
+// Results is the output of the ssdp module.
+type Results struct {
+	StatusCode int `json:"status_code"`
+
+	Location string `json:"location,omitempty"`
+	Server   string `json:"server,omitempty"`
+	USN      string `json:"usn,omitempty"`
+	ST       string `json:"st,omitempty"`
+
+	// Headers holds the headers of the response, by canonical name.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Device is the device of the description, with --fetch-description, and
+	// DescriptionError the error of the fetch.
+	Device           *Device `json:"device,omitempty"`
+	DescriptionError string  `json:"description_error,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("ssdp", "SSDP", module.Description(), 1900, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Send an SSDP M-SEARCH request to a UPnP device, and optionally fetch its device description"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "ssdp"
+}
+
+// search returns the M-SEARCH request.
+func (scanner *Scanner) search() []byte {
+	return []byte("M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: " + scanner.config.ST + "\r\n" +
+		"USER-AGENT: " + scanner.config.UserAgent + "\r\n\r\n")
+}
+
+// describe fetches and parses the device description at location, from the
+// scanned host.
+func (scanner *Scanner) describe(ctx context.Context, target zgrab2.ScanTarget, location string) (*Device, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported location scheme %q", u.Scheme)
+	}
+	port := uint(80)
+	if u.Port() != "" {
+		p, err := strconv.ParseUint(u.Port(), 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		port = uint(p)
+	}
+	target.Port = &port
+	client := &jsonapi.Client{
+		Target:    &target,
+		BaseFlags: &scanner.config.BaseFlags,
+		UserAgent: scanner.config.UserAgent,
+		MaxSize:   scanner.config.MaxSize * 1024,
+	}
+	resp, err := client.Do(ctx, "GET", u.RequestURI(), http.Header{"Accept": {"text/xml, */*"}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.OK() {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	desc := new(description)
+	if err := xml.Unmarshal(resp.Body, desc); err != nil {
+		return nil, err
+	}
+	return &desc.Device, nil
+}
+
+// Scan sends the M-SEARCH request, and reads the response, then fetches the
+// device description with --fetch-description. The scan fails if the
+// response is not an HTTP response.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write(scanner.search()); err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	buf := make([]byte, 65536)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+	if err != nil {
+		return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+	}
+	resp.Body.Close()
+	results := &Results{
+		StatusCode: resp.StatusCode,
+		Location:   resp.Header.Get("Location"),
+		Server:     resp.Header.Get("Server"),
+		USN:        resp.Header.Get("Usn"),
+		ST:         resp.Header.Get("St"),
+		Headers:    make(map[string]string),
+	}
+	for name := range resp.Header {
+		results.Headers[name] = resp.Header.Get(name)
+	}
+	if scanner.config.FetchDescription && results.Location != "" {
+		results.Device, err = scanner.describe(ctx, target, results.Location)
+		if err != nil {
+			log.Debugf("ssdp: fetching the description of %s failed: %v", target.String(), err)
+			results.DescriptionError = err.Error()
+		}
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
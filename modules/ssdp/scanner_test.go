@@ -0,0 +1,112 @@
+package ssdp
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+const deviceDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+<specVersion><major>1</major><minor>0</minor></specVersion>
+<device>
+<deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+<friendlyName>Home Router</friendlyName>
+<manufacturer>Example Networks</manufacturer>
+<modelName>EX-1000</modelName>
+<modelNumber>1.2</modelNumber>
+<UDN>uuid:11111111-2222-3333-4444-555555555555</UDN>
+<serviceList>
+<service>
+<serviceType>urn:schemas-upnp-org:service:Layer3Forwarding:1</serviceType>
+<serviceId>urn:upnp-org:serviceId:L3Forwarding1</serviceId>
+<controlURL>/ctl/L3F</controlURL>
+<eventSubURL>/evt/L3F</eventSubURL>
+<SCPDURL>/L3F.xml</SCPDURL>
+</service>
+</serviceList>
+<deviceList>
+<device>
+<deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+<friendlyName>WANDevice</friendlyName>
+</device>
+</deviceList>
+</device>
+</root>`
+
+func TestSearch(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rootDesc.xml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(deviceDescription))
+	}))
+	defer httpServer.Close()
+	port := strconv.Itoa(httpServer.Listener.Addr().(*net.TCPAddr).Port)
+
+	requests := make(chan string, 1)
+	server, err := testserver.NewUDP(func(request []byte) []byte {
+		select {
+		case requests <- string(request):
+		default:
+		}
+		// The LOCATION is fetched from the scanned host, whatever its host.
+		return []byte("HTTP/1.1 200 OK\r\n" +
+			"CACHE-CONTROL: max-age=120\r\n" +
+			"ST: upnp:rootdevice\r\n" +
+			"USN: uuid:11111111-2222-3333-4444-555555555555::upnp:rootdevice\r\n" +
+			"EXT:\r\n" +
+			"SERVER: Linux/3.14 UPnP/1.1 MiniUPnPd/2.1\r\n" +
+			"LOCATION: http://192.168.1.1:" + port + "/rootDesc.xml\r\n\r\n")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	flags := &Flags{ST: "upnp:rootdevice", FetchDescription: true, UserAgent: "zgrab/0.x", MaxSize: 256}
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), flags, server.Addr())
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	request := <-requests
+	if !strings.HasPrefix(request, "M-SEARCH * HTTP/1.1\r\n") || !strings.Contains(request, "MAN: \"ssdp:discover\"\r\n") || !strings.Contains(request, "ST: upnp:rootdevice\r\n") {
+		t.Errorf("got request %q", request)
+	}
+	results := ret.(*Results)
+	if results.StatusCode != 200 || results.Server != "Linux/3.14 UPnP/1.1 MiniUPnPd/2.1" || results.USN != "uuid:11111111-2222-3333-4444-555555555555::upnp:rootdevice" || results.Headers["Cache-Control"] != "max-age=120" {
+		t.Errorf("got %+v", results)
+	}
+	device := results.Device
+	if device == nil {
+		t.Fatalf("got no device, error %q", results.DescriptionError)
+	}
+	if device.FriendlyName != "Home Router" || device.ModelName != "EX-1000" || device.Manufacturer != "Example Networks" || device.UDN != "uuid:11111111-2222-3333-4444-555555555555" {
+		t.Errorf("got device %+v", device)
+	}
+	if len(device.Services) != 1 || device.Services[0].ControlURL != "/ctl/L3F" || len(device.Devices) != 1 || device.Devices[0].FriendlyName != "WANDevice" {
+		t.Errorf("got device %+v", device)
+	}
+}
+
+func TestInvalidResponse(t *testing.T) {
+	server, err := testserver.NewUDP(func([]byte) []byte {
+		return []byte("\x00\x01garbage")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	status, _, err := zgrab2test.Scan(t, new(Scanner), &Flags{ST: "ssdp:all"}, server.Addr())
+	if status != zgrab2.SCAN_PROTOCOL_ERROR || err == nil {
+		t.Errorf("got status %s, error %v", status, err)
+	}
+}
@@ -1,12 +1,15 @@
 package modules
 
 import (
+	"context"
+	"errors"
 	"net"
 	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/auth"
 	"github.com/zmap/zgrab2/lib/ssh"
 )
 
@@ -17,10 +20,13 @@ type SSHFlags struct {
 	HostKeyAlgorithms string `long:"host-key-algorithms" description:"Set SSH Host Key Algorithms"`
 	Ciphers           string `long:"ciphers" description:"A comma-separated list of which ciphers to offer."`
 	CollectUserAuth   bool   `long:"userauth" description:"Use the 'none' authentication request to see what userauth methods are allowed"`
+	Username          string `long:"username" description:"The username of the 'none' authentication request of --userauth"`
+	CredsFile         string `long:"creds-file" description:"File of credentials (host username:password... per line, as for the http module) attempted in turn with the password or keyboard-interactive method after the 'none' authentication request"`
 	GexMinBits        uint   `long:"gex-min-bits" description:"The minimum number of bits for the DH GEX prime." default:"1024"`
 	GexMaxBits        uint   `long:"gex-max-bits" description:"The maximum number of bits for the DH GEX prime." default:"8192"`
 	GexPreferredBits  uint   `long:"gex-preferred-bits" description:"The preferred number of bits for the DH GEX prime." default:"2048"`
 	HelloOnly         bool   `long:"hello-only" description:"Limit scan to the initial hello message"`
+	AllHostKeys       bool   `long:"all-host-keys" description:"Collect every host key of the server, with one more handshake for each other host key algorithm it supports"`
 	Verbose           bool   `long:"verbose" description:"Output additional information, including SSH client properties from the SSH handshake."`
 }
 
@@ -29,6 +35,7 @@ type SSHModule struct {
 
 type SSHScanner struct {
 	config *SSHFlags
+	creds  *auth.Credentials
 }
 
 func init() {
@@ -51,6 +58,11 @@ func (m *SSHModule) NewScanner() zgrab2.Scanner {
 	return new(SSHScanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (m *SSHModule) NewResults() interface{} {
+	return new(ssh.HandshakeLog)
+}
+
 // Description returns an overview of this module.
 func (m *SSHModule) Description() string {
 	return "Fetch an SSH server banner and collect key exchange information"
@@ -67,6 +79,13 @@ func (f *SSHFlags) Help() string {
 func (s *SSHScanner) Init(flags zgrab2.ScanFlags) error {
 	f, _ := flags.(*SSHFlags)
 	s.config = f
+	if f.CredsFile != "" {
+		creds, err := auth.ReadFile(f.CredsFile)
+		if err != nil {
+			return err
+		}
+		s.creds = creds
+	}
 	return nil
 }
 
@@ -82,19 +101,12 @@ func (s *SSHScanner) GetTrigger() string {
 	return s.config.Trigger
 }
 
-func (s *SSHScanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	data := new(ssh.HandshakeLog)
-
-	var port uint
-	// If the port is supplied in ScanTarget, let that override the cmdline option
-	if t.Port != nil {
-		port = *t.Port
-	} else {
-		port = s.config.Port
-	}
-	portStr := strconv.FormatUint(uint64(port), 10)
-	rhost := net.JoinHostPort(t.Host(), portStr)
+// errHostKeyCollected interrupts the handshakes of --all-host-keys once the
+// host key is received.
+var errHostKeyCollected = errors.New("host key collected")
 
+// newConfig returns the client configuration of the flags, logging to data.
+func (s *SSHScanner) newConfig(data *ssh.HandshakeLog) *ssh.ClientConfig {
 	sshConfig := ssh.MakeSSHConfig()
 	sshConfig.Timeout = s.config.Timeout
 	sshConfig.ConnLog = data
@@ -110,15 +122,101 @@ func (s *SSHScanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{},
 		log.Fatal(err)
 	}
 	sshConfig.Verbose = s.config.Verbose
-	sshConfig.DontAuthenticate = s.config.CollectUserAuth
 	sshConfig.GexMinBits = s.config.GexMinBits
 	sshConfig.GexMaxBits = s.config.GexMaxBits
 	sshConfig.GexPreferredBits = s.config.GexPreferredBits
+	return sshConfig
+}
+
+// handshake runs an SSH handshake with rhost on a new connection, dialed
+// like that of any other module.
+func (s *SSHScanner) handshake(ctx context.Context, t zgrab2.ScanTarget, rhost string, sshConfig *ssh.ClientConfig) error {
+	conn, err := t.Open(ctx, &s.config.BaseFlags)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, _, _, err = ssh.NewClientConn(conn, rhost, sshConfig)
+	return err
+}
+
+// collectHostKeys returns the host keys of the server for the host key
+// algorithms of the flags that it supports, other than the one negotiated by
+// the handshake logged in data, each with a handshake offering only that
+// algorithm.
+func (s *SSHScanner) collectHostKeys(ctx context.Context, t zgrab2.ScanTarget, rhost string, data *ssh.HandshakeLog) []ssh.HostKey {
+	supported := make(map[string]bool)
+	for _, alg := range data.ServerKex.ServerHostKeyAlgos {
+		supported[alg] = true
+	}
+	delete(supported, data.AlgorithmSelection.HostKey)
+	var keys []ssh.HostKey
+	for _, alg := range strings.Split(s.config.HostKeyAlgorithms, ",") {
+		if !supported[alg] {
+			continue
+		}
+		// Each algorithm is offered once.
+		delete(supported, alg)
+		var key ssh.PublicKey
+		sshConfig := s.newConfig(new(ssh.HandshakeLog))
+		sshConfig.HostKeyAlgorithms = []string{alg}
+		sshConfig.HostKeyCallback = func(hostname string, remote net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errHostKeyCollected
+		}
+		err := s.handshake(ctx, t, rhost, sshConfig)
+		hostKey := ssh.HostKey{Algorithm: alg}
+		if key != nil {
+			hostKey.Key = ssh.LogServerHostKey(key.Marshal())
+		} else if err != nil {
+			hostKey.Error = err.Error()
+		}
+		keys = append(keys, hostKey)
+	}
+	return keys
+}
+
+func (s *SSHScanner) Scan(ctx context.Context, t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	data := new(ssh.HandshakeLog)
+
+	var port uint
+	// If the port is supplied in ScanTarget, let that override the cmdline option
+	if t.Port != nil {
+		port = *t.Port
+	} else {
+		port = s.config.Port
+	}
+	portStr := strconv.FormatUint(uint64(port), 10)
+	rhost := net.JoinHostPort(t.Host(), portStr)
+
+	sshConfig := s.newConfig(data)
+	sshConfig.DontAuthenticate = s.config.CollectUserAuth
+	sshConfig.User = s.config.Username
+	for _, cred := range s.creds.For(&t, s.config.Port) {
+		// Bearer tokens have no use in ssh.
+		if cred.Token == "" {
+			sshConfig.Credentials = append(sshConfig.Credentials, ssh.Credential{User: cred.Username, Password: cred.Password})
+		}
+	}
+	if len(sshConfig.Credentials) > 0 {
+		sshConfig.DontAuthenticate = true
+	}
 	sshConfig.BannerCallback = func(banner string) error {
 		data.Banner = strings.TrimSpace(banner)
 		return nil
 	}
-	_, err := ssh.Dial("tcp", rhost, sshConfig)
+	var hostKey ssh.PublicKey
+	sshConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKey = key
+		return nil
+	}
+	err := s.handshake(ctx, t, rhost, sshConfig)
+	if s.config.AllHostKeys && hostKey != nil {
+		data.HostKeys = append([]ssh.HostKey{{
+			Algorithm: data.AlgorithmSelection.HostKey,
+			Key:       ssh.LogServerHostKey(hostKey.Marshal()),
+		}}, s.collectHostKeys(ctx, t, rhost, data)...)
+	}
 	// TODO FIXME: Distinguish error types
 	status := zgrab2.TryGetScanStatus(err)
 	return status, data, err
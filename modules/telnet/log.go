@@ -30,6 +30,16 @@ type TelnetLog struct {
 
 	// Dont is the list of options that the server requests the client *not* use.
 	Dont []TelnetOption `json:"dont,omitempty"`
+
+	// Negotiation is the transcript of the option commands and subnegotiations sent by the server and the client.
+	Negotiation []Negotiation `json:"negotiation,omitempty"`
+
+	// BannerType is the classification of the banner: BannerLoginPrompt, BannerPasswordPrompt, BannerShell,
+	// BannerMenu or BannerOther.
+	BannerType string `json:"banner_type,omitempty"`
+
+	// Login is the outcome of the login attempt, if --username or --password is set.
+	Login *LoginLog `json:"login,omitempty"`
 }
 
 // isTelnet checks if this struct represents having actually detected a Telnet service.
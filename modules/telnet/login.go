@@ -0,0 +1,167 @@
+package telnet
+
+import (
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zmap/zgrab2"
+)
+
+// Classifications of a banner (or of the response to a login step), by its
+// last line.
+const (
+	BannerLoginPrompt    = "login_prompt"
+	BannerPasswordPrompt = "password_prompt"
+	BannerShell          = "shell"
+	BannerMenu           = "menu"
+	BannerOther          = "other"
+)
+
+// responseIdleTimeout is how long to wait for more data after a part of a
+// response.
+const responseIdleTimeout = 500 * time.Millisecond
+
+var (
+	escapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+	passwordPrompt = regexp.MustCompile(`(?i)pass(word|code|phrase)?\s*:?\s*$`)
+	loginPrompt    = regexp.MustCompile(`(?i)(login|user\s*name|user|account)\s*:?\s*$`)
+	menuItem       = regexp.MustCompile(`^\s*[\[(]?\d{1,2}[\]).:-]\s*\S`)
+	menuPrompt     = regexp.MustCompile(`(?i)(choice|option|selection|select)\b.*$`)
+	shellPrompt    = regexp.MustCompile(`[$#>%]\s*$`)
+	loginFailure   = regexp.MustCompile(`(?i)incorrect|failed|failure|invalid|denied|bad password|wrong`)
+)
+
+// LoginStep is an input sent during the login attempt, and the response to
+// it.
+type LoginStep struct {
+	// Input is "username" or "password" (their values are not recorded).
+	Input string `json:"input"`
+
+	// Response is the text returned by the server after the input.
+	Response string `json:"response,omitempty"`
+
+	// ResponseType is the classification of the response.
+	ResponseType string `json:"response_type,omitempty"`
+
+	// ResponseTimeMS is the time until the first byte of the response, in
+	// milliseconds.
+	ResponseTimeMS int64 `json:"response_time_ms"`
+}
+
+// LoginLog is the outcome of a login attempt.
+type LoginLog struct {
+	Username string `json:"username,omitempty"`
+
+	Steps []LoginStep `json:"steps,omitempty"`
+
+	// Success is true if the last response is a shell prompt or a menu,
+	// without a failure message.
+	Success bool `json:"success"`
+
+	// Error is set if the attempt could not be completed.
+	Error string `json:"error,omitempty"`
+}
+
+// classifyBanner classifies banner by its last non-empty line (and, for
+// menus, its numbered lines).
+func classifyBanner(banner string) string {
+	banner = escapeSequence.ReplaceAllString(banner, "")
+	lines := strings.Split(strings.Replace(banner, "\r", "\n", -1), "\n")
+	var last string
+	menuItems := 0
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			last = line
+		}
+		if menuItem.MatchString(line) {
+			menuItems++
+		}
+	}
+	switch {
+	case last == "":
+		return ""
+	case passwordPrompt.MatchString(last):
+		return BannerPasswordPrompt
+	case loginPrompt.MatchString(last):
+		return BannerLoginPrompt
+	case menuItems >= 2 || menuPrompt.MatchString(last):
+		return BannerMenu
+	case shellPrompt.MatchString(last):
+		return BannerShell
+	}
+	return BannerOther
+}
+
+// readResponse reads the response to an input, stripping and answering the
+// commands, until it is idle for responseIdleTimeout. It returns the
+// response and the time until its first byte.
+func (n *negotiator) readResponse(conn net.Conn, maxReadSize int) (string, time.Duration, error) {
+	start := time.Now()
+	buf := make([]byte, READ_BUFFER_LENGTH)
+	numBytes, err := conn.Read(buf)
+	elapsed := time.Since(start)
+	if err != nil {
+		return "", elapsed, err
+	}
+	conn.SetReadDeadline(time.Now().Add(responseIdleTimeout))
+	rest, err := zgrab2.ReadAvailableWithOptions(conn, READ_BUFFER_LENGTH, responseIdleTimeout, 0, maxReadSize-numBytes)
+	if err != nil && err != io.EOF && !zgrab2.IsTimeoutError(err) {
+		return "", elapsed, err
+	}
+	data, reply, err := n.process(append(buf[:numBytes], rest...))
+	if err != nil {
+		return "", elapsed, err
+	}
+	if len(reply) > 0 {
+		if _, err := conn.Write(reply); err != nil {
+			return string(data), elapsed, err
+		}
+	}
+	return string(data), elapsed, nil
+}
+
+// step sends input (the value of the step named name) and appends the step
+// to ret.
+func (n *negotiator) step(conn net.Conn, ret *LoginLog, name string, input string, maxReadSize int) (string, error) {
+	if _, err := conn.Write([]byte(input + "\r\n")); err != nil {
+		return "", err
+	}
+	response, elapsed, err := n.readResponse(conn, maxReadSize)
+	responseType := classifyBanner(response)
+	ret.Steps = append(ret.Steps, LoginStep{
+		Input:          name,
+		Response:       response,
+		ResponseType:   responseType,
+		ResponseTimeMS: int64(elapsed / time.Millisecond),
+	})
+	return responseType, err
+}
+
+// login attempts to log in with username (if the banner is a login prompt)
+// and password, after the banner.
+func (n *negotiator) login(conn net.Conn, username, password string, maxReadSize int) *LoginLog {
+	ret := &LoginLog{Username: username}
+	prompt := n.log.BannerType
+	var err error
+	if prompt == BannerLoginPrompt {
+		if prompt, err = n.step(conn, ret, "username", username, maxReadSize); err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+	}
+	if prompt == BannerPasswordPrompt {
+		if prompt, err = n.step(conn, ret, "password", password, maxReadSize); err != nil {
+			ret.Error = err.Error()
+			return ret
+		}
+	} else if len(ret.Steps) == 0 {
+		ret.Error = "no login prompt"
+		return ret
+	}
+	last := ret.Steps[len(ret.Steps)-1]
+	ret.Success = (prompt == BannerShell || prompt == BannerMenu) && !loginFailure.MatchString(last.Response)
+	return ret
+}
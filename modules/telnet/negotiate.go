@@ -0,0 +1,234 @@
+package telnet
+
+import (
+	"bytes"
+	"errors"
+	"net"
+)
+
+const (
+	// SE is the end of a subnegotiation.
+	SE = byte(0xf0)
+
+	// SB is the start of a subnegotiation.
+	SB = byte(0xfa)
+)
+
+// Options with subnegotiations answered by the client.
+const (
+	// optionTerminalType is TERMINAL-TYPE (RFC 1091).
+	optionTerminalType = byte(24)
+
+	// optionNAWS is NAWS, the negotiation of the window size (RFC 1073).
+	optionNAWS = byte(31)
+
+	terminalTypeIs   = byte(0)
+	terminalTypeSend = byte(1)
+)
+
+// Senders of a Negotiation.
+const (
+	SenderServer = "server"
+	SenderClient = "client"
+)
+
+var commandNames = map[byte]string{
+	WILL: "WILL",
+	WONT: "WONT",
+	DO:   "DO",
+	DONT: "DONT",
+	SB:   "SB",
+}
+
+// nawsSize is the window size sent with NAWS: 80 columns, 24 rows.
+var nawsSize = []byte{0, 80, 0, 24}
+
+// Negotiation is an option command (or subnegotiation) sent by the server
+// or the client.
+type Negotiation struct {
+	// Sender is SenderServer or SenderClient.
+	Sender string `json:"sender"`
+
+	// Command is WILL, WONT, DO, DONT or SB.
+	Command string `json:"command"`
+
+	Option TelnetOption `json:"option"`
+
+	// Data are the parameters of a subnegotiation.
+	Data []byte `json:"data,omitempty"`
+}
+
+// negotiator strips the commands from the data received, answering the
+// option commands of the server with its policy, and records them in a
+// TelnetLog.
+type negotiator struct {
+	log *TelnetLog
+
+	// accept are the options the client agrees to (with DO to WILL, and WILL
+	// to DO); the others are refused.
+	accept map[byte]bool
+
+	// terminalType is sent in the TERMINAL-TYPE subnegotiation.
+	terminalType string
+
+	// answered are the commands already answered, to avoid negotiation
+	// loops.
+	answered map[[2]byte]bool
+
+	// pending is an incomplete command at the end of the data processed.
+	pending []byte
+}
+
+// newNegotiator returns a negotiator recording into log, agreeing to the
+// options of accept (which may be nil to refuse all of them).
+func newNegotiator(log *TelnetLog, accept map[byte]bool, terminalType string) *negotiator {
+	return &negotiator{
+		log:          log,
+		accept:       accept,
+		terminalType: terminalType,
+		answered:     make(map[[2]byte]bool),
+	}
+}
+
+// record appends a Negotiation to the log.
+func (n *negotiator) record(sender string, command byte, option byte, data []byte) {
+	n.log.Negotiation = append(n.log.Negotiation, Negotiation{
+		Sender:  sender,
+		Command: commandNames[command],
+		Option:  TelnetOption(option),
+		Data:    data,
+	})
+}
+
+// option returns the reply to an option command of the server, or nil if
+// it was already answered.
+func (n *negotiator) option(command byte, option byte) []byte {
+	n.record(SenderServer, command, option, nil)
+	opt := TelnetOption(option)
+	switch command {
+	case WILL:
+		n.log.Will = append(n.log.Will, opt)
+	case DO:
+		n.log.Do = append(n.log.Do, opt)
+	case WONT:
+		n.log.Wont = append(n.log.Wont, opt)
+	case DONT:
+		n.log.Dont = append(n.log.Dont, opt)
+	}
+	key := [2]byte{command, option}
+	if n.answered[key] {
+		return nil
+	}
+	n.answered[key] = true
+	var ret byte
+	switch command {
+	case WILL:
+		ret = DONT
+		if n.accept[option] {
+			ret = DO
+		}
+	case DO:
+		ret = WONT
+		if n.accept[option] {
+			ret = WILL
+		}
+	case WONT:
+		ret = DONT
+	case DONT:
+		ret = WONT
+	}
+	n.record(SenderClient, ret, option, nil)
+	reply := []byte{IAC, ret, option}
+	if ret == WILL && option == optionNAWS {
+		reply = append(reply, n.subnegotiation(option, nawsSize)...)
+	}
+	return reply
+}
+
+// subnegotiation records a subnegotiation sent by the client, and returns
+// it.
+func (n *negotiator) subnegotiation(option byte, data []byte) []byte {
+	n.record(SenderClient, SB, option, data)
+	ret := append([]byte{IAC, SB, option}, bytes.Replace(data, []byte{IAC}, []byte{IAC, IAC}, -1)...)
+	return append(ret, IAC, SE)
+}
+
+// process strips the commands from data, and returns the remaining data
+// and the reply to the commands. An incomplete command at the end of data
+// is kept for the next call.
+func (n *negotiator) process(data []byte) (out []byte, reply []byte, err error) {
+	buf := append(append([]byte{}, n.pending...), data...)
+	n.pending = nil
+	for i := 0; i < len(buf); {
+		if buf[i] != IAC {
+			out = append(out, buf[i])
+			i++
+			continue
+		}
+		if i+1 == len(buf) {
+			n.pending = buf[i:]
+			break
+		}
+		switch command := buf[i+1]; command {
+		case IAC:
+			out = append(out, IAC)
+			i += 2
+		case WILL, WONT, DO, DONT:
+			if i+2 == len(buf) {
+				n.pending = buf[i:]
+				return out, reply, nil
+			}
+			reply = append(reply, n.option(command, buf[i+2])...)
+			i += 3
+		case SB:
+			end := bytes.Index(buf[i:], []byte{IAC, SE})
+			if end == -1 {
+				if len(buf)-i > READ_BUFFER_LENGTH {
+					return out, reply, errors.New("Telnet subnegotiation too long")
+				}
+				n.pending = buf[i:]
+				return out, reply, nil
+			}
+			if sub := buf[i+2 : i+end]; len(sub) > 0 {
+				option, params := sub[0], bytes.Replace(sub[1:], []byte{IAC, IAC}, []byte{IAC}, -1)
+				n.record(SenderServer, SB, option, params)
+				if option == optionTerminalType && n.accept[option] && len(params) > 0 && params[0] == terminalTypeSend {
+					reply = append(reply, n.subnegotiation(option, append([]byte{terminalTypeIs}, n.terminalType...))...)
+				}
+			}
+			i += end + 2
+		default:
+			// The other commands (e.g. GO_AHEAD) have no option.
+			i += 2
+		}
+	}
+	return out, reply, nil
+}
+
+// negotiate answers the option commands received on conn until other data
+// is received, which is the start of the banner.
+func (n *negotiator) negotiate(conn net.Conn) error {
+	readBuffer := make([]byte, READ_BUFFER_LENGTH)
+	for {
+		numBytes, err := conn.Read(readBuffer)
+		if err != nil {
+			return err
+		}
+		if numBytes == len(readBuffer) {
+			return errors.New("Not enough buffer space for telnet options")
+		}
+		data, reply, err := n.process(readBuffer[:numBytes])
+		if err != nil {
+			return err
+		}
+		if len(reply) > 0 {
+			if _, err = conn.Write(reply); err != nil {
+				return err
+			}
+		}
+		if len(data) > 0 {
+			n.log.Banner = string(data)
+			return nil
+		}
+	}
+}
@@ -8,10 +8,19 @@
 // same behavior as the original zgrab.
 //
 // The output contains the banner and the negotiated options, in the same
-// format as the original zgrab.
+// format as the original zgrab, along with the transcript of the
+// negotiation and the classification of the banner (login or password
+// prompt, shell or menu).
+//
+// The options are refused unless listed in --accept-options. With
+// --username and/or --password, a login is attempted after the banner.
 package telnet
 
 import (
+	"context"
+	"strconv"
+	"strings"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
 )
@@ -23,6 +32,11 @@ type Flags struct {
 	MaxReadSize int  `long:"max-read-size" description:"Set the maximum number of bytes to read when grabbing the banner" default:"65536"`
 	Banner      bool `long:"force-banner" description:"Always return banner if it has non-zero bytes"`
 	Verbose     bool `long:"verbose" description:"More verbose logging, include debug fields in the scan results"`
+
+	AcceptOptions string `long:"accept-options" description:"Comma-separated option codes to agree to when the server offers or requests them (e.g. 1,3,24,31 for ECHO, SUPPRESS-GO-AHEAD, TERMINAL-TYPE and NAWS); the others are refused"`
+	TerminalType  string `long:"terminal-type" description:"Terminal type to send if TERMINAL-TYPE (24) is accepted" default:"xterm"`
+	Username      string `long:"username" description:"Username to send at a login prompt"`
+	Password      string `long:"password" description:"Password to send at a password prompt. WARNING: This is sent in the clear."`
 }
 
 // Module implements the zgrab2.Module interface.
@@ -32,6 +46,7 @@ type Module struct {
 // Scanner implements the zgrab2.Scanner interface.
 type Scanner struct {
 	config *Flags
+	accept map[byte]bool
 }
 
 // RegisterModule registers the zgrab2 module.
@@ -53,6 +68,11 @@ func (module *Module) NewScanner() zgrab2.Scanner {
 	return new(Scanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(TelnetLog)
+}
+
 // Description returns an overview of this module.
 func (module *Module) Description() string {
 	return "Fetch a telnet banner"
@@ -62,9 +82,29 @@ func (module *Module) Description() string {
 // On success, returns nil.
 // On failure, returns an error instance describing the error.
 func (flags *Flags) Validate(args []string) error {
+	if _, err := parseOptions(flags.AcceptOptions); err != nil {
+		log.Errorf("invalid --accept-options: %s", err)
+		return zgrab2.ErrInvalidArguments
+	}
 	return nil
 }
 
+// parseOptions parses a comma-separated list of option codes.
+func parseOptions(options string) (map[byte]bool, error) {
+	ret := make(map[byte]bool)
+	for _, option := range strings.Split(options, ",") {
+		if option = strings.TrimSpace(option); option == "" {
+			continue
+		}
+		code, err := strconv.ParseUint(option, 10, 8)
+		if err != nil {
+			return nil, err
+		}
+		ret[byte(code)] = true
+	}
+	return ret, nil
+}
+
 // Help returns the module's help string.
 func (flags *Flags) Help() string {
 	return ""
@@ -74,6 +114,11 @@ func (flags *Flags) Help() string {
 func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 	f, _ := flags.(*Flags)
 	scanner.config = f
+	accept, err := parseOptions(f.AcceptOptions)
+	if err != nil {
+		return err
+	}
+	scanner.accept = accept
 	return nil
 }
 
@@ -97,20 +142,25 @@ func (scanner *Scanner) Protocol() string {
 	return "telnet"
 }
 
-// Scan connects to the target (default port TCP 23) and attempts to grab the Telnet banner.
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	conn, err := target.Open(&scanner.config.BaseFlags)
+// Scan connects to the target (default port TCP 23) and attempts to grab the Telnet banner, then to log in if
+// --username or --password is set.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
 	defer conn.Close()
 	result := new(TelnetLog)
-	if err := GetTelnetBanner(result, conn, scanner.config.MaxReadSize); err != nil {
+	n := newNegotiator(result, scanner.accept, scanner.config.TerminalType)
+	if err := getBanner(n, conn, scanner.config.MaxReadSize); err != nil {
 		if scanner.config.Banner && len(result.Banner) > 0 {
 			return zgrab2.TryGetScanStatus(err), result, err
 		} else {
 			return zgrab2.TryGetScanStatus(err), result.getResult(), err
 		}
 	}
+	if scanner.config.Username != "" || scanner.config.Password != "" {
+		result.Login = n.login(conn, scanner.config.Username, scanner.config.Password, scanner.config.MaxReadSize)
+	}
 	return zgrab2.SCAN_SUCCESS, result, nil
 }
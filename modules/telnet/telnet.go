@@ -18,7 +18,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net"
 	"time"
@@ -95,21 +94,38 @@ func (opt *TelnetOption) UnmarshalJSON(b []byte) error {
 // GetTelnetBanner attempts to negotiate the options and fetch the telnet banner over the given connection, reading at
 // most maxReadSize bytes.
 func GetTelnetBanner(logStruct *TelnetLog, conn net.Conn, maxReadSize int) (err error) {
-	if err = NegotiateOptions(logStruct, conn); err != nil {
+	return getBanner(newNegotiator(logStruct, nil, ""), conn, maxReadSize)
+}
+
+// getBanner negotiates the options with n and fetches the banner, reading at most maxReadSize bytes, then classifies
+// it.
+func getBanner(n *negotiator, conn net.Conn, maxReadSize int) (err error) {
+	logStruct := n.log
+	if err = n.negotiate(conn); err != nil {
 		return err
 	}
 	// Keep reading until READ_BUFFER_LENGTH chunks until
 	// 	(a) a read takes longer than 500ms
 	//  (b) the combined reads take longer than the configured timeout for the connection (--timeout command line flag)
 	//  (c) the banner is maxReadSize bytes long [taking into account the fact that logStruct.Banner may already have some data from NegotiateOptions]
+	if bannerType := classifyBanner(logStruct.Banner); bannerType == BannerLoginPrompt || bannerType == BannerPasswordPrompt {
+		// The server is waiting for input, so do not wait for the full timeout.
+		conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	}
 	bannerSlice, err := zgrab2.ReadAvailableWithOptions(conn, READ_BUFFER_LENGTH, 500*time.Millisecond, 0, maxReadSize-len(logStruct.Banner))
 	if bannerSlice != nil {
-		// If there is an IAC embedded in the "banner", ignore bytes from that point on.
-		if iacIndex := getIACIndex(bannerSlice); iacIndex != -1 {
-			bannerSlice = bannerSlice[0:iacIndex]
+		// Answer the commands embedded in the "banner", and strip them.
+		data, reply, processErr := n.process(bannerSlice)
+		if processErr != nil {
+			return processErr
+		}
+		if len(reply) > 0 {
+			if _, writeErr := conn.Write(reply); writeErr != nil {
+				return writeErr
+			}
 		}
 		// append to any data we already read during NegotiateOptions
-		logStruct.Banner += string(bannerSlice)
+		logStruct.Banner += string(data)
 	}
 	// Timeouts on the first read are feasible, since the banner may have been read during the negotiation, so ignore them.
 	if err != nil && err != io.EOF && !zgrab2.IsTimeoutError(err) {
@@ -119,89 +135,13 @@ func GetTelnetBanner(logStruct *TelnetLog, conn net.Conn, maxReadSize int) (err
 	if !logStruct.isTelnet() {
 		return zgrab2.NewScanError(zgrab2.SCAN_PROTOCOL_ERROR, errors.New("Invalid response for Telnet"))
 	}
+	logStruct.BannerType = classifyBanner(logStruct.Banner)
 	return nil
 }
 
-// NegotiateOptions attempts to negotiate the connection options over the given connection.
+// NegotiateOptions attempts to negotiate the connection options over the given connection, refusing all options.
 func NegotiateOptions(logStruct *TelnetLog, conn net.Conn) error {
-	var readBuffer, retBuffer []byte
-	var option, optionType, returnOptionType byte
-	var iacIndex, firstUnreadIndex, numBytes, numDataBytes int
-	var err error
-
-	for finishedNegotiating := false; finishedNegotiating == false; {
-		readBuffer = make([]byte, READ_BUFFER_LENGTH)
-		retBuffer = nil
-		numBytes, err = conn.Read(readBuffer)
-		numDataBytes = numBytes
-
-		if err != nil {
-			return err
-		}
-
-		if numBytes == len(readBuffer) {
-			return errors.New("Not enough buffer space for telnet options")
-		}
-
-		// Negotiate options
-
-		for iacIndex = getIACIndex(readBuffer); iacIndex != -1; iacIndex = getIACIndex(readBuffer) {
-			firstUnreadIndex = 0
-			optionType = readBuffer[iacIndex+1]
-			option = readBuffer[iacIndex+2]
-
-			// ignore go ahead
-			if optionType == GO_AHEAD {
-				readBuffer = readBuffer[0:iacIndex]
-				numBytes = iacIndex
-				firstUnreadIndex = 0
-				break
-			}
-
-			// record all offered options
-			opt := TelnetOption(option)
-			if optionType == WILL {
-				logStruct.Will = append(logStruct.Will, opt)
-			} else if optionType == DO {
-				logStruct.Do = append(logStruct.Do, opt)
-			} else if optionType == WONT {
-				logStruct.Wont = append(logStruct.Wont, opt)
-			} else if optionType == DONT {
-				logStruct.Dont = append(logStruct.Dont, opt)
-			}
-
-			// reject all offered options
-			if optionType == WILL || optionType == WONT {
-				returnOptionType = DONT
-			} else if optionType == DO || optionType == DONT {
-				returnOptionType = WONT
-			} else {
-				return errors.New("Unsupported telnet IAC option type" + fmt.Sprintf("%d", optionType))
-			}
-
-			retBuffer = append(retBuffer, IAC)
-			retBuffer = append(retBuffer, returnOptionType)
-			retBuffer = append(retBuffer, option)
-
-			firstUnreadIndex = iacIndex + IAC_CMD_LENGTH
-			numDataBytes -= firstUnreadIndex
-			readBuffer = readBuffer[firstUnreadIndex:]
-		}
-
-		if _, err = conn.Write(retBuffer); err != nil {
-			return err
-		}
-
-		numIACBytes := numBytes - numDataBytes
-		finishedNegotiating = numBytes != numIACBytes
-	}
-
-	// no more IAC commands, just read the resulting data
-	if numDataBytes >= 0 {
-		logStruct.Banner = string(readBuffer[0:numDataBytes])
-	}
-
-	return nil
+	return newNegotiator(logStruct, nil, "").negotiate(conn)
 }
 
 func getIACIndex(buffer []byte) int {
@@ -0,0 +1,137 @@
+package telnet
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+func TestClassifyBanner(t *testing.T) {
+	tests := map[string]string{
+		"":                                       "",
+		"Ubuntu 18.04\r\nlogin: ":                BannerLoginPrompt,
+		"User Name : ":                           BannerLoginPrompt,
+		"\x1b[2JPassword:":                       BannerPasswordPrompt,
+		"BusyBox v1.19.4 built-in shell\r\n# ":   BannerShell,
+		"Router>":                                BannerShell,
+		"1. Status\r\n2. Reboot\r\n3. Exit\r\n>": BannerMenu,
+		"Enter your choice: ":                    BannerMenu,
+		"Welcome\r\n":                            BannerOther,
+	}
+	for banner, expected := range tests {
+		if ret := classifyBanner(banner); ret != expected {
+			t.Errorf("%q: got %q, expected %q", banner, ret, expected)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	log := new(TelnetLog)
+	n := newNegotiator(log, map[byte]bool{optionNAWS: true}, "")
+	data, reply, err := n.process([]byte{'a', IAC, IAC, IAC, DO, optionNAWS, IAC, WILL, 1, 'b', IAC, DO})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a\xffb" {
+		t.Errorf("got data %q", data)
+	}
+	expected := []byte{IAC, WILL, optionNAWS, IAC, SB, optionNAWS, 0, 80, 0, 24, IAC, SE, IAC, DONT, 1}
+	if !bytes.Equal(reply, expected) {
+		t.Errorf("got reply %v", reply)
+	}
+	// The incomplete command is completed by the next data, and DO NAWS is
+	// not answered again.
+	data, reply, err = n.process([]byte{optionNAWS})
+	if err != nil || len(data) != 0 || len(reply) != 0 {
+		t.Errorf("got data %q, reply %v, error %v", data, reply, err)
+	}
+	if len(log.Negotiation) != 6 || len(log.Do) != 2 || len(log.Will) != 1 {
+		t.Errorf("got log %+v", log)
+	}
+}
+
+// handle serves a connection, with TERMINAL-TYPE and ECHO, and a login
+// accepting root:secret.
+func handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	conn.Write([]byte{IAC, DO, optionTerminalType, IAC, WILL, 1})
+	reply := make([]byte, 6)
+	if _, err := io.ReadFull(r, reply); err != nil || !bytes.Equal(reply, []byte{IAC, WILL, optionTerminalType, IAC, DO, 1}) {
+		return
+	}
+	conn.Write([]byte{IAC, SB, optionTerminalType, terminalTypeSend, IAC, SE})
+	reply = make([]byte, 11)
+	if _, err := io.ReadFull(r, reply); err != nil || string(reply[4:9]) != "xterm" {
+		return
+	}
+	for {
+		conn.Write([]byte("Login: "))
+		username, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("Password: "))
+		password, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if username == "root\r\n" && password == "secret\r\n" {
+			conn.Write([]byte("\r\nBusyBox v1.19.4 built-in shell\r\n# "))
+			r.ReadString('\n')
+			return
+		}
+		conn.Write([]byte("\r\nLogin incorrect\r\n"))
+	}
+}
+
+func TestLogin(t *testing.T) {
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		handle(conn)
+		return nil
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	for _, password := range []string{"wrong", "secret"} {
+		flags := &Flags{
+			MaxReadSize:   65536,
+			AcceptOptions: "1,24",
+			TerminalType:  "xterm",
+			Username:      "root",
+			Password:      password,
+		}
+		result := zgrab2test.MustScan(t, new(Scanner), flags, server.Addr()).(*TelnetLog)
+		if result.Banner != "Login: " || result.BannerType != BannerLoginPrompt {
+			t.Errorf("got banner %q (%s)", result.Banner, result.BannerType)
+		}
+		negotiation := []Negotiation{
+			{Sender: SenderServer, Command: "DO", Option: TelnetOption(optionTerminalType)},
+			{Sender: SenderClient, Command: "WILL", Option: TelnetOption(optionTerminalType)},
+			{Sender: SenderServer, Command: "WILL", Option: 1},
+			{Sender: SenderClient, Command: "DO", Option: 1},
+			{Sender: SenderServer, Command: "SB", Option: TelnetOption(optionTerminalType), Data: []byte{terminalTypeSend}},
+			{Sender: SenderClient, Command: "SB", Option: TelnetOption(optionTerminalType), Data: []byte("\x00xterm")},
+		}
+		if !reflect.DeepEqual(result.Negotiation, negotiation) {
+			t.Errorf("got negotiation %+v", result.Negotiation)
+		}
+		login := result.Login
+		if login == nil || len(login.Steps) != 2 || login.Steps[0].ResponseType != BannerPasswordPrompt {
+			t.Fatalf("got login %+v", login)
+		}
+		success := password == "secret"
+		if login.Success != success {
+			t.Errorf("password %s: got login %+v", password, login)
+		}
+		if success && login.Steps[1].ResponseType != BannerShell {
+			t.Errorf("got login %+v", login)
+		}
+	}
+}
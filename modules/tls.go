@@ -1,6 +1,8 @@
 package modules
 
 import (
+	"context"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
 )
@@ -33,6 +35,11 @@ func (m *TLSModule) NewScanner() zgrab2.Scanner {
 	return new(TLSScanner)
 }
 
+// NewResults returns a new, empty instance of the scan results.
+func (m *TLSModule) NewResults() interface{} {
+	return new(zgrab2.TLSLog)
+}
+
 // Description returns an overview of this module.
 func (m *TLSModule) Description() string {
 	return "Perform a TLS handshake"
@@ -71,8 +78,8 @@ func (s *TLSScanner) InitPerSender(senderID int) error {
 // a TLS handshake. If the handshake gets past the ServerHello stage, the
 // handshake log is returned (along with any other TLS-related logs, such as
 // heartbleed, if enabled).
-func (s *TLSScanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	conn, err := t.OpenTLS(&s.config.BaseFlags, &s.config.TLSFlags)
+func (s *TLSScanner) Scan(ctx context.Context, t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := t.OpenTLS(ctx, &s.config.BaseFlags, &s.config.TLSFlags)
 	if conn != nil {
 		defer conn.Close()
 	}
@@ -0,0 +1,317 @@
+// Package vnc provides a zgrab2 module that scans for VNC servers, speaking
+// the Remote Framebuffer (RFB) protocol of RFC 6143.
+// Default Port: 5900 (TCP)
+//
+// The scanner reads the protocol version banner, answers with the highest
+// version both sides support, and records the security types the server
+// offers. If the server offers the None type and --desktop-name is set, the
+// handshake is completed to read the desktop name and framebuffer size.
+package vnc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// securityNone is the security type without authentication.
+const securityNone = 1
+
+// maxStringSize bounds the length of the failure reason and desktop name.
+const maxStringSize = 4096
+
+// securityTypeNames names the security types registered with IANA.
+var securityTypeNames = map[uint8]string{
+	0:   "Invalid",
+	1:   "None",
+	2:   "VNC Authentication",
+	5:   "RA2",
+	6:   "RA2ne",
+	16:  "Tight",
+	17:  "Ultra",
+	18:  "TLS",
+	19:  "VeNCrypt",
+	20:  "GTK-VNC SASL",
+	21:  "MD5 hash authentication",
+	22:  "Colin Dean xvp",
+	30:  "Apple Remote Desktop",
+	113: "UltraVNC MS-Logon II",
+}
+
+// ErrInvalidBanner is returned if the server does not send an RFB version.
+var ErrInvalidBanner = errors.New("invalid RFB protocol version")
+
+// Flags holds the command-line configuration for the vnc module.
+type Flags struct {
+	zgrab2.BaseFlags
+
+	DesktopName bool `long:"desktop-name" description:"If the server offers the None security type, complete the handshake to read the desktop name and framebuffer size."`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// SecurityType is a security type offered by the server.
+type SecurityType struct {
+	ID   uint8  `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+// Results is the output of the vnc module.
+type Results struct {
+	// Banner is the protocol version sent by the server.
+	Banner string `json:"banner"`
+
+	// ProtocolVersion is the version the handshake used, among 3.3, 3.7 and
+	// 3.8.
+	ProtocolVersion string `json:"protocol_version,omitempty"`
+
+	// SecurityTypes lists the security types offered. A server speaking
+	// version 3.3 imposes a single type.
+	SecurityTypes []SecurityType `json:"security_types,omitempty"`
+
+	// NoAuth is true if the server offers the None security type, letting
+	// anyone view and control the desktop.
+	NoAuth bool `json:"no_auth"`
+
+	// Failure is the reason the server gave for refusing the connection.
+	Failure string `json:"failure,omitempty"`
+
+	// DesktopName and the framebuffer size, if the handshake was completed.
+	DesktopName       string `json:"desktop_name,omitempty"`
+	FramebufferWidth  uint16 `json:"framebuffer_width,omitempty"`
+	FramebufferHeight uint16 `json:"framebuffer_height,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("vnc", "VNC", module.Description(), 5900, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Read the RFB version and security types of a VNC server, flagging servers without authentication"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "vnc"
+}
+
+// clientVersion returns the minor version of the protocol to use with a
+// server sending the given version: RFC 6143 only defines 3.3, 3.7 and 3.8,
+// and other versions (such as 3.4 and 3.6 of UltraVNC) are treated as 3.3.
+// Later versions (such as 3.889 of Apple) get 3.8.
+func clientVersion(major, minor int) int {
+	switch {
+	case major > 3 || major == 3 && minor >= 8:
+		return 8
+	case minor == 7:
+		return 7
+	}
+	return 3
+}
+
+// readString reads a string prefixed by its 32-bit length.
+func readString(r io.Reader) (string, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	if length > maxStringSize {
+		return "", zgrab2.NewScanError(zgrab2.SCAN_PROTOCOL_ERROR, fmt.Errorf("string too long (%d bytes)", length))
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// readSecurityTypes reads the security types offered by the server, or the
+// reason for the failure if it offers none.
+func readSecurityTypes(r io.Reader, minor int, results *Results) error {
+	var types []byte
+	if minor == 3 {
+		var t uint32
+		if err := binary.Read(r, binary.BigEndian, &t); err != nil {
+			return err
+		}
+		if t != 0 {
+			types = []byte{byte(t)}
+		}
+	} else {
+		count := make([]byte, 1)
+		if _, err := io.ReadFull(r, count); err != nil {
+			return err
+		}
+		types = make([]byte, count[0])
+		if _, err := io.ReadFull(r, types); err != nil {
+			return err
+		}
+	}
+	if len(types) == 0 {
+		reason, err := readString(r)
+		if err != nil {
+			return err
+		}
+		results.Failure = reason
+		return nil
+	}
+	for _, t := range types {
+		results.SecurityTypes = append(results.SecurityTypes, SecurityType{ID: t, Name: securityTypeNames[t]})
+		if t == securityNone {
+			results.NoAuth = true
+		}
+	}
+	return nil
+}
+
+// readDesktop selects the None security type, and reads the desktop name and
+// framebuffer size from the ServerInit message.
+func readDesktop(conn net.Conn, minor int, results *Results) error {
+	if minor != 3 {
+		if _, err := conn.Write([]byte{securityNone}); err != nil {
+			return err
+		}
+	}
+	if minor == 8 {
+		// Version 3.8 sends a SecurityResult even for the None type.
+		var result uint32
+		if err := binary.Read(conn, binary.BigEndian, &result); err != nil {
+			return err
+		}
+		if result != 0 {
+			reason, err := readString(conn)
+			if err != nil {
+				return err
+			}
+			results.Failure = reason
+			return nil
+		}
+	}
+	// ClientInit, asking to share the desktop with other clients.
+	if _, err := conn.Write([]byte{1}); err != nil {
+		return err
+	}
+	var init struct {
+		Width, Height uint16
+		PixelFormat   [16]byte
+	}
+	if err := binary.Read(conn, binary.BigEndian, &init); err != nil {
+		return err
+	}
+	name, err := readString(conn)
+	if err != nil {
+		return err
+	}
+	results.FramebufferWidth = init.Width
+	results.FramebufferHeight = init.Height
+	results.DesktopName = name
+	return nil
+}
+
+// Scan performs the following:
+//  1. Read the protocol version sent by the server.
+//  2. Send the version to use.
+//  3. Read the security types, or the failure reason.
+//  4. With --desktop-name, if the None type is offered, select it and read
+//     the ServerInit message.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	banner := make([]byte, 12)
+	if _, err := io.ReadFull(conn, banner); err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	results := &Results{Banner: string(banner)}
+	var major, minor int
+	if n, _ := fmt.Sscanf(string(banner), "RFB %03d.%03d\n", &major, &minor); n != 2 {
+		return zgrab2.SCAN_PROTOCOL_ERROR, results, ErrInvalidBanner
+	}
+	minor = clientVersion(major, minor)
+	results.ProtocolVersion = fmt.Sprintf("3.%d", minor)
+	if _, err := fmt.Fprintf(conn, "RFB 003.%03d\n", minor); err != nil {
+		return zgrab2.TryGetScanStatus(err), results, err
+	}
+	if err := readSecurityTypes(conn, minor, results); err != nil {
+		return zgrab2.TryGetScanStatus(err), results, err
+	}
+	if scanner.config.DesktopName && results.NoAuth {
+		if err := readDesktop(conn, minor, results); err != nil {
+			return zgrab2.TryGetScanStatus(err), results, err
+		}
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
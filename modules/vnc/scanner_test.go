@@ -0,0 +1,106 @@
+package vnc
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// serverInit is a ServerInit message for a 1024x768 desktop named "test".
+var serverInit = append([]byte{
+	4, 0, 3, 0, // width, height
+	32, 24, 0, 1, 0, 255, 0, 255, 0, 255, 16, 8, 0, 0, 0, 0, // pixel format
+	0, 0, 0, 4,
+}, "test"...)
+
+// serve returns a handler sending each of replies after reading the next
+// message expected from the client, once the server has sent version: the
+// version, the selected security type (except for version 3.3) and the
+// ClientInit.
+func serve(version string, replies ...[]byte) func(conn net.Conn) error {
+	sizes := []int{12, 1, 1}
+	if version == "RFB 003.003\n" {
+		sizes = []int{12, 1}
+	}
+	return func(conn net.Conn) error {
+		for i, reply := range replies {
+			if _, err := io.ReadFull(conn, make([]byte, sizes[i])); err != nil {
+				return err
+			}
+			conn.Write(reply)
+		}
+		return nil
+	}
+}
+
+func scan(t *testing.T, desktopName bool, version string, replies ...[]byte) (zgrab2.ScanStatus, *Results, error) {
+	server, err := testserver.New(testserver.Config{
+		Banner:   []byte(version),
+		Handler:  serve(version, replies...),
+		KeepOpen: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), &Flags{DesktopName: desktopName}, server.Addr())
+	results, _ := ret.(*Results)
+	return status, results, err
+}
+
+func TestSecurityTypes(t *testing.T) {
+	status, results, err := scan(t, false, "RFB 003.889\n", []byte{2, 2, 30})
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	expected := []SecurityType{{2, "VNC Authentication"}, {30, "Apple Remote Desktop"}}
+	if results.ProtocolVersion != "3.8" || results.NoAuth || !reflect.DeepEqual(results.SecurityTypes, expected) {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestDesktopName(t *testing.T) {
+	status, results, err := scan(t, true, "RFB 003.008\n", []byte{2, 1, 2}, []byte{0, 0, 0, 0}, serverInit)
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if !results.NoAuth || results.DesktopName != "test" || results.FramebufferWidth != 1024 || results.FramebufferHeight != 768 {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestVersion33(t *testing.T) {
+	status, results, err := scan(t, true, "RFB 003.003\n", []byte{0, 0, 0, 1}, serverInit)
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if results.ProtocolVersion != "3.3" || !results.NoAuth || results.DesktopName != "test" {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestFailure(t *testing.T) {
+	reason := "Too many security failures"
+	reply := make([]byte, 5)
+	binary.BigEndian.PutUint32(reply[1:], uint32(len(reason)))
+	status, results, err := scan(t, false, "RFB 003.007\n", append(reply, reason...))
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if results.Failure != reason || len(results.SecurityTypes) != 0 {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestInvalidBanner(t *testing.T) {
+	status, _, err := scan(t, false, "SSH-2.0-Open")
+	if status != zgrab2.SCAN_PROTOCOL_ERROR || err != ErrInvalidBanner {
+		t.Errorf("got status %s, error %v", status, err)
+	}
+}
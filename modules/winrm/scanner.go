@@ -0,0 +1,213 @@
+// Package winrm provides a zgrab2 module that sends the WS-Management
+// Identify request to WinRM services, and records the authentication
+// schemes they offer.
+// Default Port: 5985 (TCP)
+//
+// The scanner posts the Identify request to --path, over HTTPS if
+// --use-https is set (as on port 5986). The request is marked as
+// unauthenticated, which Windows answers with the protocol version and the
+// product vendor and version, without the OS version. The scanner then posts
+// it without the mark, and records the challenges of the 401 response: the
+// schemes of the service, such as Negotiate, Kerberos, CredSSP, or Basic.
+package winrm
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/lib/http"
+	"github.com/zmap/zgrab2/lib/http/httpauth"
+	"github.com/zmap/zgrab2/lib/jsonapi"
+)
+
+// identifyRequest is the WS-Management Identify request.
+const identifyRequest = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:wsmid="http://schemas.dmtf.org/wbem/wsman/identity/1/wsmanidentity.xsd"><s:Header/><s:Body><wsmid:Identify/></s:Body></s:Envelope>`
+
+// Flags holds the command-line configuration for the winrm module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.TLSFlags
+
+	Path      string `long:"path" default:"/wsman" description:"Path of the WS-Management endpoint"`
+	UseHTTPS  bool   `long:"use-https" description:"Perform an HTTPS connection on the initial host"`
+	UserAgent string `long:"user-agent" default:"Mozilla/5.0 zgrab/0.x" description:"Set a custom user agent"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Identify is the response to the Identify request.
+type Identify struct {
+	ProtocolVersion  string   `json:"protocol_version,omitempty" xml:"Body>IdentifyResponse>ProtocolVersion"`
+	ProductVendor    string   `json:"product_vendor,omitempty" xml:"Body>IdentifyResponse>ProductVendor"`
+	ProductVersion   string   `json:"product_version,omitempty" xml:"Body>IdentifyResponse>ProductVersion"`
+	SecurityProfiles []string `json:"security_profiles,omitempty" xml:"Body>IdentifyResponse>SecurityProfiles>SecurityProfileName"`
+}
+
+// Results is the output of the winrm module.
+type Results struct {
+	// IdentifyStatusCode is the status code of the response to the
+	// unauthenticated Identify request, and Identify the response.
+	IdentifyStatusCode int       `json:"identify_status_code,omitempty"`
+	Identify           *Identify `json:"identify,omitempty"`
+
+	// Server is the Server header, such as Microsoft-HTTPAPI/2.0.
+	Server string `json:"server,omitempty"`
+
+	// StatusCode is the status code of the response to the Identify request
+	// without the unauthenticated mark, and Challenges the challenges of the
+	// response. AuthSchemes lists their schemes.
+	StatusCode  int                  `json:"status_code,omitempty"`
+	Challenges  []httpauth.Challenge `json:"challenges,omitempty"`
+	AuthSchemes []string             `json:"auth_schemes,omitempty"`
+
+	// TLSLog is the log of the TLS handshake, with --use-https.
+	TLSLog *zgrab2.TLSLog `json:"tls,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("winrm", "WinRM", module.Description(), 5985, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Send the WS-Management Identify request to a WinRM service, and read its product version and authentication schemes"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "winrm"
+}
+
+// identify posts the Identify request, marked as unauthenticated if
+// unauthenticated is set.
+func (scanner *Scanner) identify(ctx context.Context, client *jsonapi.Client, unauthenticated bool) (*jsonapi.Response, error) {
+	header := map[string][]string{
+		"Content-Type": {"application/soap+xml;charset=UTF-8"},
+		"Accept":       {"*/*"},
+	}
+	if unauthenticated {
+		header["WSMANIDENTIFY"] = []string{"unauthenticated"}
+	}
+	return client.Do(ctx, "POST", scanner.config.Path, header, []byte(identifyRequest))
+}
+
+// challenges records the challenges of a 401 response.
+func (results *Results) challenges(resp *jsonapi.Response) {
+	results.StatusCode = resp.StatusCode
+	if resp.StatusCode != http.StatusUnauthorized {
+		return
+	}
+	results.Challenges = httpauth.Challenges(&http.Response{StatusCode: resp.StatusCode, Header: http.Header(resp.Header)})
+	for _, c := range results.Challenges {
+		results.AuthSchemes = append(results.AuthSchemes, c.Scheme)
+	}
+}
+
+// Scan posts the unauthenticated Identify request, then the Identify request
+// without the mark, unless the first response was already a 401. The scan
+// fails if the first request gets no HTTP response.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	client := &jsonapi.Client{
+		Target:    &target,
+		BaseFlags: &scanner.config.BaseFlags,
+		TLSFlags:  &scanner.config.TLSFlags,
+		UseTLS:    scanner.config.UseHTTPS,
+		UserAgent: scanner.config.UserAgent,
+	}
+	results := new(Results)
+	resp, err := scanner.identify(ctx, client, true)
+	results.TLSLog = client.TLSLog
+	if resp == nil {
+		if results.TLSLog != nil {
+			return zgrab2.TryGetScanStatus(err), results, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	results.IdentifyStatusCode = resp.StatusCode
+	results.Server = resp.Header.Get("Server")
+	if resp.OK() && bytes.Contains(resp.Body, []byte("IdentifyResponse")) {
+		identify := new(Identify)
+		if err := xml.Unmarshal(resp.Body, identify); err == nil {
+			results.Identify = identify
+		} else {
+			log.Debugf("winrm: invalid Identify response from %s: %v", target.String(), err)
+		}
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		resp, err = scanner.identify(ctx, client, false)
+		if err != nil {
+			log.Debugf("winrm: authenticated Identify request to %s failed: %v", target.String(), err)
+		}
+	}
+	if resp != nil {
+		results.challenges(resp)
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,61 @@
+package winrm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+)
+
+const identifyResponse = `<s:Envelope xml:lang="en-US" xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Header/><s:Body><wsmid:IdentifyResponse xmlns:wsmid="http://schemas.dmtf.org/wbem/wsman/identity/1/wsmanidentity.xsd"><wsmid:ProtocolVersion>http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd</wsmid:ProtocolVersion><wsmid:ProductVendor>Microsoft Corporation</wsmid:ProductVendor><wsmid:ProductVersion>OS: 0.0.0 SP: 0.0 Stack: 3.0</wsmid:ProductVersion><wsmid:SecurityProfiles><wsmid:SecurityProfileName>http://schemas.dmtf.org/wbem/wsman/1/wsman/secprofile/http/spnego-kerberos</wsmid:SecurityProfileName></wsmid:SecurityProfiles></wsmid:IdentifyResponse></s:Body></s:Envelope>`
+
+func scan(t *testing.T, handler http.HandlerFunc) *Results {
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	flags := &Flags{Path: "/wsman"}
+	return zgrab2test.MustScan(t, new(Scanner), flags, server.Listener.Addr().String()).(*Results)
+}
+
+func TestIdentify(t *testing.T) {
+	results := scan(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "Microsoft-HTTPAPI/2.0")
+		if r.Method != "POST" || r.URL.Path != "/wsman" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("WSMANIDENTIFY") != "unauthenticated" {
+			w.Header().Add("WWW-Authenticate", "Negotiate")
+			w.Header().Add("WWW-Authenticate", `Basic realm="WSMAN"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/soap+xml;charset=UTF-8")
+		w.Write([]byte(identifyResponse))
+	})
+	expected := &Identify{
+		ProtocolVersion:  "http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd",
+		ProductVendor:    "Microsoft Corporation",
+		ProductVersion:   "OS: 0.0.0 SP: 0.0 Stack: 3.0",
+		SecurityProfiles: []string{"http://schemas.dmtf.org/wbem/wsman/1/wsman/secprofile/http/spnego-kerberos"},
+	}
+	if results.IdentifyStatusCode != http.StatusOK || !reflect.DeepEqual(results.Identify, expected) || results.Server != "Microsoft-HTTPAPI/2.0" {
+		t.Errorf("got %+v, identify %+v", results, results.Identify)
+	}
+	if results.StatusCode != http.StatusUnauthorized || !reflect.DeepEqual(results.AuthSchemes, []string{"negotiate", "basic"}) || results.Challenges[1].Realm != "WSMAN" {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestIdentifyRequiresAuth(t *testing.T) {
+	requests := 0
+	results := scan(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("WWW-Authenticate", "Negotiate")
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	if requests != 1 || results.Identify != nil || results.IdentifyStatusCode != http.StatusUnauthorized || !reflect.DeepEqual(results.AuthSchemes, []string{"negotiate"}) {
+		t.Errorf("got %d requests, %+v", requests, results)
+	}
+}
@@ -0,0 +1,261 @@
+// Package wireguard provides a zgrab2 module that sends a WireGuard handshake
+// initiation with a random key, and records how the endpoint answers.
+// Default Port: 51820 (UDP)
+//
+// WireGuard endpoints drop the messages of unknown peers, so a handshake
+// initiation from a random key normally gets no answer. Without the public
+// key of the endpoint, the mac1 field of the initiation is random, and the
+// endpoint drops it before any processing. With --public-key, mac1 is valid,
+// and an endpoint under load answers with a cookie reply. The scanner
+// records the response, if any, the ICMP port unreachable error of a closed
+// port, or the silence of the endpoint, with the round-trip time of the
+// answer.
+package wireguard
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+	"golang.org/x/crypto/blake2s"
+)
+
+// The message types.
+const (
+	msgInitiation  = 1
+	msgResponse    = 2
+	msgCookieReply = 3
+	msgTransport   = 4
+)
+
+// The lengths of the handshake initiation, and of its fields up to mac1.
+const (
+	initiationLength = 148
+	mac1Offset       = 116
+)
+
+// labelMAC1 is the label of the key of mac1.
+const labelMAC1 = "mac1----"
+
+// messageNames names the message types.
+var messageNames = map[byte]string{
+	msgInitiation:  "handshake_initiation",
+	msgResponse:    "handshake_response",
+	msgCookieReply: "cookie_reply",
+	msgTransport:   "transport_data",
+}
+
+// Flags holds the command-line configuration for the wireguard module.
+type Flags struct {
+	zgrab2.BaseFlags
+	zgrab2.UDPFlags
+
+	PublicKey string `long:"public-key" description:"Base64 public key of the endpoint, to send a valid mac1"`
+
+	publicKey []byte
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results is the output of the wireguard module.
+type Results struct {
+	// Response is the type of the response: handshake_response,
+	// cookie_reply, or the number of another type. ResponseLength is its
+	// length.
+	Response       string `json:"response,omitempty"`
+	ResponseLength int    `json:"response_length,omitempty"`
+
+	// ReceiverIndex is true if the receiver index of the response is the
+	// sender index of the initiation.
+	ReceiverIndex bool `json:"receiver_index,omitempty"`
+
+	// PortUnreachable is true if an ICMP port unreachable error was received,
+	// and Silent if nothing was received before the timeout.
+	PortUnreachable bool `json:"port_unreachable,omitempty"`
+	Silent          bool `json:"silent,omitempty"`
+
+	// RTTSeconds is the time between the initiation and the response or ICMP
+	// error.
+	RTTSeconds float64 `json:"rtt_seconds,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("wireguard", "WireGuard", module.Description(), 51820, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Send a WireGuard handshake initiation with a random key, and record the response or silence of the endpoint"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	if flags.PublicKey == "" {
+		return nil
+	}
+	key, err := base64.StdEncoding.DecodeString(flags.PublicKey)
+	if err != nil || len(key) != 32 {
+		log.Errorf("--public-key must be a base64 key of 32 bytes")
+		return zgrab2.ErrInvalidArguments
+	}
+	flags.publicKey = key
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "wireguard"
+}
+
+// mac1 returns the mac1 of msg for publicKey: the keyed BLAKE2s-128 of msg,
+// with the BLAKE2s-256 of the label and the key as key.
+func mac1(publicKey, msg []byte) []byte {
+	key := blake2s.Sum256(append([]byte(labelMAC1), publicKey...))
+	h, _ := blake2s.New128(key[:])
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// encodeInitiation returns a handshake initiation from senderIndex, with a
+// random ephemeral key, encrypted static key and timestamp, the mac1 of
+// publicKey if it is not nil, and no mac2.
+func encodeInitiation(senderIndex uint32, publicKey []byte) []byte {
+	buf := make([]byte, initiationLength)
+	buf[0] = msgInitiation
+	binary.LittleEndian.PutUint32(buf[4:], senderIndex)
+	rand.Read(buf[8:mac1Offset])
+	if publicKey != nil {
+		copy(buf[mac1Offset:], mac1(publicKey, buf[:mac1Offset]))
+	} else {
+		rand.Read(buf[mac1Offset : mac1Offset+16])
+	}
+	return buf
+}
+
+// isRefused returns true if err is the error of an ICMP port unreachable.
+func isRefused(err error) bool {
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+	sysErr, ok := opErr.Err.(*os.SyscallError)
+	return ok && sysErr.Err == syscall.ECONNREFUSED
+}
+
+// Scan sends the handshake initiation, and waits for an answer. An endpoint
+// answering with an ICMP error, or nothing, is reported with the results and
+// the error of the read.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.OpenUDP(ctx, &scanner.config.BaseFlags, &scanner.config.UDPFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	var index [4]byte
+	rand.Read(index[:])
+	senderIndex := binary.LittleEndian.Uint32(index[:])
+	start := time.Now()
+	if _, err := conn.Write(encodeInitiation(senderIndex, scanner.config.publicKey)); err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	results := new(Results)
+	if err != nil {
+		if isRefused(err) {
+			results.PortUnreachable = true
+			results.RTTSeconds = time.Since(start).Seconds()
+			return zgrab2.SCAN_CONNECTION_REFUSED, results, err
+		}
+		if status := zgrab2.TryGetScanStatus(err); status == zgrab2.SCAN_IO_TIMEOUT {
+			results.Silent = true
+			return status, results, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	results.RTTSeconds = time.Since(start).Seconds()
+	buf = buf[:n]
+	results.ResponseLength = n
+	if n < 4 {
+		return zgrab2.SCAN_PROTOCOL_ERROR, results, fmt.Errorf("response of %d bytes", n)
+	}
+	results.Response = messageNames[buf[0]]
+	if results.Response == "" {
+		results.Response = fmt.Sprintf("%d", buf[0])
+	}
+	switch {
+	case buf[0] == msgResponse && n >= 12:
+		// The sender index, then the receiver index.
+		results.ReceiverIndex = binary.LittleEndian.Uint32(buf[8:]) == senderIndex
+	case buf[0] == msgCookieReply && n >= 8:
+		results.ReceiverIndex = binary.LittleEndian.Uint32(buf[4:]) == senderIndex
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
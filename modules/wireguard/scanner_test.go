@@ -0,0 +1,88 @@
+package wireguard
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+func scan(t *testing.T, addr string, publicKey string, timeout time.Duration) (zgrab2.ScanStatus, *Results, error) {
+	flags := &Flags{BaseFlags: zgrab2.BaseFlags{Timeout: timeout}, PublicKey: publicKey}
+	if err := flags.Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), flags, addr)
+	results, _ := ret.(*Results)
+	return status, results, err
+}
+
+func TestCookieReply(t *testing.T) {
+	publicKey := bytes.Repeat([]byte{0x42}, 32)
+	server, err := testserver.NewUDP(func(buf []byte) []byte {
+		if len(buf) != initiationLength || buf[0] != msgInitiation {
+			return nil
+		}
+		// Endpoints under load answer initiations with a valid mac1 with a
+		// cookie reply.
+		if !bytes.Equal(buf[mac1Offset:mac1Offset+16], mac1(publicKey, buf[:mac1Offset])) {
+			return nil
+		}
+		reply := make([]byte, 64)
+		reply[0] = msgCookieReply
+		copy(reply[4:8], buf[4:8])
+		return reply
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	status, results, err := scan(t, server.Addr(), base64.StdEncoding.EncodeToString(publicKey), 5*time.Second)
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if results.Response != "cookie_reply" || !results.ReceiverIndex || results.ResponseLength != 64 || results.Silent || results.RTTSeconds <= 0 {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestSilent(t *testing.T) {
+	received := make(chan uint32, 1)
+	server, err := testserver.NewUDP(func(buf []byte) []byte {
+		if len(buf) == initiationLength {
+			select {
+			case received <- binary.LittleEndian.Uint32(buf):
+			default:
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	status, results, err := scan(t, server.Addr(), "", 500*time.Millisecond)
+	if status != zgrab2.SCAN_IO_TIMEOUT || err == nil || results == nil || !results.Silent || results.Response != "" {
+		t.Errorf("got status %s, %+v, error %v", status, results, err)
+	}
+	if typ := <-received; typ != msgInitiation {
+		t.Errorf("got message type %d", typ)
+	}
+}
+
+func TestPortUnreachable(t *testing.T) {
+	server, err := testserver.NewUDP(func([]byte) []byte { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	status, results, err := scan(t, server.Addr(), "", 5*time.Second)
+	if status != zgrab2.SCAN_CONNECTION_REFUSED || err == nil || results == nil || !results.PortUnreachable {
+		t.Errorf("got status %s, %+v, error %v", status, results, err)
+	}
+}
@@ -0,0 +1,7 @@
+package modules
+
+import "github.com/zmap/zgrab2/modules/x11"
+
+func init() {
+	x11.RegisterModule()
+}
@@ -0,0 +1,151 @@
+// Package x11 provides a zgrab2 module that attempts the X11 connection setup
+// without authorization, and records whether the server grants access.
+// Default Port: 6000 (TCP)
+//
+// The scanner sends a connection setup request for protocol 11.0, with an
+// empty authorization. A server with access control enabled answers with
+// the reason of its refusal, while an open server answers with its vendor,
+// release number, pixmap formats and screens: any client can then read its
+// screens and inject input.
+package x11
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// Flags holds the command-line configuration for the x11 module.
+type Flags struct {
+	zgrab2.BaseFlags
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config *Flags
+}
+
+// Results is the output of the x11 module.
+type Results struct {
+	// Status is the status of the setup reply: success, failed or
+	// authenticate. AccessGranted is true on success.
+	Status        string `json:"status"`
+	AccessGranted bool   `json:"access_granted"`
+
+	ProtocolMajor uint16 `json:"protocol_major"`
+	ProtocolMinor uint16 `json:"protocol_minor"`
+
+	// Reason is the reason given by the server for refusing the connection.
+	Reason string `json:"reason,omitempty"`
+
+	Vendor           string `json:"vendor,omitempty"`
+	ReleaseNumber    uint32 `json:"release_number,omitempty"`
+	MaxRequestLength uint16 `json:"max_request_length,omitempty"`
+	ImageByteOrder   string `json:"image_byte_order,omitempty"`
+	MinKeycode       uint8  `json:"min_keycode,omitempty"`
+	MaxKeycode       uint8  `json:"max_keycode,omitempty"`
+
+	PixmapFormats []Format `json:"pixmap_formats,omitempty"`
+
+	// NumScreens is the number of screens of the server, and Screens lists
+	// the first ones.
+	NumScreens int      `json:"num_screens,omitempty"`
+	Screens    []Screen `json:"screens,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("x11", "X11", module.Description(), 6000, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Attempt the X11 connection setup without authorization, and record the server information if access is granted"
+}
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "x11"
+}
+
+// Scan sends the connection setup request, and reads the setup reply. A
+// refused connection is a success, with AccessGranted false.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write(encodeSetup()); err != nil {
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	results := new(Results)
+	if err := readSetup(conn, results); err != nil {
+		if err == ErrInvalidReply {
+			return zgrab2.SCAN_PROTOCOL_ERROR, nil, err
+		}
+		return zgrab2.TryGetScanStatus(err), nil, err
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
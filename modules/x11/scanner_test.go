@@ -0,0 +1,121 @@
+package x11
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2"
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// serve runs a fake X server answering the setup request with reply.
+func serve(t *testing.T, reply []byte) (*testserver.Server, chan []byte) {
+	requests := make(chan []byte, 1)
+	server, err := testserver.New(testserver.Config{Handler: func(conn net.Conn) error {
+		buf := make([]byte, 12)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return err
+		}
+		requests <- buf
+		_, err := conn.Write(reply)
+		return err
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, requests
+}
+
+func scan(t *testing.T, server *testserver.Server) (zgrab2.ScanStatus, *Results, error) {
+	defer server.Close()
+	status, ret, err := zgrab2test.Scan(t, new(Scanner), new(Flags), server.Addr())
+	results, _ := ret.(*Results)
+	return status, results, err
+}
+
+// reply returns a setup reply with the given status, reason length and body.
+func reply(status, reasonLength byte, body []byte) []byte {
+	buf := make([]byte, 8)
+	buf[0] = status
+	buf[1] = reasonLength
+	binary.LittleEndian.PutUint16(buf[2:], 11)
+	binary.LittleEndian.PutUint16(buf[6:], uint16(len(body)/4))
+	return append(buf, body...)
+}
+
+// successBody returns the body of a successful reply from an X.Org server
+// with two pixmap formats and one screen, with one depth of one visual.
+func successBody() []byte {
+	vendor := "The X.Org Foundation"
+	body := make([]byte, 32)
+	binary.LittleEndian.PutUint32(body[0:], 12013000)
+	binary.LittleEndian.PutUint16(body[16:], uint16(len(vendor)))
+	binary.LittleEndian.PutUint16(body[18:], 65535)
+	body[20] = 1
+	body[21] = 2
+	body[26] = 8
+	body[27] = 255
+	body = append(body, vendor...)
+	body = append(body, make([]byte, pad(len(vendor))-len(vendor))...)
+	body = append(body, 1, 1, 32, 0, 0, 0, 0, 0)
+	body = append(body, 24, 32, 32, 0, 0, 0, 0, 0)
+	screen := make([]byte, 40)
+	binary.LittleEndian.PutUint16(screen[20:], 1920)
+	binary.LittleEndian.PutUint16(screen[22:], 1080)
+	binary.LittleEndian.PutUint16(screen[24:], 508)
+	binary.LittleEndian.PutUint16(screen[26:], 285)
+	screen[38] = 24
+	screen[39] = 1
+	depth := make([]byte, 8)
+	depth[0] = 24
+	binary.LittleEndian.PutUint16(depth[2:], 1)
+	screen = append(append(screen, depth...), make([]byte, 24)...)
+	return append(body, screen...)
+}
+
+func TestAccessGranted(t *testing.T) {
+	server, requests := serve(t, reply(statusSuccess, 0, successBody()))
+	status, results, err := scan(t, server)
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if request := <-requests; request[0] != 'l' || binary.LittleEndian.Uint16(request[2:]) != 11 || binary.LittleEndian.Uint16(request[6:]) != 0 {
+		t.Errorf("got request %x", request)
+	}
+	if !results.AccessGranted || results.Status != "success" || results.Vendor != "The X.Org Foundation" || results.ReleaseNumber != 12013000 || results.ImageByteOrder != "lsb_first" {
+		t.Errorf("got %+v", results)
+	}
+	wantFormats := []Format{{Depth: 1, BitsPerPixel: 1, ScanlinePad: 32}, {Depth: 24, BitsPerPixel: 32, ScanlinePad: 32}}
+	if !reflect.DeepEqual(results.PixmapFormats, wantFormats) {
+		t.Errorf("got formats %+v, want %+v", results.PixmapFormats, wantFormats)
+	}
+	wantScreens := []Screen{{Width: 1920, Height: 1080, WidthMM: 508, HeightMM: 285, RootDepth: 24}}
+	if results.NumScreens != 1 || !reflect.DeepEqual(results.Screens, wantScreens) {
+		t.Errorf("got screens %+v, want %+v", results.Screens, wantScreens)
+	}
+}
+
+func TestAccessDenied(t *testing.T) {
+	reason := "Authorization required, but no authorization protocol specified\n"
+	body := append([]byte(reason), make([]byte, pad(len(reason))-len(reason))...)
+	server, _ := serve(t, reply(statusFailed, byte(len(reason)), body))
+	status, results, err := scan(t, server)
+	if status != zgrab2.SCAN_SUCCESS || err != nil {
+		t.Fatalf("got status %s, error %v", status, err)
+	}
+	if results.AccessGranted || results.Status != "failed" || results.Reason != reason {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestInvalidReply(t *testing.T) {
+	server, _ := serve(t, []byte("SSH-2.0-OpenSSH_8.9\r\n"))
+	status, _, err := scan(t, server)
+	if status != zgrab2.SCAN_PROTOCOL_ERROR || err != ErrInvalidReply {
+		t.Errorf("got status %s, error %v", status, err)
+	}
+}
@@ -0,0 +1,182 @@
+package x11
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// The status of the setup reply.
+const (
+	statusFailed       = 0
+	statusSuccess      = 1
+	statusAuthenticate = 2
+)
+
+const (
+	// setupHeaderLength is the length of the header of the setup reply, up to
+	// its additional data.
+	setupHeaderLength = 8
+
+	// setupFixedLength is the length of the fixed part of a successful setup
+	// reply, after its header.
+	setupFixedLength = 32
+
+	// screenLength is the length of the fixed part of a screen.
+	screenLength = 40
+
+	// maxScreens is the maximum number of screens parsed.
+	maxScreens = 16
+)
+
+// ErrInvalidReply is returned if the server does not answer with a setup
+// reply.
+var ErrInvalidReply = errors.New("invalid X11 setup reply")
+
+// byteOrderNames names the image byte orders.
+var byteOrderNames = map[byte]string{
+	0: "lsb_first",
+	1: "msb_first",
+}
+
+// statusNames names the status of the setup reply.
+var statusNames = map[byte]string{
+	statusFailed:       "failed",
+	statusSuccess:      "success",
+	statusAuthenticate: "authenticate",
+}
+
+// Format is a pixmap format of the server.
+type Format struct {
+	Depth        uint8 `json:"depth"`
+	BitsPerPixel uint8 `json:"bits_per_pixel"`
+	ScanlinePad  uint8 `json:"scanline_pad"`
+}
+
+// Screen is a screen of the server.
+type Screen struct {
+	Width     uint16 `json:"width"`
+	Height    uint16 `json:"height"`
+	WidthMM   uint16 `json:"width_mm"`
+	HeightMM  uint16 `json:"height_mm"`
+	RootDepth uint8  `json:"root_depth"`
+}
+
+// encodeSetup returns a little-endian connection setup request for protocol
+// 11.0, with no authorization.
+func encodeSetup() []byte {
+	buf := make([]byte, 12)
+	buf[0] = 'l'
+	binary.LittleEndian.PutUint16(buf[2:], 11)
+	binary.LittleEndian.PutUint16(buf[4:], 0)
+	return buf
+}
+
+// pad returns n rounded up to a multiple of 4.
+func pad(n int) int {
+	return (n + 3) &^ 3
+}
+
+// readSetup reads the setup reply into results.
+func readSetup(r io.Reader, results *Results) error {
+	header := make([]byte, setupHeaderLength)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	status, ok := statusNames[header[0]]
+	if !ok || binary.LittleEndian.Uint16(header[2:]) != 11 {
+		return ErrInvalidReply
+	}
+	results.Status = status
+	results.ProtocolMajor = binary.LittleEndian.Uint16(header[2:])
+	results.ProtocolMinor = binary.LittleEndian.Uint16(header[4:])
+	body := make([]byte, 4*int(binary.LittleEndian.Uint16(header[6:])))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return err
+	}
+	switch header[0] {
+	case statusFailed:
+		// The length of the reason is in the unused byte of the header.
+		n := int(header[1])
+		if n > len(body) {
+			return ErrInvalidReply
+		}
+		results.Reason = string(body[:n])
+	case statusAuthenticate:
+		results.Reason = string(trimPad(body))
+	case statusSuccess:
+		results.AccessGranted = true
+		return parseSuccess(body, results)
+	}
+	return nil
+}
+
+// trimPad returns buf without its trailing zero bytes.
+func trimPad(buf []byte) []byte {
+	for len(buf) > 0 && buf[len(buf)-1] == 0 {
+		buf = buf[:len(buf)-1]
+	}
+	return buf
+}
+
+// parseSuccess parses the body of a successful setup reply into results.
+func parseSuccess(body []byte, results *Results) error {
+	if len(body) < setupFixedLength {
+		return ErrInvalidReply
+	}
+	results.ReleaseNumber = binary.LittleEndian.Uint32(body[0:])
+	vendorLength := int(binary.LittleEndian.Uint16(body[16:]))
+	results.MaxRequestLength = binary.LittleEndian.Uint16(body[18:])
+	numScreens := int(body[20])
+	numFormats := int(body[21])
+	results.ImageByteOrder = byteOrderNames[body[22]]
+	results.MinKeycode = body[26]
+	results.MaxKeycode = body[27]
+	body = body[setupFixedLength:]
+	if len(body) < pad(vendorLength)+8*numFormats {
+		return ErrInvalidReply
+	}
+	results.Vendor = string(body[:vendorLength])
+	body = body[pad(vendorLength):]
+	for i := 0; i < numFormats; i++ {
+		results.PixmapFormats = append(results.PixmapFormats, Format{Depth: body[0], BitsPerPixel: body[1], ScanlinePad: body[2]})
+		body = body[8:]
+	}
+	results.NumScreens = numScreens
+	for i := 0; i < numScreens && i < maxScreens; i++ {
+		screen, n, err := parseScreen(body)
+		if err != nil {
+			return err
+		}
+		results.Screens = append(results.Screens, *screen)
+		body = body[n:]
+	}
+	return nil
+}
+
+// parseScreen parses a screen, and returns its length with its depths and
+// visuals.
+func parseScreen(buf []byte) (*Screen, int, error) {
+	if len(buf) < screenLength {
+		return nil, 0, ErrInvalidReply
+	}
+	s := &Screen{
+		Width:     binary.LittleEndian.Uint16(buf[20:]),
+		Height:    binary.LittleEndian.Uint16(buf[22:]),
+		WidthMM:   binary.LittleEndian.Uint16(buf[24:]),
+		HeightMM:  binary.LittleEndian.Uint16(buf[26:]),
+		RootDepth: buf[38],
+	}
+	n := screenLength
+	// Each depth is followed by its visuals, of 24 bytes each.
+	for i := 0; i < int(buf[39]); i++ {
+		if len(buf) < n+8 {
+			return nil, 0, ErrInvalidReply
+		}
+		n += 8 + 24*int(binary.LittleEndian.Uint16(buf[n+2:]))
+	}
+	if n > len(buf) {
+		return nil, 0, ErrInvalidReply
+	}
+	return s, n, nil
+}
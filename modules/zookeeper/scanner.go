@@ -0,0 +1,257 @@
+// Package zookeeper provides a zgrab2 module that sends four-letter-word
+// commands to ZooKeeper servers.
+// Default Port: 2181 (TCP)
+//
+// Each of the --commands is sent on a new connection, which the server closes
+// after its response. The responses of ruok, srvr (and stat), envi and conf
+// are parsed. Since 3.5.3, commands which are not in the whitelist of the
+// server (4lw.commands.whitelist, only srvr by default) are refused, which is
+// recorded.
+package zookeeper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// maxResponseSize is the maximum size of a response read.
+const maxResponseSize = 64 * 1024
+
+// Flags holds the command-line configuration for the zookeeper module.
+type Flags struct {
+	zgrab2.BaseFlags
+
+	Commands string `long:"commands" default:"ruok,srvr,envi,conf" description:"Comma-separated four-letter-word commands to send"`
+}
+
+// Module implements the zgrab2.Module interface.
+type Module struct {
+}
+
+// Scanner implements the zgrab2.Scanner interface.
+type Scanner struct {
+	config   *Flags
+	commands []string
+}
+
+// Command is the outcome of a command.
+type Command struct {
+	Name     string `json:"name"`
+	Response string `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Results is the output of the zookeeper module.
+type Results struct {
+	// OK is true if the server answered imok to ruok.
+	OK bool `json:"ok"`
+
+	// The fields of srvr.
+	Version     string `json:"version,omitempty"`
+	Mode        string `json:"mode,omitempty"`
+	Latency     string `json:"latency,omitempty"`
+	Received    int64  `json:"received,omitempty"`
+	Sent        int64  `json:"sent,omitempty"`
+	Connections int    `json:"connections,omitempty"`
+	Outstanding int    `json:"outstanding,omitempty"`
+	Zxid        string `json:"zxid,omitempty"`
+	NodeCount   int    `json:"node_count,omitempty"`
+
+	// Environment and Config are the properties listed by envi and conf.
+	Environment map[string]string `json:"environment,omitempty"`
+	Config      map[string]string `json:"config,omitempty"`
+
+	// Blocked lists the commands refused as not in the whitelist.
+	Blocked []string `json:"blocked,omitempty"`
+
+	// Commands lists the outcome of each command.
+	Commands []Command `json:"commands,omitempty"`
+}
+
+// RegisterModule registers the zgrab2 module.
+func RegisterModule() {
+	var module Module
+	_, err := zgrab2.AddCommand("zookeeper", "ZooKeeper", module.Description(), 2181, &module)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// NewFlags returns a default Flags object.
+func (module *Module) NewFlags() interface{} {
+	return new(Flags)
+}
+
+// NewScanner returns a new Scanner instance.
+func (module *Module) NewScanner() zgrab2.Scanner {
+	return new(Scanner)
+}
+
+// NewResults returns a new, empty instance of the scan results.
+func (module *Module) NewResults() interface{} {
+	return new(Results)
+}
+
+// Description returns an overview of this module.
+func (module *Module) Description() string {
+	return "Send four-letter-word commands to a ZooKeeper server, reading its version, mode and configuration"
+}
+
+// commandPattern matches a four-letter-word command.
+var commandPattern = regexp.MustCompile(`^[a-z]{4}$`)
+
+// Validate checks that the flags are valid.
+// On success, returns nil.
+// On failure, returns an error instance describing the error.
+func (flags *Flags) Validate(args []string) error {
+	for _, cmd := range strings.Split(flags.Commands, ",") {
+		if !commandPattern.MatchString(strings.TrimSpace(cmd)) {
+			log.Errorf("Invalid command %q: must be four lowercase letters", cmd)
+			return zgrab2.ErrInvalidArguments
+		}
+	}
+	return nil
+}
+
+// Help returns the module's help string.
+func (flags *Flags) Help() string {
+	return ""
+}
+
+// Init initializes the Scanner.
+func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
+	f, ok := flags.(*Flags)
+	if !ok {
+		return zgrab2.ErrMismatchedFlags
+	}
+	scanner.config = f
+	scanner.commands = nil
+	for _, cmd := range strings.Split(f.Commands, ",") {
+		scanner.commands = append(scanner.commands, strings.TrimSpace(cmd))
+	}
+	return nil
+}
+
+// InitPerSender initializes the scanner for a given sender.
+func (scanner *Scanner) InitPerSender(senderID int) error {
+	return nil
+}
+
+// GetName returns the Scanner name defined in the Flags.
+func (scanner *Scanner) GetName() string {
+	return scanner.config.Name
+}
+
+// GetTrigger returns the Trigger defined in the Flags.
+func (scanner *Scanner) GetTrigger() string {
+	return scanner.config.Trigger
+}
+
+// Protocol returns the protocol identifier of the scan.
+func (scanner *Scanner) Protocol() string {
+	return "zookeeper"
+}
+
+// ErrTooLarge is returned if a response is larger than maxResponseSize.
+var ErrTooLarge = errors.New("response too large")
+
+// send sends cmd on a new connection and reads the response until the server
+// closes the connection.
+func (scanner *Scanner) send(ctx context.Context, target *zgrab2.ScanTarget, cmd string) (string, error) {
+	conn, err := target.Open(ctx, &scanner.config.BaseFlags)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(cmd)); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(conn, maxResponseSize+1))
+	if len(data) > maxResponseSize {
+		return string(data[:maxResponseSize]), ErrTooLarge
+	}
+	return string(data), err
+}
+
+// properties parses the key=value lines of envi and conf, skipping the
+// others, such as the Environment: header.
+func properties(response string) map[string]string {
+	ret := make(map[string]string)
+	for _, line := range strings.Split(response, "\n") {
+		if i := strings.IndexByte(line, '='); i > 0 {
+			ret[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return ret
+}
+
+// parseServer parses the response of srvr or stat.
+func parseServer(response string, results *Results) {
+	for _, line := range strings.Split(response, "\n") {
+		i := strings.Index(line, ": ")
+		if i < 0 {
+			continue
+		}
+		value := strings.TrimSpace(line[i+2:])
+		switch line[:i] {
+		case "Zookeeper version":
+			results.Version = strings.SplitN(value, ",", 2)[0]
+		case "Mode":
+			results.Mode = value
+		case "Latency min/avg/max":
+			results.Latency = value
+		case "Received":
+			results.Received, _ = strconv.ParseInt(value, 10, 64)
+		case "Sent":
+			results.Sent, _ = strconv.ParseInt(value, 10, 64)
+		case "Connections":
+			results.Connections, _ = strconv.Atoi(value)
+		case "Outstanding":
+			results.Outstanding, _ = strconv.Atoi(value)
+		case "Zxid":
+			results.Zxid = value
+		case "Node count":
+			results.NodeCount, _ = strconv.Atoi(value)
+		}
+	}
+}
+
+// Scan sends each command in turn. The scan fails if the first connection
+// fails.
+func (scanner *Scanner) Scan(ctx context.Context, target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	results := new(Results)
+	for i, name := range scanner.commands {
+		response, err := scanner.send(ctx, &target, name)
+		if err != nil && i == 0 && response == "" {
+			return zgrab2.TryGetScanStatus(err), nil, err
+		}
+		cmd := Command{Name: name, Response: response}
+		if err != nil {
+			cmd.Error = err.Error()
+		}
+		results.Commands = append(results.Commands, cmd)
+		if strings.Contains(response, "is not executed because it is not in the whitelist") {
+			results.Blocked = append(results.Blocked, name)
+			continue
+		}
+		switch name {
+		case "ruok":
+			results.OK = response == "imok"
+		case "srvr", "stat":
+			parseServer(response, results)
+		case "envi":
+			results.Environment = properties(response)
+		case "conf":
+			results.Config = properties(response)
+		}
+	}
+	return zgrab2.SCAN_SUCCESS, results, nil
+}
@@ -0,0 +1,93 @@
+package zookeeper
+
+import (
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/zmap/zgrab2/internal/zgrab2test"
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+const srvrResponse = `Zookeeper version: 3.8.1-74db005175a4ec545697012f9069cb9dcc8cdda7, built on 2023-01-25 16:31 UTC
+Latency min/avg/max: 0/0.5/3
+Received: 12
+Sent: 11
+Connections: 2
+Outstanding: 0
+Zxid: 0x100000004
+Mode: follower
+Node count: 27
+`
+
+const enviResponse = `Environment:
+zookeeper.version=3.8.1-74db005175a4ec545697012f9069cb9dcc8cdda7, built on 2023-01-25 16:31 UTC
+host.name=zk-1
+java.version=11.0.18
+os.name=Linux
+`
+
+// serve returns a handler answering the command of a connection with its
+// response.
+func serve(responses map[string]string) func(conn net.Conn) error {
+	return func(conn net.Conn) error {
+		cmd := make([]byte, 4)
+		if _, err := io.ReadFull(conn, cmd); err != nil {
+			return err
+		}
+		response, ok := responses[string(cmd)]
+		if !ok {
+			response = string(cmd) + " is not executed because it is not in the whitelist.\n"
+		}
+		_, err := conn.Write([]byte(response))
+		return err
+	}
+}
+
+func scan(t *testing.T, responses map[string]string) *Results {
+	server, err := testserver.New(testserver.Config{Handler: serve(responses)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	return zgrab2test.MustScan(t, new(Scanner), &Flags{Commands: "ruok,srvr,envi,conf"}, server.Addr()).(*Results)
+}
+
+func TestAllAllowed(t *testing.T) {
+	results := scan(t, map[string]string{
+		"ruok": "imok",
+		"srvr": srvrResponse,
+		"envi": enviResponse,
+		"conf": "clientPort=2181\ndataDir=/data/version-2\nserverId=1\n",
+	})
+	if !results.OK || results.Version != "3.8.1-74db005175a4ec545697012f9069cb9dcc8cdda7" || results.Mode != "follower" || results.Connections != 2 || results.NodeCount != 27 || results.Zxid != "0x100000004" {
+		t.Errorf("got %+v", results)
+	}
+	if results.Environment["host.name"] != "zk-1" || results.Environment["java.version"] != "11.0.18" || len(results.Environment) != 4 {
+		t.Errorf("got environment %v", results.Environment)
+	}
+	expected := map[string]string{"clientPort": "2181", "dataDir": "/data/version-2", "serverId": "1"}
+	if !reflect.DeepEqual(results.Config, expected) || results.Blocked != nil || len(results.Commands) != 4 {
+		t.Errorf("got %+v", results)
+	}
+}
+
+func TestWhitelist(t *testing.T) {
+	results := scan(t, map[string]string{"srvr": srvrResponse})
+	if results.OK || results.Mode != "follower" || results.Environment != nil || results.Config != nil {
+		t.Errorf("got %+v", results)
+	}
+	if !reflect.DeepEqual(results.Blocked, []string{"ruok", "envi", "conf"}) {
+		t.Errorf("got blocked %v", results.Blocked)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (&Flags{Commands: "ruok, srvr"}).Validate(nil); err != nil {
+		t.Error(err)
+	}
+	if err := (&Flags{Commands: "ruok,stats"}).Validate(nil); err == nil {
+		t.Error("accepted a five-letter command")
+	}
+}
@@ -1,14 +1,106 @@
 package zgrab2
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencySamples is the number of recent scan durations retained per module
+// for computing latency percentiles.
+const latencySamples = 1024
 
 // Monitor is a collection of states per scans and a channel to communicate
 // those scans to the monitor
 type Monitor struct {
+	// throttled and throttleWait count the targets and connections delayed
+	// by the rate limits, and the total time they waited. They are accessed
+	// atomically, so they come first to be 64-bit aligned.
+	throttled    uint64
+	throttleWait int64
+	// targets counts the targets whose results were output, atomically.
+	targets uint64
+	// blocked and duplicates count the input targets skipped because they
+	// are in the blocklist or were already read, atomically.
+	blocked    uint64
+	duplicates uint64
+
 	states       map[string]*State
 	statusesChan chan moduleStatus
 	// Callback is invoked after each scan.
 	Callback func(string)
+
+	mu    sync.Mutex
+	start time.Time
+}
+
+// ThrottleStats describes the delays imposed by the rate limits.
+type ThrottleStats struct {
+	// Delayed is the number of targets whose scan was delayed by
+	// --rate-per-prefix, plus the number of connections delayed by --rate.
+	Delayed uint64 `json:"delayed"`
+
+	// Wait is the total time the delayed targets and connections waited.
+	Wait time.Duration `json:"-"`
+
+	// WaitSeconds is Wait in seconds.
+	WaitSeconds float64 `json:"wait_seconds"`
+}
+
+// recordThrottle records that a target or connection was delayed by d.
+func (m *Monitor) recordThrottle(d time.Duration) {
+	atomic.AddUint64(&m.throttled, 1)
+	atomic.AddInt64(&m.throttleWait, int64(d))
+}
+
+// Throttling returns the delays imposed by the rate limits so far. It is safe
+// to call while the scan is running.
+func (m *Monitor) Throttling() ThrottleStats {
+	wait := time.Duration(atomic.LoadInt64(&m.throttleWait))
+	return ThrottleStats{
+		Delayed:     atomic.LoadUint64(&m.throttled),
+		Wait:        wait,
+		WaitSeconds: wait.Seconds(),
+	}
+}
+
+// SkipStats counts the input targets that were not scanned.
+type SkipStats struct {
+	// Blocked is the number of targets in the --blocklist-file.
+	Blocked uint64 `json:"blocked"`
+
+	// Duplicate is the number of targets already read, with --dedup.
+	Duplicate uint64 `json:"duplicate"`
+}
+
+// recordBlocked records that a target in the blocklist was skipped.
+func (m *Monitor) recordBlocked() {
+	atomic.AddUint64(&m.blocked, 1)
+}
+
+// recordDuplicate records that a target already read was skipped.
+func (m *Monitor) recordDuplicate() {
+	atomic.AddUint64(&m.duplicates, 1)
+}
+
+// Skipped returns the number of input targets skipped so far. It is safe to
+// call while the scan is running.
+func (m *Monitor) Skipped() SkipStats {
+	return SkipStats{
+		Blocked:   atomic.LoadUint64(&m.blocked),
+		Duplicate: atomic.LoadUint64(&m.duplicates),
+	}
+}
+
+// recordTarget records that the results of a target were output.
+func (m *Monitor) recordTarget() {
+	atomic.AddUint64(&m.targets, 1)
+}
+
+// TargetsCompleted returns the number of targets whose results were output so
+// far. It is safe to call while the scan is running.
+func (m *Monitor) TargetsCompleted() uint64 {
+	return atomic.LoadUint64(&m.targets)
 }
 
 // State contains the respective number of successes and failures
@@ -16,11 +108,19 @@ type Monitor struct {
 type State struct {
 	Successes uint `json:"successes"`
 	Failures  uint `json:"failures"`
+
+	// statuses counts the results for this scan by ScanStatus.
+	statuses map[ScanStatus]uint
+	// latencies is a ring buffer of the most recent scan durations.
+	latencies []time.Duration
+	next      int
 }
 
 type moduleStatus struct {
-	name string
-	st   status
+	name    string
+	st      status
+	status  ScanStatus
+	elapsed time.Duration
 }
 
 type status uint
@@ -43,30 +143,82 @@ func (m *Monitor) Stop() {
 	close(m.statusesChan)
 }
 
+// record adds a single scan result to the state.
+func (s *State) record(ms moduleStatus) {
+	switch ms.st {
+	case statusSuccess:
+		s.Successes++
+	case statusFailure:
+		s.Failures++
+	default:
+		return
+	}
+	if s.statuses == nil {
+		s.statuses = make(map[ScanStatus]uint)
+	}
+	s.statuses[ms.status]++
+	if len(s.latencies) < latencySamples {
+		s.latencies = append(s.latencies, ms.elapsed)
+	} else {
+		s.latencies[s.next] = ms.elapsed
+		s.next = (s.next + 1) % latencySamples
+	}
+}
+
+// ModuleSnapshot is a point-in-time copy of the monitor's state for a single
+// scanner, suitable for display.
+type ModuleSnapshot struct {
+	Name      string
+	Successes uint
+	Failures  uint
+	Statuses  map[ScanStatus]uint
+	// Latencies holds the most recent scan durations, in no particular order.
+	Latencies []time.Duration
+}
+
+// Snapshot returns a copy of the current per-scanner state, and the time
+// elapsed since the monitor was created. It is safe to call while the scan is
+// running.
+func (m *Monitor) Snapshot() ([]ModuleSnapshot, time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make([]ModuleSnapshot, 0, len(m.states))
+	for name, s := range m.states {
+		snap := ModuleSnapshot{
+			Name:      name,
+			Successes: s.Successes,
+			Failures:  s.Failures,
+			Statuses:  make(map[ScanStatus]uint, len(s.statuses)),
+			Latencies: append([]time.Duration(nil), s.latencies...),
+		}
+		for k, v := range s.statuses {
+			snap.Statuses[k] = v
+		}
+		ret = append(ret, snap)
+	}
+	return ret, time.Since(m.start)
+}
+
 // MakeMonitor returns a Monitor object that can be used to collect and send
 // the status of a running scan
 func MakeMonitor(statusChanSize int, wg *sync.WaitGroup) *Monitor {
 	m := new(Monitor)
 	m.statusesChan = make(chan moduleStatus, statusChanSize)
 	m.states = make(map[string]*State, 10)
+	m.start = time.Now()
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		for s := range m.statusesChan {
+			m.mu.Lock()
 			if m.states[s.name] == nil {
 				m.states[s.name] = new(State)
 			}
+			m.states[s.name].record(s)
+			m.mu.Unlock()
 			if m.Callback != nil {
 				m.Callback(s.name)
 			}
-			switch s.st {
-			case statusSuccess:
-				m.states[s.name].Successes++
-			case statusFailure:
-				m.states[s.name].Failures++
-			default:
-				continue
-			}
 		}
 	}()
 	return m
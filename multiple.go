@@ -7,6 +7,8 @@ type MultipleCommand struct {
 	ConfigFileName  string `short:"c" long:"config-file" default:"-" description:"Config filename, use - for stdin"`
 	ContinueOnError bool   `long:"continue-on-error" description:"If proceeding protocols error, do not run following protocols (default: true)"`
 	BreakOnSuccess  bool   `long:"break-on-success" description:"If proceeding protocols succeed, do not run following protocols (default: false)"`
+	Parallel        bool   `long:"parallel" description:"Run all modules against each target concurrently, resolving its domain once"`
+	MaxHostConns    int    `long:"max-host-connections" default:"0" description:"With --parallel, the maximum number of concurrent connections to a single target (0 = unlimited)"`
 }
 
 // Validate the options sent to MultipleCommand
@@ -14,6 +16,12 @@ func (x *MultipleCommand) Validate(args []string) error {
 	if x.ConfigFileName == config.InputFileName {
 		return errors.New("cannot receive config file and input file from same source")
 	}
+	if x.Parallel && x.BreakOnSuccess {
+		return errors.New("--break-on-success requires modules to run sequentially")
+	}
+	if x.MaxHostConns < 0 {
+		return errors.New("--max-host-connections must not be negative")
+	}
 
 	return nil
 }
@@ -0,0 +1,129 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// hostLimiter bounds the number of concurrent connections to a single target.
+type hostLimiter chan struct{}
+
+// AcquireConn blocks until a new connection to the target may be opened, and
+// returns the function that must be called once the connection is closed (or
+// could not be opened). If connections to the target are not limited, it
+// returns immediately. Modules that dial connections themselves (rather than
+// through ScanTarget.Open) should use this together with ReleaseOnClose.
+func (target *ScanTarget) AcquireConn() func() {
+	if target.connLimit == nil {
+		return func() {}
+	}
+	target.connLimit <- struct{}{}
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-target.connLimit })
+	}
+}
+
+// releaseConn wraps a net.Conn, calling release when it is closed.
+type releaseConn struct {
+	net.Conn
+	release func()
+}
+
+func (c *releaseConn) Close() error {
+	defer c.release()
+	return c.Conn.Close()
+}
+
+// ReleaseOnClose returns a net.Conn that calls release (as returned by
+// AcquireConn) when it is closed. If conn is a TimeoutConnection, the
+// underlying connection is wrapped instead, so that callers relying on the
+// concrete type are unaffected.
+func ReleaseOnClose(conn net.Conn, release func()) net.Conn {
+	if tc, ok := conn.(*TimeoutConnection); ok {
+		tc.Conn = &releaseConn{Conn: tc.Conn, release: release}
+		return tc
+	}
+	return &releaseConn{Conn: conn, release: release}
+}
+
+// scanTargetParallel runs each registered scanner whose trigger matches the
+// target's tag concurrently, except those named in done, and returns their
+// responses. Scanners that run after another (see BaseFlags.After) are
+// started once its response is available.
+func (e *Engine) scanTargetParallel(ctx context.Context, input *ScanTarget, trace bool, done map[string]ScanResponse) map[string]ScanResponse {
+	// A target given only by domain is resolved once, with the default
+	// resolver unless one is configured, so that all the modules connect to
+	// the same address.
+	e.config.resolver.resolveTarget(ctx, input)
+	if limit := e.config.Multiple.MaxHostConns; limit > 0 {
+		input.connLimit = make(hostLimiter, limit)
+	}
+
+	var pending []string
+	for _, scannerName := range e.Scanners() {
+		scanner := e.Scanner(scannerName)
+		if !input.HasTag(scanner.GetTrigger()) {
+			continue
+		}
+		if _, ok := done[scanner.GetName()]; ok {
+			continue
+		}
+		pending = append(pending, scannerName)
+	}
+
+	var mu sync.Mutex
+	moduleResult := make(map[string]ScanResponse)
+	for len(pending) > 0 && ctx.Err() == nil {
+		// Start the scanners that are ready, in waves, until none is left
+		// waiting for another.
+		var runnable, waiting []string
+		for _, scannerName := range pending {
+			name := e.Scanner(scannerName).GetName()
+			run, wait := e.ready(name, moduleResult, done)
+			if wait && e.pending(e.condition(name).after, pending) {
+				waiting = append(waiting, scannerName)
+			} else if run {
+				runnable = append(runnable, scannerName)
+			}
+		}
+		var wg sync.WaitGroup
+		for _, scannerName := range runnable {
+			scanner := e.Scanner(scannerName)
+			wg.Add(1)
+			go func(scannerName string, scanner Scanner, target ScanTarget) {
+				defer wg.Done()
+				defer func() {
+					if r := recover(); r != nil {
+						log.Errorf("Panic on scanner %s when scanning target %s: %#v", scannerName, target.String(), r)
+						panic(r)
+					}
+				}()
+				target.trace = e.newTrace(trace)
+				name, res := RunScannerTimeout(ctx, scanner, e.monitor, target, e.config.ScanTimeout)
+				e.finishTrace(&target, name, &res, trace)
+				e.config.scanLog.record(&target, name, &res)
+				mu.Lock()
+				moduleResult[name] = res
+				mu.Unlock()
+			}(scannerName, scanner, *input)
+		}
+		wg.Wait()
+		pending = waiting
+	}
+	return moduleResult
+}
+
+// pending returns true if the scanner with the given name is among the named
+// scanners still to run.
+func (e *Engine) pending(name string, scannerNames []string) bool {
+	for _, scannerName := range scannerNames {
+		if e.Scanner(scannerName).GetName() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package zgrab2
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnLimit(t *testing.T) {
+	target := ScanTarget{connLimit: make(hostLimiter, 1)}
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := ReleaseOnClose(NewTimeoutConnection(nil, client, time.Second, 0, 0, 0), target.AcquireConn())
+
+	acquired := make(chan func())
+	go func() {
+		acquired <- target.AcquireConn()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second connection allowed while the first is open")
+	case <-time.After(50 * time.Millisecond):
+	}
+	conn.Close()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("closing the connection did not release its slot")
+	}
+}
+
+func TestEngineParallel(t *testing.T) {
+	config := &Config{}
+	config.Multiple.Parallel = true
+	config.Multiple.ContinueOnError = true
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.AddModule("test", new(engineTestModule))
+	for _, name := range []string{"a", "b", "c"} {
+		flags, _ := engine.NewFlags("test")
+		flags.(*engineTestFlags).Name = name
+		flags.(*engineTestFlags).Fail = name == "b"
+		if _, err := engine.NewScanner("test", flags); err != nil {
+			t.Fatal(err)
+		}
+	}
+	grab := engine.ScanTarget(ScanTarget{IP: net.ParseIP("192.0.2.1")})
+	if len(grab.Data) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(grab.Data))
+	}
+	if grab.Data["a"].Status != SCAN_SUCCESS || grab.Data["b"].Status != SCAN_PROTOCOL_ERROR {
+		t.Errorf("unexpected results %+v", grab.Data)
+	}
+}
+
+// TestEngineParallelResolve checks that a target given only by domain is
+// resolved once for all the modules, even without a configured resolver.
+func TestEngineParallelResolve(t *testing.T) {
+	config := &Config{}
+	config.Multiple.Parallel = true
+	engine, err := NewEngine(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.AddModule("test", new(engineTestModule))
+	flags, _ := engine.NewFlags("test")
+	if _, err := engine.NewScanner("test", flags); err != nil {
+		t.Fatal(err)
+	}
+	grab := engine.ScanTarget(ScanTarget{Domain: "localhost"})
+	if grab.IP != "127.0.0.1" || grab.Domain != "localhost" {
+		t.Errorf("got target %q (%q)", grab.Domain, grab.IP)
+	}
+}
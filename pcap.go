@@ -0,0 +1,442 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// pcapLinkTypeRaw is the link type of packets beginning with their IPv4
+	// or IPv6 header.
+	pcapLinkTypeRaw = 101
+	pcapSnapLen     = 65535
+	// pcapMSS is the largest TCP payload of the synthesized packets.
+	pcapMSS = 1460
+)
+
+// TCP flags of the synthesized packets.
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+// pcapCapture writes the traffic of the scans selected by --pcap-statuses and
+// --pcap-match to packet captures: a file per target and scanner in dir, or
+// all in file, rotated once it reaches rotateSize bytes.
+//
+// The packets are reconstructed from the data sent and received on the
+// connections of a scan, as recorded by its Trace, with synthetic TCP
+// handshakes and sequence numbers: capturing needs no privileges, but
+// retransmissions, TCP options and the traffic below TLS proxies are not
+// shown.
+type pcapCapture struct {
+	dir        string
+	file       string
+	rotateSize int64
+	statuses   map[ScanStatus]bool
+	match      *regexp.Regexp
+
+	mu      sync.Mutex
+	out     *os.File
+	written int64
+	index   int
+}
+
+// newPcapCapture returns the capture configured by the --pcap-* options, or
+// nil if captures are disabled.
+func newPcapCapture(config *Config) (*pcapCapture, error) {
+	if config.PcapDir == "" && config.PcapFile == "" {
+		return nil, nil
+	}
+	if config.PcapDir != "" && config.PcapFile != "" {
+		return nil, fmt.Errorf("--pcap-dir and --pcap-file cannot be used together")
+	}
+	if config.PcapRotateSize < 0 {
+		return nil, fmt.Errorf("rotation size cannot be negative, given %d", config.PcapRotateSize)
+	}
+	ret := &pcapCapture{
+		dir:        config.PcapDir,
+		file:       config.PcapFile,
+		rotateSize: int64(config.PcapRotateSize) << 20,
+	}
+	for _, field := range strings.Split(config.PcapStatuses, ",") {
+		status := ScanStatus(strings.TrimSpace(field))
+		if status == "" {
+			continue
+		}
+		if !retryableStatuses[status] && status != SCAN_SUCCESS && status != SCAN_BLOCKED {
+			return nil, fmt.Errorf("unknown scan status %q", field)
+		}
+		if ret.statuses == nil {
+			ret.statuses = make(map[ScanStatus]bool)
+		}
+		ret.statuses[status] = true
+	}
+	if config.PcapMatch != "" {
+		var err error
+		if ret.match, err = regexp.Compile(config.PcapMatch); err != nil {
+			return nil, fmt.Errorf("invalid match %q: %s", config.PcapMatch, err)
+		}
+	}
+	if ret.dir != "" {
+		if err := os.MkdirAll(ret.dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// wants returns true if the traffic of a scan with the given response and
+// trace events is to be captured: all scans if neither statuses nor a match
+// are set, otherwise those with one of the statuses or whose received data
+// matches.
+func (c *pcapCapture) wants(res *ScanResponse, events []TraceEvent) bool {
+	if c.statuses == nil && c.match == nil {
+		return true
+	}
+	if c.statuses[res.Status] {
+		return true
+	}
+	if c.match == nil {
+		return false
+	}
+	var received []byte
+	for _, ev := range events {
+		if ev.Event == "read" && ev.Data != "" {
+			data, _ := hex.DecodeString(ev.Data)
+			received = append(received, data...)
+		}
+	}
+	return c.match.Match(received)
+}
+
+// write captures the traffic of a scan of target by the named scanner, if it
+// is selected.
+func (c *pcapCapture) write(target *ScanTarget, scanner string, res *ScanResponse, events []TraceEvent) error {
+	if !c.wants(res, events) {
+		return nil
+	}
+	packets := new(bytes.Buffer)
+	writePcapPackets(packets, events)
+	if packets.Len() == 0 {
+		return nil
+	}
+	if c.dir != "" {
+		f, err := os.Create(filepath.Join(c.dir, pcapFileName(target, scanner)))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := writePcapHeader(f); err != nil {
+			return err
+		}
+		_, err = f.Write(packets.Bytes())
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.out != nil && c.rotateSize > 0 && c.written+int64(packets.Len()) > c.rotateSize {
+		c.out.Close()
+		c.out = nil
+		c.index++
+	}
+	if c.out == nil {
+		name := c.file
+		if c.index > 0 {
+			name += "." + strconv.Itoa(c.index)
+		}
+		f, err := os.Create(name)
+		if err != nil {
+			return err
+		}
+		if err := writePcapHeader(f); err != nil {
+			f.Close()
+			return err
+		}
+		c.out, c.written = f, 24
+	}
+	n, err := c.out.Write(packets.Bytes())
+	c.written += int64(n)
+	return err
+}
+
+// pcapFileName returns the name of the capture file of a scan of target by
+// the named scanner: its IP or domain, port and the scanner name, with the
+// characters other than letters, digits, dots and dashes replaced.
+func pcapFileName(target *ScanTarget, scanner string) string {
+	name := target.Domain
+	if target.IP != nil {
+		name = target.IP.String()
+	}
+	if target.Port != nil {
+		name += "_" + strconv.FormatUint(uint64(*target.Port), 10)
+	}
+	name += "_" + scanner
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name) + ".pcap"
+}
+
+// writePcapHeader writes the global header of a capture file.
+func writePcapHeader(w io.Writer) error {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], pcapSnapLen)
+	binary.LittleEndian.PutUint32(header[20:24], pcapLinkTypeRaw)
+	_, err := w.Write(header)
+	return err
+}
+
+// writePcapPackets writes the packet records reconstructed from the trace
+// events of the connections of a scan.
+func writePcapPackets(w *bytes.Buffer, events []TraceEvent) {
+	flows := make(map[int]*pcapFlow)
+	for _, ev := range events {
+		t, err := time.Parse(time.RFC3339Nano, ev.Time)
+		if err != nil {
+			continue
+		}
+		if ev.Event == "open" {
+			if flow := newPcapFlow(ev); flow != nil {
+				flows[ev.Connection] = flow
+				flow.open(w, t)
+			}
+			continue
+		}
+		flow := flows[ev.Connection]
+		if flow == nil {
+			continue
+		}
+		switch ev.Event {
+		case "write", "read":
+			data, err := hex.DecodeString(ev.Data)
+			if err == nil && len(data) > 0 {
+				flow.send(w, t, ev.Event == "write", data)
+			}
+		case "close":
+			flow.close(w, t)
+			delete(flows, ev.Connection)
+		}
+	}
+}
+
+// pcapFlow synthesizes the packets of a traced connection.
+type pcapFlow struct {
+	udp                   bool
+	localIP, remoteIP     net.IP
+	localPort, remotePort uint16
+	localSeq, remoteSeq   uint32
+	ipID                  uint16
+}
+
+// newPcapFlow returns the flow of the connection opened in ev, or nil if its
+// addresses are unknown.
+func newPcapFlow(ev TraceEvent) *pcapFlow {
+	remoteIP, remotePort, ok := splitPcapAddr(ev.Remote)
+	if !ok {
+		return nil
+	}
+	localIP, localPort, ok := splitPcapAddr(ev.local)
+	if !ok || (localIP.To4() == nil) != (remoteIP.To4() == nil) {
+		localIP, localPort = net.IPv4zero, 0
+		if remoteIP.To4() == nil {
+			localIP = net.IPv6unspecified
+		}
+	}
+	return &pcapFlow{
+		udp:        strings.HasPrefix(ev.network, "udp"),
+		localIP:    localIP,
+		remoteIP:   remoteIP,
+		localPort:  localPort,
+		remotePort: remotePort,
+		localSeq:   0x10000000,
+		remoteSeq:  0x20000000,
+	}
+}
+
+func splitPcapAddr(addr string) (net.IP, uint16, bool) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, 0, false
+	}
+	ip := net.ParseIP(host)
+	p, err := strconv.ParseUint(port, 10, 16)
+	if ip == nil || err != nil {
+		return nil, 0, false
+	}
+	return ip, uint16(p), true
+}
+
+// open writes the TCP handshake of the connection.
+func (f *pcapFlow) open(w *bytes.Buffer, t time.Time) {
+	if f.udp {
+		return
+	}
+	f.packet(w, t, true, tcpSYN, nil)
+	f.localSeq++
+	f.packet(w, t, false, tcpSYN|tcpACK, nil)
+	f.remoteSeq++
+	f.packet(w, t, true, tcpACK, nil)
+}
+
+// send writes the packets carrying data, sent if fromLocal is true, or
+// received.
+func (f *pcapFlow) send(w *bytes.Buffer, t time.Time, fromLocal bool, data []byte) {
+	if f.udp {
+		f.packet(w, t, fromLocal, 0, data)
+		return
+	}
+	for len(data) > 0 {
+		n := len(data)
+		if n > pcapMSS {
+			n = pcapMSS
+		}
+		f.packet(w, t, fromLocal, tcpPSH|tcpACK, data[:n])
+		if fromLocal {
+			f.localSeq += uint32(n)
+		} else {
+			f.remoteSeq += uint32(n)
+		}
+		data = data[n:]
+	}
+}
+
+// close writes the FIN sent when the connection was closed.
+func (f *pcapFlow) close(w *bytes.Buffer, t time.Time) {
+	if f.udp {
+		return
+	}
+	f.packet(w, t, true, tcpFIN|tcpACK, nil)
+	f.localSeq++
+}
+
+// packet writes the record of a single packet with the given TCP flags and
+// payload, or a UDP datagram.
+func (f *pcapFlow) packet(w *bytes.Buffer, t time.Time, fromLocal bool, flags byte, payload []byte) {
+	src, dst := f.localIP, f.remoteIP
+	sport, dport := f.localPort, f.remotePort
+	seq, ack := f.localSeq, f.remoteSeq
+	if !fromLocal {
+		src, dst = dst, src
+		sport, dport = dport, sport
+		seq, ack = ack, seq
+	}
+	var segment []byte
+	var proto byte
+	if f.udp {
+		proto = 17
+		segment = make([]byte, 8+len(payload))
+		binary.BigEndian.PutUint16(segment[0:2], sport)
+		binary.BigEndian.PutUint16(segment[2:4], dport)
+		binary.BigEndian.PutUint16(segment[4:6], uint16(len(segment)))
+		copy(segment[8:], payload)
+	} else {
+		proto = 6
+		segment = make([]byte, 20+len(payload))
+		binary.BigEndian.PutUint16(segment[0:2], sport)
+		binary.BigEndian.PutUint16(segment[2:4], dport)
+		binary.BigEndian.PutUint32(segment[4:8], seq)
+		if flags&tcpACK != 0 {
+			binary.BigEndian.PutUint32(segment[8:12], ack)
+		}
+		segment[12] = 5 << 4
+		segment[13] = flags
+		binary.BigEndian.PutUint16(segment[14:16], 0xffff)
+		copy(segment[20:], payload)
+	}
+	checksumOffset := 16
+	if f.udp {
+		checksumOffset = 6
+	}
+	sum := pseudoHeaderSum(src, dst, proto, len(segment))
+	checksum := internetChecksum(sum, segment)
+	if f.udp && checksum == 0 {
+		// A zero UDP checksum means none was computed.
+		checksum = 0xffff
+	}
+	binary.BigEndian.PutUint16(segment[checksumOffset:], checksum)
+
+	var ipHeader []byte
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		f.ipID++
+		ipHeader = make([]byte, 20)
+		ipHeader[0] = 0x45
+		binary.BigEndian.PutUint16(ipHeader[2:4], uint16(20+len(segment)))
+		binary.BigEndian.PutUint16(ipHeader[4:6], f.ipID)
+		ipHeader[6] = 0x40 // don't fragment
+		ipHeader[8] = 64
+		ipHeader[9] = proto
+		copy(ipHeader[12:16], src4)
+		copy(ipHeader[16:20], dst4)
+		binary.BigEndian.PutUint16(ipHeader[10:12], internetChecksum(0, ipHeader))
+	} else {
+		ipHeader = make([]byte, 40)
+		ipHeader[0] = 0x60
+		binary.BigEndian.PutUint16(ipHeader[4:6], uint16(len(segment)))
+		ipHeader[6] = proto
+		ipHeader[7] = 64
+		copy(ipHeader[8:24], src.To16())
+		copy(ipHeader[24:40], dst.To16())
+	}
+
+	length := len(ipHeader) + len(segment)
+	record := make([]byte, 16)
+	binary.LittleEndian.PutUint32(record[0:4], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(record[4:8], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:12], uint32(length))
+	binary.LittleEndian.PutUint32(record[12:16], uint32(length))
+	w.Write(record)
+	w.Write(ipHeader)
+	w.Write(segment)
+}
+
+// pseudoHeaderSum returns the sum of the pseudo-header covered by the TCP and
+// UDP checksums.
+func pseudoHeaderSum(src, dst net.IP, proto byte, length int) uint32 {
+	var header []byte
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		header = append(append(header, src4...), dst4...)
+		header = append(header, 0, proto, byte(length>>8), byte(length))
+	} else {
+		header = append(append(header, src.To16()...), dst.To16()...)
+		header = append(header, byte(length>>24), byte(length>>16), byte(length>>8), byte(length), 0, 0, 0, proto)
+	}
+	var sum uint32
+	for i := 0; i < len(header); i += 2 {
+		sum += uint32(header[i])<<8 | uint32(header[i+1])
+	}
+	return sum
+}
+
+// internetChecksum returns the one's complement checksum of data, starting
+// from sum.
+func internetChecksum(sum uint32, data []byte) uint16 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
@@ -0,0 +1,114 @@
+package zgrab2
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readPcap returns the packets of a capture file.
+func readPcap(t *testing.T, name string) [][]byte {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 24 || binary.LittleEndian.Uint32(data) != 0xa1b2c3d4 || binary.LittleEndian.Uint32(data[20:]) != pcapLinkTypeRaw {
+		t.Fatalf("bad capture header %x", data[:24])
+	}
+	var packets [][]byte
+	for data = data[24:]; len(data) >= 16; {
+		n := int(binary.LittleEndian.Uint32(data[8:12]))
+		packets = append(packets, data[16:16+n])
+		data = data[16+n:]
+	}
+	return packets
+}
+
+func TestPcapCapture(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 16)
+		conn.Read(buf)
+		conn.Write([]byte("SSH-2.0-OpenSSH_8.9\r\n"))
+	}()
+
+	trace := NewTrace(0)
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn = trace.Wrap(conn)
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 64)
+	n, _ := conn.Read(buf)
+	conn.Close()
+	if n == 0 {
+		t.Fatal("read nothing")
+	}
+
+	dir, err := ioutil.TempDir("", "pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	capture, err := newPcapCapture(&Config{PcapDir: dir, PcapStatuses: "protocol-error", PcapMatch: "OpenSSH"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := &ScanTarget{IP: net.ParseIP("127.0.0.1")}
+	if err := capture.write(target, "ssh", &ScanResponse{Status: SCAN_SUCCESS}, trace.Events()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The handshake, the data sent and received, and the FIN.
+	packets := readPcap(t, filepath.Join(dir, "127.0.0.1_ssh.pcap"))
+	if len(packets) != 6 {
+		t.Fatalf("got %d packets; expected 6", len(packets))
+	}
+	for i, packet := range packets {
+		if packet[0] != 0x45 || packet[9] != 6 {
+			t.Fatalf("packet %d is not IPv4 TCP: %x", i, packet)
+		}
+		if internetChecksum(0, packet[:20]) != 0 {
+			t.Errorf("bad IP checksum in packet %d", i)
+		}
+		if internetChecksum(pseudoHeaderSum(packet[12:16], packet[16:20], 6, len(packet)-20), packet[20:]) != 0 {
+			t.Errorf("bad TCP checksum in packet %d", i)
+		}
+	}
+	if flags := []byte{packets[0][33], packets[1][33], packets[5][33]}; flags[0] != tcpSYN || flags[1] != tcpSYN|tcpACK || flags[2] != tcpFIN|tcpACK {
+		t.Errorf("got TCP flags %x", flags)
+	}
+	if payload := string(packets[4][40:]); payload != string(buf[:n]) {
+		t.Errorf("got received payload %q", payload)
+	}
+	// The received data is acknowledged by the FIN.
+	if seq, ack := binary.BigEndian.Uint32(packets[4][24:28]), binary.BigEndian.Uint32(packets[5][28:32]); ack != seq+uint32(n) {
+		t.Errorf("FIN acknowledges %d; expected %d", ack, seq+uint32(n))
+	}
+
+	// Scans that match neither the statuses nor the pattern are not
+	// captured.
+	capture.match = nil
+	if capture.wants(&ScanResponse{Status: SCAN_SUCCESS}, trace.Events()) {
+		t.Error("captured a scan with another status")
+	}
+	if !capture.wants(&ScanResponse{Status: SCAN_PROTOCOL_ERROR}, nil) {
+		t.Error("did not capture a scan with a selected status")
+	}
+	if _, err := newPcapCapture(&Config{PcapDir: dir, PcapStatuses: "bogus"}); err == nil {
+		t.Error("expected an error for an unknown status")
+	}
+}
@@ -0,0 +1,83 @@
+package zgrab2
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PluginsEnv is the environment variable listing the plugins to load, as
+// paths separated by the OS path list separator. A directory stands for all
+// the .so files in it.
+const PluginsEnv = "ZGRAB2_PLUGINS"
+
+// LoadPlugin loads the Go plugin (built with -buildmode=plugin) at path. The
+// init functions of the plugin run as it is loaded: they register its modules
+// with AddCommand, exactly like the modules built into zgrab2, so that they
+// can then be selected on the command line and in multiple module configs.
+func LoadPlugin(path string) error {
+	before := len(modules)
+	if _, err := plugin.Open(path); err != nil {
+		return err
+	}
+	if len(modules) == before {
+		log.Warnf("plugin %s did not register any module", path)
+	}
+	return nil
+}
+
+// LoadPlugins loads the plugins listed in the ZGRAB2_PLUGINS environment
+// variable, in order. It must be called before the command line is parsed.
+func LoadPlugins() error {
+	paths, err := pluginFiles(os.Getenv(PluginsEnv))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := LoadPlugin(path); err != nil {
+			return fmt.Errorf("could not load plugin %s: %s", path, err)
+		}
+		log.Debugf("loaded plugin %s", path)
+	}
+	return nil
+}
+
+// pluginFiles returns the plugin files of a list of paths, replacing each
+// directory by the .so files it contains, sorted by name.
+func pluginFiles(list string) ([]string, error) {
+	var ret []string
+	for _, path := range filepath.SplitList(list) {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			ret = append(ret, path)
+			continue
+		}
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".so") {
+				names = append(names, entry.Name())
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ret = append(ret, filepath.Join(path, name))
+		}
+	}
+	return ret, nil
+}
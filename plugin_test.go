@@ -0,0 +1,39 @@
+package zgrab2
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPluginFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zgrab2-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"b.so", "a.so", "README"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	single := filepath.Join(dir, "README")
+
+	paths, err := pluginFiles(single + string(filepath.ListSeparator) + dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{single, filepath.Join(dir, "a.so"), filepath.Join(dir, "b.so")}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("got %v; expected %v", paths, expected)
+	}
+
+	if _, err := pluginFiles(filepath.Join(dir, "missing.so")); err == nil {
+		t.Error("no error for a missing plugin")
+	}
+	if err := LoadPlugin(single); err == nil {
+		t.Error("loaded a file that is not a plugin")
+	}
+}
@@ -1,20 +1,32 @@
 package zgrab2
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
-	"sync"
+
+	"strings"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2/lib/diff"
+	"github.com/zmap/zgrab2/lib/geo"
+	"github.com/zmap/zgrab2/lib/honeypot"
 	"github.com/zmap/zgrab2/lib/output"
+	"github.com/zmap/zgrab2/lib/transform"
 )
 
 // Grab contains all scan responses for a single host
 type Grab struct {
-	IP     string                  `json:"ip,omitempty"`
-	Domain string                  `json:"domain,omitempty"`
-	Data   map[string]ScanResponse `json:"data,omitempty"`
+	IP            string                  `json:"ip,omitempty"`
+	Domain        string                  `json:"domain,omitempty"`
+	SchemaVersion string                  `json:"schema_version"`
+	Geo           *geo.Record             `json:"geo,omitempty"`
+	Port          uint                    `json:"port,omitempty"`
+	Anomaly       *honeypot.Score         `json:"anomaly,omitempty"`
+	Data          map[string]ScanResponse `json:"data,omitempty"`
 }
 
 // ScanTarget is the host that will be scanned
@@ -22,7 +34,88 @@ type ScanTarget struct {
 	IP     net.IP
 	Domain string
 	Tag    string
-	Port   *uint
+
+	// Port, if set, overrides the port of the scanners, from the sixth
+	// column of the input.
+	Port *uint
+
+	// VHosts lists the virtual hosts to request from IP, for the modules
+	// that support it (e.g. http), from the fourth column of the input.
+	VHosts []string
+
+	// Proxy, if set, overrides --proxy for the connections to the target,
+	// from the fifth column of the input.
+	Proxy string
+
+	// Tags lists further tags of the target, from the JSON input; the
+	// scanners triggered by any of them are run.
+	Tags []string
+
+	// Options, if set, overrides options of the scanners for this target,
+	// from the JSON input.
+	Options *TargetOptions
+
+	// trace, if non-nil, records the traffic on connections opened for
+	// this target.
+	trace *Trace
+
+	// connLimit, if non-nil, bounds the number of concurrent connections
+	// to this target.
+	connLimit hostLimiter
+
+	// config, if non-nil, holds the framework options of the Engine
+	// scanning this target, used instead of the global ones.
+	config *Config
+}
+
+// TargetOptions are per-target settings from the JSON input, overriding the
+// options of the scanners that support them.
+type TargetOptions struct {
+	// Endpoint is the path requested by the http module.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Host is the Host header sent by the http module.
+	Host string `json:"host,omitempty"`
+
+	// SNI is the server name sent in TLS handshakes.
+	SNI string `json:"sni,omitempty"`
+
+	// Credentials names the entry of the --creds-file of the modules that
+	// log in (http, ssh, the mail and database modules) to use, instead of
+	// the target's.
+	Credentials string `json:"credentials,omitempty"`
+}
+
+// HasTag returns true if the target is tagged with tag, or if tag is empty
+// and the target has no tag.
+func (target *ScanTarget) HasTag(tag string) bool {
+	if target.Tag == tag {
+		return true
+	}
+	for _, t := range target.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// frameworkConfig returns the framework options of the Engine scanning the
+// target, or the global ones.
+func (target *ScanTarget) frameworkConfig() *Config {
+	if target != nil && target.config != nil {
+		return target.config
+	}
+	return &config
+}
+
+// GetOptions returns the per-target options, which are empty if none were
+// given.
+func (target *ScanTarget) GetOptions() TargetOptions {
+	if target.Options == nil {
+		return TargetOptions{}
+	}
+	return *target.Options
 }
 
 func (target ScanTarget) String() string {
@@ -56,7 +149,8 @@ func (target *ScanTarget) Host() string {
 }
 
 // Open connects to the ScanTarget using the configured flags, and returns a net.Conn that uses the configured timeouts for Read/Write operations.
-func (target *ScanTarget) Open(flags *BaseFlags) (net.Conn, error) {
+// Canceling ctx aborts the connection attempt, and interrupts the connection.
+func (target *ScanTarget) Open(ctx context.Context, flags *BaseFlags) (net.Conn, error) {
 	var port uint
 	// If the port is supplied in ScanTarget, let that override the cmdline option
 	if target.Port != nil {
@@ -66,14 +160,20 @@ func (target *ScanTarget) Open(flags *BaseFlags) (net.Conn, error) {
 	}
 
 	address := net.JoinHostPort(target.Host(), fmt.Sprintf("%d", port))
-	return DialTimeoutConnection("tcp", address, flags.Timeout, flags.BytesReadLimit)
+	release := target.AcquireConn()
+	conn, err := dialTimeoutConnection(ctx, target.ProxyURL(), "tcp", address, flags.Timeout, flags.Timeout, flags.Timeout, flags.Timeout, flags.BytesReadLimit)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return target.TraceConn(ReleaseOnClose(conn, release)), nil
 }
 
 // OpenTLS connects to the ScanTarget using the configured flags, then performs
 // the TLS handshake. On success error is nil, but the connection can be non-nil
 // even if there is an error (this allows fetching the handshake log).
-func (target *ScanTarget) OpenTLS(baseFlags *BaseFlags, tlsFlags *TLSFlags) (*TLSConnection, error) {
-	conn, err := tlsFlags.Connect(target, baseFlags)
+func (target *ScanTarget) OpenTLS(ctx context.Context, baseFlags *BaseFlags, tlsFlags *TLSFlags) (*TLSConnection, error) {
+	conn, err := tlsFlags.Connect(ctx, target, baseFlags)
 	if err != nil {
 		return conn, err
 	}
@@ -83,7 +183,8 @@ func (target *ScanTarget) OpenTLS(baseFlags *BaseFlags, tlsFlags *TLSFlags) (*TL
 
 // OpenUDP connects to the ScanTarget using the configured flags, and returns a net.Conn that uses the configured timeouts for Read/Write operations.
 // Note that the UDP "connection" does not have an associated timeout.
-func (target *ScanTarget) OpenUDP(flags *BaseFlags, udp *UDPFlags) (net.Conn, error) {
+// Canceling ctx interrupts the connection.
+func (target *ScanTarget) OpenUDP(ctx context.Context, flags *BaseFlags, udp *UDPFlags) (net.Conn, error) {
 	var port uint
 	// If the port is supplied in ScanTarget, let that override the cmdline option
 	if target.Port != nil {
@@ -91,26 +192,54 @@ func (target *ScanTarget) OpenUDP(flags *BaseFlags, udp *UDPFlags) (net.Conn, er
 	} else {
 		port = flags.Port
 	}
-	address := net.JoinHostPort(target.Host(), fmt.Sprintf("%d", port))
+	config := configFrom(ctx)
+	ip := target.IP
+	if ip == nil {
+		// Resolve the domain with the resolver of the scan, as the dialer
+		// of TCP connections does.
+		ips, err := config.resolver.lookup(ctx, target.Host())
+		if err != nil {
+			return nil, err
+		}
+		ip = ips[0]
+	}
+	if config.blocklist.Contains(ip) {
+		return nil, ErrBlocked
+	}
+	address := net.JoinHostPort(ip.String(), fmt.Sprintf("%d", port))
+	// The explicit local address, or else the next source address.
 	var local *net.UDPAddr
 	if udp != nil && (udp.LocalAddress != "" || udp.LocalPort != 0) {
 		local = &net.UDPAddr{}
-		if udp.LocalAddress != "" && udp.LocalAddress != "*" {
+		switch udp.LocalAddress {
+		case "":
+			local.IP = config.sources.pick(address)
+		case "*":
+		default:
 			local.IP = net.ParseIP(udp.LocalAddress)
 		}
 		if udp.LocalPort != 0 {
 			local.Port = int(udp.LocalPort)
 		}
+	} else {
+		local = localUDPAddr(config, address)
 	}
-	remote, err := net.ResolveUDPAddr("udp", address)
-	if err != nil {
+	dialer := newNetDialer(config, address)
+	if local != nil {
+		dialer.LocalAddr = local
+	} else {
+		dialer.LocalAddr = nil
+	}
+	if err := config.throttle.waitConn(ctx); err != nil {
 		return nil, err
 	}
-	conn, err := net.DialUDP("udp", local, remote)
+	release := target.AcquireConn()
+	conn, err := dialer.DialContext(ctx, "udp", address)
 	if err != nil {
+		release()
 		return nil, err
 	}
-	return NewTimeoutConnection(nil, conn, flags.Timeout, 0, 0, flags.BytesReadLimit), nil
+	return target.TraceConn(NewTimeoutConnection(ctx, ReleaseOnClose(conn, release), flags.Timeout, 0, 0, flags.BytesReadLimit)), nil
 }
 
 // BuildGrabFromInputResponse constructs a Grab object for a target, given the
@@ -121,11 +250,16 @@ func BuildGrabFromInputResponse(t *ScanTarget, responses map[string]ScanResponse
 	if t.IP != nil {
 		ipstr = t.IP.String()
 	}
-	return &Grab{
-		IP:     ipstr,
-		Domain: t.Domain,
-		Data:   responses,
+	grab := &Grab{
+		IP:            ipstr,
+		Domain:        t.Domain,
+		SchemaVersion: SchemaVersion,
+		Data:          responses,
+	}
+	if t.Port != nil {
+		grab.Port = *t.Port
 	}
+	return grab
 }
 
 // EncodeGrab serializes a Grab to JSON, handling the debug fields if necessary.
@@ -148,83 +282,94 @@ func EncodeGrab(raw *Grab, includeDebug bool) ([]byte, error) {
 	return json.Marshal(outputData)
 }
 
-// grabTarget calls handler for each action
-func grabTarget(input ScanTarget, m *Monitor) []byte {
-	moduleResult := make(map[string]ScanResponse)
+// newOutputFilter returns the filter given by --output-fields and
+// --output-exclude, or nil if neither is set. The fields identifying the
+// target are always kept when only some fields are.
+func newOutputFilter(config *Config) *diff.Filter {
+	if config.OutputFields == "" && config.OutputExclude == "" {
+		return nil
+	}
+	var include []string
+	if config.OutputFields != "" {
+		include = append(strings.Split(config.OutputFields, ","), "ip", "domain", "port")
+	}
+	return diff.NewFilter(include, strings.Split(config.OutputExclude, ","))
+}
 
-	for _, scannerName := range orderedScanners {
-		scanner := scanners[scannerName]
-		trigger := (*scanner).GetTrigger()
-		if input.Tag != trigger {
-			continue
+// newOutputTransformer returns the transformer anonymizing the fields of the
+// records given by the options, or nil if there are none.
+func newOutputTransformer(config *Config) (*transform.Transformer, error) {
+	var rules []transform.Rule
+	if config.TransformFile != "" {
+		var err error
+		if rules, err = transform.LoadRules(config.TransformFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range strings.Split(config.HMACFields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			rules = append(rules, transform.Rule{Path: field, Action: transform.HMAC})
 		}
-		defer func(name string) {
-			if e := recover(); e != nil {
-				log.Errorf("Panic on scanner %s when scanning target %s: %#v", scannerName, input.String(), e)
-				// Bubble out original error (with original stack) in lieu of explicitly logging the stack / error
-				panic(e)
-			}
-		}(scannerName)
-		name, res := RunScanner(*scanner, m, input)
-		moduleResult[name] = res
-		if res.Error != nil && !config.Multiple.ContinueOnError {
-			break
+	}
+	if config.AnonymizeIP != "" {
+		action := transform.TruncateIP
+		if config.AnonymizeIP == "hmac" {
+			action = transform.HMAC
 		}
-		if res.Status == SCAN_SUCCESS && config.Multiple.BreakOnSuccess {
-			break
+		// The target address is also in the network of its geo record,
+		// in the remote address of the traces (which can be a resolved
+		// domain), and in the strings of the results, e.g. URLs.
+		rules = append(rules,
+			transform.Rule{Path: "geo.prefix", Action: action},
+			transform.Rule{Path: "data.*.trace.*.remote", Action: action},
+			transform.Rule{Path: "ip", Action: action, Everywhere: true},
+		)
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	var key []byte
+	if config.TransformKeyFile != "" {
+		data, err := ioutil.ReadFile(config.TransformKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if key = bytes.TrimSpace(data); len(key) == 0 {
+			return nil, fmt.Errorf("the key file %s is empty", config.TransformKeyFile)
 		}
 	}
+	return transform.New(rules, key)
+}
 
-	raw := BuildGrabFromInputResponse(&input, moduleResult)
-	result, err := EncodeGrab(raw, includeDebugOutput())
-	if err != nil {
-		log.Fatalf("unable to marshal data: %s", err)
+// rewriteRecord removes the fields of an encoded record that filter does not
+// select, then applies transformer to it; either may be nil.
+func rewriteRecord(record []byte, filter *diff.Filter, transformer *transform.Transformer) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(record))
+	dec.UseNumber()
+	var decoded interface{}
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, err
 	}
-
-	return result
+	if filter != nil {
+		decoded = diff.Prune(decoded, filter)
+	}
+	if transformer != nil {
+		decoded = transformer.Apply(decoded)
+	}
+	return json.Marshal(decoded)
 }
 
 // Process sets up an output encoder, input reader, and starts grab workers.
 func Process(mon *Monitor) {
-	workers := config.Senders
-	processQueue := make(chan ScanTarget, workers*4)
-	outputQueue := make(chan []byte, workers*4)
-
-	//Create wait groups
-	var workerDone sync.WaitGroup
-	var outputDone sync.WaitGroup
-	workerDone.Add(int(workers))
-	outputDone.Add(1)
-
-	// Start the output encoder
-	go func() {
-		defer outputDone.Done()
-		if err := config.outputResults(outputQueue); err != nil {
-			log.Fatal(err)
-		}
-	}()
-	//Start all the workers
-	for i := 0; i < workers; i++ {
-		go func(i int) {
-			for _, scannerName := range orderedScanners {
-				scanner := *scanners[scannerName]
-				scanner.InitPerSender(i)
-			}
-			for obj := range processQueue {
-				for run := uint(0); run < uint(config.ConnectionsPerHost); run++ {
-					result := grabTarget(obj, mon)
-					outputQueue <- result
-				}
-			}
-			workerDone.Done()
-		}(i)
-	}
-
-	if err := config.inputTargets(processQueue); err != nil {
+	ProcessContext(context.Background(), mon)
+}
+
+// ProcessContext is like Process, but stops the scan once ctx is canceled,
+// after the results of the targets already done are output.
+func ProcessContext(ctx context.Context, mon *Monitor) {
+	defaultEngine.SetMonitor(mon)
+	err := defaultEngine.ProcessContext(ctx, config.inputTargets, config.outputResults)
+	if err != nil && err != ctx.Err() {
 		log.Fatal(err)
 	}
-	close(processQueue)
-	workerDone.Wait()
-	close(outputQueue)
-	outputDone.Wait()
 }
@@ -0,0 +1,182 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Progress is a point-in-time summary of a running scan, written periodically
+// by a ProgressReporter.
+type Progress struct {
+	Timestamp      string  `json:"timestamp"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+
+	// TargetsCompleted is the number of targets whose results were output.
+	TargetsCompleted uint64 `json:"targets_completed"`
+
+	// TargetsTotal estimates the total number of targets from the fraction
+	// of the input file read so far, if its size is known.
+	TargetsTotal uint64 `json:"targets_total,omitempty"`
+
+	// InputFraction is the fraction of the input file read so far, if its
+	// size is known.
+	InputFraction float64 `json:"input_fraction,omitempty"`
+
+	// Rate is the number of targets completed per second since the previous
+	// update.
+	Rate float64 `json:"rate"`
+
+	// ETASeconds estimates the time left, if the input size is known.
+	ETASeconds float64 `json:"eta_seconds,omitempty"`
+
+	Modules    map[string]*ModuleProgress `json:"modules"`
+	Throttling *ThrottleStats             `json:"throttling,omitempty"`
+	Skipped    *SkipStats                 `json:"skipped,omitempty"`
+}
+
+// ModuleProgress counts the results of a single scanner.
+type ModuleProgress struct {
+	Successes uint                `json:"successes"`
+	Failures  uint                `json:"failures"`
+	Statuses  map[ScanStatus]uint `json:"statuses"`
+}
+
+// ProgressReporter periodically writes the Progress of a running scan to an
+// io.Writer, as one JSON object per line.
+type ProgressReporter struct {
+	monitor  *Monitor
+	out      io.Writer
+	interval time.Duration
+
+	mu         sync.Mutex
+	lastDone   uint64
+	lastTime   time.Duration
+	closeAfter io.Closer
+
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// NewProgressReporter returns a ProgressReporter that writes the progress of
+// monitor to out every interval.
+func NewProgressReporter(monitor *Monitor, out io.Writer, interval time.Duration) *ProgressReporter {
+	return &ProgressReporter{
+		monitor:  monitor,
+		out:      out,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// StartProgressReporter creates a ProgressReporter writing to the file given
+// by --status-updates-file for the given monitor and starts it, or returns nil
+// if no status updates were requested.
+func StartProgressReporter(monitor *Monitor) *ProgressReporter {
+	if config.StatusUpdatesFile == "" {
+		return nil
+	}
+	var r *ProgressReporter
+	if config.StatusUpdatesFile == "-" {
+		r = NewProgressReporter(monitor, os.Stderr, config.StatusInterval)
+	} else {
+		f, err := os.Create(config.StatusUpdatesFile)
+		if err != nil {
+			log.Fatalf("could not create status updates file: %s", err)
+		}
+		r = NewProgressReporter(monitor, f, config.StatusInterval)
+		r.closeAfter = f
+	}
+	r.Start()
+	return r
+}
+
+// Start begins writing progress updates in the background.
+func (r *ProgressReporter) Start() {
+	r.stopped.Add(1)
+	go func() {
+		defer r.stopped.Done()
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.report()
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop writes a final update and stops the reporter. It is a no-op on a nil
+// reporter.
+func (r *ProgressReporter) Stop() {
+	if r == nil {
+		return
+	}
+	close(r.done)
+	r.stopped.Wait()
+	r.report()
+	if r.closeAfter != nil {
+		r.closeAfter.Close()
+	}
+}
+
+// Progress returns the current progress of the scan, with the rate computed
+// since the previous call.
+func (r *ProgressReporter) Progress() *Progress {
+	snapshots, elapsed := r.monitor.Snapshot()
+	completed := r.monitor.TargetsCompleted()
+
+	r.mu.Lock()
+	rate := 0.0
+	if interval := elapsed - r.lastTime; interval > 0 {
+		rate = float64(completed-r.lastDone) / interval.Seconds()
+	}
+	r.lastDone, r.lastTime = completed, elapsed
+	r.mu.Unlock()
+
+	ret := &Progress{
+		Timestamp:        time.Now().Format(time.RFC3339),
+		ElapsedSeconds:   elapsed.Seconds(),
+		TargetsCompleted: completed,
+		Rate:             rate,
+		Modules:          make(map[string]*ModuleProgress, len(snapshots)),
+	}
+	if fraction, eta, ok := inputETA(elapsed); ok {
+		ret.InputFraction = fraction
+		ret.ETASeconds = eta.Seconds()
+		ret.TargetsTotal = uint64(float64(completed) / fraction)
+	}
+	for _, s := range snapshots {
+		ret.Modules[s.Name] = &ModuleProgress{
+			Successes: s.Successes,
+			Failures:  s.Failures,
+			Statuses:  s.Statuses,
+		}
+	}
+	if throttling := r.monitor.Throttling(); throttling.Delayed > 0 {
+		ret.Throttling = &throttling
+	}
+	if skipped := r.monitor.Skipped(); skipped != (SkipStats{}) {
+		ret.Skipped = &skipped
+	}
+	return ret
+}
+
+// report writes one progress update.
+func (r *ProgressReporter) report() {
+	data, err := json.Marshal(r.Progress())
+	if err != nil {
+		log.Errorf("could not encode progress: %s", err)
+		return
+	}
+	if _, err := r.out.Write(append(data, '\n')); err != nil {
+		log.Errorf("could not write progress: %s", err)
+	}
+}
@@ -0,0 +1,38 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgressReporter(t *testing.T) {
+	var wg sync.WaitGroup
+	monitor := MakeMonitor(4, &wg)
+	monitor.statusesChan <- moduleStatus{name: "http", st: statusSuccess, status: SCAN_SUCCESS}
+	monitor.statusesChan <- moduleStatus{name: "http", st: statusFailure, status: SCAN_CONNECTION_TIMEOUT}
+	monitor.statusesChan <- moduleStatus{name: "http", st: statusFailure, status: SCAN_CONNECTION_TIMEOUT}
+	monitor.Stop()
+	wg.Wait()
+	monitor.recordTarget()
+	monitor.recordTarget()
+
+	out := new(bytes.Buffer)
+	r := NewProgressReporter(monitor, out, time.Hour)
+	r.Start()
+	r.Stop()
+
+	var progress Progress
+	if err := json.Unmarshal(out.Bytes(), &progress); err != nil {
+		t.Fatalf("could not decode %q: %s", out, err)
+	}
+	if progress.TargetsCompleted != 2 || progress.Rate <= 0 {
+		t.Errorf("completed %d targets at %f/s", progress.TargetsCompleted, progress.Rate)
+	}
+	http := progress.Modules["http"]
+	if http == nil || http.Successes != 1 || http.Failures != 2 || http.Statuses[SCAN_CONNECTION_TIMEOUT] != 2 {
+		t.Errorf("unexpected http progress %+v", http)
+	}
+}
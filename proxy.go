@@ -0,0 +1,306 @@
+package zgrab2
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ErrProxyUnsupportedNetwork is returned when dialing a non-TCP network
+// through a proxy.
+var ErrProxyUnsupportedNetwork = errors.New("only TCP connections can be proxied")
+
+// ParseProxy parses a proxy URL: socks5://[user:password@]host:port (with the
+// target's name resolved locally), socks5h://... (resolved by the proxy) or
+// http://[user:password@]host:port (HTTP CONNECT).
+func ParseProxy(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("proxy %s has no port", s)
+	}
+	return u, nil
+}
+
+// ProxyURL returns the proxy to use for connections to the target: the one of
+// the input, if any, or else the one of --proxy (or of the options of the
+// Engine scanning the target), or nil.
+func (target *ScanTarget) ProxyURL() *url.URL {
+	if target != nil && target.Proxy != "" {
+		if u, err := ParseProxy(target.Proxy); err == nil {
+			return u
+		}
+	}
+	return target.frameworkConfig().proxy
+}
+
+// DialProxy opens a TCP connection to address through the proxy, within
+// timeout. The address is refused with ErrBlocked, before the proxy is
+// contacted, if it is in the blocklist (see proxyTarget).
+func DialProxy(ctx context.Context, proxy *url.URL, network, address string, timeout time.Duration) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, ErrProxyUnsupportedNetwork
+	}
+	address, err := proxyTarget(ctx, configFrom(ctx), proxy, address)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	conn, err := newNetDialer(configFrom(ctx), proxy.Host).DialContext(ctx, "tcp", proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	ret := conn
+	switch proxy.Scheme {
+	case "http":
+		ret, err = connectHTTP(conn, proxy, address)
+	default:
+		err = connectSOCKS5(ctx, conn, proxy, address)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %s", proxy.Host, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return ret, nil
+}
+
+// proxyTarget checks address against the blocklist of config, which the
+// dialer only applies to the address of the proxy, and returns the address to
+// ask the proxy to connect to. With a socks5 proxy, a name is resolved
+// locally, and its address is given to the proxy, so that the address checked
+// is the one connected to. Names resolved by the proxy (with socks5h, or HTTP
+// CONNECT) cannot be checked, and are refused when there is a blocklist.
+func proxyTarget(ctx context.Context, config *Config, proxy *url.URL, address string) (string, error) {
+	if config.blocklist == nil {
+		return address, nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		if proxy.Scheme != "socks5" {
+			return "", ErrBlocked
+		}
+		ips, err := config.resolver.lookup(ctx, host)
+		if err != nil {
+			return "", err
+		}
+		ip = ips[0]
+	}
+	if config.blocklist.Contains(ip) {
+		return "", ErrBlocked
+	}
+	return net.JoinHostPort(ip.String(), port), nil
+}
+
+// bufferedConn is a net.Conn whose first bytes were read ahead into a buffer.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	if c.r.Buffered() > 0 {
+		return c.r.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+// connectHTTP asks the HTTP proxy on conn to connect to address, and returns
+// the connection to use.
+func connectHTTP(conn net.Conn, proxy *url.URL, address string) (net.Conn, error) {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("CONNECT %s: %s", address, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		// The target spoke first, in the same read as the response.
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// SOCKS5 (RFC 1928) constants.
+const (
+	socks5Version      = 5
+	socks5AuthNone     = 0
+	socks5AuthPassword = 2
+	socks5NoAcceptable = 0xff
+	socks5Connect      = 1
+	socks5IPv4         = 1
+	socks5Domain       = 3
+	socks5IPv6         = 4
+)
+
+// socks5Errors are the messages of the SOCKS5 reply codes.
+var socks5Errors = []string{
+	"",
+	"general failure",
+	"connection not allowed by ruleset",
+	"network unreachable",
+	"host unreachable",
+	"connection refused",
+	"TTL expired",
+	"command not supported",
+	"address type not supported",
+}
+
+// connectSOCKS5 asks the SOCKS5 proxy on conn to connect to address,
+// authenticating with the username and password of the proxy URL (RFC 1929)
+// if it has any.
+func connectSOCKS5(ctx context.Context, conn net.Conn, proxy *url.URL, address string) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil && proxy.Scheme == "socks5" {
+		ips, err := configFrom(ctx).resolver.lookup(ctx, host)
+		if err != nil {
+			return err
+		}
+		ip = ips[0]
+	}
+
+	methods := []byte{socks5AuthNone}
+	if proxy.User != nil {
+		methods = []byte{socks5AuthNone, socks5AuthPassword}
+	}
+	if _, err := conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("unexpected SOCKS version %d", reply[0])
+	}
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if proxy.User == nil {
+			return errors.New("SOCKS5 proxy requires a password")
+		}
+		username := proxy.User.Username()
+		password, _ := proxy.User.Password()
+		if len(username) > 255 || len(password) > 255 {
+			return errors.New("SOCKS5 username or password too long")
+		}
+		b := []byte{1, byte(len(username))}
+		b = append(b, username...)
+		b = append(b, byte(len(password)))
+		b = append(b, password...)
+		if _, err := conn.Write(b); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("SOCKS5 authentication failed")
+		}
+	case socks5NoAcceptable:
+		return errors.New("no acceptable SOCKS5 authentication method")
+	default:
+		return fmt.Errorf("unexpected SOCKS5 authentication method %d", reply[1])
+	}
+
+	req := []byte{socks5Version, socks5Connect, 0}
+	switch {
+	case ip.To4() != nil:
+		req = append(req, socks5IPv4)
+		req = append(req, ip.To4()...)
+	case ip != nil:
+		req = append(req, socks5IPv6)
+		req = append(req, ip.To16()...)
+	default:
+		if len(host) > 255 {
+			return fmt.Errorf("host name too long: %s", host)
+		}
+		req = append(req, socks5Domain, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return err
+	}
+	if header[1] != 0 {
+		if int(header[1]) < len(socks5Errors) {
+			return fmt.Errorf("SOCKS5 connect to %s: %s", address, socks5Errors[header[1]])
+		}
+		return fmt.Errorf("SOCKS5 connect to %s: error %d", address, header[1])
+	}
+	// Skip the bound address.
+	var n int
+	switch header[3] {
+	case socks5IPv4:
+		n = net.IPv4len
+	case socks5IPv6:
+		n = net.IPv6len
+	case socks5Domain:
+		var l [1]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return err
+		}
+		n = int(l[0])
+	default:
+		return fmt.Errorf("unexpected SOCKS5 address type %d", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, n+2))
+	return err
+}
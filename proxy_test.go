@@ -0,0 +1,210 @@
+package zgrab2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveOnce accepts a single connection on a new listener and hands it to
+// handle, returning the address of the listener.
+func serveOnce(t *testing.T, handle func(net.Conn)) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	return l.Addr().String()
+}
+
+func TestDialProxySOCKS5(t *testing.T) {
+	var request []byte
+	addr := serveOnce(t, func(conn net.Conn) {
+		buf := make([]byte, 4)
+		// Greeting, offering no authentication and password.
+		io.ReadFull(conn, buf[:4])
+		conn.Write([]byte{5, 2})
+		// Username/password authentication.
+		io.ReadFull(conn, buf[:2])
+		user := make([]byte, buf[1]+1)
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, make([]byte, user[len(user)-1]))
+		conn.Write([]byte{1, 0})
+		// Connect request, for a domain name.
+		io.ReadFull(conn, buf[:4])
+		io.ReadFull(conn, buf[:1])
+		request = make([]byte, buf[0]+2)
+		io.ReadFull(conn, request)
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 80, 'h', 'i'})
+	})
+	proxy, err := ParseProxy("socks5h://user:secret@" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := DialProxy(context.Background(), proxy, "tcp", "example.com:8080", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if expected := append([]byte("example.com"), 0x1f, 0x90); !bytes.Equal(request, expected) {
+		t.Errorf("requested %q; expected %q", request, expected)
+	}
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(conn, b); err != nil || string(b) != "hi" {
+		t.Errorf("read %q, %v after the SOCKS5 handshake", b, err)
+	}
+}
+
+func TestDialProxySOCKS5Refused(t *testing.T) {
+	addr := serveOnce(t, func(conn net.Conn) {
+		buf := make([]byte, 10)
+		io.ReadFull(conn, buf[:3])
+		conn.Write([]byte{5, 0})
+		io.ReadFull(conn, buf[:10])
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+	})
+	proxy, _ := ParseProxy("socks5://" + addr)
+	if _, err := DialProxy(context.Background(), proxy, "tcp", "10.0.0.1:22", time.Second); err == nil {
+		t.Errorf("DialProxy succeeded although the proxy refused the connection")
+	}
+}
+
+func TestDialProxyBlocked(t *testing.T) {
+	var request []byte
+	addr := serveOnce(t, func(conn net.Conn) {
+		buf := make([]byte, 4)
+		io.ReadFull(conn, buf[:3])
+		conn.Write([]byte{5, 0})
+		// Connect request, for an IPv4 address.
+		request = make([]byte, 10)
+		io.ReadFull(conn, request)
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 80})
+	})
+	config := &Config{}
+	config.blocklist, _ = ParseBlocklist(strings.NewReader("192.0.2.0/24"))
+	ctx := withConfig(context.Background(), config)
+	socks5, _ := ParseProxy("socks5://" + addr)
+	socks5h, _ := ParseProxy("socks5h://" + addr)
+	connectProxy, _ := ParseProxy("http://" + addr)
+
+	// The proxy is not contacted for blocked addresses, nor for names it
+	// would resolve itself.
+	for _, test := range []struct {
+		proxy   *url.URL
+		address string
+	}{
+		{socks5, "192.0.2.1:80"},
+		{socks5h, "localhost:80"},
+		{connectProxy, "localhost:80"},
+	} {
+		_, err := dialTimeoutConnection(ctx, test.proxy, "tcp", test.address, time.Second, time.Second, time.Second, time.Second, 0)
+		if status := TryGetScanStatus(err); status != SCAN_BLOCKED {
+			t.Errorf("%s through %s: got status %s, error %v; expected %s", test.address, test.proxy.Scheme, status, err, SCAN_BLOCKED)
+		}
+	}
+	_, err := (&Dialer{Proxy: socks5, Dialer: new(net.Dialer)}).DialContext(ctx, "tcp", "192.0.2.1:80")
+	if status := TryGetScanStatus(err); status != SCAN_BLOCKED {
+		t.Errorf("got status %s, error %v from the Dialer; expected %s", status, err, SCAN_BLOCKED)
+	}
+
+	// With socks5, a name is resolved locally, and its address is checked
+	// and given to the proxy.
+	conn, err := DialProxy(ctx, socks5, "tcp", "localhost:80", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if expected := []byte{5, 1, 0, 1, 127, 0, 0, 1, 0, 80}; !bytes.Equal(request, expected) {
+		t.Errorf("requested %x; expected %x", request, expected)
+	}
+}
+
+func TestDialProxySOCKS5Resolver(t *testing.T) {
+	dns, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dns.Close()
+	var queries int32
+	go serveDNS(dns, &queries)
+
+	var request []byte
+	addr := serveOnce(t, func(conn net.Conn) {
+		buf := make([]byte, 3)
+		io.ReadFull(conn, buf)
+		conn.Write([]byte{5, 0})
+		request = make([]byte, 10)
+		io.ReadFull(conn, request)
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 80})
+	})
+	// Without a blocklist, the name is resolved with the resolver of the
+	// Engine when connecting.
+	r, _ := newResolver(&Config{Resolvers: dns.LocalAddr().String()})
+	ctx := withConfig(context.Background(), &Config{resolver: r})
+	socks5, _ := ParseProxy("socks5://" + addr)
+	conn, err := DialProxy(ctx, socks5, "tcp", "example.com:80", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if expected := []byte{5, 1, 0, 1, 192, 0, 2, 1, 0, 80}; !bytes.Equal(request, expected) {
+		t.Errorf("requested %x; expected %x", request, expected)
+	}
+}
+
+func TestDialProxyHTTP(t *testing.T) {
+	var request *http.Request
+	addr := serveOnce(t, func(conn net.Conn) {
+		request, _ = http.ReadRequest(bufio.NewReader(conn))
+		// The target's banner arrives with the proxy's response.
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\nSSH-2.0-OpenSSH_8.0\r\n"))
+	})
+	proxy, err := ParseProxy("http://user:secret@" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := DialProxy(context.Background(), proxy, "tcp", "10.0.0.1:22", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if request == nil || request.Method != "CONNECT" || request.Host != "10.0.0.1:22" {
+		t.Errorf("proxy received %+v", request)
+	} else if user, password, ok := request.BasicAuth(); ok || user != "" || password != "" {
+		t.Errorf("proxy received credentials in Authorization")
+	} else if request.Header.Get("Proxy-Authorization") != "Basic dXNlcjpzZWNyZXQ=" {
+		t.Errorf("Proxy-Authorization = %q", request.Header.Get("Proxy-Authorization"))
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "SSH-2.0-OpenSSH_8.0\r\n" {
+		t.Errorf("read %q, %v after CONNECT", line, err)
+	}
+}
+
+func TestParseProxy(t *testing.T) {
+	for _, s := range []string{"socks5://127.0.0.1:1080", "socks5h://tor:9050", "http://u:p@proxy:3128"} {
+		if _, err := ParseProxy(s); err != nil {
+			t.Errorf("ParseProxy(%q): %v", s, err)
+		}
+	}
+	for _, s := range []string{"socks4://127.0.0.1:1080", "http://proxy", "127.0.0.1:1080"} {
+		if _, err := ParseProxy(s); err == nil {
+			t.Errorf("ParseProxy(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits the rate of events to rate per second, with bursts of up
+// to burst events.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	// now returns the current time; it is replaced in tests.
+	now func() time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now(), now: time.Now}
+}
+
+// reserve takes the next event, and returns how long to wait before it may
+// happen. The token is taken now, even if it is only available later, so that
+// waiters are served in order.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens < 0 {
+		return time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	return 0
+}
+
+// wait blocks until an event may happen, or ctx is canceled, and returns how
+// long it waited.
+func (b *tokenBucket) wait(ctx context.Context) (time.Duration, error) {
+	delay := b.reserve()
+	if delay <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		return delay, ctx.Err()
+	}
+}
+
+// prefixLimiter bounds the number of targets scanned concurrently in each
+// network prefix.
+type prefixLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	max    int
+	mask4  net.IPMask
+	mask6  net.IPMask
+	active map[string]int
+}
+
+func newPrefixLimiter(max, length4, length6 int) *prefixLimiter {
+	l := &prefixLimiter{
+		max:    max,
+		mask4:  net.CIDRMask(length4, 8*net.IPv4len),
+		mask6:  net.CIDRMask(length6, 8*net.IPv6len),
+		active: make(map[string]int),
+	}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// prefix returns the key of the prefix of ip.
+func (l *prefixLimiter) prefix(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return string(ip4.Mask(l.mask4))
+	}
+	return string(ip.Mask(l.mask6))
+}
+
+// acquire blocks until a target in the prefix of ip may be scanned, and returns
+// how long it waited and the function to call once the scan is done.
+func (l *prefixLimiter) acquire(ip net.IP) (time.Duration, func()) {
+	key := l.prefix(ip)
+	start := time.Now()
+	waited := false
+	l.mu.Lock()
+	for l.active[key] >= l.max {
+		waited = true
+		l.cond.Wait()
+	}
+	l.active[key]++
+	l.mu.Unlock()
+	var delay time.Duration
+	if waited {
+		delay = time.Since(start)
+	}
+	return delay, func() {
+		l.mu.Lock()
+		if l.active[key]--; l.active[key] == 0 {
+			delete(l.active, key)
+		}
+		l.mu.Unlock()
+		l.cond.Broadcast()
+	}
+}
+
+// throttle applies the --rate limit to the connections opened by the
+// scanners, through ScanTarget.Open, ScanTarget.OpenUDP and Dialer, and the
+// --rate-per-prefix limit to the targets they scan.
+type throttle struct {
+	bucket   *tokenBucket
+	prefixes *prefixLimiter
+	resolver *resolver
+	// monitor is set by Engine.SetMonitor, before the scan starts.
+	monitor *Monitor
+}
+
+// newThrottle returns the throttle for the limits of config, or nil if there
+// are none. Targets given only by domain are resolved with the resolver of
+// config to be limited per prefix.
+func newThrottle(config *Config) *throttle {
+	if config.Rate <= 0 && config.RatePerPrefix <= 0 {
+		return nil
+	}
+	t := &throttle{resolver: config.resolver}
+	if config.Rate > 0 {
+		t.bucket = newTokenBucket(config.Rate, config.RateBurst)
+	}
+	if config.RatePerPrefix > 0 {
+		t.prefixes = newPrefixLimiter(config.RatePerPrefix, config.RatePrefixLength, config.RatePrefixLength6)
+	}
+	return t
+}
+
+// setMonitor sets the Monitor recording the delays imposed by t.
+func (t *throttle) setMonitor(m *Monitor) {
+	if t != nil {
+		t.monitor = m
+	}
+}
+
+func (t *throttle) record(delay time.Duration) {
+	if delay > 0 && t.monitor != nil {
+		t.monitor.recordThrottle(delay)
+	}
+}
+
+// waitTarget blocks until the target may be scanned, and returns the function
+// to call once it has been. A target given only by domain is resolved first,
+// so that it is limited in the prefix of the address its scanners connect to;
+// if it cannot be resolved, it is not limited per prefix.
+func (t *throttle) waitTarget(ctx context.Context, target *ScanTarget) func() {
+	if t == nil || t.prefixes == nil {
+		return func() {}
+	}
+	t.resolver.resolveTarget(ctx, target)
+	if target.IP == nil {
+		return func() {}
+	}
+	delay, release := t.prefixes.acquire(target.IP)
+	t.record(delay)
+	return release
+}
+
+// waitConn blocks until a connection may be opened, or ctx is canceled.
+func (t *throttle) waitConn(ctx context.Context) error {
+	if t == nil || t.bucket == nil {
+		return nil
+	}
+	delay, err := t.bucket.wait(ctx)
+	t.record(delay)
+	return err
+}
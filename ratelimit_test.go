@@ -0,0 +1,144 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(100, 2)
+	start := time.Now()
+	// The burst passes immediately, then events are 10ms apart.
+	for i := 0; i < 7; i++ {
+		b.wait(context.Background())
+	}
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("7 events at 100/s with a burst of 2 took %s; expected about 50ms", elapsed)
+	}
+}
+
+func TestPrefixLimiter(t *testing.T) {
+	l := newPrefixLimiter(2, 24, 48)
+	if l.prefix(net.ParseIP("10.0.0.1")) != l.prefix(net.ParseIP("10.0.0.254")) {
+		t.Errorf("10.0.0.1 and 10.0.0.254 are in different /24 prefixes")
+	}
+	if l.prefix(net.ParseIP("10.0.0.1")) == l.prefix(net.ParseIP("10.0.1.1")) {
+		t.Errorf("10.0.0.1 and 10.0.1.1 are in the same /24 prefix")
+	}
+	if l.prefix(net.ParseIP("2001:db8:1::1")) != l.prefix(net.ParseIP("2001:db8:1:ffff::1")) {
+		t.Errorf("2001:db8:1::1 and 2001:db8:1:ffff::1 are in different /48 prefixes")
+	}
+
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, release := l.acquire(net.IPv4(10, 0, 0, byte(i)))
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			active--
+			mu.Unlock()
+			release()
+		}(i)
+	}
+	// Another prefix is not held up.
+	if delay, release := l.acquire(net.ParseIP("192.168.0.1")); delay != 0 {
+		t.Errorf("waited %s for an idle prefix", delay)
+	} else {
+		release()
+	}
+	wg.Wait()
+	if maxActive != 2 {
+		t.Errorf("%d targets of a prefix were scanned concurrently; expected 2", maxActive)
+	}
+	if len(l.active) != 0 {
+		t.Errorf("prefixes still active: %v", l.active)
+	}
+}
+
+func TestTokenBucketCanceled(t *testing.T) {
+	b := newTokenBucket(1, 1)
+	b.wait(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("got %v waiting past the deadline; expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestThrottleConnections(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	config := &Config{Rate: 100, RateBurst: 1}
+	config.throttle = newThrottle(config)
+	monitor := MakeMonitor(1, &sync.WaitGroup{})
+	config.throttle.setMonitor(monitor)
+	// The clock of the bucket is stopped, so that it holds a single token
+	// for the 4 dials however long they take: each of the last 3 waits
+	// 10ms more than the previous one.
+	clock := time.Now()
+	config.throttle.bucket.now = func() time.Time { return clock }
+	config.throttle.bucket.last = clock
+	ctx := withConfig(context.Background(), config)
+	dialer := NewDialer(nil)
+	start := time.Now()
+	// The limit applies to each connection, not to each target.
+	for i := 0; i < 4; i++ {
+		conn, err := dialer.DialContext(ctx, "tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("4 connections at 100/s took %s; expected at least 60ms", elapsed)
+	}
+	if throttling := monitor.Throttling(); throttling.Delayed != 3 || throttling.Wait != 60*time.Millisecond {
+		t.Errorf("got throttling %+v; expected 3 connections delayed for 60ms", throttling)
+	}
+}
+
+func TestThrottleResolvesTargets(t *testing.T) {
+	config := &Config{RatePerPrefix: 1, RatePrefixLength: 24, RatePrefixLength6: 48}
+	resolver, err := newResolver(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.resolver = resolver
+	config.throttle = newThrottle(config)
+
+	target := ScanTarget{Domain: "localhost"}
+	release := config.throttle.waitTarget(context.Background(), &target)
+	defer release()
+	if target.IP == nil {
+		t.Fatalf("localhost was not resolved before being limited per prefix")
+	}
+	if n := config.throttle.prefixes.active[config.throttle.prefixes.prefix(target.IP)]; n != 1 {
+		t.Errorf("%d targets active in the prefix of %s; expected 1", n, target.IP)
+	}
+}
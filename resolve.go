@@ -0,0 +1,255 @@
+package zgrab2
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The address families that --dns-prefer may select.
+const (
+	preferIPv4     = "ipv4"
+	preferIPv6     = "ipv6"
+	preferIPv4Only = "ipv4-only"
+	preferIPv6Only = "ipv6-only"
+)
+
+// resolver looks up the addresses of the targets given only by domain, with
+// the DNS servers, cache and address family preference of the config. A nil
+// resolver uses the system resolver and prefers IPv4 addresses.
+type resolver struct {
+	// net is the resolver used for lookups, and by the shared dialers if
+	// custom servers are set.
+	net     *net.Resolver
+	servers []string
+	next    uint32
+
+	prefer string
+	ttl    time.Duration
+
+	// allIPs is true if a target is scanned once per address.
+	allIPs bool
+
+	mu    sync.Mutex
+	cache map[string]cachedLookup
+}
+
+// cachedLookup is a lookup result kept for --dns-cache-ttl.
+type cachedLookup struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// newResolver returns the resolver configured by the --resolvers,
+// --dns-cache-ttl, --dns-prefer and --all-ips options.
+func newResolver(config *Config) (*resolver, error) {
+	ret := &resolver{
+		net:    net.DefaultResolver,
+		prefer: config.DNSPrefer,
+		ttl:    config.DNSCacheTTL,
+		allIPs: config.AllIPs,
+	}
+	switch ret.prefer {
+	case "":
+		ret.prefer = preferIPv4
+	case preferIPv4, preferIPv6, preferIPv4Only, preferIPv6Only:
+	default:
+		return nil, fmt.Errorf("unknown address family preference %q", ret.prefer)
+	}
+	if ret.ttl < 0 {
+		return nil, fmt.Errorf("cache TTL cannot be negative, given %s", ret.ttl)
+	}
+	if ret.ttl > 0 {
+		ret.cache = make(map[string]cachedLookup)
+	}
+	for _, server := range strings.Split(config.Resolvers, ",") {
+		server = strings.TrimSpace(server)
+		if server == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		host, _, _ := net.SplitHostPort(server)
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("resolver %q is not an IP address", server)
+		}
+		ret.servers = append(ret.servers, server)
+	}
+	if len(ret.servers) > 0 {
+		ret.net = &net.Resolver{PreferGo: true, Dial: ret.dialServer}
+	}
+	return ret, nil
+}
+
+// dialServer connects to the next of the custom DNS servers, ignoring the
+// address of the system's configuration.
+func (r *resolver) dialServer(ctx context.Context, network, address string) (net.Conn, error) {
+	server := r.servers[atomic.AddUint32(&r.next, 1)%uint32(len(r.servers))]
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, server)
+}
+
+// dialResolver returns the resolver the shared dialers use to look up names,
+// or nil to use the system resolver.
+func (r *resolver) dialResolver() *net.Resolver {
+	if r == nil || len(r.servers) == 0 {
+		return nil
+	}
+	return r.net
+}
+
+// dnsServer returns the address of the DNS server to send the queries the
+// net resolver cannot make (as of the HTTPS records of --tls-ech) to: the
+// next of the custom servers, or else the first of the system's.
+func (r *resolver) dnsServer() string {
+	if r != nil && len(r.servers) > 0 {
+		return r.servers[atomic.AddUint32(&r.next, 1)%uint32(len(r.servers))]
+	}
+	return systemDNSServer()
+}
+
+// systemDNSServer returns the first nameserver of /etc/resolv.conf, or the
+// local server the Go resolver falls back on if there is none.
+func systemDNSServer() string {
+	if data, err := ioutil.ReadFile("/etc/resolv.conf"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] == "nameserver" && net.ParseIP(fields[1]) != nil {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+// configured returns true if any of the resolution options is set, in which
+// case targets given by domain are resolved before they are scanned, even by
+// scanners run in turn.
+func (r *resolver) configured() bool {
+	return r != nil && (len(r.servers) > 0 || r.ttl > 0 || r.prefer != preferIPv4 || r.allIPs)
+}
+
+// lookup returns the addresses of domain, those of the preferred family
+// first.
+func (r *resolver) lookup(ctx context.Context, domain string) ([]net.IP, error) {
+	if r == nil {
+		r = &resolver{net: net.DefaultResolver, prefer: preferIPv4}
+	}
+	if r.cache != nil {
+		r.mu.Lock()
+		cached, ok := r.cache[domain]
+		r.mu.Unlock()
+		if ok && time.Now().Before(cached.expires) {
+			return cached.ips, nil
+		}
+	}
+	addrs, err := r.net.LookupIPAddr(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	var first, second []net.IP
+	for _, addr := range addrs {
+		v4 := addr.IP.To4() != nil
+		switch {
+		case v4 && (r.prefer == preferIPv4 || r.prefer == preferIPv4Only):
+			first = append(first, addr.IP)
+		case !v4 && (r.prefer == preferIPv6 || r.prefer == preferIPv6Only):
+			first = append(first, addr.IP)
+		case r.prefer == preferIPv4 || r.prefer == preferIPv6:
+			second = append(second, addr.IP)
+		}
+	}
+	ips := append(first, second...)
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no %s address for %s", strings.TrimSuffix(r.prefer, "-only"), domain)
+	}
+	if r.cache != nil {
+		r.mu.Lock()
+		r.cache[domain] = cachedLookup{ips: ips, expires: time.Now().Add(r.ttl)}
+		r.mu.Unlock()
+	}
+	return ips, nil
+}
+
+// resolveTarget sets the IP address of a target given only by domain to its
+// preferred address, so that all its scanners connect to the same address.
+// On failure, the target is left unchanged.
+func (r *resolver) resolveTarget(ctx context.Context, target *ScanTarget) {
+	if target.IP != nil || target.Domain == "" {
+		return
+	}
+	ips, err := r.lookup(ctx, target.Domain)
+	if err != nil {
+		log.Debugf("could not resolve %s: %v", target.Domain, err)
+		return
+	}
+	target.IP = ips[0]
+}
+
+// expandTargets returns a channel delivering the targets received on targets,
+// in order, with each target given only by domain replaced by one target per
+// address of the domain. Up to workers lookups are run at once. The channel is
+// closed once targets is closed, or ctx is canceled.
+func (r *resolver) expandTargets(ctx context.Context, targets <-chan ScanTarget, workers int) <-chan ScanTarget {
+	type expansion struct {
+		target ScanTarget
+		ips    []net.IP
+		done   chan struct{}
+	}
+	pending := make(chan *expansion, workers)
+	go func() {
+		defer close(pending)
+		for target := range targets {
+			exp := &expansion{target: target, done: make(chan struct{})}
+			if target.IP != nil || target.Domain == "" {
+				close(exp.done)
+			} else {
+				go func() {
+					defer close(exp.done)
+					ips, err := r.lookup(ctx, exp.target.Domain)
+					if err != nil {
+						log.Debugf("could not resolve %s: %v", exp.target.Domain, err)
+					}
+					exp.ips = ips
+				}()
+			}
+			select {
+			case pending <- exp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	ret := make(chan ScanTarget)
+	go func() {
+		defer close(ret)
+		for exp := range pending {
+			<-exp.done
+			expanded := []ScanTarget{exp.target}
+			if len(exp.ips) > 0 {
+				expanded = expanded[:0]
+				for _, ip := range exp.ips {
+					target := exp.target
+					target.IP = ip
+					expanded = append(expanded, target)
+				}
+			}
+			for _, target := range expanded {
+				select {
+				case ret <- target:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ret
+}
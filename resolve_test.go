@@ -0,0 +1,185 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// serveDNS answers the A and AAAA queries received on conn for any name with
+// two IPv4 addresses and one IPv6 address, counting the queries.
+func serveDNS(conn net.PacketConn, queries *int32) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+			continue
+		}
+		atomic.AddInt32(queries, 1)
+		q := query.Questions[0]
+		response := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true, Authoritative: true},
+			Questions: query.Questions,
+		}
+		header := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 60}
+		switch q.Type {
+		case dnsmessage.TypeA:
+			for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+				var a [4]byte
+				copy(a[:], net.ParseIP(ip).To4())
+				response.Answers = append(response.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: a}})
+			}
+		case dnsmessage.TypeAAAA:
+			var aaaa [16]byte
+			copy(aaaa[:], net.ParseIP("2001:db8::1"))
+			response.Answers = append(response.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: aaaa}})
+		}
+		packed, err := response.Pack()
+		if err != nil {
+			continue
+		}
+		conn.WriteTo(packed, addr)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var queries int32
+	go serveDNS(conn, &queries)
+
+	for _, test := range []struct {
+		prefer   string
+		expected []string
+	}{
+		{preferIPv4, []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}},
+		{preferIPv6, []string{"2001:db8::1", "192.0.2.1", "192.0.2.2"}},
+		{preferIPv4Only, []string{"192.0.2.1", "192.0.2.2"}},
+		{preferIPv6Only, []string{"2001:db8::1"}},
+	} {
+		r, err := newResolver(&Config{Resolvers: conn.LocalAddr().String(), DNSPrefer: test.prefer})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ips, err := r.lookup(context.Background(), "example.com")
+		if err != nil {
+			t.Fatalf("%s: %v", test.prefer, err)
+		}
+		if len(ips) != len(test.expected) {
+			t.Fatalf("%s: got %v; expected %v", test.prefer, ips, test.expected)
+		}
+		for i, ip := range ips {
+			if ip.String() != test.expected[i] {
+				t.Errorf("%s: got %v; expected %v", test.prefer, ips, test.expected)
+				break
+			}
+		}
+	}
+
+	r, _ := newResolver(&Config{Resolvers: conn.LocalAddr().String(), DNSCacheTTL: time.Minute})
+	atomic.StoreInt32(&queries, 0)
+	for i := 0; i < 3; i++ {
+		if _, err := r.lookup(context.Background(), "example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&queries); n != 2 {
+		t.Errorf("got %d queries for cached lookups; expected 2", n)
+	}
+
+	if _, err := newResolver(&Config{Resolvers: "dns.example.com"}); err == nil {
+		t.Error("expected an error for a resolver given by name")
+	}
+}
+
+func TestOpenUDPResolver(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var queries int32
+	go serveDNS(conn, &queries)
+
+	// The domain is resolved with the resolver of the Engine.
+	r, _ := newResolver(&Config{Resolvers: conn.LocalAddr().String()})
+	ctx := withConfig(context.Background(), &Config{resolver: r})
+	target := &ScanTarget{Domain: "example.com"}
+	udp, err := target.OpenUDP(ctx, &BaseFlags{Port: 53, Timeout: time.Second}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	if remote := udp.RemoteAddr().String(); remote != "192.0.2.1:53" {
+		t.Errorf("got remote address %s; expected 192.0.2.1:53", remote)
+	}
+}
+
+func TestResolverDNSServer(t *testing.T) {
+	r, _ := newResolver(&Config{Resolvers: "192.0.2.1, 192.0.2.2:5353"})
+	servers := map[string]bool{r.dnsServer(): true, r.dnsServer(): true}
+	if !servers["192.0.2.1:53"] || !servers["192.0.2.2:5353"] {
+		t.Errorf("got %v; expected the two custom servers", servers)
+	}
+	var none *resolver
+	if server := none.dnsServer(); server != systemDNSServer() {
+		t.Errorf("got %s without custom servers; expected the system's %s", server, systemDNSServer())
+	}
+}
+
+func TestEngineAllIPs(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var queries int32
+	go serveDNS(conn, &queries)
+
+	engine, err := NewEngine(&Config{Resolvers: conn.LocalAddr().String(), AllIPs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.AddModule("test", new(engineTestModule))
+	flags, _ := engine.NewFlags("test")
+	if _, err := engine.NewScanner("test", flags); err != nil {
+		t.Fatal(err)
+	}
+	targets := make(chan ScanTarget)
+	results := engine.Run(context.Background(), targets)
+	go func() {
+		targets <- ScanTarget{Domain: "example.com"}
+		targets <- ScanTarget{IP: net.ParseIP("198.51.100.1")}
+		close(targets)
+	}()
+	seen := make(map[string]string)
+	for grab := range results {
+		seen[grab.IP] = grab.Domain
+	}
+	expected := map[string]string{
+		"192.0.2.1":    "example.com",
+		"192.0.2.2":    "example.com",
+		"2001:db8::1":  "example.com",
+		"198.51.100.1": "",
+	}
+	if len(seen) != len(expected) {
+		t.Fatalf("got results for %v", seen)
+	}
+	for ip, domain := range expected {
+		if d, ok := seen[ip]; !ok || d != domain {
+			t.Errorf("got results for %v; expected %v", seen, expected)
+			break
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package zgrab2
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultRetryStatuses are the statuses retried when --retry-statuses is not
+// given: failures that a busy or rate-limiting host may not repeat later.
+var defaultRetryStatuses = map[ScanStatus]bool{
+	SCAN_CONNECTION_TIMEOUT: true,
+	SCAN_CONNECTION_REFUSED: true,
+}
+
+// retryableStatuses are the statuses that --retry-statuses may list.
+var retryableStatuses = map[ScanStatus]bool{
+	SCAN_CONNECTION_REFUSED: true,
+	SCAN_CONNECTION_TIMEOUT: true,
+	SCAN_CONNECTION_CLOSED:  true,
+	SCAN_IO_TIMEOUT:         true,
+	SCAN_PROTOCOL_ERROR:     true,
+	SCAN_APPLICATION_ERROR:  true,
+	SCAN_UNKNOWN_ERROR:      true,
+}
+
+// parseRetryStatuses parses the comma-separated --retry-statuses value. An
+// empty value gives the default statuses.
+func parseRetryStatuses(s string) (map[ScanStatus]bool, error) {
+	if strings.TrimSpace(s) == "" {
+		return defaultRetryStatuses, nil
+	}
+	ret := make(map[ScanStatus]bool)
+	for _, field := range strings.Split(s, ",") {
+		status := ScanStatus(strings.TrimSpace(field))
+		if !retryableStatuses[status] {
+			return nil, fmt.Errorf("%q is not a status that can be retried", field)
+		}
+		ret[status] = true
+	}
+	return ret, nil
+}
+
+// scanAttempt is a target queued to be scanned, together with the responses
+// of the scanners that are already done with it.
+type scanAttempt struct {
+	target  ScanTarget
+	seq     uint64
+	attempt int
+	done    map[string]ScanResponse
+
+	// runs counts the times each scanner was run on the target.
+	runs map[string]int
+}
+
+// retryQueue feeds the targets to the senders of an Engine, and requeues the
+// scanners of a target that failed with a transient status after a delay.
+type retryQueue struct {
+	work     chan *scanAttempt
+	retries  int
+	backoff  time.Duration
+	statuses map[ScanStatus]bool
+	pending  sync.WaitGroup
+}
+
+func newRetryQueue(config *Config, size int) *retryQueue {
+	statuses, err := parseRetryStatuses(config.RetryStatuses)
+	if err != nil {
+		statuses = defaultRetryStatuses
+	}
+	return &retryQueue{
+		work:     make(chan *scanAttempt, size),
+		retries:  config.Retries,
+		backoff:  config.RetryBackoff,
+		statuses: statuses,
+	}
+}
+
+// add queues a new target, at position seq in the input. It must not be
+// called after close.
+func (q *retryQueue) add(target ScanTarget, seq uint64) {
+	q.pending.Add(1)
+	q.work <- &scanAttempt{
+		target:  target,
+		seq:     seq,
+		attempt: 1,
+		done:    make(map[string]ScanResponse),
+		runs:    make(map[string]int),
+	}
+}
+
+// close closes the work channel once all queued targets are finished.
+func (q *retryQueue) close() {
+	go func() {
+		q.pending.Wait()
+		close(q.work)
+	}()
+}
+
+// delay returns how long to wait before the given attempt: the backoff,
+// doubled for each attempt after the second.
+func (q *retryQueue) delay(attempt int) time.Duration {
+	return q.backoff << uint(attempt-2)
+}
+
+// retry records the responses of an attempt. If any of them failed with a
+// retried status and attempts remain, it requeues the target for those
+// scanners after a delay and returns true; otherwise, the target is done and
+// must be finished once its results are output. Responses of scanners that
+// were retried record the number of times they were run.
+func (q *retryQueue) retry(a *scanAttempt, results map[string]ScanResponse) bool {
+	var failed []string
+	for name, res := range results {
+		if a.runs[name]++; a.runs[name] > 1 {
+			res.Attempts = a.runs[name]
+		}
+		a.done[name] = res
+		if q.statuses[res.Status] {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) == 0 || a.attempt > q.retries {
+		return false
+	}
+	for _, name := range failed {
+		delete(a.done, name)
+	}
+	a.attempt++
+	time.AfterFunc(q.delay(a.attempt), func() {
+		q.work <- a
+	})
+	return true
+}
+
+// finish marks a target as done.
+func (q *retryQueue) finish() {
+	q.pending.Done()
+}
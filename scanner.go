@@ -1,48 +1,106 @@
 package zgrab2
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 )
 
-var scanners map[string]*Scanner
-var orderedScanners []string
-
 // RegisterScan registers each individual scanner to be ran by the framework
 func RegisterScan(name string, s Scanner) {
-	//add to list and map
-	if scanners[name] != nil {
-		log.Fatalf("name: %s already used", name)
+	if err := defaultEngine.RegisterScan(name, s); err != nil {
+		log.Fatal(err)
 	}
-	orderedScanners = append(orderedScanners, name)
-	scanners[name] = &s
 }
 
 // PrintScanners prints all registered scanners
 func PrintScanners() {
-	for k, v := range scanners {
-		fmt.Println(k, v)
+	for _, name := range defaultEngine.Scanners() {
+		fmt.Println(name, defaultEngine.Scanner(name))
 	}
 }
 
-// RunScanner runs a single scan on a target and returns the resulting data
-func RunScanner(s Scanner, mon *Monitor, target ScanTarget) (string, ScanResponse) {
+// RunScanner runs a single scan on a target and returns the resulting data.
+// If mon is non-nil, the status of the scan is reported to it.
+func RunScanner(ctx context.Context, s Scanner, mon *Monitor, target ScanTarget) (string, ScanResponse) {
+	return RunScannerTimeout(ctx, s, mon, target, 0)
+}
+
+// ErrScanTimeout is the error of a scan abandoned by RunScannerTimeout.
+var ErrScanTimeout = NewScanError(SCAN_IO_TIMEOUT, errors.New("scan timeout exceeded"))
+
+// scanOutcome is the return value of Scanner.Scan, or the value of a panic.
+type scanOutcome struct {
+	status ScanStatus
+	result interface{}
+	err    error
+	panic  interface{}
+}
+
+// scanTimeoutGrace is how long RunScannerTimeout waits for a scanner to
+// return once its context is canceled by the timeout.
+const scanTimeoutGrace = 100 * time.Millisecond
+
+// RunScannerTimeout is like RunScanner, but if timeout is positive, the scan
+// is abandoned once it has run for that long, whether or not the scanner
+// returns: its context is canceled, and the response has an io-timeout status
+// and ErrScanTimeout as its error. The result is the one the scanner returns
+// within scanTimeoutGrace of the cancellation, if any.
+func RunScannerTimeout(ctx context.Context, s Scanner, mon *Monitor, target ScanTarget, timeout time.Duration) (string, ScanResponse) {
 	t := time.Now()
-	status, res, e := s.Scan(target)
-	var err *string
-	if e == nil {
-		mon.statusesChan <- moduleStatus{name: s.GetName(), st: statusSuccess}
-		err = nil
+	var outcome scanOutcome
+	if timeout <= 0 {
+		outcome.status, outcome.result, outcome.err = s.Scan(ctx, target)
 	} else {
-		mon.statusesChan <- moduleStatus{name: s.GetName(), st: statusFailure}
-		errString := e.Error()
+		scanCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		done := make(chan scanOutcome, 1)
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					done <- scanOutcome{panic: r}
+				}
+			}()
+			status, result, err := s.Scan(scanCtx, target)
+			done <- scanOutcome{status: status, result: result, err: err}
+		}()
+		select {
+		case outcome = <-done:
+		case <-scanCtx.Done():
+			select {
+			case outcome = <-done:
+			case <-time.After(scanTimeoutGrace):
+				outcome = scanOutcome{status: SCAN_IO_TIMEOUT, err: ErrScanTimeout}
+			}
+		}
+		if outcome.panic != nil {
+			// Re-raise the panic in the caller, which logs the target.
+			panic(outcome.panic)
+		}
+		if outcome.err != nil && ctx.Err() == nil && scanCtx.Err() == context.DeadlineExceeded {
+			outcome.status, outcome.err = SCAN_IO_TIMEOUT, ErrScanTimeout
+		}
+	}
+	elapsed := time.Since(t)
+	var err *string
+	st := statusSuccess
+	if outcome.err != nil {
+		st = statusFailure
+		errString := outcome.err.Error()
 		err = &errString
 	}
-	resp := ScanResponse{Result: res, Protocol: s.Protocol(), Error: err, Timestamp: t.Format(time.RFC3339), Status: status}
+	if mon != nil {
+		mon.statusesChan <- moduleStatus{name: s.GetName(), st: st, status: outcome.status, elapsed: elapsed}
+	}
+	resp := ScanResponse{
+		Result:    outcome.result,
+		Protocol:  s.Protocol(),
+		Error:     err,
+		Timestamp: t.Format(time.RFC3339),
+		Elapsed:   elapsed.Seconds(),
+		Status:    outcome.status,
+	}
 	return s.GetName(), resp
 }
-
-func init() {
-	scanners = make(map[string]*Scanner)
-}
@@ -0,0 +1,114 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/zmap/zgrab2/lib/schema"
+)
+
+// SchemaVersion is the version of the output record format. It is included in
+// every output record. It must be incremented whenever the structure of the
+// framework's output, or of any module's results, changes in a way that could
+// affect downstream consumers.
+const SchemaVersion = "2.1.0"
+
+// SchemaCommand contains the command line options for printing the schema of
+// the output records. Module names may be given as positional arguments;
+// if none are given, the schemas of all registered modules are printed.
+type SchemaCommand struct {
+	Format string `long:"format" default:"json-schema" choice:"json-schema" choice:"bigquery" choice:"elasticsearch" description:"Schema format to output"`
+}
+
+// Validate the options sent to SchemaCommand
+func (x *SchemaCommand) Validate(args []string) error {
+	return nil
+}
+
+// Help returns a usage string that will be output at the command line
+func (x *SchemaCommand) Help() string {
+	return ""
+}
+
+// ResultsModule is an optional interface for ScanModules that can describe
+// the results returned by their scanners.
+type ResultsModule interface {
+	// NewResults returns a new instance of the type that the module's
+	// scanners return as the ScanResponse's Result.
+	NewResults() interface{}
+}
+
+// RecordSchema returns the schema of an output record containing a single
+// scan response from the given module.
+func RecordSchema(name string, module ScanModule) *schema.Node {
+	record := schema.Describe(&Grab{})
+	response := schema.Describe(&ScanResponse{})
+	result := &schema.Node{Kind: schema.KindAny}
+	if m, ok := module.(ResultsModule); ok {
+		result = schema.Describe(m.NewResults())
+	}
+	response.Lookup("result").Node = result
+	record.Lookup("data").Node = &schema.Node{
+		Kind: schema.KindObject,
+		Fields: []*schema.Field{
+			{Name: name, Node: response, OmitEmpty: true},
+		},
+	}
+	return record
+}
+
+// getModuleNames returns the requested module names, or the names of all
+// registered modules if none were requested.
+func getModuleNames(names []string) ([]string, error) {
+	if len(names) == 0 {
+		for name := range modules {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+	for _, name := range names {
+		if modules[name] == nil {
+			return nil, fmt.Errorf("unknown module %s", name)
+		}
+	}
+	return names, nil
+}
+
+// Print writes the schema of each requested module's output record to w, as a
+// JSON object keyed by module name.
+func (x *SchemaCommand) Print(w io.Writer, names []string) error {
+	names, err := getModuleNames(names)
+	if err != nil {
+		return err
+	}
+	out := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		record := RecordSchema(name, modules[name])
+		switch x.Format {
+		case "bigquery":
+			out[name] = record.BigQuery()
+		case "elasticsearch":
+			out[name] = map[string]interface{}{
+				"mappings": map[string]interface{}{
+					"properties": record.Elasticsearch(),
+				},
+			}
+		default:
+			doc := record.JSONSchema()
+			doc["$schema"] = schema.JSONSchemaDraft
+			doc["$id"] = fmt.Sprintf("zgrab2/%s/%s", name, SchemaVersion)
+			doc["title"] = fmt.Sprintf("zgrab2 %s record", name)
+			doc["properties"].(map[string]interface{})["schema_version"] = map[string]interface{}{
+				"type":  "string",
+				"const": SchemaVersion,
+			}
+			out[name] = doc
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,36 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestSchemaElasticsearch(t *testing.T) {
+	modules.AddModule("schematest", new(engineTestModule))
+	defer modules.RemoveModule("schematest")
+
+	var buf bytes.Buffer
+	cmd := &SchemaCommand{Format: "elasticsearch"}
+	if err := cmd.Print(&buf, []string{"schematest"}); err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]struct {
+		Mappings struct {
+			Properties map[string]struct {
+				Type       string                     `json:"type"`
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	props := out["schematest"].Mappings.Properties
+	if props["ip"].Type != "keyword" || props["schema_version"].Type != "keyword" {
+		t.Errorf("unexpected mapping %s", buf.String())
+	}
+	if _, ok := props["data"].Properties["schematest"]; !ok {
+		t.Errorf("no mapping of the module's response in %s", buf.String())
+	}
+}
@@ -0,0 +1,216 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zmap/zgrab2/lib/testserver"
+)
+
+// selfTestTimeout is the timeout of the scans run by the self-tests.
+const selfTestTimeout = 5 * time.Second
+
+// SelfTestCommand contains the command line options for running the modules
+// against built-in fake servers. Module names may be given as positional
+// arguments; if none are given, the self-tests of all modules are run.
+type SelfTestCommand struct {
+	Verbose bool `long:"verbose" description:"Print the response of each scan"`
+}
+
+// Validate the options sent to SelfTestCommand
+func (x *SelfTestCommand) Validate(args []string) error {
+	return nil
+}
+
+// Help returns a usage string that will be output at the command line
+func (x *SelfTestCommand) Help() string {
+	return "Each module is run against a fake server on the loopback interface, and its status and result are checked."
+}
+
+// SelfTest is a scan of a module against a fake server, with its expected
+// outcome.
+type SelfTest struct {
+	// Name identifies the test; it defaults to the module name.
+	Name string
+
+	// Module is the name of the module to run.
+	Module string
+
+	// Server configures the fake TCP server scanned, unless UDP is set.
+	Server testserver.Config
+
+	// UDP, if not nil, answers the datagrams sent to a fake UDP server
+	// scanned instead.
+	UDP func(request []byte) []byte
+
+	// Configure, if not nil, adjusts the module's flags. The port and
+	// timeout are set beforehand.
+	Configure func(flags interface{})
+
+	// Status is the expected status of the scan (default success).
+	Status ScanStatus
+
+	// Expect, if not empty, must be found in the JSON encoding of the
+	// result.
+	Expect string
+}
+
+func (test *SelfTest) name() string {
+	if test.Name != "" {
+		return test.Name
+	}
+	return test.Module
+}
+
+// Run runs the self-tests of the modules named in names, or all of them if
+// names is empty, writing a line per test to w, and then one per registered
+// module without a self-test. It returns an error if any test failed, or if
+// all the tests were run and a module has none.
+func (x *SelfTestCommand) Run(w io.Writer, tests []SelfTest, names []string) error {
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = false
+	}
+	failed, run := 0, 0
+	for i := range tests {
+		test := &tests[i]
+		if _, ok := selected[test.Module]; len(names) > 0 && !ok {
+			continue
+		}
+		selected[test.Module] = true
+		run++
+		start := time.Now()
+		res, err := test.run()
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL  %s: %s\n", test.name(), err)
+		} else {
+			fmt.Fprintf(w, "ok    %s (%.2fs)\n", test.name(), time.Since(start).Seconds())
+		}
+		if x.Verbose && res != nil {
+			data, _ := json.Marshal(res)
+			fmt.Fprintf(w, "      %s\n", data)
+		}
+	}
+	for name, found := range selected {
+		if !found {
+			return fmt.Errorf("no self-test for module %s", name)
+		}
+	}
+	var skipped []string
+	if len(names) == 0 {
+		skipped = uncoveredModules(tests)
+		for _, name := range skipped {
+			fmt.Fprintf(w, "skip  %s: no self-test\n", name)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d self-tests failed", failed, run)
+	}
+	if len(skipped) > 0 {
+		return fmt.Errorf("%d modules have no self-test", len(skipped))
+	}
+	return nil
+}
+
+// uncoveredModules returns the names of the registered modules without a
+// test in tests, sorted.
+func uncoveredModules(tests []SelfTest) []string {
+	covered := make(map[string]bool, len(tests))
+	for _, test := range tests {
+		covered[test.Module] = true
+	}
+	var ret []string
+	for name := range modules {
+		if !covered[name] {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// run scans a fake server with the module of the test, and returns the
+// response, and an error if it is not the expected one.
+func (test *SelfTest) run() (*ScanResponse, error) {
+	module := GetModule(test.Module)
+	if module == nil {
+		return nil, fmt.Errorf("module %s is not registered", test.Module)
+	}
+	var port uint
+	var serverErr func() error
+	if test.UDP != nil {
+		server, err := testserver.NewUDP(test.UDP)
+		if err != nil {
+			return nil, err
+		}
+		defer server.Close()
+		port, serverErr = server.Port(), func() error { return nil }
+	} else {
+		server, err := testserver.New(test.Server)
+		if err != nil {
+			return nil, err
+		}
+		defer server.Close()
+		port, serverErr = server.Port(), server.Err
+	}
+
+	engine, err := NewEngine(nil)
+	if err != nil {
+		return nil, err
+	}
+	engine.AddModule(test.Module, module)
+	flags, err := engine.NewFlags(test.Module)
+	if err != nil {
+		return nil, err
+	}
+	base := GetBaseFlags(flags)
+	if base == nil {
+		return nil, ErrMismatchedFlags
+	}
+	base.Port, base.Timeout = port, selfTestTimeout
+	if test.Configure != nil {
+		test.Configure(flags)
+	}
+	if _, err := engine.NewScanner(test.Module, flags); err != nil {
+		return nil, err
+	}
+	if err := engine.InitPerSender(0); err != nil {
+		return nil, err
+	}
+	grab := engine.ScanTarget(ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	res, ok := grab.Data[base.Name]
+	if !ok {
+		return nil, fmt.Errorf("no response from the scanner")
+	}
+
+	expected := test.Status
+	if expected == "" {
+		expected = SCAN_SUCCESS
+	}
+	if res.Status != expected {
+		msg := fmt.Sprintf("got status %s; expected %s", res.Status, expected)
+		if res.Error != nil {
+			msg += fmt.Sprintf(" (error: %s)", *res.Error)
+		}
+		if err := serverErr(); err != nil {
+			msg += fmt.Sprintf(" (server: %s)", err)
+		}
+		return &res, fmt.Errorf("%s", msg)
+	}
+	if test.Expect != "" {
+		data, err := json.Marshal(res.Result)
+		if err != nil {
+			return &res, err
+		}
+		if !strings.Contains(string(data), test.Expect) {
+			return &res, fmt.Errorf("result does not contain %q", test.Expect)
+		}
+	}
+	return &res, nil
+}
@@ -0,0 +1,59 @@
+package zgrab2
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSelfTestCommand(t *testing.T) {
+	for _, name := range []string{"selftest-covered", "selftest-uncovered"} {
+		modules.AddModule(name, new(engineTestModule))
+		defer modules.RemoveModule(name)
+	}
+	tests := []SelfTest{
+		{Module: "selftest-covered", Expect: "hello"},
+		{
+			Name:   "selftest-covered (failing)",
+			Module: "selftest-covered",
+			Configure: func(flags interface{}) {
+				flags.(*engineTestFlags).Fail = true
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	err := new(SelfTestCommand).Run(&out, tests, nil)
+	if err == nil || err.Error() != "1 of 2 self-tests failed" {
+		t.Errorf("got error %v", err)
+	}
+	for _, expected := range []string{
+		"ok    selftest-covered (",
+		"FAIL  selftest-covered (failing): got status protocol-error",
+		"skip  selftest-uncovered: no self-test\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("output does not contain %q:\n%s", expected, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "skip  selftest-covered") {
+		t.Errorf("a covered module is reported as skipped:\n%s", out.String())
+	}
+
+	// A module without a self-test fails the run of all tests, even if they
+	// pass.
+	out.Reset()
+	if err := new(SelfTestCommand).Run(&out, tests[:1], nil); err == nil || !strings.HasSuffix(err.Error(), "modules have no self-test") {
+		t.Errorf("got error %v", err)
+	}
+
+	// The modules without a self-test are only listed when all tests run,
+	// and asking for one is an error.
+	out.Reset()
+	if err := new(SelfTestCommand).Run(&out, tests[:1], []string{"selftest-covered"}); err != nil || strings.Contains(out.String(), "skip") {
+		t.Errorf("got error %v, output:\n%s", err, out.String())
+	}
+	if err := new(SelfTestCommand).Run(&out, tests, []string{"selftest-uncovered"}); err == nil || !strings.Contains(err.Error(), "no self-test for module selftest-uncovered") {
+		t.Errorf("got error %v", err)
+	}
+}
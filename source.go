@@ -0,0 +1,156 @@
+package zgrab2
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// maxSourceAddresses bounds the number of source addresses a --source-ip CIDR
+// block may expand to.
+const maxSourceAddresses = 1 << 16
+
+// sourceAddresses are the local addresses connections are made from, rotated
+// through per connection.
+type sourceAddresses struct {
+	v4, v6 []net.IP
+	next   uint32
+}
+
+// parseSourceAddresses parses the --source-ip value: an address, a CIDR block,
+// or a comma-separated list of either.
+func parseSourceAddresses(s string) (*sourceAddresses, error) {
+	ret := new(sourceAddresses)
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if ip := net.ParseIP(field); ip != nil {
+			ret.add(ip)
+			continue
+		}
+		_, ipnet, err := net.ParseCIDR(field)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse %q as an IP address or CIDR block", field)
+		}
+		for ip := ipnet.IP.Mask(ipnet.Mask); ipnet.Contains(ip); incrementIP(ip) {
+			if len(ret.v4)+len(ret.v6) >= maxSourceAddresses {
+				return nil, fmt.Errorf("%s has more than %d addresses", field, maxSourceAddresses)
+			}
+			ret.add(duplicateIP(ip))
+		}
+	}
+	if len(ret.v4)+len(ret.v6) == 0 {
+		return nil, fmt.Errorf("no source address in %q", s)
+	}
+	return ret, nil
+}
+
+// interfaceAddresses returns the unicast addresses of the named interface.
+func interfaceAddresses(name string) (*sourceAddresses, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	ret := new(sourceAddresses)
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.IsGlobalUnicast() {
+			ret.add(ipnet.IP)
+		}
+	}
+	if len(ret.v4)+len(ret.v6) == 0 {
+		return nil, fmt.Errorf("interface %s has no unicast address", name)
+	}
+	return ret, nil
+}
+
+func (s *sourceAddresses) add(ip net.IP) {
+	if ip4 := ip.To4(); ip4 != nil {
+		s.v4 = append(s.v4, ip4)
+	} else {
+		s.v6 = append(s.v6, ip)
+	}
+}
+
+// pick returns the next source address for a connection to address, of the
+// same family if address is an IP (the dialer skips the addresses of a name
+// that are of the other family), or nil.
+func (s *sourceAddresses) pick(address string) net.IP {
+	if s == nil {
+		return nil
+	}
+	candidates := s.v4
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		candidates = s.v6
+	} else if ip == nil && len(candidates) == 0 {
+		candidates = s.v6
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	return candidates[atomic.AddUint32(&s.next, 1)%uint32(len(candidates))]
+}
+
+// localTCPAddr returns the local address to dial a TCP connection to address
+// from, given the options of config, or nil to let the OS pick.
+func localTCPAddr(config *Config, address string) *net.TCPAddr {
+	if ip := config.sources.pick(address); ip != nil {
+		return &net.TCPAddr{IP: ip}
+	}
+	return nil
+}
+
+// localUDPAddr returns the local address to send UDP datagrams to address
+// from, given the options of config, or nil to let the OS pick.
+func localUDPAddr(config *Config, address string) *net.UDPAddr {
+	if ip := config.sources.pick(address); ip != nil {
+		return &net.UDPAddr{IP: ip}
+	}
+	return nil
+}
+
+// newNetDialer returns a net.Dialer for a connection to address, from the
+// source address and interface of config.
+func newNetDialer(config *Config, address string) *net.Dialer {
+	ret := &net.Dialer{DualStack: true}
+	if laddr := localTCPAddr(config, address); laddr != nil {
+		ret.LocalAddr = laddr
+	}
+	ret.Control = dialControl(config)
+	ret.Resolver = config.resolver.dialResolver()
+	return ret
+}
+
+// dialControl returns the net.Dialer Control function refusing connections to
+// the addresses of the blocklist of config, and binding them to its interface,
+// or nil if neither is set.
+func dialControl(config *Config) func(network, address string, c syscall.RawConn) error {
+	var bind func(network, address string, c syscall.RawConn) error
+	if config.Interface != "" {
+		bind = bindToDeviceControl(config.Interface)
+	}
+	blocklist := config.blocklist
+	if blocklist == nil {
+		return bind
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		if err := blocklist.checkAddress(address); err != nil {
+			return err
+		}
+		if bind != nil {
+			return bind(network, address, c)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,22 @@
+// +build linux
+
+package zgrab2
+
+import (
+	"syscall"
+)
+
+// bindToDeviceControl returns a net.Dialer Control function binding sockets to
+// the named interface (SO_BINDTODEVICE), so that they are routed through it
+// whatever their source address.
+func bindToDeviceControl(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if cerr := c.Control(func(fd uintptr) {
+			err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+		}); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+}
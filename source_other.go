@@ -0,0 +1,13 @@
+// +build !linux
+
+package zgrab2
+
+import (
+	"syscall"
+)
+
+// bindToDeviceControl returns nil: sockets cannot be bound to an interface on
+// this platform, so --interface only selects the source addresses.
+func bindToDeviceControl(iface string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
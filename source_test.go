@@ -0,0 +1,73 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseSourceAddresses(t *testing.T) {
+	sources, err := parseSourceAddresses("10.0.0.1, 192.168.1.4/30,2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources.v4) != 5 || len(sources.v6) != 1 {
+		t.Fatalf("parsed %v, %v", sources.v4, sources.v6)
+	}
+	seen := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		seen[sources.pick("93.184.216.34:80").String()]++
+	}
+	for _, ip := range []string{"10.0.0.1", "192.168.1.4", "192.168.1.5", "192.168.1.6", "192.168.1.7"} {
+		if seen[ip] != 2 {
+			t.Errorf("picked %s %d times out of 10; expected 2", ip, seen[ip])
+		}
+	}
+	if ip := sources.pick("[2001:db8::2]:443"); ip.String() != "2001:db8::1" {
+		t.Errorf("picked %s for an IPv6 target", ip)
+	}
+	if ip := sources.pick("example.com:80"); ip.To4() == nil {
+		t.Errorf("picked %s for a name", ip)
+	}
+
+	for _, s := range []string{"", "10.0.0.300", "10.0.0.0/8"} {
+		if _, err := parseSourceAddresses(s); err == nil {
+			t.Errorf("parseSourceAddresses(%q) succeeded", s)
+		}
+	}
+}
+
+func TestPickIPv6Only(t *testing.T) {
+	sources, err := parseSourceAddresses("2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip := sources.pick("example.com:80"); ip == nil || ip.String() != "2001:db8::1" {
+		t.Errorf("picked %s for a name with only IPv6 sources", ip)
+	}
+	if ip := sources.pick("10.0.0.1:80"); ip != nil {
+		t.Errorf("picked %s for an IPv4 target with only IPv6 sources", ip)
+	}
+}
+
+func TestOpenUDPSource(t *testing.T) {
+	sources, err := parseSourceAddresses("127.0.0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := withConfig(context.Background(), &Config{sources: sources})
+	target := &ScanTarget{IP: net.ParseIP("127.0.0.1")}
+	flags := &BaseFlags{Port: 53, Timeout: time.Second}
+	for _, udp := range []*UDPFlags{nil, {LocalAddress: "*"}} {
+		conn, err := target.OpenUDP(ctx, flags, udp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip := conn.LocalAddr().(*net.UDPAddr).IP
+		conn.Close()
+		if expected := udp == nil || udp.LocalAddress != "*"; ip.Equal(net.ParseIP("127.0.0.2")) != expected {
+			t.Errorf("%+v: sent from %s", udp, ip)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// scannerPlaceholder is replaced by the scanner name in an --output-file
+// pattern, to write the responses of each scanner to its own file.
+const scannerPlaceholder = "{scanner}"
+
+// isSplitOutput returns true if the output file name is a pattern with a
+// file per scanner.
+func isSplitOutput(name string) bool {
+	return strings.Contains(name, scannerPlaceholder)
+}
+
+// scannerRecord is an encoded record holding the response of a single
+// scanner.
+type scannerRecord struct {
+	scanner string
+	record  []byte
+}
+
+// splitRecord splits an encoded record into one record per scanner response,
+// each with all the other fields of the record, sorted by scanner name.
+func splitRecord(result []byte) ([]scannerRecord, error) {
+	var record map[string]json.RawMessage
+	if err := json.Unmarshal(result, &record); err != nil {
+		return nil, err
+	}
+	var data map[string]json.RawMessage
+	if raw, ok := record["data"]; ok {
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ret := make([]scannerRecord, 0, len(names))
+	for _, name := range names {
+		single, err := json.Marshal(map[string]json.RawMessage{name: data[name]})
+		if err != nil {
+			return nil, err
+		}
+		record["data"] = single
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, scannerRecord{scanner: name, record: encoded})
+	}
+	return ret, nil
+}
+
+// OutputResultsSplitFunc returns an OutputResultsFunc that splits each result
+// into one record per scanner response, and passes them to the output
+// function of that scanner. The output function of a scanner is returned by
+// open when its first response is output.
+func OutputResultsSplitFunc(open func(scanner string) (OutputResultsFunc, error)) OutputResultsFunc {
+	return func(results <-chan []byte) error {
+		type output struct {
+			queue chan []byte
+			done  chan error
+		}
+		outputs := make(map[string]*output)
+		var err error
+	loop:
+		for result := range results {
+			records, splitErr := splitRecord(result)
+			if splitErr != nil {
+				log.Errorf("could not split result: %s", splitErr)
+				continue
+			}
+			for _, r := range records {
+				out := outputs[r.scanner]
+				if out == nil {
+					f, openErr := open(r.scanner)
+					if openErr != nil {
+						err = openErr
+						break loop
+					}
+					out = &output{queue: make(chan []byte, cap(results)), done: make(chan error, 1)}
+					go func() {
+						err := f(out.queue)
+						// If the output stopped early, discard the
+						// remaining records so the others are not
+						// blocked.
+						for range out.queue {
+						}
+						out.done <- err
+					}()
+					outputs[r.scanner] = out
+				}
+				out.queue <- r.record
+			}
+		}
+		for _, out := range outputs {
+			close(out.queue)
+		}
+		for _, out := range outputs {
+			if outputErr := <-out.done; err == nil {
+				err = outputErr
+			}
+		}
+		return err
+	}
+}
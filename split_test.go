@@ -0,0 +1,52 @@
+package zgrab2
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestOutputResultsSplit(t *testing.T) {
+	var mu sync.Mutex
+	written := make(map[string][]string)
+	output := OutputResultsSplitFunc(func(scanner string) (OutputResultsFunc, error) {
+		if scanner == "broken" {
+			return nil, errors.New("cannot open")
+		}
+		return func(results <-chan []byte) error {
+			for result := range results {
+				mu.Lock()
+				written[scanner] = append(written[scanner], string(result))
+				mu.Unlock()
+			}
+			return nil
+		}, nil
+	})
+
+	results := make(chan []byte, 3)
+	results <- []byte(`{"ip":"10.0.0.1","data":{"ssh":{"status":"success"},"http":{"status":"io-timeout"}}}`)
+	results <- []byte(`not json`)
+	results <- []byte(`{"ip":"10.0.0.2","data":{"http":{"status":"success"}}}`)
+	close(results)
+	if err := output(results); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"http": {
+			`{"data":{"http":{"status":"io-timeout"}},"ip":"10.0.0.1"}`,
+			`{"data":{"http":{"status":"success"}},"ip":"10.0.0.2"}`,
+		},
+		"ssh": {`{"data":{"ssh":{"status":"success"}},"ip":"10.0.0.1"}`},
+	}
+	if !reflect.DeepEqual(written, expected) {
+		t.Errorf("wrote %v, expected %v", written, expected)
+	}
+
+	results = make(chan []byte, 1)
+	results <- []byte(`{"ip":"10.0.0.1","data":{"broken":{"status":"success"}}}`)
+	close(results)
+	if err := output(results); err == nil {
+		t.Error("expected an error from a scanner output that cannot be opened")
+	}
+}
@@ -24,6 +24,7 @@ const (
 	SCAN_PROTOCOL_ERROR                = ScanStatus("protocol-error")      // Received data incompatible with the target protocol
 	SCAN_APPLICATION_ERROR             = ScanStatus("application-error")   // The application reported an error
 	SCAN_UNKNOWN_ERROR                 = ScanStatus("unknown-error")       // Catch-all for unrecognized errors
+	SCAN_BLOCKED                       = ScanStatus("blocked")             // The target address is in the --blocklist-file
 )
 
 // ScanError an error that also includes a ScanStatus.
@@ -71,6 +72,10 @@ func TryGetScanStatus(err error) ScanStatus {
 	case *net.OpError:
 		switch e.Op {
 		case "dial":
+			if scanErr, ok := e.Err.(*ScanError); ok {
+				// e.g. ErrBlocked, returned before connecting
+				return scanErr.Status
+			}
 			// TODO: Distinguish connection timeout / connection refused
 			// Windows examples:
 			//	"dial tcp 192.168.30.3:22: connectex: A connection attempt failed because the connected party did not properly respond after a period of time, or established connection failed because connected host has failed to respond."
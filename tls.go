@@ -1,6 +1,7 @@
 package zgrab2
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/csv"
 	"fmt"
@@ -42,6 +43,8 @@ type TLSFlags struct {
 	Time string `long:"time" description:"Explicit request time to use, instead of clock. YYYYMMDDhhmmss format."`
 	// TODO: directory? glob? How to map server name -> certificate?
 	Certificates string `long:"certificates" description:"Set of certificates to present to the server"`
+	ClientCert   string `long:"tls-client-cert" description:"A PEM file with the client certificate (and its chain) to present to servers requesting one; requires --tls-client-key"`
+	ClientKey    string `long:"tls-client-key" description:"A PEM file with the private key of --tls-client-cert"`
 	// TODO: re-evaluate this, or at least specify the file format
 	CertificateMap string `long:"certificate-map" description:"A file mapping server names to certificates"`
 	// TODO: directory? glob?
@@ -64,6 +67,14 @@ type TLSFlags struct {
 	ClientRandom string `long:"client-random" description:"Set an explicit Client Random (base64 encoded)"`
 	// TODO: format?
 	ClientHello string `long:"client-hello" description:"Set an explicit ClientHello (base64 encoded)"`
+
+	Resumption  bool     `long:"tls-resumption" description:"After the handshake, try to resume the session on new connections, by session ID, session ticket and TLS 1.3 PSK"`
+	Enumerate   bool     `long:"tls-enumerate" description:"After the handshake, find the supported versions (SSLv3 to TLS 1.3) and the cipher suites accepted with each, with one handshake per suite on new connections"`
+	ECH         bool     `long:"tls-ech" description:"After the handshake, send an Encrypted Client Hello on new connections, with a GREASE config and with the config of the HTTPS DNS record of the server name, and record whether the server accepted, rejected or ignored it"`
+	ECHResolver string   `long:"tls-ech-resolver" description:"The DNS resolver (host:port) to look up the HTTPS records of --tls-ech with, instead of those of --resolvers or of the system"`
+	RootStores  []string `long:"tls-root-store" description:"After the handshake, validate the server's chain against the roots of a PEM bundle, given as NAME=FILE (e.g. mozilla=cacert.pem); may be repeated"`
+	VulnChecks  bool     `long:"tls-vuln-checks" description:"After the handshake, probe the server on new connections for Heartbleed, ROBOT and CCS injection (CVE-2014-0224)"`
+	OCSP        bool     `long:"tls-ocsp" description:"After the handshake, query the OCSP responder of the server certificate for its revocation status"`
 }
 
 func getCSV(arg string) []string {
@@ -122,6 +133,16 @@ func (t *TLSFlags) GetTLSConfigForTarget(target *ScanTarget) (*tls.Config, error
 		// TODO FIXME: Implement
 		log.Fatalf("--certificates not implemented")
 	}
+	if t.ClientCert != "" || t.ClientKey != "" {
+		if t.ClientCert == "" || t.ClientKey == "" {
+			return nil, fmt.Errorf("--tls-client-cert and --tls-client-key must be given together")
+		}
+		cert, err := loadClientCertificate(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading the client certificate '%s': %s", t.ClientCert, err)
+		}
+		ret.Certificates = []tls.Certificate{cert}
+	}
 	if t.CertificateMap != "" {
 		// TODO FIXME: Implement
 		log.Fatalf("--certificate-map not implemented")
@@ -156,6 +177,10 @@ func (t *TLSFlags) GetTLSConfigForTarget(target *ScanTarget) (*tls.Config, error
 			ret.ServerName = target.Domain
 		}
 	}
+	if target != nil && target.GetOptions().SNI != "" {
+		// A server name given for the target in the input takes precedence.
+		ret.ServerName = target.GetOptions().SNI
+	}
 	if t.VerifyServerCertificate {
 		ret.InsecureSkipVerify = false
 	} else {
@@ -222,7 +247,7 @@ func (t *TLSFlags) GetTLSConfigForTarget(target *ScanTarget) (*tls.Config, error
 		ret.ExtendedRandom = false
 	}
 
-	if t.SessionTicket {
+	if t.SessionTicket || t.Resumption {
 		ret.ForceSessionTicketExt = true
 	} else {
 		ret.ForceSessionTicketExt = false
@@ -261,6 +286,29 @@ type TLSConnection struct {
 	tls.Conn
 	flags *TLSFlags
 	log   *TLSLog
+	hello *helloRecorder
+
+	// serverName is the server name of the configuration.
+	serverName string
+
+	// dial opens a new connection to the target, for the checks needing
+	// new connections (--tls-enumerate, --tls-resumption, --tls-ech and
+	// --tls-vuln-checks); they are skipped if it is nil.
+	dial func() (net.Conn, error)
+
+	// resolver is the resolver of the scan, whose DNS servers the HTTPS
+	// records of --tls-ech are looked up from, unless --tls-ech-resolver is
+	// set.
+	resolver *resolver
+}
+
+// TLSVersionSupport is the support of a protocol version found with
+// --tls-enumerate.
+type TLSVersionSupport struct {
+	Version   tls.TLSVersion `json:"version"`
+	Supported bool           `json:"supported"`
+	// The cipher suites accepted with the version, in the order of the server's preference
+	CipherSuites []tls.CipherSuite `json:"cipher_suites,omitempty"`
 }
 
 type TLSLog struct {
@@ -268,6 +316,26 @@ type TLSLog struct {
 	HandshakeLog *tls.ServerHandshake `json:"handshake_log"`
 	// This will be nil if heartbleed is not checked because of client configuration flags
 	HeartbleedLog *tls.Heartbleed `json:"heartbleed_log,omitempty"`
+	// The JA3S fingerprint of the ServerHello; nil if no ServerHello was read
+	ServerHelloFingerprint *ServerHelloFingerprint `json:"server_hello_fingerprint,omitempty"`
+	// The OCSP response stapled by the server, if any
+	StapledOCSP *OCSPResponse `json:"stapled_ocsp,omitempty"`
+	// The CertificateRequest of the server, if it asked for a client certificate
+	CertificateRequest *CertificateRequest `json:"certificate_request,omitempty"`
+	// The versions and cipher suites supported by the server, if --tls-enumerate is set
+	Enumeration []TLSVersionSupport `json:"enumeration,omitempty"`
+	// The error that interrupted the enumeration, if any
+	EnumerationError string `json:"enumeration_error,omitempty"`
+	// The outcome of the resumption attempts, if --tls-resumption is set
+	Resumption *TLSResumption `json:"resumption,omitempty"`
+	// The outcome of the Encrypted Client Hello probes, if --tls-ech is set
+	ECH *TLSECH `json:"ech,omitempty"`
+	// The validation of the server's chain against each --tls-root-store
+	ChainValidation []ChainValidation `json:"chain_validation,omitempty"`
+	// The outcome of the OCSP query for the server certificate, if --tls-ocsp is set
+	OCSP *OCSPCheck `json:"ocsp,omitempty"`
+	// The verdicts of the vulnerability checks, if --tls-vuln-checks is set
+	VulnChecks *TLSVulnChecks `json:"vuln_checks,omitempty"`
 }
 
 func (z *TLSConnection) GetLog() *TLSLog {
@@ -278,13 +346,106 @@ func (z *TLSConnection) GetLog() *TLSLog {
 	return z.log
 }
 
+// enumerate fills the enumeration of the versions and cipher suites of the
+// server in log.
+func (z *TLSConnection) enumerate(log *TLSLog) {
+	support, err := enumerateTLS(z.dial, z.serverName)
+	for _, s := range support {
+		v := TLSVersionSupport{Version: tls.TLSVersion(s.version), Supported: s.supported}
+		for _, c := range s.cipherSuites {
+			v.CipherSuites = append(v.CipherSuites, tls.CipherSuite(c))
+		}
+		log.Enumeration = append(log.Enumeration, v)
+	}
+	if err != nil {
+		log.EnumerationError = err.Error()
+	}
+}
+
+// resume fills the outcome of the resumption attempts of the session of the
+// handshake in log.
+func (z *TLSConnection) resume(log *TLSLog) {
+	var session *tlsSession
+	if hl := log.HandshakeLog; hl != nil && hl.ServerHello != nil {
+		session = &tlsSession{
+			version:     uint16(hl.ServerHello.Version),
+			cipherSuite: uint16(hl.ServerHello.CipherSuite),
+			sessionID:   hl.ServerHello.SessionID,
+		}
+		if hl.SessionTicket != nil {
+			session.ticket = hl.SessionTicket.Value
+			session.lifetimeHint = hl.SessionTicket.LifetimeHint
+		}
+	}
+	log.Resumption = testResumption(z.dial, z.serverName, session)
+}
+
+// ech fills the outcome of the Encrypted Client Hello probes in log.
+func (z *TLSConnection) ech(log *TLSLog) {
+	server := z.flags.ECHResolver
+	if server == "" {
+		server = z.resolver.dnsServer()
+	}
+	log.ECH = testECH(z.dial, z.serverName, server)
+}
+
+// serverChain returns the DER certificates sent by the server, the leaf
+// first.
+func serverChain(log *TLSLog) [][]byte {
+	var chain [][]byte
+	if hl := log.HandshakeLog; hl != nil && hl.ServerCertificates != nil {
+		chain = append(chain, hl.ServerCertificates.Certificate.Raw)
+		for _, cert := range hl.ServerCertificates.Chain {
+			chain = append(chain, cert.Raw)
+		}
+	}
+	return chain
+}
+
+// ocsp fills the outcome of the OCSP query for the server certificate in log.
+func (z *TLSConnection) ocsp(log *TLSLog) {
+	log.OCSP = checkOCSP(serverChain(log))
+}
+
+// validate fills the validation of the server's chain against each root
+// store in log.
+func (z *TLSConnection) validate(log *TLSLog) {
+	log.ChainValidation = validateChains(serverChain(log), z.flags.RootStores, z.serverName)
+}
+
+// vulnChecks fills the verdicts of the vulnerability checks in log.
+func (z *TLSConnection) vulnChecks(log *TLSLog) {
+	log.VulnChecks = checkVulnerabilities(z.dial, z.serverName)
+}
+
 func (z *TLSConnection) Handshake() error {
 	log := z.GetLog()
+	if z.flags.Enumerate && z.dial != nil {
+		defer z.enumerate(log)
+	}
+	if z.flags.Resumption && z.dial != nil {
+		defer z.resume(log)
+	}
+	if z.flags.ECH && z.dial != nil {
+		defer z.ech(log)
+	}
+	if z.flags.OCSP {
+		defer z.ocsp(log)
+	}
+	if len(z.flags.RootStores) > 0 {
+		defer z.validate(log)
+	}
+	if z.flags.VulnChecks && z.dial != nil {
+		defer z.vulnChecks(log)
+	}
 	if z.flags.Heartbleed {
 		buf := make([]byte, 256)
 		defer func() {
 			log.HandshakeLog = z.Conn.GetHandshakeLog()
 			log.HeartbleedLog = z.Conn.GetHeartbleedLog()
+			log.ServerHelloFingerprint = z.hello.fingerprint()
+			log.StapledOCSP = z.hello.stapledOCSP()
+			log.CertificateRequest = z.hello.certificateRequest()
 		}()
 		// TODO - CheckHeartbleed does not bubble errors from Handshake
 		_, err := z.CheckHeartbleed(buf)
@@ -296,6 +457,9 @@ func (z *TLSConnection) Handshake() error {
 		defer func() {
 			log.HandshakeLog = z.Conn.GetHandshakeLog()
 			log.HeartbleedLog = nil
+			log.ServerHelloFingerprint = z.hello.fingerprint()
+			log.StapledOCSP = z.hello.stapledOCSP()
+			log.CertificateRequest = z.hello.certificateRequest()
 		}()
 		return z.Conn.Handshake()
 	}
@@ -309,31 +473,82 @@ func (conn *TLSConnection) Close() error {
 // Connect opens the TCP connection to the target using the given configuration,
 // and then returns the configured wrapped TLS connection. The caller must still
 // call Handshake().
-func (t *TLSFlags) Connect(target *ScanTarget, flags *BaseFlags) (*TLSConnection, error) {
-	tcpConn, err := target.Open(flags)
+func (t *TLSFlags) Connect(ctx context.Context, target *ScanTarget, flags *BaseFlags) (*TLSConnection, error) {
+	tcpConn, err := target.Open(ctx, flags)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := t.GetTLSConnectionForTarget(tcpConn, target, func() (net.Conn, error) {
+		return target.Open(ctx, flags)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return t.GetTLSConnectionForTarget(tcpConn, target)
+	conn.resolver = configFrom(ctx).resolver
+	return conn, nil
 }
 
+// GetTLSConnection returns the TLS connection wrapping conn, which cannot be
+// reopened, e.g. after STARTTLS: the checks needing new connections are
+// skipped.
 func (t *TLSFlags) GetTLSConnection(conn net.Conn) (*TLSConnection, error) {
-	return t.GetTLSConnectionForTarget(conn, nil)
+	return t.GetTLSConnectionForTarget(conn, nil, nil)
 }
 
-func (t *TLSFlags) GetTLSConnectionForTarget(conn net.Conn, target *ScanTarget) (*TLSConnection, error) {
+// GetTLSConnectionForTarget returns the TLS connection wrapping conn, with
+// the server name of target, if not nil. dial, if not nil, opens a new
+// connection to the same server, on which TLS is negotiated directly, for the
+// checks needing new connections.
+func (t *TLSFlags) GetTLSConnectionForTarget(conn net.Conn, target *ScanTarget, dial func() (net.Conn, error)) (*TLSConnection, error) {
 	cfg, err := t.GetTLSConfigForTarget(target)
 	if err != nil {
 		return nil, fmt.Errorf("Error getting TLSConfig for options: %s", err)
 	}
-	return t.GetWrappedConnection(conn, cfg), nil
+	return t.GetWrappedConnection(conn, cfg, dial), nil
 }
 
-func (t *TLSFlags) GetWrappedConnection(conn net.Conn, cfg *tls.Config) *TLSConnection {
-	tlsClient := tls.Client(conn, cfg)
+// GetWrappedConnection returns the TLS connection wrapping conn with cfg.
+// dial is as for GetTLSConnectionForTarget.
+func (t *TLSFlags) GetWrappedConnection(conn net.Conn, cfg *tls.Config, dial func() (net.Conn, error)) *TLSConnection {
+	hello := &helloRecorder{Conn: conn}
+	tlsClient := tls.Client(hello, cfg)
 	wrappedClient := TLSConnection{
-		Conn:  *tlsClient,
-		flags: t,
+		Conn:       *tlsClient,
+		flags:      t,
+		hello:      hello,
+		serverName: cfg.ServerName,
+		dial:       dial,
+		resolver:   configFrom(nil).resolver,
 	}
 	return &wrappedClient
 }
+
+// CheckRedial returns an error if a check needing new connections to the
+// server (--tls-enumerate, --tls-resumption, --tls-ech or --tls-vuln-checks)
+// is requested. The modules negotiating TLS on connections they cannot
+// reopen call it from Validate, with the option or module preventing it.
+func (t *TLSFlags) CheckRedial(with string) error {
+	for _, check := range []struct {
+		set  bool
+		flag string
+	}{
+		{t.Enumerate, "--tls-enumerate"},
+		{t.Resumption, "--tls-resumption"},
+		{t.ECH, "--tls-ech"},
+		{t.VulnChecks, "--tls-vuln-checks"},
+	} {
+		if check.set {
+			return fmt.Errorf("%s is not supported with %s, whose TLS connections cannot be reopened", check.flag, with)
+		}
+	}
+	return nil
+}
+
+// maxResponseSize returns the maximum response size of the underlying
+// connection.
+func (z *TLSConnection) maxResponseSize() int {
+	if z.hello == nil {
+		return config.MaxResponseSize
+	}
+	return connMaxResponseSize(z.hello.Conn)
+}
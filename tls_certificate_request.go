@@ -0,0 +1,113 @@
+package zgrab2
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"sync"
+
+	"github.com/zmap/zcrypto/tls"
+)
+
+// CertificateRequest is the CertificateRequest of a server asking for a
+// client certificate, up to TLS 1.2.
+type CertificateRequest struct {
+	// CertificateTypes are the types of the client certificates accepted,
+	// such as 1 (rsa_sign) and 64 (ecdsa_sign).
+	CertificateTypes []uint8 `json:"certificate_types"`
+
+	// SignatureAlgorithms are the signature algorithms accepted, in TLS 1.2.
+	SignatureAlgorithms []uint16 `json:"signature_algorithms,omitempty"`
+
+	// CertificateAuthorities are the distinguished names of the CAs whose
+	// certificates are accepted; none if any CA is.
+	CertificateAuthorities []string `json:"certificate_authorities,omitempty"`
+}
+
+// ParseCertificateRequest parses a CertificateRequest handshake message of
+// the given version. It returns nil if msg is invalid.
+func ParseCertificateRequest(msg []byte, version uint16) *CertificateRequest {
+	if len(msg) < 5 || msg[0] != 13 {
+		return nil
+	}
+	body := msg[4:]
+	n := int(body[0])
+	if len(body) < 1+n {
+		return nil
+	}
+	req := &CertificateRequest{CertificateTypes: append([]uint8{}, body[1:1+n]...)}
+	body = body[1+n:]
+	if version >= 0x0303 {
+		if len(body) < 2 || len(body) < 2+int(binary.BigEndian.Uint16(body)) {
+			return nil
+		}
+		algs := body[2 : 2+int(binary.BigEndian.Uint16(body))]
+		for i := 0; i+1 < len(algs); i += 2 {
+			req.SignatureAlgorithms = append(req.SignatureAlgorithms, binary.BigEndian.Uint16(algs[i:]))
+		}
+		body = body[2+len(algs):]
+	}
+	if len(body) < 2 || len(body) < 2+int(binary.BigEndian.Uint16(body)) {
+		return nil
+	}
+	names := body[2 : 2+int(binary.BigEndian.Uint16(body))]
+	for len(names) >= 2 {
+		n := int(binary.BigEndian.Uint16(names))
+		if len(names) < 2+n {
+			return nil
+		}
+		var rdns pkix.RDNSequence
+		if rest, err := asn1.Unmarshal(names[2:2+n], &rdns); err == nil && len(rest) == 0 {
+			var name pkix.Name
+			name.FillFromRDNSequence(&rdns)
+			req.CertificateAuthorities = append(req.CertificateAuthorities, name.String())
+		}
+		names = names[2+n:]
+	}
+	return req
+}
+
+// certificateRequest returns the CertificateRequest read, or nil if the server
+// sent none.
+func (r *helloRecorder) certificateRequest() *CertificateRequest {
+	r.mu.Lock()
+	msg := r.certificateRequestMsg
+	r.mu.Unlock()
+	if msg == nil {
+		return nil
+	}
+	version, _, _, ok := splitServerHello(r.serverHello())
+	if !ok {
+		return nil
+	}
+	return ParseCertificateRequest(msg, version)
+}
+
+// clientCertificate is the key pair of --tls-client-cert and
+// --tls-client-key, loaded once.
+type clientCertificate struct {
+	once sync.Once
+	cert tls.Certificate
+	err  error
+}
+
+var clientCertificates = struct {
+	sync.Mutex
+	certs map[[2]string]*clientCertificate
+}{certs: make(map[[2]string]*clientCertificate)}
+
+// loadClientCertificate returns the key pair of the PEM files certPath and
+// keyPath, which are only read and parsed for the first connection.
+func loadClientCertificate(certPath, keyPath string) (tls.Certificate, error) {
+	clientCertificates.Lock()
+	cert, ok := clientCertificates.certs[[2]string{certPath, keyPath}]
+	if !ok {
+		cert = new(clientCertificate)
+		clientCertificates.certs[[2]string{certPath, keyPath}] = cert
+	}
+	clientCertificates.Unlock()
+	cert.once.Do(func() {
+		cert.cert, cert.err = tls.LoadX509KeyPair(certPath, keyPath)
+	})
+	return cert.cert, cert.err
+}
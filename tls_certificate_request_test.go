@@ -0,0 +1,130 @@
+package zgrab2
+
+import (
+	"bytes"
+	gotls "crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCertificateRequest(t *testing.T) {
+	dn, err := asn1.Marshal(pkix.Name{CommonName: "Test CA", Organization: []string{"Example"}}.ToRDNSequence())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte{2, 1, 64, 0, 4, 4, 3, 8, 4}
+	body = append(body, byte((len(dn)+2)>>8), byte(len(dn)+2), byte(len(dn)>>8), byte(len(dn)))
+	body = append(body, dn...)
+	msg := append([]byte{13, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	want := &CertificateRequest{
+		CertificateTypes:       []uint8{1, 64},
+		SignatureAlgorithms:    []uint16{0x0403, 0x0804},
+		CertificateAuthorities: []string{"CN=Test CA,O=Example"},
+	}
+	if got := ParseCertificateRequest(msg, 0x0303); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := ParseCertificateRequest(msg[:len(msg)-1], 0x0303); got != nil {
+		t.Errorf("got %+v for a truncated message", got)
+	}
+}
+
+func TestRecordCertificateRequest(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	// Restart the listener, asking for client certificates issued by the
+	// server's own certificate.
+	cert, err := x509.ParseCertificate(server.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cas := x509.NewCertPool()
+	cas.AddCert(cert)
+	config := &gotls.Config{
+		Certificates: server.TLS.Certificates,
+		MaxVersion:   gotls.VersionTLS12,
+		ClientAuth:   gotls.RequestClientCert,
+		ClientCAs:    cas,
+	}
+	listener, err := gotls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.(*gotls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := &helloRecorder{Conn: conn}
+	client := gotls.Client(hello, &gotls.Config{InsecureSkipVerify: true})
+	defer client.Close()
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	req := hello.certificateRequest()
+	if req == nil || len(req.CertificateAuthorities) != 1 || req.CertificateAuthorities[0] != cert.Subject.String() {
+		t.Errorf("got %+v, want the CA %s", req, cert.Subject)
+	}
+}
+
+func TestLoadClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zgrab2-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cert, key := newCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, nil, nil)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644)
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+
+	flags := &TLSFlags{ClientCert: certPath, ClientKey: keyPath}
+	if _, err := flags.GetTLSConfig(); err != nil {
+		t.Fatal(err)
+	}
+	// The files are not read again for the next connections.
+	os.Remove(certPath)
+	config, err := flags.GetTLSConfig()
+	if err != nil {
+		t.Fatalf("got %v once the certificate was loaded", err)
+	}
+	if len(config.Certificates) != 1 || !bytes.Equal(config.Certificates[0].Certificate[0], cert.Raw) {
+		t.Errorf("got certificates %v", config.Certificates)
+	}
+
+	if _, err := loadClientCertificate(filepath.Join(dir, "missing.pem"), keyPath); err == nil {
+		t.Error("expected an error for a missing certificate")
+	}
+}
@@ -0,0 +1,276 @@
+package zgrab2
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// echLookupTimeout is the timeout of the HTTPS record lookup of --tls-ech.
+const echLookupTimeout = 5 * time.Second
+
+// The DNS record type and SvcParamKey of the ECH configs (RFC 9460).
+const (
+	dnsTypeHTTPS = 65
+	svcParamECH  = 5
+)
+
+// The outcomes of an ECH handshake.
+const (
+	ECHAccepted = "accepted"
+	ECHRejected = "rejected"
+	ECHIgnored  = "ignored"
+)
+
+var (
+	// errNoServerName is the error of --tls-ech for the targets without a
+	// domain name.
+	errNoServerName = errors.New("no server name to probe ECH with")
+
+	// errInvalidDNSResponse is returned if the HTTPS record lookup gave an
+	// invalid response.
+	errInvalidDNSResponse = errors.New("invalid DNS response")
+)
+
+// ECHResult is the outcome of a handshake sending an Encrypted Client Hello.
+type ECHResult struct {
+	// Status is accepted if the server decrypted the ClientHello, rejected if
+	// it could not and sent retry configs, and ignored if it sent none (as the
+	// servers not supporting ECH do). It is absent if the handshake failed.
+	Status string `json:"status,omitempty"`
+
+	// RetryConfigs is the ECHConfigList sent by the server on rejection.
+	RetryConfigs []byte `json:"retry_configs,omitempty"`
+
+	// Error is the error of a failed handshake.
+	Error string `json:"error,omitempty"`
+}
+
+// TLSECH is the outcome of the ECH probes of --tls-ech, each made on a new
+// connection.
+type TLSECH struct {
+	// GREASE is the outcome of a handshake with a config made up for the
+	// probe, which no server can decrypt.
+	GREASE *ECHResult `json:"grease,omitempty"`
+
+	// ConfigList is the ECHConfigList of the HTTPS record of the server name,
+	// if any.
+	ConfigList []byte `json:"config_list,omitempty"`
+
+	// Config is the outcome of a handshake with ConfigList.
+	Config *ECHResult `json:"config,omitempty"`
+
+	// Error is the error that interrupted the probes, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// encodeECHConfigList returns an ECHConfigList (draft-ietf-tls-esni-25,
+// section 4) with one config for the X25519 public key, with HKDF-SHA256 and
+// AES-128-GCM.
+func encodeECHConfigList(configID uint8, publicKey []byte, publicName string) []byte {
+	var contents bytes.Buffer
+	contents.WriteByte(configID)
+	putUint16(&contents, 0x0020)
+	putUint16(&contents, uint16(len(publicKey)))
+	contents.Write(publicKey)
+	putUint16(&contents, 4)
+	putUint16(&contents, 0x0001)
+	putUint16(&contents, 0x0001)
+	contents.WriteByte(0)
+	contents.WriteByte(byte(len(publicName)))
+	contents.WriteString(publicName)
+	putUint16(&contents, 0)
+
+	var list bytes.Buffer
+	putUint16(&list, uint16(4+contents.Len()))
+	putUint16(&list, 0xfe0d)
+	putUint16(&list, uint16(contents.Len()))
+	contents.WriteTo(&list)
+	return list.Bytes()
+}
+
+// greaseECHConfigList returns an ECHConfigList with a random key, for which
+// the Encrypted Client Hello is indistinguishable from a GREASE one (section
+// 6.2). The public name is the server name, so that the outer ClientHello is
+// that of a plain handshake.
+func greaseECHConfigList(serverName string) []byte {
+	key := make([]byte, 33)
+	rand.Read(key)
+	return encodeECHConfigList(key[0], key[1:], serverName)
+}
+
+// skipDNSName returns the offset past the domain name at off in msg.
+func skipDNSName(msg []byte, off int) (int, bool) {
+	for off < len(msg) {
+		switch n := int(msg[off]); {
+		case n&0xc0 == 0xc0:
+			return off + 2, off+2 <= len(msg)
+		case n == 0:
+			return off + 1, true
+		default:
+			off += 1 + n
+		}
+	}
+	return 0, false
+}
+
+// parseHTTPSECH returns the first ECHConfigList of the HTTPS records of a DNS
+// response, or nil if there is none.
+func parseHTTPSECH(msg []byte) ([]byte, error) {
+	if len(msg) < 12 || msg[2]&0x80 == 0 {
+		return nil, errInvalidDNSResponse
+	}
+	switch rcode := dnsmessage.RCode(msg[3] & 0x0f); rcode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("DNS lookup failed with rcode %d", rcode)
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+	off, ok := 12, true
+	for i := 0; i < questions; i++ {
+		if off, ok = skipDNSName(msg, off); !ok || off+4 > len(msg) {
+			return nil, errInvalidDNSResponse
+		}
+		off += 4
+	}
+	for i := 0; i < answers; i++ {
+		if off, ok = skipDNSName(msg, off); !ok || off+10 > len(msg) {
+			return nil, errInvalidDNSResponse
+		}
+		typ := binary.BigEndian.Uint16(msg[off:])
+		length := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+length > len(msg) {
+			return nil, errInvalidDNSResponse
+		}
+		data := msg[off : off+length]
+		off += length
+		// Skip the other records, and the HTTPS records in alias mode
+		// (priority 0).
+		if typ != dnsTypeHTTPS || len(data) < 2 || binary.BigEndian.Uint16(data) == 0 {
+			continue
+		}
+		// The target name is not compressed.
+		params, ok := skipDNSName(data, 2)
+		if !ok {
+			return nil, errInvalidDNSResponse
+		}
+		for params+4 <= len(data) {
+			key := binary.BigEndian.Uint16(data[params:])
+			n := int(binary.BigEndian.Uint16(data[params+2:]))
+			if params+4+n > len(data) {
+				return nil, errInvalidDNSResponse
+			}
+			if key == svcParamECH {
+				return data[params+4 : params+4+n], nil
+			}
+			params += 4 + n
+		}
+	}
+	return nil, nil
+}
+
+// lookupECHConfigList returns the ECHConfigList of the HTTPS record of name
+// from resolver, over UDP, or over TCP if the response was truncated. It
+// returns nil if there is none.
+func lookupECHConfigList(resolver, name string) ([]byte, error) {
+	qname, err := dnsmessage.NewName(strings.TrimSuffix(name, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+	var id [2]byte
+	rand.Read(id[:])
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: binary.BigEndian.Uint16(id[:]), RecursionDesired: true})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: qname, Type: dnsTypeHTTPS, Class: dnsmessage.ClassINET})
+	b.StartAdditionals()
+	var opt dnsmessage.ResourceHeader
+	opt.SetEDNS0(4096, dnsmessage.RCodeSuccess, false)
+	b.OPTResource(opt, dnsmessage.OPTResource{})
+	query, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("udp", resolver, echLookupTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(echLookupTimeout))
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, 4096)
+	for {
+		n, err := conn.Read(msg)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore the responses to other queries.
+		if n >= 12 && bytes.Equal(msg[:2], id[:]) {
+			msg = msg[:n]
+			break
+		}
+	}
+	if msg[2]&0x02 != 0 {
+		if msg, err = lookupTCP(resolver, query); err != nil {
+			return nil, err
+		}
+	}
+	return parseHTTPSECH(msg)
+}
+
+// lookupTCP sends query to resolver over TCP and returns the response.
+func lookupTCP(resolver string, query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", resolver, echLookupTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(echLookupTimeout))
+	if _, err := conn.Write(append([]byte{byte(len(query) >> 8), byte(len(query))}, query...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// testECH probes the server with a GREASE ECH, then with the ECHConfigList of
+// the HTTPS record of serverName from resolver, if any.
+func testECH(dial func() (net.Conn, error), serverName, resolver string) *TLSECH {
+	e := new(TLSECH)
+	if serverName == "" {
+		e.Error = errNoServerName.Error()
+		return e
+	}
+	e.GREASE = probeECH(dial, serverName, greaseECHConfigList(serverName))
+	list, err := lookupECHConfigList(resolver, serverName)
+	if err != nil {
+		e.Error = err.Error()
+		return e
+	}
+	if list != nil {
+		e.ConfigList = list
+		e.Config = probeECH(dial, serverName, list)
+	}
+	return e
+}
@@ -0,0 +1,42 @@
+//go:build go1.23
+// +build go1.23
+
+package zgrab2
+
+import (
+	gotls "crypto/tls"
+	"errors"
+	"net"
+)
+
+// probeECH performs a TLS 1.3 handshake sending an Encrypted Client Hello for
+// configList. The certificate is not verified, whether or not the server
+// accepted it.
+func probeECH(dial func() (net.Conn, error), serverName string, configList []byte) *ECHResult {
+	conn, err := dial()
+	if err != nil {
+		return &ECHResult{Error: err.Error()}
+	}
+	client := gotls.Client(conn, &gotls.Config{
+		ServerName:                     serverName,
+		InsecureSkipVerify:             true,
+		EncryptedClientHelloConfigList: configList,
+		EncryptedClientHelloRejectionVerify: func(gotls.ConnectionState) error {
+			return nil
+		},
+	})
+	defer client.Close()
+	err = client.Handshake()
+	var rejection *gotls.ECHRejectionError
+	switch {
+	case err == nil && client.ConnectionState().ECHAccepted:
+		return &ECHResult{Status: ECHAccepted}
+	case errors.As(err, &rejection) && len(rejection.RetryConfigList) > 0:
+		return &ECHResult{Status: ECHRejected, RetryConfigs: rejection.RetryConfigList}
+	case errors.As(err, &rejection):
+		return &ECHResult{Status: ECHIgnored}
+	case err != nil:
+		return &ECHResult{Error: err.Error()}
+	}
+	return &ECHResult{Status: ECHIgnored}
+}
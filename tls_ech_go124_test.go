@@ -0,0 +1,62 @@
+//go:build go1.24
+// +build go1.24
+
+package zgrab2
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	gotls "crypto/tls"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTestECH(t *testing.T) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := encodeECHConfigList(7, key.PublicKey().Bytes(), "public.example.com")
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.TLS = &gotls.Config{
+		EncryptedClientHelloKeys: []gotls.EncryptedClientHelloKey{{
+			Config:      list[2:],
+			PrivateKey:  key.Bytes(),
+			SendAsRetry: true,
+		}},
+	}
+	server.StartTLS()
+	defer server.Close()
+	resolver := serveHTTPSRecord(t, list)
+	defer resolver.Close()
+	dial := func() (net.Conn, error) {
+		return net.Dial("tcp", server.Listener.Addr().String())
+	}
+
+	e := testECH(dial, "example.com", resolver.LocalAddr().String())
+	if e.Error != "" || e.GREASE == nil || e.GREASE.Status != ECHRejected || len(e.GREASE.RetryConfigs) == 0 {
+		t.Errorf("got %+v, GREASE %+v", e, e.GREASE)
+	}
+	if e.Config == nil || e.Config.Status != ECHAccepted {
+		t.Errorf("got %+v with the config", e.Config)
+	}
+
+	plain := httptest.NewUnstartedServer(http.NotFoundHandler())
+	plain.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	plain.StartTLS()
+	defer plain.Close()
+	r := probeECH(func() (net.Conn, error) {
+		return net.Dial("tcp", plain.Listener.Addr().String())
+	}, "example.com", list)
+	if r.Status != ECHIgnored {
+		t.Errorf("got %+v from a server without ECH", r)
+	}
+	if e := testECH(dial, "", ""); e.Error != errNoServerName.Error() {
+		t.Errorf("got %+v without a server name", e)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !go1.23
+// +build !go1.23
+
+package zgrab2
+
+import (
+	"errors"
+	"net"
+)
+
+// errECHUnsupported is the error of the ECH probes of the builds with a Go
+// version whose crypto/tls does not support ECH.
+var errECHUnsupported = errors.New("ECH probing requires Go 1.23 or later")
+
+// probeECH fails: crypto/tls supports ECH from Go 1.23.
+func probeECH(dial func() (net.Conn, error), serverName string, configList []byte) *ECHResult {
+	return &ECHResult{Error: errECHUnsupported.Error()}
+}
@@ -0,0 +1,83 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// httpsResponse returns the response to a query with an HTTPS record in
+// service mode with the ECH config list, after an alias mode record.
+func httpsResponse(query, ech []byte) []byte {
+	end, _ := skipDNSName(query, 12)
+	msg := append([]byte{query[0], query[1], 0x81, 0x80, 0, 1, 0, 2, 0, 0, 0, 0}, query[12:end+4]...)
+	alias := []byte{0, 0, 3, 'c', 'd', 'n', 0}
+	service := []byte{0, 1, 0, 0, 1, 0, 3, 2, 'h', '2', 0, 5, byte(len(ech) >> 8), byte(len(ech))}
+	service = append(service, ech...)
+	for _, data := range [][]byte{alias, service} {
+		msg = append(msg, 0xc0, 12, 0, dnsTypeHTTPS, 0, 1, 0, 0, 1, 0)
+		msg = append(msg, byte(len(data)>>8), byte(len(data)))
+		msg = append(msg, data...)
+	}
+	return msg
+}
+
+// serveHTTPSRecord runs a DNS server over UDP answering every query with an
+// HTTPS record with the ECH config list.
+func serveHTTPSRecord(t *testing.T, ech []byte) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(httpsResponse(buf[:n], ech), addr)
+		}
+	}()
+	return conn
+}
+
+func TestEncodeECHConfigList(t *testing.T) {
+	list := greaseECHConfigList("example.com")
+	if int(binary.BigEndian.Uint16(list)) != len(list)-2 || int(binary.BigEndian.Uint16(list[4:])) != len(list)-6 {
+		t.Errorf("got inconsistent lengths in %x", list)
+	}
+	if !bytes.HasSuffix(list, []byte("\x0bexample.com\x00\x00")) {
+		t.Errorf("got %x", list)
+	}
+}
+
+func TestLookupECHConfigList(t *testing.T) {
+	ech := encodeECHConfigList(1, bytes.Repeat([]byte{2}, 32), "example.com")
+	server := serveHTTPSRecord(t, ech)
+	defer server.Close()
+	list, err := lookupECHConfigList(server.LocalAddr().String(), "example.com")
+	if err != nil || !bytes.Equal(list, ech) {
+		t.Errorf("got %x, %v, want %x", list, err, ech)
+	}
+}
+
+func TestParseHTTPSECH(t *testing.T) {
+	query := append([]byte{0, 1, 1, 0, 0, 1, 0, 0, 0, 0, 0, 0, 7}, "example\x03com\x00\x00\x41\x00\x01"...)
+	msg := httpsResponse(query, nil)
+	if list, err := parseHTTPSECH(msg); list == nil || len(list) != 0 || err != nil {
+		t.Errorf("got %x, %v for an empty config list", list, err)
+	}
+	if _, err := parseHTTPSECH(msg[:len(msg)-1]); err != errInvalidDNSResponse {
+		t.Errorf("got %v for a truncated response", err)
+	}
+	msg[3] = 3
+	if list, err := parseHTTPSECH(msg); list != nil || err != nil {
+		t.Errorf("got %x, %v for NXDOMAIN", list, err)
+	}
+	msg[3] = 2
+	if _, err := parseHTTPSECH(msg); err == nil {
+		t.Errorf("got no error for SERVFAIL")
+	}
+}
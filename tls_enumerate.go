@@ -0,0 +1,238 @@
+package zgrab2
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+)
+
+// Extensions of the ClientHellos of --tls-enumerate.
+const (
+	extensionServerName        = 0
+	extensionSupportedGroups   = 10
+	extensionPointFormats      = 11
+	extensionSignatureAlgs     = 13
+	extensionPadding           = 21
+	extensionSessionTicket     = 35
+	extensionSupportedVersions = 43
+	extensionKeyShare          = 51
+)
+
+// tlsEnumerateVersions are the versions enumerated by --tls-enumerate, from
+// SSL 3.0 to TLS 1.3.
+var tlsEnumerateVersions = []uint16{0x0300, 0x0301, 0x0302, 0x0303, 0x0304}
+
+// tlsEnumerateRanges are the ranges of the cipher suites offered for the
+// versions up to TLS 1.2: the RSA, DH, ECDH and ECDHE suites with NULL,
+// export, RC4, DES, 3DES, AES, Camellia, SEED, ARIA, CCM and ChaCha20 ciphers.
+var tlsEnumerateRanges = [][2]uint16{
+	{0x0001, 0x001b},
+	{0x002f, 0x0046},
+	{0x0067, 0x006d},
+	{0x0084, 0x00c5},
+	{0xc001, 0xc032},
+	{0xc03c, 0xc079},
+	{0xc09c, 0xc0af},
+	{0xcc13, 0xcc15},
+	{0xcca8, 0xccaa},
+}
+
+// tls13CipherSuites are the cipher suites of TLS 1.3.
+var tls13CipherSuites = []uint16{0x1301, 0x1302, 0x1303, 0x1304, 0x1305}
+
+// tlsSupport is the support of a version found by enumerateTLS, with the
+// cipher suites accepted in the order of the server's preference.
+type tlsSupport struct {
+	version      uint16
+	supported    bool
+	cipherSuites []uint16
+}
+
+// enumerationCipherSuites returns the cipher suites offered for version.
+func enumerationCipherSuites(version uint16) []uint16 {
+	if version == 0x0304 {
+		return append([]uint16(nil), tls13CipherSuites...)
+	}
+	var suites []uint16
+	for _, r := range tlsEnumerateRanges {
+		for c := int(r[0]); c <= int(r[1]); c++ {
+			suites = append(suites, uint16(c))
+		}
+	}
+	return suites
+}
+
+func putUint16(b *bytes.Buffer, v uint16) {
+	b.WriteByte(byte(v >> 8))
+	b.WriteByte(byte(v))
+}
+
+// putExtension appends an extension to b.
+func putExtension(b *bytes.Buffer, typ uint16, data []byte) {
+	putUint16(b, typ)
+	putUint16(b, uint16(len(data)))
+	b.Write(data)
+}
+
+// encodeClientHello returns a ClientHello record offering only version
+// (through the supported_versions extension for TLS 1.3), and the cipher
+// suites, with the session ID, the session_ticket extension if ticket is not
+// nil, and the extra extensions. The SSL 3.0 ClientHello has no extensions.
+func encodeClientHello(version uint16, suites []uint16, serverName string, sessionID, ticket []byte, extra ...tlsExtension) []byte {
+	var ext bytes.Buffer
+	if version > 0x0300 {
+		if serverName != "" && net.ParseIP(serverName) == nil {
+			var names bytes.Buffer
+			putUint16(&names, uint16(len(serverName)+3))
+			names.WriteByte(0)
+			putUint16(&names, uint16(len(serverName)))
+			names.WriteString(serverName)
+			putExtension(&ext, extensionServerName, names.Bytes())
+		}
+		// x25519, secp256r1, secp384r1, secp521r1, ffdhe2048, ffdhe3072
+		putExtension(&ext, extensionSupportedGroups, []byte{0x00, 0x0c, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x18, 0x00, 0x19, 0x01, 0x00, 0x01, 0x01})
+		putExtension(&ext, extensionPointFormats, []byte{0x01, 0x00})
+		putExtension(&ext, extensionSignatureAlgs, []byte{0x00, 0x1a,
+			0x04, 0x03, 0x05, 0x03, 0x06, 0x03, 0x08, 0x07, 0x08, 0x04, 0x08, 0x05, 0x08, 0x06,
+			0x04, 0x01, 0x05, 0x01, 0x06, 0x01, 0x02, 0x03, 0x02, 0x01, 0x04, 0x02})
+		if ticket != nil {
+			putExtension(&ext, extensionSessionTicket, ticket)
+		}
+		for _, e := range extra {
+			putExtension(&ext, e.typ, e.data)
+		}
+	}
+	if version == 0x0304 {
+		putExtension(&ext, extensionSupportedVersions, []byte{0x02, 0x03, 0x04})
+		share := make([]byte, 2+2+2+32)
+		binary.BigEndian.PutUint16(share, 2+2+32)
+		binary.BigEndian.PutUint16(share[2:], 0x001d)
+		binary.BigEndian.PutUint16(share[4:], 32)
+		rand.Read(share[6:])
+		putExtension(&ext, extensionKeyShare, share)
+	}
+
+	var hello bytes.Buffer
+	legacyVersion := version
+	if version == 0x0304 {
+		legacyVersion = 0x0303
+	}
+	putUint16(&hello, legacyVersion)
+	random := make([]byte, 32)
+	rand.Read(random)
+	hello.Write(random)
+	hello.WriteByte(byte(len(sessionID)))
+	hello.Write(sessionID)
+	putUint16(&hello, uint16(2*len(suites)))
+	for _, c := range suites {
+		putUint16(&hello, c)
+	}
+	hello.Write([]byte{0x01, 0x00})
+	if ext.Len() > 0 {
+		// Some servers do not answer ClientHellos of 256 to 511 bytes, which
+		// the padding extension avoids (RFC 7685).
+		if length := hello.Len() + 2 + ext.Len() + 4; length >= 256 && length < 512 {
+			padding := 512 - length - 4
+			if padding < 0 {
+				padding = 0
+			}
+			putExtension(&ext, extensionPadding, make([]byte, padding))
+		}
+		putUint16(&hello, uint16(ext.Len()))
+		hello.Write(ext.Bytes())
+	}
+
+	var record bytes.Buffer
+	record.WriteByte(22)
+	recordVersion := legacyVersion
+	if version == 0x0304 {
+		recordVersion = 0x0301
+	}
+	putUint16(&record, recordVersion)
+	putUint16(&record, uint16(hello.Len()+4))
+	record.Write([]byte{1, byte(hello.Len() >> 16), byte(hello.Len() >> 8), byte(hello.Len())})
+	record.Write(hello.Bytes())
+	return record.Bytes()
+}
+
+// sendHello sends a ClientHello record on a new connection, and returns the
+// ServerHello message, or nil if the server answered with an alert or closed
+// the connection. err is set only if the connection cannot be opened.
+func sendHello(dial func() (net.Conn, error), record []byte) ([]byte, error) {
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write(record); err != nil {
+		return nil, nil
+	}
+	r := &helloRecorder{Conn: conn}
+	buf := make([]byte, 4096)
+	for r.serverHello() == nil && !r.isDone() {
+		if _, err := r.Read(buf); err != nil {
+			break
+		}
+	}
+	return r.serverHello(), nil
+}
+
+// tryHello sends a ClientHello on a new connection, and returns the version
+// and cipher suite selected by the ServerHello. ok is false if the server
+// answered with an alert or closed the connection. err is set only if the
+// connection cannot be opened.
+func tryHello(dial func() (net.Conn, error), version uint16, suites []uint16, serverName string) (selected, cipher uint16, ok bool, err error) {
+	msg, err := sendHello(dial, encodeClientHello(version, suites, serverName, nil, nil))
+	if err != nil {
+		return 0, 0, false, err
+	}
+	selected, cipher, extensions, ok := splitServerHello(msg)
+	if !ok {
+		return 0, 0, false, nil
+	}
+	for _, e := range extensions {
+		if e.typ == extensionSupportedVersions && len(e.data) == 2 {
+			selected = binary.BigEndian.Uint16(e.data)
+		}
+	}
+	return selected, cipher, true, nil
+}
+
+// enumerateTLS finds the versions supported by the server, and the cipher
+// suites it accepts with each, by offering the cipher suites not selected
+// yet until the server refuses them. Each ClientHello is sent on a new
+// connection from dial. It returns the versions enumerated before dial
+// failed, if it did.
+func enumerateTLS(dial func() (net.Conn, error), serverName string) ([]tlsSupport, error) {
+	var support []tlsSupport
+	for _, version := range tlsEnumerateVersions {
+		s := tlsSupport{version: version}
+		remaining := enumerationCipherSuites(version)
+		for len(remaining) > 0 {
+			selected, cipher, ok, err := tryHello(dial, version, remaining, serverName)
+			if err != nil {
+				return support, err
+			}
+			i := indexUint16(remaining, cipher)
+			if !ok || selected != version || i < 0 {
+				break
+			}
+			s.supported = true
+			s.cipherSuites = append(s.cipherSuites, cipher)
+			remaining = append(remaining[:i], remaining[i+1:]...)
+		}
+		support = append(support, s)
+	}
+	return support, nil
+}
+
+// indexUint16 returns the index of v in s, or -1.
+func indexUint16(s []uint16, v uint16) int {
+	for i, x := range s {
+		if x == v {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,103 @@
+package zgrab2
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestEncodeClientHello(t *testing.T) {
+	for _, version := range tlsEnumerateVersions {
+		record := encodeClientHello(version, enumerationCipherSuites(version), "example.com", nil, nil)
+		if length := len(record) - 5 - 4; length >= 256 && length < 512 {
+			t.Errorf("version %04x: got a ClientHello of %d bytes", version, length)
+		}
+		if int(record[3])<<8|int(record[4]) != len(record)-5 {
+			t.Errorf("version %04x: got a record length of %d for %d bytes", version, int(record[3])<<8|int(record[4]), len(record)-5)
+		}
+	}
+}
+
+func TestEnumerateTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.TLS = &tls.Config{
+		MinVersion:   tls.VersionTLS11,
+		CipherSuites: []uint16{0xc02f, 0xc013, 0x0035},
+	}
+	server.StartTLS()
+	defer server.Close()
+	dial := func() (net.Conn, error) {
+		return net.Dial("tcp", server.Listener.Addr().String())
+	}
+	support, err := enumerateTLS(dial, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint16][]uint16{
+		0x0300: nil,
+		0x0301: nil,
+		0x0302: {0x0035, 0xc013},
+		0x0303: {0x0035, 0xc013, 0xc02f},
+		0x0304: {0x1301, 0x1302, 0x1303},
+	}
+	if len(support) != len(want) {
+		t.Fatalf("got %+v", support)
+	}
+	for _, s := range support {
+		suites := append([]uint16(nil), s.cipherSuites...)
+		sort.Slice(suites, func(i, j int) bool { return suites[i] < suites[j] })
+		if s.supported != (want[s.version] != nil) || !reflect.DeepEqual(suites, want[s.version]) {
+			t.Errorf("version %04x: got supported %v with %04x, want %04x", s.version, s.supported, suites, want[s.version])
+		}
+	}
+}
+
+func TestHandshakeRedial(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	dial := func() (net.Conn, error) {
+		return net.Dial("tcp", server.Listener.Addr().String())
+	}
+	flags := &TLSFlags{Enumerate: true}
+	for _, redial := range []bool{false, true} {
+		conn, err := dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tlsConn *TLSConnection
+		if redial {
+			tlsConn, err = flags.GetTLSConnectionForTarget(conn, nil, dial)
+		} else {
+			tlsConn, err = flags.GetTLSConnection(conn)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			t.Fatal(err)
+		}
+		tlsConn.Close()
+		if enumerated := len(tlsConn.GetLog().Enumeration) > 0; enumerated != redial {
+			t.Errorf("with a dialer %v: got an enumeration %v", redial, enumerated)
+		}
+	}
+}
+
+func TestCheckRedial(t *testing.T) {
+	if err := (&TLSFlags{OCSP: true}).CheckRedial("--starttls"); err != nil {
+		t.Errorf("got %v", err)
+	}
+	err := (&TLSFlags{VulnChecks: true}).CheckRedial("--starttls")
+	if err == nil || err.Error() != "--tls-vuln-checks is not supported with --starttls, whose TLS connections cannot be reopened" {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package zgrab2
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// ocspTimeout is the timeout of the OCSP queries of --tls-ocsp.
+const ocspTimeout = 10 * time.Second
+
+// maxOCSPResponseSize is the largest OCSP response read.
+const maxOCSPResponseSize = 1 << 20
+
+var (
+	oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidSHA1      = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+)
+
+var ocspResponseStatusNames = map[asn1.Enumerated]string{
+	0: "successful",
+	1: "malformed_request",
+	2: "internal_error",
+	3: "try_later",
+	5: "sig_required",
+	6: "unauthorized",
+}
+
+var crlReasonNames = map[asn1.Enumerated]string{
+	0:  "unspecified",
+	1:  "key_compromise",
+	2:  "ca_compromise",
+	3:  "affiliation_changed",
+	4:  "superseded",
+	5:  "cessation_of_operation",
+	6:  "certificate_hold",
+	8:  "remove_from_crl",
+	9:  "privilege_withdrawn",
+	10: "aa_compromise",
+}
+
+var (
+	// errNoServerCertificate is the error of the checks of the server's
+	// certificate if it sent none.
+	errNoServerCertificate = errors.New("no server certificate")
+
+	// errNoOCSPResponder is the error of the live OCSP check of a leaf
+	// certificate without an OCSP responder.
+	errNoOCSPResponder = errors.New("the certificate has no OCSP responder")
+
+	// errNoIssuer is the error of the live OCSP check if the server did not
+	// send the issuer of its certificate.
+	errNoIssuer = errors.New("the issuer of the certificate was not sent")
+)
+
+// The ASN.1 structures of OCSP (RFC 6960, section 4).
+type ocspCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type ocspRequestEntry struct {
+	CertID ocspCertID
+}
+
+type ocspTBSRequest struct {
+	Version     int `asn1:"explicit,tag:0,default:0,optional"`
+	RequestList []ocspRequestEntry
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspResponseASN1 struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional,default:-1"`
+}
+
+type ocspSingleResponse struct {
+	CertID           ocspCertID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspResponseData struct {
+	Version     int `asn1:"explicit,tag:0,default:0,optional"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+	Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type basicOCSPResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// OCSPResponse is an OCSP response, with the status of one certificate. The
+// signature of the response is not verified.
+type OCSPResponse struct {
+	// ResponseStatus is the status of the response, such as successful or
+	// try_later. The other fields are absent if it is not successful.
+	ResponseStatus string `json:"response_status"`
+
+	// ProducedAt is the time the response was signed at.
+	ProducedAt *time.Time `json:"produced_at,omitempty"`
+
+	// ResponderName is the distinguished name of the responder, if it is
+	// identified by its name.
+	ResponderName string `json:"responder_name,omitempty"`
+
+	// ResponderKeyHash is the SHA-1 hash of the public key of the responder,
+	// in hex, if it is identified by its key.
+	ResponderKeyHash string `json:"responder_key_hash,omitempty"`
+
+	// SerialNumber is the serial number of the certificate.
+	SerialNumber string `json:"serial_number,omitempty"`
+
+	// CertStatus is the status of the certificate: good, revoked or unknown.
+	CertStatus string `json:"cert_status,omitempty"`
+
+	ThisUpdate *time.Time `json:"this_update,omitempty"`
+	NextUpdate *time.Time `json:"next_update,omitempty"`
+
+	// RevokedAt is the revocation time of a revoked certificate.
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+
+	// RevocationReason is the CRL reason of the revocation, if given, such as
+	// key_compromise.
+	RevocationReason string `json:"revocation_reason,omitempty"`
+}
+
+// OCSPCheck is the outcome of the live OCSP query of --tls-ocsp.
+type OCSPCheck struct {
+	// Responder is the URL of the OCSP responder queried.
+	Responder string `json:"responder,omitempty"`
+
+	Response *OCSPResponse `json:"response,omitempty"`
+
+	// Error is the error that interrupted the check, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// ParseOCSPResponse parses a DER OCSP response, with the status of the
+// certificate with the given serial number, or of the first certificate if
+// serial is nil.
+func ParseOCSPResponse(der []byte, serial *big.Int) (*OCSPResponse, error) {
+	var resp ocspResponseASN1
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after the OCSP response")
+	}
+	ret := &OCSPResponse{ResponseStatus: ocspResponseStatusNames[resp.Status]}
+	if ret.ResponseStatus == "" {
+		ret.ResponseStatus = fmt.Sprintf("unknown (%d)", resp.Status)
+	}
+	if resp.Status != 0 {
+		return ret, nil
+	}
+	if !resp.Response.ResponseType.Equal(oidOCSPBasic) {
+		return nil, fmt.Errorf("unsupported OCSP response type %s", resp.Response.ResponseType)
+	}
+	var basic basicOCSPResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return nil, err
+	}
+	data := &basic.TBSResponseData
+	ret.ProducedAt = &data.ProducedAt
+	// The responder ID is explicitly tagged: [1] for a name, [2] for a key
+	// hash.
+	switch id := data.ResponderID; id.Tag {
+	case 1:
+		var rdns pkix.RDNSequence
+		if _, err := asn1.Unmarshal(id.Bytes, &rdns); err != nil {
+			return nil, err
+		}
+		var name pkix.Name
+		name.FillFromRDNSequence(&rdns)
+		ret.ResponderName = name.String()
+	case 2:
+		var hash []byte
+		if _, err := asn1.Unmarshal(id.Bytes, &hash); err != nil {
+			return nil, err
+		}
+		ret.ResponderKeyHash = hex.EncodeToString(hash)
+	}
+	var single *ocspSingleResponse
+	for i := range data.Responses {
+		if serial == nil || data.Responses[i].CertID.SerialNumber.Cmp(serial) == 0 {
+			single = &data.Responses[i]
+			break
+		}
+	}
+	if single == nil {
+		return nil, errors.New("no status for the certificate in the OCSP response")
+	}
+	ret.SerialNumber = single.CertID.SerialNumber.String()
+	ret.ThisUpdate = &single.ThisUpdate
+	if !single.NextUpdate.IsZero() {
+		ret.NextUpdate = &single.NextUpdate
+	}
+	switch {
+	case bool(single.Good):
+		ret.CertStatus = "good"
+	case bool(single.Unknown):
+		ret.CertStatus = "unknown"
+	default:
+		ret.CertStatus = "revoked"
+		ret.RevokedAt = &single.Revoked.RevocationTime
+		if single.Revoked.Reason >= 0 {
+			ret.RevocationReason = crlReasonNames[single.Revoked.Reason]
+		}
+	}
+	return ret, nil
+}
+
+// stapledOCSP returns the OCSP response of the CertificateStatus read, or nil
+// if the server stapled none.
+func (r *helloRecorder) stapledOCSP() *OCSPResponse {
+	r.mu.Lock()
+	msg := r.certificateStatusMsg
+	r.mu.Unlock()
+	// The status type is 1 (ocsp) for the responses to status_request.
+	if len(msg) < 8 || msg[4] != 1 {
+		return nil
+	}
+	length := int(msg[5])<<16 | int(msg[6])<<8 | int(msg[7])
+	if len(msg) < 8+length {
+		return nil
+	}
+	resp, err := ParseOCSPResponse(msg[8:8+length], nil)
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+// encodeOCSPRequest returns the OCSP request of the status of cert, issued by
+// issuer, with the SHA-1 hashes of its issuer.
+func encodeOCSPRequest(cert, issuer *x509.Certificate) ([]byte, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, err
+	}
+	nameHash := sha1.Sum(issuer.RawSubject)
+	keyHash := sha1.Sum(spki.PublicKey.RightAlign())
+	return asn1.Marshal(ocspRequest{
+		TBSRequest: ocspTBSRequest{
+			RequestList: []ocspRequestEntry{{
+				CertID: ocspCertID{
+					HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+					IssuerNameHash: nameHash[:],
+					IssuerKeyHash:  keyHash[:],
+					SerialNumber:   cert.SerialNumber,
+				},
+			}},
+		},
+	})
+}
+
+// checkOCSP queries the first OCSP responder of the leaf certificate of chain
+// (DER certificates, the leaf first) for its status.
+func checkOCSP(chain [][]byte) *OCSPCheck {
+	c := new(OCSPCheck)
+	if len(chain) == 0 {
+		c.Error = errNoServerCertificate.Error()
+		return c
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	if len(leaf.OCSPServer) == 0 {
+		c.Error = errNoOCSPResponder.Error()
+		return c
+	}
+	c.Responder = leaf.OCSPServer[0]
+	var issuer *x509.Certificate
+	for _, raw := range chain[1:] {
+		if cert, err := x509.ParseCertificate(raw); err == nil && bytes.Equal(cert.RawSubject, leaf.RawIssuer) {
+			issuer = cert
+			break
+		}
+	}
+	if issuer == nil {
+		c.Error = errNoIssuer.Error()
+		return c
+	}
+	req, err := encodeOCSPRequest(leaf, issuer)
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	client := &http.Client{Timeout: ocspTimeout}
+	resp, err := client.Post(c.Responder, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxOCSPResponseSize))
+	if err != nil {
+		c.Error = err.Error()
+		return c
+	}
+	if resp.StatusCode != http.StatusOK {
+		c.Error = fmt.Sprintf("OCSP responder returned %s", resp.Status)
+		return c
+	}
+	if c.Response, err = ParseOCSPResponse(body, leaf.SerialNumber); err != nil {
+		c.Error = err.Error()
+	}
+	return c
+}
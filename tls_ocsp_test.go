@@ -0,0 +1,143 @@
+package zgrab2
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// issueCertificates returns a CA certificate and a leaf certificate it issued,
+// with the given OCSP responder.
+func issueCertificates(t *testing.T, responder string) (ca, leaf *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(4242),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{responder},
+	}
+	if der, err = x509.CreateCertificate(rand.Reader, leafTemplate, ca, &key.PublicKey, key); err != nil {
+		t.Fatal(err)
+	}
+	if leaf, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	return ca, leaf
+}
+
+// encodeOCSPResponse returns a successful OCSP response with the status of
+// single, and an invalid signature.
+func encodeOCSPResponse(t *testing.T, responderID asn1.RawValue, single ocspSingleResponse) []byte {
+	single.CertID.HashAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue}
+	basic, err := asn1.Marshal(basicOCSPResponse{
+		TBSResponseData: ocspResponseData{
+			ResponderID: responderID,
+			ProducedAt:  time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+			Responses:   []ocspSingleResponse{single},
+		},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature:          asn1.BitString{Bytes: []byte{0}, BitLength: 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(ocspResponseASN1{Response: ocspResponseBytes{ResponseType: oidOCSPBasic, Response: basic}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestParseOCSPResponse(t *testing.T) {
+	keyHash, _ := asn1.Marshal([]byte{0xab, 0xcd})
+	thisUpdate := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	der := encodeOCSPResponse(t, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: keyHash}, ocspSingleResponse{
+		CertID:     ocspCertID{SerialNumber: big.NewInt(7)},
+		Revoked:    ocspRevokedInfo{RevocationTime: thisUpdate.Add(-time.Hour), Reason: 1},
+		ThisUpdate: thisUpdate,
+		NextUpdate: thisUpdate.Add(24 * time.Hour),
+	})
+	resp, err := ParseOCSPResponse(der, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ResponseStatus != "successful" || resp.ResponderKeyHash != "abcd" || resp.SerialNumber != "7" || resp.CertStatus != "revoked" || resp.RevocationReason != "key_compromise" {
+		t.Errorf("got %+v", resp)
+	}
+	if resp.NextUpdate == nil || !resp.NextUpdate.Equal(thisUpdate.Add(24*time.Hour)) || resp.RevokedAt == nil || !resp.RevokedAt.Equal(thisUpdate.Add(-time.Hour)) {
+		t.Errorf("got next update %v, revoked at %v", resp.NextUpdate, resp.RevokedAt)
+	}
+	if _, err := ParseOCSPResponse(der, big.NewInt(8)); err == nil {
+		t.Errorf("got no error for another certificate")
+	}
+	if resp, err := ParseOCSPResponse([]byte{0x30, 0x03, 0x0a, 0x01, 0x03}, nil); err != nil || resp.ResponseStatus != "try_later" {
+		t.Errorf("got %+v, %v", resp, err)
+	}
+
+	// The response stapled in a CertificateStatus.
+	body := append([]byte{1, 0, byte(len(der) >> 8), byte(len(der))}, der...)
+	status := append([]byte{22, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	r := &helloRecorder{certificateStatusMsg: status}
+	if resp := r.stapledOCSP(); resp == nil || resp.CertStatus != "revoked" {
+		t.Errorf("got stapled %+v", resp)
+	}
+}
+
+func TestCheckOCSP(t *testing.T) {
+	var ca, leaf *x509.Certificate
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var req ocspRequest
+		if _, err := asn1.Unmarshal(body, &req); err != nil || len(req.TBSRequest.RequestList) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		certID := req.TBSRequest.RequestList[0].CertID
+		w.Write(encodeOCSPResponse(t, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: ca.RawSubject}, ocspSingleResponse{
+			CertID:     certID,
+			Good:       true,
+			ThisUpdate: time.Now().UTC().Truncate(time.Second),
+		}))
+	}))
+	defer server.Close()
+	ca, leaf = issueCertificates(t, server.URL)
+
+	c := checkOCSP([][]byte{leaf.Raw, ca.Raw})
+	if c.Error != "" || c.Responder != server.URL || c.Response == nil {
+		t.Fatalf("got %+v", c)
+	}
+	if c.Response.CertStatus != "good" || c.Response.SerialNumber != "4242" || c.Response.ResponderName != "CN=Test CA" {
+		t.Errorf("got %+v", c.Response)
+	}
+	if c := checkOCSP([][]byte{leaf.Raw}); c.Error != errNoIssuer.Error() {
+		t.Errorf("got %+v without the issuer", c)
+	}
+}
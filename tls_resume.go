@@ -0,0 +1,170 @@
+package zgrab2
+
+import (
+	"crypto/rand"
+	gotls "crypto/tls"
+	"net"
+	"sync"
+	"time"
+)
+
+// ticketWait is the longest wait for the NewSessionTicket of a TLS 1.3
+// server after the handshake.
+const ticketWait = 2 * time.Second
+
+// TLSResumption is the outcome of the resumption attempts of
+// --tls-resumption, each made on a new connection.
+type TLSResumption struct {
+	// SessionID is set if the server resumed the session by its session ID.
+	// It is absent if the handshake gave no session ID.
+	SessionID *bool `json:"session_id,omitempty"`
+
+	// SessionTicket is set if the server resumed the session with its
+	// session ticket. It is absent if the handshake gave no ticket.
+	SessionTicket *bool `json:"session_ticket,omitempty"`
+
+	// TicketLifetimeHint is the lifetime hint of the session ticket, in
+	// seconds.
+	TicketLifetimeHint uint32 `json:"ticket_lifetime_hint,omitempty"`
+
+	// TLS13PSK is set if the server resumed a TLS 1.3 session with a PSK
+	// from its NewSessionTicket. It is absent if the server does not support
+	// TLS 1.3, or sent no ticket.
+	TLS13PSK *bool `json:"tls13_psk,omitempty"`
+
+	// Error is the error that interrupted the attempts, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// tlsSession is the session of the handshake, up to TLS 1.2.
+type tlsSession struct {
+	version      uint16
+	cipherSuite  uint16
+	sessionID    []byte
+	ticket       []byte
+	lifetimeHint uint32
+}
+
+// serverHelloSessionID returns the session ID of a ServerHello message.
+func serverHelloSessionID(msg []byte) []byte {
+	if len(msg) < 4+2+32+1 || len(msg) < 4+2+32+1+int(msg[38]) {
+		return nil
+	}
+	return msg[39 : 39+int(msg[38])]
+}
+
+// resumeSession offers the session ID, and the ticket if not nil, with the
+// version and cipher suite of the session, and returns true if the server
+// echoed the session ID, which it does only to resume the session. A random
+// session ID is sent with a ticket (RFC 5077, section 3.4).
+func resumeSession(dial func() (net.Conn, error), serverName string, session *tlsSession, sessionID, ticket []byte) (bool, error) {
+	record := encodeClientHello(session.version, []uint16{session.cipherSuite}, serverName, sessionID, ticket)
+	msg, err := sendHello(dial, record)
+	if err != nil {
+		return false, err
+	}
+	echoed := serverHelloSessionID(msg)
+	return len(echoed) > 0 && string(echoed) == string(sessionID), nil
+}
+
+// ticketCache is a session cache for one server, which stops the wait for a
+// NewSessionTicket once it is received.
+type ticketCache struct {
+	mu       sync.Mutex
+	session  *gotls.ClientSessionState
+	received func()
+}
+
+func (c *ticketCache) Get(key string) (*gotls.ClientSessionState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session, c.session != nil
+}
+
+func (c *ticketCache) Put(key string, session *gotls.ClientSessionState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if session != nil && c.session == nil && c.received != nil {
+		c.received()
+	}
+	c.session = session
+}
+
+// resumeTLS13 performs a TLS 1.3 handshake, waits up to ticketWait for a
+// NewSessionTicket, and returns whether a second handshake resumed the
+// session with it. It returns nil if the first handshake failed, or no ticket
+// was received.
+func resumeTLS13(dial func() (net.Conn, error), serverName string) (*bool, error) {
+	cache := new(ticketCache)
+	config := &gotls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+		MinVersion:         gotls.VersionTLS13,
+		MaxVersion:         gotls.VersionTLS13,
+		ClientSessionCache: cache,
+	}
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	client := gotls.Client(conn, config)
+	if err := client.Handshake(); err != nil {
+		client.Close()
+		return nil, nil
+	}
+	// The ticket is read after the handshake; the read is interrupted once
+	// the ticket is received.
+	cache.mu.Lock()
+	cache.received = func() {
+		conn.SetReadDeadline(time.Now())
+	}
+	cache.mu.Unlock()
+	conn.SetReadDeadline(time.Now().Add(ticketWait))
+	client.Read(make([]byte, 1))
+	client.Close()
+	if _, ok := cache.Get(""); !ok {
+		return nil, nil
+	}
+
+	cache.mu.Lock()
+	cache.received = nil
+	cache.mu.Unlock()
+	if conn, err = dial(); err != nil {
+		return nil, err
+	}
+	client = gotls.Client(conn, config)
+	defer client.Close()
+	resumed := client.Handshake() == nil && client.ConnectionState().DidResume
+	return &resumed, nil
+}
+
+// testResumption tries to resume session, if not nil, by its session ID and
+// its ticket, then tries TLS 1.3 PSK resumption.
+func testResumption(dial func() (net.Conn, error), serverName string, session *tlsSession) *TLSResumption {
+	r := new(TLSResumption)
+	if session != nil && len(session.sessionID) > 0 {
+		resumed, err := resumeSession(dial, serverName, session, session.sessionID, nil)
+		if err != nil {
+			r.Error = err.Error()
+			return r
+		}
+		r.SessionID = &resumed
+	}
+	if session != nil && len(session.ticket) > 0 {
+		sessionID := make([]byte, 32)
+		rand.Read(sessionID)
+		resumed, err := resumeSession(dial, serverName, session, sessionID, session.ticket)
+		if err != nil {
+			r.Error = err.Error()
+			return r
+		}
+		r.SessionTicket = &resumed
+		r.TicketLifetimeHint = session.lifetimeHint
+	}
+	resumed, err := resumeTLS13(dial, serverName)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	r.TLS13PSK = resumed
+	return r
+}
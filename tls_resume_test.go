@@ -0,0 +1,93 @@
+package zgrab2
+
+import (
+	"bytes"
+	gotls "crypto/tls"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveSessions runs a fake TLS 1.2 server, which answers each ClientHello
+// with a ServerHello echoing its session ID if resume returns true.
+func serveSessions(t *testing.T, resume func(sessionID, hello []byte) bool) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			header := make([]byte, 5)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				conn.Close()
+				continue
+			}
+			hello := make([]byte, int(header[3])<<8|int(header[4]))
+			if _, err := io.ReadFull(conn, hello); err != nil || len(hello) < 39 {
+				conn.Close()
+				continue
+			}
+			sessionID := hello[39 : 39+int(hello[38])]
+			if !resume(sessionID, hello) {
+				sessionID = bytes.Repeat([]byte{0xee}, 32)
+			}
+			body := append(make([]byte, 2+32), byte(len(sessionID)))
+			body[0], body[1] = 3, 3
+			body = append(append(body, sessionID...), 0xc0, 0x2f, 0)
+			msg := append([]byte{2, 0, 0, byte(len(body))}, body...)
+			conn.Write(append([]byte{22, 3, 3, 0, byte(len(msg))}, msg...))
+			conn.Close()
+		}
+	}()
+	return listener
+}
+
+func TestTestResumption(t *testing.T) {
+	known := bytes.Repeat([]byte{1}, 32)
+	ticket := []byte("session ticket")
+	listener := serveSessions(t, func(sessionID, hello []byte) bool {
+		return bytes.Equal(sessionID, known) || bytes.Contains(hello, ticket)
+	})
+	defer listener.Close()
+	dial := func() (net.Conn, error) {
+		return net.Dial("tcp", listener.Addr().String())
+	}
+	session := &tlsSession{version: 0x0303, cipherSuite: 0xc02f, sessionID: known, ticket: ticket, lifetimeHint: 7200}
+	r := testResumption(dial, "", session)
+	if r.SessionID == nil || !*r.SessionID || r.SessionTicket == nil || !*r.SessionTicket || r.TicketLifetimeHint != 7200 {
+		t.Errorf("got %+v", r)
+	}
+	if r.TLS13PSK != nil || r.Error != "" {
+		t.Errorf("got TLS 1.3 resumption %v, error %q from a TLS 1.2 server", r.TLS13PSK, r.Error)
+	}
+
+	session.sessionID = bytes.Repeat([]byte{2}, 32)
+	session.ticket = []byte("expired ticket")
+	r = testResumption(dial, "", session)
+	if r.SessionID == nil || *r.SessionID || r.SessionTicket == nil || *r.SessionTicket {
+		t.Errorf("got %+v for an unknown session", r)
+	}
+}
+
+func TestResumeTLS13(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.TLS = &gotls.Config{MinVersion: gotls.VersionTLS13}
+	server.StartTLS()
+	defer server.Close()
+	dial := func() (net.Conn, error) {
+		return net.Dial("tcp", server.Listener.Addr().String())
+	}
+	resumed, err := resumeTLS13(dial, "example.com")
+	if err != nil || resumed == nil || !*resumed {
+		t.Errorf("got resumed %v, error %v", resumed, err)
+	}
+}
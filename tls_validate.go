@@ -0,0 +1,172 @@
+package zgrab2
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The reasons of the chain validation failures.
+const (
+	ValidationExpired          = "expired"
+	ValidationNotYetValid      = "not_yet_valid"
+	ValidationUnknownCA        = "unknown_ca"
+	ValidationHostnameMismatch = "hostname_mismatch"
+	ValidationInvalid          = "invalid"
+)
+
+// ChainValidation is the outcome of the validation of the server's chain
+// against one root store of --tls-root-store.
+type ChainValidation struct {
+	// Store is the name of the root store.
+	Store string `json:"store"`
+
+	// Valid is true if a chain to a root of the store was built, and the
+	// leaf certificate is valid for the server name, if any.
+	Valid bool `json:"valid"`
+
+	// Chain is the SHA-256 fingerprints of the certificates of the chain
+	// built, from the leaf to the root.
+	Chain []string `json:"chain,omitempty"`
+
+	// Reason is the reason of the failure: expired, not_yet_valid, unknown_ca,
+	// hostname_mismatch or invalid.
+	Reason string `json:"reason,omitempty"`
+
+	// Error is the error of the validation, or of the loading of the store.
+	Error string `json:"error,omitempty"`
+}
+
+// rootStore is a root store of --tls-root-store, loaded once.
+type rootStore struct {
+	once sync.Once
+	pool *x509.CertPool
+	err  error
+}
+
+var rootStores = struct {
+	sync.Mutex
+	stores map[string]*rootStore
+}{stores: make(map[string]*rootStore)}
+
+// loadRootStore returns the roots of the PEM bundle at path.
+func loadRootStore(path string) (*x509.CertPool, error) {
+	rootStores.Lock()
+	store, ok := rootStores.stores[path]
+	if !ok {
+		store = new(rootStore)
+		rootStores.stores[path] = store
+	}
+	rootStores.Unlock()
+	store.once.Do(func() {
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			store.err = err
+			return
+		}
+		store.pool = x509.NewCertPool()
+		if !store.pool.AppendCertsFromPEM(pem) {
+			store.err = fmt.Errorf("no certificates in %s", path)
+		}
+	})
+	return store.pool, store.err
+}
+
+// parseRootStore splits a --tls-root-store value, NAME=FILE, or FILE named
+// after its base name.
+func parseRootStore(value string) (name, path string) {
+	if i := strings.Index(value, "="); i > 0 {
+		return value[:i], value[i+1:]
+	}
+	return strings.TrimSuffix(filepath.Base(value), filepath.Ext(value)), value
+}
+
+// validationReason returns the reason of a validation error.
+func validationReason(err error) string {
+	switch e := err.(type) {
+	case x509.CertificateInvalidError:
+		if e.Reason == x509.Expired {
+			// Expired is also the reason of the certificates not yet valid,
+			// whose detail is "current time ... is before ...".
+			if strings.Contains(e.Detail, "is before") {
+				return ValidationNotYetValid
+			}
+			return ValidationExpired
+		}
+	case x509.UnknownAuthorityError:
+		return ValidationUnknownCA
+	case x509.HostnameError:
+		return ValidationHostnameMismatch
+	}
+	return ValidationInvalid
+}
+
+// validateChain validates chain (DER certificates, the leaf first) against
+// the root store at path, for serverName if not empty, at now.
+func validateChain(chain [][]byte, path, serverName string, now time.Time) *ChainValidation {
+	v := new(ChainValidation)
+	roots, err := loadRootStore(path)
+	if err != nil {
+		v.Error = err.Error()
+		return v
+	}
+	if len(chain) == 0 {
+		v.Error = errNoServerCertificate.Error()
+		return v
+	}
+	certs := make([]*x509.Certificate, len(chain))
+	for i, raw := range chain {
+		if certs[i], err = x509.ParseCertificate(raw); err != nil {
+			v.Reason = ValidationInvalid
+			v.Error = err.Error()
+			return v
+		}
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	// The hostname is checked apart, so that a chain is built, and its
+	// errors reported, whether or not the name matches.
+	chains, err := certs[0].Verify(opts)
+	if err == nil && serverName != "" {
+		err = certs[0].VerifyHostname(serverName)
+	}
+	if len(chains) > 0 {
+		for _, cert := range chains[0] {
+			sum := sha256.Sum256(cert.Raw)
+			v.Chain = append(v.Chain, hex.EncodeToString(sum[:]))
+		}
+	}
+	if err != nil {
+		v.Reason = validationReason(err)
+		v.Error = err.Error()
+		return v
+	}
+	v.Valid = true
+	return v
+}
+
+// validateChains validates chain against each root store of --tls-root-store.
+func validateChains(chain [][]byte, stores []string, serverName string) []ChainValidation {
+	now := time.Now()
+	ret := make([]ChainValidation, 0, len(stores))
+	for _, store := range stores {
+		name, path := parseRootStore(store)
+		v := validateChain(chain, path, serverName, now)
+		v.Store = name
+		ret = append(ret, *v)
+	}
+	return ret
+}
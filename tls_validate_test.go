@@ -0,0 +1,98 @@
+package zgrab2
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newCertificate returns a certificate for template, issued by parent with
+// parentKey, or self-signed if parent is nil, and its key.
+func newCertificate(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestValidateChains(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zgrab2-roots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	var stores []string
+	var cas []*x509.Certificate
+	var keys []*ecdsa.PrivateKey
+	for i, name := range []string{"good", "other"} {
+		ca, key := newCertificate(t, &x509.Certificate{
+			SerialNumber:          big.NewInt(int64(i + 1)),
+			Subject:               pkix.Name{CommonName: name + " CA"},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+		}, nil, nil)
+		path := filepath.Join(dir, name+".pem")
+		if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0644); err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, name+"="+path)
+		cas, keys = append(cas, ca), append(keys, key)
+	}
+	stores = append(stores, filepath.Join(dir, "missing.pem"))
+	leaf := func(notAfter time.Time) [][]byte {
+		cert, _ := newCertificate(t, &x509.Certificate{
+			SerialNumber: big.NewInt(10),
+			Subject:      pkix.Name{CommonName: "example.com"},
+			DNSNames:     []string{"example.com"},
+			NotBefore:    now.Add(-2 * time.Hour),
+			NotAfter:     notAfter,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, cas[0], keys[0])
+		return [][]byte{cert.Raw, cas[0].Raw}
+	}
+
+	v := validateChains(leaf(now.Add(time.Hour)), stores, "example.com")
+	if len(v) != 3 {
+		t.Fatalf("got %+v", v)
+	}
+	if v[0].Store != "good" || !v[0].Valid || len(v[0].Chain) != 2 || v[0].Error != "" {
+		t.Errorf("got %+v", v[0])
+	}
+	if v[1].Store != "other" || v[1].Valid || v[1].Reason != ValidationUnknownCA {
+		t.Errorf("got %+v", v[1])
+	}
+	if v[2].Store != "missing" || v[2].Valid || v[2].Error == "" {
+		t.Errorf("got %+v", v[2])
+	}
+
+	if v := validateChains(leaf(now.Add(time.Hour)), stores[:1], "example.org"); v[0].Valid || v[0].Reason != ValidationHostnameMismatch || len(v[0].Chain) != 2 {
+		t.Errorf("got %+v for another name", v[0])
+	}
+	if v := validateChains(leaf(now.Add(-time.Hour)), stores[:1], "example.com"); v[0].Valid || v[0].Reason != ValidationExpired {
+		t.Errorf("got %+v for an expired certificate", v[0])
+	}
+}
@@ -0,0 +1,405 @@
+package zgrab2
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// vulnCheckTimeout is the longest wait for the server in each step of the
+// probes of --tls-vuln-checks.
+var vulnCheckTimeout = 3 * time.Second
+
+// The verdicts of the checks of --tls-vuln-checks.
+const (
+	VulnVulnerable    = "vulnerable"
+	VulnNotVulnerable = "not_vulnerable"
+	VulnNotApplicable = "not_applicable"
+	VulnInconclusive  = "inconclusive"
+)
+
+// The TLS record content types.
+const (
+	recordChangeCipherSpec = 20
+	recordAlert            = 21
+	recordHandshake        = 22
+	recordHeartbeat        = 24
+)
+
+// extensionHeartbeat is the heartbeat extension (RFC 6520).
+const extensionHeartbeat = 15
+
+// vulnVersions are the versions offered in turn by the probes, until the
+// server accepts one.
+var vulnVersions = []uint16{0x0303, 0x0302, 0x0301}
+
+// robotCipherSuites are the cipher suites with RSA key exchange offered by
+// the ROBOT check.
+var robotCipherSuites = []uint16{0x009d, 0x009c, 0x003d, 0x003c, 0x0035, 0x002f, 0x000a}
+
+// errNoRSACertificate is returned if the ROBOT check cannot read the RSA key
+// of the server's certificate.
+var errNoRSACertificate = errors.New("no RSA key in the server certificate")
+
+// TLSVulnCheck is the verdict of one check of --tls-vuln-checks.
+type TLSVulnCheck struct {
+	// Verdict is vulnerable, not_vulnerable, not_applicable (if the server
+	// does not support what the flaw is in) or inconclusive.
+	Verdict string `json:"verdict,omitempty"`
+
+	// Detail is the behavior of the server the verdict is based on.
+	Detail string `json:"detail,omitempty"`
+
+	// Error is the error that interrupted the check, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// TLSVulnChecks are the verdicts of the checks of --tls-vuln-checks, each
+// made on new connections.
+type TLSVulnChecks struct {
+	Heartbleed *TLSVulnCheck `json:"heartbleed"`
+
+	// ROBOT is the verdict of the check for a Bleichenbacher oracle in the
+	// RSA key exchange.
+	ROBOT *TLSVulnCheck `json:"robot"`
+
+	// CCSInjection is the verdict of the check for the early
+	// ChangeCipherSpec acceptance of CVE-2014-0224.
+	CCSInjection *TLSVulnCheck `json:"ccs_injection"`
+}
+
+// encodeRecord returns a TLS record.
+func encodeRecord(typ uint8, version uint16, body []byte) []byte {
+	return append([]byte{typ, byte(version >> 8), byte(version), byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// readRecord reads a TLS record.
+func readRecord(conn net.Conn) (uint8, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, int(header[3])<<8|int(header[4]))
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return 0, nil, err
+	}
+	return header[0], body, nil
+}
+
+// connectionState describes how a read from the server failed.
+func connectionState(err error) string {
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return "timeout"
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return "closed"
+	}
+	if strings.Contains(err.Error(), "reset") {
+		return "reset"
+	}
+	return "error"
+}
+
+// describeRecord describes a record read from the server.
+func describeRecord(typ uint8, body []byte) string {
+	if typ == recordAlert && len(body) == 2 {
+		return fmt.Sprintf("alert %d %d", body[0], body[1])
+	}
+	return fmt.Sprintf("record %d", typ)
+}
+
+// probeConn is a connection on which the handshake was run up to the
+// ServerHelloDone.
+type probeConn struct {
+	net.Conn
+
+	// offered is the version of the ClientHello, and version the version of
+	// the ServerHello.
+	offered uint16
+	version uint16
+
+	hello *helloRecorder
+}
+
+// startHandshake sends a ClientHello offering the cipher suites and the extra
+// extensions on a new connection, with each version of vulnVersions in turn
+// until the server accepts one, and reads the server's flight up to the
+// ServerHelloDone. It returns nil if the server accepted no version. err is
+// set only if a connection cannot be opened.
+func startHandshake(dial func() (net.Conn, error), serverName string, suites []uint16, extra ...tlsExtension) (*probeConn, error) {
+	for _, offered := range vulnVersions {
+		conn, err := dial()
+		if err != nil {
+			return nil, err
+		}
+		conn.SetDeadline(time.Now().Add(vulnCheckTimeout))
+		r := &helloRecorder{Conn: conn}
+		if _, err := conn.Write(encodeClientHello(offered, suites, serverName, nil, nil, extra...)); err == nil {
+			buf := make([]byte, 4096)
+			for !r.isDone() {
+				if _, err := r.Read(buf); err != nil {
+					break
+				}
+			}
+		}
+		version, _, _, ok := splitServerHello(r.serverHello())
+		if ok && r.isDone() && version <= offered {
+			return &probeConn{Conn: conn, offered: offered, version: version, hello: r}, nil
+		}
+		conn.Close()
+	}
+	return nil, nil
+}
+
+// checkHeartbleed sends a heartbeat request claiming a payload it does not
+// have before the end of the handshake, which a vulnerable server answers
+// with as much of its memory (CVE-2014-0160).
+func checkHeartbleed(dial func() (net.Conn, error), serverName string) *TLSVulnCheck {
+	c, err := startHandshake(dial, serverName, enumerationCipherSuites(0x0303), tlsExtension{extensionHeartbeat, []byte{1}})
+	if err != nil {
+		return &TLSVulnCheck{Error: err.Error()}
+	}
+	if c == nil {
+		return &TLSVulnCheck{Verdict: VulnInconclusive, Detail: "no handshake"}
+	}
+	defer c.Close()
+	_, _, extensions, _ := splitServerHello(c.hello.serverHello())
+	heartbeat := false
+	for _, e := range extensions {
+		heartbeat = heartbeat || e.typ == extensionHeartbeat
+	}
+	if !heartbeat {
+		return &TLSVulnCheck{Verdict: VulnNotApplicable, Detail: "heartbeat extension not negotiated"}
+	}
+	c.SetDeadline(time.Now().Add(vulnCheckTimeout))
+	// A heartbeat_request claiming a payload of 16 KiB, and sending none.
+	if _, err := c.Write(encodeRecord(recordHeartbeat, c.version, []byte{1, 0x40, 0x00})); err != nil {
+		return &TLSVulnCheck{Verdict: VulnNotVulnerable, Detail: "connection closed"}
+	}
+	for {
+		typ, body, err := readRecord(c)
+		if err != nil {
+			return &TLSVulnCheck{Verdict: VulnNotVulnerable, Detail: "no heartbeat response: " + connectionState(err)}
+		}
+		switch typ {
+		case recordHeartbeat:
+			if len(body) > 3 {
+				return &TLSVulnCheck{Verdict: VulnVulnerable, Detail: fmt.Sprintf("heartbeat response of %d bytes", len(body))}
+			}
+			return &TLSVulnCheck{Verdict: VulnNotVulnerable, Detail: "empty heartbeat response"}
+		case recordAlert:
+			return &TLSVulnCheck{Verdict: VulnNotVulnerable, Detail: describeRecord(typ, body)}
+		}
+	}
+}
+
+// checkCCSInjection sends a ChangeCipherSpec right after the ServerHelloDone,
+// which a vulnerable server accepts, deriving its keys from an empty master
+// secret (CVE-2014-0224). The second ChangeCipherSpec sent is then decrypted
+// with these keys, and fails.
+func checkCCSInjection(dial func() (net.Conn, error), serverName string) *TLSVulnCheck {
+	c, err := startHandshake(dial, serverName, enumerationCipherSuites(0x0303))
+	if err != nil {
+		return &TLSVulnCheck{Error: err.Error()}
+	}
+	if c == nil {
+		return &TLSVulnCheck{Verdict: VulnInconclusive, Detail: "no handshake"}
+	}
+	defer c.Close()
+	ccs := encodeRecord(recordChangeCipherSpec, c.version, []byte{1})
+	c.SetDeadline(time.Now().Add(vulnCheckTimeout))
+	if _, err := c.Write(ccs); err != nil {
+		return &TLSVulnCheck{Verdict: VulnNotVulnerable, Detail: "connection closed"}
+	}
+	typ, body, err := readRecord(c)
+	switch {
+	case err == nil && typ == recordAlert:
+		return &TLSVulnCheck{Verdict: VulnNotVulnerable, Detail: "early ChangeCipherSpec refused: " + describeRecord(typ, body)}
+	case err == nil:
+		return &TLSVulnCheck{Verdict: VulnInconclusive, Detail: "early ChangeCipherSpec answered: " + describeRecord(typ, body)}
+	case connectionState(err) != "timeout":
+		return &TLSVulnCheck{Verdict: VulnNotVulnerable, Detail: "early ChangeCipherSpec refused: " + connectionState(err)}
+	}
+	c.SetDeadline(time.Now().Add(vulnCheckTimeout))
+	if _, err := c.Write(ccs); err != nil {
+		return &TLSVulnCheck{Verdict: VulnInconclusive, Detail: "connection closed"}
+	}
+	typ, body, err = readRecord(c)
+	// bad_record_mac or decryption_failed.
+	if err == nil && typ == recordAlert && len(body) == 2 && (body[1] == 20 || body[1] == 21) {
+		return &TLSVulnCheck{Verdict: VulnVulnerable, Detail: "early ChangeCipherSpec accepted: " + describeRecord(typ, body)}
+	}
+	if err != nil {
+		return &TLSVulnCheck{Verdict: VulnInconclusive, Detail: "early ChangeCipherSpec ignored: " + connectionState(err)}
+	}
+	return &TLSVulnCheck{Verdict: VulnInconclusive, Detail: "early ChangeCipherSpec ignored: " + describeRecord(typ, body)}
+}
+
+// serverRSAKey returns the RSA key of the leaf certificate of a Certificate
+// message.
+func serverRSAKey(msg []byte) (*rsa.PublicKey, error) {
+	// The type, length, certificate list length and certificate length.
+	if len(msg) < 10 || msg[0] != 11 {
+		return nil, errNoRSACertificate
+	}
+	length := int(msg[7])<<16 | int(msg[8])<<8 | int(msg[9])
+	if len(msg) < 10+length {
+		return nil, errNoRSACertificate
+	}
+	cert, err := x509.ParseCertificate(msg[10 : 10+length])
+	if err != nil {
+		return nil, err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errNoRSACertificate
+	}
+	return key, nil
+}
+
+// robotPayloads returns the encrypted premaster secrets of the ROBOT check
+// (https://robotattack.org/): a well formed one, then ones with wrong first
+// bytes, a 0x00 separator in the wrong position, no 0x00 separator, and a
+// wrong version.
+func robotPayloads(key *rsa.PublicKey, version uint16) [][]byte {
+	k := (key.N.BitLen() + 7) / 8
+	pad := make([]byte, k-3-48)
+	rand.Read(pad)
+	for i := range pad {
+		if pad[i] == 0 {
+			pad[i] = 0xff
+		}
+	}
+	secret := make([]byte, 46)
+	rand.Read(secret)
+	join := func(parts ...[]byte) []byte {
+		var b []byte
+		for _, p := range parts {
+			b = append(b, p...)
+		}
+		return b
+	}
+	v := []byte{byte(version >> 8), byte(version)}
+	plaintexts := [][]byte{
+		join([]byte{0x00, 0x02}, pad, []byte{0x00}, v, secret),
+		join([]byte{0x41, 0x17}, pad, []byte{0x00}, v, secret),
+		join([]byte{0x00, 0x02}, pad, []byte{0x11}, secret, []byte{0x00, 0x11}),
+		join([]byte{0x00, 0x02}, pad, []byte{0x11}, []byte{0x11, 0x11}, secret),
+		join([]byte{0x00, 0x02}, pad, []byte{0x00}, []byte{0x02, 0x02}, secret),
+	}
+	e := big.NewInt(int64(key.E))
+	payloads := make([][]byte, len(plaintexts))
+	for i, p := range plaintexts {
+		c := new(big.Int).Exp(new(big.Int).SetBytes(p), e, key.N).Bytes()
+		payloads[i] = append(make([]byte, k-len(c)), c...)
+	}
+	return payloads
+}
+
+// robotResponses sends each payload in a ClientKeyExchange on a new
+// connection, followed by a ChangeCipherSpec and a Finished if flight is
+// true, and returns the description of the server's answers.
+func robotResponses(dial func() (net.Conn, error), serverName string, payloads [][]byte, flight bool) ([]string, error) {
+	var responses []string
+	for _, payload := range payloads {
+		c, err := startHandshake(dial, serverName, robotCipherSuites)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			responses = append(responses, "no handshake")
+			continue
+		}
+		body := append([]byte{16, 0, byte((len(payload) + 2) >> 8), byte(len(payload) + 2), byte(len(payload) >> 8), byte(len(payload))}, payload...)
+		data := encodeRecord(recordHandshake, c.version, body)
+		if flight {
+			data = append(data, encodeRecord(recordChangeCipherSpec, c.version, []byte{1})...)
+			data = append(data, encodeRecord(recordHandshake, c.version, make([]byte, 64))...)
+		}
+		c.SetDeadline(time.Now().Add(vulnCheckTimeout))
+		c.Write(data)
+		var answer []string
+		for len(answer) < 3 {
+			typ, body, err := readRecord(c)
+			if err != nil {
+				answer = append(answer, connectionState(err))
+				break
+			}
+			answer = append(answer, describeRecord(typ, body))
+		}
+		c.Close()
+		responses = append(responses, strings.Join(answer, ", "))
+	}
+	return responses, nil
+}
+
+// sameResponses returns true if the responses are identical.
+func sameResponses(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkROBOT sends well formed and malformed premaster secrets, with and
+// without the rest of the client's flight, and reports an oracle if the
+// server answers them differently, consistently over two rounds.
+func checkROBOT(dial func() (net.Conn, error), serverName string) *TLSVulnCheck {
+	c, err := startHandshake(dial, serverName, robotCipherSuites)
+	if err != nil {
+		return &TLSVulnCheck{Error: err.Error()}
+	}
+	if c == nil {
+		return &TLSVulnCheck{Verdict: VulnNotApplicable, Detail: "no RSA key exchange"}
+	}
+	key, err := serverRSAKey(c.hello.certificateMsg)
+	c.Close()
+	if err != nil {
+		return &TLSVulnCheck{Verdict: VulnInconclusive, Detail: err.Error()}
+	}
+	payloads := robotPayloads(key, c.offered)
+	var responses []string
+	for _, flight := range []bool{true, false} {
+		if responses, err = robotResponses(dial, serverName, payloads, flight); err != nil {
+			return &TLSVulnCheck{Error: err.Error()}
+		}
+		differ := false
+		for _, r := range responses[1:] {
+			differ = differ || r != responses[0]
+		}
+		if !differ {
+			continue
+		}
+		again, err := robotResponses(dial, serverName, payloads, flight)
+		if err != nil {
+			return &TLSVulnCheck{Error: err.Error()}
+		}
+		detail := strings.Join(responses, "; ")
+		if !sameResponses(responses, again) {
+			return &TLSVulnCheck{Verdict: VulnInconclusive, Detail: "inconsistent responses: " + detail}
+		}
+		return &TLSVulnCheck{Verdict: VulnVulnerable, Detail: detail}
+	}
+	return &TLSVulnCheck{Verdict: VulnNotVulnerable, Detail: responses[0]}
+}
+
+// checkVulnerabilities runs the checks of --tls-vuln-checks.
+func checkVulnerabilities(dial func() (net.Conn, error), serverName string) *TLSVulnChecks {
+	return &TLSVulnChecks{
+		Heartbleed:   checkHeartbleed(dial, serverName),
+		ROBOT:        checkROBOT(dial, serverName),
+		CCSInjection: checkCCSInjection(dial, serverName),
+	}
+}
@@ -0,0 +1,155 @@
+package zgrab2
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	gotls "crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// serveFlight runs a fake TLS 1.2 server answering each ClientHello with the
+// handshake messages, then calls handle on the connection.
+func serveFlight(t *testing.T, messages []byte, handle func(conn net.Conn)) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, _, err := readRecord(conn); err != nil {
+					return
+				}
+				conn.Write(encodeRecord(recordHandshake, 0x0303, messages))
+				handle(conn)
+			}()
+		}
+	}()
+	return listener
+}
+
+// dialer returns a function opening connections to listener.
+func dialer(addr net.Addr) func() (net.Conn, error) {
+	return func() (net.Conn, error) {
+		return net.Dial("tcp", addr.String())
+	}
+}
+
+// goTLSServer runs a crypto/tls server up to TLS 1.2.
+func goTLSServer(suites []uint16) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.TLS = &gotls.Config{MaxVersion: gotls.VersionTLS12, CipherSuites: suites}
+	server.StartTLS()
+	return server
+}
+
+var serverHelloDone = []byte{14, 0, 0, 0}
+
+func TestCheckHeartbleed(t *testing.T) {
+	flight := append(serverHello(0x0303, 0xc02f, extensionHeartbeat), serverHelloDone...)
+	vulnerable := serveFlight(t, flight, func(conn net.Conn) {
+		if typ, _, err := readRecord(conn); err == nil && typ == recordHeartbeat {
+			conn.Write(encodeRecord(recordHeartbeat, 0x0303, make([]byte, 3+0x4000+16)))
+		}
+	})
+	defer vulnerable.Close()
+	if c := checkHeartbleed(dialer(vulnerable.Addr()), ""); c.Verdict != VulnVulnerable {
+		t.Errorf("got %+v", c)
+	}
+
+	server := goTLSServer(nil)
+	defer server.Close()
+	if c := checkHeartbleed(dialer(server.Listener.Addr()), ""); c.Verdict != VulnNotApplicable {
+		t.Errorf("got %+v from crypto/tls", c)
+	}
+}
+
+func TestCheckCCSInjection(t *testing.T) {
+	defer func(timeout time.Duration) { vulnCheckTimeout = timeout }(vulnCheckTimeout)
+	vulnCheckTimeout = 500 * time.Millisecond
+	flight := append(serverHello(0x0303, 0xc02f), serverHelloDone...)
+	vulnerable := serveFlight(t, flight, func(conn net.Conn) {
+		readRecord(conn)
+		if _, _, err := readRecord(conn); err == nil {
+			conn.Write(encodeRecord(recordAlert, 0x0303, []byte{2, 20}))
+		}
+	})
+	defer vulnerable.Close()
+	if c := checkCCSInjection(dialer(vulnerable.Addr()), ""); c.Verdict != VulnVulnerable {
+		t.Errorf("got %+v", c)
+	}
+
+	server := goTLSServer(nil)
+	defer server.Close()
+	if c := checkCCSInjection(dialer(server.Listener.Addr()), ""); c.Verdict != VulnNotVulnerable {
+		t.Errorf("got %+v from crypto/tls", c)
+	}
+}
+
+func TestCheckROBOT(t *testing.T) {
+	defer func(timeout time.Duration) { vulnCheckTimeout = timeout }(vulnCheckTimeout)
+	vulnCheckTimeout = 500 * time.Millisecond
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate := []byte{11, 0, 0, 0, 0, 0, 0, byte(len(der) >> 16), byte(len(der) >> 8), byte(len(der))}
+	certificate[1], certificate[2], certificate[3] = byte((len(der)+6)>>16), byte((len(der)+6)>>8), byte(len(der)+6)
+	certificate[4], certificate[5], certificate[6] = byte((len(der)+3)>>16), byte((len(der)+3)>>8), byte(len(der)+3)
+	certificate = append(certificate, der...)
+	flight := append(append(serverHello(0x0303, 0x002f), certificate...), serverHelloDone...)
+
+	// An oracle telling apart the premaster secrets starting with 0x00 0x02.
+	oracle := serveFlight(t, flight, func(conn net.Conn) {
+		_, body, err := readRecord(conn)
+		if err != nil || len(body) < 6 {
+			return
+		}
+		m := new(big.Int).Exp(new(big.Int).SetBytes(body[6:]), key.D, key.N)
+		if len(m.Bytes()) == key.Size()-1 && m.Bytes()[0] == 2 {
+			conn.Write(encodeRecord(recordAlert, 0x0303, []byte{2, 20}))
+		} else {
+			conn.Write(encodeRecord(recordAlert, 0x0303, []byte{2, 51}))
+		}
+	})
+	defer oracle.Close()
+	if c := checkROBOT(dialer(oracle.Addr()), ""); c.Verdict != VulnVulnerable {
+		t.Errorf("got %+v", c)
+	}
+
+	server := goTLSServer([]uint16{gotls.TLS_RSA_WITH_AES_128_CBC_SHA})
+	defer server.Close()
+	if c := checkROBOT(dialer(server.Listener.Addr()), ""); c.Verdict != VulnNotVulnerable {
+		t.Errorf("got %+v from crypto/tls", c)
+	}
+	ecdhe := goTLSServer([]uint16{gotls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256})
+	defer ecdhe.Close()
+	if c := checkROBOT(dialer(ecdhe.Listener.Addr()), ""); c.Verdict != VulnNotApplicable {
+		t.Errorf("got %+v without RSA key exchange", c)
+	}
+}
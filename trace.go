@@ -0,0 +1,155 @@
+package zgrab2
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// TraceEvent is a single timestamped event on a traced connection.
+type TraceEvent struct {
+	// Time is the time at which the event occurred, in RFC3339Nano format.
+	Time string `json:"time"`
+
+	// Connection is the index of the connection (in the order it was opened
+	// during the scan) on which the event occurred.
+	Connection int `json:"connection"`
+
+	// Event is one of "open", "read", "write" or "close".
+	Event string `json:"event"`
+
+	// Remote is the remote address of the connection (set on "open").
+	Remote string `json:"remote,omitempty"`
+
+	// Data is the hex-encoded data that was sent or received.
+	Data string `json:"data,omitempty"`
+
+	// Truncated is set if Data was cut short by the trace size limit.
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Error is the error returned by the operation, if any.
+	Error string `json:"error,omitempty"`
+
+	// network and local are the network and local address of the
+	// connection (set on "open"), used for packet captures.
+	network string
+	local   string
+}
+
+// Trace records the bytes sent and received on all connections opened during
+// a single scan.
+type Trace struct {
+	mu       sync.Mutex
+	events   []TraceEvent
+	conns    int
+	maxBytes int
+	bytes    int
+}
+
+// NewTrace returns an empty Trace that keeps at most maxBytes bytes of
+// connection data (0 = unlimited).
+func NewTrace(maxBytes int) *Trace {
+	return &Trace{maxBytes: maxBytes}
+}
+
+// Events returns the events recorded so far.
+func (t *Trace) Events() []TraceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TraceEvent(nil), t.events...)
+}
+
+func (t *Trace) add(conn int, event string, data []byte, err error) {
+	t.addEvent(TraceEvent{Connection: conn, Event: event}, data, err)
+}
+
+func (t *Trace) addEvent(ev TraceEvent, data []byte, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ev.Time = time.Now().Format(time.RFC3339Nano)
+	if len(data) > 0 {
+		if t.maxBytes > 0 && t.bytes+len(data) > t.maxBytes {
+			data = data[:t.maxBytes-t.bytes]
+			ev.Truncated = true
+		}
+		t.bytes += len(data)
+		ev.Data = hex.EncodeToString(data)
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	t.events = append(t.events, ev)
+}
+
+// Wrap returns a net.Conn that records all traffic on conn in the trace.
+func (t *Trace) Wrap(conn net.Conn) net.Conn {
+	t.mu.Lock()
+	id := t.conns
+	t.conns++
+	t.mu.Unlock()
+	ev := TraceEvent{Connection: id, Event: "open"}
+	if remote := conn.RemoteAddr(); remote != nil {
+		ev.Remote = remote.String()
+	}
+	if local := conn.LocalAddr(); local != nil {
+		ev.network, ev.local = local.Network(), local.String()
+	}
+	t.addEvent(ev, nil, nil)
+	return &tracedConn{Conn: conn, trace: t, id: id}
+}
+
+// tracedConn wraps a net.Conn, recording all reads and writes in a Trace.
+type tracedConn struct {
+	net.Conn
+	trace *Trace
+	id    int
+}
+
+func (c *tracedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 || (err != nil && !IsTimeoutError(err)) {
+		c.trace.add(c.id, "read", b[:n], err)
+	}
+	return n, err
+}
+
+func (c *tracedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.trace.add(c.id, "write", b[:n], err)
+	return n, err
+}
+
+func (c *tracedConn) Close() error {
+	err := c.Conn.Close()
+	c.trace.add(c.id, "close", nil, err)
+	return err
+}
+
+// TraceConn wraps conn so that its traffic is recorded in the scan result if
+// wire tracing is enabled for this target. If conn is a TimeoutConnection, the
+// underlying connection is wrapped instead, so that callers relying on the
+// concrete type are unaffected. Modules that dial connections themselves
+// (rather than through ScanTarget.Open) should use this.
+func (target *ScanTarget) TraceConn(conn net.Conn) net.Conn {
+	if target.trace == nil || conn == nil {
+		return conn
+	}
+	if tc, ok := conn.(*TimeoutConnection); ok {
+		tc.Conn = target.trace.Wrap(tc.Conn)
+		return tc
+	}
+	return target.trace.Wrap(conn)
+}
+
+// shouldTrace decides whether wire tracing is enabled for the given target.
+func (config *Config) shouldTrace(target *ScanTarget) bool {
+	if !config.Trace {
+		return false
+	}
+	if config.traceFilter != nil && !config.traceFilter.MatchString(target.String()) {
+		return false
+	}
+	return config.TraceSample >= 1 || rand.Float64() < config.TraceSample
+}
@@ -0,0 +1,57 @@
+package zgrab2
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTraceConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	target := ScanTarget{trace: NewTrace(6)}
+	conn := target.TraceConn(NewTimeoutConnection(nil, client, time.Second, 0, 0, 0))
+	if _, ok := conn.(*TimeoutConnection); !ok {
+		t.Fatalf("expected TraceConn to preserve *TimeoutConnection, got %T", conn)
+	}
+
+	go func() {
+		buf := make([]byte, 4)
+		server.Read(buf)
+		server.Write([]byte("pong"))
+	}()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	conn.Close()
+
+	events := target.trace.Events()
+	expected := []struct {
+		event     string
+		data      string
+		truncated bool
+	}{
+		{"open", "", false},
+		{"write", "ping", false},
+		{"read", "po", true},
+		{"close", "", false},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+	for i, exp := range expected {
+		ev := events[i]
+		if ev.Event != exp.event || ev.Data != hex.EncodeToString([]byte(exp.data)) || ev.Truncated != exp.truncated {
+			t.Errorf("event %d: expected %+v, got %+v", i, exp, ev)
+		}
+		if ev.Connection != 0 {
+			t.Errorf("event %d: expected connection 0, got %d", i, ev.Connection)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package zgrab2
 
 import (
+	"context"
 	"errors"
 	"net"
 	"regexp"
@@ -57,22 +58,62 @@ func ParseCommandLine(flags []string) ([]string, string, ScanFlags, error) {
 	return posArgs, moduleType, sf, err
 }
 
-// ReadAvaiable reads what it can without blocking for more than
-// defaultReadTimeout per read, or defaultTotalTimeout for the whole session.
-// Reads at most defaultMaxReadSize bytes.
-func ReadAvailable(conn net.Conn) ([]byte, error) {
-	const defaultReadTimeout = 10 * time.Millisecond
-	const defaultMaxReadSize = 1024 * 512
+// MaxResponseSize returns the maximum number of bytes of a response to read
+// in the scans run with ctx, e.g. by the HTTP modules (see
+// --max-response-size), or 0 if there is none.
+func MaxResponseSize(ctx context.Context) int {
+	return configFrom(ctx).MaxResponseSize
+}
+
+// responseSizeLimiter is implemented by the connections opened for a scan,
+// which know the --max-response-size of the Engine running it.
+type responseSizeLimiter interface {
+	maxResponseSize() int
+}
+
+// connMaxResponseSize returns the maximum response size of conn, or that of
+// the command line if conn was not opened for a scan.
+func connMaxResponseSize(conn net.Conn) int {
+	if limiter, ok := conn.(responseSizeLimiter); ok {
+		return limiter.maxResponseSize()
+	}
+	return config.MaxResponseSize
+}
+
+// limitResponseSize returns size, or the maximum response size of conn if it
+// is set and smaller.
+func limitResponseSize(conn net.Conn, size int) int {
+	if max := connMaxResponseSize(conn); max > 0 && size > max {
+		return max
+	}
+	return size
+}
+
+// The options of ReadAvailable.
+const (
+	defaultReadTimeout = 10 * time.Millisecond
+	defaultMaxReadSize = 1024 * 512
 	// if the buffer size exactly matches the number of bytes returned, we hit
 	// a corner case where we attempt to read even though there is nothing
 	// available. Otherwise we should be able to return without blocking at all.
 	// So -- it's better to be large than small, but the worst case is getting
 	// the exact right number of bytes.
-	const defaultBufferSize = 8209
+	defaultBufferSize = 8209
+)
 
+// ReadAvaiable reads what it can without blocking for more than
+// defaultReadTimeout per read, or defaultTotalTimeout for the whole session.
+// Reads at most defaultMaxReadSize bytes.
+func ReadAvailable(conn net.Conn) ([]byte, error) {
 	return ReadAvailableWithOptions(conn, defaultBufferSize, defaultReadTimeout, 0, defaultMaxReadSize)
 }
 
+// ReadAvailableTruncated is like ReadAvailable, but also returns true if more
+// data was available past the size limit.
+func ReadAvailableTruncated(conn net.Conn) ([]byte, bool, error) {
+	return ReadAvailableTruncatedWithOptions(conn, defaultBufferSize, defaultReadTimeout, 0, defaultMaxReadSize)
+}
+
 // Make this implement the net.Error interface so that err.(net.Error).Timeout() works.
 type errTotalTimeout string
 
@@ -92,12 +133,31 @@ func (err errTotalTimeout) Temporary() bool {
 	return false
 }
 
-// ReadAvailableWithOptions reads whatever can be read (up to maxReadSize) from
-// conn without blocking for longer than readTimeout per read, or totalTimeout
-// for the entire session. A totalTimeout of 0 means attempt to use the
-// connection's timeout (or, failing that, 1 second).
+// ReadAvailableWithOptions reads whatever can be read (up to maxReadSize, or
+// MaxResponseSize if smaller) from conn without blocking for longer than
+// readTimeout per read, or totalTimeout for the entire session. A totalTimeout
+// of 0 means attempt to use the connection's timeout (or, failing that, 1
+// second).
 // On failure, returns anything it was able to read along with the error.
 func ReadAvailableWithOptions(conn net.Conn, bufferSize int, readTimeout time.Duration, totalTimeout time.Duration, maxReadSize int) ([]byte, error) {
+	return readAvailable(conn, bufferSize, readTimeout, totalTimeout, limitResponseSize(conn, maxReadSize))
+}
+
+// ReadAvailableTruncatedWithOptions is like ReadAvailableWithOptions, but also
+// returns true if more data was available past the size limit. To find out, it
+// reads one more byte, which is discarded.
+func ReadAvailableTruncatedWithOptions(conn net.Conn, bufferSize int, readTimeout time.Duration, totalTimeout time.Duration, maxReadSize int) ([]byte, bool, error) {
+	maxReadSize = limitResponseSize(conn, maxReadSize)
+	ret, err := readAvailable(conn, bufferSize, readTimeout, totalTimeout, maxReadSize+1)
+	if len(ret) > maxReadSize {
+		return ret[:maxReadSize], true, err
+	}
+	return ret, false, err
+}
+
+// readAvailable implements ReadAvailableWithOptions, without applying
+// MaxResponseSize.
+func readAvailable(conn net.Conn, bufferSize int, readTimeout time.Duration, totalTimeout time.Duration, maxReadSize int) ([]byte, error) {
 	min := func(a, b int) int {
 		if a < b {
 			return a
@@ -0,0 +1,41 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadAvailableTruncated(t *testing.T) {
+	for _, test := range []struct {
+		sent      int
+		max       int
+		limit     int
+		read      int
+		truncated bool
+	}{
+		{sent: 100, max: 10, read: 10, truncated: true},
+		{sent: 10, max: 10, read: 10},
+		{sent: 100, max: 1000, read: 100},
+		{sent: 100, max: 1000, limit: 20, read: 20, truncated: true},
+	} {
+		client, server := net.Pipe()
+		go func() {
+			server.Write([]byte(strings.Repeat("x", test.sent)))
+		}()
+		// The limit is that of the Engine the connection is opened for.
+		ctx := withConfig(context.Background(), &Config{MaxResponseSize: test.limit})
+		conn := NewTimeoutConnection(ctx, client, time.Second, 0, 0, 0)
+		read, truncated, err := ReadAvailableTruncatedWithOptions(conn, 64, 50*time.Millisecond, time.Second, test.max)
+		if err != nil {
+			t.Errorf("%+v: %v", test, err)
+		}
+		if len(read) != test.read || truncated != test.truncated {
+			t.Errorf("%+v: read %d bytes, truncated %v", test, len(read), truncated)
+		}
+		conn.Close()
+		server.Close()
+	}
+}
@@ -4,6 +4,7 @@ from . import dnp3
 from . import fox
 from . import ftp
 from . import http
+from . import http3
 from . import modbus
 from . import mongodb
 from . import mssql
@@ -22,3 +23,36 @@ from . import telnet
 from . import ipp
 from . import banner
 from . import checkpoint
+from . import identify
+from . import probe
+from . import dns
+from . import snmp
+from . import ldap
+from . import rdp
+from . import vnc
+from . import mqtt
+from . import amqp
+from . import memcached
+from . import elasticsearch
+from . import docker
+from . import k8s
+from . import etcd
+from . import zookeeper
+from . import rsync
+from . import git
+from . import sip
+from . import nfs
+from . import winrm
+from . import ipmi
+from . import adb
+from . import epmd
+from . import openvpn
+from . import ike
+from . import wireguard
+from . import ssdp
+from . import mdns
+from . import x11
+from . import grpc
+from . import enip
+from . import pndcp
+from . import jarm
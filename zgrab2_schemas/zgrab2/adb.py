@@ -0,0 +1,32 @@
+# zschema sub-schema for zgrab2's adb module
+# Registers zgrab2-adb globally, and adb with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/adb/scanner.go - Results
+adb_scan_response = SubRecord({
+    "result": SubRecord({
+        "command": String(examples=["CNXN", "AUTH", "STLS"]),
+        "unauthenticated": Boolean(doc="True if the device accepted the connection without authentication."),
+        "auth_required": Boolean(),
+        "tls_required": Boolean(),
+        "version": Unsigned32BitInteger(),
+        "max_data": Unsigned32BitInteger(),
+        "banner": String(),
+        "system_type": String(examples=["device", "bootloader", "recovery", "sideload"]),
+        # This is an unconstrained map[string]string of the banner properties.
+        "properties": WhitespaceAnalyzedString(),
+        "product_name": String(),
+        "product_model": String(),
+        "product_device": String(),
+        "android_version": String(),
+        "features": ListOf(String()),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-adb", adb_scan_response)
+
+zgrab2.register_scan_response_type("adb", adb_scan_response)
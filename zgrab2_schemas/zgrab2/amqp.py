@@ -0,0 +1,36 @@
+# zschema sub-schema for zgrab2's amqp module
+# Registers zgrab2-amqp globally, and amqp with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/amqp/scanner.go - ServerProperties
+amqp_server_properties = SubRecord({
+    "product": String(examples=["RabbitMQ", "ActiveMQ", "apache-activemq-artemis"]),
+    "version": String(examples=["3.12.2"]),
+    "platform": String(examples=["Erlang/OTP 25.3", "Java"]),
+    "copyright": String(),
+    "information": String(),
+    "cluster_name": String(),
+    "capabilities": ListOf(String(), doc="The capabilities enabled (0-9-1) or offered (1.0)."),
+})
+
+# modules/amqp/scanner.go - Results
+amqp_scan_response = SubRecord({
+    "result": SubRecord({
+        "protocol": Enum(values=["0-9-1", "1.0"], doc="The AMQP version spoken with the server."),
+        "server_version": String(doc="The protocol version of Connection.Start (0-9-1).", examples=["0-9"]),
+        "server_properties": amqp_server_properties,
+        "mechanisms": ListOf(String(), doc="The SASL mechanisms offered."),
+        "locales": ListOf(String(), doc="The locales of Connection.Start (0-9-1)."),
+        "sasl_outcome": Enum(values=["ok", "auth", "sys", "sys-perm", "sys-temp"], doc="The outcome of the ANONYMOUS authentication (1.0)."),
+        "container_id": String(doc="The container ID of the open performative (1.0)."),
+        "tls": zgrab2.tls_log,
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-amqp", amqp_scan_response)
+
+zgrab2.register_scan_response_type("amqp", amqp_scan_response)
@@ -0,0 +1,66 @@
+# zschema sub-schema for zgrab2's dns module
+# Registers zgrab2-dns globally, and dns with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/dns/message.go - Record
+dns_record = SubRecord({
+    "name": String(doc="The owner name of the record."),
+    "type": String(doc="The type of the record, as a mnemonic or TYPE<n>.", examples=["A", "MX", "TYPE99"]),
+    "class": Unsigned16BitInteger(doc="The class of the record."),
+    "ttl": Unsigned32BitInteger(doc="The time to live of the record, in seconds."),
+    "data": String(doc="The data of the record in presentation format, if its type is decoded.", examples=["192.0.2.1", "10 mail.example.com."]),
+})
+
+dns_question = SubRecord({
+    "name": String(doc="The queried name."),
+    "type": String(doc="The queried type."),
+})
+
+# modules/dns/scanner.go - Results
+dns_scan_response = SubRecord({
+    "result": SubRecord({
+        "transport": String(doc="The transport the query was sent over.", examples=["udp", "tcp", "tls", "https"]),
+        "query": SubRecord({
+            "name": String(doc="The queried name."),
+            "type": String(doc="The queried type."),
+            "recursion_desired": Boolean(doc="True if the RD bit was set."),
+            "edns": Boolean(doc="True if an EDNS(0) OPT record was added."),
+        }),
+        "response": SubRecord({
+            "id": Unsigned16BitInteger(),
+            "opcode": Unsigned8BitInteger(),
+            "rcode": String(doc="The response code, including its extended bits.", examples=["NOERROR", "NXDOMAIN", "REFUSED"]),
+            "flags": SubRecord({
+                "authoritative": Boolean(),
+                "truncated": Boolean(),
+                "recursion_desired": Boolean(),
+                "recursion_available": Boolean(),
+                "authentic_data": Boolean(),
+                "checking_disabled": Boolean(),
+            }),
+            "questions": ListOf(dns_question),
+            "answers": ListOf(dns_record),
+            "authorities": ListOf(dns_record),
+            "additionals": ListOf(dns_record),
+            "edns": SubRecord({
+                "version": Unsigned8BitInteger(),
+                "udp_size": Unsigned16BitInteger(),
+                "dnssec_ok": Boolean(),
+                "nsid": String(doc="The name server identifier."),
+                "options": ListOf(Unsigned16BitInteger(), doc="The codes of the EDNS options returned."),
+            }),
+        }),
+        "raw_response": Binary(doc="The response as received."),
+        "open_resolver": Boolean(doc="True if the server answered a recursive query with records for which it is not authoritative."),
+        "http_status": Unsigned16BitInteger(doc="The HTTP status code of the DNS over HTTPS response."),
+        "tls": zgrab2.tls_log,
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-dns", dns_scan_response)
+
+zgrab2.register_scan_response_type("dns", dns_scan_response)
@@ -0,0 +1,55 @@
+# zschema sub-schema for zgrab2's docker module
+# Registers zgrab2-docker globally, and docker with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/docker/scanner.go - Results
+docker_scan_response = SubRecord({
+    "result": SubRecord({
+        "unauthenticated": Boolean(doc="True if the daemon returned its version without credentials."),
+        "auth_required": Boolean(doc="True if the request was refused, as by an authorization plugin."),
+        "client_certificate_required": Boolean(doc="True if the TLS handshake failed for lack of a client certificate."),
+        "tls_required": Boolean(doc="True if the daemon refused a plain HTTP request."),
+        "status_code": Unsigned16BitInteger(doc="The status code of the response to /version."),
+        "version": SubRecord({
+            "version": String(examples=["24.0.5"]),
+            "api_version": String(examples=["1.43"]),
+            "min_api_version": String(),
+            "git_commit": String(),
+            "go_version": String(),
+            "os": String(),
+            "arch": String(),
+            "kernel_version": String(),
+            "build_time": String(),
+            "platform": String(examples=["Docker Engine - Community"]),
+        }),
+        "info": SubRecord({
+            "id": String(),
+            "name": String(doc="The host name of the daemon."),
+            "server_version": String(),
+            "operating_system": String(),
+            "os_type": String(),
+            "architecture": String(),
+            "kernel_version": String(),
+            "containers": Unsigned32BitInteger(),
+            "containers_running": Unsigned32BitInteger(),
+            "containers_paused": Unsigned32BitInteger(),
+            "containers_stopped": Unsigned32BitInteger(),
+            "images": Unsigned32BitInteger(),
+            "driver": String(),
+            "ncpu": Unsigned32BitInteger(),
+            "mem_total": Unsigned64BitInteger(),
+            "docker_root_dir": String(),
+            "swarm_state": String(examples=["inactive", "active"]),
+            "security_options": ListOf(String()),
+        }),
+        "tls": zgrab2.tls_log,
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-docker", docker_scan_response)
+
+zgrab2.register_scan_response_type("docker", docker_scan_response)
@@ -0,0 +1,59 @@
+# zschema sub-schema for zgrab2's elasticsearch module
+# Registers zgrab2-elasticsearch globally, and elasticsearch with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/elasticsearch/scanner.go - Results
+elasticsearch_scan_response = SubRecord({
+    "result": SubRecord({
+        "unauthenticated": Boolean(doc="True if the root endpoint returned the cluster details without credentials."),
+        "auth_required": Boolean(doc="True if the first request was refused with a 401 or 403."),
+        "name": String(doc="The name of the node."),
+        "cluster_name": String(),
+        "cluster_uuid": String(),
+        "version": SubRecord({
+            "number": String(examples=["7.17.9", "2.11.0"]),
+            "distribution": String(doc="The distribution, for OpenSearch.", examples=["opensearch"]),
+            "build_flavor": String(),
+            "build_type": String(),
+            "build_hash": String(),
+            "build_date": String(),
+            "lucene_version": String(),
+            "minimum_wire_compatibility_version": String(),
+            "minimum_index_compatibility_version": String(),
+        }),
+        "tagline": String(),
+        "health": SubRecord({
+            "status": Enum(values=["green", "yellow", "red"]),
+            "timed_out": Boolean(),
+            "number_of_nodes": Unsigned32BitInteger(),
+            "number_of_data_nodes": Unsigned32BitInteger(),
+            "active_primary_shards": Unsigned32BitInteger(),
+            "active_shards": Unsigned32BitInteger(),
+            "unassigned_shards": Unsigned32BitInteger(),
+        }),
+        "index_count": Unsigned32BitInteger(doc="The number of indices listed."),
+        "indices": ListOf(SubRecord({
+            "index": String(),
+            "health": String(),
+            "status": String(),
+            "uuid": String(),
+            "docs.count": String(),
+            "store.size": String(),
+        }), doc="The first indices listed, up to --max-indices."),
+        "endpoints": ListOf(SubRecord({
+            "path": String(),
+            "status_code": Unsigned16BitInteger(),
+            "error": String(),
+            "body": String(doc="The body of the response to an endpoint which is not parsed."),
+        })),
+        "tls": zgrab2.tls_log,
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-elasticsearch", elasticsearch_scan_response)
+
+zgrab2.register_scan_response_type("elasticsearch", elasticsearch_scan_response)
@@ -0,0 +1,44 @@
+# zschema sub-schema for zgrab2's enip module
+# Registers zgrab2-enip globally, and enip with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+enip_identity = SubRecord({
+    "encapsulation_version": Unsigned16BitInteger(),
+    "socket_address": String(doc="The address configured on the device, often a private address."),
+    "socket_port": Unsigned16BitInteger(),
+    "vendor_id": Unsigned16BitInteger(),
+    "device_type": Unsigned16BitInteger(),
+    "device_type_name": String(examples=["Programmable Logic Controller", "Communications Adapter"]),
+    "product_code": Unsigned16BitInteger(),
+    "revision": String(examples=["20.11"]),
+    "status": Unsigned16BitInteger(),
+    "serial_number": String(examples=["0x00c0ffee"]),
+    "product_name": WhitespaceAnalyzedString(examples=["1756-L61/B LOGIX5561"]),
+    "state": Unsigned8BitInteger(),
+})
+
+enip_service = SubRecord({
+    "name": String(examples=["Communications"]),
+    "version": Unsigned16BitInteger(),
+    "capabilities": Unsigned16BitInteger(),
+    "tcp": Boolean(),
+    "udp": Boolean(),
+})
+
+# modules/enip/scanner.go - Results
+enip_scan_response = SubRecord({
+    "result": SubRecord({
+        "transport": String(examples=["tcp", "udp"]),
+        "encapsulation_status": Unsigned32BitInteger(),
+        "identity": enip_identity,
+        "services": ListOf(enip_service),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-enip", enip_scan_response)
+
+zgrab2.register_scan_response_type("enip", enip_scan_response)
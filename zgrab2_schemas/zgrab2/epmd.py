@@ -0,0 +1,29 @@
+# zschema sub-schema for zgrab2's epmd module
+# Registers zgrab2-epmd globally, and epmd with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/epmd/scanner.go - Results
+epmd_scan_response = SubRecord({
+    "result": SubRecord({
+        "epmd_port": Unsigned32BitInteger(),
+        "nodes": ListOf(SubRecord({
+            "name": String(examples=["rabbit", "couchdb", "ejabberd"]),
+            "port": Unsigned16BitInteger(),
+            "status": String(examples=["ok", "nok", "not_allowed", "alive"]),
+            "node_name": String(doc="The full name of the node, from its challenge."),
+            "version": Unsigned16BitInteger(),
+            "flags": Unsigned64BitInteger(),
+            "flag_names": ListOf(String()),
+            "creation": Unsigned32BitInteger(),
+            "error": String(),
+        })),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-epmd", epmd_scan_response)
+
+zgrab2.register_scan_response_type("epmd", epmd_scan_response)
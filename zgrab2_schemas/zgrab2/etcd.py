@@ -0,0 +1,41 @@
+# zschema sub-schema for zgrab2's etcd module
+# Registers zgrab2-etcd globally, and etcd with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/etcd/scanner.go - Results
+etcd_scan_response = SubRecord({
+    "result": SubRecord({
+        "server_version": String(examples=["3.5.9"]),
+        "cluster_version": String(examples=["3.5.0"]),
+        "cluster_id": String(doc="The cluster ID, in hexadecimal."),
+        "member_id": String(doc="The ID of the scanned member, in hexadecimal."),
+        "leader": String(doc="The ID of the leader, in hexadecimal."),
+        "db_size": Signed64BitInteger(),
+        "raft_term": Unsigned64BitInteger(),
+        "is_learner": Boolean(),
+        "members": ListOf(SubRecord({
+            "id": String(),
+            "name": String(),
+            "peer_urls": ListOf(String()),
+            "client_urls": ListOf(String()),
+            "is_learner": Boolean(),
+        })),
+        "auth_enabled": Boolean(doc="True if authentication is enabled; absent if unknown."),
+        "unauthenticated": Boolean(doc="True if the keys were counted without credentials."),
+        "key_count": Signed64BitInteger(),
+        "endpoints": ListOf(SubRecord({
+            "path": String(),
+            "status_code": Unsigned16BitInteger(),
+            "error": String(),
+        })),
+        "tls": zgrab2.tls_log,
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-etcd", etcd_scan_response)
+
+zgrab2.register_scan_response_type("etcd", etcd_scan_response)
@@ -14,6 +14,25 @@ ftp_scan_response = SubRecord({
         "banner": String(),
         "auth_tls": String(),
         "auth_ssl": String(),
+        "implicit_tls": Boolean(),
+        "login": SubRecord({
+            "username": String(),
+            "user": String(),
+            "pass": String(),
+            "success": Boolean(),
+        }),
+        "feat": String(),
+        "features": ListOf(String()),
+        "syst": String(),
+        "pwd": String(),
+        "list": SubRecord({
+            "passive": String(),
+            "list": String(),
+            "complete": String(),
+            "listing": String(),
+            "truncated": Boolean(),
+            "error": String(),
+        }),
     })
 }, extends=zgrab2.base_scan_response)
 
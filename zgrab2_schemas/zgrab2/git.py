@@ -0,0 +1,27 @@
+# zschema sub-schema for zgrab2's git module
+# Registers zgrab2-git globally, and git with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/git/scanner.go - Results
+git_scan_response = SubRecord({
+    "result": SubRecord({
+        "path": String(doc="The requested path."),
+        "error": String(doc="The error sent by the daemon.", examples=["access denied or repository not exported: /"]),
+        "ref_count": Unsigned32BitInteger(),
+        "refs": ListOf(SubRecord({
+            "name": String(examples=["HEAD", "refs/heads/main"]),
+            "object_id": String(),
+        })),
+        "capabilities": ListOf(String()),
+        "head": String(doc="The target of HEAD, when advertised."),
+        "agent": String(examples=["git/2.39.2"]),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-git", git_scan_response)
+
+zgrab2.register_scan_response_type("git", git_scan_response)
@@ -0,0 +1,54 @@
+# zschema sub-schema for zgrab2's grpc module
+# Registers zgrab2-grpc globally, and grpc with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+grpc_method = SubRecord({
+    "name": String(),
+    "input_type": String(),
+    "output_type": String(),
+    "client_streaming": Boolean(),
+    "server_streaming": Boolean(),
+})
+
+grpc_service = SubRecord({
+    "name": String(examples=["grpc.health.v1.Health"]),
+    "methods": ListOf(grpc_method),
+    "error": String(),
+})
+
+# modules/grpc/scanner.go - Results
+grpc_scan_response = SubRecord({
+    "result": SubRecord({
+        "settings": SubRecord({
+            "header_table_size": Unsigned32BitInteger(),
+            "enable_push": Unsigned32BitInteger(),
+            "max_concurrent_streams": Unsigned32BitInteger(),
+            "initial_window_size": Unsigned32BitInteger(),
+            "max_frame_size": Unsigned32BitInteger(),
+            "max_header_list_size": Unsigned32BitInteger(),
+            "enable_connect_protocol": Unsigned32BitInteger(),
+        }),
+        "status_code": Unsigned16BitInteger(),
+        "content_type": String(),
+        "grpc_status": String(examples=["OK", "UNIMPLEMENTED"]),
+        "grpc_message": String(),
+        "reflection": Boolean(),
+        "reflection_version": String(examples=["v1", "v1alpha"]),
+        "services": ListOf(grpc_service),
+        "reset_code": String(),
+        "goaway": SubRecord({
+            "last_stream_id": Unsigned32BitInteger(),
+            "error_code": String(),
+            "debug_data": String(),
+        }),
+        "tls": zgrab2.tls_log,
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-grpc", grpc_scan_response)
+
+zgrab2.register_scan_response_type("grpc", grpc_scan_response)
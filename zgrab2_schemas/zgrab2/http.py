@@ -146,6 +146,21 @@ http_request_full = SubRecord({
     "tls_log": zgrab2.tls_log
 })
 
+# lib/http/cookie.go: http.Cookie
+http_cookie = SubRecord({
+    "Name": String(),
+    "Value": String(),
+    "Path": String(),
+    "Domain": String(),
+    "Expires": DateTime(),
+    "RawExpires": String(),
+    "MaxAge": Signed32BitInteger(),
+    "Secure": Boolean(),
+    "HttpOnly": Boolean(),
+    "Raw": String(),
+    "Unparsed": ListOf(String()),
+})
+
 # lib/http/response.go: http.Response
 http_response_full = SubRecord({
     "status_line": String(),
@@ -162,17 +177,143 @@ http_response_full = SubRecord({
     "content_length": Signed64BitInteger(),
     "transfer_encoding": ListOf(String()),
     "trailers": http_headers,
+    "content_encoding": Enum(values=["gzip", "br", "zstd"], doc="The content encoding of the body, if it was decompressed (per --accept-encoding)."),
+    "decompressed_length": Signed64BitInteger(doc="The number of bytes of the body read after decompression."),
+    "truncated": Boolean(doc="True if the body was longer than the bytes read (see --max-size and --max-response-size)."),
+    "original_content_length": Signed64BitInteger(doc="The Content-Length sent by the server, if the body was truncated."),
+    # Only with --use-cookie-jar: the jar's cookies for the request's URL.
+    "cookie_jar": ListOf(http_cookie),
     "request": http_request_full
 })
 
-# modules/http.go: HTTPResults
-http_scan_response = SubRecord({
-    "result": SubRecord({
+# modules/http/scanner.go: Hop
+http_hop = SubRecord({
+    "url": String(),
+    "status_code": Signed32BitInteger(),
+    "headers": http_headers,
+    "tls_log": zgrab2.tls_log,
+})
+
+# modules/http/security.go: CSP
+http_csp = SubRecord({
+    "raw": String(),
+    "directives": ListOf(String()),
+    "unsafe_inline": Boolean(),
+    "unsafe_eval": Boolean(),
+})
+
+# modules/http/scanner.go: Results
+http_result_fields = {
         "connect_request": http_request,
         "connect_response": http_response,
         "response": http_response_full,
-        "redirect_response_chain": ListOf(http_response_full),
-    })
+        "hops": ListOf(http_hop, doc="Every response of the scan in order: the redirects, then the final response, whose headers and TLS log are those of the response."),
+        "favicon": SubRecord({
+            "url": String(),
+            "status_code": Signed32BitInteger(),
+            "size": Signed32BitInteger(),
+            "md5": String(),
+            "mmh3": Signed32BitInteger(doc="The MurmurHash3 of the base64-encoded favicon, as Shodan's http.favicon.hash."),
+            "error": String(),
+        }, doc="The favicon of the site, fetched with --fetch-favicon."),
+        "html": SubRecord({
+            "title": String(),
+            "generator": String(),
+            "charset": String(),
+            "login_forms": ListOf(SubRecord({
+                "action": String(),
+                "method": String(),
+                "fields": ListOf(String()),
+            })),
+            "script_hosts": ListOf(String()),
+        }, doc="The metadata extracted from the HTML of the final response, with --extract-html."),
+        "security_headers": SubRecord({
+            "hsts": SubRecord({
+                "raw": String(),
+                "valid": Boolean(),
+                "max_age": Signed64BitInteger(),
+                "include_subdomains": Boolean(),
+                "preload": Boolean(),
+            }),
+            "csp": http_csp,
+            "csp_report_only": http_csp,
+            "x_frame_options": String(),
+            "x_content_type_options": String(),
+            "x_xss_protection": String(),
+            "referrer_policy": String(),
+            "permissions_policy": String(),
+            "cross_origin_opener_policy": String(),
+            "cross_origin_embedder_policy": String(),
+            "cross_origin_resource_policy": String(),
+            "access_control_allow_origin": String(),
+            "access_control_allow_credentials": Boolean(),
+        }, doc="The analysis of the security headers of the final response, with --security-headers."),
+        "technologies": ListOf(SubRecord({
+            "name": String(),
+            "version": String(),
+            "confidence": Unsigned8BitInteger(),
+            "implied": Boolean(),
+        }), doc="The technologies detected with the --technologies-file rules."),
+        "technology_requests": ListOf(http_hop, doc="The responses to the requests sent for the technologies detected."),
+        "raw": SubRecord({
+            "request": String(),
+            "response": String(),
+            "tls_log": zgrab2.tls_log,
+        }, doc="The request sent from the --raw-request template and the raw response."),
+        "websocket": SubRecord({
+            "url": String(),
+            "status_code": Signed32BitInteger(),
+            "headers": http_headers,
+            "upgraded": Boolean(),
+            "accept_valid": Boolean(),
+            "subprotocol": String(),
+            "extensions": String(),
+            "first_frame": SubRecord({
+                "fin": Boolean(),
+                "opcode": Unsigned8BitInteger(),
+                "length": Unsigned32BitInteger(),
+                "payload": Binary(),
+            }),
+            "error": String(),
+        }, doc="The result of the WebSocket handshake, with --websocket."),
+        "tags": ListOf(String(), doc="The tags of the --match-rules rules that matched a response."),
+        "negotiate_mechanisms": ListOf(String(), doc="The mechanisms the server offered or accepted in its Negotiate (SPNEGO) challenges.", examples=[["ntlm"], ["kerberos", "ntlm"]]),
+        "credential": SubRecord({
+            "username": String(),
+            "password": String(),
+            "token": String(),
+        }, doc="The credential from the --creds-file that the server accepted."),
+        "auth": SubRecord({
+            "offered": ListOf(SubRecord({
+                "scheme": String(),
+                "realm": String(),
+                "algorithm": String(),
+            }), doc="The challenges of the first 401 or 407 response."),
+            "attempted": Boolean(),
+            "attempts": ListOf(SubRecord({
+                "scheme": String(),
+                "realm": String(),
+                "algorithm": String(),
+                "proxy": Boolean(),
+                "username": String(),
+                "status_code": Signed32BitInteger(),
+            })),
+            "status_code": Signed32BitInteger(),
+            "success": Boolean(),
+        }, doc="The authentication challenges of the server and the attempts to answer them with the --creds-file."),
+}
+
+# modules/http/vhost.go: VHostResult
+http_vhost = SubRecord({
+    "host": String(),
+    "status": Enum(values=zgrab2.STATUS_VALUES),
+    "error": String(),
+    "result": SubRecord(http_result_fields),
+})
+
+# modules/http.go: HTTPResults
+http_scan_response = SubRecord({
+    "result": SubRecord(dict(http_result_fields, vhosts=ListOf(http_vhost, doc="The results of the scans of the virtual hosts of the target, from the input or --vhost-file."))),
 }, extends=zgrab2.base_scan_response)
 
 zschema.registry.register_schema("zgrab2-http", http_scan_response)
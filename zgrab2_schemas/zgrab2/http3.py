@@ -0,0 +1,67 @@
+# zschema sub-schema for zgrab2's http3 module
+# Registers zgrab2-http3 globally, and http3 with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+from . import http
+
+http3_transport_parameters = SubRecord({
+    "original_destination_connection_id": Binary(),
+    "max_idle_timeout": Unsigned32BitInteger(),
+    "stateless_reset_token": Binary(),
+    "max_udp_payload_size": Unsigned32BitInteger(),
+    "initial_max_data": Unsigned32BitInteger(),
+    "initial_max_stream_data_bidi_local": Unsigned32BitInteger(),
+    "initial_max_stream_data_bidi_remote": Unsigned32BitInteger(),
+    "initial_max_stream_data_uni": Unsigned32BitInteger(),
+    "initial_max_streams_bidi": Unsigned32BitInteger(),
+    "initial_max_streams_uni": Unsigned32BitInteger(),
+    "ack_delay_exponent": Unsigned8BitInteger(),
+    "max_ack_delay": Unsigned16BitInteger(),
+    "disable_active_migration": Boolean(),
+    "preferred_address": Binary(),
+    "active_connection_id_limit": Unsigned32BitInteger(),
+    "initial_source_connection_id": Binary(),
+    "retry_source_connection_id": Binary(),
+    "unknown": ListOf(SubRecord({
+        "id": Unsigned32BitInteger(),
+        "value": Binary(),
+    })),
+})
+
+http3_scan_response = SubRecord({
+    "result": SubRecord({
+        "supported_versions": ListOf(String()),
+        "retry": Boolean(),
+        "cipher_suite": String(),
+        "handshake_complete": Boolean(),
+        "certificate_verified": Boolean(),
+        "alpn": String(),
+        "transport_parameters": http3_transport_parameters,
+        "certificates": ListOf(Binary()),
+        "settings": SubRecord({
+            "qpack_max_table_capacity": Unsigned32BitInteger(),
+            "max_field_section_size": Unsigned32BitInteger(),
+            "qpack_blocked_streams": Unsigned32BitInteger(),
+            "enable_connect_protocol": Unsigned32BitInteger(),
+            "h3_datagram": Unsigned32BitInteger(),
+        }),
+        "response": SubRecord({
+            "status_code": Unsigned16BitInteger(),
+            "headers": http.http_headers,
+            "body": String(),
+        }),
+        "connection_close": SubRecord({
+            "application": Boolean(),
+            "error_code": Unsigned32BitInteger(),
+            "frame_type": Unsigned32BitInteger(),
+            "reason": String(),
+        }),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-http3", http3_scan_response)
+
+zgrab2.register_scan_response_type("http3", http3_scan_response)
@@ -0,0 +1,28 @@
+# zschema sub-schema for zgrab2's identify module
+# Registers zgrab2-identify globally, and identify with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/identify/scanner.go - Results
+identify_scan_response = SubRecord({
+    "result": SubRecord({
+        "service": String(doc="The identified service, or \"unknown\".", examples=["ssh", "http", "tls", "unknown"]),
+        "probe": String(doc="The probe that identified the service.", examples=["banner", "tls", "http", "postgres"]),
+        "banner": String(doc="Whatever the server sent before receiving any data."),
+        "response": Binary(doc="The response to the probe that identified the service, when that was not the banner wait."),
+        "dispatch": SubRecord({
+            "module": String(doc="The module run for the identified service."),
+            "status": Enum(values=zgrab2.STATUS_VALUES, doc="The status of the module's scan."),
+            # The result's type depends on the module.
+            "result": SubRecord({}, required=False),
+            "error": String(doc="The error returned by the module's scan, if any."),
+        }, doc="The result of running the module matching the identified service, if --dispatch was given."),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-identify", identify_scan_response)
+
+zgrab2.register_scan_response_type("identify", identify_scan_response)
@@ -0,0 +1,43 @@
+# zschema sub-schema for zgrab2's ike module
+# Registers zgrab2-ike globally, and ike with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/ike/scanner.go - Results
+ike_scan_response = SubRecord({
+    "result": SubRecord({
+        "version": Unsigned8BitInteger(),
+        "exchange_type": String(examples=["identity_protection", "aggressive", "informational", "ike_sa_init"]),
+        "responder_spi": String(),
+        "payloads": ListOf(String()),
+        "transform": SubRecord({
+            "encryption": String(examples=["AES-CBC", "3DES-CBC", "AES-GCM-16"]),
+            "key_length": Unsigned16BitInteger(),
+            "hash": String(),
+            "prf": String(),
+            "integrity": String(),
+            "auth_method": String(examples=["PSK", "RSA-Signature"]),
+            "group": String(examples=["MODP-2048", "ECP-256"]),
+            "life_duration": Unsigned32BitInteger(),
+        }),
+        "vendor_ids": ListOf(SubRecord({
+            "id": String(),
+            "name": String(),
+        })),
+        "notifications": ListOf(SubRecord({
+            "type": Unsigned16BitInteger(),
+            "name": String(examples=["NO-PROPOSAL-CHOSEN", "INVALID_KE_PAYLOAD"]),
+            "data": String(),
+        })),
+        "nat_t": Boolean(doc="True if the response has a NAT traversal vendor ID or NAT detection payloads."),
+        "cookie": Boolean(),
+        "preferred_group": String(),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-ike", ike_scan_response)
+
+zgrab2.register_scan_response_type("ike", ike_scan_response)
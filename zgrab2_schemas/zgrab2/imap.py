@@ -7,10 +7,36 @@ import zschema.registry
 import zcrypto_schemas.zcrypto as zcrypto
 from . import zgrab2
 
+# modules/imap/auth.go - Capabilities
+imap_capabilities = SubRecord({
+    "list": ListOf(String()),
+    "auth_mechanisms": ListOf(String()),
+    "starttls": Boolean(),
+    "login_disabled": Boolean(),
+})
+
+# lib/sasl/sasl.go - Result
+imap_auth = SubRecord({
+    "advertised": ListOf(String()),
+    "accepted": String(),
+    "attempts": ListOf(SubRecord({
+        "username": String(),
+        "command": String(),
+        "mechanism": String(),
+        "success": Boolean(),
+        "response": String(),
+    })),
+})
+
 imap_scan_response = SubRecord({
     "result": SubRecord({
         "banner": String(doc="The IMAP banner."),
         "starttls": String(doc="The server's response to the STARTTLS command."),
+        "capability": String(doc="The server's response to the CAPABILITY command."),
+        "capabilities": imap_capabilities,
+        "capability_tls": String(doc="The server's response to the CAPABILITY command after the TLS handshake."),
+        "tls_capabilities": imap_capabilities,
+        "auth": imap_auth,
         "close": String(doc="The server's response to the CLOSE command."),
         "tls": zgrab2.tls_log,
     })
@@ -0,0 +1,37 @@
+# zschema sub-schema for zgrab2's ipmi module
+# Registers zgrab2-ipmi globally, and ipmi with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/ipmi/scanner.go - Results
+ipmi_scan_response = SubRecord({
+    "result": SubRecord({
+        "completion_code": Unsigned8BitInteger(),
+        "channel_number": Unsigned8BitInteger(),
+        "auth_types": ListOf(String(), doc="The IPMI 1.5 authentication types of the channel: none, md2, md5, password and oem."),
+        "ipmi_1_5": Boolean(),
+        "ipmi_2_0": Boolean(),
+        "kg_set": Boolean(doc="True if the BMC key (K_g) is not the default of zeros."),
+        "per_message_auth_disabled": Boolean(),
+        "user_level_auth_disabled": Boolean(),
+        "non_null_usernames": Boolean(),
+        "null_usernames": Boolean(),
+        "anonymous_login": Boolean(),
+        "oem_id": Unsigned32BitInteger(doc="The IANA enterprise number of the vendor of the OEM authentication type."),
+        "oem_name": String(examples=["Dell", "Super Micro"]),
+        "oem_data": Unsigned8BitInteger(),
+        "open_session": SubRecord({
+            "status_code": Unsigned8BitInteger(),
+            "status": String(),
+            "cipher_zero": Boolean(doc="True if the BMC opened an RMCP+ session with cipher suite zero."),
+        }),
+        "open_session_error": String(),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-ipmi", ipmi_scan_response)
+
+zgrab2.register_scan_response_type("ipmi", ipmi_scan_response)
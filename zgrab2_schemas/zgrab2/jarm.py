@@ -0,0 +1,19 @@
+# zschema sub-schema for zgrab2's jarm module
+# Registers zgrab2-jarm globally, and jarm with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/jarm/scanner.go - Results
+jarm_scan_response = SubRecord({
+    "result": SubRecord({
+        "hash": String(doc="The JARM hash, or 62 zeros if the server refused all the probes."),
+        "raw": String(doc="The cipher suite, version, ALPN protocol and extensions of the ten ServerHellos, separated by '|' and ','."),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-jarm", jarm_scan_response)
+
+zgrab2.register_scan_response_type("jarm", jarm_scan_response)
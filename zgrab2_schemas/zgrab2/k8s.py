@@ -0,0 +1,45 @@
+# zschema sub-schema for zgrab2's k8s module
+# Registers zgrab2-k8s globally, and k8s with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/k8s/scanner.go - Results
+k8s_scan_response = SubRecord({
+    "result": SubRecord({
+        "component": Enum(values=["apiserver", "kubelet"]),
+        "anonymous": Enum(values=["unauthorized", "forbidden", "allowed"], doc="The outcome of an anonymous request of /api (API server) or /pods (kubelet)."),
+        "version": SubRecord({
+            "major": String(),
+            "minor": String(),
+            "gitVersion": String(examples=["v1.27.4"]),
+            "gitCommit": String(),
+            "buildDate": String(),
+            "goVersion": String(),
+            "platform": String(examples=["linux/amd64"]),
+        }),
+        "healthz": String(examples=["ok"]),
+        "api_versions": ListOf(String()),
+        "pods_exposed": Boolean(doc="True if the kubelet listed its pods without credentials."),
+        "pod_count": Unsigned32BitInteger(),
+        "pods": ListOf(SubRecord({
+            "namespace": String(),
+            "name": String(),
+            "images": ListOf(String()),
+        })),
+        "stats_exposed": Boolean(doc="True if the kubelet returned /stats/summary without credentials."),
+        "node_name": String(),
+        "endpoints": ListOf(SubRecord({
+            "path": String(),
+            "status_code": Unsigned16BitInteger(),
+            "error": String(),
+        })),
+        "tls": zgrab2.tls_log,
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-k8s", k8s_scan_response)
+
+zgrab2.register_scan_response_type("k8s", k8s_scan_response)
@@ -0,0 +1,49 @@
+# zschema sub-schema for zgrab2's ldap module
+# Registers zgrab2-ldap globally, and ldap with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/ldap/messages.go - Result
+ldap_result = SubRecord({
+    "result_code": Unsigned32BitInteger(doc="The LDAP result code."),
+    "result_name": String(doc="The name of the result code.", examples=["success", "inappropriateAuthentication"]),
+    "matched_dn": String(),
+    "diagnostic_message": String(),
+})
+
+# modules/ldap/scanner.go - Results
+ldap_scan_response = SubRecord({
+    "result": SubRecord({
+        "starttls": ldap_result,
+        "bind": ldap_result,
+        "search": ldap_result,
+        "root_dse": SubRecord({
+            "naming_contexts": ListOf(String()),
+            "default_naming_context": String(),
+            "supported_ldap_version": ListOf(String()),
+            "supported_sasl_mechanisms": ListOf(String()),
+            "supported_control": ListOf(String()),
+            "supported_extension": ListOf(String()),
+            "vendor_name": String(),
+            "vendor_version": String(),
+            "dns_host_name": String(doc="The DNS name of an Active Directory domain controller."),
+            "server_name": String(),
+            "ldap_service_name": String(),
+            "domain_functionality": String(doc="The functional level of the Active Directory domain."),
+            "forest_functionality": String(),
+            "domain_controller_functionality": String(),
+            "attributes": ListOf(SubRecord({
+                "name": String(),
+                "values": ListOf(String()),
+            }), doc="All the attributes returned."),
+        }),
+        "tls": zgrab2.tls_log,
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-ldap", ldap_scan_response)
+
+zgrab2.register_scan_response_type("ldap", ldap_scan_response)
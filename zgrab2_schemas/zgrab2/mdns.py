@@ -0,0 +1,35 @@
+# zschema sub-schema for zgrab2's mdns module
+# Registers zgrab2-mdns globally, and mdns with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+mdns_instance = SubRecord({
+    "name": WhitespaceAnalyzedString(),
+    "service": String(examples=["_http._tcp.local."]),
+    "target": String(),
+    "port": Unsigned16BitInteger(),
+    "txt": ListOf(String()),
+})
+
+mdns_host = SubRecord({
+    "name": String(),
+    "addresses": ListOf(String()),
+})
+
+# modules/mdns/scanner.go - Results
+mdns_scan_response = SubRecord({
+    "result": SubRecord({
+        "service_types": ListOf(String()),
+        "instances": ListOf(mdns_instance),
+        "hosts": ListOf(mdns_host),
+        "query_length": Unsigned32BitInteger(),
+        "response_length": Unsigned32BitInteger(),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-mdns", mdns_scan_response)
+
+zgrab2.register_scan_response_type("mdns", mdns_scan_response)
@@ -0,0 +1,38 @@
+# zschema sub-schema for zgrab2's memcached module
+# Registers zgrab2-memcached globally, and memcached with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/memcached/scanner.go - Results
+memcached_scan_response = SubRecord({
+    "result": SubRecord({
+        "protocol": Enum(values=["text", "binary"]),
+        "transport": Enum(values=["tcp", "udp"]),
+        "version": String(examples=["1.6.21"]),
+        "stats": SubRecord({
+            "pid": Unsigned64BitInteger(),
+            "uptime": Unsigned64BitInteger(doc="The uptime of the server, in seconds."),
+            "threads": Unsigned64BitInteger(),
+            "curr_connections": Unsigned64BitInteger(),
+            "total_connections": Unsigned64BitInteger(),
+            "curr_items": Unsigned64BitInteger(),
+            "total_items": Unsigned64BitInteger(),
+            "bytes": Unsigned64BitInteger(doc="The size of the items stored."),
+            "limit_maxbytes": Unsigned64BitInteger(doc="The maximum size of the items stored."),
+        }),
+        "all_stats": ListOf(SubRecord({
+            "name": String(),
+            "value": String(),
+        }), doc="All the statistics returned, in order."),
+        "errors": ListOf(String(), doc="The errors reported by the server."),
+        "request_bytes": Unsigned32BitInteger(doc="The total size of the requests sent."),
+        "response_bytes": Unsigned32BitInteger(doc="The total size of the responses received."),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-memcached", memcached_scan_response)
+
+zgrab2.register_scan_response_type("memcached", memcached_scan_response)
@@ -37,6 +37,29 @@ exception_response = SubRecord({
     'exception_type': Unsigned8BitInteger(),
 })
 
+# modules/modbus/identification.go - DeviceIdentification
+device_identification = SubRecord({
+    'conformity_level': Unsigned8BitInteger(),
+    'objects': mei_object_set,
+    'exceptions': SubRecord({
+        'basic': exception_response,
+        'regular': exception_response,
+        'extended': exception_response,
+    }),
+    'error': String(),
+})
+
+# modules/modbus/registers.go - RegisterRead
+register_read = SubRecord({
+    'function_code': Unsigned8BitInteger(),
+    'address': Unsigned16BitInteger(),
+    'count': Unsigned16BitInteger(),
+    'bits': ListOf(Boolean()),
+    'registers': ListOf(Unsigned16BitInteger()),
+    'exception_response': exception_response,
+    'error': String(),
+})
+
 modbus_scan_response = SubRecord({
     'result': SubRecord({
         'length': Unsigned16BitInteger(),
@@ -46,6 +69,8 @@ modbus_scan_response = SubRecord({
         'mei_response': mei_response,
         'exception_response': exception_response,
         'raw': Binary(),
+        'device_identification': device_identification,
+        'reads': ListOf(register_read),
     })
 }, extends=zgrab2.base_scan_response)
 
@@ -7,6 +7,14 @@ import zschema.registry
 import zcrypto_schemas.zcrypto as zcrypto
 from . import zgrab2
 
+# modules/mongodb/auth.go - AuthResult
+mongodb_auth = SubRecord({
+    "attempts": ListOf(zgrab2.auth_attempt),
+    "success": Boolean(doc="True if one of the credentials was accepted."),
+    "databases": ListOf(String(), doc="The databases returned by listDatabases after a successful login."),
+    "query_error": String(),
+}, doc="The outcome of the --creds-file login attempts.")
+
 mongodb_scan_response = SubRecord({
     "result": SubRecord({
         "build_info": SubRecord({
@@ -31,7 +39,8 @@ mongodb_scan_response = SubRecord({
             "max_write_batch_size": Signed32BitInteger(),
             "logical_session_timeout_minutes": Signed32BitInteger(),
             "max_message_size_bytes": Signed32BitInteger(),
-            "read_only": Boolean()})})
+            "read_only": Boolean()}),
+        "auth": mongodb_auth})
 }, extends=zgrab2.base_scan_response)
 
 zschema.registry.register_schema("zgrab2-mongodb", mongodb_scan_response)
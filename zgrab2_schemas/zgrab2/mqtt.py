@@ -0,0 +1,32 @@
+# zschema sub-schema for zgrab2's mqtt module
+# Registers zgrab2-mqtt globally, and mqtt with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/mqtt/scanner.go - Results
+mqtt_scan_response = SubRecord({
+    "result": SubRecord({
+        "return_code": Unsigned8BitInteger(doc="The return code of the CONNACK."),
+        "return_code_name": String(examples=["accepted", "bad_username_or_password", "not_authorized"]),
+        "session_present": Boolean(),
+        "accepted": Boolean(doc="True if the broker accepted the connection."),
+        "anonymous": Boolean(doc="True if the broker accepted the connection without a user name."),
+        "sys": SubRecord({
+            "subscribed": Boolean(doc="True if the broker granted the subscription to $SYS/#."),
+            "version": String(doc="The payload of the first topic ending in /version.", examples=["mosquitto version 2.0.18"]),
+            "uptime": String(doc="The payload of the first topic ending in /uptime.", examples=["4242 seconds"]),
+            "topics": ListOf(SubRecord({
+                "topic": String(),
+                "payload": String(),
+            }), doc="The messages received on the $SYS topics."),
+        }),
+        "tls": zgrab2.tls_log,
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-mqtt", mqtt_scan_response)
+
+zgrab2.register_scan_response_type("mqtt", mqtt_scan_response)
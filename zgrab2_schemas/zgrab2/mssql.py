@@ -36,6 +36,21 @@ prelogin_options = SubRecord({
     "unknown": ListOf(unknown_prelogin_option),
 })
 
+# modules/mssql/scanner.go - AuthResult
+mssql_auth = SubRecord({
+    "attempts": ListOf(zgrab2.auth_attempt),
+    "success": Boolean(doc="True if one of the credentials was accepted."),
+    "login_ack": SubRecord({
+        "interface": Unsigned8BitInteger(),
+        "tds_version": Unsigned32BitInteger(),
+        "prog_name": String(),
+        "prog_version": String(),
+    }, doc="The LOGINACK token of the successful login."),
+    "version": WhitespaceAnalyzedString(doc="The result of SELECT @@VERSION after a successful login."),
+    "databases": ListOf(String(), doc="The databases of sys.databases, listed after a successful login."),
+    "query_error": String(),
+}, doc="The outcome of the --creds-file login attempts.")
+
 mssql_scan_response = SubRecord({
     "result": SubRecord({
         "version": WhitespaceAnalyzedString(),
@@ -43,6 +58,7 @@ mssql_scan_response = SubRecord({
         "prelogin_options": prelogin_options,
         "encrypt_mode": Enum(values=ENCRYPT_MODES, doc="The negotiated ENCRYPT_MODE with the server."),
         "tls": zgrab2.tls_log,
+        "auth": mssql_auth,
     })
 }, extends=zgrab2.base_scan_response)
 
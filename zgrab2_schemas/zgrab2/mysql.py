@@ -54,6 +54,15 @@ mysql_capability_flags = zgrab2.FlagsSet([
     "CLIENT_DEPRECATED_EOF",
 ], doc="The set of capability flags the server returned in the initial HandshakePacket. Each entry corresponds to a bit being set in the flags; key names correspond to the #defines in the MySQL docs.")
 
+# modules/mysql/scanner.go - AuthResult
+mysql_auth = SubRecord({
+    "attempts": ListOf(zgrab2.auth_attempt, doc="The login attempts, whose mechanism is the authentication plugin negotiated with the server."),
+    "success": Boolean(doc="True if one of the credentials was accepted."),
+    "version": WhitespaceAnalyzedString(doc="The result of SELECT @@version after a successful login."),
+    "databases": ListOf(String(), doc="The databases listed by SHOW DATABASES after a successful login."),
+    "query_error": String(),
+}, doc="The outcome of the --creds-file login attempts.")
+
 # zgrab2/modules/mysql.go: MySQLScanResults
 mysql_scan_response = SubRecord({
     "result": SubRecord({
@@ -71,6 +80,7 @@ mysql_scan_response = SubRecord({
         "error_message": WhitespaceAnalyzedString(doc="Optional string describing the error. Only set if there is an error."),
         "raw_packets": ListOf(Binary(), doc="The base64 encoding of all packets sent and received during the scan."),
         "tls": zgrab2.tls_log,
+        "auth": mysql_auth,
     })
 }, extends=zgrab2.base_scan_response)
 
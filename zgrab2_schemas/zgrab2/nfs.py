@@ -0,0 +1,31 @@
+# zschema sub-schema for zgrab2's nfs module
+# Registers zgrab2-nfs globally, and nfs with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/nfs/scanner.go - Results
+nfs_scan_response = SubRecord({
+    "result": SubRecord({
+        "programs": ListOf(SubRecord({
+            "program": Unsigned32BitInteger(),
+            "name": String(examples=["portmapper", "nfs", "mountd"]),
+            "version": Unsigned32BitInteger(),
+            "protocol": String(examples=["tcp", "udp"]),
+            "port": Unsigned32BitInteger(),
+        })),
+        "mount_port": Unsigned32BitInteger(doc="The TCP port of the MOUNT service called with --exports."),
+        "mount_error": String(),
+        "exports": ListOf(SubRecord({
+            "directory": String(),
+            "groups": ListOf(String(), doc="The groups of hosts allowed to mount the directory."),
+            "world_mountable": Boolean(doc="True if any host may mount the directory."),
+        })),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-nfs", nfs_scan_response)
+
+zgrab2.register_scan_response_type("nfs", nfs_scan_response)
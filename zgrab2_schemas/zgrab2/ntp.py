@@ -48,6 +48,41 @@ mode7_header = SubRecord({
     "item_size": Unsigned16BitInteger(),
 })
 
+# modules/ntp/control.go - ControlHeader
+mode6_header = SubRecord({
+    "version": Unsigned8BitInteger(),
+    "is_response": Boolean(),
+    "is_error": Boolean(),
+    "has_more": Boolean(),
+    "op_code": Unsigned8BitInteger(),
+    "sequence": Unsigned16BitInteger(),
+    "status": Unsigned16BitInteger(),
+    "association_id": Unsigned16BitInteger(),
+    "offset": Unsigned16BitInteger(),
+    "count": Unsigned16BitInteger(),
+})
+
+# modules/ntp/control.go - ReadVarResponse
+readvar_response = SubRecord({
+    # This is an unconstrained map[string]string of the system variables.
+    "variables": WhitespaceAnalyzedString(),
+    "version": String(),
+    "refid": String(),
+    "stratum": Unsigned8BitInteger(),
+    "status": Unsigned16BitInteger(),
+    "packets": Unsigned32BitInteger(),
+    "response_bytes": Unsigned32BitInteger(),
+    "header": mode6_header,
+})
+
+# modules/ntp/control.go - Amplification
+amplification = SubRecord({
+    "request_bytes": Unsigned32BitInteger(),
+    "response_bytes": Unsigned32BitInteger(),
+    "packets": Unsigned32BitInteger(),
+    "factor": Float(),
+})
+
 ntp_scan_response = SubRecord({
     "result": SubRecord({
         "version": Unsigned8BitInteger(),
@@ -55,6 +90,10 @@ ntp_scan_response = SubRecord({
         "time_response": ntp_header,
         "monlist_response": Binary(),
         "monlist_header": mode7_header,
+        "monlist_amplification": amplification,
+        "readvar": readvar_response,
+        "readvar_amplification": amplification,
+        "amplification_risk": Boolean(),
     })
 }, extends=zgrab2.base_scan_response)
 
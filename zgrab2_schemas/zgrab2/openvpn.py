@@ -0,0 +1,27 @@
+# zschema sub-schema for zgrab2's openvpn module
+# Registers zgrab2-openvpn globally, and openvpn with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/openvpn/scanner.go - Results
+openvpn_scan_response = SubRecord({
+    "result": SubRecord({
+        "transport": String(examples=["udp", "tcp"]),
+        "reset": Boolean(doc="True if the server answered with a hard reset."),
+        "tls_auth": Boolean(doc="True if the server accepted the TCP connection but did not answer the reset, as with tls-auth or tls-crypt."),
+        "opcode": String(examples=["P_CONTROL_HARD_RESET_SERVER_V2"]),
+        "key_id": Unsigned8BitInteger(),
+        "session_id": String(),
+        "acked_packet_ids": ListOf(Unsigned32BitInteger()),
+        "remote_session_id": String(),
+        "packet_id": Unsigned32BitInteger(),
+        "payload_length": Unsigned32BitInteger(),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-openvpn", openvpn_scan_response)
+
+zgrab2.register_scan_response_type("openvpn", openvpn_scan_response)
@@ -0,0 +1,37 @@
+# zschema sub-schema for zgrab2's pndcp module
+# Registers zgrab2-pndcp globally, and pndcp with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+pndcp_annotation = SubRecord({
+    "device_type": WhitespaceAnalyzedString(examples=["S7-1500"]),
+    "order_id": String(examples=["6ES7 516-3AN01-0AB0"]),
+    "hw_revision": String(examples=["5"]),
+    "sw_revision": String(examples=["V2.5.1"]),
+})
+
+pndcp_entry = SubRecord({
+    "object": String(examples=["dea00000-6c97-11d1-8271-0001010e002a"]),
+    "interface": String(examples=["dea00001-6c97-11d1-8271-00a02442df7d"]),
+    "interface_version": Unsigned16BitInteger(),
+    "annotation": WhitespaceAnalyzedString(),
+})
+
+# modules/pndcp/scanner.go - Results
+pndcp_scan_response = SubRecord({
+    "result": SubRecord({
+        "vendor_id": Unsigned16BitInteger(),
+        "device_id": Unsigned16BitInteger(),
+        "instance": Unsigned16BitInteger(),
+        "roles": ListOf(String(), examples=[["device", "controller"]]),
+        "annotation": pndcp_annotation,
+        "entries": ListOf(pndcp_entry),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-pndcp", pndcp_scan_response)
+
+zgrab2.register_scan_response_type("pndcp", pndcp_scan_response)
@@ -7,12 +7,38 @@ import zschema.registry
 import zcrypto_schemas.zcrypto as zcrypto
 from . import zgrab2
 
+# modules/pop3/auth.go - Capabilities
+pop3_capabilities = SubRecord({
+    "list": ListOf(String()),
+    "auth_mechanisms": ListOf(String()),
+    "starttls": Boolean(),
+    "user": Boolean(),
+})
+
+# lib/sasl/sasl.go - Result
+pop3_auth = SubRecord({
+    "advertised": ListOf(String()),
+    "accepted": String(),
+    "attempts": ListOf(SubRecord({
+        "username": String(),
+        "command": String(),
+        "mechanism": String(),
+        "success": Boolean(),
+        "response": String(),
+    })),
+})
+
 pop3_scan_response = SubRecord({
     "result": SubRecord({
         "banner": String(doc="The POP3 banner."),
         "noop": String(doc="The server's response to the NOOP command."),
         "help": String(doc="The server's response to the HELP command."),
         "starttls": String(doc="The server's response to the STARTTLS command."),
+        "capa": String(doc="The server's response to the CAPA command."),
+        "capabilities": pop3_capabilities,
+        "capa_tls": String(doc="The server's response to the CAPA command after the TLS handshake."),
+        "tls_capabilities": pop3_capabilities,
+        "auth": pop3_auth,
         "quit": String(doc="The server's response to the QUIT command."),
         "tls": zgrab2.tls_log,
     })
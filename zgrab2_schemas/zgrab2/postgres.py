@@ -52,6 +52,15 @@ postgres_key_data = SubRecord({
     "secret_key": Unsigned32BitInteger(),
 })
 
+# modules/postgres/auth.go - AuthResult
+postgres_auth = SubRecord({
+    "attempts": ListOf(zgrab2.auth_attempt),
+    "success": Boolean(doc="True if one of the credentials was accepted."),
+    "version": WhitespaceAnalyzedString(doc="The result of SELECT version() after a successful login."),
+    "databases": ListOf(String(), doc="The databases of pg_database, listed after a successful login."),
+    "query_error": String(),
+}, doc="The outcome of the --creds-file login attempts.")
+
 # modules/postgres/scanner.go: PostgresResults
 postgres_scan_response = SubRecord({
     "result": SubRecord({
@@ -65,6 +74,7 @@ postgres_scan_response = SubRecord({
         "server_parameters": WhitespaceAnalyzedString(),
         "backend_key_data": postgres_key_data,
         "transaction_status": WhitespaceAnalyzedString(),
+        "auth": postgres_auth,
     })
 }, extends=zgrab2.base_scan_response)
 
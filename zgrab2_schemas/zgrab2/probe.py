@@ -0,0 +1,30 @@
+# zschema sub-schema for zgrab2's probe module
+# Registers zgrab2-probe globally, and probe with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/probe/scanner.go - Results
+probe_scan_response = SubRecord({
+    "result": SubRecord({
+        "service": String(doc="The service named by the matching signature.", examples=["ftp", "ssh", "http"]),
+        "probe": String(doc="The name of the probe whose response matched.", examples=["NULL", "GetRequest"]),
+        "soft_match": Boolean(doc="True if only a soft signature, which does not give the version, matched."),
+        "pattern": String(doc="The pattern of the matching signature."),
+        "product": String(doc="The product name given by the signature."),
+        "version": String(doc="The version given by the signature."),
+        "info": String(doc="Extra information given by the signature."),
+        "hostname": String(doc="The hostname given by the signature."),
+        "os": String(doc="The operating system given by the signature."),
+        "device_type": String(doc="The device type given by the signature."),
+        "cpe": ListOf(String(), doc="The CPE names given by the signature."),
+        "response": Binary(doc="The response that matched, or if none did, the first non-empty response."),
+        "probes_sent": Unsigned32BitInteger(doc="The number of probes sent."),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-probe", probe_scan_response)
+
+zgrab2.register_scan_response_type("probe", probe_scan_response)
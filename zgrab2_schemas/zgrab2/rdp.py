@@ -0,0 +1,39 @@
+# zschema sub-schema for zgrab2's rdp module
+# Registers zgrab2-rdp globally, and rdp with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+rdp_protocols = ["rdp", "tls", "credssp", "rdstls", "credssp_early_user_auth"]
+
+# modules/rdp/negotiation.go - Negotiation
+rdp_negotiation = SubRecord({
+    "requested": ListOf(Enum(values=rdp_protocols), doc="The protocols offered in the request."),
+    "selected": String(doc="The protocol chosen by the server, if it accepted one.", examples=rdp_protocols),
+    "flags": SubRecord({
+        "extended_client_data_supported": Boolean(),
+        "dynvc_gfx_protocol_supported": Boolean(),
+        "restricted_admin_mode_supported": Boolean(),
+        "redirected_authentication_mode_supported": Boolean(),
+    }),
+    "failure": String(doc="The reason the server refused the request.", examples=["HYBRID_REQUIRED_BY_SERVER", "SSL_NOT_ALLOWED_BY_SERVER"]),
+    "failure_code": Unsigned32BitInteger(),
+    "legacy": Boolean(doc="True if the server confirmed the connection without negotiation data."),
+})
+
+# modules/rdp/scanner.go - Results
+rdp_scan_response = SubRecord({
+    "result": SubRecord({
+        "selected_protocol": String(doc="The protocol the server chose when offered TLS and CredSSP.", examples=rdp_protocols),
+        "supported_protocols": ListOf(Enum(values=rdp_protocols), doc="The protocols the server accepted."),
+        "nla_required": Boolean(doc="True if the server refused both standard RDP security and TLS without CredSSP."),
+        "negotiations": ListOf(rdp_negotiation),
+        "tls": zgrab2.tls_log,
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-rdp", rdp_scan_response)
+
+zgrab2.register_scan_response_type("rdp", rdp_scan_response)
@@ -19,7 +19,7 @@ redis_scan_response = SubRecord({
             "# Server\r\nredis_version:4.0.7\r\nkey2:value2\r\n",
             "(Error: NOAUTH Authentication required.)",
         ]),
-        "auth_response": String(doc="The response from the AUTH command, if sent."),
+        "auth_response": String(doc="The response from the AUTH command (with --username, if set, and --password), if sent."),
         "nonexistent_response": String(doc="The response from the NONEXISTENT command.", examples=[
             "(Error: ERR unknown command 'NONEXISTENT')",
         ]),
@@ -44,6 +44,15 @@ redis_scan_response = SubRecord({
             "arguments": String(doc="The arguments portion of the command sent."),
             "response": String(doc="The response from the sent command and arguments."),
         }), doc="The responses from the user-passed custom commands."),
+        # modules/redis/script.go - ScriptResponse
+        "script_responses": ListOf(SubRecord({
+            "command": String(doc="The command sent, in inline format."),
+            # This is an unconstrained map[string]string of the fields.
+            "fields": WhitespaceAnalyzedString(doc="The field:value lines of INFO and CLUSTER INFO, or the parameters and values of CONFIG GET."),
+            "values": ListOf(String(), doc="The elements of another array response."),
+            "response": String(doc="Another response, as a string."),
+            "error": String(doc="The error returned by the server."),
+        }), doc="The parsed responses to the commands of --script."),
     })
 }, extends=zgrab2.base_scan_response)
 
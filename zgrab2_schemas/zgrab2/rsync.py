@@ -0,0 +1,29 @@
+# zschema sub-schema for zgrab2's rsync module
+# Registers zgrab2-rsync globally, and rsync with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/rsync/scanner.go - Results
+rsync_scan_response = SubRecord({
+    "result": SubRecord({
+        "banner": String(doc="The greeting of the daemon.", examples=["@RSYNCD: 31.0 sha512 sha256 sha1 md5 md4"]),
+        "protocol_version": String(examples=["31.0"]),
+        "digests": ListOf(String(), doc="The checksums listed in the greeting, since protocol 31."),
+        "motd": String(doc="The message of the day."),
+        "modules": ListOf(SubRecord({
+            "name": String(),
+            "comment": String(),
+            "anonymous": Boolean(doc="True if the module was accepted without credentials."),
+            "auth_required": Boolean(doc="True if credentials were requested for the module."),
+            "error": String(doc="The error sent by the daemon if it refused the module."),
+        })),
+        "list_error": String(doc="The error sent by the daemon if it refused to list the modules."),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-rsync", rsync_scan_response)
+
+zgrab2.register_scan_response_type("rsync", rsync_scan_response)
@@ -0,0 +1,30 @@
+# zschema sub-schema for zgrab2's sip module
+# Registers zgrab2-sip globally, and sip with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/sip/scanner.go - Results
+sip_scan_response = SubRecord({
+    "result": SubRecord({
+        "transport": Enum(values=["udp", "tcp", "tls"]),
+        "version": String(examples=["SIP/2.0"]),
+        "status_code": Unsigned16BitInteger(),
+        "reason_phrase": String(),
+        "server": String(examples=["Asterisk PBX 18.15.0"]),
+        "user_agent": String(),
+        "allow": ListOf(String(), doc="The methods of the Allow header."),
+        "supported": ListOf(String(), doc="The extensions of the Supported header."),
+        "accept": ListOf(String()),
+        # TODO: This is an unconstrained map[string][]string of the headers,
+        # by canonical name.
+        "headers": WhitespaceAnalyzedString(),
+        "tls": zgrab2.tls_log,
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-sip", sip_scan_response)
+
+zgrab2.register_scan_response_type("sip", sip_scan_response)
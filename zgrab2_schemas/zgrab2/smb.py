@@ -40,8 +40,38 @@ session_setup_log = SubRecord(extended(header_log, {
     'setup_flags': Unsigned16BitInteger(),
     'target_name': String(),
     'negotiate_flags': Unsigned32BitInteger(),
+    'os_version': String(),
+    'netbios_computer_name': String(),
+    'netbios_domain_name': String(),
+    'dns_computer_name': String(),
+    'dns_domain_name': String(),
+    'dns_forest_name': String(),
 }))
 
+# lib/smb/smb/probe.go - SMBv1Log
+smbv1_log = SubRecord({
+    'security_mode': Unsigned8BitInteger(),
+    'signing_required': Boolean(),
+    'capabilities': Unsigned32BitInteger(),
+    'native_os': String(),
+    'native_lan_manager': String(),
+})
+
+# lib/smb/smb/shares.go - NullSessionLog
+null_session_log = SubRecord({
+    'allowed': Boolean(),
+    'session_flags': Unsigned16BitInteger(),
+    'ipc_share_flags': Unsigned32BitInteger(),
+    'shares': ListOf(SubRecord({
+        'name': String(),
+        'type': Unsigned32BitInteger(),
+        'type_name': Enum(values=['disk', 'printer', 'device', 'ipc']),
+        'special': Boolean(),
+        'remark': String(),
+    })),
+    'error': String(),
+})
+
 
 smb_scan_response = SubRecord({
     'result': SubRecord({
@@ -64,6 +94,11 @@ smb_scan_response = SubRecord({
         'negotiation_log': negotiate_log,
         'has_ntlm': Boolean(),
         'session_setup_log': session_setup_log,
+        'signing_required': Boolean(),
+        'encryption_required': Boolean(),
+        'supported_dialects': ListOf(String()),
+        'smbv1_log': smbv1_log,
+        'null_session': null_session_log,
     })
 }, extends=zgrab2.base_scan_response)
 
@@ -7,13 +7,43 @@ import zschema.registry
 import zcrypto_schemas.zcrypto as zcrypto
 from . import zgrab2
 
+# modules/smtp/extensions.go - Extensions
+smtp_extensions = SubRecord({
+    "domain": String(),
+    "keywords": ListOf(String()),
+    "size": Signed64BitInteger(),
+    "auth": ListOf(String()),
+    "starttls": Boolean(),
+    "pipelining": Boolean(),
+    "8bitmime": Boolean(),
+    "smtputf8": Boolean(),
+    "chunking": Boolean(),
+    "dsn": Boolean(),
+    "enhancedstatuscodes": Boolean(),
+})
+
+# modules/smtp/scanner.go - RelayCheck
+smtp_relay_check = SubRecord({
+    "steps": ListOf(SubRecord({
+        "command": String(),
+        "code": Unsigned16BitInteger(),
+        "response": String(),
+    })),
+    "open_relay": Boolean(),
+})
+
 smtp_scan_response = SubRecord({
     "result": SubRecord({
         "banner": String(),
         "ehlo": String(),
+        "extensions": smtp_extensions,
         "helo": String(),
         "help": String(),
         "starttls": String(),
+        "helo_tls": String(),
+        "ehlo_tls": String(),
+        "tls_extensions": smtp_extensions,
+        "relay": smtp_relay_check,
         "quit": String(),
         "tls": zgrab2.tls_log,
     })
@@ -0,0 +1,43 @@
+# zschema sub-schema for zgrab2's snmp module
+# Registers zgrab2-snmp globally, and snmp with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/snmp/scanner.go - Community
+snmp_community = SubRecord({
+    "community": String(doc="The first community string that was answered.", examples=["public"]),
+    "error_status": Unsigned8BitInteger(doc="The error status of the response, if not noError."),
+    "system": SubRecord({
+        "sys_descr": String(doc="sysDescr: a description of the device."),
+        "sys_object_id": String(doc="sysObjectID: the OID identifying the kind of device.", examples=["1.3.6.1.4.1.8072.3.2.10"]),
+        "sys_up_time": Unsigned32BitInteger(doc="sysUpTime: hundredths of a second since the agent started."),
+        "sys_contact": String(doc="sysContact"),
+        "sys_name": String(doc="sysName: the administrative name of the device."),
+        "sys_location": String(doc="sysLocation"),
+        "sys_services": Unsigned8BitInteger(doc="sysServices: the set of layers the device offers services at."),
+    }),
+})
+
+# modules/snmp/scanner.go - Results
+snmp_scan_response = SubRecord({
+    "result": SubRecord({
+        "v1": snmp_community,
+        "v2c": snmp_community,
+        "v3": SubRecord({
+            "engine_id": Binary(doc="The snmpEngineID of the agent."),
+            "enterprise": Unsigned32BitInteger(doc="The private enterprise number of the vendor that built the engine ID."),
+            "vendor": String(doc="The name of the vendor, if known.", examples=["Cisco", "Net-SNMP"]),
+            "format": String(doc="The format of the rest of the engine ID.", examples=["ipv4", "ipv6", "mac", "text", "octets", "enterprise", "legacy"]),
+            "data": String(doc="The rest of the engine ID, decoded for the address and text formats."),
+            "engine_boots": Unsigned32BitInteger(doc="The number of times the engine has restarted."),
+            "engine_time": Unsigned32BitInteger(doc="The number of seconds since the engine last restarted."),
+        }),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-snmp", snmp_scan_response)
+
+zgrab2.register_scan_response_type("snmp", snmp_scan_response)
@@ -0,0 +1,54 @@
+# zschema sub-schema for zgrab2's ssdp module
+# Registers zgrab2-ssdp globally, and ssdp with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+ssdp_service = SubRecord({
+    "service_type": String(),
+    "service_id": String(),
+    "control_url": String(),
+    "event_sub_url": String(),
+    "scpd_url": String(),
+})
+
+ssdp_device_fields = {
+    "device_type": String(),
+    "friendly_name": WhitespaceAnalyzedString(),
+    "manufacturer": WhitespaceAnalyzedString(),
+    "manufacturer_url": String(),
+    "model_description": WhitespaceAnalyzedString(),
+    "model_name": WhitespaceAnalyzedString(),
+    "model_number": String(),
+    "model_url": String(),
+    "serial_number": String(),
+    "udn": String(),
+    "presentation_url": String(),
+    "services": ListOf(ssdp_service),
+}
+
+# Embedded devices are only described one level deep.
+ssdp_embedded_device = SubRecord(dict(ssdp_device_fields))
+
+ssdp_device = SubRecord(dict(ssdp_device_fields, devices=ListOf(ssdp_embedded_device)))
+
+# modules/ssdp/scanner.go - Results
+ssdp_scan_response = SubRecord({
+    "result": SubRecord({
+        "status_code": Unsigned16BitInteger(),
+        "location": String(),
+        "server": WhitespaceAnalyzedString(examples=["Linux/3.14 UPnP/1.1 MiniUPnPd/2.1"]),
+        "usn": String(),
+        "st": String(),
+        # This is an unconstrained map[string]string of the response headers.
+        "headers": WhitespaceAnalyzedString(),
+        "device": ssdp_device,
+        "description_error": String(),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-ssdp", ssdp_scan_response)
+
+zgrab2.register_scan_response_type("ssdp", ssdp_scan_response)
@@ -233,6 +233,21 @@ AlgorithmSelection = SubRecordType({
     "server_to_client_alg_group": DirectionAlgorithms(),
 })
 
+# zgrab2/lib/ssh/log.go: AuthAttempt
+AuthAttempt = SubRecordType({
+    "username": String(),
+    "method": String(),
+    "success": Boolean(),
+    "error": String(),
+})
+
+# zgrab2/lib/ssh/log.go: HostKey
+HostKey = SubRecordType({
+    "algorithm": KeyAlgorithm(),
+    "key": SSHPublicKeyCert(),
+    "error": String(),
+})
+
 # zgrab2/lib/ssh/log.go: HandshakeLog
 # TODO: Can ssh re-use any of the generic TLS model?
 ssh_scan_response = SubRecord({
@@ -245,6 +260,8 @@ ssh_scan_response = SubRecord({
         "algorithm_selection": AlgorithmSelection(),
         "key_exchange": KeyExchange(),
         "userauth": ListOf(String()),
+        "userauth_attempts": ListOf(AuthAttempt()),
+        "host_keys": ListOf(HostKey()),
         "crypto": KexResult(),
     })
 }, extends=zgrab2.base_scan_response)
@@ -12,6 +12,29 @@ telnet_option = SubRecord({
     "value": Unsigned16BitInteger(),
 })
 
+# modules/telnet/negotiate.go - Negotiation
+telnet_negotiation = SubRecord({
+    "sender": Enum(values=["server", "client"]),
+    "command": Enum(values=["WILL", "WONT", "DO", "DONT", "SB"]),
+    "option": telnet_option,
+    "data": Binary(doc="The parameters of a subnegotiation."),
+})
+
+BANNER_TYPES = ["login_prompt", "password_prompt", "shell", "menu", "other"]
+
+# modules/telnet/login.go - LoginLog
+telnet_login = SubRecord({
+    "username": String(),
+    "steps": ListOf(SubRecord({
+        "input": Enum(values=["username", "password"]),
+        "response": String(),
+        "response_type": Enum(values=BANNER_TYPES),
+        "response_time_ms": Signed64BitInteger(doc="The time until the first byte of the response, in milliseconds."),
+    })),
+    "success": Boolean(doc="True if the last response is a shell prompt or a menu, without a failure message."),
+    "error": String(),
+})
+
 telnet_scan_response = SubRecord({
     "result": SubRecord({
         "banner": String(),
@@ -19,6 +42,9 @@ telnet_scan_response = SubRecord({
         "do": ListOf(telnet_option),
         "wont": ListOf(telnet_option),
         "dont": ListOf(telnet_option),
+        "negotiation": ListOf(telnet_negotiation, doc="The transcript of the option negotiation."),
+        "banner_type": Enum(values=BANNER_TYPES, doc="The classification of the banner, by its last line."),
+        "login": telnet_login,
     })
 }, extends=zgrab2.base_scan_response)
 
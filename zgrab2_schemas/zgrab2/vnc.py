@@ -0,0 +1,28 @@
+# zschema sub-schema for zgrab2's vnc module
+# Registers zgrab2-vnc globally, and vnc with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/vnc/scanner.go - Results
+vnc_scan_response = SubRecord({
+    "result": SubRecord({
+        "banner": String(doc="The protocol version sent by the server.", examples=["RFB 003.008\n", "RFB 003.889\n"]),
+        "protocol_version": Enum(values=["3.3", "3.7", "3.8"], doc="The protocol version the handshake used."),
+        "security_types": ListOf(SubRecord({
+            "id": Unsigned8BitInteger(),
+            "name": String(examples=["None", "VNC Authentication", "Apple Remote Desktop"]),
+        }), doc="The security types offered by the server."),
+        "no_auth": Boolean(doc="True if the server offers the None security type."),
+        "failure": String(doc="The reason the server gave for refusing the connection."),
+        "desktop_name": String(doc="The desktop name, if the handshake was completed."),
+        "framebuffer_width": Unsigned16BitInteger(),
+        "framebuffer_height": Unsigned16BitInteger(),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-vnc", vnc_scan_response)
+
+zgrab2.register_scan_response_type("vnc", vnc_scan_response)
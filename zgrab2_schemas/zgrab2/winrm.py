@@ -0,0 +1,33 @@
+# zschema sub-schema for zgrab2's winrm module
+# Registers zgrab2-winrm globally, and winrm with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/winrm/scanner.go - Results
+winrm_scan_response = SubRecord({
+    "result": SubRecord({
+        "identify_status_code": Signed32BitInteger(doc="The status code of the response to the unauthenticated Identify request."),
+        "identify": SubRecord({
+            "protocol_version": String(examples=["http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd"]),
+            "product_vendor": String(examples=["Microsoft Corporation"]),
+            "product_version": String(examples=["OS: 0.0.0 SP: 0.0 Stack: 3.0"]),
+            "security_profiles": ListOf(String()),
+        }),
+        "server": String(examples=["Microsoft-HTTPAPI/2.0"]),
+        "status_code": Signed32BitInteger(doc="The status code of the response to the Identify request without the unauthenticated mark."),
+        "challenges": ListOf(SubRecord({
+            "scheme": String(),
+            "realm": String(),
+            "algorithm": String(),
+        })),
+        "auth_schemes": ListOf(String(), examples=[["negotiate", "kerberos"], ["negotiate", "basic"]]),
+        "tls": zgrab2.tls_log,
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-winrm", winrm_scan_response)
+
+zgrab2.register_scan_response_type("winrm", winrm_scan_response)
@@ -0,0 +1,23 @@
+# zschema sub-schema for zgrab2's wireguard module
+# Registers zgrab2-wireguard globally, and wireguard with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/wireguard/scanner.go - Results
+wireguard_scan_response = SubRecord({
+    "result": SubRecord({
+        "response": String(examples=["handshake_response", "cookie_reply"]),
+        "response_length": Unsigned32BitInteger(),
+        "receiver_index": Boolean(doc="True if the receiver index of the response is the sender index of the initiation."),
+        "port_unreachable": Boolean(doc="True if an ICMP port unreachable error was received."),
+        "silent": Boolean(doc="True if nothing was received before the timeout."),
+        "rtt_seconds": Float(),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-wireguard", wireguard_scan_response)
+
+zgrab2.register_scan_response_type("wireguard", wireguard_scan_response)
@@ -0,0 +1,45 @@
+# zschema sub-schema for zgrab2's x11 module
+# Registers zgrab2-x11 globally, and x11 with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+x11_format = SubRecord({
+    "depth": Unsigned8BitInteger(),
+    "bits_per_pixel": Unsigned8BitInteger(),
+    "scanline_pad": Unsigned8BitInteger(),
+})
+
+x11_screen = SubRecord({
+    "width": Unsigned16BitInteger(),
+    "height": Unsigned16BitInteger(),
+    "width_mm": Unsigned16BitInteger(),
+    "height_mm": Unsigned16BitInteger(),
+    "root_depth": Unsigned8BitInteger(),
+})
+
+# modules/x11/scanner.go - Results
+x11_scan_response = SubRecord({
+    "result": SubRecord({
+        "status": String(examples=["success", "failed", "authenticate"]),
+        "access_granted": Boolean(),
+        "protocol_major": Unsigned16BitInteger(),
+        "protocol_minor": Unsigned16BitInteger(),
+        "reason": WhitespaceAnalyzedString(),
+        "vendor": WhitespaceAnalyzedString(examples=["The X.Org Foundation"]),
+        "release_number": Unsigned32BitInteger(),
+        "max_request_length": Unsigned16BitInteger(),
+        "image_byte_order": String(examples=["lsb_first", "msb_first"]),
+        "min_keycode": Unsigned8BitInteger(),
+        "max_keycode": Unsigned8BitInteger(),
+        "pixmap_formats": ListOf(x11_format),
+        "num_screens": Unsigned8BitInteger(),
+        "screens": ListOf(x11_screen),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-x11", x11_scan_response)
+
+zgrab2.register_scan_response_type("x11", x11_scan_response)
@@ -32,6 +32,7 @@ grab_result = Record({
     # TODO: ip may be required; see https://github.com/zmap/zgrab2/issues/104
     "ip": IPv4Address(required=False, doc="The IP address of the target."),
     "domain": String(required=False, doc="The domain name of the target, if available."),
+    "port": Unsigned16BitInteger(required=False, doc="The port scanned, if the input gave a list of ports for the target."),
     "data": SubRecord(scan_response_types, doc="The scan data for this host."),
 })
 
@@ -45,6 +46,7 @@ STATUS_VALUES = [
   "protocol-error",
   "application-error",
   "unknown-error",
+  "blocked",
 ]
 
 # zgrab2/module.go: ScanResponse
@@ -53,14 +55,134 @@ base_scan_response = SubRecord({
     "protocol": String(doc="The identifier of the protocol being scanned."),
     "timestamp": DateTime(doc="The time the scan was started."),
     "result": SubRecord({}, required=False),  # This is overridden by the protocols' implementations
-    "error": String(required=False, doc="If the status was not success, error may contain information about the failure.")
+    "error": String(required=False, doc="If the status was not success, error may contain information about the failure."),
+    "attempts": Unsigned8BitInteger(required=False, doc="The number of times the target was scanned, if it was retried after a transient failure (see --retries)."),
+    "elapsed": Float(required=False, doc="The time the scan took, in seconds."),
     # TODO: error_component? domain?
 })
 
+# zgrab2/ja3s.go: ServerHelloFingerprint
+server_hello_fingerprint = SubRecord({
+    "version": Unsigned16BitInteger(),
+    "cipher_suite": Unsigned16BitInteger(),
+    "extensions": ListOf(Unsigned16BitInteger(), doc="The extension types, in the order they were sent."),
+    "ja3s": String(doc="The JA3S string: the version, cipher suite and extensions, in decimal.", examples=["771,49199,65281-0-11-35-16"]),
+    "ja3s_hash": String(doc="The MD5 hash of the JA3S string."),
+})
+
+# zgrab2/tls.go: TLSVersionSupport
+tls_version_support = SubRecord({
+    "version": SubRecord({
+        "name": String(examples=["TLSv1.2"]),
+        "value": Unsigned16BitInteger(),
+    }),
+    "supported": Boolean(),
+    "cipher_suites": ListOf(SubRecord({
+        "hex": String(examples=["0xC02F"]),
+        "name": String(examples=["TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"]),
+        "value": Unsigned16BitInteger(),
+    }), doc="The cipher suites accepted with the version, in the order of the server's preference."),
+})
+
+# zgrab2/tls_resume.go: TLSResumption
+tls_resumption = SubRecord({
+    "session_id": Boolean(doc="Whether the server resumed the session by its session ID; absent if the handshake gave no session ID."),
+    "session_ticket": Boolean(doc="Whether the server resumed the session with its session ticket; absent if the handshake gave no ticket."),
+    "ticket_lifetime_hint": Unsigned32BitInteger(doc="The lifetime hint of the session ticket, in seconds."),
+    "tls13_psk": Boolean(doc="Whether the server resumed a TLS 1.3 session with a PSK; absent if the server does not support TLS 1.3 or sent no ticket."),
+    "error": String(),
+})
+
+# zgrab2/tls_ech.go: ECHResult
+ech_result = SubRecord({
+    "status": Enum(values=["accepted", "rejected", "ignored"], doc="Whether the server decrypted the Encrypted Client Hello, could not and sent retry configs, or sent none; absent if the handshake failed."),
+    "retry_configs": Binary(doc="The ECHConfigList sent by the server on rejection."),
+    "error": String(),
+})
+
+# zgrab2/tls_ech.go: TLSECH
+tls_ech = SubRecord({
+    "grease": ech_result,
+    "config_list": Binary(doc="The ECHConfigList of the HTTPS DNS record of the server name, if any."),
+    "config": ech_result,
+    "error": String(doc="The error that interrupted the probes, if any."),
+})
+
+# zgrab2/tls_ocsp.go: OCSPResponse
+ocsp_response = SubRecord({
+    "response_status": String(doc="The status of the response; the other fields are absent if it is not successful.", examples=["successful", "try_later"]),
+    "produced_at": DateTime(),
+    "responder_name": String(doc="The distinguished name of the responder, if identified by its name."),
+    "responder_key_hash": String(doc="The SHA-1 hash of the responder's public key, in hex, if identified by its key."),
+    "serial_number": String(doc="The serial number of the certificate, in decimal."),
+    "cert_status": Enum(values=["good", "revoked", "unknown"]),
+    "this_update": DateTime(),
+    "next_update": DateTime(),
+    "revoked_at": DateTime(),
+    "revocation_reason": String(examples=["key_compromise", "superseded"]),
+})
+
+# zgrab2/tls_ocsp.go: OCSPCheck
+ocsp_check = SubRecord({
+    "responder": String(doc="The URL of the OCSP responder queried."),
+    "response": ocsp_response,
+    "error": String(),
+})
+
+# zgrab2/tls_validate.go: ChainValidation
+chain_validation = SubRecord({
+    "store": String(doc="The name of the root store."),
+    "valid": Boolean(doc="Whether a chain to a root of the store was built, with a leaf valid for the server name."),
+    "chain": ListOf(String(), doc="The SHA-256 fingerprints of the certificates of the chain built, from the leaf to the root."),
+    "reason": Enum(values=["expired", "not_yet_valid", "unknown_ca", "hostname_mismatch", "invalid"]),
+    "error": String(),
+})
+
+# zgrab2/tls_vuln.go: TLSVulnCheck
+tls_vuln_check = SubRecord({
+    "verdict": Enum(values=["vulnerable", "not_vulnerable", "not_applicable", "inconclusive"]),
+    "detail": String(doc="The behavior of the server the verdict is based on."),
+    "error": String(),
+})
+
+# zgrab2/tls_vuln.go: TLSVulnChecks
+tls_vuln_checks = SubRecord({
+    "heartbleed": tls_vuln_check,
+    "robot": tls_vuln_check,
+    "ccs_injection": tls_vuln_check,
+})
+
+# zgrab2/tls_certificate_request.go: CertificateRequest
+certificate_request = SubRecord({
+    "certificate_types": ListOf(Unsigned8BitInteger(), doc="The types of the client certificates accepted."),
+    "signature_algorithms": ListOf(Unsigned16BitInteger(), doc="The signature algorithms accepted, in TLS 1.2."),
+    "certificate_authorities": ListOf(String(), doc="The distinguished names of the CAs whose certificates are accepted; absent if any CA is."),
+})
+
 # zgrab2/tls.go: TLSLog
 tls_log = SubRecord({
     "handshake_log": zcrypto.TLSHandshake(doc="The TLS handshake log."),
-    "heartbleed_log": zcrypto.HeartbleedLog(doc="The heartbleed scan log, if heartbleed scanning was enabled; otherwise, absent.")
+    "heartbleed_log": zcrypto.HeartbleedLog(doc="The heartbleed scan log, if heartbleed scanning was enabled; otherwise, absent."),
+    "server_hello_fingerprint": server_hello_fingerprint,
+    "stapled_ocsp": ocsp_response,
+    "enumeration": ListOf(tls_version_support, doc="The versions and cipher suites supported by the server, if --tls-enumerate was set."),
+    "enumeration_error": String(doc="The error that interrupted the enumeration, if any."),
+    "resumption": tls_resumption,
+    "ech": tls_ech,
+    "chain_validation": ListOf(chain_validation, doc="The validation of the chain against each --tls-root-store."),
+    "ocsp": ocsp_check,
+    "vuln_checks": tls_vuln_checks,
+    "certificate_request": certificate_request,
+})
+
+# zgrab2/lib/auth/attempt.go: Attempt
+auth_attempt = SubRecord({
+    "username": String(),
+    "mechanism": String(doc="The SASL mechanism used, or the authentication method of the protocol requested by the server."),
+    "success": Boolean(),
+    "error_code": String(doc="The error number, or the SQLSTATE of PostgreSQL, of the answer rejecting the credential."),
+    "error_message": WhitespaceAnalyzedString(),
+    "error": String(doc="Set if the attempt could not be completed."),
 })
 
 
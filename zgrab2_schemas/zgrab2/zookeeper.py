@@ -0,0 +1,37 @@
+# zschema sub-schema for zgrab2's zookeeper module
+# Registers zgrab2-zookeeper globally, and zookeeper with the main zgrab2 schema.
+from zschema.leaves import *
+from zschema.compounds import *
+import zschema.registry
+
+from . import zgrab2
+
+# modules/zookeeper/scanner.go - Results
+zookeeper_scan_response = SubRecord({
+    "result": SubRecord({
+        "ok": Boolean(doc="True if the server answered imok to ruok."),
+        "version": String(examples=["3.8.1-74db005175a4ec545697012f9069cb9dcc8cdda7"]),
+        "mode": String(examples=["standalone", "leader", "follower", "observer"]),
+        "latency": String(doc="The min/avg/max latency."),
+        "received": Signed64BitInteger(),
+        "sent": Signed64BitInteger(),
+        "connections": Unsigned32BitInteger(),
+        "outstanding": Unsigned32BitInteger(),
+        "zxid": String(),
+        "node_count": Unsigned32BitInteger(),
+        # These are unconstrained map[string]string of the properties
+        # listed by envi and conf.
+        "environment": WhitespaceAnalyzedString(),
+        "config": WhitespaceAnalyzedString(),
+        "blocked": ListOf(String(), doc="The commands refused as not in the whitelist."),
+        "commands": ListOf(SubRecord({
+            "name": String(),
+            "response": String(),
+            "error": String(),
+        })),
+    })
+}, extends=zgrab2.base_scan_response)
+
+zschema.registry.register_schema("zgrab2-zookeeper", zookeeper_scan_response)
+
+zgrab2.register_scan_response_type("zookeeper", zookeeper_scan_response)